@@ -35,6 +35,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/runutil"
@@ -136,6 +137,14 @@ func runCompact(
 		Name: "thanos_compact_garbage_collected_blocks_total",
 		Help: "Total number of blocks marked for deletion by compactor.",
 	})
+	blocksRewritten := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_blocks_rewritten_total",
+		Help: "Total number of blocks rewritten by compactor to apply deletion requests.",
+	})
+	blocksRepaired := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_blocks_repaired_total",
+		Help: "Total number of corrupted blocks repaired by compactor.",
+	})
 	_ = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
 		Name: "thanos_delete_delay_seconds",
 		Help: "Configured delete delay in seconds.",
@@ -187,6 +196,46 @@ func runCompact(
 		return err
 	}
 
+	retentionContentYaml, err := conf.retentionPoliciesConf.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of retention policies configuration")
+	}
+
+	retentionPolicies, err := compact.ParseRetentionPolicies(retentionContentYaml)
+	if err != nil {
+		return err
+	}
+
+	downsamplingLevels, additionalRetentions, err := parseDownsamplingLevels(conf.downsamplingLevels)
+	if err != nil {
+		return err
+	}
+
+	retentionByResolution := map[compact.ResolutionLevel]time.Duration{
+		compact.ResolutionLevelRaw: time.Duration(conf.retentionRaw),
+		compact.ResolutionLevel5m:  time.Duration(conf.retentionFiveMin),
+		compact.ResolutionLevel1h:  time.Duration(conf.retentionOneHr),
+	}
+
+	if retentionByResolution[compact.ResolutionLevelRaw].Seconds() != 0 {
+		level.Info(logger).Log("msg", "retention policy of raw samples is enabled", "duration", retentionByResolution[compact.ResolutionLevelRaw])
+	}
+	if retentionByResolution[compact.ResolutionLevel5m].Seconds() != 0 {
+		level.Info(logger).Log("msg", "retention policy of 5 min aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel5m])
+	}
+	if retentionByResolution[compact.ResolutionLevel1h].Seconds() != 0 {
+		level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
+	}
+	for res, retention := range additionalRetentions {
+		retentionByResolution[res] = retention
+		if retention.Seconds() != 0 {
+			level.Info(logger).Log("msg", "retention policy of additional aggregated samples is enabled", "resolution", time.Duration(res)*time.Millisecond, "duration", retention)
+		}
+	}
+	if len(retentionPolicies) > 0 {
+		level.Info(logger).Log("msg", "retention policies by external labels are enabled", "policies", len(retentionPolicies))
+	}
+
 	// Ensure we close up everything properly.
 	defer func() {
 		if err != nil {
@@ -223,14 +272,31 @@ func runCompact(
 		"/loaded",
 		component,
 	)
-	api := blocksAPI.NewBlocksAPI(logger, conf.label, flagsMap)
+	api := blocksAPI.NewBlocksAPI(logger, conf.label, flagsMap, nil)
+	compactionStatus := compact.NewStatusTracker()
+	api.SetCompactionStatus(func() interface{} { return compactionStatus.Status() })
+	bucketReporter := compact.NewBucketReporter(logger, reg, retentionByResolution, retentionPolicies)
+	api.SetBucketReport(func() interface{} {
+		if r := bucketReporter.Report(); r != nil {
+			return r
+		}
+		return nil
+	})
 	noCompactMarkerFilter := compact.NewGatherNoCompactionMarkFilter(logger, bkt)
+	shardingFilter, err := compact.NewGroupShardingFilter(conf.shards, conf.shardIndex, conf.dedupReplicaLabels)
+	if err != nil {
+		return errors.Wrap(err, "create sharding filter")
+	}
+	if conf.shards > 1 {
+		level.Info(logger).Log("msg", "compaction groups are sharded", "shards", conf.shards, "shardIndex", conf.shardIndex)
+	}
 	var sy *compact.Syncer
 	{
 		// Make sure all compactor meta syncs are done through Syncer.SyncMeta for readability.
 		cf := baseMetaFetcher.NewMetaFetcher(
 			extprom.WrapRegistererWithPrefix("thanos_", reg), []block.MetadataFilter{
 				block.NewLabelShardedMetaFilter(relabelConfig),
+				shardingFilter,
 				block.NewConsistencyDelayMetaFilter(logger, conf.consistencyDelay, extprom.WrapRegistererWithPrefix("thanos_", reg)),
 				ignoreDeletionMarkFilter,
 				duplicateBlocksFilter,
@@ -240,6 +306,10 @@ func runCompact(
 		cf.UpdateOnChange(func(blocks []metadata.Meta, err error) {
 			compactorView.Set(blocks, err)
 			api.SetLoaded(blocks, err)
+			compactionStatus.SetMarkedForDeletion(ignoreDeletionMarkFilter.DeletionMarkBlocks())
+			if err == nil {
+				bucketReporter.Update(blocks, time.Now())
+			}
 		})
 		sy, err = compact.NewSyncer(
 			logger,
@@ -266,6 +336,18 @@ func runCompact(
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+
+	if r, ok := bkt.(objstore.ExpirationRulesReader); ok {
+		// Not all credentials are allowed to read the lifecycle configuration, so the check is best effort.
+		if rules, err := r.ExpirationRules(ctx); objstore.IsNotSupportedErr(err) {
+			level.Debug(logger).Log("msg", "bucket does not provide object lifecycle rules, blocks are not checked against them")
+		} else if err != nil {
+			level.Warn(logger).Log("msg", "failed to get object lifecycle rules of the bucket, blocks are not checked against them", "err", err)
+		} else {
+			bucketReporter.SetExpirationRules(rules)
+		}
+	}
+
 	// Instantiate the compactor with different time slices. Timestamps in TSDB
 	// are in milliseconds.
 	comp, err := tsdb.NewLeveledCompactor(ctx, reg, logger, levels, downsample.NewPool())
@@ -273,15 +355,20 @@ func runCompact(
 		cancel()
 		return errors.Wrap(err, "create compactor")
 	}
+	var blockCompactor compact.Compactor = comp
+	if conf.dedupFunc == compact.PenaltyDedupFunc && enableVerticalCompaction {
+		blockCompactor = compact.NewPenaltyDedupCompactor(ctx, logger, conf.dedupReplicaLabels, comp)
+	}
 
 	var (
 		compactDir      = path.Join(conf.dataDir, "compact")
 		downsamplingDir = path.Join(conf.dataDir, "downsample")
+		rewriteDir      = path.Join(conf.dataDir, "rewrite")
 	)
 
-	if err := os.RemoveAll(downsamplingDir); err != nil {
+	if err := os.RemoveAll(rewriteDir); err != nil {
 		cancel()
-		return errors.Wrap(err, "clean working downsample directory")
+		return errors.Wrap(err, "clean working rewrite directory")
 	}
 
 	grouper := compact.NewDefaultGrouper(
@@ -294,6 +381,14 @@ func runCompact(
 		garbageCollectedBlocks,
 	)
 	blocksCleaner := compact.NewBlocksCleaner(logger, bkt, ignoreDeletionMarkFilter, deleteDelay, blocksCleaned, blockCleanupFailures)
+	deletionRewriter := compact.NewDeletionRewriter(
+		logger,
+		bkt,
+		comp,
+		rewriteDir,
+		blocksRewritten,
+		blocksMarked.WithLabelValues(metadata.DeletionMarkFilename),
+	)
 	compactor, err := compact.NewBucketCompactor(
 		logger,
 		sy,
@@ -304,33 +399,24 @@ func runCompact(
 			int64(conf.maxBlockIndexSize),
 			blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename),
 		),
-		comp,
+		blockCompactor,
 		compactDir,
 		bkt,
 		conf.compactionConcurrency,
+		compactionStatus,
+		conf.skipOrRepairCorrupted,
+		blocksRepaired,
+		blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename),
 	)
 	if err != nil {
 		cancel()
 		return errors.Wrap(err, "create bucket compactor")
 	}
 
-	retentionByResolution := map[compact.ResolutionLevel]time.Duration{
-		compact.ResolutionLevelRaw: time.Duration(conf.retentionRaw),
-		compact.ResolutionLevel5m:  time.Duration(conf.retentionFiveMin),
-		compact.ResolutionLevel1h:  time.Duration(conf.retentionOneHr),
-	}
-
-	if retentionByResolution[compact.ResolutionLevelRaw].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of raw samples is enabled", "duration", retentionByResolution[compact.ResolutionLevelRaw])
-	}
-	if retentionByResolution[compact.ResolutionLevel5m].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of 5 min aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel5m])
-	}
-	if retentionByResolution[compact.ResolutionLevel1h].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
-	}
-
-	var cleanMtx sync.Mutex
+	var (
+		cleanMtx                 sync.Mutex
+		lastOrphanedObjectsClean time.Time
+	)
 	// TODO(GiedriusS): we could also apply retention policies here but the logic would be a bit more complex.
 	cleanPartialMarked := func() error {
 		cleanMtx.Lock()
@@ -341,6 +427,19 @@ func runCompact(
 		if err := blocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
 			return errors.Wrap(err, "cleaning marked blocks")
 		}
+		// Finding orphaned objects lists all the provider objects, so it is done less often than the other cleanups.
+		if c, ok := bkt.(objstore.OrphanedObjectsCleaner); ok && conf.cleanupOrphanedObjectsInterval > 0 &&
+			time.Since(lastOrphanedObjectsClean) >= conf.cleanupOrphanedObjectsInterval {
+			lastOrphanedObjectsClean = time.Now()
+			// Objects are uploaded well before the delete delay, so their leftovers are safe to remove.
+			if n, err := c.CleanOrphanedObjects(ctx, "", deleteDelay); objstore.IsNotSupportedErr(err) {
+				level.Debug(logger).Log("msg", "bucket does not leave orphaned objects behind, nothing to clean")
+			} else if err != nil {
+				level.Error(logger).Log("msg", "failed to clean orphaned objects", "err", err)
+			} else if n > 0 {
+				level.Info(logger).Log("msg", "cleaned orphaned objects", "objects", n)
+			}
+		}
 
 		if err := sy.SyncMetas(ctx); err != nil {
 			level.Error(logger).Log("msg", "failed to sync metas", "err", err)
@@ -360,6 +459,15 @@ func runCompact(
 	}
 
 	compactMainFn := func() error {
+		if conf.enableDeletionRequests {
+			if err := sy.SyncMetas(ctx); err != nil {
+				return errors.Wrap(err, "sync before applying deletion requests")
+			}
+			if err := deletionRewriter.Rewrite(ctx, sy.Metas()); err != nil {
+				return errors.Wrap(err, "apply deletion requests")
+			}
+		}
+
 		if err := compactor.Compact(ctx); err != nil {
 			return errors.Wrap(err, "compaction")
 		}
@@ -378,7 +486,7 @@ func runCompact(
 				downsampleMetrics.downsamples.WithLabelValues(groupKey)
 				downsampleMetrics.downsampleFailures.WithLabelValues(groupKey)
 			}
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir); err != nil {
+			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir, conf.downsampleConcurrency, downsamplingLevels, nil); err != nil {
 				return errors.Wrap(err, "first pass of downsampling failed")
 			}
 
@@ -386,9 +494,21 @@ func runCompact(
 			if err := sy.SyncMetas(ctx); err != nil {
 				return errors.Wrap(err, "sync before second pass of downsampling")
 			}
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir); err != nil {
+			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir, conf.downsampleConcurrency, downsamplingLevels, nil); err != nil {
 				return errors.Wrap(err, "second pass of downsampling failed")
 			}
+
+			// Run one more pass for each additional level, so that the blocks downsampled by a pass are downsampled
+			// to the next level by the following one.
+			for pass := 3; pass <= len(downsamplingLevels); pass++ {
+				level.Info(logger).Log("msg", "start next pass of downsampling", "pass", pass)
+				if err := sy.SyncMetas(ctx); err != nil {
+					return errors.Wrapf(err, "sync before pass %d of downsampling", pass)
+				}
+				if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, sy.Metas(), downsamplingDir, conf.downsampleConcurrency, downsamplingLevels, nil); err != nil {
+					return errors.Wrapf(err, "pass %d of downsampling failed", pass)
+				}
+			}
 			level.Info(logger).Log("msg", "downsampling iterations done")
 		} else {
 			level.Info(logger).Log("msg", "downsampling was explicitly disabled")
@@ -399,7 +519,7 @@ func runCompact(
 			return errors.Wrap(err, "sync before first pass of downsampling")
 		}
 
-		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, sy.Metas(), retentionByResolution, blocksMarked.WithLabelValues(metadata.DeletionMarkFilename)); err != nil {
+		if err := compact.ApplyRetentionPolicies(ctx, logger, bkt, sy.Metas(), retentionByResolution, retentionPolicies, blocksMarked.WithLabelValues(metadata.DeletionMarkFilename)); err != nil {
 			return errors.Wrap(err, "retention failed")
 		}
 
@@ -457,6 +577,8 @@ func runCompact(
 		global := ui.NewBucketUI(logger, conf.label, conf.webConf.externalPrefix, conf.webConf.prefixHeaderName, "/global", component)
 		global.Register(r, false, ins)
 
+		ui.NewCompactionsUI(logger, conf.webConf.externalPrefix, conf.webConf.prefixHeaderName, "/compactions", compactionStatus).Register(r, ins)
+
 		// Configure Request Logging for HTTP calls.
 		opts := []logging.Option{logging.WithDecider(func() logging.Decision {
 			return logging.NoLogCall
@@ -526,15 +648,24 @@ type compactConfig struct {
 	objStore                                       extflag.PathOrContent
 	consistencyDelay                               time.Duration
 	retentionRaw, retentionFiveMin, retentionOneHr model.Duration
+	retentionPoliciesConf                          extflag.PathOrContent
 	wait                                           bool
 	waitInterval                                   time.Duration
 	disableDownsampling                            bool
+	downsamplingLevels                             []string
 	blockSyncConcurrency                           int
 	blockViewerSyncBlockInterval                   time.Duration
 	cleanupBlocksInterval                          time.Duration
+	cleanupOrphanedObjectsInterval                 time.Duration
 	compactionConcurrency                          int
+	downsampleConcurrency                          int
+	shards                                         int
+	shardIndex                                     int
+	enableDeletionRequests                         bool
+	skipOrRepairCorrupted                          bool
 	deleteDelay                                    model.Duration
 	dedupReplicaLabels                             []string
+	dedupFunc                                      string
 	selectorRelabelConf                            extflag.PathOrContent
 	webConf                                        webConfig
 	label                                          string
@@ -567,6 +698,9 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("0d").SetValue(&cc.retentionFiveMin)
 	cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. Setting this to 0d will retain samples of this resolution forever").
 		Default("0d").SetValue(&cc.retentionOneHr)
+	cc.retentionPoliciesConf = *extflag.RegisterPathOrContent(cmd, "retention.policies-config",
+		"YAML file with the list of retention policies by external labels. The retention of each block is overridden by the first policy whose selector matches "+
+			"the block external labels, e.g. '{tenant=\"team-a\"}'. Resolutions without a retention in the policy keep the retention of the retention.resolution-* flags.", false)
 
 	// TODO(kakkoyun, pgough): https://github.com/thanos-io/thanos/issues/2266.
 	cmd.Flag("wait", "Do not exit after all compactions have been processed and wait for new work.").
@@ -577,6 +711,7 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("downsampling.disable", "Disables downsampling. This is not recommended "+
 		"as querying long time ranges without non-downsampled data is not efficient and useful e.g it is not possible to render all samples for a human eye anyway").
 		Default("false").BoolVar(&cc.disableDownsampling)
+	downsamplingLevelsFlag(cmd).StringsVar(&cc.downsamplingLevels)
 
 	cmd.Flag("block-sync-concurrency", "Number of goroutines to use when syncing block metadata from object storage.").
 		Default("20").IntVar(&cc.blockSyncConcurrency)
@@ -584,10 +719,35 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		Default("1m").DurationVar(&cc.blockViewerSyncBlockInterval)
 	cmd.Flag("compact.cleanup-interval", "How often we should clean up partially uploaded blocks and blocks with deletion mark in the background when --wait has been enabled. Setting it to \"0s\" disables it - the cleaning will only happen at the end of an iteration.").
 		Default("5m").DurationVar(&cc.cleanupBlocksInterval)
+	cmd.Flag("compact.cleanup-orphaned-objects-interval", "How often we should clean up the objects left behind by failed uploads or overwrites, e.g. the segments of Swift large objects, "+
+		"along with the other cleanups. Finding them lists all the objects of the provider. Setting it to \"0s\" disables it - the objects can be cleaned with 'thanos tools bucket cleanup' instead.").
+		Default("24h").DurationVar(&cc.cleanupOrphanedObjectsInterval)
 
 	cmd.Flag("compact.concurrency", "Number of goroutines to use when compacting groups.").
 		Default("1").IntVar(&cc.compactionConcurrency)
 
+	cmd.Flag("downsample.concurrency", "Number of goroutines to use when downsampling blocks.").
+		Default("1").IntVar(&cc.downsampleConcurrency)
+
+	cmd.Flag("compact.shards", "Number of shards the compaction groups are split into. Each compactor instance processes only the groups "+
+		"whose hash of external labels (without the deduplication replica labels) modulo the number of shards equals --compact.shard-index. "+
+		"All resolutions of a group are owned by the same shard. Every shard has to be run by exactly one compactor.").
+		Default("1").IntVar(&cc.shards)
+	cmd.Flag("compact.shard-index", "Index of the shard of the compaction groups processed by this compactor, in range [0, --compact.shards).").
+		Default("0").IntVar(&cc.shardIndex)
+
+	cmd.Flag("compact.enable-deletion-requests", fmt.Sprintf("Apply the deletion requests of the bucket. Deletion requests are JSON files in the %s/ directory of the bucket, "+
+		"each with a 'selector' of the series to delete, and an optional 'min_time' and 'max_time' in milliseconds. "+
+		"Blocks with series to delete are rewritten without the deleted samples. This process is irreversible. "+
+		"Downsampled blocks are rewritten only if the deletion covers the whole block time range.", compact.DeletionRequestsDir)).
+		Default("false").BoolVar(&cc.enableDeletionRequests)
+
+	cmd.Flag("compact.skip-or-repair-corrupted", "Do not halt the compactions on blocks with not healthy index, for example with out-of-order or duplicated chunks. "+
+		"Such blocks are rewritten without the duplicated, out-of-order and outside chunks instead. "+
+		"If a block cannot be repaired, for example because its overlapping chunks have different data, it is marked for no compaction (no-compact-mark.json is uploaded) "+
+		"which causes this block to be excluded from any compaction.").
+		Default("false").BoolVar(&cc.skipOrRepairCorrupted)
+
 	cmd.Flag("delete-delay", "Time before a block marked for deletion is deleted from bucket. "+
 		"If delete-delay is non zero, blocks will be marked for deletion and compactor component will delete blocks marked for deletion from the bucket. "+
 		"If delete-delay is 0, blocks will be deleted straight away. "+
@@ -595,11 +755,15 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"or compactor is ignoring the deletion because it's compacting the block at the same time.").
 		Default("48h").SetValue(&cc.deleteDelay)
 
-	cmd.Flag("deduplication.replica-label", "Label to treat as a replica indicator of blocks that can be deduplicated (repeated flag). This will merge multiple replica blocks into one. This process is irreversible."+
-		"Experimental. When it is set to true, compactor will ignore the given labels so that vertical compaction can merge the blocks."+
-		"Please note that this uses a NAIVE algorithm for merging (no smart replica deduplication, just chaining samples together)."+
-		"This works well for deduplication of blocks with **precisely the same samples** like produced by Receiver replication.").
-		Hidden().StringsVar(&cc.dedupReplicaLabels)
+	cmd.Flag("deduplication.replica-label", "Label to treat as a replica indicator of blocks that can be deduplicated (repeated flag). This will merge multiple replica blocks into one. This process is irreversible. "+
+		"When it is set, compactor will ignore the given labels so that vertical compaction can merge the blocks. "+
+		"The samples of the replicas are merged according to --deduplication.func.").
+		StringsVar(&cc.dedupReplicaLabels)
+	cmd.Flag("deduplication.func", "Deduplication algorithm for merging the overlapping blocks of the replicas. "+
+		"Default is the chain based deduplication, which just chains the samples together and works well for blocks with **precisely the same samples** like produced by Receiver replication. "+
+		"If set to 'penalty', the penalty based deduplication used by the querier is applied instead, which works well for blocks of HA Prometheus replicas scraping at different times. "+
+		"Downsampled blocks are always merged with the chain based deduplication.").
+		Default("").EnumVar(&cc.dedupFunc, "", compact.PenaltyDedupFunc)
 
 	// TODO(bwplotka): This is short term fix for https://github.com/thanos-io/thanos/issues/1424, replace with vertical block sharding https://github.com/thanos-io/thanos/pull/3390.
 	cmd.Flag("compact.block-max-index-size", "Maximum index size for the resulted block during any compaction. Note that"+
@@ -6,11 +6,31 @@
 package main
 
 import (
+	"context"
 	"net/url"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/alecthomas/units"
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/run"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+	"golang.org/x/time/rate"
+
+	"github.com/thanos-io/thanos/pkg/accounting"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
+	"github.com/thanos-io/thanos/pkg/objstore/client"
+	"github.com/thanos-io/thanos/pkg/reloader"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/server/http/auth"
 )
 
 type grpcConfig struct {
@@ -55,9 +75,86 @@ func (hc *httpConfig) registerFlag(cmd extkingpin.FlagClause) *httpConfig {
 	return hc
 }
 
+// newHTTPAuthMiddleware returns the middleware authenticating the HTTP requests with the configuration of the given
+// flag, or nil if it is not set.
+func newHTTPAuthMiddleware(logger log.Logger, reg prometheus.Registerer, conf *extflag.PathOrContent) (*auth.Middleware, error) {
+	confYAML, err := conf.Content()
+	if err != nil {
+		return nil, err
+	}
+	if len(confYAML) == 0 {
+		return nil, nil
+	}
+	cfg, err := auth.Parse(confYAML)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse HTTP auth configuration")
+	}
+	return auth.NewMiddleware(log.With(logger, "component", "http-auth"), reg, cfg, nil)
+}
+
+type accountingConfig struct {
+	enabled        bool
+	reportInterval time.Duration
+	objStoreConfig *extflag.PathOrContent
+}
+
+func (ac *accountingConfig) registerFlag(cmd extkingpin.FlagClause) *accountingConfig {
+	cmd.Flag("accounting.enabled",
+		"Track the usage of each tenant, e.g. for chargeback. The usage is exposed as the thanos_accounting_* metrics, and written as usage reports to the bucket of --objstore-accounting.config, if any.").
+		Default("false").BoolVar(&ac.enabled)
+	cmd.Flag("accounting.report-interval",
+		"Interval at which the usage reports are written to the bucket.").
+		Default("1h").DurationVar(&ac.reportInterval)
+	ac.objStoreConfig = extkingpin.RegisterCommonObjStoreFlags(cmd, "-accounting", false, "If defined, the usage reports of --accounting.enabled are written to this bucket. See details: https://thanos.io/tip/operating/usage-accounting.md")
+	return ac
+}
+
+// accountant returns the accountant of the usage of the tenants, or nil if accounting is disabled. The usage reports
+// are written periodically to the bucket, if any.
+func (ac *accountingConfig) accountant(g *run.Group, logger log.Logger, reg *prometheus.Registry, comp component.Component) (*accounting.Accountant, error) {
+	confContentYaml, err := ac.objStoreConfig.Content()
+	if err != nil {
+		return nil, err
+	}
+	if !ac.enabled {
+		if len(confContentYaml) > 0 {
+			return nil, errors.New("--objstore-accounting.config* parameters require --accounting.enabled")
+		}
+		return nil, nil
+	}
+
+	source, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "get hostname to identify the usage reports")
+	}
+	accountant := accounting.NewAccountant(reg, comp.String(), source)
+	if len(confContentYaml) == 0 {
+		return accountant, nil
+	}
+
+	bkt, err := client.NewBucket(logger, confContentYaml, nil, comp.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "create accounting bucket client")
+	}
+	logger = log.With(logger, "component", "accounting")
+	ctx, cancel := context.WithCancel(context.Background())
+	g.Add(func() error {
+		defer runutil.CloseWithLogOnErr(logger, bkt, "accounting bucket client")
+
+		accountant.Run(ctx, logger, bkt, ac.reportInterval)
+		return nil
+	}, func(error) {
+		cancel()
+	})
+	return accountant, nil
+}
+
 type prometheusConfig struct {
-	url          *url.URL
-	readyTimeout time.Duration
+	url                *url.URL
+	readyTimeout       time.Duration
+	getConfigInterval  time.Duration
+	getConfigTimeout   time.Duration
+	labelsMaxStaleness time.Duration
 }
 
 func (pc *prometheusConfig) registerFlag(cmd extkingpin.FlagClause) *prometheusConfig {
@@ -67,6 +164,15 @@ func (pc *prometheusConfig) registerFlag(cmd extkingpin.FlagClause) *prometheusC
 	cmd.Flag("prometheus.ready_timeout",
 		"Maximum time to wait for the Prometheus instance to start up").
 		Default("10m").DurationVar(&pc.readyTimeout)
+	cmd.Flag("prometheus.get_config_interval",
+		"How often to get the Prometheus config, to refresh its external labels. It is used as a heartbeat of Prometheus as well.").
+		Default("30s").DurationVar(&pc.getConfigInterval)
+	cmd.Flag("prometheus.get_config_timeout",
+		"Timeout for getting the Prometheus config.").
+		Default("5s").DurationVar(&pc.getConfigTimeout)
+	cmd.Flag("prometheus.external_labels_max_staleness",
+		"Maximum time the external labels are served from cache while they cannot be refreshed from Prometheus, before being marked as stale in the Info API. 0 means they are never marked as stale.").
+		Default("5m").DurationVar(&pc.labelsMaxStaleness)
 	return pc
 }
 
@@ -97,9 +203,12 @@ func (tc *tsdbConfig) registerFlag(cmd extkingpin.FlagClause) *tsdbConfig {
 type reloaderConfig struct {
 	confFile        string
 	envVarConfFile  string
+	extraConfFiles  []string
+	confTemplate    bool
 	ruleDirectories []string
 	watchInterval   time.Duration
 	retryInterval   time.Duration
+	delayInterval   time.Duration
 }
 
 func (rc *reloaderConfig) registerFlag(cmd extkingpin.FlagClause) *reloaderConfig {
@@ -109,6 +218,12 @@ func (rc *reloaderConfig) registerFlag(cmd extkingpin.FlagClause) *reloaderConfi
 	cmd.Flag("reloader.config-envsubst-file",
 		"Output file for environment variable substituted config file.").
 		Default("").StringVar(&rc.envVarConfFile)
+	cmd.Flag("reloader.extra-config-file",
+		"Additional config file watched by the reloader, in the <path>[:<output file>] format. The output file, if set, is written like the one of --reloader.config-envsubst-file. The value is split on its last ':', so a path containing ':' requires an output file (repeated field).").
+		PlaceHolder("<path>[:<output file>]").StringsVar(&rc.extraConfFiles)
+	cmd.Flag("reloader.config-template",
+		"Render the output files of the config files watched by the reloader as Go templates, after environment variable substitution. The templates can use the env function to get environment variables.").
+		Default("false").BoolVar(&rc.confTemplate)
 	cmd.Flag("reloader.rule-dir",
 		"Rule directories for the reloader to refresh (repeated field).").
 		StringsVar(&rc.ruleDirectories)
@@ -118,19 +233,47 @@ func (rc *reloaderConfig) registerFlag(cmd extkingpin.FlagClause) *reloaderConfi
 	cmd.Flag("reloader.retry-interval",
 		"Controls how often reloader retries config reload in case of error.").
 		Default("5s").DurationVar(&rc.retryInterval)
+	cmd.Flag("reloader.delay-interval",
+		"Controls how long reloader waits for no more changes of the config and rules before reloading them. 0 reloads them after each change.").
+		Default("0s").DurationVar(&rc.delayInterval)
 
 	return rc
 }
 
+// cfgFiles returns the config files watched by the reloader.
+func (rc *reloaderConfig) cfgFiles() ([]reloader.CfgFile, error) {
+	var files []reloader.CfgFile
+	if rc.confFile != "" {
+		files = append(files, reloader.CfgFile{Path: rc.confFile, OutputPath: rc.envVarConfFile, Template: rc.confTemplate})
+	}
+	for _, f := range rc.extraConfFiles {
+		// Split on the last ':' so that the path can contain ':' if an output file is given.
+		file := reloader.CfgFile{Path: f, Template: rc.confTemplate}
+		if i := strings.LastIndex(f, ":"); i >= 0 {
+			file.Path, file.OutputPath = f[:i], f[i+1:]
+			if file.OutputPath == "" {
+				return nil, errors.Errorf("empty output file of extra config file %q", f)
+			}
+		}
+		if file.Path == "" {
+			return nil, errors.Errorf("empty path of extra config file %q", f)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
 type shipperConfig struct {
 	uploadCompacted       bool
 	ignoreBlockSize       bool
 	allowOutOfOrderUpload bool
+	upload                shipperUploadConfig
+	annotations           map[string]string
 }
 
 func (sc *shipperConfig) registerFlag(cmd extkingpin.FlagClause) *shipperConfig {
 	cmd.Flag("shipper.upload-compacted",
-		"If true shipper will try to upload compacted blocks as well. Useful for migration purposes. Works only if compaction is disabled on Prometheus. Do it once and then disable the flag when done.").
+		"If true shipper will try to upload compacted blocks as well, and blocks created externally, e.g. by backfilling. Blocks whose sources are all in the bucket already are skipped, and blocks overlapping with the bucket are not uploaded. Useful for migration purposes. Works only if compaction is disabled on Prometheus. Do it once and then disable the flag when done.").
 		Default("false").BoolVar(&sc.uploadCompacted)
 	cmd.Flag("shipper.ignore-unequal-block-size",
 		"If true shipper will not require prometheus min and max block size flags to be set to the same value. Only use this if you want to keep long retention and compaction enabled on your Prometheus instance, as in the worst case it can result in ~2h data loss for your Thanos bucket storage.").
@@ -140,9 +283,68 @@ func (sc *shipperConfig) registerFlag(cmd extkingpin.FlagClause) *shipperConfig
 			"This can trigger compaction without those blocks and as a result will create an overlap situation. Set it to true if you have vertical compaction enabled and wish to upload blocks as soon as possible without caring"+
 			"about order.").
 		Default("false").Hidden().BoolVar(&sc.allowOutOfOrderUpload)
+	sc.upload.registerFlag(cmd)
+	sc.annotations = map[string]string{}
+	cmd.Flag("shipper.annotation", shipperAnnotationHelp).PlaceHolder("KEY=VALUE").StringMapVar(&sc.annotations)
 	return sc
 }
 
+const shipperAnnotationHelp = "Annotation added to the meta.json of the uploaded blocks, e.g. pipeline=v2 (repeated flag). " +
+	"The name of the host and the version of Thanos are always added, so that the blocks can be traced back to their producer."
+
+// shipperAnnotations returns the annotations of the blocks uploaded by the shipper, i.e. the name of the host and
+// the version of Thanos, and the given annotations.
+func shipperAnnotations(flagAnnotations map[string]string) (map[string]string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "get hostname")
+	}
+	annotations := map[string]string{
+		metadata.ProducerAnnotation: hostname,
+		metadata.VersionAnnotation:  version.Version,
+	}
+	for k, v := range flagAnnotations {
+		annotations[k] = v
+	}
+	return annotations, nil
+}
+
+type shipperUploadConfig struct {
+	concurrency    int
+	bandwidthLimit units.Base2Bytes
+	resume         bool
+}
+
+func (uc *shipperUploadConfig) registerFlag(cmd extkingpin.FlagClause) *shipperUploadConfig {
+	cmd.Flag("shipper.upload-concurrency",
+		"Number of files of a block uploaded concurrently.").
+		Default("1").IntVar(&uc.concurrency)
+	cmd.Flag("shipper.upload-bandwidth-limit",
+		"Maximum bandwidth of the block uploads, per second. 0 means no limit.").
+		Default("0B").BytesVar(&uc.bandwidthLimit)
+	cmd.Flag("shipper.upload-resume",
+		"If true, a failed block upload is kept in the bucket, and the files of the block already in the bucket with the same size and SHA256 checksum are not uploaded again when it is retried. The checksums are computed by downloading the files. The partial block is cleaned by the compactor if it is never completed.").
+		Default("false").BoolVar(&uc.resume)
+	return uc
+}
+
+// uploadOptions returns the options of the block uploads of the shipper.
+func (uc *shipperUploadConfig) uploadOptions() block.UploadOptions {
+	opts := block.UploadOptions{
+		Concurrency: uc.concurrency,
+		Resume:      uc.resume,
+	}
+	if uc.bandwidthLimit > 0 {
+		// The burst allows reading files by chunks of up to 1MiB at most.
+		burst := int(uc.bandwidthLimit)
+		if burst > 1024*1024 {
+			burst = 1024 * 1024
+		}
+		opts.RateLimiter = rate.NewLimiter(rate.Limit(uc.bandwidthLimit), burst)
+	}
+	return opts
+}
+
 type webConfig struct {
 	externalPrefix   string
 	prefixHeaderName string
@@ -0,0 +1,49 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/reloader"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestReloaderConfig_CfgFiles(t *testing.T) {
+	for _, tcase := range []struct {
+		extraConfFiles []string
+		expected       []reloader.CfgFile
+		expectErr      bool
+	}{
+		{
+			extraConfFiles: []string{"/etc/prom/scrape.yaml"},
+			expected:       []reloader.CfgFile{{Path: "/etc/prom/scrape.yaml"}},
+		},
+		{
+			extraConfFiles: []string{"/etc/prom/scrape.yaml:/out/scrape.yaml"},
+			expected:       []reloader.CfgFile{{Path: "/etc/prom/scrape.yaml", OutputPath: "/out/scrape.yaml"}},
+		},
+		{
+			extraConfFiles: []string{"/etc/prom/a:b.yaml:/out/a.yaml"},
+			expected:       []reloader.CfgFile{{Path: "/etc/prom/a:b.yaml", OutputPath: "/out/a.yaml"}},
+		},
+		{
+			extraConfFiles: []string{":/out/scrape.yaml"},
+			expectErr:      true,
+		},
+		{
+			extraConfFiles: []string{"/etc/prom/scrape.yaml:"},
+			expectErr:      true,
+		},
+	} {
+		rc := &reloaderConfig{extraConfFiles: tcase.extraConfFiles}
+		files, err := rc.cfgFiles()
+		if tcase.expectErr {
+			testutil.NotOk(t, err)
+			continue
+		}
+		testutil.Ok(t, err)
+		testutil.Equals(t, tcase.expected, files)
+	}
+}
@@ -5,8 +5,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -16,6 +21,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/thanos-io/thanos/pkg/block"
@@ -23,13 +29,16 @@ import (
 	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/extflag"
+	"github.com/thanos-io/thanos/pkg/extkingpin"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 type DownsampleMetrics struct {
@@ -52,6 +61,76 @@ func newDownsampleMetrics(reg *prometheus.Registry) *DownsampleMetrics {
 	return m
 }
 
+// downsamplingLevelsFlag registers the flag of the additional downsampling levels of the given command.
+func downsamplingLevelsFlag(cmd extkingpin.FlagClause) *kingpin.FlagClause {
+	return cmd.Flag("downsampling.additional-level", "Additional downsampling level in the <resolution>:<min-range>[:<retention>] format, e.g. 1d:14d:10y (repeated flag). "+
+		"The blocks of the previous level are downsampled to the resolution once their time range is at least min-range. "+
+		"The downsampled blocks are retained for the retention, or forever if it is not set. The 5m and 1h levels are always enabled.").
+		PlaceHolder("<level>")
+}
+
+// parseDownsamplingLevels returns the downsampling levels with the additional ones of the given flag values, and the
+// retention of each additional resolution.
+func parseDownsamplingLevels(flagLevels []string) (downsample.Levels, map[compact.ResolutionLevel]time.Duration, error) {
+	var (
+		additional []downsample.Level
+		retentions = map[compact.ResolutionLevel]time.Duration{}
+	)
+	for _, s := range flagLevels {
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 && len(parts) != 3 {
+			return nil, nil, errors.Errorf("invalid downsampling level %q, expected <resolution>:<min-range>[:<retention>]", s)
+		}
+		var durations [3]time.Duration
+		for i, p := range parts {
+			d, err := model.ParseDuration(p)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "parse downsampling level %q", s)
+			}
+			durations[i] = time.Duration(d)
+		}
+		l := downsample.Level{Resolution: durations[0].Milliseconds(), MinRange: durations[1].Milliseconds()}
+		additional = append(additional, l)
+		retentions[compact.ResolutionLevel(l.Resolution)] = durations[2]
+	}
+
+	levels, err := downsample.NewLevels(additional...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return levels, retentions, nil
+}
+
+func downsamplingResolutionsFlag(cmd extkingpin.FlagClause) *kingpin.FlagClause {
+	return cmd.Flag("downsampling.additional-resolution", "Additional downsampling resolution of the blocks in object storage, e.g. 1d (repeated flag). "+
+		"It has to match an additional downsampling level of the compactor. The raw, 5m and 1h resolutions are always enabled.").
+		PlaceHolder("<resolution>")
+}
+
+// parseDownsamplingResolutions returns all the downsampling resolutions, in milliseconds and from the finest to
+// the coarsest, including the additional ones of the given flag values.
+func parseDownsamplingResolutions(flagResolutions []string) ([]int64, error) {
+	resolutions := downsample.DefaultLevels.Resolutions()
+	for _, s := range flagResolutions {
+		d, err := model.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse downsampling resolution %q", s)
+		}
+		res := time.Duration(d).Milliseconds()
+		if res <= downsample.ResLevel0 {
+			return nil, errors.Errorf("invalid downsampling resolution %q", s)
+		}
+		for _, r := range resolutions {
+			if r == res {
+				return nil, errors.Errorf("duplicated downsampling resolution %q", s)
+			}
+		}
+		resolutions = append(resolutions, res)
+	}
+	sort.Slice(resolutions, func(i, j int) bool { return resolutions[i] < resolutions[j] })
+	return resolutions, nil
+}
+
 func RunDownsample(
 	g *run.Group,
 	logger log.Logger,
@@ -61,6 +140,11 @@ func RunDownsample(
 	dataDir string,
 	objStoreConfig *extflag.PathOrContent,
 	comp component.Component,
+	downsampleConcurrency int,
+	levels downsample.Levels,
+	blockIDs []ulid.ULID,
+	minTime, maxTime int64,
+	resolution int64,
 ) error {
 	confContentYaml, err := objStoreConfig.Content()
 	if err != nil {
@@ -112,19 +196,27 @@ func RunDownsample(
 				metrics.downsamples.WithLabelValues(groupKey)
 				metrics.downsampleFailures.WithLabelValues(groupKey)
 			}
-			if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir); err != nil {
-				return errors.Wrap(err, "downsampling failed")
-			}
-
-			level.Info(logger).Log("msg", "start second pass of downsampling")
-			metas, _, err = metaFetcher.Fetch(ctx)
+			filter, err := newDownsampleFilter(metas, levels, blockIDs, minTime, maxTime, resolution)
 			if err != nil {
-				return errors.Wrap(err, "sync before second pass of downsampling")
+				return err
 			}
-			if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir); err != nil {
+			if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir, downsampleConcurrency, levels, filter); err != nil {
 				return errors.Wrap(err, "downsampling failed")
 			}
 
+			// Run one more pass for each additional level, so that the blocks downsampled by a pass are downsampled
+			// to the next level by the following one.
+			for pass := 2; pass <= len(levels); pass++ {
+				level.Info(logger).Log("msg", "start next pass of downsampling", "pass", pass)
+				metas, _, err = metaFetcher.Fetch(ctx)
+				if err != nil {
+					return errors.Wrapf(err, "sync before pass %d of downsampling", pass)
+				}
+				if err := downsampleBucket(ctx, logger, metrics, bkt, metas, dataDir, downsampleConcurrency, levels, filter); err != nil {
+					return errors.Wrap(err, "downsampling failed")
+				}
+			}
+
 			return nil
 		}, func(error) {
 			cancel()
@@ -151,6 +243,52 @@ func RunDownsample(
 	return nil
 }
 
+// downsampleFilter selects the blocks of the downsampling plan to downsample. A nil filter selects all of them.
+type downsampleFilter func(m *metadata.Meta) bool
+
+// newDownsampleFilter returns a filter selecting the blocks overlapping [mint, maxt] whose downsampled version with the
+// given levels has a resolution up to the given one. If block IDs are given, only these blocks and the blocks
+// downsampled from them are selected, so that they are downsampled up to the given resolution.
+func newDownsampleFilter(metas map[ulid.ULID]*metadata.Meta, levels downsample.Levels, ids []ulid.ULID, mint, maxt, resolution int64) (downsampleFilter, error) {
+	selected := make(map[ulid.ULID]struct{}, len(ids))
+	sources := map[ulid.ULID]struct{}{}
+	for _, id := range ids {
+		m, ok := metas[id]
+		if !ok {
+			return nil, errors.Errorf("block %s not found in the bucket", id)
+		}
+		selected[id] = struct{}{}
+		for _, s := range m.Compaction.Sources {
+			sources[s] = struct{}{}
+		}
+	}
+
+	return func(m *metadata.Meta) bool {
+		if m.MinTime > maxt || m.MaxTime <= mint {
+			return false
+		}
+		if next, ok := levels.Next(m.Thanos.Downsample.Resolution); !ok || next.Resolution > resolution {
+			return false
+		}
+		if len(ids) == 0 {
+			return true
+		}
+		if _, ok := selected[m.ULID]; ok {
+			return true
+		}
+		// Downsampled blocks have the same sources as the blocks they are downsampled from.
+		if m.Thanos.Downsample.Resolution == downsample.ResLevel0 {
+			return false
+		}
+		for _, s := range m.Compaction.Sources {
+			if _, ok := sources[s]; !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
 func downsampleBucket(
 	ctx context.Context,
 	logger log.Logger,
@@ -158,139 +296,265 @@ func downsampleBucket(
 	bkt objstore.Bucket,
 	metas map[ulid.ULID]*metadata.Meta,
 	dir string,
-) error {
-	if err := os.RemoveAll(dir); err != nil {
-		return errors.Wrap(err, "clean working directory")
+	concurrency int,
+	levels downsample.Levels,
+	filter downsampleFilter,
+) (rerr error) {
+	if concurrency <= 0 {
+		return errors.Errorf("invalid downsampling concurrency level (%d), concurrency level must be > 0", concurrency)
 	}
+	// The working directory is not cleaned up at the beginning, so that downsampling resumes
+	// from the progress of blocks downloaded or downsampled before a restart.
 	if err := os.MkdirAll(dir, 0777); err != nil {
 		return errors.Wrap(err, "create dir")
 	}
 
 	defer func() {
+		// Keep the progress for the next attempt on failure.
+		if rerr != nil {
+			return
+		}
 		if err := os.RemoveAll(dir); err != nil {
 			level.Error(logger).Log("msg", "failed to remove downsample cache directory", "path", dir, "err", err)
 		}
 	}()
 
-	// mapping from a hash over all source IDs to blocks. We don't need to downsample a block
-	// if a downsampled version with the same hash already exists.
-	sources5m := map[ulid.ULID]struct{}{}
-	sources1h := map[ulid.ULID]struct{}{}
+	toDownsample, err := downsamplingPlan(metas, levels)
+	if err != nil {
+		return err
+	}
+	if filter != nil {
+		var filtered []*metadata.Meta
+		for _, m := range toDownsample {
+			if filter(m) {
+				filtered = append(filtered, m)
+			}
+		}
+		toDownsample = filtered
+	}
+
+	var (
+		wg                     sync.WaitGroup
+		workCtx, workCtxCancel = context.WithCancel(ctx)
+		metaChan               = make(chan *metadata.Meta)
+		errChan                = make(chan error, concurrency)
+	)
+	defer workCtxCancel()
+
+	// Set up workers who will downsample the blocks, until they encounter an error.
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range metaChan {
+				// The plan only has blocks with a next level.
+				next, _ := levels.Next(m.Thanos.Downsample.Resolution)
+				if err := processDownsampling(workCtx, logger, bkt, m, dir, next.Resolution); err != nil {
+					metrics.downsampleFailures.WithLabelValues(compact.DefaultGroupKey(m.Thanos)).Inc()
+					errChan <- errors.Wrapf(err, "downsampling to %s", time.Duration(next.Resolution)*time.Millisecond)
+					return
+				}
+				metrics.downsamples.WithLabelValues(compact.DefaultGroupKey(m.Thanos)).Inc()
+			}
+		}()
+	}
+
+	var errs errutil.MultiError
+metaLoop:
+	for _, m := range toDownsample {
+		select {
+		case err := <-errChan:
+			errs.Add(err)
+			break metaLoop
+		case metaChan <- m:
+		}
+	}
+	close(metaChan)
+	wg.Wait()
+
+	// Collect any other error reported by the workers.
+	close(errChan)
+	for err := range errChan {
+		errs.Add(err)
+	}
+	return errs.Err()
+}
+
+// downsamplingPlan returns the blocks to downsample with the given levels, which are the blocks without downsampled
+// version big enough to be downsampled.
+func downsamplingPlan(metas map[ulid.ULID]*metadata.Meta, levels downsample.Levels) ([]*metadata.Meta, error) {
+	// mapping from each resolution to the sources of its blocks. We don't need to downsample a block
+	// if a downsampled version with the same sources already exists.
+	sources := map[int64]map[ulid.ULID]struct{}{}
+	for _, r := range levels.Resolutions() {
+		sources[r] = map[ulid.ULID]struct{}{}
+	}
 
 	for _, m := range metas {
-		switch m.Thanos.Downsample.Resolution {
-		case downsample.ResLevel0:
+		res, ok := sources[m.Thanos.Downsample.Resolution]
+		if !ok {
+			return nil, errors.Errorf("unexpected downsampling resolution %d", m.Thanos.Downsample.Resolution)
+		}
+		if m.Thanos.Downsample.Resolution == downsample.ResLevel0 {
 			continue
-		case downsample.ResLevel1:
-			for _, id := range m.Compaction.Sources {
-				sources5m[id] = struct{}{}
-			}
-		case downsample.ResLevel2:
-			for _, id := range m.Compaction.Sources {
-				sources1h[id] = struct{}{}
-			}
-		default:
-			return errors.Errorf("unexpected downsampling resolution %d", m.Thanos.Downsample.Resolution)
+		}
+		for _, id := range m.Compaction.Sources {
+			res[id] = struct{}{}
 		}
 	}
 
+	var toDownsample []*metadata.Meta
 	for _, m := range metas {
-		switch m.Thanos.Downsample.Resolution {
-		case downsample.ResLevel0:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources5m[id]; !ok {
-					missing = true
-					break
-				}
-			}
-			if !missing {
-				continue
-			}
-			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
-			// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
-			// blocks. Otherwise we may never downsample some data.
-			if m.MaxTime-m.MinTime < downsample.DownsampleRange0 {
-				continue
-			}
-			if err := processDownsampling(ctx, logger, bkt, m, dir, downsample.ResLevel1); err != nil {
-				metrics.downsampleFailures.WithLabelValues(compact.DefaultGroupKey(m.Thanos)).Inc()
-				return errors.Wrap(err, "downsampling to 5 min")
-			}
-			metrics.downsamples.WithLabelValues(compact.DefaultGroupKey(m.Thanos)).Inc()
-
-		case downsample.ResLevel1:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources1h[id]; !ok {
-					missing = true
-					break
-				}
-			}
-			if !missing {
-				continue
-			}
-			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
-			// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
-			// blocks. Otherwise we may never downsample some data.
-			if m.MaxTime-m.MinTime < downsample.DownsampleRange1 {
-				continue
-			}
-			if err := processDownsampling(ctx, logger, bkt, m, dir, downsample.ResLevel2); err != nil {
-				metrics.downsampleFailures.WithLabelValues(compact.DefaultGroupKey(m.Thanos)).Inc()
-				return errors.Wrap(err, "downsampling to 60 min")
+		next, ok := levels.Next(m.Thanos.Downsample.Resolution)
+		if !ok {
+			continue
+		}
+		missing := false
+		for _, id := range m.Compaction.Sources {
+			if _, ok := sources[next.Resolution][id]; !ok {
+				missing = true
+				break
 			}
-			metrics.downsamples.WithLabelValues(compact.DefaultGroupKey(m.Thanos)).Inc()
 		}
+		if !missing {
+			continue
+		}
+		// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
+		// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
+		// blocks. Otherwise we may never downsample some data.
+		if m.MaxTime-m.MinTime < next.MinRange {
+			continue
+		}
+		toDownsample = append(toDownsample, m)
 	}
-	return nil
+	return toDownsample, nil
 }
 
-func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bucket, m *metadata.Meta, dir string, resolution int64) error {
-	begin := time.Now()
-	bdir := filepath.Join(dir, m.ULID.String())
+// downsampleProgress is the progress of the downsampling of a block, persisted in the working directory
+// so that downsampling resumes after a restart instead of downloading and downsampling the block again.
+type downsampleProgress struct {
+	// Resolution is the resolution the block is downsampled to.
+	Resolution int64 `json:"resolution"`
+	// Downloaded is true once the block is downloaded and its index verified.
+	Downloaded bool `json:"downloaded"`
+	// Result is the ID of the downsampled block once it is written and its index verified.
+	Result ulid.ULID `json:"result"`
+}
+
+func progressFilename(dir string, id ulid.ULID) string {
+	return filepath.Join(dir, id.String()+".progress.json")
+}
 
-	err := block.Download(ctx, logger, bkt, m.ULID, bdir)
+// readDownsampleProgress reads the progress of the downsampling of the given block to the given resolution.
+// Progress of blocks not found in the working directory is ignored.
+func readDownsampleProgress(logger log.Logger, dir string, id ulid.ULID, resolution int64) downsampleProgress {
+	var p downsampleProgress
+	b, err := ioutil.ReadFile(progressFilename(dir, id))
 	if err != nil {
-		return errors.Wrapf(err, "download block %s", m.ULID)
+		if !os.IsNotExist(err) {
+			level.Warn(logger).Log("msg", "failed to read downsampling progress, starting over", "id", id, "err", err)
+		}
+		return downsampleProgress{Resolution: resolution}
+	}
+	if err := json.Unmarshal(b, &p); err != nil || p.Resolution != resolution {
+		level.Warn(logger).Log("msg", "invalid downsampling progress, starting over", "id", id, "err", err)
+		return downsampleProgress{Resolution: resolution}
+	}
+	if p.Downloaded && !exists(filepath.Join(dir, id.String(), metadata.MetaFilename)) {
+		return downsampleProgress{Resolution: resolution}
 	}
-	level.Info(logger).Log("msg", "downloaded block", "id", m.ULID, "duration", time.Since(begin))
+	if p.Result != (ulid.ULID{}) && !exists(filepath.Join(dir, p.Result.String(), metadata.MetaFilename)) {
+		p.Result = ulid.ULID{}
+	}
+	return p
+}
 
-	if err := block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
-		return errors.Wrap(err, "input block index not valid")
+// writeDownsampleProgress atomically writes the progress of the downsampling of the given block.
+func writeDownsampleProgress(dir string, id ulid.ULID, p downsampleProgress) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrap(err, "marshal progress")
+	}
+	tmp := progressFilename(dir, id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return errors.Wrap(err, "write progress")
 	}
+	return errors.Wrap(os.Rename(tmp, progressFilename(dir, id)), "rename progress")
+}
 
-	begin = time.Now()
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bucket, m *metadata.Meta, dir string, resolution int64) error {
+	begin := time.Now()
+	bdir := filepath.Join(dir, m.ULID.String())
+
+	progress := readDownsampleProgress(logger, dir, m.ULID, resolution)
+	if !progress.Downloaded {
+		if err := os.RemoveAll(bdir); err != nil {
+			return errors.Wrapf(err, "clean block dir %s", bdir)
+		}
+		err := block.Download(ctx, logger, bkt, m.ULID, bdir)
+		if err != nil {
+			return errors.Wrapf(err, "download block %s", m.ULID)
+		}
+		level.Info(logger).Log("msg", "downloaded block", "id", m.ULID, "duration", time.Since(begin))
+
+		if err := block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
+			return errors.Wrap(err, "input block index not valid")
+		}
 
-	var pool chunkenc.Pool
-	if m.Thanos.Downsample.Resolution == 0 {
-		pool = chunkenc.NewPool()
+		progress.Downloaded = true
+		if err := writeDownsampleProgress(dir, m.ULID, progress); err != nil {
+			return errors.Wrapf(err, "save downsampling progress of block %s", m.ULID)
+		}
 	} else {
-		pool = downsample.NewPool()
+		level.Info(logger).Log("msg", "resuming downsampling of already downloaded block", "id", m.ULID)
 	}
 
-	b, err := tsdb.OpenBlock(logger, bdir, pool)
-	if err != nil {
-		return errors.Wrapf(err, "open block %s", m.ULID)
-	}
-	defer runutil.CloseWithLogOnErr(log.With(logger, "outcome", "potential left mmap file handlers left"), b, "tsdb reader")
+	id := progress.Result
+	if id == (ulid.ULID{}) {
+		begin = time.Now()
 
-	id, err := downsample.Downsample(logger, m, b, dir, resolution)
-	if err != nil {
-		return errors.Wrapf(err, "downsample block %s to window %d", m.ULID, resolution)
-	}
-	resdir := filepath.Join(dir, id.String())
+		var pool chunkenc.Pool
+		if m.Thanos.Downsample.Resolution == 0 {
+			pool = chunkenc.NewPool()
+		} else {
+			pool = downsample.NewPool()
+		}
+
+		b, err := tsdb.OpenBlock(logger, bdir, pool)
+		if err != nil {
+			return errors.Wrapf(err, "open block %s", m.ULID)
+		}
+		defer runutil.CloseWithLogOnErr(log.With(logger, "outcome", "potential left mmap file handlers left"), b, "tsdb reader")
+
+		id, err = downsample.Downsample(logger, m, b, dir, resolution)
+		if err != nil {
+			return errors.Wrapf(err, "downsample block %s to window %d", m.ULID, resolution)
+		}
 
-	level.Info(logger).Log("msg", "downsampled block",
-		"from", m.ULID, "to", id, "duration", time.Since(begin))
+		level.Info(logger).Log("msg", "downsampled block",
+			"from", m.ULID, "to", id, "duration", time.Since(begin))
+
+		if err := block.VerifyIndex(logger, filepath.Join(dir, id.String(), block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
+			return errors.Wrap(err, "output block index not valid")
+		}
 
-	if err := block.VerifyIndex(logger, filepath.Join(resdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
-		return errors.Wrap(err, "output block index not valid")
+		progress.Result = id
+		if err := writeDownsampleProgress(dir, m.ULID, progress); err != nil {
+			return errors.Wrapf(err, "save downsampling progress of block %s", m.ULID)
+		}
+	} else {
+		level.Info(logger).Log("msg", "resuming upload of already downsampled block", "from", m.ULID, "to", id)
 	}
+	resdir := filepath.Join(dir, id.String())
 
 	begin = time.Now()
 
-	err = block.Upload(ctx, logger, bkt, resdir)
+	err := block.Upload(ctx, logger, bkt, resdir)
 	if err != nil {
 		return errors.Wrapf(err, "upload downsampled block %s", id)
 	}
@@ -298,6 +562,9 @@ func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bu
 	level.Info(logger).Log("msg", "uploaded block", "id", id, "duration", time.Since(begin))
 
 	// It is not harmful if these fails.
+	if err := os.Remove(progressFilename(dir, m.ULID)); err != nil {
+		level.Warn(logger).Log("msg", "failed to remove downsampling progress", "id", m.ULID, "err", err)
+	}
 	if err := os.RemoveAll(bdir); err != nil {
 		level.Warn(logger).Log("msg", "failed to clean directory", "dir", bdir, "err", err)
 	}
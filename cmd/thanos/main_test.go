@@ -16,7 +16,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/objstore"
@@ -57,9 +59,170 @@ func TestCleanupDownsampleCacheFolder(t *testing.T) {
 
 	metas, _, err := metaFetcher.Fetch(ctx)
 	testutil.Ok(t, err)
-	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, metas, dir))
+	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, metas, dir, 1, downsample.DefaultLevels, nil))
 	testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(compact.DefaultGroupKey(meta.Thanos))))
 
 	_, err = os.Stat(dir)
 	testutil.Assert(t, os.IsNotExist(err), "index cache dir should not exist at the end of execution")
 }
+
+func TestDownsampleBucketResumesFromProgress(t *testing.T) {
+	logger := log.NewNopLogger()
+	dir, err := ioutil.TempDir("", "test-downsample-resume")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	workDir := path.Join(dir, "downsample")
+	var ids []ulid.ULID
+	for _, ext := range []string{"1", "2"} {
+		// Create the blocks in the working directory, as if they were downloaded before a restart.
+		id, err := e2eutil.CreateBlock(
+			ctx,
+			workDir,
+			[]labels.Labels{{{Name: "a", Value: "1"}}},
+			1, 0, downsample.DownsampleRange0+1, // Pass the minimum DownsampleRange0 check.
+			labels.Labels{{Name: "e1", Value: ext}},
+			downsample.ResLevel0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, path.Join(workDir, id.String())))
+		ids = append(ids, id)
+	}
+
+	// The first block is already downloaded, so it can be downsampled without its chunks in the bucket.
+	testutil.Ok(t, writeDownsampleProgress(workDir, ids[0], downsampleProgress{Resolution: downsample.ResLevel1, Downloaded: true}))
+	testutil.Ok(t, bkt.Delete(ctx, path.Join(ids[0].String(), block.ChunksDirname, "000001")))
+
+	metrics := newDownsampleMetrics(prometheus.NewRegistry())
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, nil, nil)
+	testutil.Ok(t, err)
+
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Ok(t, downsampleBucket(ctx, logger, metrics, bkt, metas, workDir, 2, downsample.DefaultLevels, nil))
+	for _, id := range ids {
+		testutil.Equals(t, 1.0, promtest.ToFloat64(metrics.downsamples.WithLabelValues(compact.DefaultGroupKey(metas[id].Thanos))))
+	}
+
+	metas, _, err = metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 4, len(metas))
+
+	_, err = os.Stat(workDir)
+	testutil.Assert(t, os.IsNotExist(err), "downsample dir should not exist at the end of execution")
+}
+
+func TestDownsampleFilter(t *testing.T) {
+	newMeta := func(id ulid.ULID, resolution, mint, maxt int64, sources ...ulid.ULID) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       id,
+				MinTime:    mint,
+				MaxTime:    maxt,
+				Compaction: tsdb.BlockMetaCompaction{Sources: sources},
+			},
+			Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: resolution}},
+		}
+	}
+	var (
+		raw1 = newMeta(ulid.MustNew(1, nil), downsample.ResLevel0, 0, 100, ulid.MustNew(10, nil), ulid.MustNew(11, nil))
+		raw2 = newMeta(ulid.MustNew(2, nil), downsample.ResLevel0, 100, 200, ulid.MustNew(12, nil))
+		ds1  = newMeta(ulid.MustNew(3, nil), downsample.ResLevel1, 0, 100, ulid.MustNew(11, nil), ulid.MustNew(10, nil))
+		ds2  = newMeta(ulid.MustNew(4, nil), downsample.ResLevel1, 100, 200, ulid.MustNew(12, nil))
+	)
+	metas := map[ulid.ULID]*metadata.Meta{raw1.ULID: raw1, raw2.ULID: raw2, ds1.ULID: ds1, ds2.ULID: ds2}
+
+	_, err := newDownsampleFilter(metas, downsample.DefaultLevels, []ulid.ULID{ulid.MustNew(5, nil)}, 0, 200, downsample.ResLevel2)
+	testutil.NotOk(t, err)
+
+	for _, tcase := range []struct {
+		name       string
+		ids        []ulid.ULID
+		mint, maxt int64
+		resolution int64
+		selected   []*metadata.Meta
+	}{
+		{name: "all blocks", mint: 0, maxt: 200, resolution: downsample.ResLevel2, selected: []*metadata.Meta{raw1, raw2, ds1, ds2}},
+		{name: "up to 5m", mint: 0, maxt: 200, resolution: downsample.ResLevel1, selected: []*metadata.Meta{raw1, raw2}},
+		{name: "time range", mint: 100, maxt: 150, resolution: downsample.ResLevel2, selected: []*metadata.Meta{raw2, ds2}},
+		{name: "block and its downsampled blocks", ids: []ulid.ULID{raw1.ULID}, mint: 0, maxt: 200, resolution: downsample.ResLevel2, selected: []*metadata.Meta{raw1, ds1}},
+		{name: "downsampled block only", ids: []ulid.ULID{ds2.ULID}, mint: 0, maxt: 200, resolution: downsample.ResLevel2, selected: []*metadata.Meta{ds2}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			filter, err := newDownsampleFilter(metas, downsample.DefaultLevels, tcase.ids, tcase.mint, tcase.maxt, tcase.resolution)
+			testutil.Ok(t, err)
+
+			var selected []*metadata.Meta
+			for _, m := range []*metadata.Meta{raw1, raw2, ds1, ds2} {
+				if filter(m) {
+					selected = append(selected, m)
+				}
+			}
+			testutil.Equals(t, tcase.selected, selected)
+		})
+	}
+}
+
+func TestParseDownsamplingLevels(t *testing.T) {
+	const day = int64(24 * time.Hour / time.Millisecond)
+
+	levels, retentions, err := parseDownsamplingLevels(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, downsample.DefaultLevels, levels)
+	testutil.Equals(t, map[compact.ResolutionLevel]time.Duration{}, retentions)
+
+	levels, retentions, err = parseDownsamplingLevels([]string{"1d:14d:10y", "1w:60d"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{downsample.ResLevel0, downsample.ResLevel1, downsample.ResLevel2, day, 7 * day}, levels.Resolutions())
+	testutil.Equals(t, downsample.Level{Resolution: day, MinRange: 14 * day}, levels[2])
+	testutil.Equals(t, map[compact.ResolutionLevel]time.Duration{
+		compact.ResolutionLevel(day):     10 * 365 * 24 * time.Hour,
+		compact.ResolutionLevel(7 * day): 0,
+	}, retentions)
+
+	for _, s := range []string{"1d", "1d:14d:10y:1y", "1x:14d", "1h:14d"} {
+		_, _, err := parseDownsamplingLevels([]string{s})
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestDownsamplingPlanWithAdditionalLevel(t *testing.T) {
+	const day = int64(24 * time.Hour / time.Millisecond)
+
+	levels, err := downsample.NewLevels(downsample.Level{Resolution: day, MinRange: 14 * day})
+	testutil.Ok(t, err)
+
+	newMeta := func(id ulid.ULID, resolution, maxt int64, sources ...ulid.ULID) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: id, MaxTime: maxt, Compaction: tsdb.BlockMetaCompaction{Sources: sources}},
+			Thanos:    metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: resolution}},
+		}
+	}
+	var (
+		src1, src2 = ulid.MustNew(10, nil), ulid.MustNew(11, nil)
+		// Block with all its downsampled versions.
+		raw1 = newMeta(ulid.MustNew(1, nil), downsample.ResLevel0, 14*day, src1)
+		ds1  = newMeta(ulid.MustNew(2, nil), downsample.ResLevel1, 14*day, src1)
+		ds2  = newMeta(ulid.MustNew(3, nil), downsample.ResLevel2, 14*day, src1)
+		ds3  = newMeta(ulid.MustNew(4, nil), day, 14*day, src1)
+		// 1h block too small to be downsampled to 1d.
+		small = newMeta(ulid.MustNew(5, nil), downsample.ResLevel2, 13*day, src2)
+	)
+
+	metas := map[ulid.ULID]*metadata.Meta{raw1.ULID: raw1, ds1.ULID: ds1, ds2.ULID: ds2, ds3.ULID: ds3, small.ULID: small}
+	plan, err := downsamplingPlan(metas, levels)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(plan))
+
+	delete(metas, ds3.ULID)
+	plan, err = downsamplingPlan(metas, levels)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []*metadata.Meta{ds2}, plan)
+
+	// Blocks of resolutions without level are unexpected.
+	_, err = downsamplingPlan(map[ulid.ULID]*metadata.Meta{ds3.ULID: ds3}, downsample.DefaultLevels)
+	testutil.NotOk(t, err)
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -20,39 +21,58 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/discovery/file"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
+	"google.golang.org/grpc"
 
+	"github.com/thanos-io/thanos/pkg/accounting"
 	v1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/discovery/cache"
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/discovery/endpoints"
+	"github.com/thanos-io/thanos/pkg/discovery/kubernetes"
+	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extgrpc"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/metadata"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/rules"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+	"github.com/thanos-io/thanos/pkg/server/http/auth"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/targets"
 	"github.com/thanos-io/thanos/pkg/tls"
 	"github.com/thanos-io/thanos/pkg/ui"
 )
 
+const (
+	queryModeDefault = "default"
+	queryModeSplit   = "split"
+)
+
 // registerQuery registers a query command.
 func registerQuery(app *extkingpin.App) {
 	comp := component.Query
 	cmd := app.Command(comp.String(), "query node exposing PromQL enabled Query API with data retrieved from multiple store nodes")
 
 	httpBindAddr, httpGracePeriod := extkingpin.RegisterHTTPFlags(cmd)
+	httpCert := cmd.Flag("http-server-tls-cert", "TLS Certificate for HTTP server, leave blank to disable TLS").Default("").String()
+	httpKey := cmd.Flag("http-server-tls-key", "TLS Key for the HTTP server, leave blank to disable TLS").Default("").String()
+	httpClientCA := cmd.Flag("http-server-tls-client-ca", "TLS CA to verify clients against. If no client CA is specified, there is no client verification on server side. (tls.NoClientCert)").Default("").String()
+	httpAuthConfig := extkingpin.RegisterHTTPAuthFlags(cmd)
+	accountingConf := new(accountingConfig).registerFlag(cmd)
 	grpcBindAddr, grpcGracePeriod, grpcCert, grpcKey, grpcClientCA := extkingpin.RegisterGRPCFlags(cmd)
 
 	secure := cmd.Flag("grpc-client-tls-secure", "Use TLS when talking to the gRPC server").Default("false").Bool()
@@ -79,9 +99,18 @@ func registerQuery(app *extkingpin.App) {
 	maxConcurrentSelects := cmd.Flag("query.max-concurrent-select", "Maximum number of select requests made concurrently per a query.").
 		Default("4").Int()
 
-	queryReplicaLabels := cmd.Flag("query.replica-label", "Labels to treat as a replica indicator along which data is deduplicated. Still you will be able to query without deduplication using 'dedup=false' parameter. Data includes time series, recording rules, and alerting rules.").
+	maxSelectMemory := cmd.Flag("query.select-memory-limit", "Maximum size of the series of a single select held in memory for merging and deduplication. Above it, the series are sorted and spilled to temporary files in --query.select-spill-dir, trading query latency for bounded memory. The limit applies to each select, so a query can hold it once for each of its selectors. 0 means no limit.").
+		Default("0").Bytes()
+	selectSpillDir := cmd.Flag("query.select-spill-dir", "Directory of the series spilled by selects exceeding --query.select-memory-limit. Defaults to the directory for temporary files of the system. Files left behind by a previous run are removed at startup.").
+		Default("").String()
+
+	queryReplicaLabels := cmd.Flag("query.replica-label", "Labels to treat as a replica indicator along which data is deduplicated. Still you will be able to query without deduplication using 'dedup=false' parameter. Data includes time series, recording rules, alerting rules, and targets.").
 		Strings()
 
+	dedupFunc := cmd.Flag("deduplication.func", "Algorithm merging the samples of the replicas of a series. 'penalty' uses the samples of one replica and switches to another one only if there is a gap in the samples of the current replica. "+
+		"'chain' chains the samples of all replicas one-to-one in timestamp order, adjusting counter values so that rate() is not affected by replica flaps.").
+		Default(string(query.DedupFuncPenalty)).Enum(string(query.DedupFuncPenalty), string(query.DedupFuncChain))
+
 	instantDefaultMaxSourceResolution := extkingpin.ModelDuration(cmd.Flag("query.instant.default.max_source_resolution", "default value for max_source_resolution for instant queries. If not set, defaults to 0s only taking raw resolution into account. 1h can be a good value if you use instant queries over time ranges that incorporate times outside of your raw-retention.").Default("0s").Hidden())
 
 	defaultMetadataTimeRange := cmd.Flag("query.metadata.default-time-range", "The default metadata time range duration for retrieving labels through Labels and Series API when the range parameters are not specified. The zero value means range covers the time since the beginning.").Default("0s").Duration()
@@ -96,6 +125,12 @@ func registerQuery(app *extkingpin.App) {
 	ruleEndpoints := cmd.Flag("rule", "Experimental: Addresses of statically configured rules API servers (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect rule API servers through respective DNS lookups.").
 		Hidden().PlaceHolder("<rule>").Strings()
 
+	targetEndpoints := cmd.Flag("target", "Experimental: Addresses of statically configured target API servers (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect target API servers through respective DNS lookups.").
+		Hidden().PlaceHolder("<target>").Strings()
+
+	metadataEndpoints := cmd.Flag("metadata", "Experimental: Addresses of statically configured metadata API servers (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect metadata API servers through respective DNS lookups.").
+		Hidden().PlaceHolder("<metadata>").Strings()
+
 	strictStores := cmd.Flag("store-strict", "Addresses of only statically configured store API servers that are always used, even if the health check fails. Useful if you have a caching layer on top.").
 		PlaceHolder("<staticstore>").Strings()
 
@@ -105,6 +140,10 @@ func registerQuery(app *extkingpin.App) {
 	fileSDInterval := extkingpin.ModelDuration(cmd.Flag("store.sd-interval", "Refresh interval to re-read file SD files. It is used as a resync fallback.").
 		Default("5m"))
 
+	endpointsSDFiles := cmd.Flag("store.sd-config-files", "Path to YAML files that contain groups of store API servers, each with its own strictness, TLS settings and exposed APIs. The path can be a glob pattern (repeatable). "+
+		"The files are re-read when modified, and every --store.sd-interval. See format details: https://thanos.io/tip/components/query.md/#file-service-discovery-with-options").
+		PlaceHolder("<path>").Strings()
+
 	// TODO(bwplotka): Grab this from TTL at some point.
 	dnsSDInterval := extkingpin.ModelDuration(cmd.Flag("store.sd-dns-interval", "Interval between DNS resolutions.").
 		Default("30s"))
@@ -112,20 +151,76 @@ func registerQuery(app *extkingpin.App) {
 	dnsSDResolver := cmd.Flag("store.sd-dns-resolver", fmt.Sprintf("Resolver to use. Possible options: [%s, %s]", dns.GolangResolverType, dns.MiekgdnsResolverType)).
 		Default(string(dns.GolangResolverType)).Hidden().String()
 
+	kubernetesSDSelector := cmd.Flag("store.sd-kubernetes-selector", "Label selector of the Kubernetes Endpoints or EndpointSlices, which inherit the labels of their Service, to discover store API servers from. If defined, the ready endpoints are discovered as soon as Kubernetes reports them, e.g. when the Services are scaled, with no DNS lookups. The pod service account is used to watch the objects.").
+		PlaceHolder("<selector>").String()
+
+	kubernetesSDNamespaces := cmd.Flag("store.sd-kubernetes-namespace", "Kubernetes namespace to discover store API servers in (repeatable). All namespaces are watched if not specified.").
+		PlaceHolder("<namespace>").Strings()
+
+	kubernetesSDPort := cmd.Flag("store.sd-kubernetes-port", "Name of the port of the store API servers discovered through Kubernetes.").
+		Default("grpc").String()
+
+	kubernetesSDRole := cmd.Flag("store.sd-kubernetes-role", "Kind of the Kubernetes objects to watch to discover store API servers.").
+		Default("endpoints").Enum("endpoints", "endpointslice")
+
 	unhealthyStoreTimeout := extkingpin.ModelDuration(cmd.Flag("store.unhealthy-timeout", "Timeout before an unhealthy store is cleaned from the store UI page.").Default("5m"))
 
+	enableStoreAdminAPI := cmd.Flag("store.enable-admin-api", "Enable the HTTP API to add and remove store API endpoints at runtime, and to drain them, i.e. stop sending queries to them, e.g. before their maintenance.").
+		Default("false").Bool()
+
 	enableAutodownsampling := cmd.Flag("query.auto-downsampling", "Enable automatic adjustment (step / 5) to what source of data should be used in store gateways if no max_source_resolution param is specified.").
 		Default("false").Bool()
 
+	downsamplingResolutions := downsamplingResolutionsFlag(cmd).Strings()
+
 	enableQueryPartialResponse := cmd.Flag("query.partial-response", "Enable partial response for queries if no partial_response param is specified. --no-query.partial-response for disabling.").
 		Default("true").Bool()
 
 	enableRulePartialResponse := cmd.Flag("rule.partial-response", "Enable partial response for rules endpoint. --no-rule.partial-response for disabling.").
 		Hidden().Default("true").Bool()
 
+	enableTargetPartialResponse := cmd.Flag("target.partial-response", "Enable partial response for targets endpoint. --no-target.partial-response for disabling.").
+		Hidden().Default("true").Bool()
+
+	enableMetadataPartialResponse := cmd.Flag("metadata.partial-response", "Enable partial response for metadata endpoint. --no-metadata.partial-response for disabling.").
+		Hidden().Default("true").Bool()
+
 	defaultEvaluationInterval := extkingpin.ModelDuration(cmd.Flag("query.default-evaluation-interval", "Set default evaluation interval for sub queries.").Default("1m"))
 
 	storeResponseTimeout := extkingpin.ModelDuration(cmd.Flag("store.response-timeout", "If a Store doesn't send any data in this specified duration then a Store will be ignored and partial data will be returned if it's enabled. 0 disables timeout.").Default("0ms"))
+	partialResponsePolicies := cmd.Flag("store.partial-response-policy", fmt.Sprintf("Partial response policy of StoreAPIs in the <address|type>=<%s|%s> format, e.g. sidecar=%s (repeatable). "+
+		"The failures of '%s' StoreAPIs fail the queries even if partial response is enabled, the failures of '%s' ones only do if "+
+		"partial response is explicitly disabled by the request. "+
+		"The policy of an address takes precedence over the one of a type.",
+		query.PartialResponsePolicyStrict, query.PartialResponsePolicyBestEffort, query.PartialResponsePolicyStrict,
+		query.PartialResponsePolicyStrict, query.PartialResponsePolicyBestEffort)).
+		PlaceHolder("<policy>").Strings()
+
+	queryMode := cmd.Flag("query.mode", "Mode of evaluation of the range queries. In 'split' mode, range queries are evaluated in consecutive time ranges of --query.split-interval, "+
+		"so that only the series of one time range are held in memory at once. This reduces the peak memory of range queries over long time ranges, at the cost of selecting the series once per time range. "+
+		"The results are not streamed: they are merged and returned once all the time ranges are evaluated. The query timeout and max samples limit apply to each time range.").Default(queryModeDefault).Enum(queryModeDefault, queryModeSplit)
+	splitInterval := extkingpin.ModelDuration(cmd.Flag("query.split-interval", "Maximum time range of the evaluations of range queries in 'split' mode. It is rounded down to a multiple of the query step.").
+		Default("1d"))
+
+	enforceTenancy := cmd.Flag("query.enforce-tenancy", "Enforce the tenant of the requests to the query API and StoreAPI: only the series with the tenant label set to the tenant of the request are selected. "+
+		"Requests without tenant are rejected.").Default("false").Bool()
+	tenantHeader := cmd.Flag("query.tenant-header", "HTTP header, or gRPC metadata for the StoreAPI, to read the tenant of the requests from, when tenancy is enforced.").Default(query.DefaultTenantHeader).String()
+	tenantCertField := cmd.Flag("query.tenant-certificate-field", fmt.Sprintf("Field of the client certificate subject to read the tenant of the requests from, when tenancy is enforced. "+
+		"If set, takes precedence over --query.tenant-header. Requires --http-server-tls-client-ca. Possible options: %s, %s, %s.",
+		query.CertificateFieldOrganization, query.CertificateFieldOrganizationalUnit, query.CertificateFieldCommonName)).
+		Default("").Enum("", query.CertificateFieldOrganization, query.CertificateFieldOrganizationalUnit, query.CertificateFieldCommonName)
+	tenantLabel := cmd.Flag("query.tenant-label-name", "Label enforced to the tenant of the requests, when tenancy is enforced.").Default(query.DefaultTenantLabel).String()
+
+	maxConcurrentPerTenant := cmd.Flag("query.max-concurrent-per-tenant", "Maximum number of queries of a tenant processed concurrently, including the series, label names and label values requests. "+
+		"Queries above the limit are rejected. Without tenancy, all the queries share the limit. 0 means no limit.").Default("0").Int()
+	maxSeries := cmd.Flag("query.max-series", "Maximum number of series selected by a query, counted after deduplication. 0 means no limit.").Default("0").Int()
+	maxFetchedChunks := cmd.Flag("query.max-fetched-chunks", "Maximum number of chunks fetched from the StoreAPIs by a query. 0 means no limit.").Default("0").Int()
+	maxFetchedSamples := cmd.Flag("query.max-fetched-samples", "Maximum number of samples fetched from the StoreAPIs by a query. 0 means no limit.").Default("0").Int()
+	maxLabelValues := cmd.Flag("query.max-label-values", "Maximum number of label names or values returned by a label names or label values request. 0 means no limit.").Default("0").Int()
+	limitsConfig := extflag.RegisterPathOrContent(cmd, "query.limits-config", "YAML file that contains the per tenant overrides of the query limits. See format details: https://thanos.io/tip/components/query.md/#query-limits", false)
+
+	activeQueryPath := cmd.Flag("query.active-query-path", "Directory to log the active queries in. The queries still active when the querier stops, e.g. because it ran out of memory, are logged at the next start. Empty disables it.").
+		Default("").String()
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 		selectorLset, err := parseFlagLabels(*selectorLabels)
@@ -141,6 +236,14 @@ func registerQuery(app *extkingpin.App) {
 			return errors.Errorf("Address %s is duplicated for --rule flag.", dup)
 		}
 
+		if dup := firstDuplicate(*targetEndpoints); dup != "" {
+			return errors.Errorf("Address %s is duplicated for --target flag.", dup)
+		}
+
+		if dup := firstDuplicate(*metadataEndpoints); dup != "" {
+			return errors.Errorf("Address %s is duplicated for --metadata flag.", dup)
+		}
+
 		var fileSD *file.Discovery
 		if len(*fileSDFiles) > 0 {
 			conf := &file.SDConfig{
@@ -150,6 +253,24 @@ func registerQuery(app *extkingpin.App) {
 			fileSD = file.NewDiscovery(conf, logger)
 		}
 
+		var endpointsSD *endpoints.FileDiscovery
+		if len(*endpointsSDFiles) > 0 {
+			endpointsSD = endpoints.NewFileDiscovery(logger, *endpointsSDFiles, time.Duration(*fileSDInterval))
+		}
+
+		var kubernetesSD *kubernetes.Discovery
+		if *kubernetesSDSelector != "" {
+			kubernetesSD, err = kubernetes.NewDiscovery(logger, kubernetes.SDConfig{
+				Role:       *kubernetesSDRole,
+				Namespaces: *kubernetesSDNamespaces,
+				Selector:   *kubernetesSDSelector,
+				Port:       *kubernetesSDPort,
+			})
+			if err != nil {
+				return errors.Wrap(err, "create Kubernetes service discovery")
+			}
+		}
+
 		if *webRoutePrefix == "" {
 			*webRoutePrefix = *webExternalPrefix
 		}
@@ -158,6 +279,64 @@ func registerQuery(app *extkingpin.App) {
 			level.Warn(logger).Log("msg", "different values for --web.route-prefix and --web.external-prefix detected, web UI may not work without a reverse-proxy.")
 		}
 
+		var rangeQuerySplitInterval time.Duration
+		if *queryMode == queryModeSplit {
+			if *splitInterval <= 0 {
+				return errors.New("--query.split-interval must be positive")
+			}
+			rangeQuerySplitInterval = time.Duration(*splitInterval)
+		}
+
+		var tenancy *query.Tenancy
+		if *enforceTenancy {
+			if *tenantCertField != "" && *httpClientCA == "" {
+				return errors.New("--query.tenant-certificate-field requires client certificates to be verified with --http-server-tls-client-ca")
+			}
+			tenancy, err = query.NewTenancy(*tenantHeader, *tenantCertField, *tenantLabel)
+			if err != nil {
+				return errors.Wrap(err, "configure tenancy")
+			}
+		}
+
+		if *maxConcurrentPerTenant < 0 || *maxSeries < 0 || *maxFetchedChunks < 0 || *maxFetchedSamples < 0 || *maxLabelValues < 0 {
+			return errors.New("query limits must not be negative")
+		}
+		limitsConfigYAML, err := limitsConfig.Content()
+		if err != nil {
+			return err
+		}
+		limits, err := query.NewTenantLimits(query.Limits{
+			MaxConcurrent:        *maxConcurrentPerTenant,
+			MaxSeries:            *maxSeries,
+			MaxFetchedChunks:     *maxFetchedChunks,
+			MaxFetchedSamples:    *maxFetchedSamples,
+			MaxLabelValues:       *maxLabelValues,
+			StoreResponseTimeout: time.Duration(*storeResponseTimeout),
+		}, limitsConfigYAML)
+		if err != nil {
+			return errors.Wrap(err, "configure query limits")
+		}
+
+		activeQueries, err := query.NewActiveQueries(log.With(logger, "component", "active-queries"), *activeQueryPath, *maxConcurrentQueries)
+		if err != nil {
+			return errors.Wrap(err, "configure active queries")
+		}
+
+		partialResponsePolicy, err := query.NewPartialResponsePolicies(*partialResponsePolicies)
+		if err != nil {
+			return errors.Wrap(err, "parse partial response policies")
+		}
+
+		httpAuth, err := newHTTPAuthMiddleware(logger, reg, httpAuthConfig)
+		if err != nil {
+			return errors.Wrap(err, "configure HTTP auth")
+		}
+
+		accountant, err := accountingConf.accountant(g, logger, reg, comp)
+		if err != nil {
+			return errors.Wrap(err, "configure accounting")
+		}
+
 		return runQuery(
 			g,
 			logger,
@@ -176,31 +355,52 @@ func registerQuery(app *extkingpin.App) {
 			*serverName,
 			*httpBindAddr,
 			time.Duration(*httpGracePeriod),
+			*httpCert,
+			*httpKey,
+			*httpClientCA,
+			httpAuth,
 			*webRoutePrefix,
 			*webExternalPrefix,
 			*webPrefixHeaderName,
 			*maxConcurrentQueries,
 			*maxConcurrentSelects,
+			int64(*maxSelectMemory),
+			*selectSpillDir,
 			time.Duration(*queryTimeout),
 			*lookbackDelta,
 			*dynamicLookbackDelta,
+			*downsamplingResolutions,
 			time.Duration(*defaultEvaluationInterval),
 			time.Duration(*storeResponseTimeout),
 			*queryReplicaLabels,
+			query.DedupFunc(*dedupFunc),
 			selectorLset,
 			getFlagsMap(cmd.Flags()),
 			*stores,
 			*ruleEndpoints,
+			*targetEndpoints,
+			*metadataEndpoints,
 			*enableAutodownsampling,
 			*enableQueryPartialResponse,
 			*enableRulePartialResponse,
+			*enableTargetPartialResponse,
+			*enableMetadataPartialResponse,
 			fileSD,
+			endpointsSD,
+			kubernetesSD,
 			time.Duration(*dnsSDInterval),
 			*dnsSDResolver,
 			time.Duration(*unhealthyStoreTimeout),
+			*enableStoreAdminAPI,
+			accountant,
 			time.Duration(*instantDefaultMaxSourceResolution),
 			*defaultMetadataTimeRange,
 			*strictStores,
+			tenancy,
+			rangeQuerySplitInterval,
+			limits,
+			activeQueries,
+			partialResponsePolicy,
 			component.Query,
 		)
 	})
@@ -226,31 +426,52 @@ func runQuery(
 	serverName string,
 	httpBindAddr string,
 	httpGracePeriod time.Duration,
+	httpCert string,
+	httpKey string,
+	httpClientCA string,
+	httpAuth *auth.Middleware,
 	webRoutePrefix string,
 	webExternalPrefix string,
 	webPrefixHeaderName string,
 	maxConcurrentQueries int,
 	maxConcurrentSelects int,
+	maxSelectMemoryBytes int64,
+	selectSpillDir string,
 	queryTimeout time.Duration,
 	lookbackDelta time.Duration,
 	dynamicLookbackDelta bool,
+	downsamplingResolutions []string,
 	defaultEvaluationInterval time.Duration,
 	storeResponseTimeout time.Duration,
 	queryReplicaLabels []string,
+	dedupFunc query.DedupFunc,
 	selectorLset labels.Labels,
 	flagsMap map[string]string,
 	storeAddrs []string,
 	ruleAddrs []string,
+	targetAddrs []string,
+	metadataAddrs []string,
 	enableAutodownsampling bool,
 	enableQueryPartialResponse bool,
 	enableRulePartialResponse bool,
+	enableTargetPartialResponse bool,
+	enableMetadataPartialResponse bool,
 	fileSD *file.Discovery,
+	endpointsSD *endpoints.FileDiscovery,
+	kubernetesSD *kubernetes.Discovery,
 	dnsSDInterval time.Duration,
 	dnsSDResolver string,
 	unhealthyStoreTimeout time.Duration,
+	enableStoreAdminAPI bool,
+	accountant *accounting.Accountant,
 	instantDefaultMaxSourceResolution time.Duration,
 	defaultMetadataTimeRange time.Duration,
 	strictStores []string,
+	tenancy *query.Tenancy,
+	rangeQuerySplitInterval time.Duration,
+	limits *query.TenantLimits,
+	activeQueries *query.ActiveQueries,
+	partialResponsePolicy *query.PartialResponsePolicies,
 	comp component.Component,
 ) error {
 	// TODO(bplotka in PR #513 review): Move arguments into struct.
@@ -259,12 +480,26 @@ func runQuery(
 		Help: "The number of times a duplicated store addresses is detected from the different configs in query",
 	})
 
-	dialOpts, err := extgrpc.StoreClientGRPCOpts(logger, reg, tracer, secure, cert, key, caCert, serverName)
+	grpcOpts := extgrpc.StoreClientBaseGRPCOpts(reg, tracer)
+	tlsOpt, err := extgrpc.StoreClientTLSOpt(logger, secure, cert, key, caCert, serverName)
 	if err != nil {
 		return errors.Wrap(err, "building gRPC client")
 	}
+	dialOpts := appendDialOpt(grpcOpts, tlsOpt)
 
-	fileSDCache := cache.New()
+	resolutions, err := parseDownsamplingResolutions(downsamplingResolutions)
+	if err != nil {
+		return err
+	}
+
+	// The series spilled by a previous run, e.g. which crashed, are never read again.
+	if removed, err := query.RemoveSpilledSeries(selectSpillDir); err != nil {
+		level.Warn(logger).Log("msg", "failed to remove series spilled by a previous run", "dir", selectSpillDir, "err", err)
+	} else if removed > 0 {
+		level.Info(logger).Log("msg", "removed series spilled by a previous run", "dir", selectSpillDir, "files", removed)
+	}
+
+	sdCache := cache.New()
 	dnsStoreProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_store_apis_", reg),
@@ -277,12 +512,30 @@ func runQuery(
 		}
 	}
 
+	endpointGroups := newEndpointGroups(logger, grpcOpts, dns.NewProvider(
+		logger,
+		extprom.WrapRegistererWithPrefix("thanos_query_store_sd_config_apis_", reg),
+		dns.ResolverType(dnsSDResolver),
+	))
+
 	dnsRuleProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_rule_apis_", reg),
 		dns.ResolverType(dnsSDResolver),
 	)
 
+	dnsTargetProvider := dns.NewProvider(
+		logger,
+		extprom.WrapRegistererWithPrefix("thanos_query_target_apis_", reg),
+		dns.ResolverType(dnsSDResolver),
+	)
+
+	dnsMetadataProvider := dns.NewProvider(
+		logger,
+		extprom.WrapRegistererWithPrefix("thanos_query_metadata_apis_", reg),
+		dns.ResolverType(dnsSDResolver),
+	)
+
 	var (
 		stores = query.NewStoreSet(
 			logger,
@@ -293,14 +546,16 @@ func runQuery(
 				for _, addr := range strictStores {
 					specs = append(specs, query.NewGRPCStoreSpec(addr, true))
 				}
-				// Add DNS resolved addresses from static flags and file SD.
+				// Add DNS resolved addresses from static flags, file and Kubernetes SD.
 				for _, addr := range dnsStoreProvider.Addresses() {
 					specs = append(specs, query.NewGRPCStoreSpec(addr, false))
 				}
+				// Add DNS resolved addresses from the groups of endpoints of the SD config files, with their own options.
+				specs = append(specs, endpointGroups.StoreSpecs()...)
 				return removeDuplicateStoreSpecs(logger, duplicatedStores, specs)
 			},
 			func() (specs []query.RuleSpec) {
-				for _, addr := range dnsRuleProvider.Addresses() {
+				for _, addr := range append(dnsRuleProvider.Addresses(), endpointGroups.Addresses(endpoints.APIRules)...) {
 					specs = append(specs, query.NewGRPCStoreSpec(addr, false))
 				}
 
@@ -309,17 +564,34 @@ func runQuery(
 
 				return specs
 			},
+			func() (specs []query.TargetSpec) {
+				for _, addr := range append(dnsTargetProvider.Addresses(), endpointGroups.Addresses(endpoints.APITargets)...) {
+					specs = append(specs, query.NewGRPCStoreSpec(addr, false))
+				}
+				return specs
+			},
+			func() (specs []query.MetadataSpec) {
+				for _, addr := range append(dnsMetadataProvider.Addresses(), endpointGroups.Addresses(endpoints.APIMetadata)...) {
+					specs = append(specs, query.NewGRPCStoreSpec(addr, false))
+				}
+				return specs
+			},
 			dialOpts,
 			unhealthyStoreTimeout,
 		)
-		proxy            = store.NewProxyStore(logger, reg, stores.Get, component.Query, selectorLset, storeResponseTimeout)
+		proxy            = store.NewProxyStore(logger, reg, stores.Get, component.Query, selectorLset, storeResponseTimeout, partialResponsePolicy.Policy)
 		rulesProxy       = rules.NewProxy(logger, stores.GetRulesClients)
+		targetsProxy     = targets.NewProxy(logger, stores.GetTargetsClients)
+		metadataProxy    = metadata.NewProxy(logger, stores.GetMetadataClients)
 		queryableCreator = query.NewQueryableCreator(
 			logger,
 			extprom.WrapRegistererWithPrefix("thanos_query_", reg),
 			proxy,
 			maxConcurrentSelects,
 			queryTimeout,
+			dedupFunc,
+			maxSelectMemoryBytes,
+			selectSpillDir,
 		)
 		engineOpts = promql.EngineOpts{
 			Logger: logger,
@@ -347,56 +619,102 @@ func runQuery(
 			stores.Close()
 		})
 	}
-	// Run File Service Discovery and update the store set when the files are modified.
+	// Run File and Kubernetes Service Discovery and update the store set when the files are modified or the
+	// endpoints change.
+	var discoverers []discovery.Discoverer
 	if fileSD != nil {
-		var fileSDUpdates chan []*targetgroup.Group
-		ctxRun, cancelRun := context.WithCancel(context.Background())
-
-		fileSDUpdates = make(chan []*targetgroup.Group)
-
-		g.Add(func() error {
-			fileSD.Run(ctxRun, fileSDUpdates)
-			return nil
-		}, func(error) {
-			cancelRun()
-		})
+		discoverers = append(discoverers, fileSD)
+	}
+	if kubernetesSD != nil {
+		discoverers = append(discoverers, kubernetesSD)
+	}
+	if len(discoverers) > 0 {
+		sdUpdates := make(chan []*targetgroup.Group)
+
+		for _, d := range discoverers {
+			d := d
+			ctxRun, cancelRun := context.WithCancel(context.Background())
+			g.Add(func() error {
+				d.Run(ctxRun, sdUpdates)
+				return nil
+			}, func(error) {
+				cancelRun()
+			})
+		}
 
 		ctxUpdate, cancelUpdate := context.WithCancel(context.Background())
 		g.Add(func() error {
 			for {
 				select {
-				case update := <-fileSDUpdates:
+				case update := <-sdUpdates:
 					// Discoverers sometimes send nil updates so need to check for it to avoid panics.
 					if update == nil {
 						continue
 					}
-					fileSDCache.Update(update)
+					sdCache.Update(update)
 					stores.Update(ctxUpdate)
 
-					if err := dnsStoreProvider.Resolve(ctxUpdate, append(fileSDCache.Addresses(), storeAddrs...)); err != nil {
+					if err := dnsStoreProvider.Resolve(ctxUpdate, append(sdCache.Addresses(), storeAddrs...)); err != nil {
 						level.Error(logger).Log("msg", "failed to resolve addresses for storeAPIs", "err", err)
 					}
-					// Rules apis do not support file service discovery as of now.
+					// Rules, targets and metadata apis do not support file and Kubernetes service discovery as of now.
 				case <-ctxUpdate.Done():
 					return nil
 				}
 			}
 		}, func(error) {
+			// The channel is not closed, as the discoverers might still be sending to it.
 			cancelUpdate()
-			close(fileSDUpdates)
 		})
 	}
-	// Periodically update the addresses from static flags and file SD by resolving them using DNS SD if necessary.
+	// Run the discovery of the groups of endpoints from the SD config files and update the store set when they change.
+	if endpointsSD != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		updates := make(chan []endpoints.Config)
+
+		g.Add(func() error {
+			endpointsSD.Run(ctx, updates)
+			return nil
+		}, func(error) {
+			cancel()
+		})
+		g.Add(func() error {
+			for {
+				select {
+				case cfgs := <-updates:
+					endpointGroups.Update(cfgs)
+					if err := endpointGroups.Resolve(ctx); err != nil {
+						level.Error(logger).Log("msg", "failed to resolve addresses of the SD config files for storeAPIs", "err", err)
+					}
+					stores.Update(ctx)
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}, func(error) {
+			cancel()
+		})
+	}
+	// Periodically update the addresses from static flags, file and Kubernetes SD by resolving them using DNS SD if necessary.
 	{
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			return runutil.Repeat(dnsSDInterval, ctx.Done(), func() error {
-				if err := dnsStoreProvider.Resolve(ctx, append(fileSDCache.Addresses(), storeAddrs...)); err != nil {
+				if err := dnsStoreProvider.Resolve(ctx, append(sdCache.Addresses(), storeAddrs...)); err != nil {
 					level.Error(logger).Log("msg", "failed to resolve addresses for storeAPIs", "err", err)
 				}
+				if err := endpointGroups.Resolve(ctx); err != nil {
+					level.Error(logger).Log("msg", "failed to resolve addresses of the SD config files for storeAPIs", "err", err)
+				}
 				if err := dnsRuleProvider.Resolve(ctx, ruleAddrs); err != nil {
 					level.Error(logger).Log("msg", "failed to resolve addresses for rulesAPIs", "err", err)
 				}
+				if err := dnsTargetProvider.Resolve(ctx, targetAddrs); err != nil {
+					level.Error(logger).Log("msg", "failed to resolve addresses for targetsAPIs", "err", err)
+				}
+				if err := dnsMetadataProvider.Resolve(ctx, metadataAddrs); err != nil {
+					level.Error(logger).Log("msg", "failed to resolve addresses for metadataAPIs", "err", err)
+				}
 				return nil
 			})
 		}, func(error) {
@@ -438,18 +756,22 @@ func runQuery(
 
 		ins := extpromhttp.NewInstrumentationMiddleware(reg)
 		// TODO(bplotka in PR #513 review): pass all flags, not only the flags needed by prefix rewriting.
-		ui.NewQueryUI(logger, stores, webExternalPrefix, webPrefixHeaderName).Register(router, ins)
+		ui.NewQueryUI(logger, stores, activeQueries, tenancy, webExternalPrefix, webPrefixHeaderName).Register(router, ins)
 
 		api := v1.NewQueryAPI(
 			logger,
 			stores,
-			engineFactory(promql.NewEngine, engineOpts, dynamicLookbackDelta),
+			engineFactory(promql.NewEngine, engineOpts, dynamicLookbackDelta, resolutions),
 			queryableCreator,
 			// NOTE: Will share the same replica label as the query for now.
 			rules.NewGRPCClientWithDedup(rulesProxy, queryReplicaLabels),
+			targets.NewGRPCClientWithDedup(targetsProxy, queryReplicaLabels),
+			metadata.NewGRPCClient(metadataProxy),
 			enableAutodownsampling,
 			enableQueryPartialResponse,
 			enableRulePartialResponse,
+			enableTargetPartialResponse,
+			enableMetadataPartialResponse,
 			queryReplicaLabels,
 			flagsMap,
 			instantDefaultMaxSourceResolution,
@@ -458,13 +780,26 @@ func runQuery(
 				extprom.WrapRegistererWithPrefix("thanos_query_concurrent_", reg),
 				maxConcurrentQueries,
 			),
+			tenancy,
+			rangeQuerySplitInterval,
+			limits,
+			activeQueries,
+			enableStoreAdminAPI,
+			accountant,
 		)
 
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
 
+		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "HTTP"), httpCert, httpKey, httpClientCA)
+		if err != nil {
+			return errors.Wrap(err, "setup HTTP server")
+		}
+
 		srv := httpserver.New(logger, reg, comp, httpProbe,
 			httpserver.WithListen(httpBindAddr),
 			httpserver.WithGracePeriod(httpGracePeriod),
+			httpserver.WithTLSConfig(tlsCfg),
+			httpserver.WithAuth(httpAuth),
 		)
 		srv.Handle("/", router)
 
@@ -486,13 +821,21 @@ func runQuery(
 			return errors.Wrap(err, "setup gRPC server")
 		}
 
-		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe,
-			grpcserver.WithServer(store.RegisterStoreServer(proxy)),
-			grpcserver.WithServer(rules.RegisterRulesServer(rulesProxy)),
+		opts := []grpcserver.Option{
+			grpcserver.WithServer(store.RegisterStoreServer(tenancy.StoreServer(proxy))),
 			grpcserver.WithListen(grpcBindAddr),
 			grpcserver.WithGracePeriod(grpcGracePeriod),
 			grpcserver.WithTLSConfig(tlsCfg),
-		)
+		}
+		// Rules, targets and metadata are not scoped to tenants, so they are not served when tenancy is enforced.
+		if !tenancy.Enabled() {
+			opts = append(opts,
+				grpcserver.WithServer(rules.RegisterRulesServer(rulesProxy)),
+				grpcserver.WithServer(targets.RegisterTargetsServer(targetsProxy)),
+				grpcserver.WithServer(metadata.RegisterMetadataServer(metadataProxy)),
+			)
+		}
+		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe, opts...)
 
 		g.Add(func() error {
 			statusProber.Ready()
@@ -524,6 +867,99 @@ func removeDuplicateStoreSpecs(logger log.Logger, duplicatedStores prometheus.Co
 	return deduplicated
 }
 
+// endpointGroup is a group of endpoints of the SD config files, with the gRPC dial options of its TLS settings.
+type endpointGroup struct {
+	endpoints.Config
+	dialOpts []grpc.DialOption
+}
+
+// endpointGroups are the groups of endpoints of the SD config files, whose addresses are resolved using DNS SD if
+// necessary.
+type endpointGroups struct {
+	logger   log.Logger
+	grpcOpts []grpc.DialOption
+	provider *dns.Provider
+
+	mtx    sync.RWMutex
+	groups []endpointGroup
+}
+
+func newEndpointGroups(logger log.Logger, grpcOpts []grpc.DialOption, provider *dns.Provider) *endpointGroups {
+	return &endpointGroups{logger: logger, grpcOpts: grpcOpts, provider: provider}
+}
+
+// Update replaces the groups of endpoints. The groups with invalid TLS settings are skipped.
+func (e *endpointGroups) Update(cfgs []endpoints.Config) {
+	groups := make([]endpointGroup, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		group := endpointGroup{Config: cfg}
+		if tlsCfg := cfg.TLSConfig; tlsCfg != nil {
+			tlsOpt, err := extgrpc.StoreClientTLSOpt(e.logger, tlsCfg.Secure, tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.CAFile, tlsCfg.ServerName)
+			if err != nil {
+				level.Error(e.logger).Log("msg", "failed to configure TLS of endpoints, skipping them", "targets", strings.Join(cfg.Targets, ","), "err", err)
+				continue
+			}
+			group.dialOpts = appendDialOpt(e.grpcOpts, tlsOpt)
+		}
+		groups = append(groups, group)
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.groups = groups
+}
+
+// Resolve resolves the addresses of all the groups.
+func (e *endpointGroups) Resolve(ctx context.Context) error {
+	e.mtx.RLock()
+	var targets []string
+	for _, group := range e.groups {
+		targets = append(targets, group.Targets...)
+	}
+	e.mtx.RUnlock()
+
+	return e.provider.Resolve(ctx, targets)
+}
+
+// StoreSpecs returns the specs of the resolved addresses of all the groups.
+func (e *endpointGroups) StoreSpecs() []query.StoreSpec {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	var specs []query.StoreSpec
+	for _, group := range e.groups {
+		for _, target := range group.Targets {
+			for _, addr := range e.provider.AddressesFor(target) {
+				specs = append(specs, query.NewGRPCStoreSpecWithDialOpts(addr, group.Strict, group.dialOpts))
+			}
+		}
+	}
+	return specs
+}
+
+// Addresses returns the resolved addresses of the groups exposing the given API.
+func (e *endpointGroups) Addresses(api string) []string {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	var addrs []string
+	for _, group := range e.groups {
+		if !group.HasAPI(api) {
+			continue
+		}
+		for _, target := range group.Targets {
+			addrs = append(addrs, e.provider.AddressesFor(target)...)
+		}
+	}
+	return addrs
+}
+
+// appendDialOpt returns a copy of the given gRPC dial options with the given one appended, so that the options can be
+// shared by several connections.
+func appendDialOpt(opts []grpc.DialOption, opt grpc.DialOption) []grpc.DialOption {
+	return append(append(make([]grpc.DialOption, 0, len(opts)+1), opts...), opt)
+}
+
 // firstDuplicate returns the first duplicate string in the given string slice
 // or empty string if none was found.
 func firstDuplicate(ss []string) string {
@@ -540,9 +976,10 @@ func firstDuplicate(ss []string) string {
 	return ""
 }
 
-// engineFactory creates from 1 to 3 promql.Engines depending on
-// dynamicLookbackDelta and eo.LookbackDelta and returns a function
+// engineFactory creates from 1 to len(downsamplingResolutions) promql.Engines
+// depending on dynamicLookbackDelta and eo.LookbackDelta and returns a function
 // that returns appropriate engine for given maxSourceResolutionMillis.
+// The downsampling resolutions are expected to be sorted from the finest to the coarsest, starting with the raw one.
 //
 // TODO: it seems like a good idea to tweak Prometheus itself
 // instead of creating several Engines here.
@@ -550,10 +987,11 @@ func engineFactory(
 	newEngine func(promql.EngineOpts) *promql.Engine,
 	eo promql.EngineOpts,
 	dynamicLookbackDelta bool,
+	downsamplingResolutions []int64,
 ) func(int64) *promql.Engine {
 	resolutions := []int64{downsample.ResLevel0}
 	if dynamicLookbackDelta {
-		resolutions = []int64{downsample.ResLevel0, downsample.ResLevel1, downsample.ResLevel2}
+		resolutions = downsamplingResolutions
 	}
 	var (
 		engines = make([]*promql.Engine, len(resolutions))
@@ -4,7 +4,9 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
@@ -39,6 +41,8 @@ type queryFrontendConfig struct {
 	http httpConfig
 	queryfrontend.Config
 	orgIdHeaders []string
+
+	downsamplingResolutions []string
 }
 
 func registerQueryFrontend(app *extkingpin.App) {
@@ -54,6 +58,11 @@ func registerQueryFrontend(app *extkingpin.App) {
 				Limits:             &cortexvalidation.Limits{},
 				ResultsCacheConfig: &queryrange.ResultsCacheConfig{},
 			},
+			InstantQueryConfig: queryfrontend.InstantQueryConfig{
+				// Instant queries are not split, at most one request is made downstream per query.
+				Limits:             &cortexvalidation.Limits{MaxQueryParallelism: 1},
+				ResultsCacheConfig: &queryrange.ResultsCacheConfig{},
+			},
 			LabelsConfig: queryfrontend.LabelsConfig{
 				Limits:             &cortexvalidation.Limits{},
 				ResultsCacheConfig: &queryrange.ResultsCacheConfig{},
@@ -70,9 +79,18 @@ func registerQueryFrontend(app *extkingpin.App) {
 	cmd.Flag("query-range.split-interval", "Split query range requests by an interval and execute in parallel, it should be greater than 0 when query-range.response-cache-config is configured.").
 		Default("24h").DurationVar(&cfg.QueryRangeConfig.SplitQueriesByInterval)
 
+	cmd.Flag("query-range.vertical-shards", "Number of shards to split the range queries aggregating their series into, by the hash of the labels the series are grouped by. The shards are executed in parallel by the downstream queriers. Queries are not sharded if it is lower than 2.").
+		Default("0").IntVar(&cfg.QueryRangeConfig.VerticalShards)
+
 	cmd.Flag("query-range.max-retries-per-request", "Maximum number of retries for a single query range request; beyond this, the downstream error is returned.").
 		Default("5").IntVar(&cfg.QueryRangeConfig.MaxRetries)
 
+	cmd.Flag("query-range.retry-budget-ratio", "Maximum ratio of retries to query range requests, e.g. 0.1 allows one retry every ten requests on average, to prevent overloading the downstream queriers with retries when most requests fail. 0 does not limit the retries.").
+		Default("0").Float64Var(&cfg.QueryRangeConfig.RetryBudgetRatio)
+
+	cmd.Flag("query-range.retry-budget-burst", "Maximum number of retries of query range requests which can be accumulated by the retry budget, so that the failed parts of a split query can be retried at once. Only used if query-range.retry-budget-ratio is greater than 0.").
+		Default("10").IntVar(&cfg.QueryRangeConfig.RetryBudgetBurst)
+
 	cmd.Flag("query-range.max-query-length", "Limit the query time range (end - start time) in the query-frontend, 0 disables it.").
 		Default("0").DurationVar(&cfg.QueryRangeConfig.Limits.MaxQueryLength)
 
@@ -87,6 +105,22 @@ func registerQueryFrontend(app *extkingpin.App) {
 
 	cfg.QueryRangeConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "query-range.response-cache-config", "YAML file that contains response cache configuration.", false)
 
+	// Instant query tripperware flags.
+	cmd.Flag("query-instant.max-retries-per-request", "Maximum number of retries for a single instant query request; beyond this, the downstream error is returned.").
+		Default("5").IntVar(&cfg.InstantQueryConfig.MaxRetries)
+
+	cmd.Flag("query-instant.response-cache-max-freshness", "Most recent allowed cacheable result for instant query requests, to prevent caching very recent results that might still be in flux.").
+		Default("1m").DurationVar(&cfg.InstantQueryConfig.Limits.MaxCacheFreshness)
+
+	cmd.Flag("query-instant.align-time-step", "Step to align the evaluation time of incoming instant queries down to, for better cache-ability, "+
+		"so that the queries received within a step share their cached results. 0 disables the alignment.").
+		Default("0s").DurationVar(&cfg.InstantQueryConfig.AlignTimeStep)
+
+	cmd.Flag("query-instant.partial-response", "Enable partial response for instant query requests if no partial_response param is specified. --no-query-instant.partial-response for disabling.").
+		Default("true").BoolVar(&cfg.InstantQueryConfig.PartialResponseStrategy)
+
+	cfg.InstantQueryConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "query-instant.response-cache-config", "YAML file that contains response cache configuration.", false)
+
 	// Labels tripperware flags.
 	cmd.Flag("labels.split-interval", "Split labels requests by an interval and execute in parallel, it should be greater than 0 when labels.response-cache-config is configured.").
 		Default("24h").DurationVar(&cfg.LabelsConfig.SplitQueriesByInterval)
@@ -114,10 +148,18 @@ func registerQueryFrontend(app *extkingpin.App) {
 	cmd.Flag("query-frontend.downstream-url", "URL of downstream Prometheus Query compatible API.").
 		Default("http://localhost:9090").StringVar(&cfg.DownstreamURL)
 
+	cmd.Flag("query-frontend.downstream-concurrency", "Maximum number of requests sent to the downstream Prometheus Query compatible API at a time. "+
+		"If greater than 0, the requests are queued per tenant, identified by query-frontend.org-id-header, and the tenants are served in turn. 0 disables queueing.").
+		Default("0").IntVar(&cfg.DownstreamConcurrency)
+
+	cmd.Flag("query-frontend.max-outstanding-requests-per-tenant", "Maximum number of queued requests per tenant; beyond this, the requests of the tenant are rejected with HTTP 429. "+
+		"Only used if query-frontend.downstream-concurrency is greater than 0.").
+		Default("100").IntVar(&cfg.MaxOutstandingPerTenant)
+
 	cmd.Flag("query-frontend.compress-responses", "Compress HTTP responses.").
 		Default("false").BoolVar(&cfg.CompressResponses)
 
-	cmd.Flag("query-frontend.log-queries-longer-than", "Log queries that are slower than the specified duration. "+
+	cmd.Flag("query-frontend.log-queries-longer-than", "Log queries that are slower than the specified duration, as structured records with their source and the work they caused downstream. "+
 		"Set to 0 to disable. Set to < 0 to enable on all queries.").Default("0").DurationVar(&cfg.CortexHandlerConfig.LogQueriesLongerThan)
 
 	cmd.Flag("query-frontend.org-id-header", "Request header names used to identify the source of slow queries (repeated flag). "+
@@ -125,6 +167,11 @@ func registerQueryFrontend(app *extkingpin.App) {
 		"If multiple headers match the request, the first matching arg specified will take precedence. "+
 		"If no headers match 'anonymous' will be used.").PlaceHolder("<http-header-name>").StringsVar(&cfg.orgIdHeaders)
 
+	cmd.Flag("query-frontend.slow-query-log-file", "File the queries logged by --query-frontend.log-queries-longer-than are appended to, as JSON records. If empty, they are written to the log.").
+		Default("").StringVar(&cfg.SlowQueryLogFile)
+
+	downsamplingResolutionsFlag(cmd).StringsVar(&cfg.downsamplingResolutions)
+
 	cmd.Flag("log.request.decision", "Request Logging for logging the start and end of requests. LogFinishCall is enabled by default. LogFinishCall : Logs the finish call of the requests. LogStartAndFinishCall : Logs the start and finish call of the requests. NoLogCall : Disable request logging.").Default("LogFinishCall").EnumVar(&cfg.RequestLoggingDecision, "NoLogCall", "LogFinishCall", "LogStartAndFinishCall")
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
@@ -140,6 +187,12 @@ func runQueryFrontend(
 	cfg *queryFrontendConfig,
 	comp component.Component,
 ) error {
+	resolutions, err := parseDownsamplingResolutions(cfg.downsamplingResolutions)
+	if err != nil {
+		return err
+	}
+	cfg.DownsamplingResolutions = resolutions
+
 	queryRangeCacheConfContentYaml, err := cfg.QueryRangeConfig.CachePathOrContent.Content()
 	if err != nil {
 		return err
@@ -155,6 +208,21 @@ func runQueryFrontend(
 		}
 	}
 
+	instantQueryCacheConfContentYaml, err := cfg.InstantQueryConfig.CachePathOrContent.Content()
+	if err != nil {
+		return err
+	}
+	if len(instantQueryCacheConfContentYaml) > 0 {
+		cacheConfig, err := queryfrontend.NewCacheConfig(logger, instantQueryCacheConfContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "initializing the instant query cache config")
+		}
+		cfg.InstantQueryConfig.ResultsCacheConfig = &queryrange.ResultsCacheConfig{
+			Compression: cfg.CacheCompression,
+			CacheConfig: *cacheConfig,
+		}
+	}
+
 	labelsCacheConfContentYaml, err := cfg.LabelsConfig.CachePathOrContent.Content()
 	if err != nil {
 		return err
@@ -191,11 +259,38 @@ func runQueryFrontend(
 		return errors.Wrap(err, "setup downstream roundtripper")
 	}
 
+	// Queue the requests per tenant before sending them downstream.
+	if cfg.DownstreamConcurrency > 0 {
+		queue := queryfrontend.NewQueueRoundTripper(roundTripper, cfg.MaxOutstandingPerTenant, cfg.DownstreamConcurrency, logger, reg)
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return queue.Run(ctx)
+		}, func(error) {
+			cancel()
+		})
+		roundTripper = queue
+	}
+
 	// Wrap the downstream RoundTripper into query frontend Tripperware.
 	roundTripper = tripperWare(roundTripper)
 
-	// Create the query frontend transport.
-	handler := transport.NewHandler(*cfg.CortexHandlerConfig, roundTripper, logger)
+	// Create the query frontend transport. The slow queries are logged by the slow query log handler, with more
+	// details than by the transport.
+	handlerConfig := *cfg.CortexHandlerConfig
+	handlerConfig.LogQueriesLongerThan = 0
+	handler := transport.NewHandler(handlerConfig, roundTripper, logger)
+	if threshold := cfg.CortexHandlerConfig.LogQueriesLongerThan; threshold != 0 {
+		slowQueryLogger := logger
+		if cfg.SlowQueryLogFile != "" {
+			f, err := os.OpenFile(cfg.SlowQueryLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+			if err != nil {
+				return errors.Wrap(err, "open slow query log file")
+			}
+			// The file is written to until the process exits.
+			slowQueryLogger = log.With(log.NewJSONLogger(log.NewSyncWriter(f)), "ts", log.DefaultTimestampUTC)
+		}
+		handler = queryfrontend.NewSlowQueryLogHandler(handler, threshold, slowQueryLogger)
+	}
 	if cfg.CompressResponses {
 		handler = gziphandler.GzipHandler(handler)
 	}
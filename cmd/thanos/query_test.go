@@ -4,11 +4,18 @@
 package main
 
 import (
+	"context"
+	"math"
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/log"
 	"github.com/prometheus/prometheus/promql"
+	"google.golang.org/grpc"
 
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/discovery/endpoints"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -102,10 +109,74 @@ func TestEngineFactory(t *testing.T) {
 		}
 	)
 	for _, td := range tData {
-		e := engineFactory(mockNewEngine, promql.EngineOpts{LookbackDelta: td.lookbackDelta}, td.dynamicLookbackDelta)
+		e := engineFactory(mockNewEngine, promql.EngineOpts{LookbackDelta: td.lookbackDelta}, td.dynamicLookbackDelta, downsample.DefaultLevels.Resolutions())
 		for _, tc := range td.tcs {
 			got := e(tc.stepMillis)
 			testutil.Equals(t, tc.expect, got)
 		}
 	}
 }
+
+func TestEngineFactory_AdditionalResolution(t *testing.T) {
+	var (
+		engineRaw = promql.NewEngine(promql.EngineOpts{})
+		engine5m  = promql.NewEngine(promql.EngineOpts{LookbackDelta: 5 * time.Minute})
+		engine1h  = promql.NewEngine(promql.EngineOpts{LookbackDelta: 1 * time.Hour})
+		engine1d  = promql.NewEngine(promql.EngineOpts{LookbackDelta: 24 * time.Hour})
+	)
+	mockNewEngine := func(opts promql.EngineOpts) *promql.Engine {
+		switch opts.LookbackDelta {
+		case 24 * time.Hour:
+			return engine1d
+		case 1 * time.Hour:
+			return engine1h
+		case 5 * time.Minute:
+			return engine5m
+		default:
+			return engineRaw
+		}
+	}
+
+	resolutions, err := parseDownsamplingResolutions([]string{"1d"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{downsample.ResLevel0, downsample.ResLevel1, downsample.ResLevel2, 24 * time.Hour.Milliseconds()}, resolutions)
+
+	_, err = parseDownsamplingResolutions([]string{"1h"})
+	testutil.NotOk(t, err)
+
+	e := engineFactory(mockNewEngine, promql.EngineOpts{}, true, resolutions)
+	testutil.Equals(t, engineRaw, e(0))
+	testutil.Equals(t, engine5m, e(time.Minute.Milliseconds()))
+	testutil.Equals(t, engine1h, e(time.Hour.Milliseconds()))
+	testutil.Equals(t, engine1d, e(2*time.Hour.Milliseconds()))
+}
+
+func TestEndpointGroups(t *testing.T) {
+	logger := log.NewNopLogger()
+	grpcOpts := []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32))}
+
+	groups := newEndpointGroups(logger, grpcOpts, dns.NewProvider(logger, nil, ""))
+	groups.Update([]endpoints.Config{
+		{Targets: []string{"store-1:10901", "store-2:10901"}},
+		{Targets: []string{"rule-1:10901"}, Strict: true, APIs: []string{endpoints.APIStore, endpoints.APIRules}, TLSConfig: &endpoints.TLSConfig{}},
+		// The groups with invalid TLS settings are skipped.
+		{Targets: []string{"rule-2:10901"}, TLSConfig: &endpoints.TLSConfig{Secure: true, CAFile: "/nonexistent/ca.crt"}},
+	})
+	testutil.Equals(t, 0, len(groups.StoreSpecs()))
+
+	testutil.Ok(t, groups.Resolve(context.Background()))
+	specs := groups.StoreSpecs()
+	testutil.Equals(t, 3, len(specs))
+	for i, addr := range []string{"store-1:10901", "store-2:10901", "rule-1:10901"} {
+		testutil.Equals(t, addr, specs[i].Addr())
+	}
+	testutil.Assert(t, !specs[0].StrictStatic() && specs[0].DialOpts() == nil, "store-1 should use the options of the flags")
+	testutil.Assert(t, specs[2].StrictStatic(), "rule-1 should be strict")
+	testutil.Equals(t, 2, len(specs[2].DialOpts()))
+
+	testutil.Equals(t, []string{"store-1:10901", "store-2:10901", "rule-1:10901"}, groups.Addresses(endpoints.APIStore))
+	testutil.Equals(t, []string{"rule-1:10901"}, groups.Addresses(endpoints.APIRules))
+	testutil.Equals(t, []string(nil), groups.Addresses(endpoints.APITargets))
+	// The dial options of the flags are left unmodified.
+	testutil.Equals(t, 1, len(grpcOpts))
+}
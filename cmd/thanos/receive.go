@@ -19,14 +19,20 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
 
+	"github.com/thanos-io/thanos/pkg/accounting"
+	receiveAPI "github.com/thanos-io/thanos/pkg/api/receive"
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extgrpc"
 	"github.com/thanos-io/thanos/pkg/extprom"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/logging"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
@@ -34,6 +40,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+	"github.com/thanos-io/thanos/pkg/server/http/auth"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/tls"
 )
@@ -42,6 +49,8 @@ func registerReceive(app *extkingpin.App) {
 	cmd := app.Command(component.Receive.String(), "Accept Prometheus remote write API requests and write to local tsdb.")
 
 	httpBindAddr, httpGracePeriod := extkingpin.RegisterHTTPFlags(cmd)
+	httpAuthConfig := extkingpin.RegisterHTTPAuthFlags(cmd)
+	accountingConf := new(accountingConfig).registerFlag(cmd)
 	grpcBindAddr, grpcGracePeriod, grpcCert, grpcKey, grpcClientCA := extkingpin.RegisterGRPCFlags(cmd)
 
 	rwAddress := cmd.Flag("remote-write.address", "Address to listen on for remote write requests.").
@@ -75,14 +84,32 @@ func registerReceive(app *extkingpin.App) {
 
 	defaultTenantID := cmd.Flag("receive.default-tenant-id", "Default tenant ID to use when none is provided via a header.").Default(receive.DefaultTenant).String()
 
+	splitTenantLabelName := cmd.Flag("receive.split-tenant-label-name", "Label name of the series holding their tenant. If set, the series of write requests are split by tenant, taking precedence over the tenant header, and the label is removed from them. The series without the label belong to the tenant of the header.").Default("").String()
+
 	tenantLabelName := cmd.Flag("receive.tenant-label-name", "Label name through which the tenant will be announced.").Default(receive.DefaultTenantLabel).String()
 
 	replicaHeader := cmd.Flag("receive.replica-header", "HTTP header specifying the replica number of a write request.").Default(receive.DefaultReplicaHeader).String()
 
 	replicationFactor := cmd.Flag("receive.replication-factor", "How many times to replicate incoming write requests.").Default("1").Uint64()
 
+	replicationQuorum := cmd.Flag("receive.replication-quorum", "How many replicas of incoming write requests have to be written for them to succeed. 0 means a majority of the replication factor.").Default("0").Uint64()
+
+	asyncReplication := cmd.Flag("receive.replication-async", "If true, incoming write requests succeed as soon as their local replica, or their first one, is written, and the other replicas are written in the background, with retries. This lowers the latency of the write requests at the cost of their durability.").Default("false").Bool()
+
+	asyncReplicationMaxPending := cmd.Flag("receive.replication-async-max-pending", "Maximum number of replicas written in the background with --receive.replication-async, 0 for no limit. Once reached, the replicas are written before the write requests succeed.").Default("1000").Int()
+
+	forwardConcurrency := cmd.Flag("receive.forward-concurrency", "Maximum number of concurrent requests forwarded to the other receivers of the hashring. 0 means no limit.").Default("0").Int()
+
 	forwardTimeout := extkingpin.ModelDuration(cmd.Flag("receive-forward-timeout", "Timeout for each forward request.").Default("5s").Hidden())
 
+	limitsConfig := extflag.RegisterPathOrContent(cmd, "receive.limits-config", "YAML file that contains the limits of the write requests of the tenants. See format details: https://thanos.io/tip/components/receive.md/#limits", false)
+
+	headSeriesLimit := cmd.Flag("receive.head-series-limit", "Maximum number of active series of the TSDB of each tenant, i.e. series which received samples in the last 10 minutes. The samples of new series are rejected once it is reached. 0 means no limit.").Default("0").Int()
+
+	idleTenantTimeout := extkingpin.ModelDuration(cmd.Flag("receive.idle-tenant-timeout", "Duration after which the TSDB of a tenant receiving no writes is flushed, uploaded, closed and removed, to free its resources. It is re-created on the next write of the tenant. Requires the object storage to be configured. 0 disables it.").Default("0s"))
+
+	tenantTSDBConfig := extflag.RegisterPathOrContent(cmd, "receive.tenant-tsdb-config", "YAML file that contains the TSDB options of the tenants, overriding the ones of the flags. See format details: https://thanos.io/tip/components/receive.md/#tenant-tsdb-options", false)
+
 	tsdbMinBlockDuration := extkingpin.ModelDuration(cmd.Flag("tsdb.min-block-duration", "Min duration for local TSDB blocks").Default("2h").Hidden())
 	tsdbMaxBlockDuration := extkingpin.ModelDuration(cmd.Flag("tsdb.max-block-duration", "Max duration for local TSDB blocks").Default("2h").Hidden())
 	walCompression := cmd.Flag("tsdb.wal-compression", "Compress the tsdb WAL.").Default("true").Bool()
@@ -94,12 +121,51 @@ func registerReceive(app *extkingpin.App) {
 			"This can trigger compaction without those blocks and as a result will create an overlap situation. Set it to true if you have vertical compaction enabled and wish to upload blocks as soon as possible without caring"+
 			"about order.").
 		Default("false").Hidden().Bool()
+	uploadConf := (&shipperUploadConfig{}).registerFlag(cmd)
+	annotations := cmd.Flag("shipper.annotation", shipperAnnotationHelp+" The tenant of the blocks is also added.").PlaceHolder("KEY=VALUE").StringMap()
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 		lset, err := parseFlagLabels(*labelStrs)
 		if err != nil {
 			return errors.Wrap(err, "parse labels")
 		}
+		blockAnnotations, err := shipperAnnotations(*annotations)
+		if err != nil {
+			return err
+		}
+
+		// The same middleware authenticates the requests of both the HTTP and remote write servers.
+		httpAuth, err := newHTTPAuthMiddleware(logger, reg, httpAuthConfig)
+		if err != nil {
+			return errors.Wrap(err, "configure HTTP auth")
+		}
+
+		accountant, err := accountingConf.accountant(g, logger, reg, component.Receive)
+		if err != nil {
+			return errors.Wrap(err, "configure accounting")
+		}
+
+		if *replicationQuorum > *replicationFactor {
+			return errors.New("--receive.replication-quorum cannot be greater than --receive.replication-factor")
+		}
+		if *replicationQuorum > 0 && *asyncReplication {
+			return errors.New("--receive.replication-quorum and --receive.replication-async are mutually exclusive")
+		}
+		if *forwardConcurrency < 0 {
+			return errors.New("--receive.forward-concurrency must not be negative")
+		}
+		if *headSeriesLimit < 0 {
+			return errors.New("--receive.head-series-limit must not be negative")
+		}
+
+		limitsConfigYAML, err := limitsConfig.Content()
+		if err != nil {
+			return err
+		}
+		limiter, err := receive.NewLimiter(reg, limitsConfigYAML)
+		if err != nil {
+			return errors.Wrap(err, "configure limits")
+		}
 
 		var cw *receive.ConfigWatcher
 		if *hashringsFile != "" {
@@ -117,6 +183,15 @@ func registerReceive(app *extkingpin.App) {
 			WALCompression:    *walCompression,
 		}
 
+		tenantTSDBConfigYAML, err := tenantTSDBConfig.Content()
+		if err != nil {
+			return err
+		}
+		tenantTSDBOpts, err := receive.NewTenantTSDBOptions(tsdbOpts, tenantTSDBConfigYAML)
+		if err != nil {
+			return errors.Wrap(err, "configure tenant TSDB options")
+		}
+
 		// Local is empty, so try to generate a local endpoint
 		// based on the hostname and the listening port.
 		if *localEndpoint == "" {
@@ -141,6 +216,7 @@ func registerReceive(app *extkingpin.App) {
 			*grpcClientCA,
 			*httpBindAddr,
 			time.Duration(*httpGracePeriod),
+			httpAuth,
 			*rwAddress,
 			*rwServerCert,
 			*rwServerKey,
@@ -152,18 +228,31 @@ func registerReceive(app *extkingpin.App) {
 			*dataDir,
 			objStoreConfig,
 			tsdbOpts,
+			tenantTSDBOpts,
 			*ignoreBlockSize,
 			lset,
 			cw,
 			*localEndpoint,
 			*tenantHeader,
 			*defaultTenantID,
+			*splitTenantLabelName,
 			*tenantLabelName,
 			*replicaHeader,
 			*replicationFactor,
+			*replicationQuorum,
+			*asyncReplication,
+			*asyncReplicationMaxPending,
+			*forwardConcurrency,
 			time.Duration(*forwardTimeout),
+			limiter,
+			*headSeriesLimit,
+			time.Duration(*idleTenantTimeout),
 			*allowOutOfOrderUpload,
+			uploadConf.uploadOptions(),
+			accountant,
+			blockAnnotations,
 			component.Receive,
+			getFlagsMap(cmd.Flags()),
 		)
 	})
 }
@@ -180,6 +269,7 @@ func runReceive(
 	grpcClientCA string,
 	httpBindAddr string,
 	httpGracePeriod time.Duration,
+	httpAuth *auth.Middleware,
 	rwAddress string,
 	rwServerCert string,
 	rwServerKey string,
@@ -191,18 +281,31 @@ func runReceive(
 	dataDir string,
 	objStoreConfig *extflag.PathOrContent,
 	tsdbOpts *tsdb.Options,
+	tenantTSDBOpts *receive.TenantTSDBOptions,
 	ignoreBlockSize bool,
 	lset labels.Labels,
 	cw *receive.ConfigWatcher,
 	endpoint string,
 	tenantHeader string,
 	defaultTenantID string,
+	splitTenantLabelName string,
 	tenantLabelName string,
 	replicaHeader string,
 	replicationFactor uint64,
+	replicationQuorum uint64,
+	asyncReplication bool,
+	asyncReplicationMaxPending int,
+	forwardConcurrency int,
 	forwardTimeout time.Duration,
+	limiter *receive.Limiter,
+	headSeriesLimit int,
+	idleTenantTimeout time.Duration,
 	allowOutOfOrderUpload bool,
+	uploadOpts block.UploadOptions,
+	accountant *accounting.Accountant,
+	annotations map[string]string,
 	comp component.SourceStoreAPI,
+	flagsMap map[string]string,
 ) error {
 	logger = log.With(logger, "component", "receive")
 	level.Warn(logger).Log("msg", "setting up receive")
@@ -237,6 +340,10 @@ func runReceive(
 		}
 	} else {
 		level.Info(logger).Log("msg", "no supported bucket was configured, uploads will be disabled")
+		if idleTenantTimeout > 0 {
+			// The local TSDB is the only copy of the data of the tenants, so it is never removed.
+			level.Warn(logger).Log("msg", "idle tenants are not pruned, as uploads are disabled")
+		}
 	}
 
 	// TODO(brancz): remove after a couple of versions
@@ -250,27 +357,56 @@ func runReceive(
 		logger,
 		reg,
 		tsdbOpts,
+		tenantTSDBOpts,
 		lset,
 		tenantLabelName,
 		bkt,
 		allowOutOfOrderUpload,
+		uploadOpts,
+		annotations,
 	)
-	writer := receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs)
+	activeSeries := receive.NewActiveSeries(reg, headSeriesLimit)
+	writer := receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs, activeSeries, accountant)
 	webHandler := receive.NewHandler(log.With(logger, "component", "receive-handler"), &receive.Options{
-		Writer:            writer,
-		ListenAddress:     rwAddress,
-		Registry:          reg,
-		Endpoint:          endpoint,
-		TenantHeader:      tenantHeader,
-		DefaultTenantID:   defaultTenantID,
-		ReplicaHeader:     replicaHeader,
-		ReplicationFactor: replicationFactor,
-		Tracer:            tracer,
-		TLSConfig:         rwTLSConfig,
-		DialOpts:          dialOpts,
-		ForwardTimeout:    forwardTimeout,
+		Writer:                     writer,
+		ListenAddress:              rwAddress,
+		Registry:                   reg,
+		Endpoint:                   endpoint,
+		TenantHeader:               tenantHeader,
+		DefaultTenantID:            defaultTenantID,
+		ReplicaHeader:              replicaHeader,
+		ReplicationFactor:          replicationFactor,
+		ReplicationQuorum:          replicationQuorum,
+		AsyncReplication:           asyncReplication,
+		AsyncReplicationMaxPending: asyncReplicationMaxPending,
+		ForwardConcurrency:         forwardConcurrency,
+		Tracer:                     tracer,
+		TLSConfig:                  rwTLSConfig,
+		Auth:                       httpAuth,
+		DialOpts:                   dialOpts,
+		ForwardTimeout:             forwardTimeout,
+		SplitTenantLabelName:       splitTenantLabelName,
+		Limiter:                    limiter,
 	})
 
+	if accountant != nil {
+		// The stored bytes of the tenants are refreshed periodically, as walking their TSDBs is expensive.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Minute, ctx.Done(), func() error {
+				sizes, err := dbs.TenantsStoredBytes()
+				if err != nil {
+					level.Warn(logger).Log("msg", "failed to get the stored bytes of the tenants", "err", err)
+					return nil
+				}
+				accountant.SetStoredBytes(sizes)
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
+
 	grpcProbe := prober.NewGRPC()
 	httpProbe := prober.NewHTTP()
 	statusProber := prober.Combine(
@@ -423,7 +559,26 @@ func runReceive(
 	srv := httpserver.New(logger, reg, comp, httpProbe,
 		httpserver.WithListen(httpBindAddr),
 		httpserver.WithGracePeriod(httpGracePeriod),
+		httpserver.WithAuth(httpAuth),
 	)
+	{
+		r := route.New()
+		ins := extpromhttp.NewInstrumentationMiddleware(reg)
+		// Configure Request Logging for HTTP calls.
+		opts := []logging.Option{logging.WithDecider(func() logging.Decision {
+			return logging.NoLogCall
+		})}
+		logMiddleware := logging.NewHTTPServerMiddleware(logger, opts...)
+		// The active series of all the tenants are only exposed to the authenticated requests.
+		apiActiveSeries := activeSeries
+		if activeSeries != nil && httpAuth == nil {
+			level.Info(logger).Log("msg", "active series API disabled, as it requires --http.auth-config")
+			apiActiveSeries = nil
+		}
+		api := receiveAPI.NewReceiveAPI(logger, apiActiveSeries, flagsMap)
+		api.Register(r.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
+		srv.Handle("/", r)
+	}
 	g.Add(func() error {
 		statusProber.Healthy()
 
@@ -562,6 +717,12 @@ func runReceive(
 					case <-tick.C:
 						if err := upload(ctx); err != nil {
 							level.Warn(logger).Log("msg", "recurring upload failed", "err", err)
+							continue
+						}
+						if idleTenantTimeout > 0 {
+							if err := dbs.Prune(ctx, idleTenantTimeout); err != nil {
+								level.Warn(logger).Log("msg", "pruning idle tenants failed", "err", err)
+							}
 						}
 					}
 				}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"context"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/url"
@@ -23,9 +24,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/util/strutil"
 	"github.com/thanos-io/thanos/pkg/errutil"
@@ -33,10 +37,12 @@ import (
 
 	"github.com/thanos-io/thanos/pkg/alert"
 	v1 "github.com/thanos-io/thanos/pkg/api/rule"
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
 	"github.com/thanos-io/thanos/pkg/extflag"
+	"github.com/thanos-io/thanos/pkg/extgrpc"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	http_util "github.com/thanos-io/thanos/pkg/http"
@@ -49,6 +55,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+	"github.com/thanos-io/thanos/pkg/server/http/auth"
 	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -57,12 +64,16 @@ import (
 	"github.com/thanos-io/thanos/pkg/ui"
 )
 
+// shardPeerHealthCheckTimeout is the timeout of the health checks of the ruler replicas sharing the rule groups.
+const shardPeerHealthCheckTimeout = 5 * time.Second
+
 // registerRule registers a rule command.
 func registerRule(app *extkingpin.App) {
 	comp := component.Rule
 	cmd := app.Command(comp.String(), "ruler evaluating Prometheus rules against given Query nodes, exposing Store API and storing old blocks in bucket")
 
 	httpBindAddr, httpGracePeriod := extkingpin.RegisterHTTPFlags(cmd)
+	httpAuthConfig := extkingpin.RegisterHTTPAuthFlags(cmd)
 	grpcBindAddr, grpcGracePeriod, grpcCert, grpcKey, grpcClientCA := extkingpin.RegisterGRPCFlags(cmd)
 
 	labelStrs := cmd.Flag("label", "Labels to be applied to all generated metrics (repeated). Similar to external labels for Prometheus, used to identify ruler and its blocks as unique source.").
@@ -76,6 +87,10 @@ func registerRule(app *extkingpin.App) {
 		Default("1m"))
 	evalInterval := extkingpin.ModelDuration(cmd.Flag("eval-interval", "The default evaluation interval to use.").
 		Default("30s"))
+	evalQueryOffset := extkingpin.ModelDuration(cmd.Flag("eval-query-offset", "The default query offset of the rule groups, to use for the groups not defining their own 'query_offset'. The rules are evaluated against the samples written this long before the evaluation time, which tolerates ingestion delays, e.g. of remote write.").
+		Default("0s"))
+	evalJitter := extkingpin.ModelDuration(cmd.Flag("eval-jitter", "Maximum random delay before each query of the rule evaluations. It spreads the queries of the rulers over time and gives the late samples more time to arrive, without changing the evaluation time. As the rules of a group are evaluated in sequence, it should be much smaller than the evaluation interval of the groups divided by their number of rules.").
+		Default("0s"))
 	tsdbBlockDuration := extkingpin.ModelDuration(cmd.Flag("tsdb.block-duration", "Block duration for TSDB block.").
 		Default("2h"))
 	tsdbRetention := extkingpin.ModelDuration(cmd.Flag("tsdb.retention", "Block retention time on local disk.").
@@ -102,6 +117,8 @@ func registerRule(app *extkingpin.App) {
 
 	objStoreConfig := extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
 
+	remoteWriteConfig := extflag.RegisterPathOrContent(cmd, "remote-write.config", "YAML config of the remote write endpoints, e.g. Thanos Receive, that the evaluated samples are sent to. See format details: https://thanos.io/tip/components/rule.md/#stateless-mode. If defined, the ruler runs in stateless mode: its local TSDB is only used as the write-ahead log of the samples, which are neither exposed through the Store API nor uploaded to the bucket.", false)
+
 	queries := cmd.Flag("query", "Addresses of statically configured query API servers (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect query API servers through respective DNS lookups.").
 		PlaceHolder("<query>").Strings()
 
@@ -122,11 +139,39 @@ func registerRule(app *extkingpin.App) {
 	dnsSDResolver := cmd.Flag("query.sd-dns-resolver", "Resolver to use. Possible options: [golang, miekgdns]").
 		Default("golang").Hidden().String()
 
+	ruleStorageConfig := extkingpin.RegisterCommonObjStoreFlags(cmd, "-rules", false, "If defined, the rule files of the tenants are also loaded from this bucket, and can be managed through the rule storage API. See details: https://thanos.io/tip/components/rule.md/#rule-storage")
+
+	ruleStoragePrefix := cmd.Flag("rule-storage.prefix", "Prefix of the rule files of the tenants in the '--objstore-rules.config*' bucket.").
+		Default("rules/").String()
+
+	ruleStorageSyncInterval := extkingpin.ModelDuration(cmd.Flag("rule-storage.sync-interval", "Interval between the reloads of the rule files from the '--objstore-rules.config*' bucket.").
+		Default("1m"))
+
+	ruleStorageAPITokensFile := cmd.Flag("rule-storage.api-tokens-file", "Path to the YAML file with the bearer tokens of the tenants, the rule storage API requests have to be authenticated with. A request can only manage the rule groups of the tenant of its token. If not defined, the rule storage API is disabled. See details: https://thanos.io/tip/components/rule.md/#rule-storage").
+		PlaceHolder("<path>").String()
+
+	shardSelf := cmd.Flag("rule.shard.self", "Address of this ruler replica, as discovered through the '--rule.shard.peer' or '--rule.shard.peer-sd-files' flags. If defined, the rule groups are sharded across the discovered replicas, so that each group is evaluated by a single replica. See details: https://thanos.io/tip/components/rule.md/#rule-group-sharding").
+		PlaceHolder("<address>").String()
+
+	shardPeers := cmd.Flag("rule.shard.peer", "Addresses of the ruler replicas sharing the rule groups (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect the replicas through respective DNS lookups, every '--query.sd-dns-interval'.").
+		PlaceHolder("<peer>").Strings()
+
+	shardPeerSDFiles := cmd.Flag("rule.shard.peer-sd-files", "Path to file that contains addresses of the ruler replicas sharing the rule groups. The path can be a glob pattern (repeatable).").
+		PlaceHolder("<path>").Strings()
+
+	shardSecure := cmd.Flag("rule.shard.grpc-client-tls-secure", "Use TLS when health checking the gRPC servers of the ruler replicas sharing the rule groups.").Default("false").Bool()
+	shardCert := cmd.Flag("rule.shard.grpc-client-tls-cert", "TLS Certificates to use to identify this client to the ruler replicas sharing the rule groups.").Default("").String()
+	shardKey := cmd.Flag("rule.shard.grpc-client-tls-key", "TLS Key for the client's certificate.").Default("").String()
+	shardCACert := cmd.Flag("rule.shard.grpc-client-tls-ca", "TLS CA Certificates to use to verify the gRPC servers of the ruler replicas sharing the rule groups.").Default("").String()
+	shardServerName := cmd.Flag("rule.shard.grpc-client-server-name", "Server name to verify the hostname on the returned gRPC certificates of the ruler replicas sharing the rule groups. See https://tools.ietf.org/html/rfc4366#section-3.1").Default("").String()
+
 	allowOutOfOrderUpload := cmd.Flag("shipper.allow-out-of-order-uploads",
 		"If true, shipper will skip failed block uploads in the given iteration and retry later. This means that some newer blocks might be uploaded sooner than older blocks."+
 			"This can trigger compaction without those blocks and as a result will create an overlap situation. Set it to true if you have vertical compaction enabled and wish to upload blocks as soon as possible without caring"+
 			"about order.").
 		Default("false").Hidden().Bool()
+	uploadConf := (&shipperUploadConfig{}).registerFlag(cmd)
+	annotations := cmd.Flag("shipper.annotation", shipperAnnotationHelp).PlaceHolder("KEY=VALUE").StringMap()
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, reload <-chan struct{}, _ bool) error {
 		lset, err := parseFlagLabels(*labelStrs)
@@ -137,6 +182,10 @@ func registerRule(app *extkingpin.App) {
 		if err != nil {
 			return errors.Wrap(err, "parse alert query url")
 		}
+		blockAnnotations, err := shipperAnnotations(*annotations)
+		if err != nil {
+			return err
+		}
 
 		tsdbOpts := &tsdb.Options{
 			MinBlockDuration:  int64(time.Duration(*tsdbBlockDuration) / time.Millisecond),
@@ -176,6 +225,62 @@ func registerRule(app *extkingpin.App) {
 			return errors.New("--alertmanagers.url and --alertmanagers.config* parameters cannot be defined at the same time")
 		}
 
+		// Parse and check remote write configuration.
+		remoteWriteConfigYAML, err := remoteWriteConfig.Content()
+		if err != nil {
+			return err
+		}
+		if len(remoteWriteConfigYAML) != 0 {
+			objStoreConfigYAML, err := objStoreConfig.Content()
+			if err != nil {
+				return err
+			}
+			if len(objStoreConfigYAML) != 0 {
+				return errors.New("--remote-write.config* and --objstore.config* parameters cannot be defined at the same time")
+			}
+		}
+
+		// Parse and check rule storage configuration.
+		ruleStorageConfigYAML, err := ruleStorageConfig.Content()
+		if err != nil {
+			return err
+		}
+		var ruleStorageAPITokens []v1.TenantToken
+		if *ruleStorageAPITokensFile != "" {
+			if len(ruleStorageConfigYAML) == 0 {
+				return errors.New("--rule-storage.api-tokens-file parameter requires --objstore-rules.config*")
+			}
+			b, err := ioutil.ReadFile(*ruleStorageAPITokensFile)
+			if err != nil {
+				return errors.Wrap(err, "read rule storage API tokens file")
+			}
+			ruleStorageAPITokens, err = v1.ParseTenantTokens(b)
+			if err != nil {
+				return errors.Wrapf(err, "parse rule storage API tokens file %s", *ruleStorageAPITokensFile)
+			}
+		}
+
+		// Parse and check sharding configuration.
+		if *shardSelf == "" && (len(*shardPeers) != 0 || len(*shardPeerSDFiles) != 0) {
+			return errors.New("--rule.shard.peer/--rule.shard.peer-sd-files parameters require --rule.shard.self")
+		}
+		if *shardSelf != "" && len(*shardPeers) == 0 && len(*shardPeerSDFiles) == 0 {
+			return errors.New("--rule.shard.self parameter requires --rule.shard.peer or --rule.shard.peer-sd-files")
+		}
+		var shardPeerCheck thanosrules.PeerHealthChecker
+		if *shardSelf != "" {
+			tlsOpt, err := extgrpc.StoreClientTLSOpt(logger, *shardSecure, *shardCert, *shardKey, *shardCACert, *shardServerName)
+			if err != nil {
+				return errors.Wrap(err, "configure rule shard peers TLS")
+			}
+			shardPeerCheck = thanosrules.NewGRPCPeerHealthChecker(shardPeerHealthCheckTimeout, tlsOpt)
+		}
+
+		httpAuth, err := newHTTPAuthMiddleware(logger, reg, httpAuthConfig)
+		if err != nil {
+			return errors.Wrap(err, "configure HTTP auth")
+		}
+
 		return runRule(g,
 			logger,
 			reg,
@@ -194,14 +299,18 @@ func registerRule(app *extkingpin.App) {
 			*grpcClientCA,
 			*httpBindAddr,
 			time.Duration(*httpGracePeriod),
+			httpAuth,
 			*webRoutePrefix,
 			*webExternalPrefix,
 			*webPrefixHeaderName,
 			time.Duration(*resendDelay),
 			time.Duration(*evalInterval),
+			time.Duration(*evalQueryOffset),
+			time.Duration(*evalJitter),
 			*dataDir,
 			*ruleFiles,
 			objStoreConfig,
+			remoteWriteConfigYAML,
 			tsdbOpts,
 			alertQueryURL,
 			*alertExcludeLabels,
@@ -211,8 +320,18 @@ func registerRule(app *extkingpin.App) {
 			queryConfigYAML,
 			time.Duration(*dnsSDInterval),
 			*dnsSDResolver,
+			ruleStorageConfigYAML,
+			*ruleStoragePrefix,
+			time.Duration(*ruleStorageSyncInterval),
+			ruleStorageAPITokens,
+			*shardSelf,
+			*shardPeers,
+			*shardPeerSDFiles,
+			shardPeerCheck,
 			comp,
 			*allowOutOfOrderUpload,
+			uploadConf.uploadOptions(),
+			blockAnnotations,
 			*httpMethod,
 			getFlagsMap(cmd.Flags()),
 		)
@@ -226,6 +345,7 @@ type RuleMetrics struct {
 	duplicatedQuery   prometheus.Counter
 	rulesLoaded       *prometheus.GaugeVec
 	ruleEvalWarnings  *prometheus.CounterVec
+	shardPeers        prometheus.Gauge
 }
 
 func newRuleMetrics(reg *prometheus.Registry) *RuleMetrics {
@@ -257,6 +377,10 @@ func newRuleMetrics(reg *prometheus.Registry) *RuleMetrics {
 			Help: "The total number of rule evaluation that were successful but had warnings which can indicate partial error.",
 		}, []string{"strategy"},
 	)
+	m.shardPeers = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_rule_shard_peers",
+		Help: "Number of healthy ruler replicas the rule groups are sharded across, including this one, or 0 if this replica evaluates no group.",
+	})
 	m.ruleEvalWarnings.WithLabelValues(strings.ToLower(storepb.PartialResponseStrategy_ABORT.String()))
 	m.ruleEvalWarnings.WithLabelValues(strings.ToLower(storepb.PartialResponseStrategy_WARN.String()))
 
@@ -284,14 +408,18 @@ func runRule(
 	grpcClientCA string,
 	httpBindAddr string,
 	httpGracePeriod time.Duration,
+	httpAuth *auth.Middleware,
 	webRoutePrefix string,
 	webExternalPrefix string,
 	webPrefixHeaderName string,
 	resendDelay time.Duration,
 	evalInterval time.Duration,
+	evalQueryOffset time.Duration,
+	evalJitter time.Duration,
 	dataDir string,
 	ruleFiles []string,
 	objStoreConfig *extflag.PathOrContent,
+	remoteWriteConfigYAML []byte,
 	tsdbOpts *tsdb.Options,
 	alertQueryURL *url.URL,
 	alertExcludeLabels []string,
@@ -301,8 +429,18 @@ func runRule(
 	queryConfigYAML []byte,
 	dnsSDInterval time.Duration,
 	dnsSDResolver string,
+	ruleStorageConfigYAML []byte,
+	ruleStoragePrefix string,
+	ruleStorageSyncInterval time.Duration,
+	ruleStorageAPITokens []v1.TenantToken,
+	shardSelf string,
+	shardPeers []string,
+	shardPeerSDFiles []string,
+	shardPeerCheck thanosrules.PeerHealthChecker,
 	comp component.Component,
 	allowOutOfOrderUpload bool,
+	uploadOpts block.UploadOptions,
+	annotations map[string]string,
 	httpMethod string,
 	flagsMap map[string]string,
 ) error {
@@ -380,6 +518,24 @@ func runRule(
 		})
 	}
 
+	// In stateless mode, the samples appended to the TSDB are sent to the remote write endpoints from its WAL.
+	var appendable storage.Appendable = db
+	if len(remoteWriteConfigYAML) > 0 {
+		remoteStore, err := newRemoteWriteStorage(logger, reg, remoteWriteConfigYAML, lset, db, dataDir)
+		if err != nil {
+			return err
+		}
+		done := make(chan struct{})
+		g.Add(func() error {
+			<-done
+			return remoteStore.Close()
+		}, func(error) {
+			close(done)
+		})
+		appendable = storage.NewFanout(logger, db, remoteStore)
+		level.Info(logger).Log("msg", "remote write enabled, running in stateless mode")
+	}
+
 	// Build the Alertmanager clients.
 	var alertingCfg alert.AlertingConfig
 	if len(alertmgrsConfigYAML) > 0 {
@@ -422,7 +578,91 @@ func runRule(
 		// Discover and resolve Alertmanager addresses.
 		addDiscoveryGroups(g, amClient, alertmgrsDNSSDInterval)
 
-		alertmgrs = append(alertmgrs, alert.NewAlertmanager(logger, amClient, time.Duration(cfg.Timeout), cfg.APIVersion))
+		alertmgrs = append(alertmgrs, alert.NewAlertmanager(logger, amClient, time.Duration(cfg.Timeout), cfg.APIVersion, cfg.AlertRelabelConfigs))
+	}
+
+	// Load the rule files of the tenants from the rule storage bucket, if any.
+	var ruleStorage *thanosrules.Storage
+	if len(ruleStorageConfigYAML) > 0 {
+		bkt, err := client.NewBucket(logger, ruleStorageConfigYAML, nil, component.Rule.String())
+		if err != nil {
+			return err
+		}
+		ruleStorage = thanosrules.NewStorage(logger, bkt, ruleStoragePrefix, filepath.Join(dataDir, "rule-storage"))
+
+		done := make(chan struct{})
+		g.Add(func() error {
+			<-done
+			return bkt.Close()
+		}, func(error) {
+			close(done)
+		})
+	}
+
+	// Discover the ruler replicas sharing the rule groups, and rebalance the groups when they change.
+	var (
+		sharder *thanosrules.Sharder
+		reshard = make(chan struct{}, 1)
+	)
+	if shardSelf != "" {
+		sharder = thanosrules.NewSharder(logger, shardSelf, shardPeerCheck)
+
+		var fileSDConfigs []http_util.FileSDConfig
+		if len(shardPeerSDFiles) > 0 {
+			fileSDConfigs = append(fileSDConfigs, http_util.FileSDConfig{
+				Files:           shardPeerSDFiles,
+				RefreshInterval: model.Duration(querySDInterval),
+			})
+		}
+		peersClient, err := http_util.NewClient(
+			logger,
+			http_util.EndpointsConfig{StaticAddresses: shardPeers, FileSDConfigs: fileSDConfigs},
+			nil,
+			dns.NewProvider(
+				logger,
+				extprom.WrapRegistererWithPrefix("thanos_rule_shard_peers_", reg),
+				dns.ResolverType(dnsSDResolver),
+			),
+		)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			peersClient.Discover(ctx)
+			return nil
+		}, func(error) {
+			cancel()
+		})
+		g.Add(func() error {
+			return runutil.Repeat(dnsSDInterval, ctx.Done(), func() error {
+				if err := peersClient.Resolve(ctx); err != nil {
+					level.Error(logger).Log("msg", "resolve rule shard peers", "err", err)
+					return nil
+				}
+				var peers []string
+				for _, u := range peersClient.Endpoints() {
+					peers = append(peers, u.Host)
+				}
+				changed, err := sharder.SetPeers(ctx, peers)
+				if err != nil {
+					level.Error(logger).Log("msg", "no rule group is evaluated by this replica", "err", err)
+				}
+				if !changed {
+					return nil
+				}
+				metrics.shardPeers.Set(float64(len(sharder.Peers())))
+				level.Info(logger).Log("msg", "rule shard peers changed", "peers", strings.Join(sharder.Peers(), ","))
+				select {
+				case reshard <- struct{}{}:
+				default:
+				}
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
 	}
 
 	var (
@@ -463,13 +703,15 @@ func runRule(
 			rules.ManagerOptions{
 				NotifyFunc:  notifyFunc,
 				Logger:      logger,
-				Appendable:  db,
+				Appendable:  appendable,
 				ExternalURL: nil,
 				Queryable:   db,
 				ResendDelay: resendDelay,
 			},
-			queryFuncCreator(logger, queryClients, metrics.duplicatedQuery, metrics.ruleEvalWarnings, httpMethod),
+			queryFuncCreator(logger, queryClients, metrics.duplicatedQuery, metrics.ruleEvalWarnings, httpMethod, evalJitter),
 			lset,
+			evalQueryOffset,
+			sharder,
 		)
 
 		// Schedule rule manager that evaluates rules.
@@ -511,23 +753,43 @@ func runRule(
 	{
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
-			// Initialize rules.
-			if err := reloadRules(logger, ruleFiles, ruleMgr, evalInterval, metrics); err != nil {
-				level.Error(logger).Log("msg", "initialize rules failed", "err", err)
-				return err
+			// Initialize rules. A failed sync from the rule storage does not fail the startup, as the bucket can be
+			// unavailable for a while: the rule files of the last successful sync are loaded, and the sync is retried
+			// every --rule-storage.sync-interval.
+			if err := reloadRules(logger, ruleFiles, ruleStorage, ruleMgr, evalInterval, metrics); err != nil {
+				if _, ok := err.(ruleStorageSyncError); !ok {
+					level.Error(logger).Log("msg", "initialize rules failed", "err", err)
+					return err
+				}
+				level.Warn(logger).Log("msg", "initial sync of rule files from rule storage failed, retrying", "err", err)
+			}
+			// The rule files in the rule storage bucket are reloaded periodically, as they can be changed by other rulers.
+			var syncRules <-chan time.Time
+			if ruleStorage != nil {
+				t := time.NewTicker(ruleStorageSyncInterval)
+				defer t.Stop()
+				syncRules = t.C
 			}
 			for {
 				select {
 				case <-reloadSignal:
-					if err := reloadRules(logger, ruleFiles, ruleMgr, evalInterval, metrics); err != nil {
+					if err := reloadRules(logger, ruleFiles, ruleStorage, ruleMgr, evalInterval, metrics); err != nil {
 						level.Error(logger).Log("msg", "reload rules by sighup failed", "err", err)
 					}
 				case reloadMsg := <-reloadWebhandler:
-					err := reloadRules(logger, ruleFiles, ruleMgr, evalInterval, metrics)
+					err := reloadRules(logger, ruleFiles, ruleStorage, ruleMgr, evalInterval, metrics)
 					if err != nil {
 						level.Error(logger).Log("msg", "reload rules by webhandler failed", "err", err)
 					}
 					reloadMsg <- err
+				case <-reshard:
+					if err := reloadRules(logger, ruleFiles, ruleStorage, ruleMgr, evalInterval, metrics); err != nil {
+						level.Error(logger).Log("msg", "reload rules after rule shard peers change failed", "err", err)
+					}
+				case <-syncRules:
+					if err := reloadRules(logger, ruleFiles, ruleStorage, ruleMgr, evalInterval, metrics); err != nil {
+						level.Error(logger).Log("msg", "reload rules from rule storage failed", "err", err)
+					}
 				case <-ctx.Done():
 					return ctx.Err()
 				}
@@ -554,14 +816,17 @@ func runRule(
 			return errors.Wrap(err, "setup gRPC server")
 		}
 
-		// TODO: Add rules API implementation when ready.
-		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe,
-			grpcserver.WithServer(store.RegisterStoreServer(tsdbStore)),
+		opts := []grpcserver.Option{
 			grpcserver.WithServer(thanosrules.RegisterRulesServer(ruleMgr)),
 			grpcserver.WithListen(grpcBindAddr),
 			grpcserver.WithGracePeriod(grpcGracePeriod),
 			grpcserver.WithTLSConfig(tlsCfg),
-		)
+		}
+		// In stateless mode, the samples are queried from the remote write endpoints.
+		if len(remoteWriteConfigYAML) == 0 {
+			opts = append(opts, grpcserver.WithServer(store.RegisterStoreServer(tsdbStore)))
+		}
+		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe, opts...)
 
 		g.Add(func() error {
 			statusProber.Ready()
@@ -608,9 +873,20 @@ func runRule(
 		api := v1.NewRuleAPI(logger, reg, thanosrules.NewGRPCClient(ruleMgr), ruleMgr, flagsMap)
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
 
+		if ruleStorage != nil && len(ruleStorageAPITokens) > 0 {
+			reload := func() error {
+				reloadMsg := make(chan error)
+				reloadWebhandler <- reloadMsg
+				return <-reloadMsg
+			}
+			storageAPI := v1.NewRuleStorageAPI(logger, ruleStorage, reload, ruleStorageAPITokens)
+			storageAPI.Register(router.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
+		}
+
 		srv := httpserver.New(logger, reg, comp, httpProbe,
 			httpserver.WithListen(httpBindAddr),
 			httpserver.WithGracePeriod(httpGracePeriod),
+			httpserver.WithAuth(httpAuth),
 		)
 		srv.Handle("/", router)
 
@@ -646,7 +922,7 @@ func runRule(
 			}
 		}()
 
-		s := shipper.New(logger, reg, dataDir, bkt, func() labels.Labels { return lset }, metadata.RulerSource, false, allowOutOfOrderUpload)
+		s := shipper.New(logger, reg, dataDir, bkt, func() labels.Labels { return lset }, metadata.RulerSource, annotations, false, allowOutOfOrderUpload, uploadOpts)
 
 		ctx, cancel := context.WithCancel(context.Background())
 
@@ -670,6 +946,26 @@ func runRule(
 	return nil
 }
 
+// newRemoteWriteStorage returns the storage sending the samples appended to the given TSDB to the remote write
+// endpoints configured in the given YAML, with the labels of the ruler as external labels.
+func newRemoteWriteStorage(logger log.Logger, reg prometheus.Registerer, confYAML []byte, lset labels.Labels, db *tsdb.DB, dataDir string) (*remote.Storage, error) {
+	conf, err := config.Load(string(confYAML))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse remote write config")
+	}
+	if len(conf.RemoteWriteConfigs) == 0 {
+		return nil, errors.New("no remote write endpoint configured")
+	}
+	conf.GlobalConfig.ExternalLabels = labelsTSDBToProm(lset)
+
+	// The WAL of the TSDB is read from the data directory.
+	remoteStore := remote.NewStorage(log.With(logger, "component", "remote"), reg, db.StartTime, dataDir, time.Minute)
+	if err := remoteStore.ApplyConfig(conf); err != nil {
+		return nil, errors.Wrap(err, "apply remote write config")
+	}
+	return remoteStore, nil
+}
+
 func removeLockfileIfAny(logger log.Logger, dataDir string) error {
 	absdir, err := filepath.Abs(dataDir)
 	if err != nil {
@@ -735,6 +1031,7 @@ func queryFuncCreator(
 	duplicatedQuery prometheus.Counter,
 	ruleEvalWarnings *prometheus.CounterVec,
 	httpMethod string,
+	jitter time.Duration,
 ) func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc {
 
 	// queryFunc returns query function that hits the HTTP query API of query peers in randomized order until we get a result
@@ -758,6 +1055,13 @@ func queryFuncCreator(
 		}
 
 		return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+			if jitter > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(rand.Int63n(int64(jitter)))):
+				}
+			}
 			for _, i := range rand.Perm(len(queriers)) {
 				promClient := promClients[i]
 				endpoints := removeDuplicateQueryEndpoints(logger, duplicatedQuery, queriers[i].Endpoints())
@@ -805,14 +1109,22 @@ func addDiscoveryGroups(g *run.Group, c *http_util.Client, interval time.Duratio
 	})
 }
 
+// ruleStorageSyncError is returned by reloadRules when only the sync of the rule files from the rule storage failed,
+// in which case the rule files of the last successful sync are loaded.
+type ruleStorageSyncError struct {
+	error
+}
+
 func reloadRules(logger log.Logger,
 	ruleFiles []string,
+	ruleStorage *thanosrules.Storage,
 	ruleMgr *thanosrules.Manager,
 	evalInterval time.Duration,
 	metrics *RuleMetrics) error {
 	level.Debug(logger).Log("msg", "configured rule files", "files", strings.Join(ruleFiles, ","))
 	var (
 		errs      errutil.MultiError
+		syncErr   error
 		files     []string
 		seenFiles = make(map[string]struct{})
 	)
@@ -832,11 +1144,23 @@ func reloadRules(logger log.Logger,
 			seenFiles[fp] = struct{}{}
 		}
 	}
+	if ruleStorage != nil {
+		// On error, the rule files of the last successful sync are still loaded.
+		var fs []string
+		fs, syncErr = ruleStorage.Sync(context.Background())
+		if syncErr != nil {
+			syncErr = errors.Wrap(syncErr, "sync rule files from rule storage")
+		}
+		files = append(files, fs...)
+	}
 
 	level.Info(logger).Log("msg", "reload rule files", "numFiles", len(files))
 
 	if err := ruleMgr.Update(evalInterval, files); err != nil {
 		metrics.configSuccess.Set(0)
+		if syncErr != nil {
+			errs.Add(syncErr)
+		}
 		errs.Add(errors.Wrap(err, "reloading rules failed"))
 		return errs.Err()
 	}
@@ -848,5 +1172,11 @@ func reloadRules(logger log.Logger,
 	for _, group := range ruleMgr.RuleGroups() {
 		metrics.rulesLoaded.WithLabelValues(group.PartialResponseStrategy.String(), group.OriginalFile, group.Name()).Set(float64(len(group.Rules())))
 	}
+	if syncErr != nil {
+		if errs.Err() == nil {
+			return ruleStorageSyncError{syncErr}
+		}
+		errs.Add(syncErr)
+	}
 	return errs.Err()
 }
@@ -4,7 +4,22 @@
 package main
 
 import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
 
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
@@ -48,3 +63,70 @@ func Test_parseFlagLabels(t *testing.T) {
 		testutil.Equals(t, err != nil, td.expectErr)
 	}
 }
+
+func Test_newRemoteWriteStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rule-remote-write")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	db, err := tsdb.Open(dir, nil, nil, tsdb.DefaultOptions())
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, db.Close()) }()
+
+	lset := labels.FromStrings("replica", "a")
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := newRemoteWriteStorage(log.NewNopLogger(), prometheus.NewRegistry(), []byte("remote_write: [{}]"), lset, db, dir)
+		testutil.NotOk(t, err)
+	})
+
+	t.Run("no endpoint", func(t *testing.T) {
+		_, err := newRemoteWriteStorage(log.NewNopLogger(), prometheus.NewRegistry(), []byte("remote_write: []"), lset, db, dir)
+		testutil.NotOk(t, err)
+	})
+
+	t.Run("samples sent with external labels", func(t *testing.T) {
+		received := make(chan prompb.WriteRequest, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			compressed, err := ioutil.ReadAll(r.Body)
+			testutil.Ok(t, err)
+			reqBuf, err := snappy.Decode(nil, compressed)
+			testutil.Ok(t, err)
+
+			var req prompb.WriteRequest
+			testutil.Ok(t, proto.Unmarshal(reqBuf, &req))
+			select {
+			case received <- req:
+			default:
+			}
+		}))
+		defer srv.Close()
+
+		conf := "remote_write:\n- url: " + srv.URL + "\n  queue_config:\n    batch_send_deadline: 10ms\n"
+		remoteStore, err := newRemoteWriteStorage(log.NewNopLogger(), prometheus.NewRegistry(), []byte(conf), lset, db, dir)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, remoteStore.Close()) }()
+
+		// Wait for the WAL watcher to start reading the WAL of the TSDB.
+		time.Sleep(time.Second)
+
+		app := storage.NewFanout(log.NewNopLogger(), db, remoteStore).Appender(context.Background())
+		_, err = app.Add(labels.FromStrings("__name__", "job:up:sum", "job", "test"), time.Now().Unix()*1000, 1)
+		testutil.Ok(t, err)
+		testutil.Ok(t, app.Commit())
+
+		select {
+		case req := <-received:
+			testutil.Equals(t, 1, len(req.Timeseries))
+			testutil.Equals(t, []prompb.Label{
+				{Name: "__name__", Value: "job:up:sum"},
+				{Name: "job", Value: "test"},
+				{Name: "replica", Value: "a"},
+			}, req.Timeseries[0].Labels)
+			testutil.Equals(t, 1, len(req.Timeseries[0].Samples))
+			testutil.Equals(t, 1.0, req.Timeseries[0].Samples[0].Value)
+		case <-time.After(30 * time.Second):
+			t.Fatal("no samples received by the remote write endpoint")
+		}
+	})
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/extkingpin"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	thanoshttp "github.com/thanos-io/thanos/pkg/http"
+	meta "github.com/thanos-io/thanos/pkg/metadata"
 	thanosmodel "github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
@@ -38,6 +39,7 @@ import (
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
 	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/targets"
 	"github.com/thanos-io/thanos/pkg/tls"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
@@ -47,15 +49,19 @@ func registerSidecar(app *extkingpin.App) {
 	conf := &sidecarConfig{}
 	conf.registerFlag(cmd)
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		cfgFiles, err := conf.reloader.cfgFiles()
+		if err != nil {
+			return errors.Wrap(err, "reloader config files")
+		}
 		rl := reloader.New(log.With(logger, "component", "reloader"),
 			extprom.WrapRegistererWithPrefix("thanos_sidecar_", reg),
 			&reloader.Options{
 				ReloadURL:     reloader.ReloadURLFromBase(conf.prometheus.url),
-				CfgFile:       conf.reloader.confFile,
-				CfgOutputFile: conf.reloader.envVarConfFile,
+				CfgFiles:      cfgFiles,
 				WatchedDirs:   conf.reloader.ruleDirectories,
 				WatchInterval: conf.reloader.watchInterval,
 				RetryInterval: conf.reloader.retryInterval,
+				DelayInterval: conf.reloader.delayInterval,
 			})
 
 		return runSidecar(g, logger, reg, tracer, rl, component.Sidecar, *conf)
@@ -79,8 +85,9 @@ func runSidecar(
 		mint: conf.limitMinTime.PrometheusTimestamp(),
 		maxt: math.MaxInt64,
 
-		limitMinTime: conf.limitMinTime,
-		client:       promclient.NewWithTracingClient(logger, "thanos-sidecar"),
+		limitMinTime:       conf.limitMinTime,
+		labelsMaxStaleness: conf.prometheus.labelsMaxStaleness,
+		client:             promclient.NewWithTracingClient(logger, "thanos-sidecar"),
 	}
 
 	confContentYaml, err := conf.objStore.Content()
@@ -142,7 +149,10 @@ func runSidecar(
 			// Blocking query of external labels before joining as a Source Peer into gossip.
 			// We retry infinitely until we reach and fetch labels from our Prometheus.
 			err := runutil.Retry(2*time.Second, ctx.Done(), func() error {
-				if err := m.UpdateLabels(ctx); err != nil {
+				iterCtx, iterCancel := context.WithTimeout(ctx, conf.prometheus.getConfigTimeout)
+				defer iterCancel()
+
+				if err := m.UpdateLabels(iterCtx); err != nil {
 					level.Warn(logger).Log(
 						"msg", "failed to fetch initial external labels. Is Prometheus running? Retrying",
 						"err", err,
@@ -170,13 +180,13 @@ func runSidecar(
 			}
 
 			// Periodically query the Prometheus config. We use this as a heartbeat as well as for updating
-			// the external labels we apply.
-			return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
-				iterCtx, iterCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			// the external labels we apply. If it fails, the last external labels are still applied.
+			return runutil.Repeat(conf.prometheus.getConfigInterval, ctx.Done(), func() error {
+				iterCtx, iterCancel := context.WithTimeout(context.Background(), conf.prometheus.getConfigTimeout)
 				defer iterCancel()
 
 				if err := m.UpdateLabels(iterCtx); err != nil {
-					level.Warn(logger).Log("msg", "heartbeat failed", "err", err)
+					level.Warn(logger).Log("msg", "heartbeat failed", "err", err, "stale_external_labels", m.LabelsStale())
 					promUp.Set(0)
 				} else {
 					promUp.Set(1)
@@ -204,7 +214,7 @@ func runSidecar(
 		t.MaxIdleConns = conf.connection.maxIdleConns
 		c := promclient.NewClient(&http.Client{Transport: tracing.HTTPTripperware(logger, t)}, logger, thanoshttp.ThanosUserAgent)
 
-		promStore, err := store.NewPrometheusStore(logger, reg, c, conf.prometheus.url, component.Sidecar, m.Labels, m.Timestamps)
+		promStore, err := store.NewPrometheusStore(logger, reg, c, conf.prometheus.url, component.Sidecar, m.Labels, m.Timestamps, m.LabelsStale)
 		if err != nil {
 			return errors.Wrap(err, "create Prometheus store")
 		}
@@ -218,6 +228,8 @@ func runSidecar(
 		s := grpcserver.New(logger, reg, tracer, comp, grpcProbe,
 			grpcserver.WithServer(store.RegisterStoreServer(promStore)),
 			grpcserver.WithServer(rules.RegisterRulesServer(rules.NewPrometheus(conf.prometheus.url, c, m.Labels))),
+			grpcserver.WithServer(targets.RegisterTargetsServer(targets.NewPrometheus(conf.prometheus.url, c, m.Labels))),
+			grpcserver.WithServer(meta.RegisterMetadataServer(meta.NewPrometheus(conf.prometheus.url, c))),
 			grpcserver.WithListen(conf.grpc.bindAddress),
 			grpcserver.WithGracePeriod(time.Duration(conf.grpc.gracePeriod)),
 			grpcserver.WithTLSConfig(tlsCfg),
@@ -250,6 +262,11 @@ func runSidecar(
 			level.Error(logger).Log("err", err)
 		}
 
+		annotations, err := shipperAnnotations(conf.shipper.annotations)
+		if err != nil {
+			return err
+		}
+
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
@@ -267,8 +284,8 @@ func runSidecar(
 				return errors.Wrapf(err, "aborting as no external labels found after waiting %s", promReadyTimeout)
 			}
 
-			s := shipper.New(logger, reg, conf.tsdb.path, bkt, m.Labels, metadata.SidecarSource,
-				conf.shipper.uploadCompacted, conf.shipper.allowOutOfOrderUpload)
+			s := shipper.New(logger, reg, conf.tsdb.path, bkt, m.Labels, metadata.SidecarSource, annotations,
+				conf.shipper.uploadCompacted, conf.shipper.allowOutOfOrderUpload, conf.shipper.upload.uploadOptions())
 
 			return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
 				if uploaded, err := s.Sync(ctx); err != nil {
@@ -332,12 +349,14 @@ func validatePrometheus(ctx context.Context, client *promclient.Client, logger l
 type promMetadata struct {
 	promURL *url.URL
 
-	mtx    sync.Mutex
-	mint   int64
-	maxt   int64
-	labels labels.Labels
+	mtx           sync.Mutex
+	mint          int64
+	maxt          int64
+	labels        labels.Labels
+	labelsUpdated time.Time
 
-	limitMinTime thanosmodel.TimeOrDurationValue
+	limitMinTime       thanosmodel.TimeOrDurationValue
+	labelsMaxStaleness time.Duration
 
 	client *promclient.Client
 }
@@ -352,6 +371,7 @@ func (s *promMetadata) UpdateLabels(ctx context.Context) error {
 	defer s.mtx.Unlock()
 
 	s.labels = elset
+	s.labelsUpdated = time.Now()
 	return nil
 }
 
@@ -374,6 +394,15 @@ func (s *promMetadata) Labels() labels.Labels {
 	return s.labels
 }
 
+// LabelsStale returns true if the external labels could not be updated from Prometheus for longer than
+// the maximum staleness.
+func (s *promMetadata) LabelsStale() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.labelsMaxStaleness > 0 && !s.labelsUpdated.IsZero() && time.Since(s.labelsUpdated) > s.labelsMaxStaleness
+}
+
 func (s *promMetadata) Timestamps() (mint int64, maxt int64) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
@@ -6,8 +6,13 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/oklog/run"
@@ -27,6 +32,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/logging"
 	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/runutil"
@@ -64,14 +70,28 @@ func registerStore(app *extkingpin.App) {
 	chunkPoolSize := cmd.Flag("chunk-pool-size", "Maximum size of concurrently allocatable bytes reserved strictly to reuse for chunks in memory.").
 		Default("2GB").Bytes()
 
+	seriesPoolSize := cmd.Flag("series-pool-size", "Maximum size of concurrently allocatable bytes reserved strictly to reuse for series of the index in memory. 0 means no limit.").
+		Default("0").Bytes()
+
+	poolsMemoryRatio := cmd.Flag("store.pools-memory-ratio", "Ratio of the available memory, excluding the in-memory index cache, reserved for the chunk and series pools. If greater than 0, the pools are sized at startup from the memory limit of the cgroup or the total memory of the host, 80% for chunks and 20% for series, and --chunk-pool-size and --series-pool-size are ignored. The pools are not resized if the memory limit changes afterwards.").
+		Default("0").Float64()
+
 	maxSampleCount := cmd.Flag("store.grpc.series-sample-limit",
 		"Maximum amount of samples returned via a single Series call. The Series call fails if this limit is exceeded. 0 means no limit. NOTE: For efficiency the limit is internally implemented as 'chunks limit' considering each chunk contains 120 samples (it's the max number of samples each chunk can contain), so the actual number of samples might be lower, even though the maximum could be hit.").
 		Default("0").Uint()
 
+	maxChunksBytes := cmd.Flag("store.grpc.series-max-chunks-bytes",
+		"Maximum size of chunks fetched from the object storage for a single Series call. The Series call fails if this limit is exceeded. 0 means no limit.").
+		Default("0B").Bytes()
+
 	maxConcurrent := cmd.Flag("store.grpc.series-max-concurrency", "Maximum number of concurrent Series calls.").Default("20").Int()
 
 	objStoreConfig := extkingpin.RegisterCommonObjStoreFlags(cmd, "", true)
 
+	objStoreFaultsConfig := extflag.RegisterPathOrContent(extflag.HiddenCmdClause(cmd), "debug.objstore-faults.config",
+		"YAML that contains the faults injected into the operations on the object storage, to test the retries and timeouts of Store Gateway. For testing only.",
+		false)
+
 	syncInterval := cmd.Flag("sync-block-duration", "Repeat interval for syncing the blocks between local and remote view.").
 		Default("3m").Duration()
 
@@ -113,6 +133,35 @@ func registerStore(app *extkingpin.App) {
 	lazyIndexReaderIdleTimeout := cmd.Flag("store.index-header-lazy-reader-idle-timeout", "If index-header lazy reader is enabled and this idle timeout setting is > 0, memory map-ed index-headers will be automatically released after 'idle timeout' inactivity.").
 		Hidden().Default("5m").Duration()
 
+	lazyIndexReaderMaxLoaded := cmd.Flag("store.index-header-lazy-reader-max-loaded", "If index-header lazy reader is enabled and this limit is > 0, the least recently used memory map-ed index-headers will be released once more of them are loaded, limiting the number of open files.").
+		Default("0").Int()
+
+	lazyIndexReaderMaxLoadedBytes := cmd.Flag("store.index-header-lazy-reader-max-loaded-bytes", "If index-header lazy reader is enabled and this limit is > 0, the least recently used memory map-ed index-headers will be released once their total size exceeds it.").
+		Default("0B").Bytes()
+
+	indexHeaderStateCacheEnabled := cmd.Flag("store.enable-index-header-state-cache", "If true, Store Gateway will persist the postings offsets and symbols parsed from the index-header next to it in the data dir, so they do not have to be parsed again after a restart or lazy reload. "+
+		"The persisted state is validated against the block and index-header and rebuilt if it does not match.").
+		Default("false").Bool()
+
+	enableChunkDedup := cmd.Flag("store.enable-chunk-dedup", "If true, Store Gateway will merge overlapping chunks of a series, e.g. from overlapping blocks not compacted yet, into chunks containing a single copy of the samples. "+
+		"It reduces the size of responses with duplicated data at the cost of re-encoding the overlapping chunks. Downsampled chunks are not deduplicated.").
+		Default("false").Bool()
+
+	seriesGetRangeConcurrency := cmd.Flag("store.series-get-range-concurrency", "Maximum number of concurrent GetRange calls against object storage to fetch postings, series and chunks for a single Series request, across all the queried blocks. 0 means unlimited. "+
+		"Lower values avoid bursts of requests against high latency object storages.").
+		Default("0").Int()
+
+	getRangeMaxGapSize := cmd.Flag("store.get-range-max-gap-size", "Maximum gap between ranges of postings, series or chunks of a block, which are fetched together by a single GetRange call. "+
+		"Larger values batch more ranges into fewer, larger requests, at the cost of fetching more unneeded bytes.").
+		Default("512KiB").Bytes()
+
+	enableLazyExpandedPostings := cmd.Flag("store.enable-lazy-expanded-postings", "If true, Store Gateway will not fetch postings of matchers which are too large compared to the postings of the most selective matcher, and will match the labels of the fetched series against them instead.").
+		Default("false").Bool()
+
+	postingsBatchSize := cmd.Flag("store.postings-batch-size", "Number of expanded postings of a block, whose series are fetched and decoded together in a single Series request. "+
+		"Smaller batches bound the memory used by the fetched series and the size of the GetRange calls, at the cost of more calls. 0 means all postings are fetched at once.").
+		Default("0").Int()
+
 	webExternalPrefix := cmd.Flag("web.external-prefix", "Static prefix for all HTML links and redirect URLs in the bucket web UI interface. Actual endpoints are still served on / or the web.route-prefix. This allows thanos bucket web UI to be served behind a reverse proxy that strips a URL sub-path.").Default("").String()
 	webPrefixHeaderName := cmd.Flag("web.prefix-header", "Name of HTTP request header used for dynamic prefixing of UI links and redirects. This option is ignored if web.external-prefix argument is set. Security risk: enable this option only if a reverse proxy in front of thanos is resetting the header. The --web.prefix-header=X-Forwarded-Prefix option can be useful, for example, if Thanos UI is served via Traefik reverse proxy with PathPrefixStrip option enabled, which sends the stripped prefix value in X-Forwarded-Prefix header. This allows thanos UI to be served on a sub-path.").Default("").String()
 
@@ -128,6 +177,7 @@ func registerStore(app *extkingpin.App) {
 			tracer,
 			indexCacheConfig,
 			objStoreConfig,
+			objStoreFaultsConfig,
 			*dataDir,
 			*grpcBindAddr,
 			time.Duration(*grpcGracePeriod),
@@ -138,7 +188,10 @@ func registerStore(app *extkingpin.App) {
 			time.Duration(*httpGracePeriod),
 			uint64(*indexCacheSize),
 			uint64(*chunkPoolSize),
+			uint64(*seriesPoolSize),
+			*poolsMemoryRatio,
 			uint64(*maxSampleCount),
+			uint64(*maxChunksBytes),
 			*maxConcurrent,
 			component.Store,
 			debugLogging,
@@ -160,6 +213,14 @@ func registerStore(app *extkingpin.App) {
 			getFlagsMap(cmd.Flags()),
 			*lazyIndexReaderEnabled,
 			*lazyIndexReaderIdleTimeout,
+			*lazyIndexReaderMaxLoaded,
+			int64(*lazyIndexReaderMaxLoadedBytes),
+			*indexHeaderStateCacheEnabled,
+			*enableChunkDedup,
+			*seriesGetRangeConcurrency,
+			uint64(*getRangeMaxGapSize),
+			*enableLazyExpandedPostings,
+			*postingsBatchSize,
 		)
 	})
 }
@@ -172,12 +233,15 @@ func runStore(
 	tracer opentracing.Tracer,
 	indexCacheConfig *extflag.PathOrContent,
 	objStoreConfig *extflag.PathOrContent,
+	objStoreFaultsConfig *extflag.PathOrContent,
 	dataDir string,
 	grpcBindAddr string,
 	grpcGracePeriod time.Duration,
 	grpcCert, grpcKey, grpcClientCA, httpBindAddr string,
 	httpGracePeriod time.Duration,
-	indexCacheSizeBytes, chunkPoolSizeBytes, maxSampleCount uint64,
+	indexCacheSizeBytes, chunkPoolSizeBytes, seriesPoolSizeBytes uint64,
+	poolsMemoryRatio float64,
+	maxSampleCount, maxChunksBytes uint64,
 	maxConcurrency int,
 	component component.Component,
 	verbose bool,
@@ -194,6 +258,14 @@ func runStore(
 	flagsMap map[string]string,
 	lazyIndexReaderEnabled bool,
 	lazyIndexReaderIdleTimeout time.Duration,
+	lazyIndexReaderMaxLoaded int,
+	lazyIndexReaderMaxLoadedBytes int64,
+	indexHeaderStateCacheEnabled bool,
+	enableChunkDedup bool,
+	seriesGetRangeConcurrency int,
+	getRangeMaxGapSize uint64,
+	enableLazyExpandedPostings bool,
+	postingsBatchSize int,
 ) error {
 	grpcProbe := prober.NewGRPC()
 	httpProbe := prober.NewHTTP()
@@ -224,7 +296,16 @@ func runStore(
 		return err
 	}
 
-	bkt, err := client.NewBucket(logger, confContentYaml, reg, component.String())
+	faultsConfigYaml, err := objStoreFaultsConfig.Content()
+	if err != nil {
+		return errors.Wrap(err, "get object storage faults configuration")
+	}
+	faults, err := objstore.ParseFaultConfig(faultsConfigYaml)
+	if err != nil {
+		return err
+	}
+
+	bkt, err := client.NewBucketWithFaults(logger, confContentYaml, reg, component.String(), faults)
 	if err != nil {
 		return errors.Wrap(err, "create bucket client")
 	}
@@ -297,6 +378,24 @@ func runStore(
 
 	queriesGate := gate.New(extprom.WrapRegistererWithPrefix("thanos_bucket_store_series_", reg), maxConcurrency)
 
+	if poolsMemoryRatio < 0 || poolsMemoryRatio >= 1 {
+		return errors.Errorf("pools memory ratio must be in [0, 1) (got %v)", poolsMemoryRatio)
+	}
+	if poolsMemoryRatio > 0 {
+		mem, err := availableMemory(cgroupV2MemoryMax, cgroupV1MemoryLimit, procMeminfo)
+		if err != nil {
+			return errors.Wrap(err, "get available memory")
+		}
+		if len(indexCacheContentYaml) == 0 {
+			if indexCacheSizeBytes >= mem {
+				return errors.Errorf("index cache size %v exceeds the available memory %v", indexCacheSizeBytes, mem)
+			}
+			mem -= indexCacheSizeBytes
+		}
+		chunkPoolSizeBytes, seriesPoolSizeBytes = poolSizes(mem, poolsMemoryRatio)
+	}
+	level.Info(logger).Log("msg", "sized store pools", "chunkPoolBytes", chunkPoolSizeBytes, "seriesPoolBytes", seriesPoolSizeBytes, "memoryRatio", poolsMemoryRatio)
+
 	bs, err := store.NewBucketStore(
 		logger,
 		reg,
@@ -306,7 +405,9 @@ func runStore(
 		indexCache,
 		queriesGate,
 		chunkPoolSizeBytes,
+		seriesPoolSizeBytes,
 		store.NewChunksLimiterFactory(maxSampleCount/store.MaxSamplesPerChunk), // The samples limit is an approximation based on the max number of samples per chunk.
+		store.NewBytesLimiterFactory(units.Base2Bytes(maxChunksBytes)),
 		verbose,
 		blockSyncConcurrency,
 		filterConf,
@@ -316,6 +417,14 @@ func runStore(
 		false,
 		lazyIndexReaderEnabled,
 		lazyIndexReaderIdleTimeout,
+		lazyIndexReaderMaxLoaded,
+		lazyIndexReaderMaxLoadedBytes,
+		indexHeaderStateCacheEnabled,
+		enableChunkDedup,
+		seriesGetRangeConcurrency,
+		getRangeMaxGapSize,
+		enableLazyExpandedPostings,
+		postingsBatchSize,
 	)
 	if err != nil {
 		return errors.Wrap(err, "create object storage store")
@@ -386,7 +495,7 @@ func runStore(
 			return logging.NoLogCall
 		})}
 		logMiddleware := logging.NewHTTPServerMiddleware(logger, opts...)
-		api := blocksAPI.NewBlocksAPI(logger, "", flagsMap)
+		api := blocksAPI.NewBlocksAPI(logger, "", flagsMap, nil)
 		api.Register(r.WithPrefix("/api/v1"), tracer, logger, ins, logMiddleware)
 
 		metaFetcher.UpdateOnChange(func(blocks []metadata.Meta, err error) {
@@ -399,3 +508,73 @@ func runStore(
 	level.Info(logger).Log("msg", "starting store node")
 	return nil
 }
+
+const (
+	cgroupV2MemoryMax   = "/sys/fs/cgroup/memory.max"
+	cgroupV1MemoryLimit = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
+	procMeminfo         = "/proc/meminfo"
+)
+
+// availableMemory returns the memory available to the process, the lowest of the memory limit of its cgroup, v2 or
+// v1, and the total memory of the host. Missing files are ignored.
+func availableMemory(cgroupV2Path, cgroupV1Path, meminfoPath string) (uint64, error) {
+	var mem uint64
+	limit := func(v uint64) {
+		if v > 0 && (mem == 0 || v < mem) {
+			mem = v
+		}
+	}
+
+	for _, p := range []string{cgroupV2Path, cgroupV1Path} {
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, errors.Wrapf(err, "read %s", p)
+		}
+		v := strings.TrimSpace(string(b))
+		if v == "max" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "parse memory limit of %s", p)
+		}
+		// Cgroups v1 report the unlimited memory as the max int64 rounded down to the page size.
+		if n >= 1<<62 {
+			continue
+		}
+		limit(n)
+	}
+
+	b, err := ioutil.ReadFile(meminfoPath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, errors.Wrapf(err, "read %s", meminfoPath)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 || f[0] != "MemTotal:" {
+			continue
+		}
+		n, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "parse total memory of %s", meminfoPath)
+		}
+		limit(n * 1024)
+		break
+	}
+
+	if mem == 0 {
+		return 0, errors.New("no memory limit or total memory found")
+	}
+	return mem, nil
+}
+
+// poolSizes returns the sizes of the chunk and series pools for the given ratio of the available memory. Chunks take
+// most of the memory used by series calls, so the chunk pool gets 80% of it.
+func poolSizes(mem uint64, ratio float64) (chunkPoolBytes, seriesPoolBytes uint64) {
+	total := uint64(float64(mem) * ratio)
+	chunkPoolBytes = total / 5 * 4
+	return chunkPoolBytes, total - chunkPoolBytes
+}
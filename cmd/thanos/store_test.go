@@ -0,0 +1,61 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestAvailableMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "available-memory")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		testutil.Ok(t, ioutil.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+	missing := filepath.Join(dir, "missing")
+	meminfo := write("meminfo", "MemTotal:       16384000 kB\nMemFree:         1024000 kB\n")
+
+	for _, tcase := range []struct {
+		name               string
+		cgroupV2, cgroupV1 string
+		meminfo            string
+		expected           uint64
+		expectErr          bool
+	}{
+		{name: "host", cgroupV2: missing, cgroupV1: missing, meminfo: meminfo, expected: 16384000 * 1024},
+		{name: "cgroup v2", cgroupV2: write("v2", "4294967296\n"), cgroupV1: missing, meminfo: meminfo, expected: 4 << 30},
+		{name: "cgroup v2 unlimited", cgroupV2: write("v2-max", "max\n"), cgroupV1: missing, meminfo: meminfo, expected: 16384000 * 1024},
+		{name: "cgroup v1", cgroupV2: missing, cgroupV1: write("v1", "2147483648\n"), meminfo: meminfo, expected: 2 << 30},
+		{name: "cgroup v1 unlimited", cgroupV2: missing, cgroupV1: write("v1-max", "9223372036854771712\n"), meminfo: meminfo, expected: 16384000 * 1024},
+		{name: "cgroup above host", cgroupV2: write("v2-large", "68719476736\n"), cgroupV1: missing, meminfo: meminfo, expected: 16384000 * 1024},
+		{name: "cgroup without meminfo", cgroupV2: write("v2-only", "1073741824"), cgroupV1: missing, meminfo: missing, expected: 1 << 30},
+		{name: "invalid limit", cgroupV2: write("v2-invalid", "lots"), cgroupV1: missing, meminfo: meminfo, expectErr: true},
+		{name: "nothing", cgroupV2: missing, cgroupV1: missing, meminfo: missing, expectErr: true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			mem, err := availableMemory(tcase.cgroupV2, tcase.cgroupV1, tcase.meminfo)
+			if tcase.expectErr {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, mem)
+		})
+	}
+}
+
+func TestPoolSizes(t *testing.T) {
+	chunks, series := poolSizes(10<<30, 0.5)
+	testutil.Equals(t, uint64(4<<30), chunks)
+	testutil.Equals(t, uint64(1<<30), series)
+}
@@ -5,15 +5,22 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/oklog/run"
@@ -23,9 +30,16 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/tsdb"
 	v1 "github.com/thanos-io/thanos/pkg/api/blocks"
+	"github.com/thanos-io/thanos/pkg/backfill"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
@@ -49,7 +63,10 @@ import (
 	"golang.org/x/text/message"
 )
 
-const extpromPrefix = "thanos_bucket_"
+const (
+	extpromPrefix = "thanos_bucket_"
+	importMinTime = "0000-01-01T00:00:00Z"
+)
 
 var (
 	issuesVerifiersRegistry = verifier.Registry{
@@ -59,7 +76,8 @@ var (
 			verifier.DuplicatedCompactionBlocks{},
 		},
 	}
-	inspectColumns = []string{"ULID", "FROM", "UNTIL", "RANGE", "UNTIL-DOWN", "#SERIES", "#SAMPLES", "#CHUNKS", "COMP-LEVEL", "COMP-FAILED", "LABELS", "RESOLUTION", "SOURCE"}
+	inspectColumns = []string{"ULID", "FROM", "UNTIL", "RANGE", "UNTIL-DOWN", "#SERIES", "#SAMPLES", "#CHUNKS", "SIZE", "COMP-LEVEL", "COMP-FAILED", "LABELS", "RESOLUTION", "SOURCE", "ANNOTATIONS"}
+	planColumns    = []string{"STEP", "GROUP", "ACTION", "INPUT", "FROM", "UNTIL", "COMP-LEVEL", "RESOLUTION", "#SAMPLES", "EST-SIZE", "OVERLAPPING"}
 )
 
 func registerBucket(app extkingpin.AppClause) {
@@ -74,6 +92,9 @@ func registerBucket(app extkingpin.AppClause) {
 	registerBucketDownsample(cmd, objStoreConfig)
 	registerBucketCleanup(cmd, objStoreConfig)
 	registerBucketMarkBlock(cmd, objStoreConfig)
+	registerBucketRewrite(cmd, objStoreConfig)
+	registerBucketImport(cmd, objStoreConfig)
+	registerBucketPlan(cmd, objStoreConfig)
 }
 
 func registerBucketVerify(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
@@ -93,7 +114,19 @@ func registerBucketVerify(app extkingpin.AppClause, objStoreConfig *extflag.Path
 		"Note that deleting blocks immediately can cause query failures, if store gateway still has the block loaded, "+
 		"or compactor is ignoring the deletion because it's compacting the block at the same time.").
 		Default("0s"))
+	deep := cmd.Flag("deep", "Instead of verifying the issues, download the blocks and verify their meta.json against their files, "+
+		"the TOC and the postings of their index and the checksums of all their chunks. A JSON report of the corrupted blocks, and of the blocks which could not be "+
+		"verified, is written and the command fails if any is found. Repair is not supported.").
+		Default("false").Bool()
+	deepConcurrency := cmd.Flag("deep.concurrency", "Number of blocks verified concurrently in deep mode.").
+		Default("1").Int()
+	deepReportFile := cmd.Flag("deep.report-file", "Path of the JSON report of the corrupted blocks written in deep mode. If empty, the report is printed to the standard output.").
+		Default("").String()
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		if *deep && *repair {
+			return errors.New("repair is not supported in deep mode")
+		}
+
 		confContentYaml, err := objStoreConfig.Content()
 		if err != nil {
 			return err
@@ -158,6 +191,19 @@ func registerBucketVerify(app extkingpin.AppClause, objStoreConfig *extflag.Path
 		}
 
 		v := verifier.NewManager(reg, logger, bkt, backupBkt, fetcher, time.Duration(*deleteDelay), r)
+		if *deep {
+			report, err := v.VerifyDeep(context.Background(), idMatcher, *deepConcurrency)
+			if err != nil {
+				return err
+			}
+			if err := writeDeepReport(*deepReportFile, report); err != nil {
+				return errors.Wrap(err, "write report")
+			}
+			if len(report.CorruptedBlocks) > 0 || len(report.FailedBlocks) > 0 {
+				return errors.Errorf("found %d corrupted blocks out of %d, %d blocks could not be verified", len(report.CorruptedBlocks), report.VerifiedBlocks, len(report.FailedBlocks))
+			}
+			return nil
+		}
 		if *repair {
 			return v.VerifyAndRepair(context.Background(), idMatcher)
 		}
@@ -166,6 +212,20 @@ func registerBucketVerify(app extkingpin.AppClause, objStoreConfig *extflag.Path
 	})
 }
 
+// writeDeepReport writes the given report as JSON to the given file, or to the standard output if it is empty.
+func writeDeepReport(file string, report *verifier.DeepReport) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if file == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0666)
+}
+
 func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
 	cmd := app.Command("ls", "List all blocks in the bucket")
 	output := cmd.Flag("output", "Optional format in which to print each block's information. Options are 'json', 'wide' or a custom template.").
@@ -257,16 +317,19 @@ func registerBucketLs(app extkingpin.AppClause, objStoreConfig *extflag.PathOrCo
 
 func registerBucketInspect(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
 	cmd := app.Command("inspect", "Inspect all blocks in the bucket in detailed, table-like way")
-	selector := cmd.Flag("selector", "Selects blocks based on label, e.g. '-l key1=\\\"value1\\\" -l key2=\\\"value2\\\"'. All key value pairs must match.").Short('l').
+	selector := cmd.Flag("selector", "Selects blocks based on label, e.g. '-l key1=\\\"value1\\\" -l key2=~\\\"value2.*\\\"'. All matchers must match. The =, !=, =~ and !~ operators are supported.").Short('l').
 		PlaceHolder("<name>=\\\"<value>\\\"").Strings()
 	sortBy := cmd.Flag("sort-by", "Sort by columns. It's also possible to sort by multiple columns, e.g. '--sort-by FROM --sort-by UNTIL'. I.e., if the 'FROM' value is equal the rows are then further sorted by the 'UNTIL' value.").
 		Default("FROM", "UNTIL").Enums(inspectColumns...)
+	columns := cmd.Flag("columns", "Columns to print, in order (repeated flag).").Default(inspectColumns...).Enums(inspectColumns...)
+	output := cmd.Flag("output", "Output format. The json and csv formats are machine-readable: sizes are in bytes and times in RFC3339 format.").
+		Default("table").Enum("table", "json", "csv")
 	timeout := cmd.Flag("timeout", "Timeout to download metadata from remote storage").Default("5m").Duration()
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 
 		// Parse selector.
-		selectorLabels, err := parseFlagLabels(*selector)
+		matchers, err := replicate.ParseFlagMatchers(*selector)
 		if err != nil {
 			return errors.Wrap(err, "error parsing selector flag")
 		}
@@ -305,7 +368,7 @@ func registerBucketInspect(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 			blockMetas = append(blockMetas, meta)
 		}
 
-		return printTable(blockMetas, selectorLabels, *sortBy)
+		return printBlocks(os.Stdout, blockMetas, matchers, *columns, *sortBy, *output)
 	})
 }
 
@@ -318,6 +381,8 @@ func registerBucketWeb(app extkingpin.AppClause, objStoreConfig *extflag.PathOrC
 	interval := cmd.Flag("refresh", "Refresh interval to download metadata from remote storage").Default("30m").Duration()
 	timeout := cmd.Flag("timeout", "Timeout to download metadata from remote storage").Default("5m").Duration()
 	label := cmd.Flag("label", "Prometheus label to use as timeline title").String()
+	enableAdminOperations := cmd.Flag("enable-admin-operations", "Enable UI/API admin operations like marking blocks for deletion and no compaction. "+
+		"The web interface has no authentication, only enable them if it is not reachable by untrusted users.").Default("false").Bool()
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
 		comp := component.Bucket
@@ -338,9 +403,23 @@ func registerBucketWeb(app extkingpin.AppClause, objStoreConfig *extflag.PathOrC
 		bucketUI := ui.NewBucketUI(logger, *label, *webExternalPrefix, *webPrefixHeaderName, "", component.Bucket)
 		bucketUI.Register(router, true, ins)
 
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Bucket.String())
+		if err != nil {
+			return errors.Wrap(err, "bucket client")
+		}
+
 		flagsMap := getFlagsMap(cmd.Flags())
 
-		api := v1.NewBlocksAPI(logger, *label, flagsMap)
+		var adminBkt objstore.Bucket
+		if *enableAdminOperations {
+			adminBkt = bkt
+		}
+		api := v1.NewBlocksAPI(logger, *label, flagsMap, adminBkt)
 
 		// Configure Request Logging for HTTP calls.
 		opts := []logging.Option{logging.WithDecider(func() logging.Decision {
@@ -364,16 +443,6 @@ func registerBucketWeb(app extkingpin.AppClause, objStoreConfig *extflag.PathOrC
 			level.Warn(logger).Log("msg", "Refresh interval should be at least 2 times the timeout")
 		}
 
-		confContentYaml, err := objStoreConfig.Content()
-		if err != nil {
-			return err
-		}
-
-		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Bucket.String())
-		if err != nil {
-			return errors.Wrap(err, "bucket client")
-		}
-
 		// TODO(bwplotka): Allow Bucket UI to visualize the state of block as well.
 		fetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), nil, nil)
 		if err != nil {
@@ -433,8 +502,9 @@ func registerBucketReplicate(app extkingpin.AppClause, objStoreConfig *extflag.P
 	toObjStoreConfig := extkingpin.RegisterCommonObjStoreFlags(cmd, "-to", false, "The object storage which replicate data to.")
 	resolutions := cmd.Flag("resolution", "Only blocks with these resolutions will be replicated. Repeated flag.").Default("0s", "5m", "1h").HintAction(listResLevel).DurationList()
 	compactions := cmd.Flag("compaction", "Only blocks with these compaction levels will be replicated. Repeated flag.").Default("1", "2", "3", "4").Ints()
-	matcherStrs := cmd.Flag("matcher", "Only blocks whose external labels exactly match this matcher will be replicated.").PlaceHolder("key=\"value\"").Strings()
+	matcherStrs := cmd.Flag("matcher", "Only blocks whose external labels match this matcher will be replicated. The =, !=, =~ and !~ operators are supported. Repeated flag.").PlaceHolder("key=\"value\"").Strings()
 	singleRun := cmd.Flag("single-run", "Run replication only one time, then exit.").Default("false").Bool()
+	interval := cmd.Flag("interval", "Interval between the replication runs, unless single-run is set.").Default("1m").Duration()
 	minTime := model.TimeOrDuration(cmd.Flag("min-time", "Start of time range limit to replicate. Thanos Replicate will replicate only metrics, which happened later than this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
 		Default("0000-01-01T00:00:00Z"))
 	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "End of time range limit to replicate. Thanos Replicate will replicate only metrics, which happened earlier than this value. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
@@ -464,6 +534,7 @@ func registerBucketReplicate(app extkingpin.AppClause, objStoreConfig *extflag.P
 			objStoreConfig,
 			toObjStoreConfig,
 			*singleRun,
+			*interval,
 			minTime,
 			maxTime,
 		)
@@ -475,15 +546,44 @@ func registerBucketDownsample(app extkingpin.AppClause, objStoreConfig *extflag.
 	httpAddr, httpGracePeriod := extkingpin.RegisterHTTPFlags(cmd)
 	dataDir := cmd.Flag("data-dir", "Data directory in which to cache blocks and process downsamplings.").
 		Default("./data").String()
+	downsampleConcurrency := cmd.Flag("downsample.concurrency", "Number of goroutines to use when downsampling blocks.").
+		Default("1").Int()
+	blockIDs := cmd.Flag("id", "ID (ULID) of the blocks to downsample (repeated flag). The blocks downsampled from them are downsampled further up to the target resolution. All the blocks are downsampled if not set.").Strings()
+	minTime := model.TimeOrDuration(cmd.Flag("min-time", "Start of time range limit to downsample. Only the blocks overlapping the time range are downsampled. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("0000-01-01T00:00:00Z"))
+	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "End of time range limit to downsample. Only the blocks overlapping the time range are downsampled. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("9999-12-31T23:59:59Z"))
+	resolution := extkingpin.ModelDuration(cmd.Flag("resolution", "Target resolution up to which the blocks are downsampled, either 5m, 1h or the one of an additional level.").
+		Default("1h").HintAction(listResLevel))
+	flagLevels := downsamplingLevelsFlag(cmd).Strings()
 
 	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ <-chan struct{}, _ bool) error {
-		return RunDownsample(g, logger, reg, *httpAddr, time.Duration(*httpGracePeriod), *dataDir, objStoreConfig, component.Downsample)
+		levels, _, err := parseDownsamplingLevels(*flagLevels)
+		if err != nil {
+			return err
+		}
+		res := time.Duration(*resolution).Milliseconds()
+		if res == downsample.ResLevel0 || !levels.Contains(res) {
+			return errors.Errorf("invalid target resolution %s, must be either 5m, 1h or the one of an additional level", *resolution)
+		}
+
+		var ids []ulid.ULID
+		for _, id := range *blockIDs {
+			u, err := ulid.Parse(id)
+			if err != nil {
+				return errors.Errorf("id is not a valid block ULID, got: %v", id)
+			}
+			ids = append(ids, u)
+		}
+
+		return RunDownsample(g, logger, reg, *httpAddr, time.Duration(*httpGracePeriod), *dataDir, objStoreConfig, component.Downsample, *downsampleConcurrency,
+			levels, ids, minTime.PrometheusTimestamp(), maxTime.PrometheusTimestamp(), res)
 	})
 }
 
 func registerBucketCleanup(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
 	cmd := app.Command(component.Cleanup.String(), "Cleans up all blocks marked for deletion")
-	deleteDelay := cmd.Flag("delete-delay", "Time before a block marked for deletion is deleted from bucket.").Default("48h").Duration()
+	deleteDelay := cmd.Flag("delete-delay", "Time before a block marked for deletion is deleted from bucket. Leftovers of object uploads older than this, e.g. segments of overwritten Swift large objects, are deleted too.").Default("48h").Duration()
 	consistencyDelay := cmd.Flag("consistency-delay", fmt.Sprintf("Minimum age of fresh (non-compacted) blocks before they are being processed. Malformed blocks older than the maximum of consistency-delay and %v will be removed.", compact.PartialUploadThresholdAge)).
 		Default("30m").Duration()
 	blockSyncConcurrency := cmd.Flag("block-sync-concurrency", "Number of goroutines to use when syncing block metadata from object storage.").
@@ -564,76 +664,240 @@ func registerBucketCleanup(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 		if err := blocksCleaner.DeleteMarkedBlocks(ctx); err != nil {
 			return errors.Wrap(err, "error cleaning blocks")
 		}
+		if c, ok := bkt.(objstore.OrphanedObjectsCleaner); ok {
+			switch n, err := c.CleanOrphanedObjects(ctx, "", *deleteDelay); {
+			case objstore.IsNotSupportedErr(err):
+				// The bucket does not leave orphaned objects behind.
+			case err != nil:
+				return errors.Wrap(err, "clean orphaned objects")
+			default:
+				level.Info(logger).Log("msg", "cleaned orphaned objects", "objects", n)
+			}
+		}
 
 		level.Info(logger).Log("msg", "cleanup done")
 		return nil
 	})
 }
 
-func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortBy []string) error {
-	header := inspectColumns
+// inspectRow returns the values of the inspect columns of the given block. Unknown values are nil.
+func inspectRow(m *metadata.Meta) []interface{} {
+	var untilDown interface{}
+	if until, err := compact.UntilNextDownsampling(m, downsample.DefaultLevels); err == nil {
+		untilDown = until
+	}
+	var size interface{}
+	if len(m.Thanos.Files) > 0 {
+		var s int64
+		for _, f := range m.Thanos.Files {
+			s += f.SizeBytes
+		}
+		size = units.Base2Bytes(s)
+	}
 
-	var lines [][]string
-	p := message.NewPrinter(language.English)
+	return []interface{}{
+		m.ULID.String(),
+		time.Unix(m.MinTime/1000, 0),
+		time.Unix(m.MaxTime/1000, 0),
+		time.Duration((m.MaxTime - m.MinTime) * int64(time.Millisecond)),
+		untilDown,
+		m.Stats.NumSeries,
+		m.Stats.NumSamples,
+		m.Stats.NumChunks,
+		size,
+		m.Compaction.Level,
+		m.Compaction.Failed,
+		m.Thanos.Labels,
+		time.Duration(m.Thanos.Downsample.Resolution * int64(time.Millisecond)),
+		string(m.Thanos.Source),
+		m.Thanos.Annotations,
+	}
+}
 
+// printBlocks prints the given columns of the blocks matching all the given matchers in the given output format,
+// sorted by the given columns.
+func printBlocks(w io.Writer, blockMetas []*metadata.Meta, matchers []*labels.Matcher, columns, sortBy []string, output string) error {
+	var colNums, sortByColNums []int
+	for _, col := range columns {
+		index := getIndex(inspectColumns, col)
+		if index == -1 {
+			return errors.Errorf("column %s not found", col)
+		}
+		colNums = append(colNums, index)
+	}
+	for _, col := range sortBy {
+		index := getIndex(inspectColumns, col)
+		if index == -1 {
+			return errors.Errorf("column %s not found", col)
+		}
+		sortByColNums = append(sortByColNums, index)
+	}
+	// Blocks with the same values are sorted by ULID.
+	sortByColNums = append(sortByColNums, 0)
+
+	var rows [][]interface{}
 	for _, blockMeta := range blockMetas {
-		if !matchesSelector(blockMeta, selectorLabels) {
+		if !matchesSelector(blockMeta, matchers) {
 			continue
 		}
+		rows = append(rows, inspectRow(blockMeta))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		for _, index := range sortByColNums {
+			if c := compareInspectValues(rows[i][index], rows[j][index]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
 
-		timeRange := time.Duration((blockMeta.MaxTime - blockMeta.MinTime) * int64(time.Millisecond))
-
-		untilDown := "-"
-		if until, err := compact.UntilNextDownsampling(blockMeta); err == nil {
-			untilDown = until.String()
+	switch output {
+	case "json":
+		objs := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			obj := map[string]interface{}{}
+			for _, index := range colNums {
+				obj[inspectJSONKey(inspectColumns[index])] = inspectJSONValue(row[index])
+			}
+			objs = append(objs, obj)
 		}
-		var labels []string
-		for _, key := range getKeysAlphabetically(blockMeta.Thanos.Labels) {
-			labels = append(labels, fmt.Sprintf("%s=%s", key, blockMeta.Thanos.Labels[key]))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objs)
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return err
 		}
-
-		var line []string
-		line = append(line, blockMeta.ULID.String())
-		line = append(line, time.Unix(blockMeta.MinTime/1000, 0).Format("02-01-2006 15:04:05"))
-		line = append(line, time.Unix(blockMeta.MaxTime/1000, 0).Format("02-01-2006 15:04:05"))
-		line = append(line, timeRange.String())
-		line = append(line, untilDown)
-		line = append(line, p.Sprintf("%d", blockMeta.Stats.NumSeries))
-		line = append(line, p.Sprintf("%d", blockMeta.Stats.NumSamples))
-		line = append(line, p.Sprintf("%d", blockMeta.Stats.NumChunks))
-		line = append(line, p.Sprintf("%d", blockMeta.Compaction.Level))
-		line = append(line, p.Sprintf("%t", blockMeta.Compaction.Failed))
-		line = append(line, strings.Join(labels, ","))
-		line = append(line, time.Duration(blockMeta.Thanos.Downsample.Resolution*int64(time.Millisecond)).String())
-		line = append(line, string(blockMeta.Thanos.Source))
-		lines = append(lines, line)
+		for _, row := range rows {
+			line := make([]string, 0, len(colNums))
+			for _, index := range colNums {
+				line = append(line, formatInspectValue(row[index], false))
+			}
+			if err := cw.Write(line); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
 	}
 
-	var sortByColNum []int
-	for _, col := range sortBy {
-		index := getIndex(header, col)
-		if index == -1 {
-			return errors.Errorf("column %s not found", col)
+	var lines [][]string
+	for _, row := range rows {
+		line := make([]string, 0, len(colNums))
+		for _, index := range colNums {
+			line = append(line, formatInspectValue(row[index], true))
 		}
-		sortByColNum = append(sortByColNum, index)
+		lines = append(lines, line)
 	}
 
-	t := Table{Header: header, Lines: lines, SortIndices: sortByColNum}
-	sort.Sort(t)
-
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader(t.Header)
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(columns)
 	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
 	table.SetCenterSeparator("|")
 	table.SetAutoWrapText(false)
 	table.SetReflowDuringAutoWrap(false)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.AppendBulk(t.Lines)
+	table.AppendBulk(lines)
 	table.Render()
 
 	return nil
 }
 
+// formatInspectValue formats the given inspect value for the table output if human is true, for the CSV one otherwise.
+func formatInspectValue(v interface{}, human bool) string {
+	p := message.NewPrinter(language.English)
+
+	switch v := v.(type) {
+	case nil:
+		if human {
+			return "-"
+		}
+		return ""
+	case time.Time:
+		if human {
+			return v.Format("02-01-2006 15:04:05")
+		}
+		return v.UTC().Format(time.RFC3339)
+	case units.Base2Bytes:
+		if human {
+			return v.String()
+		}
+		return strconv.FormatInt(int64(v), 10)
+	case uint64, int:
+		if human {
+			return p.Sprintf("%d", v)
+		}
+		return fmt.Sprintf("%d", v)
+	case map[string]string:
+		var lbls []string
+		for _, key := range getKeysAlphabetically(v) {
+			lbls = append(lbls, fmt.Sprintf("%s=%s", key, v[key]))
+		}
+		return strings.Join(lbls, ",")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// inspectJSONKey returns the key of the given inspect column in the JSON output, e.g. comp_level for COMP-LEVEL.
+func inspectJSONKey(col string) string {
+	return strings.Replace(strings.TrimPrefix(strings.ToLower(col), "#"), "-", "_", -1)
+}
+
+// inspectJSONValue returns the given inspect value as encoded in the JSON output: sizes are in bytes and durations are
+// formatted like in the other outputs.
+func inspectJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case time.Duration:
+		return v.String()
+	case units.Base2Bytes:
+		return int64(v)
+	}
+	return v
+}
+
+// compareInspectValues returns -1, 0 or 1 if the inspect value a is lower than, equal to or greater than b. Unknown
+// values are lower than all the other ones.
+func compareInspectValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	var less, equal bool
+	switch a := a.(type) {
+	case time.Time:
+		less, equal = a.Before(b.(time.Time)), a.Equal(b.(time.Time))
+	case time.Duration:
+		less, equal = a < b.(time.Duration), a == b.(time.Duration)
+	case units.Base2Bytes:
+		less, equal = a < b.(units.Base2Bytes), a == b.(units.Base2Bytes)
+	case uint64:
+		less, equal = a < b.(uint64), a == b.(uint64)
+	case int:
+		less, equal = a < b.(int), a == b.(int)
+	case bool:
+		less, equal = !a && b.(bool), a == b.(bool)
+	default:
+		sa, sb := formatInspectValue(a, false), formatInspectValue(b, false)
+		less, equal = sa < sb, sa == sb
+	}
+	switch {
+	case equal:
+		return 0
+	case less:
+		return -1
+	}
+	return 1
+}
+
 func getKeysAlphabetically(labels map[string]string) []string {
 	var keys []string
 	for k := range labels {
@@ -643,11 +907,11 @@ func getKeysAlphabetically(labels map[string]string) []string {
 	return keys
 }
 
-// matchesSelector checks if blockMeta contains every label from
-// the selector with the correct value.
-func matchesSelector(blockMeta *metadata.Meta, selectorLabels labels.Labels) bool {
-	for _, l := range selectorLabels {
-		if v, ok := blockMeta.Thanos.Labels[l.Name]; !ok || v != l.Value {
+// matchesSelector checks if the external labels of blockMeta match all the
+// given matchers.
+func matchesSelector(blockMeta *metadata.Meta, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(blockMeta.Thanos.Labels[m.Name]) {
 			return false
 		}
 	}
@@ -664,46 +928,6 @@ func getIndex(strs []string, s string) int {
 	return -1
 }
 
-type Table struct {
-	Header      []string
-	Lines       [][]string
-	SortIndices []int
-}
-
-func (t Table) Len() int { return len(t.Lines) }
-
-func (t Table) Swap(i, j int) { t.Lines[i], t.Lines[j] = t.Lines[j], t.Lines[i] }
-
-func (t Table) Less(i, j int) bool {
-	for _, index := range t.SortIndices {
-		if t.Lines[i][index] == t.Lines[j][index] {
-			continue
-		}
-		return compare(t.Lines[i][index], t.Lines[j][index])
-	}
-	return compare(t.Lines[i][0], t.Lines[j][0])
-}
-
-func compare(s1, s2 string) bool {
-	// Values can be either Time, Duration, comma-delimited integers or strings.
-	s1Time, s1Err := time.Parse("02-01-2006 15:04:05", s1)
-	s2Time, s2Err := time.Parse("02-01-2006 15:04:05", s2)
-	if s1Err != nil || s2Err != nil {
-		s1Duration, s1Err := time.ParseDuration(s1)
-		s2Duration, s2Err := time.ParseDuration(s2)
-		if s1Err != nil || s2Err != nil {
-			s1Int, s1Err := strconv.ParseUint(strings.Replace(s1, ",", "", -1), 10, 64)
-			s2Int, s2Err := strconv.ParseUint(strings.Replace(s2, ",", "", -1), 10, 64)
-			if s1Err != nil || s2Err != nil {
-				return s1 < s2
-			}
-			return s1Int < s2Int
-		}
-		return s1Duration < s2Duration
-	}
-	return s1Time.Before(s2Time)
-}
-
 func registerBucketMarkBlock(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
 	cmd := app.Command(component.Mark.String(), "Mark block for deletion or no-compact in a safe way. NOTE: If the compactor is currently running compacting same block, this operation would be potentially a noop.")
 	blockIDs := cmd.Flag("id", "ID (ULID) of the blocks to be marked for deletion (repeated flag)").Required().Strings()
@@ -753,3 +977,483 @@ func registerBucketMarkBlock(app extkingpin.AppClause, objStoreConfig *extflag.P
 		return nil
 	})
 }
+
+func registerBucketRewrite(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
+	cmd := app.Command(component.Rewrite.String(), "Rewrite blocks, deleting and relabeling their series. The rewritten blocks are uploaded with new IDs and the original ones are marked for deletion. "+
+		"NOTE: If the compactor is currently running compacting same block, the original block might be compacted before being deleted.")
+	blockIDs := cmd.Flag("id", "ID (ULID) of the blocks to rewrite (repeated flag).").Required().Strings()
+	tmpDir := cmd.Flag("tmp.dir", "Working directory for temporary files.").Default(filepath.Join(os.TempDir(), "thanos-rewrite")).String()
+	deleteSeries := cmd.Flag("rewrite.delete-series", "Series selector of the series to delete, e.g. '{__name__=\"http_requests_total\",path=~\"/user/.+\"}' (repeated flag).").
+		PlaceHolder("<selector>").Strings()
+	relabelConf := extflag.RegisterPathOrContent(cmd, "rewrite.relabel-config", "YAML file that contains the relabeling configuration applied to the series of the blocks. It follows native Prometheus relabel-config syntax, and series dropped by the relabeling are deleted. See format details: https://prometheus.io/docs/prometheus/latest/configuration/configuration/#relabel_config ", false)
+	dryRun := cmd.Flag("dry-run", "Rewrite the blocks locally and log the changes, without uploading the rewritten blocks or marking the original ones for deletion.").
+		Default("false").Bool()
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		var deleteMatchers [][]*labels.Matcher
+		for _, s := range *deleteSeries {
+			ms, err := parser.ParseMetricSelector(s)
+			if err != nil {
+				return errors.Wrapf(err, "parse series selector %s", s)
+			}
+			deleteMatchers = append(deleteMatchers, ms)
+		}
+
+		relabelContentYaml, err := relabelConf.Content()
+		if err != nil {
+			return errors.Wrap(err, "get content of relabel configuration")
+		}
+		relabelConfig, err := compact.ParseRewriteRelabelConfig(relabelContentYaml)
+		if err != nil {
+			return err
+		}
+		if len(deleteMatchers) == 0 && len(relabelConfig) == 0 {
+			return errors.New("no series to delete or relabel configuration specified")
+		}
+
+		var ids []ulid.ULID
+		for _, id := range *blockIDs {
+			u, err := ulid.Parse(id)
+			if err != nil {
+				return errors.Errorf("id is not a valid block ULID, got: %v", id)
+			}
+			ids = append(ids, u)
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Rewrite.String())
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+			for _, id := range ids {
+				if err := rewriteBlock(ctx, logger, bkt, *tmpDir, id, deleteMatchers, relabelConfig, *dryRun); err != nil {
+					return errors.Wrapf(err, "rewrite block %s", id)
+				}
+			}
+			level.Info(logger).Log("msg", "rewrite done", "IDs", strings.Join(*blockIDs, ","))
+			return nil
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+}
+
+func rewriteBlock(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	tmpDir string,
+	id ulid.ULID,
+	deleteMatchers [][]*labels.Matcher,
+	relabelConfig []*relabel.Config,
+	dryRun bool,
+) error {
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "create working dir")
+	}
+	dir, err := ioutil.TempDir(tmpDir, id.String())
+	if err != nil {
+		return errors.Wrap(err, "create temporary dir")
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			level.Warn(logger).Log("msg", "failed to delete dir", "dir", dir, "err", err)
+		}
+	}()
+
+	m, err := block.DownloadMeta(ctx, logger, bkt, id)
+	if err != nil {
+		return err
+	}
+	if err := block.Download(ctx, logger, bkt, id, filepath.Join(dir, id.String())); err != nil {
+		return errors.Wrap(err, "download block")
+	}
+
+	resid, stats, err := compact.RewriteBlock(logger, dir, &m, deleteMatchers, relabelConfig)
+	if err != nil {
+		return err
+	}
+	logger = log.With(logger, "block", id, "deleted_series", stats.DeletedSeries, "relabeled_series", stats.RelabeledSeries, "merged_series", stats.MergedSeries)
+	if !stats.Modified() {
+		level.Info(logger).Log("msg", "no series to delete or relabel found in block; skipping")
+		return nil
+	}
+	if dryRun {
+		level.Info(logger).Log("msg", "dry run: block would be rewritten", "empty", resid == ulid.ULID{})
+		return nil
+	}
+
+	details := "all series deleted by rewrite"
+	if resid != (ulid.ULID{}) {
+		bdir := filepath.Join(dir, resid.String())
+		if err := block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
+			return errors.Wrapf(err, "invalid rewritten block %s", resid)
+		}
+		if err := block.Upload(ctx, logger, bkt, bdir); err != nil {
+			return errors.Wrapf(err, "upload rewritten block %s", resid)
+		}
+		details = fmt.Sprintf("rewritten as %s", resid)
+	}
+	// Spawn a new context so we always mark a block for deletion in full on shutdown.
+	delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := block.MarkForDeletion(delCtx, logger, bkt, id, details, promauto.With(nil).NewCounter(prometheus.CounterOpts{})); err != nil {
+		return errors.Wrap(err, "mark block for deletion")
+	}
+	level.Info(logger).Log("msg", "block rewritten", "result_block", resid)
+	return nil
+}
+
+func registerBucketImport(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
+	cmd := app.Command(component.Import.String(), "Import the samples of an OpenMetrics text dump or of a remote read endpoint as new blocks uploaded to the bucket, to backfill the historical data of other systems. "+
+		"NOTE: Imported blocks overlapping existing blocks with the same external labels can only be compacted with vertical compaction.")
+	openMetricsFile := cmd.Flag("openmetrics.file", "Path of the OpenMetrics text dump to import, or - to read it from the standard input. All its samples must have a timestamp. It is read once, the samples of each series have to be in time order, others are dropped.").
+		PlaceHolder("<path>").String()
+	remoteReadURL := cmd.Flag("remote-read.url", "URL of the remote read endpoint to import the samples from, e.g. http://prometheus:9090/api/v1/read.").
+		PlaceHolder("<url>").String()
+	remoteReadSelector := cmd.Flag("remote-read.selector", "Series selector of the series to import from the remote read endpoint.").
+		Default(`{__name__=~".+"}`).String()
+	remoteReadTimeout := extkingpin.ModelDuration(cmd.Flag("remote-read.timeout", "Timeout of each remote read query. The samples of each block are read with one query.").
+		Default("5m"))
+	labelStrs := cmd.Flag("label", "External labels of the imported blocks (repeated), identifying the system the data is imported from.").
+		PlaceHolder("key=\"value\"").Required().Strings()
+	blockDuration := extkingpin.ModelDuration(cmd.Flag("block-duration", "Duration of the imported blocks. The blocks are aligned to it.").Default("2h"))
+	minTime := model.TimeOrDuration(cmd.Flag("min-time", "Start of time range limit to import. Only the samples later than this value are imported. Has to be set to import from a remote read endpoint. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default(importMinTime))
+	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "End of time range limit to import. Only the samples earlier than this value are imported. Option can be a constant time in RFC3339 format or time duration relative to current time, such as -1d or 2h45m. Valid duration units are ms, s, m, h, d, w, y.").
+		Default("9999-12-31T23:59:59Z"))
+	tmpDir := cmd.Flag("tmp.dir", "Working directory for temporary files.").Default(filepath.Join(os.TempDir(), "thanos-import")).String()
+	dryRun := cmd.Flag("dry-run", "Create the blocks locally and log them, without uploading them.").Default("false").Bool()
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		extLset, err := parseFlagLabels(*labelStrs)
+		if err != nil {
+			return errors.Wrap(err, "parse labels")
+		}
+		sort.Sort(extLset)
+
+		mint, maxt := minTime.PrometheusTimestamp(), maxTime.PrometheusTimestamp()
+		var (
+			src  backfill.Source
+			dump *os.File
+		)
+		switch {
+		case *openMetricsFile != "" && *remoteReadURL != "":
+			return errors.New("only one of --openmetrics.file and --remote-read.url can be set")
+		case *openMetricsFile == "-":
+			src = backfill.NewOpenMetricsSource(os.Stdin)
+		case *openMetricsFile != "":
+			dump, err = os.Open(*openMetricsFile)
+			if err != nil {
+				return errors.Wrap(err, "open OpenMetrics text dump")
+			}
+			src = backfill.NewOpenMetricsSource(dump)
+		case *remoteReadURL != "":
+			if minTime.Time != nil && minTime.Time.Format(time.RFC3339) == importMinTime {
+				return errors.New("--min-time has to be set to import from a remote read endpoint")
+			}
+			if now := timestamp.FromTime(time.Now()); maxt > now {
+				maxt = now
+			}
+			matchers, err := parser.ParseMetricSelector(*remoteReadSelector)
+			if err != nil {
+				return errors.Wrapf(err, "parse series selector %s", *remoteReadSelector)
+			}
+			u, err := url.Parse(*remoteReadURL)
+			if err != nil {
+				return errors.Wrap(err, "parse remote read URL")
+			}
+			readClient, err := remote.NewReadClient(component.Import.String(), &remote.ClientConfig{
+				URL:     &config_util.URL{URL: u},
+				Timeout: *remoteReadTimeout,
+			})
+			if err != nil {
+				return errors.Wrap(err, "create remote read client")
+			}
+			src = backfill.NewRemoteReadSource(readClient, matchers, time.Duration(*blockDuration).Milliseconds())
+		default:
+			return errors.New("one of --openmetrics.file and --remote-read.url has to be set")
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Import.String())
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+			if dump != nil {
+				defer runutil.CloseWithLogOnErr(logger, dump, "OpenMetrics text dump")
+			}
+
+			return importBlocks(ctx, logger, bkt, *tmpDir, src, mint, maxt, time.Duration(*blockDuration).Milliseconds(), extLset, *dryRun)
+		}, func(err error) {
+			cancel()
+		})
+		return nil
+	})
+}
+
+func importBlocks(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	tmpDir string,
+	src backfill.Source,
+	mint, maxt int64,
+	blockDuration int64,
+	extLset labels.Labels,
+	dryRun bool,
+) error {
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "create working dir")
+	}
+	dir, err := ioutil.TempDir(tmpDir, "import")
+	if err != nil {
+		return errors.Wrap(err, "create temporary dir")
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			level.Warn(logger).Log("msg", "failed to delete dir", "dir", dir, "err", err)
+		}
+	}()
+
+	ids, stats, err := backfill.CreateBlocks(ctx, logger, dir, src, mint, maxt, blockDuration, extLset)
+	if err != nil {
+		return err
+	}
+	if stats.OutOfOrderSamples > 0 {
+		level.Warn(logger).Log("msg", "dropped out of order samples, samples of each series have to be in time order", "samples", stats.OutOfOrderSamples)
+	}
+	if len(ids) == 0 {
+		return errors.New("no samples to import found")
+	}
+
+	for _, id := range ids {
+		bdir := filepath.Join(dir, id.String())
+		m, err := metadata.Read(bdir)
+		if err != nil {
+			return errors.Wrapf(err, "read meta of block %s", id)
+		}
+		if err := block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), m.MinTime, m.MaxTime); err != nil {
+			return errors.Wrapf(err, "invalid imported block %s", id)
+		}
+		if dryRun {
+			level.Info(logger).Log("msg", "dry run: block would be uploaded", "block", id, "mint", m.MinTime, "maxt", m.MaxTime, "samples", m.Stats.NumSamples)
+			continue
+		}
+		if err := block.Upload(ctx, logger, bkt, bdir); err != nil {
+			return errors.Wrapf(err, "upload imported block %s", id)
+		}
+		level.Info(logger).Log("msg", "uploaded imported block", "block", id, "mint", m.MinTime, "maxt", m.MaxTime, "samples", m.Stats.NumSamples)
+	}
+	level.Info(logger).Log("msg", "import done", "blocks", len(ids), "samples", stats.Samples, "out_of_order_samples", stats.OutOfOrderSamples)
+	return nil
+}
+
+func registerBucketPlan(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
+	cmd := app.Command("plan", "Print the compactions and downsamplings the compactor would execute, without downloading or writing anything. "+
+		"The stats and sizes of the resulting blocks are upper bounds, as samples of overlapping blocks can be deduplicated.")
+	consistencyDelay := cmd.Flag("consistency-delay", "Minimum age of fresh (non-compacted) blocks before they are being processed.").
+		Default("30m").Duration()
+	deleteDelay := cmd.Flag("delete-delay", "Time before a block marked for deletion is deleted from bucket, as configured in the compactor.").
+		Default("48h").Duration()
+	dedupReplicaLabels := cmd.Flag("deduplication.replica-label", "Label to treat as a replica indicator of blocks that can be deduplicated (repeated flag), as configured in the compactor. "+
+		"Planning with replica labels enables vertical compaction.").Strings()
+	disableDownsampling := cmd.Flag("downsampling.disable", "Do not plan downsamplings, as configured in the compactor.").
+		Default("false").Bool()
+	flagLevels := downsamplingLevelsFlag(cmd).Strings()
+	timeout := cmd.Flag("timeout", "Timeout to download metadata from remote storage").Default("5m").Duration()
+	selectorRelabelConf := extkingpin.RegisterSelectorRelabelFlags(cmd)
+
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		relabelContentYaml, err := selectorRelabelConf.Content()
+		if err != nil {
+			return errors.Wrap(err, "get content of relabel configuration")
+		}
+
+		relabelConfig, err := block.ParseRelabelConfig(relabelContentYaml)
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Bucket.String())
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		stubCounter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+		noCompactMarkerFilter := compact.NewGatherNoCompactionMarkFilter(logger, bkt)
+		fetcher, err := block.NewMetaFetcher(logger, fetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), []block.MetadataFilter{
+			block.NewLabelShardedMetaFilter(relabelConfig),
+			block.NewConsistencyDelayMetaFilter(logger, *consistencyDelay, extprom.WrapRegistererWithPrefix(extpromPrefix, reg)),
+			block.NewIgnoreDeletionMarkFilter(logger, bkt, *deleteDelay/2),
+			block.NewDeduplicateFilter(),
+			noCompactMarkerFilter,
+		}, []block.MetadataModifier{block.NewReplicaLabelRemover(logger, *dedupReplicaLabels)})
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		metas, _, err := fetcher.Fetch(ctx)
+		if err != nil {
+			return err
+		}
+
+		grouper := compact.NewDefaultGrouper(logger, bkt, false, len(*dedupReplicaLabels) > 0, nil, stubCounter, stubCounter)
+		groups, err := grouper.Groups(metas)
+		if err != nil {
+			return errors.Wrap(err, "build compaction groups")
+		}
+
+		levels, err := compactions.levels(compactions.maxLevel())
+		if err != nil {
+			return errors.Wrap(err, "get compaction levels")
+		}
+		compactionsPlan, compacted, err := compact.SimulateCompactions(ctx, compact.NewPlanner(logger, levels, noCompactMarkerFilter), groups)
+		if err != nil {
+			return errors.Wrap(err, "simulate compactions")
+		}
+
+		downsamplingLevels, _, err := parseDownsamplingLevels(*flagLevels)
+		if err != nil {
+			return err
+		}
+		var downsamplingsPlan []*metadata.Meta
+		if !*disableDownsampling {
+			if downsamplingsPlan, err = simulateDownsamplings(compacted, downsamplingLevels); err != nil {
+				return errors.Wrap(err, "simulate downsamplings")
+			}
+		}
+		return printPlan(compactionsPlan, downsamplingsPlan, len(*dedupReplicaLabels) > 0)
+	})
+}
+
+// simulateDownsamplings returns the metas of the blocks the passes of downsampling of the compactor, one for each of the
+// given levels, would produce from the given blocks, in order.
+func simulateDownsamplings(metas []*metadata.Meta, levels downsample.Levels) ([]*metadata.Meta, error) {
+	var (
+		downsampled []*metadata.Meta
+		entropy     = rand.New(rand.NewSource(time.Now().UnixNano()))
+		byID        = make(map[ulid.ULID]*metadata.Meta, len(metas))
+	)
+	for _, m := range metas {
+		byID[m.ULID] = m
+	}
+	for pass := 0; pass < len(levels); pass++ {
+		toDownsample, err := downsamplingPlan(byID, levels)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(toDownsample, func(i, j int) bool {
+			if toDownsample[i].Thanos.Downsample.Resolution != toDownsample[j].Thanos.Downsample.Resolution {
+				return toDownsample[i].Thanos.Downsample.Resolution < toDownsample[j].Thanos.Downsample.Resolution
+			}
+			return toDownsample[i].MinTime < toDownsample[j].MinTime
+		})
+
+		for _, m := range toDownsample {
+			res := *m
+			res.ULID = ulid.MustNew(ulid.Now(), entropy)
+			res.Compaction.Parents = []tsdb.BlockDesc{{ULID: m.ULID, MinTime: m.MinTime, MaxTime: m.MaxTime}}
+			res.Thanos.Source = metadata.CompactorSource
+			res.Thanos.Files = nil
+			next, _ := levels.Next(m.Thanos.Downsample.Resolution)
+			res.Thanos.Downsample.Resolution = next.Resolution
+			byID[res.ULID] = &res
+			downsampled = append(downsampled, &res)
+		}
+	}
+	return downsampled, nil
+}
+
+func printPlan(compactionsPlan []compact.SimulatedCompaction, downsamplingsPlan []*metadata.Meta, verticalCompaction bool) error {
+	var (
+		lines [][]string
+		p     = message.NewPrinter(language.English)
+		// steps are the steps producing each planned block, to refer to them as input of the following steps.
+		steps = map[ulid.ULID]int{}
+	)
+	input := func(metas ...*metadata.Meta) string {
+		var ids []string
+		for _, m := range metas {
+			if step, ok := steps[m.ULID]; ok {
+				ids = append(ids, fmt.Sprintf("step %d", step))
+				continue
+			}
+			ids = append(ids, m.ULID.String())
+		}
+		return strings.Join(ids, ",")
+	}
+	line := func(group, action, in string, res *metadata.Meta, size int64, overlapping bool) {
+		steps[res.ULID] = len(lines) + 1
+
+		estSize := "-"
+		if size > 0 {
+			estSize = units.Base2Bytes(size).String()
+		}
+		lines = append(lines, []string{
+			p.Sprintf("%d", len(lines)+1),
+			group,
+			action,
+			in,
+			time.Unix(res.MinTime/1000, 0).Format("02-01-2006 15:04:05"),
+			time.Unix(res.MaxTime/1000, 0).Format("02-01-2006 15:04:05"),
+			p.Sprintf("%d", res.Compaction.Level),
+			time.Duration(res.Thanos.Downsample.Resolution * int64(time.Millisecond)).String(),
+			p.Sprintf("%d", res.Stats.NumSamples),
+			estSize,
+			p.Sprintf("%t", overlapping),
+		})
+	}
+
+	for _, c := range compactionsPlan {
+		if c.Overlapping && !verticalCompaction {
+			fmt.Fprintf(os.Stderr, "WARNING: blocks %s of group %s overlap; the compactor would halt unless vertical compaction is enabled with --deduplication.replica-label\n", input(c.Blocks...), c.Group)
+		}
+		line(c.Group, "compact", input(c.Blocks...), c.Result, c.EstimatedSizeBytes, c.Overlapping)
+	}
+	for _, m := range downsamplingsPlan {
+		parent := &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: m.Compaction.Parents[0].ULID}}
+		line(compact.DefaultGroupKey(m.Thanos), "downsample", input(parent), m, 0, false)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(planColumns)
+	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	table.SetCenterSeparator("|")
+	table.SetAutoWrapText(false)
+	table.SetReflowDuringAutoWrap(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk(lines)
+	table.Render()
+
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func Test_PrintBlocks(t *testing.T) {
+	metas := []*metadata.Meta{
+		{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(1, nil),
+				MinTime:    0,
+				MaxTime:    7200000,
+				Stats:      tsdb.BlockStats{NumSeries: 1000, NumSamples: 120000, NumChunks: 1000},
+				Compaction: tsdb.BlockMetaCompaction{Level: 1},
+			},
+			Thanos: metadata.Thanos{
+				Labels: map[string]string{"cluster": "eu-1"},
+				Source: metadata.SidecarSource,
+				Files:  []metadata.File{{RelPath: "chunks/000001", SizeBytes: 2048}, {RelPath: "index", SizeBytes: 1024}},
+				Annotations: map[string]string{
+					metadata.ProducerAnnotation: "prometheus-0",
+					metadata.VersionAnnotation:  "0.17.0",
+				},
+			},
+		},
+		{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(2, nil),
+				MinTime:    0,
+				MaxTime:    7200000,
+				Stats:      tsdb.BlockStats{NumSeries: 20, NumSamples: 2400, NumChunks: 20},
+				Compaction: tsdb.BlockMetaCompaction{Level: 1},
+			},
+			Thanos: metadata.Thanos{
+				Labels: map[string]string{"cluster": "us-1"},
+				Source: metadata.SidecarSource,
+			},
+		},
+		{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(3, nil),
+				MinTime:    0,
+				MaxTime:    7200000,
+				Stats:      tsdb.BlockStats{NumSeries: 300, NumSamples: 36000, NumChunks: 300},
+				Compaction: tsdb.BlockMetaCompaction{Level: 1},
+			},
+			Thanos: metadata.Thanos{
+				Labels: map[string]string{"cluster": "eu-2"},
+				Source: metadata.SidecarSource,
+				Files:  []metadata.File{{RelPath: "chunks/000001", SizeBytes: 512}},
+			},
+		},
+	}
+
+	var b bytes.Buffer
+	testutil.Ok(t, printBlocks(&b, metas, nil, []string{"ULID", "#SERIES", "SIZE", "LABELS", "ANNOTATIONS"}, []string{"#SERIES"}, "csv"))
+	testutil.Equals(t, `ULID,#SERIES,SIZE,LABELS,ANNOTATIONS
+00000000020000000000000000,20,,cluster=us-1,
+00000000030000000000000000,300,512,cluster=eu-2,
+00000000010000000000000000,1000,3072,cluster=eu-1,"thanos.io/producer=prometheus-0,thanos.io/version=0.17.0"
+`, b.String())
+
+	// Only the blocks matching all the matchers are printed.
+	b.Reset()
+	eu := []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "cluster", "eu-.*")}
+	testutil.Ok(t, printBlocks(&b, metas, eu, []string{"ULID", "FROM", "SIZE", "LABELS"}, []string{"SIZE"}, "json"))
+	testutil.Equals(t, `[
+  {
+    "from": "1970-01-01T00:00:00Z",
+    "labels": {
+      "cluster": "eu-2"
+    },
+    "size": 512,
+    "ulid": "00000000030000000000000000"
+  },
+  {
+    "from": "1970-01-01T00:00:00Z",
+    "labels": {
+      "cluster": "eu-1"
+    },
+    "size": 3072,
+    "ulid": "00000000010000000000000000"
+  }
+]
+`, b.String())
+
+	b.Reset()
+	testutil.NotOk(t, printBlocks(&b, metas, nil, []string{"ULID"}, []string{"UNKNOWN"}, "table"))
+}
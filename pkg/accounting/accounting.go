@@ -0,0 +1,228 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package accounting tracks the usage of each tenant, e.g. for chargeback, and exposes it as metrics and as usage
+// reports periodically written to the object storage.
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+// ReportsDir is the directory of the object storage the usage reports are written to.
+const ReportsDir = "usage"
+
+// TenantUsage is the usage of a tenant over the period of a report.
+type TenantUsage struct {
+	Tenant string `json:"tenant"`
+	// IngestedSamples is the number of samples successfully written.
+	IngestedSamples int64 `json:"ingestedSamples"`
+	// StoredBytes is the size of the data stored at the end of the period.
+	StoredBytes int64 `json:"storedBytes"`
+	// QueriedSamples is the number of samples fetched from the StoreAPIs by the queries.
+	QueriedSamples int64 `json:"queriedSamples"`
+	// QuerySeconds is the time spent evaluating the queries.
+	QuerySeconds float64 `json:"querySeconds"`
+}
+
+func (u TenantUsage) isZero() bool {
+	return u.IngestedSamples == 0 && u.StoredBytes == 0 && u.QueriedSamples == 0 && u.QuerySeconds == 0
+}
+
+// Report is the usage of the tenants over a period, as seen by a single instance of a component.
+type Report struct {
+	Component string        `json:"component"`
+	Source    string        `json:"source"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Tenants   []TenantUsage `json:"tenants"`
+}
+
+// Name returns the name of the object of the report in the object storage: the reports are grouped by day and
+// component, and named after their source and end time.
+func (r Report) Name() string {
+	end := r.End.UTC()
+	return path.Join(ReportsDir, end.Format("2006-01-02"), r.Component, fmt.Sprintf("%s-%d.json", r.Source, end.Unix()))
+}
+
+// Accountant tracks the usage of the tenants.
+type Accountant struct {
+	component string
+	source    string
+
+	mtx sync.Mutex
+	// The start of the period of the next report, and the usage since then.
+	start time.Time
+	usage map[string]*TenantUsage
+
+	ingestedSamples *prometheus.CounterVec
+	storedBytes     *prometheus.GaugeVec
+	queriedSamples  *prometheus.CounterVec
+	querySeconds    *prometheus.CounterVec
+}
+
+// NewAccountant returns a new Accountant of the usage of the tenants by the given component. The source identifies
+// the instance of the component in the reports, e.g. its hostname.
+func NewAccountant(reg prometheus.Registerer, component, source string) *Accountant {
+	return &Accountant{
+		component: component,
+		source:    source,
+		start:     time.Now(),
+		usage:     map[string]*TenantUsage{},
+		ingestedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_accounting_ingested_samples_total",
+			Help: "Total number of samples successfully written, by tenant.",
+		}, []string{"tenant"}),
+		storedBytes: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_accounting_stored_bytes",
+			Help: "Size of the data stored on disk, by tenant.",
+		}, []string{"tenant"}),
+		queriedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_accounting_queried_samples_total",
+			Help: "Total number of samples fetched from the StoreAPIs by queries, by tenant.",
+		}, []string{"tenant"}),
+		querySeconds: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_accounting_query_seconds_total",
+			Help: "Total time spent evaluating queries, by tenant.",
+		}, []string{"tenant"}),
+	}
+}
+
+// tenant returns the usage of the given tenant since the last report. It must be called with the lock held.
+func (a *Accountant) tenant(tenant string) *TenantUsage {
+	u, ok := a.usage[tenant]
+	if !ok {
+		u = &TenantUsage{Tenant: tenant}
+		a.usage[tenant] = u
+	}
+	return u
+}
+
+// AddIngestedSamples accounts the given number of samples written for the tenant.
+func (a *Accountant) AddIngestedSamples(tenant string, samples int) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.tenant(tenant).IngestedSamples += int64(samples)
+	a.ingestedSamples.WithLabelValues(tenant).Add(float64(samples))
+}
+
+// AddQuery accounts a query of the tenant, which fetched the given number of samples and took the given duration.
+func (a *Accountant) AddQuery(tenant string, samples int64, duration time.Duration) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	u := a.tenant(tenant)
+	u.QueriedSamples += samples
+	u.QuerySeconds += duration.Seconds()
+	a.queriedSamples.WithLabelValues(tenant).Add(float64(samples))
+	a.querySeconds.WithLabelValues(tenant).Add(duration.Seconds())
+}
+
+// SetStoredBytes sets the size of the data stored for each tenant. The tenants missing from the given sizes do not
+// store any data anymore.
+func (a *Accountant) SetStoredBytes(sizes map[string]int64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for tenant, u := range a.usage {
+		if _, ok := sizes[tenant]; !ok {
+			u.StoredBytes = 0
+		}
+	}
+	a.storedBytes.Reset()
+	for tenant, size := range sizes {
+		a.tenant(tenant).StoredBytes = size
+		a.storedBytes.WithLabelValues(tenant).Set(float64(size))
+	}
+}
+
+// report returns the report of the usage since the last committed report, until the given time.
+func (a *Accountant) report(end time.Time) Report {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	r := Report{Component: a.component, Source: a.source, Start: a.start, End: end, Tenants: make([]TenantUsage, 0, len(a.usage))}
+	for _, u := range a.usage {
+		if !u.isZero() {
+			r.Tenants = append(r.Tenants, *u)
+		}
+	}
+	sort.Slice(r.Tenants, func(i, j int) bool { return r.Tenants[i].Tenant < r.Tenants[j].Tenant })
+	return r
+}
+
+// commit subtracts the usage of the given report, once it is written, so that the next report starts at its end.
+func (a *Accountant) commit(r Report) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for _, reported := range r.Tenants {
+		u := a.tenant(reported.Tenant)
+		u.IngestedSamples -= reported.IngestedSamples
+		u.QueriedSamples -= reported.QueriedSamples
+		u.QuerySeconds -= reported.QuerySeconds
+		if u.QuerySeconds < 1e-9 {
+			// Ignore the rounding errors of the subtraction.
+			u.QuerySeconds = 0
+		}
+		// The stored bytes are a gauge, reported as is in each report.
+		if u.IngestedSamples == 0 && u.QueriedSamples == 0 && u.QuerySeconds == 0 && u.StoredBytes == 0 {
+			delete(a.usage, reported.Tenant)
+		}
+	}
+	a.start = r.End
+}
+
+// WriteReport writes the report of the usage since the last written report to the bucket. The usage is kept for
+// the next report if it can not be written.
+func (a *Accountant) WriteReport(ctx context.Context, bkt objstore.Bucket) error {
+	r := a.report(time.Now())
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "marshal usage report")
+	}
+	if err := bkt.Upload(ctx, r.Name(), bytes.NewReader(b)); err != nil {
+		return errors.Wrapf(err, "upload usage report %s", r.Name())
+	}
+	a.commit(r)
+	return nil
+}
+
+// Run writes the usage reports to the bucket at the given interval until the context is done, and one last time
+// then, so that no usage is lost on shutdown.
+func (a *Accountant) Run(ctx context.Context, logger log.Logger, bkt objstore.Bucket, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			writeCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := a.WriteReport(writeCtx, bkt); err != nil {
+				level.Error(logger).Log("msg", "failed to write last usage report", "err", err)
+			}
+			return
+		case <-ticker.C:
+			if err := a.WriteReport(ctx, bkt); err != nil {
+				level.Warn(logger).Log("msg", "failed to write usage report, retrying at next interval", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package accounting
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type failingBucket struct {
+	objstore.Bucket
+}
+
+func (b failingBucket) Upload(context.Context, string, io.Reader) error {
+	return errors.New("upload failed")
+}
+
+func readReports(t *testing.T, bkt objstore.Bucket) []Report {
+	var reports []Report
+	testutil.Ok(t, bkt.Iter(context.Background(), ReportsDir, func(day string) error {
+		return bkt.Iter(context.Background(), day, func(comp string) error {
+			return bkt.Iter(context.Background(), comp, func(name string) error {
+				rc, err := bkt.Get(context.Background(), name)
+				testutil.Ok(t, err)
+				defer rc.Close()
+				b, err := ioutil.ReadAll(rc)
+				testutil.Ok(t, err)
+
+				var r Report
+				testutil.Ok(t, json.Unmarshal(b, &r))
+				testutil.Equals(t, r.Name(), name)
+				reports = append(reports, r)
+				return nil
+			})
+		})
+	}))
+	return reports
+}
+
+func TestAccountant(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	a := NewAccountant(reg, "receive", "receive-0")
+	bkt := objstore.NewInMemBucket()
+	ctx := context.Background()
+
+	a.AddIngestedSamples("tenant-a", 10)
+	a.AddIngestedSamples("tenant-b", 5)
+	a.AddIngestedSamples("tenant-a", 2)
+	a.AddQuery("tenant-b", 100, 2*time.Second)
+	a.SetStoredBytes(map[string]int64{"tenant-a": 1024, "tenant-c": 2048})
+
+	testutil.Equals(t, 12.0, promtest.ToFloat64(a.ingestedSamples.WithLabelValues("tenant-a")))
+	testutil.Equals(t, 100.0, promtest.ToFloat64(a.queriedSamples.WithLabelValues("tenant-b")))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(a.querySeconds.WithLabelValues("tenant-b")))
+	testutil.Equals(t, 2048.0, promtest.ToFloat64(a.storedBytes.WithLabelValues("tenant-c")))
+
+	// The usage is kept for the next report if the report can not be written.
+	testutil.NotOk(t, a.WriteReport(ctx, failingBucket{Bucket: bkt}))
+	a.AddIngestedSamples("tenant-a", 3)
+
+	testutil.Ok(t, a.WriteReport(ctx, bkt))
+	reports := readReports(t, bkt)
+	testutil.Equals(t, 1, len(reports))
+	testutil.Equals(t, "receive", reports[0].Component)
+	testutil.Equals(t, "receive-0", reports[0].Source)
+	testutil.Equals(t, []TenantUsage{
+		{Tenant: "tenant-a", IngestedSamples: 15, StoredBytes: 1024},
+		{Tenant: "tenant-b", IngestedSamples: 5, QueriedSamples: 100, QuerySeconds: 2},
+		{Tenant: "tenant-c", StoredBytes: 2048},
+	}, reports[0].Tenants)
+
+	// The next report starts at the end of the previous one, with only the stored bytes of the tenants left.
+	time.Sleep(time.Second)
+	a.AddQuery("tenant-a", 10, time.Second)
+	a.SetStoredBytes(map[string]int64{"tenant-a": 4096})
+	testutil.Ok(t, a.WriteReport(ctx, bkt))
+
+	reports = readReports(t, bkt)
+	testutil.Equals(t, 2, len(reports))
+	testutil.Equals(t, reports[0].End, reports[1].Start)
+	testutil.Equals(t, []TenantUsage{
+		{Tenant: "tenant-a", StoredBytes: 4096, QueriedSamples: 10, QuerySeconds: 1},
+	}, reports[1].Tenants)
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
 	"go.uber.org/atomic"
 
 	"github.com/thanos-io/thanos/pkg/runutil"
@@ -263,12 +264,14 @@ func (q *Queue) Push(alerts []*Alert) {
 type Sender struct {
 	logger        log.Logger
 	alertmanagers []*Alertmanager
-	versions      []APIVersion
 
-	sent    *prometheus.CounterVec
-	errs    *prometheus.CounterVec
-	dropped prometheus.Counter
-	latency *prometheus.HistogramVec
+	sent           *prometheus.CounterVec
+	errs           *prometheus.CounterVec
+	failed         *prometheus.CounterVec
+	relabelDropped *prometheus.CounterVec
+	inFlight       *prometheus.GaugeVec
+	dropped        prometheus.Counter
+	latency        *prometheus.HistogramVec
 }
 
 // NewSender returns a new sender. On each call to Send the entire alert batch is sent
@@ -281,20 +284,9 @@ func NewSender(
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
-	var (
-		versions       []APIVersion
-		versionPresent map[APIVersion]struct{}
-	)
-	for _, am := range alertmanagers {
-		if _, found := versionPresent[am.version]; found {
-			continue
-		}
-		versions = append(versions, am.version)
-	}
 	s := &Sender{
 		logger:        logger,
 		alertmanagers: alertmanagers,
-		versions:      versions,
 
 		sent: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "thanos_alert_sender_alerts_sent_total",
@@ -306,6 +298,21 @@ func NewSender(
 			Help: "Total number of errors while sending alerts to alertmanager.",
 		}, []string{"alertmanager"}),
 
+		failed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_alert_sender_alerts_failed_total",
+			Help: "Total number of alerts which failed to be sent to alertmanager.",
+		}, []string{"alertmanager"}),
+
+		relabelDropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_alert_sender_alerts_relabel_dropped_total",
+			Help: "Total number of alerts not sent to alertmanager because they were dropped by its alert relabel configs.",
+		}, []string{"alertmanager"}),
+
+		inFlight: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_alert_sender_alerts_in_flight",
+			Help: "Number of alerts being sent to alertmanager.",
+		}, []string{"alertmanager"}),
+
 		dropped: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name: "thanos_alert_sender_alerts_dropped_total",
 			Help: "Total number of alerts dropped in case of all sends to alertmanagers failed.",
@@ -328,6 +335,32 @@ func toAPILabels(labels labels.Labels) models.LabelSet {
 	return apiLabels
 }
 
+// encodeAlerts returns the payload of the given alerts for the given Alertmanager API version.
+func encodeAlerts(version APIVersion, alerts []*Alert) ([]byte, error) {
+	switch version {
+	case APIv1:
+		b, err := json.Marshal(alerts)
+		return b, errors.Wrap(err, "encoding alerts for v1 API")
+	case APIv2:
+		apiAlerts := make(models.PostableAlerts, 0, len(alerts))
+		for _, a := range alerts {
+			apiAlerts = append(apiAlerts, &models.PostableAlert{
+				Annotations: toAPILabels(a.Annotations),
+				EndsAt:      strfmt.DateTime(a.EndsAt),
+				StartsAt:    strfmt.DateTime(a.StartsAt),
+				Alert: models.Alert{
+					GeneratorURL: strfmt.URI(a.GeneratorURL),
+					Labels:       toAPILabels(a.Labels),
+				},
+			})
+		}
+		b, err := json.Marshal(apiAlerts)
+		return b, errors.Wrap(err, "encoding alerts for v2 API")
+	default:
+		return nil, errors.Errorf("unsupported Alertmanager API version %q", version)
+	}
+}
+
 // Send an alert batch to all given Alertmanager clients.
 // TODO(bwplotka): https://github.com/thanos-io/thanos/issues/660.
 func (s *Sender) Send(ctx context.Context, alerts []*Alert) {
@@ -335,70 +368,73 @@ func (s *Sender) Send(ctx context.Context, alerts []*Alert) {
 		return
 	}
 
-	payload := make(map[APIVersion][]byte)
-	for _, version := range s.versions {
-		var (
-			b   []byte
-			err error
-		)
-		switch version {
-		case APIv1:
-			if b, err = json.Marshal(alerts); err != nil {
-				level.Warn(s.logger).Log("msg", "encoding alerts for v1 API failed", "err", err)
-				return
-			}
-		case APIv2:
-			apiAlerts := make(models.PostableAlerts, 0, len(alerts))
-			for _, a := range alerts {
-				apiAlerts = append(apiAlerts, &models.PostableAlert{
-					Annotations: toAPILabels(a.Annotations),
-					EndsAt:      strfmt.DateTime(a.EndsAt),
-					StartsAt:    strfmt.DateTime(a.StartsAt),
-					Alert: models.Alert{
-						GeneratorURL: strfmt.URI(a.GeneratorURL),
-						Labels:       toAPILabels(a.Labels),
-					},
-				})
-			}
-			if b, err = json.Marshal(apiAlerts); err != nil {
-				level.Warn(s.logger).Log("msg", "encoding alerts for v2 API failed", "err", err)
-				return
-			}
-		}
-		payload[version] = b
-	}
-
 	var (
 		wg         sync.WaitGroup
 		numSuccess atomic.Uint64
+		// Payloads of the alerts as given, per API version, shared by the Alertmanagers without alert relabel configs.
+		payloads = make(map[APIVersion][]byte)
 	)
 	for _, am := range s.alertmanagers {
+		amAlerts := am.relabel(alerts)
+		numDropped := len(alerts) - len(amAlerts)
+		if len(amAlerts) == 0 {
+			// None of the alerts are meant for this Alertmanager, which is not a failure.
+			for _, u := range am.dispatcher.Endpoints() {
+				s.relabelDropped.WithLabelValues(u.Host).Add(float64(numDropped))
+			}
+			numSuccess.Inc()
+			continue
+		}
+
+		var (
+			payload []byte
+			err     error
+		)
+		if len(am.relabelConfigs) == 0 {
+			if _, ok := payloads[am.version]; !ok {
+				payloads[am.version], err = encodeAlerts(am.version, amAlerts)
+			}
+			payload = payloads[am.version]
+		} else {
+			payload, err = encodeAlerts(am.version, amAlerts)
+		}
+		if err != nil {
+			level.Warn(s.logger).Log("msg", "encoding alerts failed", "err", err)
+			continue
+		}
+
 		for _, u := range am.dispatcher.Endpoints() {
+			s.relabelDropped.WithLabelValues(u.Host).Add(float64(numDropped))
+
 			wg.Add(1)
-			go func(am *Alertmanager, u url.URL) {
+			go func(am *Alertmanager, u url.URL, payload []byte, numAlerts int) {
 				defer wg.Done()
 
-				level.Debug(s.logger).Log("msg", "sending alerts", "alertmanager", u.Host, "numAlerts", len(alerts))
+				level.Debug(s.logger).Log("msg", "sending alerts", "alertmanager", u.Host, "numAlerts", numAlerts)
 				start := time.Now()
 				u.Path = path.Join(u.Path, fmt.Sprintf("/api/%s/alerts", string(am.version)))
 
+				s.inFlight.WithLabelValues(u.Host).Add(float64(numAlerts))
+				defer s.inFlight.WithLabelValues(u.Host).Sub(float64(numAlerts))
+
 				tracing.DoInSpan(ctx, "post_alerts HTTP[client]", func(ctx context.Context) {
-					if err := am.postAlerts(ctx, u, bytes.NewReader(payload[am.version])); err != nil {
+					if err := am.postAlerts(ctx, u, bytes.NewReader(payload)); err != nil {
 						level.Warn(s.logger).Log(
 							"msg", "sending alerts failed",
 							"alertmanager", u.Host,
-							"alerts", string(payload[am.version]),
+							"alerts", string(payload),
 							"err", err,
 						)
 						s.errs.WithLabelValues(u.Host).Inc()
+						s.failed.WithLabelValues(u.Host).Add(float64(numAlerts))
 						return
 					}
 					s.latency.WithLabelValues(u.Host).Observe(time.Since(start).Seconds())
-					s.sent.WithLabelValues(u.Host).Add(float64(len(alerts)))
+					s.sent.WithLabelValues(u.Host).Add(float64(numAlerts))
 
 					numSuccess.Inc()
 				})
-			}(am, *u)
+			}(am, *u, payload, len(amAlerts))
 		}
 	}
 	wg.Wait()
@@ -420,24 +456,45 @@ type Dispatcher interface {
 
 // Alertmanager is an HTTP client that can send alerts to a cluster of Alertmanager endpoints.
 type Alertmanager struct {
-	logger     log.Logger
-	dispatcher Dispatcher
-	timeout    time.Duration
-	version    APIVersion
+	logger         log.Logger
+	dispatcher     Dispatcher
+	timeout        time.Duration
+	version        APIVersion
+	relabelConfigs []*relabel.Config
 }
 
-// NewAlertmanager returns a new Alertmanager client.
-func NewAlertmanager(logger log.Logger, dispatcher Dispatcher, timeout time.Duration, version APIVersion) *Alertmanager {
+// NewAlertmanager returns a new Alertmanager client. The alerts are relabelled with the given relabel configs before
+// being sent to the Alertmanager.
+func NewAlertmanager(logger log.Logger, dispatcher Dispatcher, timeout time.Duration, version APIVersion, relabelConfigs []*relabel.Config) *Alertmanager {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
 
 	return &Alertmanager{
-		logger:     logger,
-		dispatcher: dispatcher,
-		timeout:    timeout,
-		version:    version,
+		logger:         logger,
+		dispatcher:     dispatcher,
+		timeout:        timeout,
+		version:        version,
+		relabelConfigs: relabelConfigs,
+	}
+}
+
+// relabel returns the given alerts relabelled with the relabel configs of the Alertmanager, without the dropped ones.
+func (a *Alertmanager) relabel(alerts []*Alert) []*Alert {
+	if len(a.relabelConfigs) == 0 {
+		return alerts
+	}
+	res := make([]*Alert, 0, len(alerts))
+	for _, alrt := range alerts {
+		lset := relabel.Process(alrt.Labels, a.relabelConfigs...)
+		if lset == nil {
+			continue
+		}
+		relabelled := *alrt
+		relabelled.Labels = lset
+		res = append(res, &relabelled)
 	}
+	return res
 }
 
 func (a *Alertmanager) postAlerts(ctx context.Context, u url.URL, r io.Reader) error {
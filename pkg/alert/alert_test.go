@@ -5,6 +5,7 @@ package alert
 
 import (
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -14,6 +15,8 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"gopkg.in/yaml.v2"
 
 	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil"
@@ -78,10 +81,11 @@ func assertSameHosts(t *testing.T, expected []*url.URL, found []*url.URL) {
 }
 
 type fakeClient struct {
-	urls []*url.URL
-	dof  func(u *url.URL) (*http.Response, error)
-	mtx  sync.Mutex
-	seen []*url.URL
+	urls   []*url.URL
+	dof    func(u *url.URL) (*http.Response, error)
+	mtx    sync.Mutex
+	seen   []*url.URL
+	bodies []string
 }
 
 func (f *fakeClient) Endpoints() []*url.URL {
@@ -93,6 +97,11 @@ func (f *fakeClient) Do(req *http.Request) (*http.Response, error) {
 	defer f.mtx.Unlock()
 	u := req.URL
 	f.seen = append(f.seen, u)
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.bodies = append(f.bodies, string(b))
 	if f.dof == nil {
 		rec := httptest.NewRecorder()
 		rec.WriteHeader(http.StatusOK)
@@ -105,7 +114,7 @@ func TestSenderSendsOk(t *testing.T) {
 	poster := &fakeClient{
 		urls: []*url.URL{{Host: "am1:9090"}, {Host: "am2:9090"}},
 	}
-	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)})
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1, nil)})
 
 	s.Send(context.Background(), []*Alert{{}, {}})
 
@@ -132,7 +141,7 @@ func TestSenderSendsOneFails(t *testing.T) {
 			return rec.Result(), nil
 		},
 	}
-	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)})
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1, nil)})
 
 	s.Send(context.Background(), []*Alert{{}, {}})
 
@@ -153,7 +162,7 @@ func TestSenderSendsAllFail(t *testing.T) {
 			return nil, errors.New("no such host")
 		},
 	}
-	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)})
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1, nil)})
 
 	s.Send(context.Background(), []*Alert{{}, {}})
 
@@ -166,3 +175,43 @@ func TestSenderSendsAllFail(t *testing.T) {
 	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.errs.WithLabelValues(poster.urls[1].Host))))
 	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.dropped)))
 }
+
+func TestSenderSendsRelabelled(t *testing.T) {
+	var relabelConfigs, dropAllConfigs []*relabel.Config
+	testutil.Ok(t, yaml.Unmarshal([]byte(`
+- source_labels: [team]
+  regex: a
+  action: keep
+- target_label: routed
+  replacement: "true"
+`), &relabelConfigs))
+	testutil.Ok(t, yaml.Unmarshal([]byte(`
+- source_labels: [team]
+  regex: c
+  action: keep
+`), &dropAllConfigs))
+
+	all := &fakeClient{urls: []*url.URL{{Host: "am1:9090"}}}
+	teamA := &fakeClient{urls: []*url.URL{{Host: "am2:9090"}}}
+	none := &fakeClient{urls: []*url.URL{{Host: "am3:9090"}}}
+	s := NewSender(nil, nil, []*Alertmanager{
+		NewAlertmanager(nil, all, time.Minute, APIv2, nil),
+		NewAlertmanager(nil, teamA, time.Minute, APIv2, relabelConfigs),
+		NewAlertmanager(nil, none, time.Minute, APIv1, dropAllConfigs),
+	})
+
+	s.Send(context.Background(), []*Alert{
+		{Labels: labels.FromStrings("alertname", "a", "team", "a")},
+		{Labels: labels.FromStrings("alertname", "b", "team", "b")},
+	})
+
+	testutil.Equals(t, []string{`[{"endsAt":"0001-01-01T00:00:00.000Z","startsAt":"0001-01-01T00:00:00.000Z","labels":{"alertname":"a","team":"a"}},{"endsAt":"0001-01-01T00:00:00.000Z","startsAt":"0001-01-01T00:00:00.000Z","labels":{"alertname":"b","team":"b"}}]`}, all.bodies)
+	testutil.Equals(t, []string{`[{"endsAt":"0001-01-01T00:00:00.000Z","startsAt":"0001-01-01T00:00:00.000Z","labels":{"alertname":"a","routed":"true","team":"a"}}]`}, teamA.bodies)
+	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.sent.WithLabelValues("am1:9090"))))
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.sent.WithLabelValues("am2:9090"))))
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.relabelDropped.WithLabelValues("am2:9090"))))
+	testutil.Equals(t, 0, int(promtestutil.ToFloat64(s.inFlight.WithLabelValues("am2:9090"))))
+	testutil.Equals(t, 0, len(none.bodies))
+	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.relabelDropped.WithLabelValues("am3:9090"))))
+	testutil.Equals(t, 0, int(promtestutil.ToFloat64(s.dropped)))
+}
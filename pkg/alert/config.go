@@ -12,6 +12,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/relabel"
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
@@ -28,6 +29,8 @@ type AlertmanagerConfig struct {
 	EndpointsConfig  http_util.EndpointsConfig `yaml:",inline"`
 	Timeout          model.Duration            `yaml:"timeout"`
 	APIVersion       APIVersion                `yaml:"api_version"`
+	// AlertRelabelConfigs are applied to the alerts before they are sent to the Alertmanager endpoints.
+	AlertRelabelConfigs []*relabel.Config `yaml:"alert_relabel_configs"`
 }
 
 // APIVersion represents the API version of the Alertmanager endpoint.
@@ -65,8 +68,9 @@ func DefaultAlertmanagerConfig() AlertmanagerConfig {
 			StaticAddresses: []string{},
 			FileSDConfigs:   []http_util.FileSDConfig{},
 		},
-		Timeout:    model.Duration(time.Second * 10),
-		APIVersion: APIv1,
+		Timeout:             model.Duration(time.Second * 10),
+		APIVersion:          APIv1,
+		AlertRelabelConfigs: []*relabel.Config{},
 	}
 }
 
@@ -56,6 +56,9 @@ const (
 	ErrorExec     ErrorType = "execution"
 	ErrorBadData  ErrorType = "bad_data"
 	ErrorInternal ErrorType = "internal"
+	ErrorLimit    ErrorType = "limit"
+	ErrorNotFound ErrorType = "not_found"
+	ErrorAuth     ErrorType = "unauthorized"
 )
 
 var corsHeaders = map[string]string{
@@ -241,12 +244,16 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 	switch apiErr.Typ {
 	case ErrorBadData:
 		code = http.StatusBadRequest
-	case ErrorExec:
+	case ErrorExec, ErrorLimit:
 		code = 422
 	case ErrorCanceled, ErrorTimeout:
 		code = http.StatusServiceUnavailable
 	case ErrorInternal:
 		code = http.StatusInternalServerError
+	case ErrorNotFound:
+		code = http.StatusNotFound
+	case ErrorAuth:
+		code = http.StatusUnauthorized
 	default:
 		code = http.StatusInternalServerError
 	}
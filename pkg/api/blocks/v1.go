@@ -5,15 +5,22 @@ package v1
 
 import (
 	"net/http"
+	"path"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
 	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/objstore"
 )
 
 // BlocksAPI is a very simple API used by Thanos Block Viewer.
@@ -22,6 +29,9 @@ type BlocksAPI struct {
 	logger           log.Logger
 	globalBlocksInfo *BlocksInfo
 	loadedBlocksInfo *BlocksInfo
+	compactions      func() interface{}
+	bucketReporter   func() interface{}
+	bkt              objstore.Bucket
 }
 
 type BlocksInfo struct {
@@ -31,11 +41,13 @@ type BlocksInfo struct {
 	Err         error           `json:"err"`
 }
 
-// NewBlocksAPI creates a simple API to be used by Thanos Block Viewer.
-func NewBlocksAPI(logger log.Logger, label string, flagsMap map[string]string) *BlocksAPI {
+// NewBlocksAPI creates a simple API to be used by Thanos Block Viewer. Blocks can be marked for deletion or no
+// compaction through the API only if the bucket is not nil.
+func NewBlocksAPI(logger log.Logger, label string, flagsMap map[string]string, bkt objstore.Bucket) *BlocksAPI {
 	return &BlocksAPI{
 		baseAPI: api.NewBaseAPI(logger, flagsMap),
 		logger:  logger,
+		bkt:     bkt,
 		globalBlocksInfo: &BlocksInfo{
 			Blocks: []metadata.Meta{},
 			Label:  label,
@@ -53,6 +65,9 @@ func (bapi *BlocksAPI) Register(r *route.Router, tracer opentracing.Tracer, logg
 	instr := api.GetInstr(tracer, logger, ins, logMiddleware)
 
 	r.Get("/blocks", instr("blocks", bapi.blocks))
+	r.Get("/compactions", instr("compactions", bapi.compactionStatus))
+	r.Get("/blocks/report", instr("blocks_report", bapi.bucketReport))
+	r.Post("/blocks/mark", instr("blocks_mark", bapi.markBlock))
 }
 
 func (bapi *BlocksAPI) blocks(r *http.Request) (interface{}, []error, *api.ApiError) {
@@ -63,6 +78,65 @@ func (bapi *BlocksAPI) blocks(r *http.Request) (interface{}, []error, *api.ApiEr
 	return bapi.globalBlocksInfo, nil, nil
 }
 
+func (bapi *BlocksAPI) markBlock(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if bapi.bkt == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("marking blocks is disabled, it has to be enabled with --enable-admin-operations")}
+	}
+
+	idParam := r.FormValue("id")
+	actionParam := r.FormValue("action")
+	detailParam := r.FormValue("detail")
+
+	if idParam == "" {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("ID cannot be empty")}
+	}
+	id, err := ulid.Parse(idParam)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("ULID %q is not valid: %v", idParam, err)}
+	}
+
+	exists, err := bapi.bkt.Exists(r.Context(), path.Join(id.String(), metadata.MetaFilename))
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrapf(err, "check block %s", id)}
+	}
+	if !exists {
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: errors.Errorf("block %s not found", id)}
+	}
+
+	switch actionParam {
+	case "DELETION":
+		err = block.MarkForDeletion(r.Context(), bapi.logger, bapi.bkt, id, detailParam, promauto.With(nil).NewCounter(prometheus.CounterOpts{}))
+	case "NO_COMPACTION":
+		err = block.MarkForNoCompact(r.Context(), bapi.logger, bapi.bkt, id, metadata.ManualNoCompactReason, detailParam, promauto.With(nil).NewCounter(prometheus.CounterOpts{}))
+	case "":
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("action cannot be empty")}
+	default:
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("not supported marker %v", actionParam)}
+	}
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: err}
+	}
+	return nil, nil, nil
+}
+
+func (bapi *BlocksAPI) compactionStatus(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if bapi.compactions == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("compaction status is only available on compactor")}
+	}
+	return bapi.compactions(), nil, nil
+}
+
+func (bapi *BlocksAPI) bucketReport(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if bapi.bucketReporter == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("bucket report is only available on compactor")}
+	}
+	report := bapi.bucketReporter()
+	if report == nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorNotFound, Err: errors.New("bucket was not synced yet")}
+	}
+	return report, nil, nil
+}
+
 func (b *BlocksInfo) set(blocks []metadata.Meta, err error) {
 	if err != nil {
 		// Last view is maintained.
@@ -85,3 +159,14 @@ func (bapi *BlocksAPI) SetGlobal(blocks []metadata.Meta, err error) {
 func (bapi *BlocksAPI) SetLoaded(blocks []metadata.Meta, err error) {
 	bapi.loadedBlocksInfo.set(blocks, err)
 }
+
+// SetCompactionStatus sets the function returning the state of the compactions exposed in the API.
+func (bapi *BlocksAPI) SetCompactionStatus(status func() interface{}) {
+	bapi.compactions = status
+}
+
+// SetBucketReport sets the function returning the report of the blocks of the bucket exposed in the API. The function
+// returns nil if the bucket was not synced yet.
+func (bapi *BlocksAPI) SetBucketReport(report func() interface{}) {
+	bapi.bucketReporter = report
+}
@@ -0,0 +1,71 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/thanos-io/thanos/pkg/api"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func markRequest(t *testing.T, id, action, detail string) *http.Request {
+	form := url.Values{"id": {id}, "action": {action}, "detail": {detail}}
+	r, err := http.NewRequest(http.MethodPost, "/blocks/mark", strings.NewReader(form.Encode()))
+	testutil.Ok(t, err)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestMarkBlock(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	id := ulid.MustNew(1, nil)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), metadata.MetaFilename), strings.NewReader("{}")))
+
+	// Marking blocks is disabled without bucket.
+	_, _, apiErr := NewBlocksAPI(log.NewNopLogger(), "", nil, nil).markBlock(markRequest(t, id.String(), "DELETION", ""))
+	testutil.Assert(t, apiErr != nil)
+	testutil.Equals(t, api.ErrorBadData, apiErr.Typ)
+
+	bapi := NewBlocksAPI(log.NewNopLogger(), "", nil, bkt)
+	for _, tcase := range []struct {
+		id, action string
+	}{
+		{id: "", action: "DELETION"},
+		{id: "not-a-ulid", action: "DELETION"},
+		{id: id.String(), action: ""},
+		{id: id.String(), action: "UNKNOWN"},
+	} {
+		_, _, apiErr := bapi.markBlock(markRequest(t, tcase.id, tcase.action, ""))
+		testutil.Assert(t, apiErr != nil, "%v", tcase)
+		testutil.Equals(t, api.ErrorBadData, apiErr.Typ)
+	}
+
+	_, _, apiErr = bapi.markBlock(markRequest(t, id.String(), "NO_COMPACTION", "too big"))
+	testutil.Assert(t, apiErr == nil, "%v", apiErr)
+	exists, err := bkt.Exists(ctx, path.Join(id.String(), metadata.NoCompactMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists)
+
+	_, _, apiErr = bapi.markBlock(markRequest(t, id.String(), "DELETION", "not needed"))
+	testutil.Assert(t, apiErr == nil, "%v", apiErr)
+	exists, err = bkt.Exists(ctx, path.Join(id.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists)
+
+	// Blocks which don't exist can't be marked.
+	_, _, apiErr = bapi.markBlock(markRequest(t, ulid.MustNew(2, nil).String(), "DELETION", ""))
+	testutil.Assert(t, apiErr != nil)
+	testutil.Equals(t, api.ErrorNotFound, apiErr.Typ)
+}
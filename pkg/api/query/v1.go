@@ -23,11 +23,13 @@ import (
 	"context"
 	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
@@ -37,16 +39,25 @@ import (
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/stats"
 
+	"github.com/thanos-io/thanos/pkg/accounting"
 	"github.com/thanos-io/thanos/pkg/api"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/metadata"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/rules"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/strutil"
+	"github.com/thanos-io/thanos/pkg/targets"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
@@ -57,6 +68,11 @@ const (
 	ReplicaLabelsParam       = "replicaLabels[]"
 	MatcherParam             = "match[]"
 	StoreMatcherParam        = "storeMatch[]"
+	StatsParam               = "stats"
+	ShardIndexParam          = "shard_index"
+	TotalShardsParam         = "shard_count"
+	ShardGroupingParam       = "shard_grouping"
+	ShardLabelsParam         = "shard_labels[]"
 )
 
 // QueryAPI is an API used by Thanos Querier.
@@ -68,16 +84,29 @@ type QueryAPI struct {
 	// queryEngine returns appropriate promql.Engine for a query with a given step.
 	queryEngine func(int64) *promql.Engine
 	ruleGroups  rules.UnaryClient
+	targets     targets.UnaryClient
+	metadatas   metadata.UnaryClient
 
-	enableAutodownsampling     bool
-	enableQueryPartialResponse bool
-	enableRulePartialResponse  bool
+	enableAutodownsampling        bool
+	enableQueryPartialResponse    bool
+	enableRulePartialResponse     bool
+	enableTargetPartialResponse   bool
+	enableMetadataPartialResponse bool
 
 	replicaLabels []string
 	storeSet      *query.StoreSet
+	tenancy       *query.Tenancy
+	limits        *query.TenantLimits
+	activeQueries *query.ActiveQueries
+	// accountant accounts the usage of the queries to their tenant, if not nil.
+	accountant *accounting.Accountant
 
 	defaultInstantQueryMaxSourceResolution time.Duration
 	defaultMetadataTimeRange               time.Duration
+	// rangeQuerySplitInterval is the interval range queries are evaluated by, if not zero.
+	rangeQuerySplitInterval time.Duration
+	// enableStoreAdminAPI enables adding, removing and draining stores at runtime.
+	enableStoreAdminAPI bool
 }
 
 // NewQueryAPI returns an initialized QueryAPI type.
@@ -87,14 +116,24 @@ func NewQueryAPI(
 	qe func(int64) *promql.Engine,
 	c query.QueryableCreator,
 	ruleGroups rules.UnaryClient,
+	targets targets.UnaryClient,
+	metadatas metadata.UnaryClient,
 	enableAutodownsampling bool,
 	enableQueryPartialResponse bool,
 	enableRulePartialResponse bool,
+	enableTargetPartialResponse bool,
+	enableMetadataPartialResponse bool,
 	replicaLabels []string,
 	flagsMap map[string]string,
 	defaultInstantQueryMaxSourceResolution time.Duration,
 	defaultMetadataTimeRange time.Duration,
 	gate gate.Gate,
+	tenancy *query.Tenancy,
+	rangeQuerySplitInterval time.Duration,
+	limits *query.TenantLimits,
+	activeQueries *query.ActiveQueries,
+	enableStoreAdminAPI bool,
+	accountant *accounting.Accountant,
 ) *QueryAPI {
 	return &QueryAPI{
 		baseAPI:         api.NewBaseAPI(logger, flagsMap),
@@ -103,14 +142,24 @@ func NewQueryAPI(
 		queryableCreate: c,
 		gate:            gate,
 		ruleGroups:      ruleGroups,
+		targets:         targets,
+		metadatas:       metadatas,
 
 		enableAutodownsampling:                 enableAutodownsampling,
 		enableQueryPartialResponse:             enableQueryPartialResponse,
 		enableRulePartialResponse:              enableRulePartialResponse,
+		enableTargetPartialResponse:            enableTargetPartialResponse,
+		enableMetadataPartialResponse:          enableMetadataPartialResponse,
 		replicaLabels:                          replicaLabels,
 		storeSet:                               storeSet,
+		tenancy:                                tenancy,
+		limits:                                 limits,
+		activeQueries:                          activeQueries,
 		defaultInstantQueryMaxSourceResolution: defaultInstantQueryMaxSourceResolution,
 		defaultMetadataTimeRange:               defaultMetadataTimeRange,
+		rangeQuerySplitInterval:                rangeQuerySplitInterval,
+		enableStoreAdminAPI:                    enableStoreAdminAPI,
+		accountant:                             accountant,
 	}
 }
 
@@ -126,6 +175,9 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 	r.Get("/query_range", instr("query_range", qapi.queryRange))
 	r.Post("/query_range", instr("query_range", qapi.queryRange))
 
+	r.Get("/query_explain", instr("query_explain", qapi.queryExplain))
+	r.Post("/query_explain", instr("query_explain", qapi.queryExplain))
+
 	r.Get("/label/:name/values", instr("label_values", qapi.labelValues))
 
 	r.Get("/series", instr("series", qapi.series))
@@ -135,8 +187,31 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 	r.Post("/labels", instr("label_names", qapi.labelNames))
 
 	r.Get("/stores", instr("stores", qapi.stores))
+	r.Post("/stores/add", instr("stores_add", qapi.addStore))
+	r.Post("/stores/remove", instr("stores_remove", qapi.removeStore))
+	r.Post("/stores/drain", instr("stores_drain", qapi.drainStore(true)))
+	r.Post("/stores/undrain", instr("stores_undrain", qapi.drainStore(false)))
+
+	r.Get("/status/active_queries", instr("status_active_queries", qapi.statusActiveQueries))
+
+	// Rules, alerts, targets and metadata are not scoped to tenants, so they are not exposed when tenancy is enforced.
+	r.Get("/rules", instr("rules", qapi.withoutTenancy(NewRulesHandler(qapi.ruleGroups, qapi.enableRulePartialResponse))))
+
+	r.Get("/alerts", instr("alerts", qapi.withoutTenancy(NewAlertsHandler(qapi.ruleGroups, qapi.enableRulePartialResponse))))
+
+	r.Get("/targets", instr("targets", qapi.withoutTenancy(NewTargetsHandler(qapi.targets, qapi.enableTargetPartialResponse))))
 
-	r.Get("/rules", instr("rules", NewRulesHandler(qapi.ruleGroups, qapi.enableRulePartialResponse)))
+	r.Get("/metadata", instr("metadata", qapi.withoutTenancy(NewMetricMetadataHandler(qapi.metadatas, qapi.enableMetadataPartialResponse))))
+}
+
+// withoutTenancy returns the given handler, rejecting all the requests if tenancy is enforced.
+func (qapi *QueryAPI) withoutTenancy(f api.ApiFunc) api.ApiFunc {
+	if !qapi.tenancy.Enabled() {
+		return f
+	}
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("%s is not available when tenancy is enforced", r.URL.Path)}
+	}
 }
 
 type queryData struct {
@@ -145,6 +220,58 @@ type queryData struct {
 
 	// Additional Thanos Response field.
 	Warnings []error `json:"warnings,omitempty"`
+	// Optional stats field in response if parameter "stats" is not empty.
+	Stats *queryStats `json:"stats,omitempty"`
+}
+
+// queryStats are the statistics of a query: the wall times of the phases of its evaluation, and the data fetched
+// from the StoreAPIs.
+type queryStats struct {
+	*stats.QueryStats
+	Store query.StoresStats `json:"store"`
+}
+
+// parseQueryStatsParam returns a context gathering the statistics of the query if they are requested.
+func parseQueryStatsParam(ctx context.Context, r *http.Request) (context.Context, *query.QueryStats) {
+	if r.FormValue(StatsParam) == "" {
+		return ctx, nil
+	}
+	qs := query.NewQueryStats()
+	return query.WithQueryStats(ctx, qs), qs
+}
+
+// parseShardParams returns a context restricting the query to the series of a shard if one is requested. The
+// series are sharded by the hash of the given labels if the shard grouping is "by", or by the hash of all their
+// labels but the given ones if it is "without".
+func parseShardParams(ctx context.Context, r *http.Request) (context.Context, *api.ApiError) {
+	if r.FormValue(TotalShardsParam) == "" {
+		return ctx, nil
+	}
+	totalShards, err := strconv.Atoi(r.FormValue(TotalShardsParam))
+	if err != nil || totalShards <= 0 {
+		return nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid '%s' parameter, expected a positive integer", TotalShardsParam)}
+	}
+	shardIndex, err := strconv.Atoi(r.FormValue(ShardIndexParam))
+	if err != nil || shardIndex < 0 || shardIndex >= totalShards {
+		return nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid '%s' parameter, expected an integer between 0 and %d", ShardIndexParam, totalShards-1)}
+	}
+
+	var by bool
+	switch grouping := r.FormValue(ShardGroupingParam); grouping {
+	case "by":
+		by = true
+	case "without":
+	default:
+		return nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid '%s' parameter %q, expected by or without", ShardGroupingParam, grouping)}
+	}
+	return query.WithShardInfo(ctx, query.NewShardInfo(shardIndex, totalShards, by, r.Form[ShardLabelsParam])), nil
+}
+
+func newQueryStats(qry promql.Query, qs *query.QueryStats) *queryStats {
+	if qs == nil {
+		return nil
+	}
+	return &queryStats{QueryStats: query.PromQLStats(qry), Store: qs.Stores()}
 }
 
 func (qapi *QueryAPI) parseEnableDedupParam(r *http.Request) (enableDeduplication bool, _ *api.ApiError) {
@@ -224,6 +351,66 @@ func (qapi *QueryAPI) parsePartialResponseParam(r *http.Request, defaultEnablePa
 	return defaultEnablePartialResponse, nil
 }
 
+// withPartialResponseParam returns a context disabling the partial responses of the best-effort StoreAPIs too,
+// if partial response is explicitly disabled by the request.
+func withPartialResponseParam(ctx context.Context, r *http.Request) context.Context {
+	if val := r.FormValue(PartialResponseParam); val != "" {
+		if enable, err := strconv.ParseBool(val); err == nil && !enable {
+			return context.WithValue(ctx, store.PartialResponseDisabledKey, true)
+		}
+	}
+	return ctx
+}
+
+func (qapi *QueryAPI) parseTenant(r *http.Request) (tenant string, _ *api.ApiError) {
+	tenant, err := qapi.tenancy.Tenant(r)
+	if err != nil {
+		return "", &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+	return tenant, nil
+}
+
+// withLimits returns a context enforcing the query limits of the tenant, and its cancel function.
+func (qapi *QueryAPI) withLimits(ctx context.Context, tenant string) (context.Context, context.CancelFunc) {
+	limits := qapi.limits.ForTenant(tenant)
+	ctx = query.WithLimits(ctx, limits)
+	if limits.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, limits.QueryTimeout)
+	}
+	return ctx, func() {}
+}
+
+// startQuery accounts a query of the tenant against its limit of concurrent queries until the returned function is
+// called.
+func (qapi *QueryAPI) startQuery(tenant string) (func(), *api.ApiError) {
+	finished, err := qapi.limits.StartQuery(tenant)
+	if err != nil {
+		return nil, &api.ApiError{Typ: api.ErrorLimit, Err: err}
+	}
+	return finished, nil
+}
+
+// accountQuery returns a context counting the samples fetched by a query of the tenant, and a function accounting
+// the usage of the query once it is executed.
+func (qapi *QueryAPI) accountQuery(ctx context.Context, tenant string) (context.Context, func()) {
+	if qapi.accountant == nil {
+		return ctx, func() {}
+	}
+	usage := &query.QueryUsage{}
+	start := time.Now()
+	return query.WithQueryUsage(ctx, usage), func() {
+		qapi.accountant.AddQuery(tenant, usage.Samples(), time.Since(start))
+	}
+}
+
+// execErrorType returns the type of the error of a query execution.
+func execErrorType(err error) api.ErrorType {
+	if query.IsLimitError(err) {
+		return api.ErrorLimit
+	}
+	return api.ErrorExec
+}
+
 func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiError) {
 	ts, err := parseTimeParam(r, "time", qapi.baseAPI.Now())
 	if err != nil {
@@ -262,6 +449,26 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 		return nil, nil, apiErr
 	}
 
+	tenant, apiErr := qapi.parseTenant(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	ctx, cancel := qapi.withLimits(ctx, tenant)
+	defer cancel()
+	ctx = withPartialResponseParam(ctx, r)
+
+	finished, apiErr := qapi.startQuery(tenant)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	defer finished()
+
+	ctx, done := qapi.activeQueries.Insert(ctx, "query", r.FormValue("query"), r.RemoteAddr, tenant)
+	defer done()
+
+	ctx, qs := parseQueryStatsParam(ctx, r)
+
 	maxSourceResolution, apiErr := qapi.parseDownsamplingParamMillis(r, qapi.defaultInstantQueryMaxSourceResolution)
 	if apiErr != nil {
 		return nil, nil, apiErr
@@ -273,7 +480,7 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 	span, ctx := tracing.StartSpan(ctx, "promql_instant_query")
 	defer span.Finish()
 
-	qry, err := qe.NewInstantQuery(qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, false), r.FormValue("query"), ts)
+	qry, err := qe.NewInstantQuery(qapi.tenancy.Queryable(tenant, qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, false)), r.FormValue("query"), ts)
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
@@ -286,8 +493,13 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 	}
 	defer qapi.gate.Done()
 
+	ctx, accounted := qapi.accountQuery(ctx, tenant)
 	res := qry.Exec(ctx)
+	accounted()
 	if res.Err != nil {
+		if query.IsLimitError(res.Err) {
+			return nil, nil, &api.ApiError{Typ: api.ErrorLimit, Err: res.Err}
+		}
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
 			return nil, nil, &api.ApiError{Typ: api.ErrorCanceled, Err: res.Err}
@@ -302,6 +514,7 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 	return &queryData{
 		ResultType: res.Value.Type(),
 		Result:     res.Value,
+		Stats:      newQueryStats(qry, qs),
 	}, res.Warnings, nil
 }
 
@@ -374,19 +587,45 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr
 	}
 
+	tenant, apiErr := qapi.parseTenant(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	ctx, cancel := qapi.withLimits(ctx, tenant)
+	defer cancel()
+	ctx = withPartialResponseParam(ctx, r)
+
+	finished, apiErr := qapi.startQuery(tenant)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	defer finished()
+
+	ctx, done := qapi.activeQueries.Insert(ctx, "query_range", r.FormValue("query"), r.RemoteAddr, tenant)
+	defer done()
+
+	ctx, qs := parseQueryStatsParam(ctx, r)
+
+	ctx, apiErr = parseShardParams(ctx, r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	qe := qapi.queryEngine(maxSourceResolution)
 
 	// We are starting promQL tracing span here, because we have no control over promQL code.
 	span, ctx := tracing.StartSpan(ctx, "promql_range_query")
 	defer span.Finish()
 
-	qry, err := qe.NewRangeQuery(
-		qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, false),
-		r.FormValue("query"),
-		start,
-		end,
-		step,
-	)
+	queryable := qapi.tenancy.Queryable(tenant, qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, false))
+
+	var qry promql.Query
+	if qapi.rangeQuerySplitInterval > 0 {
+		qry, err = query.NewSplitRangeQuery(qe, queryable, r.FormValue("query"), start, end, step, qapi.rangeQuerySplitInterval)
+	} else {
+		qry, err = qe.NewRangeQuery(queryable, r.FormValue("query"), start, end, step)
+	}
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
@@ -399,8 +638,13 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	}
 	defer qapi.gate.Done()
 
+	ctx, accounted := qapi.accountQuery(ctx, tenant)
 	res := qry.Exec(ctx)
+	accounted()
 	if res.Err != nil {
+		if query.IsLimitError(res.Err) {
+			return nil, nil, &api.ApiError{Typ: api.ErrorLimit, Err: res.Err}
+		}
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
 			return nil, nil, &api.ApiError{Typ: api.ErrorCanceled, Err: res.Err}
@@ -413,9 +657,124 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	return &queryData{
 		ResultType: res.Value.Type(),
 		Result:     res.Value,
+		Stats:      newQueryStats(qry, qs),
 	}, res.Warnings, nil
 }
 
+// queryExplain is the plan of a query: how its selects are fanned out to the StoreAPIs.
+type queryExplain struct {
+	Expr string `json:"expr"`
+	// MaxSourceResolution is the maximum resolution of the data of the query, in milliseconds.
+	MaxSourceResolution int64    `json:"maxSourceResolution"`
+	Deduplicate         bool     `json:"deduplicate"`
+	ReplicaLabels       []string `json:"replicaLabels"`
+	PartialResponse     bool     `json:"partialResponse"`
+	// SplitInterval is the interval the range query is evaluated by, if it is split.
+	SplitInterval string             `json:"splitInterval,omitempty"`
+	Selects       []query.SelectPlan `json:"selects"`
+}
+
+// queryExplain plans an instant query, or a range query if the start parameter is given, without fetching any data
+// from the StoreAPIs.
+func (qapi *QueryAPI) queryExplain(r *http.Request) (interface{}, []error, *api.ApiError) {
+	expr, err := parser.ParseExpr(r.FormValue("query"))
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+
+	enableDedup, apiErr := qapi.parseEnableDedupParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	replicaLabels, apiErr := qapi.parseReplicaLabelsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	storeDebugMatchers, apiErr := qapi.parseStoreDebugMatchersParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	tenant, apiErr := qapi.parseTenant(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	res := &queryExplain{Expr: expr.String(), PartialResponse: enablePartialResponse}
+	if enableDedup && len(replicaLabels) > 0 {
+		res.Deduplicate, res.ReplicaLabels = true, replicaLabels
+	}
+
+	plan := query.NewQueryPlan()
+	ctx := query.WithQueryPlan(r.Context(), plan)
+	queryable := func(maxSourceResolution int64) storage.Queryable {
+		return qapi.tenancy.Queryable(tenant, qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, false))
+	}
+
+	var qry promql.Query
+	if r.FormValue("start") == "" {
+		ts, err := parseTimeParam(r, "time", qapi.baseAPI.Now())
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		if res.MaxSourceResolution, apiErr = qapi.parseDownsamplingParamMillis(r, qapi.defaultInstantQueryMaxSourceResolution); apiErr != nil {
+			return nil, nil, apiErr
+		}
+		qry, err = qapi.queryEngine(res.MaxSourceResolution).NewInstantQuery(queryable(res.MaxSourceResolution), r.FormValue("query"), ts)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+	} else {
+		start, err := parseTime(r.FormValue("start"))
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		end, err := parseTime(r.FormValue("end"))
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		if end.Before(start) {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("end timestamp must not be before start time")}
+		}
+		step, err := parseDuration(r.FormValue("step"))
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "param step")}
+		}
+		if step <= 0 {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer")}
+		}
+		// Same default as for the range queries.
+		if res.MaxSourceResolution, apiErr = qapi.parseDownsamplingParamMillis(r, step/5); apiErr != nil {
+			return nil, nil, apiErr
+		}
+
+		qe := qapi.queryEngine(res.MaxSourceResolution)
+		if qapi.rangeQuerySplitInterval > 0 {
+			res.SplitInterval = qapi.rangeQuerySplitInterval.String()
+			qry, err = query.NewSplitRangeQuery(qe, queryable(res.MaxSourceResolution), r.FormValue("query"), start, end, step, qapi.rangeQuerySplitInterval)
+		} else {
+			qry, err = qe.NewRangeQuery(queryable(res.MaxSourceResolution), r.FormValue("query"), start, end, step)
+		}
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+	}
+
+	// The selects don't fetch any data, so the evaluation only plans them.
+	if err := qry.Exec(ctx).Err; err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
+	}
+	res.Selects = plan.Selects()
+	return res, nil, nil
+}
+
 func (qapi *QueryAPI) labelValues(r *http.Request) (interface{}, []error, *api.ApiError) {
 	ctx := r.Context()
 	name := route.Param(ctx, "name")
@@ -429,17 +788,41 @@ func (qapi *QueryAPI) labelValues(r *http.Request) (interface{}, []error, *api.A
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
 
+	matcherSets, apiErr := parseLabelMatcherSetsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
+	tenant, apiErr := qapi.parseTenant(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	ctx, cancel := qapi.withLimits(r.Context(), tenant)
+	defer cancel()
+	ctx = withPartialResponseParam(ctx, r)
+
+	finished, apiErr := qapi.startQuery(tenant)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	defer finished()
+
+	ctx, done := qapi.activeQueries.Insert(ctx, "label_values", name, r.RemoteAddr, tenant)
+	defer done()
+
 	storeDebugMatchers, apiErr := qapi.parseStoreDebugMatchersParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
-	q, err := qapi.queryableCreate(true, nil, storeDebugMatchers, 0, enablePartialResponse, false).
+	// Chunks are skipped, as only the labels of the series are needed.
+	q, err := qapi.tenancy.Queryable(tenant, qapi.queryableCreate(true, nil, storeDebugMatchers, 0, enablePartialResponse, true)).
 		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
@@ -448,9 +831,23 @@ func (qapi *QueryAPI) labelValues(r *http.Request) (interface{}, []error, *api.A
 
 	// TODO(fabxc): add back request context.
 
-	vals, warnings, err := q.LabelValues(name)
+	var (
+		vals     []string
+		warnings storage.Warnings
+	)
+	if len(matcherSets) > 0 {
+		lq, ok := q.(query.LabelMatchersQuerier)
+		if !ok {
+			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.New("querier does not support label matchers")}
+		}
+		vals, warnings, err = mergeLabelsWithMatchers(matcherSets, func(ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
+			return lq.LabelValuesWithMatchers(name, ms...)
+		})
+	} else {
+		vals, warnings, err = q.LabelValues(name)
+	}
 	if err != nil {
-		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
+		return nil, nil, &api.ApiError{Typ: execErrorType(err), Err: err}
 	}
 
 	if vals == nil {
@@ -503,8 +900,26 @@ func (qapi *QueryAPI) series(r *http.Request) (interface{}, []error, *api.ApiErr
 		return nil, nil, apiErr
 	}
 
-	q, err := qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, math.MaxInt64, enablePartialResponse, true).
-		Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
+	tenant, apiErr := qapi.parseTenant(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	ctx, cancel := qapi.withLimits(r.Context(), tenant)
+	defer cancel()
+	ctx = withPartialResponseParam(ctx, r)
+
+	finished, apiErr := qapi.startQuery(tenant)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	defer finished()
+
+	ctx, done := qapi.activeQueries.Insert(ctx, "series", strings.Join(r.Form[MatcherParam], ", "), r.RemoteAddr, tenant)
+	defer done()
+
+	q, err := qapi.tenancy.Queryable(tenant, qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, math.MaxInt64, enablePartialResponse, true)).
+		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
 	}
@@ -523,7 +938,7 @@ func (qapi *QueryAPI) series(r *http.Request) (interface{}, []error, *api.ApiErr
 		metrics = append(metrics, set.At().Labels())
 	}
 	if set.Err() != nil {
-		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: set.Err()}
+		return nil, nil, &api.ApiError{Typ: execErrorType(set.Err()), Err: set.Err()}
 	}
 	return metrics, set.Warnings(), nil
 }
@@ -534,26 +949,62 @@ func (qapi *QueryAPI) labelNames(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
 
+	matcherSets, apiErr := parseLabelMatcherSetsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
+	tenant, apiErr := qapi.parseTenant(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	ctx, cancel := qapi.withLimits(r.Context(), tenant)
+	defer cancel()
+	ctx = withPartialResponseParam(ctx, r)
+
+	finished, apiErr := qapi.startQuery(tenant)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	defer finished()
+
+	ctx, done := qapi.activeQueries.Insert(ctx, "label_names", "", r.RemoteAddr, tenant)
+	defer done()
+
 	storeDebugMatchers, apiErr := qapi.parseStoreDebugMatchersParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
-	q, err := qapi.queryableCreate(true, nil, storeDebugMatchers, 0, enablePartialResponse, false).
-		Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
+	// Chunks are skipped, as only the labels of the series are needed.
+	q, err := qapi.tenancy.Queryable(tenant, qapi.queryableCreate(true, nil, storeDebugMatchers, 0, enablePartialResponse, true)).
+		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
 	}
 	defer runutil.CloseWithLogOnErr(qapi.logger, q, "queryable labelNames")
 
-	names, warnings, err := q.LabelNames()
+	var (
+		names    []string
+		warnings storage.Warnings
+	)
+	if len(matcherSets) > 0 {
+		lq, ok := q.(query.LabelMatchersQuerier)
+		if !ok {
+			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.New("querier does not support label matchers")}
+		}
+		names, warnings, err = mergeLabelsWithMatchers(matcherSets, lq.LabelNamesWithMatchers)
+	} else {
+		names, warnings, err = q.LabelNames()
+	}
 	if err != nil {
-		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
+		return nil, nil, &api.ApiError{Typ: execErrorType(err), Err: err}
 	}
 	if names == nil {
 		names = make([]string, 0)
@@ -562,6 +1013,41 @@ func (qapi *QueryAPI) labelNames(r *http.Request) (interface{}, []error, *api.Ap
 	return names, warnings, nil
 }
 
+// parseLabelMatcherSetsParam parses the optional match[] parameters of the label names and values requests.
+func parseLabelMatcherSetsParam(r *http.Request) ([][]*labels.Matcher, *api.ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "parse form")}
+	}
+
+	var matcherSets [][]*labels.Matcher
+	for _, s := range r.Form[MatcherParam] {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+	return matcherSets, nil
+}
+
+// mergeLabelsWithMatchers returns the sorted union of the label names or values returned by f for each of the
+// matcher sets.
+func mergeLabelsWithMatchers(matcherSets [][]*labels.Matcher, f func(...*labels.Matcher) ([]string, storage.Warnings, error)) ([]string, storage.Warnings, error) {
+	var (
+		sets     [][]string
+		warnings storage.Warnings
+	)
+	for _, ms := range matcherSets {
+		vals, warns, err := f(ms...)
+		if err != nil {
+			return nil, nil, err
+		}
+		sets = append(sets, vals)
+		warnings = append(warnings, warns...)
+	}
+	return strutil.MergeSlices(sets...), warnings, nil
+}
+
 func (qapi *QueryAPI) stores(r *http.Request) (interface{}, []error, *api.ApiError) {
 	statuses := make(map[string][]query.StoreStatus)
 	for _, status := range qapi.storeSet.GetStoreStatus() {
@@ -570,14 +1056,72 @@ func (qapi *QueryAPI) stores(r *http.Request) (interface{}, []error, *api.ApiErr
 	return statuses, nil, nil
 }
 
+func (qapi *QueryAPI) parseStoreAddrParam(r *http.Request) (string, *api.ApiError) {
+	if !qapi.enableStoreAdminAPI {
+		return "", &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("store admin API is disabled")}
+	}
+
+	addr := r.FormValue("addr")
+	if addr == "" {
+		return "", &api.ApiError{Typ: api.ErrorBadData, Err: errors.New("store address cannot be empty")}
+	}
+	return addr, nil
+}
+
+func (qapi *QueryAPI) addStore(r *http.Request) (interface{}, []error, *api.ApiError) {
+	addr, apiErr := qapi.parseStoreAddrParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if err := qapi.storeSet.AddStore(addr); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+	level.Info(qapi.logger).Log("msg", "added store at runtime", "address", addr)
+	return nil, nil, nil
+}
+
+func (qapi *QueryAPI) removeStore(r *http.Request) (interface{}, []error, *api.ApiError) {
+	addr, apiErr := qapi.parseStoreAddrParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if err := qapi.storeSet.RemoveStore(addr); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+	level.Info(qapi.logger).Log("msg", "removed store added at runtime", "address", addr)
+	return nil, nil, nil
+}
+
+func (qapi *QueryAPI) drainStore(drain bool) api.ApiFunc {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		addr, apiErr := qapi.parseStoreAddrParam(r)
+		if apiErr != nil {
+			return nil, nil, apiErr
+		}
+		if err := qapi.storeSet.DrainStore(addr, drain); err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		level.Info(qapi.logger).Log("msg", "changed store drain state", "address", addr, "drained", drain)
+		return nil, nil, nil
+	}
+}
+
+// statusActiveQueries lists the active queries, only the ones of the tenant of the request if tenancy is enforced.
+func (qapi *QueryAPI) statusActiveQueries(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if !qapi.tenancy.Enabled() {
+		return qapi.activeQueries.List(), nil, nil
+	}
+
+	tenant, apiErr := qapi.parseTenant(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	return qapi.activeQueries.ListTenant(tenant), nil, nil
+}
+
 // NewRulesHandler created handler compatible with HTTP /api/v1/rules https://prometheus.io/docs/prometheus/latest/querying/api/#rules
 // which uses gRPC Unary Rules API.
 func NewRulesHandler(client rules.UnaryClient, enablePartialResponse bool) func(*http.Request) (interface{}, []error, *api.ApiError) {
-	ps := storepb.PartialResponseStrategy_ABORT
-	if enablePartialResponse {
-		ps = storepb.PartialResponseStrategy_WARN
-	}
-
 	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
 		typeParam := r.URL.Query().Get("type")
 		typ, ok := rulespb.RulesRequest_Type_value[strings.ToUpper(typeParam)]
@@ -588,7 +1132,12 @@ func NewRulesHandler(client rules.UnaryClient, enablePartialResponse bool) func(
 			typ = int32(rulespb.RulesRequest_ALL)
 		}
 
-		// TODO(bwplotka): Allow exactly the same functionality as query API: passing replica, dedup and partial response as HTTP params as well.
+		ps, apiErr := parsePartialResponseStrategy(r, enablePartialResponse)
+		if apiErr != nil {
+			return nil, nil, apiErr
+		}
+
+		// TODO(bwplotka): Allow exactly the same functionality as query API: passing replica and dedup as HTTP params as well.
 		req := &rulespb.RulesRequest{
 			Type:                    rulespb.RulesRequest_Type(typ),
 			PartialResponseStrategy: ps,
@@ -601,6 +1150,135 @@ func NewRulesHandler(client rules.UnaryClient, enablePartialResponse bool) func(
 	}
 }
 
+// alertDiscovery is the response of the HTTP /api/v1/alerts endpoint.
+type alertDiscovery struct {
+	Alerts []*rulespb.AlertInstance `json:"alerts"`
+}
+
+// NewAlertsHandler created handler compatible with HTTP /api/v1/alerts https://prometheus.io/docs/prometheus/latest/querying/api/#alerts
+// which uses gRPC Unary Rules API. The alerts are the ones of the deduplicated alerting rules, labeled with the
+// labels of their rules they do not have, e.g. the external labels.
+func NewAlertsHandler(client rules.UnaryClient, enablePartialResponse bool) func(*http.Request) (interface{}, []error, *api.ApiError) {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		ps, apiErr := parsePartialResponseStrategy(r, enablePartialResponse)
+		if apiErr != nil {
+			return nil, nil, apiErr
+		}
+
+		req := &rulespb.RulesRequest{
+			Type:                    rulespb.RulesRequest_ALERT,
+			PartialResponseStrategy: ps,
+		}
+		groups, warnings, err := client.Rules(r.Context(), req)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Errorf("error retrieving alerts: %v", err)}
+		}
+
+		res := alertDiscovery{Alerts: []*rulespb.AlertInstance{}}
+		for _, g := range groups.Groups {
+			for _, rule := range g.Rules {
+				a := rule.GetAlert()
+				if a == nil {
+					continue
+				}
+				for _, inst := range a.Alerts {
+					lset := inst.Labels.PromLabels()
+					for _, l := range a.Labels.PromLabels() {
+						// The labels of the rule are templates, the ones the alert has are already expanded.
+						if !lset.Has(l.Name) {
+							lset = append(lset, l)
+						}
+					}
+					sort.Sort(lset)
+					inst.Labels = labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(lset)}
+					res.Alerts = append(res.Alerts, inst)
+				}
+			}
+		}
+		return res, warnings, nil
+	}
+}
+
+// NewTargetsHandler created handler compatible with HTTP /api/v1/targets https://prometheus.io/docs/prometheus/latest/querying/api/#targets
+// which uses gRPC Unary Targets API.
+func NewTargetsHandler(client targets.UnaryClient, enablePartialResponse bool) func(*http.Request) (interface{}, []error, *api.ApiError) {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		stateParam := r.URL.Query().Get("state")
+		state, ok := targetspb.TargetsRequest_State_value[strings.ToUpper(stateParam)]
+		if !ok {
+			if stateParam != "" {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid targets parameter state='%v'", stateParam)}
+			}
+			state = int32(targetspb.TargetsRequest_ANY)
+		}
+
+		ps, apiErr := parsePartialResponseStrategy(r, enablePartialResponse)
+		if apiErr != nil {
+			return nil, nil, apiErr
+		}
+
+		req := &targetspb.TargetsRequest{
+			State:                   targetspb.TargetsRequest_State(state),
+			PartialResponseStrategy: ps,
+		}
+		t, warnings, err := client.Targets(r.Context(), req)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Errorf("error retrieving targets: %v", err)}
+		}
+		return t, warnings, nil
+	}
+}
+
+// NewMetricMetadataHandler created handler compatible with HTTP /api/v1/metadata https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+// which uses gRPC Unary Metadata API.
+func NewMetricMetadataHandler(client metadata.UnaryClient, enablePartialResponse bool) func(*http.Request) (interface{}, []error, *api.ApiError) {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		ps, apiErr := parsePartialResponseStrategy(r, enablePartialResponse)
+		if apiErr != nil {
+			return nil, nil, apiErr
+		}
+
+		req := &metadatapb.MetadataRequest{
+			// By default we use -1, which means no limit.
+			Limit:                   -1,
+			Metric:                  r.URL.Query().Get("metric"),
+			PartialResponseStrategy: ps,
+		}
+
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			limit, err := strconv.ParseInt(limitStr, 10, 32)
+			if err != nil {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("invalid metric metadata limit='%v'", limitStr)}
+			}
+			req.Limit = int32(limit)
+		}
+
+		md, warnings, err := client.Metadata(r.Context(), req)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "retrieving metadata")}
+		}
+		return md, warnings, nil
+	}
+}
+
+// parsePartialResponseStrategy returns the partial response strategy of the request, given by its partial_response
+// parameter if any.
+func parsePartialResponseStrategy(r *http.Request, enablePartialResponse bool) (storepb.PartialResponseStrategy, *api.ApiError) {
+	// Overwrite the cli flag when provided as a query parameter.
+	partialResponse := enablePartialResponse
+	if val := r.FormValue(PartialResponseParam); val != "" {
+		var err error
+		partialResponse, err = strconv.ParseBool(val)
+		if err != nil {
+			return 0, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", PartialResponseParam)}
+		}
+	}
+	if partialResponse {
+		return storepb.PartialResponseStrategy_WARN, nil
+	}
+	return storepb.PartialResponseStrategy_ABORT, nil
+}
+
 var (
 	infMinTime = time.Unix(math.MinInt64/1000+62135596801, 0)
 	infMaxTime = time.Unix(math.MaxInt64/1000-62135596801, 999999999)
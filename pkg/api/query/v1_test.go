@@ -25,6 +25,7 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
@@ -48,11 +49,13 @@ import (
 	baseAPI "github.com/thanos-io/thanos/pkg/api"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 	"github.com/thanos-io/thanos/pkg/testutil/testpromcompatibility"
@@ -180,7 +183,7 @@ func TestQueryEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), 2, timeout, query.DedupFuncPenalty, 0, ""),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -674,7 +677,7 @@ func TestMetadataEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), 2, timeout, query.DedupFuncPenalty, 0, ""),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -684,7 +687,7 @@ func TestMetadataEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, nil, db, component.Query, nil), 2, timeout, query.DedupFuncPenalty, 0, ""),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -803,6 +806,71 @@ func TestMetadataEndpoints(t *testing.T) {
 			},
 			errType: baseAPI.ErrorBadData,
 		},
+		// Label values and names of the series matching any of the match[] parameters.
+		{
+			endpoint: api.labelValues,
+			query: url.Values{
+				"match[]": []string{`test_metric2`},
+			},
+			params: map[string]string{
+				"name": "foo",
+			},
+			response: []string{
+				"boo",
+			},
+		},
+		{
+			endpoint: api.labelValues,
+			query: url.Values{
+				"match[]": []string{`test_metric1{foo="bar"}`, `test_metric_replica2`},
+			},
+			params: map[string]string{
+				"name": "foo",
+			},
+			response: []string{
+				"bar",
+				"boo",
+			},
+		},
+		{
+			endpoint: apiWithLabelLookback.labelValues,
+			query: url.Values{
+				"match[]": []string{`test_metric2`},
+			},
+			params: map[string]string{
+				"name": "foo",
+			},
+			response: []string{},
+		},
+		{
+			endpoint: api.labelNames,
+			query: url.Values{
+				"match[]": []string{`test_metric2`},
+			},
+			response: []string{
+				"__name__",
+				"foo",
+			},
+		},
+		{
+			endpoint: api.labelNames,
+			query: url.Values{
+				"match[]": []string{`test_metric_replica1`, `test_metric_replica2`},
+			},
+			response: []string{
+				"__name__",
+				"foo",
+				"replica",
+				"replica1",
+			},
+		},
+		{
+			endpoint: api.labelNames,
+			query: url.Values{
+				"match[]": []string{`{foo=}`},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
 		{
 			endpoint: api.series,
 			query: url.Values{
@@ -1082,6 +1150,167 @@ func TestMetadataEndpoints(t *testing.T) {
 	}
 }
 
+type planClient struct {
+	storepb.StoreClient
+	addr      string
+	labelSets []labels.Labels
+}
+
+func (c *planClient) LabelSets() []labels.Labels { return c.labelSets }
+func (c *planClient) TimeRange() (int64, int64)  { return 0, math.MaxInt64 }
+func (c *planClient) LabelMatchers() bool        { return true }
+func (c *planClient) String() string             { return c.addr }
+func (c *planClient) Addr() string               { return c.addr }
+
+func TestQueryExplainEndpoint(t *testing.T) {
+	clients := []store.Client{
+		&planClient{addr: "sidecar-eu:10901", labelSets: []labels.Labels{labels.FromStrings("region", "eu")}},
+		&planClient{addr: "sidecar-us:10901", labelSets: []labels.Labels{labels.FromStrings("region", "us")}},
+	}
+	proxy := store.NewProxyStore(nil, nil, func() []store.Client { return clients }, component.Query, nil, 0, nil)
+	qe := promql.NewEngine(promql.EngineOpts{MaxSamples: 10000, Timeout: time.Minute})
+	api := &QueryAPI{
+		baseAPI:         &baseAPI.BaseAPI{Now: time.Now},
+		queryableCreate: query.NewQueryableCreator(nil, nil, proxy, 2, time.Minute, query.DedupFuncPenalty, 0, ""),
+		queryEngine:     func(int64) *promql.Engine { return qe },
+		replicaLabels:   []string{"replica"},
+	}
+
+	stores := []store.StorePlan{
+		{Store: "sidecar-eu:10901", Queried: true},
+		{Store: "sidecar-us:10901", Reason: "label sets of the store do not match the matchers"},
+	}
+	for i, test := range []endpointTestCase{
+		{endpoint: api.queryExplain, query: url.Values{"query": []string{"rate(x{"}}, errType: baseAPI.ErrorBadData},
+		{
+			endpoint: api.queryExplain,
+			query:    url.Values{"query": []string{`sum by (job) (http_requests_total{region="eu"} offset 5m)`}, "time": []string{"600"}},
+			response: &queryExplain{
+				Expr:          `sum by(job) (http_requests_total{region="eu"} offset 5m)`,
+				Deduplicate:   true,
+				ReplicaLabels: []string{"replica"},
+				Selects: []query.SelectPlan{{
+					Matchers:    `{region="eu", __name__="http_requests_total"}`,
+					MinTime:     0,
+					MaxTime:     300000,
+					Aggregates:  []string{"COUNT", "SUM"},
+					Func:        "sum",
+					Grouping:    []string{"job"},
+					By:          true,
+					Deduplicate: true,
+					Proxy:       &store.SeriesPlan{Matchers: `{region="eu", __name__="http_requests_total"}`, Stores: stores},
+				}},
+			},
+		},
+		{
+			endpoint: api.queryExplain,
+			query: url.Values{
+				"query":                 []string{`up`},
+				"start":                 []string{"0"},
+				"end":                   []string{"3600"},
+				"step":                  []string{"60"},
+				"dedup":                 []string{"false"},
+				"partial_response":      []string{"true"},
+				"max_source_resolution": []string{"5m"},
+			},
+			response: &queryExplain{
+				Expr:                "up",
+				MaxSourceResolution: 300000,
+				PartialResponse:     true,
+				Selects: []query.SelectPlan{{
+					Matchers:            `{__name__="up"}`,
+					MinTime:             -300000,
+					MaxTime:             3600000,
+					MaxResolutionWindow: 300000,
+					Aggregates:          []string{"COUNT", "SUM"},
+					StepMillis:          60000,
+					PartialResponse:     true,
+					Proxy: &store.SeriesPlan{Matchers: `{__name__="up"}`, Stores: []store.StorePlan{
+						{Store: "sidecar-eu:10901", Queried: true},
+						{Store: "sidecar-us:10901", Queried: true},
+					}},
+				}},
+			},
+		},
+	} {
+		if ok := testEndpoint(t, test, fmt.Sprintf("#%d", i)); !ok {
+			return
+		}
+	}
+}
+
+func TestStoreAdminEndpoints(t *testing.T) {
+	storeSet := query.NewStoreSet(nil, nil, func() []query.StoreSpec {
+		return []query.StoreSpec{query.NewGRPCStoreSpec("127.0.0.1:10901", false)}
+	}, nil, nil, nil, nil, time.Minute)
+	defer storeSet.Close()
+
+	api := &QueryAPI{
+		baseAPI:             &baseAPI.BaseAPI{Now: time.Now},
+		logger:              log.NewNopLogger(),
+		storeSet:            storeSet,
+		enableStoreAdminAPI: true,
+	}
+	disabledAPI := &QueryAPI{
+		baseAPI:  &baseAPI.BaseAPI{Now: time.Now},
+		logger:   log.NewNopLogger(),
+		storeSet: storeSet,
+	}
+
+	addr := url.Values{"addr": []string{"127.0.0.1:10902"}}
+	for i, test := range []endpointTestCase{
+		{endpoint: disabledAPI.addStore, query: addr, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+		{endpoint: api.addStore, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+		// Statically defined stores cannot be added.
+		{endpoint: api.addStore, query: url.Values{"addr": []string{"127.0.0.1:10901"}}, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+		{endpoint: api.addStore, query: addr, method: http.MethodPost},
+		{endpoint: api.addStore, query: addr, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+		// The store is not active yet.
+		{endpoint: api.drainStore(true), query: addr, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+		{endpoint: api.drainStore(false), query: addr, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+		{endpoint: disabledAPI.removeStore, query: addr, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+		{endpoint: api.removeStore, query: addr, method: http.MethodPost},
+		{endpoint: api.removeStore, query: addr, method: http.MethodPost, errType: baseAPI.ErrorBadData},
+	} {
+		if ok := testEndpoint(t, test, fmt.Sprintf("#%d", i)); !ok {
+			return
+		}
+	}
+}
+
+func TestTenancyEndpoints(t *testing.T) {
+	tenancy, err := query.NewTenancy(query.DefaultTenantHeader, "", query.DefaultTenantLabel)
+	testutil.Ok(t, err)
+	activeQueries, err := query.NewActiveQueries(log.NewNopLogger(), "", 0)
+	testutil.Ok(t, err)
+	_, finishA := activeQueries.Insert(context.Background(), "query", "up", "", "team-a")
+	defer finishA()
+	_, finishB := activeQueries.Insert(context.Background(), "query", "up", "", "team-b")
+	defer finishB()
+
+	api := &QueryAPI{
+		baseAPI:       &baseAPI.BaseAPI{Now: time.Now},
+		logger:        log.NewNopLogger(),
+		tenancy:       tenancy,
+		activeQueries: activeQueries,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/status/active_queries", nil)
+	_, _, apiErr := api.statusActiveQueries(req)
+	testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected requests without tenant to be rejected")
+
+	req.Header.Set(query.DefaultTenantHeader, "team-b")
+	res, _, apiErr := api.statusActiveQueries(req)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	queries := res.([]query.ActiveQuery)
+	testutil.Equals(t, 1, len(queries))
+	testutil.Equals(t, "team-b", queries[0].Tenant)
+
+	// Endpoints not scoped to tenants are rejected.
+	_, _, apiErr = api.withoutTenancy(NewTargetsHandler(nil, false))(req)
+	testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected the request to be rejected")
+}
+
 func TestParseTime(t *testing.T) {
 	ts, err := time.Parse(time.RFC3339Nano, "2015-06-03T13:21:58.555Z")
 	if err != nil {
@@ -1590,6 +1819,145 @@ func TestRulesHandler(t *testing.T) {
 	}
 }
 
+func TestRulesHandler_PartialResponseParam(t *testing.T) {
+	for _, tc := range []struct {
+		param                 string
+		enablePartialResponse bool
+		expected              storepb.PartialResponseStrategy
+		fail                  bool
+	}{
+		{enablePartialResponse: false, expected: storepb.PartialResponseStrategy_ABORT},
+		{enablePartialResponse: true, expected: storepb.PartialResponseStrategy_WARN},
+		{param: "true", enablePartialResponse: false, expected: storepb.PartialResponseStrategy_WARN},
+		{param: "false", enablePartialResponse: true, expected: storepb.PartialResponseStrategy_ABORT},
+		{param: "maybe", fail: true},
+	} {
+		t.Run(fmt.Sprintf("param=%q/default=%v", tc.param, tc.enablePartialResponse), func(t *testing.T) {
+			client := &strategyRulesClient{}
+			endpoint := NewRulesHandler(client, tc.enablePartialResponse)
+
+			v := url.Values{}
+			if tc.param != "" {
+				v.Set(PartialResponseParam, tc.param)
+			}
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com?%s", v.Encode()), nil)
+			testutil.Ok(t, err)
+
+			_, _, apiErr := endpoint(req)
+			if tc.fail {
+				testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected bad data error, got %v", apiErr)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+			testutil.Equals(t, tc.expected, client.strategy)
+		})
+	}
+}
+
+func TestAlertsHandler(t *testing.T) {
+	activeAt := time.Unix(100, 0)
+	client := mockedRulesClient{g: map[rulespb.RulesRequest_Type][]*rulespb.RuleGroup{
+		rulespb.RulesRequest_ALERT: {
+			{
+				Name: "grp",
+				Rules: []*rulespb.Rule{
+					rulespb.NewAlertingRule(&rulespb.Alert{
+						Name:   "InstanceDown",
+						State:  rulespb.AlertState_FIRING,
+						Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "cluster", Value: "eu"}, {Name: "severity", Value: "{{ $labels.sev }}"}}},
+						Alerts: []*rulespb.AlertInstance{
+							{
+								Labels:   labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "alertname", Value: "InstanceDown"}, {Name: "severity", Value: "page"}}},
+								State:    rulespb.AlertState_FIRING,
+								ActiveAt: &activeAt,
+								Value:    "1",
+							},
+						},
+					}),
+					rulespb.NewAlertingRule(&rulespb.Alert{Name: "NoAlerts"}),
+				},
+			},
+		},
+	}}
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	testutil.Ok(t, err)
+	res, warnings, apiErr := NewAlertsHandler(client, false)(req)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	testutil.Equals(t, 0, len(warnings))
+
+	b, err := json.Marshal(res)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"alerts":[{"labels":{"alertname":"InstanceDown","cluster":"eu","severity":"page"},"annotations":{},`+
+		`"state":"firing","activeAt":"`+activeAt.Format(time.RFC3339Nano)+`","value":"1","partialResponseStrategy":"WARN"}]}`, string(b))
+}
+
+func TestTargetsHandler(t *testing.T) {
+	for _, tc := range []struct {
+		state    string
+		expected targetspb.TargetsRequest_State
+		fail     bool
+	}{
+		{expected: targetspb.TargetsRequest_ANY},
+		{state: "active", expected: targetspb.TargetsRequest_ACTIVE},
+		{state: "Dropped", expected: targetspb.TargetsRequest_DROPPED},
+		{state: "some", fail: true},
+	} {
+		t.Run(tc.state, func(t *testing.T) {
+			client := &mockedTargetsClient{}
+			endpoint := NewTargetsHandler(client, true)
+
+			v := url.Values{}
+			if tc.state != "" {
+				v.Set("state", tc.state)
+			}
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com?%s", v.Encode()), nil)
+			testutil.Ok(t, err)
+
+			res, _, apiErr := endpoint(req)
+			if tc.fail {
+				testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected bad data error, got %v", apiErr)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+			testutil.Equals(t, &targetspb.TargetsRequest{State: tc.expected, PartialResponseStrategy: storepb.PartialResponseStrategy_WARN}, client.req)
+
+			b, err := json.Marshal(res)
+			testutil.Ok(t, err)
+			testutil.Equals(t, `{"activeTargets":[],"droppedTargets":[]}`, string(b))
+		})
+	}
+}
+
+func TestMetricMetadataHandler(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		expected *metadatapb.MetadataRequest
+		fail     bool
+	}{
+		{expected: &metadatapb.MetadataRequest{Limit: -1, PartialResponseStrategy: storepb.PartialResponseStrategy_WARN}},
+		{query: "metric=up&limit=3", expected: &metadatapb.MetadataRequest{Metric: "up", Limit: 3, PartialResponseStrategy: storepb.PartialResponseStrategy_WARN}},
+		{query: "partial_response=false", expected: &metadatapb.MetadataRequest{Limit: -1, PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT}},
+		{query: "limit=a", fail: true},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			client := &mockedMetadataClient{}
+			endpoint := NewMetricMetadataHandler(client, true)
+
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com?%s", tc.query), nil)
+			testutil.Ok(t, err)
+
+			_, _, apiErr := endpoint(req)
+			if tc.fail {
+				testutil.Assert(t, apiErr != nil && apiErr.Typ == baseAPI.ErrorBadData, "expected bad data error, got %v", apiErr)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+			testutil.Equals(t, tc.expected, client.req)
+		})
+	}
+}
+
 func BenchmarkQueryResultEncoding(b *testing.B) {
 	var mat promql.Matrix
 	for i := 0; i < 1000; i++ {
@@ -1634,6 +2002,36 @@ func (c mockedRulesClient) Rules(_ context.Context, req *rulespb.RulesRequest) (
 	return &rulespb.RuleGroups{Groups: c.g[req.Type]}, c.w, c.err
 }
 
+// strategyRulesClient records the partial response strategy of the requests.
+type strategyRulesClient struct {
+	strategy storepb.PartialResponseStrategy
+}
+
+func (c *strategyRulesClient) Rules(_ context.Context, req *rulespb.RulesRequest) (*rulespb.RuleGroups, storage.Warnings, error) {
+	c.strategy = req.PartialResponseStrategy
+	return &rulespb.RuleGroups{}, nil, nil
+}
+
+// mockedTargetsClient records the targets requests.
+type mockedTargetsClient struct {
+	req *targetspb.TargetsRequest
+}
+
+func (c *mockedTargetsClient) Targets(_ context.Context, req *targetspb.TargetsRequest) (*targetspb.TargetDiscovery, storage.Warnings, error) {
+	c.req = req
+	return &targetspb.TargetDiscovery{}, nil, nil
+}
+
+// mockedMetadataClient records the metadata requests.
+type mockedMetadataClient struct {
+	req *metadatapb.MetadataRequest
+}
+
+func (c *mockedMetadataClient) Metadata(_ context.Context, req *metadatapb.MetadataRequest) (*metadatapb.MetricMetadata, storage.Warnings, error) {
+	c.req = req
+	return &metadatapb.MetricMetadata{}, nil, nil
+}
+
 type sample struct {
 	t int64
 	v float64
@@ -0,0 +1,59 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/common/route"
+	"github.com/thanos-io/thanos/pkg/api"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/receive"
+)
+
+// ReceiveAPI is a very simple API exposing the state of the TSDBs of Thanos Receive.
+type ReceiveAPI struct {
+	baseAPI      *api.BaseAPI
+	logger       log.Logger
+	activeSeries *receive.ActiveSeries
+
+	now func() time.Time
+}
+
+// NewReceiveAPI creates a simple API exposing the given active series of the TSDBs, if not nil.
+func NewReceiveAPI(logger log.Logger, activeSeries *receive.ActiveSeries, flagsMap map[string]string) *ReceiveAPI {
+	return &ReceiveAPI{
+		baseAPI:      api.NewBaseAPI(logger, flagsMap),
+		logger:       logger,
+		activeSeries: activeSeries,
+		now:          time.Now,
+	}
+}
+
+func (rapi *ReceiveAPI) Register(r *route.Router, tracer opentracing.Tracer, logger log.Logger, ins extpromhttp.InstrumentationMiddleware, logMiddleware *logging.HTTPServerMiddleware) {
+	rapi.baseAPI.Register(r, tracer, logger, ins, logMiddleware)
+
+	instr := api.GetInstr(tracer, logger, ins, logMiddleware)
+
+	if rapi.activeSeries != nil {
+		r.Get("/active_series", instr("active_series", rapi.activeSeriesStatus))
+	}
+}
+
+func (rapi *ReceiveAPI) activeSeriesStatus(r *http.Request) (interface{}, []error, *api.ApiError) {
+	tenants := rapi.activeSeries.Tenants(rapi.now())
+	if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		for _, t := range tenants {
+			if t.Tenant == tenant {
+				return []receive.TenantActiveSeries{t}, nil, nil
+			}
+		}
+		return []receive.TenantActiveSeries{}, nil, nil
+	}
+	return tenants, nil, nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package v1
+
+import (
+	"context"
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/route"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/api"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/logging"
+	"github.com/thanos-io/thanos/pkg/rules"
+)
+
+// TenantToken is a bearer token allowed to manage the rule groups of a single tenant.
+type TenantToken struct {
+	Tenant string `yaml:"tenant"`
+	Token  string `yaml:"token"`
+}
+
+// ParseTenantTokens parses and validates the YAML list of the tenant tokens.
+func ParseTenantTokens(b []byte) ([]TenantToken, error) {
+	var tokens []TenantToken
+	if err := yaml.UnmarshalStrict(b, &tokens); err != nil {
+		return nil, errors.Wrap(err, "parsing YAML content")
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("no tenant token configured")
+	}
+	seen := map[string]struct{}{}
+	for i, t := range tokens {
+		if t.Tenant == "" {
+			return nil, errors.Errorf("no tenant for token %d", i)
+		}
+		if t.Token == "" {
+			return nil, errors.Errorf("no token for tenant %s", t.Tenant)
+		}
+		if _, ok := seen[t.Token]; ok {
+			return nil, errors.Errorf("token of tenant %s already used by another tenant", t.Tenant)
+		}
+		seen[t.Token] = struct{}{}
+	}
+	return tokens, nil
+}
+
+type ctxKey int
+
+const tenantKey = ctxKey(0)
+
+// RuleStorageAPI manages the rule groups of the tenants stored in the bucket of Thanos Ruler. The requests have to be
+// authenticated with the bearer token of a tenant, and can only manage the rule groups of this tenant.
+type RuleStorageAPI struct {
+	logger  log.Logger
+	storage *rules.Storage
+	reload  func() error
+	tokens  []TenantToken
+}
+
+// NewRuleStorageAPI creates a Thanos Ruler API managing the rule groups in the given storage, and calling reload after
+// every change for the ruler to evaluate the new rule groups.
+func NewRuleStorageAPI(
+	logger log.Logger,
+	storage *rules.Storage,
+	reload func() error,
+	tokens []TenantToken,
+) *RuleStorageAPI {
+	return &RuleStorageAPI{
+		logger:  logger,
+		storage: storage,
+		reload:  reload,
+		tokens:  tokens,
+	}
+}
+
+func (rapi *RuleStorageAPI) Register(r *route.Router, tracer opentracing.Tracer, logger log.Logger, ins extpromhttp.InstrumentationMiddleware, logMiddleware *logging.HTTPServerMiddleware) {
+	instr := api.GetInstr(tracer, logger, ins, logMiddleware)
+
+	r.Get("/rules/config", instr("rules_config", rapi.authenticated(rapi.namespaces)))
+	r.Get("/rules/config/:namespace", instr("rules_config_namespace", rapi.authenticated(rapi.namespace)))
+	r.Post("/rules/config/:namespace", instr("rules_config_set_group", rapi.authenticated(rapi.setGroup)))
+	r.Del("/rules/config/:namespace", instr("rules_config_delete_namespace", rapi.authenticated(rapi.deleteNamespace)))
+	r.Get("/rules/config/:namespace/:group", instr("rules_config_group", rapi.authenticated(rapi.group)))
+	r.Del("/rules/config/:namespace/:group", instr("rules_config_delete_group", rapi.authenticated(rapi.deleteGroup)))
+}
+
+// authenticated rejects the requests without the bearer token of a tenant, and sets the tenant of the others.
+func (rapi *RuleStorageAPI) authenticated(f api.ApiFunc) api.ApiFunc {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		tenant := ""
+		// All the tokens are compared, for the time taken not to tell which one matched.
+		for _, t := range rapi.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+				tenant = t.Tenant
+			}
+		}
+		if token == "" || tenant == "" {
+			return nil, nil, &api.ApiError{Typ: api.ErrorAuth, Err: errors.New("invalid bearer token")}
+		}
+		return f(r.WithContext(context.WithValue(r.Context(), tenantKey, tenant)))
+	}
+}
+
+func (rapi *RuleStorageAPI) tenant(r *http.Request) string {
+	return r.Context().Value(tenantKey).(string)
+}
+
+func (rapi *RuleStorageAPI) namespaces(r *http.Request) (interface{}, []error, *api.ApiError) {
+	namespaces, err := rapi.storage.Namespaces(r.Context(), rapi.tenant(r))
+	if err != nil {
+		return nil, nil, storageError(err)
+	}
+	return struct {
+		Namespaces []string `json:"namespaces"`
+	}{Namespaces: namespaces}, nil, nil
+}
+
+func (rapi *RuleStorageAPI) namespace(r *http.Request) (interface{}, []error, *api.ApiError) {
+	groups, err := rapi.storage.Namespace(r.Context(), rapi.tenant(r), route.Param(r.Context(), "namespace"))
+	if err != nil {
+		return nil, nil, storageError(err)
+	}
+	return struct {
+		Groups []map[string]interface{} `json:"groups"`
+	}{Groups: groups}, nil, nil
+}
+
+func (rapi *RuleStorageAPI) group(r *http.Request) (interface{}, []error, *api.ApiError) {
+	group, err := rapi.storage.Group(r.Context(), rapi.tenant(r), route.Param(r.Context(), "namespace"), route.Param(r.Context(), "group"))
+	if err != nil {
+		return nil, nil, storageError(err)
+	}
+	return group, nil, nil
+}
+
+func (rapi *RuleStorageAPI) setGroup(r *http.Request) (interface{}, []error, *api.ApiError) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "read rule group")}
+	}
+	if err := rapi.storage.SetGroup(r.Context(), rapi.tenant(r), route.Param(r.Context(), "namespace"), b); err != nil {
+		return nil, nil, storageError(err)
+	}
+	return nil, nil, rapi.reloadRules()
+}
+
+func (rapi *RuleStorageAPI) deleteGroup(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if err := rapi.storage.DeleteGroup(r.Context(), rapi.tenant(r), route.Param(r.Context(), "namespace"), route.Param(r.Context(), "group")); err != nil {
+		return nil, nil, storageError(err)
+	}
+	return nil, nil, rapi.reloadRules()
+}
+
+func (rapi *RuleStorageAPI) deleteNamespace(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if err := rapi.storage.DeleteNamespace(r.Context(), rapi.tenant(r), route.Param(r.Context(), "namespace")); err != nil {
+		return nil, nil, storageError(err)
+	}
+	return nil, nil, rapi.reloadRules()
+}
+
+func (rapi *RuleStorageAPI) reloadRules() *api.ApiError {
+	if err := rapi.reload(); err != nil {
+		return &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "reload rules")}
+	}
+	return nil
+}
+
+func storageError(err error) *api.ApiError {
+	switch errors.Cause(err) {
+	case rules.ErrNotFound:
+		return &api.ApiError{Typ: api.ErrorNotFound, Err: err}
+	case rules.ErrInvalid:
+		return &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	default:
+		return &api.ApiError{Typ: api.ErrorInternal, Err: err}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package backfill creates Thanos blocks from the samples of other systems, e.g. OpenMetrics text dumps or remote read
+// endpoints, so that their historical data can be uploaded to the object storage.
+package backfill
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/block/writer"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// chunkSegmentSize is the size of the chunk files of the created blocks. The blocks of all the ranges a source has
+// samples for can be written at once, smaller chunk files than the default avoid preallocating 512MiB for each.
+const chunkSegmentSize = 64 * 1024 * 1024
+
+// Source provides the samples of the series to import.
+type Source interface {
+	// Append appends to the given appender the samples of the source within [mint, maxt), reading the source once.
+	Append(ctx context.Context, app Appender, mint, maxt int64) error
+}
+
+// Appender receives the samples of a Source.
+type Appender interface {
+	// Append appends a sample to the series with the given labels, which must be sorted. Samples of a series not
+	// newer than its previous samples are dropped.
+	Append(lset labels.Labels, t int64, v float64) error
+	// Flush writes the blocks of the ranges ending before t. Sources call it when they won't append samples older
+	// than t anymore, so that fewer blocks are kept open.
+	Flush(ctx context.Context, t int64) error
+}
+
+// Stats are the stats of the samples appended by a Source.
+type Stats struct {
+	// Samples is the number of written samples.
+	Samples int
+	// OutOfOrderSamples is the number of dropped samples, as they were not newer than the previous samples of their
+	// series.
+	OutOfOrderSamples int
+}
+
+// CreateBlocks writes in dir the blocks with the samples of the given source within [mint, maxt] and the given
+// external labels, one block for each range of the given duration aligned to it, like the blocks of Prometheus.
+// Ranges without samples are skipped. It returns the IDs of the written blocks, sorted by time, and the stats of the
+// samples.
+func CreateBlocks(
+	ctx context.Context,
+	logger log.Logger,
+	dir string,
+	src Source,
+	mint, maxt int64,
+	blockDuration int64,
+	extLset labels.Labels,
+) ([]ulid.ULID, Stats, error) {
+	if blockDuration <= 0 {
+		return nil, Stats{}, errors.Errorf("invalid block duration %d", blockDuration)
+	}
+	if mint > maxt {
+		return nil, Stats{}, nil
+	}
+
+	app := &blockAppender{
+		logger:        logger,
+		dir:           dir,
+		blockDuration: blockDuration,
+		meta: metadata.Thanos{
+			Labels:     extLset.Map(),
+			Downsample: metadata.ThanosDownsample{Resolution: downsample.ResLevel0},
+			Source:     metadata.BucketImportSource,
+		},
+		writers: map[int64]*writer.Writer{},
+	}
+	defer app.close()
+
+	// The time range of sources is half-open, like the one of blocks.
+	end := maxt
+	if maxt < math.MaxInt64 {
+		end = maxt + 1
+	}
+	if err := src.Append(ctx, app, mint, end); err != nil {
+		return nil, app.stats, err
+	}
+	if err := app.flushAll(ctx); err != nil {
+		return nil, app.stats, err
+	}
+	return app.ids, app.stats, nil
+}
+
+// blockAppender is the Appender of CreateBlocks, writing the samples to the blocks of their aligned ranges.
+type blockAppender struct {
+	logger        log.Logger
+	dir           string
+	blockDuration int64
+	meta          metadata.Thanos
+
+	// writers are the writers of the blocks being written, by start of their range.
+	writers map[int64]*writer.Writer
+	ids     []ulid.ULID
+	stats   Stats
+}
+
+// Append implements Appender.
+func (a *blockAppender) Append(lset labels.Labels, t int64, v float64) error {
+	start := t - t%a.blockDuration
+	if t%a.blockDuration < 0 {
+		start -= a.blockDuration
+	}
+
+	w, ok := a.writers[start]
+	if !ok {
+		var err error
+		if w, err = writer.NewWithChunkSegmentSize(a.logger, a.dir, a.meta, chunkSegmentSize); err != nil {
+			return errors.Wrapf(err, "create block for range [%d, %d)", start, start+a.blockDuration)
+		}
+		a.writers[start] = w
+	}
+
+	if err := w.Append(lset, t, v); err != nil {
+		if errors.Cause(err) == writer.ErrOutOfOrderSample {
+			a.stats.OutOfOrderSamples++
+			return nil
+		}
+		return err
+	}
+	a.stats.Samples++
+	return nil
+}
+
+// Flush implements Appender.
+func (a *blockAppender) Flush(ctx context.Context, t int64) error {
+	return a.flush(ctx, func(start int64) bool { return start+a.blockDuration <= t })
+}
+
+// flushAll writes the blocks of all the ranges samples were appended to.
+func (a *blockAppender) flushAll(ctx context.Context) error {
+	return a.flush(ctx, func(int64) bool { return true })
+}
+
+func (a *blockAppender) flush(ctx context.Context, ok func(start int64) bool) error {
+	var starts []int64
+	for start := range a.writers {
+		if ok(start) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	for _, start := range starts {
+		w := a.writers[start]
+		delete(a.writers, start)
+		id, err := w.Flush(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "flush block for range [%d, %d)", start, start+a.blockDuration)
+		}
+		a.ids = append(a.ids, id)
+	}
+	return nil
+}
+
+// close removes the blocks not flushed, e.g. on errors.
+func (a *blockAppender) close() {
+	for start, w := range a.writers {
+		runutil.CloseWithLogOnErr(a.logger, w, "block writer")
+		delete(a.writers, start)
+	}
+}
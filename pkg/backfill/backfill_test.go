@@ -0,0 +1,170 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+const testBlockDuration = int64(2 * time.Hour / time.Millisecond)
+
+func TestCreateBlocks_OpenMetrics(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dump := `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200"} 1 0
+http_requests_total{code="500"} 1 7300
+http_requests_total{code="200"} 2 3600
+http_requests_total{code="200"} 3 7200
+http_requests_total{code="200"} 2 3600
+# EOF
+`
+	dir, err := ioutil.TempDir("", "backfill-openmetrics")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	for _, invalid := range []string{
+		"http_requests_total{code=\"200\"} 1\n# EOF\n",
+		"http_requests_total{code=\"200\"} 1 0\n",
+		"http_requests_total{code=\"200\"} 1 0\n# EOF\nhttp_requests_total{code=\"200\"} 2 1\n",
+	} {
+		_, _, err := CreateBlocks(ctx, logger, dir, NewOpenMetricsSource(strings.NewReader(invalid)), math.MinInt64, math.MaxInt64, testBlockDuration, nil)
+		testutil.NotOk(t, err)
+		files, err := ioutil.ReadDir(dir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, len(files))
+	}
+
+	extLset := labels.FromStrings("cluster", "imported")
+	ids, stats, err := CreateBlocks(ctx, logger, dir, NewOpenMetricsSource(strings.NewReader(dump)), math.MinInt64, math.MaxInt64, testBlockDuration, extLset)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(ids))
+	// The last sample is dropped, as it is older than the previous sample of its series.
+	testutil.Equals(t, Stats{Samples: 4, OutOfOrderSamples: 1}, stats)
+
+	for i, exp := range []struct {
+		mint, maxt int64
+		series     uint64
+		samples    uint64
+	}{
+		{mint: 0, maxt: 3600001, series: 1, samples: 2},
+		{mint: 7200000, maxt: 7300001, series: 2, samples: 2},
+	} {
+		bdir := filepath.Join(dir, ids[i].String())
+		m, err := metadata.Read(bdir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, exp.mint, m.MinTime)
+		testutil.Equals(t, exp.maxt, m.MaxTime)
+		testutil.Equals(t, exp.series, m.Stats.NumSeries)
+		testutil.Equals(t, exp.samples, m.Stats.NumSamples)
+		testutil.Equals(t, extLset.Map(), m.Thanos.Labels)
+		testutil.Equals(t, metadata.BucketImportSource, m.Thanos.Source)
+		testutil.Ok(t, block.VerifyIndex(logger, filepath.Join(bdir, block.IndexFilename), m.MinTime, m.MaxTime))
+	}
+
+	// Only the samples within the given time range are imported.
+	dir, err = ioutil.TempDir("", "backfill-openmetrics")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	ids, stats, err = CreateBlocks(ctx, logger, dir, NewOpenMetricsSource(strings.NewReader(dump)), 3600000, 7200000, testBlockDuration, extLset)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(ids))
+	testutil.Equals(t, Stats{Samples: 2, OutOfOrderSamples: 1}, stats)
+	for _, id := range ids {
+		m, err := metadata.Read(filepath.Join(dir, id.String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, uint64(1), m.Stats.NumSamples)
+	}
+}
+
+func TestCreateBlocks_OpenMetricsBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill-openmetrics")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	// The dump is parsed in several batches.
+	var b strings.Builder
+	n := 0
+	for ; b.Len() <= 3*openMetricsBatchSize; n++ {
+		fmt.Fprintf(&b, "up{instance=\"%d\"} 1 %.3f\n", n%100, float64(n)/1000)
+	}
+	b.WriteString("# EOF\n")
+
+	ids, stats, err := CreateBlocks(context.Background(), log.NewNopLogger(), dir, NewOpenMetricsSource(strings.NewReader(b.String())), math.MinInt64, math.MaxInt64, testBlockDuration, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(ids))
+	testutil.Equals(t, Stats{Samples: n}, stats)
+
+	m, err := metadata.Read(filepath.Join(dir, ids[0].String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, uint64(100), m.Stats.NumSeries)
+	testutil.Equals(t, uint64(n), m.Stats.NumSamples)
+}
+
+type fakeReadClient struct {
+	series  []*prompb.TimeSeries
+	queries []*prompb.Query
+}
+
+func (c *fakeReadClient) Read(_ context.Context, q *prompb.Query) (*prompb.QueryResult, error) {
+	c.queries = append(c.queries, q)
+	return &prompb.QueryResult{Timeseries: c.series}, nil
+}
+
+func TestCreateBlocks_RemoteRead(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "backfill-remote-read")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	client := &fakeReadClient{series: []*prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "job", Value: "b"}, {Name: "__name__", Value: "up"}},
+			Samples: []prompb.Sample{{Timestamp: 1500, Value: 0}},
+		},
+	}}
+	matchers := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")}
+	src := NewRemoteReadSource(client, matchers, testBlockDuration)
+
+	ids, stats, err := CreateBlocks(ctx, logger, dir, src, 1000, testBlockDuration+1000, testBlockDuration, labels.FromStrings("cluster", "imported"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, Stats{Samples: 3}, stats)
+	// The remote read endpoint returns the same samples for both blocks, but only the ones of the first block are kept.
+	testutil.Equals(t, 1, len(ids))
+	testutil.Equals(t, 2, len(client.queries))
+	testutil.Equals(t, int64(1000), client.queries[0].StartTimestampMs)
+	testutil.Equals(t, testBlockDuration-1, client.queries[0].EndTimestampMs)
+	testutil.Equals(t, testBlockDuration, client.queries[1].StartTimestampMs)
+	testutil.Equals(t, testBlockDuration+1000, client.queries[1].EndTimestampMs)
+
+	m, err := metadata.Read(filepath.Join(dir, ids[0].String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, uint64(2), m.Stats.NumSeries)
+	testutil.Equals(t, uint64(3), m.Stats.NumSamples)
+}
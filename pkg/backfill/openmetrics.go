@@ -0,0 +1,96 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package backfill
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/textparse"
+)
+
+// openMetricsBatchSize is the size of the batches of lines of OpenMetrics text dumps parsed at once, so that dumps
+// are never fully loaded in memory.
+const openMetricsBatchSize = 1024 * 1024
+
+var openMetricsEOF = []byte("# EOF")
+
+// OpenMetricsSource is a Source of the samples of an OpenMetrics text dump.
+type OpenMetricsSource struct {
+	r io.Reader
+}
+
+// NewOpenMetricsSource returns a Source of the samples of the OpenMetrics text dump read from r, which must end with
+// "# EOF" and have a timestamp for each sample. The dump can only be appended once.
+func NewOpenMetricsSource(r io.Reader) *OpenMetricsSource {
+	return &OpenMetricsSource{r: r}
+}
+
+// Append implements Source. The dump is parsed in batches of lines as it is read.
+func (s *OpenMetricsSource) Append(ctx context.Context, app Appender, mint, maxt int64) error {
+	r := bufio.NewReader(s.r)
+	batch := make([]byte, 0, openMetricsBatchSize+len(openMetricsEOF)+1)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "read OpenMetrics")
+		}
+		if bytes.Equal(bytes.TrimSuffix(line, []byte("\n")), openMetricsEOF) {
+			if _, err := r.Peek(1); err != io.EOF {
+				return errors.New("parse OpenMetrics: unexpected data after # EOF")
+			}
+			return s.parse(batch, app, mint, maxt)
+		}
+		if err == io.EOF {
+			return errors.New("parse OpenMetrics: data does not end with # EOF")
+		}
+
+		batch = append(batch, line...)
+		if len(batch) >= openMetricsBatchSize {
+			if err := s.parse(batch, app, mint, maxt); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+}
+
+// parse appends the samples within [mint, maxt) of the given complete lines of the dump.
+func (s *OpenMetricsSource) parse(batch []byte, app Appender, mint, maxt int64) error {
+	batch = append(append(batch, openMetricsEOF...), '\n')
+	p := textparse.NewOpenMetricsParser(batch)
+	for {
+		e, err := p.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "parse OpenMetrics")
+		}
+		if e != textparse.EntrySeries {
+			continue
+		}
+
+		series, ts, v := p.Series()
+		if ts == nil {
+			return errors.Errorf("sample of series %s has no timestamp", series)
+		}
+		if *ts < mint || *ts >= maxt {
+			continue
+		}
+		// The labels are kept by the appender, so they can't be reused.
+		var lset labels.Labels
+		p.Metric(&lset)
+		if err := app.Append(lset, *ts, v); err != nil {
+			return errors.Wrapf(err, "append sample of series %s", lset)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package backfill
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// RemoteReadSource is a Source of the samples of the series matching some matchers, read from a remote read endpoint.
+type RemoteReadSource struct {
+	client     remote.ReadClient
+	matchers   []*labels.Matcher
+	queryRange int64
+}
+
+// NewRemoteReadSource returns a Source of the samples of the series matching the given matchers, read with the given
+// client. The samples are read with one query for each range of the given duration aligned to it, e.g. the duration
+// of the blocks, so that the blocks of the previous ranges can be written before the next query.
+func NewRemoteReadSource(client remote.ReadClient, matchers []*labels.Matcher, queryRange int64) *RemoteReadSource {
+	return &RemoteReadSource{client: client, matchers: matchers, queryRange: queryRange}
+}
+
+// Append implements Source.
+func (s *RemoteReadSource) Append(ctx context.Context, app Appender, mint, maxt int64) error {
+	if s.queryRange <= 0 {
+		return errors.Errorf("invalid query range %d", s.queryRange)
+	}
+	start := mint - mint%s.queryRange
+	if mint%s.queryRange < 0 {
+		start -= s.queryRange
+	}
+	for t := start; t < maxt; t += s.queryRange {
+		qmint, qmaxt := t, t+s.queryRange
+		if qmint < mint {
+			qmint = mint
+		}
+		// The end of the last range can overflow.
+		if qmaxt > maxt || qmaxt < t {
+			qmaxt = maxt
+		}
+		if err := s.query(ctx, app, qmint, qmaxt); err != nil {
+			return errors.Wrapf(err, "query range [%d, %d)", qmint, qmaxt)
+		}
+		if err := app.Flush(ctx, qmaxt); err != nil {
+			return err
+		}
+		if qmaxt == maxt {
+			return nil
+		}
+	}
+	return nil
+}
+
+// query appends the samples within [mint, maxt) read with a single query.
+func (s *RemoteReadSource) query(ctx context.Context, app Appender, mint, maxt int64) error {
+	// The time range of remote read queries is inclusive.
+	q, err := remote.ToQuery(mint, maxt-1, s.matchers, nil)
+	if err != nil {
+		return errors.Wrap(err, "create remote read query")
+	}
+	res, err := s.client.Read(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "remote read")
+	}
+
+	for _, ts := range res.Timeseries {
+		lset := make(labels.Labels, 0, len(ts.Labels))
+		for _, l := range ts.Labels {
+			lset = append(lset, labels.Label{Name: l.Name, Value: l.Value})
+		}
+		sort.Sort(lset)
+
+		for _, smpl := range ts.Samples {
+			if smpl.Timestamp < mint || smpl.Timestamp >= maxt {
+				continue
+			}
+			if err := app.Append(lset, smpl.Timestamp, smpl.Value); err != nil {
+				return errors.Wrapf(err, "append sample of series %s", lset)
+			}
+		}
+	}
+	return nil
+}
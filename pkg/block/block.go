@@ -8,8 +8,10 @@ package block
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -23,6 +25,8 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
@@ -63,12 +67,31 @@ func Download(ctx context.Context, logger log.Logger, bucket objstore.Bucket, id
 	return nil
 }
 
+// UploadOptions are the options of the upload of a block.
+type UploadOptions struct {
+	// Concurrency is the number of files of the block uploaded concurrently. It defaults to 1.
+	Concurrency int
+	// RateLimiter limits the bandwidth of the upload, in bytes per second, if not nil. It can be shared by several
+	// uploads to cap their total bandwidth.
+	RateLimiter *rate.Limiter
+	// Resume enables resuming interrupted uploads: the files already in the bucket with the same size and SHA256
+	// checksum as the local ones are not uploaded again, and the block is not cleaned from the bucket if the upload
+	// fails, so that it can be retried. The checksums of the files in the bucket are computed by downloading them, as
+	// the checksums of the object storage providers, e.g. ETags, are not comparable between providers.
+	Resume bool
+}
+
 // Upload uploads block from given block dir that ends with block id.
 // It makes sure cleanup is done on error to avoid partial block uploads.
 // It also verifies basic features of Thanos block.
 // TODO(bplotka): Ensure bucket operations have reasonable backoff retries.
 // NOTE: Upload updates `meta.Thanos.File` section.
 func Upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir string) error {
+	return UploadWithOptions(ctx, logger, bkt, bdir, UploadOptions{})
+}
+
+// UploadWithOptions uploads block from given block dir that ends with block id, like Upload, with the given options.
+func UploadWithOptions(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir string, opts UploadOptions) error {
 	df, err := os.Stat(bdir)
 	if err != nil {
 		return err
@@ -103,26 +126,171 @@ func Upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir st
 		return errors.Wrap(err, "encode meta file")
 	}
 
-	if err := bkt.Upload(ctx, path.Join(DebugMetas, fmt.Sprintf("%s.json", id)), bytes.NewReader(metaEncoded.Bytes())); err != nil {
-		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload debug meta file"))
+	fail := func(err error) error {
+		if opts.Resume {
+			// Keep the partial upload to resume it: without meta file, it is not considered as a block.
+			return err
+		}
+		return cleanUp(logger, bkt, id, err)
 	}
 
-	if err := objstore.UploadDir(ctx, logger, bkt, path.Join(bdir, ChunksDirname), path.Join(id.String(), ChunksDirname)); err != nil {
-		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload chunks"))
+	if err := bkt.Upload(ctx, path.Join(DebugMetas, fmt.Sprintf("%s.json", id)), bytes.NewReader(metaEncoded.Bytes())); err != nil {
+		return fail(errors.Wrap(err, "upload debug meta file"))
 	}
 
-	if err := objstore.UploadFile(ctx, logger, bkt, path.Join(bdir, IndexFilename), path.Join(id.String(), IndexFilename)); err != nil {
-		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload index"))
+	if err := uploadFiles(ctx, logger, bkt, bdir, id, meta.Thanos.Files, opts); err != nil {
+		return fail(err)
 	}
 
 	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file to be pending uploads.
 	if err := bkt.Upload(ctx, path.Join(id.String(), MetaFilename), &metaEncoded); err != nil {
-		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload meta file"))
+		return fail(errors.Wrap(err, "upload meta file"))
 	}
 
 	return nil
 }
 
+// uploadFiles uploads the given chunks and index files of the block, with the given options.
+func uploadFiles(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir string, id ulid.ULID, files []metadata.File, opts UploadOptions) error {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	ch := make(chan metadata.File)
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			for f := range ch {
+				if err := uploadFile(gctx, logger, bkt, bdir, id, f, opts); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(ch)
+		for _, f := range files {
+			if f.RelPath == MetaFilename {
+				continue
+			}
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			case ch <- f:
+			}
+		}
+		return nil
+	})
+	return g.Wait()
+}
+
+func uploadFile(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir string, id ulid.ULID, f metadata.File, opts UploadOptions) error {
+	src := filepath.Join(bdir, f.RelPath)
+	dst := path.Join(id.String(), filepath.ToSlash(f.RelPath))
+
+	if opts.Resume {
+		uploaded, err := alreadyUploaded(ctx, logger, bkt, src, dst, f.SizeBytes)
+		if err != nil {
+			return err
+		}
+		if uploaded {
+			level.Debug(logger).Log("msg", "file already uploaded, skipping", "file", dst, "size", f.SizeBytes)
+			return nil
+		}
+	}
+
+	if opts.RateLimiter == nil {
+		return objstore.UploadFile(ctx, logger, bkt, src, dst)
+	}
+
+	r, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "open file %s", src)
+	}
+	defer runutil.CloseWithLogOnErr(logger, r, "close file %s", src)
+
+	if err := bkt.Upload(ctx, dst, &rateLimitedReader{ctx: ctx, f: r, limiter: opts.RateLimiter}); err != nil {
+		return errors.Wrapf(err, "upload file %s as %s", src, dst)
+	}
+	level.Debug(logger).Log("msg", "uploaded file", "from", src, "dst", dst, "bucket", bkt.Name())
+	return nil
+}
+
+// alreadyUploaded returns true if the object dst of the bucket has the given size and the same SHA256 checksum as the
+// local file src.
+func alreadyUploaded(ctx context.Context, logger log.Logger, bkt objstore.Bucket, src, dst string, size int64) (bool, error) {
+	attrs, err := bkt.Attributes(ctx, dst)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "get attributes of %s", dst)
+	}
+	if attrs.Size != size {
+		return false, nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return false, errors.Wrapf(err, "open file %s", src)
+	}
+	defer runutil.CloseWithLogOnErr(logger, f, "close file %s", src)
+
+	localSum, err := sha256Sum(f)
+	if err != nil {
+		return false, errors.Wrapf(err, "checksum file %s", src)
+	}
+
+	rc, err := bkt.Get(ctx, dst)
+	if err != nil {
+		return false, errors.Wrapf(err, "get %s", dst)
+	}
+	defer runutil.CloseWithLogOnErr(logger, rc, "close object %s", dst)
+
+	remoteSum, err := sha256Sum(rc)
+	if err != nil {
+		return false, errors.Wrapf(err, "checksum object %s", dst)
+	}
+	return bytes.Equal(localSum, remoteSum), nil
+}
+
+func sha256Sum(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// rateLimitedReader reads a file at the rate of its limiter.
+type rateLimitedReader struct {
+	ctx     context.Context
+	f       *os.File
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	// The limiter cannot wait for more bytes than its burst at once.
+	if b := r.limiter.Burst(); len(p) > b {
+		p = p[:b]
+	}
+	n, err := r.f.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// ObjectSize implements objstore.ObjectSizer.
+func (r *rateLimitedReader) ObjectSize() (int64, error) {
+	return objstore.TryToGetSize(r.f)
+}
+
 func cleanUp(logger log.Logger, bkt objstore.Bucket, id ulid.ULID, err error) error {
 	// Cleanup the dir with an uncancelable context.
 	cleanErr := Delete(context.Background(), logger, bkt, id)
@@ -191,20 +359,31 @@ func Delete(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid
 // deleteDirRec removes all objects prefixed with dir from the bucket. It skips objects that return true for the passed keep function.
 // NOTE: For objects removal use `block.Delete` strictly.
 func deleteDirRec(ctx context.Context, logger log.Logger, bkt objstore.Bucket, dir string, keep func(name string) bool) error {
-	return bkt.Iter(ctx, dir, func(name string) error {
-		// If we hit a directory, call DeleteDir recursively.
-		if strings.HasSuffix(name, objstore.DirDelim) {
-			return deleteDirRec(ctx, logger, bkt, name, keep)
-		}
-		if keep(name) {
+	var (
+		names   []string
+		listRec func(dir string) error
+	)
+	listRec = func(dir string) error {
+		return bkt.Iter(ctx, dir, func(name string) error {
+			// If we hit a directory, list it recursively.
+			if strings.HasSuffix(name, objstore.DirDelim) {
+				return listRec(name)
+			}
+			if !keep(name) {
+				names = append(names, name)
+			}
 			return nil
-		}
-		if err := bkt.Delete(ctx, name); err != nil {
-			return err
-		}
-		level.Debug(logger).Log("msg", "deleted file", "file", name, "bucket", bkt.Name())
-		return nil
-	})
+		})
+	}
+	if err := listRec(dir); err != nil {
+		return err
+	}
+
+	if err := bkt.DeleteMultiple(ctx, names); err != nil {
+		return err
+	}
+	level.Debug(logger).Log("msg", "deleted files", "dir", dir, "files", len(names), "bucket", bkt.Name())
+	return nil
 }
 
 // DownloadMeta downloads only meta file from bucket by block ID.
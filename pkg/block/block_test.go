@@ -8,10 +8,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,6 +27,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+	"golang.org/x/time/rate"
 )
 
 func TestIsBlockDir(t *testing.T) {
@@ -210,6 +213,84 @@ func TestUpload(t *testing.T) {
 	}
 }
 
+func TestUploadWithOptions(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "test-block-upload-options")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(tmpDir)) }()
+
+	b1, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+		{{Name: "a", Value: "1"}},
+		{{Name: "a", Value: "2"}},
+		{{Name: "b", Value: "1"}},
+	}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: "val1"}}, 124)
+	testutil.Ok(t, err)
+	bdir := path.Join(tmpDir, b1.String())
+	chunks, err := ioutil.ReadFile(path.Join(bdir, ChunksDirname, "000001"))
+	testutil.Ok(t, err)
+	index, err := ioutil.ReadFile(path.Join(bdir, IndexFilename))
+	testutil.Ok(t, err)
+
+	{
+		// Concurrent and rate limited upload, reading the files by small chunks.
+		bkt := objstore.NewInMemBucket()
+		testutil.Ok(t, UploadWithOptions(ctx, log.NewNopLogger(), bkt, bdir, UploadOptions{
+			Concurrency: 4,
+			RateLimiter: rate.NewLimiter(rate.Inf, 100),
+		}))
+		testutil.Equals(t, 4, len(bkt.Objects()))
+		testutil.Equals(t, chunks, bkt.Objects()[path.Join(b1.String(), ChunksDirname, "000001")])
+		testutil.Equals(t, index, bkt.Objects()[path.Join(b1.String(), IndexFilename)])
+	}
+	{
+		// Resumed upload, the files with the same content are not uploaded again, the others are uploaded even with
+		// the expected size.
+		bkt := &uploadCountingBucket{InMemBucket: objstore.NewInMemBucket(), uploads: map[string]int{}}
+		chunksFile := path.Join(b1.String(), ChunksDirname, "000001")
+		testutil.Ok(t, bkt.InMemBucket.Upload(ctx, chunksFile, bytes.NewReader(chunks)))
+		testutil.Ok(t, bkt.InMemBucket.Upload(ctx, path.Join(b1.String(), IndexFilename), bytes.NewReader(bytes.Repeat([]byte{'a'}, len(index)))))
+
+		testutil.Ok(t, UploadWithOptions(ctx, log.NewNopLogger(), bkt, bdir, UploadOptions{Resume: true}))
+		testutil.Equals(t, 4, len(bkt.Objects()))
+		testutil.Equals(t, 0, bkt.uploads[chunksFile])
+		testutil.Equals(t, 1, bkt.uploads[path.Join(b1.String(), IndexFilename)])
+		testutil.Equals(t, chunks, bkt.Objects()[chunksFile])
+		testutil.Equals(t, index, bkt.Objects()[path.Join(b1.String(), IndexFilename)])
+	}
+	{
+		// Failed upload is kept in the bucket to be resumed.
+		bkt := objstore.NewInMemBucket()
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		testutil.NotOk(t, UploadWithOptions(cctx, log.NewNopLogger(), bkt, bdir, UploadOptions{
+			RateLimiter: rate.NewLimiter(1, 1),
+			Resume:      true,
+		}))
+		_, ok := bkt.Objects()[path.Join(DebugMetas, fmt.Sprintf("%s.json", b1.String()))]
+		testutil.Assert(t, ok, "expected debug meta file to be kept")
+		_, ok = bkt.Objects()[path.Join(b1.String(), MetaFilename)]
+		testutil.Assert(t, !ok, "expected no meta file")
+	}
+}
+
+// uploadCountingBucket counts the uploads of each object.
+type uploadCountingBucket struct {
+	*objstore.InMemBucket
+
+	mtx     sync.Mutex
+	uploads map[string]int
+}
+
+func (b *uploadCountingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	b.mtx.Lock()
+	b.uploads[name]++
+	b.mtx.Unlock()
+	return b.InMemBucket.Upload(ctx, name, r)
+}
+
 func TestDelete(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 	ctx := context.Background()
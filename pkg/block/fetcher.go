@@ -636,6 +636,10 @@ func addNodeBySources(root *Node, add *Node) bool {
 
 		// Block exists with same sources, add as child.
 		if contains(parentSources, childSources) && contains(childSources, parentSources) {
+			// A block rewritten from the existing one keeps its sources, and replaces it.
+			if rewrittenFrom(&add.Meta, &node.Meta) {
+				node.Meta, add.Meta = add.Meta, node.Meta
+			}
 			node.Children = append(node.Children, add)
 			return true
 		}
@@ -656,6 +660,13 @@ func addNodeBySources(root *Node, add *Node) bool {
 	return addNodeBySources(rootNode, add)
 }
 
+// rewrittenFrom returns true if the block of the given meta was rewritten from the block of the given original meta,
+// e.g. by the bucket rewrite tool.
+func rewrittenFrom(meta, original *metadata.Meta) bool {
+	return meta.Thanos.Source == metadata.BucketRewriteSource &&
+		len(meta.Compaction.Parents) == 1 && meta.Compaction.Parents[0].ULID == original.ULID
+}
+
 func contains(s1 []ulid.ULID, s2 []ulid.ULID) bool {
 	for _, a := range s2 {
 		found := false
@@ -525,6 +525,8 @@ func TestTimePartitionMetaFilter_Filter(t *testing.T) {
 type sourcesAndResolution struct {
 	sources    []ulid.ULID
 	resolution int64
+	// rewrittenFrom is the block the block was rewritten from, if not empty.
+	rewrittenFrom ulid.ULID
 }
 
 func TestDeduplicateFilter_Filter(t *testing.T) {
@@ -845,6 +847,32 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 				ULID(12),
 			},
 		},
+		{
+			name: "rewritten blocks with same sources",
+			input: map[ulid.ULID]*sourcesAndResolution{
+				ULID(3): {
+					sources:    []ulid.ULID{ULID(1), ULID(2)},
+					resolution: 0,
+				},
+				ULID(4): {
+					sources:       []ulid.ULID{ULID(1), ULID(2)},
+					resolution:    0,
+					rewrittenFrom: ULID(3),
+				},
+				ULID(5): {
+					sources:       []ulid.ULID{ULID(1), ULID(2)},
+					resolution:    0,
+					rewrittenFrom: ULID(4),
+				},
+				ULID(6): {
+					sources:    []ulid.ULID{ULID(1), ULID(2)},
+					resolution: 0,
+				},
+			},
+			expected: []ulid.ULID{
+				ULID(5),
+			},
+		},
 	} {
 		f := NewDeduplicateFilter()
 		if ok := t.Run(tcase.name, func(t *testing.T) {
@@ -865,6 +893,10 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 						},
 					},
 				}
+				if metaInfo.rewrittenFrom != (ulid.ULID{}) {
+					metas[id].Compaction.Parents = []tsdb.BlockDesc{{ULID: metaInfo.rewrittenFrom}}
+					metas[id].Thanos.Source = metadata.BucketRewriteSource
+				}
 			}
 			testutil.Ok(t, f.Filter(ctx, metas, m.synced))
 			compareSliceWithMapKeys(t, metas, tcase.expected)
@@ -447,8 +447,14 @@ type BinaryReader struct {
 
 // NewBinaryReader loads or builds new index-header if not present on disk.
 func NewBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, id ulid.ULID, postingOffsetsInMemSampling int) (*BinaryReader, error) {
+	return newBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, false)
+}
+
+// newBinaryReader loads or builds new index-header if not present on disk. If stateCacheEnabled is true, the state
+// parsed from the index-header is loaded from the state file next to it, or persisted there if it is missing or invalid.
+func newBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, id ulid.ULID, postingOffsetsInMemSampling int, stateCacheEnabled bool) (*BinaryReader, error) {
 	binfn := filepath.Join(dir, id.String(), block.IndexHeaderFilename)
-	br, err := newFileBinaryReader(binfn, postingOffsetsInMemSampling)
+	br, err := newFileBinaryReader(logger, binfn, id, postingOffsetsInMemSampling, stateCacheEnabled)
 	if err == nil {
 		return br, nil
 	}
@@ -461,10 +467,10 @@ func NewBinaryReader(ctx context.Context, logger log.Logger, bkt objstore.Bucket
 	}
 
 	level.Debug(logger).Log("msg", "built index-header file", "path", binfn, "elapsed", time.Since(start))
-	return newFileBinaryReader(binfn, postingOffsetsInMemSampling)
+	return newFileBinaryReader(logger, binfn, id, postingOffsetsInMemSampling, stateCacheEnabled)
 }
 
-func newFileBinaryReader(path string, postingOffsetsInMemSampling int) (bw *BinaryReader, err error) {
+func newFileBinaryReader(logger log.Logger, path string, id ulid.ULID, postingOffsetsInMemSampling int, stateCacheEnabled bool) (bw *BinaryReader, err error) {
 	f, err := fileutil.OpenMmapFile(path)
 	if err != nil {
 		return nil, err
@@ -509,6 +515,51 @@ func newFileBinaryReader(path string, postingOffsetsInMemSampling int) (bw *Bina
 		return nil, errors.Wrap(err, "read symbols")
 	}
 
+	// Earlier V1 formats keep the whole postings offset table in memory, the state is not cached for them.
+	stateCacheEnabled = stateCacheEnabled && r.indexVersion != index.FormatV1
+	statefn := filepath.Join(filepath.Dir(path), StateFilename)
+	if stateCacheEnabled {
+		err := r.readState(statefn, id)
+		if err == nil {
+			r.dec = &index.Decoder{LookupSymbol: r.LookupSymbol}
+			return r, nil
+		}
+		if !os.IsNotExist(errors.Cause(err)) {
+			level.Warn(logger).Log("msg", "failed to read index-header state; parsing index-header", "path", statefn, "err", err)
+		}
+	}
+
+	if err := r.readPostingsOffsetTable(); err != nil {
+		return nil, err
+	}
+
+	r.nameSymbols = make(map[uint32]string, len(r.postings))
+	for k := range r.postings {
+		if k == "" {
+			continue
+		}
+		off, err := r.symbols.ReverseLookup(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "reverse symbol lookup")
+		}
+		r.nameSymbols[off] = k
+	}
+
+	r.dec = &index.Decoder{LookupSymbol: r.LookupSymbol}
+
+	if stateCacheEnabled {
+		if err := r.writeState(statefn, id); err != nil {
+			level.Warn(logger).Log("msg", "failed to write index-header state", "path", statefn, "err", err)
+		}
+	}
+	return r, nil
+}
+
+// readPostingsOffsetTable reads the postings offset table of the index-header, keeping the offsets of all values
+// in memory for the V1 index format and 1/postingOffsetsInMemSampling of them otherwise.
+func (r *BinaryReader) readPostingsOffsetTable() error {
+	postingOffsetsInMemSampling := r.postingOffsetsInMemSampling
+
 	var lastKey []string
 	if r.indexVersion == index.FormatV1 {
 		// Earlier V1 formats don't have a sorted postings offset table, so
@@ -535,7 +586,7 @@ func newFileBinaryReader(path string, postingOffsetsInMemSampling int) (bw *Bina
 			prevRng = index.Range{Start: int64(off + postingLengthFieldSize)}
 			return nil
 		}); err != nil {
-			return nil, errors.Wrap(err, "read postings table")
+			return errors.Wrap(err, "read postings table")
 		}
 		if lastKey != nil {
 			prevRng.End = r.indexLastPostingEnd - crc32.Size
@@ -577,7 +628,7 @@ func newFileBinaryReader(path string, postingOffsetsInMemSampling int) (bw *Bina
 
 			return nil
 		}); err != nil {
-			return nil, errors.Wrap(err, "read postings table")
+			return errors.Wrap(err, "read postings table")
 		}
 		if lastKey != nil {
 			if (valueCount-1)%postingOffsetsInMemSampling != 0 {
@@ -595,22 +646,7 @@ func newFileBinaryReader(path string, postingOffsetsInMemSampling int) (bw *Bina
 			r.postings[k].offsets = l
 		}
 	}
-
-	r.nameSymbols = make(map[uint32]string, len(r.postings))
-	for k := range r.postings {
-		if k == "" {
-			continue
-		}
-		off, err := r.symbols.ReverseLookup(k)
-		if err != nil {
-			return nil, errors.Wrap(err, "reverse symbol lookup")
-		}
-		r.nameSymbols[off] = k
-	}
-
-	r.dec = &index.Decoder{LookupSymbol: r.LookupSymbol}
-
-	return r, nil
+	return nil
 }
 
 // newBinaryTOCFromByteSlice return parsed TOC from given index header byte slice.
@@ -362,7 +362,7 @@ func BenchmarkBinaryReader(t *testing.B) {
 
 	t.ResetTimer()
 	for i := 0; i < t.N; i++ {
-		br, err := newFileBinaryReader(fn, 32)
+		br, err := newFileBinaryReader(log.NewNopLogger(), fn, m.ULID, 32, false)
 		testutil.Ok(t, err)
 		testutil.Ok(t, br.Close())
 	}
@@ -69,7 +69,9 @@ type LazyBinaryReader struct {
 	filepath                    string
 	id                          ulid.ULID
 	postingOffsetsInMemSampling int
+	stateCacheEnabled           bool
 	metrics                     *LazyBinaryReaderMetrics
+	onLoaded                    func(*LazyBinaryReader)
 	onClosed                    func(*LazyBinaryReader)
 
 	readerMx  sync.RWMutex
@@ -93,6 +95,21 @@ func NewLazyBinaryReader(
 	postingOffsetsInMemSampling int,
 	metrics *LazyBinaryReaderMetrics,
 	onClosed func(*LazyBinaryReader),
+) (*LazyBinaryReader, error) {
+	return newLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, false, metrics, nil, onClosed)
+}
+
+func newLazyBinaryReader(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.BucketReader,
+	dir string,
+	id ulid.ULID,
+	postingOffsetsInMemSampling int,
+	stateCacheEnabled bool,
+	metrics *LazyBinaryReaderMetrics,
+	onLoaded func(*LazyBinaryReader),
+	onClosed func(*LazyBinaryReader),
 ) (*LazyBinaryReader, error) {
 	filepath := filepath.Join(dir, id.String(), block.IndexHeaderFilename)
 
@@ -120,8 +137,10 @@ func NewLazyBinaryReader(
 		filepath:                    filepath,
 		id:                          id,
 		postingOffsetsInMemSampling: postingOffsetsInMemSampling,
+		stateCacheEnabled:           stateCacheEnabled,
 		metrics:                     metrics,
 		usedAt:                      atomic.NewInt64(time.Now().UnixNano()),
+		onLoaded:                    onLoaded,
 		onClosed:                    onClosed,
 	}, nil
 }
@@ -231,7 +250,7 @@ func (r *LazyBinaryReader) load() error {
 	r.metrics.loadCount.Inc()
 	startTime := time.Now()
 
-	reader, err := NewBinaryReader(r.ctx, r.logger, r.bkt, r.dir, r.id, r.postingOffsetsInMemSampling)
+	reader, err := newBinaryReader(r.ctx, r.logger, r.bkt, r.dir, r.id, r.postingOffsetsInMemSampling, r.stateCacheEnabled)
 	if err != nil {
 		r.metrics.loadFailedCount.Inc()
 		r.readerErr = err
@@ -242,6 +261,11 @@ func (r *LazyBinaryReader) load() error {
 	level.Debug(r.logger).Log("msg", "lazy loaded index-header file", "path", r.filepath, "elapsed", time.Since(startTime))
 	r.metrics.loadDuration.Observe(time.Since(startTime).Seconds())
 
+	if r.onLoaded != nil {
+		// Mark as used before notifying, so the just loaded reader is not the least recently used one.
+		r.usedAt.Store(time.Now().UnixNano())
+		r.onLoaded(r)
+	}
 	return nil
 }
 
@@ -268,6 +292,17 @@ func (r *LazyBinaryReader) unload() error {
 	return nil
 }
 
+// loadedSize returns the size of the loaded index-header, or false if it is not loaded.
+func (r *LazyBinaryReader) loadedSize() (int64, bool) {
+	r.readerMx.RLock()
+	defer r.readerMx.RUnlock()
+
+	if r.reader == nil {
+		return 0, false
+	}
+	return int64(r.reader.b.Len()), true
+}
+
 func (r *LazyBinaryReader) lastUsedAt() int64 {
 	return r.usedAt.Load()
 }
@@ -5,6 +5,7 @@ package indexheader
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,44 +19,64 @@ import (
 
 // ReaderPool is used to istantiate new index-header readers and keep track of them.
 // When the lazy reader is enabled, the pool keeps track of all instantiated readers
-// and automatically close them once the idle timeout is reached. A closed lazy reader
-// will be automatically re-opened upon next usage.
+// and automatically close them once the idle timeout is reached or, least recently used
+// first, once the limits of loaded readers are exceeded. A closed lazy reader will be
+// automatically re-opened upon next usage.
 type ReaderPool struct {
-	lazyReaderEnabled     bool
-	lazyReaderIdleTimeout time.Duration
-	lazyReaderMetrics     *LazyBinaryReaderMetrics
-	logger                log.Logger
+	lazyReaderEnabled        bool
+	lazyReaderIdleTimeout    time.Duration
+	lazyReaderMaxLoaded      int
+	lazyReaderMaxLoadedBytes int64
+	lazyReaderMetrics        *LazyBinaryReaderMetrics
+	stateCacheEnabled        bool
+	logger                   log.Logger
 
 	// Channel used to signal once the pool is closing.
 	close chan struct{}
+	// Channel used to signal once a lazy reader has been loaded and the limits have to be checked.
+	loaded chan struct{}
 
 	// Keep track of all readers managed by the pool.
 	lazyReadersMx sync.Mutex
 	lazyReaders   map[*LazyBinaryReader]struct{}
 }
 
-// NewReaderPool makes a new ReaderPool.
-func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, reg prometheus.Registerer) *ReaderPool {
+// NewReaderPool makes a new ReaderPool. If lazyReaderMaxLoaded or lazyReaderMaxLoadedBytes are > 0, the least recently
+// used lazy readers are closed once more readers, or readers with larger index-headers in total, are loaded.
+// If stateCacheEnabled is true, readers persist the state parsed from the index-header next to it, so it does not
+// have to be parsed again after a restart or lazy reload.
+func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, lazyReaderMaxLoaded int, lazyReaderMaxLoadedBytes int64, stateCacheEnabled bool, reg prometheus.Registerer) *ReaderPool {
 	p := &ReaderPool{
-		logger:                logger,
-		lazyReaderEnabled:     lazyReaderEnabled,
-		lazyReaderIdleTimeout: lazyReaderIdleTimeout,
-		lazyReaderMetrics:     NewLazyBinaryReaderMetrics(reg),
-		lazyReaders:           make(map[*LazyBinaryReader]struct{}),
-		close:                 make(chan struct{}),
+		logger:                   logger,
+		lazyReaderEnabled:        lazyReaderEnabled,
+		lazyReaderIdleTimeout:    lazyReaderIdleTimeout,
+		lazyReaderMaxLoaded:      lazyReaderMaxLoaded,
+		lazyReaderMaxLoadedBytes: lazyReaderMaxLoadedBytes,
+		lazyReaderMetrics:        NewLazyBinaryReaderMetrics(reg),
+		stateCacheEnabled:        stateCacheEnabled,
+		lazyReaders:              make(map[*LazyBinaryReader]struct{}),
+		close:                    make(chan struct{}),
+		loaded:                   make(chan struct{}, 1),
 	}
 
-	// Start a goroutine to close idle readers (only if required).
-	if p.lazyReaderEnabled && p.lazyReaderIdleTimeout > 0 {
-		checkFreq := p.lazyReaderIdleTimeout / 10
-
+	// Start a goroutine to close idle readers and enforce the limits (only if required).
+	if p.trackLazyReaders() {
 		go func() {
+			var idleCheck <-chan time.Time
+			if p.lazyReaderIdleTimeout > 0 {
+				t := time.NewTicker(p.lazyReaderIdleTimeout / 10)
+				defer t.Stop()
+				idleCheck = t.C
+			}
+
 			for {
 				select {
 				case <-p.close:
 					return
-				case <-time.After(checkFreq):
+				case <-idleCheck:
 					p.closeIdleReaders()
+				case <-p.loaded:
+					p.closeLeastRecentlyUsedReaders()
 				}
 			}
 		}()
@@ -64,6 +85,15 @@ func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTime
 	return p
 }
 
+// trackLazyReaders returns true if the pool has to keep track of the lazy readers.
+func (p *ReaderPool) trackLazyReaders() bool {
+	return p.lazyReaderEnabled && (p.lazyReaderIdleTimeout > 0 || p.limitLoadedReaders())
+}
+
+func (p *ReaderPool) limitLoadedReaders() bool {
+	return p.lazyReaderMaxLoaded > 0 || p.lazyReaderMaxLoadedBytes > 0
+}
+
 // NewBinaryReader creates and returns a new binary reader. If the pool has been configured
 // with lazy reader enabled, this function will return a lazy reader. The returned lazy reader
 // is tracked by the pool and automatically closed once the idle timeout expires.
@@ -72,9 +102,9 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	var err error
 
 	if p.lazyReaderEnabled {
-		reader, err = NewLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, p.lazyReaderMetrics, p.onLazyReaderClosed)
+		reader, err = newLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, p.stateCacheEnabled, p.lazyReaderMetrics, p.onLazyReaderLoaded, p.onLazyReaderClosed)
 	} else {
-		reader, err = NewBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling)
+		reader, err = newBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, p.stateCacheEnabled)
 	}
 
 	if err != nil {
@@ -82,7 +112,7 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	}
 
 	// Keep track of lazy readers only if required.
-	if p.lazyReaderEnabled && p.lazyReaderIdleTimeout > 0 {
+	if p.trackLazyReaders() {
 		p.lazyReadersMx.Lock()
 		p.lazyReaders[reader.(*LazyBinaryReader)] = struct{}{}
 		p.lazyReadersMx.Unlock()
@@ -112,6 +142,50 @@ func (p *ReaderPool) closeIdleReaders() {
 	}
 }
 
+// closeLeastRecentlyUsedReaders closes the least recently used loaded readers until the limits are satisfied.
+// The most recently used reader is never closed, even if it exceeds the limits alone.
+func (p *ReaderPool) closeLeastRecentlyUsedReaders() {
+	type loadedReader struct {
+		r      *LazyBinaryReader
+		size   int64
+		usedAt int64
+	}
+
+	p.lazyReadersMx.Lock()
+	readers := make([]*LazyBinaryReader, 0, len(p.lazyReaders))
+	for r := range p.lazyReaders {
+		readers = append(readers, r)
+	}
+	p.lazyReadersMx.Unlock()
+
+	var (
+		loaded    []loadedReader
+		totalSize int64
+	)
+	for _, r := range readers {
+		size, ok := r.loadedSize()
+		if !ok {
+			continue
+		}
+		loaded = append(loaded, loadedReader{r: r, size: size, usedAt: r.lastUsedAt()})
+		totalSize += size
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].usedAt < loaded[j].usedAt })
+
+	exceeded := func(count int, size int64) bool {
+		return (p.lazyReaderMaxLoaded > 0 && count > p.lazyReaderMaxLoaded) ||
+			(p.lazyReaderMaxLoadedBytes > 0 && size > p.lazyReaderMaxLoadedBytes)
+	}
+	// Same as for idle readers, a reader used in the meanwhile may be closed, and will be re-opened upon next usage.
+	for i := 0; i < len(loaded)-1 && exceeded(len(loaded)-i, totalSize); i++ {
+		if err := loaded[i].r.unload(); err != nil {
+			level.Warn(p.logger).Log("msg", "failed to close least recently used index-header reader", "err", err)
+			continue
+		}
+		totalSize -= loaded[i].size
+	}
+}
+
 func (p *ReaderPool) getIdleReaders() []*LazyBinaryReader {
 	p.lazyReadersMx.Lock()
 	defer p.lazyReadersMx.Unlock()
@@ -136,6 +210,17 @@ func (p *ReaderPool) isTracking(r *LazyBinaryReader) bool {
 	return ok
 }
 
+func (p *ReaderPool) onLazyReaderLoaded(*LazyBinaryReader) {
+	if !p.limitLoadedReaders() {
+		return
+	}
+	// The limits are checked asynchronously, not to close other readers while holding the lock of the loaded one.
+	select {
+	case p.loaded <- struct{}{}:
+	default:
+	}
+}
+
 func (p *ReaderPool) onLazyReaderClosed(r *LazyBinaryReader) {
 	p.lazyReadersMx.Lock()
 	defer p.lazyReadersMx.Unlock()
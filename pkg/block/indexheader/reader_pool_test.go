@@ -5,6 +5,7 @@ package indexheader
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
 	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
 
@@ -59,7 +61,7 @@ func TestReaderPool_NewBinaryReader(t *testing.T) {
 
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
-			pool := NewReaderPool(log.NewNopLogger(), testData.lazyReaderEnabled, testData.lazyReaderIdleTimeout, nil)
+			pool := NewReaderPool(log.NewNopLogger(), testData.lazyReaderEnabled, testData.lazyReaderIdleTimeout, 0, 0, false, nil)
 			defer pool.Close()
 
 			r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3)
@@ -95,7 +97,7 @@ func TestReaderPool_ShouldCloseIdleLazyReaders(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String())))
 
-	pool := NewReaderPool(log.NewNopLogger(), true, idleTimeout, nil)
+	pool := NewReaderPool(log.NewNopLogger(), true, idleTimeout, 0, 0, false, nil)
 	defer pool.Close()
 
 	r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3)
@@ -131,3 +133,100 @@ func TestReaderPool_ShouldCloseIdleLazyReaders(t *testing.T) {
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(pool.lazyReaderMetrics.loadCount))
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(pool.lazyReaderMetrics.unloadCount))
 }
+
+func TestReaderPool_ShouldCloseLeastRecentlyUsedLazyReaders(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "test-indexheader")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(tmpDir)) }()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	// Create blocks.
+	var blockIDs []ulid.ULID
+	for i := 0; i < 3; i++ {
+		blockID, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+			{{Name: "a", Value: "1"}},
+			{{Name: "a", Value: "2"}},
+		}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: fmt.Sprintf("%d", i)}}, 124)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String())))
+		blockIDs = append(blockIDs, blockID)
+	}
+
+	use := func(t *testing.T, r Reader) {
+		labelNames, err := r.LabelNames()
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a"}, labelNames)
+	}
+	isLoaded := func(r Reader) bool {
+		_, ok := r.(*LazyBinaryReader).loadedSize()
+		return ok
+	}
+	waitUnloads := func(t *testing.T, pool *ReaderPool, expected float64) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if promtestutil.ToFloat64(pool.lazyReaderMetrics.unloadCount) >= expected {
+				break
+			}
+		}
+		testutil.Equals(t, expected, promtestutil.ToFloat64(pool.lazyReaderMetrics.unloadCount))
+	}
+
+	t.Run("max loaded", func(t *testing.T) {
+		pool := NewReaderPool(log.NewNopLogger(), true, 0, 2, 0, false, nil)
+		defer pool.Close()
+
+		var readers []Reader
+		for _, id := range blockIDs {
+			r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, id, 3)
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, r.Close()) }()
+			readers = append(readers, r)
+		}
+
+		use(t, readers[0])
+		use(t, readers[1])
+		waitUnloads(t, pool, 0)
+
+		// The least recently used reader is closed.
+		use(t, readers[0])
+		use(t, readers[2])
+		waitUnloads(t, pool, 1)
+		testutil.Assert(t, isLoaded(readers[0]), "expected reader 0 to be loaded")
+		testutil.Assert(t, !isLoaded(readers[1]), "expected reader 1 to be closed")
+		testutil.Assert(t, isLoaded(readers[2]), "expected reader 2 to be loaded")
+		testutil.Assert(t, pool.isTracking(readers[1].(*LazyBinaryReader)))
+
+		// Closed reader is re-opened upon next usage.
+		use(t, readers[1])
+		waitUnloads(t, pool, 2)
+		testutil.Assert(t, !isLoaded(readers[0]), "expected reader 0 to be closed")
+		testutil.Equals(t, float64(4), promtestutil.ToFloat64(pool.lazyReaderMetrics.loadCount))
+	})
+
+	t.Run("max loaded bytes", func(t *testing.T) {
+		r, err := NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockIDs[0], 3)
+		testutil.Ok(t, err)
+		size := int64(r.b.Len())
+		testutil.Ok(t, r.Close())
+
+		pool := NewReaderPool(log.NewNopLogger(), true, 0, 0, 2*size, false, nil)
+		defer pool.Close()
+
+		var readers []Reader
+		for _, id := range blockIDs {
+			r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, id, 3)
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, r.Close()) }()
+			readers = append(readers, r)
+			use(t, r)
+		}
+		waitUnloads(t, pool, 1)
+		testutil.Assert(t, !isLoaded(readers[0]), "expected reader 0 to be closed")
+		testutil.Assert(t, isLoaded(readers[1]), "expected reader 1 to be loaded")
+		testutil.Assert(t, isLoaded(readers[2]), "expected reader 2 to be loaded")
+	})
+}
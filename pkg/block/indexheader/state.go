@@ -0,0 +1,150 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package indexheader
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// The state file caches the postings offsets kept in memory and the label name symbols, so they do not have
+// to be parsed from the whole postings offset table and symbols of the index-header after a restart or lazy
+// reload. It starts with the header of stateHeaderLen bytes, which identifies the block, the index-header and
+// the posting offsets sampling the state is valid for, and ends with the CRC32 of the whole content before it.
+//
+// In between, name symbols are stored as a count followed by symbol offset and label name pairs. Postings offsets
+// are stored as a count of label names, each followed by the offset of its last value and the sampled values with
+// their offsets in the postings offset table.
+const (
+	// StateFilename is the name of the file next to the index-header, which caches the state parsed from it.
+	StateFilename = "index-header-state"
+
+	// MagicState are 4 bytes at the head of an index-header state file.
+	MagicState = 0xBAAAD793
+
+	// StateFormatV1 represents first version of index-header state file.
+	StateFormatV1 = 1
+
+	// stateHeaderLen is the length of magic, version, block ULID, posting offsets sampling,
+	// index-header size and index-header TOC checksum.
+	stateHeaderLen = 4 + 1 + 16 + 4 + 8 + 4
+)
+
+// stateHeader returns the header identifying the state of the given reader.
+func (r *BinaryReader) stateHeader(id ulid.ULID) []byte {
+	e := encoding.Encbuf{B: make([]byte, 0, stateHeaderLen)}
+	e.PutBE32(MagicState)
+	e.PutByte(StateFormatV1)
+	e.B = append(e.B, id[:]...)
+	e.PutBE32int(r.postingOffsetsInMemSampling)
+	e.PutBE64(uint64(r.b.Len()))
+	e.B = append(e.B, r.b.Range(r.b.Len()-crc32.Size, r.b.Len())...)
+	return e.Get()
+}
+
+// writeState persists the parsed postings offsets and label name symbols of the reader into the file in an atomic way.
+func (r *BinaryReader) writeState(fn string, id ulid.ULID) (err error) {
+	e := encoding.Encbuf{B: r.stateHeader(id)}
+
+	e.PutUvarint(len(r.nameSymbols))
+	for off, name := range r.nameSymbols {
+		e.PutUvarint32(off)
+		e.PutUvarintStr(name)
+	}
+
+	e.PutUvarint(len(r.postings))
+	for name, p := range r.postings {
+		e.PutUvarintStr(name)
+		e.PutVarint64(p.lastValOffset)
+		e.PutUvarint(len(p.offsets))
+		for _, o := range p.offsets {
+			e.PutUvarintStr(o.value)
+			e.PutUvarint(o.tableOff)
+		}
+	}
+	e.PutBE32(crc32.Checksum(e.Get(), castagnoliTable))
+
+	tmp := fn + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "create state file")
+	}
+	defer func() {
+		if err != nil {
+			runutil.CloseWithErrCapture(&err, f, "close state file")
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	if _, err := f.Write(e.Get()); err != nil {
+		return errors.Wrap(err, "write state file")
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "sync state file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "close state file")
+	}
+	return os.Rename(tmp, fn)
+}
+
+// readState loads the postings offsets and label name symbols from the file, if it was written for the same
+// block, index-header and posting offsets sampling.
+func (r *BinaryReader) readState(fn string, id ulid.ULID) (err error) {
+	f, err := fileutil.OpenMmapFile(fn)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, f, "close state file")
+
+	b := f.Bytes()
+	if len(b) < stateHeaderLen+crc32.Size {
+		return errors.Wrap(encoding.ErrInvalidSize, "state file")
+	}
+	if exp := r.stateHeader(id); string(b[:stateHeaderLen]) != string(exp) {
+		return errors.New("state file does not match the index-header")
+	}
+	if binary.BigEndian.Uint32(b[len(b)-crc32.Size:]) != crc32.Checksum(b[:len(b)-crc32.Size], castagnoliTable) {
+		return errors.Wrap(encoding.ErrInvalidChecksum, "state file")
+	}
+
+	d := encoding.Decbuf{B: b[stateHeaderLen : len(b)-crc32.Size]}
+
+	// Strings are copied, as they must stay valid after the file is unmapped.
+	cnt := d.Uvarint()
+	nameSymbols := make(map[uint32]string, cnt)
+	for ; d.Err() == nil && cnt > 0; cnt-- {
+		nameSymbols[uint32(d.Uvarint64())] = d.UvarintStr()
+	}
+
+	cnt = d.Uvarint()
+	postings := make(map[string]*postingValueOffsets, cnt)
+	for ; d.Err() == nil && cnt > 0; cnt-- {
+		name := d.UvarintStr()
+		p := &postingValueOffsets{lastValOffset: d.Varint64()}
+		p.offsets = make([]postingOffset, d.Uvarint())
+		for i := range p.offsets {
+			p.offsets[i] = postingOffset{value: d.UvarintStr(), tableOff: d.Uvarint()}
+		}
+		postings[name] = p
+	}
+	if err := d.Err(); err != nil {
+		return errors.Wrap(err, "decode state file")
+	}
+	if d.Len() != 0 {
+		return errors.Errorf("%d unexpected bytes at the end of state file", d.Len())
+	}
+
+	r.nameSymbols = nameSymbols
+	r.postings = postings
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package indexheader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestBinaryReader_StateCache(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "test-indexheader-state")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(tmpDir)) }()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	m := prepareIndexV2Block(t, tmpDir, bkt)
+	statefn := filepath.Join(tmpDir, m.ULID.String(), StateFilename)
+
+	// Without the state cache, nothing is persisted.
+	parsed, err := NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, m.ULID, 32)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, parsed.Close()) }()
+	_, err = os.Stat(statefn)
+	testutil.Assert(t, os.IsNotExist(err), "expected no state file, got %v", err)
+
+	assertSameState := func(t *testing.T, br *BinaryReader) {
+		t.Helper()
+		testutil.Equals(t, parsed.postings, br.postings)
+		testutil.Equals(t, parsed.nameSymbols, br.nameSymbols)
+
+		names, err := br.LabelNames()
+		testutil.Ok(t, err)
+		expNames, err := parsed.LabelNames()
+		testutil.Ok(t, err)
+		testutil.Equals(t, expNames, names)
+
+		for _, name := range names {
+			vals, err := br.LabelValues(name)
+			testutil.Ok(t, err)
+			expVals, err := parsed.LabelValues(name)
+			testutil.Ok(t, err)
+			testutil.Equals(t, expVals, vals)
+
+			rng, err := br.PostingsOffset(name, vals[len(vals)/2])
+			testutil.Ok(t, err)
+			expRng, err := parsed.PostingsOffset(name, vals[len(vals)/2])
+			testutil.Ok(t, err)
+			testutil.Equals(t, expRng, rng)
+		}
+	}
+
+	// State is persisted after parsing and loaded from the file afterwards.
+	br, err := newBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, m.ULID, 32, true)
+	testutil.Ok(t, err)
+	assertSameState(t, br)
+	testutil.Ok(t, br.Close())
+
+	state, err := ioutil.ReadFile(statefn)
+	testutil.Ok(t, err)
+
+	loaded := &BinaryReader{b: parsed.b, postingOffsetsInMemSampling: 32}
+	testutil.Ok(t, loaded.readState(statefn, m.ULID))
+	testutil.Equals(t, parsed.postings, loaded.postings)
+	testutil.Equals(t, parsed.nameSymbols, loaded.nameSymbols)
+
+	br, err = newBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, m.ULID, 32, true)
+	testutil.Ok(t, err)
+	assertSameState(t, br)
+	testutil.Ok(t, br.Close())
+
+	// State of other blocks or samplings is not used.
+	testutil.NotOk(t, loaded.readState(statefn, ulid.MustNew(1, nil)))
+	testutil.NotOk(t, (&BinaryReader{b: parsed.b, postingOffsetsInMemSampling: 16}).readState(statefn, m.ULID))
+
+	br, err = newBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, m.ULID, 16, true)
+	testutil.Ok(t, err)
+	testutil.Ok(t, br.Close())
+	testutil.Ok(t, (&BinaryReader{b: parsed.b, postingOffsetsInMemSampling: 16}).readState(statefn, m.ULID))
+
+	// Corrupted state is detected and rewritten.
+	corrupted := append([]byte{}, state...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	testutil.Ok(t, ioutil.WriteFile(statefn, corrupted, 0600))
+	testutil.NotOk(t, loaded.readState(statefn, m.ULID))
+
+	br, err = newBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, m.ULID, 32, true)
+	testutil.Ok(t, err)
+	assertSameState(t, br)
+	testutil.Ok(t, br.Close())
+	testutil.Ok(t, loaded.readState(statefn, m.ULID))
+}
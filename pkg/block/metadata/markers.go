@@ -67,6 +67,8 @@ const (
 	// IndexSizeExceedingNoCompactReason is a reason of index being too big (for example exceeding 64GB limit: https://github.com/thanos-io/thanos/issues/1424)
 	// This reason can be ignored when vertical block sharding will be implemented.
 	IndexSizeExceedingNoCompactReason = "index-size-exceeding"
+	// CorruptedNoCompactReason is a reason of block index being not healthy (for example with out-of-order chunks), that could not be repaired by the compactor.
+	CorruptedNoCompactReason = "corrupted"
 )
 
 // NoCompactMark marker stores reason of block being excluded from compaction if needed.
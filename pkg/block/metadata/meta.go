@@ -32,6 +32,8 @@ const (
 	CompactorRepairSource SourceType = "compactor.repair"
 	RulerSource           SourceType = "ruler"
 	BucketRepairSource    SourceType = "bucket.repair"
+	BucketRewriteSource   SourceType = "bucket.rewrite"
+	BucketImportSource    SourceType = "bucket.import"
 	TestSource            SourceType = "test"
 )
 
@@ -44,6 +46,15 @@ const (
 	ThanosVersion1 = 1
 )
 
+const (
+	// ProducerAnnotation is the annotation with the name of the host of the Thanos component that produced the block.
+	ProducerAnnotation = "thanos.io/producer"
+	// VersionAnnotation is the annotation with the version of the Thanos component that produced the block.
+	VersionAnnotation = "thanos.io/version"
+	// TenantAnnotation is the annotation with the tenant whose series are in the block, for blocks produced by receive.
+	TenantAnnotation = "thanos.io/tenant"
+)
+
 // Meta describes the a block's meta. It wraps the known TSDB meta structure and
 // extends it by Thanos-specific fields.
 type Meta struct {
@@ -72,6 +83,14 @@ type Thanos struct {
 	// Useful to avoid API call to get size of each file, as well as for debugging purposes.
 	// Optional, added in v0.17.0.
 	Files []File `json:"files,omitempty"`
+
+	// DeletionRequests is a sorted list of the names of the deletion requests applied to the block. Optional.
+	DeletionRequests []string `json:"deletion_requests,omitempty"`
+
+	// Annotations are arbitrary key/values describing the block, e.g. the component, pipeline or tenant that produced it,
+	// to trace the block back to its producer. They are kept when the block is downsampled, rewritten or compacted, the
+	// annotations with different values in the compacted blocks having the JSON list of the distinct values. Optional.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type File struct {
@@ -0,0 +1,415 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package writer builds TSDB blocks with Thanos meta from the series and samples of any source, e.g. to backfill
+// historical data or to build blocks in ETL pipelines. Samples are written to the chunk files of the block as they are
+// appended, only the labels and chunk references of the series are kept in memory until the index is written.
+package writer
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// SamplesPerChunk is the number of samples of the chunks cut by Writer.Append, the same as Prometheus.
+const SamplesPerChunk = 120
+
+// ErrOutOfOrderSample is the cause of the errors of Writer.Append for samples not newer than the previous samples of
+// their series.
+var ErrOutOfOrderSample = errors.New("out of order sample")
+
+// Writer writes a block from the series appended to it. The samples of each series must be appended in time order,
+// the series themselves can be appended in any order and interleaved. Writer is not safe for concurrent use.
+type Writer struct {
+	logger log.Logger
+	dir    string
+	tmpDir string
+	id     ulid.ULID
+	meta   metadata.Thanos
+	// blockMeta is the time range and compaction of the block given to NewFromMeta, nil if they are the ones of the
+	// appended series.
+	blockMeta *tsdb.BlockMeta
+
+	chunkWriter tsdb.ChunkWriter
+	series      map[uint64][]*series
+	mint, maxt  int64
+	stats       tsdb.BlockStats
+	done        bool
+}
+
+type series struct {
+	lset labels.Labels
+	// chks are the chunks of the series written to the chunk files, without their data.
+	chks []chunks.Meta
+	// head is the chunk samples are appended to, nil if none was appended since the last cut.
+	head     chunkenc.Chunk
+	app      chunkenc.Appender
+	headMint int64
+	maxt     int64
+}
+
+// New creates a Writer writing a block with the given Thanos meta in dir. Aggregated chunks of downsampled blocks
+// can only be appended with AppendChunks if meta has a resolution greater than 0. Call Flush to write the block, and
+// Close to release the resources of the writer and to remove the partially written block if not flushed.
+func New(logger log.Logger, dir string, meta metadata.Thanos) (*Writer, error) {
+	return NewWithChunkSegmentSize(logger, dir, meta, chunks.DefaultChunkSegmentSize)
+}
+
+// NewWithChunkSegmentSize is like New, with chunk files of the given size instead of the 512MiB of Prometheus. Chunk
+// files are preallocated, so smaller ones save disk space when writing many small blocks at once.
+func NewWithChunkSegmentSize(logger log.Logger, dir string, meta metadata.Thanos, chunkSegmentSize int64) (*Writer, error) {
+	return newWriter(logger, dir, ulid.MustNew(ulid.Now(), rand.Reader), meta, chunkSegmentSize)
+}
+
+// NewFromMeta is like New, but the block keeps the ULID, if set, time range and compaction of the given meta instead
+// of the ones of the appended series, e.g. for blocks rewritten from another block like downsampled blocks. The block
+// is written even if no series were appended, and the labels of the series are not checked against the external
+// labels.
+func NewFromMeta(logger log.Logger, dir string, meta metadata.Meta) (*Writer, error) {
+	if meta.ULID == (ulid.ULID{}) {
+		meta.ULID = ulid.MustNew(ulid.Now(), rand.Reader)
+	}
+	// The files are gathered again when the block is uploaded.
+	meta.Thanos.Files = nil
+	w, err := newWriter(logger, dir, meta.ULID, meta.Thanos, chunks.DefaultChunkSegmentSize)
+	if err != nil {
+		return nil, err
+	}
+	w.blockMeta = &tsdb.BlockMeta{MinTime: meta.MinTime, MaxTime: meta.MaxTime, Compaction: meta.Compaction}
+	return w, nil
+}
+
+func newWriter(logger log.Logger, dir string, id ulid.ULID, meta metadata.Thanos, chunkSegmentSize int64) (*Writer, error) {
+	if meta.Version == 0 {
+		meta.Version = metadata.ThanosVersion1
+	}
+	tmpDir := filepath.Join(dir, id.String()+".tmp")
+	if err := os.MkdirAll(tmpDir, 0750); err != nil {
+		return nil, errors.Wrap(err, "create block dir")
+	}
+	chunkWriter, err := chunks.NewWriterWithSegSize(filepath.Join(tmpDir, block.ChunksDirname), chunkSegmentSize)
+	if err != nil {
+		if rerr := os.RemoveAll(tmpDir); rerr != nil {
+			level.Warn(logger).Log("msg", "failed to remove block dir", "dir", tmpDir, "err", rerr)
+		}
+		return nil, errors.Wrap(err, "create chunk writer")
+	}
+	return &Writer{
+		logger:      logger,
+		dir:         dir,
+		tmpDir:      tmpDir,
+		id:          id,
+		meta:        meta,
+		chunkWriter: chunkWriter,
+		series:      map[uint64][]*series{},
+		mint:        math.MaxInt64,
+		maxt:        math.MinInt64,
+	}, nil
+}
+
+// getOrCreate returns the series with the given labels, creating it if it was not appended yet.
+func (w *Writer) getOrCreate(lset labels.Labels) (*series, error) {
+	h := lset.Hash()
+	for _, s := range w.series[h] {
+		if labels.Equal(s.lset, lset) {
+			return s, nil
+		}
+	}
+
+	if len(lset) == 0 {
+		return nil, errors.New("empty labels")
+	}
+	for i, l := range lset {
+		if l.Name == "" || l.Value == "" {
+			return nil, errors.Errorf("empty label name or value in series %s", lset)
+		}
+		if i > 0 && lset[i-1].Name >= l.Name {
+			return nil, errors.Errorf("labels of series %s are not sorted or have duplicate names", lset)
+		}
+		// Blocks rewritten from other blocks can have series with external labels, e.g. the ones uploaded by sidecars.
+		if _, ok := w.meta.Labels[l.Name]; ok && w.blockMeta == nil {
+			return nil, errors.Errorf("series %s has external label %s", lset, l.Name)
+		}
+	}
+
+	s := &series{lset: lset.Copy(), maxt: math.MinInt64}
+	w.series[h] = append(w.series[h], s)
+	return s, nil
+}
+
+// Append appends a sample to the series with the given labels. The labels must be sorted and must not contain the
+// external labels of the block. The sample must be newer than the previous samples of the series, otherwise an error
+// caused by ErrOutOfOrderSample is returned.
+func (w *Writer) Append(lset labels.Labels, t int64, v float64) error {
+	if w.done {
+		return errors.New("writer is flushed or closed")
+	}
+	if w.meta.Downsample.Resolution != 0 {
+		return errors.Errorf("samples can only be appended to raw blocks, append aggregated chunks to blocks of resolution %d", w.meta.Downsample.Resolution)
+	}
+	s, err := w.getOrCreate(lset)
+	if err != nil {
+		return err
+	}
+	if t <= s.maxt {
+		return errors.Wrapf(ErrOutOfOrderSample, "sample of series %s at %d is not newer than the previous sample at %d", s.lset, t, s.maxt)
+	}
+
+	if s.head == nil {
+		s.head = chunkenc.NewXORChunk()
+		if s.app, err = s.head.Appender(); err != nil {
+			return errors.Wrap(err, "create chunk appender")
+		}
+		s.headMint = t
+	}
+	s.app.Append(t, v)
+	s.maxt = t
+	w.addTime(t, t)
+	w.stats.NumSamples++
+
+	if s.head.NumSamples() >= SamplesPerChunk {
+		return w.cut(s)
+	}
+	return nil
+}
+
+// AppendChunks appends already encoded chunks to the series with the given labels, e.g. the aggregated chunks of
+// downsampled blocks. The chunks must be sorted by time, not overlap, and be newer than the previous samples of the
+// series. Their encoding must match the resolution of the block.
+func (w *Writer) AppendChunks(lset labels.Labels, chks ...chunks.Meta) error {
+	if w.done {
+		return errors.New("writer is flushed or closed")
+	}
+	s, err := w.getOrCreate(lset)
+	if err != nil {
+		return err
+	}
+	if err := w.cut(s); err != nil {
+		return err
+	}
+
+	for _, c := range chks {
+		if c.Chunk == nil {
+			return errors.Errorf("chunk [%d, %d] of series %s has no data", c.MinTime, c.MaxTime, s.lset)
+		}
+		// Raw blocks have XOR chunks only, downsampled blocks have aggregated chunks only.
+		if raw := w.meta.Downsample.Resolution == 0; raw != (c.Chunk.Encoding() == chunkenc.EncXOR) {
+			return errors.Errorf("chunk of series %s with encoding %s does not match the resolution %d of the block", s.lset, c.Chunk.Encoding(), w.meta.Downsample.Resolution)
+		}
+		if c.MinTime > c.MaxTime || c.MinTime <= s.maxt {
+			return errors.Errorf("chunk [%d, %d] of series %s is not newer than the previous samples at %d", c.MinTime, c.MaxTime, s.lset, s.maxt)
+		}
+		if err := w.write(s, c); err != nil {
+			return err
+		}
+		s.maxt = c.MaxTime
+		w.addTime(c.MinTime, c.MaxTime)
+		w.stats.NumSamples += uint64(c.Chunk.NumSamples())
+	}
+	return nil
+}
+
+// AppendSeries appends all the samples of the given series.
+func (w *Writer) AppendSeries(s storage.Series) error {
+	it := s.Iterator()
+	for it.Next() {
+		t, v := it.At()
+		if err := w.Append(s.Labels(), t, v); err != nil {
+			return err
+		}
+	}
+	return errors.Wrapf(it.Err(), "iterate series %s", s.Labels())
+}
+
+func (w *Writer) addTime(mint, maxt int64) {
+	if mint < w.mint {
+		w.mint = mint
+	}
+	if maxt > w.maxt {
+		w.maxt = maxt
+	}
+}
+
+// cut writes the head chunk of the series, if any.
+func (w *Writer) cut(s *series) error {
+	if s.head == nil {
+		return nil
+	}
+	c := chunks.Meta{MinTime: s.headMint, MaxTime: s.maxt, Chunk: s.head}
+	s.head, s.app = nil, nil
+	return w.write(s, c)
+}
+
+// write writes the chunk of the series to the chunk files, keeping only its reference and time range in memory.
+func (w *Writer) write(s *series, c chunks.Meta) error {
+	s.chks = append(s.chks, c)
+	if err := w.chunkWriter.WriteChunks(s.chks[len(s.chks)-1:]...); err != nil {
+		return errors.Wrapf(err, "write chunk of series %s", s.lset)
+	}
+	s.chks[len(s.chks)-1].Chunk = nil
+	w.stats.NumChunks++
+	return nil
+}
+
+// Flush writes the index and meta.json of the block and moves it to its final directory in dir. It returns the ID of
+// the block. No more series can be appended afterwards.
+func (w *Writer) Flush(ctx context.Context) (_ ulid.ULID, err error) {
+	if w.done {
+		return ulid.ULID{}, errors.New("writer is flushed or closed")
+	}
+	w.done = true
+	chunksClosed := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if !chunksClosed {
+			runutil.CloseWithLogOnErr(w.logger, w.chunkWriter, "chunk writer")
+		}
+		w.remove()
+	}()
+
+	all := make([]*series, 0, len(w.series))
+	symbols := map[string]struct{}{}
+	for _, ss := range w.series {
+		for _, s := range ss {
+			if err := w.cut(s); err != nil {
+				return ulid.ULID{}, err
+			}
+			// Series AppendChunks was called for with no chunks are not written.
+			if len(s.chks) == 0 {
+				continue
+			}
+			all = append(all, s)
+			for _, l := range s.lset {
+				symbols[l.Name] = struct{}{}
+				symbols[l.Value] = struct{}{}
+			}
+		}
+	}
+	if len(all) == 0 && w.blockMeta == nil {
+		return ulid.ULID{}, errors.New("no samples appended")
+	}
+	w.stats.NumSeries = uint64(len(all))
+
+	bm := tsdb.BlockMeta{
+		MinTime: w.mint,
+		// Blocks are half-open: [MinTime, MaxTime).
+		MaxTime: w.maxt + 1,
+		Compaction: tsdb.BlockMetaCompaction{
+			Level:   1,
+			Sources: []ulid.ULID{w.id},
+		},
+	}
+	if w.blockMeta != nil {
+		bm = *w.blockMeta
+	}
+
+	chunksClosed = true
+	if err := w.chunkWriter.Close(); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "close chunk writer")
+	}
+	if err := w.writeIndex(ctx, all, symbols); err != nil {
+		return ulid.ULID{}, err
+	}
+
+	bm.ULID = w.id
+	bm.Stats = w.stats
+	bm.Version = metadata.TSDBVersion1
+	meta := metadata.Meta{BlockMeta: bm, Thanos: w.meta}
+	meta.Thanos.SegmentFiles = block.GetSegmentFiles(w.tmpDir)
+	if err := meta.WriteToDir(w.logger, w.tmpDir); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write meta.json")
+	}
+	if err := syncDir(w.tmpDir); err != nil {
+		return ulid.ULID{}, err
+	}
+	if err := fileutil.Replace(w.tmpDir, filepath.Join(w.dir, w.id.String())); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "rename block dir")
+	}
+
+	level.Info(w.logger).Log(
+		"msg", "wrote block",
+		"ulid", w.id,
+		"mint", timestamp.Time(bm.MinTime),
+		"maxt", timestamp.Time(bm.MaxTime),
+		"series", w.stats.NumSeries,
+		"samples", w.stats.NumSamples,
+		"resolution", w.meta.Downsample.Resolution,
+	)
+	return w.id, nil
+}
+
+// writeIndex writes the index of the block with the given series, sorted by their labels as required by TSDB.
+func (w *Writer) writeIndex(ctx context.Context, all []*series, symbols map[string]struct{}) (err error) {
+	indexWriter, err := index.NewWriter(ctx, filepath.Join(w.tmpDir, block.IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "create index writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexWriter, "index writer")
+
+	syms := make([]string, 0, len(symbols))
+	for s := range symbols {
+		syms = append(syms, s)
+	}
+	sort.Strings(syms)
+	for _, s := range syms {
+		if err := indexWriter.AddSymbol(s); err != nil {
+			return errors.Wrap(err, "add symbol")
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool { return labels.Compare(all[i].lset, all[j].lset) < 0 })
+	for i, s := range all {
+		if err := indexWriter.AddSeries(uint64(i), s.lset, s.chks...); err != nil {
+			return errors.Wrapf(err, "add series %s", s.lset)
+		}
+	}
+	return nil
+}
+
+func syncDir(dir string) (err error) {
+	df, err := fileutil.OpenDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "open block dir")
+	}
+	defer runutil.CloseWithErrCapture(&err, df, "block dir")
+	return errors.Wrap(fileutil.Fdatasync(df), "sync block dir")
+}
+
+func (w *Writer) remove() {
+	if err := os.RemoveAll(w.tmpDir); err != nil {
+		level.Warn(w.logger).Log("msg", "failed to remove partially written block", "dir", w.tmpDir, "err", err)
+	}
+}
+
+// Close releases the resources of the writer. If the block was not flushed, the partially written block is removed.
+func (w *Writer) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer w.remove()
+	return w.chunkWriter.Close()
+}
@@ -0,0 +1,225 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package writer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/block/writer"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type sample struct {
+	t int64
+	v float64
+}
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "block-writer")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	w, err := writer.New(log.NewNopLogger(), dir, metadata.Thanos{
+		Labels:     map[string]string{"cluster": "eu-1"},
+		Downsample: metadata.ThanosDownsample{Resolution: downsample.ResLevel0},
+		Source:     metadata.BucketImportSource,
+	})
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, w.Close()) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "api"),
+		labels.FromStrings("__name__", "up", "job", "db"),
+	}
+	// Series are appended interleaved and in reverse order of their labels.
+	exp := map[string][]sample{}
+	for i := int64(0); i < 300; i++ {
+		for j := len(series) - 1; j >= 0; j-- {
+			s := sample{t: 1000 + i*15000, v: float64(i * int64(j+1))}
+			testutil.Ok(t, w.Append(series[j], s.t, s.v))
+			exp[series[j].String()] = append(exp[series[j].String()], s)
+		}
+	}
+
+	err = w.Append(series[0], 1000, 1)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, writer.ErrOutOfOrderSample, errors.Cause(err))
+	testutil.NotOk(t, w.Append(labels.FromStrings("__name__", "up", "cluster", "eu-2"), 1000, 1))
+	testutil.NotOk(t, w.Append(labels.Labels{{Name: "job", Value: "api"}, {Name: "__name__", Value: "up"}}, 1000, 1))
+	testutil.NotOk(t, w.Append(labels.FromStrings("__name__", "up", "job", ""), 1000, 1))
+
+	id, err := w.Flush(context.Background())
+	testutil.Ok(t, err)
+	testutil.NotOk(t, w.Append(series[0], 10e6, 1))
+	_, err = os.Stat(filepath.Join(dir, id.String()+".tmp"))
+	testutil.Assert(t, os.IsNotExist(err), "temporary block dir should be renamed")
+
+	bdir := filepath.Join(dir, id.String())
+	meta, err := metadata.Read(bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, id, meta.ULID)
+	testutil.Equals(t, int64(1000), meta.MinTime)
+	testutil.Equals(t, int64(1000+299*15000+1), meta.MaxTime)
+	testutil.Equals(t, tsdb.BlockStats{NumSeries: 2, NumSamples: 600, NumChunks: 6}, meta.Stats)
+	testutil.Equals(t, metadata.Thanos{
+		Version:      metadata.ThanosVersion1,
+		Labels:       map[string]string{"cluster": "eu-1"},
+		Downsample:   metadata.ThanosDownsample{Resolution: downsample.ResLevel0},
+		Source:       metadata.BucketImportSource,
+		SegmentFiles: []string{"000001"},
+	}, meta.Thanos)
+	testutil.Ok(t, block.VerifyIndex(log.NewNopLogger(), filepath.Join(bdir, block.IndexFilename), meta.MinTime, meta.MaxTime))
+
+	b, err := tsdb.OpenBlock(log.NewNopLogger(), bdir, nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	q, err := tsdb.NewBlockQuerier(b, meta.MinTime, meta.MaxTime)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+
+	set := q.Select(true, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"))
+	var got []labels.Labels
+	for set.Next() {
+		got = append(got, set.At().Labels())
+		testutil.Equals(t, exp[set.At().Labels().String()], expandSeries(t, set.At()))
+	}
+	testutil.Ok(t, set.Err())
+	testutil.Equals(t, series, got)
+}
+
+func TestWriter_AppendChunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "block-writer")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	lset := labels.FromStrings("__name__", "up")
+	newChunk := func(mint, maxt int64) chunks.Meta {
+		var aggrs [5]chunkenc.Chunk
+		for i := range aggrs {
+			c := chunkenc.NewXORChunk()
+			app, err := c.Appender()
+			testutil.Ok(t, err)
+			for ts := mint; ts <= maxt; ts += downsample.ResLevel1 {
+				app.Append(ts, 1)
+			}
+			aggrs[i] = c
+		}
+		return chunks.Meta{MinTime: mint, MaxTime: maxt, Chunk: downsample.EncodeAggrChunk(aggrs)}
+	}
+
+	w, err := writer.New(log.NewNopLogger(), dir, metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: downsample.ResLevel1}})
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, w.Close()) }()
+
+	testutil.NotOk(t, w.Append(lset, 0, 1))
+	testutil.Ok(t, w.AppendChunks(lset, newChunk(0, 10*downsample.ResLevel1), newChunk(11*downsample.ResLevel1, 20*downsample.ResLevel1)))
+	testutil.NotOk(t, w.AppendChunks(lset, newChunk(15*downsample.ResLevel1, 30*downsample.ResLevel1)))
+
+	raw := chunkenc.NewXORChunk()
+	testutil.NotOk(t, w.AppendChunks(lset, chunks.Meta{MinTime: 100 * downsample.ResLevel1, MaxTime: 100 * downsample.ResLevel1, Chunk: raw}))
+
+	id, err := w.Flush(context.Background())
+	testutil.Ok(t, err)
+	meta, err := metadata.Read(filepath.Join(dir, id.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, tsdb.BlockStats{NumSeries: 1, NumSamples: 21, NumChunks: 2}, meta.Stats)
+	testutil.Equals(t, downsample.ResLevel1, meta.Thanos.Downsample.Resolution)
+}
+
+func TestWriter_NewFromMeta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "block-writer")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	orig := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustNew(1, nil),
+			MinTime: 0,
+			MaxTime: 2 * time.Hour.Milliseconds(),
+			Compaction: tsdb.BlockMetaCompaction{
+				Level:   2,
+				Sources: []ulid.ULID{ulid.MustNew(2, nil), ulid.MustNew(3, nil)},
+			},
+		},
+		Thanos: metadata.Thanos{
+			Labels: map[string]string{"cluster": "eu-1"},
+			Source: metadata.CompactorSource,
+			Files:  []metadata.File{{RelPath: "index", SizeBytes: 1}},
+		},
+	}
+
+	// The time range and compaction of the meta are kept, and the block is written even without series.
+	for _, lset := range []labels.Labels{labels.FromStrings("__name__", "up", "cluster", "eu-1"), nil} {
+		w, err := writer.NewFromMeta(log.NewNopLogger(), dir, orig)
+		testutil.Ok(t, err)
+		expSeries := uint64(0)
+		if lset != nil {
+			// Series of rewritten blocks can have external labels.
+			testutil.Ok(t, w.Append(lset, 1000, 1))
+			expSeries = 1
+		}
+		id, err := w.Flush(context.Background())
+		testutil.Ok(t, err)
+		testutil.Ok(t, w.Close())
+		testutil.Equals(t, orig.ULID, id)
+
+		meta, err := metadata.Read(filepath.Join(dir, id.String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, orig.MinTime, meta.MinTime)
+		testutil.Equals(t, orig.MaxTime, meta.MaxTime)
+		testutil.Equals(t, orig.Compaction, meta.Compaction)
+		testutil.Equals(t, 0, len(meta.Thanos.Files))
+		testutil.Equals(t, expSeries, meta.Stats.NumSeries)
+		testutil.Ok(t, os.RemoveAll(filepath.Join(dir, id.String())))
+	}
+}
+
+func TestWriter_Close(t *testing.T) {
+	dir, err := ioutil.TempDir("", "block-writer")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	// Flushing nothing fails, closing the writer removes the partially written blocks.
+	w, err := writer.New(log.NewNopLogger(), dir, metadata.Thanos{})
+	testutil.Ok(t, err)
+	_, err = w.Flush(context.Background())
+	testutil.NotOk(t, err)
+	testutil.Ok(t, w.Close())
+
+	w, err = writer.New(log.NewNopLogger(), dir, metadata.Thanos{})
+	testutil.Ok(t, err)
+	testutil.Ok(t, w.Append(labels.FromStrings("__name__", "up"), 0, 1))
+	testutil.Ok(t, w.Close())
+
+	files, err := ioutil.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(files))
+}
+
+func expandSeries(t *testing.T, s storage.Series) (res []sample) {
+	it := s.Iterator()
+	for it.Next() {
+		ts, v := it.At()
+		res = append(res, sample{t: ts, v: v})
+	}
+	testutil.Ok(t, it.Err())
+	return res
+}
@@ -0,0 +1,529 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/groupcache"
+	"github.com/golang/groupcache/consistenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/model"
+	thanostls "github.com/thanos-io/thanos/pkg/tls"
+)
+
+// GroupcacheBasePath is the HTTP path under which the peers serve the groupcache requests.
+const GroupcacheBasePath = "/_groupcache/"
+
+const groupcacheReplicas = 50
+
+var (
+	errGroupcacheNoSelfAddress = errors.New("no self address configured for groupcache")
+	errGroupcacheNoListen      = errors.New("no listen address configured for groupcache")
+	errGroupcacheNoGroup       = errors.New("no group name configured for groupcache")
+	errGroupcacheMaxSize       = errors.New("groupcache max size must be positive")
+
+	defaultGroupcacheConfig = GroupcacheConfig{
+		MaxSize:                   250 * 1024 * 1024,
+		Timeout:                   2 * time.Second,
+		MaxGetConcurrency:         100,
+		DNSProviderUpdateInterval: 30 * time.Second,
+	}
+
+	// Groupcache groups and peer pickers are registered globally, so peer pickers of all the groups
+	// are kept here, as groupcache allows to register the peer picker function only once.
+	registerPeerPickerOnce sync.Once
+	peerPickersMtx         sync.Mutex
+	peerPickers            = map[string]groupcache.PeerPicker{}
+)
+
+// GroupcacheConfig is the config accepted by Groupcache.
+type GroupcacheConfig struct {
+	// Peers specifies the list of addresses of all the peers sharing the cache, including this one.
+	// The addresses get resolved with the DNS provider.
+	Peers []string `yaml:"peers"`
+
+	// SelfAddress specifies the address of this instance, as resolved from the peers.
+	SelfAddress string `yaml:"self_address"`
+
+	// ListenAddress specifies the address the requests of the peers are served on. It is separate from the
+	// HTTP server of the component, so that the access to the cached items can be restricted to the peers.
+	ListenAddress string `yaml:"listen_address"`
+
+	// TLSConfig configures mutual TLS between the peers.
+	TLSConfig GroupcacheTLSConfig `yaml:"tls_config"`
+
+	// GroupName specifies the name of the group. Peers share the cached items of the same group only.
+	GroupName string `yaml:"groupcache_group"`
+
+	// MaxSize specifies the maximum size of the items cached by this instance.
+	MaxSize model.Bytes `yaml:"max_size"`
+
+	// Timeout specifies the timeout of requests to the peers.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MaxGetConcurrency specifies the maximum number of items fetched concurrently by a single Fetch() call.
+	MaxGetConcurrency int `yaml:"max_get_concurrency"`
+
+	// DNSProviderUpdateInterval specifies the DNS discovery update interval.
+	DNSProviderUpdateInterval time.Duration `yaml:"dns_provider_update_interval"`
+}
+
+// GroupcacheTLSConfig configures the TLS of the requests between the peers. Both the server and the client
+// certificates are verified with the CA, so that only the peers can fetch the cached items.
+type GroupcacheTLSConfig struct {
+	// CertFile is the path to the certificate presented by this instance to the peers, both as server and client.
+	CertFile string `yaml:"cert_file"`
+	// KeyFile is the path to the key of the certificate.
+	KeyFile string `yaml:"key_file"`
+	// CAFile is the path to the CA verifying the certificates of the peers.
+	CAFile string `yaml:"ca_file"`
+	// ServerName is the name the certificates of the peers are verified against, the peer host by default.
+	ServerName string `yaml:"server_name"`
+}
+
+func (c *GroupcacheTLSConfig) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+func (c *GroupcacheConfig) validate() error {
+	if c.SelfAddress == "" {
+		return errGroupcacheNoSelfAddress
+	}
+	if c.ListenAddress == "" {
+		return errGroupcacheNoListen
+	}
+	if c.TLSConfig.enabled() && (c.TLSConfig.CertFile == "" || c.TLSConfig.KeyFile == "" || c.TLSConfig.CAFile == "") {
+		return errors.New("groupcache tls_config requires cert_file, key_file and ca_file")
+	}
+	if c.GroupName == "" {
+		return errGroupcacheNoGroup
+	}
+	if c.MaxSize <= 0 {
+		return errGroupcacheMaxSize
+	}
+	// Avoid panic in time ticker.
+	if c.DNSProviderUpdateInterval <= 0 {
+		return errors.New("DNS provider update interval must be positive")
+	}
+	if c.MaxGetConcurrency <= 0 {
+		return errors.New("max get concurrency must be positive")
+	}
+	return nil
+}
+
+// parseGroupcacheConfig unmarshals a buffer into a GroupcacheConfig with default values.
+func parseGroupcacheConfig(conf []byte) (GroupcacheConfig, error) {
+	config := defaultGroupcacheConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return GroupcacheConfig{}, err
+	}
+	return config, nil
+}
+
+// GroupcacheLoader loads the data identified by the key on a cache miss, e.g. from the object storage.
+// The data has to be immutable, as cached items never expire and are only evicted when the cache is full.
+type GroupcacheLoader func(ctx context.Context, key string) ([]byte, error)
+
+// Groupcache is a read-through cache shared by the peers, where each key is owned by a single peer, which
+// loads the data on a miss and caches it. Concurrent fetches of the same key are deduplicated, so the data
+// is loaded once, even if the peers fetch it at the same time.
+type Groupcache struct {
+	logger log.Logger
+	config GroupcacheConfig
+	group  *groupcache.Group
+	peers  *groupcachePeers
+	server *http.Server
+
+	// DNS provider used to keep the peers list updated.
+	dnsProvider *dns.Provider
+
+	// Channel used to notify internal goroutines when they should quit.
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// NewGroupcache makes a new Groupcache, loading missing items with loader. The requests of the peers are
+// served on the listen address until the cache is stopped.
+func NewGroupcache(logger log.Logger, reg prometheus.Registerer, conf []byte, loader GroupcacheLoader) (*Groupcache, error) {
+	config, err := parseGroupcacheConfig(conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse groupcache config")
+	}
+	return NewGroupcacheWithConfig(logger, reg, config, loader)
+}
+
+// NewGroupcacheWithConfig makes a new Groupcache.
+func NewGroupcacheWithConfig(logger log.Logger, reg prometheus.Registerer, config GroupcacheConfig, loader GroupcacheLoader) (*Groupcache, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", config.ListenAddress)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listen on groupcache address %s", config.ListenAddress)
+	}
+	c, err := newGroupcache(logger, reg, config, l, loader)
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newGroupcache(logger log.Logger, reg prometheus.Registerer, config GroupcacheConfig, l net.Listener, loader GroupcacheLoader) (*Groupcache, error) {
+	if groupcache.GetGroup(config.GroupName) != nil {
+		return nil, errors.Errorf("groupcache group %s already exists", config.GroupName)
+	}
+
+	var (
+		scheme    = "http"
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		serverTLS *tls.Config
+	)
+	if config.TLSConfig.enabled() {
+		var err error
+		if serverTLS, err = thanostls.NewServerConfig(logger, config.TLSConfig.CertFile, config.TLSConfig.KeyFile, config.TLSConfig.CAFile); err != nil {
+			return nil, errors.Wrap(err, "groupcache server TLS")
+		}
+		if transport.TLSClientConfig, err = thanostls.NewClientConfig(logger, config.TLSConfig.CertFile, config.TLSConfig.KeyFile, config.TLSConfig.CAFile, config.TLSConfig.ServerName); err != nil {
+			return nil, errors.Wrap(err, "groupcache client TLS")
+		}
+		scheme = "https"
+		l = tls.NewListener(l, serverTLS)
+	}
+
+	if reg != nil {
+		reg = prometheus.WrapRegistererWith(prometheus.Labels{"name": config.GroupName}, reg)
+	}
+
+	c := &Groupcache{
+		logger: logger,
+		config: config,
+		peers: &groupcachePeers{
+			self:   config.SelfAddress,
+			scheme: scheme,
+			client: &http.Client{Timeout: config.Timeout, Transport: transport},
+		},
+		dnsProvider: dns.NewProvider(
+			logger,
+			extprom.WrapRegistererWithPrefix("thanos_cache_groupcache_", reg),
+			dns.GolangResolverType,
+		),
+		stop: make(chan struct{}),
+	}
+
+	registerPeerPickerOnce.Do(func() {
+		groupcache.RegisterPerGroupPeerPicker(func(groupName string) groupcache.PeerPicker {
+			peerPickersMtx.Lock()
+			defer peerPickersMtx.Unlock()
+
+			if p, ok := peerPickers[groupName]; ok {
+				return p
+			}
+			return groupcache.NoPeers{}
+		})
+	})
+	peerPickersMtx.Lock()
+	peerPickers[config.GroupName] = c.peers
+	peerPickersMtx.Unlock()
+
+	c.group = groupcache.NewGroup(config.GroupName, int64(config.MaxSize), groupcache.GetterFunc(func(ctx context.Context, key string, dest groupcache.Sink) error {
+		data, err := loader(ctx, key)
+		if err != nil {
+			return err
+		}
+		return dest.SetBytes(data)
+	}))
+	c.registerMetrics(reg)
+
+	mux := http.NewServeMux()
+	mux.Handle(GroupcacheBasePath, c)
+	c.server = &http.Server{Handler: mux, TLSConfig: serverTLS}
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		if err := c.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			level.Error(logger).Log("msg", "groupcache server failed", "err", err)
+		}
+	}()
+
+	// A failed resolution is not fatal, as the peers may not be ready yet: items owned by unknown
+	// peers are loaded locally until the next resolution.
+	if err := c.resolvePeers(); err != nil {
+		level.Warn(logger).Log("msg", "failed to resolve groupcache peers", "err", err)
+	}
+
+	c.workers.Add(1)
+	go c.resolvePeersLoop()
+
+	level.Info(logger).Log("msg", "created groupcache", "group", config.GroupName, "self", config.SelfAddress, "listen", l.Addr().String())
+	return c, nil
+}
+
+func (c *Groupcache) registerMetrics(reg prometheus.Registerer) {
+	stats := &c.group.Stats
+	for _, m := range []struct {
+		name, help string
+		val        *groupcache.AtomicInt
+	}{
+		{name: "thanos_cache_groupcache_gets_total", help: "Total number of items requests to groupcache, including the requests of the peers.", val: &stats.Gets},
+		{name: "thanos_cache_groupcache_hits_total", help: "Total number of items requests to groupcache that were a hit of the local cache.", val: &stats.CacheHits},
+		{name: "thanos_cache_groupcache_peer_loads_total", help: "Total number of items loaded from the peers.", val: &stats.PeerLoads},
+		{name: "thanos_cache_groupcache_peer_errors_total", help: "Total number of failed requests to the peers.", val: &stats.PeerErrors},
+		{name: "thanos_cache_groupcache_loads_total", help: "Total number of items loads after deduplication of concurrent requests.", val: &stats.LoadsDeduped},
+		{name: "thanos_cache_groupcache_local_loads_total", help: "Total number of items loaded by this instance.", val: &stats.LocalLoads},
+		{name: "thanos_cache_groupcache_local_load_errors_total", help: "Total number of failed loads of items by this instance.", val: &stats.LocalLoadErrs},
+		{name: "thanos_cache_groupcache_server_requests_total", help: "Total number of items requests served to the peers.", val: &stats.ServerRequests},
+	} {
+		val := m.val
+		promauto.With(reg).NewCounterFunc(prometheus.CounterOpts{Name: m.name, Help: m.help}, func() float64 {
+			return float64(val.Get())
+		})
+	}
+
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_cache_groupcache_bytes",
+		Help: "Size of the items cached by this instance in bytes.",
+	}, func() float64 {
+		return float64(c.group.CacheStats(groupcache.MainCache).Bytes + c.group.CacheStats(groupcache.HotCache).Bytes)
+	})
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_cache_groupcache_items",
+		Help: "Number of the items cached by this instance.",
+	}, func() float64 {
+		return float64(c.group.CacheStats(groupcache.MainCache).Items + c.group.CacheStats(groupcache.HotCache).Items)
+	})
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_cache_groupcache_peers",
+		Help: "Number of the peers sharing the cache, including this instance.",
+	}, func() float64 {
+		return float64(c.peers.count())
+	})
+}
+
+// Store is a no-op, as the items are loaded by the peer owning them on a miss.
+func (c *Groupcache) Store(context.Context, map[string][]byte, time.Duration) {}
+
+// Fetch fetches multiple keys from the peers owning them, loading the missing ones, and returns a map
+// containing the fetched items. Keys failing to be fetched or loaded are logged and missing in the map.
+func (c *Groupcache) Fetch(ctx context.Context, keys []string) map[string][]byte {
+	var (
+		mtx     sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string][]byte, len(keys))
+		gate    = make(chan struct{}, c.config.MaxGetConcurrency)
+	)
+	for _, key := range keys {
+		select {
+		case gate <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return results
+		}
+
+		wg.Add(1)
+		go func(key string) {
+			defer func() {
+				<-gate
+				wg.Done()
+			}()
+
+			var data []byte
+			if err := c.group.Get(ctx, key, groupcache.AllocatingByteSliceSink(&data)); err != nil {
+				level.Debug(c.logger).Log("msg", "failed to fetch item from groupcache", "key", key, "err", err)
+				return
+			}
+
+			mtx.Lock()
+			results[key] = data
+			mtx.Unlock()
+		}(key)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// ServeHTTP serves the requests of the peers for items owned by this instance.
+func (c *Groupcache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, GroupcacheBasePath), "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if parts[0] != c.config.GroupName {
+		http.Error(w, "no such group: "+parts[0], http.StatusNotFound)
+		return
+	}
+
+	c.group.Stats.ServerRequests.Add(1)
+	var data []byte
+	if err := c.group.Get(r.Context(), parts[1], groupcache.AllocatingByteSliceSink(&data)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := proto.Marshal(&pb.GetResponse{Value: data})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(body)
+}
+
+// Stop stops serving the peers and the discovery of the peers.
+func (c *Groupcache) Stop() {
+	close(c.stop)
+	_ = c.server.Close()
+	c.workers.Wait()
+}
+
+func (c *Groupcache) resolvePeersLoop() {
+	defer c.workers.Done()
+
+	ticker := time.NewTicker(c.config.DNSProviderUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.resolvePeers(); err != nil {
+				level.Warn(c.logger).Log("msg", "failed to update groupcache peers list", "err", err)
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Groupcache) resolvePeers() error {
+	// Resolve configured addresses with a reasonable timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := c.dnsProvider.Resolve(ctx, c.config.Peers)
+	if err != nil {
+		err = errors.Wrapf(err, "resolve peers %s", strings.Join(c.config.Peers, ","))
+	}
+	// Keep using the addresses resolved successfully.
+	c.peers.set(c.dnsProvider.Addresses())
+	return err
+}
+
+// groupcachePeers picks the peer owning the key using consistent hashing on the addresses of the peers.
+type groupcachePeers struct {
+	self   string
+	scheme string
+	client *http.Client
+
+	mtx     sync.RWMutex
+	addrs   []string
+	ring    *consistenthash.Map
+	getters map[string]*groupcacheGetter
+}
+
+func (p *groupcachePeers) set(addrs []string) {
+	// This instance is always one of the peers, so that the ownership is the same as seen by the peers.
+	addrs = append([]string{p.self}, addrs...)
+	sort.Strings(addrs)
+
+	uniq := addrs[:0]
+	for i, addr := range addrs {
+		if i == 0 || addr != addrs[i-1] {
+			uniq = append(uniq, addr)
+		}
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if strings.Join(p.addrs, ",") == strings.Join(uniq, ",") {
+		return
+	}
+
+	p.addrs = uniq
+	p.ring = consistenthash.New(groupcacheReplicas, nil)
+	p.ring.Add(uniq...)
+	p.getters = make(map[string]*groupcacheGetter, len(uniq))
+	for _, addr := range uniq {
+		p.getters[addr] = &groupcacheGetter{client: p.client, baseURL: p.scheme + "://" + addr + GroupcacheBasePath}
+	}
+}
+
+func (p *groupcachePeers) count() int {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return len(p.addrs)
+}
+
+// PickPeer implements groupcache.PeerPicker.
+func (p *groupcachePeers) PickPeer(key string) (groupcache.ProtoGetter, bool) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	if p.ring == nil || p.ring.IsEmpty() {
+		return nil, false
+	}
+	if addr := p.ring.Get(key); addr != p.self {
+		return p.getters[addr], true
+	}
+	return nil, false
+}
+
+// groupcacheGetter fetches the items from a peer.
+type groupcacheGetter struct {
+	client  *http.Client
+	baseURL string
+}
+
+// Get implements groupcache.ProtoGetter.
+func (g *groupcacheGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	u := g.baseURL + url.PathEscape(in.GetGroup()) + "/" + url.PathEscape(in.GetKey())
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected response %s from %s", resp.Status, g.baseURL)
+	}
+
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, resp.Body); err != nil {
+		return errors.Wrap(err, "read response body")
+	}
+	return errors.Wrap(proto.Unmarshal(b.Bytes(), out), "decode response body")
+}
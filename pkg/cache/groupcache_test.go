@@ -0,0 +1,164 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gogo/protobuf/proto"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestGroupcache(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		loads = map[string]int{}
+	)
+	loader := func(_ context.Context, key string) ([]byte, error) {
+		if strings.HasPrefix(key, "missing") {
+			return nil, errors.New("not found")
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		loads[key]++
+		return []byte("local-" + key), nil
+	}
+
+	// Groups are registered globally, so the remote peer is served by a stub.
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, GroupcacheBasePath), "/", 2)
+		if len(parts) != 2 || parts[0] != "test-groupcache" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(parts[1], "missing") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		body, err := proto.Marshal(&pb.GetResponse{Value: []byte("remote-" + parts[1])})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer peer.Close()
+	peerAddr := strings.TrimPrefix(peer.URL, "http://")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	selfAddr := l.Addr().String()
+
+	conf := GroupcacheConfig{
+		Peers:                     []string{selfAddr, peerAddr},
+		SelfAddress:               selfAddr,
+		ListenAddress:             selfAddr,
+		GroupName:                 "test-groupcache",
+		MaxSize:                   1024 * 1024,
+		Timeout:                   time.Second,
+		MaxGetConcurrency:         2,
+		DNSProviderUpdateInterval: time.Minute,
+	}
+	c, err := newGroupcache(log.NewNopLogger(), nil, conf, l, loader)
+	testutil.Ok(t, err)
+	defer c.Stop()
+	testutil.Equals(t, 2, c.peers.count())
+
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	defer func() { _ = other.Close() }()
+	_, err = newGroupcache(log.NewNopLogger(), nil, conf, other, loader)
+	testutil.NotOk(t, err)
+
+	var (
+		ctx      = context.Background()
+		keys     []string
+		expected = map[string][]byte{}
+	)
+	for i := 0; i < 20; i++ {
+		key := "key-" + string(rune('a'+i))
+		keys = append(keys, key)
+
+		if _, remote := c.peers.PickPeer(key); remote {
+			expected[key] = []byte("remote-" + key)
+		} else {
+			expected[key] = []byte("local-" + key)
+		}
+	}
+	testutil.Assert(t, len(loads) == 0, "expected no loads before fetching")
+	testutil.Equals(t, expected, c.Fetch(ctx, append(keys, "missing")))
+
+	// Items owned by this instance are loaded once and served from the cache afterwards.
+	testutil.Equals(t, expected, c.Fetch(ctx, keys))
+	local := 0
+	for _, key := range keys {
+		if strings.HasPrefix(string(expected[key]), "local-") {
+			testutil.Equals(t, 1, loads[key], "key %s", key)
+			local++
+			continue
+		}
+		testutil.Equals(t, 0, loads[key], "key %s", key)
+	}
+	testutil.Assert(t, local > 0 && local < len(keys), "expected keys owned by both peers, got %d local", local)
+
+	// The peers are served on the listen address.
+	resp, err := http.Get("http://" + selfAddr + GroupcacheBasePath + "test-groupcache/" + keys[0])
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, resp.Body.Close()) }()
+	testutil.Equals(t, http.StatusOK, resp.StatusCode)
+
+	// Storing is a no-op.
+	c.Store(ctx, map[string][]byte{"missing": []byte("value")}, time.Hour)
+	testutil.Equals(t, map[string][]byte{}, c.Fetch(ctx, []string{"missing"}))
+
+	// Items owned by an unavailable peer are loaded locally.
+	peer.Close()
+	for i := 0; i < 100; i++ {
+		key := "other-" + string(rune('a'+i))
+		if _, remote := c.peers.PickPeer(key); remote {
+			testutil.Equals(t, map[string][]byte{key: []byte("local-" + key)}, c.Fetch(ctx, []string{key}))
+			return
+		}
+	}
+	t.Fatal("expected a key owned by the peer")
+}
+
+func TestGroupcachePeers_PickPeer(t *testing.T) {
+	p := &groupcachePeers{self: "a:1", scheme: "http"}
+
+	_, ok := p.PickPeer("key")
+	testutil.Assert(t, !ok, "expected no peer without the addresses")
+
+	p.set([]string{"b:1", "a:1", "c:1", "b:1"})
+	testutil.Equals(t, []string{"a:1", "b:1", "c:1"}, p.addrs)
+
+	owners := map[string]int{}
+	for i := 0; i < 300; i++ {
+		peer, ok := p.PickPeer("key-" + string(rune(i)))
+		if !ok {
+			owners["a:1"]++
+			continue
+		}
+		owners[strings.TrimSuffix(strings.TrimPrefix(peer.(*groupcacheGetter).baseURL, "http://"), GroupcacheBasePath)]++
+	}
+	testutil.Equals(t, 3, len(owners))
+
+	// The self address is always one of the peers.
+	p.set(nil)
+	testutil.Equals(t, []string{"a:1"}, p.addrs)
+	_, ok = p.PickPeer("key")
+	testutil.Assert(t, !ok, "expected all keys to be owned by this instance")
+}
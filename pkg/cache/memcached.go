@@ -5,6 +5,7 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -15,10 +16,11 @@ import (
 	"github.com/thanos-io/thanos/pkg/cacheutil"
 )
 
-// MemcachedCache is a memcached-based cache.
+// MemcachedCache is a memcached-based cache. It works with any remote cache client, see NewRedisCache.
 type MemcachedCache struct {
-	logger    log.Logger
-	memcached cacheutil.MemcachedClient
+	logger  log.Logger
+	backend string
+	client  cacheutil.RemoteCacheClient
 
 	// Metrics.
 	requests prometheus.Counter
@@ -26,25 +28,31 @@ type MemcachedCache struct {
 }
 
 // NewMemcachedCache makes a new MemcachedCache.
-func NewMemcachedCache(name string, logger log.Logger, memcached cacheutil.MemcachedClient, reg prometheus.Registerer) *MemcachedCache {
+func NewMemcachedCache(name string, logger log.Logger, memcached cacheutil.RemoteCacheClient, reg prometheus.Registerer) *MemcachedCache {
+	return newRemoteCache(name, "memcached", logger, memcached, reg)
+}
+
+// newRemoteCache makes a new MemcachedCache using the given client, with metrics named after the backend of the client.
+func newRemoteCache(name, backend string, logger log.Logger, client cacheutil.RemoteCacheClient, reg prometheus.Registerer) *MemcachedCache {
 	c := &MemcachedCache{
-		logger:    logger,
-		memcached: memcached,
+		logger:  logger,
+		backend: backend,
+		client:  client,
 	}
 
 	c.requests = promauto.With(reg).NewCounter(prometheus.CounterOpts{
-		Name:        "thanos_cache_memcached_requests_total",
-		Help:        "Total number of items requests to memcached.",
+		Name:        fmt.Sprintf("thanos_cache_%s_requests_total", backend),
+		Help:        fmt.Sprintf("Total number of items requests to %s.", backend),
 		ConstLabels: prometheus.Labels{"name": name},
 	})
 
 	c.hits = promauto.With(reg).NewCounter(prometheus.CounterOpts{
-		Name:        "thanos_cache_memcached_hits_total",
+		Name:        fmt.Sprintf("thanos_cache_%s_hits_total", backend),
 		Help:        "Total number of items requests to the cache that were a hit.",
 		ConstLabels: prometheus.Labels{"name": name},
 	})
 
-	level.Info(logger).Log("msg", "created memcached cache")
+	level.Info(logger).Log("msg", fmt.Sprintf("created %s cache", backend))
 
 	return c
 }
@@ -59,7 +67,7 @@ func (c *MemcachedCache) Store(ctx context.Context, data map[string][]byte, ttl
 	)
 
 	for key, val := range data {
-		if err := c.memcached.SetAsync(ctx, key, val, ttl); err != nil {
+		if err := c.client.SetAsync(ctx, key, val, ttl); err != nil {
 			failed++
 			if firstErr == nil {
 				firstErr = err
@@ -68,16 +76,16 @@ func (c *MemcachedCache) Store(ctx context.Context, data map[string][]byte, ttl
 	}
 
 	if firstErr != nil {
-		level.Warn(c.logger).Log("msg", "failed to store one or more items into memcached", "failed", failed, "firstErr", firstErr)
+		level.Warn(c.logger).Log("msg", fmt.Sprintf("failed to store one or more items into %s", c.backend), "failed", failed, "firstErr", firstErr)
 	}
 }
 
 // Fetch fetches multiple keys and returns a map containing cache hits, along with a list of missing keys.
 // In case of error, it logs and return an empty cache hits map.
 func (c *MemcachedCache) Fetch(ctx context.Context, keys []string) map[string][]byte {
-	// Fetch the keys from memcached in a single request.
+	// Fetch the keys from the cache, batching them as the client allows.
 	c.requests.Add(float64(len(keys)))
-	results := c.memcached.GetMulti(ctx, keys)
+	results := c.client.GetMulti(ctx, keys)
 	c.hits.Add(float64(len(results)))
 	return results
 }
@@ -0,0 +1,16 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cache
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/thanos/pkg/cacheutil"
+)
+
+// NewRedisCache makes a new Redis-based cache.
+func NewRedisCache(name string, logger log.Logger, redis cacheutil.RemoteCacheClient, reg prometheus.Registerer) *MemcachedCache {
+	return newRemoteCache(name, "redis", logger, redis, reg)
+}
@@ -55,13 +55,13 @@ var (
 	}
 )
 
-// MemcachedClient is a high level client to interact with memcached.
-type MemcachedClient interface {
-	// GetMulti fetches multiple keys at once from memcached. In case of error,
+// RemoteCacheClient is a high level client to interact with a remote cache, e.g. memcached or Redis.
+type RemoteCacheClient interface {
+	// GetMulti fetches multiple keys at once from the remote cache. In case of error,
 	// an empty map is returned and the error tracked/logged.
 	GetMulti(ctx context.Context, keys []string) map[string][]byte
 
-	// SetAsync enqueues an asynchronous operation to store a key into memcached.
+	// SetAsync enqueues an asynchronous operation to store a key into the remote cache.
 	// Returns an error in case it fails to enqueue the operation. In case the
 	// underlying async operation will fail, the error will be tracked/logged.
 	SetAsync(ctx context.Context, key string, value []byte, ttl time.Duration) error
@@ -70,6 +70,11 @@ type MemcachedClient interface {
 	Stop()
 }
 
+// MemcachedClient is a high level client to interact with memcached.
+type MemcachedClient interface {
+	RemoteCacheClient
+}
+
 // memcachedClientBackend is an interface used to mock the underlying client in tests.
 type memcachedClientBackend interface {
 	GetMulti(keys []string) (map[string]*memcache.Item, error)
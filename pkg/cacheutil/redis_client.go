@@ -0,0 +1,572 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cacheutil
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	config_util "github.com/prometheus/common/config"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/gate"
+	http_util "github.com/thanos-io/thanos/pkg/http"
+	"github.com/thanos-io/thanos/pkg/model"
+)
+
+const (
+	opSetMulti = "setmulti"
+)
+
+var (
+	errRedisAsyncBufferFull                = errors.New("the async buffer is full")
+	errRedisConfigNoAddrs                  = errors.New("no redis addresses provided")
+	errRedisMaxAsyncConcurrencyNotPositive = errors.New("max async concurrency must be positive")
+	errRedisSentinelClusterMode            = errors.New("sentinel master name can't be used in cluster mode")
+	errRedisMultipleAddrs                  = errors.New("multiple redis addresses require cluster mode, or a sentinel master name")
+
+	defaultRedisClientConfig = RedisClientConfig{
+		DialTimeout:            5 * time.Second,
+		ReadTimeout:            3 * time.Second,
+		WriteTimeout:           3 * time.Second,
+		PoolSize:               100,
+		IdleTimeout:            5 * time.Minute,
+		MaxAsyncConcurrency:    20,
+		MaxAsyncBufferSize:     10000,
+		MaxItemSize:            model.Bytes(16 * 1024 * 1024),
+		MaxGetMultiConcurrency: 100,
+		MaxGetMultiBatchSize:   100,
+		MaxSetMultiBatchSize:   100,
+	}
+)
+
+// RedisClientConfig is the config accepted by RedisClient.
+type RedisClientConfig struct {
+	// Addresses specifies the list of Redis addresses: a single Redis server, the seed nodes of Redis Cluster
+	// if ClusterMode is set, or Redis Sentinels if MasterName is set.
+	Addresses []string `yaml:"addresses"`
+
+	// ClusterMode specifies whether the addresses are nodes of Redis Cluster. It is required to set multiple
+	// addresses without MasterName.
+	ClusterMode bool `yaml:"cluster_mode"`
+
+	// MasterName specifies the name of the master monitored by the Redis Sentinels set as addresses.
+	MasterName string `yaml:"master_name"`
+
+	// Username and Password authenticate the connections, with Redis 6 ACL if Username is set.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// SentinelPassword authenticates the connections to Redis Sentinels.
+	SentinelPassword string `yaml:"sentinel_password"`
+
+	// DB specifies the database to be selected after connecting. Not supported by Redis Cluster.
+	DB int `yaml:"db"`
+
+	// DialTimeout, ReadTimeout and WriteTimeout specify the timeouts of connecting, reading and writing.
+	DialTimeout  time.Duration `yaml:"dial_timeout"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// PoolSize specifies the maximum number of connections per address.
+	PoolSize int `yaml:"pool_size"`
+
+	// MinIdleConnections specifies the minimum number of idle connections kept per address.
+	MinIdleConnections int `yaml:"min_idle_connections"`
+
+	// IdleTimeout specifies the amount of time after which idle connections are closed.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// MaxConnectionAge specifies the age at which connections are closed. If set to 0, connections are not closed due to age.
+	MaxConnectionAge time.Duration `yaml:"max_connection_age"`
+
+	// MaxAsyncConcurrency specifies the maximum number of SetAsync goroutines.
+	MaxAsyncConcurrency int `yaml:"max_async_concurrency"`
+
+	// MaxAsyncBufferSize specifies the queue buffer size for SetAsync operations.
+	MaxAsyncBufferSize int `yaml:"max_async_buffer_size"`
+
+	// MaxItemSize specifies the maximum size of an item stored in Redis.
+	// Items bigger than MaxItemSize are skipped.
+	// If set to 0, no maximum size is enforced.
+	MaxItemSize model.Bytes `yaml:"max_item_size"`
+
+	// MaxGetMultiConcurrency specifies the maximum number of concurrent GetMulti() pipelines.
+	// If set to 0, concurrency is unlimited.
+	MaxGetMultiConcurrency int `yaml:"max_get_multi_concurrency"`
+
+	// MaxGetMultiBatchSize specifies the maximum number of keys fetched by a single pipeline.
+	// If more keys are specified, internally keys are splitted into multiple batches and fetched
+	// concurrently, honoring MaxGetMultiConcurrency parallelism. If set to 0, the max batch size is unlimited.
+	MaxGetMultiBatchSize int `yaml:"max_get_multi_batch_size"`
+
+	// MaxSetMultiBatchSize specifies the maximum number of enqueued items stored by a single pipeline.
+	MaxSetMultiBatchSize int `yaml:"max_set_multi_batch_size"`
+
+	// TLSEnabled enables TLS connections.
+	TLSEnabled bool `yaml:"tls_enabled"`
+
+	// TLSConfig configures TLS connections.
+	TLSConfig http_util.TLSConfig `yaml:"tls_config"`
+}
+
+func (c *RedisClientConfig) validate() error {
+	if len(c.Addresses) == 0 {
+		return errRedisConfigNoAddrs
+	}
+
+	if c.MasterName != "" && c.ClusterMode {
+		return errRedisSentinelClusterMode
+	}
+
+	if len(c.Addresses) > 1 && c.MasterName == "" && !c.ClusterMode {
+		return errRedisMultipleAddrs
+	}
+
+	// Set async only available when MaxAsyncConcurrency > 0.
+	if c.MaxAsyncConcurrency <= 0 {
+		return errRedisMaxAsyncConcurrencyNotPositive
+	}
+
+	return nil
+}
+
+// parseRedisClientConfig unmarshals a buffer into a RedisClientConfig with default values.
+func parseRedisClientConfig(conf []byte) (RedisClientConfig, error) {
+	config := defaultRedisClientConfig
+	if err := yaml.Unmarshal(conf, &config); err != nil {
+		return RedisClientConfig{}, err
+	}
+
+	return config, nil
+}
+
+// redisItem is an item to be stored in Redis.
+type redisItem struct {
+	key   string
+	value []byte
+	ttl   time.Duration
+}
+
+// redisClientBackend is an interface used to mock the underlying client in tests.
+type redisClientBackend interface {
+	// getMulti returns the values of the keys which were found.
+	getMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+	setMulti(ctx context.Context, items []redisItem) error
+	Close() error
+}
+
+// pipelinedRedisBackend fetches and stores multiple items in a single pipeline. Pipelines of
+// Redis Cluster clients are split by the nodes serving the keys.
+type pipelinedRedisBackend struct {
+	client redis.UniversalClient
+}
+
+func (b pipelinedRedisBackend) getMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	cmds := make([]*redis.StringCmd, 0, len(keys))
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, pipe.Get(ctx, key))
+		}
+		return nil
+	})
+	// Missing keys fail the pipeline with redis.Nil, which is expected.
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	items := make(map[string][]byte, len(keys))
+	for i, cmd := range cmds {
+		val, err := cmd.Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "get %s", keys[i])
+		}
+		items[keys[i]] = val
+	}
+	return items, nil
+}
+
+func (b pipelinedRedisBackend) setMulti(ctx context.Context, items []redisItem) error {
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, it := range items {
+			pipe.Set(ctx, it.key, it.value, it.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (b pipelinedRedisBackend) Close() error {
+	return b.client.Close()
+}
+
+type redisClient struct {
+	logger log.Logger
+	config RedisClientConfig
+	client redisClientBackend
+
+	// Channel used to notify internal goroutines when they should quit.
+	stop chan struct{}
+
+	// Channel used to enqueue items to be stored asynchronously.
+	asyncQueue chan redisItem
+
+	// Gate used to enforce the max number of concurrent GetMulti() pipelines.
+	getMultiGate gate.Gate
+
+	// Wait group used to wait all workers on stopping.
+	workers sync.WaitGroup
+
+	// Tracked metrics.
+	clientInfo prometheus.GaugeFunc
+	operations *prometheus.CounterVec
+	failures   *prometheus.CounterVec
+	skipped    *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	dataSize   *prometheus.HistogramVec
+}
+
+// NewRedisClient makes a new RedisClient.
+func NewRedisClient(logger log.Logger, name string, conf []byte, reg prometheus.Registerer) (*redisClient, error) {
+	config, err := parseRedisClientConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRedisClientWithConfig(logger, name, config, reg)
+}
+
+// NewRedisClientWithConfig makes a new RedisClient.
+func NewRedisClientWithConfig(logger log.Logger, name string, config RedisClientConfig, reg prometheus.Registerer) (*redisClient, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            config.Addresses,
+		MasterName:       config.MasterName,
+		Username:         config.Username,
+		Password:         config.Password,
+		SentinelPassword: config.SentinelPassword,
+		DB:               config.DB,
+		DialTimeout:      config.DialTimeout,
+		ReadTimeout:      config.ReadTimeout,
+		WriteTimeout:     config.WriteTimeout,
+		PoolSize:         config.PoolSize,
+		MinIdleConns:     config.MinIdleConnections,
+		IdleTimeout:      config.IdleTimeout,
+		MaxConnAge:       config.MaxConnectionAge,
+	}
+	if config.TLSEnabled {
+		tlsConfig, err := config_util.NewTLSConfig(&config_util.TLSConfig{
+			CAFile:             config.TLSConfig.CAFile,
+			CertFile:           config.TLSConfig.CertFile,
+			KeyFile:            config.TLSConfig.KeyFile,
+			ServerName:         config.TLSConfig.ServerName,
+			InsecureSkipVerify: config.TLSConfig.InsecureSkipVerify,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "create TLS config")
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	var client redis.UniversalClient
+	if config.ClusterMode {
+		client = redis.NewClusterClient(opts.Cluster())
+	} else {
+		client = redis.NewUniversalClient(opts)
+	}
+
+	if reg != nil {
+		reg = prometheus.WrapRegistererWith(prometheus.Labels{"name": name}, reg)
+	}
+	return newRedisClient(logger, pipelinedRedisBackend{client: client}, config, reg), nil
+}
+
+func newRedisClient(logger log.Logger, client redisClientBackend, config RedisClientConfig, reg prometheus.Registerer) *redisClient {
+	c := &redisClient{
+		logger:     logger,
+		config:     config,
+		client:     client,
+		asyncQueue: make(chan redisItem, config.MaxAsyncBufferSize),
+		stop:       make(chan struct{}, 1),
+		getMultiGate: gate.New(
+			prometheus.WrapRegistererWithPrefix("thanos_redis_getmulti_", reg),
+			config.MaxGetMultiConcurrency,
+		),
+	}
+
+	c.clientInfo = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_redis_client_info",
+		Help: "A metric with a constant '1' value labeled by configuration options from which redis client was configured.",
+		ConstLabels: prometheus.Labels{
+			"cluster_mode":              strconv.FormatBool(config.ClusterMode),
+			"sentinel":                  strconv.FormatBool(config.MasterName != ""),
+			"tls_enabled":               strconv.FormatBool(config.TLSEnabled),
+			"dial_timeout":              config.DialTimeout.String(),
+			"read_timeout":              config.ReadTimeout.String(),
+			"write_timeout":             config.WriteTimeout.String(),
+			"pool_size":                 strconv.Itoa(config.PoolSize),
+			"max_async_concurrency":     strconv.Itoa(config.MaxAsyncConcurrency),
+			"max_async_buffer_size":     strconv.Itoa(config.MaxAsyncBufferSize),
+			"max_item_size":             strconv.FormatUint(uint64(config.MaxItemSize), 10),
+			"max_get_multi_concurrency": strconv.Itoa(config.MaxGetMultiConcurrency),
+			"max_get_multi_batch_size":  strconv.Itoa(config.MaxGetMultiBatchSize),
+			"max_set_multi_batch_size":  strconv.Itoa(config.MaxSetMultiBatchSize),
+		},
+	},
+		func() float64 { return 1 },
+	)
+
+	c.operations = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_redis_operations_total",
+		Help: "Total number of operations against redis.",
+	}, []string{"operation"})
+	c.operations.WithLabelValues(opGetMulti)
+	c.operations.WithLabelValues(opSetMulti)
+
+	c.failures = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_redis_operation_failures_total",
+		Help: "Total number of operations against redis that failed.",
+	}, []string{"operation", "reason"})
+	for _, op := range []string{opGetMulti, opSetMulti} {
+		c.failures.WithLabelValues(op, reasonTimeout)
+		c.failures.WithLabelValues(op, reasonServerError)
+		c.failures.WithLabelValues(op, reasonNetworkError)
+		c.failures.WithLabelValues(op, reasonOther)
+	}
+
+	c.skipped = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_redis_operation_skipped_total",
+		Help: "Total number of operations against redis that have been skipped.",
+	}, []string{"operation", "reason"})
+	c.skipped.WithLabelValues(opSetMulti, reasonMaxItemSize)
+	c.skipped.WithLabelValues(opSetMulti, reasonAsyncBufferFull)
+
+	c.duration = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "thanos_redis_operation_duration_seconds",
+		Help:    "Duration of operations against redis.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.5, 1, 3, 6, 10},
+	}, []string{"operation"})
+	c.duration.WithLabelValues(opGetMulti)
+	c.duration.WithLabelValues(opSetMulti)
+
+	c.dataSize = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name: "thanos_redis_operation_data_size_bytes",
+		Help: "Tracks the size of the data stored in and fetched from redis.",
+		Buckets: []float64{
+			32, 256, 512, 1024, 32 * 1024, 256 * 1024, 512 * 1024, 1024 * 1024, 32 * 1024 * 1024, 256 * 1024 * 1024, 512 * 1024 * 1024,
+		},
+	},
+		[]string{"operation"},
+	)
+	c.dataSize.WithLabelValues(opGetMulti)
+	c.dataSize.WithLabelValues(opSetMulti)
+
+	// Start a number of goroutines - storing the enqueued items - equal
+	// to the max concurrency we have.
+	c.workers.Add(c.config.MaxAsyncConcurrency)
+	for i := 0; i < c.config.MaxAsyncConcurrency; i++ {
+		go c.asyncQueueProcessLoop()
+	}
+
+	level.Info(logger).Log("msg", "created redis client", "addresses", strings.Join(config.Addresses, ","))
+	return c
+}
+
+func (c *redisClient) Stop() {
+	close(c.stop)
+
+	// Wait until all workers have terminated.
+	c.workers.Wait()
+
+	if err := c.client.Close(); err != nil {
+		level.Warn(c.logger).Log("msg", "failed to close redis client", "err", err)
+	}
+}
+
+func (c *redisClient) SetAsync(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	// Skip hitting redis at all if the item is bigger than the max allowed size.
+	if c.config.MaxItemSize > 0 && uint64(len(value)) > uint64(c.config.MaxItemSize) {
+		c.skipped.WithLabelValues(opSetMulti, reasonMaxItemSize).Inc()
+		return nil
+	}
+
+	select {
+	case c.asyncQueue <- redisItem{key: key, value: value, ttl: ttl}:
+		return nil
+	default:
+		c.skipped.WithLabelValues(opSetMulti, reasonAsyncBufferFull).Inc()
+		level.Debug(c.logger).Log("msg", "failed to store item to redis because the async buffer is full", "err", errRedisAsyncBufferFull, "size", len(c.asyncQueue))
+		return nil
+	}
+}
+
+// asyncQueueProcessLoop stores the enqueued items, batching the items enqueued meanwhile into a single pipeline.
+func (c *redisClient) asyncQueueProcessLoop() {
+	defer c.workers.Done()
+
+	batchSize := c.config.MaxSetMultiBatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	for {
+		select {
+		case it := <-c.asyncQueue:
+			batch := []redisItem{it}
+		collect:
+			for len(batch) < batchSize {
+				select {
+				case it := <-c.asyncQueue:
+					batch = append(batch, it)
+				default:
+					break collect
+				}
+			}
+			c.setMulti(batch)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *redisClient) setMulti(items []redisItem) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.WriteTimeout+c.config.DialTimeout)
+	defer cancel()
+
+	start := time.Now()
+	c.operations.WithLabelValues(opSetMulti).Inc()
+
+	if err := c.client.setMulti(ctx, items); err != nil {
+		level.Debug(c.logger).Log("msg", "failed to store items to redis", "numKeys", len(items), "firstKey", items[0].key, "err", err)
+		c.trackError(opSetMulti, err)
+		return
+	}
+
+	var total int
+	for _, it := range items {
+		total += len(it.value)
+	}
+	c.dataSize.WithLabelValues(opSetMulti).Observe(float64(total))
+	c.duration.WithLabelValues(opSetMulti).Observe(time.Since(start).Seconds())
+}
+
+func (c *redisClient) GetMulti(ctx context.Context, keys []string) map[string][]byte {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	batchSize := c.config.MaxGetMultiBatchSize
+	if batchSize <= 0 {
+		batchSize = len(keys)
+	}
+
+	var (
+		mtx     sync.Mutex
+		wg      sync.WaitGroup
+		hits    = map[string][]byte{}
+		lastErr error
+	)
+	for batchStart := 0; batchStart < len(keys); batchStart += batchSize {
+		batchEnd := batchStart + batchSize
+		if batchEnd > len(keys) {
+			batchEnd = len(keys)
+		}
+		batchKeys := keys[batchStart:batchEnd]
+
+		// The max concurrency is enforced by getMultiSingle().
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			items, err := c.getMultiSingle(ctx, batchKeys)
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			for key, val := range items {
+				hits[key] = val
+			}
+		}()
+	}
+	wg.Wait()
+
+	if lastErr != nil {
+		// Some batch requests may have succeeded. In this case we prefer to log it and move on,
+		// given returning some results from the cache is better than returning nothing.
+		level.Warn(c.logger).Log("msg", "failed to fetch items from redis", "numKeys", len(keys), "firstKey", keys[0], "err", lastErr)
+	}
+	return hits
+}
+
+func (c *redisClient) getMultiSingle(ctx context.Context, keys []string) (map[string][]byte, error) {
+	// Wait until we get a free slot from the gate, if the max
+	// concurrency should be enforced.
+	if c.config.MaxGetMultiConcurrency > 0 {
+		if err := c.getMultiGate.Start(ctx); err != nil {
+			return nil, errors.Wrapf(err, "failed to wait for turn")
+		}
+		defer c.getMultiGate.Done()
+	}
+
+	start := time.Now()
+	c.operations.WithLabelValues(opGetMulti).Inc()
+
+	items, err := c.client.getMulti(ctx, keys)
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "failed to get multiple items from redis", "err", err)
+		c.trackError(opGetMulti, err)
+		return nil, err
+	}
+
+	var total int
+	for _, val := range items {
+		total += len(val)
+	}
+	c.dataSize.WithLabelValues(opGetMulti).Observe(float64(total))
+	c.duration.WithLabelValues(opGetMulti).Observe(time.Since(start).Seconds())
+	return items, nil
+}
+
+func (c *redisClient) trackError(op string, err error) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.failures.WithLabelValues(op, reasonTimeout).Inc()
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			c.failures.WithLabelValues(op, reasonTimeout).Inc()
+		} else {
+			c.failures.WithLabelValues(op, reasonNetworkError).Inc()
+		}
+	case isRedisServerError(err):
+		c.failures.WithLabelValues(op, reasonServerError).Inc()
+	default:
+		c.failures.WithLabelValues(op, reasonOther).Inc()
+	}
+}
+
+// isRedisServerError returns true if the error was replied by the server.
+func isRedisServerError(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr)
+}
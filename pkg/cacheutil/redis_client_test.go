@@ -0,0 +1,381 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package cacheutil
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRedisClientConfig_validate(t *testing.T) {
+	tests := map[string]struct {
+		config   RedisClientConfig
+		expected error
+	}{
+		"should pass on valid config": {
+			config: RedisClientConfig{
+				Addresses:           []string{"127.0.0.1:6379"},
+				MaxAsyncConcurrency: 1,
+			},
+			expected: nil,
+		},
+		"should pass on valid sentinel config": {
+			config: RedisClientConfig{
+				Addresses:           []string{"127.0.0.1:26379", "127.0.0.2:26379"},
+				MasterName:          "master",
+				MaxAsyncConcurrency: 1,
+			},
+			expected: nil,
+		},
+		"should fail on no addresses": {
+			config: RedisClientConfig{
+				Addresses:           []string{},
+				MaxAsyncConcurrency: 1,
+			},
+			expected: errRedisConfigNoAddrs,
+		},
+		"should fail on master name in cluster mode": {
+			config: RedisClientConfig{
+				Addresses:           []string{"127.0.0.1:6379"},
+				ClusterMode:         true,
+				MasterName:          "master",
+				MaxAsyncConcurrency: 1,
+			},
+			expected: errRedisSentinelClusterMode,
+		},
+		"should pass on valid cluster config": {
+			config: RedisClientConfig{
+				Addresses:           []string{"127.0.0.1:6379", "127.0.0.2:6379"},
+				ClusterMode:         true,
+				MaxAsyncConcurrency: 1,
+			},
+			expected: nil,
+		},
+		"should fail on multiple addresses without cluster mode": {
+			config: RedisClientConfig{
+				Addresses:           []string{"127.0.0.1:6379", "127.0.0.2:6379"},
+				MaxAsyncConcurrency: 1,
+			},
+			expected: errRedisMultipleAddrs,
+		},
+		"should fail on max_async_concurrency <= 0": {
+			config: RedisClientConfig{
+				Addresses:           []string{"127.0.0.1:6379"},
+				MaxAsyncConcurrency: 0,
+			},
+			expected: errRedisMaxAsyncConcurrencyNotPositive,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testutil.Equals(t, testData.expected, testData.config.validate())
+		})
+	}
+}
+
+func TestNewRedisClient(t *testing.T) {
+	// Should return error on empty YAML config.
+	client, err := NewRedisClient(log.NewNopLogger(), "test", []byte{}, nil)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, (*redisClient)(nil), client)
+
+	// Should return error on invalid YAML config.
+	client, err = NewRedisClient(log.NewNopLogger(), "test", []byte("invalid"), nil)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, (*redisClient)(nil), client)
+
+	// Should return error on invalid TLS config.
+	client, err = NewRedisClient(log.NewNopLogger(), "test", []byte(`
+addresses:
+  - 127.0.0.1:6379
+tls_enabled: true
+tls_config:
+  ca_file: /not/existing/ca.pem
+`), nil)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, (*redisClient)(nil), client)
+
+	// Should instance a redis client with minimum YAML config.
+	client, err = NewRedisClient(log.NewNopLogger(), "test", []byte(`
+addresses:
+  - 127.0.0.1:6379
+`), nil)
+	testutil.Ok(t, err)
+	defer client.Stop()
+
+	testutil.Equals(t, []string{"127.0.0.1:6379"}, client.config.Addresses)
+	testutil.Equals(t, defaultRedisClientConfig.DialTimeout, client.config.DialTimeout)
+	testutil.Equals(t, defaultRedisClientConfig.ReadTimeout, client.config.ReadTimeout)
+	testutil.Equals(t, defaultRedisClientConfig.WriteTimeout, client.config.WriteTimeout)
+	testutil.Equals(t, defaultRedisClientConfig.PoolSize, client.config.PoolSize)
+	testutil.Equals(t, defaultRedisClientConfig.MaxAsyncConcurrency, client.config.MaxAsyncConcurrency)
+	testutil.Equals(t, defaultRedisClientConfig.MaxAsyncBufferSize, client.config.MaxAsyncBufferSize)
+	testutil.Equals(t, defaultRedisClientConfig.MaxGetMultiConcurrency, client.config.MaxGetMultiConcurrency)
+	testutil.Equals(t, defaultRedisClientConfig.MaxGetMultiBatchSize, client.config.MaxGetMultiBatchSize)
+	testutil.Equals(t, defaultRedisClientConfig.MaxSetMultiBatchSize, client.config.MaxSetMultiBatchSize)
+	testutil.Equals(t, defaultRedisClientConfig.MaxItemSize, client.config.MaxItemSize)
+
+	// Should instance a redis cluster client with configured YAML config.
+	client, err = NewRedisClient(log.NewNopLogger(), "test", []byte(`
+addresses:
+  - 127.0.0.1:6379
+cluster_mode: true
+username: user
+password: pass
+dial_timeout: 1s
+pool_size: 1
+max_async_concurrency: 1
+max_async_buffer_size: 1
+max_get_multi_concurrency: 1
+max_get_multi_batch_size: 1
+max_set_multi_batch_size: 1
+max_item_size: 1MiB
+`), nil)
+	testutil.Ok(t, err)
+	defer client.Stop()
+
+	testutil.Equals(t, true, client.config.ClusterMode)
+	testutil.Equals(t, "user", client.config.Username)
+	testutil.Equals(t, "pass", client.config.Password)
+	testutil.Equals(t, 1*time.Second, client.config.DialTimeout)
+	testutil.Equals(t, 1, client.config.PoolSize)
+	testutil.Equals(t, 1, client.config.MaxAsyncConcurrency)
+	testutil.Equals(t, 1, client.config.MaxAsyncBufferSize)
+	testutil.Equals(t, 1, client.config.MaxGetMultiConcurrency)
+	testutil.Equals(t, 1, client.config.MaxGetMultiBatchSize)
+	testutil.Equals(t, 1, client.config.MaxSetMultiBatchSize)
+	testutil.Equals(t, model.Bytes(1024*1024), client.config.MaxItemSize)
+}
+
+func TestRedisClient_SetAsync(t *testing.T) {
+	ctx := context.Background()
+	config := defaultRedisClientConfig
+	config.Addresses = []string{"127.0.0.1:6379"}
+	config.MaxItemSize = model.Bytes(10)
+	backendMock := newRedisClientBackendMock()
+
+	client := newRedisClient(log.NewNopLogger(), backendMock, config, nil)
+	defer client.Stop()
+
+	testutil.Ok(t, client.SetAsync(ctx, "key-1", []byte("value-1"), time.Second))
+	testutil.Ok(t, client.SetAsync(ctx, "key-2", []byte("value-2"), time.Second))
+	testutil.Ok(t, client.SetAsync(ctx, "key-3", []byte("value-3-too-long-to-be-stored"), time.Second))
+	testutil.Ok(t, backendMock.waitItems(2))
+
+	actual, err := client.getMultiSingle(ctx, []string{"key-1", "key-2", "key-3"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string][]byte{"key-1": []byte("value-1"), "key-2": []byte("value-2")}, actual)
+	testutil.Equals(t, time.Second, backendMock.ttls["key-1"])
+
+	testutil.Equals(t, float64(backendMock.setMultiCount), prom_testutil.ToFloat64(client.operations.WithLabelValues(opSetMulti)))
+	testutil.Equals(t, 1.0, prom_testutil.ToFloat64(client.operations.WithLabelValues(opGetMulti)))
+	testutil.Equals(t, 0.0, prom_testutil.ToFloat64(client.failures.WithLabelValues(opSetMulti, reasonOther)))
+	testutil.Equals(t, 1.0, prom_testutil.ToFloat64(client.skipped.WithLabelValues(opSetMulti, reasonMaxItemSize)))
+}
+
+func TestRedisClient_GetMulti(t *testing.T) {
+	tests := map[string]struct {
+		maxBatchSize          int
+		maxConcurrency        int
+		mockedGetMultiErrors  int
+		initialItems          map[string][]byte
+		getKeys               []string
+		expectedHits          map[string][]byte
+		expectedGetMultiCount int
+	}{
+		"should fetch keys in a single batch if the input keys is <= the max batch size": {
+			maxBatchSize:   2,
+			maxConcurrency: 5,
+			initialItems: map[string][]byte{
+				"key-1": []byte("value-1"),
+				"key-2": []byte("value-2"),
+			},
+			getKeys: []string{"key-1", "key-2"},
+			expectedHits: map[string][]byte{
+				"key-1": []byte("value-1"),
+				"key-2": []byte("value-2"),
+			},
+			expectedGetMultiCount: 1,
+		},
+		"should fetch keys in multiple batches if the input keys is > the max batch size": {
+			maxBatchSize:   2,
+			maxConcurrency: 5,
+			initialItems: map[string][]byte{
+				"key-1": []byte("value-1"),
+				"key-2": []byte("value-2"),
+				"key-3": []byte("value-3"),
+			},
+			getKeys: []string{"key-1", "key-2", "key-3", "key-4"},
+			expectedHits: map[string][]byte{
+				"key-1": []byte("value-1"),
+				"key-2": []byte("value-2"),
+				"key-3": []byte("value-3"),
+			},
+			expectedGetMultiCount: 2,
+		},
+		"should fetch keys in a single batch if max batch size is disabled": {
+			maxBatchSize:   0,
+			maxConcurrency: 0,
+			initialItems: map[string][]byte{
+				"key-1": []byte("value-1"),
+				"key-2": []byte("value-2"),
+				"key-3": []byte("value-3"),
+			},
+			getKeys: []string{"key-1", "key-2", "key-3"},
+			expectedHits: map[string][]byte{
+				"key-1": []byte("value-1"),
+				"key-2": []byte("value-2"),
+				"key-3": []byte("value-3"),
+			},
+			expectedGetMultiCount: 1,
+		},
+		"should return partial results if some batches failed": {
+			maxBatchSize:         2,
+			maxConcurrency:       1,
+			mockedGetMultiErrors: 1,
+			initialItems: map[string][]byte{
+				"key-1": []byte("value-1"),
+				"key-2": []byte("value-2"),
+				"key-3": []byte("value-3"),
+			},
+			getKeys:               []string{"key-1", "key-2", "key-3"},
+			expectedGetMultiCount: 2,
+		},
+		"should return no hits on all keys missing": {
+			maxBatchSize:   2,
+			maxConcurrency: 5,
+			initialItems: map[string][]byte{
+				"key-1": []byte("value-1"),
+			},
+			getKeys:               []string{"key-2", "key-3"},
+			expectedHits:          map[string][]byte{},
+			expectedGetMultiCount: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			config := defaultRedisClientConfig
+			config.Addresses = []string{"127.0.0.1:6379"}
+			config.MaxGetMultiBatchSize = testData.maxBatchSize
+			config.MaxGetMultiConcurrency = testData.maxConcurrency
+
+			backendMock := newRedisClientBackendMock()
+			backendMock.getMultiErrors = testData.mockedGetMultiErrors
+			client := newRedisClient(log.NewNopLogger(), backendMock, config, nil)
+			defer client.Stop()
+
+			for key, value := range testData.initialItems {
+				backendMock.items[key] = value
+			}
+
+			hits := client.GetMulti(ctx, testData.getKeys)
+			if testData.mockedGetMultiErrors > 0 {
+				// Which batch fails is not deterministic, so only the number of hits of the other batch is checked.
+				testutil.Assert(t, len(hits) == 1 || len(hits) == 2, "unexpected hits %v", hits)
+			} else {
+				testutil.Equals(t, testData.expectedHits, hits)
+			}
+
+			testutil.Equals(t, testData.expectedGetMultiCount, backendMock.getMultiCount)
+			testutil.Equals(t, float64(testData.expectedGetMultiCount), prom_testutil.ToFloat64(client.operations.WithLabelValues(opGetMulti)))
+			testutil.Equals(t, float64(testData.mockedGetMultiErrors), prom_testutil.ToFloat64(client.failures.WithLabelValues(opGetMulti, reasonOther)))
+		})
+	}
+}
+
+func TestRedisClients_CanUseSameRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	config := defaultRedisClientConfig
+	config.Addresses = []string{"127.0.0.1:6379"}
+
+	client1, err := NewRedisClientWithConfig(log.NewNopLogger(), "a", config, reg)
+	testutil.Ok(t, err)
+	defer client1.Stop()
+
+	client2, err := NewRedisClientWithConfig(log.NewNopLogger(), "b", config, reg)
+	testutil.Ok(t, err)
+	defer client2.Stop()
+}
+
+type redisClientBackendMock struct {
+	lock           sync.Mutex
+	items          map[string][]byte
+	ttls           map[string]time.Duration
+	getMultiCount  int
+	getMultiErrors int
+	setMultiCount  int
+}
+
+func newRedisClientBackendMock() *redisClientBackendMock {
+	return &redisClientBackendMock{
+		items: map[string][]byte{},
+		ttls:  map[string]time.Duration{},
+	}
+}
+
+func (c *redisClientBackendMock) getMulti(_ context.Context, keys []string) (map[string][]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.getMultiCount++
+	if c.getMultiCount <= c.getMultiErrors {
+		return nil, errors.New("mocked getMulti error")
+	}
+
+	items := make(map[string][]byte)
+	for _, key := range keys {
+		if value, ok := c.items[key]; ok {
+			items[key] = value
+		}
+	}
+
+	return items, nil
+}
+
+func (c *redisClientBackendMock) setMulti(_ context.Context, items []redisItem) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.setMultiCount++
+	for _, it := range items {
+		c.items[it.key] = it.value
+		c.ttls[it.key] = it.ttl
+	}
+
+	return nil
+}
+
+func (c *redisClientBackendMock) Close() error {
+	return nil
+}
+
+func (c *redisClientBackendMock) waitItems(expected int) error {
+	deadline := time.Now().Add(1 * time.Second)
+
+	for time.Now().Before(deadline) {
+		c.lock.Lock()
+		count := len(c.items)
+		c.lock.Unlock()
+
+		if count >= expected {
+			return nil
+		}
+	}
+
+	return errors.New("timeout expired while waiting for items in the redis mock")
+}
@@ -5,12 +5,14 @@ package compact
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -105,20 +107,18 @@ func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket
 	}, nil
 }
 
-// UntilNextDownsampling calculates how long it will take until the next downsampling operation.
+// UntilNextDownsampling calculates how long it will take until the next downsampling operation with the given levels.
 // Returns an error if there will be no downsampling.
-func UntilNextDownsampling(m *metadata.Meta) (time.Duration, error) {
-	timeRange := time.Duration((m.MaxTime - m.MinTime) * int64(time.Millisecond))
-	switch m.Thanos.Downsample.Resolution {
-	case downsample.ResLevel2:
+func UntilNextDownsampling(m *metadata.Meta, levels downsample.Levels) (time.Duration, error) {
+	if !levels.Contains(m.Thanos.Downsample.Resolution) {
+		return time.Duration(0), errors.Errorf("invalid resolution %v", m.Thanos.Downsample.Resolution)
+	}
+	next, ok := levels.Next(m.Thanos.Downsample.Resolution)
+	if !ok {
 		return time.Duration(0), errors.New("no downsampling")
-	case downsample.ResLevel1:
-		return time.Duration(downsample.DownsampleRange1*time.Millisecond) - timeRange, nil
-	case downsample.ResLevel0:
-		return time.Duration(downsample.DownsampleRange0*time.Millisecond) - timeRange, nil
-	default:
-		panic(errors.Errorf("invalid resolution %v", m.Thanos.Downsample.Resolution))
 	}
+	timeRange := time.Duration((m.MaxTime - m.MinTime) * int64(time.Millisecond))
+	return time.Duration(next.MinRange*int64(time.Millisecond)) - timeRange, nil
 }
 
 // SyncMetas synchronizes local state of block metas with what we have in the bucket.
@@ -527,6 +527,28 @@ func IsIssue347Error(err error) bool {
 	return ok
 }
 
+// CorruptedBlockError is a type wrapper for errors caused by a block with a not healthy index, for example with
+// out-of-order or duplicated chunks. It halts compactions, unless the compactor skips or repairs such blocks.
+type CorruptedBlockError struct {
+	err error
+
+	id ulid.ULID
+}
+
+func corruptedBlockError(err error, corruptedBlock ulid.ULID) CorruptedBlockError {
+	return CorruptedBlockError{err: err, id: corruptedBlock}
+}
+
+func (e CorruptedBlockError) Error() string {
+	return e.err.Error()
+}
+
+// IsCorruptedBlockError returns true if the base error is a CorruptedBlockError.
+func IsCorruptedBlockError(err error) bool {
+	_, ok := errors.Cause(err).(CorruptedBlockError)
+	return ok
+}
+
 // HaltError is a type wrapper for errors that should halt any further progress on compactions.
 type HaltError struct {
 	err error
@@ -677,6 +699,104 @@ func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket,
 	return nil
 }
 
+// RepairOrSkipCorruptedBlock rewrites the block of the given CorruptedBlockError without its out-of-order, duplicated
+// and outside chunks. If the block cannot be repaired, for example because its overlapping chunks have different data,
+// it is marked for no compaction instead, so it is excluded from the next compaction plans.
+func RepairOrSkipCorruptedBlock(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	blocksRepaired prometheus.Counter,
+	blocksMarkedForDeletion prometheus.Counter,
+	blocksMarkedForNoCompact prometheus.Counter,
+	corruptedErr error,
+) error {
+	ce, ok := errors.Cause(corruptedErr).(CorruptedBlockError)
+	if !ok {
+		return errors.Errorf("Given error is not a corrupted block error: %v", corruptedErr)
+	}
+
+	repairErr := repairCorruptedBlock(ctx, logger, bkt, ce.id, blocksMarkedForDeletion)
+	if repairErr == nil {
+		blocksRepaired.Inc()
+		return nil
+	}
+	if IsRetryError(repairErr) {
+		return repairErr
+	}
+
+	level.Warn(logger).Log("msg", "failed to repair corrupted block; marking it for no compaction", "id", ce.id, "err", repairErr)
+	if err := block.MarkForNoCompact(
+		ctx,
+		logger,
+		bkt,
+		ce.id,
+		metadata.CorruptedNoCompactReason,
+		fmt.Sprintf("corrupted block could not be repaired: %v; repair error: %v", corruptedErr, repairErr),
+		blocksMarkedForNoCompact,
+	); err != nil {
+		return errors.Wrapf(err, "mark %v for no compaction", ce.id)
+	}
+	return nil
+}
+
+func repairCorruptedBlock(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, blocksMarkedForDeletion prometheus.Counter) error {
+	level.Info(logger).Log("msg", "repairing corrupted block", "id", id)
+
+	tmpdir, err := ioutil.TempDir("", fmt.Sprintf("repair-corrupted-id-%s-", id))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := os.RemoveAll(tmpdir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remote tmpdir", "err", err, "tmpdir", tmpdir)
+		}
+	}()
+
+	bdir := filepath.Join(tmpdir, id.String())
+	if err := block.Download(ctx, logger, bkt, id, bdir); err != nil {
+		return retry(errors.Wrapf(err, "download block %s", id))
+	}
+
+	meta, err := metadata.Read(bdir)
+	if err != nil {
+		return errors.Wrapf(err, "read meta from %s", bdir)
+	}
+
+	resid, err := block.Repair(
+		logger,
+		tmpdir,
+		id,
+		metadata.CompactorRepairSource,
+		block.IgnoreCompleteOutsideChunk,
+		block.IgnoreDuplicateOutsideChunk,
+		block.IgnoreIssue347OutsideChunk,
+	)
+	if err != nil {
+		return errors.Wrapf(err, "repair failed for block %s", id)
+	}
+
+	// Verify repaired id before uploading it.
+	if err := block.VerifyIndex(logger, filepath.Join(tmpdir, resid.String(), block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
+		return errors.Wrapf(err, "repaired block is invalid %s", resid)
+	}
+
+	level.Info(logger).Log("msg", "uploading repaired block", "newID", resid)
+	if err = block.Upload(ctx, logger, bkt, filepath.Join(tmpdir, resid.String())); err != nil {
+		return retry(errors.Wrapf(err, "upload of %s failed", resid))
+	}
+
+	// Spawn a new context so we always mark a block for deletion in full on shutdown.
+	delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	if err := block.MarkForDeletion(delCtx, logger, bkt, id, "source of repaired block", blocksMarkedForDeletion); err != nil {
+		return retry(errors.Wrapf(err, "marking corrupted block %s for deletion has failed", id))
+	}
+	return nil
+}
+
 func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp Compactor) (shouldRerun bool, compID ulid.ULID, err error) {
 	cg.mtx.Lock()
 	defer cg.mtx.Unlock()
@@ -732,7 +852,7 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		}
 
 		if err := stats.CriticalErr(); err != nil {
-			return false, ulid.ULID{}, halt(errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", bdir, meta.Compaction.Level, meta.Thanos.Labels))
+			return false, ulid.ULID{}, corruptedBlockError(errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", bdir, meta.Compaction.Level, meta.Thanos.Labels), meta.ULID)
 		}
 
 		if err := stats.Issue347OutsideChunksErr(); err != nil {
@@ -776,10 +896,12 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 	index := filepath.Join(bdir, block.IndexFilename)
 
 	newMeta, err := metadata.InjectThanos(cg.logger, bdir, metadata.Thanos{
-		Labels:       cg.labels.Map(),
-		Downsample:   metadata.ThanosDownsample{Resolution: cg.resolution},
-		Source:       metadata.CompactorSource,
-		SegmentFiles: block.GetSegmentFiles(bdir),
+		Labels:           cg.labels.Map(),
+		Downsample:       metadata.ThanosDownsample{Resolution: cg.resolution},
+		Source:           metadata.CompactorSource,
+		SegmentFiles:     block.GetSegmentFiles(bdir),
+		DeletionRequests: appliedDeletionRequests(toCompact),
+		Annotations:      mergeAnnotations(toCompact),
 	}, nil)
 	if err != nil {
 		return false, ulid.ULID{}, errors.Wrapf(err, "failed to finalize the block %s", bdir)
@@ -821,6 +943,59 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 	return true, compID, nil
 }
 
+// mergeAnnotations returns the annotations of the block compacted from the given blocks. The annotations with different
+// values in the blocks have the sorted distinct values as a JSON list, e.g. ["host-a","host-b"], so that the compacted
+// block can still be traced back to all the producers of its sources. Values can contain any character, as they are
+// never split.
+func mergeAnnotations(metas []*metadata.Meta) map[string]string {
+	values := map[string]map[string]struct{}{}
+	for _, m := range metas {
+		for k, v := range m.Thanos.Annotations {
+			if _, ok := values[k]; !ok {
+				values[k] = map[string]struct{}{}
+			}
+			for _, sv := range annotationValues(v) {
+				values[k][sv] = struct{}{}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	annotations := make(map[string]string, len(values))
+	for k, set := range values {
+		vs := make([]string, 0, len(set))
+		for v := range set {
+			vs = append(vs, v)
+		}
+		if len(vs) == 1 {
+			annotations[k] = vs[0]
+			continue
+		}
+		sort.Strings(vs)
+		b, err := json.Marshal(vs)
+		if err != nil {
+			// Marshaling strings can't fail.
+			panic(err)
+		}
+		annotations[k] = string(b)
+	}
+	return annotations
+}
+
+// annotationValues returns the values of an annotation merged by mergeAnnotations, so that the values of blocks
+// already compacted are not repeated, or the value itself if it is not a JSON list of strings.
+func annotationValues(v string) []string {
+	if strings.HasPrefix(v, "[") {
+		var vs []string
+		if err := json.Unmarshal([]byte(v), &vs); err == nil && len(vs) > 0 {
+			return vs
+		}
+	}
+	return []string{v}
+}
+
 func (cg *Group) deleteBlock(id ulid.ULID, bdir string) error {
 	if err := os.RemoveAll(bdir); err != nil {
 		return errors.Wrapf(err, "remove old block dir %s", id)
@@ -846,6 +1021,11 @@ type BucketCompactor struct {
 	compactDir  string
 	bkt         objstore.Bucket
 	concurrency int
+	tracker     *StatusTracker
+
+	skipOrRepairCorrupted    bool
+	blocksRepaired           prometheus.Counter
+	blocksMarkedForNoCompact prometheus.Counter
 }
 
 // NewBucketCompactor creates a new bucket compactor.
@@ -858,6 +1038,10 @@ func NewBucketCompactor(
 	compactDir string,
 	bkt objstore.Bucket,
 	concurrency int,
+	tracker *StatusTracker,
+	skipOrRepairCorrupted bool,
+	blocksRepaired prometheus.Counter,
+	blocksMarkedForNoCompact prometheus.Counter,
 ) (*BucketCompactor, error) {
 	if concurrency <= 0 {
 		return nil, errors.Errorf("invalid concurrency level (%d), concurrency level must be > 0", concurrency)
@@ -871,6 +1055,11 @@ func NewBucketCompactor(
 		compactDir:  compactDir,
 		bkt:         bkt,
 		concurrency: concurrency,
+		tracker:     tracker,
+
+		skipOrRepairCorrupted:    skipOrRepairCorrupted,
+		blocksRepaired:           blocksRepaired,
+		blocksMarkedForNoCompact: blocksMarkedForNoCompact,
 	}, nil
 }
 
@@ -904,7 +1093,11 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 			go func() {
 				defer wg.Done()
 				for g := range groupChan {
-					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, c.planner, c.comp)
+					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, c.tracker.planner(c.planner, g), c.comp)
+					if IsCorruptedBlockError(err) && !c.skipOrRepairCorrupted {
+						err = halt(err)
+					}
+					c.tracker.finished(g, err)
 					if err == nil {
 						if shouldRerunGroup {
 							mtx.Lock()
@@ -922,6 +1115,15 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 							continue
 						}
 					}
+
+					if IsCorruptedBlockError(err) {
+						if err := RepairOrSkipCorruptedBlock(workCtx, c.logger, c.bkt, c.blocksRepaired, c.sy.metrics.blocksMarkedForDeletion, c.blocksMarkedForNoCompact, err); err == nil {
+							mtx.Lock()
+							finishedAllGroups = false
+							mtx.Unlock()
+							continue
+						}
+					}
 					errChan <- errors.Wrapf(err, "group %s", g.Key())
 					return
 				}
@@ -950,6 +1152,10 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 			return errors.Wrap(err, "build compaction groups")
 		}
 
+		if err := c.tracker.plan(ctx, c.planner, groups); err != nil {
+			return errors.Wrap(err, "plan compactions")
+		}
+
 		level.Info(c.logger).Log("msg", "start of compactions")
 
 		// Send all groups found during this pass to the compaction workers.
@@ -1032,3 +1238,62 @@ func (f *GatherNoCompactionMarkFilter) Filter(ctx context.Context, metas map[uli
 	}
 	return nil
 }
+
+const shardExcludedMeta = "shard-excluded"
+
+var _ block.MetadataFilter = &GroupShardingFilter{}
+
+// GroupShardingFilter is a block.Fetcher filter that passes only the blocks of compaction groups owned by the given shard,
+// so multiple compactors can split the work without relabel configs. Group ownership is computed from the hash of the block
+// external labels, excluding the replica labels used for vertical compaction. Resolution is not taken into account, so
+// all resolutions of the same stream are compacted, downsampled and retained by the same shard.
+// Not go routine safe.
+type GroupShardingFilter struct {
+	shards        uint64
+	shardIndex    uint64
+	replicaLabels []string
+}
+
+// NewGroupShardingFilter creates GroupShardingFilter.
+func NewGroupShardingFilter(shards, shardIndex int, replicaLabels []string) (*GroupShardingFilter, error) {
+	if shards < 1 {
+		return nil, errors.Errorf("number of shards must be positive, got %d", shards)
+	}
+	if shardIndex < 0 || shardIndex >= shards {
+		return nil, errors.Errorf("shard index must be in range [0, %d), got %d", shards, shardIndex)
+	}
+	return &GroupShardingFilter{
+		shards:        uint64(shards),
+		shardIndex:    uint64(shardIndex),
+		replicaLabels: replicaLabels,
+	}, nil
+}
+
+// Filter filters out blocks of compaction groups not owned by the shard.
+func (f *GroupShardingFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) error {
+	if f.shards == 1 {
+		return nil
+	}
+	for id, m := range metas {
+		if f.shardOf(m.Thanos.Labels) != f.shardIndex {
+			synced.WithLabelValues(shardExcludedMeta).Inc()
+			delete(metas, id)
+		}
+	}
+	return nil
+}
+
+func (f *GroupShardingFilter) shardOf(lbls map[string]string) uint64 {
+	ls := make(labels.Labels, 0, len(lbls))
+Outer:
+	for k, v := range lbls {
+		for _, r := range f.replicaLabels {
+			if k == r {
+				continue Outer
+			}
+		}
+		ls = append(ls, labels.Label{Name: k, Value: v})
+	}
+	sort.Sort(ls)
+	return ls.Hash() % f.shards
+}
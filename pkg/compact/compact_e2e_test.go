@@ -198,7 +198,7 @@ func TestGroup_Compact_e2e(t *testing.T) {
 		planner := NewTSDBBasedPlanner(logger, []int64{1000, 3000})
 
 		grouper := NewDefaultGrouper(logger, bkt, false, false, reg, blocksMarkedForDeletion, garbageCollectedBlocks)
-		bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 2)
+		bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 2, nil, false, nil, nil)
 		testutil.Ok(t, err)
 
 		// Compaction on empty should not fail.
@@ -4,14 +4,31 @@
 package compact
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb"
 
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/errutil"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
 
 func TestHaltError(t *testing.T) {
@@ -74,6 +91,58 @@ func TestRetryError(t *testing.T) {
 	testutil.Assert(t, IsHaltError(err), "not a halt error. Retry should not hide halt error")
 }
 
+func TestCorruptedBlockError(t *testing.T) {
+	err := corruptedBlockError(errors.New("test"), ulid.MustNew(1, nil))
+	testutil.Assert(t, IsCorruptedBlockError(err), "not a corrupted block error")
+	testutil.Assert(t, IsCorruptedBlockError(errors.Wrap(err, "something")), "not a corrupted block error")
+	testutil.Assert(t, !IsHaltError(err), "halt error")
+
+	testutil.Assert(t, IsHaltError(halt(err)), "not a halt error")
+	testutil.Assert(t, !IsCorruptedBlockError(halt(err)), "corrupted block error")
+}
+
+func TestRepairOrSkipCorruptedBlock(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "repair-corrupted")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+	rawID, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 1000, labels.FromStrings("cluster", "x"), 0)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, rawID.String())))
+	// Downsampled blocks cannot be repaired.
+	downsampledID, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 1000, labels.FromStrings("cluster", "x"), downsample.ResLevel1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, downsampledID.String())))
+
+	var (
+		blocksRepaired           = promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+		blocksMarkedForDeletion  = promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+		blocksMarkedForNoCompact = promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	)
+	testutil.NotOk(t, RepairOrSkipCorruptedBlock(ctx, logger, bkt, blocksRepaired, blocksMarkedForDeletion, blocksMarkedForNoCompact, errors.New("not corrupted")))
+
+	testutil.Ok(t, RepairOrSkipCorruptedBlock(ctx, logger, bkt, blocksRepaired, blocksMarkedForDeletion, blocksMarkedForNoCompact,
+		errors.Wrap(corruptedBlockError(errors.New("out-of-order chunks"), rawID), "group")))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksRepaired))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksMarkedForDeletion))
+	exists, err := bkt.Exists(ctx, path.Join(rawID.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists, "repaired block not marked for deletion")
+
+	testutil.Ok(t, RepairOrSkipCorruptedBlock(ctx, logger, bkt, blocksRepaired, blocksMarkedForDeletion, blocksMarkedForNoCompact,
+		corruptedBlockError(errors.New("out-of-order chunks"), downsampledID)))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksRepaired))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksMarkedForNoCompact))
+	m := &metadata.NoCompactMark{}
+	testutil.Ok(t, metadata.ReadMarker(ctx, logger, bkt, downsampledID.String(), m))
+	testutil.Equals(t, metadata.NoCompactReason(metadata.CorruptedNoCompactReason), m.Reason)
+}
+
 func TestGroupKey(t *testing.T) {
 	for _, tcase := range []struct {
 		input    metadata.Thanos
@@ -125,3 +194,93 @@ func TestGroupMaxMinTime(t *testing.T) {
 	testutil.Equals(t, int64(0), g.MinTime())
 	testutil.Equals(t, int64(30), g.MaxTime())
 }
+
+func TestMergeAnnotations(t *testing.T) {
+	newMeta := func(annotations map[string]string) *metadata.Meta {
+		return &metadata.Meta{Thanos: metadata.Thanos{Annotations: annotations}}
+	}
+
+	testutil.Equals(t, map[string]string(nil), mergeAnnotations(nil))
+	testutil.Equals(t, map[string]string(nil), mergeAnnotations([]*metadata.Meta{newMeta(nil), newMeta(nil)}))
+	merged := mergeAnnotations([]*metadata.Meta{
+		newMeta(map[string]string{metadata.ProducerAnnotation: "host-b", metadata.VersionAnnotation: "0.17.0", "query": "a,b"}),
+		newMeta(map[string]string{metadata.ProducerAnnotation: `["host-a","host-c"]`, metadata.VersionAnnotation: "0.17.0", "pipeline": "v2"}),
+		newMeta(map[string]string{metadata.ProducerAnnotation: "host-a", "query": "[c]"}),
+	})
+	testutil.Equals(t, map[string]string{
+		metadata.ProducerAnnotation: `["host-a","host-b","host-c"]`,
+		metadata.VersionAnnotation:  "0.17.0",
+		"pipeline":                  "v2",
+		// Values with commas or which are not JSON lists are kept as they are.
+		"query": `["[c]","a,b"]`,
+	}, merged)
+
+	// Merged values are not repeated when compacting again.
+	testutil.Equals(t, map[string]string{
+		metadata.ProducerAnnotation: `["host-a","host-b","host-c","host-d"]`,
+		metadata.VersionAnnotation:  "0.17.0",
+		"pipeline":                  "v2",
+		"query":                     `["[c]","a,b"]`,
+	}, mergeAnnotations([]*metadata.Meta{
+		newMeta(merged),
+		newMeta(map[string]string{metadata.ProducerAnnotation: "host-d", "query": "a,b"}),
+	}))
+}
+
+func TestGroupShardingFilter(t *testing.T) {
+	_, err := NewGroupShardingFilter(0, 0, nil)
+	testutil.NotOk(t, err)
+	_, err = NewGroupShardingFilter(2, 2, nil)
+	testutil.NotOk(t, err)
+	_, err = NewGroupShardingFilter(2, -1, nil)
+	testutil.NotOk(t, err)
+
+	const shards = 3
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i := 0; i < 30; i++ {
+		for _, res := range []int64{downsample.ResLevel0, downsample.ResLevel1} {
+			for _, replica := range []string{"a", "b"} {
+				m := &metadata.Meta{}
+				m.ULID = ulid.MustNew(uint64(len(metas)), nil)
+				m.Thanos.Labels = map[string]string{"cluster": strconv.Itoa(i), "replica": replica}
+				m.Thanos.Downsample.Resolution = res
+				metas[m.ULID] = m
+			}
+		}
+	}
+
+	owners := map[string]int{}
+	for i := 0; i < shards; i++ {
+		f, err := NewGroupShardingFilter(shards, i, []string{"replica"})
+		testutil.Ok(t, err)
+
+		filtered := make(map[ulid.ULID]*metadata.Meta, len(metas))
+		for id, m := range metas {
+			filtered[id] = m
+		}
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"state"})
+		testutil.Ok(t, f.Filter(context.Background(), filtered, synced))
+		testutil.Equals(t, float64(len(metas)-len(filtered)), promtest.ToFloat64(synced.WithLabelValues(shardExcludedMeta)))
+		testutil.Assert(t, len(filtered) > 0, "expected blocks owned by shard %d", i)
+
+		for _, m := range filtered {
+			cluster := m.Thanos.Labels["cluster"]
+			if owner, ok := owners[cluster]; ok {
+				testutil.Equals(t, i, owner, "all resolutions and replicas of cluster %s are expected in the same shard", cluster)
+				continue
+			}
+			owners[cluster] = i
+		}
+	}
+	testutil.Equals(t, 30, len(owners))
+
+	// A single shard owns everything.
+	f, err := NewGroupShardingFilter(1, 0, nil)
+	testutil.Ok(t, err)
+	filtered := make(map[ulid.ULID]*metadata.Meta, len(metas))
+	for id, m := range metas {
+		filtered[id] = m
+	}
+	testutil.Ok(t, f.Filter(context.Background(), filtered, extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"state"})))
+	testutil.Equals(t, metas, filtered)
+}
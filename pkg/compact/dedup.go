@@ -0,0 +1,333 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// PenaltyDedupFunc is the name of the penalty based deduplication of the replicas during vertical compaction.
+const PenaltyDedupFunc = "penalty"
+
+// maxSamplesPerChunk is the max number of samples of the chunks written by PenaltyDedupCompactor, same as in Prometheus head.
+const maxSamplesPerChunk = 120
+
+// PenaltyDedupCompactor is a Compactor which merges the overlapping blocks of HA replicas using the same penalty based
+// deduplication as the querier, instead of chaining the samples of all the replicas together.
+// The replica of each block is identified by the values of the replica labels in its external labels. Compactions of
+// blocks of a single replica and of downsampled blocks are delegated to the wrapped compactor.
+type PenaltyDedupCompactor struct {
+	ctx           context.Context
+	logger        log.Logger
+	replicaLabels []string
+	chained       Compactor
+}
+
+// NewPenaltyDedupCompactor creates PenaltyDedupCompactor.
+func NewPenaltyDedupCompactor(ctx context.Context, logger log.Logger, replicaLabels []string, chained Compactor) *PenaltyDedupCompactor {
+	return &PenaltyDedupCompactor{
+		ctx:           ctx,
+		logger:        logger,
+		replicaLabels: replicaLabels,
+		chained:       chained,
+	}
+}
+
+// Write persists a Block into a directory using the wrapped compactor.
+func (c *PenaltyDedupCompactor) Write(dest string, b tsdb.BlockReader, mint, maxt int64, parent *tsdb.BlockMeta) (ulid.ULID, error) {
+	return c.chained.Write(dest, b, mint, maxt, parent)
+}
+
+// Compact compacts the blocks of the given directories into a new block in dest, deduplicating the samples of
+// the same series from different replicas. Open blocks are ignored, as the blocks are read from the directories.
+func (c *PenaltyDedupCompactor) Compact(dest string, dirs []string, open []*tsdb.Block) (_ ulid.ULID, rerr error) {
+	var (
+		metas    = make([]*metadata.Meta, 0, len(dirs))
+		replicas = map[string]int{}
+	)
+	for _, dir := range dirs {
+		m, err := metadata.Read(dir)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "read meta from %s", dir)
+		}
+		if m.Thanos.Downsample.Resolution != downsample.ResLevel0 {
+			return c.chained.Compact(dest, dirs, open)
+		}
+		if _, ok := replicas[c.replicaOf(m.Thanos.Labels)]; !ok {
+			replicas[c.replicaOf(m.Thanos.Labels)] = len(replicas)
+		}
+		metas = append(metas, m)
+	}
+	if len(replicas) < 2 {
+		return c.chained.Compact(dest, dirs, open)
+	}
+
+	meta := compactedMeta(metas)
+	var (
+		sets    = make([]storage.SeriesSet, 0, len(dirs))
+		symbols = map[string]struct{}{}
+	)
+	for i, dir := range dirs {
+		b, err := tsdb.OpenBlock(c.logger, dir, nil)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "open block %s", dir)
+		}
+		defer runutil.CloseWithErrCapture(&rerr, b, "close block")
+
+		if err := addSymbols(b, symbols); err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "read symbols of block %s", dir)
+		}
+
+		// Blocks meta is half open: [min, max), so subtract 1 to ensure we don't hold samples with exact meta.MaxTime timestamp.
+		q, err := tsdb.NewBlockQuerier(b, meta.MinTime, meta.MaxTime-1)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "create querier for block %s", dir)
+		}
+		defer runutil.CloseWithErrCapture(&rerr, q, "close querier")
+
+		sets = append(sets, replicaSeriesSet{
+			SeriesSet: q.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".*")),
+			replica:   replicas[c.replicaOf(metas[i].Thanos.Labels)],
+		})
+	}
+
+	dir := filepath.Join(dest, meta.ULID.String())
+	tmp := dir + ".tmp"
+	defer func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			level.Error(c.logger).Log("msg", "failed to remove tmp dir after compaction", "dir", tmp, "err", err)
+		}
+	}()
+
+	if err := c.writeBlock(tmp, meta, symbols, storage.NewMergeSeriesSet(sets, mergeReplicas)); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write block")
+	}
+	if meta.Stats.NumSamples == 0 {
+		level.Info(c.logger).Log("msg", "deduplicated block would have no samples", "mint", meta.MinTime, "maxt", meta.MaxTime)
+		return ulid.ULID{}, nil
+	}
+
+	if err := meta.WriteToDir(c.logger, tmp); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write meta")
+	}
+	// Create an empty tombstones file, as expected for the blocks written by the Prometheus compactor.
+	if _, err := tombstones.WriteFile(c.logger, tmp, tombstones.NewMemTombstones()); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write tombstones")
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "rename block dir")
+	}
+
+	level.Info(c.logger).Log("msg", "compacted blocks with penalty deduplication", "ulid", meta.ULID, "replicas", len(replicas),
+		"mint", meta.MinTime, "maxt", meta.MaxTime)
+	return meta.ULID, nil
+}
+
+func (c *PenaltyDedupCompactor) writeBlock(dir string, meta *metadata.Meta, symbols map[string]struct{}, set storage.SeriesSet) (err error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	chunkw, err := chunks.NewWriter(filepath.Join(dir, block.ChunksDirname))
+	if err != nil {
+		return errors.Wrap(err, "open chunk writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkw, "close chunk writer")
+
+	indexw, err := index.NewWriter(c.ctx, filepath.Join(dir, block.IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "open index writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexw, "close index writer")
+
+	syms := make([]string, 0, len(symbols))
+	for s := range symbols {
+		syms = append(syms, s)
+	}
+	sort.Strings(syms)
+	for _, s := range syms {
+		if err := indexw.AddSymbol(s); err != nil {
+			return errors.Wrap(err, "add symbol")
+		}
+	}
+
+	var ref uint64
+	for set.Next() {
+		select {
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		default:
+		}
+
+		s := set.At()
+		chks, samples, err := encodeChunks(s.Iterator())
+		if err != nil {
+			return errors.Wrapf(err, "encode chunks of series %s", s.Labels())
+		}
+		if len(chks) == 0 {
+			continue
+		}
+		if err := chunkw.WriteChunks(chks...); err != nil {
+			return errors.Wrap(err, "write chunks")
+		}
+		if err := indexw.AddSeries(ref, s.Labels(), chks...); err != nil {
+			return errors.Wrap(err, "add series")
+		}
+		ref++
+
+		meta.Stats.NumSeries++
+		meta.Stats.NumChunks += uint64(len(chks))
+		meta.Stats.NumSamples += samples
+	}
+	return errors.Wrap(set.Err(), "iterate series")
+}
+
+// replicaOf returns the identifier of the replica of a block with the given external labels.
+func (c *PenaltyDedupCompactor) replicaOf(lbls map[string]string) string {
+	values := make([]string, 0, len(c.replicaLabels))
+	for _, l := range c.replicaLabels {
+		values = append(values, lbls[l])
+	}
+	return strings.Join(values, "\xff")
+}
+
+// compactedMeta returns the meta of the block compacted from the given blocks, the same way as the Prometheus compactor.
+func compactedMeta(metas []*metadata.Meta) *metadata.Meta {
+	res := &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustNew(ulid.Now(), rand.Reader),
+			MinTime: math.MaxInt64,
+			MaxTime: math.MinInt64,
+			Version: metadata.TSDBVersion1,
+		},
+	}
+
+	sources := map[ulid.ULID]struct{}{}
+	for _, m := range metas {
+		if m.MinTime < res.MinTime {
+			res.MinTime = m.MinTime
+		}
+		if m.MaxTime > res.MaxTime {
+			res.MaxTime = m.MaxTime
+		}
+		if m.Compaction.Level > res.Compaction.Level {
+			res.Compaction.Level = m.Compaction.Level
+		}
+		for _, s := range m.Compaction.Sources {
+			sources[s] = struct{}{}
+		}
+		res.Compaction.Parents = append(res.Compaction.Parents, tsdb.BlockDesc{
+			ULID:    m.ULID,
+			MinTime: m.MinTime,
+			MaxTime: m.MaxTime,
+		})
+	}
+	res.Compaction.Level++
+
+	for s := range sources {
+		res.Compaction.Sources = append(res.Compaction.Sources, s)
+	}
+	sort.Slice(res.Compaction.Sources, func(i, j int) bool {
+		return res.Compaction.Sources[i].Compare(res.Compaction.Sources[j]) < 0
+	})
+	return res
+}
+
+func addSymbols(b tsdb.BlockReader, symbols map[string]struct{}) (err error) {
+	indexr, err := b.Index()
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, indexr, "close index reader")
+
+	it := indexr.Symbols()
+	for it.Next() {
+		symbols[it.At()] = struct{}{}
+	}
+	return it.Err()
+}
+
+// encodeChunks encodes the samples of the given iterator into XOR chunks of maxSamplesPerChunk samples.
+func encodeChunks(it chunkenc.Iterator) (chks []chunks.Meta, samples uint64, err error) {
+	var app chunkenc.Appender
+	for it.Next() {
+		t, v := it.At()
+		if len(chks) == 0 || chks[len(chks)-1].Chunk.NumSamples() >= maxSamplesPerChunk {
+			chk := chunkenc.NewXORChunk()
+			if app, err = chk.Appender(); err != nil {
+				return nil, 0, err
+			}
+			chks = append(chks, chunks.Meta{MinTime: t, Chunk: chk})
+		}
+		app.Append(t, v)
+		chks[len(chks)-1].MaxTime = t
+		samples++
+	}
+	return chks, samples, it.Err()
+}
+
+// mergeReplicas merges the series with the same labels from different blocks. Series from blocks of the same replica
+// are chained together, while different replicas are deduplicated.
+func mergeReplicas(series ...storage.Series) storage.Series {
+	var (
+		ids       []int
+		byReplica = map[int][]storage.Series{}
+	)
+	for _, s := range series {
+		r := s.(replicaSeries).replica
+		if _, ok := byReplica[r]; !ok {
+			ids = append(ids, r)
+		}
+		byReplica[r] = append(byReplica[r], s)
+	}
+	sort.Ints(ids)
+
+	replicas := make([]storage.Series, 0, len(ids))
+	for _, id := range ids {
+		replicas = append(replicas, storage.ChainedSeriesMerge(byReplica[id]...))
+	}
+	if len(replicas) == 1 {
+		return replicas[0]
+	}
+	return query.NewDedupSeries(series[0].Labels(), replicas, false)
+}
+
+// replicaSeriesSet is a storage.SeriesSet of a block, which annotates its series with the replica of the block.
+type replicaSeriesSet struct {
+	storage.SeriesSet
+	replica int
+}
+
+func (s replicaSeriesSet) At() storage.Series {
+	return replicaSeries{Series: s.SeriesSet.At(), replica: s.replica}
+}
+
+type replicaSeries struct {
+	storage.Series
+	replica int
+}
@@ -0,0 +1,145 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type sample struct {
+	t int64
+	v float64
+}
+
+type chainedCompactorMock struct {
+	Compactor
+	compacted [][]string
+}
+
+func (c *chainedCompactorMock) Compact(_ string, dirs []string, _ []*tsdb.Block) (ulid.ULID, error) {
+	c.compacted = append(c.compacted, dirs)
+	return ulid.ULID{}, nil
+}
+
+func TestPenaltyDedupCompactor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "penalty-dedup")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	ctx := context.Background()
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+	createBlock := func(extLset map[string]string, samples []sample) string {
+		w, err := tsdb.NewBlockWriter(log.NewNopLogger(), dir, 2*3600*1000)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, w.Close()) }()
+
+		app := w.Appender(ctx)
+		for _, lset := range series {
+			for _, s := range samples {
+				_, err := app.Add(lset, s.t, s.v)
+				testutil.Ok(t, err)
+			}
+		}
+		testutil.Ok(t, app.Commit())
+		id, err := w.Flush(ctx)
+		testutil.Ok(t, err)
+
+		bdir := filepath.Join(dir, id.String())
+		_, err = metadata.InjectThanos(log.NewNopLogger(), bdir, metadata.Thanos{Labels: extLset, Source: metadata.TestSource}, nil)
+		testutil.Ok(t, err)
+		return bdir
+	}
+
+	// Replica "b" is scraped with an offset and replica "a" has a gap in the middle.
+	var replicaA, replicaB []sample
+	for ts := int64(0); ts < 10000; ts += 100 {
+		if ts < 4000 || ts >= 6000 {
+			replicaA = append(replicaA, sample{t: ts, v: float64(ts)})
+		}
+		replicaB = append(replicaB, sample{t: ts + 50, v: float64(ts + 50)})
+	}
+	dirA := createBlock(map[string]string{"cluster": "x", "replica": "a"}, replicaA)
+	dirB := createBlock(map[string]string{"cluster": "x", "replica": "b"}, replicaB)
+	dirA2 := createBlock(map[string]string{"cluster": "x", "replica": "a"}, []sample{{t: 10000, v: 10000}})
+
+	chained := &chainedCompactorMock{}
+	comp := NewPenaltyDedupCompactor(ctx, log.NewNopLogger(), []string{"replica"}, chained)
+
+	t.Run("single replica is compacted by the chained compactor", func(t *testing.T) {
+		_, err := comp.Compact(dir, []string{dirA, dirA2}, nil)
+		testutil.Ok(t, err)
+		testutil.Equals(t, [][]string{{dirA, dirA2}}, chained.compacted)
+	})
+
+	t.Run("replicas are deduplicated", func(t *testing.T) {
+		id, err := comp.Compact(dir, []string{dirA, dirB, dirA2}, nil)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(chained.compacted))
+
+		meta, err := metadata.Read(filepath.Join(dir, id.String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(0), meta.MinTime)
+		testutil.Equals(t, int64(10001), meta.MaxTime)
+		testutil.Equals(t, 2, meta.Compaction.Level)
+		testutil.Equals(t, 3, len(meta.Compaction.Sources))
+		testutil.Equals(t, 3, len(meta.Compaction.Parents))
+
+		// Replica "a" is followed until its gap, then replica "b" until it ends, the same as when querying.
+		// Samples of the replica not picked are skipped by the penalty: the samples of "b" before
+		// the initial penalty of 5s and the last sample of "a" right after the end of "b".
+		var exp []sample
+		for _, s := range replicaA {
+			if s.t < 4000 {
+				exp = append(exp, s)
+			}
+		}
+		for _, s := range replicaB {
+			if s.t > 5000 {
+				exp = append(exp, s)
+			}
+		}
+
+		b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, id.String()), nil)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, b.Close()) }()
+		q, err := tsdb.NewBlockQuerier(b, meta.MinTime, meta.MaxTime)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, q.Close()) }()
+
+		set := q.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, "a", ".+"))
+		var got []labels.Labels
+		for set.Next() {
+			got = append(got, set.At().Labels())
+			testutil.Equals(t, exp, expandSeries(t, set.At()))
+		}
+		testutil.Ok(t, set.Err())
+		testutil.Equals(t, series, got)
+
+		testutil.Equals(t, uint64(2), meta.Stats.NumSeries)
+		testutil.Equals(t, uint64(2*len(exp)), meta.Stats.NumSamples)
+	})
+}
+
+func expandSeries(t *testing.T, s storage.Series) (res []sample) {
+	it := s.Iterator()
+	for it.Next() {
+		ts, v := it.At()
+		res = append(res, sample{t: ts, v: v})
+	}
+	testutil.Ok(t, it.Err())
+	return res
+}
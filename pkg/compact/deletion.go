@@ -0,0 +1,314 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// DeletionRequestsDir is the directory of the bucket with the deletion requests applied by the compactor.
+const DeletionRequestsDir = "deletion-requests"
+
+// DeletionRequest requests the deletion of the samples of the series matching the selector within the closed
+// time range [MinTime, MaxTime], in milliseconds. A MaxTime of 0 means no upper bound.
+// Deletion requests are JSON files with the .json extension in the DeletionRequestsDir of the bucket.
+type DeletionRequest struct {
+	// Name of the deletion request, which is the name of its file without the extension.
+	Name     string `json:"-"`
+	Selector string `json:"selector"`
+	MinTime  int64  `json:"min_time"`
+	MaxTime  int64  `json:"max_time"`
+
+	matchers []*labels.Matcher
+}
+
+// ReadDeletionRequests reads the deletion requests from the bucket, sorted by name. Invalid deletion requests are skipped.
+func ReadDeletionRequests(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) ([]*DeletionRequest, error) {
+	var reqs []*DeletionRequest
+	if err := bkt.Iter(ctx, DeletionRequestsDir, func(name string) error {
+		if path.Ext(name) != ".json" {
+			return nil
+		}
+		req, err := readDeletionRequest(ctx, bkt, name)
+		if err != nil {
+			level.Warn(logger).Log("msg", "skipping invalid deletion request", "file", name, "err", err)
+			return nil
+		}
+		reqs = append(reqs, req)
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "iterate deletion requests")
+	}
+
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].Name < reqs[j].Name
+	})
+	return reqs, nil
+}
+
+func readDeletionRequest(ctx context.Context, bkt objstore.BucketReader, name string) (_ *DeletionRequest, err error) {
+	r, err := bkt.Get(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", name)
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "close deletion request")
+
+	req := &DeletionRequest{Name: strings.TrimSuffix(path.Base(name), ".json")}
+	if err := json.NewDecoder(r).Decode(req); err != nil {
+		return nil, errors.Wrap(err, "decode deletion request")
+	}
+	if req.matchers, err = parser.ParseMetricSelector(req.Selector); err != nil {
+		return nil, errors.Wrap(err, "parse selector")
+	}
+	if req.MaxTime == 0 {
+		req.MaxTime = math.MaxInt64
+	}
+	if req.MinTime > req.MaxTime {
+		return nil, errors.Errorf("min time %d is after max time %d", req.MinTime, req.MaxTime)
+	}
+	return req, nil
+}
+
+// DeletionRewriter rewrites the blocks with series matching the deletion requests of the bucket, omitting the requested data.
+// The names of the applied deletion requests are kept in the meta of the rewritten blocks, and of the blocks compacted or
+// downsampled from these, so the blocks are rewritten once.
+// Not go routine safe.
+type DeletionRewriter struct {
+	logger                  log.Logger
+	bkt                     objstore.Bucket
+	comp                    Compactor
+	dir                     string
+	blocksRewritten         prometheus.Counter
+	blocksMarkedForDeletion prometheus.Counter
+
+	// checked are the deletion requests checked since the start, for blocks without any series to delete.
+	checked map[ulid.ULID]map[string]struct{}
+}
+
+// NewDeletionRewriter creates DeletionRewriter.
+func NewDeletionRewriter(
+	logger log.Logger,
+	bkt objstore.Bucket,
+	comp Compactor,
+	dir string,
+	blocksRewritten prometheus.Counter,
+	blocksMarkedForDeletion prometheus.Counter,
+) *DeletionRewriter {
+	return &DeletionRewriter{
+		logger:                  logger,
+		bkt:                     bkt,
+		comp:                    comp,
+		dir:                     dir,
+		blocksRewritten:         blocksRewritten,
+		blocksMarkedForDeletion: blocksMarkedForDeletion,
+		checked:                 map[ulid.ULID]map[string]struct{}{},
+	}
+}
+
+// Rewrite rewrites the given blocks with series matching deletion requests not applied to them yet.
+// The original blocks are marked for deletion.
+func (r *DeletionRewriter) Rewrite(ctx context.Context, metas map[ulid.ULID]*metadata.Meta) error {
+	reqs, err := ReadDeletionRequests(ctx, r.logger, r.bkt)
+	if err != nil {
+		return retry(err)
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	for id, m := range metas {
+		pending := r.pending(m, reqs)
+		if len(pending) == 0 {
+			continue
+		}
+		if err := r.rewrite(ctx, m, pending); err != nil {
+			return errors.Wrapf(err, "rewrite block %s", id)
+		}
+	}
+	return nil
+}
+
+func (r *DeletionRewriter) pending(m *metadata.Meta, reqs []*DeletionRequest) []*DeletionRequest {
+	applied := map[string]struct{}{}
+	for _, name := range m.Thanos.DeletionRequests {
+		applied[name] = struct{}{}
+	}
+
+	var pending []*DeletionRequest
+	for _, req := range reqs {
+		// Blocks meta is half open: [min, max), while deletion requests are closed intervals.
+		if req.MaxTime < m.MinTime || req.MinTime >= m.MaxTime {
+			continue
+		}
+		if _, ok := applied[req.Name]; ok {
+			continue
+		}
+		if _, ok := r.checked[m.ULID][req.Name]; ok {
+			continue
+		}
+		pending = append(pending, req)
+	}
+	return pending
+}
+
+func (r *DeletionRewriter) rewrite(ctx context.Context, m *metadata.Meta, reqs []*DeletionRequest) (err error) {
+	bdir := filepath.Join(r.dir, m.ULID.String())
+	defer func() {
+		if err := os.RemoveAll(bdir); err != nil {
+			level.Error(r.logger).Log("msg", "failed to remove block dir after rewrite", "dir", bdir, "err", err)
+		}
+	}()
+
+	if err := block.Download(ctx, r.logger, r.bkt, m.ULID, bdir); err != nil {
+		return retry(errors.Wrapf(err, "download block %s", m.ULID))
+	}
+	b, err := tsdb.OpenBlock(r.logger, bdir, downsample.NewPool())
+	if err != nil {
+		return errors.Wrapf(err, "open block %s", m.ULID)
+	}
+	defer runutil.CloseWithErrCapture(&err, b, "close block")
+
+	if r.checked[m.ULID] == nil {
+		r.checked[m.ULID] = map[string]struct{}{}
+	}
+	var applied []string
+	for _, req := range reqs {
+		r.checked[m.ULID][req.Name] = struct{}{}
+
+		// Aggregated chunks of downsampled blocks can't be trimmed, only whole chunks can be deleted.
+		if m.Thanos.Downsample.Resolution != downsample.ResLevel0 && (req.MinTime > m.MinTime || req.MaxTime < m.MaxTime-1) {
+			level.Warn(r.logger).Log("msg", "deletion requests not covering whole downsampled blocks are not supported; skipping",
+				"request", req.Name, "block", m.ULID)
+			continue
+		}
+		if err := b.Delete(req.MinTime, req.MaxTime, req.matchers...); err != nil {
+			return errors.Wrapf(err, "delete series of request %s", req.Name)
+		}
+		applied = append(applied, req.Name)
+	}
+
+	tombs, err := b.Tombstones()
+	if err != nil {
+		return errors.Wrap(err, "read tombstones")
+	}
+	deleted := tombs.Total()
+	if err := tombs.Close(); err != nil {
+		return errors.Wrap(err, "close tombstones")
+	}
+	if deleted == 0 {
+		level.Debug(r.logger).Log("msg", "no series to delete found in block", "block", m.ULID)
+		return nil
+	}
+
+	level.Info(r.logger).Log("msg", "rewriting block to apply deletion requests", "block", m.ULID, "requests", strings.Join(applied, ","), "series", deleted)
+	id, err := r.comp.Write(r.dir, b, m.MinTime, m.MaxTime, &m.BlockMeta)
+	if err != nil {
+		return errors.Wrapf(err, "write block without deleted series")
+	}
+
+	if id != (ulid.ULID{}) {
+		if err := r.upload(ctx, m, id, applied); err != nil {
+			return err
+		}
+	} else {
+		level.Info(r.logger).Log("msg", "rewritten block would have no samples, deleting original block", "block", m.ULID)
+	}
+
+	// Spawn a new context so we always mark a block for deletion in full on shutdown.
+	delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := block.MarkForDeletion(delCtx, r.logger, r.bkt, m.ULID, "source of rewritten block", r.blocksMarkedForDeletion); err != nil {
+		return retry(errors.Wrapf(err, "mark block %s for deletion", m.ULID))
+	}
+	return nil
+}
+
+func (r *DeletionRewriter) upload(ctx context.Context, m *metadata.Meta, id ulid.ULID, applied []string) error {
+	bdir := filepath.Join(r.dir, id.String())
+	defer func() {
+		if err := os.RemoveAll(bdir); err != nil {
+			level.Error(r.logger).Log("msg", "failed to remove rewritten block dir", "dir", bdir, "err", err)
+		}
+	}()
+
+	thanosMeta := m.Thanos
+	thanosMeta.Source = metadata.CompactorSource
+	thanosMeta.SegmentFiles = block.GetSegmentFiles(bdir)
+	thanosMeta.Files = nil
+	thanosMeta.DeletionRequests = append(append([]string{}, m.Thanos.DeletionRequests...), applied...)
+	sort.Strings(thanosMeta.DeletionRequests)
+
+	// Keep the compaction of the original block, adding the rewritten block to its sources. This way the original block
+	// is filtered out as a duplicate of the rewritten one, until it is deleted.
+	rewrittenMeta := m.BlockMeta
+	rewrittenMeta.Compaction.Sources = append(append([]ulid.ULID{}, m.Compaction.Sources...), id)
+	rewrittenMeta.Compaction.Parents = []tsdb.BlockDesc{{ULID: m.ULID, MinTime: m.MinTime, MaxTime: m.MaxTime}}
+
+	newMeta, err := metadata.InjectThanos(r.logger, bdir, thanosMeta, &rewrittenMeta)
+	if err != nil {
+		return errors.Wrapf(err, "failed to finalize the block %s", bdir)
+	}
+	if err := os.Remove(filepath.Join(bdir, "tombstones")); err != nil {
+		return errors.Wrap(err, "remove tombstones")
+	}
+	if err := block.VerifyIndex(r.logger, filepath.Join(bdir, block.IndexFilename), newMeta.MinTime, newMeta.MaxTime); err != nil {
+		return halt(errors.Wrapf(err, "invalid rewritten block %s", bdir))
+	}
+
+	if err := block.Upload(ctx, r.logger, r.bkt, bdir); err != nil {
+		return retry(errors.Wrapf(err, "upload of %s failed", id))
+	}
+	r.blocksRewritten.Inc()
+	level.Info(r.logger).Log("msg", "uploaded rewritten block", "block", m.ULID, "result_block", id)
+	return nil
+}
+
+// appliedDeletionRequests returns the sorted names of the deletion requests applied to all the given blocks.
+func appliedDeletionRequests(metas []*metadata.Meta) []string {
+	if len(metas) == 0 {
+		return nil
+	}
+	var applied []string
+Outer:
+	for _, name := range metas[0].Thanos.DeletionRequests {
+		for _, m := range metas[1:] {
+			found := false
+			for _, n := range m.Thanos.DeletionRequests {
+				if n == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue Outer
+			}
+		}
+		applied = append(applied, name)
+	}
+	sort.Strings(applied)
+	return applied
+}
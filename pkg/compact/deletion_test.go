@@ -0,0 +1,153 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestReadDeletionRequests(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	for name, content := range map[string]string{
+		"b.json":        `{"selector": "{a=\"1\"}", "min_time": 10, "max_time": 20}`,
+		"a.json":        `{"selector": "{a=\"2\"}"}`,
+		"invalid.json":  `{"selector": "{a="}`,
+		"reversed.json": `{"selector": "{a=\"2\"}", "min_time": 20, "max_time": 10}`,
+		"other.txt":     `{"selector": "{a=\"3\"}"}`,
+	} {
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(DeletionRequestsDir, name), strings.NewReader(content)))
+	}
+
+	reqs, err := ReadDeletionRequests(ctx, log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(reqs))
+	testutil.Equals(t, "a", reqs[0].Name)
+	testutil.Equals(t, int64(0), reqs[0].MinTime)
+	testutil.Equals(t, int64(1<<63-1), reqs[0].MaxTime)
+	testutil.Equals(t, "b", reqs[1].Name)
+	testutil.Equals(t, int64(10), reqs[1].MinTime)
+	testutil.Equals(t, int64(20), reqs[1].MaxTime)
+	testutil.Equals(t, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "1")}, reqs[1].matchers)
+}
+
+func TestDeletionRewriter_Rewrite(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "deletion-rewriter")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+	origID, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 1000, labels.FromStrings("cluster", "x"), 0)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, origID.String())))
+
+	for name, content := range map[string]string{
+		"delete-a1":       `{"selector": "{a=\"1\"}", "max_time": 499}`,
+		"not-found":       `{"selector": "{a=\"3\"}"}`,
+		"not-overlapping": `{"selector": "{a=\"2\"}", "min_time": 1000}`,
+	} {
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(DeletionRequestsDir, name+".json"), strings.NewReader(content)))
+	}
+
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000}, nil)
+	testutil.Ok(t, err)
+	var (
+		blocksRewritten         = promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+		blocksMarkedForDeletion = promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	)
+	r := NewDeletionRewriter(logger, bkt, comp, filepath.Join(dir, "rewrite"), blocksRewritten, blocksMarkedForDeletion)
+
+	fetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil, nil, nil)
+	testutil.Ok(t, err)
+	metas, _, err := fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Ok(t, r.Rewrite(ctx, metas))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksRewritten))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksMarkedForDeletion))
+
+	metas, _, err = fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(metas))
+	var rewritten *metadata.Meta
+	for id, m := range metas {
+		if id != origID {
+			rewritten = m
+		}
+	}
+	testutil.Equals(t, []string{"delete-a1", "not-found"}, rewritten.Thanos.DeletionRequests)
+	testutil.Equals(t, map[string]string{"cluster": "x"}, rewritten.Thanos.Labels)
+	testutil.Equals(t, []ulid.ULID{origID, rewritten.ULID}, rewritten.Compaction.Sources)
+	testutil.Equals(t, metas[origID].Compaction.Level, rewritten.Compaction.Level)
+	testutil.Equals(t, int64(0), rewritten.MinTime)
+	testutil.Equals(t, int64(1000), rewritten.MaxTime)
+	// Samples are 9ms apart, so 56 samples of the first series are deleted.
+	testutil.Equals(t, uint64(144), rewritten.Stats.NumSamples)
+
+	exists, err := bkt.Exists(ctx, path.Join(origID.String(), metadata.DeletionMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists, "expected original block to be marked for deletion")
+
+	// Applied deletion requests are not applied again.
+	testutil.Ok(t, r.Rewrite(ctx, metas))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(blocksRewritten))
+
+	bdir := filepath.Join(dir, rewritten.ULID.String())
+	testutil.Ok(t, block.Download(ctx, logger, bkt, rewritten.ULID, bdir))
+	b, err := tsdb.OpenBlock(logger, bdir, nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	q, err := tsdb.NewBlockQuerier(b, rewritten.MinTime, rewritten.MaxTime)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+
+	set := q.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, "a", ".+"))
+	samples := map[string]int{}
+	for set.Next() {
+		it := set.At().Iterator()
+		for it.Next() {
+			ts, _ := it.At()
+			if set.At().Labels().Get("a") == "1" {
+				testutil.Assert(t, ts > 499, "unexpected sample %d of deleted series", ts)
+			}
+			samples[set.At().Labels().Get("a")]++
+		}
+		testutil.Ok(t, it.Err())
+	}
+	testutil.Ok(t, set.Err())
+	testutil.Equals(t, map[string]int{"1": 44, "2": 100}, samples)
+}
+
+func TestAppliedDeletionRequests(t *testing.T) {
+	newMeta := func(applied ...string) *metadata.Meta {
+		return &metadata.Meta{Thanos: metadata.Thanos{DeletionRequests: applied}}
+	}
+	testutil.Equals(t, []string(nil), appliedDeletionRequests(nil))
+	testutil.Equals(t, []string{"a", "b"}, appliedDeletionRequests([]*metadata.Meta{newMeta("a", "b")}))
+	testutil.Equals(t, []string{"b"}, appliedDeletionRequests([]*metadata.Meta{newMeta("a", "b", "c"), newMeta("b"), newMeta("c", "b")}))
+	testutil.Equals(t, []string(nil), appliedDeletionRequests([]*metadata.Meta{newMeta("a"), newMeta()}))
+}
@@ -4,6 +4,7 @@
 package downsample
 
 import (
+	"context"
 	"math"
 	"math/rand"
 	"os"
@@ -20,6 +21,7 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/index"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/block/writer"
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/runutil"
 )
@@ -49,6 +51,16 @@ func Downsample(
 		return id, errors.New("target resolution not lower than existing one")
 	}
 
+	// Remove the flushed block in case of errors closing the readers.
+	defer func() {
+		if err != nil && id != (ulid.ULID{}) {
+			var merr errutil.MultiError
+			merr.Add(err)
+			merr.Add(os.RemoveAll(filepath.Join(dir, id.String())))
+			err = merr.Err()
+		}
+	}()
+
 	indexr, err := b.Index()
 	if err != nil {
 		return id, errors.Wrap(err, "open index reader")
@@ -61,37 +73,19 @@ func Downsample(
 	}
 	defer runutil.CloseWithErrCapture(&err, chunkr, "downsample chunk reader")
 
-	// Generate new block id.
-	uid := ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
-
-	// Create block directory to populate with chunks, meta and index files into.
-	blockDir := filepath.Join(dir, uid.String())
-	if err := os.MkdirAll(blockDir, 0777); err != nil {
-		return id, errors.Wrap(err, "mkdir block dir")
-	}
-
-	// Remove blockDir in case of errors.
-	defer func() {
-		if err != nil {
-			var merr errutil.MultiError
-			merr.Add(err)
-			merr.Add(os.RemoveAll(blockDir))
-			err = merr.Err()
-		}
-	}()
-
 	// Copy original meta to the new one. Update downsampling resolution and ULID for a new block.
 	newMeta := *origMeta
 	newMeta.Thanos.Downsample.Resolution = resolution
-	newMeta.ULID = uid
+	newMeta.Thanos.Source = metadata.CompactorSource
+	newMeta.ULID = ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
 
 	// Writes downsampled chunks right into the files, avoiding excess memory allocation.
 	// Flushes index and meta data after aggregations.
-	streamedBlockWriter, err := NewStreamedBlockWriter(blockDir, indexr, logger, newMeta)
+	blockWriter, err := writer.NewFromMeta(logger, dir, newMeta)
 	if err != nil {
-		return id, errors.Wrap(err, "get streamed block writer")
+		return id, errors.Wrap(err, "create block writer")
 	}
-	defer runutil.CloseWithErrCapture(&err, streamedBlockWriter, "close stream block writer")
+	defer runutil.CloseWithErrCapture(&err, blockWriter, "close block writer")
 
 	postings, err := indexr.Postings(index.AllPostingsKey())
 	if err != nil {
@@ -143,7 +137,7 @@ func Downsample(
 					return id, errors.Wrapf(err, "expand chunk %d, series %d", c.Ref, postings.At())
 				}
 			}
-			if err := streamedBlockWriter.WriteSeries(lset, downsampleRaw(all, resolution)); err != nil {
+			if err := blockWriter.AppendChunks(lset, downsampleRaw(all, resolution)...); err != nil {
 				return id, errors.Wrapf(err, "downsample raw data, series: %d", postings.At())
 			}
 		} else {
@@ -166,7 +160,7 @@ func Downsample(
 			if err != nil {
 				return id, errors.Wrapf(err, "downsample aggregate block, series: %d", postings.At())
 			}
-			if err := streamedBlockWriter.WriteSeries(lset, downsampledChunks); err != nil {
+			if err := blockWriter.AppendChunks(lset, downsampledChunks...); err != nil {
 				return id, errors.Wrapf(err, "write series: %d", postings.At())
 			}
 		}
@@ -175,8 +169,8 @@ func Downsample(
 		return id, errors.Wrap(postings.Err(), "iterate series set")
 	}
 
-	id = uid
-	return
+	id, err = blockWriter.Flush(context.Background())
+	return id, errors.Wrap(err, "flush downsampled block")
 }
 
 // currentWindow returns the end timestamp of the window that t falls into.
@@ -0,0 +1,83 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Level is a downsampling level, to which the blocks of the previous level are downsampled.
+type Level struct {
+	// Resolution is the resolution of the blocks of the level, in milliseconds.
+	Resolution int64
+	// MinRange is the minimum time range of the blocks of the previous level to downsample, in milliseconds,
+	// so that the downsampled chunks have enough samples.
+	MinRange int64
+}
+
+// Levels are downsampling levels, sorted from the finest to the coarsest resolution.
+type Levels []Level
+
+// DefaultLevels are the standard downsampling levels in Thanos: raw blocks are downsampled to 5m, and 5m blocks
+// to 1h.
+var DefaultLevels = Levels{
+	{Resolution: ResLevel1, MinRange: DownsampleRange0},
+	{Resolution: ResLevel2, MinRange: DownsampleRange1},
+}
+
+// NewLevels returns the default downsampling levels with the given additional ones, e.g. a 1d resolution for
+// multi-year retention.
+func NewLevels(additional ...Level) (Levels, error) {
+	levels := append(Levels{}, DefaultLevels...)
+	for _, l := range additional {
+		if l.Resolution <= ResLevel0 {
+			return nil, errors.Errorf("invalid downsampling resolution %d", l.Resolution)
+		}
+		if l.MinRange <= 0 {
+			return nil, errors.Errorf("invalid minimum block range %d of downsampling resolution %s", l.MinRange, time.Duration(l.Resolution)*time.Millisecond)
+		}
+		for _, o := range levels {
+			if o.Resolution == l.Resolution {
+				return nil, errors.Errorf("duplicated downsampling resolution %s", time.Duration(l.Resolution)*time.Millisecond)
+			}
+		}
+		levels = append(levels, l)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Resolution < levels[j].Resolution })
+	return levels, nil
+}
+
+// Resolutions returns the resolutions of the levels, including the raw one, from the finest to the coarsest.
+func (l Levels) Resolutions() []int64 {
+	res := make([]int64, 0, len(l)+1)
+	res = append(res, ResLevel0)
+	for _, lvl := range l {
+		res = append(res, lvl.Resolution)
+	}
+	return res
+}
+
+// Contains returns true if the given resolution is the raw one or the one of a level.
+func (l Levels) Contains(resolution int64) bool {
+	for _, r := range l.Resolutions() {
+		if r == resolution {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the level to which the blocks of the given resolution are downsampled. It returns false if the
+// resolution is the coarsest one.
+func (l Levels) Next(resolution int64) (Level, bool) {
+	for _, lvl := range l {
+		if lvl.Resolution > resolution {
+			return lvl, true
+		}
+	}
+	return Level{}, false
+}
@@ -0,0 +1,47 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package downsample
+
+import (
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestLevels(t *testing.T) {
+	const resLevel1d = int64(24 * 60 * 60 * 1000)
+
+	levels, err := NewLevels()
+	testutil.Ok(t, err)
+	testutil.Equals(t, DefaultLevels, levels)
+	testutil.Equals(t, []int64{ResLevel0, ResLevel1, ResLevel2}, levels.Resolutions())
+
+	_, err = NewLevels(Level{Resolution: ResLevel2, MinRange: DownsampleRange1})
+	testutil.NotOk(t, err)
+	_, err = NewLevels(Level{Resolution: 0, MinRange: DownsampleRange1})
+	testutil.NotOk(t, err)
+	_, err = NewLevels(Level{Resolution: resLevel1d})
+	testutil.NotOk(t, err)
+
+	levels, err = NewLevels(Level{Resolution: resLevel1d, MinRange: 14 * 24 * 60 * 60 * 1000})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{ResLevel0, ResLevel1, ResLevel2, resLevel1d}, levels.Resolutions())
+	testutil.Assert(t, levels.Contains(resLevel1d), "1d resolution should be contained")
+	testutil.Assert(t, !levels.Contains(2*resLevel1d), "2d resolution should not be contained")
+
+	for _, tcase := range []struct {
+		resolution int64
+		next       int64
+		ok         bool
+	}{
+		{resolution: ResLevel0, next: ResLevel1, ok: true},
+		{resolution: ResLevel1, next: ResLevel2, ok: true},
+		{resolution: ResLevel2, next: resLevel1d, ok: true},
+		{resolution: resLevel1d, ok: false},
+	} {
+		next, ok := levels.Next(tcase.resolution)
+		testutil.Equals(t, tcase.ok, ok)
+		testutil.Equals(t, tcase.next, next.Resolution)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+// reportAgeBuckets are the upper bounds of the age groups of the blocks, by the time of their most recent samples.
+var reportAgeBuckets = []time.Duration{
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+	365 * 24 * time.Hour,
+}
+
+// reportSizeBuckets are the buckets of the block size histogram, from 1MiB to 256GiB.
+var reportSizeBuckets = prometheus.ExponentialBuckets(1<<20, 4, 10)
+
+// BucketReport summarizes the blocks of the bucket, as synced by the compactor.
+type BucketReport struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Blocks      int       `json:"blocks"`
+	// SizeBytes is the total size of the blocks listing their files, and so their sizes, in their meta.json.
+	SizeBytes    int64         `json:"sizeBytes"`
+	ByResolution []ReportGroup `json:"byResolution"`
+	ByLevel      []ReportGroup `json:"byLevel"`
+	ByAge        []ReportGroup `json:"byAge"`
+	// Expiring are the blocks deleted by the object lifecycle rules of the provider before their retention.
+	Expiring []ExpiringBlock `json:"expiring"`
+}
+
+// ReportGroup aggregates the blocks of a resolution, compaction level or age group of a BucketReport.
+type ReportGroup struct {
+	Group     string `json:"group"`
+	Blocks    int    `json:"blocks"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// ExpiringBlock is a block deleted by an object lifecycle rule before its retention.
+type ExpiringBlock struct {
+	ID        ulid.ULID `json:"id"`
+	Rule      string    `json:"rule"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// RetainedUntil is the time the block is deleted by the retention, or nil if it is retained forever.
+	RetainedUntil *time.Time `json:"retainedUntil,omitempty"`
+}
+
+// BucketReporter reports the blocks of the bucket after each sync, as BucketReport and as metrics, and warns about
+// the blocks deleted by the object lifecycle rules of the provider before their retention.
+type BucketReporter struct {
+	logger                log.Logger
+	retentionByResolution map[ResolutionLevel]time.Duration
+	policies              []*RetentionPolicy
+
+	mtx    sync.Mutex
+	rules  []objstore.ExpirationRule
+	metas  []metadata.Meta
+	report *BucketReport
+
+	blocksDesc   *prometheus.Desc
+	sizeDesc     *prometheus.Desc
+	ageDesc      *prometheus.Desc
+	expiringDesc *prometheus.Desc
+}
+
+// NewBucketReporter creates BucketReporter, checking the blocks against the given retentions, and registers its
+// metrics in reg.
+func NewBucketReporter(logger log.Logger, reg prometheus.Registerer, retentionByResolution map[ResolutionLevel]time.Duration, policies []*RetentionPolicy) *BucketReporter {
+	r := &BucketReporter{
+		logger:                logger,
+		retentionByResolution: retentionByResolution,
+		policies:              policies,
+		blocksDesc: prometheus.NewDesc(
+			"thanos_compact_bucket_blocks",
+			"Number of blocks in the bucket by resolution and compaction level, as of the last sync.",
+			[]string{"resolution", "level"}, nil,
+		),
+		sizeDesc: prometheus.NewDesc(
+			"thanos_compact_bucket_block_size_bytes",
+			"Size of the blocks in the bucket listing their files in their meta.json, as of the last sync.",
+			[]string{"resolution"}, nil,
+		),
+		ageDesc: prometheus.NewDesc(
+			"thanos_compact_bucket_block_age_seconds",
+			"Age of the most recent samples of the blocks in the bucket, as of the last sync.",
+			[]string{"resolution"}, nil,
+		),
+		expiringDesc: prometheus.NewDesc(
+			"thanos_compact_bucket_lifecycle_expiring_blocks",
+			"Number of blocks deleted by the object lifecycle rules of the provider before their retention, as of the last sync.",
+			nil, nil,
+		),
+	}
+	if reg != nil {
+		reg.MustRegister(r)
+	}
+	return r
+}
+
+// SetExpirationRules sets the object lifecycle rules of the provider the blocks are checked against.
+func (r *BucketReporter) SetExpirationRules(rules []objstore.ExpirationRule) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.rules = rules
+}
+
+// Update reports the given synced blocks.
+func (r *BucketReporter) Update(metas []metadata.Meta, now time.Time) *BucketReport {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	report := &BucketReport{GeneratedAt: now, Blocks: len(metas), Expiring: []ExpiringBlock{}}
+	byResolution := map[int64]*ReportGroup{}
+	byLevel := map[int]*ReportGroup{}
+	byAge := make([]ReportGroup, len(reportAgeBuckets)+1)
+	for i, b := range reportAgeBuckets {
+		byAge[i].Group = "<" + model.Duration(b).String()
+	}
+	byAge[len(reportAgeBuckets)].Group = ">=" + model.Duration(reportAgeBuckets[len(reportAgeBuckets)-1]).String()
+
+	for i := range metas {
+		m := &metas[i]
+		size := blockSize(m)
+		report.SizeBytes += size
+
+		res := m.Thanos.Downsample.Resolution
+		if byResolution[res] == nil {
+			byResolution[res] = &ReportGroup{Group: strconv.FormatInt(res, 10)}
+		}
+		byResolution[res].Blocks++
+		byResolution[res].SizeBytes += size
+
+		lvl := m.Compaction.Level
+		if byLevel[lvl] == nil {
+			byLevel[lvl] = &ReportGroup{Group: strconv.Itoa(lvl)}
+		}
+		byLevel[lvl].Blocks++
+		byLevel[lvl].SizeBytes += size
+
+		age := &byAge[ageBucket(m, now)]
+		age.Blocks++
+		age.SizeBytes += size
+
+		if e := expiringBlock(m, blockRetention(m, r.retentionByResolution, r.policies), r.rules); e != nil {
+			report.Expiring = append(report.Expiring, *e)
+		}
+	}
+
+	resolutions := make([]int64, 0, len(byResolution))
+	for res := range byResolution {
+		resolutions = append(resolutions, res)
+	}
+	sort.Slice(resolutions, func(i, j int) bool { return resolutions[i] < resolutions[j] })
+	for _, res := range resolutions {
+		report.ByResolution = append(report.ByResolution, *byResolution[res])
+	}
+	levels := make([]int, 0, len(byLevel))
+	for lvl := range byLevel {
+		levels = append(levels, lvl)
+	}
+	sort.Ints(levels)
+	for _, lvl := range levels {
+		report.ByLevel = append(report.ByLevel, *byLevel[lvl])
+	}
+	report.ByAge = byAge
+	sort.Slice(report.Expiring, func(i, j int) bool { return report.Expiring[i].ExpiresAt.Before(report.Expiring[j].ExpiresAt) })
+
+	if len(report.Expiring) > 0 {
+		first := report.Expiring[0]
+		level.Warn(r.logger).Log(
+			"msg", "object lifecycle rules of the bucket delete blocks before their retention, check the lifecycle configuration of the bucket",
+			"blocks", len(report.Expiring), "firstBlock", first.ID, "rule", first.Rule, "expiresAt", first.ExpiresAt,
+		)
+	}
+
+	r.metas = metas
+	r.report = report
+	return report
+}
+
+// Report returns the report of the last sync, or nil if no sync was reported yet.
+func (r *BucketReporter) Report() *BucketReport {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.report
+}
+
+// Describe implements prometheus.Collector.
+func (r *BucketReporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.blocksDesc
+	ch <- r.sizeDesc
+	ch <- r.ageDesc
+	ch <- r.expiringDesc
+}
+
+// Collect implements prometheus.Collector.
+func (r *BucketReporter) Collect(ch chan<- prometheus.Metric) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.report == nil {
+		return
+	}
+
+	type histogram struct {
+		count   uint64
+		sum     float64
+		buckets map[float64]uint64
+	}
+	observe := func(hs map[string]*histogram, res string, bounds []float64, v float64) {
+		h := hs[res]
+		if h == nil {
+			h = &histogram{buckets: make(map[float64]uint64, len(bounds))}
+			for _, b := range bounds {
+				h.buckets[b] = 0
+			}
+			hs[res] = h
+		}
+		h.count++
+		h.sum += v
+		for _, b := range bounds {
+			if v <= b {
+				h.buckets[b]++
+			}
+		}
+	}
+
+	ageBounds := make([]float64, 0, len(reportAgeBuckets))
+	for _, b := range reportAgeBuckets {
+		ageBounds = append(ageBounds, b.Seconds())
+	}
+	blocks := map[[2]string]int{}
+	sizes, ages := map[string]*histogram{}, map[string]*histogram{}
+	for i := range r.metas {
+		m := &r.metas[i]
+		res := strconv.FormatInt(m.Thanos.Downsample.Resolution, 10)
+		blocks[[2]string{res, strconv.Itoa(m.Compaction.Level)}]++
+		if len(m.Thanos.Files) > 0 {
+			observe(sizes, res, reportSizeBuckets, float64(blockSize(m)))
+		}
+		observe(ages, res, ageBounds, r.report.GeneratedAt.Sub(timestamp(m.MaxTime)).Seconds())
+	}
+
+	for k, n := range blocks {
+		ch <- prometheus.MustNewConstMetric(r.blocksDesc, prometheus.GaugeValue, float64(n), k[0], k[1])
+	}
+	for res, h := range sizes {
+		ch <- prometheus.MustNewConstHistogram(r.sizeDesc, h.count, h.sum, h.buckets, res)
+	}
+	for res, h := range ages {
+		ch <- prometheus.MustNewConstHistogram(r.ageDesc, h.count, h.sum, h.buckets, res)
+	}
+	ch <- prometheus.MustNewConstMetric(r.expiringDesc, prometheus.GaugeValue, float64(len(r.report.Expiring)))
+}
+
+// blockSize returns the size of the block from the files listed in its meta.json, or 0 if they are not listed.
+func blockSize(m *metadata.Meta) int64 {
+	var size int64
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	return size
+}
+
+func timestamp(ms int64) time.Time {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
+// ageBucket returns the index of the age group of the block in reportAgeBuckets, or len(reportAgeBuckets) if older.
+func ageBucket(m *metadata.Meta, now time.Time) int {
+	age := now.Sub(timestamp(m.MaxTime))
+	for i, b := range reportAgeBuckets {
+		if age < b {
+			return i
+		}
+	}
+	return len(reportAgeBuckets)
+}
+
+// expiringBlock returns the block if any of the given rules deletes its objects before the given retention, or nil.
+// The objects of the block are assumed to be uploaded at the time of its ULID.
+func expiringBlock(m *metadata.Meta, retention time.Duration, rules []objstore.ExpirationRule) *ExpiringBlock {
+	dir := m.ULID.String() + objstore.DirDelim
+	uploaded := ulid.Time(m.ULID.Time())
+
+	var retainedUntil *time.Time
+	if retention > 0 {
+		t := timestamp(m.MaxTime).Add(retention)
+		retainedUntil = &t
+	}
+
+	var e *ExpiringBlock
+	for _, rule := range rules {
+		// Rules deleting only some of the objects of the block corrupt it too.
+		if !strings.HasPrefix(dir, rule.Prefix) && !strings.HasPrefix(rule.Prefix, dir) {
+			continue
+		}
+		expiresAt := rule.At
+		if rule.After > 0 {
+			expiresAt = uploaded.Add(rule.After)
+		}
+		if retainedUntil != nil && !expiresAt.Before(*retainedUntil) {
+			continue
+		}
+		if e == nil || expiresAt.Before(e.ExpiresAt) {
+			e = &ExpiringBlock{ID: m.ULID, Rule: rule.ID, ExpiresAt: expiresAt, RetainedUntil: retainedUntil}
+		}
+	}
+	return e
+}
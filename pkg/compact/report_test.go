@@ -0,0 +1,119 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestBucketReporter(t *testing.T) {
+	now := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	newMeta := func(created, maxTime time.Time, res int64, lvl int, size int64) metadata.Meta {
+		m := metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(ulid.Timestamp(created), nil),
+				MaxTime:    maxTime.UnixNano() / int64(time.Millisecond),
+				Compaction: tsdb.BlockMetaCompaction{Level: lvl},
+			},
+			Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: res}},
+		}
+		if size > 0 {
+			m.Thanos.Files = []metadata.File{{RelPath: "index", SizeBytes: size}}
+		}
+		return m
+	}
+	metas := []metadata.Meta{
+		newMeta(now.Add(-time.Hour), now.Add(-2*time.Hour), 0, 1, 10<<20),
+		newMeta(now.Add(-5*day), now.Add(-6*day), 0, 3, 1<<30),
+		newMeta(now.Add(-40*day), now.Add(-60*day), 300000, 4, 0),
+		newMeta(now.Add(-2*day), now.Add(-400*day), 3600000, 4, 2<<30),
+	}
+
+	reg := prometheus.NewRegistry()
+	r := NewBucketReporter(log.NewNopLogger(), reg, map[ResolutionLevel]time.Duration{
+		ResolutionLevelRaw: 30 * day,
+		ResolutionLevel5m:  90 * day,
+	}, nil)
+	testutil.Equals(t, (*BucketReport)(nil), r.Report())
+	testutil.Equals(t, 0, promtest.CollectAndCount(r))
+
+	// Raw blocks expire after 30 days of retention, the rule deletes them after 7 days of their upload.
+	// 5m blocks are retained for 90 days, 1h blocks forever.
+	r.SetExpirationRules([]objstore.ExpirationRule{
+		{ID: "all", After: 7 * day},
+		{ID: "other", Prefix: "other/", After: day},
+	})
+	report := r.Update(metas, now)
+	testutil.Equals(t, report, r.Report())
+	testutil.Equals(t, 4, report.Blocks)
+	testutil.Equals(t, int64(10<<20+1<<30+2<<30), report.SizeBytes)
+	testutil.Equals(t, []ReportGroup{
+		{Group: "0", Blocks: 2, SizeBytes: 10<<20 + 1<<30},
+		{Group: "300000", Blocks: 1},
+		{Group: "3600000", Blocks: 1, SizeBytes: 2 << 30},
+	}, report.ByResolution)
+	testutil.Equals(t, []ReportGroup{
+		{Group: "1", Blocks: 1, SizeBytes: 10 << 20},
+		{Group: "3", Blocks: 1, SizeBytes: 1 << 30},
+		{Group: "4", Blocks: 2, SizeBytes: 2 << 30},
+	}, report.ByLevel)
+	testutil.Equals(t, []ReportGroup{
+		{Group: "<1d", Blocks: 1, SizeBytes: 10 << 20},
+		{Group: "<1w", Blocks: 1, SizeBytes: 1 << 30},
+		{Group: "<30d"},
+		{Group: "<90d", Blocks: 1},
+		{Group: "<1y"},
+		{Group: ">=1y", Blocks: 1, SizeBytes: 2 << 30},
+	}, report.ByAge)
+
+	testutil.Equals(t, 4, len(report.Expiring))
+	for i, m := range []metadata.Meta{metas[2], metas[1], metas[3], metas[0]} {
+		e := report.Expiring[i]
+		testutil.Equals(t, m.ULID, e.ID)
+		testutil.Equals(t, "all", e.Rule)
+		testutil.Equals(t, ulid.Time(m.ULID.Time()).Add(7*day), e.ExpiresAt)
+	}
+	testutil.Equals(t, (*time.Time)(nil), report.Expiring[2].RetainedUntil)
+
+	// Rules not matching the blocks or deleting them after their retention are fine.
+	r.SetExpirationRules([]objstore.ExpirationRule{
+		{ID: "other", Prefix: "other/", After: day},
+		{ID: "block", Prefix: metas[0].ULID.String() + "/chunks/", After: 60 * day},
+	})
+	testutil.Equals(t, 0, len(r.Update(metas, now).Expiring))
+	r.SetExpirationRules([]objstore.ExpirationRule{
+		{ID: "block", Prefix: metas[0].ULID.String() + "/chunks/", After: day},
+	})
+	report = r.Update(metas, now)
+	testutil.Equals(t, 1, len(report.Expiring))
+	testutil.Equals(t, metas[0].ULID, report.Expiring[0].ID)
+
+	testutil.Ok(t, promtest.CollectAndCompare(r, strings.NewReader(`
+# HELP thanos_compact_bucket_blocks Number of blocks in the bucket by resolution and compaction level, as of the last sync.
+# TYPE thanos_compact_bucket_blocks gauge
+thanos_compact_bucket_blocks{level="1",resolution="0"} 1
+thanos_compact_bucket_blocks{level="3",resolution="0"} 1
+thanos_compact_bucket_blocks{level="4",resolution="300000"} 1
+thanos_compact_bucket_blocks{level="4",resolution="3600000"} 1
+# HELP thanos_compact_bucket_lifecycle_expiring_blocks Number of blocks deleted by the object lifecycle rules of the provider before their retention, as of the last sync.
+# TYPE thanos_compact_bucket_lifecycle_expiring_blocks gauge
+thanos_compact_bucket_lifecycle_expiring_blocks 1
+`), "thanos_compact_bucket_blocks", "thanos_compact_bucket_lifecycle_expiring_blocks"))
+	// Size histograms only include the blocks listing their files.
+	testutil.Equals(t, 2, promtest.CollectAndCount(r, "thanos_compact_bucket_block_size_bytes"))
+	testutil.Equals(t, 3, promtest.CollectAndCount(r, "thanos_compact_bucket_block_age_seconds"))
+}
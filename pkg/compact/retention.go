@@ -13,6 +13,11 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v2"
+
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
@@ -27,10 +32,25 @@ func ApplyRetentionPolicyByResolution(
 	metas map[ulid.ULID]*metadata.Meta,
 	retentionByResolution map[ResolutionLevel]time.Duration,
 	blocksMarkedForDeletion prometheus.Counter,
+) error {
+	return ApplyRetentionPolicies(ctx, logger, bkt, metas, retentionByResolution, nil, blocksMarkedForDeletion)
+}
+
+// ApplyRetentionPolicies removes blocks depending on the retention of the first of the given policies matching
+// the block external labels, falling back to the specified retentionByResolution, based on blocks MaxTime.
+// A value of 0 disables the retention for its resolution.
+func ApplyRetentionPolicies(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	metas map[ulid.ULID]*metadata.Meta,
+	retentionByResolution map[ResolutionLevel]time.Duration,
+	policies []*RetentionPolicy,
+	blocksMarkedForDeletion prometheus.Counter,
 ) error {
 	level.Info(logger).Log("msg", "start optional retention")
 	for id, m := range metas {
-		retentionDuration := retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)]
+		retentionDuration := blockRetention(m, retentionByResolution, policies)
 		if retentionDuration.Seconds() == 0 {
 			continue
 		}
@@ -46,3 +66,68 @@ func ApplyRetentionPolicyByResolution(
 	level.Info(logger).Log("msg", "optional retention apply done")
 	return nil
 }
+
+// blockRetention returns the retention of the given block, from the first of the given policies matching its external
+// labels, falling back to the retention of its resolution. A value of 0 means the block is retained forever.
+func blockRetention(m *metadata.Meta, retentionByResolution map[ResolutionLevel]time.Duration, policies []*RetentionPolicy) time.Duration {
+	res := ResolutionLevel(m.Thanos.Downsample.Resolution)
+	retention := retentionByResolution[res]
+	for _, p := range policies {
+		if p.matches(m.Thanos.Labels) {
+			return p.retention(res, retention)
+		}
+	}
+	return retention
+}
+
+// RetentionPolicy is the retention of the blocks with external labels matching its selector.
+// Resolutions without a retention are retained according to the default retention of the resolution.
+type RetentionPolicy struct {
+	Selector      string          `yaml:"selector"`
+	ResolutionRaw *model.Duration `yaml:"resolution_raw"`
+	Resolution5m  *model.Duration `yaml:"resolution_5m"`
+	Resolution1h  *model.Duration `yaml:"resolution_1h"`
+
+	matchers []*labels.Matcher
+}
+
+// ParseRetentionPolicies parses the YAML content of a list of retention policies.
+func ParseRetentionPolicies(content []byte) ([]*RetentionPolicy, error) {
+	var policies []*RetentionPolicy
+	if err := yaml.UnmarshalStrict(content, &policies); err != nil {
+		return nil, errors.Wrap(err, "parsing retention policies")
+	}
+	for i, p := range policies {
+		ms, err := parser.ParseMetricSelector(p.Selector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse selector of retention policy %d", i)
+		}
+		p.matchers = ms
+	}
+	return policies, nil
+}
+
+func (p *RetentionPolicy) matches(lbls map[string]string) bool {
+	for _, m := range p.matchers {
+		if !m.Matches(lbls[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *RetentionPolicy) retention(res ResolutionLevel, def time.Duration) time.Duration {
+	var d *model.Duration
+	switch res {
+	case ResolutionLevelRaw:
+		d = p.ResolutionRaw
+	case ResolutionLevel5m:
+		d = p.Resolution5m
+	case ResolutionLevel1h:
+		d = p.Resolution1h
+	}
+	if d == nil {
+		return def
+	}
+	return time.Duration(*d)
+}
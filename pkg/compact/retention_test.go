@@ -241,7 +241,7 @@ func TestApplyRetentionPolicyByResolution(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
 			for _, b := range tt.blocks {
-				uploadMockBlock(t, bkt, b.id, b.minTime, b.maxTime, int64(b.resolution))
+				uploadMockBlock(t, bkt, b.id, b.minTime, b.maxTime, int64(b.resolution), nil)
 			}
 
 			metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil, nil, nil)
@@ -277,7 +277,78 @@ func TestApplyRetentionPolicyByResolution(t *testing.T) {
 	}
 }
 
-func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxTime time.Time, resolutionLevel int64) {
+func TestApplyRetentionPolicies(t *testing.T) {
+	logger := log.NewNopLogger()
+	ctx := context.TODO()
+
+	_, err := compact.ParseRetentionPolicies([]byte(`[{selector: "{tenant=}"}]`))
+	testutil.NotOk(t, err)
+	_, err = compact.ParseRetentionPolicies([]byte(`[{selector: "{tenant=\"a\"}", resolution_2h: 1d}]`))
+	testutil.NotOk(t, err)
+
+	policies, err := compact.ParseRetentionPolicies([]byte(`
+- selector: '{tenant="team-a"}'
+  resolution_raw: 1d
+  resolution_5m: 0d
+- selector: '{tenant=~"team-.*"}'
+  resolution_raw: 3d
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(policies))
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	for _, b := range []struct {
+		id         string
+		resolution compact.ResolutionLevel
+		tenant     string
+	}{
+		// Raw retention overridden to 1d by the first policy.
+		{"01CPHBEX20729MJQZXE3W0BW40", compact.ResolutionLevelRaw, "team-a"},
+		// Retained forever by the first policy.
+		{"01CPHBEX20729MJQZXE3W0BW41", compact.ResolutionLevel5m, "team-a"},
+		// Default 1h retention, not overridden by the first policy.
+		{"01CPHBEX20729MJQZXE3W0BW42", compact.ResolutionLevel1h, "team-a"},
+		// Raw retention overridden to 3d by the second policy.
+		{"01CPHBEX20729MJQZXE3W0BW43", compact.ResolutionLevelRaw, "team-b"},
+		// Default retention.
+		{"01CPHBEX20729MJQZXE3W0BW44", compact.ResolutionLevelRaw, "other"},
+		{"01CPHBEX20729MJQZXE3W0BW45", compact.ResolutionLevel5m, "other"},
+	} {
+		uploadMockBlock(t, bkt, b.id, time.Now().Add(-3*24*time.Hour), time.Now().Add(-2*24*time.Hour), int64(b.resolution), map[string]string{"tenant": b.tenant})
+	}
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil, nil, nil)
+	testutil.Ok(t, err)
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+
+	blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	testutil.Ok(t, compact.ApplyRetentionPolicies(ctx, logger, bkt, metas, map[compact.ResolutionLevel]time.Duration{
+		compact.ResolutionLevelRaw: 7 * 24 * time.Hour,
+		compact.ResolutionLevel5m:  24 * time.Hour,
+		compact.ResolutionLevel1h:  24 * time.Hour,
+	}, policies, blocksMarkedForDeletion))
+
+	var marked []string
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		exists, err := bkt.Exists(ctx, filepath.Join(name, metadata.DeletionMarkFilename))
+		if err != nil {
+			return err
+		}
+		if exists {
+			marked = append(marked, name)
+		}
+		return nil
+	}))
+	testutil.Equals(t, []string{
+		"01CPHBEX20729MJQZXE3W0BW40/",
+		"01CPHBEX20729MJQZXE3W0BW42/",
+		"01CPHBEX20729MJQZXE3W0BW45/",
+	}, marked)
+	testutil.Equals(t, 3.0, promtest.ToFloat64(blocksMarkedForDeletion))
+}
+
+func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxTime time.Time, resolutionLevel int64, lset map[string]string) {
 	t.Helper()
 	meta1 := metadata.Meta{
 		BlockMeta: tsdb.BlockMeta{
@@ -287,6 +358,7 @@ func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxT
 			Version: 1,
 		},
 		Thanos: metadata.Thanos{
+			Labels: lset,
 			Downsample: metadata.ThanosDownsample{
 				Resolution: resolutionLevel,
 			},
@@ -0,0 +1,301 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// RewriteStats are the statistics of the rewrite of a block.
+type RewriteStats struct {
+	// DeletedSeries is the number of series matching the deletion matchers or dropped by the relabeling.
+	DeletedSeries int
+	// RelabeledSeries is the number of series whose labels were modified by the relabeling.
+	RelabeledSeries int
+	// MergedSeries is the number of series merged into other ones having the same labels after the relabeling.
+	MergedSeries int
+}
+
+// Modified returns whether or not the rewrite modified any series.
+func (s RewriteStats) Modified() bool {
+	return s.DeletedSeries > 0 || s.RelabeledSeries > 0
+}
+
+// ParseRewriteRelabelConfig parses the relabel configuration of the series of rewritten blocks. Unlike the relabel
+// configuration selecting blocks, all relabel actions are supported.
+func ParseRewriteRelabelConfig(contentYaml []byte) ([]*relabel.Config, error) {
+	var relabelConfig []*relabel.Config
+	if err := yaml.Unmarshal(contentYaml, &relabelConfig); err != nil {
+		return nil, errors.Wrap(err, "parsing relabel configuration")
+	}
+	return relabelConfig, nil
+}
+
+// rewriteSeries is a series of the block being rewritten, with its labels after the relabeling.
+type rewriteSeries struct {
+	ref  uint64
+	lset labels.Labels
+}
+
+// RewriteBlock writes in dir a new block from the block of the given meta in dir, without the series matching all the
+// matchers of any of the given deletion matchers, and with the labels of the other series relabeled with the given
+// relabel configs. The series dropped by the relabeling are deleted as well, and the series having the same labels
+// after the relabeling are merged.
+// Only the labels of the series are kept in memory: their chunks are read again and written one series at a time.
+// Downsampled blocks are rewritten as well, but their aggregated chunks cannot be merged, so a relabeling resulting in
+// several series with the same labels in a downsampled block is refused before writing anything.
+// It returns the ID of the new block, or an empty ULID if the block is not modified or all its series are deleted.
+// The new block keeps the compaction sources of the original block, with the original block as its only parent, so
+// that the deduplication of the blocks prefers it over the original block until it is deleted.
+func RewriteBlock(
+	logger log.Logger,
+	dir string,
+	m *metadata.Meta,
+	deleteMatchers [][]*labels.Matcher,
+	relabelConfig []*relabel.Config,
+) (resid ulid.ULID, stats RewriteStats, err error) {
+	bdir := filepath.Join(dir, m.ULID.String())
+
+	indexr, err := index.NewFileReader(filepath.Join(bdir, block.IndexFilename))
+	if err != nil {
+		return resid, stats, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexr, "rewrite index reader")
+
+	chunkr, err := chunks.NewDirReader(filepath.Join(bdir, block.ChunksDirname), downsample.NewPool())
+	if err != nil {
+		return resid, stats, errors.Wrap(err, "open chunks")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkr, "rewrite chunk reader")
+
+	series, symbols, err := rewrittenSeries(indexr, deleteMatchers, relabelConfig, &stats)
+	if err != nil {
+		return resid, stats, err
+	}
+	if !stats.Modified() {
+		return resid, stats, nil
+	}
+	if len(series) == 0 {
+		level.Info(logger).Log("msg", "all series of block deleted", "block", m.ULID)
+		return resid, stats, nil
+	}
+
+	sort.SliceStable(series, func(i, j int) bool {
+		return labels.Compare(series[i].lset, series[j].lset) < 0
+	})
+	for i := 1; i < len(series); i++ {
+		if !labels.Equal(series[i-1].lset, series[i].lset) {
+			continue
+		}
+		// Aggregated chunks of downsampled blocks can't be merged.
+		if m.Thanos.Downsample.Resolution != downsample.ResLevel0 {
+			return resid, stats, errors.Errorf("relabeling results in several series with labels %s in block %s downsampled at resolution %d, which cannot be merged", series[i].lset, m.ULID, m.Thanos.Downsample.Resolution)
+		}
+		stats.MergedSeries++
+	}
+
+	resid = ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	resdir := filepath.Join(dir, resid.String())
+
+	resmeta := *m
+	resmeta.ULID = resid
+	resmeta.Stats = tsdb.BlockStats{}
+	resmeta.Compaction.Sources = append([]ulid.ULID{}, m.Compaction.Sources...)
+	resmeta.Compaction.Parents = []tsdb.BlockDesc{{ULID: m.ULID, MinTime: m.MinTime, MaxTime: m.MaxTime}}
+	resmeta.Thanos.Source = metadata.BucketRewriteSource
+	resmeta.Thanos.Files = nil
+
+	if err := writeRewrittenSeries(resdir, indexr, chunkr, series, symbols, &resmeta); err != nil {
+		return resid, stats, errors.Wrap(err, "write block")
+	}
+	resmeta.Thanos.SegmentFiles = block.GetSegmentFiles(resdir)
+	if err := resmeta.WriteToDir(logger, resdir); err != nil {
+		return resid, stats, err
+	}
+	return resid, stats, nil
+}
+
+// rewrittenSeries returns the series of the given index which are not deleted, with their labels relabeled, and the
+// sorted symbols of their labels, updating the given stats.
+func rewrittenSeries(indexr *index.Reader, deleteMatchers [][]*labels.Matcher, relabelConfig []*relabel.Config, stats *RewriteStats) ([]rewriteSeries, []string, error) {
+	all, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "postings")
+	}
+
+	var (
+		series  []rewriteSeries
+		symbols = map[string]struct{}{}
+		chks    []chunks.Meta
+	)
+	for all.Next() {
+		var lset labels.Labels
+		if err := indexr.Series(all.At(), &lset, &chks); err != nil {
+			return nil, nil, errors.Wrap(err, "series")
+		}
+		if matchesAny(lset, deleteMatchers) {
+			stats.DeletedSeries++
+			continue
+		}
+		relabeled := relabel.Process(lset, relabelConfig...)
+		if relabeled == nil {
+			stats.DeletedSeries++
+			continue
+		}
+		if !labels.Equal(lset, relabeled) {
+			stats.RelabeledSeries++
+		}
+
+		for _, l := range relabeled {
+			symbols[l.Name] = struct{}{}
+			symbols[l.Value] = struct{}{}
+		}
+		series = append(series, rewriteSeries{ref: all.At(), lset: relabeled})
+	}
+	if all.Err() != nil {
+		return nil, nil, errors.Wrap(all.Err(), "iterate series")
+	}
+
+	sorted := make([]string, 0, len(symbols))
+	for s := range symbols {
+		sorted = append(sorted, s)
+	}
+	sort.Strings(sorted)
+	return series, sorted, nil
+}
+
+func matchesAny(lset labels.Labels, matchers [][]*labels.Matcher) bool {
+Outer:
+	for _, ms := range matchers {
+		for _, m := range ms {
+			if !m.Matches(lset.Get(m.Name)) {
+				continue Outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writeRewrittenSeries writes the given sorted series in a new block in the given directory, with the given sorted
+// symbols, reading their chunks from the original block one series at a time, merging the series having the same
+// labels and updating the stats of the given meta.
+func writeRewrittenSeries(resdir string, indexr *index.Reader, chunkr *chunks.Reader, series []rewriteSeries, symbols []string, meta *metadata.Meta) (err error) {
+	chunkw, err := chunks.NewWriter(filepath.Join(resdir, block.ChunksDirname))
+	if err != nil {
+		return errors.Wrap(err, "open chunk writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, chunkw, "rewrite chunk writer")
+
+	indexw, err := index.NewWriter(context.TODO(), filepath.Join(resdir, block.IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "open index writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, indexw, "rewrite index writer")
+
+	for _, s := range symbols {
+		if err := indexw.AddSymbol(s); err != nil {
+			return errors.Wrap(err, "add symbol")
+		}
+	}
+
+	var (
+		merger = storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge)
+		ref    uint64
+	)
+	for i := 0; i < len(series); {
+		j := i + 1
+		for j < len(series) && labels.Equal(series[i].lset, series[j].lset) {
+			j++
+		}
+
+		chks, err := readRewrittenChunks(indexr, chunkr, series[i])
+		if err != nil {
+			return err
+		}
+		if j > i+1 {
+			toMerge := make([]storage.ChunkSeries, 0, j-i)
+			toMerge = append(toMerge, chunkSeries(series[i].lset, chks))
+			for _, s := range series[i+1 : j] {
+				chks, err := readRewrittenChunks(indexr, chunkr, s)
+				if err != nil {
+					return err
+				}
+				toMerge = append(toMerge, chunkSeries(s.lset, chks))
+			}
+
+			chks = nil
+			it := merger(toMerge...).Iterator()
+			for it.Next() {
+				chks = append(chks, it.At())
+			}
+			if it.Err() != nil {
+				return errors.Wrapf(it.Err(), "merge series %s", series[i].lset)
+			}
+		}
+
+		if err := chunkw.WriteChunks(chks...); err != nil {
+			return errors.Wrap(err, "write chunks")
+		}
+		if err := indexw.AddSeries(ref, series[i].lset, chks...); err != nil {
+			return errors.Wrap(err, "add series")
+		}
+		ref++
+
+		meta.Stats.NumSeries++
+		meta.Stats.NumChunks += uint64(len(chks))
+		for _, chk := range chks {
+			meta.Stats.NumSamples += uint64(chk.Chunk.NumSamples())
+		}
+		i = j
+	}
+	return nil
+}
+
+// readRewrittenChunks reads the chunks of the given series from the original block.
+func readRewrittenChunks(indexr *index.Reader, chunkr *chunks.Reader, s rewriteSeries) ([]chunks.Meta, error) {
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	if err := indexr.Series(s.ref, &lset, &chks); err != nil {
+		return nil, errors.Wrapf(err, "series %d", s.ref)
+	}
+	for i, c := range chks {
+		var err error
+		chks[i].Chunk, err = chunkr.Chunk(c.Ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read chunk %d of series %s", c.Ref, lset)
+		}
+	}
+	return chks, nil
+}
+
+func chunkSeries(lset labels.Labels, chks []chunks.Meta) storage.ChunkSeries {
+	return &storage.ChunkSeriesEntry{
+		Lset:            lset,
+		ChunkIteratorFn: func() chunks.Iterator { return storage.NewListChunkSeriesIterator(chks...) },
+	}
+}
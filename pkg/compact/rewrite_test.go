@@ -0,0 +1,129 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestRewriteBlock(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "rewrite-block")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+		labels.FromStrings("a", "3", "b", "x"),
+		labels.FromStrings("a", "4"),
+		labels.FromStrings("a", "5"),
+	}
+	id, err := e2eutil.CreateBlock(ctx, dir, series, 100, 0, 1000, labels.FromStrings("cluster", "x"), 0)
+	testutil.Ok(t, err)
+	m, err := metadata.Read(filepath.Join(dir, id.String()))
+	testutil.Ok(t, err)
+
+	// Nothing to rewrite.
+	resid, stats, err := RewriteBlock(logger, dir, m, [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "a", "6")}}, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, ulid.ULID{}, resid)
+	testutil.Equals(t, RewriteStats{}, stats)
+
+	// All series deleted.
+	resid, stats, err = RewriteBlock(logger, dir, m, [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchRegexp, "a", ".+")}}, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, ulid.ULID{}, resid)
+	testutil.Equals(t, RewriteStats{DeletedSeries: 5}, stats)
+
+	relabelConfig, err := ParseRewriteRelabelConfig([]byte(`
+- action: labeldrop
+  regex: b
+- action: replace
+  source_labels: [a]
+  regex: "3"
+  target_label: a
+  replacement: "2"
+- action: drop
+  source_labels: [a]
+  regex: "4"
+`))
+	testutil.Ok(t, err)
+	resid, stats, err = RewriteBlock(logger, dir, m, [][]*labels.Matcher{
+		{labels.MustNewMatcher(labels.MatchEqual, "a", "1")},
+		// Series must match all the matchers.
+		{labels.MustNewMatcher(labels.MatchEqual, "a", "5"), labels.MustNewMatcher(labels.MatchEqual, "b", "x")},
+	}, relabelConfig)
+	testutil.Ok(t, err)
+	testutil.Equals(t, RewriteStats{DeletedSeries: 2, RelabeledSeries: 1, MergedSeries: 1}, stats)
+
+	resdir := filepath.Join(dir, resid.String())
+	resmeta, err := metadata.Read(resdir)
+	testutil.Ok(t, err)
+	testutil.Ok(t, block.VerifyIndex(logger, filepath.Join(resdir, block.IndexFilename), resmeta.MinTime, resmeta.MaxTime))
+	testutil.Equals(t, metadata.BucketRewriteSource, resmeta.Thanos.Source)
+	testutil.Equals(t, m.Thanos.Labels, resmeta.Thanos.Labels)
+	testutil.Equals(t, m.Compaction.Sources, resmeta.Compaction.Sources)
+	testutil.Equals(t, m.ULID, resmeta.Compaction.Parents[0].ULID)
+	testutil.Equals(t, uint64(2), resmeta.Stats.NumSeries)
+	// The samples of the merged series have the same timestamps.
+	testutil.Equals(t, uint64(200), resmeta.Stats.NumSamples)
+
+	ir, err := index.NewFileReader(filepath.Join(resdir, block.IndexFilename))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, ir.Close()) }()
+	p, err := ir.Postings(index.AllPostingsKey())
+	testutil.Ok(t, err)
+	var (
+		got  []labels.Labels
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for p.Next() {
+		testutil.Ok(t, ir.Series(p.At(), &lset, &chks))
+		got = append(got, lset.Copy())
+	}
+	testutil.Ok(t, p.Err())
+	testutil.Equals(t, []labels.Labels{labels.FromStrings("a", "2"), labels.FromStrings("a", "5")}, got)
+
+	// Downsampled blocks are rewritten, unless their series have to be merged.
+	b, err := tsdb.OpenBlock(logger, filepath.Join(dir, id.String()), downsample.NewPool())
+	testutil.Ok(t, err)
+	dsid, err := downsample.Downsample(logger, m, b, dir, downsample.ResLevel1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, b.Close())
+	dsmeta, err := metadata.Read(filepath.Join(dir, dsid.String()))
+	testutil.Ok(t, err)
+
+	resid, stats, err = RewriteBlock(logger, dir, dsmeta, [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "a", "1")}}, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, RewriteStats{DeletedSeries: 1}, stats)
+	resmeta, err = metadata.Read(filepath.Join(dir, resid.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, downsample.ResLevel1, resmeta.Thanos.Downsample.Resolution)
+	testutil.Equals(t, uint64(4), resmeta.Stats.NumSeries)
+	testutil.Equals(t, dsmeta.Stats.NumChunks-1, resmeta.Stats.NumChunks)
+
+	_, _, err = RewriteBlock(logger, dir, dsmeta, nil, relabelConfig)
+	testutil.NotOk(t, err)
+}
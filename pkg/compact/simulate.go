@@ -0,0 +1,160 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// SimulatedCompaction is a compaction the compactor would execute, as simulated by SimulateCompactions.
+type SimulatedCompaction struct {
+	Group string
+	// Blocks are the blocks to compact, which can be results of previous simulated compactions of the group.
+	Blocks []*metadata.Meta
+	// Result is the meta of the block the compaction would produce. Its stats are upper bounds,
+	// as samples of overlapping blocks can be deduplicated.
+	Result *metadata.Meta
+	// Overlapping is true if the blocks to compact overlap, which requires vertical compaction.
+	Overlapping bool
+	// EstimatedSizeBytes is the sum of the sizes of the blocks to compact, or 0 if unknown for any of them.
+	EstimatedSizeBytes int64
+}
+
+// SimulateCompactions plans the compactions the compactor would execute for the given groups, until no more compactions
+// are planned, without downloading or writing any block. It returns the simulated compactions in the order they would be
+// executed for each group, and the metas of the blocks of the groups once all of them are executed.
+func SimulateCompactions(ctx context.Context, planner Planner, groups []*Group) ([]SimulatedCompaction, []*metadata.Meta, error) {
+	var (
+		compactions []SimulatedCompaction
+		result      []*metadata.Meta
+		entropy     = rand.New(rand.NewSource(time.Now().UnixNano()))
+		// sizes are the estimated sizes of the simulated blocks.
+		sizes = map[ulid.ULID]int64{}
+	)
+	for _, g := range groups {
+		metas := append([]*metadata.Meta{}, g.metasByMinTime...)
+		for {
+			toCompact, err := planner.Plan(ctx, metas)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "plan compaction of group %s", g.Key())
+			}
+			// Compactions of a single block don't reduce the number of blocks, so they would be the last of the group.
+			if len(toCompact) < 2 {
+				break
+			}
+
+			res := simulatedCompactionResult(ulid.MustNew(ulid.Now(), entropy), toCompact)
+			var size int64
+			for _, m := range toCompact {
+				s, ok := sizes[m.ULID]
+				if !ok {
+					s = BlockSize(m)
+				}
+				if s == 0 {
+					size = 0
+					break
+				}
+				size += s
+			}
+			sizes[res.ULID] = size
+			compactions = append(compactions, SimulatedCompaction{
+				Group:              g.Key(),
+				Blocks:             toCompact,
+				Result:             res,
+				Overlapping:        len(tsdb.OverlappingBlocks(blockMetas(toCompact))) > 0,
+				EstimatedSizeBytes: size,
+			})
+
+			compacted := map[ulid.ULID]struct{}{}
+			for _, m := range toCompact {
+				compacted[m.ULID] = struct{}{}
+			}
+			remaining := []*metadata.Meta{res}
+			for _, m := range metas {
+				if _, ok := compacted[m.ULID]; !ok {
+					remaining = append(remaining, m)
+				}
+			}
+			sort.Slice(remaining, func(i, j int) bool {
+				return remaining[i].MinTime < remaining[j].MinTime
+			})
+			metas = remaining
+		}
+		result = append(result, metas...)
+	}
+	return compactions, result, nil
+}
+
+// simulatedCompactionResult returns the meta of the block resulting of the compaction of the given blocks, like
+// the meta of a block compacted by the TSDB compactor.
+func simulatedCompactionResult(id ulid.ULID, toCompact []*metadata.Meta) *metadata.Meta {
+	res := &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    id,
+			MinTime: toCompact[0].MinTime,
+			MaxTime: toCompact[0].MaxTime,
+			Version: metadata.TSDBVersion1,
+		},
+		Thanos: metadata.Thanos{
+			Version:    metadata.ThanosVersion1,
+			Labels:     toCompact[0].Thanos.Labels,
+			Downsample: toCompact[0].Thanos.Downsample,
+			Source:     metadata.CompactorSource,
+		},
+	}
+
+	sources := map[ulid.ULID]struct{}{}
+	for _, m := range toCompact {
+		if m.MinTime < res.MinTime {
+			res.MinTime = m.MinTime
+		}
+		if m.MaxTime > res.MaxTime {
+			res.MaxTime = m.MaxTime
+		}
+		if m.Compaction.Level > res.Compaction.Level {
+			res.Compaction.Level = m.Compaction.Level
+		}
+		for _, s := range m.Compaction.Sources {
+			sources[s] = struct{}{}
+		}
+		res.Compaction.Parents = append(res.Compaction.Parents, tsdb.BlockDesc{ULID: m.ULID, MinTime: m.MinTime, MaxTime: m.MaxTime})
+
+		res.Stats.NumSamples += m.Stats.NumSamples
+		res.Stats.NumSeries += m.Stats.NumSeries
+		res.Stats.NumChunks += m.Stats.NumChunks
+	}
+	res.Compaction.Level++
+	for s := range sources {
+		res.Compaction.Sources = append(res.Compaction.Sources, s)
+	}
+	sort.Slice(res.Compaction.Sources, func(i, j int) bool {
+		return res.Compaction.Sources[i].Compare(res.Compaction.Sources[j]) < 0
+	})
+	return res
+}
+
+// BlockSize returns the size in bytes of the files of the block, as listed in its meta, or 0 if unknown.
+func BlockSize(m *metadata.Meta) (size int64) {
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	return size
+}
+
+func blockMetas(metas []*metadata.Meta) []tsdb.BlockMeta {
+	res := make([]tsdb.BlockMeta, 0, len(metas))
+	for _, m := range metas {
+		res = append(res, m.BlockMeta)
+	}
+	return res
+}
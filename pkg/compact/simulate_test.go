@@ -0,0 +1,73 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSimulateCompactions(t *testing.T) {
+	newMeta := func(id uint64, mint, maxt int64, size int64) *metadata.Meta {
+		m := &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:       ulid.MustNew(id, nil),
+				MinTime:    mint,
+				MaxTime:    maxt,
+				Stats:      tsdb.BlockStats{NumSamples: 100, NumSeries: 10, NumChunks: 20},
+				Compaction: tsdb.BlockMetaCompaction{Level: 1, Sources: []ulid.ULID{ulid.MustNew(id, nil)}},
+			},
+			Thanos: metadata.Thanos{Labels: map[string]string{"cluster": "a"}},
+		}
+		if size > 0 {
+			m.Thanos.Files = []metadata.File{{RelPath: "index", SizeBytes: size / 2}, {RelPath: "chunks/000001", SizeBytes: size / 2}}
+		}
+		return m
+	}
+	g, err := NewGroup(nil, nil, "a", labels.FromStrings("cluster", "a"), 0, false, false, nil, nil, nil, nil, nil, nil, nil)
+	testutil.Ok(t, err)
+	for _, m := range []*metadata.Meta{newMeta(1, 0, 10, 100), newMeta(2, 5, 20, 200), newMeta(3, 20, 30, 300)} {
+		testutil.Ok(t, g.Add(m))
+	}
+	single, err := NewGroup(nil, nil, "b", labels.FromStrings("cluster", "b"), 0, false, false, nil, nil, nil, nil, nil, nil, nil)
+	testutil.Ok(t, err)
+	other := newMeta(4, 0, 10, 0)
+	other.Thanos.Labels = map[string]string{"cluster": "b"}
+	testutil.Ok(t, single.Add(other))
+
+	compactions, metas, err := SimulateCompactions(context.Background(), firstTwoPlanner{}, []*Group{g, single})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(compactions))
+
+	first := compactions[0]
+	testutil.Equals(t, "a", first.Group)
+	testutil.Equals(t, []*metadata.Meta{g.metasByMinTime[0], g.metasByMinTime[1]}, first.Blocks)
+	testutil.Assert(t, first.Overlapping, "expected overlapping blocks")
+	testutil.Equals(t, int64(300), first.EstimatedSizeBytes)
+	testutil.Equals(t, int64(0), first.Result.MinTime)
+	testutil.Equals(t, int64(20), first.Result.MaxTime)
+	testutil.Equals(t, 2, first.Result.Compaction.Level)
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)}, first.Result.Compaction.Sources)
+	testutil.Equals(t, tsdb.BlockStats{NumSamples: 200, NumSeries: 20, NumChunks: 40}, first.Result.Stats)
+	testutil.Equals(t, map[string]string{"cluster": "a"}, first.Result.Thanos.Labels)
+
+	// The result of the first compaction is compacted with the remaining block.
+	second := compactions[1]
+	testutil.Equals(t, []*metadata.Meta{first.Result, g.metasByMinTime[2]}, second.Blocks)
+	testutil.Assert(t, !second.Overlapping, "unexpected overlapping blocks")
+	testutil.Equals(t, int64(600), second.EstimatedSizeBytes)
+	testutil.Equals(t, 3, second.Result.Compaction.Level)
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil)}, second.Result.Compaction.Sources)
+
+	testutil.Equals(t, []*metadata.Meta{second.Result, other}, metas)
+	// Groups are not modified.
+	testutil.Equals(t, 3, len(g.metasByMinTime))
+}
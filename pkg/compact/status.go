@@ -0,0 +1,255 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// Status is a snapshot of the state of the compactions, as exposed by the compactor HTTP API and UI.
+type Status struct {
+	// RefreshedAt is the time the pending compactions were last planned.
+	RefreshedAt       time.Time                `json:"refreshedAt"`
+	Planned           []PlannedCompaction      `json:"planned"`
+	Running           []RunningCompaction      `json:"running"`
+	Halted            []HaltedGroup            `json:"halted"`
+	MarkedForDeletion []*metadata.DeletionMark `json:"markedForDeletion"`
+}
+
+// PlannedCompaction is the next compaction planned for a group.
+type PlannedCompaction struct {
+	Group      string            `json:"group"`
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	Blocks     []ulid.ULID       `json:"blocks"`
+	MinTime    int64             `json:"minTime"`
+	MaxTime    int64             `json:"maxTime"`
+	NumSamples uint64            `json:"numSamples"`
+}
+
+// RunningCompaction is a compaction of a group in progress.
+type RunningCompaction struct {
+	PlannedCompaction
+	StartedAt time.Time `json:"startedAt"`
+	// ETA is the estimated completion time of the compaction, based on the rate of the finished compactions.
+	// It is nil until the first compaction finishes.
+	ETA *time.Time `json:"eta,omitempty"`
+}
+
+// HaltedGroup is a group whose compaction hit a halt error.
+type HaltedGroup struct {
+	Group    string    `json:"group"`
+	Reason   string    `json:"reason"`
+	HaltedAt time.Time `json:"haltedAt"`
+}
+
+// StatusTracker tracks the state of the compactions of a BucketCompactor.
+// A nil StatusTracker is valid and tracks nothing.
+type StatusTracker struct {
+	mtx sync.Mutex
+
+	refreshedAt       time.Time
+	planned           map[string]PlannedCompaction
+	running           map[string]RunningCompaction
+	halted            map[string]HaltedGroup
+	markedForDeletion []*metadata.DeletionMark
+
+	// plans are the plans of the groups of the current pass, reused by the group compaction instead of planning again.
+	plans map[*Group][]*metadata.Meta
+
+	// samplesPerSecond is the moving average of the samples compacted per second, used to estimate running compactions ETA.
+	samplesPerSecond float64
+}
+
+// NewStatusTracker creates StatusTracker.
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{
+		planned: map[string]PlannedCompaction{},
+		running: map[string]RunningCompaction{},
+		halted:  map[string]HaltedGroup{},
+		plans:   map[*Group][]*metadata.Meta{},
+	}
+}
+
+// Status returns the current state of the compactions.
+func (t *StatusTracker) Status() *Status {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	s := &Status{
+		RefreshedAt:       t.refreshedAt,
+		Planned:           []PlannedCompaction{},
+		Running:           []RunningCompaction{},
+		Halted:            []HaltedGroup{},
+		MarkedForDeletion: append([]*metadata.DeletionMark{}, t.markedForDeletion...),
+	}
+	for _, p := range t.planned {
+		s.Planned = append(s.Planned, p)
+	}
+	for _, r := range t.running {
+		if t.samplesPerSecond > 0 {
+			eta := r.StartedAt.Add(time.Duration(float64(r.NumSamples) / t.samplesPerSecond * float64(time.Second)))
+			r.ETA = &eta
+		}
+		s.Running = append(s.Running, r)
+	}
+	for _, h := range t.halted {
+		s.Halted = append(s.Halted, h)
+	}
+	sort.Slice(s.Planned, func(i, j int) bool { return s.Planned[i].Group < s.Planned[j].Group })
+	sort.Slice(s.Running, func(i, j int) bool { return s.Running[i].Group < s.Running[j].Group })
+	sort.Slice(s.Halted, func(i, j int) bool { return s.Halted[i].Group < s.Halted[j].Group })
+	return s
+}
+
+// SetMarkedForDeletion updates the blocks marked for deletion.
+func (t *StatusTracker) SetMarkedForDeletion(marks map[ulid.ULID]*metadata.DeletionMark) {
+	if t == nil {
+		return
+	}
+	markedForDeletion := make([]*metadata.DeletionMark, 0, len(marks))
+	for _, m := range marks {
+		markedForDeletion = append(markedForDeletion, m)
+	}
+	sort.Slice(markedForDeletion, func(i, j int) bool {
+		return markedForDeletion[i].DeletionTime < markedForDeletion[j].DeletionTime
+	})
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.markedForDeletion = markedForDeletion
+}
+
+// plan replaces the pending compactions with the next compactions planned for the given groups.
+func (t *StatusTracker) plan(ctx context.Context, planner Planner, groups []*Group) error {
+	if t == nil {
+		return nil
+	}
+	planned := map[string]PlannedCompaction{}
+	plans := make(map[*Group][]*metadata.Meta, len(groups))
+	for _, g := range groups {
+		toCompact, err := planner.Plan(ctx, g.metasByMinTime)
+		if err != nil {
+			return err
+		}
+		plans[g] = toCompact
+		if len(toCompact) == 0 {
+			continue
+		}
+		planned[g.Key()] = newPlannedCompaction(g, toCompact)
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.refreshedAt = time.Now()
+	t.planned = planned
+	t.plans = plans
+	return nil
+}
+
+// takePlan returns the plan of the group made by the last planning, if it was not used yet.
+func (t *StatusTracker) takePlan(g *Group) ([]*metadata.Meta, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	toCompact, ok := t.plans[g]
+	delete(t.plans, g)
+	return toCompact, ok
+}
+
+func newPlannedCompaction(g *Group, toCompact []*metadata.Meta) PlannedCompaction {
+	p := PlannedCompaction{
+		Group:      g.Key(),
+		Labels:     g.Labels().Map(),
+		Resolution: g.Resolution(),
+		MinTime:    toCompact[0].MinTime,
+		MaxTime:    toCompact[0].MaxTime,
+	}
+	for _, m := range toCompact {
+		p.Blocks = append(p.Blocks, m.ULID)
+		p.NumSamples += m.Stats.NumSamples
+		if m.MinTime < p.MinTime {
+			p.MinTime = m.MinTime
+		}
+		if m.MaxTime > p.MaxTime {
+			p.MaxTime = m.MaxTime
+		}
+	}
+	return p
+}
+
+// started tracks the compaction of the given blocks of the group as running.
+func (t *StatusTracker) started(g *Group, toCompact []*metadata.Meta) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	// The plan of the group is being executed, the next one is unknown until the next planning.
+	delete(t.planned, g.Key())
+	t.running[g.Key()] = RunningCompaction{PlannedCompaction: newPlannedCompaction(g, toCompact), StartedAt: time.Now()}
+}
+
+// finished tracks the end of the running compaction of the group, if any.
+func (t *StatusTracker) finished(g *Group, err error) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	r, ok := t.running[g.Key()]
+	delete(t.running, g.Key())
+	if IsHaltError(err) {
+		t.halted[g.Key()] = HaltedGroup{Group: g.Key(), Reason: err.Error(), HaltedAt: time.Now()}
+		return
+	}
+	if err != nil {
+		return
+	}
+	delete(t.halted, g.Key())
+	if !ok {
+		return
+	}
+	if elapsed := time.Since(r.StartedAt).Seconds(); elapsed > 0 && r.NumSamples > 0 {
+		rate := float64(r.NumSamples) / elapsed
+		if t.samplesPerSecond == 0 {
+			t.samplesPerSecond = rate
+		} else {
+			t.samplesPerSecond = 0.8*t.samplesPerSecond + 0.2*rate
+		}
+	}
+}
+
+// trackingPlanner tracks the compactions it plans for a group as running. The first plan of the group reuses the
+// one made by the tracker planning, so that each group is planned once per pass.
+type trackingPlanner struct {
+	Planner
+	tracker *StatusTracker
+	group   *Group
+}
+
+func (p *trackingPlanner) Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	toCompact, ok := p.tracker.takePlan(p.group)
+	var err error
+	if !ok {
+		toCompact, err = p.Planner.Plan(ctx, metasByMinTime)
+	}
+	if err == nil && len(toCompact) > 0 {
+		p.tracker.started(p.group, toCompact)
+	}
+	return toCompact, err
+}
+
+// planner returns a planner tracking the compactions of the group, or the given planner if t is nil.
+func (t *StatusTracker) planner(planner Planner, g *Group) Planner {
+	if t == nil {
+		return planner
+	}
+	return &trackingPlanner{Planner: planner, tracker: t, group: g}
+}
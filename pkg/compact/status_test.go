@@ -0,0 +1,112 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type firstTwoPlanner struct {
+	calls *int
+}
+
+func (p firstTwoPlanner) Plan(_ context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	if p.calls != nil {
+		*p.calls++
+	}
+	if len(metasByMinTime) < 2 {
+		return nil, nil
+	}
+	return metasByMinTime[:2], nil
+}
+
+func TestStatusTracker(t *testing.T) {
+	ctx := context.Background()
+	newGroup := func(key string, metas ...*metadata.Meta) *Group {
+		g, err := NewGroup(nil, nil, key, labels.FromStrings("cluster", key), 0, false, false, nil, nil, nil, nil, nil, nil, nil)
+		testutil.Ok(t, err)
+		for _, m := range metas {
+			m.Thanos.Labels = map[string]string{"cluster": key}
+			testutil.Ok(t, g.Add(m))
+		}
+		return g
+	}
+	newMeta := func(id uint64, mint, maxt int64) *metadata.Meta {
+		return &metadata.Meta{BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustNew(id, nil),
+			MinTime: mint,
+			MaxTime: maxt,
+			Stats:   tsdb.BlockStats{NumSamples: 100},
+		}}
+	}
+
+	a := newGroup("a", newMeta(1, 0, 10), newMeta(2, 10, 20), newMeta(3, 20, 30))
+	b := newGroup("b", newMeta(4, 0, 10))
+
+	var calls int
+	tracker := NewStatusTracker()
+	testutil.Ok(t, tracker.plan(ctx, firstTwoPlanner{calls: &calls}, []*Group{a, b}))
+	testutil.Equals(t, 2, calls)
+	s := tracker.Status()
+	testutil.Equals(t, []PlannedCompaction{{
+		Group:      "a",
+		Labels:     map[string]string{"cluster": "a"},
+		Blocks:     []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)},
+		MinTime:    0,
+		MaxTime:    20,
+		NumSamples: 200,
+	}}, s.Planned)
+	testutil.Equals(t, 0, len(s.Running))
+
+	// Compactions planned by the group are running, without ETA until a compaction finishes. The group reuses the
+	// plan made by the tracker.
+	_, err := tracker.planner(firstTwoPlanner{calls: &calls}, a).Plan(ctx, a.metasByMinTime)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, calls)
+	s = tracker.Status()
+	testutil.Equals(t, 0, len(s.Planned))
+	testutil.Equals(t, 1, len(s.Running))
+	testutil.Equals(t, "a", s.Running[0].Group)
+	testutil.Assert(t, s.Running[0].ETA == nil, "unexpected ETA before any finished compaction")
+
+	tracker.finished(a, nil)
+	testutil.Equals(t, 0, len(tracker.Status().Running))
+	testutil.Assert(t, tracker.samplesPerSecond > 0, "expected compaction rate to be tracked")
+
+	_, err = tracker.planner(firstTwoPlanner{calls: &calls}, a).Plan(ctx, a.metasByMinTime)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, calls)
+	s = tracker.Status()
+	testutil.Equals(t, 1, len(s.Running))
+	testutil.Assert(t, s.Running[0].ETA != nil && !s.Running[0].ETA.Before(s.Running[0].StartedAt), "expected ETA after start")
+
+	// Halted groups are tracked until they are compacted successfully.
+	tracker.finished(a, halt(errors.New("overlapping sources")))
+	s = tracker.Status()
+	testutil.Equals(t, 0, len(s.Running))
+	testutil.Equals(t, 1, len(s.Halted))
+	testutil.Equals(t, "a", s.Halted[0].Group)
+	testutil.Equals(t, "overlapping sources", s.Halted[0].Reason)
+
+	tracker.finished(a, nil)
+	testutil.Equals(t, 0, len(tracker.Status().Halted))
+
+	tracker.SetMarkedForDeletion(map[ulid.ULID]*metadata.DeletionMark{
+		ulid.MustNew(2, nil): {ID: ulid.MustNew(2, nil), DeletionTime: time.Unix(20, 0).Unix()},
+		ulid.MustNew(1, nil): {ID: ulid.MustNew(1, nil), DeletionTime: time.Unix(10, 0).Unix()},
+	})
+	s = tracker.Status()
+	testutil.Equals(t, 2, len(s.MarkedForDeletion))
+	testutil.Equals(t, ulid.MustNew(1, nil), s.MarkedForDeletion[0].ID)
+}
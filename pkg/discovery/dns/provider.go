@@ -163,3 +163,11 @@ func (p *Provider) Addresses() []string {
 	}
 	return result
 }
+
+// AddressesFor returns the latest addresses resolved from the given address, e.g. a `dns+` prefixed one.
+func (p *Provider) AddressesFor(addr string) []string {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.resolved[addr]
+}
@@ -96,6 +96,8 @@ func TestProvider(t *testing.T) {
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(prv.resolverAddrs.WithLabelValues("any+b")))
 	testutil.Equals(t, float64(1), promtestutil.ToFloat64(prv.resolverAddrs.WithLabelValues("any+c")))
 
+	testutil.Equals(t, ips[2:4], prv.AddressesFor("any+b"))
+	testutil.Equals(t, []string(nil), prv.AddressesFor("any+a"))
 }
 
 type mockResolver struct {
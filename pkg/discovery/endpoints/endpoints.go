@@ -0,0 +1,236 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package endpoints discovers groups of gRPC endpoints, with their own options, from files.
+package endpoints
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"gopkg.in/fsnotify.v1"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+)
+
+// The APIs that endpoints can expose.
+const (
+	APIStore    = "store"
+	APIRules    = "rules"
+	APITargets  = "targets"
+	APIMetadata = "metadata"
+)
+
+var apis = []string{APIStore, APIRules, APITargets, APIMetadata}
+
+// Config is a group of endpoints sharing the same options.
+type Config struct {
+	// Targets are the addresses of the endpoints. They may be prefixed with 'dns+' or 'dnssrv+' to be resolved
+	// through the respective DNS lookups.
+	Targets []string `yaml:"targets"`
+	// Strict is true if the endpoints are always used, even if their health check fails.
+	Strict bool `yaml:"strict"`
+	// APIs are the APIs exposed by the endpoints. Defaults to the store API only, which is always required as it is
+	// used to check the health of the endpoints.
+	APIs []string `yaml:"apis"`
+	// TLSConfig configures the transport security of the connections to the endpoints. The client TLS flags are used
+	// if not set.
+	TLSConfig *TLSConfig `yaml:"tls_config"`
+}
+
+// TLSConfig configures the transport security of the connections to endpoints.
+type TLSConfig struct {
+	// Secure enables TLS. The other fields are ignored if false.
+	Secure     bool   `yaml:"secure"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	CAFile     string `yaml:"ca_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+// HasAPI returns true if the endpoints of the group expose the given API.
+func (c Config) HasAPI(api string) bool {
+	if len(c.APIs) == 0 {
+		return api == APIStore
+	}
+	for _, a := range c.APIs {
+		if a == api {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) validate() error {
+	if len(c.Targets) == 0 {
+		return errors.New("no targets")
+	}
+	for _, api := range c.APIs {
+		var known bool
+		for _, a := range apis {
+			known = known || a == api
+		}
+		if !known {
+			return errors.Errorf("unknown API %q, expecting one of: %s", api, strings.Join(apis, ", "))
+		}
+	}
+	if !c.HasAPI(APIStore) {
+		return errors.Errorf("the %s API is required, as it is used to check the health of the endpoints", APIStore)
+	}
+	if c.Strict {
+		for _, t := range c.Targets {
+			if dns.IsDynamicNode(t) {
+				return errors.Errorf("%s is a dynamically specified endpoint i.e. it uses SD and that is not permitted under strict mode", t)
+			}
+		}
+	}
+	return nil
+}
+
+// Parse parses and validates YAML groups of endpoints.
+func Parse(b []byte) ([]Config, error) {
+	var cfgs []Config
+	if err := yaml.UnmarshalStrict(b, &cfgs); err != nil {
+		return nil, errors.Wrap(err, "parsing YAML content")
+	}
+	for i, cfg := range cfgs {
+		if err := cfg.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid group %d", i)
+		}
+	}
+	return cfgs, nil
+}
+
+// FileDiscovery discovers groups of endpoints from files. The files are re-read when they change, and periodically
+// as a fallback.
+type FileDiscovery struct {
+	logger   log.Logger
+	patterns []string
+	interval time.Duration
+
+	// The last groups successfully read from each file.
+	files map[string][]Config
+}
+
+// NewFileDiscovery returns a new FileDiscovery of the groups of endpoints in the files matching the given glob
+// patterns.
+func NewFileDiscovery(logger log.Logger, patterns []string, interval time.Duration) *FileDiscovery {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &FileDiscovery{
+		logger:   logger,
+		patterns: patterns,
+		interval: interval,
+		files:    map[string][]Config{},
+	}
+}
+
+// Run sends the groups of endpoints of all the files on the given channel, each time they change, until the given
+// context is done.
+func (d *FileDiscovery) Run(ctx context.Context, ch chan<- []Config) {
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		level.Error(d.logger).Log("msg", "failed to create file watcher, only re-reading endpoints files periodically", "err", err)
+	} else {
+		defer func() {
+			if err := watcher.Close(); err != nil {
+				level.Error(d.logger).Log("msg", "error closing file watcher", "err", err)
+			}
+		}()
+		for _, p := range d.patterns {
+			// Watch the directories, as the files might not exist yet, or be replaced.
+			if err := watcher.Add(filepath.Dir(p)); err != nil {
+				level.Error(d.logger).Log("msg", "failed to watch directory of endpoints files", "path", filepath.Dir(p), "err", err)
+			}
+		}
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	var last []Config
+	for sent := false; ; {
+		if cfgs := d.refresh(); !sent || !reflect.DeepEqual(cfgs, last) {
+			select {
+			case ch <- cfgs:
+			case <-ctx.Done():
+				return
+			}
+			last, sent = cfgs, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			// fsnotify sometimes sends a bunch of events without name or operation.
+			if len(event.Name) == 0 {
+				continue
+			}
+		case err := <-errs:
+			if err != nil {
+				level.Error(d.logger).Log("msg", "error watching endpoints files", "err", err)
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh reads the files matching the patterns and returns their groups of endpoints. The last groups read
+// from the files that can not be read or parsed are kept.
+func (d *FileDiscovery) refresh() []Config {
+	seen := map[string]struct{}{}
+	for _, p := range d.patterns {
+		files, err := filepath.Glob(p)
+		if err != nil {
+			level.Error(d.logger).Log("msg", "invalid endpoints files pattern", "pattern", p, "err", err)
+			continue
+		}
+		for _, f := range files {
+			seen[f] = struct{}{}
+
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				level.Error(d.logger).Log("msg", "failed to read endpoints file", "path", f, "err", err)
+				continue
+			}
+			cfgs, err := Parse(b)
+			if err != nil {
+				level.Error(d.logger).Log("msg", "failed to parse endpoints file", "path", f, "err", err)
+				continue
+			}
+			d.files[f] = cfgs
+		}
+	}
+
+	names := make([]string, 0, len(d.files))
+	for f := range d.files {
+		if _, ok := seen[f]; !ok {
+			delete(d.files, f)
+			continue
+		}
+		names = append(names, f)
+	}
+	sort.Strings(names)
+
+	var cfgs []Config
+	for _, f := range names {
+		cfgs = append(cfgs, d.files[f]...)
+	}
+	return cfgs
+}
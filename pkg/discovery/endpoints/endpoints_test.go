@@ -0,0 +1,99 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package endpoints
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParse(t *testing.T) {
+	cfgs, err := Parse([]byte(`
+- targets: ['store-1:10901', 'dns+store.example.org:10901']
+- targets: ['rule-1:10901']
+  strict: true
+  apis: [store, rules]
+  tls_config:
+    secure: true
+    ca_file: /etc/ca.crt
+    server_name: rule.example.org
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Config{
+		{Targets: []string{"store-1:10901", "dns+store.example.org:10901"}},
+		{
+			Targets:   []string{"rule-1:10901"},
+			Strict:    true,
+			APIs:      []string{APIStore, APIRules},
+			TLSConfig: &TLSConfig{Secure: true, CAFile: "/etc/ca.crt", ServerName: "rule.example.org"},
+		},
+	}, cfgs)
+
+	testutil.Assert(t, cfgs[0].HasAPI(APIStore), "store API should be exposed by default")
+	testutil.Assert(t, !cfgs[0].HasAPI(APIRules), "rules API should not be exposed by default")
+	testutil.Assert(t, cfgs[1].HasAPI(APIRules), "rules API should be exposed")
+	testutil.Assert(t, !cfgs[1].HasAPI(APITargets), "targets API should not be exposed")
+
+	for _, tcase := range []string{
+		`- targets: []`,
+		`- targets: ['store-1:10901']
+  apis: [rules]`,
+		`- targets: ['store-1:10901']
+  apis: [store, exemplars]`,
+		`- targets: ['dns+store.example.org:10901']
+  strict: true`,
+		`- targets: ['store-1:10901']
+  unknown: true`,
+	} {
+		_, err := Parse([]byte(tcase))
+		testutil.NotOk(t, err, tcase)
+	}
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "endpoints-sd")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	// The files are replaced at once, so that they are never read partially written.
+	write := func(name, content string) {
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, name+".tmp"), []byte(content), 0600))
+		testutil.Ok(t, os.Rename(filepath.Join(dir, name+".tmp"), filepath.Join(dir, name)))
+	}
+	write("a.yml", "- targets: ['store-1:10901']\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ch := make(chan []Config)
+	go NewFileDiscovery(log.NewNopLogger(), []string{filepath.Join(dir, "*.yml")}, 100*time.Millisecond).Run(ctx, ch)
+
+	testutil.Equals(t, []Config{{Targets: []string{"store-1:10901"}}}, <-ch)
+
+	// The groups of all the files are sent, sorted by file name.
+	write("b.yml", "- targets: ['store-2:10901']\n  strict: true\n")
+	testutil.Equals(t, []Config{
+		{Targets: []string{"store-1:10901"}},
+		{Targets: []string{"store-2:10901"}, Strict: true},
+	}, <-ch)
+
+	// The last groups of invalid files are kept.
+	write("b.yml", "- targets: []\n")
+	write("a.yml", "- targets: ['store-3:10901']\n")
+	testutil.Equals(t, []Config{
+		{Targets: []string{"store-3:10901"}},
+		{Targets: []string{"store-2:10901"}, Strict: true},
+	}, <-ch)
+
+	testutil.Ok(t, os.Remove(filepath.Join(dir, "a.yml")))
+	testutil.Equals(t, []Config{{Targets: []string{"store-2:10901"}, Strict: true}}, <-ch)
+}
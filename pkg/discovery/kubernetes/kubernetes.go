@@ -0,0 +1,144 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package kubernetes discovers the addresses of the ready endpoints of Kubernetes Services.
+package kubernetes
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+const (
+	metaLabelPrefix = model.MetaLabelPrefix + "kubernetes_"
+
+	endpointReadyLabel      = metaLabelPrefix + "endpoint_ready"
+	endpointPortNameLabel   = metaLabelPrefix + "endpoint_port_name"
+	endpointSliceReadyLabel = metaLabelPrefix + "endpointslice_endpoint_conditions_ready"
+	endpointSlicePortLabel  = metaLabelPrefix + "endpointslice_port_name"
+	podReadyLabel           = metaLabelPrefix + "pod_ready"
+)
+
+// SDConfig is the configuration of the discovery of the endpoints of Kubernetes Services.
+type SDConfig struct {
+	// Role is the kind of the Kubernetes objects to watch, either endpoints or endpointslice.
+	// Defaults to endpoints.
+	Role string `yaml:"role"`
+	// Namespaces to watch the objects in. All namespaces are watched if empty.
+	Namespaces []string `yaml:"namespaces"`
+	// Selector is the label selector of the Endpoints or EndpointSlices to watch, which inherit the labels of
+	// their Service.
+	Selector string `yaml:"selector"`
+	// Port is the name of the port of the endpoints. All ports are discovered if empty.
+	Port string `yaml:"port"`
+
+	// APIServer is the URL of the Kubernetes API server, e.g. of a kubectl proxy. The in-cluster configuration,
+	// with the service account of the pod, is used if empty.
+	APIServer string `yaml:"api_server"`
+}
+
+// Discovery discovers the addresses of the endpoints of Kubernetes Services. Only the endpoints of ready pods are
+// discovered, and the changes are sent as soon as Kubernetes reports them, e.g. when a Service is scaled, with no
+// need to wait for DNS records to expire.
+type Discovery struct {
+	discoverer discovery.Discoverer
+	role       kubernetes.Role
+	port       string
+}
+
+// NewDiscovery returns a new Discovery for the given configuration.
+func NewDiscovery(logger log.Logger, cfg SDConfig) (*Discovery, error) {
+	role := kubernetes.Role(cfg.Role)
+	if role == "" {
+		role = kubernetes.RoleEndpoint
+	}
+	if role != kubernetes.RoleEndpoint && role != kubernetes.RoleEndpointSlice {
+		return nil, errors.Errorf("invalid Kubernetes SD role %q, expecting one of: %s, %s", role, kubernetes.RoleEndpoint, kubernetes.RoleEndpointSlice)
+	}
+
+	conf := &kubernetes.SDConfig{
+		Role:               role,
+		NamespaceDiscovery: kubernetes.NamespaceDiscovery{Names: cfg.Namespaces},
+	}
+	if cfg.APIServer != "" {
+		u, err := url.Parse(cfg.APIServer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse Kubernetes API server URL %s", cfg.APIServer)
+		}
+		conf.APIServer = config_util.URL{URL: u}
+	}
+	if cfg.Selector != "" {
+		conf.Selectors = []kubernetes.SelectorConfig{{Role: role, Label: cfg.Selector}}
+	}
+	d, err := kubernetes.New(logger, conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "create Kubernetes discovery")
+	}
+	return newDiscovery(d, role, cfg.Port), nil
+}
+
+func newDiscovery(d discovery.Discoverer, role kubernetes.Role, port string) *Discovery {
+	return &Discovery{discoverer: d, role: role, port: port}
+}
+
+// Run implements discovery.Discoverer. It sends the target groups of the watched objects, with only the targets of
+// the ready endpoints, until the given context is done.
+func (d *Discovery) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
+	updates := make(chan []*targetgroup.Group)
+	go d.discoverer.Run(ctx, updates)
+
+	for {
+		select {
+		case update := <-updates:
+			tgs := make([]*targetgroup.Group, 0, len(update))
+			for _, tg := range update {
+				// Some Discoverers send nil target group so need to check for it to avoid panics.
+				if tg == nil {
+					continue
+				}
+				tgs = append(tgs, d.filter(tg))
+			}
+			select {
+			case ch <- tgs:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// filter returns the given target group with only the targets of the ready endpoints on the configured port.
+func (d *Discovery) filter(tg *targetgroup.Group) *targetgroup.Group {
+	readyLabel, portLabel := model.LabelName(endpointReadyLabel), model.LabelName(endpointPortNameLabel)
+	if d.role == kubernetes.RoleEndpointSlice {
+		readyLabel, portLabel = endpointSliceReadyLabel, endpointSlicePortLabel
+	}
+
+	filtered := &targetgroup.Group{Source: tg.Source, Labels: tg.Labels}
+	for _, target := range tg.Targets {
+		// Targets with no port label are the ports of the pods that are not part of the Service.
+		port, ok := target[portLabel]
+		if !ok || (d.port != "" && string(port) != d.port) {
+			continue
+		}
+		// The readiness of endpoint slices is unknown if not set, which must be interpreted as ready.
+		if ready, ok := target[readyLabel]; (ok || d.role == kubernetes.RoleEndpoint) && ready != "true" {
+			continue
+		}
+		if ready, ok := target[podReadyLabel]; ok && ready != "true" {
+			continue
+		}
+		filtered.Targets = append(filtered.Targets, target)
+	}
+	return filtered
+}
@@ -0,0 +1,109 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/kubernetes"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type fakeDiscoverer struct {
+	updates [][]*targetgroup.Group
+}
+
+func (d *fakeDiscoverer) Run(ctx context.Context, ch chan<- []*targetgroup.Group) {
+	for _, u := range d.updates {
+		select {
+		case ch <- u:
+		case <-ctx.Done():
+			return
+		}
+	}
+	<-ctx.Done()
+}
+
+func TestNewDiscovery(t *testing.T) {
+	_, err := NewDiscovery(nil, SDConfig{Role: string(kubernetes.RolePod)})
+	testutil.NotOk(t, err)
+
+	_, err = NewDiscovery(nil, SDConfig{APIServer: "http://[::1"})
+	testutil.NotOk(t, err)
+}
+
+func TestDiscovery_Run(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		role     kubernetes.Role
+		port     string
+		targets  []model.LabelSet
+		expected []string
+	}{
+		{
+			name: "endpoints",
+			role: kubernetes.RoleEndpoint,
+			port: "grpc",
+			targets: []model.LabelSet{
+				{model.AddressLabel: "10.0.0.1:10901", endpointPortNameLabel: "grpc", endpointReadyLabel: "true", podReadyLabel: "true"},
+				{model.AddressLabel: "10.0.0.1:10902", endpointPortNameLabel: "http", endpointReadyLabel: "true", podReadyLabel: "true"},
+				{model.AddressLabel: "10.0.0.2:10901", endpointPortNameLabel: "grpc", endpointReadyLabel: "false", podReadyLabel: "false"},
+				{model.AddressLabel: "10.0.0.3:10901", endpointPortNameLabel: "grpc", endpointReadyLabel: "true", podReadyLabel: "false"},
+				{model.AddressLabel: "10.0.0.4:10901", endpointPortNameLabel: "grpc", endpointReadyLabel: "true"},
+				// Port of a pod that is not part of the Service.
+				{model.AddressLabel: "10.0.0.1:9090", podReadyLabel: "true"},
+			},
+			expected: []string{"10.0.0.1:10901", "10.0.0.4:10901"},
+		},
+		{
+			name: "endpoints with any port",
+			role: kubernetes.RoleEndpoint,
+			targets: []model.LabelSet{
+				{model.AddressLabel: "10.0.0.1:10901", endpointPortNameLabel: "grpc", endpointReadyLabel: "true"},
+				{model.AddressLabel: "10.0.0.1:10902", endpointPortNameLabel: "http", endpointReadyLabel: "true"},
+				{model.AddressLabel: "10.0.0.2:10901", endpointPortNameLabel: "grpc"},
+			},
+			expected: []string{"10.0.0.1:10901", "10.0.0.1:10902"},
+		},
+		{
+			name: "endpoint slices",
+			role: kubernetes.RoleEndpointSlice,
+			port: "grpc",
+			targets: []model.LabelSet{
+				{model.AddressLabel: "10.0.0.1:10901", endpointSlicePortLabel: "grpc", endpointSliceReadyLabel: "true", podReadyLabel: "true"},
+				{model.AddressLabel: "10.0.0.2:10901", endpointSlicePortLabel: "grpc", endpointSliceReadyLabel: "false"},
+				{model.AddressLabel: "10.0.0.3:10901", endpointSlicePortLabel: "grpc"},
+				{model.AddressLabel: "10.0.0.4:10901", endpointPortNameLabel: "grpc", endpointReadyLabel: "true"},
+			},
+			expected: []string{"10.0.0.1:10901", "10.0.0.3:10901"},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d := newDiscovery(&fakeDiscoverer{updates: [][]*targetgroup.Group{
+				{nil, {Source: "default/thanos-store", Targets: tcase.targets, Labels: model.LabelSet{"namespace": "default"}}},
+			}}, tcase.role, tcase.port)
+
+			ch := make(chan []*targetgroup.Group)
+			go d.Run(ctx, ch)
+
+			tgs := <-ch
+			testutil.Equals(t, 1, len(tgs))
+			testutil.Equals(t, "default/thanos-store", tgs[0].Source)
+			testutil.Equals(t, model.LabelSet{"namespace": "default"}, tgs[0].Labels)
+
+			var addrs []string
+			for _, target := range tgs[0].Targets {
+				addrs = append(addrs, string(target[model.AddressLabel]))
+			}
+			testutil.Equals(t, tcase.expected, addrs)
+		})
+	}
+}
@@ -15,11 +15,20 @@ import (
 	"github.com/thanos-io/thanos/pkg/tls"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 )
 
 // StoreClientGRPCOpts creates gRPC dial options for connecting to a store client.
 func StoreClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, secure bool, cert, key, caCert, serverName string) ([]grpc.DialOption, error) {
+	tlsOpt, err := StoreClientTLSOpt(logger, secure, cert, key, caCert, serverName)
+	if err != nil {
+		return nil, err
+	}
+	return append(StoreClientBaseGRPCOpts(reg, tracer), tlsOpt), nil
+}
+
+// StoreClientBaseGRPCOpts creates the gRPC dial options for connecting to a store client, except the transport security
+// one. The client metrics are registered, so it must be called once per registry.
+func StoreClientBaseGRPCOpts(reg *prometheus.Registry, tracer opentracing.Tracer) []grpc.DialOption {
 	grpcMets := grpc_prometheus.NewClientMetrics()
 	grpcMets.EnableClientHandlingTimeHistogram(
 		grpc_prometheus.WithHistogramBuckets([]float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120}),
@@ -46,16 +55,22 @@ func StoreClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer ope
 	if reg != nil {
 		reg.MustRegister(grpcMets)
 	}
+	return dialOpts
+}
 
+// StoreClientTLSOpt creates the gRPC dial option of the transport security for connecting to a store client.
+// The certificates are reloaded for the new connections when their files are modified.
+func StoreClientTLSOpt(logger log.Logger, secure bool, cert, key, caCert, serverName string) (grpc.DialOption, error) {
 	if !secure {
-		return append(dialOpts, grpc.WithInsecure()), nil
+		return grpc.WithInsecure(), nil
 	}
 
 	level.Info(logger).Log("msg", "enabling client to server TLS")
 
-	tlsCfg, err := tls.NewClientConfig(logger, cert, key, caCert, serverName)
+	// The TLS configuration is rebuilt for each connection, so that the certificates can be rotated without restart.
+	tlsCfg, err := tls.NewClientConfigFunc(logger, cert, key, caCert, serverName)
 	if err != nil {
 		return nil, err
 	}
-	return append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg))), nil
+	return grpc.WithTransportCredentials(newReloadingCredentials(tlsCfg)), nil
 }
@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package extgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// reloadingCredentials are TLS transport credentials whose configuration is rebuilt for each connection, so that the
+// new connections use the last loaded certificates.
+type reloadingCredentials struct {
+	config             func() *tls.Config
+	serverNameOverride string
+}
+
+func newReloadingCredentials(config func() *tls.Config) credentials.TransportCredentials {
+	return &reloadingCredentials{config: config}
+}
+
+func (c *reloadingCredentials) creds() credentials.TransportCredentials {
+	cfg := c.config()
+	if c.serverNameOverride != "" {
+		cfg.ServerName = c.serverNameOverride
+	}
+	return credentials.NewTLS(cfg)
+}
+
+// ClientHandshake implements credentials.TransportCredentials.
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.creds().ClientHandshake(ctx, authority, rawConn)
+}
+
+// ServerHandshake implements credentials.TransportCredentials.
+func (c *reloadingCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.creds().ServerHandshake(rawConn)
+}
+
+// Info implements credentials.TransportCredentials.
+func (c *reloadingCredentials) Info() credentials.ProtocolInfo {
+	return c.creds().Info()
+}
+
+// Clone implements credentials.TransportCredentials.
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{config: c.config, serverNameOverride: c.serverNameOverride}
+}
+
+// OverrideServerName implements credentials.TransportCredentials.
+func (c *reloadingCredentials) OverrideServerName(serverNameOverride string) error {
+	c.serverNameOverride = serverNameOverride
+	return nil
+}
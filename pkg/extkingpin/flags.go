@@ -50,6 +50,16 @@ func RegisterHTTPFlags(cmd FlagClause) (httpBindAddr *string, httpGracePeriod *m
 	return httpBindAddr, httpGracePeriod
 }
 
+// RegisterHTTPAuthFlags registers flags to pass the configuration of the authentication of the HTTP requests.
+func RegisterHTTPAuthFlags(cmd FlagClause) *extflag.PathOrContent {
+	return extflag.RegisterPathOrContent(
+		cmd,
+		"http.auth-config",
+		"YAML file with the configuration of the authentication and authorization of the HTTP requests. See format details: https://thanos.io/tip/operating/http-authentication.md/#configuration ",
+		false,
+	)
+}
+
 // RegisterCommonObjStoreFlags register flags to specify object storage configuration.
 func RegisterCommonObjStoreFlags(cmd FlagClause, suffix string, required bool, extraDesc ...string) *extflag.PathOrContent {
 	help := fmt.Sprintf("YAML file that contains object store%s configuration. See format details: https://thanos.io/tip/thanos/storage.md/#configuration ", suffix)
@@ -153,3 +153,14 @@ func (g *instrumentedInFlightGate) Done() {
 	g.inflight.Dec()
 	g.g.Done()
 }
+
+type noopGate struct{}
+
+// NewNoop returns a gate which never blocks, e.g. used when the concurrency is unlimited.
+func NewNoop() Gate { return noopGate{} }
+
+// Start implements the Gate interface.
+func (noopGate) Start(context.Context) error { return nil }
+
+// Done implements the Gate interface.
+func (noopGate) Done() {}
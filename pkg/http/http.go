@@ -16,11 +16,13 @@ import (
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
+	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/discovery/file"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/thanos/pkg/discovery/cache"
+	"github.com/thanos-io/thanos/pkg/discovery/kubernetes"
 )
 
 // ClientConfig configures an HTTP client.
@@ -128,13 +130,15 @@ func (u userAgentRoundTripper) RoundTrip(r *http.Request) (*http.Response, error
 	return u.rt.RoundTrip(r)
 }
 
-// EndpointsConfig configures a cluster of HTTP endpoints from static addresses and
-// file service discovery.
+// EndpointsConfig configures a cluster of HTTP endpoints from static addresses,
+// file and Kubernetes service discovery.
 type EndpointsConfig struct {
 	// List of addresses with DNS prefixes.
 	StaticAddresses []string `yaml:"static_configs"`
 	// List of file  configurations (our FileSD supports different DNS lookups).
 	FileSDConfigs []FileSDConfig `yaml:"file_sd_configs"`
+	// List of Kubernetes service discovery configurations.
+	KubernetesSDConfigs []kubernetes.SDConfig `yaml:"kubernetes_sd_configs"`
 
 	// The URL scheme to use when talking to targets.
 	Scheme string `yaml:"scheme"`
@@ -176,8 +180,8 @@ type Client struct {
 	prefix     string
 
 	staticAddresses []string
-	fileSDCache     *cache.Cache
-	fileDiscoverers []*file.Discovery
+	sdCache         *cache.Cache
+	discoverers     []discovery.Discoverer
 
 	provider AddressProvider
 }
@@ -188,7 +192,7 @@ func NewClient(logger log.Logger, cfg EndpointsConfig, client *http.Client, prov
 		logger = log.NewNopLogger()
 	}
 
-	var discoverers []*file.Discovery
+	var discoverers []discovery.Discoverer
 	for _, sdCfg := range cfg.FileSDConfigs {
 		fileSDCfg, err := sdCfg.convert()
 		if err != nil {
@@ -196,14 +200,21 @@ func NewClient(logger log.Logger, cfg EndpointsConfig, client *http.Client, prov
 		}
 		discoverers = append(discoverers, file.NewDiscovery(&fileSDCfg, logger))
 	}
+	for _, sdCfg := range cfg.KubernetesSDConfigs {
+		d, err := kubernetes.NewDiscovery(logger, sdCfg)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, d)
+	}
 	return &Client{
 		logger:          logger,
 		httpClient:      client,
 		scheme:          cfg.Scheme,
 		prefix:          cfg.PathPrefix,
 		staticAddresses: cfg.StaticAddresses,
-		fileSDCache:     cache.New(),
-		fileDiscoverers: discoverers,
+		sdCache:         cache.New(),
+		discoverers:     discoverers,
 		provider:        provider,
 	}, nil
 }
@@ -233,9 +244,9 @@ func (c *Client) Discover(ctx context.Context) {
 	var wg sync.WaitGroup
 	ch := make(chan []*targetgroup.Group)
 
-	for _, d := range c.fileDiscoverers {
+	for _, d := range c.discoverers {
 		wg.Add(1)
-		go func(d *file.Discovery) {
+		go func(d discovery.Discoverer) {
 			d.Run(ctx, ch)
 			wg.Done()
 		}(d)
@@ -249,7 +260,7 @@ func (c *Client) Discover(ctx context.Context) {
 				if update == nil {
 					continue
 				}
-				c.fileSDCache.Update(update)
+				c.sdCache.Update(update)
 			case <-ctx.Done():
 				return
 			}
@@ -260,5 +271,5 @@ func (c *Client) Discover(ctx context.Context) {
 
 // Resolve refreshes and resolves the list of targets.
 func (c *Client) Resolve(ctx context.Context) error {
-	return c.provider.Resolve(ctx, append(c.fileSDCache.Addresses(), c.staticAddresses...))
+	return c.provider.Resolve(ctx, append(c.sdCache.Addresses(), c.staticAddresses...))
 }
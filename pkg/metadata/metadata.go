@@ -0,0 +1,126 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+)
+
+var _ UnaryClient = &GRPCClient{}
+
+// UnaryClient is gRPC metadatapb.Metadata client which expands streaming metadata API. Useful for consumers that does not
+// support streaming.
+type UnaryClient interface {
+	Metadata(ctx context.Context, req *metadatapb.MetadataRequest) (*metadatapb.MetricMetadata, storage.Warnings, error)
+}
+
+// GRPCClient allows to retrieve metadata from local gRPC streaming server implementation.
+type GRPCClient struct {
+	proxy metadatapb.MetadataServer
+}
+
+func NewGRPCClient(ms metadatapb.MetadataServer) *GRPCClient {
+	return &GRPCClient{
+		proxy: ms,
+	}
+}
+
+// Metadata returns the metadata of the metrics, merged by metric and deduplicated, with at most the limit of the
+// request metrics if not negative.
+func (mc *GRPCClient) Metadata(ctx context.Context, req *metadatapb.MetadataRequest) (*metadatapb.MetricMetadata, storage.Warnings, error) {
+	resp := &metadataServer{ctx: ctx}
+
+	if err := mc.proxy.Metadata(req, resp); err != nil {
+		return nil, nil, errors.Wrap(err, "proxy Metadata")
+	}
+
+	entries := dedupMetadata(resp.entries)
+	if req.Limit >= 0 && len(entries) > int(req.Limit) {
+		entries = entries[:req.Limit]
+	}
+	return &metadatapb.MetricMetadata{Metadata: entries}, resp.warnings, nil
+}
+
+// dedupMetadata merges the entries of the same metrics, returned by different servers, and removes their duplicated
+// metadata. The entries are sorted by metric and their metadata by type, help and unit.
+func dedupMetadata(entries []*metadatapb.MetricMetadataEntry) []*metadatapb.MetricMetadataEntry {
+	if len(entries) == 0 {
+		return entries
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Metric < entries[j].Metric })
+
+	i := 0
+	for _, e := range entries[1:] {
+		if e.Metric == entries[i].Metric {
+			entries[i].Metas = append(entries[i].Metas, e.Metas...)
+		} else {
+			i++
+			entries[i] = e
+		}
+	}
+	entries = entries[:i+1]
+
+	for _, e := range entries {
+		e.Metas = dedupMetas(e.Metas)
+	}
+	return entries
+}
+
+func dedupMetas(metas []metadatapb.Meta) []metadatapb.Meta {
+	if len(metas) == 0 {
+		return metas
+	}
+
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].Type != metas[j].Type {
+			return metas[i].Type < metas[j].Type
+		}
+		if metas[i].Help != metas[j].Help {
+			return metas[i].Help < metas[j].Help
+		}
+		return metas[i].Unit < metas[j].Unit
+	})
+
+	i := 0
+	for _, m := range metas[1:] {
+		if m != metas[i] {
+			i++
+			metas[i] = m
+		}
+	}
+	return metas[:i+1]
+}
+
+type metadataServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	metadatapb.Metadata_MetadataServer
+	ctx context.Context
+
+	warnings []error
+	entries  []*metadatapb.MetricMetadataEntry
+}
+
+func (srv *metadataServer) Send(res *metadatapb.MetadataResponse) error {
+	if res.GetWarning() != "" {
+		srv.warnings = append(srv.warnings, errors.New(res.GetWarning()))
+		return nil
+	}
+
+	if res.GetMetadata() == nil {
+		return errors.New("no metadata")
+	}
+
+	srv.entries = append(srv.entries, res.GetMetadata().Metadata...)
+	return nil
+}
+
+func (srv *metadataServer) Context() context.Context {
+	return srv.ctx
+}
@@ -0,0 +1,108 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.TolerantVerifyLeakMain(m)
+}
+
+var (
+	upMeta      = metadatapb.Meta{Type: "gauge", Help: "Up."}
+	upOtherMeta = metadatapb.Meta{Type: "gauge", Help: "Whether the target is up."}
+	reqMeta     = metadatapb.Meta{Type: "counter", Help: "Requests.", Unit: "requests"}
+)
+
+func TestDedupMetadata(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		entries, want []*metadatapb.MetricMetadataEntry
+	}{
+		{
+			name:    "nil slice",
+			entries: nil,
+			want:    nil,
+		},
+		{
+			name:    "empty slice",
+			entries: []*metadatapb.MetricMetadataEntry{},
+			want:    []*metadatapb.MetricMetadataEntry{},
+		},
+		{
+			name: "different metrics",
+			entries: []*metadatapb.MetricMetadataEntry{
+				{Metric: "up", Metas: []metadatapb.Meta{upMeta}},
+				{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+			},
+			want: []*metadatapb.MetricMetadataEntry{
+				{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+				{Metric: "up", Metas: []metadatapb.Meta{upMeta}},
+			},
+		},
+		{
+			name: "same metrics of different servers",
+			entries: []*metadatapb.MetricMetadataEntry{
+				{Metric: "up", Metas: []metadatapb.Meta{upOtherMeta}},
+				{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+				{Metric: "up", Metas: []metadatapb.Meta{upMeta, upOtherMeta}},
+				{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+			},
+			want: []*metadatapb.MetricMetadataEntry{
+				{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+				{Metric: "up", Metas: []metadatapb.Meta{upMeta, upOtherMeta}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.Equals(t, tc.want, dedupMetadata(tc.entries))
+		})
+	}
+}
+
+type testMetadataServer struct {
+	metadatapb.MetadataServer
+
+	responses []*metadatapb.MetadataResponse
+}
+
+func (s *testMetadataServer) Metadata(_ *metadatapb.MetadataRequest, srv metadatapb.Metadata_MetadataServer) error {
+	for _, r := range s.responses {
+		if err := srv.Send(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestGRPCClient_Metadata(t *testing.T) {
+	client := NewGRPCClient(&testMetadataServer{responses: []*metadatapb.MetadataResponse{
+		metadatapb.NewMetricMetadataResponse(&metadatapb.MetricMetadata{Metadata: []*metadatapb.MetricMetadataEntry{
+			{Metric: "up", Metas: []metadatapb.Meta{upMeta}},
+			{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+		}}),
+		metadatapb.NewWarningMetadataResponse(context.DeadlineExceeded),
+		metadatapb.NewMetricMetadataResponse(&metadatapb.MetricMetadata{Metadata: []*metadatapb.MetricMetadataEntry{
+			{Metric: "up", Metas: []metadatapb.Meta{upMeta}},
+		}}),
+	}})
+
+	md, warnings, err := client.Metadata(context.Background(), &metadatapb.MetadataRequest{Limit: -1})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(warnings))
+	testutil.Equals(t, &metadatapb.MetricMetadata{Metadata: []*metadatapb.MetricMetadataEntry{
+		{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+		{Metric: "up", Metas: []metadatapb.Meta{upMeta}},
+	}}, md)
+
+	md, _, err = client.Metadata(context.Background(), &metadatapb.MetadataRequest{Limit: 1})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(md.Metadata))
+}
@@ -0,0 +1,55 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadatapb
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+func NewMetricMetadataResponse(metadata *MetricMetadata) *MetadataResponse {
+	return &MetadataResponse{
+		Result: &MetadataResponse_Metadata{
+			Metadata: metadata,
+		},
+	}
+}
+
+func NewWarningMetadataResponse(warning error) *MetadataResponse {
+	return &MetadataResponse{
+		Result: &MetadataResponse_Warning{
+			Warning: warning.Error(),
+		},
+	}
+}
+
+// UnmarshalJSON unmarshals the metric name to metadata map of the Prometheus API. The entries are sorted by metric.
+func (m *MetricMetadata) UnmarshalJSON(entry []byte) error {
+	var metas map[string][]Meta
+	if err := json.Unmarshal(entry, &metas); err != nil {
+		return errors.Wrapf(err, "metricMetadata: unmarshal %v", string(entry))
+	}
+
+	m.Metadata = make([]*MetricMetadataEntry, 0, len(metas))
+	for metric, ms := range metas {
+		m.Metadata = append(m.Metadata, &MetricMetadataEntry{Metric: metric, Metas: ms})
+	}
+	sort.Slice(m.Metadata, func(i, j int) bool { return m.Metadata[i].Metric < m.Metadata[j].Metric })
+	return nil
+}
+
+// MarshalJSON marshals the metadata into the metric name to metadata map of the Prometheus API.
+func (m *MetricMetadata) MarshalJSON() ([]byte, error) {
+	metas := make(map[string][]Meta, len(m.Metadata))
+	for _, e := range m.Metadata {
+		if _, ok := metas[e.Metric]; !ok {
+			// Ensure that empty slices are marshaled as '[]' and not 'null'.
+			metas[e.Metric] = make([]Meta, 0, len(e.Metas))
+		}
+		metas[e.Metric] = append(metas[e.Metric], e.Metas...)
+	}
+	return json.Marshal(metas)
+}
@@ -0,0 +1,51 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPrometheus_Metadata(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/api/v1/metadata", r.URL.Path)
+		query = r.URL.Query()
+		_, _ = w.Write([]byte(`{"status":"success","data":{
+"up":[{"type":"gauge","help":"Up.","unit":""}],
+"http_requests_total":[{"type":"counter","help":"Requests.","unit":"requests"}]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	client := NewGRPCClient(NewPrometheus(u, promclient.NewDefaultClient()))
+
+	md, w, err := client.Metadata(context.Background(), &metadatapb.MetadataRequest{Metric: "up", Limit: -1})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(w))
+	testutil.Equals(t, url.Values{"metric": []string{"up"}}, query)
+	testutil.Equals(t, &metadatapb.MetricMetadata{Metadata: []*metadatapb.MetricMetadataEntry{
+		{Metric: "http_requests_total", Metas: []metadatapb.Meta{reqMeta}},
+		{Metric: "up", Metas: []metadatapb.Meta{upMeta}},
+	}}, md)
+
+	b, err := json.Marshal(md)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"http_requests_total":[{"type":"counter","help":"Requests.","unit":"requests"}],"up":[{"type":"gauge","help":"Up.","unit":""}]}`, string(b))
+
+	_, _, err = client.Metadata(context.Background(), &metadatapb.MetadataRequest{Limit: 10})
+	testutil.Ok(t, err)
+	testutil.Equals(t, url.Values{"limit": []string{"10"}}, query)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package metadata
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Proxy implements metadatapb.Metadata gRPC that fanouts requests to given metadatapb.Metadata.
+type Proxy struct {
+	logger   log.Logger
+	metadata func() []metadatapb.MetadataClient
+}
+
+func RegisterMetadataServer(metadataSrv metadatapb.MetadataServer) func(*grpc.Server) {
+	return func(s *grpc.Server) {
+		metadatapb.RegisterMetadataServer(s, metadataSrv)
+	}
+}
+
+// NewProxy returns new metadata.Proxy.
+func NewProxy(logger log.Logger, metadata func() []metadatapb.MetadataClient) *Proxy {
+	return &Proxy{
+		logger:   logger,
+		metadata: metadata,
+	}
+}
+
+func (s *Proxy) Metadata(req *metadatapb.MetadataRequest, srv metadatapb.Metadata_MetadataServer) error {
+	var (
+		g, gctx  = errgroup.WithContext(srv.Context())
+		respChan = make(chan *metadatapb.MetricMetadata, 10)
+		metadata []*metadatapb.MetricMetadata
+	)
+
+	for _, metadataClient := range s.metadata() {
+		ms := &metadataStream{
+			client:  metadataClient,
+			request: req,
+			channel: respChan,
+			server:  srv,
+		}
+		g.Go(func() error { return ms.receive(gctx) })
+	}
+
+	go func() {
+		_ = g.Wait()
+		close(respChan)
+	}()
+
+	for resp := range respChan {
+		metadata = append(metadata, resp)
+	}
+
+	if err := g.Wait(); err != nil {
+		level.Error(s.logger).Log("err", err)
+		return err
+	}
+
+	for _, m := range metadata {
+		if err := srv.Send(metadatapb.NewMetricMetadataResponse(m)); err != nil {
+			return status.Error(codes.Unknown, errors.Wrap(err, "send metadata response").Error())
+		}
+	}
+
+	return nil
+}
+
+type metadataStream struct {
+	client  metadatapb.MetadataClient
+	request *metadatapb.MetadataRequest
+	channel chan<- *metadatapb.MetricMetadata
+	server  metadatapb.Metadata_MetadataServer
+}
+
+func (stream *metadataStream) receive(ctx context.Context) error {
+	metadata, err := stream.client.Metadata(ctx, stream.request)
+	if err != nil {
+		err = errors.Wrapf(err, "fetching metadata from metadata client %v", stream.client)
+
+		if stream.request.PartialResponseStrategy == storepb.PartialResponseStrategy_ABORT {
+			return err
+		}
+
+		if serr := stream.server.Send(metadatapb.NewWarningMetadataResponse(err)); serr != nil {
+			return serr
+		}
+		// Not an error if response strategy is warning.
+		return nil
+	}
+
+	for {
+		md, err := metadata.Recv()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err, "receiving metadata from metadata client %v", stream.client)
+
+			if stream.request.PartialResponseStrategy == storepb.PartialResponseStrategy_ABORT {
+				return err
+			}
+
+			if err := stream.server.Send(metadatapb.NewWarningMetadataResponse(err)); err != nil {
+				return errors.Wrapf(err, "sending metadata error to server %v", stream.server)
+			}
+
+			continue
+		}
+
+		if w := md.GetWarning(); w != "" {
+			if err := stream.server.Send(metadatapb.NewWarningMetadataResponse(errors.New(w))); err != nil {
+				return errors.Wrapf(err, "sending metadata warning to server %v", stream.server)
+			}
+			continue
+		}
+
+		select {
+		case stream.channel <- md.GetMetadata():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
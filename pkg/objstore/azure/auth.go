@@ -0,0 +1,208 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	blob "github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	storageResource       = "https://storage.azure.com/"
+	defaultAuthorityHost  = "https://login.microsoftonline.com/"
+	clientAssertionType   = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	tokenRequestTimeout   = 30 * time.Second
+	tokenRefreshMargin    = 5 * time.Minute
+	tokenRefreshRetryWait = 30 * time.Second
+)
+
+// msiEndpoint is the Azure Instance Metadata Service token endpoint. Variable for testing.
+var msiEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// WorkloadIdentityConfig configures Azure AD workload identity federation, where a token issued to the workload,
+// e.g. a Kubernetes service account token, is exchanged for an Azure AD token. Unset fields default to the
+// AZURE_CLIENT_ID, AZURE_TENANT_ID, AZURE_FEDERATED_TOKEN_FILE and AZURE_AUTHORITY_HOST environment variables
+// set by the AKS workload identity webhook.
+type WorkloadIdentityConfig struct {
+	ClientID      string `yaml:"client_id"`
+	TenantID      string `yaml:"tenant_id"`
+	TokenFile     string `yaml:"token_file"`
+	AuthorityHost string `yaml:"authority_host"`
+}
+
+func (conf *WorkloadIdentityConfig) setDefaultsFromEnv() {
+	for _, f := range []struct {
+		field *string
+		env   string
+	}{
+		{field: &conf.ClientID, env: "AZURE_CLIENT_ID"},
+		{field: &conf.TenantID, env: "AZURE_TENANT_ID"},
+		{field: &conf.TokenFile, env: "AZURE_FEDERATED_TOKEN_FILE"},
+		{field: &conf.AuthorityHost, env: "AZURE_AUTHORITY_HOST"},
+	} {
+		if *f.field == "" {
+			*f.field = os.Getenv(f.env)
+		}
+	}
+	if conf.AuthorityHost == "" {
+		conf.AuthorityHost = defaultAuthorityHost
+	}
+}
+
+type aadToken struct {
+	accessToken string
+	expiresOn   time.Time
+}
+
+type tokenSource func(ctx context.Context) (aadToken, error)
+
+// newCredential returns the credential for the configured authentication: the storage account key if set,
+// workload identity if configured, and managed identity otherwise.
+func newCredential(logger log.Logger, conf Config) (blob.Credential, error) {
+	if conf.StorageAccountKey != "" {
+		return blob.NewSharedKeyCredential(conf.StorageAccountName, conf.StorageAccountKey)
+	}
+
+	client := &http.Client{Timeout: tokenRequestTimeout}
+	src := managedIdentityToken(client, conf.UserAssignedID)
+	if conf.WorkloadIdentity.TokenFile != "" {
+		src = workloadIdentityToken(client, conf.WorkloadIdentity)
+	}
+	return newTokenCredential(logger, src)
+}
+
+// newTokenCredential returns a credential refreshing the token from src before it expires. Failing to get the
+// initial token is returned as an error, later failures are retried.
+func newTokenCredential(logger log.Logger, src tokenSource) (blob.Credential, error) {
+	var (
+		initErr error
+		initial = true
+	)
+	cred := blob.NewTokenCredential("", func(c blob.TokenCredential) time.Duration {
+		ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+		defer cancel()
+
+		tok, err := src(ctx)
+		if err != nil {
+			if initial {
+				initErr = err
+				return 0
+			}
+			level.Warn(logger).Log("msg", "failed to refresh Azure AD token, retrying", "err", err)
+			return tokenRefreshRetryWait
+		}
+		initial = false
+		c.SetToken(tok.accessToken)
+
+		if d := time.Until(tok.expiresOn) - tokenRefreshMargin; d > tokenRefreshRetryWait {
+			return d
+		}
+		return tokenRefreshRetryWait
+	})
+	if initErr != nil {
+		return nil, errors.Wrap(initErr, "get Azure AD token")
+	}
+	return cred, nil
+}
+
+// managedIdentityToken gets tokens from the Instance Metadata Service. If clientID is empty, the system-assigned
+// identity or the only user-assigned identity is used.
+func managedIdentityToken(client *http.Client, clientID string) tokenSource {
+	return func(ctx context.Context) (aadToken, error) {
+		q := url.Values{}
+		q.Set("api-version", "2018-02-01")
+		q.Set("resource", storageResource)
+		if clientID != "" {
+			q.Set("client_id", clientID)
+		}
+		req, err := http.NewRequest(http.MethodGet, msiEndpoint+"?"+q.Encode(), nil)
+		if err != nil {
+			return aadToken{}, err
+		}
+		req.Header.Set("Metadata", "true")
+
+		tok, err := doTokenRequest(ctx, client, req)
+		return tok, errors.Wrap(err, "managed identity")
+	}
+}
+
+// workloadIdentityToken exchanges the federated token from the configured file for an Azure AD token.
+func workloadIdentityToken(client *http.Client, conf WorkloadIdentityConfig) tokenSource {
+	return func(ctx context.Context) (aadToken, error) {
+		// The file is read on every request, as the token is rotated.
+		assertion, err := ioutil.ReadFile(conf.TokenFile)
+		if err != nil {
+			return aadToken{}, errors.Wrap(err, "read federated token")
+		}
+
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		form.Set("client_id", conf.ClientID)
+		form.Set("scope", storageResource+".default")
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+
+		u := strings.TrimSuffix(conf.AuthorityHost, "/") + "/" + url.PathEscape(conf.TenantID) + "/oauth2/v2.0/token"
+		req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(form.Encode()))
+		if err != nil {
+			return aadToken{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		tok, err := doTokenRequest(ctx, client, req)
+		return tok, errors.Wrap(err, "workload identity")
+	}
+}
+
+func doTokenRequest(ctx context.Context, client *http.Client, req *http.Request) (aadToken, error) {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return aadToken{}, err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return aadToken{}, errors.Errorf("unexpected response %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	// IMDS returns the expiry as strings, Azure AD as numbers.
+	var body struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return aadToken{}, errors.Wrap(err, "decode token response")
+	}
+	if body.AccessToken == "" {
+		return aadToken{}, errors.New("no access token in response")
+	}
+
+	tok := aadToken{accessToken: body.AccessToken}
+	if on, err := strconv.ParseInt(body.ExpiresOn.String(), 10, 64); err == nil {
+		tok.expiresOn = time.Unix(on, 0)
+	} else if in, err := strconv.ParseInt(body.ExpiresIn.String(), 10, 64); err == nil {
+		tok.expiresOn = time.Now().Add(time.Duration(in) * time.Second)
+	} else {
+		return aadToken{}, errors.New("no token expiry in response")
+	}
+	return tok, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	blob "github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/go-kit/kit/log"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// Override the metadata endpoint used by managedIdentityToken.
+func withMSIEndpoint(endpoint string) func() {
+	old := msiEndpoint
+	msiEndpoint = endpoint
+	return func() { msiEndpoint = old }
+}
+
+func TestManagedIdentityToken(t *testing.T) {
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("client_id") == "unknown" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_request","error_description":"Identity not found"}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%s","expires_on":"%d","resource":"%s","token_type":"Bearer"}`,
+			r.URL.Query().Get("client_id"), time.Now().Add(time.Hour).Unix(), r.URL.Query().Get("resource"))
+	}))
+	defer srv.Close()
+	defer withMSIEndpoint(srv.URL)()
+
+	tok, err := managedIdentityToken(srv.Client(), "")(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, "token-", tok.accessToken)
+	testutil.Equals(t, storageResource, requests[0].URL.Query().Get("resource"))
+	_, ok := requests[0].URL.Query()["client_id"]
+	testutil.Assert(t, !ok, "expected no client_id for the system-assigned identity")
+
+	tok, err = managedIdentityToken(srv.Client(), "client-id")(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, "token-client-id", tok.accessToken)
+	testutil.Assert(t, time.Until(tok.expiresOn) > 59*time.Minute, "unexpected expiry %v", tok.expiresOn)
+
+	_, err = managedIdentityToken(srv.Client(), "unknown")(context.Background())
+	testutil.NotOk(t, err)
+}
+
+func TestWorkloadIdentityToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "azure-auth")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+	tokenFile := filepath.Join(dir, "token")
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("federated-1\n"), 0600))
+
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Ok(t, r.ParseForm())
+		requests = append(requests, r)
+		if r.URL.Path != "/tenant-id/oauth2/v2.0/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"token_type":"Bearer","expires_in":3599,"access_token":"aad-%s"}`, r.PostForm.Get("client_assertion"))
+	}))
+	defer srv.Close()
+
+	conf := WorkloadIdentityConfig{ClientID: "client-id", TenantID: "tenant-id", TokenFile: tokenFile, AuthorityHost: srv.URL + "/"}
+	src := workloadIdentityToken(srv.Client(), conf)
+
+	tok, err := src(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, "aad-federated-1", tok.accessToken)
+	testutil.Assert(t, time.Until(tok.expiresOn) > 59*time.Minute, "unexpected expiry %v", tok.expiresOn)
+
+	form := requests[0].PostForm
+	testutil.Equals(t, "client_credentials", form.Get("grant_type"))
+	testutil.Equals(t, "client-id", form.Get("client_id"))
+	testutil.Equals(t, "https://storage.azure.com/.default", form.Get("scope"))
+	testutil.Equals(t, clientAssertionType, form.Get("client_assertion_type"))
+
+	// Rotated token is used on refresh.
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("federated-2"), 0600))
+	tok, err = src(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, "aad-federated-2", tok.accessToken)
+
+	conf.TenantID = "other"
+	_, err = workloadIdentityToken(srv.Client(), conf)(context.Background())
+	testutil.NotOk(t, err)
+}
+
+func TestNewCredential(t *testing.T) {
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"msi-token","expires_on":"` + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + `"}`))
+	}))
+	defer srv.Close()
+	defer withMSIEndpoint(srv.URL)()
+
+	conf := Config{StorageAccountName: "foo", ContainerName: "roo", UserAssignedID: "client-id"}
+	testutil.Ok(t, conf.validate())
+
+	cred, err := newCredential(log.NewNopLogger(), conf)
+	testutil.Ok(t, err)
+	tc, ok := cred.(blob.TokenCredential)
+	testutil.Assert(t, ok, "expected token credential, got %T", cred)
+	testutil.Equals(t, "msi-token", tc.Token())
+
+	// Failing to get the initial token fails the creation.
+	fail = true
+	_, err = newCredential(log.NewNopLogger(), conf)
+	testutil.NotOk(t, err)
+
+	// Account key does not need a token.
+	conf = Config{StorageAccountName: "foo", StorageAccountKey: "Zm9vCg==", ContainerName: "roo"}
+	testutil.Ok(t, conf.validate())
+	cred, err = newCredential(log.NewNopLogger(), conf)
+	testutil.Ok(t, err)
+	_, ok = cred.(*blob.SharedKeyCredential)
+	testutil.Assert(t, ok, "expected shared key credential, got %T", cred)
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	blob "github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/go-kit/kit/log"
@@ -22,35 +23,48 @@ import (
 
 const (
 	azureDefaultEndpoint = "blob.core.windows.net"
+
+	// copyStatusPollInterval is the interval of checking status of the asynchronous server side copy.
+	copyStatusPollInterval = 500 * time.Millisecond
 )
 
 // Config Azure storage configuration.
 type Config struct {
 	StorageAccountName string `yaml:"storage_account"`
-	StorageAccountKey  string `yaml:"storage_account_key"`
-	ContainerName      string `yaml:"container"`
-	Endpoint           string `yaml:"endpoint"`
-	MaxRetries         int    `yaml:"max_retries"`
+	// StorageAccountKey is used for authentication if set, Azure AD authentication is used otherwise.
+	StorageAccountKey string `yaml:"storage_account_key"`
+	ContainerName     string `yaml:"container"`
+	Endpoint          string `yaml:"endpoint"`
+	MaxRetries        int    `yaml:"max_retries"`
+	// UserAssignedID is the client ID of the user-assigned managed identity to authenticate with.
+	UserAssignedID   string                 `yaml:"user_assigned_id"`
+	WorkloadIdentity WorkloadIdentityConfig `yaml:"workload_identity"`
 }
 
 // Bucket implements the store.Bucket interface against Azure APIs.
 type Bucket struct {
 	logger       log.Logger
 	containerURL blob.ContainerURL
+	credential   blob.Credential
 	config       *Config
 }
 
 // Validate checks to see if any of the config options are set.
 func (conf *Config) validate() error {
-	if conf.StorageAccountName == "" ||
-		conf.StorageAccountKey == "" {
-		return errors.New("invalid Azure storage configuration")
-	}
-	if conf.StorageAccountName == "" && conf.StorageAccountKey != "" {
-		return errors.New("no Azure storage_account specified while storage_account_key is present in config file; both should be present")
+	if conf.StorageAccountName == "" {
+		return errors.New("no Azure storage_account specified in config file")
 	}
-	if conf.StorageAccountName != "" && conf.StorageAccountKey == "" {
-		return errors.New("no Azure storage_account_key specified while storage_account is present in config file; both should be present")
+	if conf.StorageAccountKey != "" {
+		if conf.UserAssignedID != "" || conf.WorkloadIdentity != (WorkloadIdentityConfig{}) {
+			return errors.New("user_assigned_id and workload_identity cannot be used together with storage_account_key")
+		}
+	} else if conf.UserAssignedID == "" {
+		conf.WorkloadIdentity.setDefaultsFromEnv()
+		if conf.WorkloadIdentity.TokenFile != "" && (conf.WorkloadIdentity.ClientID == "" || conf.WorkloadIdentity.TenantID == "") {
+			return errors.New("workload_identity client_id and tenant_id must be set if token_file is set")
+		}
+	} else if conf.WorkloadIdentity != (WorkloadIdentityConfig{}) {
+		return errors.New("user_assigned_id and workload_identity cannot be used together")
 	}
 	if conf.ContainerName == "" {
 		return errors.New("no Azure container specified")
@@ -77,8 +91,13 @@ func NewBucket(logger log.Logger, azureConfig []byte, component string) (*Bucket
 		return nil, err
 	}
 
+	credential, err := newCredential(logger, conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "create Azure credential")
+	}
+
 	ctx := context.Background()
-	container, err := createContainer(ctx, conf)
+	container, err := createContainer(ctx, conf, credential)
 	if err != nil {
 		ret, ok := err.(blob.StorageError)
 		if !ok {
@@ -86,7 +105,7 @@ func NewBucket(logger log.Logger, azureConfig []byte, component string) (*Bucket
 		}
 		if ret.ServiceCode() == "ContainerAlreadyExists" {
 			level.Debug(logger).Log("msg", "Getting connection to existing Azure blob container", "container", conf.ContainerName)
-			container, err = getContainer(ctx, conf)
+			container, err = getContainer(ctx, conf, credential)
 			if err != nil {
 				return nil, errors.Wrapf(err, "cannot get existing Azure blob container: %s", container)
 			}
@@ -100,6 +119,7 @@ func NewBucket(logger log.Logger, azureConfig []byte, component string) (*Bucket
 	bkt := &Bucket{
 		logger:       logger,
 		containerURL: container,
+		credential:   credential,
 		config:       &conf,
 	}
 	return bkt, nil
@@ -108,7 +128,14 @@ func NewBucket(logger log.Logger, azureConfig []byte, component string) (*Bucket
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
 
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes returned by the listing.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
 	prefix := dir
 	if prefix != "" && !strings.HasSuffix(prefix, DirDelim) {
 		prefix += DirDelim
@@ -127,18 +154,18 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 
 		marker = list.NextMarker
 
-		var listNames []string
-
 		for _, blob := range list.Segment.BlobItems {
-			listNames = append(listNames, blob.Name)
+			attrs := objstore.ObjectAttributes{LastModified: blob.Properties.LastModified}
+			if blob.Properties.ContentLength != nil {
+				attrs.Size = *blob.Properties.ContentLength
+			}
+			if err := f(blob.Name, attrs); err != nil {
+				return err
+			}
 		}
 
 		for _, blobPrefix := range list.Segment.BlobPrefixes {
-			listNames = append(listNames, blobPrefix.Name)
-		}
-
-		for _, name := range listNames {
-			if err := f(name); err != nil {
+			if err := f(blobPrefix.Name, objstore.ObjectAttributes{}); err != nil {
 				return err
 			}
 		}
@@ -148,7 +175,7 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 			break
 		}
 
-		level.Debug(b.logger).Log("msg", "requesting next iteration of listing blobs", "last_entries", len(listNames), "iteration", i)
+		level.Debug(b.logger).Log("msg", "requesting next iteration of listing blobs", "last_entries", len(list.Segment.BlobItems)+len(list.Segment.BlobPrefixes), "iteration", i)
 	}
 
 	return nil
@@ -159,6 +186,9 @@ func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	if err == nil {
 		return false
 	}
+	if storageErr, ok := errors.Cause(err).(blob.StorageError); ok && storageErr.ServiceCode() == blob.ServiceCodeBlobNotFound {
+		return true
+	}
 
 	errorCode := parseError(err.Error())
 	if errorCode == "InvalidUri" || errorCode == "BlobNotFound" {
@@ -168,6 +198,14 @@ func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	return false
 }
 
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (b *Bucket) ErrStatusCode(err error) int {
+	if storageErr, ok := errors.Cause(err).(blob.StorageError); ok && storageErr.Response() != nil {
+		return storageErr.Response().StatusCode
+	}
+	return 0
+}
+
 func (b *Bucket) getBlobReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
 	level.Debug(b.logger).Log("msg", "getting blob", "blob", name, "offset", offset, "length", length)
 	if len(name) == 0 {
@@ -182,7 +220,7 @@ func (b *Bucket) getBlobReader(ctx context.Context, name string, offset, length
 		return nil, errors.New("X-Ms-Error-Code: [BlobNotFound]")
 	}
 
-	blobURL, err := getBlobURL(ctx, *b.config, name)
+	blobURL, err := getBlobURL(ctx, *b.config, b.credential, name)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot get Azure blob URL, address: %s", name)
 	}
@@ -233,7 +271,7 @@ func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (
 
 // Attributes returns information about the specified object.
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
-	blobURL, err := getBlobURL(ctx, *b.config, name)
+	blobURL, err := getBlobURL(ctx, *b.config, b.credential, name)
 	if err != nil {
 		return objstore.ObjectAttributes{}, errors.Wrapf(err, "cannot get Azure blob URL, blob: %s", name)
 	}
@@ -253,7 +291,7 @@ func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAt
 // Exists checks if the given object exists.
 func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 	level.Debug(b.logger).Log("msg", "check if blob exists", "blob", name)
-	blobURL, err := getBlobURL(ctx, *b.config, name)
+	blobURL, err := getBlobURL(ctx, *b.config, b.credential, name)
 	if err != nil {
 		return false, errors.Wrapf(err, "cannot get Azure blob URL, address: %s", name)
 	}
@@ -271,7 +309,7 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 // Upload the contents of the reader as an object into the bucket.
 func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	level.Debug(b.logger).Log("msg", "Uploading blob", "blob", name)
-	blobURL, err := getBlobURL(ctx, *b.config, name)
+	blobURL, err := getBlobURL(ctx, *b.config, b.credential, name)
 	if err != nil {
 		return errors.Wrapf(err, "cannot get Azure blob URL, address: %s", name)
 	}
@@ -289,7 +327,7 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 // Delete removes the object with the given name.
 func (b *Bucket) Delete(ctx context.Context, name string) error {
 	level.Debug(b.logger).Log("msg", "Deleting blob", "blob", name)
-	blobURL, err := getBlobURL(ctx, *b.config, name)
+	blobURL, err := getBlobURL(ctx, *b.config, b.credential, name)
 	if err != nil {
 		return errors.Wrapf(err, "cannot get Azure blob URL, address: %s", name)
 	}
@@ -300,6 +338,53 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
+// DeleteMultiple removes all blobs with the given names concurrently.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	return objstore.DeleteMultipleConcurrently(ctx, b, names, objstore.DefaultDeleteConcurrency)
+}
+
+// Copy copies the blob with srcName into the dstName using server side copy.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) error {
+	level.Debug(b.logger).Log("msg", "copying blob", "src", srcName, "dst", dstName)
+	srcURL, err := getBlobURL(ctx, *b.config, b.credential, srcName)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get Azure blob URL, address: %s", srcName)
+	}
+	// The copy of a missing blob fails with CannotVerifyCopySource, so check the source first to return the
+	// BlobNotFound error of the service, which is recognized by IsObjNotFoundErr.
+	if _, err := srcURL.GetProperties(ctx, blob.BlobAccessConditions{}); err != nil {
+		return errors.Wrapf(err, "cannot get properties for Azure blob, address: %s", srcName)
+	}
+	dstURL, err := getBlobURL(ctx, *b.config, b.credential, dstName)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get Azure blob URL, address: %s", dstName)
+	}
+
+	resp, err := dstURL.StartCopyFromURL(ctx, srcURL.URL(), blob.Metadata{}, blob.ModifiedAccessConditions{}, blob.BlobAccessConditions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot start copy of Azure blob, address: %s", srcName)
+	}
+
+	// Copy is asynchronous, although within the same storage account it usually finishes immediately.
+	status, description := resp.CopyStatus(), ""
+	for status == blob.CopyStatusPending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(copyStatusPollInterval):
+		}
+		props, err := dstURL.GetProperties(ctx, blob.BlobAccessConditions{})
+		if err != nil {
+			return errors.Wrapf(err, "cannot get properties for Azure blob, address: %s", dstName)
+		}
+		status, description = props.CopyStatus(), props.CopyStatusDescription()
+	}
+	if status != blob.CopyStatusSuccess {
+		return errors.Errorf("copy of Azure blob %s to %s finished with status %s: %s", srcName, dstName, status, description)
+	}
+	return nil
+}
+
 // Name returns Azure container name.
 func (b *Bucket) Name() string {
 	return b.config.ContainerName
@@ -16,6 +16,8 @@ func TestConfig_validate(t *testing.T) {
 		ContainerName      string
 		Endpoint           string
 		MaxRetries         int
+		UserAssignedID     string
+		WorkloadIdentity   WorkloadIdentityConfig
 	}
 	tests := []struct {
 		name         string
@@ -52,6 +54,56 @@ func TestConfig_validate(t *testing.T) {
 				StorageAccountKey:  "",
 				ContainerName:      "roo",
 			},
+			wantErr:      false,
+			wantEndpoint: azureDefaultEndpoint,
+		},
+		{
+			name: "user-assigned managed identity",
+			fields: fields{
+				StorageAccountName: "foo",
+				ContainerName:      "roo",
+				UserAssignedID:     "client-id",
+			},
+			wantErr:      false,
+			wantEndpoint: azureDefaultEndpoint,
+		},
+		{
+			name: "user-assigned managed identity with account key",
+			fields: fields{
+				StorageAccountName: "foo",
+				StorageAccountKey:  "bar",
+				ContainerName:      "roo",
+				UserAssignedID:     "client-id",
+			},
+			wantErr: true,
+		},
+		{
+			name: "workload identity",
+			fields: fields{
+				StorageAccountName: "foo",
+				ContainerName:      "roo",
+				WorkloadIdentity:   WorkloadIdentityConfig{ClientID: "client-id", TenantID: "tenant-id", TokenFile: "/var/run/token"},
+			},
+			wantErr:      false,
+			wantEndpoint: azureDefaultEndpoint,
+		},
+		{
+			name: "workload identity without tenant",
+			fields: fields{
+				StorageAccountName: "foo",
+				ContainerName:      "roo",
+				WorkloadIdentity:   WorkloadIdentityConfig{ClientID: "client-id", TokenFile: "/var/run/token"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "workload identity with user-assigned managed identity",
+			fields: fields{
+				StorageAccountName: "foo",
+				ContainerName:      "roo",
+				UserAssignedID:     "client-id",
+				WorkloadIdentity:   WorkloadIdentityConfig{ClientID: "client-id", TenantID: "tenant-id", TokenFile: "/var/run/token"},
+			},
 			wantErr: true,
 		},
 		{
@@ -92,6 +144,8 @@ func TestConfig_validate(t *testing.T) {
 				ContainerName:      tt.fields.ContainerName,
 				Endpoint:           tt.fields.Endpoint,
 				MaxRetries:         tt.fields.MaxRetries,
+				UserAssignedID:     tt.fields.UserAssignedID,
+				WorkloadIdentity:   tt.fields.WorkloadIdentity,
 			}
 			err := conf.validate()
 			if (err != nil) != tt.wantErr {
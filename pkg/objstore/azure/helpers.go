@@ -30,12 +30,7 @@ func init() {
 	pipeline.SetForceLogEnabled(false)
 }
 
-func getContainerURL(ctx context.Context, conf Config) (blob.ContainerURL, error) {
-	c, err := blob.NewSharedKeyCredential(conf.StorageAccountName, conf.StorageAccountKey)
-	if err != nil {
-		return blob.ContainerURL{}, err
-	}
-
+func getContainerURL(ctx context.Context, conf Config, credential blob.Credential) (blob.ContainerURL, error) {
 	retryOptions := blob.RetryOptions{
 		MaxTries: int32(conf.MaxRetries),
 	}
@@ -43,7 +38,7 @@ func getContainerURL(ctx context.Context, conf Config) (blob.ContainerURL, error
 		retryOptions.TryTimeout = time.Until(deadline)
 	}
 
-	p := blob.NewPipeline(c, blob.PipelineOptions{
+	p := blob.NewPipeline(credential, blob.PipelineOptions{
 		Retry:     retryOptions,
 		Telemetry: blob.TelemetryOptions{Value: "Thanos"},
 		RequestLog: blob.RequestLogOptions{
@@ -64,8 +59,8 @@ func getContainerURL(ctx context.Context, conf Config) (blob.ContainerURL, error
 	return service.NewContainerURL(conf.ContainerName), nil
 }
 
-func getContainer(ctx context.Context, conf Config) (blob.ContainerURL, error) {
-	c, err := getContainerURL(ctx, conf)
+func getContainer(ctx context.Context, conf Config, credential blob.Credential) (blob.ContainerURL, error) {
+	c, err := getContainerURL(ctx, conf, credential)
 	if err != nil {
 		return blob.ContainerURL{}, err
 	}
@@ -74,8 +69,8 @@ func getContainer(ctx context.Context, conf Config) (blob.ContainerURL, error) {
 	return c, err
 }
 
-func createContainer(ctx context.Context, conf Config) (blob.ContainerURL, error) {
-	c, err := getContainerURL(ctx, conf)
+func createContainer(ctx context.Context, conf Config, credential blob.Credential) (blob.ContainerURL, error) {
+	c, err := getContainerURL(ctx, conf, credential)
 	if err != nil {
 		return blob.ContainerURL{}, err
 	}
@@ -86,8 +81,8 @@ func createContainer(ctx context.Context, conf Config) (blob.ContainerURL, error
 	return c, err
 }
 
-func getBlobURL(ctx context.Context, conf Config, blobName string) (blob.BlockBlobURL, error) {
-	c, err := getContainerURL(ctx, conf)
+func getBlobURL(ctx context.Context, conf Config, credential blob.Credential, blobName string) (blob.BlockBlobURL, error) {
+	c, err := getContainerURL(ctx, conf, credential)
 	if err != nil {
 		return blob.BlockBlobURL{}, err
 	}
@@ -0,0 +1,811 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package b2 implements objstore.Bucket against the native Backblaze B2 API.
+package b2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+const DirDelim = "/"
+
+const (
+	defaultEndpoint = "https://api.backblazeb2.com"
+
+	// MinPartSize is the minimum size of the part of the large file allowed by B2.
+	MinPartSize = 5 * 1000 * 1000
+	// maxCopySize is the maximum size of the file which can be copied with a single b2_copy_file call.
+	maxCopySize = 5 * 1000 * 1000 * 1000
+	// maxFileCount is the maximum number of files returned by a single list call.
+	maxFileCount = 1000
+)
+
+// DefaultConfig for B2 bucket.
+var DefaultConfig = Config{
+	Endpoint: defaultEndpoint,
+	PartSize: 100 * 1000 * 1000,
+}
+
+// Config stores the configuration for B2 bucket.
+type Config struct {
+	Bucket string `yaml:"bucket"`
+	// Endpoint is the URL of the B2 API used for the account authorization.
+	Endpoint         string `yaml:"endpoint"`
+	ApplicationKeyID string `yaml:"application_key_id"`
+	ApplicationKey   string `yaml:"application_key"`
+	// PartSize is the size of the parts objects larger than it are uploaded in as large files.
+	PartSize int64 `yaml:"part_size"`
+}
+
+func (conf *Config) validate() error {
+	if conf.Bucket == "" || conf.ApplicationKeyID == "" || conf.ApplicationKey == "" {
+		return errors.New("insufficient b2 configuration information")
+	}
+	if conf.Endpoint == "" {
+		return errors.New("no b2 endpoint in config file")
+	}
+	if conf.PartSize < MinPartSize {
+		return errors.Errorf("part_size has to be at least %d bytes", MinPartSize)
+	}
+	return nil
+}
+
+// apiError is the error returned by B2 API.
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("b2: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+type authorization struct {
+	AccountID          string `json:"accountId"`
+	AuthorizationToken string `json:"authorizationToken"`
+	APIURL             string `json:"apiUrl"`
+	DownloadURL        string `json:"downloadUrl"`
+	Allowed            struct {
+		BucketID   string `json:"bucketId"`
+		BucketName string `json:"bucketName"`
+	} `json:"allowed"`
+}
+
+type file struct {
+	FileID          string `json:"fileId"`
+	FileName        string `json:"fileName"`
+	Action          string `json:"action"`
+	ContentLength   int64  `json:"contentLength"`
+	UploadTimestamp int64  `json:"uploadTimestamp"`
+}
+
+type listFilesRequest struct {
+	BucketID      string `json:"bucketId"`
+	StartFileName string `json:"startFileName,omitempty"`
+	StartFileID   string `json:"startFileId,omitempty"`
+	MaxFileCount  int    `json:"maxFileCount"`
+	Prefix        string `json:"prefix"`
+	Delimiter     string `json:"delimiter,omitempty"`
+}
+
+type listFilesResponse struct {
+	Files        []file  `json:"files"`
+	NextFileName *string `json:"nextFileName"`
+	NextFileID   *string `json:"nextFileId"`
+}
+
+type uploadURL struct {
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// Bucket implements the store.Bucket interface against the native Backblaze B2 API.
+type Bucket struct {
+	logger    log.Logger
+	name      string
+	config    Config
+	client    *http.Client
+	userAgent string
+
+	mtx      sync.RWMutex
+	auth     authorization
+	bucketID string
+
+	// partBuffers are the buffers of the content of unknown size, which has to be buffered as B2 needs the size
+	// of each upload upfront.
+	partBuffers sync.Pool
+}
+
+// NewBucket returns a new Bucket using the provided B2 config values.
+func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error) {
+	config, err := parseConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewBucketWithConfig(logger, config, component)
+}
+
+// NewBucketWithConfig returns a new Bucket using the provided B2 config struct.
+func NewBucketWithConfig(logger log.Logger, config Config, component string) (*Bucket, error) {
+	b, err := newBucket(logger, config, component)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.resolveBucketID(context.Background()); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func newBucket(logger log.Logger, config Config, component string) (*Bucket, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate b2 configuration")
+	}
+	b := &Bucket{
+		logger:    logger,
+		name:      config.Bucket,
+		config:    config,
+		client:    &http.Client{Transport: tracing.HTTPPropagationTripperware(http.DefaultTransport)},
+		userAgent: fmt.Sprintf("thanos-%s", component),
+	}
+	if err := b.authorize(context.Background()); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func parseConfig(conf []byte) (Config, error) {
+	config := DefaultConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return Config{}, errors.Wrap(err, "parsing b2 configuration")
+	}
+	return config, nil
+}
+
+// authorize obtains a new authorization token for the account.
+func (b *Bucket) authorize(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(b.config.Endpoint, "/")+"/b2api/v2/b2_authorize_account", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(b.config.ApplicationKeyID, b.config.ApplicationKey)
+
+	var auth authorization
+	if err := b.do(req, &auth); err != nil {
+		return errors.Wrap(err, "authorize b2 account")
+	}
+
+	b.mtx.Lock()
+	b.auth = auth
+	b.mtx.Unlock()
+	return nil
+}
+
+func (b *Bucket) authorization() authorization {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	return b.auth
+}
+
+func (b *Bucket) resolveBucketID(ctx context.Context) error {
+	auth := b.authorization()
+	// Application keys restricted to a single bucket are not allowed to list buckets.
+	if auth.Allowed.BucketID != "" && auth.Allowed.BucketName == b.name {
+		b.bucketID = auth.Allowed.BucketID
+		return nil
+	}
+
+	var resp struct {
+		Buckets []struct {
+			BucketID string `json:"bucketId"`
+		} `json:"buckets"`
+	}
+	if err := b.call(ctx, "b2_list_buckets", map[string]string{"accountId": auth.AccountID, "bucketName": b.name}, &resp); err != nil {
+		return errors.Wrapf(err, "find b2 bucket %s", b.name)
+	}
+	if len(resp.Buckets) == 0 {
+		return errors.Errorf("b2 bucket %s does not exist", b.name)
+	}
+	b.bucketID = resp.Buckets[0].BucketID
+	return nil
+}
+
+// do sends the request and decodes the JSON response into resp, if not nil.
+func (b *Bucket) do(req *http.Request, resp interface{}) error {
+	req.Header.Set("User-Agent", b.userAgent)
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(b.logger, res.Body, "b2 response")
+
+	if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	if resp == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(res.Body).Decode(resp), "decode b2 response")
+}
+
+func responseError(res *http.Response) error {
+	apiErr := &apiError{Status: res.StatusCode}
+	// Responses to HEAD requests have no body.
+	if res.Request.Method != http.MethodHead {
+		_ = json.NewDecoder(res.Body).Decode(apiErr)
+	}
+	if apiErr.Code == "" {
+		apiErr.Code = http.StatusText(res.StatusCode)
+	}
+	return apiErr
+}
+
+// isExpiredAuthErr returns true if the request was rejected because of the authorization token. Only wrong
+// credentials are reported with unauthorized code, responses to HEAD requests have no code at all.
+func isExpiredAuthErr(err error) bool {
+	apiErr, ok := errors.Cause(err).(*apiError)
+	return ok && apiErr.Status == http.StatusUnauthorized && apiErr.Code != "unauthorized"
+}
+
+// withReauth calls f with the current authorization, authorizing the account again and retrying once
+// if the authorization token expired.
+func (b *Bucket) withReauth(ctx context.Context, f func(auth authorization) error) error {
+	err := f(b.authorization())
+	if !isExpiredAuthErr(err) {
+		return err
+	}
+	if err := b.authorize(ctx); err != nil {
+		return err
+	}
+	return f(b.authorization())
+}
+
+// call invokes the B2 API operation with the JSON encoded request.
+func (b *Bucket) call(ctx context.Context, op string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return errors.Wrapf(err, "encode %s request", op)
+	}
+	return b.withReauth(ctx, func(auth authorization) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.APIURL+"/b2api/v2/"+op, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+		return b.do(req, response)
+	})
+}
+
+// download sends the request for the file with the given name and returns the response with unread body.
+func (b *Bucket) download(ctx context.Context, method, name, rangeHeader string) (*http.Response, error) {
+	var res *http.Response
+	err := b.withReauth(ctx, func(auth authorization) error {
+		req, err := http.NewRequestWithContext(ctx, method, auth.DownloadURL+"/file/"+escape(b.name)+"/"+escape(name), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", auth.AuthorizationToken)
+		req.Header.Set("User-Agent", b.userAgent)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		res, err = b.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+			defer runutil.ExhaustCloseWithLogOnErr(b.logger, res.Body, "b2 download response")
+			return responseError(res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// escape percent-encodes the file name as required by B2.
+func escape(name string) string {
+	var sb strings.Builder
+	for _, c := range []byte(name) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.IndexByte("-._~/", c) >= 0:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// Name returns the bucket name for B2.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes returned by the listing.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
+	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
+	// object itself as one prefix item.
+	if dir != "" {
+		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
+	}
+
+	req := listFilesRequest{BucketID: b.bucketID, MaxFileCount: maxFileCount, Prefix: dir, Delimiter: DirDelim}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var resp listFilesResponse
+		if err := b.call(ctx, "b2_list_file_names", req, &resp); err != nil {
+			return errors.Wrapf(err, "list b2 files in %s", dir)
+		}
+		for _, file := range resp.Files {
+			if file.FileName == dir {
+				continue
+			}
+			attrs := objstore.ObjectAttributes{}
+			if file.Action != "folder" {
+				attrs.Size = file.ContentLength
+				attrs.LastModified = timeFromMillis(file.UploadTimestamp)
+			}
+			if err := f(file.FileName, attrs); err != nil {
+				return err
+			}
+		}
+		if resp.NextFileName == nil {
+			return nil
+		}
+		req.StartFileName = *resp.NextFileName
+	}
+}
+
+func timeFromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// GetRange returns a new range reader for the given object name and range.
+func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if name == "" {
+		return nil, errors.New("object name is empty")
+	}
+	var rangeHeader string
+	if length != -1 {
+		rangeHeader = fmt.Sprintf("bytes=%d-%d", off, off+length-1)
+	} else if off > 0 {
+		rangeHeader = fmt.Sprintf("bytes=%d-", off)
+	}
+	res, err := b.download(ctx, http.MethodGet, name, rangeHeader)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// head returns the headers of the latest version of the given file.
+func (b *Bucket) head(ctx context.Context, name string) (http.Header, error) {
+	res, err := b.download(ctx, http.MethodHead, name, "")
+	if err != nil {
+		return nil, err
+	}
+	runutil.ExhaustCloseWithLogOnErr(b.logger, res.Body, "b2 head response")
+	return res.Header, nil
+}
+
+// Exists checks if the given object exists in the bucket.
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	if _, err := b.head(ctx, name); err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "stat b2 file %s", name)
+	}
+	return true, nil
+}
+
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	header, err := b.head(ctx, name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "parse content length of %s", name)
+	}
+	uploaded, err := strconv.ParseInt(header.Get("X-Bz-Upload-Timestamp"), 10, 64)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "parse upload timestamp of %s", name)
+	}
+	return objstore.ObjectAttributes{
+		Size:         size,
+		LastModified: timeFromMillis(uploaded),
+	}, nil
+}
+
+// Upload the contents of the reader as an object into the bucket.
+// Objects larger than the configured part size are uploaded as B2 large files.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	size, err := objstore.TryToGetSize(r)
+	if err != nil {
+		// Size is unknown, so read one byte more than a part to find out if the content fits into a single upload.
+		buf := b.getPartBuffer()
+		defer b.putPartBuffer(buf)
+		if *buf, err = readPart(r, (*buf)[:0], b.config.PartSize+1); err != nil {
+			return errors.Wrapf(err, "read %s", name)
+		}
+		if int64(len(*buf)) <= b.config.PartSize {
+			return b.uploadFile(ctx, name, bytes.NewReader(*buf), int64(len(*buf)))
+		}
+		return b.uploadLargeFile(ctx, name, io.MultiReader(bytes.NewReader(*buf), r), -1)
+	}
+	if size <= b.config.PartSize {
+		return b.uploadFile(ctx, name, r, size)
+	}
+	return b.uploadLargeFile(ctx, name, r, size)
+}
+
+func (b *Bucket) uploadFile(ctx context.Context, name string, r io.Reader, size int64) error {
+	var u uploadURL
+	if err := b.call(ctx, "b2_get_upload_url", map[string]string{"bucketId": b.bucketID}, &u); err != nil {
+		return errors.Wrap(err, "get b2 upload url")
+	}
+	if _, err := b.uploadContent(ctx, u, r, size, map[string]string{
+		"X-Bz-File-Name": escape(name),
+		"Content-Type":   "b2/x-auto",
+	}); err != nil {
+		return errors.Wrapf(err, "upload b2 file %s", name)
+	}
+	return nil
+}
+
+func (b *Bucket) uploadLargeFile(ctx context.Context, name string, r io.Reader, size int64) (err error) {
+	var started struct {
+		FileID string `json:"fileId"`
+	}
+	if err := b.call(ctx, "b2_start_large_file", map[string]string{
+		"bucketId":    b.bucketID,
+		"fileName":    name,
+		"contentType": "b2/x-auto",
+	}, &started); err != nil {
+		return errors.Wrapf(err, "start b2 large file %s", name)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Abandoned large files keep their parts stored, so make sure to cancel upload on failure.
+		if cerr := b.call(context.Background(), "b2_cancel_large_file", map[string]string{"fileId": started.FileID}, nil); cerr != nil {
+			err = errors.Wrapf(err, "cancel b2 large file %s failed: %v", name, cerr)
+		}
+	}()
+
+	var u uploadURL
+	if err := b.call(ctx, "b2_get_upload_part_url", map[string]string{"fileId": started.FileID}, &u); err != nil {
+		return errors.Wrap(err, "get b2 upload part url")
+	}
+
+	var (
+		sha1s []string
+		buf   *[]byte
+	)
+	if size < 0 {
+		buf = b.getPartBuffer()
+		defer b.putPartBuffer(buf)
+	}
+	for part := 1; ; part++ {
+		var (
+			partReader io.Reader
+			partSize   int64
+			last       bool
+		)
+		if size >= 0 {
+			partSize = b.config.PartSize
+			if remaining := size - int64(part-1)*b.config.PartSize; remaining <= partSize {
+				partSize, last = remaining, true
+			}
+			partReader = io.LimitReader(r, partSize)
+		} else {
+			if *buf, err = readPart(r, (*buf)[:0], b.config.PartSize); err != nil {
+				return errors.Wrapf(err, "read part %d of %s", part, name)
+			}
+			if len(*buf) == 0 {
+				break
+			}
+			partReader, partSize, last = bytes.NewReader(*buf), int64(len(*buf)), int64(len(*buf)) < b.config.PartSize
+		}
+
+		sum, err := b.uploadContent(ctx, u, partReader, partSize, map[string]string{
+			"X-Bz-Part-Number": strconv.Itoa(part),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "upload part %d of b2 large file %s", part, name)
+		}
+		sha1s = append(sha1s, sum)
+		if last {
+			break
+		}
+	}
+
+	if err := b.call(ctx, "b2_finish_large_file", map[string]interface{}{
+		"fileId":        started.FileID,
+		"partSha1Array": sha1s,
+	}, nil); err != nil {
+		return errors.Wrapf(err, "finish b2 large file %s", name)
+	}
+	return nil
+}
+
+func (b *Bucket) getPartBuffer() *[]byte {
+	if buf, ok := b.partBuffers.Get().(*[]byte); ok {
+		return buf
+	}
+	return new([]byte)
+}
+
+func (b *Bucket) putPartBuffer(buf *[]byte) {
+	b.partBuffers.Put(buf)
+}
+
+// readPart appends up to limit bytes from r to buf. The buffer grows with the content read, so small content does not
+// allocate the whole limit.
+func readPart(r io.Reader, buf []byte, limit int64) ([]byte, error) {
+	for int64(len(buf)) < limit {
+		if len(buf) == cap(buf) {
+			c := 2*int64(cap(buf)) + 512
+			if c > limit {
+				c = limit
+			}
+			grown := make([]byte, len(buf), c)
+			copy(grown, buf)
+			buf = grown
+		}
+		end := int64(cap(buf))
+		if end > limit {
+			end = limit
+		}
+		n, err := r.Read(buf[len(buf):end])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+// uploadContent uploads size bytes from r to the upload URL and returns their SHA1 checksum.
+// The checksum is computed while streaming and sent at the end of the body, so the content does not need to be buffered.
+func (b *Bucket) uploadContent(ctx context.Context, u uploadURL, r io.Reader, size int64, headers map[string]string) (string, error) {
+	h := sha1.New()
+	body := io.MultiReader(io.TeeReader(io.LimitReader(r, size), h), &checksumReader{h: h})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.UploadURL, body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size + sha1.Size*2
+	req.Header.Set("Authorization", u.AuthorizationToken)
+	req.Header.Set("X-Bz-Content-Sha1", "hex_digits_at_end")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if err := b.do(req, nil); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumReader returns the hex encoded checksum of the content written to h until then.
+type checksumReader struct {
+	h   hash.Hash
+	sum io.Reader
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	if c.sum == nil {
+		c.sum = strings.NewReader(hex.EncodeToString(c.h.Sum(nil)))
+	}
+	return c.sum.Read(p)
+}
+
+// Delete removes all versions of the object with the given name.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	versions, err := b.fileVersions(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return &apiError{Status: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("file not present: %s", name)}
+	}
+	for _, id := range versions {
+		if err := b.call(ctx, "b2_delete_file_version", map[string]string{"fileName": name, "fileId": id}, nil); err != nil {
+			return errors.Wrapf(err, "delete b2 file %s version %s", name, id)
+		}
+	}
+	return nil
+}
+
+// fileVersions returns IDs of all versions of the file with the given name.
+func (b *Bucket) fileVersions(ctx context.Context, name string) ([]string, error) {
+	var ids []string
+	req := listFilesRequest{BucketID: b.bucketID, StartFileName: name, MaxFileCount: maxFileCount, Prefix: name}
+	for {
+		var resp listFilesResponse
+		if err := b.call(ctx, "b2_list_file_versions", req, &resp); err != nil {
+			return nil, errors.Wrapf(err, "list b2 file versions of %s", name)
+		}
+		for _, f := range resp.Files {
+			if f.FileName == name {
+				ids = append(ids, f.FileID)
+			}
+		}
+		if resp.NextFileName == nil || *resp.NextFileName != name {
+			return ids, nil
+		}
+		req.StartFileName, req.StartFileID = *resp.NextFileName, *resp.NextFileID
+	}
+}
+
+// DeleteMultiple removes all objects with the given names.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	return objstore.DeleteMultipleConcurrently(ctx, b, names, objstore.DefaultDeleteConcurrency)
+}
+
+// Copy copies the object with srcName into the dstName using server side copy.
+// Objects too large to be copied with a single request are downloaded and uploaded again.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) error {
+	header, err := b.head(ctx, srcName)
+	if err != nil {
+		// Error is not wrapped, so it can be checked with IsObjNotFoundErr.
+		return err
+	}
+	if size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err != nil || size > maxCopySize {
+		rc, err := b.Get(ctx, srcName)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(b.logger, rc, "b2 copy source %s", srcName)
+		return b.Upload(ctx, dstName, rc)
+	}
+	if err := b.call(ctx, "b2_copy_file", map[string]string{
+		"sourceFileId":      header.Get("X-Bz-File-Id"),
+		"fileName":          dstName,
+		"metadataDirective": "COPY",
+	}, nil); err != nil {
+		return errors.Wrapf(err, "copy b2 file %s to %s", srcName, dstName)
+	}
+	return nil
+}
+
+// IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
+func (b *Bucket) IsObjNotFoundErr(err error) bool {
+	apiErr, ok := errors.Cause(err).(*apiError)
+	return ok && apiErr.Status == http.StatusNotFound
+}
+
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (b *Bucket) ErrStatusCode(err error) int {
+	if apiErr, ok := errors.Cause(err).(*apiError); ok {
+		return apiErr.Status
+	}
+	return 0
+}
+
+func (b *Bucket) Close() error { return nil }
+
+func configFromEnv() Config {
+	c := DefaultConfig
+	c.Bucket = os.Getenv("B2_BUCKET")
+	c.ApplicationKeyID = os.Getenv("B2_APPLICATION_KEY_ID")
+	c.ApplicationKey = os.Getenv("B2_APPLICATION_KEY")
+	if e := os.Getenv("B2_ENDPOINT"); e != "" {
+		c.Endpoint = e
+	}
+	return c
+}
+
+// NewTestBucket creates test bkt client that before returning creates temporary bucket.
+// In a close function it empties and deletes the bucket.
+func NewTestBucket(t testing.TB) (objstore.Bucket, func(), error) {
+	c := configFromEnv()
+	if c.ApplicationKeyID == "" || c.ApplicationKey == "" {
+		return nil, nil, errors.New("insufficient b2 test configuration information")
+	}
+
+	if c.Bucket != "" {
+		if os.Getenv("THANOS_ALLOW_EXISTING_BUCKET_USE") == "" {
+			return nil, nil, errors.New("B2_BUCKET is defined. Normally this tests will create temporary bucket " +
+				"and delete it after test. Unset B2_BUCKET env variable to use default logic. If you really want to run " +
+				"tests against provided (NOT USED!) bucket, set THANOS_ALLOW_EXISTING_BUCKET_USE=true. WARNING: That bucket " +
+				"needs to be manually cleared. This means that it is only useful to run one test in a time.")
+		}
+		b, err := NewBucketWithConfig(log.NewNopLogger(), c, "thanos-e2e-test")
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := b.Iter(context.Background(), "", func(f string) error {
+			return errors.Errorf("bucket %s is not empty", c.Bucket)
+		}); err != nil {
+			return nil, nil, errors.Wrapf(err, "b2 check bucket %s", c.Bucket)
+		}
+		t.Log("WARNING. Reusing", c.Bucket, "B2 bucket for B2 tests. Manual cleanup afterwards is required")
+		return b, func() {}, nil
+	}
+
+	// B2 bucket names are limited to 50 characters.
+	c.Bucket = objstore.CreateTemporaryTestBucketName(t)
+	if len(c.Bucket) > 50 {
+		c.Bucket = c.Bucket[:50]
+	}
+	b, err := newBucket(log.NewNopLogger(), c, "thanos-e2e-test")
+	if err != nil {
+		return nil, nil, err
+	}
+	var created struct {
+		BucketID string `json:"bucketId"`
+	}
+	if err := b.call(context.Background(), "b2_create_bucket", map[string]string{
+		"accountId":  b.authorization().AccountID,
+		"bucketName": c.Bucket,
+		"bucketType": "allPrivate",
+	}, &created); err != nil {
+		return nil, nil, errors.Wrapf(err, "create b2 bucket %s", c.Bucket)
+	}
+	b.bucketID = created.BucketID
+	t.Log("created temporary B2 bucket for B2 tests with name", c.Bucket)
+
+	return b, func() {
+		objstore.EmptyBucket(t, context.Background(), b)
+		if err := b.call(context.Background(), "b2_delete_bucket", map[string]string{
+			"accountId": b.authorization().AccountID,
+			"bucketId":  b.bucketID,
+		}, nil); err != nil {
+			t.Logf("deleting bucket %s failed: %s", c.Bucket, err)
+		}
+	}, nil
+}
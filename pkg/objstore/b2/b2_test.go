@@ -0,0 +1,366 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package b2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type fakeFile struct {
+	id       string
+	data     []byte
+	uploaded int64
+}
+
+// fakeB2 is a minimal in-memory implementation of the B2 API used by the Bucket.
+type fakeB2 struct {
+	t      *testing.T
+	srv    *httptest.Server
+	bucket string
+
+	mtx      sync.Mutex
+	token    string
+	files    map[string]*fakeFile
+	large    map[string]map[int][]byte
+	largeFor map[string]string
+	nextID   int
+	calls    map[string]int
+}
+
+func newFakeB2(t *testing.T, bucket string) *fakeB2 {
+	f := &fakeB2{
+		t:        t,
+		bucket:   bucket,
+		token:    "token-0",
+		files:    map[string]*fakeFile{},
+		large:    map[string]map[int][]byte{},
+		largeFor: map[string]string{},
+		calls:    map[string]int{},
+	}
+	f.srv = httptest.NewServer(f)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeB2) expireToken() {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.token = fmt.Sprintf("token-%d", f.nextID)
+	f.nextID++
+}
+
+func (f *fakeB2) newID() string {
+	f.nextID++
+	return fmt.Sprintf("id-%d", f.nextID)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiError{Status: status, Code: code, Message: code})
+}
+
+func (f *fakeB2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if r.URL.Path == "/b2api/v2/b2_authorize_account" {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "key-id" || pass != "key" {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		resp := authorization{AccountID: "account", AuthorizationToken: f.token, APIURL: f.srv.URL, DownloadURL: f.srv.URL}
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if r.Header.Get("Authorization") != f.token {
+		writeError(w, http.StatusUnauthorized, "expired_auth_token")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		f.download(w, r)
+		return
+	}
+
+	op := strings.TrimPrefix(r.URL.Path, "/b2api/v2/")
+	f.calls[op]++
+	switch op {
+	case "upload", "upload_part":
+		f.upload(w, r)
+		return
+	}
+
+	var req map[string]interface{}
+	testutil.Ok(f.t, json.NewDecoder(r.Body).Decode(&req))
+	str := func(k string) string {
+		s, _ := req[k].(string)
+		return s
+	}
+
+	var resp interface{} = map[string]string{}
+	switch op {
+	case "b2_list_buckets":
+		resp = map[string]interface{}{"buckets": []map[string]string{{"bucketId": "bucket-id"}}}
+	case "b2_list_file_names":
+		resp = f.list(str("prefix"), str("delimiter"), str("startFileName"))
+	case "b2_list_file_versions":
+		resp = f.list(str("prefix"), "", str("startFileName"))
+	case "b2_get_upload_url":
+		resp = uploadURL{UploadURL: f.srv.URL + "/b2api/v2/upload", AuthorizationToken: f.token}
+	case "b2_get_upload_part_url":
+		resp = uploadURL{UploadURL: f.srv.URL + "/b2api/v2/upload_part?fileId=" + str("fileId"), AuthorizationToken: f.token}
+	case "b2_start_large_file":
+		id := f.newID()
+		f.large[id] = map[int][]byte{}
+		f.largeFor[id] = str("fileName")
+		resp = map[string]string{"fileId": id}
+	case "b2_finish_large_file":
+		parts := f.large[str("fileId")]
+		var data []byte
+		for i := 1; i <= len(parts); i++ {
+			data = append(data, parts[i]...)
+		}
+		f.files[f.largeFor[str("fileId")]] = &fakeFile{id: str("fileId"), data: data, uploaded: time.Now().UnixNano() / 1e6}
+		delete(f.large, str("fileId"))
+	case "b2_cancel_large_file":
+		delete(f.large, str("fileId"))
+	case "b2_delete_file_version":
+		file, ok := f.files[str("fileName")]
+		if !ok || file.id != str("fileId") {
+			writeError(w, http.StatusBadRequest, "file_not_present")
+			return
+		}
+		delete(f.files, str("fileName"))
+	case "b2_copy_file":
+		for _, file := range f.files {
+			if file.id == str("sourceFileId") {
+				f.files[str("fileName")] = &fakeFile{id: f.newID(), data: file.data, uploaded: time.Now().UnixNano() / 1e6}
+			}
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported")
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// list returns up to two entries per page to exercise pagination.
+func (f *fakeB2) list(prefix, delimiter, start string) listFilesResponse {
+	var names []string
+	seen := map[string]bool{}
+	for name := range f.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				name = name[:len(prefix)+i+1]
+			}
+		}
+		if !seen[name] && name >= start {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	resp := listFilesResponse{Files: []file{}}
+	for i, name := range names {
+		if i == 2 {
+			resp.NextFileName = &names[i]
+			break
+		}
+		if file, ok := f.files[name]; ok {
+			resp.Files = append(resp.Files, uploadEntry(name, file))
+			continue
+		}
+		resp.Files = append(resp.Files, folderEntry(name))
+	}
+	return resp
+}
+
+func uploadEntry(name string, f *fakeFile) file {
+	return file{FileID: f.id, FileName: name, Action: "upload", ContentLength: int64(len(f.data)), UploadTimestamp: f.uploaded}
+}
+
+func folderEntry(name string) file {
+	return file{FileName: name, Action: "folder"}
+}
+
+func (f *fakeB2) upload(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	testutil.Ok(f.t, err)
+	testutil.Equals(f.t, "hex_digits_at_end", r.Header.Get("X-Bz-Content-Sha1"))
+	data, sum := body[:len(body)-40], body[len(body)-40:]
+	expected := sha1.Sum(data)
+	if hex.EncodeToString(expected[:]) != string(sum) {
+		writeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+
+	if id := r.URL.Query().Get("fileId"); id != "" {
+		part, err := strconv.Atoi(r.Header.Get("X-Bz-Part-Number"))
+		testutil.Ok(f.t, err)
+		f.large[id][part] = data
+	} else {
+		name, err := url.PathUnescape(r.Header.Get("X-Bz-File-Name"))
+		testutil.Ok(f.t, err)
+		f.files[name] = &fakeFile{id: f.newID(), data: data, uploaded: time.Now().UnixNano() / 1e6}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{})
+}
+
+func (f *fakeB2) download(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/file/"+f.bucket+"/")
+	file, ok := f.files[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found")
+		return
+	}
+	w.Header().Set("X-Bz-File-Id", file.id)
+	w.Header().Set("X-Bz-Upload-Timestamp", strconv.FormatInt(file.uploaded, 10))
+
+	data, status := file.data, http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		parts := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+		start, err := strconv.Atoi(parts[0])
+		testutil.Ok(f.t, err)
+		end := len(data) - 1
+		if parts[1] != "" {
+			end, err = strconv.Atoi(parts[1])
+			testutil.Ok(f.t, err)
+		}
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		if start > end {
+			data = nil
+		} else {
+			data = data[start : end+1]
+		}
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(data)
+	}
+}
+
+func newTestBucketWithFake(t *testing.T, partSize int64) (*Bucket, *fakeB2) {
+	fake := newFakeB2(t, "test-bucket")
+	conf := DefaultConfig
+	conf.Bucket = "test-bucket"
+	conf.Endpoint = fake.srv.URL
+	conf.ApplicationKeyID = "key-id"
+	conf.ApplicationKey = "key"
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), conf, "test")
+	testutil.Ok(t, err)
+	// Allow parts smaller than B2 limits, so large files can be tested cheaply.
+	bkt.config.PartSize = partSize
+	return bkt, fake
+}
+
+func TestBucket_AcceptanceWithFakeB2(t *testing.T) {
+	bkt, _ := newTestBucketWithFake(t, DefaultConfig.PartSize)
+	objstore.AcceptanceTest(t, bkt)
+}
+
+func TestBucket_LargeFiles(t *testing.T) {
+	ctx := context.Background()
+	bkt, fake := newTestBucketWithFake(t, 10)
+
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	for _, tcase := range []struct {
+		name   string
+		reader func() io.Reader
+	}{
+		{name: "known size", reader: func() io.Reader { return bytes.NewReader(data) }},
+		{name: "unknown size", reader: func() io.Reader { return ioutil.NopCloser(bytes.NewReader(data)) }},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			fake.calls = map[string]int{}
+			testutil.Ok(t, bkt.Upload(ctx, "large", tcase.reader()))
+			testutil.Equals(t, 1, fake.calls["b2_start_large_file"])
+			testutil.Equals(t, 4, fake.calls["upload_part"])
+			testutil.Equals(t, 1, fake.calls["b2_finish_large_file"])
+
+			rc, err := bkt.Get(ctx, "large")
+			testutil.Ok(t, err)
+			content, err := ioutil.ReadAll(rc)
+			testutil.Ok(t, err)
+			testutil.Ok(t, rc.Close())
+			testutil.Equals(t, data, content)
+		})
+	}
+
+	// Content fitting into a single part is uploaded as a regular file.
+	fake.calls = map[string]int{}
+	testutil.Ok(t, bkt.Upload(ctx, "small", ioutil.NopCloser(bytes.NewReader(data[:10]))))
+	testutil.Equals(t, 0, fake.calls["b2_start_large_file"])
+	testutil.Equals(t, 1, fake.calls["upload"])
+}
+
+func TestReadPart(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 10000)
+
+	// The buffer grows with the content, up to the limit.
+	buf, err := readPart(iotest.OneByteReader(bytes.NewReader(data[:10])), nil, 5000)
+	testutil.Ok(t, err)
+	testutil.Equals(t, data[:10], buf)
+	testutil.Assert(t, cap(buf) < 5000, "expected buffer of small content to be small, got capacity %d", cap(buf))
+
+	buf, err = readPart(bytes.NewReader(data), buf[:0], 5000)
+	testutil.Ok(t, err)
+	testutil.Equals(t, data[:5000], buf)
+	testutil.Equals(t, 5000, cap(buf))
+}
+
+func TestBucket_ReauthorizesOnExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	bkt, fake := newTestBucketWithFake(t, DefaultConfig.PartSize)
+
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("data")))
+	fake.expireToken()
+
+	ok, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+
+	fake.expireToken()
+	var names []string
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		names = append(names, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{"obj"}, names)
+}
+
+func TestEscape(t *testing.T) {
+	testutil.Equals(t, "dir/file-1_2.3~", escape("dir/file-1_2.3~"))
+	testutil.Equals(t, "a%20b%2Bc%3Fd", escape("a b+c?d"))
+}
@@ -14,11 +14,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/azure"
+	"github.com/thanos-io/thanos/pkg/objstore/b2"
 	"github.com/thanos-io/thanos/pkg/objstore/cos"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/thanos-io/thanos/pkg/objstore/gcs"
+	"github.com/thanos-io/thanos/pkg/objstore/hdfs"
 	"github.com/thanos-io/thanos/pkg/objstore/oss"
 	"github.com/thanos-io/thanos/pkg/objstore/s3"
+	"github.com/thanos-io/thanos/pkg/objstore/sftp"
 	"github.com/thanos-io/thanos/pkg/objstore/swift"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -33,16 +36,31 @@ const (
 	SWIFT      ObjProvider = "SWIFT"
 	COS        ObjProvider = "COS"
 	ALIYUNOSS  ObjProvider = "ALIYUNOSS"
+	B2         ObjProvider = "B2"
+	HDFS       ObjProvider = "HDFS"
+	SFTP       ObjProvider = "SFTP"
 )
 
 type BucketConfig struct {
 	Type   ObjProvider `yaml:"type"`
 	Config interface{} `yaml:"config"`
+	// Prefix is the key prefix all objects are stored under, so multiple installations can share one bucket.
+	Prefix string `yaml:"prefix"`
+	// RateLimits limits the rate of the operations on the bucket. Zero values mean no limit.
+	RateLimits objstore.RateLimitConfig `yaml:"rate_limits"`
+	// Retries configures the retries of the operations failing with transient errors. Disabled by default.
+	Retries objstore.RetryConfig `yaml:"retries"`
 }
 
 // NewBucket initializes and returns new object storage clients.
 // NOTE: confContentYaml can contain secrets.
 func NewBucket(logger log.Logger, confContentYaml []byte, reg prometheus.Registerer, component string) (objstore.InstrumentedBucket, error) {
+	return NewBucketWithFaults(logger, confContentYaml, reg, component, objstore.FaultConfig{})
+}
+
+// NewBucketWithFaults is like NewBucket, but injects the given faults into the operations on the object storage, for
+// testing only. The injected faults are retried like the failures of the provider.
+func NewBucketWithFaults(logger log.Logger, confContentYaml []byte, reg prometheus.Registerer, component string, faults objstore.FaultConfig) (objstore.InstrumentedBucket, error) {
 	level.Info(logger).Log("msg", "loading bucket configuration")
 	bucketConf := &BucketConfig{}
 	if err := yaml.UnmarshalStrict(confContentYaml, bucketConf); err != nil {
@@ -68,6 +86,12 @@ func NewBucket(logger log.Logger, confContentYaml []byte, reg prometheus.Registe
 		bucket, err = cos.NewBucket(logger, config, component)
 	case string(ALIYUNOSS):
 		bucket, err = oss.NewBucket(logger, config, component)
+	case string(B2):
+		bucket, err = b2.NewBucket(logger, config, component)
+	case string(HDFS):
+		bucket, err = hdfs.NewBucket(logger, config)
+	case string(SFTP):
+		bucket, err = sftp.NewBucket(logger, config)
 	case string(FILESYSTEM):
 		bucket, err = filesystem.NewBucketFromConfig(config)
 	default:
@@ -76,5 +100,20 @@ func NewBucket(logger log.Logger, confContentYaml []byte, reg prometheus.Registe
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("create %s client", bucketConf.Type))
 	}
+	// Faults are injected closest to the provider, so they are seen by the other wrappers as failures of the provider.
+	if faults != (objstore.FaultConfig{}) {
+		level.Warn(logger).Log("msg", "injecting faults into the operations on the bucket, this is meant for testing only")
+		bucket = objstore.NewFaultyBucket(bucket, faults)
+	}
+	if strings.Trim(bucketConf.Prefix, objstore.DirDelim) != "" {
+		bucket = objstore.NewPrefixedBucket(bucket, bucketConf.Prefix)
+	}
+	if bucketConf.RateLimits != (objstore.RateLimitConfig{}) {
+		bucket = objstore.NewRateLimitedBucket(bucket, bucketConf.RateLimits)
+	}
+	// Retries are rate limited too, so they do not add to the load of the struggling object storage.
+	if bucketConf.Retries.MaxAttempts > 1 {
+		bucket = objstore.NewRetryingBucket(bucket, bucketConf.Retries)
+	}
 	return objstore.NewTracingBucket(objstore.BucketWithMetrics(bucket.Name(), bucket, reg)), nil
 }
@@ -0,0 +1,670 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// CompressionAlgorithm is the algorithm the compressed bucket compresses objects with.
+type CompressionAlgorithm string
+
+const (
+	GzipCompression   CompressionAlgorithm = "gzip"
+	SnappyCompression CompressionAlgorithm = "snappy"
+	ZstdCompression   CompressionAlgorithm = "zstd"
+)
+
+const (
+	compressedMagic    = "TCMP"
+	compressedVersion1 = 1
+
+	// DefaultCompressionBlockSize is the default size of the content compressed separately.
+	DefaultCompressionBlockSize = 256 * 1024
+
+	// compressedHeaderSize is the size of the header holding magic, version, algorithm and block size.
+	compressedHeaderSize = len(compressedMagic) + 2 + 4
+	// compressedTrailerSize is the size of the trailer holding number of blocks, size of the content, block size, version,
+	// algorithm and magic.
+	compressedTrailerSize    = 4 + 8 + 4 + 2 + len(compressedMagic)
+	compressedIndexCacheSize = 1024
+
+	// maxZstdBlockSize is the maximum block size of objects compressed with zstd, bounding the memory used to
+	// decompress a block.
+	maxZstdBlockSize = 64 * 1024 * 1024
+)
+
+var compressionAlgorithmIDs = map[CompressionAlgorithm]byte{
+	GzipCompression:   1,
+	SnappyCompression: 2,
+	ZstdCompression:   3,
+}
+
+// CompressionConfig configures the compressed bucket.
+type CompressionConfig struct {
+	Algorithm CompressionAlgorithm
+	// BlockSize is the size of the content compressed separately. Range reads have to fetch and decompress all
+	// blocks the range overlaps, so smaller blocks make them cheaper at the cost of worse compression ratio.
+	// Defaults to DefaultCompressionBlockSize.
+	BlockSize int
+	// Skip returns true for objects which should be uploaded uncompressed, e.g. the ones read mostly with small
+	// range reads. Defaults to compressing all objects.
+	Skip func(name string) bool
+}
+
+// compressedBucket compresses objects on Upload and decompresses them on Get and GetRange.
+//
+// Compressed object starts with a header with the magic, the algorithm and the block size, followed by the content split into blocks
+// of the configured size compressed separately, each prefixed with its compressed length and terminated by an empty
+// length. At the end there is an index with offsets of all blocks and a fixed size trailer, so range reads can find
+// and decompress only the blocks the range overlaps. Objects without the header are read as they are.
+type compressedBucket struct {
+	Bucket
+
+	id        byte
+	blockSize int
+	skip      func(name string) bool
+
+	mtx     sync.Mutex
+	indexes *lru.LRU
+}
+
+// NewCompressedBucket returns a Bucket which transparently compresses objects uploaded to bkt and decompresses them
+// on read. Objects uploaded uncompressed, before the compression was enabled or excluded with CompressionConfig.Skip,
+// are still readable.
+// NOTE: Range reads and Attributes of compressed objects need to fetch the object index first, which is cached.
+// IterWithAttributes has to fetch attributes of each object separately.
+func NewCompressedBucket(bkt Bucket, conf CompressionConfig) (Bucket, error) {
+	id, ok := compressionAlgorithmIDs[conf.Algorithm]
+	if !ok {
+		return nil, errors.Errorf("unsupported compression algorithm %q", conf.Algorithm)
+	}
+	if conf.BlockSize == 0 {
+		conf.BlockSize = DefaultCompressionBlockSize
+	}
+	if conf.BlockSize < 0 {
+		return nil, errors.Errorf("invalid compression block size %d", conf.BlockSize)
+	}
+	if conf.Algorithm == ZstdCompression && conf.BlockSize > maxZstdBlockSize {
+		return nil, errors.Errorf("compression block size %d exceeds the maximum of %d bytes for zstd", conf.BlockSize, maxZstdBlockSize)
+	}
+	if conf.Skip == nil {
+		conf.Skip = func(string) bool { return false }
+	}
+	indexes, err := lru.NewLRU(compressedIndexCacheSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedBucket{Bucket: bkt, id: id, blockSize: conf.BlockSize, skip: conf.Skip, indexes: indexes}, nil
+}
+
+// Upload compresses the contents of the reader and uploads it as an object into the bucket.
+func (b *compressedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if b.skip(name) {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+	codec, err := newCompressionCodec(b.id, b.blockSize)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, compressedHeaderSize)
+	copy(header, compressedMagic)
+	header[len(compressedMagic)] = compressedVersion1
+	header[len(compressedMagic)+1] = b.id
+	binary.BigEndian.PutUint32(header[len(compressedMagic)+2:], uint32(b.blockSize))
+
+	return b.Bucket.Upload(ctx, name, &compressingReader{
+		r:         r,
+		codec:     codec,
+		id:        b.id,
+		blockSize: b.blockSize,
+		block:     make([]byte, b.blockSize),
+		buf:       header,
+		written:   int64(compressedHeaderSize),
+	})
+}
+
+// Get returns a reader decompressing the given object.
+func (b *compressedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(rc)
+	header, err := br.Peek(compressedHeaderSize)
+	if err != nil || string(header[:len(compressedMagic)]) != compressedMagic {
+		// Object is not compressed.
+		return &bufferedReadCloser{Reader: br, Closer: rc}, nil
+	}
+	if header[len(compressedMagic)] != compressedVersion1 {
+		_ = rc.Close()
+		return nil, errors.Errorf("unsupported compressed object version %d", header[len(compressedMagic)])
+	}
+	codec, err := newCompressionCodec(header[len(compressedMagic)+1], int(binary.BigEndian.Uint32(header[len(compressedMagic)+2:])))
+	if err != nil {
+		_ = rc.Close()
+		return nil, errors.Wrapf(err, "read header of %s", name)
+	}
+	if _, err := br.Discard(compressedHeaderSize); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return &decompressingReader{r: br, c: rc, codec: codec, blocks: -1, remaining: -1}, nil
+}
+
+// GetRange returns a reader decompressing the given range of the object. Only blocks overlapping with the range are fetched.
+func (b *compressedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if off < 0 {
+		return nil, errors.Errorf("invalid offset %d", off)
+	}
+	if length == 0 || length < -1 {
+		return nil, errors.Errorf("invalid length %d", length)
+	}
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := b.index(ctx, name, attrs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read index of %s", name)
+	}
+	if idx == nil {
+		return b.Bucket.GetRange(ctx, name, off, length)
+	}
+
+	if off >= idx.size {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if length == -1 || off+length > idx.size {
+		length = idx.size - off
+	}
+	bs := int64(idx.blockSize)
+	first, last := off/bs, (off+length-1)/bs
+	start, end := idx.offsets[first], idx.end
+	if last+1 < int64(len(idx.offsets)) {
+		end = idx.offsets[last+1]
+	}
+	rc, err := b.Bucket.GetRange(ctx, name, start, end-start)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := newCompressionCodec(idx.id, idx.blockSize)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return &decompressingReader{
+		r:         bufio.NewReader(rc),
+		c:         rc,
+		codec:     codec,
+		blocks:    last - first + 1,
+		skip:      off - first*bs,
+		remaining: length,
+	}, nil
+}
+
+// ErrStatusCode implements objstore.ErrStatusCodeResolver if the underlying bucket does.
+func (b *compressedBucket) ErrStatusCode(err error) int {
+	if r, ok := b.Bucket.(ErrStatusCodeResolver); ok {
+		return r.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it.
+func (b *compressedBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := b.Bucket.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, prefix, minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it.
+func (b *compressedBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	if r, ok := b.Bucket.(ExpirationRulesReader); ok {
+		return r.ExpirationRules(ctx)
+	}
+	return nil, ErrNotSupported
+}
+
+// Attributes returns information about the specified object, with the size of the decompressed content.
+func (b *compressedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	if err != nil {
+		return attrs, err
+	}
+	idx, err := b.index(ctx, name, attrs)
+	if err != nil {
+		return ObjectAttributes{}, errors.Wrapf(err, "read index of %s", name)
+	}
+	if idx != nil {
+		attrs.Size = idx.size
+	}
+	return attrs, nil
+}
+
+// IterWithAttributes calls f for each entry in the given directory, with the size of the decompressed content.
+func (b *compressedBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error) error {
+	return b.Bucket.IterWithAttributes(ctx, dir, func(name string, attrs ObjectAttributes) error {
+		if !strings.HasSuffix(name, DirDelim) {
+			var err error
+			if attrs, err = b.Attributes(ctx, name); err != nil {
+				return errors.Wrapf(err, "get attributes of %s", name)
+			}
+		}
+		return f(name, attrs)
+	})
+}
+
+type compressedIndexKey struct {
+	name  string
+	attrs ObjectAttributes
+}
+
+// compressedIndex locates the blocks of the compressed object.
+type compressedIndex struct {
+	id        byte
+	blockSize int
+	// size is the size of the decompressed content.
+	size int64
+	// offsets are the offsets of the blocks in the object, end is the offset where the last one ends.
+	offsets []int64
+	end     int64
+}
+
+// index returns the index of the compressed object with the given attributes, or nil if the object is not compressed.
+func (b *compressedBucket) index(ctx context.Context, name string, attrs ObjectAttributes) (*compressedIndex, error) {
+	// Attributes are part of the key, so the index of the overwritten object is not used.
+	key := compressedIndexKey{name: name, attrs: attrs}
+	b.mtx.Lock()
+	v, ok := b.indexes.Get(key)
+	b.mtx.Unlock()
+	if ok {
+		return v.(*compressedIndex), nil
+	}
+
+	idx, err := b.readIndex(ctx, name, attrs.Size)
+	if err != nil {
+		return nil, err
+	}
+	b.mtx.Lock()
+	b.indexes.Add(key, idx)
+	b.mtx.Unlock()
+	return idx, nil
+}
+
+func (b *compressedBucket) readIndex(ctx context.Context, name string, size int64) (*compressedIndex, error) {
+	if size < int64(compressedHeaderSize+4+compressedTrailerSize) {
+		return nil, nil
+	}
+	trailer, err := b.readRange(ctx, name, size-int64(compressedTrailerSize), int64(compressedTrailerSize))
+	if err != nil {
+		return nil, err
+	}
+	if string(trailer[compressedTrailerSize-len(compressedMagic):]) != compressedMagic {
+		return nil, nil
+	}
+	if v := trailer[16]; v != compressedVersion1 {
+		return nil, errors.Errorf("unsupported compressed object version %d", v)
+	}
+	idx := &compressedIndex{
+		id:        trailer[17],
+		blockSize: int(binary.BigEndian.Uint32(trailer[12:])),
+		size:      int64(binary.BigEndian.Uint64(trailer[4:])),
+		offsets:   make([]int64, binary.BigEndian.Uint32(trailer)),
+	}
+	indexSize := int64(len(idx.offsets)) * 8
+	indexOff := size - int64(compressedTrailerSize) - indexSize
+	if idx.blockSize <= 0 || indexOff < int64(compressedHeaderSize+4) {
+		return nil, errors.Errorf("malformed compressed object of %d bytes", size)
+	}
+	// Blocks are followed by the empty length terminating them.
+	idx.end = indexOff - 4
+	if len(idx.offsets) == 0 {
+		return idx, nil
+	}
+
+	index, err := b.readRange(ctx, name, indexOff, indexSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range idx.offsets {
+		idx.offsets[i] = int64(binary.BigEndian.Uint64(index[i*8:]))
+	}
+	return idx, nil
+}
+
+func (b *compressedBucket) readRange(ctx context.Context, name string, off, length int64) (_ []byte, err error) {
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rc.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// compressionCodec compresses and decompresses single blocks.
+type compressionCodec interface {
+	compress(dst, src []byte) ([]byte, error)
+	decompress(dst, src []byte) ([]byte, error)
+}
+
+// newCompressionCodec returns the codec of the algorithm with the given ID. Decompressed blocks larger than maxBlockSize
+// are rejected.
+func newCompressionCodec(id byte, maxBlockSize int) (compressionCodec, error) {
+	switch id {
+	case compressionAlgorithmIDs[GzipCompression]:
+		return &gzipCodec{maxBlockSize: maxBlockSize}, nil
+	case compressionAlgorithmIDs[SnappyCompression]:
+		return &snappyCodec{maxBlockSize: maxBlockSize}, nil
+	case compressionAlgorithmIDs[ZstdCompression]:
+		if maxBlockSize > maxZstdBlockSize {
+			return nil, errors.Errorf("invalid zstd block size %d", maxBlockSize)
+		}
+		return &zstdCodec{maxBlockSize: maxBlockSize}, nil
+	}
+	return nil, errors.Errorf("unknown compression algorithm %d", id)
+}
+
+type gzipCodec struct {
+	maxBlockSize int
+	w            *gzip.Writer
+	r            *gzip.Reader
+}
+
+func (c *gzipCodec) compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst[:0])
+	if c.w == nil {
+		c.w = gzip.NewWriter(buf)
+	} else {
+		c.w.Reset(buf)
+	}
+	if _, err := c.w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := c.w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCodec) decompress(dst, src []byte) ([]byte, error) {
+	var err error
+	if c.r == nil {
+		c.r, err = gzip.NewReader(bytes.NewReader(src))
+	} else {
+		err = c.r.Reset(bytes.NewReader(src))
+	}
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(dst[:0])
+	if _, err := buf.ReadFrom(io.LimitReader(c.r, int64(c.maxBlockSize)+1)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > c.maxBlockSize {
+		return nil, errors.New("decompressed block exceeds block size")
+	}
+	return buf.Bytes(), nil
+}
+
+type snappyCodec struct {
+	maxBlockSize int
+}
+
+func (c *snappyCodec) compress(dst, src []byte) ([]byte, error) {
+	return snappy.Encode(dst[:cap(dst)], src), nil
+}
+
+func (c *snappyCodec) decompress(dst, src []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > c.maxBlockSize {
+		return nil, errors.New("decompressed block exceeds block size")
+	}
+	return snappy.Decode(dst[:cap(dst)], src)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCoders returns the zstd encoder and decoder shared by all zstd codecs, as they are safe for concurrent use of
+// EncodeAll and DecodeAll and expensive to create.
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxZstdBlockSize))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+type zstdCodec struct {
+	maxBlockSize int
+}
+
+func (c *zstdCodec) compress(dst, src []byte) ([]byte, error) {
+	enc, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return enc.EncodeAll(src, dst[:0]), nil
+}
+
+func (c *zstdCodec) decompress(dst, src []byte) ([]byte, error) {
+	_, dec, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	block, err := dec.DecodeAll(src, dst[:0])
+	if err != nil {
+		return nil, err
+	}
+	if len(block) > c.maxBlockSize {
+		return nil, errors.New("decompressed block exceeds block size")
+	}
+	return block, nil
+}
+
+type compressingReader struct {
+	r         io.Reader
+	codec     compressionCodec
+	id        byte
+	blockSize int
+
+	block      []byte
+	compressed []byte
+	buf        []byte
+	offsets    []int64
+	written    int64
+	size       int64
+	eof, done  bool
+}
+
+func (r *compressingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *compressingReader) next() error {
+	if r.eof {
+		r.buf = r.footer()
+		r.done = true
+		return nil
+	}
+	n, err := io.ReadFull(r.r, r.block)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	r.eof = err != nil
+	if n == 0 {
+		return nil
+	}
+
+	compressed, cerr := r.codec.compress(r.compressed, r.block[:n])
+	if cerr != nil {
+		return errors.Wrap(cerr, "compress")
+	}
+	r.compressed = compressed
+
+	r.buf = make([]byte, 4, 4+len(compressed))
+	binary.BigEndian.PutUint32(r.buf, uint32(len(compressed)))
+	r.buf = append(r.buf, compressed...)
+	r.offsets = append(r.offsets, r.written)
+	r.written += int64(len(r.buf))
+	r.size += int64(n)
+	return nil
+}
+
+// footer returns the terminator of the blocks, followed by the index and the trailer.
+func (r *compressingReader) footer() []byte {
+	b := make([]byte, 4+len(r.offsets)*8+compressedTrailerSize)
+	idx := b[4:]
+	for i, off := range r.offsets {
+		binary.BigEndian.PutUint64(idx[i*8:], uint64(off))
+	}
+	trailer := idx[len(r.offsets)*8:]
+	binary.BigEndian.PutUint32(trailer, uint32(len(r.offsets)))
+	binary.BigEndian.PutUint64(trailer[4:], uint64(r.size))
+	binary.BigEndian.PutUint32(trailer[12:], uint32(r.blockSize))
+	trailer[16] = compressedVersion1
+	trailer[17] = r.id
+	copy(trailer[18:], compressedMagic)
+	return b
+}
+
+type decompressingReader struct {
+	r     *bufio.Reader
+	c     io.Closer
+	codec compressionCodec
+
+	// blocks is the number of blocks left to read, -1 if it has to be detected by reaching the terminator.
+	blocks int64
+	// skip is the number of decompressed bytes to drop from the first block.
+	skip int64
+	// remaining is the number of the decompressed bytes left to return, -1 if not limited.
+	remaining int64
+
+	buf        []byte
+	compressed []byte
+	block      []byte
+}
+
+func (r *decompressingReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	for len(r.buf) == 0 {
+		if r.blocks == 0 {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	if r.remaining >= 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	if r.remaining >= 0 {
+		r.remaining -= int64(n)
+	}
+	return n, nil
+}
+
+func (r *decompressingReader) next() error {
+	var l [4]byte
+	if _, err := io.ReadFull(r.r, l[:]); err != nil {
+		return errors.Wrap(noEOF(err), "read compressed block length")
+	}
+	n := binary.BigEndian.Uint32(l[:])
+	if n == 0 {
+		if r.blocks > 0 {
+			return errors.New("unexpected end of compressed blocks")
+		}
+		r.blocks = 0
+		return nil
+	}
+	if cap(r.compressed) < int(n) {
+		r.compressed = make([]byte, n)
+	}
+	r.compressed = r.compressed[:n]
+	if _, err := io.ReadFull(r.r, r.compressed); err != nil {
+		return errors.Wrap(noEOF(err), "read compressed block")
+	}
+	block, err := r.codec.decompress(r.block, r.compressed)
+	if err != nil {
+		return errors.Wrap(err, "decompress block")
+	}
+	r.block = block
+	if r.blocks > 0 {
+		r.blocks--
+	}
+
+	if r.skip > int64(len(block)) {
+		return errors.New("compressed block shorter than expected")
+	}
+	r.buf = block[r.skip:]
+	r.skip = 0
+	return nil
+}
+
+func (r *decompressingReader) Close() error {
+	return r.c.Close()
+}
+
+// noEOF returns io.ErrUnexpectedEOF instead of io.EOF, as the content ending in the middle of the compressed object
+// is not expected.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type bufferedReadCloser struct {
+	io.Reader
+	io.Closer
+}
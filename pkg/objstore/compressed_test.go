@@ -0,0 +1,201 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func newTestCompressedBucket(t *testing.T, bkt Bucket, algo CompressionAlgorithm, blockSize int) Bucket {
+	cbkt, err := NewCompressedBucket(bkt, CompressionConfig{Algorithm: algo, BlockSize: blockSize})
+	testutil.Ok(t, err)
+	return cbkt
+}
+
+func TestCompressedBucket_Acceptance(t *testing.T) {
+	for _, algo := range []CompressionAlgorithm{GzipCompression, SnappyCompression, ZstdCompression} {
+		t.Run(string(algo), func(t *testing.T) {
+			// Small blocks, so test objects span multiple of them.
+			AcceptanceTest(t, newTestCompressedBucket(t, NewInMemBucket(), algo, 4))
+		})
+	}
+}
+
+// rangeRecordingBucket records the lengths of the range reads.
+type rangeRecordingBucket struct {
+	Bucket
+	lengths []int64
+}
+
+func (b *rangeRecordingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.lengths = append(b.lengths, length)
+	return b.Bucket.GetRange(ctx, name, off, length)
+}
+
+func TestCompressedBucket_RangeReads(t *testing.T) {
+	ctx := context.Background()
+	const blockSize = 1024
+
+	for _, algo := range []CompressionAlgorithm{GzipCompression, SnappyCompression, ZstdCompression} {
+		for _, size := range []int{0, 1, blockSize - 1, blockSize, 3*blockSize + 123} {
+			t.Run(fmt.Sprintf("%s/%d", algo, size), func(t *testing.T) {
+				inmem := NewInMemBucket()
+				bkt := newTestCompressedBucket(t, inmem, algo, blockSize)
+
+				// Half random and half repeated content, so it is compressible.
+				data := make([]byte, size)
+				_, err := rand.Read(data[:size/2])
+				testutil.Ok(t, err)
+				testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(data)))
+
+				attrs, err := bkt.Attributes(ctx, "obj")
+				testutil.Ok(t, err)
+				testutil.Equals(t, int64(size), attrs.Size)
+
+				rc, err := bkt.Get(ctx, "obj")
+				testutil.Ok(t, err)
+				content, err := ioutil.ReadAll(rc)
+				testutil.Ok(t, err)
+				testutil.Ok(t, rc.Close())
+				testutil.Equals(t, data, content)
+
+				for _, r := range [][2]int64{
+					{0, -1},
+					{0, 1},
+					{1, blockSize},
+					{blockSize - 1, 2},
+					{blockSize, blockSize},
+					{2*blockSize + 5, 99999999},
+				} {
+					off, length := r[0], r[1]
+					rc, err := bkt.GetRange(ctx, "obj", off, length)
+					testutil.Ok(t, err)
+					content, err := ioutil.ReadAll(rc)
+					testutil.Ok(t, err)
+					testutil.Ok(t, rc.Close())
+
+					var expected []byte
+					if off < int64(size) {
+						end := int64(size)
+						if length != -1 && off+length < end {
+							end = off + length
+						}
+						expected = data[off:end]
+					}
+					testutil.Equals(t, len(expected), len(content), "range %v", r)
+					testutil.Assert(t, bytes.Equal(expected, content), "range %v: content mismatch", r)
+				}
+			})
+		}
+	}
+}
+
+func TestCompressedBucket_RangeReadsFetchOnlyOverlappingBlocks(t *testing.T) {
+	ctx := context.Background()
+	const blockSize = 1024
+	recording := &rangeRecordingBucket{Bucket: NewInMemBucket()}
+	bkt := newTestCompressedBucket(t, recording, SnappyCompression, blockSize)
+
+	data := make([]byte, 100*blockSize)
+	_, err := rand.Read(data)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(data)))
+
+	rc, err := bkt.GetRange(ctx, "obj", 10*blockSize+10, 20)
+	testutil.Ok(t, err)
+	content, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, data[10*blockSize+10:10*blockSize+30], content)
+
+	// Trailer, index and a single block.
+	testutil.Equals(t, 3, len(recording.lengths))
+	testutil.Equals(t, int64(compressedTrailerSize), recording.lengths[0])
+	testutil.Equals(t, int64(100*8), recording.lengths[1])
+	testutil.Assert(t, recording.lengths[2] < 2*blockSize, "expected single block to be fetched, got %d bytes", recording.lengths[2])
+
+	// Index is cached.
+	recording.lengths = nil
+	rc, err = bkt.GetRange(ctx, "obj", 0, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, 1, len(recording.lengths))
+}
+
+func TestCompressedBucket_UncompressedObjects(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	bkt, err := NewCompressedBucket(inmem, CompressionConfig{
+		Algorithm: GzipCompression,
+		Skip:      func(name string) bool { return strings.Contains(name, "/chunks/") },
+	})
+	testutil.Ok(t, err)
+
+	data := bytes.Repeat([]byte("metric{label=\"value\"}"), 1000)
+	testutil.Ok(t, bkt.Upload(ctx, "block/index", bytes.NewReader(data)))
+	testutil.Ok(t, bkt.Upload(ctx, "block/chunks/000001", bytes.NewReader(data)))
+	// Objects uploaded before the compression was enabled.
+	testutil.Ok(t, inmem.Upload(ctx, "block/meta.json", bytes.NewReader(data)))
+
+	testutil.Assert(t, len(inmem.Objects()["block/index"]) < len(data)/10, "expected index to be compressed")
+	testutil.Equals(t, data, inmem.Objects()["block/chunks/000001"])
+
+	for _, name := range []string{"block/index", "block/chunks/000001", "block/meta.json"} {
+		rc, err := bkt.Get(ctx, name)
+		testutil.Ok(t, err)
+		content, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, data, content, name)
+
+		rc, err = bkt.GetRange(ctx, name, 5, 100)
+		testutil.Ok(t, err)
+		content, err = ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, data[5:105], content, name)
+
+		attrs, err := bkt.Attributes(ctx, name)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(len(data)), attrs.Size, name)
+	}
+}
+
+func TestCompressedBucket_DetectsCorruption(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	bkt := newTestCompressedBucket(t, inmem, GzipCompression, 1024)
+
+	data := bytes.Repeat([]byte("a"), 2*1024+10)
+	testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(data)))
+	compressed := inmem.Objects()["obj"]
+
+	// Truncated in the middle of the blocks.
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(compressed[:compressedHeaderSize+10])))
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.NotOk(t, err)
+
+	// Modified block.
+	modified := append([]byte{}, compressed...)
+	modified[compressedHeaderSize+4+12] ^= 0xff
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(modified)))
+	rc, err = bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.NotOk(t, err)
+
+	_, err = NewCompressedBucket(inmem, CompressionConfig{Algorithm: "zip"})
+	testutil.NotOk(t, err)
+}
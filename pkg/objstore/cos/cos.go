@@ -19,6 +19,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/clientutil"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
 	"gopkg.in/yaml.v2"
 )
 
@@ -75,10 +76,10 @@ func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error
 	}
 
 	client := cos.NewClient(b, &http.Client{
-		Transport: &cos.AuthorizationTransport{
+		Transport: tracing.HTTPPropagationTripperware(&cos.AuthorizationTransport{
 			SecretID:  config.SecretId,
 			SecretKey: config.SecretKey,
-		},
+		}),
 	})
 
 	bkt := &Bucket{
@@ -135,9 +136,53 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
+// maxDeleteMultiObjects is the maximum number of objects removed in a single multi-object delete request.
+const maxDeleteMultiObjects = 1000
+
+// DeleteMultiple removes all objects with the given names using multi-object delete requests.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	for len(names) > 0 {
+		n := len(names)
+		if n > maxDeleteMultiObjects {
+			n = maxDeleteMultiObjects
+		}
+		opt := &cos.ObjectDeleteMultiOptions{Quiet: true}
+		for _, name := range names[:n] {
+			opt.Objects = append(opt.Objects, cos.Object{Key: name})
+		}
+		res, _, err := b.client.Object.DeleteMulti(ctx, opt)
+		if err != nil {
+			return errors.Wrap(err, "delete cos objects")
+		}
+		for _, e := range res.Errors {
+			if e.Code != "NoSuchKey" {
+				return errors.Errorf("delete cos object %s: %s", e.Key, e.Code)
+			}
+		}
+		names = names[n:]
+	}
+	return nil
+}
+
+// Copy copies the object with srcName into the dstName using server side copy.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) error {
+	sourceURL := fmt.Sprintf("%s/%s", b.client.BaseURL.BucketURL.Host, srcName)
+	// Error is not wrapped, so it can be checked with IsObjNotFoundErr.
+	_, _, err := b.client.Object.Copy(ctx, dstName, sourceURL, nil)
+	return err
+}
+
 // Iter calls f for each entry in the given directory (not recursive.). The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes returned by the listing.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, dirDelim) + dirDelim
 	}
@@ -149,7 +194,7 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		if object.key == "" {
 			continue
 		}
-		if err := f(object.key); err != nil {
+		if err := f(object.key, object.attrs); err != nil {
 			return err
 		}
 	}
@@ -217,11 +262,20 @@ func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	}
 }
 
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (b *Bucket) ErrStatusCode(err error) int {
+	if respErr, ok := errors.Cause(err).(*cos.ErrorResponse); ok && respErr.Response != nil {
+		return respErr.Response.StatusCode
+	}
+	return 0
+}
+
 func (b *Bucket) Close() error { return nil }
 
 type objectInfo struct {
-	key string
-	err error
+	key   string
+	attrs objstore.ObjectAttributes
+	err   error
 }
 
 func (b *Bucket) listObjects(ctx context.Context, objectPrefix string) <-chan objectInfo {
@@ -248,10 +302,16 @@ func (b *Bucket) listObjects(ctx context.Context, objectPrefix string) <-chan ob
 			}
 
 			for _, object := range result.Contents {
+				info := objectInfo{
+					key:   object.Key,
+					attrs: objstore.ObjectAttributes{Size: int64(object.Size)},
+				}
+				// tencent cos returns LastModified in ISO8601 format in the listing.
+				if info.attrs.LastModified, err = time.Parse(time.RFC3339, object.LastModified); err != nil {
+					info = objectInfo{err: errors.Wrapf(err, "parse last modified of %s", object.Key)}
+				}
 				select {
-				case objectsCh <- objectInfo{
-					key: object.Key,
-				}:
+				case objectsCh <- info:
 				case <-ctx.Done():
 					return
 				}
@@ -0,0 +1,601 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/pkg/errors"
+)
+
+const (
+	encryptedMagic     = "TENC"
+	encryptedVersion1  = 1
+	encryptedChunkSize = 64 * 1024
+	encryptedTagSize   = 16
+	dataKeySize        = 32
+
+	// MaxWrappedKeySize is the maximum size of the wrapped data key a KeyProvider can return.
+	MaxWrappedKeySize = 512
+
+	// encryptedHeaderSize is the size of the header stored at the beginning of each encrypted object. It is constant,
+	// so the size of the plaintext can be computed from the size of the object without reading it.
+	encryptedHeaderSize = len(encryptedMagic) + 1 + 2 + MaxWrappedKeySize
+	encryptedFrameSize  = encryptedChunkSize + encryptedTagSize
+
+	encryptedKeyCacheSize = 1024
+)
+
+// KeyProvider generates and unwraps the data keys used by the encrypted bucket. Each object is encrypted
+// with its own data key, which is stored in the wrapped form within the object (envelope encryption).
+type KeyProvider interface {
+	// GenerateDataKey returns a new random data key and its wrapped form.
+	GenerateDataKey(ctx context.Context) (key []byte, wrapped []byte, err error)
+
+	// UnwrapDataKey returns the data key from its wrapped form, as returned by GenerateDataKey.
+	UnwrapDataKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// staticKeyProvider wraps data keys with AES-GCM using a fixed master key.
+type staticKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// NewStaticKeyProvider returns a KeyProvider which wraps data keys with the given AES master key.
+// The master key has to be 16, 24 or 32 bytes long.
+func NewStaticKeyProvider(masterKey []byte) (KeyProvider, error) {
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "create master key cipher")
+	}
+	return &staticKeyProvider{aead: aead}, nil
+}
+
+func (p *staticKeyProvider) GenerateDataKey(_ context.Context) ([]byte, []byte, error) {
+	key := make([]byte, dataKeySize)
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, errors.Wrap(err, "generate data key")
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, errors.Wrap(err, "generate nonce")
+	}
+	return key, p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (p *staticKeyProvider) UnwrapDataKey(_ context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < p.aead.NonceSize() {
+		return nil, errors.New("wrapped data key too short")
+	}
+	n := p.aead.NonceSize()
+	key, err := p.aead.Open(nil, wrapped[:n], wrapped[n:], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrap data key")
+	}
+	return key, nil
+}
+
+// encryptedBucket encrypts objects on Upload and decrypts them on Get and GetRange.
+//
+// Object is stored as a fixed size header holding the wrapped data key, followed by the content split
+// into chunks of encryptedChunkSize encrypted separately with AES-GCM. Each chunk is authenticated with its
+// index and with the information whether it is the last one, so chunks cannot be reordered and object cannot be
+// truncated unnoticed. Thanks to the chunked framing, range reads only need to fetch and decrypt the chunks the
+// range overlaps.
+type encryptedBucket struct {
+	Bucket
+
+	keys KeyProvider
+
+	mtx sync.Mutex
+	// objects caches the data keys and the sizes of the recently read objects, so range reads of the same object
+	// only have to fetch its chunks.
+	objects *lru.LRU
+}
+
+// NewEncryptedBucket returns a Bucket which transparently encrypts objects uploaded to bkt and decrypts them on read
+// using client side envelope encryption with the data keys from the given KeyProvider.
+// NOTE: All objects in the bucket are expected to be uploaded through the encrypted bucket.
+func NewEncryptedBucket(bkt Bucket, keys KeyProvider) Bucket {
+	objects, _ := lru.NewLRU(encryptedKeyCacheSize, nil)
+	return &encryptedBucket{Bucket: bkt, keys: keys, objects: objects}
+}
+
+// encryptedObject is the data key and the size of an encrypted object.
+type encryptedObject struct {
+	aead cipher.AEAD
+	// size is the size of the encrypted object.
+	size int64
+}
+
+// Upload encrypts the contents of the reader and uploads it as an object into the bucket.
+func (b *encryptedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	key, wrapped, err := b.keys.GenerateDataKey(ctx)
+	if err != nil {
+		return errors.Wrap(err, "generate data key")
+	}
+	if len(wrapped) > MaxWrappedKeySize {
+		return errors.Errorf("wrapped data key of %d bytes exceeds the maximum of %d bytes", len(wrapped), MaxWrappedKeySize)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return errors.Wrap(err, "create data key cipher")
+	}
+
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedMagic)
+	header[len(encryptedMagic)] = encryptedVersion1
+	binary.BigEndian.PutUint16(header[len(encryptedMagic)+1:], uint16(len(wrapped)))
+	copy(header[len(encryptedMagic)+3:], wrapped)
+
+	size, err := TryToGetSize(r)
+	if err != nil {
+		size = -1
+	}
+	b.forget(name)
+	return b.Bucket.Upload(ctx, name, &encryptingReader{
+		r:     bufio.NewReaderSize(r, encryptedChunkSize),
+		size:  size,
+		aead:  aead,
+		buf:   header,
+		chunk: make([]byte, encryptedChunkSize),
+		frame: make([]byte, 0, encryptedFrameSize),
+	})
+}
+
+// Delete removes the object with the given name.
+func (b *encryptedBucket) Delete(ctx context.Context, name string) error {
+	b.forget(name)
+	return b.Bucket.Delete(ctx, name)
+}
+
+// DeleteMultiple removes the objects with the given names.
+func (b *encryptedBucket) DeleteMultiple(ctx context.Context, names []string) error {
+	for _, name := range names {
+		b.forget(name)
+	}
+	return b.Bucket.DeleteMultiple(ctx, names)
+}
+
+func (b *encryptedBucket) forget(name string) {
+	b.mtx.Lock()
+	b.objects.Remove(name)
+	b.mtx.Unlock()
+}
+
+// Get returns a reader decrypting the given object.
+func (b *encryptedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := b.readHeader(ctx, rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, errors.Wrapf(err, "read header of %s", name)
+	}
+	return newDecryptingReader(rc, aead, 0, -1, 0, -1), nil
+}
+
+// GetRange returns a reader decrypting the given range of the object. Only chunks overlapping with the range are fetched.
+// The data keys and sizes of the objects are cached, so range reads of recently read objects take a single request.
+func (b *encryptedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if off < 0 {
+		return nil, errors.Errorf("invalid offset %d", off)
+	}
+	if length == 0 || length < -1 {
+		return nil, errors.Errorf("invalid length %d", length)
+	}
+
+	b.mtx.Lock()
+	v, ok := b.objects.Get(name)
+	b.mtx.Unlock()
+	if ok {
+		obj := v.(*encryptedObject)
+		// The object might have been overwritten by another writer since it was cached, in which case its chunks fail
+		// to decrypt with the cached data key, or the range is beyond the cached size.
+		if size, err := plaintextSize(obj.size); err == nil && off < size {
+			rc, err := b.getChunks(ctx, name, obj, off, length, nil)
+			if err == nil {
+				return rc, nil
+			}
+			if !isDecryptErr(err) {
+				return nil, err
+			}
+		}
+		b.forget(name)
+	}
+
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	size, err := plaintextSize(attrs.Size)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get size of %s", name)
+	}
+	if off >= size {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	var (
+		obj = &encryptedObject{size: attrs.Size}
+		hrc io.ReadCloser
+	)
+	if off < encryptedChunkSize {
+		// The range starts in the first chunk, so the header is fetched with the chunks in a single request.
+		rc, err := b.getChunks(ctx, name, obj, off, length, func(r io.Reader) (cipher.AEAD, error) {
+			return b.readHeader(ctx, r)
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.remember(name, obj)
+		return rc, nil
+	}
+
+	hrc, err = b.Bucket.GetRange(ctx, name, 0, int64(encryptedHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	obj.aead, err = b.readHeader(ctx, hrc)
+	if cerr := hrc.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read header of %s", name)
+	}
+	rc, err := b.getChunks(ctx, name, obj, off, length, nil)
+	if err != nil {
+		return nil, err
+	}
+	b.remember(name, obj)
+	return rc, nil
+}
+
+func (b *encryptedBucket) remember(name string, obj *encryptedObject) {
+	b.mtx.Lock()
+	b.objects.Add(name, obj)
+	b.mtx.Unlock()
+}
+
+// getChunks returns a reader decrypting the given range of the object from the chunks the range overlaps. If readHeader
+// is given, the header is fetched along with the chunks, and the data key it returns is set to the object.
+// The first chunk is decrypted before returning, so a wrong data key is reported right away.
+func (b *encryptedBucket) getChunks(ctx context.Context, name string, obj *encryptedObject, off, length int64, readHeader func(io.Reader) (cipher.AEAD, error)) (io.ReadCloser, error) {
+	size, err := plaintextSize(obj.size)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get size of %s", name)
+	}
+	if length == -1 || off+length > size {
+		length = size - off
+	}
+
+	firstChunk, lastChunk := off/encryptedChunkSize, (off+length-1)/encryptedChunkSize
+	encOff := int64(encryptedHeaderSize) + firstChunk*encryptedFrameSize
+	encLen := (lastChunk - firstChunk + 1) * encryptedFrameSize
+	if encOff+encLen > obj.size {
+		encLen = obj.size - encOff
+	}
+	if readHeader != nil {
+		encLen += encOff
+		encOff = 0
+	}
+	rc, err := b.Bucket.GetRange(ctx, name, encOff, encLen)
+	if err != nil {
+		return nil, err
+	}
+	if readHeader != nil {
+		if obj.aead, err = readHeader(rc); err != nil {
+			_ = rc.Close()
+			return nil, errors.Wrapf(err, "read header of %s", name)
+		}
+	}
+	dr := newDecryptingReader(rc, obj.aead, firstChunk, chunksCount(size)-1, off-firstChunk*encryptedChunkSize, length)
+	if err := dr.next(); err != nil {
+		_ = rc.Close()
+		return nil, errors.Wrapf(err, "read %s", name)
+	}
+	return dr, nil
+}
+
+// ErrStatusCode implements objstore.ErrStatusCodeResolver if the underlying bucket does.
+func (b *encryptedBucket) ErrStatusCode(err error) int {
+	if r, ok := b.Bucket.(ErrStatusCodeResolver); ok {
+		return r.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it.
+func (b *encryptedBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := b.Bucket.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, prefix, minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it.
+func (b *encryptedBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	if r, ok := b.Bucket.(ExpirationRulesReader); ok {
+		return r.ExpirationRules(ctx)
+	}
+	return nil, ErrNotSupported
+}
+
+// Attributes returns information about the specified object, with the size of the decrypted content.
+func (b *encryptedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	if err != nil {
+		return attrs, err
+	}
+	if attrs.Size, err = plaintextSize(attrs.Size); err != nil {
+		return ObjectAttributes{}, errors.Wrapf(err, "get size of %s", name)
+	}
+	return attrs, nil
+}
+
+// IterWithAttributes calls f for each entry in the given directory, with the size of the decrypted content.
+func (b *encryptedBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error) error {
+	return b.Bucket.IterWithAttributes(ctx, dir, func(name string, attrs ObjectAttributes) error {
+		if !strings.HasSuffix(name, DirDelim) {
+			var err error
+			if attrs.Size, err = plaintextSize(attrs.Size); err != nil {
+				return errors.Wrapf(err, "get size of %s", name)
+			}
+		}
+		return f(name, attrs)
+	})
+}
+
+func (b *encryptedBucket) readHeader(ctx context.Context, r io.Reader) (cipher.AEAD, error) {
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, errors.New("not an encrypted object")
+	}
+	if v := header[len(encryptedMagic)]; v != encryptedVersion1 {
+		return nil, errors.Errorf("unsupported encrypted object version %d", v)
+	}
+	keyLen := int(binary.BigEndian.Uint16(header[len(encryptedMagic)+1:]))
+	if keyLen > MaxWrappedKeySize {
+		return nil, errors.Errorf("invalid wrapped data key size %d", keyLen)
+	}
+	key, err := b.keys.UnwrapDataKey(ctx, header[len(encryptedMagic)+3:len(encryptedMagic)+3+keyLen])
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrap data key")
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for the chunk with the given index. Data keys are never reused across objects,
+// so the nonce only has to be unique within the object.
+func chunkNonce(idx int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, uint64(idx))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// plaintextSize returns the size of the decrypted content of the encrypted object with the given size.
+func plaintextSize(size int64) (int64, error) {
+	body := size - int64(encryptedHeaderSize)
+	if body < encryptedTagSize {
+		return 0, errors.Errorf("encrypted object too small: %d bytes", size)
+	}
+	full, rem := body/encryptedFrameSize, body%encryptedFrameSize
+	if rem == 0 {
+		return full * encryptedChunkSize, nil
+	}
+	if rem < encryptedTagSize {
+		return 0, errors.Errorf("malformed encrypted object of %d bytes", size)
+	}
+	return full*encryptedChunkSize + rem - encryptedTagSize, nil
+}
+
+// encryptedSize returns the size of the encrypted object with content of the given size.
+func encryptedSize(size int64) int64 {
+	return int64(encryptedHeaderSize) + size + chunksCount(size)*encryptedTagSize
+}
+
+// chunksCount returns number of chunks the content of given size is encrypted into. Empty content is stored as single empty chunk.
+func chunksCount(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + encryptedChunkSize - 1) / encryptedChunkSize
+}
+
+type encryptingReader struct {
+	r *bufio.Reader
+	// size is the size of the content, -1 if unknown.
+	size  int64
+	aead  cipher.AEAD
+	idx   int64
+	done  bool
+	buf   []byte
+	chunk []byte
+	frame []byte
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// ObjectSize implements objstore.ObjectSizer, so the size of the encrypted object is known upfront if the size of the
+// content is.
+func (r *encryptingReader) ObjectSize() (int64, error) {
+	if r.size < 0 {
+		return 0, errors.New("unknown size of the content")
+	}
+	return encryptedSize(r.size), nil
+}
+
+func (r *encryptingReader) next() error {
+	n, err := io.ReadFull(r.r, r.chunk)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err != nil
+	if !last {
+		// Peek to find out if this is the last chunk, so it can be marked as such.
+		if _, err := r.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	r.buf = r.aead.Seal(r.frame[:0], chunkNonce(r.idx, last), r.chunk[:n], nil)
+	r.idx++
+	r.done = last
+	return nil
+}
+
+type decryptingReader struct {
+	rc   io.ReadCloser
+	r    *bufio.Reader
+	aead cipher.AEAD
+
+	idx int64
+	// lastChunk is the index of the last chunk of the object, -1 if it has to be detected by reaching the end of the reader.
+	lastChunk int64
+	// skip is the number of decrypted bytes to drop from the first chunk.
+	skip int64
+	// remaining is the number of the decrypted bytes left to return, -1 if not limited.
+	remaining int64
+
+	done  bool
+	buf   []byte
+	frame []byte
+	chunk []byte
+}
+
+func newDecryptingReader(rc io.ReadCloser, aead cipher.AEAD, firstChunk, lastChunk, skip, length int64) *decryptingReader {
+	return &decryptingReader{
+		rc:        rc,
+		r:         bufio.NewReaderSize(rc, encryptedFrameSize),
+		aead:      aead,
+		idx:       firstChunk,
+		lastChunk: lastChunk,
+		skip:      skip,
+		remaining: length,
+		frame:     make([]byte, encryptedFrameSize),
+		chunk:     make([]byte, 0, encryptedChunkSize),
+	}
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	if r.remaining >= 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	if r.remaining >= 0 {
+		r.remaining -= int64(n)
+	}
+	return n, nil
+}
+
+func (r *decryptingReader) next() error {
+	n, err := io.ReadFull(r.r, r.frame)
+	if err == io.EOF {
+		return errors.Errorf("unexpected end of encrypted object before chunk %d", r.idx)
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := r.idx == r.lastChunk
+	if r.lastChunk < 0 {
+		last = err != nil
+		if !last {
+			if _, err := r.r.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	chunk, err := r.aead.Open(r.chunk[:0], chunkNonce(r.idx, last), r.frame[:n], nil)
+	if err != nil {
+		return decryptErr{idx: r.idx, err: err}
+	}
+	if r.skip > 0 {
+		if r.skip > int64(len(chunk)) {
+			return errors.Errorf("chunk %d is shorter than expected", r.idx)
+		}
+		chunk = chunk[r.skip:]
+		r.skip = 0
+	}
+	r.buf = chunk
+	r.idx++
+	r.done = last
+	return nil
+}
+
+// decryptErr is returned if a chunk fails to decrypt, because of a wrong data key or tampered content.
+type decryptErr struct {
+	idx int64
+	err error
+}
+
+func (e decryptErr) Error() string {
+	return fmt.Sprintf("decrypt chunk %d: %s", e.idx, e.err)
+}
+
+func isDecryptErr(err error) bool {
+	_, ok := errors.Cause(err).(decryptErr)
+	return ok
+}
+
+func (r *decryptingReader) Close() error {
+	return r.rc.Close()
+}
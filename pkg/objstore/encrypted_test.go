@@ -0,0 +1,166 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func newTestKeyProvider(t *testing.T) KeyProvider {
+	kp, err := NewStaticKeyProvider(bytes.Repeat([]byte{1}, 32))
+	testutil.Ok(t, err)
+	return kp
+}
+
+func TestEncryptedBucket_Acceptance(t *testing.T) {
+	AcceptanceTest(t, NewEncryptedBucket(NewInMemBucket(), newTestKeyProvider(t)))
+}
+
+func TestEncryptedBucket_RangeReads(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	bkt := NewEncryptedBucket(inmem, newTestKeyProvider(t))
+
+	for _, size := range []int{0, 1, encryptedChunkSize - 1, encryptedChunkSize, 3*encryptedChunkSize + 123} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(data)))
+
+		// Content must not be stored in plain text. Short content can appear in the ciphertext by chance.
+		if size >= 16 {
+			testutil.Assert(t, !bytes.Contains(inmem.Objects()["obj"], data), "expected content to be encrypted")
+		}
+
+		attrs, err := bkt.Attributes(ctx, "obj")
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(size), attrs.Size)
+
+		rc, err := bkt.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		content, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Equals(t, data, content)
+
+		for _, r := range [][2]int64{
+			{0, -1},
+			{0, 1},
+			{1, encryptedChunkSize},
+			{encryptedChunkSize - 1, 2},
+			{encryptedChunkSize, encryptedChunkSize},
+			{2*encryptedChunkSize + 5, 99999999},
+		} {
+			off, length := r[0], r[1]
+			rc, err := bkt.GetRange(ctx, "obj", off, length)
+			testutil.Ok(t, err)
+			content, err := ioutil.ReadAll(rc)
+			testutil.Ok(t, err)
+			testutil.Ok(t, rc.Close())
+
+			var expected []byte
+			if off < int64(size) {
+				end := int64(size)
+				if length != -1 && off+length < end {
+					end = off + length
+				}
+				expected = data[off:end]
+			}
+			testutil.Equals(t, len(expected), len(content), "size %d range %v", size, r)
+			testutil.Assert(t, bytes.Equal(expected, content), "size %d range %v: content mismatch", size, r)
+		}
+	}
+}
+
+func TestEncryptedBucket_DetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	bkt := NewEncryptedBucket(inmem, newTestKeyProvider(t))
+
+	data := bytes.Repeat([]byte("a"), 2*encryptedChunkSize+10)
+	testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(data)))
+	enc := inmem.Objects()["obj"]
+
+	// Truncated at the chunk boundary.
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(enc[:encryptedHeaderSize+encryptedFrameSize])))
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.NotOk(t, err)
+
+	// Modified content.
+	modified := append([]byte{}, enc...)
+	modified[len(modified)-20] ^= 1
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(modified)))
+	// The first chunk of the range is decrypted right away.
+	_, err = bkt.GetRange(ctx, "obj", 2*encryptedChunkSize, 10)
+	testutil.NotOk(t, err)
+
+	// Different master key.
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(enc)))
+	otherKeys, err := NewStaticKeyProvider(bytes.Repeat([]byte{2}, 32))
+	testutil.Ok(t, err)
+	_, err = NewEncryptedBucket(inmem, otherKeys).Get(ctx, "obj")
+	testutil.NotOk(t, err)
+}
+
+type getRangeCountingBucket struct {
+	Bucket
+	getRanges, attributes int
+}
+
+func (b *getRangeCountingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.getRanges++
+	return b.Bucket.GetRange(ctx, name, off, length)
+}
+
+func (b *getRangeCountingBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	b.attributes++
+	return b.Bucket.Attributes(ctx, name)
+}
+
+func TestEncryptedBucket_CachedDataKeys(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	counting := &getRangeCountingBucket{Bucket: inmem}
+	bkt := NewEncryptedBucket(counting, newTestKeyProvider(t))
+
+	data := bytes.Repeat([]byte("a"), 3*encryptedChunkSize)
+	r := &encryptingReader{size: int64(len(data))}
+	testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(data)))
+	size, err := r.ObjectSize()
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(len(inmem.Objects()["obj"])), size)
+
+	read := func(off, length int64) []byte {
+		rc, err := bkt.GetRange(ctx, "obj", off, length)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, rc.Close()) }()
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		return b
+	}
+
+	// The first read of the object fetches its attributes and header, next ones only the chunks.
+	testutil.Equals(t, data[2*encryptedChunkSize:2*encryptedChunkSize+10], read(2*encryptedChunkSize, 10))
+	testutil.Equals(t, 1, counting.attributes)
+	testutil.Equals(t, 2, counting.getRanges)
+	testutil.Equals(t, data[encryptedChunkSize:encryptedChunkSize+10], read(encryptedChunkSize, 10))
+	testutil.Equals(t, 1, counting.attributes)
+	testutil.Equals(t, 3, counting.getRanges)
+
+	// Objects overwritten by other writers are not decrypted with the cached data key.
+	other := NewEncryptedBucket(inmem, newTestKeyProvider(t))
+	data = bytes.Repeat([]byte("b"), 3*encryptedChunkSize)
+	testutil.Ok(t, other.Upload(ctx, "obj", bytes.NewReader(data)))
+	testutil.Equals(t, data[encryptedChunkSize:encryptedChunkSize+10], read(encryptedChunkSize, 10))
+	testutil.Equals(t, 2, counting.attributes)
+}
@@ -0,0 +1,275 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// FaultConfig configures the faults injected into the operations on the faulty bucket per operation type, to test
+// the retries, timeouts and error handling of the components against an unreliable object storage.
+// NOTE: Meant for testing only, e.g. in e2e tests.
+type FaultConfig struct {
+	// Get applies to Get, GetRange, Exists and Attributes operations.
+	Get OperationFaults `yaml:"get"`
+	// Iter applies to Iter and IterWithAttributes operations.
+	Iter OperationFaults `yaml:"iter"`
+	// Upload applies to Upload and Copy operations.
+	Upload OperationFaults `yaml:"upload"`
+	// Delete applies to Delete and DeleteMultiple operations.
+	Delete OperationFaults `yaml:"delete"`
+}
+
+// ParseFaultConfig parses the YAML of a FaultConfig. Empty content disables the faults.
+func ParseFaultConfig(contentYaml []byte) (FaultConfig, error) {
+	var conf FaultConfig
+	if err := yaml.UnmarshalStrict(contentYaml, &conf); err != nil {
+		return FaultConfig{}, errors.Wrap(err, "parsing fault configuration")
+	}
+	return conf, nil
+}
+
+// OperationFaults configures the faults injected into a single operation type. Rates are probabilities from 0 to 1.
+// Zero values disable the faults.
+type OperationFaults struct {
+	// ErrorRate is the rate of operations failing with a 500 status code.
+	ErrorRate float64 `yaml:"error_rate"`
+	// ThrottleRate is the rate of operations rejected with a 503 status code, as by providers asking to slow down.
+	ThrottleRate float64 `yaml:"throttle_rate"`
+	// PartialReadRate is the rate of reads of the objects failing with io.ErrUnexpectedEOF after a part of the
+	// object is read. Only relevant for Get operations.
+	PartialReadRate float64 `yaml:"partial_read_rate"`
+	// Latency is the delay added before each operation. Operations time out if their context is done before.
+	Latency model.Duration `yaml:"latency"`
+}
+
+// FaultError is an error injected by the faulty bucket, failing an operation with the given HTTP status code.
+type FaultError struct {
+	Op         string
+	StatusCode int
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("injected fault in %s operation: %d %s", e.Op, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// FaultyBucket injects errors, throttling responses, partial reads and latency into the operations on the wrapped
+// bucket as configured.
+type FaultyBucket struct {
+	bkt Bucket
+
+	get, iter, upload, del OperationFaults
+
+	mtx sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewFaultyBucket returns a bucket, which injects the configured faults into the operations on bkt. Faults are
+// injected before the operations are passed to bkt, so failed operations have no effect.
+func NewFaultyBucket(bkt Bucket, conf FaultConfig) *FaultyBucket {
+	return &FaultyBucket{
+		bkt:    bkt,
+		get:    conf.Get,
+		iter:   conf.Iter,
+		upload: conf.Upload,
+		del:    conf.Delete,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *FaultyBucket) happens(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.rnd.Float64() < rate
+}
+
+func (b *FaultyBucket) intn(n int) int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.rnd.Intn(n)
+}
+
+// inject waits for the latency of the operation and returns the injected error, if any.
+func (b *FaultyBucket) inject(ctx context.Context, op string, f OperationFaults) error {
+	if f.Latency > 0 {
+		t := time.NewTimer(time.Duration(f.Latency))
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if b.happens(f.ThrottleRate) {
+		return &FaultError{Op: op, StatusCode: http.StatusServiceUnavailable}
+	}
+	if b.happens(f.ErrorRate) {
+		return &FaultError{Op: op, StatusCode: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+func (b *FaultyBucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	if err := b.inject(ctx, OpIter, b.iter); err != nil {
+		return err
+	}
+	return b.bkt.Iter(ctx, dir, f)
+}
+
+func (b *FaultyBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error) error {
+	if err := b.inject(ctx, OpIter, b.iter); err != nil {
+		return err
+	}
+	return b.bkt.IterWithAttributes(ctx, dir, f)
+}
+
+func (b *FaultyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.inject(ctx, OpGet, b.get); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return b.readCloser(rc), nil
+}
+
+func (b *FaultyBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if err := b.inject(ctx, OpGetRange, b.get); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return b.readCloser(rc), nil
+}
+
+func (b *FaultyBucket) readCloser(rc io.ReadCloser) io.ReadCloser {
+	if !b.happens(b.get.PartialReadRate) {
+		return rc
+	}
+	return &partialReadCloser{ReadCloser: rc, bkt: b}
+}
+
+func (b *FaultyBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.inject(ctx, OpExists, b.get); err != nil {
+		return false, err
+	}
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *FaultyBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	if err := b.inject(ctx, OpAttributes, b.get); err != nil {
+		return ObjectAttributes{}, err
+	}
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *FaultyBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.inject(ctx, OpUpload, b.upload); err != nil {
+		return err
+	}
+	return b.bkt.Upload(ctx, name, r)
+}
+
+func (b *FaultyBucket) Copy(ctx context.Context, srcName, dstName string) error {
+	if err := b.inject(ctx, OpCopy, b.upload); err != nil {
+		return err
+	}
+	return b.bkt.Copy(ctx, srcName, dstName)
+}
+
+func (b *FaultyBucket) Delete(ctx context.Context, name string) error {
+	if err := b.inject(ctx, OpDelete, b.del); err != nil {
+		return err
+	}
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *FaultyBucket) DeleteMultiple(ctx context.Context, names []string) error {
+	if err := b.inject(ctx, OpDeleteMultiple, b.del); err != nil {
+		return err
+	}
+	return b.bkt.DeleteMultiple(ctx, names)
+}
+
+func (b *FaultyBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+// ErrStatusCode implements objstore.ErrStatusCodeResolver, resolving the status codes of the injected errors and
+// of the errors of the underlying bucket if it does.
+func (b *FaultyBucket) ErrStatusCode(err error) int {
+	var ferr *FaultError
+	if errors.As(err, &ferr) {
+		return ferr.StatusCode
+	}
+	if r, ok := b.bkt.(ErrStatusCodeResolver); ok {
+		return r.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it.
+func (b *FaultyBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := b.bkt.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, prefix, minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it.
+func (b *FaultyBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	if r, ok := b.bkt.(ExpirationRulesReader); ok {
+		return r.ExpirationRules(ctx)
+	}
+	return nil, ErrNotSupported
+}
+
+func (b *FaultyBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *FaultyBucket) Name() string {
+	return b.bkt.Name()
+}
+
+// partialReadCloser returns a part of the first read of the object and fails with io.ErrUnexpectedEOF, as when the
+// connection breaks in the middle of the download.
+type partialReadCloser struct {
+	io.ReadCloser
+	bkt    *FaultyBucket
+	failed bool
+}
+
+func (r *partialReadCloser) Read(p []byte) (int, error) {
+	if r.failed {
+		return 0, io.ErrUnexpectedEOF
+	}
+	r.failed = true
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		n = r.bkt.intn(n)
+	}
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	return n, io.ErrUnexpectedEOF
+}
@@ -0,0 +1,127 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestFaultyBucket_Acceptance(t *testing.T) {
+	AcceptanceTest(t, NewFaultyBucket(NewInMemBucket(), FaultConfig{}))
+}
+
+func TestFaultyBucket_Errors(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	bkt := NewFaultyBucket(inmem, FaultConfig{
+		Get:    OperationFaults{ThrottleRate: 1},
+		Upload: OperationFaults{ErrorRate: 1},
+	})
+
+	err := bkt.Upload(ctx, "obj", bytes.NewReader([]byte("data")))
+	testutil.NotOk(t, err)
+	testutil.Equals(t, FailureServerError, FailureReason(err, bkt))
+	testutil.Assert(t, IsRetryableErr(err, bkt), "server errors should be retryable")
+	testutil.Equals(t, 0, len(inmem.Objects()))
+
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader([]byte("data"))))
+	_, err = bkt.Get(ctx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, FailureThrottled, FailureReason(errors.Wrap(err, "get"), bkt))
+	_, err = bkt.Exists(ctx, "obj")
+	testutil.NotOk(t, err)
+
+	// Other operations are not affected.
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+	testutil.Ok(t, bkt.Delete(ctx, "obj"))
+}
+
+func TestFaultyBucket_PartialReads(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	data := bytes.Repeat([]byte("a"), 1024)
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(data)))
+
+	bkt := NewFaultyBucket(inmem, FaultConfig{Get: OperationFaults{PartialReadRate: 1}})
+	for _, tcase := range []struct {
+		get  func() (io.ReadCloser, error)
+		size int
+	}{
+		{get: func() (io.ReadCloser, error) { return bkt.Get(ctx, "obj") }, size: len(data)},
+		{get: func() (io.ReadCloser, error) { return bkt.GetRange(ctx, "obj", 10, 500) }, size: 500},
+	} {
+		rc, err := tcase.get()
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Equals(t, io.ErrUnexpectedEOF, err)
+		testutil.Assert(t, len(b) < tcase.size, "expected partial read, got %d bytes", len(b))
+		testutil.Ok(t, rc.Close())
+	}
+}
+
+func TestFaultyBucket_Latency(t *testing.T) {
+	bkt := NewFaultyBucket(NewInMemBucket(), FaultConfig{Iter: OperationFaults{Latency: model.Duration(100 * time.Millisecond)}})
+
+	start := time.Now()
+	testutil.Ok(t, bkt.Iter(context.Background(), "", func(string) error { return nil }))
+	testutil.Assert(t, time.Since(start) >= 100*time.Millisecond, "expected iter to be delayed, took %v", time.Since(start))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := bkt.Iter(ctx, "", func(string) error { return nil })
+	testutil.NotOk(t, err)
+	testutil.Equals(t, FailureTimeout, FailureReason(err, bkt))
+}
+
+func TestFaultyBucket_Retries(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	data := bytes.Repeat([]byte("abcd"), 1024)
+	testutil.Ok(t, inmem.Upload(ctx, "obj", bytes.NewReader(data)))
+
+	// Faults are overcome by the retries, with the reads resumed after the partial reads.
+	bkt := NewRetryingBucket(NewFaultyBucket(inmem, FaultConfig{
+		Get: OperationFaults{ErrorRate: 0.3, ThrottleRate: 0.3, PartialReadRate: 0.5},
+	}), RetryConfig{MaxAttempts: 100, MinBackoff: model.Duration(time.Microsecond), MaxBackoff: model.Duration(time.Millisecond)})
+	for i := 0; i < 10; i++ {
+		rc, err := bkt.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Equals(t, data, b)
+		testutil.Ok(t, rc.Close())
+	}
+}
+
+func TestParseFaultConfig(t *testing.T) {
+	conf, err := ParseFaultConfig([]byte(`
+get:
+  error_rate: 0.1
+  latency: 200ms
+upload:
+  throttle_rate: 0.5
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, FaultConfig{
+		Get:    OperationFaults{ErrorRate: 0.1, Latency: model.Duration(200 * time.Millisecond)},
+		Upload: OperationFaults{ThrottleRate: 0.5},
+	}, conf)
+
+	conf, err = ParseFaultConfig(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, FaultConfig{}, conf)
+
+	_, err = ParseFaultConfig([]byte(`list: {}`))
+	testutil.NotOk(t, err)
+}
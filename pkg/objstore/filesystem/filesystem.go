@@ -5,11 +5,14 @@ package filesystem
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"gopkg.in/yaml.v2"
@@ -19,16 +22,23 @@ import (
 	"github.com/pkg/errors"
 )
 
+// tmpSuffix is the suffix of the files uploads are written to before being renamed to the object name.
+const tmpSuffix = ".thanos-tmp"
+
 // Config stores the configuration for storing and accessing blobs in filesystem.
 type Config struct {
 	Directory string `yaml:"directory"`
+	// FsyncParentDirectory makes uploads also fsync the directories whose entries were changed, so uploaded
+	// objects survive crashes of the node, at the cost of slower uploads.
+	FsyncParentDirectory bool `yaml:"fsync_parent_directory"`
 }
 
 // Bucket implements the objstore.Bucket interfaces against filesystem that binary runs on.
 // Methods from Bucket interface are thread-safe. Objects are assumed to be immutable.
 // NOTE: It does not follow symbolic links.
 type Bucket struct {
-	rootDir string
+	rootDir        string
+	fsyncParentDir bool
 }
 
 // NewBucketFromConfig returns a new filesystem.Bucket from config.
@@ -40,21 +50,34 @@ func NewBucketFromConfig(conf []byte) (*Bucket, error) {
 	if c.Directory == "" {
 		return nil, errors.New("missing directory for filesystem bucket")
 	}
-	return NewBucket(c.Directory)
+	return NewBucketWithConfig(c)
 }
 
 // NewBucket returns a new filesystem.Bucket.
 func NewBucket(rootDir string) (*Bucket, error) {
-	absDir, err := filepath.Abs(rootDir)
+	return NewBucketWithConfig(Config{Directory: rootDir})
+}
+
+// NewBucketWithConfig returns a new filesystem.Bucket from config.
+func NewBucketWithConfig(conf Config) (*Bucket, error) {
+	absDir, err := filepath.Abs(conf.Directory)
 	if err != nil {
 		return nil, err
 	}
-	return &Bucket{rootDir: absDir}, nil
+	return &Bucket{rootDir: absDir, fsyncParentDir: conf.FsyncParentDirectory}, nil
 }
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the attributes of the files. Directories have empty attributes.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
 	absDir := filepath.Join(b.rootDir, dir)
 	info, err := os.Stat(absDir)
 	if err != nil {
@@ -72,7 +95,12 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		return err
 	}
 	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), tmpSuffix) {
+			// Skip in progress uploads.
+			continue
+		}
 		name := filepath.Join(dir, file.Name())
+		attrs := objstore.ObjectAttributes{Size: file.Size(), LastModified: file.ModTime()}
 
 		if file.IsDir() {
 			empty, err := isDirEmpty(filepath.Join(absDir, file.Name()))
@@ -85,8 +113,9 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 				continue
 			}
 			name += objstore.DirDelim
+			attrs = objstore.ObjectAttributes{}
 		}
-		if err := f(name); err != nil {
+		if err := f(name, attrs); err != nil {
 			return err
 		}
 	}
@@ -164,22 +193,94 @@ func (b *Bucket) Exists(_ context.Context, name string) (bool, error) {
 }
 
 // Upload writes the file specified in src to into the memory.
+// The content is written to a temporary file which is fsynced and renamed to the object name, so that the object
+// is never seen partially written.
 func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) (err error) {
 	file := filepath.Join(b.rootDir, name)
-	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+	dir := filepath.Dir(file)
+
+	// Directories up to the first existing one have to be synced once created.
+	existingDir := dir
+	for {
+		if _, err := os.Stat(existingDir); err == nil || filepath.Dir(existingDir) == existingDir {
+			break
+		}
+		existingDir = filepath.Dir(existingDir)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return err
 	}
 
-	f, err := os.Create(file)
-	if err != nil {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
 		return err
 	}
-	defer runutil.CloseWithErrCapture(&err, f, "close")
+	f, err := os.OpenFile(filepath.Join(dir, "."+filepath.Base(file)+"."+hex.EncodeToString(suffix[:])+tmpSuffix), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "create temporary file for %s", file)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
 
 	if _, err := io.Copy(f, r); err != nil {
-		return errors.Wrapf(err, "copy to %s", file)
+		_ = f.Close()
+		return errors.Wrapf(err, "copy to %s", f.Name())
 	}
-	return nil
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "fsync %s", f.Name())
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "close %s", f.Name())
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		return errors.Wrapf(err, "rename %s to %s", f.Name(), file)
+	}
+
+	if !b.fsyncParentDir {
+		return nil
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if err := fsyncDir(d); err != nil {
+			return err
+		}
+		if d == existingDir {
+			return nil
+		}
+	}
+}
+
+func fsyncDir(dir string) (err error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", dir)
+	}
+	defer runutil.CloseWithErrCapture(&err, f, "close dir")
+
+	return errors.Wrapf(f.Sync(), "fsync %s", dir)
+}
+
+// Copy copies the file with srcName into the dstName.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) (err error) {
+	src := filepath.Join(b.rootDir, srcName)
+	info, err := os.Stat(src)
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", src)
+	}
+	if info.IsDir() {
+		return errors.Errorf("%s is a directory", src)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", src)
+	}
+	defer runutil.CloseWithErrCapture(&err, f, "close")
+
+	return b.Upload(ctx, dstName, f)
 }
 
 func isDirEmpty(name string) (ok bool, err error) {
@@ -214,6 +315,12 @@ func (b *Bucket) Delete(_ context.Context, name string) error {
 	return nil
 }
 
+// DeleteMultiple removes all files with the given names.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	// Delete cleans up empty parent directories, so run sequentially to not race on them.
+	return objstore.DeleteMultipleConcurrently(ctx, b, names, 1)
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	return os.IsNotExist(errors.Cause(err))
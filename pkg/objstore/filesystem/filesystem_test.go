@@ -0,0 +1,77 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestBucket_Acceptance(t *testing.T) {
+	for _, fsync := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "filesystem-bucket")
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+		bkt, err := NewBucketWithConfig(Config{Directory: dir, FsyncParentDirectory: fsync})
+		testutil.Ok(t, err)
+		objstore.AcceptanceTest(t, bkt)
+	}
+}
+
+type failingReader struct {
+	r io.Reader
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestBucket_UploadIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "filesystem-bucket")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt, err := NewBucketWithConfig(Config{Directory: dir, FsyncParentDirectory: true})
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "block/meta.json", strings.NewReader(`{"version":1}`)))
+
+	// Failed upload keeps the previous content and leaves no temporary files behind.
+	testutil.NotOk(t, bkt.Upload(ctx, "block/meta.json", failingReader{r: strings.NewReader(`{"vers`)}))
+	rc, err := bkt.Get(ctx, "block/meta.json")
+	testutil.Ok(t, err)
+	content, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, `{"version":1}`, string(content))
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "block"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(files))
+
+	// Upload in progress is not listed.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "block", ".index.0123"+tmpSuffix), bytes.Repeat([]byte("a"), 10), 0666))
+	var names []string
+	testutil.Ok(t, bkt.Iter(ctx, "block/", func(name string) error {
+		names = append(names, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{"block/meta.json"}, names)
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"runtime"
 	"strings"
 	"testing"
@@ -18,6 +19,7 @@ import (
 	"github.com/prometheus/common/version"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"gopkg.in/yaml.v2"
@@ -87,6 +89,14 @@ func (b *Bucket) Name() string {
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes returned by the listing.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
@@ -109,7 +119,10 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		if err != nil {
 			return err
 		}
-		if err := f(attrs.Prefix + attrs.Name); err != nil {
+		if err := f(attrs.Prefix+attrs.Name, objstore.ObjectAttributes{
+			Size:         attrs.Size,
+			LastModified: attrs.Updated,
+		}); err != nil {
 			return err
 		}
 	}
@@ -169,11 +182,37 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 	return b.bkt.Object(name).Delete(ctx)
 }
 
+// DeleteMultiple removes all objects with the given names. GCS client does not support batch requests,
+// so objects are deleted concurrently.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	return objstore.DeleteMultipleConcurrently(ctx, b, names, objstore.DefaultDeleteConcurrency)
+}
+
+// Copy copies the object with srcName into the dstName using server side rewrite.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) error {
+	_, err := b.bkt.Object(dstName).CopierFrom(b.bkt.Object(srcName)).Run(ctx)
+	// Unlike reads, rewrites of missing objects fail with the API error.
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return storage.ErrObjectNotExist
+	}
+	return err
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	return err == storage.ErrObjectNotExist
 }
 
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (b *Bucket) ErrStatusCode(err error) int {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
 func (b *Bucket) Close() error {
 	return b.closer.Close()
 }
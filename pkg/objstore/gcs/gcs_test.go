@@ -0,0 +1,36 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package gcs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-kit/kit/log"
+	"google.golang.org/api/option"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestBucket_Copy_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "No such object: test/src"}}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	testutil.Ok(t, err)
+	b := &Bucket{logger: log.NewNopLogger(), bkt: client.Bucket("test"), closer: client, name: "test"}
+	defer func() { testutil.Ok(t, b.Close()) }()
+
+	err = b.Copy(ctx, "src", "dst")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, b.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+}
@@ -0,0 +1,621 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package hdfs implements objstore.Bucket against HDFS using the WebHDFS REST API, served either
+// by the NameNode itself or by an HttpFS gateway.
+package hdfs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/jcmturner/gokrb5/v8/client"
+	krb5config "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+const DirDelim = "/"
+
+const (
+	// tokenReloadInterval is how often the delegation token file is read again, so renewed tokens are picked up.
+	tokenReloadInterval = time.Minute
+	// tmpSuffix is the suffix of the files objects are written to before being renamed to their final name.
+	tmpSuffix = ".thanos-tmp"
+)
+
+// DefaultConfig for HDFS bucket.
+var DefaultConfig = Config{
+	RootDir: "/thanos",
+	Kerberos: KerberosConfig{
+		Krb5ConfigFile: "/etc/krb5.conf",
+	},
+}
+
+// Config stores the configuration for HDFS bucket.
+type Config struct {
+	// Endpoint is the URL of the NameNode HTTP server or the HttpFS gateway, e.g. http://namenode:9870.
+	Endpoint string `yaml:"endpoint"`
+	// RootDir is the absolute HDFS path of the directory objects are stored in.
+	RootDir string `yaml:"root_dir"`
+	// UserName is the user the requests are made as on clusters with simple authentication.
+	UserName string `yaml:"user_name"`
+	// DelegationTokenFile is the path to the file with the encoded delegation token used on secured clusters.
+	DelegationTokenFile string `yaml:"delegation_token_file"`
+	// Kerberos configures the SPNEGO authentication used on secured clusters.
+	Kerberos KerberosConfig `yaml:"kerberos"`
+}
+
+// KerberosConfig stores the configuration of Kerberos (SPNEGO) authentication. It is enabled when a keytab file is set.
+type KerberosConfig struct {
+	// KeytabFile is the path to the keytab with the key of the principal.
+	KeytabFile string `yaml:"keytab_file"`
+	// Principal is the name of the principal the requests are made as, without the realm.
+	Principal string `yaml:"principal"`
+	// Realm is the Kerberos realm of the principal.
+	Realm string `yaml:"realm"`
+	// Krb5ConfigFile is the path to the krb5.conf file with the KDCs of the realm.
+	Krb5ConfigFile string `yaml:"krb5_config_file"`
+	// ServicePrincipalName is the SPN of the NameNode or HttpFS HTTP server, HTTP/<endpoint host> by default.
+	ServicePrincipalName string `yaml:"service_principal_name"`
+}
+
+func (conf *KerberosConfig) enabled() bool {
+	return conf.KeytabFile != ""
+}
+
+func (conf *Config) validate() error {
+	if conf.Endpoint == "" {
+		return errors.New("no hdfs endpoint in config file")
+	}
+	if !path.IsAbs(conf.RootDir) {
+		return errors.Errorf("hdfs root_dir has to be an absolute path, got %q", conf.RootDir)
+	}
+	authMethods := 0
+	for _, set := range []bool{conf.UserName != "", conf.DelegationTokenFile != "", conf.Kerberos.enabled()} {
+		if set {
+			authMethods++
+		}
+	}
+	if authMethods > 1 {
+		return errors.New("user_name, delegation_token_file and kerberos are mutually exclusive")
+	}
+	if conf.Kerberos.enabled() && (conf.Kerberos.Principal == "" || conf.Kerberos.Realm == "") {
+		return errors.New("kerberos principal and realm are required together with keytab_file")
+	}
+	return nil
+}
+
+// remoteError is the error returned by WebHDFS API.
+type remoteError struct {
+	Status    int    `json:"-"`
+	Exception string `json:"exception"`
+	Message   string `json:"message"`
+}
+
+func (e *remoteError) Error() string {
+	return fmt.Sprintf("webhdfs: %d %s: %s", e.Status, e.Exception, e.Message)
+}
+
+type fileStatus struct {
+	PathSuffix       string `json:"pathSuffix"`
+	Type             string `json:"type"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+}
+
+func (s fileStatus) attributes() objstore.ObjectAttributes {
+	return objstore.ObjectAttributes{
+		Size:         s.Length,
+		LastModified: time.Unix(0, s.ModificationTime*int64(time.Millisecond)),
+	}
+}
+
+// Bucket implements the store.Bucket interface against HDFS using WebHDFS REST API.
+type Bucket struct {
+	logger log.Logger
+	config Config
+	client *http.Client
+
+	// krb5 is the Kerberos client used to authenticate requests to the endpoint, nil if Kerberos is not configured.
+	krb5     *client.Client
+	spn      string
+	endpoint *url.URL
+
+	mtx          sync.Mutex
+	token        string
+	tokenReadAt  time.Time
+	tokenReadErr error
+}
+
+// NewBucket returns a new Bucket using the provided HDFS config values.
+func NewBucket(logger log.Logger, conf []byte) (*Bucket, error) {
+	config, err := parseConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewBucketWithConfig(logger, config)
+}
+
+// NewBucketWithConfig returns a new Bucket using the provided HDFS config struct.
+func NewBucketWithConfig(logger log.Logger, config Config) (*Bucket, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate hdfs configuration")
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	config.RootDir = path.Clean(config.RootDir)
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse hdfs endpoint")
+	}
+
+	var krb5 *client.Client
+	spn := config.Kerberos.ServicePrincipalName
+	if config.Kerberos.enabled() {
+		if krb5, err = newKerberosClient(config.Kerberos); err != nil {
+			return nil, err
+		}
+		if spn == "" {
+			spn = "HTTP/" + endpoint.Hostname()
+		}
+		level.Info(logger).Log("msg", "authenticating hdfs requests with kerberos", "principal", config.Kerberos.Principal+"@"+config.Kerberos.Realm, "spn", spn)
+	}
+
+	return &Bucket{
+		logger:   logger,
+		config:   config,
+		krb5:     krb5,
+		spn:      spn,
+		endpoint: endpoint,
+		client: &http.Client{
+			Transport: tracing.HTTPPropagationTripperware(http.DefaultTransport),
+			// Writes are redirected to a DataNode, where the content has to be sent. Only reads
+			// can be followed automatically, as they have no body.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if req.Method != http.MethodGet {
+					return http.ErrUseLastResponse
+				}
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				return nil
+			},
+		},
+	}, nil
+}
+
+// newKerberosClient returns a client logged in with the key from the keytab. The client renews its ticket
+// granting ticket in the background until it is destroyed.
+func newKerberosClient(conf KerberosConfig) (*client.Client, error) {
+	kt, err := keytab.Load(conf.KeytabFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load kerberos keytab %s", conf.KeytabFile)
+	}
+	krb5conf, err := krb5config.Load(conf.Krb5ConfigFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "load kerberos config %s", conf.Krb5ConfigFile)
+	}
+	// Hadoop KDCs are commonly configured without FAST, which would make the pre-authentication fail.
+	cl := client.NewWithKeytab(conf.Principal, conf.Realm, kt, krb5conf, client.DisablePAFXFAST(true))
+	if err := cl.Login(); err != nil {
+		return nil, errors.Wrapf(err, "kerberos login of %s@%s", conf.Principal, conf.Realm)
+	}
+	return cl, nil
+}
+
+func parseConfig(conf []byte) (Config, error) {
+	config := DefaultConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return Config{}, errors.Wrap(err, "parsing hdfs configuration")
+	}
+	return config, nil
+}
+
+// delegationToken returns the content of the delegation token file, reading it again if the cached one is too old.
+func (b *Bucket) delegationToken() (string, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if time.Since(b.tokenReadAt) < tokenReloadInterval {
+		return b.token, b.tokenReadErr
+	}
+	token, err := ioutil.ReadFile(b.config.DelegationTokenFile)
+	b.token, b.tokenReadAt, b.tokenReadErr = strings.TrimSpace(string(token)), time.Now(), errors.Wrap(err, "read delegation token")
+	return b.token, b.tokenReadErr
+}
+
+// url returns the WebHDFS URL of the operation on the object with the given name.
+func (b *Bucket) url(name, op string, params url.Values) (string, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", op)
+	switch {
+	case b.config.DelegationTokenFile != "":
+		token, err := b.delegationToken()
+		if err != nil {
+			return "", err
+		}
+		params.Set("delegation", token)
+	case b.config.UserName != "":
+		params.Set("user.name", b.config.UserName)
+	}
+	u := url.URL{Path: "/webhdfs/v1" + b.path(name), RawQuery: params.Encode()}
+	return b.config.Endpoint + u.String(), nil
+}
+
+func (b *Bucket) path(name string) string {
+	return path.Join(b.config.RootDir, name)
+}
+
+// do sends the request for the operation and returns the response with unread body if its status is one
+// of the expected ones.
+func (b *Bucket) do(ctx context.Context, method, rawURL string, body io.Reader, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if size, err := objstore.TryToGetSize(body); err == nil {
+			req.ContentLength = size
+		}
+	}
+	// Only requests to the endpoint are negotiated. DataNodes, which writes and reads are redirected to,
+	// authenticate the request with the delegation token the NameNode puts into the redirect location.
+	if b.krb5 != nil && req.URL.Host == b.endpoint.Host {
+		if err := spnego.SetSPNEGOHeader(b.krb5, req, b.spn); err != nil {
+			return nil, errors.Wrap(err, "kerberos authentication")
+		}
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range expected {
+		if res.StatusCode == s {
+			return res, nil
+		}
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(b.logger, res.Body, "webhdfs response")
+	return nil, responseError(res)
+}
+
+func responseError(res *http.Response) error {
+	var body struct {
+		RemoteException remoteError `json:"RemoteException"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&body)
+
+	remoteErr := &body.RemoteException
+	remoteErr.Status = res.StatusCode
+	if remoteErr.Exception == "" {
+		remoteErr.Exception = http.StatusText(res.StatusCode)
+	}
+	if res.StatusCode == http.StatusUnauthorized && strings.HasPrefix(res.Header.Get("WWW-Authenticate"), "Negotiate") {
+		remoteErr.Message = "cluster requires Kerberos authentication, configure kerberos or delegation_token_file: " + remoteErr.Message
+	}
+	return remoteErr
+}
+
+// call sends the request for the operation and decodes the JSON response into resp.
+func (b *Bucket) call(ctx context.Context, method, name, op string, params url.Values, resp interface{}) error {
+	u, err := b.url(name, op, params)
+	if err != nil {
+		return err
+	}
+	res, err := b.do(ctx, method, u, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(b.logger, res.Body, "webhdfs response")
+	return errors.Wrapf(json.NewDecoder(res.Body).Decode(resp), "decode webhdfs %s response", op)
+}
+
+// Name returns the root directory of the bucket.
+func (b *Bucket) Name() string {
+	return b.config.RootDir
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the attributes of the files. Directories have empty attributes.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
+	var resp struct {
+		FileStatuses struct {
+			FileStatus []fileStatus `json:"FileStatus"`
+		} `json:"FileStatuses"`
+	}
+	if err := b.call(ctx, http.MethodGet, dir, "LISTSTATUS", nil, &resp); err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "list hdfs directory %s", b.path(dir))
+	}
+
+	dir = strings.TrimSuffix(dir, DirDelim)
+	for _, status := range resp.FileStatuses.FileStatus {
+		// Listing a file returns the file itself with an empty suffix.
+		if status.PathSuffix == "" || strings.HasSuffix(status.PathSuffix, tmpSuffix) {
+			continue
+		}
+		name := path.Join(dir, status.PathSuffix)
+		attrs := status.attributes()
+		if status.Type == "DIRECTORY" {
+			name += DirDelim
+			attrs = objstore.ObjectAttributes{}
+		}
+		if err := f(name, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// GetRange returns a new range reader for the given object name and range.
+func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if name == "" {
+		return nil, errors.New("object name is empty")
+	}
+	params := url.Values{}
+	if off > 0 {
+		params.Set("offset", strconv.FormatInt(off, 10))
+	}
+	if length != -1 {
+		params.Set("length", strconv.FormatInt(length, 10))
+	}
+	u, err := b.url(name, "OPEN", params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.do(ctx, http.MethodGet, u, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (b *Bucket) status(ctx context.Context, name string) (fileStatus, error) {
+	var resp struct {
+		FileStatus fileStatus `json:"FileStatus"`
+	}
+	if err := b.call(ctx, http.MethodGet, name, "GETFILESTATUS", nil, &resp); err != nil {
+		return fileStatus{}, err
+	}
+	return resp.FileStatus, nil
+}
+
+// Exists checks if the given object exists in the bucket.
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	status, err := b.status(ctx, name)
+	if err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "stat hdfs file %s", b.path(name))
+	}
+	return status.Type == "FILE", nil
+}
+
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	status, err := b.status(ctx, name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return status.attributes(), nil
+}
+
+// Upload the contents of the reader as an object into the bucket.
+// The content is written to a temporary file first, which is renamed to the object name once complete,
+// so partially written objects are never visible.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(name), fmt.Sprintf(".%s.%s%s", path.Base(name), hex.EncodeToString(suffix), tmpSuffix))
+
+	if err := b.create(ctx, tmp, r); err != nil {
+		return errors.Wrapf(err, "write hdfs file %s", b.path(tmp))
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if derr := b.delete(context.Background(), tmp); derr != nil {
+			err = errors.Wrapf(err, "delete hdfs temporary file %s failed: %v", b.path(tmp), derr)
+		}
+	}()
+
+	// Rename does not replace existing files, so the previous version of the object has to be removed first.
+	for _, overwrite := range []bool{false, true} {
+		if overwrite {
+			if err := b.delete(ctx, name); err != nil && !b.IsObjNotFoundErr(err) {
+				return errors.Wrapf(err, "delete previous hdfs file %s", b.path(name))
+			}
+		}
+		renamed, err := b.rename(ctx, tmp, name)
+		if err != nil {
+			return errors.Wrapf(err, "rename hdfs file %s to %s", b.path(tmp), b.path(name))
+		}
+		if renamed {
+			return nil
+		}
+	}
+	return errors.Errorf("rename hdfs file %s to %s: destination exists", b.path(tmp), b.path(name))
+}
+
+// create writes the content of r into a new file with the given name, creating missing parent directories.
+func (b *Bucket) create(ctx context.Context, name string, r io.Reader) error {
+	u, err := b.url(name, "CREATE", url.Values{"overwrite": {"true"}})
+	if err != nil {
+		return err
+	}
+	// The first request without content returns location of the DataNode (or of the HttpFS data endpoint) to write to.
+	res, err := b.do(ctx, http.MethodPut, u, nil, http.StatusTemporaryRedirect)
+	if err != nil {
+		return err
+	}
+	runutil.ExhaustCloseWithLogOnErr(b.logger, res.Body, "webhdfs create response")
+
+	res, err = b.do(ctx, http.MethodPut, res.Header.Get("Location"), r, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	runutil.ExhaustCloseWithLogOnErr(b.logger, res.Body, "webhdfs write response")
+	return nil
+}
+
+func (b *Bucket) rename(ctx context.Context, src, dst string) (bool, error) {
+	var resp struct {
+		Boolean bool `json:"boolean"`
+	}
+	if err := b.call(ctx, http.MethodPut, src, "RENAME", url.Values{"destination": {b.path(dst)}}, &resp); err != nil {
+		return false, err
+	}
+	return resp.Boolean, nil
+}
+
+// delete removes the file or empty directory with the given name.
+func (b *Bucket) delete(ctx context.Context, name string) error {
+	var resp struct {
+		Boolean bool `json:"boolean"`
+	}
+	if err := b.call(ctx, http.MethodDelete, name, "DELETE", url.Values{"recursive": {"false"}}, &resp); err != nil {
+		return err
+	}
+	if !resp.Boolean {
+		return &remoteError{Status: http.StatusNotFound, Exception: "FileNotFoundException", Message: fmt.Sprintf("file does not exist: %s", b.path(name))}
+	}
+	return nil
+}
+
+// Delete removes the object with the given name, together with parent directories left empty.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	if err := b.delete(ctx, name); err != nil {
+		// Error is not wrapped, so it can be checked with IsObjNotFoundErr.
+		return err
+	}
+	// Non-recursive delete fails on directories which are not empty, so it is safe to call it for all parents,
+	// even if other objects are concurrently written into them.
+	for dir := path.Dir(name); dir != "." && dir != DirDelim; dir = path.Dir(dir) {
+		if err := b.delete(ctx, dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// DeleteMultiple removes all objects with the given names.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	return objstore.DeleteMultipleConcurrently(ctx, b, names, objstore.DefaultDeleteConcurrency)
+}
+
+// Copy copies the object with srcName into the dstName. WebHDFS has no copy operation,
+// so the content is downloaded and uploaded again.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) (err error) {
+	rc, err := b.Get(ctx, srcName)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, rc, "hdfs copy source %s", srcName)
+
+	return b.Upload(ctx, dstName, rc)
+}
+
+// IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
+func (b *Bucket) IsObjNotFoundErr(err error) bool {
+	remoteErr, ok := errors.Cause(err).(*remoteError)
+	return ok && (remoteErr.Status == http.StatusNotFound || remoteErr.Exception == "FileNotFoundException")
+}
+
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (b *Bucket) ErrStatusCode(err error) int {
+	if remoteErr, ok := errors.Cause(err).(*remoteError); ok {
+		return remoteErr.Status
+	}
+	return 0
+}
+
+// Close stops the renewal of the Kerberos tickets, if Kerberos is configured.
+func (b *Bucket) Close() error {
+	if b.krb5 != nil {
+		b.krb5.Destroy()
+	}
+	return nil
+}
+
+func configFromEnv() Config {
+	c := DefaultConfig
+	c.Endpoint = os.Getenv("WEBHDFS_ENDPOINT")
+	c.UserName = os.Getenv("HDFS_USER_NAME")
+	c.DelegationTokenFile = os.Getenv("HDFS_DELEGATION_TOKEN_FILE")
+	return c
+}
+
+// NewTestBucket creates test bkt client that before returning creates temporary root directory.
+// In a close function it deletes the directory with all its content.
+func NewTestBucket(t testing.TB) (objstore.Bucket, func(), error) {
+	c := configFromEnv()
+	if c.Endpoint == "" {
+		return nil, nil, errors.New("insufficient hdfs test configuration information")
+	}
+	c.RootDir = path.Join(DefaultConfig.RootDir, objstore.CreateTemporaryTestBucketName(t))
+
+	b, err := NewBucketWithConfig(log.NewNopLogger(), c)
+	if err != nil {
+		return nil, nil, err
+	}
+	var resp struct {
+		Boolean bool `json:"boolean"`
+	}
+	if err := b.call(context.Background(), http.MethodPut, "", "MKDIRS", nil, &resp); err != nil {
+		return nil, nil, errors.Wrapf(err, "create hdfs directory %s", c.RootDir)
+	}
+	t.Log("created temporary HDFS directory for HDFS tests with name", c.RootDir)
+
+	return b, func() {
+		if err := b.call(context.Background(), http.MethodDelete, "", "DELETE", url.Values{"recursive": {"true"}}, &resp); err != nil {
+			t.Logf("deleting directory %s failed: %s", c.RootDir, err)
+		}
+	}, nil
+}
@@ -0,0 +1,319 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package hdfs
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type fakeFile struct {
+	data     []byte
+	modified int64
+}
+
+// fakeWebHDFS is a minimal in-memory implementation of the WebHDFS API, which redirects writes to itself
+// the same way the NameNode redirects them to a DataNode.
+type fakeWebHDFS struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mtx   sync.Mutex
+	auth  func(q map[string][]string) bool
+	files map[string]*fakeFile
+	dirs  map[string]bool
+	calls map[string]int
+}
+
+func newFakeWebHDFS(t *testing.T) *fakeWebHDFS {
+	f := &fakeWebHDFS{
+		t:     t,
+		auth:  func(map[string][]string) bool { return true },
+		files: map[string]*fakeFile{},
+		dirs:  map[string]bool{"/": true},
+		calls: map[string]int{},
+	}
+	f.srv = httptest.NewServer(f)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeRemoteError(w http.ResponseWriter, status int, exception string) {
+	writeJSON(w, status, map[string]remoteError{"RemoteException": {Exception: exception, Message: exception}})
+}
+
+func (f *fakeWebHDFS) mkdirs(p string) {
+	for ; p != "/"; p = path.Dir(p) {
+		f.dirs[p] = true
+	}
+}
+
+func (f *fakeWebHDFS) children(p string) []string {
+	var names []string
+	for _, m := range []map[string]bool{f.dirs, f.fileSet()} {
+		for name := range m {
+			if name != "/" && path.Dir(name) == p {
+				names = append(names, path.Base(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *fakeWebHDFS) fileSet() map[string]bool {
+	s := map[string]bool{}
+	for name := range f.files {
+		s[name] = true
+	}
+	return s
+}
+
+func (f *fakeWebHDFS) status(p string) (fileStatus, bool) {
+	if file, ok := f.files[p]; ok {
+		return fileStatus{Type: "FILE", Length: int64(len(file.data)), ModificationTime: file.modified}, true
+	}
+	if f.dirs[p] {
+		return fileStatus{Type: "DIRECTORY"}, true
+	}
+	return fileStatus{}, false
+}
+
+func (f *fakeWebHDFS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	q := r.URL.Query()
+	if !f.auth(q) {
+		w.Header().Set("WWW-Authenticate", "Negotiate")
+		writeRemoteError(w, http.StatusUnauthorized, "SecurityException")
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, "/webhdfs/v1")
+	op := q.Get("op")
+	f.calls[op]++
+
+	switch op {
+	case "GETFILESTATUS":
+		status, ok := f.status(p)
+		if !ok {
+			writeRemoteError(w, http.StatusNotFound, "FileNotFoundException")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]fileStatus{"FileStatus": status})
+	case "LISTSTATUS":
+		status, ok := f.status(p)
+		if !ok {
+			writeRemoteError(w, http.StatusNotFound, "FileNotFoundException")
+			return
+		}
+		statuses := []fileStatus{status}
+		if status.Type == "DIRECTORY" {
+			statuses = statuses[:0]
+			for _, name := range f.children(p) {
+				s, _ := f.status(path.Join(p, name))
+				s.PathSuffix = name
+				statuses = append(statuses, s)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]map[string][]fileStatus{"FileStatuses": {"FileStatus": statuses}})
+	case "OPEN":
+		file, ok := f.files[p]
+		if !ok {
+			writeRemoteError(w, http.StatusNotFound, "FileNotFoundException")
+			return
+		}
+		data := file.data
+		if off := q.Get("offset"); off != "" {
+			o, err := strconv.Atoi(off)
+			testutil.Ok(f.t, err)
+			data = data[o:]
+		}
+		if length := q.Get("length"); length != "" {
+			l, err := strconv.Atoi(length)
+			testutil.Ok(f.t, err)
+			if l < len(data) {
+				data = data[:l]
+			}
+		}
+		_, _ = w.Write(data)
+	case "CREATE":
+		if q.Get("data") != "true" {
+			q.Set("data", "true")
+			w.Header().Set("Location", f.srv.URL+r.URL.Path+"?"+q.Encode())
+			w.WriteHeader(http.StatusTemporaryRedirect)
+			return
+		}
+		testutil.Equals(f.t, "application/octet-stream", r.Header.Get("Content-Type"))
+		data, err := ioutil.ReadAll(r.Body)
+		testutil.Ok(f.t, err)
+		f.mkdirs(path.Dir(p))
+		f.files[p] = &fakeFile{data: data, modified: time.Now().UnixNano() / int64(time.Millisecond)}
+		w.WriteHeader(http.StatusCreated)
+	case "RENAME":
+		dst := q.Get("destination")
+		_, srcOK := f.files[p]
+		_, dstExists := f.status(dst)
+		if !srcOK || dstExists || !f.dirs[path.Dir(dst)] {
+			writeJSON(w, http.StatusOK, map[string]bool{"boolean": false})
+			return
+		}
+		f.files[dst] = f.files[p]
+		delete(f.files, p)
+		writeJSON(w, http.StatusOK, map[string]bool{"boolean": true})
+	case "DELETE":
+		testutil.Equals(f.t, "false", q.Get("recursive"))
+		if _, ok := f.files[p]; ok {
+			delete(f.files, p)
+		} else if f.dirs[p] {
+			if len(f.children(p)) > 0 {
+				writeRemoteError(w, http.StatusForbidden, "PathIsNotEmptyDirectoryException")
+				return
+			}
+			delete(f.dirs, p)
+		} else {
+			writeJSON(w, http.StatusOK, map[string]bool{"boolean": false})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"boolean": true})
+	default:
+		writeRemoteError(w, http.StatusBadRequest, "UnsupportedOperationException")
+	}
+}
+
+func newTestBucketWithFake(t *testing.T, conf Config) (*Bucket, *fakeWebHDFS) {
+	fake := newFakeWebHDFS(t)
+	conf.Endpoint = fake.srv.URL
+	fake.mkdirs(conf.RootDir)
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), conf)
+	testutil.Ok(t, err)
+	return bkt, fake
+}
+
+func TestBucket_AcceptanceWithFakeWebHDFS(t *testing.T) {
+	bkt, fake := newTestBucketWithFake(t, DefaultConfig)
+	objstore.AcceptanceTest(t, bkt)
+
+	// Temporary files are not left behind and empty directories are removed.
+	var files []string
+	for name := range fake.files {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	testutil.Equals(t, []string{"/thanos/id1/obj_1.some", "/thanos/id1/obj_3.some", "/thanos/obj_5.some"}, files)
+	testutil.Assert(t, !fake.dirs["/thanos/id2"], "expected empty directory to be deleted")
+	testutil.Assert(t, fake.dirs["/thanos"], "expected root directory to be kept")
+}
+
+func TestBucket_UploadIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	bkt, fake := newTestBucketWithFake(t, DefaultConfig)
+
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj", strings.NewReader("v1")))
+	testutil.Equals(t, 1, fake.calls["RENAME"])
+
+	// Object is replaced only after the new content is fully written.
+	fake.calls = map[string]int{}
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj", strings.NewReader("v2")))
+	testutil.Equals(t, 2, fake.calls["RENAME"])
+	testutil.Equals(t, []byte("v2"), fake.files["/thanos/dir/obj"].data)
+
+	// Temporary files are not listed.
+	fake.files["/thanos/dir/.obj.0123456789abcdef"+tmpSuffix] = &fakeFile{data: []byte("partial")}
+	var seen []string
+	testutil.Ok(t, bkt.Iter(ctx, "dir", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/obj"}, seen)
+}
+
+func TestBucket_Auth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("simple", func(t *testing.T) {
+		conf := DefaultConfig
+		conf.UserName = "thanos"
+		bkt, fake := newTestBucketWithFake(t, conf)
+		fake.auth = func(q map[string][]string) bool {
+			return len(q["user.name"]) == 1 && q["user.name"][0] == "thanos"
+		}
+		testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("data")))
+	})
+	t.Run("delegation token", func(t *testing.T) {
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("token-1\n"), os.ModePerm))
+
+		conf := DefaultConfig
+		conf.DelegationTokenFile = tokenFile
+		bkt, fake := newTestBucketWithFake(t, conf)
+		fake.auth = func(q map[string][]string) bool {
+			return len(q["delegation"]) == 1 && q["delegation"][0] == "token-1" && len(q["user.name"]) == 0
+		}
+		testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("data")))
+
+		// Renewed token is used once the cached one is reloaded.
+		testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("token-2"), os.ModePerm))
+		fake.auth = func(q map[string][]string) bool {
+			return len(q["delegation"]) == 1 && q["delegation"][0] == "token-2"
+		}
+		_, err := bkt.Exists(ctx, "obj")
+		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), "Kerberos"), "expected hint about Kerberos, got %s", err)
+
+		bkt.tokenReadAt = time.Time{}
+		ok, err := bkt.Exists(ctx, "obj")
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok, "expected object to exist")
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, tcase := range []struct {
+		name string
+		conf string
+		ok   bool
+	}{
+		{name: "minimal", conf: "endpoint: http://namenode:9870", ok: true},
+		{name: "no endpoint", conf: "root_dir: /thanos"},
+		{name: "relative root dir", conf: "endpoint: http://namenode:9870\nroot_dir: thanos"},
+		{name: "both auth methods", conf: "endpoint: http://namenode:9870\nuser_name: thanos\ndelegation_token_file: /token"},
+		{name: "kerberos and user name", conf: "endpoint: http://namenode:9870\nuser_name: thanos\nkerberos:\n  keytab_file: /keytab\n  principal: thanos\n  realm: EXAMPLE.COM"},
+		{name: "kerberos without realm", conf: "endpoint: http://namenode:9870\nkerberos:\n  keytab_file: /keytab\n  principal: thanos"},
+		{name: "missing kerberos keytab", conf: "endpoint: http://namenode:9870\nkerberos:\n  keytab_file: /non-existent/keytab\n  principal: thanos\n  realm: EXAMPLE.COM"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := NewBucket(log.NewNopLogger(), []byte(tcase.conf))
+			if tcase.ok {
+				testutil.Ok(t, err)
+				return
+			}
+			testutil.NotOk(t, err)
+		})
+	}
+}
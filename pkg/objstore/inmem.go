@@ -43,8 +43,16 @@ func (b *InMemBucket) Objects() map[string][]byte {
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error) error {
-	unique := map[string]struct{}{}
+func (b *InMemBucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes. Directories have empty attributes.
+func (b *InMemBucket) IterWithAttributes(_ context.Context, dir string, f func(string, ObjectAttributes) error) error {
+	unique := map[string]ObjectAttributes{}
 
 	var dirPartsCount int
 	dirParts := strings.SplitAfter(dir, DirDelim)
@@ -62,7 +70,12 @@ func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error)
 		}
 
 		parts := strings.SplitAfter(filename, DirDelim)
-		unique[strings.Join(parts[:dirPartsCount+1], "")] = struct{}{}
+		// Entries which are directories get empty attributes.
+		var attrs ObjectAttributes
+		if len(parts) == dirPartsCount+1 {
+			attrs = b.attrs[filename]
+		}
+		unique[strings.Join(parts[:dirPartsCount+1], "")] = attrs
 	}
 	b.mtx.RUnlock()
 
@@ -85,7 +98,7 @@ func (b *InMemBucket) Iter(_ context.Context, dir string, f func(string) error)
 	})
 
 	for _, k := range keys {
-		if err := f(k); err != nil {
+		if err := f(k, unique[k]); err != nil {
 			return err
 		}
 	}
@@ -188,6 +201,34 @@ func (b *InMemBucket) Delete(_ context.Context, name string) error {
 	return nil
 }
 
+// Copy copies the object with srcName into the dstName.
+func (b *InMemBucket) Copy(_ context.Context, srcName, dstName string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	body, ok := b.objects[srcName]
+	if !ok {
+		return errNotFound
+	}
+	// Objects are immutable, so it is safe to share the same content.
+	b.objects[dstName] = body
+	b.attrs[dstName] = ObjectAttributes{
+		Size:         int64(len(body)),
+		LastModified: time.Now(),
+	}
+	return nil
+}
+
+// DeleteMultiple removes all objects with the given names.
+func (b *InMemBucket) DeleteMultiple(_ context.Context, names []string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, name := range names {
+		delete(b.objects, name)
+		delete(b.attrs, name)
+	}
+	return nil
+}
+
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *InMemBucket) IsObjNotFoundErr(err error) bool {
 	return errors.Cause(err) == errNotFound
@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,6 +19,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/thanos-io/thanos/pkg/runutil"
 )
@@ -29,8 +32,15 @@ const (
 	OpUpload     = "upload"
 	OpDelete     = "delete"
 	OpAttributes = "attributes"
+	OpCopy       = "copy"
+
+	OpDeleteMultiple = "delete_multiple"
 )
 
+// DefaultDeleteConcurrency is the number of concurrent Delete calls used to remove multiple objects
+// by providers without native support for batch deletion.
+const DefaultDeleteConcurrency = 16
+
 // Bucket provides read and write access to an object storage bucket.
 // NOTE: We assume strong consistency for write-read flow.
 type Bucket interface {
@@ -45,6 +55,15 @@ type Bucket interface {
 	// If object does not exists in the moment of deletion, Delete should throw error.
 	Delete(ctx context.Context, name string) error
 
+	// Copy copies the object with the srcName into the dstName within the same bucket, without downloading
+	// and re-uploading the content where the provider supports it. Existing dstName object is overwritten.
+	// If srcName does not exist, Copy should return error for which IsObjNotFoundErr returns true.
+	Copy(ctx context.Context, srcName, dstName string) error
+
+	// DeleteMultiple removes all objects with the given names, batching the requests where the provider supports it.
+	// Contrary to Delete, objects which do not exist are ignored.
+	DeleteMultiple(ctx context.Context, names []string) error
+
 	// Name returns the bucket name for the provider.
 	Name() string
 }
@@ -70,6 +89,10 @@ type BucketReader interface {
 	// Entries are passed to function in sorted order.
 	Iter(ctx context.Context, dir string, f func(string) error) error
 
+	// IterWithAttributes calls f for each entry in the given directory similar to Iter, but passes also the attributes
+	// of each object, taken from the listing response where the provider supports it. Directories have empty attributes.
+	IterWithAttributes(ctx context.Context, dir string, f func(name string, attrs ObjectAttributes) error) error
+
 	// Get returns a reader for the given object name.
 	Get(ctx context.Context, name string) (io.ReadCloser, error)
 
@@ -103,10 +126,18 @@ type ObjectAttributes struct {
 	LastModified time.Time `json:"last_modified"`
 }
 
+// ObjectSizer can return the size of the object it reads.
+type ObjectSizer interface {
+	// ObjectSize returns the size of the object in bytes, or an error if it cannot be known.
+	ObjectSize() (int64, error)
+}
+
 // TryToGetSize tries to get upfront size from reader.
 // TODO(https://github.com/thanos-io/thanos/issues/678): Remove guessing length when minio provider will support multipart upload without this.
 func TryToGetSize(r io.Reader) (int64, error) {
 	switch f := r.(type) {
+	case ObjectSizer:
+		return f.ObjectSize()
 	case *os.File:
 		fileInfo, err := f.Stat()
 		if err != nil {
@@ -230,9 +261,122 @@ func DownloadDir(ctx context.Context, logger log.Logger, bkt BucketReader, src,
 	return nil
 }
 
+// DeleteMultipleConcurrently removes objects with the given names running up to concurrency Delete calls at once.
+// It is meant for Bucket implementations without native batch deletion. Objects which do not exist are ignored.
+func DeleteMultipleConcurrently(ctx context.Context, bkt Bucket, names []string, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	ch := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			for name := range ch {
+				if err := bkt.Delete(gctx, name); err != nil && !bkt.IsObjNotFoundErr(err) {
+					return errors.Wrapf(err, "delete %s", name)
+				}
+			}
+			return nil
+		})
+	}
+
+	func() {
+		defer close(ch)
+		for _, name := range names {
+			select {
+			case ch <- name:
+			case <-gctx.Done():
+				return
+			}
+		}
+	}()
+	return g.Wait()
+}
+
 // IsOpFailureExpectedFunc allows to mark certain errors as expected, so they will not increment thanos_objstore_bucket_operation_failures_total metric.
 type IsOpFailureExpectedFunc func(error) bool
 
+// ErrStatusCodeResolver is implemented by buckets which can tell the HTTP status code of the failed request an
+// error comes from. It is used to break down the failures in metrics.
+type ErrStatusCodeResolver interface {
+	// ErrStatusCode returns the HTTP status code of the request err comes from, or 0 if unknown.
+	ErrStatusCode(err error) int
+}
+
+// ErrNotSupported is returned by the optional bucket operations, e.g. OrphanedObjectsCleaner.CleanOrphanedObjects, of
+// bucket wrappers whose underlying bucket does not implement them.
+var ErrNotSupported = errors.New("operation not supported by the bucket")
+
+// IsNotSupportedErr returns true if the optional bucket operation returning err is not supported by the bucket.
+func IsNotSupportedErr(err error) bool {
+	return errors.Cause(err) == ErrNotSupported
+}
+
+// OrphanedObjectsCleaner is implemented by buckets which store objects as several provider objects, e.g. the segments
+// of large objects, and can leave some of them behind on failed uploads or overwrites. Bucket wrappers implement it
+// even if their underlying bucket does not, returning ErrNotSupported.
+type OrphanedObjectsCleaner interface {
+	// CleanOrphanedObjects removes the provider objects older than minAge which are not part of any object anymore,
+	// only considering the ones left by the objects with the given name prefix.
+	// It returns the number of removed provider objects.
+	CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error)
+}
+
+// ExpirationRule is a rule of the object lifecycle of the provider, deleting the objects with the given prefix.
+type ExpirationRule struct {
+	ID     string
+	Prefix string
+	// After is the age of the objects after which they are deleted, or 0 if they are deleted at At.
+	After time.Duration
+	At    time.Time
+}
+
+// ExpirationRulesReader is implemented by buckets which can tell the object lifecycle rules of the provider deleting
+// their objects, e.g. S3 lifecycle configurations. Bucket wrappers implement it even if their underlying bucket does
+// not, returning ErrNotSupported.
+type ExpirationRulesReader interface {
+	// ExpirationRules returns the enabled expiration rules applying to the objects of the bucket.
+	ExpirationRules(ctx context.Context) ([]ExpirationRule, error)
+}
+
+// Reasons of failed operations.
+const (
+	// FailureThrottled are requests rejected by the provider to slow down, i.e. with 429 or 503 status code.
+	FailureThrottled = "throttled"
+	// FailureServerError are requests failed with 5xx status code other than 503.
+	FailureServerError = "server_error"
+	// FailureClientError are requests failed with 4xx status code other than 429.
+	FailureClientError = "client_error"
+	// FailureTimeout are operations which timed out.
+	FailureTimeout = "timeout"
+	// FailureOther are failures with an unknown cause.
+	FailureOther = "other"
+)
+
+// FailureReason returns the reason of the failure of an operation using the given status code resolver, which can be nil.
+func FailureReason(err error, resolver ErrStatusCodeResolver) string {
+	if resolver != nil {
+		switch code := resolver.ErrStatusCode(err); {
+		case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+			return FailureThrottled
+		case code >= 500 && code < 600:
+			return FailureServerError
+		case code >= 400 && code < 500:
+			return FailureClientError
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return FailureTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return FailureTimeout
+	}
+	return FailureOther
+}
+
 var _ InstrumentedBucket = &metricBucket{}
 
 // BucketWithMetrics takes a bucket and registers metrics with the given registry for
@@ -253,6 +397,12 @@ func BucketWithMetrics(name string, b Bucket, reg prometheus.Registerer) *metric
 			ConstLabels: prometheus.Labels{"bucket": name},
 		}, []string{"operation"}),
 
+		opsFailureReasons: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_bucket_operation_failure_reasons_total",
+			Help:        "Total number of operations against a bucket that failed, but were not expected to fail, by reason: throttled (429 and 503 status codes), server_error, client_error, timeout and other.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+		}, []string{"operation", "reason"}),
+
 		opsDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
 			Name:        "thanos_objstore_bucket_operation_duration_seconds",
 			Help:        "Duration of successful operations against the bucket",
@@ -260,11 +410,19 @@ func BucketWithMetrics(name string, b Bucket, reg prometheus.Registerer) *metric
 			Buckets:     []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
 		}, []string{"operation"}),
 
+		opsTransferredBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_bucket_operation_transferred_bytes_total",
+			Help:        "Total number of bytes read by get and get_range operations and written by successful upload operations.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+		}, []string{"operation"}),
+
 		lastSuccessfulUploadTime: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "thanos_objstore_bucket_last_successful_upload_time",
 			Help: "Second timestamp of the last successful upload to the bucket.",
 		}, []string{"bucket"}),
 	}
+	bkt.statusCodeResolver, _ = b.(ErrStatusCodeResolver)
+
 	for _, op := range []string{
 		OpIter,
 		OpGet,
@@ -273,10 +431,18 @@ func BucketWithMetrics(name string, b Bucket, reg prometheus.Registerer) *metric
 		OpUpload,
 		OpDelete,
 		OpAttributes,
+		OpCopy,
+		OpDeleteMultiple,
 	} {
 		bkt.ops.WithLabelValues(op)
 		bkt.opsFailures.WithLabelValues(op)
 		bkt.opsDuration.WithLabelValues(op)
+		for _, reason := range []string{FailureThrottled, FailureServerError, FailureClientError, FailureTimeout, FailureOther} {
+			bkt.opsFailureReasons.WithLabelValues(op, reason)
+		}
+	}
+	for _, op := range []string{OpGet, OpGetRange, OpUpload} {
+		bkt.opsTransferredBytes.WithLabelValues(op)
 	}
 	bkt.lastSuccessfulUploadTime.WithLabelValues(b.Name())
 	return bkt
@@ -287,9 +453,12 @@ type metricBucket struct {
 
 	ops                 *prometheus.CounterVec
 	opsFailures         *prometheus.CounterVec
+	opsFailureReasons   *prometheus.CounterVec
 	isOpFailureExpected IsOpFailureExpectedFunc
+	statusCodeResolver  ErrStatusCodeResolver
 
 	opsDuration              *prometheus.HistogramVec
+	opsTransferredBytes      *prometheus.CounterVec
 	lastSuccessfulUploadTime *prometheus.GaugeVec
 }
 
@@ -298,8 +467,11 @@ func (b *metricBucket) WithExpectedErrs(fn IsOpFailureExpectedFunc) Bucket {
 		bkt:                      b.bkt,
 		ops:                      b.ops,
 		opsFailures:              b.opsFailures,
+		opsFailureReasons:        b.opsFailureReasons,
 		isOpFailureExpected:      fn,
+		statusCodeResolver:       b.statusCodeResolver,
 		opsDuration:              b.opsDuration,
+		opsTransferredBytes:      b.opsTransferredBytes,
 		lastSuccessfulUploadTime: b.lastSuccessfulUploadTime,
 	}
 }
@@ -308,17 +480,39 @@ func (b *metricBucket) ReaderWithExpectedErrs(fn IsOpFailureExpectedFunc) Bucket
 	return b.WithExpectedErrs(fn)
 }
 
+// observeFailure records the failure of the operation, unless it is expected or the operation was canceled.
+func (b *metricBucket) observeFailure(ctx context.Context, op string, err error) {
+	if b.isOpFailureExpected(err) || ctx.Err() == context.Canceled {
+		return
+	}
+	b.opsFailures.WithLabelValues(op).Inc()
+	b.opsFailureReasons.WithLabelValues(op, FailureReason(err, b.statusCodeResolver)).Inc()
+}
+
 func (b *metricBucket) Iter(ctx context.Context, dir string, f func(name string) error) error {
 	const op = OpIter
 	b.ops.WithLabelValues(op).Inc()
 
-	err := b.bkt.Iter(ctx, dir, f)
-	if err != nil {
-		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
-			b.opsFailures.WithLabelValues(op).Inc()
-		}
+	start := time.Now()
+	if err := b.bkt.Iter(ctx, dir, f); err != nil {
+		b.observeFailure(ctx, op, err)
+		return err
 	}
-	return err
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (b *metricBucket) IterWithAttributes(ctx context.Context, dir string, f func(name string, attrs ObjectAttributes) error) error {
+	const op = OpIter
+	b.ops.WithLabelValues(op).Inc()
+
+	start := time.Now()
+	if err := b.bkt.IterWithAttributes(ctx, dir, f); err != nil {
+		b.observeFailure(ctx, op, err)
+		return err
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
 }
 
 func (b *metricBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
@@ -328,9 +522,7 @@ func (b *metricBucket) Attributes(ctx context.Context, name string) (ObjectAttri
 	start := time.Now()
 	attrs, err := b.bkt.Attributes(ctx, name)
 	if err != nil {
-		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
-			b.opsFailures.WithLabelValues(op).Inc()
-		}
+		b.observeFailure(ctx, op, err)
 		return attrs, err
 	}
 	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
@@ -343,18 +535,10 @@ func (b *metricBucket) Get(ctx context.Context, name string) (io.ReadCloser, err
 
 	rc, err := b.bkt.Get(ctx, name)
 	if err != nil {
-		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
-			b.opsFailures.WithLabelValues(op).Inc()
-		}
+		b.observeFailure(ctx, op, err)
 		return nil, err
 	}
-	return newTimingReadCloser(
-		rc,
-		op,
-		b.opsDuration,
-		b.opsFailures,
-		b.isOpFailureExpected,
-	), nil
+	return newTimingReadCloser(ctx, rc, op, b), nil
 }
 
 func (b *metricBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
@@ -363,18 +547,10 @@ func (b *metricBucket) GetRange(ctx context.Context, name string, off, length in
 
 	rc, err := b.bkt.GetRange(ctx, name, off, length)
 	if err != nil {
-		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
-			b.opsFailures.WithLabelValues(op).Inc()
-		}
+		b.observeFailure(ctx, op, err)
 		return nil, err
 	}
-	return newTimingReadCloser(
-		rc,
-		op,
-		b.opsDuration,
-		b.opsFailures,
-		b.isOpFailureExpected,
-	), nil
+	return newTimingReadCloser(ctx, rc, op, b), nil
 }
 
 func (b *metricBucket) Exists(ctx context.Context, name string) (bool, error) {
@@ -384,9 +560,7 @@ func (b *metricBucket) Exists(ctx context.Context, name string) (bool, error) {
 	start := time.Now()
 	ok, err := b.bkt.Exists(ctx, name)
 	if err != nil {
-		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
-			b.opsFailures.WithLabelValues(op).Inc()
-		}
+		b.observeFailure(ctx, op, err)
 		return false, err
 	}
 	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
@@ -397,15 +571,25 @@ func (b *metricBucket) Upload(ctx context.Context, name string, r io.Reader) err
 	const op = OpUpload
 	b.ops.WithLabelValues(op).Inc()
 
+	// Readers of known size are passed as they are, as providers use their type to get the size.
+	size, err := TryToGetSize(r)
+	var counting *countingReader
+	if err != nil {
+		counting = &countingReader{Reader: r}
+		r = counting
+	}
+
 	start := time.Now()
 	if err := b.bkt.Upload(ctx, name, r); err != nil {
-		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
-			b.opsFailures.WithLabelValues(op).Inc()
-		}
+		b.observeFailure(ctx, op, err)
 		return err
 	}
+	if counting != nil {
+		size = counting.n
+	}
 	b.lastSuccessfulUploadTime.WithLabelValues(b.bkt.Name()).SetToCurrentTime()
 	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	b.opsTransferredBytes.WithLabelValues(op).Add(float64(size))
 	return nil
 }
 
@@ -415,9 +599,7 @@ func (b *metricBucket) Delete(ctx context.Context, name string) error {
 
 	start := time.Now()
 	if err := b.bkt.Delete(ctx, name); err != nil {
-		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
-			b.opsFailures.WithLabelValues(op).Inc()
-		}
+		b.observeFailure(ctx, op, err)
 		return err
 	}
 	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
@@ -425,10 +607,62 @@ func (b *metricBucket) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
+func (b *metricBucket) Copy(ctx context.Context, srcName, dstName string) error {
+	const op = OpCopy
+	b.ops.WithLabelValues(op).Inc()
+
+	start := time.Now()
+	if err := b.bkt.Copy(ctx, srcName, dstName); err != nil {
+		b.observeFailure(ctx, op, err)
+		return err
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (b *metricBucket) DeleteMultiple(ctx context.Context, names []string) error {
+	const op = OpDeleteMultiple
+	b.ops.WithLabelValues(op).Inc()
+
+	start := time.Now()
+	if err := b.bkt.DeleteMultiple(ctx, names); err != nil {
+		b.observeFailure(ctx, op, err)
+		return err
+	}
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
+}
+
 func (b *metricBucket) IsObjNotFoundErr(err error) bool {
 	return b.bkt.IsObjNotFoundErr(err)
 }
 
+// ErrStatusCode implements objstore.ErrStatusCodeResolver if the underlying bucket does.
+func (b *metricBucket) ErrStatusCode(err error) int {
+	if b.statusCodeResolver != nil {
+		return b.statusCodeResolver.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it.
+func (b *metricBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := b.bkt.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, prefix, minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it.
+func (b *metricBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	if r, ok := b.bkt.(ExpirationRulesReader); ok {
+		return r.ExpirationRules(ctx)
+	}
+	return nil, ErrNotSupported
+}
+
 func (b *metricBucket) Close() error {
 	return b.bkt.Close()
 }
@@ -437,39 +671,46 @@ func (b *metricBucket) Name() string {
 	return b.bkt.Name()
 }
 
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
 type timingReadCloser struct {
 	io.ReadCloser
 
 	alreadyGotErr bool
 
-	start             time.Time
-	op                string
-	duration          *prometheus.HistogramVec
-	failed            *prometheus.CounterVec
-	isFailureExpected IsOpFailureExpectedFunc
+	ctx   context.Context
+	start time.Time
+	op    string
+	bkt   *metricBucket
 }
 
-func newTimingReadCloser(rc io.ReadCloser, op string, dur *prometheus.HistogramVec, failed *prometheus.CounterVec, isFailureExpected IsOpFailureExpectedFunc) *timingReadCloser {
-	// Initialize the metrics with 0.
-	dur.WithLabelValues(op)
-	failed.WithLabelValues(op)
+func newTimingReadCloser(ctx context.Context, rc io.ReadCloser, op string, bkt *metricBucket) *timingReadCloser {
 	return &timingReadCloser{
-		ReadCloser:        rc,
-		start:             time.Now(),
-		op:                op,
-		duration:          dur,
-		failed:            failed,
-		isFailureExpected: isFailureExpected,
+		ReadCloser: rc,
+		ctx:        ctx,
+		start:      time.Now(),
+		op:         op,
+		bkt:        bkt,
 	}
 }
 
 func (rc *timingReadCloser) Close() error {
 	err := rc.ReadCloser.Close()
 	if !rc.alreadyGotErr && err != nil {
-		rc.failed.WithLabelValues(rc.op).Inc()
+		rc.bkt.opsFailures.WithLabelValues(rc.op).Inc()
+		rc.bkt.opsFailureReasons.WithLabelValues(rc.op, FailureReason(err, rc.bkt.statusCodeResolver)).Inc()
 	}
 	if !rc.alreadyGotErr && err == nil {
-		rc.duration.WithLabelValues(rc.op).Observe(time.Since(rc.start).Seconds())
+		rc.bkt.opsDuration.WithLabelValues(rc.op).Observe(time.Since(rc.start).Seconds())
 		rc.alreadyGotErr = true
 	}
 	return err
@@ -477,11 +718,10 @@ func (rc *timingReadCloser) Close() error {
 
 func (rc *timingReadCloser) Read(b []byte) (n int, err error) {
 	n, err = rc.ReadCloser.Read(b)
+	rc.bkt.opsTransferredBytes.WithLabelValues(rc.op).Add(float64(n))
 	// Report metric just once.
 	if !rc.alreadyGotErr && err != nil && err != io.EOF {
-		if !rc.isFailureExpected(err) {
-			rc.failed.WithLabelValues(rc.op).Inc()
-		}
+		rc.bkt.observeFailure(rc.ctx, rc.op, err)
 		rc.alreadyGotErr = true
 	}
 	return n, err
@@ -4,9 +4,19 @@
 package objstore
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
@@ -14,19 +24,21 @@ import (
 func TestMetricBucket_Close(t *testing.T) {
 	bkt := BucketWithMetrics("abc", NewInMemBucket(), nil)
 	// Expected initialized metrics.
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.opsDuration))
 
 	AcceptanceTest(t, bkt.WithExpectedErrs(bkt.IsObjNotFoundErr))
-	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
+	testutil.Equals(t, float64(7), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
 	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
-	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
 	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGetRange)))
-	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
-	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
+	testutil.Equals(t, float64(7), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
 	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDeleteMultiple)))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.ops.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.ops))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpIter)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpAttributes)))
 	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpGet)))
@@ -34,22 +46,26 @@ func TestMetricBucket_Close(t *testing.T) {
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpExists)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpUpload)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpDeleteMultiple)))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.opsDuration))
 	lastUpload := promtest.ToFloat64(bkt.lastSuccessfulUploadTime)
 	testutil.Assert(t, lastUpload > 0, "last upload not greater than 0, val: %f", lastUpload)
 
 	// Clear bucket, but don't clear metrics to ensure we use same.
 	bkt.bkt = NewInMemBucket()
 	AcceptanceTest(t, bkt)
-	testutil.Equals(t, float64(12), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
+	testutil.Equals(t, float64(14), promtest.ToFloat64(bkt.ops.WithLabelValues(OpIter)))
 	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpAttributes)))
-	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
+	testutil.Equals(t, float64(8), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGet)))
 	testutil.Equals(t, float64(6), promtest.ToFloat64(bkt.ops.WithLabelValues(OpGetRange)))
-	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
-	testutil.Equals(t, float64(12), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
+	testutil.Equals(t, float64(8), promtest.ToFloat64(bkt.ops.WithLabelValues(OpExists)))
+	testutil.Equals(t, float64(14), promtest.ToFloat64(bkt.ops.WithLabelValues(OpUpload)))
 	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.ops))
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpDeleteMultiple)))
+	testutil.Equals(t, float64(4), promtest.ToFloat64(bkt.ops.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.ops))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpIter)))
 	// Not expected not found error here.
 	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpAttributes)))
@@ -59,7 +75,134 @@ func TestMetricBucket_Close(t *testing.T) {
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpExists)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpUpload)))
 	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpDelete)))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsFailures))
-	testutil.Equals(t, 7, promtest.CollectAndCount(bkt.opsDuration))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpDeleteMultiple)))
+	// Not expected not found error here.
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpCopy)))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.opsFailures))
+	testutil.Equals(t, 9, promtest.CollectAndCount(bkt.opsDuration))
 	testutil.Assert(t, promtest.ToFloat64(bkt.lastSuccessfulUploadTime) > lastUpload)
 }
+
+type statusCodeErr struct {
+	code int
+}
+
+func (e statusCodeErr) Error() string { return fmt.Sprintf("request failed with status %d", e.code) }
+
+// failingBucket fails the operations on objects named after a status code with that code.
+type failingBucket struct {
+	Bucket
+}
+
+func (b failingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if code, err := strconv.Atoi(name); err == nil {
+		return nil, errors.Wrap(statusCodeErr{code: code}, "get")
+	}
+	if name == "timeout" {
+		return nil, errors.Wrap(context.DeadlineExceeded, "get")
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b failingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if code, err := strconv.Atoi(name); err == nil {
+		return errors.Wrap(statusCodeErr{code: code}, "upload")
+	}
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func (b failingBucket) ErrStatusCode(err error) int {
+	if e, ok := errors.Cause(err).(statusCodeErr); ok {
+		return e.code
+	}
+	return 0
+}
+
+func TestMetricBucket_FailureReasonsAndTransferredBytes(t *testing.T) {
+	ctx := context.Background()
+	bkt := BucketWithMetrics("abc", failingBucket{Bucket: NewInMemBucket()}, nil)
+	// Expected initialized metrics.
+	testutil.Equals(t, 9*5, promtest.CollectAndCount(bkt.opsFailureReasons))
+	testutil.Equals(t, 3, promtest.CollectAndCount(bkt.opsTransferredBytes))
+
+	for _, name := range []string{"429", "503", "500", "502", "403", "timeout", "missing"} {
+		_, err := bkt.Get(ctx, name)
+		testutil.NotOk(t, err)
+	}
+	testutil.Equals(t, float64(7), promtest.ToFloat64(bkt.opsFailures.WithLabelValues(OpGet)))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.opsFailureReasons.WithLabelValues(OpGet, FailureThrottled)))
+	testutil.Equals(t, float64(2), promtest.ToFloat64(bkt.opsFailureReasons.WithLabelValues(OpGet, FailureServerError)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailureReasons.WithLabelValues(OpGet, FailureClientError)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailureReasons.WithLabelValues(OpGet, FailureTimeout)))
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailureReasons.WithLabelValues(OpGet, FailureOther)))
+
+	// Expected failures are not broken down either.
+	_, err := bkt.WithExpectedErrs(bkt.IsObjNotFoundErr).Get(ctx, "missing")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, float64(1), promtest.ToFloat64(bkt.opsFailureReasons.WithLabelValues(OpGet, FailureOther)))
+
+	// Readers of both known and unknown size are counted.
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("content")))
+	testutil.Ok(t, bkt.Upload(ctx, "obj2", ioutil.NopCloser(strings.NewReader("more content"))))
+	testutil.Equals(t, float64(len("content")+len("more content")), promtest.ToFloat64(bkt.opsTransferredBytes.WithLabelValues(OpUpload)))
+
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, float64(len("content")), promtest.ToFloat64(bkt.opsTransferredBytes.WithLabelValues(OpGet)))
+
+	rc, err = bkt.GetRange(ctx, "obj2", 5, 3)
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, float64(3), promtest.ToFloat64(bkt.opsTransferredBytes.WithLabelValues(OpGetRange)))
+
+	// Iter latency is observed.
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+	m := &dto.Metric{}
+	testutil.Ok(t, bkt.opsDuration.WithLabelValues(OpIter).(prometheus.Histogram).Write(m))
+	testutil.Equals(t, uint64(1), m.GetHistogram().GetSampleCount())
+}
+
+// optionalOpsBucket is a bucket implementing the optional bucket operations.
+type optionalOpsBucket struct {
+	*InMemBucket
+}
+
+func (optionalOpsBucket) CleanOrphanedObjects(context.Context, string, time.Duration) (int, error) {
+	return 3, nil
+}
+
+func (optionalOpsBucket) ExpirationRules(context.Context) ([]ExpirationRule, error) {
+	return []ExpirationRule{{ID: "expire", After: time.Hour}}, nil
+}
+
+func TestBucketWrappers_OptionalOperations(t *testing.T) {
+	ctx := context.Background()
+	for name, wrap := range map[string]func(Bucket) Bucket{
+		"metrics":     func(b Bucket) Bucket { return BucketWithMetrics("test", b, nil) },
+		"tracing":     func(b Bucket) Bucket { return NewTracingBucket(b) },
+		"retrying":    func(b Bucket) Bucket { return NewRetryingBucket(b, RetryConfig{}) },
+		"ratelimited": func(b Bucket) Bucket { return NewRateLimitedBucket(b, RateLimitConfig{}) },
+		"faulty":      func(b Bucket) Bucket { return NewFaultyBucket(b, FaultConfig{}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			bkt := wrap(NewInMemBucket())
+			_, err := bkt.(OrphanedObjectsCleaner).CleanOrphanedObjects(ctx, "", 0)
+			testutil.Assert(t, IsNotSupportedErr(err), "expected not supported error, got %v", err)
+			_, err = bkt.(ExpirationRulesReader).ExpirationRules(ctx)
+			testutil.Assert(t, IsNotSupportedErr(err), "expected not supported error, got %v", err)
+
+			bkt = wrap(optionalOpsBucket{NewInMemBucket()})
+			n, err := bkt.(OrphanedObjectsCleaner).CleanOrphanedObjects(ctx, "", 0)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 3, n)
+			rules, err := bkt.(ExpirationRulesReader).ExpirationRules(ctx)
+			testutil.Ok(t, err)
+			testutil.Equals(t, []ExpirationRule{{ID: "expire", After: time.Hour}}, rules)
+		})
+	}
+}
@@ -29,12 +29,48 @@ import (
 // Part size for multi part upload.
 const PartSize = 1024 * 1024 * 128
 
+// DefaultConfig for oss bucket.
+var DefaultConfig = Config{
+	ResumableUpload: ResumableUploadConfig{
+		PartSize:    PartSize,
+		Concurrency: 1,
+	},
+}
+
 // Config stores the configuration for oss bucket.
 type Config struct {
-	Endpoint        string `yaml:"endpoint"`
-	Bucket          string `yaml:"bucket"`
-	AccessKeyID     string `yaml:"access_key_id"`
-	AccessKeySecret string `yaml:"access_key_secret"`
+	Endpoint        string                `yaml:"endpoint"`
+	Bucket          string                `yaml:"bucket"`
+	AccessKeyID     string                `yaml:"access_key_id"`
+	AccessKeySecret string                `yaml:"access_key_secret"`
+	ResumableUpload ResumableUploadConfig `yaml:"resumable_upload"`
+}
+
+// ResumableUploadConfig configures multipart uploads of local files, which track the uploaded parts in a checkpoint
+// file on local disk, so interrupted upload of the same file can be resumed instead of restarted.
+type ResumableUploadConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CheckpointDir is the local directory for the checkpoint files. Required if enabled.
+	CheckpointDir string `yaml:"checkpoint_dir"`
+	PartSize      int64  `yaml:"part_size"`
+	// Concurrency is the number of parts uploaded in parallel.
+	Concurrency int `yaml:"concurrency"`
+}
+
+func (c ResumableUploadConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.CheckpointDir == "" {
+		return errors.New("checkpoint_dir is required for resumable upload")
+	}
+	if c.PartSize < alioss.MinPartSize || c.PartSize > alioss.MaxPartSize {
+		return errors.Errorf("part_size has to be between %d and %d bytes", alioss.MinPartSize, alioss.MaxPartSize)
+	}
+	if c.Concurrency <= 0 {
+		return errors.New("concurrency has to be greater than 0")
+	}
+	return nil
 }
 
 // Bucket implements the store.Bucket interface.
@@ -75,6 +111,20 @@ func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) error {
 		return errors.Wrapf(err, "failed to get size apriori to upload %s", name)
 	}
 
+	if f, ok := r.(*os.File); ok && b.config.ResumableUpload.Enabled && size > b.config.ResumableUpload.PartSize {
+		// Resumable upload re-reads the file by its path, so the parts already uploaded can be skipped when resuming.
+		if err := b.bucket.UploadFile(
+			name,
+			f.Name(),
+			b.config.ResumableUpload.PartSize,
+			alioss.Routines(b.config.ResumableUpload.Concurrency),
+			alioss.CheckpointDir(true, b.config.ResumableUpload.CheckpointDir),
+		); err != nil {
+			return errors.Wrap(err, "failed to upload oss object with resumable upload")
+		}
+		return nil
+	}
+
 	chunksnum, lastslice := int(math.Floor(float64(size)/PartSize)), size%PartSize
 
 	ncloser := ioutil.NopCloser(r)
@@ -132,6 +182,30 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 	return nil
 }
 
+// maxDeleteObjects is the maximum number of objects removed in a single DeleteObjects request.
+const maxDeleteObjects = 1000
+
+// DeleteMultiple removes all objects with the given names using DeleteObjects requests.
+func (b *Bucket) DeleteMultiple(_ context.Context, names []string) error {
+	for len(names) > 0 {
+		n := len(names)
+		if n > maxDeleteObjects {
+			n = maxDeleteObjects
+		}
+		if _, err := b.bucket.DeleteObjects(names[:n], alioss.DeleteObjectsQuiet(true)); err != nil {
+			return errors.Wrap(err, "delete oss objects")
+		}
+		names = names[n:]
+	}
+	return nil
+}
+
+// Copy copies the object with srcName into the dstName using server side (multipart) copy.
+func (b *Bucket) Copy(_ context.Context, srcName, dstName string) error {
+	// Error is not wrapped, so it can be checked with IsObjNotFoundErr.
+	return b.bucket.CopyFile(b.name, srcName, dstName, PartSize)
+}
+
 // Attributes returns information about the specified object.
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
 	m, err := b.bucket.GetObjectMeta(name)
@@ -159,7 +233,7 @@ func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAt
 
 // NewBucket returns a new Bucket using the provided oss config values.
 func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error) {
-	var config Config
+	config := DefaultConfig
 	if err := yaml.Unmarshal(conf, &config); err != nil {
 		return nil, errors.Wrap(err, "parse aliyun oss config file failed")
 	}
@@ -169,6 +243,15 @@ func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error
 			"is not present in config file")
 	}
 
+	if err := config.ResumableUpload.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid resumable_upload configuration")
+	}
+	if config.ResumableUpload.Enabled {
+		if err := os.MkdirAll(config.ResumableUpload.CheckpointDir, os.ModePerm); err != nil {
+			return nil, errors.Wrap(err, "create checkpoint directory")
+		}
+	}
+
 	client, err := alioss.New(config.Endpoint, config.AccessKeyID, config.AccessKeySecret)
 	if err != nil {
 		return nil, errors.Wrap(err, "create aliyun oss client failed")
@@ -191,6 +274,14 @@ func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error
 // Iter calls f for each entry in the given directory (not recursive). The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes returned by the listing.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, objstore.DirDelim) + objstore.DirDelim
 	}
@@ -207,13 +298,13 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		marker = alioss.Marker(objects.NextMarker)
 
 		for _, object := range objects.Objects {
-			if err := f(object.Key); err != nil {
+			if err := f(object.Key, objstore.ObjectAttributes{Size: object.Size, LastModified: object.LastModified}); err != nil {
 				return errors.Wrapf(err, "callback func invoke for object %s failed ", object.Key)
 			}
 		}
 
 		for _, object := range objects.CommonPrefixes {
-			if err := f(object); err != nil {
+			if err := f(object, objstore.ObjectAttributes{}); err != nil {
 				return errors.Wrapf(err, "callback func invoke for directory %s failed", object)
 			}
 		}
@@ -357,3 +448,11 @@ func (b *Bucket) IsObjNotFoundErr(err error) bool {
 	}
 	return false
 }
+
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (b *Bucket) ErrStatusCode(err error) int {
+	if aliErr, ok := errors.Cause(err).(alioss.ServiceError); ok {
+		return aliErr.StatusCode
+	}
+	return 0
+}
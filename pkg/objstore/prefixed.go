@@ -0,0 +1,145 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PrefixedBucket stores the objects of the wrapped bucket under a key prefix, so multiple installations or tenants
+// can share one bucket.
+type PrefixedBucket struct {
+	bkt    Bucket
+	prefix string
+}
+
+// NewPrefixedBucket returns a bucket, which stores the objects of bkt under the given prefix. Leading and trailing
+// slashes of prefix are ignored.
+func NewPrefixedBucket(bkt Bucket, prefix string) *PrefixedBucket {
+	return &PrefixedBucket{bkt: bkt, prefix: strings.Trim(prefix, DirDelim) + DirDelim}
+}
+
+func (b *PrefixedBucket) withPrefix(name string) string {
+	return b.prefix + name
+}
+
+func (b *PrefixedBucket) withoutPrefix(name string) string {
+	return strings.TrimPrefix(name, b.prefix)
+}
+
+func (b *PrefixedBucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.bkt.Iter(ctx, b.withPrefix(dir), func(name string) error {
+		return f(b.withoutPrefix(name))
+	})
+}
+
+func (b *PrefixedBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error) error {
+	return b.bkt.IterWithAttributes(ctx, b.withPrefix(dir), func(name string, attrs ObjectAttributes) error {
+		return f(b.withoutPrefix(name), attrs)
+	})
+}
+
+func (b *PrefixedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	// The prefix alone is not an object name, so it is not passed on.
+	if name == "" {
+		return nil, errors.New("object name is empty")
+	}
+	return b.bkt.Get(ctx, b.withPrefix(name))
+}
+
+func (b *PrefixedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if name == "" {
+		return nil, errors.New("object name is empty")
+	}
+	return b.bkt.GetRange(ctx, b.withPrefix(name), off, length)
+}
+
+func (b *PrefixedBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, b.withPrefix(name))
+}
+
+func (b *PrefixedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, b.withPrefix(name))
+}
+
+func (b *PrefixedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	return b.bkt.Upload(ctx, b.withPrefix(name), r)
+}
+
+func (b *PrefixedBucket) Copy(ctx context.Context, srcName, dstName string) error {
+	return b.bkt.Copy(ctx, b.withPrefix(srcName), b.withPrefix(dstName))
+}
+
+func (b *PrefixedBucket) Delete(ctx context.Context, name string) error {
+	return b.bkt.Delete(ctx, b.withPrefix(name))
+}
+
+func (b *PrefixedBucket) DeleteMultiple(ctx context.Context, names []string) error {
+	prefixed := make([]string, 0, len(names))
+	for _, name := range names {
+		prefixed = append(prefixed, b.withPrefix(name))
+	}
+	return b.bkt.DeleteMultiple(ctx, prefixed)
+}
+
+func (b *PrefixedBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+// ErrStatusCode implements objstore.ErrStatusCodeResolver if the underlying bucket does.
+func (b *PrefixedBucket) ErrStatusCode(err error) int {
+	if r, ok := b.bkt.(ErrStatusCodeResolver); ok {
+		return r.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it. Only the orphaned objects under the prefix of the bucket are cleaned.
+func (b *PrefixedBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := b.bkt.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, b.withPrefix(prefix), minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it. Only the rules applying to the objects under the prefix are returned, with prefixes relative
+// to it.
+func (b *PrefixedBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	r, ok := b.bkt.(ExpirationRulesReader)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	rules, err := r.ExpirationRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ExpirationRule, 0, len(rules))
+	for _, rule := range rules {
+		switch {
+		case strings.HasPrefix(b.prefix, rule.Prefix):
+			rule.Prefix = ""
+		case strings.HasPrefix(rule.Prefix, b.prefix):
+			rule.Prefix = b.withoutPrefix(rule.Prefix)
+		default:
+			continue
+		}
+		res = append(res, rule)
+	}
+	return res, nil
+}
+
+func (b *PrefixedBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *PrefixedBucket) Name() string {
+	return b.bkt.Name() + DirDelim + strings.TrimSuffix(b.prefix, DirDelim)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPrefixedBucket_Acceptance(t *testing.T) {
+	for _, prefix := range []string{"tenant", "/tenant/", "tenant/sub"} {
+		t.Run(prefix, func(t *testing.T) {
+			AcceptanceTest(t, NewPrefixedBucket(NewInMemBucket(), prefix))
+		})
+	}
+}
+
+func TestPrefixedBucket(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	bkt := NewPrefixedBucket(inmem, "/tenant/")
+	testutil.Equals(t, "inmem/tenant", bkt.Name())
+
+	testutil.Ok(t, inmem.Upload(ctx, "other/obj", strings.NewReader("other")))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/obj", strings.NewReader("data")))
+	testutil.Ok(t, bkt.Copy(ctx, "dir/obj", "dir/copy"))
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("data")))
+
+	var names []string
+	for name := range inmem.Objects() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	testutil.Equals(t, []string{"other/obj", "tenant/dir/copy", "tenant/dir/obj", "tenant/obj"}, names)
+
+	// Objects outside of the prefix are not visible.
+	var seen []string
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}))
+	sort.Strings(seen)
+	testutil.Equals(t, []string{"dir/", "obj"}, seen)
+
+	ok, err := bkt.Exists(ctx, "other/obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "object outside of the prefix should not exist")
+
+	testutil.Ok(t, bkt.DeleteMultiple(ctx, []string{"dir/obj", "dir/copy"}))
+	testutil.Ok(t, bkt.Delete(ctx, "obj"))
+	testutil.Equals(t, 1, len(inmem.Objects()))
+}
@@ -0,0 +1,245 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/thanos-io/thanos/pkg/model"
+)
+
+// RateLimitConfig configures the limits of the rate limited bucket per operation type.
+type RateLimitConfig struct {
+	// Get limits Get, GetRange, Exists and Attributes operations.
+	Get OperationRateLimit `yaml:"get"`
+	// Iter limits Iter and IterWithAttributes operations.
+	Iter OperationRateLimit `yaml:"iter"`
+	// Upload limits Upload and Copy operations.
+	Upload OperationRateLimit `yaml:"upload"`
+	// Delete limits Delete and DeleteMultiple operations.
+	Delete OperationRateLimit `yaml:"delete"`
+}
+
+// OperationRateLimit configures the limits of a single operation type. Zero values mean no limit.
+type OperationRateLimit struct {
+	// RequestsPerSecond is the maximum average rate of requests.
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// Burst is the maximum number of requests allowed to be sent at once. Defaults to 1.
+	Burst int `yaml:"burst"`
+	// BytesPerSecond is the maximum bandwidth of the transferred content. Only relevant for Get and Upload operations.
+	BytesPerSecond model.Bytes `yaml:"bytes_per_second"`
+}
+
+type operationLimiter struct {
+	requests  *rate.Limiter
+	bandwidth *rate.Limiter
+}
+
+func newOperationLimiter(c OperationRateLimit) operationLimiter {
+	l := operationLimiter{}
+	if c.RequestsPerSecond > 0 {
+		burst := c.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		l.requests = rate.NewLimiter(rate.Limit(c.RequestsPerSecond), burst)
+	}
+	if c.BytesPerSecond > 0 {
+		// Allow bursts of up to one second of traffic, which also bounds the size of a single read.
+		burst := int(math.Min(float64(c.BytesPerSecond), math.MaxInt32))
+		l.bandwidth = rate.NewLimiter(rate.Limit(c.BytesPerSecond), burst)
+	}
+	return l
+}
+
+func (l operationLimiter) wait(ctx context.Context) error {
+	if l.requests == nil {
+		return nil
+	}
+	return l.requests.Wait(ctx)
+}
+
+// RateLimitedBucket limits the rate of requests and the bandwidth of operations on the wrapped bucket,
+// so bucket scans do not saturate the object storage.
+type RateLimitedBucket struct {
+	bkt Bucket
+
+	get, iter, upload, del operationLimiter
+}
+
+// NewRateLimitedBucket returns a bucket, which blocks the operations on bkt until they are allowed by the limits.
+// NOTE: Limits apply to the calls on the returned bucket, not to the actual requests the provider makes to serve them.
+func NewRateLimitedBucket(bkt Bucket, conf RateLimitConfig) *RateLimitedBucket {
+	return &RateLimitedBucket{
+		bkt:    bkt,
+		get:    newOperationLimiter(conf.Get),
+		iter:   newOperationLimiter(conf.Iter),
+		upload: newOperationLimiter(conf.Upload),
+		del:    newOperationLimiter(conf.Delete),
+	}
+}
+
+func (b *RateLimitedBucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	if err := b.iter.wait(ctx); err != nil {
+		return err
+	}
+	return b.bkt.Iter(ctx, dir, f)
+}
+
+func (b *RateLimitedBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error) error {
+	if err := b.iter.wait(ctx); err != nil {
+		return err
+	}
+	return b.bkt.IterWithAttributes(ctx, dir, f)
+}
+
+func (b *RateLimitedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.get.wait(ctx); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return b.get.readCloser(ctx, rc), nil
+}
+
+func (b *RateLimitedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if err := b.get.wait(ctx); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return b.get.readCloser(ctx, rc), nil
+}
+
+func (b *RateLimitedBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.get.wait(ctx); err != nil {
+		return false, err
+	}
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *RateLimitedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	if err := b.get.wait(ctx); err != nil {
+		return ObjectAttributes{}, err
+	}
+	return b.bkt.Attributes(ctx, name)
+}
+
+// Upload uploads the contents of the reader as an object into the bucket.
+// NOTE: With bandwidth limit the size of the reader cannot be detected upfront by the provider.
+func (b *RateLimitedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.upload.wait(ctx); err != nil {
+		return err
+	}
+	if b.upload.bandwidth != nil {
+		r = &rateLimitedReader{ctx: ctx, r: r, limiter: b.upload.bandwidth}
+	}
+	return b.bkt.Upload(ctx, name, r)
+}
+
+func (b *RateLimitedBucket) Copy(ctx context.Context, srcName, dstName string) error {
+	if err := b.upload.wait(ctx); err != nil {
+		return err
+	}
+	return b.bkt.Copy(ctx, srcName, dstName)
+}
+
+func (b *RateLimitedBucket) Delete(ctx context.Context, name string) error {
+	if err := b.del.wait(ctx); err != nil {
+		return err
+	}
+	return b.bkt.Delete(ctx, name)
+}
+
+func (b *RateLimitedBucket) DeleteMultiple(ctx context.Context, names []string) error {
+	if err := b.del.wait(ctx); err != nil {
+		return err
+	}
+	return b.bkt.DeleteMultiple(ctx, names)
+}
+
+func (b *RateLimitedBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+// ErrStatusCode implements objstore.ErrStatusCodeResolver if the underlying bucket does.
+func (b *RateLimitedBucket) ErrStatusCode(err error) int {
+	if r, ok := b.bkt.(ErrStatusCodeResolver); ok {
+		return r.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it.
+func (b *RateLimitedBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := b.bkt.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, prefix, minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it.
+func (b *RateLimitedBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	if r, ok := b.bkt.(ExpirationRulesReader); ok {
+		return r.ExpirationRules(ctx)
+	}
+	return nil, ErrNotSupported
+}
+
+func (b *RateLimitedBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *RateLimitedBucket) Name() string {
+	return b.bkt.Name()
+}
+
+func (l operationLimiter) readCloser(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	if l.bandwidth == nil {
+		return rc
+	}
+	return &rateLimitedReadCloser{
+		ReadCloser: rc,
+		r:          rateLimitedReader{ctx: ctx, r: rc, limiter: l.bandwidth},
+	}
+}
+
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type rateLimitedReadCloser struct {
+	io.ReadCloser
+	r rateLimitedReader
+}
+
+func (r *rateLimitedReadCloser) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRateLimitedBucket_Acceptance(t *testing.T) {
+	limit := OperationRateLimit{RequestsPerSecond: 10000, Burst: 100, BytesPerSecond: 1024 * 1024}
+	AcceptanceTest(t, NewRateLimitedBucket(NewInMemBucket(), RateLimitConfig{Get: limit, Iter: limit, Upload: limit, Delete: limit}))
+}
+
+func TestRateLimitedBucket_Requests(t *testing.T) {
+	ctx := context.Background()
+	bkt := NewRateLimitedBucket(NewInMemBucket(), RateLimitConfig{
+		Get: OperationRateLimit{RequestsPerSecond: 20, Burst: 1},
+	})
+
+	// Other operations are not limited.
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader([]byte("data"))))
+	}
+	testutil.Assert(t, time.Since(start) < 200*time.Millisecond, "expected uploads to not be limited")
+
+	start = time.Now()
+	for i := 0; i < 6; i++ {
+		_, err := bkt.Exists(ctx, "obj")
+		testutil.Ok(t, err)
+	}
+	testutil.Assert(t, time.Since(start) >= 200*time.Millisecond, "expected requests to be limited, took %v", time.Since(start))
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := bkt.Get(cancelCtx, "obj")
+	testutil.NotOk(t, err)
+}
+
+func TestRateLimitedBucket_Bandwidth(t *testing.T) {
+	ctx := context.Background()
+	inmem := NewInMemBucket()
+	bkt := NewRateLimitedBucket(inmem, RateLimitConfig{
+		Get:    OperationRateLimit{BytesPerSecond: 10 * 1024},
+		Upload: OperationRateLimit{BytesPerSecond: 10 * 1024},
+	})
+	data := bytes.Repeat([]byte("a"), 15*1024)
+
+	// The first second worth of traffic is allowed in burst, the rest has to wait.
+	start := time.Now()
+	testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(data)))
+	testutil.Assert(t, time.Since(start) >= 400*time.Millisecond, "expected upload to be limited, took %v", time.Since(start))
+	testutil.Equals(t, data, inmem.Objects()["obj"])
+
+	start = time.Now()
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	content, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Assert(t, time.Since(start) >= 400*time.Millisecond, "expected download to be limited, took %v", time.Since(start))
+	testutil.Equals(t, data, content)
+}
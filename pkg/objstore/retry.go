@@ -0,0 +1,358 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"context"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultRetryMinBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+)
+
+// RetryConfig configures the retries of the failed operations.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts of an operation, including the first one.
+	// Zero or one disables the retries.
+	MaxAttempts int `yaml:"max_attempts"`
+	// MinBackoff is the wait before the first retry. It doubles with every next retry. Defaults to 100ms.
+	MinBackoff model.Duration `yaml:"min_backoff"`
+	// MaxBackoff is the maximum wait between the retries. Defaults to 10s.
+	MaxBackoff model.Duration `yaml:"max_backoff"`
+	// IsRetryable overrides the classification of the errors which are retried. Defaults to IsRetryableErr
+	// with the status code resolver of the wrapped bucket.
+	IsRetryable func(error) bool `yaml:"-"`
+}
+
+// IsRetryableErr returns true if the error is likely transient: throttling, server errors, timeouts and
+// broken connections. The resolver, which can be nil, provides the status codes of the provider errors.
+func IsRetryableErr(err error, resolver ErrStatusCodeResolver) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch FailureReason(err, resolver) {
+	case FailureThrottled, FailureServerError, FailureTimeout:
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// RetryingBucket retries the operations on the wrapped bucket failing with transient errors, waiting
+// an exponentially growing, jittered backoff between the attempts.
+type RetryingBucket struct {
+	bkt Bucket
+
+	maxAttempts            int
+	minBackoff, maxBackoff time.Duration
+	isRetryable            func(error) bool
+}
+
+// NewRetryingBucket returns a bucket, which retries the operations on bkt as configured.
+// NOTE: Uploads are only retried for readers implementing io.Seeker, as the content has to be read again.
+// Iterations are only retried if they fail before any object was passed to the callback.
+// Reads of the objects are resumed from the last read position, assuming the objects are immutable.
+func NewRetryingBucket(bkt Bucket, conf RetryConfig) *RetryingBucket {
+	b := &RetryingBucket{
+		bkt:         bkt,
+		maxAttempts: conf.MaxAttempts,
+		minBackoff:  time.Duration(conf.MinBackoff),
+		maxBackoff:  time.Duration(conf.MaxBackoff),
+		isRetryable: conf.IsRetryable,
+	}
+	if b.maxAttempts < 1 {
+		b.maxAttempts = 1
+	}
+	if b.minBackoff <= 0 {
+		b.minBackoff = defaultRetryMinBackoff
+	}
+	if b.maxBackoff <= 0 {
+		b.maxBackoff = defaultRetryMaxBackoff
+	}
+	if b.maxBackoff < b.minBackoff {
+		b.maxBackoff = b.minBackoff
+	}
+	if b.isRetryable == nil {
+		resolver, _ := bkt.(ErrStatusCodeResolver)
+		b.isRetryable = func(err error) bool { return IsRetryableErr(err, resolver) }
+	}
+	return b
+}
+
+func (b *RetryingBucket) newBackoff() *backoff.Backoff {
+	return &backoff.Backoff{Min: b.minBackoff, Max: b.maxBackoff, Factor: 2, Jitter: true}
+}
+
+func (b *RetryingBucket) shouldRetry(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !b.bkt.IsObjNotFoundErr(err) && b.isRetryable(err)
+}
+
+// retry runs f until it succeeds, fails with a non-retryable error, the attempts are exhausted or ctx is done.
+// The last error is returned. If canRetry is not nil, it has to return true for the next attempt to be made.
+func (b *RetryingBucket) retry(ctx context.Context, f func() error, canRetry func() bool) error {
+	bo := b.newBackoff()
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= b.maxAttempts || !b.shouldRetry(ctx, err) || (canRetry != nil && !canRetry()) {
+			return err
+		}
+		if !wait(ctx, bo.Duration()) {
+			return err
+		}
+	}
+}
+
+// wait returns false if ctx is done before d elapses.
+func wait(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (b *RetryingBucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	called := false
+	return b.retry(ctx, func() error {
+		return b.bkt.Iter(ctx, dir, func(name string) error {
+			called = true
+			return f(name)
+		})
+	}, func() bool { return !called })
+}
+
+func (b *RetryingBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error) error {
+	called := false
+	return b.retry(ctx, func() error {
+		return b.bkt.IterWithAttributes(ctx, dir, func(name string, attrs ObjectAttributes) error {
+			called = true
+			return f(name, attrs)
+		})
+	}, func() bool { return !called })
+}
+
+func (b *RetryingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.getRange(ctx, name, 0, -1)
+}
+
+func (b *RetryingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.getRange(ctx, name, off, length)
+}
+
+func (b *RetryingBucket) getRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	if err := b.retry(ctx, func() (err error) {
+		if off == 0 && length == -1 {
+			rc, err = b.bkt.Get(ctx, name)
+			return err
+		}
+		rc, err = b.bkt.GetRange(ctx, name, off, length)
+		return err
+	}, nil); err != nil {
+		return nil, err
+	}
+	return &retryingReadCloser{ctx: ctx, b: b, name: name, off: off, length: length, rc: rc, bo: b.newBackoff()}, nil
+}
+
+func (b *RetryingBucket) Exists(ctx context.Context, name string) (exists bool, err error) {
+	err = b.retry(ctx, func() error {
+		exists, err = b.bkt.Exists(ctx, name)
+		return err
+	}, nil)
+	return exists, err
+}
+
+func (b *RetryingBucket) Attributes(ctx context.Context, name string) (attrs ObjectAttributes, err error) {
+	err = b.retry(ctx, func() error {
+		attrs, err = b.bkt.Attributes(ctx, name)
+		return err
+	}, nil)
+	return attrs, err
+}
+
+// Upload uploads the contents of the reader as an object into the bucket.
+// If the reader implements io.Seeker, it is rewound to the initial position before every retry.
+// Other readers are uploaded in a single attempt.
+func (b *RetryingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return b.bkt.Upload(ctx, name, r)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return b.bkt.Upload(ctx, name, r)
+	}
+
+	first := true
+	return b.retry(ctx, func() error {
+		if !first {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return errors.Wrap(err, "rewind reader for retry")
+			}
+		}
+		first = false
+		return b.bkt.Upload(ctx, name, r)
+	}, nil)
+}
+
+func (b *RetryingBucket) Copy(ctx context.Context, srcName, dstName string) error {
+	return b.retry(ctx, func() error { return b.bkt.Copy(ctx, srcName, dstName) }, nil)
+}
+
+// Delete removes the object with the given name. If a retry after a transient failure finds the object
+// missing, the failed attempt is assumed to have deleted it.
+func (b *RetryingBucket) Delete(ctx context.Context, name string) error {
+	failed := false
+	return b.retry(ctx, func() error {
+		err := b.bkt.Delete(ctx, name)
+		if failed && err != nil && b.bkt.IsObjNotFoundErr(err) {
+			return nil
+		}
+		failed = err != nil
+		return err
+	}, nil)
+}
+
+func (b *RetryingBucket) DeleteMultiple(ctx context.Context, names []string) error {
+	return b.retry(ctx, func() error { return b.bkt.DeleteMultiple(ctx, names) }, nil)
+}
+
+func (b *RetryingBucket) IsObjNotFoundErr(err error) bool {
+	return b.bkt.IsObjNotFoundErr(err)
+}
+
+// ErrStatusCode implements objstore.ErrStatusCodeResolver if the underlying bucket does.
+func (b *RetryingBucket) ErrStatusCode(err error) int {
+	if r, ok := b.bkt.(ErrStatusCodeResolver); ok {
+		return r.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it.
+func (b *RetryingBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := b.bkt.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, prefix, minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it.
+func (b *RetryingBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	if r, ok := b.bkt.(ExpirationRulesReader); ok {
+		return r.ExpirationRules(ctx)
+	}
+	return nil, ErrNotSupported
+}
+
+func (b *RetryingBucket) Close() error {
+	return b.bkt.Close()
+}
+
+func (b *RetryingBucket) Name() string {
+	return b.bkt.Name()
+}
+
+// retryingReadCloser resumes reading the object from the last read position if the read fails with
+// a retryable error.
+type retryingReadCloser struct {
+	ctx          context.Context
+	b            *RetryingBucket
+	name         string
+	off, length  int64
+	rc           io.ReadCloser
+	bo           *backoff.Backoff
+	read         int64
+	retries      int
+	reopenCause  error
+	closedReader bool
+}
+
+func (r *retryingReadCloser) Read(p []byte) (int, error) {
+	if r.reopenCause != nil {
+		if err := r.reopen(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.rc.Read(p)
+	r.read += int64(n)
+	if n > 0 {
+		// Progress was made, retries are counted from scratch for the next failure.
+		r.retries = 0
+		r.bo.Reset()
+	}
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	if r.length >= 0 && r.read >= r.length {
+		return n, io.EOF
+	}
+	if r.retries >= r.b.maxAttempts-1 || !r.b.shouldRetry(r.ctx, err) {
+		return n, err
+	}
+
+	r.reopenCause = err
+	if n > 0 {
+		return n, nil
+	}
+	return r.Read(p)
+}
+
+// reopen closes the failed reader and gets the remaining part of the object, retrying as configured.
+func (r *retryingReadCloser) reopen() error {
+	if !r.closedReader {
+		_ = r.rc.Close()
+		r.closedReader = true
+	}
+
+	err := r.reopenCause
+	for r.retries < r.b.maxAttempts-1 {
+		r.retries++
+		if !wait(r.ctx, r.bo.Duration()) {
+			return err
+		}
+
+		length := int64(-1)
+		if r.length >= 0 {
+			length = r.length - r.read
+		}
+		rc, gerr := r.b.bkt.GetRange(r.ctx, r.name, r.off+r.read, length)
+		if gerr == nil {
+			r.rc = rc
+			r.closedReader = false
+			r.reopenCause = nil
+			return nil
+		}
+		err = errors.Wrapf(gerr, "resume read of %s at %d after: %v", r.name, r.off+r.read, r.reopenCause)
+		if !r.b.shouldRetry(r.ctx, gerr) {
+			break
+		}
+	}
+	return err
+}
+
+func (r *retryingReadCloser) Close() error {
+	if r.closedReader {
+		return nil
+	}
+	r.closedReader = true
+	return r.rc.Close()
+}
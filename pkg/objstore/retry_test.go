@@ -0,0 +1,303 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+var testRetryConfig = RetryConfig{MaxAttempts: 3, MinBackoff: model.Duration(time.Millisecond), MaxBackoff: model.Duration(5 * time.Millisecond)}
+
+// flakyBucket fails the operations with the queued errors before passing them to the wrapped bucket.
+// Readers it returns fail with a connection reset after breakAfter bytes, the first breaks times.
+type flakyBucket struct {
+	Bucket
+	errs  []error
+	calls int
+
+	breakAfter int64
+	breaks     int
+	ranges     [][2]int64
+}
+
+func (b *flakyBucket) fail() error {
+	b.calls++
+	if len(b.errs) == 0 {
+		return nil
+	}
+	err := b.errs[0]
+	b.errs = b.errs[1:]
+	return err
+}
+
+func (b *flakyBucket) reader(rc io.ReadCloser) io.ReadCloser {
+	if b.breaks == 0 {
+		return rc
+	}
+	b.breaks--
+	return struct {
+		io.Reader
+		io.Closer
+	}{Reader: io.MultiReader(io.LimitReader(rc, b.breakAfter), errReader{err: errors.Wrap(syscall.ECONNRESET, "read")}), Closer: rc}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func (b *flakyBucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	if err := b.fail(); err != nil {
+		return err
+	}
+	return b.Bucket.Iter(ctx, dir, f)
+}
+
+func (b *flakyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return b.reader(rc), nil
+}
+
+func (b *flakyBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.ranges = append(b.ranges, [2]int64{off, length})
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return b.reader(rc), nil
+}
+
+func (b *flakyBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.fail(); err != nil {
+		return false, err
+	}
+	return b.Bucket.Exists(ctx, name)
+}
+
+func (b *flakyBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.fail(); err != nil {
+		// Consume part of the content, like a failed request would.
+		_, _ = io.CopyN(ioutil.Discard, r, 2)
+		return err
+	}
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func (b *flakyBucket) Delete(ctx context.Context, name string) error {
+	if err := b.fail(); err != nil {
+		// Failed after the object was deleted.
+		_ = b.Bucket.Delete(ctx, name)
+		return err
+	}
+	return b.Bucket.Delete(ctx, name)
+}
+
+func (b *flakyBucket) ErrStatusCode(err error) int {
+	if e, ok := errors.Cause(err).(statusCodeErr); ok {
+		return e.code
+	}
+	return 0
+}
+
+func TestRetryingBucket_Acceptance(t *testing.T) {
+	AcceptanceTest(t, NewRetryingBucket(NewInMemBucket(), testRetryConfig))
+}
+
+func TestIsRetryableErr(t *testing.T) {
+	resolver := &flakyBucket{}
+	for _, tcase := range []struct {
+		err      error
+		expected bool
+	}{
+		{err: statusCodeErr{code: 429}, expected: true},
+		{err: errors.Wrap(statusCodeErr{code: 503}, "get"), expected: true},
+		{err: statusCodeErr{code: 500}, expected: true},
+		{err: statusCodeErr{code: 403}},
+		{err: statusCodeErr{code: 404}},
+		{err: errors.Wrap(context.DeadlineExceeded, "get"), expected: true},
+		{err: errors.Wrap(context.Canceled, "get")},
+		{err: errors.Wrap(syscall.ECONNRESET, "read"), expected: true},
+		{err: io.ErrUnexpectedEOF, expected: true},
+		{err: errors.New("invalid config")},
+	} {
+		testutil.Equals(t, tcase.expected, IsRetryableErr(tcase.err, resolver), "%v", tcase.err)
+	}
+	testutil.Assert(t, !IsRetryableErr(statusCodeErr{code: 503}, nil), "expected status code to be unknown without resolver")
+}
+
+func TestRetryingBucket_Retries(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyBucket{Bucket: NewInMemBucket()}
+	bkt := NewRetryingBucket(flaky, testRetryConfig)
+	testutil.Ok(t, flaky.Bucket.Upload(ctx, "obj", strings.NewReader("data")))
+
+	// Transient errors are retried.
+	flaky.errs = []error{statusCodeErr{code: 503}, errors.Wrap(syscall.ECONNRESET, "exists")}
+	exists, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists, "expected object to exist")
+	testutil.Equals(t, 3, flaky.calls)
+
+	// Up to max attempts.
+	flaky.calls = 0
+	flaky.errs = []error{statusCodeErr{code: 500}, statusCodeErr{code: 500}, statusCodeErr{code: 500}, statusCodeErr{code: 500}}
+	_, err = bkt.Exists(ctx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 500, bkt.ErrStatusCode(err))
+	testutil.Equals(t, 3, flaky.calls)
+
+	// Other errors are not retried.
+	flaky.calls = 0
+	flaky.errs = []error{statusCodeErr{code: 403}}
+	_, err = bkt.Get(ctx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 1, flaky.calls)
+
+	flaky.calls = 0
+	flaky.errs = nil
+	_, err = bkt.Get(ctx, "missing")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error")
+	testutil.Equals(t, 1, flaky.calls)
+
+	// Retries stop with the context.
+	flaky.calls = 0
+	flaky.errs = []error{statusCodeErr{code: 503}, statusCodeErr{code: 503}}
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = bkt.Exists(cancelCtx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 1, flaky.calls)
+
+	// Custom classification.
+	flaky.calls = 0
+	flaky.errs = []error{errors.New("custom")}
+	exists, err = NewRetryingBucket(flaky, RetryConfig{
+		MaxAttempts: 2,
+		MinBackoff:  model.Duration(time.Millisecond),
+		IsRetryable: func(err error) bool { return err.Error() == "custom" },
+	}).Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, exists, "expected object to exist")
+	testutil.Equals(t, 2, flaky.calls)
+}
+
+func TestRetryingBucket_Upload(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyBucket{Bucket: NewInMemBucket()}
+	bkt := NewRetryingBucket(flaky, testRetryConfig)
+
+	// Seekable readers are rewound to the initial position.
+	r := strings.NewReader("xxdata")
+	_, err := r.Seek(2, io.SeekStart)
+	testutil.Ok(t, err)
+	flaky.errs = []error{statusCodeErr{code: 503}, statusCodeErr{code: 503}}
+	testutil.Ok(t, bkt.Upload(ctx, "obj", r))
+	testutil.Equals(t, 3, flaky.calls)
+	testutil.Equals(t, []byte("data"), flaky.Bucket.(*InMemBucket).Objects()["obj"])
+
+	// Others can't be read again.
+	flaky.calls = 0
+	flaky.errs = []error{statusCodeErr{code: 503}}
+	testutil.NotOk(t, bkt.Upload(ctx, "obj2", bytes.NewBufferString("data")))
+	testutil.Equals(t, 1, flaky.calls)
+}
+
+func TestRetryingBucket_Iter(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyBucket{Bucket: NewInMemBucket()}
+	bkt := NewRetryingBucket(flaky, testRetryConfig)
+	testutil.Ok(t, flaky.Bucket.Upload(ctx, "a", strings.NewReader("a")))
+	testutil.Ok(t, flaky.Bucket.Upload(ctx, "b", strings.NewReader("b")))
+
+	var seen []string
+	flaky.errs = []error{statusCodeErr{code: 503}}
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		seen = append(seen, name)
+		return nil
+	}))
+	testutil.Equals(t, []string{"a", "b"}, seen)
+	testutil.Equals(t, 2, flaky.calls)
+
+	// Failures after the objects were passed to the callback are not retried, not to pass them again.
+	flaky.calls = 0
+	cbErr := errors.Wrap(statusCodeErr{code: 503}, "callback")
+	testutil.Equals(t, cbErr, bkt.Iter(ctx, "", func(string) error { return cbErr }))
+	testutil.Equals(t, 1, flaky.calls)
+}
+
+func TestRetryingBucket_Delete(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyBucket{Bucket: NewInMemBucket()}
+	bkt := NewRetryingBucket(flaky, testRetryConfig)
+	testutil.Ok(t, flaky.Bucket.Upload(ctx, "obj", strings.NewReader("data")))
+
+	// The failed attempt deleted the object.
+	flaky.errs = []error{statusCodeErr{code: 503}}
+	testutil.Ok(t, bkt.Delete(ctx, "obj"))
+	testutil.Equals(t, 2, flaky.calls)
+
+	err := bkt.Delete(ctx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error")
+}
+
+func TestRetryingBucket_ResumesReads(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyBucket{Bucket: NewInMemBucket()}
+	bkt := NewRetryingBucket(flaky, testRetryConfig)
+	data := []byte("0123456789abcdefghij")
+	testutil.Ok(t, flaky.Bucket.Upload(ctx, "obj", bytes.NewReader(data)))
+
+	// Each reader fails after 3 bytes, but progress is made, so reads are resumed more times than max attempts.
+	flaky.breakAfter, flaky.breaks = 3, 4
+	rc, err := bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	content, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, data, content)
+	testutil.Equals(t, [][2]int64{{3, -1}, {6, -1}, {9, -1}, {12, -1}}, flaky.ranges)
+
+	flaky.ranges = nil
+	flaky.breakAfter, flaky.breaks = 2, 2
+	rc, err = bkt.GetRange(ctx, "obj", 5, 10)
+	testutil.Ok(t, err)
+	content, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, data[5:15], content)
+	testutil.Equals(t, [][2]int64{{5, 10}, {7, 8}, {9, 6}}, flaky.ranges)
+
+	// Resuming stops without progress.
+	flaky.ranges = nil
+	flaky.breakAfter, flaky.breaks = 0, 10
+	rc, err = bkt.Get(ctx, "obj")
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, syscall.ECONNRESET), "unexpected error %v", err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, 2, len(flaky.ranges))
+}
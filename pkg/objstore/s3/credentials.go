@@ -0,0 +1,289 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// Credential providers which can be used in credentials_chain.
+const (
+	// StaticCredentials uses access_key and secret_key from the config.
+	StaticCredentials = "static"
+	// EnvCredentials uses the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+	EnvCredentials = "env"
+	// FileCredentials uses the AWS shared credentials file.
+	FileCredentials = "file"
+	// WebIdentityCredentials uses AssumeRoleWithWebIdentity as configured in web_identity, e.g. for EKS IRSA.
+	WebIdentityCredentials = "web_identity"
+	// IAMCredentials uses the EC2 instance metadata or ECS task role. It also handles web identity configured
+	// with the AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE environment variables.
+	IAMCredentials = "iam"
+)
+
+// WebIdentityConfig configures credentials obtained with AssumeRoleWithWebIdentity.
+type WebIdentityConfig struct {
+	RoleARN string `yaml:"role_arn"`
+	// TokenFile is the path to the OIDC token. It is read on every credentials refresh, as the token is rotated.
+	TokenFile       string `yaml:"token_file"`
+	RoleSessionName string `yaml:"role_session_name"`
+}
+
+// AssumeRoleConfig configures a role assumed with the credentials obtained from the credentials chain,
+// e.g. to access a bucket in another account.
+type AssumeRoleConfig struct {
+	RoleARN         string         `yaml:"role_arn"`
+	RoleSessionName string         `yaml:"role_session_name"`
+	ExternalID      string         `yaml:"external_id"`
+	Duration        model.Duration `yaml:"duration"`
+}
+
+func validateCredentialsConfig(conf Config) error {
+	for _, p := range conf.CredentialsChain {
+		switch p {
+		case StaticCredentials:
+			if conf.AccessKey == "" {
+				return errors.New("access_key and secret_key must be set to use the static credentials provider")
+			}
+		case WebIdentityCredentials:
+			if conf.WebIdentity.TokenFile == "" || conf.WebIdentity.RoleARN == "" {
+				return errors.New("web_identity.role_arn and web_identity.token_file must be set to use the web_identity credentials provider")
+			}
+		case EnvCredentials, FileCredentials, IAMCredentials:
+		default:
+			return errors.Errorf("unsupported credentials provider %q in credentials_chain; supported are static, env, file, web_identity, iam", p)
+		}
+	}
+
+	if (conf.WebIdentity.TokenFile == "") != (conf.WebIdentity.RoleARN == "") {
+		return errors.New("web_identity.role_arn and web_identity.token_file must be set together")
+	}
+	if conf.AssumeRole.RoleARN == "" && (conf.AssumeRole.RoleSessionName != "" || conf.AssumeRole.ExternalID != "" || conf.AssumeRole.Duration != 0) {
+		return errors.New("assume_role.role_arn must be set if any other assume_role option is set")
+	}
+	return nil
+}
+
+// credentialsChain returns the credential providers for the given config. Without credentials_chain, static
+// credentials are used if access_key is set, web identity if web_identity is set, and the environment, the shared
+// credentials file and IAM otherwise.
+func credentialsChain(conf Config, rt http.RoundTripper) []credentials.Provider {
+	names := conf.CredentialsChain
+	if len(names) == 0 {
+		switch {
+		case conf.AccessKey != "":
+			names = []string{StaticCredentials}
+		case conf.WebIdentity.TokenFile != "":
+			names = []string{WebIdentityCredentials}
+		default:
+			names = []string{EnvCredentials, FileCredentials, IAMCredentials}
+		}
+	}
+
+	chain := make([]credentials.Provider, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case StaticCredentials:
+			signature := credentials.SignatureV4
+			// TODO(bwplotka): Don't do flags, use actual v2, v4 params.
+			if conf.SignatureV2 {
+				signature = credentials.SignatureV2
+			}
+
+			chain = append(chain, &credentials.Static{
+				Value: credentials.Value{
+					AccessKeyID:     conf.AccessKey,
+					SecretAccessKey: conf.SecretKey,
+					SignerType:      signature,
+				},
+			})
+		case EnvCredentials:
+			chain = append(chain, &credentials.EnvAWS{})
+		case FileCredentials:
+			chain = append(chain, &credentials.FileAWSCredentials{})
+		case WebIdentityCredentials:
+			chain = append(chain, &webIdentityProvider{
+				client:   &http.Client{Transport: rt},
+				endpoint: stsEndpoint(conf),
+				conf:     conf.WebIdentity,
+			})
+		case IAMCredentials:
+			chain = append(chain, &credentials.IAM{
+				Client: &http.Client{
+					Transport: http.DefaultTransport,
+				},
+			})
+		}
+	}
+
+	if conf.AssumeRole.RoleARN == "" {
+		return chain
+	}
+	return []credentials.Provider{&assumeRoleProvider{
+		client:   &http.Client{Transport: rt},
+		endpoint: stsEndpoint(conf),
+		region:   stsRegion(conf),
+		source:   credentials.NewChainCredentials(chain),
+		conf:     conf.AssumeRole,
+	}}
+}
+
+func stsEndpoint(conf Config) string {
+	if conf.STSEndpoint != "" {
+		return conf.STSEndpoint
+	}
+	if conf.Region != "" {
+		return "https://sts." + conf.Region + ".amazonaws.com"
+	}
+	return "https://sts.amazonaws.com"
+}
+
+func stsRegion(conf Config) string {
+	if conf.Region != "" {
+		return conf.Region
+	}
+	return "us-east-1"
+}
+
+// webIdentityProvider retrieves credentials with AssumeRoleWithWebIdentity.
+type webIdentityProvider struct {
+	credentials.Expiry
+
+	client   *http.Client
+	endpoint string
+	conf     WebIdentityConfig
+}
+
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.conf.TokenFile)
+	if err != nil {
+		return credentials.Value{}, errors.Wrap(err, "read web identity token")
+	}
+
+	v := url.Values{}
+	v.Set("Action", "AssumeRoleWithWebIdentity")
+	v.Set("Version", "2011-06-15")
+	v.Set("RoleArn", p.conf.RoleARN)
+	v.Set("RoleSessionName", roleSessionName(p.conf.RoleSessionName))
+	v.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp credentials.AssumeRoleWithWebIdentityResponse
+	if err := doSTSRequest(p.client, req, &resp); err != nil {
+		return credentials.Value{}, errors.Wrap(err, "assume role with web identity")
+	}
+
+	creds := resp.Result.Credentials
+	p.SetExpiration(creds.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKey,
+		SecretAccessKey: creds.SecretKey,
+		SessionToken:    creds.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// assumeRoleProvider retrieves credentials with AssumeRole, signing the request with the source credentials.
+type assumeRoleProvider struct {
+	credentials.Expiry
+
+	client   *http.Client
+	endpoint string
+	region   string
+	source   *credentials.Credentials
+	conf     AssumeRoleConfig
+}
+
+func (p *assumeRoleProvider) Retrieve() (credentials.Value, error) {
+	src, err := p.source.Get()
+	if err != nil {
+		return credentials.Value{}, errors.Wrap(err, "get source credentials")
+	}
+	if src.AccessKeyID == "" {
+		return credentials.Value{}, errors.New("no source credentials found to assume role with")
+	}
+
+	v := url.Values{}
+	v.Set("Action", "AssumeRole")
+	v.Set("Version", "2011-06-15")
+	v.Set("RoleArn", p.conf.RoleARN)
+	v.Set("RoleSessionName", roleSessionName(p.conf.RoleSessionName))
+	if p.conf.ExternalID != "" {
+		v.Set("ExternalId", p.conf.ExternalID)
+	}
+	if p.conf.Duration != 0 {
+		v.Set("DurationSeconds", strconv.Itoa(int(time.Duration(p.conf.Duration).Seconds())))
+	}
+	body := v.Encode()
+	hash := sha256.Sum256([]byte(body))
+
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, strings.NewReader(body))
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	// SignV4STS does not handle session tokens, set before signing so the header is signed too.
+	if src.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", src.SessionToken)
+	}
+	req = signer.SignV4STS(*req, src.AccessKeyID, src.SecretAccessKey, p.region)
+
+	var resp credentials.AssumeRoleResponse
+	if err := doSTSRequest(p.client, req, &resp); err != nil {
+		return credentials.Value{}, errors.Wrapf(err, "assume role %s", p.conf.RoleARN)
+	}
+
+	creds := resp.Result.Credentials
+	p.SetExpiration(creds.Expiration, credentials.DefaultExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKey,
+		SecretAccessKey: creds.SecretKey,
+		SessionToken:    creds.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func roleSessionName(name string) string {
+	if name != "" {
+		return name
+	}
+	return "thanos-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+func doSTSRequest(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("unexpected response %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return errors.Wrap(xml.NewDecoder(resp.Body).Decode(v), "decode response")
+}
@@ -0,0 +1,213 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package s3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/prometheus/common/model"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+const stsResponse = `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>%[2]s</AccessKeyId>
+      <SecretAccessKey>secret-%[2]s</SecretAccessKey>
+      <SessionToken>token-%[2]s</SessionToken>
+      <Expiration>%[3]s</Expiration>
+    </Credentials>
+  </%[1]sResult>
+</%[1]sResponse>`
+
+// fakeSTS answers AssumeRoleWithWebIdentity and AssumeRole requests, issuing credentials named after the role.
+type fakeSTS struct {
+	t        *testing.T
+	requests []*http.Request
+}
+
+func (s *fakeSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	testutil.Ok(s.t, r.ParseForm())
+	s.requests = append(s.requests, r)
+
+	action := r.PostForm.Get("Action")
+	if r.PostForm.Get("RoleArn") == "arn:aws:iam::111122223333:role/denied" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<ErrorResponse><Error><Code>AccessDenied</Code></Error></ErrorResponse>"))
+		return
+	}
+	role := r.PostForm.Get("RoleArn")
+	_, _ = fmt.Fprintf(w, stsResponse, action, role[strings.LastIndex(role, "/")+1:], time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+}
+
+func TestCredentialsChain_WebIdentity(t *testing.T) {
+	sts := &fakeSTS{t: t}
+	srv := httptest.NewServer(sts)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "s3-credentials")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+	tokenFile := filepath.Join(dir, "token")
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("jwt-1\n"), 0600))
+
+	conf := DefaultConfig
+	conf.Endpoint = "s3-endpoint"
+	conf.STSEndpoint = srv.URL
+	conf.WebIdentity = WebIdentityConfig{RoleARN: "arn:aws:iam::111122223333:role/thanos", TokenFile: tokenFile, RoleSessionName: "store"}
+	testutil.Ok(t, validate(conf))
+
+	creds := credentials.NewChainCredentials(credentialsChain(conf, http.DefaultTransport))
+	v, err := creds.Get()
+	testutil.Ok(t, err)
+	testutil.Equals(t, credentials.Value{AccessKeyID: "thanos", SecretAccessKey: "secret-thanos", SessionToken: "token-thanos", SignerType: credentials.SignatureV4}, v)
+
+	testutil.Equals(t, 1, len(sts.requests))
+	form := sts.requests[0].PostForm
+	testutil.Equals(t, "AssumeRoleWithWebIdentity", form.Get("Action"))
+	testutil.Equals(t, "arn:aws:iam::111122223333:role/thanos", form.Get("RoleArn"))
+	testutil.Equals(t, "store", form.Get("RoleSessionName"))
+	testutil.Equals(t, "jwt-1", form.Get("WebIdentityToken"))
+
+	// Rotated token is used on refresh.
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("jwt-2"), 0600))
+	creds.Expire()
+	_, err = creds.Get()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(sts.requests))
+	testutil.Equals(t, "jwt-2", sts.requests[1].PostForm.Get("WebIdentityToken"))
+}
+
+func TestCredentialsChain_AssumeRole(t *testing.T) {
+	sts := &fakeSTS{t: t}
+	srv := httptest.NewServer(sts)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "s3-credentials")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+	tokenFile := filepath.Join(dir, "token")
+	testutil.Ok(t, ioutil.WriteFile(tokenFile, []byte("jwt"), 0600))
+
+	conf := DefaultConfig
+	conf.Endpoint = "s3-endpoint"
+	conf.Region = "eu-west-1"
+	conf.STSEndpoint = srv.URL
+	conf.WebIdentity = WebIdentityConfig{RoleARN: "arn:aws:iam::111122223333:role/source", TokenFile: tokenFile}
+	conf.AssumeRole = AssumeRoleConfig{
+		RoleARN:    "arn:aws:iam::444455556666:role/target",
+		ExternalID: "ext",
+		Duration:   model.Duration(15 * time.Minute),
+	}
+	testutil.Ok(t, validate(conf))
+
+	v, err := credentials.NewChainCredentials(credentialsChain(conf, http.DefaultTransport)).Get()
+	testutil.Ok(t, err)
+	testutil.Equals(t, "target", v.AccessKeyID)
+	testutil.Equals(t, "token-target", v.SessionToken)
+
+	testutil.Equals(t, 2, len(sts.requests))
+	testutil.Equals(t, "AssumeRoleWithWebIdentity", sts.requests[0].PostForm.Get("Action"))
+	assumeRole := sts.requests[1]
+	testutil.Equals(t, "AssumeRole", assumeRole.PostForm.Get("Action"))
+	testutil.Equals(t, "arn:aws:iam::444455556666:role/target", assumeRole.PostForm.Get("RoleArn"))
+	testutil.Equals(t, "ext", assumeRole.PostForm.Get("ExternalId"))
+	testutil.Equals(t, "900", assumeRole.PostForm.Get("DurationSeconds"))
+	testutil.Assert(t, strings.HasPrefix(assumeRole.PostForm.Get("RoleSessionName"), "thanos-"), "expected default role session name")
+
+	// Signed with the source credentials, including the session token.
+	auth := assumeRole.Header.Get("Authorization")
+	testutil.Assert(t, strings.Contains(auth, "Credential=source/"), "unexpected authorization header %q", auth)
+	testutil.Assert(t, strings.Contains(auth, "/eu-west-1/sts/aws4_request"), "unexpected authorization header %q", auth)
+	testutil.Assert(t, strings.Contains(auth, "x-amz-security-token"), "expected session token to be signed, got %q", auth)
+	testutil.Equals(t, "token-source", assumeRole.Header.Get("X-Amz-Security-Token"))
+
+	// Errors are reported.
+	conf.AssumeRole.RoleARN = "arn:aws:iam::111122223333:role/denied"
+	p := credentialsChain(conf, http.DefaultTransport)
+	testutil.Equals(t, 1, len(p))
+	_, err = p[0].Retrieve()
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "AccessDenied"), "unexpected error %v", err)
+}
+
+func TestCredentialsChain_Order(t *testing.T) {
+	conf := DefaultConfig
+	conf.Endpoint = "s3-endpoint"
+	conf.AccessKey = "static-key"
+	conf.SecretKey = "static-secret"
+
+	for _, tcase := range []struct {
+		chain    []string
+		expected []credentials.Provider
+	}{
+		{
+			expected: []credentials.Provider{&credentials.Static{}},
+		},
+		{
+			chain:    []string{EnvCredentials, StaticCredentials},
+			expected: []credentials.Provider{&credentials.EnvAWS{}, &credentials.Static{}},
+		},
+		{
+			chain:    []string{IAMCredentials, FileCredentials},
+			expected: []credentials.Provider{&credentials.IAM{}, &credentials.FileAWSCredentials{}},
+		},
+	} {
+		conf.CredentialsChain = tcase.chain
+		testutil.Ok(t, validate(conf))
+
+		chain := credentialsChain(conf, http.DefaultTransport)
+		testutil.Equals(t, len(tcase.expected), len(chain))
+		for i := range chain {
+			testutil.Equals(t, fmt.Sprintf("%T", tcase.expected[i]), fmt.Sprintf("%T", chain[i]))
+		}
+	}
+
+	// Environment is tried before the static credentials.
+	testutil.Ok(t, os.Setenv("AWS_ACCESS_KEY_ID", "env-key"))
+	testutil.Ok(t, os.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret"))
+	defer func() {
+		testutil.Ok(t, os.Unsetenv("AWS_ACCESS_KEY_ID"))
+		testutil.Ok(t, os.Unsetenv("AWS_SECRET_ACCESS_KEY"))
+	}()
+	conf.CredentialsChain = []string{EnvCredentials, StaticCredentials}
+	v, err := credentials.NewChainCredentials(credentialsChain(conf, http.DefaultTransport)).Get()
+	testutil.Ok(t, err)
+	testutil.Equals(t, "env-key", v.AccessKeyID)
+}
+
+func TestValidate_CredentialsConfig(t *testing.T) {
+	for _, tcase := range []struct {
+		input     string
+		expectErr bool
+	}{
+		{input: "credentials_chain: [env, file, iam]"},
+		{input: "credentials_chain: [env, ec2]", expectErr: true},
+		{input: "credentials_chain: [static]", expectErr: true},
+		{input: "credentials_chain: [static]\naccess_key: key\nsecret_key: secret"},
+		{input: "credentials_chain: [web_identity]", expectErr: true},
+		{input: "web_identity:\n  role_arn: arn:aws:iam::111122223333:role/thanos", expectErr: true},
+		{input: "web_identity:\n  role_arn: arn:aws:iam::111122223333:role/thanos\n  token_file: /var/run/token"},
+		{input: "credentials_chain: [web_identity, iam]\nweb_identity:\n  role_arn: arn:aws:iam::111122223333:role/thanos\n  token_file: /var/run/token"},
+		{input: "assume_role:\n  role_arn: arn:aws:iam::111122223333:role/thanos\n  external_id: ext\n  duration: 1h"},
+		{input: "assume_role:\n  external_id: ext", expectErr: true},
+	} {
+		cfg, err := parseConfig([]byte("bucket: abdd\nendpoint: \"s3-endpoint\"\n" + tcase.input))
+		testutil.Ok(t, err)
+		if tcase.expectErr {
+			testutil.NotOk(t, validate(cfg), tcase.input)
+			continue
+		}
+		testutil.Ok(t, validate(cfg), tcase.input)
+	}
+}
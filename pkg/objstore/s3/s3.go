@@ -13,6 +13,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -24,11 +25,14 @@ import (
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
+	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
 	"gopkg.in/yaml.v2"
 )
 
@@ -73,15 +77,54 @@ type Config struct {
 	// PartSize used for multipart upload. Only used if uploaded object size is known and larger than configured PartSize.
 	PartSize  uint64    `yaml:"part_size"`
 	SSEConfig SSEConfig `yaml:"sse_config"`
+	// STSEndpoint is used for web_identity and assume_role. Defaults to the regional AWS STS endpoint.
+	STSEndpoint string `yaml:"sts_endpoint"`
+	// CredentialsChain is the ordered list of credential providers tried, the first one returning credentials is used.
+	CredentialsChain []string          `yaml:"credentials_chain"`
+	WebIdentity      WebIdentityConfig `yaml:"web_identity"`
+	AssumeRole       AssumeRoleConfig  `yaml:"assume_role"`
 }
 
 // SSEConfig deals with the configuration of SSE for Minio. The following options are valid:
 // kmsencryptioncontext == https://docs.aws.amazon.com/kms/latest/developerguide/services-s3.html#s3-encryption-context
+// bucketkeyenabled == https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucket-key.html
 type SSEConfig struct {
-	Type                 string            `yaml:"type"`
+	Type string `yaml:"type"`
+	// KMSKeyID can be a key ID, a key ARN, an alias name (alias/<name>) or an alias ARN.
 	KMSKeyID             string            `yaml:"kms_key_id"`
 	KMSEncryptionContext map[string]string `yaml:"kms_encryption_context"`
-	EncryptionKey        string            `yaml:"encryption_key"`
+	// BucketKeyEnabled enables S3 Bucket Keys for SSE-KMS, reducing the number of requests made from S3 to KMS.
+	BucketKeyEnabled bool   `yaml:"bucket_key_enabled"`
+	EncryptionKey    string `yaml:"encryption_key"`
+}
+
+// kmsKeyARNRegexp matches ARNs of KMS keys and aliases, e.g. arn:aws:kms:us-east-1:111122223333:alias/thanos.
+var kmsKeyARNRegexp = regexp.MustCompile(`^arn:aws[a-z-]*:kms:[a-z0-9-]+:[0-9]{12}:(key|alias)/[a-zA-Z0-9/_-]+$`)
+
+// validateKMSKeyID checks the AWS specific key ID formats. Other values are passed as they are, as S3 compatible
+// storages use their own key naming.
+func validateKMSKeyID(keyID string) error {
+	switch {
+	case strings.HasPrefix(keyID, "arn:"):
+		if !kmsKeyARNRegexp.MatchString(keyID) {
+			return errors.Errorf("kms_key_id %q is not a valid KMS key or alias ARN", keyID)
+		}
+	case strings.HasPrefix(keyID, "alias/"):
+		if keyID == "alias/" {
+			return errors.New("kms_key_id alias name must not be empty")
+		}
+	}
+	return nil
+}
+
+// sseKMSWithBucketKey enables S3 Bucket Keys on top of SSE-KMS.
+type sseKMSWithBucketKey struct {
+	encrypt.ServerSide
+}
+
+func (s sseKMSWithBucketKey) Marshal(h http.Header) {
+	s.ServerSide.Marshal(h)
+	h.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", "true")
 }
 
 type TraceConfig struct {
@@ -163,36 +206,9 @@ func NewBucket(logger log.Logger, conf []byte, component string) (*Bucket, error
 
 // NewBucketWithConfig returns a new Bucket using the provided s3 config values.
 func NewBucketWithConfig(logger log.Logger, config Config, component string) (*Bucket, error) {
-	var chain []credentials.Provider
-
 	if err := validate(config); err != nil {
 		return nil, err
 	}
-	if config.AccessKey != "" {
-		signature := credentials.SignatureV4
-		// TODO(bwplotka): Don't do flags, use actual v2, v4 params.
-		if config.SignatureV2 {
-			signature = credentials.SignatureV2
-		}
-
-		chain = []credentials.Provider{&credentials.Static{
-			Value: credentials.Value{
-				AccessKeyID:     config.AccessKey,
-				SecretAccessKey: config.SecretKey,
-				SignerType:      signature,
-			},
-		}}
-	} else {
-		chain = []credentials.Provider{
-			&credentials.EnvAWS{},
-			&credentials.FileAWSCredentials{},
-			&credentials.IAM{
-				Client: &http.Client{
-					Transport: http.DefaultTransport,
-				},
-			},
-		}
-	}
 
 	// Check if a roundtripper has been set in the config
 	// otherwise build the default transport.
@@ -203,11 +219,13 @@ func NewBucketWithConfig(logger log.Logger, config Config, component string) (*B
 		rt = DefaultTransport(config)
 	}
 
+	chain := credentialsChain(config, rt)
+
 	client, err := minio.New(config.Endpoint, &minio.Options{
 		Creds:     credentials.NewChainCredentials(chain),
 		Secure:    !config.Insecure,
 		Region:    config.Region,
-		Transport: rt,
+		Transport: tracing.HTTPPropagationTripperware(rt),
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "initialize s3 client")
@@ -222,6 +240,9 @@ func NewBucketWithConfig(logger log.Logger, config Config, component string) (*B
 			if err != nil {
 				return nil, errors.Wrap(err, "initialize s3 client SSE-KMS")
 			}
+			if config.SSEConfig.BucketKeyEnabled {
+				sse = sseKMSWithBucketKey{ServerSide: sse}
+			}
 
 		case SSEC:
 			key, err := ioutil.ReadFile(config.SSEConfig.EncryptionKey)
@@ -291,7 +312,17 @@ func validate(conf Config) error {
 		return errors.New("kms_key_id must be set if sse_config.type is set to 'SSE-KMS'")
 	}
 
-	return nil
+	if conf.SSEConfig.Type == SSEKMS {
+		if err := validateKMSKeyID(conf.SSEConfig.KMSKeyID); err != nil {
+			return err
+		}
+	}
+
+	if conf.SSEConfig.Type != SSEKMS && (conf.SSEConfig.BucketKeyEnabled || len(conf.SSEConfig.KMSEncryptionContext) > 0) {
+		return errors.New("bucket_key_enabled and kms_encryption_context can only be set if sse_config.type is set to 'SSE-KMS'")
+	}
+
+	return validateCredentialsConfig(conf)
 }
 
 // ValidateForTests checks to see the config options for tests are set.
@@ -307,6 +338,14 @@ func ValidateForTests(conf Config) error {
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes returned by the listing.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
@@ -332,7 +371,10 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		if object.Key == dir {
 			continue
 		}
-		if err := f(object.Key); err != nil {
+		if err := f(object.Key, objstore.ObjectAttributes{
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		}); err != nil {
 			return err
 		}
 	}
@@ -423,6 +465,51 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	return nil
 }
 
+// DeleteMultiple removes all objects with the given names using multi-object delete requests.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, name := range names {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: name}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	errs := errutil.MultiError{}
+	// Error channel has to be drained fully, so the listing goroutine is not leaked.
+	for rerr := range b.client.RemoveObjects(ctx, b.name, objectsCh, minio.RemoveObjectsOptions{}) {
+		if rerr.Err != nil && !b.IsObjNotFoundErr(rerr.Err) {
+			errs.Add(errors.Wrapf(rerr.Err, "delete s3 object %s", rerr.ObjectName))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		errs.Add(err)
+	}
+	return errs.Err()
+}
+
+// Copy copies the object with srcName into the dstName using server side copy.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) error {
+	src := minio.CopySrcOptions{Bucket: b.name, Object: srcName}
+	// Objects encrypted with customer provided keys have to be decrypted with the same key to be copied.
+	if b.sse != nil && b.sse.Type() == encrypt.SSEC {
+		src.Encryption = b.sse
+	}
+	// ComposeObject splits copy of objects larger than 5GiB into multiple parts.
+	if _, err := b.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket:     b.name,
+		Object:     dstName,
+		Encryption: b.sse,
+	}, src); err != nil {
+		return errors.Wrap(err, "copy s3 object")
+	}
+	return nil
+}
+
 // Attributes returns information about the specified object.
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
 	objInfo, err := b.client.StatObject(ctx, b.name, name, minio.StatObjectOptions{})
@@ -443,7 +530,55 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 
 // IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
 func (b *Bucket) IsObjNotFoundErr(err error) bool {
-	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+	return minio.ToErrorResponse(errors.Cause(err)).Code == "NoSuchKey"
+}
+
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (b *Bucket) ErrStatusCode(err error) int {
+	return minio.ToErrorResponse(errors.Cause(err)).StatusCode
+}
+
+// ExpirationRules returns the enabled expiration rules of the lifecycle configuration of the bucket.
+func (b *Bucket) ExpirationRules(ctx context.Context) ([]objstore.ExpirationRule, error) {
+	config, err := b.client.GetBucketLifecycle(ctx, b.name)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "get bucket lifecycle")
+	}
+	return expirationRules(config), nil
+}
+
+func expirationRules(config *lifecycle.Configuration) []objstore.ExpirationRule {
+	var rules []objstore.ExpirationRule
+	for _, r := range config.Rules {
+		if r.Status != "Enabled" {
+			continue
+		}
+		// Objects are not tagged on upload, so the rules filtering by tags never apply.
+		if r.RuleFilter.Tag.Key != "" || len(r.RuleFilter.And.Tags) > 0 {
+			continue
+		}
+		rule := objstore.ExpirationRule{ID: r.ID, Prefix: r.Prefix}
+		if r.RuleFilter.Prefix != "" {
+			rule.Prefix = r.RuleFilter.Prefix
+		}
+		if r.RuleFilter.And.Prefix != "" {
+			rule.Prefix = r.RuleFilter.And.Prefix
+		}
+		switch {
+		case !r.Expiration.IsDaysNull():
+			rule.After = time.Duration(r.Expiration.Days) * 24 * time.Hour
+		case !r.Expiration.IsDateNull():
+			rule.At = r.Expiration.Date.Time
+		default:
+			// Transitions and expirations of non current versions do not delete the current objects.
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
 }
 
 func (b *Bucket) Close() error { return nil }
@@ -4,10 +4,23 @@
 package s3
 
 import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
 func TestParseConfig(t *testing.T) {
@@ -109,6 +122,50 @@ sse_config:
 	testutil.Ok(t, validate(cfg))
 }
 
+func TestParseConfig_SSEKMSConfig(t *testing.T) {
+	for _, tcase := range []struct {
+		sseConfig string
+		expectErr bool
+	}{
+		{sseConfig: "kms_key_id: alias/thanos"},
+		{sseConfig: "kms_key_id: alias/", expectErr: true},
+		{sseConfig: "kms_key_id: arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"},
+		{sseConfig: "kms_key_id: arn:aws-us-gov:kms:us-gov-west-1:111122223333:alias/thanos"},
+		{sseConfig: "kms_key_id: arn:aws:s3:::bucket", expectErr: true},
+		{sseConfig: "kms_key_id: arn:aws:kms:us-east-1:1111:alias/thanos", expectErr: true},
+		// Key names of S3 compatible storages are not validated.
+		{sseConfig: "kms_key_id: my-minio-key"},
+		{sseConfig: "kms_key_id: alias/thanos\n  bucket_key_enabled: true"},
+		{sseConfig: "type: SSE-S3\n  bucket_key_enabled: true", expectErr: true},
+		{sseConfig: "type: SSE-S3\n  kms_encryption_context:\n    key: value", expectErr: true},
+	} {
+		sseConfig := tcase.sseConfig
+		if !strings.Contains(sseConfig, "type:") {
+			sseConfig = "type: SSE-KMS\n  " + sseConfig
+		}
+		input := []byte("bucket: abdd\nendpoint: \"s3-endpoint\"\nsse_config:\n  " + sseConfig)
+
+		cfg, err := parseConfig(input)
+		testutil.Ok(t, err)
+		if tcase.expectErr {
+			testutil.NotOk(t, validate(cfg), tcase.sseConfig)
+			continue
+		}
+		testutil.Ok(t, validate(cfg), tcase.sseConfig)
+	}
+}
+
+func TestSSEKMSWithBucketKey(t *testing.T) {
+	sse, err := encrypt.NewSSEKMS("alias/thanos", nil)
+	testutil.Ok(t, err)
+
+	h := http.Header{}
+	sseKMSWithBucketKey{ServerSide: sse}.Marshal(h)
+	testutil.Equals(t, "aws:kms", h.Get("X-Amz-Server-Side-Encryption"))
+	testutil.Equals(t, "alias/thanos", h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	testutil.Equals(t, "true", h.Get("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"))
+}
+
 func TestParseConfig_DefaultHTTPConfig(t *testing.T) {
 	input := []byte(`bucket: abcd
 insecure: false`)
@@ -256,3 +313,61 @@ list_objects_version: "abcd"`)
 		t.Errorf("parsing of list_objects_version failed: got %v, expected %v", cfg.ListObjectsVersion, "abcd")
 	}
 }
+
+func TestExpirationRules(t *testing.T) {
+	config := lifecycle.NewConfiguration()
+	testutil.Ok(t, xml.Unmarshal([]byte(`<LifecycleConfiguration>
+	<Rule><ID>legacy</ID><Prefix>old/</Prefix><Status>Enabled</Status><Expiration><Days>30</Days></Expiration></Rule>
+	<Rule><ID>filter</ID><Filter><Prefix>tmp/</Prefix></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>
+	<Rule><ID>date</ID><Filter></Filter><Status>Enabled</Status><Expiration><Date>2030-01-01T00:00:00Z</Date></Expiration></Rule>
+	<Rule><ID>disabled</ID><Filter></Filter><Status>Disabled</Status><Expiration><Days>1</Days></Expiration></Rule>
+	<Rule><ID>tagged</ID><Filter><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>
+	<Rule><ID>transition</ID><Filter></Filter><Status>Enabled</Status><Transition><Days>1</Days><StorageClass>GLACIER</StorageClass></Transition></Rule>
+</LifecycleConfiguration>`), config))
+
+	testutil.Equals(t, []objstore.ExpirationRule{
+		{ID: "legacy", Prefix: "old/", After: 30 * 24 * time.Hour},
+		{ID: "filter", Prefix: "tmp/", After: 24 * time.Hour},
+		{ID: "date", At: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, expirationRules(config))
+}
+
+func TestBucket_PropagatesTraceContext(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		headers []http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		headers = append(headers, r.Header)
+		mtx.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test"
+	cfg.Endpoint = strings.TrimPrefix(srv.URL, "http://")
+	cfg.Region = "us-east-1"
+	cfg.Insecure = true
+	cfg.AccessKey = "key"
+	cfg.SecretKey = "secret"
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	// Requests without span are sent unchanged.
+	_, err = bkt.Exists(context.Background(), "obj")
+	testutil.Ok(t, err)
+
+	tracer := mocktracer.New()
+	span, ctx := tracing.StartSpan(tracing.ContextWithTracer(context.Background(), tracer), "exists")
+	_, err = bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	span.Finish()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	testutil.Equals(t, 2, len(headers))
+	testutil.Equals(t, "", headers[0].Get("Mockpfx-Ids-Spanid"))
+	testutil.Equals(t, strconv.Itoa(span.Context().(mocktracer.MockSpanContext).TraceID), headers[1].Get("Mockpfx-Ids-Traceid"))
+}
@@ -0,0 +1,119 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package sftp
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// posixRenameExt is the OpenSSH extension renaming files with replacing the existing target.
+	posixRenameExt = "posix-rename@openssh.com"
+
+	// maxDataSize is the maximum size of data read or written with a single request, supported by all servers.
+	maxDataSize = 32 * 1024
+)
+
+// conn is a SFTP session over a single SSH connection. Requests can be sent concurrently.
+type conn struct {
+	ssh         *ssh.Client
+	sftp        *sftp.Client
+	posixRename bool
+
+	// done is closed once the SSH connection is lost or closed.
+	done chan struct{}
+}
+
+func dial(addr string, config *ssh.ClientConfig) (_ *conn, err error) {
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ssh dial %s", addr)
+	}
+	sc, err := sftp.NewClient(client, sftp.MaxPacket(maxDataSize))
+	if err != nil {
+		_ = client.Close()
+		return nil, errors.Wrap(err, "start sftp session")
+	}
+
+	c := &conn{ssh: client, sftp: sc, done: make(chan struct{})}
+	if v, ok := sc.HasExtension(posixRenameExt); ok && v == "1" {
+		c.posixRename = true
+	}
+	go func() {
+		_ = client.Wait()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+func (c *conn) close() {
+	_ = c.sftp.Close()
+	_ = c.ssh.Close()
+}
+
+func (c *conn) broken() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// rename renames the file, replacing the target if the server supports it.
+func (c *conn) rename(src, dst string) error {
+	if c.posixRename {
+		return c.sftp.PosixRename(src, dst)
+	}
+	return c.sftp.Rename(src, dst)
+}
+
+// pool keeps a fixed number of SFTP connections, which are used in turns and dialed again when broken.
+type pool struct {
+	dial func() (*conn, error)
+
+	mtx   sync.Mutex
+	conns []*conn
+	next  int
+}
+
+func newPool(size int, dial func() (*conn, error)) *pool {
+	return &pool{dial: dial, conns: make([]*conn, size)}
+}
+
+func (p *pool) get() (*conn, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	i := p.next
+	p.next = (p.next + 1) % len(p.conns)
+	if c := p.conns[i]; c != nil && !c.broken() {
+		return c, nil
+	}
+	if c := p.conns[i]; c != nil {
+		c.close()
+	}
+	c, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	p.conns[i] = c
+	return c, nil
+}
+
+func (p *pool) close() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for i, c := range p.conns {
+		if c != nil {
+			c.close()
+		}
+		p.conns[i] = nil
+	}
+}
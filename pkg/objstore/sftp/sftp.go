@@ -0,0 +1,514 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package sftp implements objstore.Bucket against a plain file server accessed over SFTP.
+package sftp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+const DirDelim = "/"
+
+// tmpSuffix is the suffix of the files objects are written to before being renamed to their final name.
+const tmpSuffix = ".thanos-tmp"
+
+// DefaultConfig for SFTP bucket.
+var DefaultConfig = Config{
+	MaxConnections: 4,
+	DialTimeout:    model.Duration(10 * time.Second),
+}
+
+// Config stores the configuration for SFTP bucket.
+type Config struct {
+	// Host is the address of the SSH server in host:port format. Port defaults to 22.
+	Host           string `yaml:"host"`
+	User           string `yaml:"user"`
+	Password       string `yaml:"password"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	// KnownHostsFile is the path to the OpenSSH known_hosts file used to verify the server host key.
+	KnownHostsFile string `yaml:"known_hosts_file"`
+	// HostKeyFingerprint is the SHA256 fingerprint of the server host key, as printed by ssh-keygen -l.
+	HostKeyFingerprint        string `yaml:"host_key_fingerprint"`
+	InsecureSkipHostKeyVerify bool   `yaml:"insecure_skip_host_key_verify"`
+	// RootDir is the directory on the server objects are stored in. Relative paths are resolved against the home directory of the user.
+	RootDir string `yaml:"root_dir"`
+	// MaxConnections is the number of SSH connections the requests are spread over.
+	MaxConnections int            `yaml:"max_connections"`
+	DialTimeout    model.Duration `yaml:"dial_timeout"`
+}
+
+func (conf *Config) validate() error {
+	if conf.Host == "" || conf.User == "" {
+		return errors.New("insufficient sftp configuration information")
+	}
+	if conf.Password == "" && conf.PrivateKeyFile == "" {
+		return errors.New("no sftp password or private_key_file in config file")
+	}
+	n := 0
+	for _, set := range []bool{conf.KnownHostsFile != "", conf.HostKeyFingerprint != "", conf.InsecureSkipHostKeyVerify} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("exactly one of known_hosts_file, host_key_fingerprint or insecure_skip_host_key_verify has to be set")
+	}
+	if conf.MaxConnections <= 0 {
+		return errors.New("max_connections has to be positive")
+	}
+	return nil
+}
+
+// sshConfig returns the configuration of SSH client connections.
+func (conf *Config) sshConfig() (*ssh.ClientConfig, error) {
+	c := &ssh.ClientConfig{
+		User:    conf.User,
+		Timeout: time.Duration(conf.DialTimeout),
+	}
+	if conf.PrivateKeyFile != "" {
+		key, err := ioutil.ReadFile(conf.PrivateKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read private key")
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse private key")
+		}
+		c.Auth = append(c.Auth, ssh.PublicKeys(signer))
+	}
+	if conf.Password != "" {
+		c.Auth = append(c.Auth, ssh.Password(conf.Password))
+	}
+
+	switch {
+	case conf.KnownHostsFile != "":
+		callback, err := knownhosts.New(conf.KnownHostsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load known hosts")
+		}
+		c.HostKeyCallback = callback
+	case conf.HostKeyFingerprint != "":
+		c.HostKeyCallback = func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if fp := ssh.FingerprintSHA256(key); fp != conf.HostKeyFingerprint {
+				return errors.Errorf("host key fingerprint %s does not match the configured one", fp)
+			}
+			return nil
+		}
+	default:
+		c.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+	return c, nil
+}
+
+// Bucket implements the store.Bucket interface against a SFTP server.
+type Bucket struct {
+	logger  log.Logger
+	name    string
+	rootDir string
+	pool    *pool
+}
+
+// NewBucket returns a new Bucket using the provided SFTP config values.
+func NewBucket(logger log.Logger, conf []byte) (*Bucket, error) {
+	config, err := parseConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewBucketWithConfig(logger, config)
+}
+
+// NewBucketWithConfig returns a new Bucket using the provided SFTP config struct.
+func NewBucketWithConfig(logger log.Logger, config Config) (*Bucket, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if err := config.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate sftp configuration")
+	}
+	sshConfig, err := config.sshConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "sftp ssh configuration")
+	}
+	addr := config.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	var rootDir string
+	if config.RootDir != "" {
+		rootDir = path.Clean(config.RootDir)
+	}
+
+	b := &Bucket{
+		logger:  logger,
+		name:    fmt.Sprintf("sftp: %s@%s:%s", config.User, addr, rootDir),
+		rootDir: rootDir,
+		pool: newPool(config.MaxConnections, func() (*conn, error) {
+			return dial(addr, sshConfig)
+		}),
+	}
+	// Dial one connection upfront to report misconfiguration early.
+	if _, err := b.pool.get(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func parseConfig(conf []byte) (Config, error) {
+	config := DefaultConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return Config{}, errors.Wrap(err, "parsing sftp configuration")
+	}
+	return config, nil
+}
+
+func (b *Bucket) path(name string) string {
+	if b.rootDir == "" {
+		// Relative to the home directory of the user.
+		return path.Join(".", name)
+	}
+	return path.Join(b.rootDir, name)
+}
+
+func isTmp(name string) bool {
+	return strings.HasSuffix(name, tmpSuffix)
+}
+
+// Name returns the bucket name for SFTP.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the attributes of the files. Directories have empty attributes.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
+	c, err := b.pool.get()
+	if err != nil {
+		return err
+	}
+	infos, err := c.sftp.ReadDir(b.path(dir))
+	if err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "read sftp directory %s", b.path(dir))
+	}
+	// Servers return entries in the order of the file system, while callers expect them sorted like in object stores.
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	dir = strings.TrimSuffix(dir, DirDelim)
+	for _, info := range infos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.Name() == "." || info.Name() == ".." || isTmp(info.Name()) {
+			continue
+		}
+		name := path.Join(dir, info.Name())
+		attrs := objstore.ObjectAttributes{Size: info.Size(), LastModified: info.ModTime()}
+		if info.IsDir() {
+			name += DirDelim
+			attrs = objstore.ObjectAttributes{}
+		}
+		if err := f(name, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// GetRange returns a new range reader for the given object name and range.
+func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if name == "" {
+		return nil, errors.New("object name is empty")
+	}
+	c, err := b.pool.get()
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.sftp.Open(b.path(name))
+	if err != nil {
+		// Error is not wrapped, so it can be checked with IsObjNotFoundErr.
+		return nil, err
+	}
+	if off > 0 {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, errors.Wrapf(err, "seek sftp file %s", b.path(name))
+		}
+	}
+	var r io.Reader = f
+	if length != -1 {
+		r = io.LimitReader(f, length)
+	}
+	return &fileReader{ctx: ctx, Reader: r, Closer: f}, nil
+}
+
+// fileReader reads the content of the opened file. The SFTP client does not support contexts,
+// so the context is checked before each read instead.
+type fileReader struct {
+	ctx context.Context
+	io.Reader
+	io.Closer
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+// Exists checks if the given object exists in the bucket.
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	c, err := b.pool.get()
+	if err != nil {
+		return false, err
+	}
+	info, err := c.sftp.Stat(b.path(name))
+	if err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "stat sftp file %s", b.path(name))
+	}
+	return !info.IsDir(), nil
+}
+
+// Attributes returns information about the specified object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	c, err := b.pool.get()
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	info, err := c.sftp.Stat(b.path(name))
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return objstore.ObjectAttributes{
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+// Upload the contents of the reader as an object into the bucket.
+// The content is written to a temporary file first, which is renamed to the object name once complete,
+// so partially written objects are never visible.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
+	c, err := b.pool.get()
+	if err != nil {
+		return err
+	}
+	if err := b.mkdirAll(c, path.Dir(b.path(name))); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmp := b.path(path.Join(path.Dir(name), fmt.Sprintf(".%s.%s%s", path.Base(name), hex.EncodeToString(suffix), tmpSuffix)))
+	f, err := c.sftp.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return errors.Wrapf(err, "create sftp file %s", tmp)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if rerr := c.sftp.Remove(tmp); rerr != nil {
+			err = errors.Wrapf(err, "remove sftp temporary file %s failed: %v", tmp, rerr)
+		}
+	}()
+
+	if _, err := io.Copy(f, &contextReader{ctx: ctx, r: r}); err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "write sftp file %s", tmp)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "close sftp file %s", tmp)
+	}
+
+	dst := b.path(name)
+	if c.posixRename {
+		return errors.Wrapf(c.rename(tmp, dst), "rename sftp file %s to %s", tmp, dst)
+	}
+	// Plain rename fails if the target exists, so the previous version of the object has to be removed first.
+	if err := c.rename(tmp, dst); err == nil {
+		return nil
+	}
+	if err := c.sftp.Remove(dst); err != nil && !b.IsObjNotFoundErr(err) {
+		return errors.Wrapf(err, "remove previous sftp file %s", dst)
+	}
+	return errors.Wrapf(c.rename(tmp, dst), "rename sftp file %s to %s", tmp, dst)
+}
+
+// contextReader stops reading once the context is done, so uploads can be cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// mkdirAll creates the directory with the given path on the server together with all missing parents,
+// including the root directory.
+func (b *Bucket) mkdirAll(c *conn, dir string) error {
+	if dir == "." || dir == DirDelim {
+		return nil
+	}
+	info, err := c.sftp.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return errors.Errorf("sftp path %s is not a directory", dir)
+		}
+		return nil
+	}
+	if !b.IsObjNotFoundErr(err) {
+		return errors.Wrapf(err, "stat sftp directory %s", dir)
+	}
+	if err := b.mkdirAll(c, path.Dir(dir)); err != nil {
+		return err
+	}
+	if err := c.sftp.Mkdir(dir); err != nil {
+		// Directory might have been created concurrently.
+		if info, serr := c.sftp.Stat(dir); serr == nil && info.IsDir() {
+			return nil
+		}
+		return errors.Wrapf(err, "create sftp directory %s", dir)
+	}
+	return nil
+}
+
+// Delete removes the object with the given name, together with parent directories left empty.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	c, err := b.pool.get()
+	if err != nil {
+		return err
+	}
+	if err := c.sftp.Remove(b.path(name)); err != nil {
+		// Error is not wrapped, so it can be checked with IsObjNotFoundErr.
+		return err
+	}
+	// Removing directory fails if it is not empty, so it is safe to try it for all parents,
+	// even if other objects are concurrently written into them.
+	for dir := path.Dir(name); dir != "." && dir != DirDelim; dir = path.Dir(dir) {
+		if err := c.sftp.RemoveDirectory(b.path(dir)); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// DeleteMultiple removes all objects with the given names.
+func (b *Bucket) DeleteMultiple(ctx context.Context, names []string) error {
+	return objstore.DeleteMultipleConcurrently(ctx, b, names, objstore.DefaultDeleteConcurrency)
+}
+
+// Copy copies the object with srcName into the dstName. SFTP has no copy operation,
+// so the content is downloaded and uploaded again.
+func (b *Bucket) Copy(ctx context.Context, srcName, dstName string) (err error) {
+	rc, err := b.Get(ctx, srcName)
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, rc, "sftp copy source %s", srcName)
+
+	return b.Upload(ctx, dstName, rc)
+}
+
+// IsObjNotFoundErr returns true if error means that object is not found. Relevant to Get operations.
+func (b *Bucket) IsObjNotFoundErr(err error) bool {
+	return os.IsNotExist(errors.Cause(err))
+}
+
+// Close closes all connections to the server.
+func (b *Bucket) Close() error {
+	b.pool.close()
+	return nil
+}
+
+func configFromEnv() Config {
+	c := DefaultConfig
+	c.Host = os.Getenv("SFTP_HOST")
+	c.User = os.Getenv("SFTP_USER")
+	c.Password = os.Getenv("SFTP_PASSWORD")
+	c.PrivateKeyFile = os.Getenv("SFTP_PRIVATE_KEY_FILE")
+	c.KnownHostsFile = os.Getenv("SFTP_KNOWN_HOSTS_FILE")
+	c.HostKeyFingerprint = os.Getenv("SFTP_HOST_KEY_FINGERPRINT")
+	c.RootDir = os.Getenv("SFTP_ROOT_DIR")
+	return c
+}
+
+// NewTestBucket creates test bkt client that before returning creates temporary directory.
+// In a close function it empties and deletes the directory.
+func NewTestBucket(t testing.TB) (objstore.Bucket, func(), error) {
+	c := configFromEnv()
+	if c.Host == "" || c.User == "" {
+		return nil, nil, errors.New("insufficient sftp test configuration information")
+	}
+	c.RootDir = path.Join(c.RootDir, objstore.CreateTemporaryTestBucketName(t))
+
+	b, err := NewBucketWithConfig(log.NewNopLogger(), c)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := context.Background()
+	conn, err := b.pool.get()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := b.mkdirAll(conn, b.rootDir); err != nil {
+		return nil, nil, err
+	}
+	t.Log("created temporary SFTP directory for SFTP tests with name", c.RootDir)
+
+	return b, func() {
+		objstore.EmptyBucket(t, ctx, b)
+		if err := conn.sftp.RemoveDirectory(b.rootDir); err != nil {
+			t.Logf("deleting directory %s failed: %s", c.RootDir, err)
+		}
+		_ = b.Close()
+	}, nil
+}
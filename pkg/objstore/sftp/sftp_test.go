@@ -0,0 +1,280 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// fakeServer is a SSH server with a SFTP subsystem, which stores objects in a local temporary directory.
+type fakeServer struct {
+	t        *testing.T
+	dir      string
+	hostKey  ssh.Signer
+	listener net.Listener
+
+	mtx   sync.Mutex
+	conns []ssh.Conn
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	testutil.Ok(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	testutil.Ok(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	s := &fakeServer{t: t, dir: t.TempDir(), hostKey: signer, listener: l}
+	t.Cleanup(func() { _ = l.Close() })
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() != "thanos" || string(pass) != "secret" {
+				return nil, fmt.Errorf("password rejected for %s", c.User())
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(nc, config)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.listener.Addr().String() }
+
+// closeConns closes all established connections, as if the server was restarted.
+func (s *fakeServer) closeConns() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) handleConn(nc net.Conn, config *ssh.ServerConfig) {
+	sc, chans, reqs, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		return
+	}
+	s.mtx.Lock()
+	s.conns = append(s.conns, sc)
+	s.mtx.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			_ = newCh.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					go s.serveSFTP(ch)
+				}
+			}
+		}()
+	}
+}
+
+func (s *fakeServer) localPath(p string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(p))
+}
+
+// serveSFTP serves the files of the local file system. Tests store objects below the temporary directory of the server.
+func (s *fakeServer) serveSFTP(ch ssh.Channel) {
+	defer func() { _ = ch.Close() }()
+
+	srv, err := sftp.NewServer(ch)
+	testutil.Ok(s.t, err)
+	_ = srv.Serve()
+}
+
+func testConfig(s *fakeServer) Config {
+	conf := DefaultConfig
+	conf.Host = s.addr()
+	conf.User = "thanos"
+	conf.Password = "secret"
+	conf.HostKeyFingerprint = ssh.FingerprintSHA256(s.hostKey.PublicKey())
+	conf.RootDir = s.localPath("/thanos")
+	conf.MaxConnections = 2
+	return conf
+}
+
+func TestBucket_AcceptanceWithFakeServer(t *testing.T) {
+	for _, posixRename := range []bool{true, false} {
+		t.Run(fmt.Sprintf("posix-rename=%v", posixRename), func(t *testing.T) {
+			s := newFakeServer(t)
+			bkt, err := NewBucketWithConfig(log.NewNopLogger(), testConfig(s))
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, bkt.Close()) }()
+
+			if !posixRename {
+				// The server always supports the extension, so the client is made to not use it.
+				dial := bkt.pool.dial
+				bkt.pool.close()
+				bkt.pool.dial = func() (*conn, error) {
+					c, err := dial()
+					if err == nil {
+						c.posixRename = false
+					}
+					return c, err
+				}
+			}
+
+			objstore.AcceptanceTest(t, bkt)
+
+			// Temporary files are not left behind and empty directories are removed.
+			var files []string
+			testutil.Ok(t, filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					files = append(files, strings.TrimPrefix(p, s.dir))
+				}
+				return err
+			}))
+			testutil.Equals(t, []string{"/thanos/id1/obj_1.some", "/thanos/id1/obj_3.some", "/thanos/obj_5.some"}, files)
+			_, err = os.Stat(s.localPath("/thanos/id2"))
+			testutil.Assert(t, os.IsNotExist(err), "expected empty directory to be deleted")
+		})
+	}
+}
+
+func TestBucket_LargeObject(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeServer(t)
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), testConfig(s))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	data := make([]byte, 3*maxDataSize+123)
+	_, err = rand.Read(data)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, "dir/large", ioutil.NopCloser(strings.NewReader(string(data)))))
+
+	rc, err := bkt.GetRange(ctx, "dir/large", maxDataSize-10, 2*maxDataSize)
+	testutil.Ok(t, err)
+	content, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, data[maxDataSize-10:3*maxDataSize-10], content)
+}
+
+func TestBucket_HostKeyVerification(t *testing.T) {
+	s := newFakeServer(t)
+
+	t.Run("fingerprint mismatch", func(t *testing.T) {
+		conf := testConfig(s)
+		conf.HostKeyFingerprint = "SHA256:invalid"
+		_, err := NewBucketWithConfig(log.NewNopLogger(), conf)
+		testutil.NotOk(t, err)
+		testutil.Assert(t, strings.Contains(err.Error(), "does not match"), "unexpected error %s", err)
+	})
+	t.Run("known hosts", func(t *testing.T) {
+		knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+		testutil.Ok(t, ioutil.WriteFile(knownHosts, []byte(knownhosts.Line([]string{s.addr()}, s.hostKey.PublicKey())+"\n"), os.ModePerm))
+
+		conf := testConfig(s)
+		conf.HostKeyFingerprint = ""
+		conf.KnownHostsFile = knownHosts
+		bkt, err := NewBucketWithConfig(log.NewNopLogger(), conf)
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Close())
+	})
+	t.Run("unknown host", func(t *testing.T) {
+		knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+		testutil.Ok(t, ioutil.WriteFile(knownHosts, nil, os.ModePerm))
+
+		conf := testConfig(s)
+		conf.HostKeyFingerprint = ""
+		conf.KnownHostsFile = knownHosts
+		_, err := NewBucketWithConfig(log.NewNopLogger(), conf)
+		testutil.NotOk(t, err)
+	})
+}
+
+func TestBucket_Reconnects(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeServer(t)
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), testConfig(s))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	testutil.Ok(t, bkt.Upload(ctx, "obj", strings.NewReader("data")))
+	s.closeConns()
+
+	// Wait until the client notices the connections are gone.
+	for _, c := range bkt.pool.conns {
+		if c == nil {
+			continue
+		}
+		select {
+		case <-c.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection was not closed")
+		}
+	}
+	ok, err := bkt.Exists(ctx, "obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, tcase := range []struct {
+		name string
+		conf string
+		ok   bool
+	}{
+		{name: "password with fingerprint", conf: "host: files\nuser: thanos\npassword: secret\nhost_key_fingerprint: SHA256:abc", ok: true},
+		{name: "no credentials", conf: "host: files\nuser: thanos\nhost_key_fingerprint: SHA256:abc"},
+		{name: "no host key verification", conf: "host: files\nuser: thanos\npassword: secret"},
+		{name: "multiple host key verifications", conf: "host: files\nuser: thanos\npassword: secret\nhost_key_fingerprint: SHA256:abc\ninsecure_skip_host_key_verify: true"},
+		{name: "no connections", conf: "host: files\nuser: thanos\npassword: secret\ninsecure_skip_host_key_verify: true\nmax_connections: 0"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			conf, err := parseConfig([]byte(tcase.conf))
+			testutil.Ok(t, err)
+			err = conf.validate()
+			if tcase.ok {
+				testutil.Ok(t, err)
+				return
+			}
+			testutil.NotOk(t, err)
+		})
+	}
+}
@@ -5,49 +5,99 @@
 package swift
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
 	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/jpillora/backoff"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
 // DirDelim is the delimiter used to model a directory structure in an object store bucket.
 const DirDelim = "/"
 
+const (
+	// LargeObjectTypeSLO uploads large objects as static large objects.
+	LargeObjectTypeSLO = "slo"
+	// LargeObjectTypeDLO uploads large objects as dynamic large objects. Useful for clusters not supporting
+	// static large objects like older OpenStack releases or Ceph RadosGW.
+	LargeObjectTypeDLO = "dlo"
+)
+
+var DefaultConfig = SwiftConfig{
+	MaxAuthRetries:   1,
+	AuthRetryBackoff: model.Duration(time.Second),
+	LargeObjectType:  LargeObjectTypeSLO,
+	// Objects in Swift are limited to 5GiB by default, so use 1GiB segments to stay well below it.
+	LargeObjectChunkSize: 1024 * 1024 * 1024,
+}
+
 type SwiftConfig struct {
-	AuthUrl           string `yaml:"auth_url"`
-	Username          string `yaml:"username"`
-	UserDomainName    string `yaml:"user_domain_name"`
-	UserDomainID      string `yaml:"user_domain_id"`
-	UserId            string `yaml:"user_id"`
-	Password          string `yaml:"password"`
-	DomainId          string `yaml:"domain_id"`
-	DomainName        string `yaml:"domain_name"`
-	ProjectID         string `yaml:"project_id"`
-	ProjectName       string `yaml:"project_name"`
-	ProjectDomainID   string `yaml:"project_domain_id"`
-	ProjectDomainName string `yaml:"project_domain_name"`
-	RegionName        string `yaml:"region_name"`
-	ContainerName     string `yaml:"container_name"`
+	AuthUrl                     string `yaml:"auth_url"`
+	Username                    string `yaml:"username"`
+	UserDomainName              string `yaml:"user_domain_name"`
+	UserDomainID                string `yaml:"user_domain_id"`
+	UserId                      string `yaml:"user_id"`
+	Password                    string `yaml:"password"`
+	DomainId                    string `yaml:"domain_id"`
+	DomainName                  string `yaml:"domain_name"`
+	ApplicationCredentialID     string `yaml:"application_credential_id"`
+	ApplicationCredentialName   string `yaml:"application_credential_name"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+	ProjectID                   string `yaml:"project_id"`
+	ProjectName                 string `yaml:"project_name"`
+	ProjectDomainID             string `yaml:"project_domain_id"`
+	ProjectDomainName           string `yaml:"project_domain_name"`
+	RegionName                  string `yaml:"region_name"`
+	ContainerName               string `yaml:"container_name"`
+	// MaxAuthRetries is the number of times a request rejected due to an expired or invalid token
+	// is retried after re-authenticating against Keystone.
+	MaxAuthRetries   int            `yaml:"max_auth_retries"`
+	AuthRetryBackoff model.Duration `yaml:"auth_retry_backoff"`
+	// LargeObjectType is the type of the manifest used for objects larger than LargeObjectChunkSize: either slo or dlo.
+	LargeObjectType      string `yaml:"large_object_type"`
+	LargeObjectChunkSize int64  `yaml:"large_object_chunk_size"`
+	// LargeObjectSegmentsContainer is the container storing large object segments. Defaults to <container_name>_segments.
+	LargeObjectSegmentsContainer string `yaml:"large_object_segments_container"`
 }
 
 type Container struct {
 	logger log.Logger
 	client *gophercloud.ServiceClient
 	name   string
+
+	maxAuthRetries int
+	authBackoff    backoff.Backoff
+
+	largeObjectType       string
+	chunkSize             int64
+	segmentsContainerName string
 }
 
 func NewContainer(logger log.Logger, conf []byte) (*Container, error) {
@@ -55,11 +105,19 @@ func NewContainer(logger log.Logger, conf []byte) (*Container, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := sc.validate(); err != nil {
+		return nil, err
+	}
 
-	provider, err := openstack.AuthenticatedClient(authOptsFromConfig(sc))
+	authOpts := authOptsFromConfig(sc)
+	provider, err := openstack.NewClient(authOpts.IdentityEndpoint)
 	if err != nil {
 		return nil, err
 	}
+	provider.HTTPClient.Transport = tracing.HTTPPropagationTripperware(http.DefaultTransport)
+	if err := openstack.Authenticate(provider, authOpts); err != nil {
+		return nil, err
+	}
 
 	client, err := openstack.NewObjectStorageV1(provider, gophercloud.EndpointOpts{
 		Region: sc.RegionName,
@@ -69,12 +127,107 @@ func NewContainer(logger log.Logger, conf []byte) (*Container, error) {
 	}
 
 	return &Container{
-		logger: logger,
-		client: client,
-		name:   sc.ContainerName,
+		logger:         logger,
+		client:         client,
+		name:           sc.ContainerName,
+		maxAuthRetries: sc.MaxAuthRetries,
+		authBackoff:    authBackoff(time.Duration(sc.AuthRetryBackoff)),
+
+		largeObjectType:       sc.LargeObjectType,
+		chunkSize:             sc.LargeObjectChunkSize,
+		segmentsContainerName: sc.LargeObjectSegmentsContainer,
 	}, nil
 }
 
+func (sc *SwiftConfig) validate() error {
+	if sc.LargeObjectType != LargeObjectTypeSLO && sc.LargeObjectType != LargeObjectTypeDLO {
+		return errors.Errorf("unsupported large object type %q; expected %q or %q", sc.LargeObjectType, LargeObjectTypeSLO, LargeObjectTypeDLO)
+	}
+	if sc.LargeObjectChunkSize <= 0 {
+		return errors.New("large object chunk size must be positive")
+	}
+	return nil
+}
+
+func authBackoff(min time.Duration) backoff.Backoff {
+	return backoff.Backoff{
+		Factor: 2,
+		Min:    min,
+		Max:    10 * min,
+		Jitter: true,
+	}
+}
+
+// clientWithContext returns a copy of the object storage client which issues all its requests with the given context,
+// so callers are able to cancel or time out in-flight requests. The copy shares the authentication state
+// with the original client, so a token refreshed by one of them is picked up by all others.
+func (c *Container) clientWithContext(ctx context.Context) *gophercloud.ServiceClient {
+	orig := c.client.ProviderClient
+	pc := &gophercloud.ProviderClient{
+		IdentityBase:     orig.IdentityBase,
+		IdentityEndpoint: orig.IdentityEndpoint,
+		EndpointLocator:  orig.EndpointLocator,
+		HTTPClient:       orig.HTTPClient,
+		UserAgent:        orig.UserAgent,
+		Context:          ctx,
+	}
+	pc.CopyTokenFrom(orig)
+	if orig.ReauthFunc != nil {
+		pc.ReauthFunc = func() error {
+			if err := orig.Reauthenticate(pc.Token()); err != nil {
+				return err
+			}
+			pc.CopyTokenFrom(orig)
+			return nil
+		}
+	}
+
+	sc := *c.client
+	sc.ProviderClient = pc
+	return &sc
+}
+
+// isAuthErr returns true if the request was rejected because of an expired or otherwise invalid token.
+func isAuthErr(err error) bool {
+	switch err.(type) {
+	case gophercloud.ErrDefault401, *gophercloud.ErrUnableToReauthenticate:
+		return true
+	}
+	return false
+}
+
+// unwrapReauthErr returns the error the request failed with after gophercloud already re-authenticated once,
+// so it can be inspected as any other response error (e.g. not found).
+func unwrapReauthErr(err error) error {
+	if rerr, ok := err.(*gophercloud.ErrErrorAfterReauthentication); ok && rerr.ErrOriginal != nil {
+		return rerr.ErrOriginal
+	}
+	return err
+}
+
+// withAuthRetries runs f and, in case the request was rejected due to an expired token, re-authenticates and
+// retries it up to the configured number of times.
+func (c *Container) withAuthRetries(ctx context.Context, f func(client *gophercloud.ServiceClient) error) error {
+	for attempt := 0; ; attempt++ {
+		client := c.clientWithContext(ctx)
+		err := unwrapReauthErr(f(client))
+		if err == nil || !isAuthErr(err) || attempt >= c.maxAuthRetries {
+			return err
+		}
+
+		level.Warn(c.logger).Log("msg", "swift request unauthorized; re-authenticating and retrying", "attempt", attempt+1, "err", err)
+		if err := c.client.Reauthenticate(client.Token()); err != nil {
+			return errors.Wrap(err, "re-authenticate")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.authBackoff.ForAttempt(float64(attempt))):
+		}
+	}
+}
+
 // Name returns the container name for swift.
 func (c *Container) Name() string {
 	return c.name
@@ -83,6 +236,14 @@ func (c *Container) Name() string {
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
 func (c *Container) Iter(ctx context.Context, dir string, f func(string) error) error {
+	return c.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	})
+}
+
+// IterWithAttributes calls f for each entry in the given directory similar to Iter, passing also
+// the object attributes returned by the listing.
+func (c *Container) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error) error {
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
@@ -90,18 +251,31 @@ func (c *Container) Iter(ctx context.Context, dir string, f func(string) error)
 	}
 
 	options := &objects.ListOpts{Full: true, Prefix: dir, Delimiter: DirDelim}
-	return objects.List(c.client, c.name, options).EachPage(func(page pagination.Page) (bool, error) {
-		objectNames, err := objects.ExtractNames(page)
-		if err != nil {
-			return false, err
-		}
-		for _, objectName := range objectNames {
-			if err := f(objectName); err != nil {
+	return c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		return objects.List(client, c.name, options).EachPage(func(page pagination.Page) (bool, error) {
+			objs, err := objects.ExtractInfo(page)
+			if err != nil {
 				return false, err
 			}
-		}
+			for _, obj := range objs {
+				name, attrs := obj.Name, objstore.ObjectAttributes{Size: obj.Bytes, LastModified: obj.LastModified}
+				if obj.Subdir != "" {
+					name, attrs = obj.Subdir, objstore.ObjectAttributes{}
+				} else if obj.Bytes == 0 && c.largeObjectType == LargeObjectTypeDLO {
+					// Listings report zero size for DLO manifests, so ask for the real size of the object.
+					if attrs, err = c.Attributes(ctx, name); err != nil {
+						return false, errors.Wrapf(err, "get attributes of %s", name)
+					}
+				}
+				if err := f(name, attrs); err != nil {
+					return false, err
+				}
+				// In case of retry, resume the listing after the last entry passed to f.
+				options.Marker = name
+			}
 
-		return true, nil
+			return true, nil
+		})
 	})
 }
 
@@ -110,8 +284,13 @@ func (c *Container) Get(ctx context.Context, name string) (io.ReadCloser, error)
 	if name == "" {
 		return nil, errors.New("error, empty container name passed")
 	}
-	response := objects.Download(c.client, c.name, name, nil)
-	return response.Body, response.Err
+	var body io.ReadCloser
+	err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		response := objects.Download(client, c.name, name, nil)
+		body = response.Body
+		return response.Err
+	})
+	return body, err
 }
 
 // GetRange returns a new range reader for the given object name and range.
@@ -128,14 +307,22 @@ func (c *Container) GetRange(ctx context.Context, name string, off, length int64
 		Newest: true,
 		Range:  fmt.Sprintf("bytes=%s-%s", lowerLimit, upperLimit),
 	}
-	response := objects.Download(c.client, c.name, name, options)
-	return response.Body, response.Err
+	var body io.ReadCloser
+	err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		response := objects.Download(client, c.name, name, options)
+		body = response.Body
+		return response.Err
+	})
+	return body, err
 }
 
 // Attributes returns information about the specified object.
 func (c *Container) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
-	response := objects.Get(c.client, c.name, name, nil)
-	headers, err := response.Extract()
+	var headers *objects.GetHeader
+	err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) (err error) {
+		headers, err = objects.Get(client, c.name, name, nil).Extract()
+		return err
+	})
 	if err != nil {
 		return objstore.ObjectAttributes{}, err
 	}
@@ -148,7 +335,9 @@ func (c *Container) Attributes(ctx context.Context, name string) (objstore.Objec
 
 // Exists checks if the given object exists.
 func (c *Container) Exists(ctx context.Context, name string) (bool, error) {
-	err := objects.Get(c.client, c.name, name, nil).Err
+	err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		return objects.Get(client, c.name, name, nil).Err
+	})
 	if err == nil {
 		return true, nil
 	}
@@ -166,16 +355,622 @@ func (c *Container) IsObjNotFoundErr(err error) bool {
 	return ok
 }
 
+// ErrStatusCode returns the HTTP status code of the failed request the error comes from, or 0 if unknown.
+func (c *Container) ErrStatusCode(err error) int {
+	if statusErr, ok := errors.Cause(err).(gophercloud.StatusCodeError); ok {
+		return statusErr.GetStatusCode()
+	}
+	return 0
+}
+
 // Upload writes the contents of the reader as an object into the container.
+// Objects larger than the configured chunk size are uploaded as large objects split into segments.
 func (c *Container) Upload(ctx context.Context, name string, r io.Reader) error {
-	options := &objects.CreateOpts{Content: r}
-	res := objects.Create(c.client, c.name, name, options)
-	return res.Err
+	size, err := objstore.TryToGetSize(r)
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "could not guess file size; reading content in chunks to detect large object upload", "name", name, "err", err)
+		size = -1
+	}
+	if size >= 0 && size <= c.chunkSize {
+		return c.uploadObject(ctx, c.name, name, r, objects.CreateOpts{})
+	}
+	if size < 0 {
+		// Buffer the beginning of the content to find out whether it fits into a single object. Above that, the
+		// content is streamed as segments, so memory is not allocated up to the chunk size for every upload.
+		limit := int64(maxBufferedUploadSize)
+		if c.chunkSize < limit {
+			limit = c.chunkSize
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+		if err != nil {
+			return errors.Wrap(err, "read content")
+		}
+		if int64(len(b)) <= limit {
+			return c.uploadObject(ctx, c.name, name, bytes.NewReader(b), objects.CreateOpts{})
+		}
+		r = io.MultiReader(bytes.NewReader(b), r)
+	}
+	return c.uploadLargeObject(ctx, name, &segmentReader{r: r, size: size, chunkSize: c.chunkSize})
 }
 
-// Delete removes the object with the given name.
+// maxBufferedUploadSize is the maximum size of the content of unknown size buffered in memory on upload.
+const maxBufferedUploadSize = 16 * 1024 * 1024
+
+// uploadObject uploads a single object with the given options making sure the content can be replayed in case of retry.
+func (c *Container) uploadObject(ctx context.Context, container, name string, r io.Reader, opts objects.CreateOpts) error {
+	_, err := c.uploadObjectWithHeader(ctx, container, name, r, opts)
+	return err
+}
+
+func (c *Container) uploadObjectWithHeader(ctx context.Context, container, name string, r io.Reader, opts objects.CreateOpts) (*objects.CreateHeader, error) {
+	// The content has to be replayable in case of retry. Gophercloud buffers non seekable readers
+	// into memory anyway to calculate the ETag, so doing it upfront does not cost anything extra.
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "read content")
+		}
+		rs = bytes.NewReader(b)
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrap(err, "get content offset")
+	}
+
+	var header *objects.CreateHeader
+	err = c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) (err error) {
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return errors.Wrap(err, "rewind content")
+		}
+		opts.Content = rs
+		header, err = objects.Create(client, container, name, opts).Extract()
+		return err
+	})
+	return header, err
+}
+
+// uploadStreamedObject uploads the content of the reader as it is read, without buffering it. As the content cannot
+// be replayed, the upload is not retried, and its MD5 sum is checked against the ETag of the object instead, in case
+// the request was resent after re-authentication. It returns the header of the object and the size of the content.
+func (c *Container) uploadStreamedObject(ctx context.Context, container, name string, r io.Reader) (*objects.CreateHeader, int64, error) {
+	var (
+		hash = md5.New()
+		cr   = &countingReader{r: io.TeeReader(r, hash)}
+	)
+	header, err := objects.Create(c.clientWithContext(ctx), container, name, objects.CreateOpts{Content: cr, NoETag: true}).Extract()
+	if err != nil {
+		return nil, 0, unwrapReauthErr(err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(strings.Trim(header.ETag, `"`), sum) {
+		return nil, 0, errors.Errorf("ETag %s of uploaded content does not match its MD5 sum %s", header.ETag, sum)
+	}
+	return header, cr.n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// segmentsContainer returns the name of the container storing segments of large objects.
+func (c *Container) segmentsContainer() string {
+	if c.segmentsContainerName != "" {
+		return c.segmentsContainerName
+	}
+	return c.name + "_segments"
+}
+
+// sloSegment is a single entry of a static large object manifest.
+type sloSegment struct {
+	Path      string `json:"path"`
+	Etag      string `json:"etag"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// uploadLargeObject uploads the content as consecutive segments into the segments container and
+// creates a static or dynamic large object manifest referencing them under the given name.
+// The segments of the large object it overwrites, if any, are removed once the manifest is uploaded.
+// Overwriting a large object with a small one leaves its segments to CleanOrphanedObjects.
+func (c *Container) uploadLargeObject(ctx context.Context, name string, segments *segmentReader) error {
+	stale, err := c.largeObjectSegments(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "get segments of overwritten object")
+	}
+
+	segContainer := c.segmentsContainer()
+	if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		return containers.Create(client, segContainer, nil).Err
+	}); err != nil {
+		return errors.Wrapf(err, "create segments container %s", segContainer)
+	}
+
+	// Segments of each upload get own prefix, so overwriting an object never mixes segments of two uploads.
+	prefix := fmt.Sprintf("%s/%d/", name, time.Now().UnixNano())
+
+	var manifest []sloSegment
+	for i := 0; !segments.done(); i++ {
+		segName := fmt.Sprintf("%s%08d", prefix, i)
+		var (
+			header *objects.CreateHeader
+			size   int64
+		)
+		if seg, ok := segments.section(); ok {
+			size = seg.Size()
+			header, err = c.uploadObjectWithHeader(ctx, segContainer, segName, seg, objects.CreateOpts{})
+		} else {
+			header, size, err = c.uploadStreamedObject(ctx, segContainer, segName, segments.stream())
+		}
+		if err != nil {
+			return errors.Wrapf(err, "upload segment %s", segName)
+		}
+		if err := segments.consumed(size); err != nil {
+			return errors.Wrap(err, "read segment")
+		}
+		manifest = append(manifest, sloSegment{Path: "/" + segContainer + "/" + segName, Etag: header.ETag, SizeBytes: size})
+	}
+
+	switch c.largeObjectType {
+	case LargeObjectTypeDLO:
+		err = c.uploadObject(ctx, c.name, name, bytes.NewReader(nil), objects.CreateOpts{
+			ObjectManifest: segContainer + "/" + prefix,
+		})
+	default:
+		b, merr := json.Marshal(manifest)
+		if merr != nil {
+			return errors.Wrap(merr, "marshal manifest")
+		}
+		err = c.uploadObject(ctx, c.name, name, bytes.NewReader(b), objects.CreateOpts{
+			MultipartManifest: "put",
+		})
+	}
+	if err != nil {
+		return errors.Wrap(err, "upload large object manifest")
+	}
+	return errors.Wrap(c.deleteSegments(ctx, stale), "delete segments of overwritten object")
+}
+
+// largeObjectSegments returns the paths, as <container>/<segment name>, of the segments of the large object with the
+// given name. It returns none if the object does not exist or is not a large object.
+func (c *Container) largeObjectSegments(ctx context.Context, name string) ([]string, error) {
+	var headers *objects.GetHeader
+	if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) (err error) {
+		headers, err = objects.Get(client, c.name, name, nil).Extract()
+		return err
+	}); err != nil {
+		if c.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch {
+	case headers.StaticLargeObject:
+		var b []byte
+		if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) (err error) {
+			res := objects.Download(client, c.name, name, objects.DownloadOpts{MultipartManifest: "get"})
+			b, err = res.ExtractContent()
+			return err
+		}); err != nil {
+			return nil, errors.Wrapf(err, "get manifest of %s", name)
+		}
+		// The manifest is returned with the name of the segments rather than their path given on upload.
+		var manifest []struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal manifest of %s", name)
+		}
+		paths := make([]string, 0, len(manifest))
+		for _, seg := range manifest {
+			p := seg.Name
+			if p == "" {
+				p = seg.Path
+			}
+			paths = append(paths, strings.TrimPrefix(p, "/"))
+		}
+		return paths, nil
+	case headers.ObjectManifest != "":
+		container, segNames, err := c.dloSegments(ctx, headers.ObjectManifest)
+		if err != nil {
+			return nil, err
+		}
+		paths := make([]string, 0, len(segNames))
+		for _, segName := range segNames {
+			paths = append(paths, container+"/"+segName)
+		}
+		return paths, nil
+	}
+	return nil, nil
+}
+
+// deleteSegments removes the segments with the given paths, as <container>/<segment name>, using bulk deletes if
+// the cluster supports them. Segments which do not exist anymore are ignored.
+func (c *Container) deleteSegments(ctx context.Context, paths []string) error {
+	byContainer := map[string][]string{}
+	for _, p := range paths {
+		parts := strings.SplitN(p, "/", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("invalid segment path %q", p)
+		}
+		byContainer[parts[0]] = append(byContainer[parts[0]], parts[1])
+	}
+
+	for container, segNames := range byContainer {
+		supported, err := c.bulkDelete(ctx, container, segNames)
+		if err != nil {
+			return err
+		}
+		if supported {
+			continue
+		}
+		for _, segName := range segNames {
+			if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+				return objects.Delete(client, container, segName, nil).Err
+			}); err != nil && !c.IsObjNotFoundErr(err) {
+				return errors.Wrapf(err, "delete segment %s", segName)
+			}
+		}
+	}
+	return nil
+}
+
+// segmentReader splits the content into segments of at most chunkSize bytes.
+// If the total size is known and the reader supports it, segments are read directly from the underlying reader and
+// can be replayed, otherwise each segment is streamed from the reader.
+type segmentReader struct {
+	r         io.Reader
+	size      int64
+	chunkSize int64
+
+	off int64
+	eof bool
+}
+
+func (s *segmentReader) done() bool {
+	if s.size >= 0 {
+		return s.off >= s.size
+	}
+	return s.eof
+}
+
+// section returns the next segment as a section of the underlying reader, if the reader supports it.
+func (s *segmentReader) section() (*io.SectionReader, bool) {
+	ra, ok := s.r.(io.ReaderAt)
+	if !ok || s.size < 0 {
+		return nil, false
+	}
+	n := s.chunkSize
+	if rest := s.size - s.off; rest < n {
+		n = rest
+	}
+	return io.NewSectionReader(ra, s.off, n), true
+}
+
+// stream returns the reader of the next segment. It has to be read until EOF, before consumed is called.
+func (s *segmentReader) stream() io.Reader {
+	return io.LimitReader(s.r, s.chunkSize)
+}
+
+// consumed moves the reader past the content of the segment of n bytes.
+func (s *segmentReader) consumed(n int64) error {
+	s.off += n
+	if s.size >= 0 {
+		if n < s.chunkSize && s.off < s.size {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	if n < s.chunkSize {
+		s.eof = true
+		return nil
+	}
+	// Peek to find out whether the content ended exactly at the segment boundary, so no empty segment is uploaded.
+	var b [1]byte
+	for {
+		m, err := s.r.Read(b[:])
+		if m > 0 {
+			s.r = io.MultiReader(bytes.NewReader(b[:m]), s.r)
+			return nil
+		}
+		if err == io.EOF {
+			s.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Delete removes the object with the given name. Segments of large objects are removed as well.
 func (c *Container) Delete(ctx context.Context, name string) error {
-	return objects.Delete(c.client, c.name, name, nil).Err
+	var headers *objects.GetHeader
+	if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) (err error) {
+		headers, err = objects.Get(client, c.name, name, nil).Extract()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	switch {
+	case headers.StaticLargeObject:
+		return c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+			return objects.Delete(client, c.name, name, objects.DeleteOpts{MultipartManifest: "delete"}).Err
+		})
+	case headers.ObjectManifest != "":
+		if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+			return objects.Delete(client, c.name, name, nil).Err
+		}); err != nil {
+			return err
+		}
+		return errors.Wrap(c.deleteDLOSegments(ctx, headers.ObjectManifest), "delete segments")
+	}
+	return c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		return objects.Delete(client, c.name, name, nil).Err
+	})
+}
+
+// deleteDLOSegments removes all segments referenced by the given dynamic large object manifest.
+func (c *Container) deleteDLOSegments(ctx context.Context, manifest string) error {
+	container, segNames, err := c.dloSegments(ctx, manifest)
+	if err != nil {
+		return err
+	}
+	for _, segName := range segNames {
+		if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+			return objects.Delete(client, container, segName, nil).Err
+		}); err != nil && !c.IsObjNotFoundErr(err) {
+			return errors.Wrapf(err, "delete segment %s", segName)
+		}
+	}
+	return nil
+}
+
+// dloSegments returns the container and the names of the segments referenced by the given dynamic large object
+// manifest.
+func (c *Container) dloSegments(ctx context.Context, manifest string) (string, []string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(manifest, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "", nil, errors.Errorf("invalid object manifest %q", manifest)
+	}
+	container, prefix := parts[0], parts[1]
+	if v, err := url.PathUnescape(container); err == nil {
+		container = v
+	}
+	if v, err := url.PathUnescape(prefix); err == nil {
+		prefix = v
+	}
+
+	var segNames []string
+	if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		segNames = segNames[:0]
+		return objects.List(client, container, &objects.ListOpts{Full: true, Prefix: prefix}).EachPage(func(page pagination.Page) (bool, error) {
+			names, err := objects.ExtractNames(page)
+			if err != nil {
+				return false, err
+			}
+			segNames = append(segNames, names...)
+			return true, nil
+		})
+	}); err != nil {
+		return "", nil, errors.Wrapf(err, "list segments of %s", manifest)
+	}
+	return container, segNames, nil
+}
+
+// CleanOrphanedObjects removes the segments of large objects with the given name prefix older than minAge which are
+// not referenced by their object anymore, e.g. the segments of aborted uploads or of large objects overwritten by
+// small ones. Segments not uploaded by this container, i.e. not named
+// <object name>/<upload timestamp>/<segment number>, are left untouched.
+func (c *Container) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	segContainer := c.segmentsContainer()
+	var segNames []string
+	err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		segNames = segNames[:0]
+		return objects.List(client, segContainer, &objects.ListOpts{Full: true, Prefix: prefix}).EachPage(func(page pagination.Page) (bool, error) {
+			names, err := objects.ExtractNames(page)
+			if err != nil {
+				return false, err
+			}
+			segNames = append(segNames, names...)
+			return true, nil
+		})
+	})
+	if c.IsObjNotFoundErr(err) {
+		// Segments container does not exist, no large objects were uploaded.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "list segments in %s", segContainer)
+	}
+
+	// The segments of uploads in progress are not referenced yet, so only the ones old enough are considered.
+	maxUploadTime := time.Now().Add(-minAge).UnixNano()
+	candidates := map[string][]string{}
+	for _, segName := range segNames {
+		upload := path.Dir(segName)
+		uploadTime, err := strconv.ParseInt(path.Base(upload), 10, 64)
+		if err != nil || upload == "." || uploadTime > maxUploadTime {
+			continue
+		}
+		owner := path.Dir(upload)
+		candidates[owner] = append(candidates[owner], segName)
+	}
+
+	var orphaned []string
+	for owner, names := range candidates {
+		paths, err := c.largeObjectSegments(ctx, owner)
+		if err != nil {
+			return 0, errors.Wrapf(err, "get segments of %s", owner)
+		}
+		referenced := make(map[string]struct{}, len(paths))
+		for _, p := range paths {
+			referenced[p] = struct{}{}
+		}
+		for _, segName := range names {
+			if _, ok := referenced[segContainer+"/"+segName]; !ok {
+				orphaned = append(orphaned, segContainer+"/"+segName)
+			}
+		}
+	}
+	if err := c.deleteSegments(ctx, orphaned); err != nil {
+		return 0, errors.Wrap(err, "delete orphaned segments")
+	}
+	return len(orphaned), nil
+}
+
+// bulkDeleteBatchSize is the maximum number of objects removed by a single bulk delete request.
+// Swift allows up to 10000 by default, keep it lower to not hit request timeouts.
+const bulkDeleteBatchSize = 1000
+
+// bulkDeleteResponse is the response of the Swift bulk delete middleware.
+type bulkDeleteResponse struct {
+	NumberDeleted  int        `json:"Number Deleted"`
+	NumberNotFound int        `json:"Number Not Found"`
+	ResponseStatus string     `json:"Response Status"`
+	ResponseBody   string     `json:"Response Body"`
+	Errors         [][]string `json:"Errors"`
+}
+
+// DeleteMultiple removes all objects with the given names using the bulk delete middleware if the cluster supports it.
+// Segments of large objects uploaded by this container are removed as well.
+func (c *Container) DeleteMultiple(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	supported, err := c.bulkDelete(ctx, c.name, names)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		level.Debug(c.logger).Log("msg", "swift bulk delete is not supported; deleting objects one by one")
+		return objstore.DeleteMultipleConcurrently(ctx, c, names, objstore.DefaultDeleteConcurrency)
+	}
+
+	// Bulk delete does not remove segments of large objects, so find the ones owned by deleted objects. Listing
+	// is done per object since a prefix shared by all names would usually cover the whole segments container.
+	var segNames []string
+	segContainer := c.segmentsContainer()
+	for _, name := range names {
+		var objSegNames []string
+		err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+			objSegNames = objSegNames[:0]
+			opts := &objects.ListOpts{Full: true, Prefix: name + "/"}
+			return objects.List(client, segContainer, opts).EachPage(func(page pagination.Page) (bool, error) {
+				pageNames, err := objects.ExtractNames(page)
+				if err != nil {
+					return false, err
+				}
+				for _, segName := range pageNames {
+					// Segments are named <object name>/<upload timestamp>/<segment number>.
+					if path.Dir(path.Dir(segName)) == name {
+						objSegNames = append(objSegNames, segName)
+					}
+				}
+				return true, nil
+			})
+		})
+		if c.IsObjNotFoundErr(err) {
+			// Segments container does not exist, no large objects were uploaded.
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "list segments of %s in %s", name, segContainer)
+		}
+		segNames = append(segNames, objSegNames...)
+	}
+	if len(segNames) == 0 {
+		return nil
+	}
+	if _, err := c.bulkDelete(ctx, segContainer, segNames); err != nil {
+		return errors.Wrap(err, "delete segments")
+	}
+	return nil
+}
+
+// bulkDelete removes the given objects from the given container using bulk delete requests.
+// It returns false if the cluster does not support bulk deletes.
+func (c *Container) bulkDelete(ctx context.Context, container string, names []string) (bool, error) {
+	for len(names) > 0 {
+		n := len(names)
+		if n > bulkDeleteBatchSize {
+			n = bulkDeleteBatchSize
+		}
+
+		var body bytes.Buffer
+		for _, name := range names[:n] {
+			body.WriteString(escapePath(container + "/" + name))
+			body.WriteString("\n")
+		}
+
+		var resp bulkDeleteResponse
+		if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+			resp = bulkDeleteResponse{}
+			_, err := client.Post(client.ResourceBaseURL()+"?bulk-delete", bytes.NewReader(body.Bytes()), &resp, &gophercloud.RequestOpts{
+				MoreHeaders: map[string]string{"Content-Type": "text/plain"},
+				OkCodes:     []int{http.StatusOK, http.StatusNoContent},
+			})
+			return err
+		}); err != nil {
+			return false, errors.Wrap(err, "bulk delete")
+		}
+		if resp.ResponseStatus == "" {
+			// Without the bulk middleware the request is handled as account metadata update, returning no content.
+			return false, nil
+		}
+		if len(resp.Errors) > 0 {
+			return true, errors.Errorf("bulk delete failed for %d objects, first error: %v", len(resp.Errors), resp.Errors[0])
+		}
+		if !strings.HasPrefix(resp.ResponseStatus, "2") {
+			return true, errors.Errorf("bulk delete failed with status %s: %s", resp.ResponseStatus, resp.ResponseBody)
+		}
+		names = names[n:]
+	}
+	return true, nil
+}
+
+// escapePath URL encodes each element of the given slash separated path.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// Copy copies the object with srcName into the dstName using server side copy.
+// Large objects are copied by re-uploading their content, as server side copy is limited to the maximum object
+// size and copying the manifest only would make both objects share the same segments.
+func (c *Container) Copy(ctx context.Context, srcName, dstName string) error {
+	var headers *objects.GetHeader
+	if err := c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) (err error) {
+		headers, err = objects.Get(client, c.name, srcName, nil).Extract()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if headers.StaticLargeObject || headers.ObjectManifest != "" {
+		rc, err := c.Get(ctx, srcName)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(c.logger, rc, "close large object reader")
+		return c.Upload(ctx, dstName, rc)
+	}
+
+	return c.withAuthRetries(ctx, func(client *gophercloud.ServiceClient) error {
+		return objects.Copy(client, c.name, srcName, objects.CopyOpts{Destination: "/" + c.name + "/" + dstName}).Err
+	})
 }
 
 func (*Container) Close() error {
@@ -184,7 +979,7 @@ func (*Container) Close() error {
 }
 
 func parseConfig(conf []byte) (*SwiftConfig, error) {
-	var sc SwiftConfig
+	sc := DefaultConfig
 	err := yaml.UnmarshalStrict(conf, &sc)
 	return &sc, err
 }
@@ -200,6 +995,10 @@ func authOptsFromConfig(sc *SwiftConfig) gophercloud.AuthOptions {
 		TenantID:         sc.ProjectID,
 		TenantName:       sc.ProjectName,
 
+		ApplicationCredentialID:     sc.ApplicationCredentialID,
+		ApplicationCredentialName:   sc.ApplicationCredentialName,
+		ApplicationCredentialSecret: sc.ApplicationCredentialSecret,
+
 		// Allow Gophercloud to re-authenticate automatically.
 		AllowReauth: true,
 	}
@@ -213,6 +1012,14 @@ func authOptsFromConfig(sc *SwiftConfig) gophercloud.AuthOptions {
 		authOpts.DomainID = sc.UserDomainID
 	}
 
+	// Application credentials are bound to the project they were created in and
+	// Keystone rejects explicitly scoped requests using them.
+	if sc.ApplicationCredentialSecret != "" {
+		authOpts.TenantID = ""
+		authOpts.TenantName = ""
+		return authOpts
+	}
+
 	// A token can be scoped to a domain or project.
 	// The project can be in another domain than the user, which is indicated by setting either projectDomainName or projectDomainID.
 	switch {
@@ -257,6 +1064,15 @@ func configFromEnv() SwiftConfig {
 		UserDomainName:    os.Getenv("OS_USER_DOMAIN_NAME"),
 		ProjectDomainID:   os.Getenv("OS_PROJECT_DOMAIN_ID"),
 		ProjectDomainName: os.Getenv("OS_PROJECT_DOMAIN_NAME"),
+		MaxAuthRetries:    DefaultConfig.MaxAuthRetries,
+		AuthRetryBackoff:  DefaultConfig.AuthRetryBackoff,
+
+		LargeObjectType:      DefaultConfig.LargeObjectType,
+		LargeObjectChunkSize: DefaultConfig.LargeObjectChunkSize,
+
+		ApplicationCredentialID:     os.Getenv("OS_APPLICATION_CREDENTIAL_ID"),
+		ApplicationCredentialName:   os.Getenv("OS_APPLICATION_CREDENTIAL_NAME"),
+		ApplicationCredentialSecret: os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET"),
 	}
 
 	return c
@@ -264,11 +1080,19 @@ func configFromEnv() SwiftConfig {
 
 // validateForTests checks to see the config options for tests are set.
 func validateForTests(conf SwiftConfig) error {
-	if conf.AuthUrl == "" ||
-		conf.Username == "" ||
+	if conf.AuthUrl == "" || conf.RegionName == "" {
+		return errors.New("insufficient swift test configuration information")
+	}
+	// Application credentials carry their own project scope.
+	if conf.ApplicationCredentialSecret != "" {
+		if conf.ApplicationCredentialID == "" && (conf.ApplicationCredentialName == "" || conf.Username == "") {
+			return errors.New("insufficient swift test configuration information")
+		}
+		return nil
+	}
+	if conf.Username == "" ||
 		conf.Password == "" ||
-		(conf.ProjectName == "" && conf.ProjectID == "") ||
-		conf.RegionName == "" {
+		(conf.ProjectName == "" && conf.ProjectID == "") {
 		return errors.New("insufficient swift test configuration information")
 	}
 	return nil
@@ -324,5 +1148,9 @@ func NewTestContainer(t testing.TB) (objstore.Bucket, func(), error) {
 		if err := c.deleteContainer(tmpContainerName); err != nil {
 			t.Logf("deleting container %s failed: %s", tmpContainerName, err)
 		}
+		// Segments container is created only if large objects were uploaded.
+		if err := c.deleteContainer(c.segmentsContainer()); err != nil && !c.IsObjNotFoundErr(err) {
+			t.Logf("deleting container %s failed: %s", c.segmentsContainer(), err)
+		}
 	}, nil
 }
@@ -4,8 +4,28 @@
 package swift
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/gophercloud/gophercloud"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -51,3 +71,435 @@ func TestAuthOptsFromConfig(t *testing.T) {
 	testutil.Equals(t, "projectDomain", authOpts.Scope.DomainName)
 	testutil.Equals(t, "thanosProject", authOpts.Scope.ProjectName)
 }
+
+func TestAuthOptsFromConfig_ApplicationCredentials(t *testing.T) {
+	input := &SwiftConfig{
+		AuthUrl:                     "http://identity.something.com/v3",
+		ApplicationCredentialID:     "abc123",
+		ApplicationCredentialSecret: "secret",
+	}
+
+	authOpts := authOptsFromConfig(input)
+	testutil.Equals(t, "http://identity.something.com/v3", authOpts.IdentityEndpoint)
+	testutil.Equals(t, "abc123", authOpts.ApplicationCredentialID)
+	testutil.Equals(t, "secret", authOpts.ApplicationCredentialSecret)
+	testutil.Equals(t, "", authOpts.Username)
+	testutil.Assert(t, authOpts.Scope == nil, "application credentials must not be scoped")
+}
+
+func newTestContainerWithServer(t *testing.T, h http.Handler) (*Container, func()) {
+	srv := httptest.NewServer(h)
+	c := &Container{
+		logger: log.NewNopLogger(),
+		client: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       srv.URL + "/",
+		},
+		name:           "test",
+		maxAuthRetries: 1,
+		authBackoff:    authBackoff(time.Millisecond),
+
+		largeObjectType: LargeObjectTypeSLO,
+		chunkSize:       DefaultConfig.LargeObjectChunkSize,
+	}
+	return c, srv.Close
+}
+
+func TestContainer_ContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	c, closeFn := newTestContainerWithServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer closeFn()
+	defer close(release)
+
+	for _, tcase := range []struct {
+		name string
+		op   func(ctx context.Context) error
+	}{
+		{name: "Get", op: func(ctx context.Context) error { _, err := c.Get(ctx, "obj"); return err }},
+		{name: "GetRange", op: func(ctx context.Context) error { _, err := c.GetRange(ctx, "obj", 0, 10); return err }},
+		{name: "Exists", op: func(ctx context.Context) error { _, err := c.Exists(ctx, "obj"); return err }},
+		{name: "Attributes", op: func(ctx context.Context) error { _, err := c.Attributes(ctx, "obj"); return err }},
+		{name: "Upload", op: func(ctx context.Context) error { return c.Upload(ctx, "obj", strings.NewReader("data")) }},
+		{name: "Delete", op: func(ctx context.Context) error { return c.Delete(ctx, "obj") }},
+		{name: "Iter", op: func(ctx context.Context) error { return c.Iter(ctx, "", func(string) error { return nil }) }},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			errc := make(chan error, 1)
+			go func() { errc <- tcase.op(ctx) }()
+
+			select {
+			case err := <-errc:
+				testutil.NotOk(t, err)
+				testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded, got %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("operation did not honor context cancellation")
+			}
+		})
+	}
+}
+
+func TestContainer_RetryOnUnauthorized(t *testing.T) {
+	var (
+		requests int
+		uploaded []byte
+	)
+	c, closeFn := newTestContainerWithServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// Reject every other request as if the token expired in between.
+		if requests%2 == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPut {
+			uploaded, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer closeFn()
+
+	testutil.Ok(t, c.Upload(context.Background(), "obj", strings.NewReader("data")))
+	testutil.Equals(t, 2, requests)
+	testutil.Equals(t, "data", string(uploaded))
+
+	// Delete issues HEAD and DELETE requests which are both retried.
+	testutil.Ok(t, c.Delete(context.Background(), "obj"))
+	testutil.Equals(t, 6, requests)
+
+	// Retries are exhausted if token is rejected again.
+	c.maxAuthRetries = 0
+	err := c.Delete(context.Background(), "obj")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, isAuthErr(err), "expected unauthorized error, got %v", err)
+}
+
+func TestParseConfig_DefaultAuthRetries(t *testing.T) {
+	cfg, err := parseConfig([]byte(`auth_url: http://identity.something.com/v3`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, DefaultConfig.MaxAuthRetries, cfg.MaxAuthRetries)
+	testutil.Equals(t, DefaultConfig.AuthRetryBackoff, cfg.AuthRetryBackoff)
+
+	cfg, err = parseConfig([]byte(`max_auth_retries: 3
+auth_retry_backoff: 5s`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, cfg.MaxAuthRetries)
+	testutil.Equals(t, model.Duration(5*time.Second), cfg.AuthRetryBackoff)
+}
+
+// fakeSwift is a minimal in-memory implementation of the Swift objects API sufficient to test large object handling.
+type fakeSwift struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+
+	// bulkDelete enables the bulk delete middleware.
+	bulkDelete bool
+	// failListings makes listings of the given container fail.
+	failListings string
+	listPrefixes []string
+}
+
+func newFakeSwift() *fakeSwift {
+	return &fakeSwift{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+}
+
+func (f *fakeSwift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(path, "/") {
+		// Account and container level requests.
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.Method == http.MethodPost {
+			if !f.bulkDelete {
+				// Without the bulk middleware, bulk deletes are handled as account metadata updates.
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			resp := bulkDeleteResponse{ResponseStatus: "200 OK"}
+			for _, line := range strings.Fields(string(b)) {
+				name, _ := url.PathUnescape(line)
+				if _, ok := f.objects[name]; !ok {
+					resp.NumberNotFound++
+					continue
+				}
+				delete(f.objects, name)
+				resp.NumberDeleted++
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		if path == f.failListings {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var names []string
+		prefix, marker := r.URL.Query().Get("prefix"), r.URL.Query().Get("marker")
+		if marker == "" {
+			f.listPrefixes = append(f.listPrefixes, path+"/"+prefix)
+		}
+		for name := range f.objects {
+			if !strings.HasPrefix(name, path+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(name, path+"/")
+			if strings.HasPrefix(name, prefix) && name > marker {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strings.Join(names, "\n")))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		h := http.Header{}
+		if v := r.Header.Get("X-Object-Manifest"); v != "" {
+			h.Set("X-Object-Manifest", v)
+		}
+		if r.URL.Query().Get("multipart-manifest") == "put" {
+			h.Set("X-Static-Large-Object", "True")
+		}
+		f.objects[path] = b
+		f.headers[path] = h
+		w.Header().Set("Etag", fmt.Sprintf("%x", md5.Sum(b)))
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead:
+		if _, ok := f.objects[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range f.headers[path] {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		b, ok := f.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range f.headers[path] {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	case http.MethodDelete:
+		if _, ok := f.objects[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("multipart-manifest") == "delete" {
+			var segments []sloSegment
+			_ = json.Unmarshal(f.objects[path], &segments)
+			for _, s := range segments {
+				delete(f.objects, strings.TrimPrefix(s.Path, "/"))
+			}
+		}
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeSwift) objectNames(prefix string) []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	var names []string
+	for name := range f.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestContainer_LargeObjects(t *testing.T) {
+	for _, tcase := range []struct {
+		typ    string
+		reader func() io.Reader
+	}{
+		{typ: LargeObjectTypeSLO, reader: func() io.Reader { return strings.NewReader("0123456789") }},
+		{typ: LargeObjectTypeSLO, reader: func() io.Reader { return io.MultiReader(strings.NewReader("0123456789")) }},
+		{typ: LargeObjectTypeSLO, reader: func() io.Reader { return bytes.NewBufferString("0123456789") }},
+		{typ: LargeObjectTypeDLO, reader: func() io.Reader { return strings.NewReader("0123456789") }},
+		{typ: LargeObjectTypeDLO, reader: func() io.Reader { return io.MultiReader(strings.NewReader("0123456789")) }},
+	} {
+		t.Run(tcase.typ, func(t *testing.T) {
+			srv := newFakeSwift()
+			c, closeFn := newTestContainerWithServer(t, srv)
+			defer closeFn()
+			c.largeObjectType = tcase.typ
+			c.chunkSize = 4
+
+			testutil.Ok(t, c.Upload(context.Background(), "dir/obj", tcase.reader()))
+
+			segs := srv.objectNames("test_segments/")
+			testutil.Equals(t, 3, len(segs))
+			var content []byte
+			for _, seg := range segs {
+				content = append(content, srv.objects[seg]...)
+			}
+			testutil.Equals(t, "0123456789", string(content))
+
+			switch tcase.typ {
+			case LargeObjectTypeSLO:
+				testutil.Equals(t, "True", srv.headers["test/dir/obj"].Get("X-Static-Large-Object"))
+				var manifest []sloSegment
+				testutil.Ok(t, json.Unmarshal(srv.objects["test/dir/obj"], &manifest))
+				testutil.Equals(t, 3, len(manifest))
+				testutil.Equals(t, "/"+segs[0], manifest[0].Path)
+				testutil.Equals(t, int64(4), manifest[0].SizeBytes)
+				testutil.Equals(t, int64(2), manifest[2].SizeBytes)
+			case LargeObjectTypeDLO:
+				manifest := srv.headers["test/dir/obj"].Get("X-Object-Manifest")
+				testutil.Assert(t, strings.HasPrefix(segs[0], manifest), "segment %s not matching manifest %s", segs[0], manifest)
+				testutil.Equals(t, 0, len(srv.objects["test/dir/obj"]))
+			}
+
+			testutil.Ok(t, c.Delete(context.Background(), "dir/obj"))
+			testutil.Equals(t, []string(nil), srv.objectNames(""))
+		})
+	}
+}
+
+func TestContainer_SmallObjectsAreNotSegmented(t *testing.T) {
+	srv := newFakeSwift()
+	c, closeFn := newTestContainerWithServer(t, srv)
+	defer closeFn()
+	c.chunkSize = 4
+
+	// Content ending exactly at the chunk boundary must not produce empty segments.
+	testutil.Ok(t, c.Upload(context.Background(), "obj", io.MultiReader(strings.NewReader("0123"))))
+	testutil.Equals(t, []string{"test/obj"}, srv.objectNames(""))
+	testutil.Equals(t, "0123", string(srv.objects["test/obj"]))
+}
+
+func TestParseConfig_LargeObjectType(t *testing.T) {
+	cfg, err := parseConfig([]byte(`large_object_type: dlo`))
+	testutil.Ok(t, err)
+	testutil.Ok(t, cfg.validate())
+	testutil.Equals(t, LargeObjectTypeDLO, cfg.LargeObjectType)
+	testutil.Equals(t, DefaultConfig.LargeObjectChunkSize, cfg.LargeObjectChunkSize)
+
+	cfg, err = parseConfig([]byte(`large_object_type: other`))
+	testutil.Ok(t, err)
+	testutil.NotOk(t, cfg.validate())
+}
+
+func TestContainer_LargeObjectsOverwrite(t *testing.T) {
+	for _, typ := range []string{LargeObjectTypeSLO, LargeObjectTypeDLO} {
+		t.Run(typ, func(t *testing.T) {
+			srv := newFakeSwift()
+			c, closeFn := newTestContainerWithServer(t, srv)
+			defer closeFn()
+			c.largeObjectType = typ
+			c.chunkSize = 4
+
+			testutil.Ok(t, c.Upload(context.Background(), "dir/obj", strings.NewReader("0123456789")))
+			old := srv.objectNames("test_segments/")
+			testutil.Equals(t, 3, len(old))
+
+			// Segments of the overwritten object are removed.
+			testutil.Ok(t, c.Upload(context.Background(), "dir/obj", strings.NewReader("abcdef")))
+			segs := srv.objectNames("test_segments/")
+			testutil.Equals(t, 2, len(segs))
+			for _, seg := range segs {
+				testutil.Assert(t, seg != old[0], "segment %s of overwritten object not removed", seg)
+			}
+		})
+	}
+}
+
+func TestContainer_CleanOrphanedObjects(t *testing.T) {
+	srv := newFakeSwift()
+	c, closeFn := newTestContainerWithServer(t, srv)
+	defer closeFn()
+	c.chunkSize = 4
+
+	ctx := context.Background()
+	n, err := c.CleanOrphanedObjects(ctx, "", 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, n)
+
+	testutil.Ok(t, c.Upload(ctx, "dir/obj", strings.NewReader("0123456789")))
+	testutil.Ok(t, c.Upload(ctx, "dir/overwritten", strings.NewReader("0123456789")))
+	testutil.Ok(t, c.Upload(ctx, "dir/overwritten", strings.NewReader("01")))
+	// Segments of an aborted upload and segments not uploaded by Thanos.
+	srv.objects["test_segments/dir/aborted/1/00000000"] = []byte("0123")
+	srv.objects["test_segments/other"] = []byte("0123")
+	testutil.Equals(t, 8, len(srv.objectNames("test_segments/")))
+
+	// Recent segments are kept, as their upload might be in progress.
+	n, err = c.CleanOrphanedObjects(ctx, "", time.Hour)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, n)
+	testutil.Equals(t, 7, len(srv.objectNames("test_segments/")))
+
+	n, err = c.CleanOrphanedObjects(ctx, "", 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, n)
+	segs := srv.objectNames("test_segments/")
+	testutil.Equals(t, 4, len(segs))
+	testutil.Equals(t, "test_segments/other", segs[3])
+	for _, seg := range segs[:3] {
+		testutil.Assert(t, strings.HasPrefix(seg, "test_segments/dir/obj/"), "unexpected segment %s", seg)
+	}
+
+	// Prefixed buckets only clean the segments of their own objects.
+	srv.objects["test_segments/dir/aborted/1/00000000"] = []byte("0123")
+	srv.objects["test_segments/tenant/aborted/1/00000000"] = []byte("0123")
+	n, err = objstore.NewPrefixedBucket(c, "tenant").CleanOrphanedObjects(ctx, "", 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, n)
+	testutil.Equals(t, []string(nil), srv.objectNames("test_segments/tenant/"))
+	testutil.Equals(t, 4, len(srv.objectNames("test_segments/dir/")))
+}
+
+func TestContainer_DeleteMultiple(t *testing.T) {
+	srv := newFakeSwift()
+	srv.bulkDelete = true
+	c, closeFn := newTestContainerWithServer(t, srv)
+	defer closeFn()
+	c.chunkSize = 4
+
+	ctx := context.Background()
+	testutil.Ok(t, c.Upload(ctx, "a/large", strings.NewReader("0123456789")))
+	testutil.Ok(t, c.Upload(ctx, "b/small", strings.NewReader("01")))
+	testutil.Ok(t, c.Upload(ctx, "b/other", strings.NewReader("0123456789")))
+	testutil.Equals(t, 6, len(srv.objectNames("test_segments/")))
+
+	// Segments are listed per deleted object instead of listing the whole segments container.
+	srv.listPrefixes = nil
+	testutil.Ok(t, c.DeleteMultiple(ctx, []string{"a/large", "b/small"}))
+	testutil.Equals(t, []string{"test_segments/a/large/", "test_segments/b/small/"}, srv.listPrefixes)
+	testutil.Equals(t, []string{"test/b/other"}, srv.objectNames("test/"))
+	segs := srv.objectNames("test_segments/")
+	testutil.Equals(t, 3, len(segs))
+	for _, seg := range segs {
+		testutil.Assert(t, strings.HasPrefix(seg, "test_segments/b/other/"), "unexpected segment %s", seg)
+	}
+
+	// Failing to list segments is reported even if there are no segments to delete.
+	srv.failListings = "test_segments"
+	testutil.NotOk(t, c.DeleteMultiple(ctx, []string{"b/small"}))
+}
@@ -183,6 +183,18 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 	}))
 	testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/obj_3.some"}, seen)
 
+	// Can we iter over items with attributes, without asking for them separately?
+	seenAttrs := map[string]ObjectAttributes{}
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "", func(fn string, attrs ObjectAttributes) error {
+		seenAttrs[fn] = attrs
+		return nil
+	}))
+	testutil.Equals(t, 3, len(seenAttrs))
+	testutil.Equals(t, int64(12), seenAttrs["obj_5.some"].Size)
+	testutil.Assert(t, !seenAttrs["obj_5.some"].LastModified.IsZero(), "expected last modified to be set for obj_5.some")
+	testutil.Equals(t, ObjectAttributes{}, seenAttrs["id1/"])
+	testutil.Equals(t, ObjectAttributes{}, seenAttrs["id2/"])
+
 	// Can we iter over items from not existing dir?
 	testutil.Ok(t, bkt.Iter(ctx, "id0", func(fn string) error {
 		t.Error("Not expected to loop through not existing directory")
@@ -191,6 +203,29 @@ func AcceptanceTest(t *testing.T, bkt Bucket) {
 		return nil
 	}))
 
+	// Copy should create a new object with the same content.
+	testutil.Ok(t, bkt.Copy(ctx, "id1/obj_3.some", "id2/obj_3_copy.some"))
+	rcCopy, err := bkt.Get(ctx, "id2/obj_3_copy.some")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, rcCopy.Close()) }()
+	content, err = ioutil.ReadAll(rcCopy)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "@test-data3@", string(content))
+
+	err = bkt.Copy(ctx, "id1/obj_not_existing.some", "id2/obj_not_existing.some")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, bkt.IsObjNotFoundErr(err), "expected not found error but got %s", err)
+	testutil.Ok(t, bkt.Upload(ctx, "id2/obj_3_copy_2.some", strings.NewReader("@test-data3@")))
+
+	// DeleteMultiple should remove all given objects and ignore the ones which do not exist.
+	testutil.Ok(t, bkt.DeleteMultiple(ctx, []string{"id2/obj_3_copy.some", "id2/obj_3_copy_2.some", "id2/obj_not_existing.some"}))
+	for _, name := range []string{"id2/obj_3_copy.some", "id2/obj_3_copy_2.some"} {
+		ok, err := bkt.Exists(ctx, name)
+		testutil.Ok(t, err)
+		testutil.Assert(t, !ok, "expected %s to be deleted", name)
+	}
+	testutil.Ok(t, bkt.DeleteMultiple(ctx, nil))
+
 	testutil.Ok(t, bkt.Delete(ctx, "id1/obj_2.some"))
 
 	// Delete is expected to fail on non existing object.
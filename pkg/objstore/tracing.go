@@ -6,87 +6,194 @@ package objstore
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
-// TracingBucket includes bucket operations in the traces.
+// Tags of the spans of the bucket operations.
+const (
+	TagOperation  = "objstore.operation"
+	TagBucket     = "objstore.bucket"
+	TagName       = "objstore.name"
+	TagDir        = "objstore.dir"
+	TagDstName    = "objstore.dst_name"
+	TagOffset     = "objstore.offset"
+	TagLength     = "objstore.length"
+	TagObjects    = "objstore.objects"
+	TagBytesRead  = "objstore.bytes_read"
+	TagBytesWrite = "objstore.bytes_written"
+	TagStatusCode = "objstore.status_code"
+	TagNotFound   = "objstore.not_found"
+)
+
+// TracingBucket includes bucket operations in the traces, with their objects, the number of bytes read or written and,
+// on failures, the status code of the provider.
 type TracingBucket struct {
-	bkt Bucket
+	bkt                Bucket
+	statusCodeResolver ErrStatusCodeResolver
 }
 
 func NewTracingBucket(bkt Bucket) InstrumentedBucket {
-	return TracingBucket{bkt: bkt}
+	t := TracingBucket{bkt: bkt}
+	t.statusCodeResolver, _ = bkt.(ErrStatusCodeResolver)
+	return t
+}
+
+// startSpan starts the span of the given operation, tagged with the operation and the bucket.
+func (t TracingBucket) startSpan(ctx context.Context, operationName, op string) (opentracing.Span, context.Context) {
+	span, spanCtx := tracing.StartSpan(ctx, operationName)
+	span.SetTag(TagOperation, op)
+	span.SetTag(TagBucket, t.bkt.Name())
+	return span, spanCtx
+}
+
+// finishSpan tags the span with the error of the operation, if any, and finishes it.
+func (t TracingBucket) finishSpan(span opentracing.Span, err error) {
+	t.tagErr(span, err)
+	span.Finish()
+}
+
+func (t TracingBucket) tagErr(span opentracing.Span, err error) {
+	if err == nil {
+		return
+	}
+	if t.statusCodeResolver != nil {
+		if code := t.statusCodeResolver.ErrStatusCode(err); code != 0 {
+			span.SetTag(TagStatusCode, code)
+		}
+	}
+	// Missing objects are often expected, e.g. for optional files, so they are not marked as errors.
+	if t.bkt.IsObjNotFoundErr(err) {
+		span.SetTag(TagNotFound, true)
+		return
+	}
+	ext.Error.Set(span, true)
+	span.LogKV("err", err)
 }
 
 func (t TracingBucket) Iter(ctx context.Context, dir string, f func(string) error) (err error) {
-	tracing.DoWithSpan(ctx, "bucket_iter", func(spanCtx context.Context, span opentracing.Span) {
-		span.LogKV("dir", dir)
-		err = t.bkt.Iter(spanCtx, dir, f)
+	span, spanCtx := t.startSpan(ctx, "bucket_iter", OpIter)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagDir, dir)
+
+	objects := 0
+	err = t.bkt.Iter(spanCtx, dir, func(name string) error {
+		objects++
+		return f(name)
+	})
+	span.SetTag(TagObjects, objects)
+	return err
+}
+
+func (t TracingBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error) (err error) {
+	span, spanCtx := t.startSpan(ctx, "bucket_iter_with_attributes", OpIter)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagDir, dir)
+
+	objects := 0
+	err = t.bkt.IterWithAttributes(spanCtx, dir, func(name string, attrs ObjectAttributes) error {
+		objects++
+		return f(name, attrs)
 	})
-	return
+	span.SetTag(TagObjects, objects)
+	return err
 }
 
 func (t TracingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	span, spanCtx := tracing.StartSpan(ctx, "bucket_get")
-	span.LogKV("name", name)
+	span, spanCtx := t.startSpan(ctx, "bucket_get", OpGet)
+	span.SetTag(TagName, name)
 
 	r, err := t.bkt.Get(spanCtx, name)
 	if err != nil {
-		span.LogKV("err", err)
-		span.Finish()
+		t.finishSpan(span, err)
 		return nil, err
 	}
 
-	return &tracingReadCloser{r: r, s: span}, nil
+	return &tracingReadCloser{r: r, s: span, bkt: t}, nil
 }
 
 func (t TracingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
-	span, spanCtx := tracing.StartSpan(ctx, "bucket_getrange")
-	span.LogKV("name", name, "offset", off, "length", length)
+	span, spanCtx := t.startSpan(ctx, "bucket_getrange", OpGetRange)
+	span.SetTag(TagName, name)
+	span.SetTag(TagOffset, off)
+	span.SetTag(TagLength, length)
 
 	r, err := t.bkt.GetRange(spanCtx, name, off, length)
 	if err != nil {
-		span.LogKV("err", err)
-		span.Finish()
+		t.finishSpan(span, err)
 		return nil, err
 	}
 
-	return &tracingReadCloser{r: r, s: span}, nil
+	return &tracingReadCloser{r: r, s: span, bkt: t}, nil
 }
 
 func (t TracingBucket) Exists(ctx context.Context, name string) (exists bool, err error) {
-	tracing.DoWithSpan(ctx, "bucket_exists", func(spanCtx context.Context, span opentracing.Span) {
-		span.LogKV("name", name)
-		exists, err = t.bkt.Exists(spanCtx, name)
-	})
-	return
+	span, spanCtx := t.startSpan(ctx, "bucket_exists", OpExists)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagName, name)
+
+	return t.bkt.Exists(spanCtx, name)
 }
 
 func (t TracingBucket) Attributes(ctx context.Context, name string) (attrs ObjectAttributes, err error) {
-	tracing.DoWithSpan(ctx, "bucket_attributes", func(spanCtx context.Context, span opentracing.Span) {
-		span.LogKV("name", name)
-		attrs, err = t.bkt.Attributes(spanCtx, name)
-	})
-	return
+	span, spanCtx := t.startSpan(ctx, "bucket_attributes", OpAttributes)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagName, name)
+
+	return t.bkt.Attributes(spanCtx, name)
 }
 
 func (t TracingBucket) Upload(ctx context.Context, name string, r io.Reader) (err error) {
-	tracing.DoWithSpan(ctx, "bucket_upload", func(spanCtx context.Context, span opentracing.Span) {
-		span.LogKV("name", name)
-		err = t.bkt.Upload(spanCtx, name, r)
-	})
-	return
+	span, spanCtx := t.startSpan(ctx, "bucket_upload", OpUpload)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagName, name)
+
+	// Readers of known size are passed as they are, as providers use their type to get the size.
+	size, sizeErr := TryToGetSize(r)
+	var counting *countingReader
+	if sizeErr != nil {
+		counting = &countingReader{Reader: r}
+		r = counting
+	}
+
+	if err = t.bkt.Upload(spanCtx, name, r); err != nil {
+		// Failed uploads might have written only part of the content, if any.
+		return err
+	}
+	if counting != nil {
+		size = counting.n
+	}
+	span.SetTag(TagBytesWrite, size)
+	return nil
 }
 
 func (t TracingBucket) Delete(ctx context.Context, name string) (err error) {
-	tracing.DoWithSpan(ctx, "bucket_delete", func(spanCtx context.Context, span opentracing.Span) {
-		span.LogKV("name", name)
-		err = t.bkt.Delete(spanCtx, name)
-	})
-	return
+	span, spanCtx := t.startSpan(ctx, "bucket_delete", OpDelete)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagName, name)
+
+	return t.bkt.Delete(spanCtx, name)
+}
+
+func (t TracingBucket) Copy(ctx context.Context, srcName, dstName string) (err error) {
+	span, spanCtx := t.startSpan(ctx, "bucket_copy", OpCopy)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagName, srcName)
+	span.SetTag(TagDstName, dstName)
+
+	return t.bkt.Copy(spanCtx, srcName, dstName)
+}
+
+func (t TracingBucket) DeleteMultiple(ctx context.Context, names []string) (err error) {
+	span, spanCtx := t.startSpan(ctx, "bucket_delete_multiple", OpDeleteMultiple)
+	defer func() { t.finishSpan(span, err) }()
+	span.SetTag(TagObjects, len(names))
+
+	return t.bkt.DeleteMultiple(spanCtx, names)
 }
 
 func (t TracingBucket) Name() string {
@@ -101,9 +208,35 @@ func (t TracingBucket) IsObjNotFoundErr(err error) bool {
 	return t.bkt.IsObjNotFoundErr(err)
 }
 
+// ErrStatusCode implements objstore.ErrStatusCodeResolver if the underlying bucket does.
+func (t TracingBucket) ErrStatusCode(err error) int {
+	if t.statusCodeResolver != nil {
+		return t.statusCodeResolver.ErrStatusCode(err)
+	}
+	return 0
+}
+
+// CleanOrphanedObjects implements objstore.OrphanedObjectsCleaner. It returns ErrNotSupported if the underlying
+// bucket does not implement it.
+func (t TracingBucket) CleanOrphanedObjects(ctx context.Context, prefix string, minAge time.Duration) (int, error) {
+	if c, ok := t.bkt.(OrphanedObjectsCleaner); ok {
+		return c.CleanOrphanedObjects(ctx, prefix, minAge)
+	}
+	return 0, ErrNotSupported
+}
+
+// ExpirationRules implements objstore.ExpirationRulesReader. It returns ErrNotSupported if the underlying bucket
+// does not implement it.
+func (t TracingBucket) ExpirationRules(ctx context.Context) ([]ExpirationRule, error) {
+	if r, ok := t.bkt.(ExpirationRulesReader); ok {
+		return r.ExpirationRules(ctx)
+	}
+	return nil, ErrNotSupported
+}
+
 func (t TracingBucket) WithExpectedErrs(expectedFunc IsOpFailureExpectedFunc) Bucket {
 	if ib, ok := t.bkt.(InstrumentedBucket); ok {
-		return TracingBucket{bkt: ib.WithExpectedErrs(expectedFunc)}
+		return TracingBucket{bkt: ib.WithExpectedErrs(expectedFunc), statusCodeResolver: t.statusCodeResolver}
 	}
 	return t
 }
@@ -115,16 +248,18 @@ func (t TracingBucket) ReaderWithExpectedErrs(expectedFunc IsOpFailureExpectedFu
 type tracingReadCloser struct {
 	r    io.ReadCloser
 	s    opentracing.Span
-	read int
+	bkt  TracingBucket
+	read int64
+	err  error
 }
 
 func (t *tracingReadCloser) Read(p []byte) (int, error) {
 	n, err := t.r.Read(p)
 	if n > 0 {
-		t.read += n
+		t.read += int64(n)
 	}
-	if err != nil && err != io.EOF && t.s != nil {
-		t.s.LogKV("err", err)
+	if err != nil && err != io.EOF && t.err == nil {
+		t.err = err
 	}
 	return n, err
 }
@@ -132,11 +267,11 @@ func (t *tracingReadCloser) Read(p []byte) (int, error) {
 func (t *tracingReadCloser) Close() error {
 	err := t.r.Close()
 	if t.s != nil {
-		t.s.LogKV("read", t.read)
-		if err != nil {
-			t.s.LogKV("close err", err)
+		t.s.SetTag(TagBytesRead, t.read)
+		if t.err == nil {
+			t.err = err
 		}
-		t.s.Finish()
+		t.bkt.finishSpan(t.s, t.err)
 		t.s = nil
 	}
 	return err
@@ -0,0 +1,59 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+func TestTracingBucket(t *testing.T) {
+	tracer := mocktracer.New()
+	ctx := tracing.ContextWithTracer(context.Background(), tracer)
+	bkt := NewTracingBucket(BucketWithMetrics("abc", failingBucket{Bucket: NewInMemBucket()}, nil))
+
+	// Readers of unknown size are counted.
+	testutil.Ok(t, bkt.Upload(ctx, "obj", ioutil.NopCloser(strings.NewReader("hello world"))))
+	testutil.Ok(t, bkt.Upload(ctx, "obj2", bytes.NewReader([]byte("hello"))))
+	// Bytes of failed uploads are not reported.
+	testutil.NotOk(t, bkt.Upload(ctx, "503", bytes.NewReader([]byte("hello"))))
+
+	rc, err := bkt.GetRange(ctx, "obj", 6, 5)
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "world", string(b))
+	testutil.Ok(t, rc.Close())
+
+	_, err = bkt.Get(ctx, "503")
+	testutil.NotOk(t, err)
+	_, err = bkt.Get(ctx, "missing")
+	testutil.NotOk(t, err)
+
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+
+	spans := tracer.FinishedSpans()
+	testutil.Equals(t, 7, len(spans))
+
+	for i, expected := range []map[string]interface{}{
+		{TagOperation: OpUpload, TagBucket: "inmem", TagName: "obj", TagBytesWrite: int64(11)},
+		{TagOperation: OpUpload, TagBucket: "inmem", TagName: "obj2", TagBytesWrite: int64(5)},
+		{TagOperation: OpUpload, TagBucket: "inmem", TagName: "503", TagStatusCode: 503, "error": true},
+		{TagOperation: OpGetRange, TagBucket: "inmem", TagName: "obj", TagOffset: int64(6), TagLength: int64(5), TagBytesRead: int64(5)},
+		{TagOperation: OpGet, TagBucket: "inmem", TagName: "503", TagStatusCode: 503, "error": true},
+		{TagOperation: OpGet, TagBucket: "inmem", TagName: "missing", TagNotFound: true},
+		{TagOperation: OpIter, TagBucket: "inmem", TagDir: "", TagObjects: 2},
+	} {
+		testutil.Equals(t, expected, spans[i].Tags(), spans[i].OperationName)
+	}
+	testutil.Equals(t, "bucket_getrange", spans[3].OperationName)
+}
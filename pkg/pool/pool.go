@@ -22,6 +22,7 @@ type BucketedBytesPool struct {
 	sizes     []int
 	maxTotal  uint64
 	usedTotal uint64
+	exhausted uint64
 	mtx       sync.Mutex
 
 	new func(s int) *[]byte
@@ -67,6 +68,7 @@ func (p *BucketedBytesPool) Get(sz int) (*[]byte, error) {
 	defer p.mtx.Unlock()
 
 	if p.maxTotal > 0 && p.usedTotal+uint64(sz) > p.maxTotal {
+		p.exhausted++
 		return nil, ErrPoolExhausted
 	}
 
@@ -115,3 +117,23 @@ func (p *BucketedBytesPool) Put(b *[]byte) {
 		p.usedTotal -= sz
 	}
 }
+
+// UsedBytes returns the number of bytes obtained from the pool and not returned yet.
+func (p *BucketedBytesPool) UsedBytes() uint64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.usedTotal
+}
+
+// MaxBytes returns the maximum number of bytes which can be used at a given time, or 0 if not limited.
+func (p *BucketedBytesPool) MaxBytes() uint64 {
+	return p.maxTotal
+}
+
+// Exhausted returns the number of byte slices the pool could not provide, as more than the maximum number of
+// bytes would have been used.
+func (p *BucketedBytesPool) Exhausted() uint64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.exhausted
+}
@@ -58,6 +58,9 @@ func TestBytesPool(t *testing.T) {
 	b2, err := chunkPool.Get(600)
 	testutil.NotOk(t, err)
 	testutil.Equals(t, ErrPoolExhausted, err)
+	testutil.Equals(t, uint64(500), chunkPool.UsedBytes())
+	testutil.Equals(t, uint64(1000), chunkPool.MaxBytes())
+	testutil.Equals(t, uint64(1), chunkPool.Exhausted())
 
 	chunkPool.Put(b1)
 	chunkPool.Put(b2)
@@ -31,9 +31,11 @@ import (
 	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	"google.golang.org/grpc/codes"
 	yaml "gopkg.in/yaml.v2"
@@ -727,3 +729,42 @@ func (c *Client) RulesInGRPC(ctx context.Context, base *url.URL, typeRules strin
 	}
 	return m.Data.Groups, nil
 }
+
+// TargetsInGRPC returns the targets from Prometheus targets API. It uses gRPC errors.
+func (c *Client) TargetsInGRPC(ctx context.Context, base *url.URL, stateTargets string) (*targetspb.TargetDiscovery, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/targets")
+
+	if stateTargets != "" {
+		q := u.Query()
+		q.Add("state", stateTargets)
+		u.RawQuery = q.Encode()
+	}
+
+	var m struct {
+		Data *targetspb.TargetDiscovery `json:"data"`
+	}
+	return m.Data, c.get2xxResultWithGRPCErrors(ctx, "/prom_targets HTTP[client]", &u, &m)
+}
+
+// MetadataInGRPC returns the metadata from Prometheus metric metadata API. It uses gRPC errors.
+func (c *Client) MetadataInGRPC(ctx context.Context, base *url.URL, metric string, limit int) (*metadatapb.MetricMetadata, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/metadata")
+	q := u.Query()
+
+	if metric != "" {
+		q.Add("metric", metric)
+	}
+	// We only set limit when it is >= 0.
+	if limit >= 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	u.RawQuery = q.Encode()
+
+	var m struct {
+		Data *metadatapb.MetricMetadata `json:"data"`
+	}
+	return m.Data, c.get2xxResultWithGRPCErrors(ctx, "/prom_metadata HTTP[client]", &u, &m)
+}
@@ -0,0 +1,309 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/edsrzf/mmap-go"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// activeQueriesFile is the name of the file the active queries are logged in.
+	activeQueriesFile = "queries.active"
+	// activeQuerySlotSize is the size of the slot of each query in the active queries log.
+	activeQuerySlotSize = 1000
+)
+
+// ActiveQuery is the status of a query in flight in the querier.
+type ActiveQuery struct {
+	ID         uint64    `json:"id"`
+	Endpoint   string    `json:"endpoint"`
+	Query      string    `json:"query,omitempty"`
+	Originator string    `json:"originator"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Start      time.Time `json:"start"`
+	// Matchers are the matchers of the series selected by the query so far.
+	Matchers []string `json:"matchers"`
+	// Stores are the StoreAPIs queried by the query so far.
+	Stores []string `json:"stores"`
+}
+
+// activeQuery is a query in flight, updated by the queriers created for it.
+type activeQuery struct {
+	mtx      sync.Mutex
+	status   ActiveQuery
+	matchers map[string]struct{}
+	stores   map[string]struct{}
+}
+
+func (q *activeQuery) addMatchers(ms []*labels.Matcher) {
+	strs := make([]string, 0, len(ms))
+	for _, m := range ms {
+		strs = append(strs, m.String())
+	}
+	s := "{" + strings.Join(strs, ", ") + "}"
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if _, ok := q.matchers[s]; !ok {
+		q.matchers[s] = struct{}{}
+		q.status.Matchers = append(q.status.Matchers, s)
+	}
+}
+
+func (q *activeQuery) addStore(store string) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if _, ok := q.stores[store]; !ok {
+		q.stores[store] = struct{}{}
+		q.status.Stores = append(q.status.Stores, store)
+	}
+}
+
+func (q *activeQuery) get() ActiveQuery {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	s := q.status
+	s.Matchers = append([]string{}, q.status.Matchers...)
+	s.Stores = append([]string{}, q.status.Stores...)
+	return s
+}
+
+// ActiveQueries tracks the queries in flight in the querier. If it is given a directory, the active queries are
+// also logged on disk, so that the queries in flight when the querier crashed, e.g. because of an OOM, are reported
+// at the next start. Like in Prometheus, the log is a preallocated file mapped in memory, where each query is written
+// in its own slot, so that inserting and removing a query only writes its slot.
+type ActiveQueries struct {
+	logger log.Logger
+
+	mtx     sync.Mutex
+	nextID  uint64
+	queries map[uint64]*activeQuery
+
+	// log is the memory mapped log of the active queries, if any.
+	log mmap.MMap
+	// freeSlots are the offsets of the free slots of the log.
+	freeSlots []int
+}
+
+// NewActiveQueries returns ActiveQueries logging the active queries in the given directory, if not empty, in a log of
+// the given number of slots. The queries inserted while all slots are used are not logged. The queries left active in
+// the directory by the previous run are logged.
+func NewActiveQueries(logger log.Logger, dir string, slots int) (*ActiveQueries, error) {
+	a := &ActiveQueries{logger: logger, queries: map[uint64]*activeQuery{}}
+	if dir == "" {
+		return a, nil
+	}
+	if slots <= 0 {
+		return nil, errors.New("the active queries log needs at least one slot")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, errors.Wrap(err, "create active queries directory")
+	}
+	path := filepath.Join(dir, activeQueriesFile)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "read active queries")
+	}
+	unfinished, err := parseActiveQueriesLog(b)
+	if err != nil {
+		level.Warn(logger).Log("msg", "ignoring corrupted active queries log", "file", path, "err", err)
+	}
+	for _, q := range unfinished {
+		level.Warn(logger).Log("msg", "query did not finish in the last run", "endpoint", q.Endpoint, "query", q.Query,
+			"originator", q.Originator, "tenant", q.Tenant, "start", q.Start.Format(time.RFC3339))
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0640)
+	if err != nil {
+		return nil, errors.Wrap(err, "open active queries log")
+	}
+	defer runutil.CloseWithLogOnErr(logger, f, "active queries log")
+	if err := f.Truncate(int64(1 + slots*activeQuerySlotSize)); err != nil {
+		return nil, errors.Wrap(err, "allocate active queries log")
+	}
+	if a.log, err = mmap.Map(f, mmap.RDWR, 0); err != nil {
+		return nil, errors.Wrap(err, "mmap active queries log")
+	}
+	a.log[0] = '['
+	for i := slots - 1; i >= 0; i-- {
+		a.freeSlots = append(a.freeSlots, 1+i*activeQuerySlotSize)
+	}
+	return a, nil
+}
+
+// Insert tracks a query of the given endpoint until the returned function is called. The queriers created with the
+// returned context record the series selected and the StoreAPIs queried by the query. Nothing is tracked by nil
+// ActiveQueries.
+func (a *ActiveQueries) Insert(ctx context.Context, endpoint, query, originator, tenant string) (context.Context, func()) {
+	if a == nil {
+		return ctx, func() {}
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.nextID++
+	q := &activeQuery{
+		status: ActiveQuery{
+			ID:         a.nextID,
+			Endpoint:   endpoint,
+			Query:      query,
+			Originator: originator,
+			Tenant:     tenant,
+			Start:      time.Now(),
+			Matchers:   []string{},
+			Stores:     []string{},
+		},
+		matchers: map[string]struct{}{},
+		stores:   map[string]struct{}{},
+	}
+	a.queries[q.status.ID] = q
+	slot := a.logLocked(q.status)
+
+	return context.WithValue(ctx, activeQueryKey{}, q), func() {
+		a.mtx.Lock()
+		defer a.mtx.Unlock()
+
+		delete(a.queries, q.status.ID)
+		if slot >= 0 {
+			copy(a.log[slot:slot+activeQuerySlotSize], make([]byte, activeQuerySlotSize))
+			a.freeSlots = append(a.freeSlots, slot)
+		}
+	}
+}
+
+// logLocked writes the query in a free slot of the log, and returns the offset of the slot. It returns -1 if the
+// query is not logged.
+func (a *ActiveQueries) logLocked(q ActiveQuery) int {
+	if a.log == nil {
+		return -1
+	}
+	if len(a.freeSlots) == 0 {
+		level.Debug(a.logger).Log("msg", "no free slot in the active queries log, query not logged", "endpoint", q.Endpoint, "query", q.Query)
+		return -1
+	}
+	entry, err := newActiveQueryEntry(q)
+	if err != nil {
+		level.Warn(a.logger).Log("msg", "failed to log active query", "err", err)
+		return -1
+	}
+
+	slot := a.freeSlots[len(a.freeSlots)-1]
+	a.freeSlots = a.freeSlots[:len(a.freeSlots)-1]
+	copy(a.log[slot:], entry)
+	a.log[slot+activeQuerySlotSize-1] = ','
+	return slot
+}
+
+// List returns the active queries, sorted by start time. It is safe to call on nil ActiveQueries.
+func (a *ActiveQueries) List() []ActiveQuery {
+	return a.list(func(ActiveQuery) bool { return true })
+}
+
+// ListTenant returns the active queries of the given tenant, sorted by start time. It is safe to call on nil
+// ActiveQueries.
+func (a *ActiveQueries) ListTenant(tenant string) []ActiveQuery {
+	return a.list(func(q ActiveQuery) bool { return q.Tenant == tenant })
+}
+
+func (a *ActiveQueries) list(keep func(ActiveQuery) bool) []ActiveQuery {
+	if a == nil {
+		return []ActiveQuery{}
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	res := make([]ActiveQuery, 0, len(a.queries))
+	for _, q := range a.queries {
+		if s := q.get(); keep(s) {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// newActiveQueryEntry returns the JSON entry of the query in the log, followed by a comma once written in its slot.
+// Only the fields of the query known at its start are logged, and the query is trimmed to fit in the slot.
+func newActiveQueryEntry(q ActiveQuery) ([]byte, error) {
+	entry := ActiveQuery{
+		ID:         q.ID,
+		Endpoint:   q.Endpoint,
+		Originator: q.Originator,
+		Tenant:     q.Tenant,
+		Start:      q.Start,
+	}
+	for size := len(q.Query); ; {
+		entry.Query = trimStringByBytes(q.Query, size)
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal active query")
+		}
+		// The last byte of the slot is the comma separating the entries.
+		excess := len(b) - (activeQuerySlotSize - 1)
+		if excess <= 0 {
+			return b, nil
+		}
+		if len(entry.Query) == 0 {
+			return nil, errors.New("active query does not fit in a slot of the log")
+		}
+		// Escaped characters take more bytes in JSON than in the query, so the query is trimmed until it fits.
+		size = len(entry.Query) - excess
+		if size < 0 {
+			size = 0
+		}
+	}
+}
+
+// trimStringByBytes returns the longest prefix of the string of at most size bytes, not splitting UTF-8 characters.
+func trimStringByBytes(s string, size int) string {
+	if size >= len(s) {
+		return s
+	}
+	for size > 0 && !utf8.RuneStart(s[size]) {
+		size--
+	}
+	return s[:size]
+}
+
+// parseActiveQueriesLog parses the queries of the active queries log. The entries of the slots are separated by
+// commas and the unused slots are zeroed, so the log is a JSON array once they are removed.
+func parseActiveQueriesLog(b []byte) ([]ActiveQuery, error) {
+	s := strings.TrimRight(strings.ReplaceAll(string(b), "\x00", ""), ",")
+	if len(s) <= 1 {
+		return nil, nil
+	}
+	var queries []ActiveQuery
+	if err := json.Unmarshal([]byte(s+"]"), &queries); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+type activeQueryKey struct{}
+
+func activeQueryFromContext(ctx context.Context) *activeQuery {
+	q, _ := ctx.Value(activeQueryKey{}).(*activeQuery)
+	return q
+}
@@ -0,0 +1,129 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/gate"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestActiveQueries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "active-queries")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	a, err := NewActiveQueries(log.NewNopLogger(), dir, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ActiveQuery{}, a.List())
+
+	ctx, done1 := a.Insert(context.Background(), "query", "up", "10.0.0.1:4242", "")
+	_, done2 := a.Insert(context.Background(), "series", "{job=\"a\"}", "10.0.0.2:4242", "team-a")
+
+	storeAPI := &queriedStoreServer{addr: "store-1:10901", storeServer: storeServer{resps: []*storepb.SeriesResponse{
+		storeSeriesResponse(t, labels.FromStrings("a", "1"), []sample{{0, 0}}),
+	}}}
+	q := newQuerier(ctx, nil, 0, 10, nil, nil, storeAPI, false, DedupFuncPenalty, 0, true, false, gate.New(2), time.Minute, spillOpts{})
+	for _, ms := range [][]*labels.Matcher{
+		{labels.MustNewMatcher(labels.MatchEqual, "a", "1")},
+		{labels.MustNewMatcher(labels.MatchEqual, "a", "1")},
+		{labels.MustNewMatcher(labels.MatchEqual, "a", "1"), labels.MustNewMatcher(labels.MatchRegexp, "b", "2|3")},
+	} {
+		set := q.Select(false, nil, ms...)
+		for set.Next() {
+		}
+		testutil.Ok(t, set.Err())
+	}
+	testutil.Ok(t, q.Close())
+
+	queries := a.List()
+	testutil.Equals(t, 2, len(queries))
+	testutil.Equals(t, "query", queries[0].Endpoint)
+	testutil.Equals(t, "up", queries[0].Query)
+	testutil.Equals(t, "10.0.0.1:4242", queries[0].Originator)
+	testutil.Equals(t, []string{`{a="1"}`, `{a="1", b=~"2|3"}`}, queries[0].Matchers)
+	testutil.Equals(t, []string{"store-1:10901"}, queries[0].Stores)
+	testutil.Equals(t, "series", queries[1].Endpoint)
+	testutil.Equals(t, "team-a", queries[1].Tenant)
+	testutil.Equals(t, []string{}, queries[1].Matchers)
+	testutil.Equals(t, []ActiveQuery{queries[1]}, a.ListTenant("team-a"))
+
+	// All the slots of the log are used, so the query is tracked but not logged.
+	_, done3 := a.Insert(context.Background(), "query", "down", "10.0.0.3:4242", "")
+	testutil.Equals(t, 3, len(a.List()))
+	done3()
+
+	done1()
+	testutil.Equals(t, 1, len(a.List()))
+
+	// The queries still active, as after a crash, are logged at the next start.
+	var buf bytes.Buffer
+	a, err = NewActiveQueries(log.NewLogfmtLogger(&buf), dir, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, strings.Count(buf.String(), "query did not finish in the last run"))
+	testutil.Assert(t, strings.Contains(buf.String(), "originator=10.0.0.2:4242 tenant=team-a"), "unexpected log %s", buf.String())
+	testutil.Equals(t, []ActiveQuery{}, a.List())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, activeQueriesFile))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1+2*activeQuerySlotSize, len(b))
+	unfinished, err := parseActiveQueriesLog(b)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(unfinished))
+
+	// Finishing a query of the previous instance doesn't affect the new one.
+	done2()
+	testutil.Equals(t, []ActiveQuery{}, a.List())
+}
+
+// queriedStoreServer reports itself as queried on each Series call, like the proxy does for its stores.
+type queriedStoreServer struct {
+	storeServer
+
+	addr string
+}
+
+func (s *queriedStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	if f, ok := srv.Context().Value(store.QueriedStoreKey).(func(string)); ok {
+		f(s.addr)
+	}
+	return s.storeServer.Series(r, srv)
+}
+
+func TestNewActiveQueryEntry(t *testing.T) {
+	start := time.Unix(1600000000, 0).UTC()
+	for _, query := range []string{
+		"up",
+		strings.Repeat("a", 2*activeQuerySlotSize),
+		// Escaped characters are longer in JSON.
+		strings.Repeat(`"<`, activeQuerySlotSize),
+		strings.Repeat("é", activeQuerySlotSize),
+	} {
+		entry, err := newActiveQueryEntry(ActiveQuery{ID: 1, Endpoint: "query", Query: query, Originator: "10.0.0.1:4242", Start: start})
+		testutil.Ok(t, err)
+		testutil.Assert(t, len(entry) < activeQuerySlotSize, "entry of %d bytes does not fit in a slot", len(entry))
+
+		queries, err := parseActiveQueriesLog(append(append([]byte("["), entry...), ','))
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(queries))
+		testutil.Assert(t, strings.HasPrefix(query, queries[0].Query), "expected a prefix of the query")
+		testutil.Equals(t, start, queries[0].Start)
+	}
+
+	_, err := newActiveQueryEntry(ActiveQuery{Tenant: strings.Repeat("a", activeQuerySlotSize)})
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// QueryPlan gathers the plans of the selects of a query, without fetching any data from the StoreAPIs.
+type QueryPlan struct {
+	mtx     sync.Mutex
+	selects []SelectPlan
+}
+
+// SelectPlan is the plan of a select of a query: the Series request sent to the proxy, and its fan-out to the
+// StoreAPIs. The hints and requested aggregates are pushed down to the StoreAPIs.
+type SelectPlan struct {
+	// Matchers are the matchers of the select, as given by the PromQL engine.
+	Matchers            string   `json:"matchers"`
+	MinTime             int64    `json:"minTime"`
+	MaxTime             int64    `json:"maxTime"`
+	MaxResolutionWindow int64    `json:"maxResolutionWindow"`
+	Aggregates          []string `json:"aggregates"`
+	Func                string   `json:"func,omitempty"`
+	StepMillis          int64    `json:"stepMillis"`
+	RangeMillis         int64    `json:"rangeMillis"`
+	Grouping            []string `json:"grouping,omitempty"`
+	By                  bool     `json:"by"`
+	SkipChunks          bool     `json:"skipChunks"`
+	PartialResponse     bool     `json:"partialResponse"`
+	Deduplicate         bool     `json:"deduplicate"`
+
+	// Proxy is the fan-out of the select to the StoreAPIs, if the proxy is able to plan it.
+	Proxy *store.SeriesPlan `json:"proxy,omitempty"`
+}
+
+// seriesPlanner is the proxy of the StoreAPIs, planning the Series requests without sending them.
+type seriesPlanner interface {
+	PlanSeries(ctx context.Context, r *storepb.SeriesRequest) (*store.SeriesPlan, error)
+}
+
+// NewQueryPlan returns an empty QueryPlan.
+func NewQueryPlan() *QueryPlan {
+	return &QueryPlan{}
+}
+
+// add adds the plan of the given Series request of a select.
+func (p *QueryPlan) add(ctx context.Context, proxy storepb.StoreServer, ms []*labels.Matcher, hints *storage.SelectHints, r *storepb.SeriesRequest, deduplicate bool) error {
+	s := SelectPlan{
+		Matchers:            storepb.PromMatchersToString(ms...),
+		MinTime:             r.MinTime,
+		MaxTime:             r.MaxTime,
+		MaxResolutionWindow: r.MaxResolutionWindow,
+		Aggregates:          []string{},
+		SkipChunks:          r.SkipChunks,
+		PartialResponse:     !r.PartialResponseDisabled,
+		Deduplicate:         deduplicate,
+	}
+	for _, a := range r.Aggregates {
+		s.Aggregates = append(s.Aggregates, a.String())
+	}
+	if hints != nil {
+		s.Func, s.StepMillis, s.RangeMillis, s.By = hints.Func, hints.Step, hints.Range, hints.By
+		if len(hints.Grouping) > 0 {
+			s.Grouping = hints.Grouping
+		}
+	}
+	if planner, ok := proxy.(seriesPlanner); ok {
+		plan, err := planner.PlanSeries(ctx, r)
+		if err != nil {
+			return errors.Wrap(err, "plan series")
+		}
+		s.Proxy = plan
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.selects = append(p.selects, s)
+	return nil
+}
+
+// Selects returns the plans of the selects of the query, sorted by matchers and time range.
+func (p *QueryPlan) Selects() []SelectPlan {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	res := append([]SelectPlan{}, p.selects...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Matchers != res[j].Matchers {
+			return res[i].Matchers < res[j].Matchers
+		}
+		if res[i].MinTime != res[j].MinTime {
+			return res[i].MinTime < res[j].MinTime
+		}
+		return res[i].MaxTime < res[j].MaxTime
+	})
+	return res
+}
+
+type queryPlanKey struct{}
+
+// WithQueryPlan returns a context planning the selects of the queriers created with it into p, instead of fetching
+// their data.
+func WithQueryPlan(ctx context.Context, p *QueryPlan) context.Context {
+	return context.WithValue(ctx, queryPlanKey{}, p)
+}
+
+func queryPlanFromContext(ctx context.Context) *QueryPlan {
+	p, _ := ctx.Value(queryPlanKey{}).(*QueryPlan)
+	return p
+}
@@ -348,10 +348,23 @@ func (it *chunkSeriesIterator) Err() error {
 	return it.chunks[it.i].Err()
 }
 
+// DedupFunc is the algorithm used to merge the samples of the replicas of a series.
+type DedupFunc string
+
+const (
+	// DedupFuncPenalty picks the samples of one replica at a time, and switches to another replica only if there is
+	// a gap in the samples of the current one. It is the default.
+	DedupFuncPenalty DedupFunc = "penalty"
+	// DedupFuncChain chains the samples of all replicas one-to-one in timestamp order, keeping one sample per
+	// timestamp. Counter values are adjusted when switching replicas so they never go down.
+	DedupFuncChain DedupFunc = "chain"
+)
+
 type dedupSeriesSet struct {
 	set           storage.SeriesSet
 	replicaLabels map[string]struct{}
 	isCounter     bool
+	dedupFunc     DedupFunc
 
 	replicas []storage.Series
 	lset     labels.Labels
@@ -359,8 +372,8 @@ type dedupSeriesSet struct {
 	ok       bool
 }
 
-func newDedupSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}, isCounter bool) storage.SeriesSet {
-	s := &dedupSeriesSet{set: set, replicaLabels: replicaLabels, isCounter: isCounter}
+func newDedupSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}, isCounter bool, dedupFunc DedupFunc) storage.SeriesSet {
+	s := &dedupSeriesSet{set: set, replicaLabels: replicaLabels, isCounter: isCounter, dedupFunc: dedupFunc}
 	s.ok = s.set.Next()
 	if s.ok {
 		s.peek = s.set.At()
@@ -427,6 +440,9 @@ func (s *dedupSeriesSet) At() storage.Series {
 	// Clients may store the series, so we must make a copy of the slice before advancing.
 	repl := make([]storage.Series, len(s.replicas))
 	copy(repl, s.replicas)
+	if s.dedupFunc == DedupFuncChain {
+		return newChainSeries(s.lset, repl, s.isCounter)
+	}
 	return newDedupSeries(s.lset, repl, s.isCounter)
 }
 
@@ -456,6 +472,12 @@ func newDedupSeries(lset labels.Labels, replicas []storage.Series, isCounter boo
 	return &dedupSeries{lset: lset, isCounter: isCounter, replicas: replicas}
 }
 
+// NewDedupSeries returns a series with the given labels, merging the samples of the given replicas with the same
+// penalty based deduplication used for querying. isCounter enables the adjustment of counter values across replicas.
+func NewDedupSeries(lset labels.Labels, replicas []storage.Series, isCounter bool) storage.Series {
+	return newDedupSeries(lset, replicas, isCounter)
+}
+
 func (s *dedupSeries) Labels() labels.Labels {
 	return s.lset
 }
@@ -480,6 +502,33 @@ func (s *dedupSeries) Iterator() chunkenc.Iterator {
 	return it
 }
 
+type chainSeries struct {
+	lset     labels.Labels
+	replicas []storage.Series
+
+	isCounter bool
+}
+
+func newChainSeries(lset labels.Labels, replicas []storage.Series, isCounter bool) *chainSeries {
+	return &chainSeries{lset: lset, isCounter: isCounter, replicas: replicas}
+}
+
+func (s *chainSeries) Labels() labels.Labels {
+	return s.lset
+}
+
+func (s *chainSeries) Iterator() chunkenc.Iterator {
+	its := make([]adjustableSeriesIterator, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		if s.isCounter {
+			its = append(its, &counterErrAdjustSeriesIterator{Iterator: r.Iterator()})
+		} else {
+			its = append(its, noopAdjustableSeriesIterator{Iterator: r.Iterator()})
+		}
+	}
+	return newChainSeriesIterator(its)
+}
+
 // adjustableSeriesIterator iterates over the data of a time series and allows to adjust current value based on
 // given lastValue iterated.
 type adjustableSeriesIterator interface {
@@ -672,6 +721,87 @@ func (it *dedupSeriesIterator) Err() error {
 	return it.b.Err()
 }
 
+// chainSeriesIterator merges the samples of all replicas one-to-one in timestamp order. If several replicas have
+// a sample at the same timestamp, only the one of the first replica is kept.
+// As opposed to the dedupSeriesIterator, it does not skip samples close to the previous one, so the samples of
+// replicas scraped with an offset are interleaved. The value of the replica switched to is adjusted with the last
+// value, so that counters do not go down when the replicas did not see the same resets.
+type chainSeriesIterator struct {
+	replicas []adjustableSeriesIterator
+	oks      []bool
+
+	// curr is the index of the replica of the current sample, or -1 before the first sample or after the last one.
+	curr  int
+	lastT int64
+	lastV float64
+}
+
+func newChainSeriesIterator(replicas []adjustableSeriesIterator) *chainSeriesIterator {
+	it := &chainSeriesIterator{
+		replicas: replicas,
+		oks:      make([]bool, len(replicas)),
+		curr:     -1,
+		lastT:    math.MinInt64,
+	}
+	for i, r := range replicas {
+		it.oks[i] = r.Next()
+	}
+	return it
+}
+
+func (it *chainSeriesIterator) Next() bool {
+	next := -1
+	var nextT int64
+	for i, r := range it.replicas {
+		if !it.oks[i] {
+			continue
+		}
+		// Skip the samples of the replicas at or before the current one.
+		if t, _ := r.At(); t <= it.lastT {
+			if it.oks[i] = r.Seek(it.lastT + 1); !it.oks[i] {
+				continue
+			}
+		}
+		if t, _ := r.At(); next < 0 || t < nextT {
+			next, nextT = i, t
+		}
+	}
+	if next < 0 {
+		it.curr = -1
+		return false
+	}
+	if it.curr >= 0 && it.curr != next {
+		// We switched replicas.
+		it.replicas[next].adjustAtValue(it.lastV)
+	}
+	it.curr = next
+	it.lastT, it.lastV = it.replicas[next].At()
+	return true
+}
+
+func (it *chainSeriesIterator) Seek(t int64) bool {
+	// Don't use underlying Seek, but iterate over next to adjust the values of all replicas.
+	for it.curr < 0 || it.lastT < t {
+		if !it.Next() {
+			return false
+		}
+	}
+	return true
+}
+
+func (it *chainSeriesIterator) At() (int64, float64) {
+	return it.replicas[it.curr].At()
+}
+
+func (it *chainSeriesIterator) Err() error {
+	for _, r := range it.replicas {
+		if err := r.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type lazySeriesSet struct {
 	create func() (s storage.SeriesSet, ok bool)
 
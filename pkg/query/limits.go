@@ -0,0 +1,269 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// Limits are the limits enforced on each query. Zero values mean no limit.
+type Limits struct {
+	// MaxConcurrent is the maximum number of queries of a tenant processed concurrently.
+	MaxConcurrent int
+	// MaxSeries is the maximum number of series selected by a query, counted after deduplication.
+	MaxSeries int
+	// MaxFetchedChunks is the maximum number of chunks fetched from the StoreAPIs by a query.
+	MaxFetchedChunks int
+	// MaxFetchedSamples is the maximum number of samples fetched from the StoreAPIs by a query.
+	MaxFetchedSamples int
+	// MaxLabelValues is the maximum number of label names or values returned by a label names or values request.
+	MaxLabelValues int
+	// QueryTimeout is the maximum time to process a query. It can only be lower than the timeout of the query engine.
+	QueryTimeout time.Duration
+	// StoreResponseTimeout is the time after which a StoreAPI not sending any data is ignored.
+	StoreResponseTimeout time.Duration
+}
+
+// limitsOverride is the limits of a tenant in the limits configuration, overriding the default ones if set.
+type limitsOverride struct {
+	MaxConcurrent        *int            `yaml:"max_concurrent"`
+	MaxSeries            *int            `yaml:"max_series"`
+	MaxFetchedChunks     *int            `yaml:"max_fetched_chunks"`
+	MaxFetchedSamples    *int            `yaml:"max_fetched_samples"`
+	MaxLabelValues       *int            `yaml:"max_label_values"`
+	QueryTimeout         *model.Duration `yaml:"query_timeout"`
+	StoreResponseTimeout *model.Duration `yaml:"store_response_timeout"`
+}
+
+type limitsConfig struct {
+	Tenants map[string]limitsOverride `yaml:"tenants"`
+}
+
+// TenantLimits are the limits of the queries of each tenant. A nil TenantLimits is valid and enforces no limits.
+type TenantLimits struct {
+	defaults Limits
+	tenants  map[string]Limits
+
+	mtx sync.Mutex
+	// running is the number of queries of each tenant in flight.
+	running map[string]int
+}
+
+// NewTenantLimits creates TenantLimits from the default limits and the YAML limits configuration overriding them for
+// some tenants, if any.
+func NewTenantLimits(defaults Limits, content []byte) (*TenantLimits, error) {
+	var conf limitsConfig
+	if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+		return nil, errors.Wrap(err, "parsing limits configuration")
+	}
+
+	l := &TenantLimits{defaults: defaults, tenants: map[string]Limits{}, running: map[string]int{}}
+	for tenant, o := range conf.Tenants {
+		limits := defaults
+		if o.MaxConcurrent != nil {
+			limits.MaxConcurrent = *o.MaxConcurrent
+		}
+		if o.MaxSeries != nil {
+			limits.MaxSeries = *o.MaxSeries
+		}
+		if o.MaxFetchedChunks != nil {
+			limits.MaxFetchedChunks = *o.MaxFetchedChunks
+		}
+		if o.MaxFetchedSamples != nil {
+			limits.MaxFetchedSamples = *o.MaxFetchedSamples
+		}
+		if o.MaxLabelValues != nil {
+			limits.MaxLabelValues = *o.MaxLabelValues
+		}
+		if o.QueryTimeout != nil {
+			limits.QueryTimeout = time.Duration(*o.QueryTimeout)
+		}
+		if o.StoreResponseTimeout != nil {
+			limits.StoreResponseTimeout = time.Duration(*o.StoreResponseTimeout)
+		}
+		if limits.MaxConcurrent < 0 || limits.MaxSeries < 0 || limits.MaxFetchedChunks < 0 || limits.MaxFetchedSamples < 0 || limits.MaxLabelValues < 0 {
+			return nil, errors.Errorf("negative limit for tenant %s", tenant)
+		}
+		l.tenants[tenant] = limits
+	}
+	return l, nil
+}
+
+// ForTenant returns the limits of the queries of the given tenant. It returns no limits if l is nil.
+func (l *TenantLimits) ForTenant(tenant string) Limits {
+	if l == nil {
+		return Limits{}
+	}
+	if limits, ok := l.tenants[tenant]; ok {
+		return limits
+	}
+	return l.defaults
+}
+
+// StartQuery accounts a query of the given tenant as in flight until the returned function is called. It fails with
+// a LimitError if the tenant already has its maximum number of concurrent queries in flight. Nothing is accounted by
+// nil TenantLimits.
+func (l *TenantLimits) StartQuery(tenant string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	maxConcurrent := l.ForTenant(tenant).MaxConcurrent
+	if maxConcurrent <= 0 {
+		return func() {}, nil
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.running[tenant] >= maxConcurrent {
+		return nil, LimitError{err: fmt.Errorf("exceeded the limit of %d concurrent queries", maxConcurrent)}
+	}
+	l.running[tenant]++
+	return func() {
+		l.mtx.Lock()
+		defer l.mtx.Unlock()
+		if l.running[tenant]--; l.running[tenant] == 0 {
+			delete(l.running, tenant)
+		}
+	}, nil
+}
+
+type limitsKey struct{}
+
+// WithLimits returns a context enforcing the given limits on the queriers created with it.
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, limits)
+}
+
+func limitsFromContext(ctx context.Context) Limits {
+	limits, _ := ctx.Value(limitsKey{}).(Limits)
+	return limits
+}
+
+// LimitError is the error of a query exceeding one of its limits.
+type LimitError struct {
+	err error
+}
+
+func (e LimitError) Error() string {
+	return e.err.Error()
+}
+
+// IsLimitError returns true if the base error is a LimitError.
+func IsLimitError(err error) bool {
+	_, ok := errors.Cause(err).(LimitError)
+	return ok
+}
+
+// limiter counts the data fetched and the series selected by the selects of a querier, failing once it exceeds the
+// limits.
+type limiter struct {
+	limits Limits
+
+	series, chunks, samples int64
+}
+
+// addSeries counts a series selected by the query, after deduplication.
+func (l *limiter) addSeries() error {
+	if l.limits.MaxSeries > 0 {
+		if n := atomic.AddInt64(&l.series, 1); n > int64(l.limits.MaxSeries) {
+			return LimitError{err: fmt.Errorf("exceeded the limit of %d series selected by the query", l.limits.MaxSeries)}
+		}
+	}
+	return nil
+}
+
+// checkLabelValues checks the number of label names or values returned by a request.
+func (l *limiter) checkLabelValues(n int) error {
+	if l.limits.MaxLabelValues > 0 && n > l.limits.MaxLabelValues {
+		return LimitError{err: fmt.Errorf("exceeded the limit of %d label names or values returned by the query", l.limits.MaxLabelValues)}
+	}
+	return nil
+}
+
+// add counts the data of a series fetched from the StoreAPIs.
+func (l *limiter) add(s *storepb.Series) error {
+	if l.limits.MaxFetchedChunks > 0 {
+		if n := atomic.AddInt64(&l.chunks, int64(len(s.Chunks))); n > int64(l.limits.MaxFetchedChunks) {
+			return LimitError{err: fmt.Errorf("exceeded the limit of %d chunks fetched by the query", l.limits.MaxFetchedChunks)}
+		}
+	}
+	if l.limits.MaxFetchedSamples > 0 {
+		samples, err := seriesSamples(s)
+		if err != nil {
+			return err
+		}
+		if n := atomic.AddInt64(&l.samples, int64(samples)); n > int64(l.limits.MaxFetchedSamples) {
+			return LimitError{err: fmt.Errorf("exceeded the limit of %d samples fetched by the query", l.limits.MaxFetchedSamples)}
+		}
+	}
+	return nil
+}
+
+// seriesSamples returns the number of samples of the chunks of the series.
+func seriesSamples(s *storepb.Series) (int, error) {
+	var samples int
+	for _, c := range s.Chunks {
+		n, err := aggrChunkSamples(c)
+		if err != nil {
+			return 0, err
+		}
+		samples += n
+	}
+	return samples, nil
+}
+
+// aggrChunkSamples returns the number of samples of the chunk, counting the samples of one of its aggregates only.
+func aggrChunkSamples(c storepb.AggrChunk) (int, error) {
+	for _, chk := range []*storepb.Chunk{c.Raw, c.Count, c.Sum, c.Min, c.Max, c.Counter} {
+		if chk == nil {
+			continue
+		}
+		if chk.Type != storepb.Chunk_XOR {
+			return 0, errors.Errorf("unsupported chunk encoding %d", chk.Type)
+		}
+		xc, err := chunkenc.FromData(chunkenc.EncXOR, chk.Data)
+		if err != nil {
+			return 0, errors.Wrap(err, "decode chunk")
+		}
+		return xc.NumSamples(), nil
+	}
+	return 0, nil
+}
+
+// limitedSeriesSet counts the series of the set against the limit of series selected by the query.
+type limitedSeriesSet struct {
+	storage.SeriesSet
+	limiter *limiter
+	err     error
+}
+
+func (s *limitedSeriesSet) Next() bool {
+	if s.err != nil || !s.SeriesSet.Next() {
+		return false
+	}
+	if err := s.limiter.addSeries(); err != nil {
+		s.err = err
+		return false
+	}
+	return true
+}
+
+func (s *limitedSeriesSet) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.SeriesSet.Err()
+}
@@ -0,0 +1,171 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/gate"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestNewTenantLimits(t *testing.T) {
+	defaults := Limits{MaxSeries: 10, StoreResponseTimeout: time.Minute}
+
+	var nilLimits *TenantLimits
+	testutil.Equals(t, Limits{}, nilLimits.ForTenant("team-a"))
+
+	l, err := NewTenantLimits(defaults, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, defaults, l.ForTenant("team-a"))
+
+	l, err = NewTenantLimits(defaults, []byte(`
+tenants:
+  team-a:
+    max_series: 0
+    max_fetched_samples: 1000
+    query_timeout: 30s
+  team-b:
+    store_response_timeout: 10s
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, Limits{MaxFetchedSamples: 1000, QueryTimeout: 30 * time.Second, StoreResponseTimeout: time.Minute}, l.ForTenant("team-a"))
+	testutil.Equals(t, Limits{MaxSeries: 10, StoreResponseTimeout: 10 * time.Second}, l.ForTenant("team-b"))
+	testutil.Equals(t, defaults, l.ForTenant("team-c"))
+
+	_, err = NewTenantLimits(defaults, []byte(`
+tenants:
+  team-a:
+    max_chunks: 10
+`))
+	testutil.NotOk(t, err)
+	_, err = NewTenantLimits(defaults, []byte(`
+tenants:
+  team-a:
+    max_fetched_chunks: -1
+`))
+	testutil.NotOk(t, err)
+}
+
+func TestLimiter(t *testing.T) {
+	// Each series has 2 chunks of 3 and 2 samples.
+	s := storeSeriesResponse(t, labels.FromStrings("a", "1"), []sample{{0, 0}, {1, 1}, {2, 2}}, []sample{{3, 3}, {4, 4}}).GetSeries()
+
+	for _, tcase := range []struct {
+		limits Limits
+		// allowed is the number of series fetched before exceeding the limits.
+		allowed int
+	}{
+		{limits: Limits{}, allowed: 100},
+		{limits: Limits{MaxSeries: 3}, allowed: 3},
+		{limits: Limits{MaxFetchedChunks: 5}, allowed: 2},
+		{limits: Limits{MaxFetchedSamples: 10}, allowed: 2},
+		{limits: Limits{MaxSeries: 3, MaxFetchedSamples: 4}, allowed: 0},
+	} {
+		l := &limiter{limits: tcase.limits}
+		var err error
+		fetched := 0
+		for ; fetched < 100; fetched++ {
+			if err = l.add(s); err != nil {
+				break
+			}
+			if err = l.addSeries(); err != nil {
+				break
+			}
+		}
+		testutil.Equals(t, tcase.allowed, fetched)
+		if tcase.allowed < 100 {
+			testutil.Assert(t, IsLimitError(err), "expected limit error, got %v", err)
+		}
+	}
+
+	testutil.Assert(t, !IsLimitError(errors.New("other")), "not a limit error")
+
+	l := &limiter{limits: Limits{MaxLabelValues: 2}}
+	testutil.Ok(t, l.checkLabelValues(2))
+	testutil.Assert(t, IsLimitError(l.checkLabelValues(3)), "expected limit error")
+}
+
+func TestTenantLimits_StartQuery(t *testing.T) {
+	var nilLimits *TenantLimits
+	finished, err := nilLimits.StartQuery("team-a")
+	testutil.Ok(t, err)
+	finished()
+
+	l, err := NewTenantLimits(Limits{MaxConcurrent: 2}, []byte(`
+tenants:
+  team-b:
+    max_concurrent: 0
+`))
+	testutil.Ok(t, err)
+
+	first, err := l.StartQuery("team-a")
+	testutil.Ok(t, err)
+	second, err := l.StartQuery("team-a")
+	testutil.Ok(t, err)
+	_, err = l.StartQuery("team-a")
+	testutil.Assert(t, IsLimitError(err), "expected limit error, got %v", err)
+	// The limit is per tenant.
+	other, err := l.StartQuery("team-c")
+	testutil.Ok(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := l.StartQuery("team-b")
+		testutil.Ok(t, err)
+	}
+
+	first()
+	third, err := l.StartQuery("team-a")
+	testutil.Ok(t, err)
+	second()
+	third()
+	other()
+	testutil.Equals(t, 0, len(l.running))
+}
+
+func TestQuerier_Select_Limits(t *testing.T) {
+	storeAPI := &storeServer{resps: []*storepb.SeriesResponse{
+		storeSeriesResponse(t, labels.FromStrings("a", "1"), []sample{{0, 0}, {1, 1}}),
+		storeSeriesResponse(t, labels.FromStrings("a", "2"), []sample{{0, 0}, {1, 1}}),
+	}}
+
+	// Replicas of the same series.
+	replicasAPI := &storeServer{resps: []*storepb.SeriesResponse{
+		storeSeriesResponse(t, labels.FromStrings("a", "1", "replica", "1"), []sample{{0, 0}, {1, 1}}),
+		storeSeriesResponse(t, labels.FromStrings("a", "1", "replica", "2"), []sample{{0, 0}, {1, 1}}),
+	}}
+
+	for _, tcase := range []struct {
+		store    storepb.StoreServer
+		dedup    bool
+		limits   Limits
+		limitErr bool
+	}{
+		{store: storeAPI, limits: Limits{MaxSeries: 2}},
+		{store: storeAPI, limits: Limits{MaxSeries: 1}, limitErr: true},
+		{store: storeAPI, limits: Limits{MaxFetchedSamples: 3}, limitErr: true},
+		// Series are counted after deduplication.
+		{store: replicasAPI, dedup: true, limits: Limits{MaxSeries: 1}},
+		{store: replicasAPI, limits: Limits{MaxSeries: 1}, limitErr: true},
+	} {
+		ctx := WithLimits(context.Background(), tcase.limits)
+		q := newQuerier(ctx, nil, 0, 10, []string{"replica"}, nil, tcase.store, tcase.dedup, DedupFuncPenalty, 0, true, false, gate.New(2), time.Minute, spillOpts{})
+
+		set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "a", "1"))
+		for set.Next() {
+		}
+		if tcase.limitErr {
+			testutil.NotOk(t, set.Err())
+			testutil.Assert(t, IsLimitError(set.Err()), "expected limit error, got %v", set.Err())
+		} else {
+			testutil.Ok(t, set.Err())
+		}
+		testutil.Ok(t, q.Close())
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+const (
+	PartialResponsePolicyStrict     = "strict"
+	PartialResponsePolicyBestEffort = "best-effort"
+)
+
+// PartialResponsePolicies are the partial response policies of the StoreAPIs, by address or by type.
+type PartialResponsePolicies struct {
+	byAddr map[string]store.PartialResponsePolicy
+	byType map[string]store.PartialResponsePolicy
+}
+
+// NewPartialResponsePolicies parses the given policies in the <address|type>=<strict|best-effort> format, where type
+// is the type of the StoreAPIs, e.g. sidecar.
+func NewPartialResponsePolicies(specs []string) (*PartialResponsePolicies, error) {
+	types := map[string]struct{}{}
+	for t := range storepb.StoreType_name {
+		if c := component.FromProto(storepb.StoreType(t)); c != nil {
+			types[c.String()] = struct{}{}
+		}
+	}
+
+	p := &PartialResponsePolicies{byAddr: map[string]store.PartialResponsePolicy{}, byType: map[string]store.PartialResponsePolicy{}}
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("invalid partial response policy %q, expected <address|type>=<%s|%s>", spec, PartialResponsePolicyStrict, PartialResponsePolicyBestEffort)
+		}
+		target, value := spec[:i], spec[i+1:]
+
+		var policy store.PartialResponsePolicy
+		switch value {
+		case PartialResponsePolicyStrict:
+			policy = store.PartialResponseStrict
+		case PartialResponsePolicyBestEffort:
+			policy = store.PartialResponseBestEffort
+		default:
+			return nil, errors.Errorf("invalid partial response policy %q of %s, expected %s or %s", value, target, PartialResponsePolicyStrict, PartialResponsePolicyBestEffort)
+		}
+
+		if _, ok := types[target]; ok {
+			p.byType[target] = policy
+			continue
+		}
+		p.byAddr[target] = policy
+	}
+	return p, nil
+}
+
+// Policy returns the partial response policy of the given StoreAPI. The policy of its address takes precedence over
+// the one of its type.
+func (p *PartialResponsePolicies) Policy(st store.Client) store.PartialResponsePolicy {
+	if policy, ok := p.byAddr[st.Addr()]; ok {
+		return policy
+	}
+	if ref, ok := st.(*storeRef); ok && ref.StoreType() != nil {
+		if policy, ok := p.byType[ref.StoreType().String()]; ok {
+			return policy
+		}
+	}
+	return store.PartialResponseDefault
+}
@@ -0,0 +1,36 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPartialResponsePolicies(t *testing.T) {
+	for _, spec := range []string{"sidecar", "=strict", "sidecar=true", "store=best_effort"} {
+		_, err := NewPartialResponsePolicies([]string{spec})
+		testutil.NotOk(t, err)
+	}
+
+	p, err := NewPartialResponsePolicies([]string{"sidecar=strict", "store=best-effort", "10.0.0.1:10901=best-effort"})
+	testutil.Ok(t, err)
+
+	for _, tc := range []struct {
+		ref      *storeRef
+		expected store.PartialResponsePolicy
+	}{
+		{ref: &storeRef{addr: "10.0.0.2:10901", storeType: component.Sidecar}, expected: store.PartialResponseStrict},
+		{ref: &storeRef{addr: "10.0.0.3:10901", storeType: component.Store}, expected: store.PartialResponseBestEffort},
+		{ref: &storeRef{addr: "10.0.0.4:10901", storeType: component.Receive}, expected: store.PartialResponseDefault},
+		{ref: &storeRef{addr: "10.0.0.5:10901"}, expected: store.PartialResponseDefault},
+		// The policy of the address takes precedence over the one of the type.
+		{ref: &storeRef{addr: "10.0.0.1:10901", storeType: component.Sidecar}, expected: store.PartialResponseBestEffort},
+	} {
+		testutil.Equals(t, tc.expected, p.Policy(tc.ref))
+	}
+}
@@ -7,9 +7,12 @@ import (
 	"context"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/types"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,9 +21,11 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage"
 
+	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/tracing"
@@ -32,13 +37,34 @@ import (
 // replicaLabels at query time.
 // maxResolutionMillis controls downsampling resolution that is allowed (specified in milliseconds).
 // partialResponse controls `partialResponseDisabled` option of StoreAPI and partial response behavior of proxy.
+// The replicas are merged with the dedupFunc given to NewQueryableCreator.
+// The series of a select exceeding the maxSelectMemoryBytes given to NewQueryableCreator, if greater than 0, are
+// spilled to temporary files in spillDir and merged from disk.
 type QueryableCreator func(deduplicate bool, replicaLabels []string, storeDebugMatchers [][]*labels.Matcher, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable
 
+// LabelMatchersQuerier is a querier which can restrict the label names and values to the ones of the series
+// matching some matchers, as storage.LabelQuerier does not support matchers.
+type LabelMatchersQuerier interface {
+	// LabelValuesWithMatchers returns all potential values for a label name in the series matching the given matchers.
+	LabelValuesWithMatchers(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error)
+	// LabelNamesWithMatchers returns all the unique label names present in the series matching the given matchers
+	// in sorted order.
+	LabelNamesWithMatchers(matchers ...*labels.Matcher) ([]string, storage.Warnings, error)
+}
+
 // NewQueryableCreator creates QueryableCreator.
-func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy storepb.StoreServer, maxConcurrentSelects int, selectTimeout time.Duration) QueryableCreator {
+func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy storepb.StoreServer, maxConcurrentSelects int, selectTimeout time.Duration, dedupFunc DedupFunc, maxSelectMemoryBytes int64, spillDir string) QueryableCreator {
 	duration := promauto.With(
 		extprom.WrapRegistererWithPrefix("concurrent_selects_", reg),
 	).NewHistogram(gate.DurationHistogramOpts)
+	spill := spillOpts{
+		maxBytes: maxSelectMemoryBytes,
+		dir:      spillDir,
+		spilledBytes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "select_spilled_bytes_total",
+			Help: "Total number of bytes of series spilled to disk by selects exceeding the memory limit.",
+		}),
+	}
 
 	return func(deduplicate bool, replicaLabels []string, storeDebugMatchers [][]*labels.Matcher, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable {
 		return &queryable{
@@ -47,6 +73,7 @@ func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy sto
 			storeDebugMatchers:  storeDebugMatchers,
 			proxy:               proxy,
 			deduplicate:         deduplicate,
+			dedupFunc:           dedupFunc,
 			maxResolutionMillis: maxResolutionMillis,
 			partialResponse:     partialResponse,
 			skipChunks:          skipChunks,
@@ -55,6 +82,7 @@ func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy sto
 			},
 			maxConcurrentSelects: maxConcurrentSelects,
 			selectTimeout:        selectTimeout,
+			spill:                spill,
 		}
 	}
 }
@@ -65,17 +93,19 @@ type queryable struct {
 	storeDebugMatchers   [][]*labels.Matcher
 	proxy                storepb.StoreServer
 	deduplicate          bool
+	dedupFunc            DedupFunc
 	maxResolutionMillis  int64
 	partialResponse      bool
 	skipChunks           bool
 	gateProviderFn       func() gate.Gate
 	maxConcurrentSelects int
 	selectTimeout        time.Duration
+	spill                spillOpts
 }
 
 // Querier returns a new storage querier against the underlying proxy store API.
 func (q *queryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.maxResolutionMillis, q.partialResponse, q.skipChunks, q.gateProviderFn(), q.selectTimeout), nil
+	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.dedupFunc, q.maxResolutionMillis, q.partialResponse, q.skipChunks, q.gateProviderFn(), q.selectTimeout, q.spill), nil
 }
 
 type querier struct {
@@ -87,11 +117,24 @@ type querier struct {
 	storeDebugMatchers  [][]*labels.Matcher
 	proxy               storepb.StoreServer
 	deduplicate         bool
+	dedupFunc           DedupFunc
 	maxResolutionMillis int64
 	partialResponse     bool
 	skipChunks          bool
 	selectGate          gate.Gate
 	selectTimeout       time.Duration
+	limiter             *limiter
+	stats               *QueryStats
+	usage               *QueryUsage
+	active              *activeQuery
+	shard               *storepb.ShardInfo
+	plan                *QueryPlan
+	spill               spillOpts
+
+	// spilledSets are the sets of spilled series of the selects, removed from disk on Close.
+	spilledMtx    sync.Mutex
+	spilledSets   []*spilledSeriesSet
+	spilledClosed bool
 }
 
 // newQuerier creates implementation of storage.Querier that fetches data from the proxy
@@ -104,10 +147,12 @@ func newQuerier(
 	storeDebugMatchers [][]*labels.Matcher,
 	proxy storepb.StoreServer,
 	deduplicate bool,
+	dedupFunc DedupFunc,
 	maxResolutionMillis int64,
 	partialResponse, skipChunks bool,
 	selectGate gate.Gate,
 	selectTimeout time.Duration,
+	spill spillOpts,
 ) *querier {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -131,9 +176,17 @@ func newQuerier(
 		storeDebugMatchers:  storeDebugMatchers,
 		proxy:               proxy,
 		deduplicate:         deduplicate,
+		dedupFunc:           dedupFunc,
 		maxResolutionMillis: maxResolutionMillis,
 		partialResponse:     partialResponse,
 		skipChunks:          skipChunks,
+		limiter:             &limiter{limits: limitsFromContext(ctx)},
+		stats:               queryStatsFromContext(ctx),
+		usage:               queryUsageFromContext(ctx),
+		active:              activeQueryFromContext(ctx),
+		shard:               shardInfoFromContext(ctx).storeShardInfo(rl),
+		plan:                queryPlanFromContext(ctx),
+		spill:               spill,
 	}
 }
 
@@ -144,10 +197,19 @@ func (q *querier) isDedupEnabled() bool {
 type seriesServer struct {
 	// This field just exist to pseudo-implement the unused methods of the interface.
 	storepb.Store_SeriesServer
-	ctx context.Context
+	ctx     context.Context
+	limiter *limiter
+	stats   *QueryStats
+	usage   *QueryUsage
+	// mint and maxt are the time range of the select, for the stats.
+	mint, maxt int64
 
 	seriesSet []storepb.Series
-	warnings  []string
+	// spiller buffers the series instead of seriesSet if set, spilling them to disk above its memory limit.
+	spiller  *seriesSpiller
+	warnings []string
+	// limitErr is the error of the limiter, if the fetched series exceeded the limits.
+	limitErr error
 }
 
 func (s *seriesServer) Send(r *storepb.SeriesResponse) error {
@@ -157,10 +219,31 @@ func (s *seriesServer) Send(r *storepb.SeriesResponse) error {
 	}
 
 	if r.GetSeries() != nil {
+		if err := s.limiter.add(r.GetSeries()); err != nil {
+			s.limitErr = err
+			return err
+		}
+		if s.usage != nil {
+			if err := s.usage.add(r.GetSeries()); err != nil {
+				return err
+			}
+		}
+		if s.spiller != nil {
+			return s.spiller.add(*r.GetSeries())
+		}
 		s.seriesSet = append(s.seriesSet, *r.GetSeries())
 		return nil
 	}
 
+	if r.GetHints() != nil && s.stats != nil {
+		hints := &hintspb.SeriesResponseHints{}
+		if err := types.UnmarshalAny(r.GetHints(), hints); err != nil {
+			return errors.Wrap(err, "unmarshal series response hints")
+		}
+		s.stats.add(s.mint, s.maxt, hints.StoresQueryStats)
+		return nil
+	}
+
 	// Unsupported field, skip.
 	return nil
 }
@@ -169,29 +252,6 @@ func (s *seriesServer) Context() context.Context {
 	return s.ctx
 }
 
-// aggrsFromFunc infers aggregates of the underlying data based on the wrapping
-// function of a series selection.
-func aggrsFromFunc(f string) []storepb.Aggr {
-	if f == "min" || strings.HasPrefix(f, "min_") {
-		return []storepb.Aggr{storepb.Aggr_MIN}
-	}
-	if f == "max" || strings.HasPrefix(f, "max_") {
-		return []storepb.Aggr{storepb.Aggr_MAX}
-	}
-	if f == "count" || strings.HasPrefix(f, "count_") {
-		return []storepb.Aggr{storepb.Aggr_COUNT}
-	}
-	// f == "sum" falls through here since we want the actual samples.
-	if strings.HasPrefix(f, "sum_") {
-		return []storepb.Aggr{storepb.Aggr_SUM}
-	}
-	if f == "increase" || f == "rate" || f == "irate" || f == "resets" {
-		return []storepb.Aggr{storepb.Aggr_COUNTER}
-	}
-	// In the default case, we retrieve count and sum to compute an average.
-	return []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM}
-}
-
 func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Matcher) storage.SeriesSet {
 	if hints == nil {
 		hints = &storage.SelectHints{
@@ -260,13 +320,26 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 		return nil, errors.Wrap(err, "convert matchers")
 	}
 
-	aggrs := aggrsFromFunc(hints.Func)
+	aggrs := storepb.AggrsFromFunc(hints.Func)
 
 	// TODO(bwplotka): Pass it using the SeriesRequest instead of relying on context.
 	ctx = context.WithValue(ctx, store.StoreMatcherKey, q.storeDebugMatchers)
+	if q.limiter.limits.StoreResponseTimeout > 0 {
+		ctx = context.WithValue(ctx, store.ResponseTimeoutKey, q.limiter.limits.StoreResponseTimeout)
+	}
+	if q.active != nil {
+		q.active.addMatchers(ms)
+		ctx = context.WithValue(ctx, store.QueriedStoreKey, q.active.addStore)
+	}
+
+	var reqHints *types.Any
+	if q.stats != nil {
+		if reqHints, err = types.MarshalAny(&hintspb.SeriesRequestHints{EnableQueryStats: true}); err != nil {
+			return nil, errors.Wrap(err, "marshal series request hints")
+		}
+	}
 
-	resp := &seriesServer{ctx: ctx}
-	if err := q.proxy.Series(&storepb.SeriesRequest{
+	req := &storepb.SeriesRequest{
 		MinTime:                 hints.Start,
 		MaxTime:                 hints.End,
 		Matchers:                sms,
@@ -274,7 +347,32 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 		Aggregates:              aggrs,
 		PartialResponseDisabled: !q.partialResponse,
 		SkipChunks:              q.skipChunks,
-	}, resp); err != nil {
+		Hints:                   reqHints,
+		ShardInfo:               q.shard,
+	}
+	if q.plan != nil {
+		// The query is only planned, no data is fetched.
+		return storage.EmptySeriesSet(), q.plan.add(ctx, q.proxy, ms, hints, req, q.isDedupEnabled())
+	}
+
+	resp := &seriesServer{ctx: ctx, limiter: q.limiter, stats: q.stats, usage: q.usage, mint: hints.Start, maxt: hints.End}
+	if q.spill.maxBytes > 0 {
+		var replicaLabels map[string]struct{}
+		if q.isDedupEnabled() {
+			replicaLabels = q.replicaLabels
+		}
+		resp.spiller = newSeriesSpiller(q.spill, replicaLabels)
+	}
+	if err := q.proxy.Series(req, resp); err != nil {
+		if resp.spiller != nil {
+			if cerr := resp.spiller.close(); cerr != nil {
+				level.Warn(q.logger).Log("msg", "failed to remove spilled series", "err", cerr)
+			}
+		}
+		if resp.limitErr != nil {
+			// The limit error is sent back by the proxy as a gRPC status, losing its type.
+			return nil, errors.Wrap(resp.limitErr, "proxy Series()")
+		}
 		return nil, errors.Wrap(err, "proxy Series()")
 	}
 
@@ -283,30 +381,64 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 		warns = append(warns, errors.New(w))
 	}
 
-	if !q.isDedupEnabled() {
-		// Return data without any deduplication.
-		return &promSeriesSet{
-			mint:  q.mint,
-			maxt:  q.maxt,
-			set:   newStoreSeriesSet(resp.seriesSet),
-			aggrs: aggrs,
-			warns: warns,
-		}, nil
+	var storeSet storepb.SeriesSet
+	if resp.spiller != nil {
+		// The spilled series are sorted for deduplication by the spiller.
+		spilled := resp.spiller.seriesSet()
+		q.spilledMtx.Lock()
+		closed := q.spilledClosed
+		if !closed {
+			q.spilledSets = append(q.spilledSets, spilled)
+		}
+		q.spilledMtx.Unlock()
+		if closed {
+			// The querier was closed while fetching the series, so they are not iterated anymore.
+			if err := spilled.Close(); err != nil {
+				level.Warn(q.logger).Log("msg", "failed to remove spilled series", "err", err)
+			}
+			return nil, errors.New("querier closed before the series were fetched")
+		}
+		storeSet = spilled
+	} else {
+		if q.isDedupEnabled() {
+			// TODO(fabxc): this could potentially pushed further down into the store API to make true streaming possible.
+			sortDedupLabels(resp.seriesSet, q.replicaLabels)
+		}
+		storeSet = newStoreSeriesSet(resp.seriesSet)
 	}
-
-	// TODO(fabxc): this could potentially pushed further down into the store API to make true streaming possible.
-	sortDedupLabels(resp.seriesSet, q.replicaLabels)
 	set := &promSeriesSet{
 		mint:  q.mint,
 		maxt:  q.maxt,
-		set:   newStoreSeriesSet(resp.seriesSet),
+		set:   storeSet,
 		aggrs: aggrs,
 		warns: warns,
 	}
 
+	if !q.isDedupEnabled() {
+		// Return data without any deduplication.
+		return q.limitSeriesSet(q.shardSeriesSet(set)), nil
+	}
+
 	// The merged series set assembles all potentially-overlapping time ranges of the same series into a single one.
 	// TODO(bwplotka): We could potentially dedup on chunk level, use chunk iterator for that when available.
-	return newDedupSeriesSet(set, q.replicaLabels, len(aggrs) == 1 && aggrs[0] == storepb.Aggr_COUNTER), nil
+	return q.limitSeriesSet(q.shardSeriesSet(newDedupSeriesSet(set, q.replicaLabels, len(aggrs) == 1 && aggrs[0] == storepb.Aggr_COUNTER, q.dedupFunc))), nil
+}
+
+// limitSeriesSet returns the set failing once the series selected by the query exceed the limit, if any. The series
+// are counted after deduplication, so that the replicas of a series count once.
+func (q *querier) limitSeriesSet(set storage.SeriesSet) storage.SeriesSet {
+	if q.limiter.limits.MaxSeries <= 0 {
+		return set
+	}
+	return &limitedSeriesSet{SeriesSet: set, limiter: q.limiter}
+}
+
+// shardSeriesSet returns the series of the set belonging to the shard of the querier, if any.
+func (q *querier) shardSeriesSet(set storage.SeriesSet) storage.SeriesSet {
+	if q.shard == nil {
+		return set
+	}
+	return &shardedSeriesSet{SeriesSet: set, shard: q.shard}
 }
 
 // sortDedupLabels re-sorts the set so that the same series with different replica
@@ -333,21 +465,38 @@ func sortDedupLabels(set []storepb.Series, replicaLabels map[string]struct{}) {
 
 // LabelValues returns all potential values for a label name.
 func (q *querier) LabelValues(name string) ([]string, storage.Warnings, error) {
+	return q.LabelValuesWithMatchers(name)
+}
+
+// LabelValuesWithMatchers returns all potential values for a label name in the series matching the given matchers.
+func (q *querier) LabelValuesWithMatchers(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
 	span, ctx := tracing.StartSpan(q.ctx, "querier_label_values")
 	defer span.Finish()
 
+	ms, err := storepb.TranslatePromMatchers(matchers...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "convert matchers")
+	}
+
 	// TODO(bwplotka): Pass it using the SeriesRequest instead of relying on context.
 	ctx = context.WithValue(ctx, store.StoreMatcherKey, q.storeDebugMatchers)
+	if q.active != nil {
+		ctx = context.WithValue(ctx, store.QueriedStoreKey, q.active.addStore)
+	}
 
 	resp, err := q.proxy.LabelValues(ctx, &storepb.LabelValuesRequest{
 		Label:                   name,
 		PartialResponseDisabled: !q.partialResponse,
 		Start:                   q.mint,
 		End:                     q.maxt,
+		Matchers:                ms,
 	})
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "proxy LabelValues()")
 	}
+	if err := q.limiter.checkLabelValues(len(resp.Values)); err != nil {
+		return nil, nil, err
+	}
 
 	var warns storage.Warnings
 	for _, w := range resp.Warnings {
@@ -359,20 +508,38 @@ func (q *querier) LabelValues(name string) ([]string, storage.Warnings, error) {
 
 // LabelNames returns all the unique label names present in the block in sorted order.
 func (q *querier) LabelNames() ([]string, storage.Warnings, error) {
+	return q.LabelNamesWithMatchers()
+}
+
+// LabelNamesWithMatchers returns all the unique label names present in the series matching the given matchers in
+// sorted order.
+func (q *querier) LabelNamesWithMatchers(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
 	span, ctx := tracing.StartSpan(q.ctx, "querier_label_names")
 	defer span.Finish()
 
+	ms, err := storepb.TranslatePromMatchers(matchers...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "convert matchers")
+	}
+
 	// TODO(bwplotka): Pass it using the SeriesRequest instead of relying on context.
 	ctx = context.WithValue(ctx, store.StoreMatcherKey, q.storeDebugMatchers)
+	if q.active != nil {
+		ctx = context.WithValue(ctx, store.QueriedStoreKey, q.active.addStore)
+	}
 
 	resp, err := q.proxy.LabelNames(ctx, &storepb.LabelNamesRequest{
 		PartialResponseDisabled: !q.partialResponse,
 		Start:                   q.mint,
 		End:                     q.maxt,
+		Matchers:                ms,
 	})
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "proxy LabelNames()")
 	}
+	if err := q.limiter.checkLabelValues(len(resp.Names)); err != nil {
+		return nil, nil, err
+	}
 
 	var warns storage.Warnings
 	for _, w := range resp.Warnings {
@@ -384,5 +551,14 @@ func (q *querier) LabelNames() ([]string, storage.Warnings, error) {
 
 func (q *querier) Close() error {
 	q.cancel()
-	return nil
+
+	q.spilledMtx.Lock()
+	defer q.spilledMtx.Unlock()
+	var merr errutil.MultiError
+	for _, s := range q.spilledSets {
+		merr.Add(s.Close())
+	}
+	q.spilledSets = nil
+	q.spilledClosed = true
+	return errors.Wrap(merr.Err(), "remove spilled series")
 }
@@ -42,7 +42,7 @@ type sample struct {
 
 func TestQueryableCreator_MaxResolution(t *testing.T) {
 	testProxy := &storeServer{resps: []*storepb.SeriesResponse{}}
-	queryableCreator := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second)
+	queryableCreator := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second, DedupFuncPenalty, 0, "")
 
 	oneHourMillis := int64(1*time.Hour) / int64(time.Millisecond)
 	queryable := queryableCreator(false, nil, nil, oneHourMillis, false, false)
@@ -58,6 +58,35 @@ func TestQueryableCreator_MaxResolution(t *testing.T) {
 
 }
 
+type recordingStoreServer struct {
+	storeServer
+
+	reqs []*storepb.SeriesRequest
+}
+
+func (s *recordingStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	s.reqs = append(s.reqs, r)
+	return s.storeServer.Series(r, srv)
+}
+
+func TestQuerier_Select_Aggregates(t *testing.T) {
+	testProxy := &recordingStoreServer{}
+	queryable := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second, DedupFuncPenalty, 0, "")(false, nil, nil, 0, false, false)
+
+	q, err := queryable.Querier(context.Background(), 0, 42)
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+	hints := &storage.SelectHints{Start: 0, End: 42, Step: 10, Func: "rate", Grouping: []string{"job"}, By: true, Range: 30}
+	set := q.Select(false, hints, labels.MustNewMatcher(labels.MatchEqual, "__name__", "http_requests_total"))
+	testutil.Assert(t, !set.Next(), "no series expected")
+	testutil.Ok(t, set.Err())
+
+	// Only the aggregates of downsampled chunks needed by the function of the query are requested.
+	testutil.Equals(t, 1, len(testProxy.reqs))
+	testutil.Equals(t, []storepb.Aggr{storepb.Aggr_COUNTER}, testProxy.reqs[0].Aggregates)
+}
+
 // Tests E2E how PromQL works with downsampled data.
 func TestQuerier_DownsampledData(t *testing.T) {
 	testProxy := &storeServer{
@@ -72,7 +101,7 @@ func TestQuerier_DownsampledData(t *testing.T) {
 	}
 
 	timeout := 10 * time.Second
-	q := NewQueryableCreator(nil, nil, testProxy, 2, timeout)(false, nil, nil, 9999999, false, false)
+	q := NewQueryableCreator(nil, nil, testProxy, 2, timeout, DedupFuncPenalty, 0, "")(false, nil, nil, 9999999, false, false)
 	engine := promql.NewEngine(
 		promql.EngineOpts{
 			MaxSamples: math.MaxInt32,
@@ -363,7 +392,7 @@ func TestQuerier_Select_AfterPromQL(t *testing.T) {
 						g := gate.New(2)
 						mq := &mockedQueryable{
 							Creator: func(mint, maxt int64) storage.Querier {
-								return newQuerier(context.Background(), nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, g, timeout)
+								return newQuerier(context.Background(), nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, DedupFuncPenalty, 0, true, false, g, timeout, spillOpts{})
 							},
 						}
 						t.Cleanup(func() {
@@ -607,7 +636,7 @@ func TestQuerier_Select(t *testing.T) {
 				{dedup: true, expected: []series{tcase.expectedAfterDedup}},
 			} {
 				g := gate.New(2)
-				q := newQuerier(context.Background(), nil, tcase.mint, tcase.maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, g, timeout)
+				q := newQuerier(context.Background(), nil, tcase.mint, tcase.maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, DedupFuncPenalty, 0, true, false, g, timeout, spillOpts{})
 				t.Cleanup(func() { testutil.Ok(t, q.Close()) })
 
 				t.Run(fmt.Sprintf("dedup=%v", sc.dedup), func(t *testing.T) {
@@ -854,7 +883,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 100 * time.Second
 		g := gate.New(2)
-		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, false, 0, true, false, g, timeout)
+		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, false, DedupFuncPenalty, 0, true, false, g, timeout, spillOpts{})
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -924,7 +953,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 5 * time.Second
 		g := gate.New(2)
-		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, true, 0, true, false, g, timeout)
+		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, true, DedupFuncPenalty, 0, true, false, g, timeout, spillOpts{})
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -1357,7 +1386,7 @@ func TestDedupSeriesSet(t *testing.T) {
 
 	for _, tcase := range tests {
 		t.Run("", func(t *testing.T) {
-			dedupSet := newDedupSeriesSet(&mockedSeriesSet{series: tcase.input}, tcase.dedupLabels, tcase.isCounter)
+			dedupSet := newDedupSeriesSet(&mockedSeriesSet{series: tcase.input}, tcase.dedupLabels, tcase.isCounter, DedupFuncPenalty)
 			var ats []storage.Series
 			for dedupSet.Next() {
 				ats = append(ats, dedupSet.At())
@@ -1418,6 +1447,88 @@ func TestDedupSeriesIterator(t *testing.T) {
 	}
 }
 
+func TestChainSeriesIterator(t *testing.T) {
+	cases := []struct {
+		a, b, exp []sample
+		isCounter bool
+	}{
+		{ // Samples with the same timestamps are kept only once.
+			a:   []sample{{10000, 10}, {20000, 11}, {30000, 12}},
+			b:   []sample{{10000, 20}, {20000, 21}, {30000, 22}, {40000, 23}},
+			exp: []sample{{10000, 10}, {20000, 11}, {30000, 12}, {40000, 23}},
+		},
+		{ // Replicas scraped with an offset are interleaved.
+			a:   []sample{{10000, 1}, {20000, 3}, {50000, 6}},
+			b:   []sample{{15000, 2}, {25000, 4}, {35000, 5}},
+			exp: []sample{{10000, 1}, {15000, 2}, {20000, 3}, {25000, 4}, {35000, 5}, {50000, 6}},
+		},
+		{ // Counters never go down when switching replicas.
+			a:         []sample{{10000, 10}, {20000, 20}, {30000, 30}},
+			b:         []sample{{15000, 12}, {25000, 22}, {35000, 32}},
+			exp:       []sample{{10000, 10}, {15000, 12}, {20000, 20}, {25000, 22}, {30000, 30}, {35000, 32}},
+			isCounter: true,
+		},
+		{
+			a:         []sample{{10000, 10}, {20000, 20}, {30000, 30}},
+			b:         []sample{{15000, 5}, {25000, 15}, {35000, 25}},
+			exp:       []sample{{10000, 10}, {15000, 10}, {20000, 20}, {25000, 20}, {30000, 30}, {35000, 30}},
+			isCounter: true,
+		},
+	}
+	for i, c := range cases {
+		t.Logf("case %d:", i)
+		var its []adjustableSeriesIterator
+		for _, smpls := range [][]sample{c.a, c.b} {
+			if c.isCounter {
+				its = append(its, &counterErrAdjustSeriesIterator{Iterator: newMockedSeriesIterator(smpls)})
+			} else {
+				its = append(its, noopAdjustableSeriesIterator{newMockedSeriesIterator(smpls)})
+			}
+		}
+		res := expandSeries(t, newChainSeriesIterator(its))
+		testutil.Equals(t, c.exp, res)
+	}
+
+	it := newChainSeriesIterator([]adjustableSeriesIterator{
+		noopAdjustableSeriesIterator{newMockedSeriesIterator([]sample{{10000, 1}, {30000, 3}})},
+		noopAdjustableSeriesIterator{newMockedSeriesIterator([]sample{{20000, 2}, {40000, 4}})},
+	})
+	testutil.Assert(t, it.Seek(25000))
+	ts, v := it.At()
+	testutil.Equals(t, sample{30000, 3}, sample{ts, v})
+	testutil.Assert(t, it.Seek(20000))
+	ts, v = it.At()
+	testutil.Equals(t, sample{30000, 3}, sample{ts, v})
+	testutil.Assert(t, !it.Seek(50000))
+}
+
+func TestDedupSeriesSet_Chain(t *testing.T) {
+	input := []series{
+		{
+			lset:    labels.Labels{{Name: "a", Value: "1"}, {Name: "replica", Value: "r1"}},
+			samples: []sample{{10000, 1}, {30000, 3}},
+		}, {
+			lset:    labels.Labels{{Name: "a", Value: "1"}, {Name: "replica", Value: "r2"}},
+			samples: []sample{{20000, 2}, {30000, 4}},
+		}, {
+			lset:    labels.Labels{{Name: "a", Value: "2"}, {Name: "replica", Value: "r1"}},
+			samples: []sample{{10000, 1}},
+		},
+	}
+	dedupSet := newDedupSeriesSet(&mockedSeriesSet{series: input}, map[string]struct{}{"replica": {}}, false, DedupFuncChain)
+
+	var res []series
+	for dedupSet.Next() {
+		s := dedupSet.At()
+		res = append(res, series{lset: s.Labels(), samples: expandSeries(t, s.Iterator())})
+	}
+	testutil.Ok(t, dedupSet.Err())
+	testutil.Equals(t, []series{
+		{lset: labels.Labels{{Name: "a", Value: "1"}}, samples: []sample{{10000, 1}, {20000, 2}, {30000, 3}}},
+		{lset: labels.Labels{{Name: "a", Value: "2"}}, samples: []sample{{10000, 1}}},
+	}, res)
+}
+
 func BenchmarkDedupSeriesIterator(b *testing.B) {
 	run := func(b *testing.B, s1, s2 []sample) {
 		it := newDedupSeriesIterator(
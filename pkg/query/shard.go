@@ -0,0 +1,85 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// ShardInfo selects the shard of the series a query is evaluated on. The series are assigned to the shards by the
+// hash of their grouping labels, so that all the series aggregated together by the query end up in the same shard.
+type ShardInfo struct {
+	// ShardIndex is the index of the selected shard, from 0 to TotalShards-1.
+	ShardIndex  int
+	TotalShards int
+	// By is true if the series are hashed by Labels, false if they are hashed by all their labels but Labels and
+	// the metric name.
+	By     bool
+	Labels []string
+}
+
+// NewShardInfo returns the ShardInfo of the given shard.
+func NewShardInfo(shardIndex, totalShards int, by bool, lbls []string) *ShardInfo {
+	sorted := append([]string{}, lbls...)
+	sort.Strings(sorted)
+	return &ShardInfo{ShardIndex: shardIndex, TotalShards: totalShards, By: by, Labels: sorted}
+}
+
+// storeShardInfo returns the shard selection pushed down to the stores, or nil if there is no shard. The stores hash
+// the series before deduplication, so the replica labels are not hashed, and the replicas of a series always end up
+// in the same shard.
+func (s *ShardInfo) storeShardInfo(replicaLabels map[string]struct{}) *storepb.ShardInfo {
+	if s == nil {
+		return nil
+	}
+
+	var lbls []string
+	if s.By {
+		for _, l := range s.Labels {
+			if _, ok := replicaLabels[l]; !ok {
+				lbls = append(lbls, l)
+			}
+		}
+	} else {
+		lbls = append(lbls, s.Labels...)
+		for l := range replicaLabels {
+			lbls = append(lbls, l)
+		}
+		sort.Strings(lbls)
+	}
+	return &storepb.ShardInfo{ShardIndex: int64(s.ShardIndex), TotalShards: int64(s.TotalShards), By: s.By, Labels: lbls}
+}
+
+// shardedSeriesSet filters the series of the set not belonging to the shard, in case of stores not selecting the
+// shard themselves.
+type shardedSeriesSet struct {
+	storage.SeriesSet
+	shard *storepb.ShardInfo
+}
+
+func (s *shardedSeriesSet) Next() bool {
+	for s.SeriesSet.Next() {
+		if s.shard.Matches(s.SeriesSet.At().Labels()) {
+			return true
+		}
+	}
+	return false
+}
+
+type shardInfoKey struct{}
+
+// WithShardInfo returns a context restricting the queriers created with it to the series of the given shard.
+func WithShardInfo(ctx context.Context, s *ShardInfo) context.Context {
+	return context.WithValue(ctx, shardInfoKey{}, s)
+}
+
+func shardInfoFromContext(ctx context.Context) *ShardInfo {
+	s, _ := ctx.Value(shardInfoKey{}).(*ShardInfo)
+	return s
+}
@@ -0,0 +1,93 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/gate"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// shardingStoreServer only sends the series of the shard of the requests.
+type shardingStoreServer struct {
+	storeServer
+
+	sent int
+}
+
+func (s *shardingStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	for _, resp := range s.resps {
+		if !r.ShardInfo.Matches(resp.GetSeries().PromLabels()) {
+			continue
+		}
+		s.sent++
+		if err := srv.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestQuerier_Select_Shards(t *testing.T) {
+	var resps []*storepb.SeriesResponse
+	for i := 0; i < 20; i++ {
+		for _, replica := range []string{"r1", "r2"} {
+			resps = append(resps, storeSeriesResponse(t, labels.FromStrings(
+				"__name__", "up", "instance", fmt.Sprintf("%d", i), "job", fmt.Sprintf("%d", i%4), "replica", replica,
+			), []sample{{0, 0}, {1, 1}}))
+		}
+	}
+
+	for _, tcase := range []struct {
+		name  string
+		by    bool
+		lbls  []string
+		group string
+	}{
+		{name: "by job", by: true, lbls: []string{"job"}, group: "job"},
+		{name: "without instance", lbls: []string{"instance"}, group: "job"},
+		{name: "without nothing", group: "instance"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			const totalShards = 3
+
+			storeAPI := &shardingStoreServer{storeServer: storeServer{resps: resps}}
+			seen := map[string]struct{}{}
+			groups := map[string]int{}
+			for i := 0; i < totalShards; i++ {
+				ctx := WithShardInfo(context.Background(), NewShardInfo(i, totalShards, tcase.by, tcase.lbls))
+				q := newQuerier(ctx, nil, 0, 10, []string{"replica"}, nil, storeAPI, true, DedupFuncPenalty, 0, true, false, gate.New(2), time.Minute, spillOpts{})
+
+				set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"))
+				for set.Next() {
+					lset := set.At().Labels()
+					testutil.Equals(t, "", lset.Get("replica"))
+
+					_, ok := seen[lset.String()]
+					testutil.Assert(t, !ok, "series %v returned by several shards", lset)
+					seen[lset.String()] = struct{}{}
+
+					// All the series of a group must be returned by the same shard.
+					g := lset.Get(tcase.group)
+					if shard, ok := groups[g]; ok {
+						testutil.Equals(t, shard, i)
+					}
+					groups[g] = i
+				}
+				testutil.Ok(t, set.Err())
+				testutil.Ok(t, q.Close())
+			}
+			testutil.Equals(t, 20, len(seen))
+			// Each replica of the series is sent by the store for a single shard.
+			testutil.Equals(t, len(resps), storeAPI.sent)
+		})
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/errutil"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// spillFilePrefix is the prefix of the names of the files of the spilled series.
+const spillFilePrefix = "thanos-query-series-"
+
+// RemoveSpilledSeries removes the files of the series spilled to dir, or to the default directory for temporary files
+// if empty, e.g. the ones left behind by a querier which crashed. It returns the number of removed files. Spilled
+// series still being read, e.g. by another querier spilling to dir, remain readable on Unix systems.
+func RemoveSpilledSeries(dir string) (int, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	files, err := filepath.Glob(filepath.Join(dir, spillFilePrefix+"*"))
+	if err != nil {
+		return 0, errors.Wrap(err, "list spilled series")
+	}
+	var (
+		merr    errutil.MultiError
+		removed int
+	)
+	for _, f := range files {
+		if err := removeRunFile(f); err != nil {
+			merr.Add(err)
+			continue
+		}
+		removed++
+	}
+	return removed, merr.Err()
+}
+
+// removeRunFile removes the file of a run, which can already be removed by RemoveSpilledSeries.
+func removeRunFile(name string) error {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// spillOpts configures the spilling of the series of the selects to disk.
+type spillOpts struct {
+	// maxBytes is the maximum size of the series of a select held in memory, or 0 if not limited.
+	maxBytes int64
+	// dir is the directory of the spilled series, the default directory for temporary files if empty.
+	dir          string
+	spilledBytes prometheus.Counter
+}
+
+// seriesSpiller buffers the series of a select in memory up to maxBytes. Above it, the buffered series are sorted
+// and written to a temporary file, so that selects fetching millions of series do not run the querier out of memory.
+// The sorted runs are merged back when iterating the series.
+type seriesSpiller struct {
+	opts spillOpts
+	// replicaLabels are the labels the series are deduplicated by, if any. The series are sorted as by
+	// sortDedupLabels then, otherwise they are kept in the order they were added in.
+	replicaLabels map[string]struct{}
+
+	buf      []storepb.Series
+	bufBytes int64
+	runs     []*os.File
+	// lenBuf is the buffer of the lengths of the spilled series.
+	lenBuf [binary.MaxVarintLen64]byte
+}
+
+func newSeriesSpiller(opts spillOpts, replicaLabels map[string]struct{}) *seriesSpiller {
+	return &seriesSpiller{opts: opts, replicaLabels: replicaLabels}
+}
+
+// add buffers the series, spilling the buffered series to disk if they exceed the maximum size.
+func (s *seriesSpiller) add(series storepb.Series) error {
+	s.buf = append(s.buf, series)
+	s.bufBytes += int64(series.Size())
+	if s.bufBytes <= s.opts.maxBytes {
+		return nil
+	}
+	if err := s.spill(); err != nil {
+		return errors.Wrap(err, "spill series to disk")
+	}
+	return nil
+}
+
+func (s *seriesSpiller) sort() {
+	if s.replicaLabels != nil {
+		sortDedupLabels(s.buf, s.replicaLabels)
+	}
+}
+
+// spill writes the buffered series to a new run file, as length prefixed protobuf messages.
+func (s *seriesSpiller) spill() (err error) {
+	s.sort()
+
+	f, err := ioutil.TempFile(s.opts.dir, spillFilePrefix)
+	if err != nil {
+		return errors.Wrap(err, "create run file")
+	}
+	s.runs = append(s.runs, f)
+
+	w := bufio.NewWriter(f)
+	var written int64
+	for i := range s.buf {
+		b, err := s.buf[i].Marshal()
+		if err != nil {
+			return errors.Wrap(err, "marshal series")
+		}
+		n := binary.PutUvarint(s.lenBuf[:], uint64(len(b)))
+		if _, err := w.Write(s.lenBuf[:n]); err != nil {
+			return errors.Wrap(err, "write series")
+		}
+		if _, err := w.Write(b); err != nil {
+			return errors.Wrap(err, "write series")
+		}
+		written += int64(n + len(b))
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "flush run file")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "rewind run file")
+	}
+	if s.opts.spilledBytes != nil {
+		s.opts.spilledBytes.Add(float64(written))
+	}
+
+	s.buf, s.bufBytes = nil, 0
+	return nil
+}
+
+// close removes the spilled series from disk, in case they are not iterated.
+func (s *seriesSpiller) close() error {
+	var merr errutil.MultiError
+	for _, f := range s.runs {
+		merr.Add(f.Close())
+		merr.Add(removeRunFile(f.Name()))
+	}
+	s.runs = nil
+	return merr.Err()
+}
+
+// seriesSet returns the added series, sorted like in memory. The returned set has to be closed to remove the spilled
+// series from disk, which happens too when it is fully iterated.
+func (s *seriesSpiller) seriesSet() *spilledSeriesSet {
+	s.sort()
+	set := &spilledSeriesSet{runs: s.runs, dedup: s.replicaLabels != nil}
+	for _, f := range s.runs {
+		set.cursors = append(set.cursors, &fileRunCursor{r: bufio.NewReader(f)})
+	}
+	set.cursors = append(set.cursors, &memRunCursor{series: s.buf, i: -1})
+	s.buf, s.runs = nil, nil
+	return set
+}
+
+// runCursor iterates the sorted series of a run.
+type runCursor interface {
+	next() (bool, error)
+	at() *storepb.Series
+}
+
+type memRunCursor struct {
+	series []storepb.Series
+	i      int
+}
+
+func (c *memRunCursor) next() (bool, error) {
+	if c.i >= len(c.series)-1 {
+		return false, nil
+	}
+	c.i++
+	return true, nil
+}
+
+func (c *memRunCursor) at() *storepb.Series { return &c.series[c.i] }
+
+type fileRunCursor struct {
+	r   *bufio.Reader
+	cur storepb.Series
+}
+
+func (c *fileRunCursor) next() (bool, error) {
+	l, err := binary.ReadUvarint(c.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "read length of spilled series")
+	}
+	// The labels of the series are not copied on unmarshal, so every series needs its own buffer.
+	b := make([]byte, l)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return false, errors.Wrap(err, "read spilled series")
+	}
+	c.cur = storepb.Series{}
+	if err := c.cur.Unmarshal(b); err != nil {
+		return false, errors.Wrap(err, "unmarshal spilled series")
+	}
+	return true, nil
+}
+
+func (c *fileRunCursor) at() *storepb.Series { return &c.cur }
+
+// spilledSeriesSet implements storepb.SeriesSet over the runs of a seriesSpiller. Sorted runs of deduplicated
+// selects are merged, other runs are iterated one after the other, in the order the series were added in.
+type spilledSeriesSet struct {
+	cursors []runCursor
+	dedup   bool
+	runs    []*os.File
+
+	// heap holds the indexes of the cursors with series left, ordered by their current series.
+	heap    cursorHeap
+	started bool
+	cur     *storepb.Series
+	err     error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (s *spilledSeriesSet) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if err := s.advance(); err != nil {
+		s.err = err
+		return false
+	}
+	if s.cur == nil {
+		if err := s.Close(); err != nil {
+			s.err = errors.Wrap(err, "remove spilled series")
+		}
+		return false
+	}
+	return true
+}
+
+func (s *spilledSeriesSet) advance() error {
+	if !s.dedup {
+		for len(s.cursors) > 0 {
+			ok, err := s.cursors[0].next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				s.cur = s.cursors[0].at()
+				return nil
+			}
+			s.cursors = s.cursors[1:]
+		}
+		s.cur = nil
+		return nil
+	}
+
+	if !s.started {
+		s.started = true
+		s.heap = cursorHeap{cursors: s.cursors}
+		for i, c := range s.cursors {
+			ok, err := c.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				s.heap.idx = append(s.heap.idx, i)
+			}
+		}
+		heap.Init(&s.heap)
+	} else if len(s.heap.idx) > 0 {
+		// Move the cursor of the current series forward.
+		ok, err := s.cursors[s.heap.idx[0]].next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&s.heap, 0)
+		} else {
+			heap.Pop(&s.heap)
+		}
+	}
+
+	if len(s.heap.idx) == 0 {
+		s.cur = nil
+		return nil
+	}
+	s.cur = s.cursors[s.heap.idx[0]].at()
+	return nil
+}
+
+func (s *spilledSeriesSet) At() (labels.Labels, []storepb.AggrChunk) {
+	return s.cur.PromLabels(), s.cur.Chunks
+}
+
+func (s *spilledSeriesSet) Err() error {
+	return s.err
+}
+
+// Close removes the spilled series from disk. It is safe to call it multiple times.
+func (s *spilledSeriesSet) Close() error {
+	s.closeOnce.Do(func() {
+		var merr errutil.MultiError
+		for _, f := range s.runs {
+			merr.Add(f.Close())
+			merr.Add(removeRunFile(f.Name()))
+		}
+		s.closeErr = merr.Err()
+	})
+	return s.closeErr
+}
+
+// cursorHeap orders the indexes of the run cursors by the labels of their current series, and by the order of the
+// runs for the same labels.
+type cursorHeap struct {
+	cursors []runCursor
+	idx     []int
+}
+
+func (h *cursorHeap) Len() int { return len(h.idx) }
+
+func (h *cursorHeap) Less(i, j int) bool {
+	a, b := h.cursors[h.idx[i]].at(), h.cursors[h.idx[j]].at()
+	if c := labels.Compare(labelpb.ZLabelsToPromLabels(a.Labels), labelpb.ZLabelsToPromLabels(b.Labels)); c != 0 {
+		return c < 0
+	}
+	return h.idx[i] < h.idx[j]
+}
+
+func (h *cursorHeap) Swap(i, j int) { h.idx[i], h.idx[j] = h.idx[j], h.idx[i] }
+
+func (h *cursorHeap) Push(x interface{}) { h.idx = append(h.idx, x.(int)) }
+
+func (h *cursorHeap) Pop() interface{} {
+	n := len(h.idx)
+	x := h.idx[n-1]
+	h.idx = h.idx[:n-1]
+	return x
+}
@@ -0,0 +1,176 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/gate"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// spillTestSeries returns series of two replicas, in the order the proxy would send them in.
+func spillTestSeries(t *testing.T) []storepb.Series {
+	var res []storepb.Series
+	for _, replica := range []string{"1", "2"} {
+		for i := 0; i < 20; i++ {
+			r := storeSeriesResponse(t, labels.FromStrings("a", fmt.Sprintf("%02d", i), "replica", replica, "z", "1"), []sample{{int64(i), 1}, {int64(i + 1), 2}})
+			res = append(res, *r.GetSeries())
+		}
+	}
+	return res
+}
+
+func expandStoreSeriesSet(t *testing.T, set storepb.SeriesSet) (res []storepb.Series) {
+	for set.Next() {
+		lset, chks := set.At()
+		res = append(res, storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset.Copy()), Chunks: chks})
+	}
+	testutil.Ok(t, set.Err())
+	return res
+}
+
+func TestSeriesSpiller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	for _, replicaLabels := range []map[string]struct{}{nil, {"replica": {}}} {
+		expected := spillTestSeries(t)
+		if replicaLabels != nil {
+			sortDedupLabels(expected, replicaLabels)
+		}
+
+		for _, maxBytes := range []int64{1, 200, 1 << 20} {
+			t.Run(fmt.Sprintf("dedup=%v,maxBytes=%d", replicaLabels != nil, maxBytes), func(t *testing.T) {
+				spilledBytes := prometheus.NewCounter(prometheus.CounterOpts{})
+				s := newSeriesSpiller(spillOpts{maxBytes: maxBytes, dir: dir, spilledBytes: spilledBytes}, replicaLabels)
+				for _, series := range spillTestSeries(t) {
+					testutil.Ok(t, s.add(series))
+				}
+				if maxBytes < 1<<20 {
+					testutil.Assert(t, promtest.ToFloat64(spilledBytes) > 0, "expected series to be spilled")
+				} else {
+					testutil.Equals(t, 0.0, promtest.ToFloat64(spilledBytes))
+				}
+
+				testutil.Equals(t, expected, expandStoreSeriesSet(t, s.seriesSet()))
+
+				// Fully iterated sets remove their files.
+				files, err := ioutil.ReadDir(dir)
+				testutil.Ok(t, err)
+				testutil.Equals(t, 0, len(files))
+			})
+		}
+	}
+}
+
+func TestSeriesSpiller_Close(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	s := newSeriesSpiller(spillOpts{maxBytes: 1, dir: dir}, nil)
+	for _, series := range spillTestSeries(t) {
+		testutil.Ok(t, s.add(series))
+	}
+	files, err := ioutil.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Assert(t, len(files) > 0, "expected series to be spilled")
+
+	set := s.seriesSet()
+	testutil.Assert(t, set.Next(), "expected series")
+	testutil.Ok(t, set.Close())
+	testutil.Ok(t, set.Close())
+
+	files, err = ioutil.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(files))
+}
+
+func TestRemoveSpilledSeries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "other"), nil, 0600))
+	s := newSeriesSpiller(spillOpts{maxBytes: 1, dir: dir}, nil)
+	expected := spillTestSeries(t)
+	for _, series := range expected {
+		testutil.Ok(t, s.add(series))
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Assert(t, len(files) > 1, "expected series to be spilled")
+
+	// The series being iterated are still readable once removed, and closing the set does not fail.
+	set := s.seriesSet()
+	removed, err := RemoveSpilledSeries(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, len(files)-1, removed)
+	testutil.Equals(t, expected, expandStoreSeriesSet(t, set))
+	testutil.Ok(t, set.Close())
+
+	files, err = ioutil.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(files))
+	testutil.Equals(t, "other", files[0].Name())
+}
+
+func TestQuerier_Select_Spill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill-test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	storeAPI := &storeServer{}
+	for _, s := range spillTestSeries(t) {
+		storeAPI.resps = append(storeAPI.resps, storepb.NewSeriesResponse(&s))
+	}
+
+	expand := func(set storage.SeriesSet) (res []series) {
+		for set.Next() {
+			res = append(res, series{lset: set.At().Labels(), samples: expandSeries(t, set.At().Iterator())})
+		}
+		testutil.Ok(t, set.Err())
+		return res
+	}
+
+	for _, dedup := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dedup=%v", dedup), func(t *testing.T) {
+			newQ := func(spill spillOpts) *querier {
+				return newQuerier(context.Background(), nil, 0, 100, []string{"replica"}, nil, storeAPI, dedup, DedupFuncPenalty, 0, true, false, gate.New(2), time.Minute, spill)
+			}
+
+			q := newQ(spillOpts{})
+			expected := expand(q.Select(false, nil))
+			testutil.Ok(t, q.Close())
+
+			spilledBytes := prometheus.NewCounter(prometheus.CounterOpts{})
+			q = newQ(spillOpts{maxBytes: 100, dir: dir, spilledBytes: spilledBytes})
+			testutil.Equals(t, expected, expand(q.Select(false, nil)))
+			testutil.Assert(t, promtest.ToFloat64(spilledBytes) > 0, "expected series to be spilled")
+
+			// Closing the querier removes the series of the selects, which were not fully iterated.
+			testutil.Assert(t, q.Select(false, nil).Next(), "expected series")
+			testutil.Ok(t, q.Close())
+			files, err := ioutil.ReadDir(dir)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 0, len(files))
+		})
+	}
+}
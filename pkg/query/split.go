@@ -0,0 +1,185 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/stats"
+)
+
+// NewSplitRangeQuery returns a range query evaluated in consecutive time ranges of at most splitInterval, aligned to
+// the step, whose results are merged. Only the series selected for one time range are held in memory at once,
+// which reduces the peak memory of range queries over long time ranges, at the cost of selecting the series once per
+// time range. As every step of a range query is evaluated independently, the result is the same as the one of the
+// range query evaluated at once.
+// The results are not streamed: the merged result of all the time ranges is held in memory until the query is closed.
+// The timeout and max samples limit of the engine apply to the evaluation of each time range.
+func NewSplitRangeQuery(engine *promql.Engine, q storage.Queryable, qs string, start, end time.Time, step, splitInterval time.Duration) (promql.Query, error) {
+	if step <= 0 {
+		return nil, errors.New("zero or negative query resolution step widths are not accepted")
+	}
+	// Each time range spans a whole number of steps, so all of them are aligned to the query start.
+	stepsPerRange := int64(splitInterval / step)
+	if stepsPerRange < 1 {
+		stepsPerRange = 1
+	}
+
+	var ranges [][2]time.Time
+	for s := start; !s.After(end); s = s.Add(time.Duration(stepsPerRange) * step) {
+		e := s.Add(time.Duration(stepsPerRange-1) * step)
+		if e.After(end) {
+			e = end
+		}
+		ranges = append(ranges, [2]time.Time{s, e})
+	}
+	if len(ranges) == 0 {
+		ranges = append(ranges, [2]time.Time{start, end})
+	}
+
+	// The first query is created right away to report parsing errors.
+	first, err := engine.NewRangeQuery(q, qs, ranges[0][0], ranges[0][1], step)
+	if err != nil {
+		return nil, err
+	}
+	return &splitRangeQuery{
+		engine:    engine,
+		queryable: q,
+		qs:        qs,
+		step:      step,
+		ranges:    ranges,
+		first:     first,
+		current:   first,
+		stats:     &stats.QueryStats{},
+	}, nil
+}
+
+type splitRangeQuery struct {
+	engine    *promql.Engine
+	queryable storage.Queryable
+	qs        string
+	step      time.Duration
+	ranges    [][2]time.Time
+
+	first promql.Query
+	// stats are the statistics of the evaluations of the time ranges so far, summed.
+	stats *stats.QueryStats
+
+	mtx      sync.Mutex
+	current  promql.Query
+	canceled bool
+}
+
+// Exec evaluates the time ranges one by one and merges their results.
+func (q *splitRangeQuery) Exec(ctx context.Context) *promql.Result {
+	var (
+		series = map[string]*promql.Series{}
+		warns  storage.Warnings
+	)
+	for i, r := range q.ranges {
+		sub := q.first
+		if i > 0 {
+			var err error
+			sub, err = q.engine.NewRangeQuery(q.queryable, q.qs, r[0], r[1], q.step)
+			if err != nil {
+				return &promql.Result{Err: err}
+			}
+			if !q.setCurrent(sub) {
+				sub.Close()
+				return &promql.Result{Err: promql.ErrQueryCanceled("split range query")}
+			}
+		}
+
+		res := sub.Exec(ctx)
+		q.addStats(sub)
+		if res.Err != nil {
+			sub.Close()
+			return res
+		}
+		warns = append(warns, res.Warnings...)
+
+		mat, err := res.Matrix()
+		if err != nil {
+			sub.Close()
+			return &promql.Result{Err: errors.Wrap(err, "unexpected result of range query")}
+		}
+		for _, s := range mat {
+			key := s.Metric.String()
+			merged, ok := series[key]
+			if !ok {
+				merged = &promql.Series{Metric: s.Metric}
+				series[key] = merged
+			}
+			// Points are copied, as they are recovered by the engine when the query is closed.
+			merged.Points = append(merged.Points, s.Points...)
+		}
+		sub.Close()
+	}
+
+	mat := make(promql.Matrix, 0, len(series))
+	for _, s := range series {
+		mat = append(mat, *s)
+	}
+	sort.Sort(mat)
+	return &promql.Result{Value: mat, Warnings: warns}
+}
+
+func (q *splitRangeQuery) addStats(sub promql.Query) {
+	s := stats.NewQueryStats(sub.Stats()).Timings
+	q.stats.Timings.EvalTotalTime += s.EvalTotalTime
+	q.stats.Timings.ResultSortTime += s.ResultSortTime
+	q.stats.Timings.QueryPreparationTime += s.QueryPreparationTime
+	q.stats.Timings.InnerEvalTime += s.InnerEvalTime
+	q.stats.Timings.ExecQueueTime += s.ExecQueueTime
+	q.stats.Timings.ExecTotalTime += s.ExecTotalTime
+}
+
+func (q *splitRangeQuery) setCurrent(sub promql.Query) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.canceled {
+		return false
+	}
+	q.current = sub
+	return true
+}
+
+// Close is a noop, as the memory used by the evaluation of each time range is recovered once its result is merged.
+func (q *splitRangeQuery) Close() {}
+
+// Statement returns the parsed statement of the query.
+func (q *splitRangeQuery) Statement() parser.Statement {
+	return q.first.Statement()
+}
+
+// Stats returns statistics about the lifetime of the evaluation of the first time range. Use PromQLStats for the
+// statistics of all the time ranges.
+func (q *splitRangeQuery) Stats() *stats.QueryTimers {
+	return q.first.Stats()
+}
+
+// PromQLStats returns the statistics of the evaluation of the query. The statistics of the range queries created with
+// NewSplitRangeQuery are the ones of the evaluations of all their time ranges, summed.
+func PromQLStats(qry promql.Query) *stats.QueryStats {
+	if q, ok := qry.(*splitRangeQuery); ok {
+		s := *q.stats
+		return &s
+	}
+	return stats.NewQueryStats(qry.Stats())
+}
+
+// Cancel signals that the running evaluation should be aborted.
+func (q *splitRangeQuery) Cancel() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.canceled = true
+	q.current.Cancel()
+}
@@ -0,0 +1,66 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/util/stats"
+	"github.com/prometheus/prometheus/util/teststorage"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSplitRangeQuery(t *testing.T) {
+	s := teststorage.New(t)
+	defer s.Close()
+
+	app := s.Appender(context.Background())
+	for i := int64(0); i < 600; i++ {
+		_, err := app.Add(labels.FromStrings("__name__", "requests_total", "job", "a"), i*15000, float64(i))
+		testutil.Ok(t, err)
+		// The series of job b starts after the first time range.
+		if i > 300 {
+			_, err = app.Add(labels.FromStrings("__name__", "requests_total", "job", "b"), i*15000, float64(2*i))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	start, end, step := time.Unix(0, 0), time.Unix(9000, 0), time.Minute
+
+	for _, qs := range []string{
+		`rate(requests_total[5m])`,
+		`sum(requests_total)`,
+		`max_over_time(requests_total[10m:1m])`,
+		`1`,
+	} {
+		t.Run(qs, func(t *testing.T) {
+			qry, err := engine.NewRangeQuery(s, qs, start, end, step)
+			testutil.Ok(t, err)
+			exp := qry.Exec(context.Background())
+			testutil.Ok(t, exp.Err)
+
+			for _, splitInterval := range []time.Duration{time.Minute, 37 * time.Minute, time.Hour, 24 * time.Hour} {
+				split, err := NewSplitRangeQuery(engine, s, qs, start, end, step, splitInterval)
+				testutil.Ok(t, err)
+				res := split.Exec(context.Background())
+				testutil.Ok(t, res.Err)
+				testutil.Equals(t, exp.Value, res.Value)
+				// The statistics are the ones of all the time ranges.
+				testutil.Assert(t, PromQLStats(split).Timings.EvalTotalTime >= stats.NewQueryStats(split.Stats()).Timings.EvalTotalTime, "expected statistics of all time ranges")
+				split.Close()
+			}
+			qry.Close()
+		})
+	}
+
+	_, err := NewSplitRangeQuery(engine, s, `rate(`, start, end, step, time.Hour)
+	testutil.NotOk(t, err)
+}
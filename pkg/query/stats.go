@@ -0,0 +1,282 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// QueryStats gathers the statistics of the data fetched from the StoreAPIs by the selects of a query.
+type QueryStats struct {
+	mtx    sync.Mutex
+	stores map[string]*StoreStats
+	// sources are the time ranges of the data each source contributed to the selects.
+	sources map[Source]*timeRange
+}
+
+// NewQueryStats returns empty QueryStats.
+func NewQueryStats() *QueryStats {
+	return &QueryStats{stores: map[string]*StoreStats{}, sources: map[Source]*timeRange{}}
+}
+
+// timeRange is a time range in milliseconds, with an exclusive maxt.
+type timeRange struct {
+	mint, maxt int64
+}
+
+// StoreStats are the statistics of the data fetched from a StoreAPI by a query, summed over its selects.
+// The wall times are in seconds.
+type StoreStats struct {
+	Store           string  `json:"store"`
+	Selects         int     `json:"selects"`
+	SeriesFetched   int64   `json:"seriesFetched"`
+	ChunksFetched   int64   `json:"chunksFetched"`
+	BlocksQueried   int64   `json:"blocksQueried"`
+	BytesDownloaded int64   `json:"bytesDownloaded"`
+	SelectTime      float64 `json:"selectTime"`
+	FetchTime       float64 `json:"fetchTime"`
+	MergeTime       float64 `json:"mergeTime"`
+	// MinTime and MaxTime are the time range advertised by the StoreAPI.
+	MinTime int64 `json:"minTime"`
+	MaxTime int64 `json:"maxTime"`
+	// Blocks are the blocks queried, for the StoreAPIs backed by the object storage.
+	Blocks []BlockStats `json:"blocks,omitempty"`
+}
+
+// BlockStats describes a block queried by a query. Its MaxTime is exclusive.
+type BlockStats struct {
+	ID         string `json:"id"`
+	MinTime    int64  `json:"minTime"`
+	MaxTime    int64  `json:"maxTime"`
+	Resolution int64  `json:"resolution"`
+}
+
+// Source is a source of the data of a query: a StoreAPI, and for the StoreAPIs backed by the object storage, a block
+// and its resolution.
+type Source struct {
+	Store      string `json:"store"`
+	Block      string `json:"block,omitempty"`
+	Resolution int64  `json:"resolution"`
+}
+
+// SourceRange is a time range of a query along with the sources that contributed data to it. Its MaxTime is
+// exclusive.
+type SourceRange struct {
+	MinTime int64    `json:"minTime"`
+	MaxTime int64    `json:"maxTime"`
+	Sources []Source `json:"sources"`
+}
+
+// StoresStats are the statistics of the data fetched from the StoreAPIs by a query.
+type StoresStats struct {
+	StoresQueried   int          `json:"storesQueried"`
+	BlocksQueried   int64        `json:"blocksQueried"`
+	SeriesFetched   int64        `json:"seriesFetched"`
+	ChunksFetched   int64        `json:"chunksFetched"`
+	BytesDownloaded int64        `json:"bytesDownloaded"`
+	Stores          []StoreStats `json:"stores"`
+	// Timeline are the consecutive time ranges of the query, with the sources of their data. The time ranges no
+	// source contributed data to are left out.
+	Timeline []SourceRange `json:"timeline"`
+}
+
+// add adds the statistics returned by the proxy for a select of the given time range, with an inclusive maxt.
+func (s *QueryStats) add(mint, maxt int64, stores []hintspb.StoreQueryStats) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	selected := timeRange{mint: mint, maxt: exclusive(maxt)}
+	for _, h := range stores {
+		st, ok := s.stores[h.Store]
+		if !ok {
+			st = &StoreStats{Store: h.Store, MinTime: h.MinTime, MaxTime: h.MaxTime}
+			s.stores[h.Store] = st
+		}
+		if len(h.QueriedBlocks) == 0 {
+			r := selected
+			// Older proxies don't return the time range of the StoreAPIs.
+			if h.MinTime != 0 || h.MaxTime != 0 {
+				r = timeRange{mint: h.MinTime, maxt: exclusive(h.MaxTime)}
+			}
+			s.addSource(Source{Store: h.Store}, r, selected)
+		}
+		for _, b := range h.QueriedBlocks {
+			src := Source{Store: h.Store, Block: b.Id, Resolution: b.Resolution}
+			if _, ok := s.sources[src]; !ok {
+				st.Blocks = append(st.Blocks, BlockStats{ID: b.Id, MinTime: b.MinTime, MaxTime: b.MaxTime, Resolution: b.Resolution})
+			}
+			s.addSource(src, timeRange{mint: b.MinTime, maxt: b.MaxTime}, selected)
+		}
+		st.Selects++
+		st.SeriesFetched += h.SeriesReceived
+		st.ChunksFetched += h.ChunksReceived
+		st.SelectTime += h.Duration.Seconds()
+		// Only the StoreAPIs backed by the object storage return detailed statistics.
+		if h.QueryStats != nil {
+			st.BlocksQueried += h.QueryStats.BlocksQueried
+			st.BytesDownloaded += h.QueryStats.DataDownloadedSizeSum
+			st.FetchTime += h.QueryStats.GetAllDuration.Seconds()
+			st.MergeTime += h.QueryStats.MergeDuration.Seconds()
+		}
+	}
+}
+
+// Stores returns the statistics of the StoreAPIs, sorted by store.
+func (s *QueryStats) Stores() StoresStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	res := StoresStats{StoresQueried: len(s.stores), Stores: make([]StoreStats, 0, len(s.stores))}
+	for _, st := range s.stores {
+		res.BlocksQueried += st.BlocksQueried
+		res.SeriesFetched += st.SeriesFetched
+		res.ChunksFetched += st.ChunksFetched
+		res.BytesDownloaded += st.BytesDownloaded
+		res.Stores = append(res.Stores, *st)
+	}
+	sort.Slice(res.Stores, func(i, j int) bool { return res.Stores[i].Store < res.Stores[j].Store })
+	res.Timeline = s.timeline()
+	return res
+}
+
+// addSource extends the time range of the given source with the part of r within the selected time range.
+func (s *QueryStats) addSource(src Source, r, selected timeRange) {
+	if r.mint < selected.mint {
+		r.mint = selected.mint
+	}
+	if r.maxt > selected.maxt {
+		r.maxt = selected.maxt
+	}
+	if r.mint >= r.maxt {
+		return
+	}
+	cur, ok := s.sources[src]
+	if !ok {
+		s.sources[src] = &r
+		return
+	}
+	if r.mint < cur.mint {
+		cur.mint = r.mint
+	}
+	if r.maxt > cur.maxt {
+		cur.maxt = r.maxt
+	}
+}
+
+// timeline splits the time ranges of the sources at their boundaries, and merges the neighbouring ranges with the
+// same sources.
+func (s *QueryStats) timeline() []SourceRange {
+	var bounds []int64
+	for _, r := range s.sources {
+		bounds = append(bounds, r.mint, r.maxt)
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	res := []SourceRange{}
+	for i := 1; i < len(bounds); i++ {
+		mint, maxt := bounds[i-1], bounds[i]
+		if mint == maxt {
+			continue
+		}
+		var sources []Source
+		for src, r := range s.sources {
+			if r.mint <= mint && maxt <= r.maxt {
+				sources = append(sources, src)
+			}
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		sortSources(sources)
+
+		if n := len(res); n > 0 && res[n-1].MaxTime == mint && equalSources(res[n-1].Sources, sources) {
+			res[n-1].MaxTime = maxt
+			continue
+		}
+		res = append(res, SourceRange{MinTime: mint, MaxTime: maxt, Sources: sources})
+	}
+	return res
+}
+
+func sortSources(sources []Source) {
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Store != sources[j].Store {
+			return sources[i].Store < sources[j].Store
+		}
+		if sources[i].Resolution != sources[j].Resolution {
+			return sources[i].Resolution < sources[j].Resolution
+		}
+		return sources[i].Block < sources[j].Block
+	})
+}
+
+func equalSources(a, b []Source) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// exclusive returns the exclusive maxt matching the given inclusive one.
+func exclusive(maxt int64) int64 {
+	if maxt == math.MaxInt64 {
+		return maxt
+	}
+	return maxt + 1
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats returns a context gathering the statistics of the queriers created with it into s.
+func WithQueryStats(ctx context.Context, s *QueryStats) context.Context {
+	return context.WithValue(ctx, queryStatsKey{}, s)
+}
+
+func queryStatsFromContext(ctx context.Context) *QueryStats {
+	s, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return s
+}
+
+// QueryUsage counts the samples fetched from the StoreAPIs by the selects of a query, to account its usage.
+type QueryUsage struct {
+	samples int64
+}
+
+// Samples returns the number of samples fetched.
+func (u *QueryUsage) Samples() int64 {
+	return atomic.LoadInt64(&u.samples)
+}
+
+func (u *QueryUsage) add(s *storepb.Series) error {
+	n, err := seriesSamples(s)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&u.samples, int64(n))
+	return nil
+}
+
+type queryUsageKey struct{}
+
+// WithQueryUsage returns a context counting the samples fetched by the queriers created with it into u.
+func WithQueryUsage(ctx context.Context, u *QueryUsage) context.Context {
+	return context.WithValue(ctx, queryUsageKey{}, u)
+}
+
+func queryUsageFromContext(ctx context.Context) *QueryUsage {
+	u, _ := ctx.Value(queryUsageKey{}).(*QueryUsage)
+	return u
+}
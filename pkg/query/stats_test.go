@@ -0,0 +1,124 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/prometheus/prometheus/pkg/gate"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQuerier_Select_QueryStats(t *testing.T) {
+	hints, err := types.MarshalAny(&hintspb.SeriesResponseHints{StoresQueryStats: []hintspb.StoreQueryStats{
+		{
+			Store:          "store-gateway",
+			SeriesReceived: 2,
+			ChunksReceived: 4,
+			Duration:       2 * time.Second,
+			QueryStats: &hintspb.QueryStats{
+				BlocksQueried:         3,
+				DataDownloadedSizeSum: 1024,
+				GetAllDuration:        time.Second,
+				MergeDuration:         500 * time.Millisecond,
+			},
+		},
+		{Store: "sidecar", SeriesReceived: 1, ChunksReceived: 1, Duration: time.Second},
+	}})
+	testutil.Ok(t, err)
+	storeAPI := &storeServer{resps: []*storepb.SeriesResponse{
+		storeSeriesResponse(t, labels.FromStrings("a", "1"), []sample{{0, 0}, {1, 1}}),
+		storepb.NewHintsSeriesResponse(hints),
+	}}
+
+	qs := NewQueryStats()
+	q := newQuerier(WithQueryStats(context.Background(), qs), nil, 0, 10, nil, nil, storeAPI, false, DedupFuncPenalty, 0, true, false, gate.New(2), time.Minute, spillOpts{})
+	for i := 0; i < 2; i++ {
+		set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "a", "1"))
+		for set.Next() {
+		}
+		testutil.Ok(t, set.Err())
+	}
+	testutil.Ok(t, q.Close())
+
+	testutil.Equals(t, StoresStats{
+		StoresQueried:   2,
+		BlocksQueried:   6,
+		SeriesFetched:   6,
+		ChunksFetched:   10,
+		BytesDownloaded: 2048,
+		Stores: []StoreStats{
+			{Store: "sidecar", Selects: 2, SeriesFetched: 2, ChunksFetched: 2, SelectTime: 2},
+			{Store: "store-gateway", Selects: 2, SeriesFetched: 4, ChunksFetched: 8, BlocksQueried: 6, BytesDownloaded: 2048, SelectTime: 4, FetchTime: 2, MergeTime: 1},
+		},
+		Timeline: []SourceRange{
+			{MinTime: 0, MaxTime: 11, Sources: []Source{{Store: "sidecar"}, {Store: "store-gateway"}}},
+		},
+	}, qs.Stores())
+
+	// Without query stats, the response hints are ignored.
+	q = newQuerier(context.Background(), nil, 0, 10, nil, nil, storeAPI, false, DedupFuncPenalty, 0, true, false, gate.New(2), time.Minute, spillOpts{})
+	set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "a", "1"))
+	for set.Next() {
+	}
+	testutil.Ok(t, set.Err())
+	testutil.Ok(t, q.Close())
+}
+
+func TestQueryStats_Timeline(t *testing.T) {
+	qs := NewQueryStats()
+	qs.add(0, 999, []hintspb.StoreQueryStats{
+		{Store: "sidecar", MinTime: 700, MaxTime: math.MaxInt64},
+		{Store: "store-gateway", MinTime: 0, MaxTime: 800, QueriedBlocks: []hintspb.Block{
+			{Id: "raw", MinTime: 400, MaxTime: 800},
+			{Id: "5m", MinTime: 0, MaxTime: 400, Resolution: 300000},
+		}},
+	})
+	// A select of a smaller time range, e.g. of a subquery, doesn't add new sources.
+	qs.add(600, 799, []hintspb.StoreQueryStats{
+		{Store: "sidecar", MinTime: 700, MaxTime: math.MaxInt64},
+		{Store: "store-gateway", MinTime: 0, MaxTime: 800, QueriedBlocks: []hintspb.Block{{Id: "raw", MinTime: 400, MaxTime: 800}}},
+	})
+
+	stats := qs.Stores()
+	testutil.Equals(t, []StoreStats{
+		{Store: "sidecar", Selects: 2, MinTime: 700, MaxTime: math.MaxInt64},
+		{Store: "store-gateway", Selects: 2, MinTime: 0, MaxTime: 800, Blocks: []BlockStats{
+			{ID: "raw", MinTime: 400, MaxTime: 800},
+			{ID: "5m", MinTime: 0, MaxTime: 400, Resolution: 300000},
+		}},
+	}, stats.Stores)
+	testutil.Equals(t, []SourceRange{
+		{MinTime: 0, MaxTime: 400, Sources: []Source{{Store: "store-gateway", Block: "5m", Resolution: 300000}}},
+		{MinTime: 400, MaxTime: 700, Sources: []Source{{Store: "store-gateway", Block: "raw"}}},
+		{MinTime: 700, MaxTime: 800, Sources: []Source{{Store: "sidecar"}, {Store: "store-gateway", Block: "raw"}}},
+		{MinTime: 800, MaxTime: 1000, Sources: []Source{{Store: "sidecar"}}},
+	}, stats.Timeline)
+}
+
+func TestQuerier_Select_QueryUsage(t *testing.T) {
+	storeAPI := &storeServer{resps: []*storepb.SeriesResponse{
+		storeSeriesResponse(t, labels.FromStrings("a", "1"), []sample{{0, 0}, {1, 1}}, []sample{{2, 2}}),
+		storeSeriesResponse(t, labels.FromStrings("a", "1", "b", "2"), []sample{{0, 0}, {1, 1}, {2, 2}}),
+	}}
+
+	usage := &QueryUsage{}
+	q := newQuerier(WithQueryUsage(context.Background(), usage), nil, 0, 10, nil, nil, storeAPI, false, DedupFuncPenalty, 0, true, false, gate.New(2), time.Minute, spillOpts{})
+	for i := 0; i < 2; i++ {
+		set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "a", "1"))
+		for set.Next() {
+		}
+		testutil.Ok(t, set.Err())
+	}
+	testutil.Ok(t, q.Close())
+	testutil.Equals(t, int64(12), usage.Samples())
+}
@@ -18,30 +18,41 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 )
 
 const (
 	unhealthyStoreMessage = "removing store because it's unhealthy or does not exist"
+
+	// storeCheckHistorySize is the number of health checks kept in the status of a store.
+	storeCheckHistorySize = 30
 )
 
 type StoreSpec interface {
 	// Addr returns StoreAPI Address for the store spec. It is used as ID for store.
 	Addr() string
-	// Metadata returns current labels, store type and min, max ranges for store.
+	// Metadata returns current labels, store type and min, max ranges for store, and whether the labels are stale, i.e.
+	// the store could not refresh them recently and returned cached ones.
 	// It can change for every call for this method.
 	// If metadata call fails we assume that store is no longer accessible and we should not use it.
 	// NOTE: It is implementation responsibility to retry until context timeout, but a caller responsibility to manage
 	// given store connection.
-	Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []labels.Labels, mint int64, maxt int64, storeType component.StoreAPI, err error)
+	Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []labels.Labels, mint int64, maxt int64, storeType component.StoreAPI, labelsStale, labelMatchers bool, err error)
 
 	// StrictStatic returns true if the StoreAPI has been statically defined and it is under a strict mode.
 	StrictStatic() bool
+
+	// DialOpts returns the gRPC dial options of the StoreAPI, e.g. with its own TLS settings, or nil if the ones of the
+	// store set are used.
+	DialOpts() []grpc.DialOption
 }
 
 type RuleSpec interface {
@@ -49,6 +60,16 @@ type RuleSpec interface {
 	Addr() string
 }
 
+type TargetSpec interface {
+	// Addr returns TargetsAPI Address for the targets spec. It is used as its ID.
+	Addr() string
+}
+
+type MetadataSpec interface {
+	// Addr returns MetadataAPI Address for the metadata spec. It is used as its ID.
+	Addr() string
+}
+
 // stringError forces the error to be a string
 // when marshaled into a JSON.
 type stringError struct {
@@ -73,11 +94,29 @@ type StoreStatus struct {
 	StoreType component.StoreAPI `json:"-"`
 	MinTime   int64              `json:"minTime"`
 	MaxTime   int64              `json:"maxTime"`
+	// LabelsStale is true if the store could not refresh its external labels recently, e.g. a sidecar which could not
+	// reach its Prometheus, so that LabelSets might not be up to date.
+	LabelsStale bool `json:"labelsStale"`
+	// Dynamic is true if the store was added at runtime.
+	Dynamic bool `json:"dynamic"`
+	// Drained is true if no queries are sent to the store.
+	Drained bool `json:"drained"`
+	// History are the last health checks of the store, from the oldest to the newest.
+	History []StoreCheck `json:"history"`
+}
+
+// StoreCheck is the result of a health check of a store.
+type StoreCheck struct {
+	Time time.Time `json:"time"`
+	// Duration is the duration of the check, in seconds.
+	Duration float64      `json:"duration"`
+	Error    *stringError `json:"error"`
 }
 
 type grpcStoreSpec struct {
 	addr         string
 	strictstatic bool
+	dialOpts     []grpc.DialOption
 }
 
 // NewGRPCStoreSpec creates store pure gRPC spec.
@@ -86,11 +125,22 @@ func NewGRPCStoreSpec(addr string, strictstatic bool) StoreSpec {
 	return &grpcStoreSpec{addr: addr, strictstatic: strictstatic}
 }
 
+// NewGRPCStoreSpecWithDialOpts creates store pure gRPC spec, dialed with the given options instead of the ones of the
+// store set.
+func NewGRPCStoreSpecWithDialOpts(addr string, strictstatic bool, dialOpts []grpc.DialOption) StoreSpec {
+	return &grpcStoreSpec{addr: addr, strictstatic: strictstatic, dialOpts: dialOpts}
+}
+
 // StrictStatic returns true if the StoreAPI has been statically defined and it is under a strict mode.
 func (s *grpcStoreSpec) StrictStatic() bool {
 	return s.strictstatic
 }
 
+// DialOpts returns the gRPC dial options of the StoreAPI, or nil if the ones of the store set are used.
+func (s *grpcStoreSpec) DialOpts() []grpc.DialOption {
+	return s.dialOpts
+}
+
 func (s *grpcStoreSpec) Addr() string {
 	// API addr should not change between state changes.
 	return s.addr
@@ -98,10 +148,12 @@ func (s *grpcStoreSpec) Addr() string {
 
 // Metadata method for gRPC store API tries to reach host Info method until context timeout. If we are unable to get metadata after
 // that time, we assume that the host is unhealthy and return error.
-func (s *grpcStoreSpec) Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []labels.Labels, mint int64, maxt int64, Type component.StoreAPI, err error) {
-	resp, err := client.Info(ctx, &storepb.InfoRequest{}, grpc.WaitForReady(true))
+// The labels are stale if the response has the store.ExternalLabelsStaleHeader header.
+func (s *grpcStoreSpec) Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []labels.Labels, mint int64, maxt int64, Type component.StoreAPI, labelsStale, labelMatchers bool, err error) {
+	var md metadata.MD
+	resp, err := client.Info(ctx, &storepb.InfoRequest{}, grpc.WaitForReady(true), grpc.Header(&md))
 	if err != nil {
-		return nil, 0, 0, nil, errors.Wrapf(err, "fetching store info from %s", s.addr)
+		return nil, 0, 0, nil, false, false, errors.Wrapf(err, "fetching store info from %s", s.addr)
 	}
 	if len(resp.LabelSets) == 0 && len(resp.Labels) > 0 {
 		resp.LabelSets = []labelpb.ZLabelSet{{Labels: resp.Labels}}
@@ -111,7 +163,12 @@ func (s *grpcStoreSpec) Metadata(ctx context.Context, client storepb.StoreClient
 	for _, ls := range resp.LabelSets {
 		labelSets = append(labelSets, ls.PromLabels())
 	}
-	return labelSets, resp.MinTime, resp.MaxTime, component.FromProto(resp.StoreType), nil
+	for _, v := range md.Get(store.ExternalLabelsStaleHeader) {
+		if v == "true" {
+			labelsStale = true
+		}
+	}
+	return labelSets, resp.MinTime, resp.MaxTime, component.FromProto(resp.StoreType), labelsStale, resp.LabelMatchers, nil
 }
 
 // storeSetNodeCollector is a metric collector reporting the number of available storeAPIs for Querier.
@@ -181,6 +238,8 @@ type StoreSet struct {
 	// accessible and we close gRPC client for it.
 	storeSpecs          func() []StoreSpec
 	ruleSpecs           func() []RuleSpec
+	targetSpecs         func() []TargetSpec
+	metadataSpecs       func() []MetadataSpec
 	dialOpts            []grpc.DialOption
 	gRPCInfoCallTimeout time.Duration
 
@@ -191,24 +250,37 @@ type StoreSet struct {
 	// Main map of stores currently used for fanout.
 	stores       map[string]*storeRef
 	storesMetric *storeSetNodeCollector
+	// staleLabelsStores is the number of active stores with stale external labels.
+	staleLabelsStores prometheus.Gauge
 
 	// Map of statuses used only by UI.
 	storeStatuses         map[string]*StoreStatus
 	unhealthyStoreTimeout time.Duration
+
+	// Addresses of the stores added at runtime, and of the stores no queries are sent to.
+	endpointsMtx  sync.RWMutex
+	dynamicStores map[string]struct{}
+	drainedStores map[string]struct{}
 }
 
-// NewStoreSet returns a new set of store APIs and potentially Rules APIs from given specs.
+// NewStoreSet returns a new set of store APIs and potentially Rules, Targets and Metadata APIs from given specs.
 func NewStoreSet(
 	logger log.Logger,
 	reg *prometheus.Registry,
 	storeSpecs func() []StoreSpec,
 	ruleSpecs func() []RuleSpec,
+	targetSpecs func() []TargetSpec,
+	metadataSpecs func() []MetadataSpec,
 	dialOpts []grpc.DialOption,
 	unhealthyStoreTimeout time.Duration,
 ) *StoreSet {
 	storesMetric := newStoreSetNodeCollector()
+	staleLabelsStores := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_store_nodes_stale_external_labels",
+		Help: "Number of Store APIs whose external labels are stale, as they could not be refreshed recently by the store.",
+	})
 	if reg != nil {
-		reg.MustRegister(storesMetric)
+		reg.MustRegister(storesMetric, staleLabelsStores)
 	}
 
 	if logger == nil {
@@ -220,22 +292,119 @@ func NewStoreSet(
 	if ruleSpecs == nil {
 		ruleSpecs = func() []RuleSpec { return nil }
 	}
+	if targetSpecs == nil {
+		targetSpecs = func() []TargetSpec { return nil }
+	}
+	if metadataSpecs == nil {
+		metadataSpecs = func() []MetadataSpec { return nil }
+	}
 
 	ss := &StoreSet{
 		logger:                log.With(logger, "component", "storeset"),
 		storeSpecs:            storeSpecs,
 		ruleSpecs:             ruleSpecs,
+		targetSpecs:           targetSpecs,
+		metadataSpecs:         metadataSpecs,
 		dialOpts:              dialOpts,
 		storesMetric:          storesMetric,
+		staleLabelsStores:     staleLabelsStores,
 		gRPCInfoCallTimeout:   5 * time.Second,
 		stores:                make(map[string]*storeRef),
 		storeStatuses:         make(map[string]*StoreStatus),
 		unhealthyStoreTimeout: unhealthyStoreTimeout,
+		dynamicStores:         make(map[string]struct{}),
+		drainedStores:         make(map[string]struct{}),
 	}
 	return ss
 }
 
-// TODO(bwplotka): Consider moving storeRef out of this package and renaming it, as it also supports rules API.
+// AddStore adds the StoreAPI with the given address to the store set at runtime. It is connected to on the next
+// Update() call.
+func (s *StoreSet) AddStore(addr string) error {
+	if addr == "" {
+		return errors.New("store address cannot be empty")
+	}
+	for _, spec := range s.storeSpecs() {
+		if spec.Addr() == addr {
+			return errors.Errorf("store %s is already defined", addr)
+		}
+	}
+
+	s.endpointsMtx.Lock()
+	defer s.endpointsMtx.Unlock()
+
+	if _, ok := s.dynamicStores[addr]; ok {
+		return errors.Errorf("store %s is already added", addr)
+	}
+	s.dynamicStores[addr] = struct{}{}
+	return nil
+}
+
+// RemoveStore removes the StoreAPI with the given address, added at runtime, from the store set. Its connection is
+// closed on the next Update() call.
+func (s *StoreSet) RemoveStore(addr string) error {
+	s.endpointsMtx.Lock()
+	defer s.endpointsMtx.Unlock()
+
+	if _, ok := s.dynamicStores[addr]; !ok {
+		return errors.Errorf("store %s was not added at runtime", addr)
+	}
+	delete(s.dynamicStores, addr)
+	delete(s.drainedStores, addr)
+	return nil
+}
+
+// DrainStore stops sending queries to the active StoreAPI with the given address, e.g. before its maintenance, or
+// resumes sending them if drain is false. A drained store is still health checked.
+func (s *StoreSet) DrainStore(addr string, drain bool) error {
+	s.storesMtx.RLock()
+	_, ok := s.stores[addr]
+	s.storesMtx.RUnlock()
+
+	s.endpointsMtx.Lock()
+	defer s.endpointsMtx.Unlock()
+
+	if !drain {
+		if _, drained := s.drainedStores[addr]; !drained {
+			return errors.Errorf("store %s is not drained", addr)
+		}
+		delete(s.drainedStores, addr)
+		return nil
+	}
+	if !ok {
+		return errors.Errorf("store %s is not active", addr)
+	}
+	s.drainedStores[addr] = struct{}{}
+	return nil
+}
+
+func (s *StoreSet) isDrained(addr string) bool {
+	s.endpointsMtx.RLock()
+	defer s.endpointsMtx.RUnlock()
+
+	_, ok := s.drainedStores[addr]
+	return ok
+}
+
+// allStoreSpecs returns the store specs, including the ones of the stores added at runtime.
+func (s *StoreSet) allStoreSpecs() []StoreSpec {
+	specs := s.storeSpecs()
+
+	s.endpointsMtx.RLock()
+	defer s.endpointsMtx.RUnlock()
+
+	addrs := make([]string, 0, len(s.dynamicStores))
+	for addr := range s.dynamicStores {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		specs = append(specs, NewGRPCStoreSpec(addr, false))
+	}
+	return specs
+}
+
+// TODO(bwplotka): Consider moving storeRef out of this package and renaming it, as it also supports rules, targets and metadata API.
 type storeRef struct {
 	storepb.StoreClient
 
@@ -244,25 +413,37 @@ type storeRef struct {
 	addr string
 	// If rule is not nil, then this store also supports rules API.
 	rule rulespb.RulesClient
+	// If target is not nil, then this store also supports targets API.
+	target targetspb.TargetsClient
+	// If metadata is not nil, then this store also supports metadata API.
+	metadata metadatapb.MetadataClient
 
 	// Meta (can change during runtime).
 	labelSets []labels.Labels
 	storeType component.StoreAPI
 	minTime   int64
 	maxTime   int64
+	// labelsStale is true if the store could not refresh labelSets recently.
+	labelsStale bool
+	// labelMatchers is true if the store restricts the label names and values to the ones of the matching series.
+	labelMatchers bool
 
 	logger log.Logger
 }
 
-func (s *storeRef) Update(labelSets []labels.Labels, minTime int64, maxTime int64, storeType component.StoreAPI, rule rulespb.RulesClient) {
+func (s *storeRef) Update(labelSets []labels.Labels, labelsStale, labelMatchers bool, minTime int64, maxTime int64, storeType component.StoreAPI, rule rulespb.RulesClient, target targetspb.TargetsClient, metadata metadatapb.MetadataClient) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
 	s.storeType = storeType
 	s.labelSets = labelSets
+	s.labelsStale = labelsStale
+	s.labelMatchers = labelMatchers
 	s.minTime = minTime
 	s.maxTime = maxTime
 	s.rule = rule
+	s.target = target
+	s.metadata = metadata
 }
 
 func (s *storeRef) StoreType() component.StoreAPI {
@@ -279,6 +460,37 @@ func (s *storeRef) HasRulesAPI() bool {
 	return s.rule != nil
 }
 
+func (s *storeRef) HasTargetsAPI() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.target != nil
+}
+
+func (s *storeRef) HasMetadataAPI() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.metadata != nil
+}
+
+// LabelsStale returns true if the store could not refresh its external labels recently.
+func (s *storeRef) LabelsStale() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.labelsStale
+}
+
+// LabelMatchers returns true if the store restricts the label names and values to the ones of the series matching the
+// matchers of the requests.
+func (s *storeRef) LabelMatchers() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.labelMatchers
+}
+
 func (s *storeRef) LabelSets() []labels.Labels {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
@@ -344,11 +556,15 @@ func (s *StoreSet) Update(ctx context.Context) {
 	level.Debug(s.logger).Log("msg", "checked requested storeAPIs", "activeStores", len(activeStores), "cachedStores", len(stores))
 
 	stats := newStoreAPIStats()
+	staleLabelsStores := 0
 
 	// Close stores that where not active this time (are not in active stores map).
 	for addr, st := range stores {
 		if _, ok := activeStores[addr]; ok {
 			stats[st.StoreType()][labelpb.PromLabelSetsToString(st.LabelSets())]++
+			if st.LabelsStale() {
+				staleLabelsStores++
+			}
 			continue
 		}
 
@@ -376,6 +592,9 @@ func (s *StoreSet) Update(ctx context.Context) {
 				"address", addr, "extLset", extLset, "duplicates", fmt.Sprintf("%v", stats[component.Sidecar][extLset]+stats[component.Rule][extLset]+1))
 		}
 		stats[st.StoreType()][extLset]++
+		if st.LabelsStale() {
+			staleLabelsStores++
+		}
 
 		stores[addr] = st
 		s.updateStoreStatus(st, nil)
@@ -384,10 +603,19 @@ func (s *StoreSet) Update(ctx context.Context) {
 			level.Info(s.logger).Log("msg", "adding new rulesAPI to query storeset", "address", addr)
 		}
 
+		if st.HasTargetsAPI() {
+			level.Info(s.logger).Log("msg", "adding new targetsAPI to query storeset", "address", addr)
+		}
+
+		if st.HasMetadataAPI() {
+			level.Info(s.logger).Log("msg", "adding new metadataAPI to query storeset", "address", addr)
+		}
+
 		level.Info(s.logger).Log("msg", "adding new storeAPI to query storeset", "address", addr, "extLset", extLset)
 	}
 
 	s.storesMetric.Update(stats)
+	s.staleLabelsStores.Set(float64(staleLabelsStores))
 	s.storesMtx.Lock()
 	s.stores = stores
 	s.storesMtx.Unlock()
@@ -402,17 +630,25 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 		mtx          sync.Mutex
 		wg           sync.WaitGroup
 
-		storeAddrSet = make(map[string]struct{})
-		ruleAddrSet  = make(map[string]struct{})
+		storeAddrSet    = make(map[string]struct{})
+		ruleAddrSet     = make(map[string]struct{})
+		targetAddrSet   = make(map[string]struct{})
+		metadataAddrSet = make(map[string]struct{})
 	)
 
 	// Gather active stores map concurrently. Build new store if does not exist already.
 	for _, ruleSpec := range s.ruleSpecs() {
 		ruleAddrSet[ruleSpec.Addr()] = struct{}{}
 	}
+	for _, targetSpec := range s.targetSpecs() {
+		targetAddrSet[targetSpec.Addr()] = struct{}{}
+	}
+	for _, metadataSpec := range s.metadataSpecs() {
+		metadataAddrSet[metadataSpec.Addr()] = struct{}{}
+	}
 
 	// Gather healthy stores map concurrently. Build new store if does not exist already.
-	for _, storeSpec := range s.storeSpecs() {
+	for _, storeSpec := range s.allStoreSpecs() {
 		if _, ok := storeAddrSet[storeSpec.Addr()]; ok {
 			level.Warn(s.logger).Log("msg", "duplicated address in store nodes", "address", storeSpec.Addr())
 			continue
@@ -428,12 +664,18 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 			ctx, cancel := context.WithTimeout(ctx, s.gRPCInfoCallTimeout)
 			defer cancel()
 
+			start := time.Now()
 			st, seenAlready := stores[addr]
 			if !seenAlready {
 				// New store or was unactive and was removed in the past - create new one.
-				conn, err := grpc.DialContext(ctx, addr, s.dialOpts...)
+				dialOpts := s.dialOpts
+				if opts := spec.DialOpts(); opts != nil {
+					dialOpts = opts
+				}
+				conn, err := grpc.DialContext(ctx, addr, dialOpts...)
 				if err != nil {
 					s.updateStoreStatus(&storeRef{addr: addr}, err)
+					s.recordStoreCheck(addr, start, err)
 					level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "dialing connection"), "address", addr)
 					return
 				}
@@ -446,8 +688,18 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 				rule = rulespb.NewRulesClient(st.cc)
 			}
 
+			var target targetspb.TargetsClient
+			if _, ok := targetAddrSet[addr]; ok {
+				target = targetspb.NewTargetsClient(st.cc)
+			}
+
+			var metadata metadatapb.MetadataClient
+			if _, ok := metadataAddrSet[addr]; ok {
+				metadata = metadatapb.NewMetadataClient(st.cc)
+			}
+
 			// Check existing or new store. Is it healthy? What are current metadata?
-			labelSets, minTime, maxTime, storeType, err := spec.Metadata(ctx, st.StoreClient)
+			labelSets, minTime, maxTime, storeType, labelsStale, labelMatchers, err := spec.Metadata(ctx, st.StoreClient)
 			if err != nil {
 				if !seenAlready && !spec.StrictStatic() {
 					// Close only if new and not a strict static node.
@@ -455,6 +707,7 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 					st.Close()
 				}
 				s.updateStoreStatus(st, err)
+				s.recordStoreCheck(addr, start, err)
 				level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "getting metadata"), "address", addr)
 
 				if !spec.StrictStatic() {
@@ -469,8 +722,14 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 				return
 			}
 
+			if labelsStale && !st.LabelsStale() {
+				level.Warn(s.logger).Log("msg", "external labels of store are stale, the store could not refresh them recently", "address", addr, "extLset", labelpb.PromLabelSetsToString(labelSets))
+			} else if !labelsStale && st.LabelsStale() {
+				level.Info(s.logger).Log("msg", "external labels of store are no longer stale", "address", addr, "extLset", labelpb.PromLabelSetsToString(labelSets))
+			}
+			st.Update(labelSets, labelsStale, labelMatchers, minTime, maxTime, storeType, rule, target, metadata)
 			s.updateStoreStatus(st, nil)
-			st.Update(labelSets, minTime, maxTime, storeType, rule)
+			s.recordStoreCheck(addr, start, nil)
 
 			mtx.Lock()
 			defer mtx.Unlock()
@@ -485,6 +744,16 @@ func (s *StoreSet) getActiveStores(ctx context.Context, stores map[string]*store
 			level.Warn(s.logger).Log("msg", "ignored rule store", "address", ruleAddr)
 		}
 	}
+	for targetAddr := range targetAddrSet {
+		if _, ok := storeAddrSet[targetAddr]; !ok {
+			level.Warn(s.logger).Log("msg", "ignored target store", "address", targetAddr)
+		}
+	}
+	for metadataAddr := range metadataAddrSet {
+		if _, ok := storeAddrSet[metadataAddr]; !ok {
+			level.Warn(s.logger).Log("msg", "ignored metadata store", "address", metadataAddr)
+		}
+	}
 	return activeStores
 }
 
@@ -505,6 +774,7 @@ func (s *StoreSet) updateStoreStatus(store *storeRef, err error) {
 		status.StoreType = store.StoreType()
 		status.MinTime = mint
 		status.MaxTime = maxt
+		status.LabelsStale = store.LabelsStale()
 		status.LastError = nil
 	} else {
 		status.LastError = &stringError{originalErr: err}
@@ -513,13 +783,39 @@ func (s *StoreSet) updateStoreStatus(store *storeRef, err error) {
 	s.storeStatuses[store.addr] = &status
 }
 
+// recordStoreCheck adds the result of a health check of the store started at the given time to its status.
+func (s *StoreSet) recordStoreCheck(addr string, start time.Time, err error) {
+	s.storesStatusesMtx.Lock()
+	defer s.storesStatusesMtx.Unlock()
+
+	status, ok := s.storeStatuses[addr]
+	if !ok {
+		return
+	}
+	check := StoreCheck{Time: start, Duration: time.Since(start).Seconds()}
+	if err != nil {
+		check.Error = &stringError{originalErr: err}
+	}
+	status.History = append(status.History, check)
+	if len(status.History) > storeCheckHistorySize {
+		status.History = status.History[len(status.History)-storeCheckHistorySize:]
+	}
+}
+
 func (s *StoreSet) GetStoreStatus() []StoreStatus {
 	s.storesStatusesMtx.RLock()
 	defer s.storesStatusesMtx.RUnlock()
 
+	s.endpointsMtx.RLock()
+	defer s.endpointsMtx.RUnlock()
+
 	statuses := make([]StoreStatus, 0, len(s.storeStatuses))
 	for _, v := range s.storeStatuses {
-		statuses = append(statuses, *v)
+		status := *v
+		status.History = append([]StoreCheck(nil), v.History...)
+		_, status.Dynamic = s.dynamicStores[status.Name]
+		_, status.Drained = s.drainedStores[status.Name]
+		statuses = append(statuses, status)
 	}
 
 	sort.Slice(statuses, func(i, j int) bool {
@@ -528,32 +824,63 @@ func (s *StoreSet) GetStoreStatus() []StoreStatus {
 	return statuses
 }
 
-// Get returns a list of all active stores.
+// Get returns a list of all active stores, except the drained ones.
 func (s *StoreSet) Get() []store.Client {
 	s.storesMtx.RLock()
 	defer s.storesMtx.RUnlock()
 
 	stores := make([]store.Client, 0, len(s.stores))
 	for _, st := range s.stores {
+		if s.isDrained(st.addr) {
+			continue
+		}
 		stores = append(stores, st)
 	}
 	return stores
 }
 
-// GetRulesClients returns a list of all active rules clients.
+// GetRulesClients returns a list of all active rules clients, except the ones of drained stores.
 func (s *StoreSet) GetRulesClients() []rulespb.RulesClient {
 	s.storesMtx.RLock()
 	defer s.storesMtx.RUnlock()
 
 	rules := make([]rulespb.RulesClient, 0, len(s.stores))
 	for _, st := range s.stores {
-		if st.HasRulesAPI() {
+		if st.HasRulesAPI() && !s.isDrained(st.addr) {
 			rules = append(rules, st.rule)
 		}
 	}
 	return rules
 }
 
+// GetTargetsClients returns a list of all active targets clients, except the ones of drained stores.
+func (s *StoreSet) GetTargetsClients() []targetspb.TargetsClient {
+	s.storesMtx.RLock()
+	defer s.storesMtx.RUnlock()
+
+	targets := make([]targetspb.TargetsClient, 0, len(s.stores))
+	for _, st := range s.stores {
+		if st.HasTargetsAPI() && !s.isDrained(st.addr) {
+			targets = append(targets, st.target)
+		}
+	}
+	return targets
+}
+
+// GetMetadataClients returns a list of all active metadata clients, except the ones of drained stores.
+func (s *StoreSet) GetMetadataClients() []metadatapb.MetadataClient {
+	s.storesMtx.RLock()
+	defer s.storesMtx.RUnlock()
+
+	metadata := make([]metadatapb.MetadataClient, 0, len(s.stores))
+	for _, st := range s.stores {
+		if st.HasMetadataAPI() && !s.isDrained(st.addr) {
+			metadata = append(metadata, st.metadata)
+		}
+	}
+	return metadata
+}
+
 func (s *StoreSet) Close() {
 	s.storesMtx.Lock()
 	defer s.storesMtx.Unlock()
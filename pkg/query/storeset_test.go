@@ -13,8 +13,11 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/component"
@@ -30,14 +33,20 @@ var testGRPCOpts = []grpc.DialOption{
 }
 
 type testStore struct {
-	infoDelay time.Duration
-	info      storepb.InfoResponse
+	infoDelay   time.Duration
+	labelsStale bool
+	info        storepb.InfoResponse
 }
 
 func (s *testStore) Info(ctx context.Context, r *storepb.InfoRequest) (*storepb.InfoResponse, error) {
 	if s.infoDelay > 0 {
 		time.Sleep(s.infoDelay)
 	}
+	if s.labelsStale {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(store.ExternalLabelsStaleHeader, "true")); err != nil {
+			return nil, err
+		}
+	}
 	return &s.info, nil
 }
 
@@ -62,6 +71,8 @@ type testStoreMeta struct {
 	storeType        component.StoreAPI
 	minTime, maxTime int64
 	infoDelay        time.Duration
+	labelsStale      bool
+	labelMatchers    bool
 }
 
 type testStores struct {
@@ -86,11 +97,13 @@ func startTestStores(storeMetas []testStoreMeta) (*testStores, error) {
 
 		storeSrv := &testStore{
 			info: storepb.InfoResponse{
-				LabelSets: meta.extlsetFn(listener.Addr().String()),
-				MaxTime:   meta.maxTime,
-				MinTime:   meta.minTime,
+				LabelSets:     meta.extlsetFn(listener.Addr().String()),
+				MaxTime:       meta.maxTime,
+				MinTime:       meta.minTime,
+				LabelMatchers: meta.labelMatchers,
 			},
-			infoDelay: meta.infoDelay,
+			infoDelay:   meta.infoDelay,
+			labelsStale: meta.labelsStale,
 		}
 		if meta.storeType != nil {
 			storeSrv.info.StoreType = meta.storeType.ToProto()
@@ -196,6 +209,8 @@ func TestStoreSet_Update(t *testing.T) {
 		func() (specs []RuleSpec) {
 			return nil
 		},
+		nil,
+		nil,
 		testGRPCOpts, time.Minute)
 	storeSet.gRPCInfoCallTimeout = 2 * time.Second
 	defer storeSet.Close()
@@ -545,6 +560,8 @@ func TestStoreSet_Update_NoneAvailable(t *testing.T) {
 			return specs
 		},
 		func() (specs []RuleSpec) { return nil },
+		nil,
+		nil,
 		testGRPCOpts, time.Minute)
 	storeSet.gRPCInfoCallTimeout = 2 * time.Second
 
@@ -629,7 +646,7 @@ func TestQuerierStrict(t *testing.T) {
 		}
 	}, func() []RuleSpec {
 		return nil
-	}, testGRPCOpts, time.Minute)
+	}, nil, nil, testGRPCOpts, time.Minute)
 	defer storeSet.Close()
 	storeSet.gRPCInfoCallTimeout = 1 * time.Second
 
@@ -679,11 +696,15 @@ func TestStoreSet_Update_Rules(t *testing.T) {
 	defer stores.Close()
 
 	for _, tc := range []struct {
-		name           string
-		storeSpecs     func() []StoreSpec
-		ruleSpecs      func() []RuleSpec
-		expectedStores int
-		expectedRules  int
+		name             string
+		storeSpecs       func() []StoreSpec
+		ruleSpecs        func() []RuleSpec
+		targetSpecs      func() []TargetSpec
+		metadataSpecs    func() []MetadataSpec
+		expectedStores   int
+		expectedRules    int
+		expectedTargets  int
+		expectedMetadata int
 	}{
 		{
 			name: "stores, no rules",
@@ -754,10 +775,67 @@ func TestStoreSet_Update_Rules(t *testing.T) {
 			expectedStores: 2,
 			expectedRules:  2,
 		},
+		{
+			name: "two stores, one rule, one different target",
+			storeSpecs: func() []StoreSpec {
+				return []StoreSpec{
+					NewGRPCStoreSpec(stores.orderAddrs[0], false),
+					NewGRPCStoreSpec(stores.orderAddrs[1], false),
+				}
+			},
+			ruleSpecs: func() []RuleSpec {
+				return []RuleSpec{
+					NewGRPCStoreSpec(stores.orderAddrs[0], false),
+				}
+			},
+			targetSpecs: func() []TargetSpec {
+				return []TargetSpec{
+					NewGRPCStoreSpec(stores.orderAddrs[1], false),
+				}
+			},
+			expectedStores:  2,
+			expectedRules:   1,
+			expectedTargets: 1,
+		},
+		{
+			name: "two stores, one target, two metadata",
+			storeSpecs: func() []StoreSpec {
+				return []StoreSpec{
+					NewGRPCStoreSpec(stores.orderAddrs[0], false),
+					NewGRPCStoreSpec(stores.orderAddrs[1], false),
+				}
+			},
+			targetSpecs: func() []TargetSpec {
+				return []TargetSpec{
+					NewGRPCStoreSpec(stores.orderAddrs[0], false),
+				}
+			},
+			metadataSpecs: func() []MetadataSpec {
+				return []MetadataSpec{
+					NewGRPCStoreSpec(stores.orderAddrs[0], false),
+					NewGRPCStoreSpec(stores.orderAddrs[1], false),
+				}
+			},
+			expectedStores:   2,
+			expectedTargets:  1,
+			expectedMetadata: 2,
+		},
+		{
+			name: "targets, no stores",
+			targetSpecs: func() []TargetSpec {
+				return []TargetSpec{
+					NewGRPCStoreSpec(stores.orderAddrs[0], false),
+				}
+			},
+			expectedStores:  0,
+			expectedTargets: 0,
+		},
 	} {
 		storeSet := NewStoreSet(nil, nil,
 			tc.storeSpecs,
 			tc.ruleSpecs,
+			tc.targetSpecs,
+			tc.metadataSpecs,
 			testGRPCOpts, time.Minute)
 
 		t.Run(tc.name, func(t *testing.T) {
@@ -766,13 +844,25 @@ func TestStoreSet_Update_Rules(t *testing.T) {
 			testutil.Equals(t, tc.expectedStores, len(storeSet.stores))
 
 			gotRules := 0
+			gotTargets := 0
+			gotMetadata := 0
 			for _, ref := range storeSet.stores {
 				if ref.HasRulesAPI() {
 					gotRules += 1
 				}
+				if ref.HasTargetsAPI() {
+					gotTargets += 1
+				}
+				if ref.HasMetadataAPI() {
+					gotMetadata += 1
+				}
 			}
 
 			testutil.Equals(t, tc.expectedRules, gotRules)
+			testutil.Equals(t, tc.expectedTargets, gotTargets)
+			testutil.Equals(t, tc.expectedTargets, len(storeSet.GetTargetsClients()))
+			testutil.Equals(t, tc.expectedMetadata, gotMetadata)
+			testutil.Equals(t, tc.expectedMetadata, len(storeSet.GetMetadataClients()))
 		})
 	}
 }
@@ -930,6 +1020,8 @@ func TestStoreSet_Rules_Discovery(t *testing.T) {
 
 					return tc.states[currentState].ruleSpecs()
 				},
+				nil,
+				nil,
 				testGRPCOpts, time.Minute)
 
 			defer storeSet.Close()
@@ -1044,3 +1136,225 @@ func TestUpdateStoreStateForgetsPreviousErrors(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, `null`, string(b))
 }
+
+func TestStoreSet_DynamicAndDrainedStores(t *testing.T) {
+	st, err := startTestStores([]testStoreMeta{
+		{
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "addr", Value: addr}}}}
+			},
+			storeType: component.Sidecar,
+		},
+		{
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "addr", Value: addr}}}}
+			},
+			storeType: component.Store,
+		},
+	})
+	testutil.Ok(t, err)
+	defer st.Close()
+
+	addrs := st.StoreAddresses()
+	staticAddr, dynamicAddr := addrs[0], addrs[1]
+
+	storeSet := NewStoreSet(nil, nil,
+		func() []StoreSpec { return []StoreSpec{NewGRPCStoreSpec(staticAddr, false)} },
+		nil,
+		nil,
+		nil,
+		testGRPCOpts, time.Minute)
+	storeSet.gRPCInfoCallTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	storeSet.Update(context.Background())
+	testutil.Equals(t, 1, len(storeSet.Get()))
+
+	testutil.NotOk(t, storeSet.AddStore(staticAddr))
+	testutil.NotOk(t, storeSet.RemoveStore(staticAddr))
+	testutil.Ok(t, storeSet.AddStore(dynamicAddr))
+	testutil.NotOk(t, storeSet.AddStore(dynamicAddr))
+
+	storeSet.Update(context.Background())
+	testutil.Equals(t, 2, len(storeSet.Get()))
+
+	statuses := storeSet.GetStoreStatus()
+	testutil.Equals(t, 2, len(statuses))
+	for _, status := range statuses {
+		testutil.Equals(t, status.Name == dynamicAddr, status.Dynamic)
+		testutil.Assert(t, status.LastError == nil, "store %s should be healthy", status.Name)
+		testutil.Assert(t, len(status.History) > 0, "store %s should have been checked", status.Name)
+	}
+
+	// Drained stores are still checked, but not queried.
+	testutil.NotOk(t, storeSet.DrainStore("127.0.0.1:1", true))
+	testutil.NotOk(t, storeSet.DrainStore(staticAddr, false))
+	testutil.Ok(t, storeSet.DrainStore(staticAddr, true))
+	storeSet.Update(context.Background())
+
+	clients := storeSet.Get()
+	testutil.Equals(t, 1, len(clients))
+	testutil.Equals(t, dynamicAddr, clients[0].Addr())
+	for _, status := range storeSet.GetStoreStatus() {
+		testutil.Equals(t, status.Name == staticAddr, status.Drained)
+		if status.Name == staticAddr {
+			testutil.Equals(t, 3, len(status.History))
+		}
+	}
+
+	testutil.Ok(t, storeSet.DrainStore(staticAddr, false))
+	testutil.Equals(t, 2, len(storeSet.Get()))
+
+	// Removed stores are closed on the next update.
+	testutil.Ok(t, storeSet.RemoveStore(dynamicAddr))
+	storeSet.Update(context.Background())
+	clients = storeSet.Get()
+	testutil.Equals(t, 1, len(clients))
+	testutil.Equals(t, staticAddr, clients[0].Addr())
+}
+
+func TestStoreSet_SpecDialOpts(t *testing.T) {
+	st, err := startTestStores([]testStoreMeta{
+		{
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "addr", Value: addr}}}}
+			},
+			storeType: component.Sidecar,
+		},
+		{
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "addr", Value: addr}}}}
+			},
+			storeType: component.Store,
+		},
+	})
+	testutil.Ok(t, err)
+	defer st.Close()
+
+	addrs := st.StoreAddresses()
+
+	// The dial options of the store set have no transport security, so only the store with its own options can be dialed.
+	storeSet := NewStoreSet(nil, nil,
+		func() []StoreSpec {
+			return []StoreSpec{
+				NewGRPCStoreSpec(addrs[0], false),
+				NewGRPCStoreSpecWithDialOpts(addrs[1], false, testGRPCOpts),
+			}
+		},
+		nil,
+		nil,
+		nil,
+		[]grpc.DialOption{grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32))}, time.Minute)
+	storeSet.gRPCInfoCallTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	storeSet.Update(context.Background())
+	clients := storeSet.Get()
+	testutil.Equals(t, 1, len(clients))
+	testutil.Equals(t, addrs[1], clients[0].Addr())
+}
+
+func TestStoreSet_StaleExternalLabels(t *testing.T) {
+	st, err := startTestStores([]testStoreMeta{
+		{
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "addr", Value: addr}}}}
+			},
+			storeType:   component.Sidecar,
+			labelsStale: true,
+		},
+		{
+			extlsetFn: func(addr string) []labelpb.ZLabelSet {
+				return []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "addr", Value: addr}}}}
+			},
+			storeType: component.Sidecar,
+		},
+	})
+	testutil.Ok(t, err)
+	defer st.Close()
+
+	addrs := st.StoreAddresses()
+
+	reg := prometheus.NewRegistry()
+	storeSet := NewStoreSet(nil, reg,
+		func() []StoreSpec {
+			return []StoreSpec{NewGRPCStoreSpec(addrs[0], false), NewGRPCStoreSpec(addrs[1], false)}
+		},
+		nil,
+		nil,
+		nil,
+		testGRPCOpts, time.Minute)
+	storeSet.gRPCInfoCallTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	storeSet.Update(context.Background())
+
+	// Stores with stale labels are still queried.
+	testutil.Equals(t, 2, len(storeSet.Get()))
+	testutil.Equals(t, 1.0, promtestutil.ToFloat64(storeSet.staleLabelsStores))
+
+	statuses := storeSet.GetStoreStatus()
+	testutil.Equals(t, 2, len(statuses))
+	for _, status := range statuses {
+		testutil.Equals(t, status.Name == addrs[0], status.LabelsStale)
+	}
+}
+
+func TestStoreSet_LabelMatchers(t *testing.T) {
+	extlsetFn := func(addr string) []labelpb.ZLabelSet {
+		return []labelpb.ZLabelSet{{Labels: []labelpb.ZLabel{{Name: "addr", Value: addr}}}}
+	}
+	st, err := startTestStores([]testStoreMeta{
+		{extlsetFn: extlsetFn, storeType: component.Sidecar, labelMatchers: true},
+		{extlsetFn: extlsetFn, storeType: component.Sidecar},
+	})
+	testutil.Ok(t, err)
+	defer st.Close()
+
+	addrs := st.StoreAddresses()
+	storeSet := NewStoreSet(nil, nil,
+		func() []StoreSpec {
+			return []StoreSpec{NewGRPCStoreSpec(addrs[0], false), NewGRPCStoreSpec(addrs[1], false)}
+		},
+		nil,
+		nil,
+		nil,
+		testGRPCOpts, time.Minute)
+	storeSet.gRPCInfoCallTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	storeSet.Update(context.Background())
+
+	stores := storeSet.Get()
+	testutil.Equals(t, 2, len(stores))
+	for _, s := range stores {
+		testutil.Equals(t, s.Addr() == addrs[0], s.LabelMatchers())
+	}
+}
+
+func TestRecordStoreCheck_History(t *testing.T) {
+	mockStoreSet := &StoreSet{
+		storeStatuses: map[string]*StoreStatus{},
+	}
+	mockStoreRef := &storeRef{
+		addr: "testStore",
+	}
+
+	// Checks of unknown stores are ignored.
+	mockStoreSet.recordStoreCheck("testStore", time.Now(), nil)
+	testutil.Equals(t, 0, len(mockStoreSet.storeStatuses))
+
+	mockStoreSet.updateStoreStatus(mockStoreRef, nil)
+	for i := 0; i < storeCheckHistorySize+5; i++ {
+		var err error
+		if i%2 == 0 {
+			err = errors.New("test err")
+		}
+		mockStoreSet.recordStoreCheck("testStore", time.Now(), err)
+	}
+
+	history := mockStoreSet.storeStatuses["testStore"].History
+	testutil.Equals(t, storeCheckHistorySize, len(history))
+	testutil.Assert(t, history[len(history)-1].Error != nil, "last check should have failed")
+	testutil.Assert(t, history[len(history)-2].Error == nil, "second to last check should have succeeded")
+}
@@ -0,0 +1,342 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+const (
+	// DefaultTenantHeader is the default HTTP header the tenant of a request is read from.
+	DefaultTenantHeader = "THANOS-TENANT"
+	// DefaultTenantLabel is the default label enforced to the tenant of a request.
+	DefaultTenantLabel = "tenant_id"
+
+	// Fields of the client certificate subject the tenant of a request can be read from.
+	CertificateFieldOrganization       = "organization"
+	CertificateFieldOrganizationalUnit = "organizationalUnit"
+	CertificateFieldCommonName         = "commonName"
+)
+
+// Tenancy enforces the tenant of the requests to the queries, by adding a matcher of the tenant label on all selected series.
+// A nil Tenancy is valid and enforces nothing.
+type Tenancy struct {
+	header    string
+	certField string
+	label     string
+}
+
+// NewTenancy creates Tenancy, reading the tenant of a request from the given field of the client certificate if
+// certField is not empty, or from the given HTTP header otherwise.
+func NewTenancy(header, certField, label string) (*Tenancy, error) {
+	switch certField {
+	case "", CertificateFieldOrganization, CertificateFieldOrganizationalUnit, CertificateFieldCommonName:
+	default:
+		return nil, errors.Errorf("unknown certificate field %q", certField)
+	}
+	if certField == "" && header == "" {
+		return nil, errors.New("either a header or a certificate field is required to read the tenant from")
+	}
+	if label == "" {
+		return nil, errors.New("tenant label is required")
+	}
+	return &Tenancy{header: header, certField: certField, label: label}, nil
+}
+
+// Tenant returns the tenant of the request. It returns an empty tenant if t is nil, and an error if t is not nil and
+// the request has no tenant.
+func (t *Tenancy) Tenant(r *http.Request) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	if t.certField == "" {
+		tenant := r.Header.Get(t.header)
+		if tenant == "" {
+			return "", errors.Errorf("missing tenant header %s", t.header)
+		}
+		return tenant, nil
+	}
+
+	if r.TLS == nil {
+		return t.tenantFromCertificates(nil)
+	}
+	return t.tenantFromCertificates(r.TLS.PeerCertificates)
+}
+
+// grpcTenant returns the tenant of the gRPC request of the given context, read from the metadata of the request or
+// from its client certificate like Tenant.
+func (t *Tenancy) grpcTenant(ctx context.Context) (string, error) {
+	if t.certField == "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if tenant := md.Get(t.header); len(tenant) > 0 && tenant[0] != "" {
+			return tenant[0], nil
+		}
+		return "", errors.Errorf("missing tenant header %s", t.header)
+	}
+
+	var certs []*x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			certs = info.State.PeerCertificates
+		}
+	}
+	return t.tenantFromCertificates(certs)
+}
+
+func (t *Tenancy) tenantFromCertificates(certs []*x509.Certificate) (string, error) {
+	if len(certs) == 0 {
+		return "", errors.New("missing client certificate to read the tenant from")
+	}
+	subject := certs[0].Subject
+	var tenant string
+	switch t.certField {
+	case CertificateFieldOrganization:
+		if len(subject.Organization) > 0 {
+			tenant = subject.Organization[0]
+		}
+	case CertificateFieldOrganizationalUnit:
+		if len(subject.OrganizationalUnit) > 0 {
+			tenant = subject.OrganizationalUnit[0]
+		}
+	case CertificateFieldCommonName:
+		tenant = subject.CommonName
+	}
+	if tenant == "" {
+		return "", errors.Errorf("missing %s in client certificate subject", t.certField)
+	}
+	return tenant, nil
+}
+
+// Queryable returns a queryable selecting only the series of the given tenant, or the given queryable if t is nil.
+func (t *Tenancy) Queryable(tenant string, queryable storage.Queryable) storage.Queryable {
+	if t == nil {
+		return queryable
+	}
+	return &tenantQueryable{Queryable: queryable, matcher: labels.MustNewMatcher(labels.MatchEqual, t.label, tenant)}
+}
+
+type tenantQueryable struct {
+	storage.Queryable
+	matcher *labels.Matcher
+}
+
+// Querier returns a new storage querier selecting only the series of the tenant.
+func (q *tenantQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	querier, err := q.Queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantQuerier{Querier: querier, matcher: q.matcher, mint: mint, maxt: maxt}, nil
+}
+
+type tenantQuerier struct {
+	storage.Querier
+	matcher    *labels.Matcher
+	mint, maxt int64
+}
+
+func (q *tenantQuerier) Select(sortSeries bool, hints *storage.SelectHints, ms ...*labels.Matcher) storage.SeriesSet {
+	// The tenant matcher is ANDed with the given ones, so a request can't select the series of other tenants.
+	return q.Querier.Select(sortSeries, hints, append([]*labels.Matcher{q.matcher}, ms...)...)
+}
+
+// LabelValues returns all potential values for a label name in the series of the tenant.
+func (q *tenantQuerier) LabelValues(name string) ([]string, storage.Warnings, error) {
+	return q.LabelValuesWithMatchers(name)
+}
+
+// LabelValuesWithMatchers returns all potential values for a label name in the series of the tenant matching the
+// given matchers. The tenant matcher is enforced by the querier even for the stores ignoring the matchers of label
+// requests, as it gathers their label values from their series.
+func (q *tenantQuerier) LabelValuesWithMatchers(name string, ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	if lq, ok := q.Querier.(LabelMatchersQuerier); ok {
+		return lq.LabelValuesWithMatchers(name, append([]*labels.Matcher{q.matcher}, ms...)...)
+	}
+
+	// Otherwise they are gathered from the series of the tenant.
+	values := map[string]struct{}{}
+	warns, err := q.forEachSeries(func(lset labels.Labels) {
+		if v := lset.Get(name); v != "" {
+			values[v] = struct{}{}
+		}
+	}, ms...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sortedKeys(values), warns, nil
+}
+
+// LabelNames returns all the unique label names present in the series of the tenant in sorted order.
+func (q *tenantQuerier) LabelNames() ([]string, storage.Warnings, error) {
+	return q.LabelNamesWithMatchers()
+}
+
+// LabelNamesWithMatchers returns all the unique label names present in the series of the tenant matching the given
+// matchers in sorted order. The tenant matcher is enforced like in LabelValuesWithMatchers.
+func (q *tenantQuerier) LabelNamesWithMatchers(ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	if lq, ok := q.Querier.(LabelMatchersQuerier); ok {
+		return lq.LabelNamesWithMatchers(append([]*labels.Matcher{q.matcher}, ms...)...)
+	}
+
+	// Otherwise they are gathered from the series of the tenant.
+	names := map[string]struct{}{}
+	warns, err := q.forEachSeries(func(lset labels.Labels) {
+		for _, l := range lset {
+			names[l.Name] = struct{}{}
+		}
+	}, ms...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sortedKeys(names), warns, nil
+}
+
+func (q *tenantQuerier) forEachSeries(f func(labels.Labels), ms ...*labels.Matcher) (storage.Warnings, error) {
+	set := q.Select(false, &storage.SelectHints{Start: q.mint, End: q.maxt, Func: "series"}, ms...)
+	for set.Next() {
+		f(set.At().Labels())
+	}
+	if err := set.Err(); err != nil {
+		return nil, errors.Wrap(err, "select series of tenant")
+	}
+	return set.Warnings(), nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Enabled returns true if t enforces the tenant of the requests.
+func (t *Tenancy) Enabled() bool {
+	return t != nil
+}
+
+// StoreServer returns a StoreAPI server serving only the series of the tenant of the requests, or the given server
+// if t is nil.
+func (t *Tenancy) StoreServer(srv storepb.StoreServer) storepb.StoreServer {
+	if t == nil {
+		return srv
+	}
+	return &tenantStoreServer{StoreServer: srv, tenancy: t}
+}
+
+type tenantStoreServer struct {
+	storepb.StoreServer
+	tenancy *Tenancy
+}
+
+func (s *tenantStoreServer) matcher(ctx context.Context) (storepb.LabelMatcher, error) {
+	tenant, err := s.tenancy.grpcTenant(ctx)
+	if err != nil {
+		return storepb.LabelMatcher{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return storepb.LabelMatcher{Type: storepb.LabelMatcher_EQ, Name: s.tenancy.label, Value: tenant}, nil
+}
+
+// Series streams the series of the tenant matching the request.
+func (s *tenantStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	m, err := s.matcher(srv.Context())
+	if err != nil {
+		return err
+	}
+	req := *r
+	req.Matchers = append([]storepb.LabelMatcher{m}, r.Matchers...)
+	return s.StoreServer.Series(&req, srv)
+}
+
+// LabelNames returns the label names of the series of the tenant. They are gathered from its series, as not all
+// StoreAPIs restrict the label names to the ones of the series matching the matchers of the request.
+func (s *tenantStoreServer) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+	names := map[string]struct{}{}
+	warns, err := s.forEachSeries(ctx, &storepb.SeriesRequest{
+		MinTime:                 r.Start,
+		MaxTime:                 r.End,
+		Matchers:                r.Matchers,
+		PartialResponseDisabled: r.PartialResponseDisabled,
+		PartialResponseStrategy: r.PartialResponseStrategy,
+	}, func(lset []labelpb.ZLabel) {
+		for _, l := range lset {
+			names[l.Name] = struct{}{}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &storepb.LabelNamesResponse{Names: sortedKeys(names), Warnings: warns}, nil
+}
+
+// LabelValues returns the values of the label in the series of the tenant, gathered from its series like LabelNames.
+func (s *tenantStoreServer) LabelValues(ctx context.Context, r *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	values := map[string]struct{}{}
+	warns, err := s.forEachSeries(ctx, &storepb.SeriesRequest{
+		MinTime:                 r.Start,
+		MaxTime:                 r.End,
+		Matchers:                r.Matchers,
+		PartialResponseDisabled: r.PartialResponseDisabled,
+		PartialResponseStrategy: r.PartialResponseStrategy,
+	}, func(lset []labelpb.ZLabel) {
+		for _, l := range lset {
+			if l.Name == r.Label {
+				values[l.Value] = struct{}{}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &storepb.LabelValuesResponse{Values: sortedKeys(values), Warnings: warns}, nil
+}
+
+func (s *tenantStoreServer) forEachSeries(ctx context.Context, r *storepb.SeriesRequest, f func([]labelpb.ZLabel)) ([]string, error) {
+	r.SkipChunks = true
+	srv := &tenantLabelsServer{ctx: ctx, f: f}
+	if err := s.Series(r, srv); err != nil {
+		return nil, err
+	}
+	return srv.warnings, nil
+}
+
+// tenantLabelsServer calls its function with the labels of the series sent to it.
+type tenantLabelsServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.Store_SeriesServer
+
+	ctx      context.Context
+	f        func([]labelpb.ZLabel)
+	warnings []string
+}
+
+func (s *tenantLabelsServer) Send(r *storepb.SeriesResponse) error {
+	if r.GetWarning() != "" {
+		s.warnings = append(s.warnings, r.GetWarning())
+	}
+	if r.GetSeries() != nil {
+		s.f(r.GetSeries().Labels)
+	}
+	return nil
+}
+
+func (s *tenantLabelsServer) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,190 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestTenancy_Tenant(t *testing.T) {
+	withCert := func(r *http.Request, subject pkix.Name) *http.Request {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: subject}}}
+		return r
+	}
+
+	var nilTenancy *Tenancy
+	tenant, err := nilTenancy.Tenant(httptest.NewRequest("GET", "/", nil))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "", tenant)
+
+	_, err = NewTenancy("", "", DefaultTenantLabel)
+	testutil.NotOk(t, err)
+	_, err = NewTenancy(DefaultTenantHeader, "serialNumber", DefaultTenantLabel)
+	testutil.NotOk(t, err)
+
+	byHeader, err := NewTenancy(DefaultTenantHeader, "", DefaultTenantLabel)
+	testutil.Ok(t, err)
+	r := httptest.NewRequest("GET", "/", nil)
+	_, err = byHeader.Tenant(r)
+	testutil.NotOk(t, err)
+	r.Header.Set(DefaultTenantHeader, "team-a")
+	tenant, err = byHeader.Tenant(r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "team-a", tenant)
+
+	byCert, err := NewTenancy(DefaultTenantHeader, CertificateFieldOrganizationalUnit, DefaultTenantLabel)
+	testutil.Ok(t, err)
+	// The header is ignored when the tenant is read from the client certificate.
+	_, err = byCert.Tenant(r)
+	testutil.NotOk(t, err)
+	_, err = byCert.Tenant(withCert(httptest.NewRequest("GET", "/", nil), pkix.Name{CommonName: "team-a"}))
+	testutil.NotOk(t, err)
+	tenant, err = byCert.Tenant(withCert(httptest.NewRequest("GET", "/", nil), pkix.Name{OrganizationalUnit: []string{"team-b", "team-c"}}))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "team-b", tenant)
+}
+
+type recordingQuerier struct {
+	storage.Querier
+
+	series   []labels.Labels
+	matchers [][]*labels.Matcher
+}
+
+func (q *recordingQuerier) Select(_ bool, _ *storage.SelectHints, ms ...*labels.Matcher) storage.SeriesSet {
+	q.matchers = append(q.matchers, ms)
+	set := &mockedSeriesSet{}
+	for _, lset := range q.series {
+		set.series = append(set.series, series{lset: lset})
+	}
+	return set
+}
+
+func (q *recordingQuerier) Close() error { return nil }
+
+func TestTenancy_Queryable(t *testing.T) {
+	inner := &recordingQuerier{series: []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "a", "tenant_id", "team-a"),
+		labels.FromStrings("__name__", "up", "instance", "b", "tenant_id", "team-a"),
+	}}
+	tenancy, err := NewTenancy(DefaultTenantHeader, "", DefaultTenantLabel)
+	testutil.Ok(t, err)
+
+	q, err := tenancy.Queryable("team-a", storage.QueryableFunc(func(context.Context, int64, int64) (storage.Querier, error) {
+		return inner, nil
+	})).Querier(context.Background(), 0, 10)
+	testutil.Ok(t, err)
+
+	tenantMatcher := labels.MustNewMatcher(labels.MatchEqual, "tenant_id", "team-a")
+	// The tenant matcher restricts matchers on the tenant label too.
+	other := labels.MustNewMatcher(labels.MatchEqual, "tenant_id", "team-b")
+	set := q.Select(false, nil, other)
+	testutil.Ok(t, set.Err())
+	testutil.Equals(t, []*labels.Matcher{tenantMatcher, other}, inner.matchers[0])
+
+	names, _, err := q.LabelNames()
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"__name__", "instance", "job", "tenant_id"}, names)
+	testutil.Equals(t, []*labels.Matcher{tenantMatcher}, inner.matchers[1])
+
+	values, _, err := q.LabelValues("job")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a"}, values)
+	testutil.Equals(t, []*labels.Matcher{tenantMatcher}, inner.matchers[2])
+	testutil.Ok(t, q.Close())
+}
+
+type labelMatchersQuerier struct {
+	recordingQuerier
+}
+
+func (q *labelMatchersQuerier) LabelValuesWithMatchers(name string, ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	q.matchers = append(q.matchers, ms)
+	return []string{name}, nil, nil
+}
+
+func (q *labelMatchersQuerier) LabelNamesWithMatchers(ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	q.matchers = append(q.matchers, ms)
+	return []string{"tenant_id"}, nil, nil
+}
+
+func TestTenancy_Queryable_LabelMatchersPushdown(t *testing.T) {
+	inner := &labelMatchersQuerier{}
+	tenancy, err := NewTenancy(DefaultTenantHeader, "", DefaultTenantLabel)
+	testutil.Ok(t, err)
+
+	q, err := tenancy.Queryable("team-a", storage.QueryableFunc(func(context.Context, int64, int64) (storage.Querier, error) {
+		return inner, nil
+	})).Querier(context.Background(), 0, 10)
+	testutil.Ok(t, err)
+
+	tenantMatcher := labels.MustNewMatcher(labels.MatchEqual, "tenant_id", "team-a")
+	job := labels.MustNewMatcher(labels.MatchEqual, "job", "a")
+	lq, ok := q.(LabelMatchersQuerier)
+	testutil.Assert(t, ok, "tenant querier should support label matchers")
+
+	// The tenant matcher is pushed down with the given matchers instead of selecting the series of the tenant.
+	names, _, err := lq.LabelNamesWithMatchers(job)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"tenant_id"}, names)
+	testutil.Equals(t, []*labels.Matcher{tenantMatcher, job}, inner.matchers[0])
+
+	values, _, err := q.LabelValues("job")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"job"}, values)
+	testutil.Equals(t, []*labels.Matcher{tenantMatcher}, inner.matchers[1])
+	testutil.Ok(t, q.Close())
+}
+
+func TestTenancy_StoreServer(t *testing.T) {
+	tenancy, err := NewTenancy(DefaultTenantHeader, "", DefaultTenantLabel)
+	testutil.Ok(t, err)
+
+	store := &recordingStoreServer{storeServer: storeServer{resps: []*storepb.SeriesResponse{
+		storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "a", DefaultTenantLabel, "team-a")),
+		storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "b", "zone", "eu", DefaultTenantLabel, "team-a")),
+		storepb.NewWarnSeriesResponse(errors.New("store down")),
+	}}}
+	srv := tenancy.StoreServer(store)
+	tenantMatcher := storepb.LabelMatcher{Type: storepb.LabelMatcher_EQ, Name: DefaultTenantLabel, Value: "team-a"}
+	jobMatcher := storepb.LabelMatcher{Type: storepb.LabelMatcher_EQ, Name: "job", Value: "b"}
+
+	// Requests without tenant are rejected.
+	_, err = srv.LabelNames(context.Background(), &storepb.LabelNamesRequest{})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, codes.InvalidArgument, status.Code(err))
+	testutil.Equals(t, 0, len(store.reqs))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultTenantHeader, "team-a"))
+	names, err := srv.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 1, End: 2})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"__name__", "job", DefaultTenantLabel, "zone"}, names.Names)
+	testutil.Equals(t, []string{"store down"}, names.Warnings)
+	testutil.Equals(t, &storepb.SeriesRequest{MinTime: 1, MaxTime: 2, Matchers: []storepb.LabelMatcher{tenantMatcher}, SkipChunks: true}, store.reqs[0])
+
+	values, err := srv.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "job", Matchers: []storepb.LabelMatcher{jobMatcher}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, values.Values)
+	testutil.Equals(t, []storepb.LabelMatcher{tenantMatcher, jobMatcher}, store.reqs[1].Matchers)
+
+	testutil.Ok(t, srv.Series(&storepb.SeriesRequest{Matchers: []storepb.LabelMatcher{jobMatcher}}, &tenantLabelsServer{ctx: ctx, f: func([]labelpb.ZLabel) {}}))
+	testutil.Equals(t, []storepb.LabelMatcher{tenantMatcher, jobMatcher}, store.reqs[2].Matchers)
+}
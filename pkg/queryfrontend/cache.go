@@ -18,23 +18,35 @@ type thanosCacheKeyGenerator struct {
 	resolutions []int64
 }
 
-func newThanosCacheKeyGenerator(interval time.Duration) thanosCacheKeyGenerator {
+// newThanosCacheKeyGenerator returns a cache key generator for the given split interval and downsampling
+// resolutions, from the finest to the coarsest. The standard resolutions are used if none are given.
+func newThanosCacheKeyGenerator(interval time.Duration, resolutions []int64) thanosCacheKeyGenerator {
+	if len(resolutions) == 0 {
+		resolutions = downsample.DefaultLevels.Resolutions()
+	}
+	// Resolutions are looked up from high to low.
+	res := make([]int64, 0, len(resolutions))
+	for i := len(resolutions) - 1; i >= 0; i-- {
+		res = append(res, resolutions[i])
+	}
 	return thanosCacheKeyGenerator{
 		interval:    interval,
-		resolutions: []int64{downsample.ResLevel2, downsample.ResLevel1, downsample.ResLevel0},
+		resolutions: res,
 	}
 }
 
 // TODO(yeya24): Add other request params as request key.
 // GenerateCacheKey generates a cache key based on the Request and interval.
 func (t thanosCacheKeyGenerator) GenerateCacheKey(_ string, r queryrange.Request) string {
+	// Instant queries are not split, so their evaluation time is used instead of the interval.
+	if tr, ok := r.(*ThanosQueryInstantRequest); ok {
+		return fmt.Sprintf("%s:%d:%d:%t", tr.Query, tr.Time, t.resolutionLevel(tr.MaxSourceResolution), tr.AutoDownsampling)
+	}
+
 	currentInterval := r.GetStart() / t.interval.Milliseconds()
 	switch tr := r.(type) {
 	case *ThanosQueryRangeRequest:
-		i := 0
-		for ; i < len(t.resolutions) && t.resolutions[i] > tr.MaxSourceResolution; i++ {
-		}
-		return fmt.Sprintf("%s:%d:%d:%d", tr.Query, tr.Step, currentInterval, i)
+		return fmt.Sprintf("%s:%d:%d:%d", tr.Query, tr.Step, currentInterval, t.resolutionLevel(tr.MaxSourceResolution))
 	case *ThanosLabelsRequest:
 		return fmt.Sprintf("%s:%d", tr.Label, currentInterval)
 	case *ThanosSeriesRequest:
@@ -42,3 +54,11 @@ func (t thanosCacheKeyGenerator) GenerateCacheKey(_ string, r queryrange.Request
 	}
 	return fmt.Sprintf("%s:%d:%d", r.GetQuery(), r.GetStep(), currentInterval)
 }
+
+// resolutionLevel returns the index of the coarsest resolution which is not coarser than the given max source resolution.
+func (t thanosCacheKeyGenerator) resolutionLevel(maxSourceResolution int64) int {
+	i := 0
+	for ; i < len(t.resolutions) && t.resolutions[i] > maxSourceResolution; i++ {
+	}
+	return i
+}
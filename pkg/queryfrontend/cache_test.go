@@ -12,7 +12,7 @@ import (
 )
 
 func TestGenerateCacheKey(t *testing.T) {
-	splitter := newThanosCacheKeyGenerator(hour)
+	splitter := newThanosCacheKeyGenerator(hour, nil)
 
 	for _, tc := range []struct {
 		name     string
@@ -76,8 +76,58 @@ func TestGenerateCacheKey(t *testing.T) {
 			},
 			expected: "up:10000:0:0",
 		},
+		{
+			name: "instant query",
+			req: &ThanosQueryInstantRequest{
+				Query: "up",
+				Time:  2 * hour,
+			},
+			expected: "up:7200000:2:false",
+		},
+		{
+			name: "instant query with auto downsampling",
+			req: &ThanosQueryInstantRequest{
+				Query:            "up",
+				Time:             2 * hour,
+				AutoDownsampling: true,
+			},
+			expected: "up:7200000:2:true",
+		},
+		{
+			name: "instant query with 5m downsampling resolution",
+			req: &ThanosQueryInstantRequest{
+				Query:               "up",
+				Time:                2 * hour,
+				MaxSourceResolution: 300 * seconds,
+			},
+			expected: "up:7200000:1:false",
+		},
 	} {
 		key := splitter.GenerateCacheKey("", tc.req)
 		testutil.Equals(t, tc.expected, key)
 	}
 }
+
+func TestGenerateCacheKey_AdditionalResolution(t *testing.T) {
+	const day = 24 * hour
+	splitter := newThanosCacheKeyGenerator(hour, []int64{0, 300 * seconds, hour, day})
+
+	for _, tc := range []struct {
+		maxSourceResolution int64
+		expected            string
+	}{
+		{maxSourceResolution: 0, expected: "up:10000:0:3"},
+		{maxSourceResolution: 300 * seconds, expected: "up:10000:0:2"},
+		{maxSourceResolution: hour, expected: "up:10000:0:1"},
+		{maxSourceResolution: 2 * hour, expected: "up:10000:0:1"},
+		{maxSourceResolution: day, expected: "up:10000:0:0"},
+	} {
+		key := splitter.GenerateCacheKey("", &ThanosQueryRangeRequest{
+			Query:               "up",
+			Start:               0,
+			Step:                10 * seconds,
+			MaxSourceResolution: tc.maxSourceResolution,
+		})
+		testutil.Equals(t, tc.expected, key)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	cortexcache "github.com/cortexproject/cortex/pkg/chunk/cache"
 	"github.com/cortexproject/cortex/pkg/frontend/transport"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/thanos-io/thanos/pkg/cacheutil"
@@ -25,6 +26,7 @@ type ResponseCacheProvider string
 const (
 	INMEMORY  ResponseCacheProvider = "IN-MEMORY"
 	MEMCACHED ResponseCacheProvider = "MEMCACHED"
+	REDIS     ResponseCacheProvider = "REDIS"
 )
 
 var (
@@ -40,8 +42,23 @@ var (
 		},
 		Expiration: 24 * time.Hour,
 	}
+
+	defaultRedisConfig = RedisResponseCacheConfig{
+		Redis: cacheutil.RedisClientConfig{
+			ReadTimeout:         3 * time.Second,
+			WriteTimeout:        3 * time.Second,
+			PoolSize:            100,
+			IdleTimeout:         5 * time.Minute,
+			MaxAsyncConcurrency: 10,
+			MaxAsyncBufferSize:  10000,
+		},
+		Expiration: 24 * time.Hour,
+	}
 )
 
+// defaultInMemoryMaxSize is the maximum size of the in-memory cache if no size limit is configured.
+const defaultInMemoryMaxSize = "100MB"
+
 // InMemoryResponseCacheConfig holds the configs for the in-memory cache provider.
 type InMemoryResponseCacheConfig struct {
 	// MaxSize represents overall maximum number of bytes cache can contain.
@@ -59,6 +76,13 @@ type MemcachedResponseCacheConfig struct {
 	Expiration time.Duration `yaml:"expiration"`
 }
 
+// RedisResponseCacheConfig holds the configs for the redis cache provider.
+type RedisResponseCacheConfig struct {
+	Redis cacheutil.RedisClientConfig `yaml:",inline"`
+	// Expiration sets a global expiration limit for all cached items.
+	Expiration time.Duration `yaml:"expiration"`
+}
+
 // CacheProviderConfig is the initial CacheProviderConfig struct holder before parsing it into a specific cache provider.
 // Based on the config type the config is then parsed into a specific cache provider.
 type CacheProviderConfig struct {
@@ -85,6 +109,12 @@ func NewCacheConfig(logger log.Logger, confContentYaml []byte) (*cortexcache.Con
 			return nil, err
 		}
 
+		// Without any size limit, the cache would not be created.
+		if config.MaxSize == "" && config.MaxSizeItems <= 0 {
+			level.Warn(logger).Log("msg", "in-memory response cache max_size and max_size_items not set, so using a default max_size of "+defaultInMemoryMaxSize)
+			config.MaxSize = defaultInMemoryMaxSize
+		}
+
 		return &cortexcache.Config{
 			EnableFifoCache: true,
 			Fifocache: cortexcache.FifoCacheConfig{
@@ -135,14 +165,107 @@ func NewCacheConfig(logger log.Logger, confContentYaml []byte) (*cortexcache.Con
 				WriteBackGoroutines: config.Memcached.MaxAsyncConcurrency,
 			},
 		}, nil
+	case string(REDIS):
+		config := defaultRedisConfig
+		if err := yaml.UnmarshalStrict(backendConfig, &config); err != nil {
+			return nil, err
+		}
+		if len(config.Redis.Addresses) == 0 {
+			return nil, errors.New("no redis addresses provided")
+		}
+		if config.Redis.MasterName != "" && config.Redis.ClusterMode {
+			return nil, errors.New("sentinel master name can't be used in cluster mode")
+		}
+		if len(config.Redis.Addresses) > 1 && config.Redis.MasterName == "" && !config.Redis.ClusterMode {
+			return nil, errors.New("multiple redis addresses require cluster mode, or a sentinel master name")
+		}
+		warnUnsupportedRedisOptions(logger, config.Redis)
+
+		if config.Expiration == 0 {
+			level.Warn(logger).Log("msg", "redis cache valid time set to 0, so using a default of 24 hours expiration time")
+			config.Expiration = 24 * time.Hour
+		}
+
+		if config.Redis.MaxAsyncConcurrency <= 0 {
+			level.Warn(logger).Log("msg", "redis max async concurrency must be positive, defaulting to 10")
+			config.Redis.MaxAsyncConcurrency = 10
+		}
+
+		// The redis client of the results cache has a single timeout for the requests.
+		timeout := config.Redis.ReadTimeout
+		if config.Redis.WriteTimeout > timeout {
+			timeout = config.Redis.WriteTimeout
+		}
+
+		return &cortexcache.Config{
+			Redis: cortexcache.RedisConfig{
+				Endpoint:           strings.Join(config.Redis.Addresses, ","),
+				MasterName:         config.Redis.MasterName,
+				Timeout:            timeout,
+				Expiration:         config.Expiration,
+				DB:                 config.Redis.DB,
+				PoolSize:           config.Redis.PoolSize,
+				Password:           flagext.Secret{Value: config.Redis.Password},
+				EnableTLS:          config.Redis.TLSEnabled,
+				InsecureSkipVerify: config.Redis.TLSConfig.InsecureSkipVerify,
+				IdleTimeout:        config.Redis.IdleTimeout,
+				MaxConnAge:         config.Redis.MaxConnectionAge,
+			},
+			Background: cortexcache.BackgroundConfig{
+				WriteBackBuffer:     config.Redis.MaxAsyncBufferSize,
+				WriteBackGoroutines: config.Redis.MaxAsyncConcurrency,
+			},
+		}, nil
 	default:
 		return nil, errors.Errorf("response cache with type %s is not supported", cacheConfig.Type)
 	}
 }
 
+// warnUnsupportedRedisOptions logs the options of the redis client config which are set but not supported by the
+// redis client of the results cache.
+// TODO: Add support for them in the cortex module.
+func warnUnsupportedRedisOptions(logger log.Logger, config cacheutil.RedisClientConfig) {
+	var unsupported []string
+	if config.ClusterMode && len(config.Addresses) == 1 {
+		// The redis client of the results cache only selects Redis Cluster with two or more addresses.
+		unsupported = append(unsupported, "cluster_mode with a single address")
+	}
+	if config.Username != "" {
+		unsupported = append(unsupported, "username")
+	}
+	if config.SentinelPassword != "" {
+		unsupported = append(unsupported, "sentinel_password")
+	}
+	if config.DialTimeout > 0 {
+		unsupported = append(unsupported, "dial_timeout")
+	}
+	if config.MinIdleConnections > 0 {
+		unsupported = append(unsupported, "min_idle_connections")
+	}
+	if config.MaxItemSize > 0 {
+		unsupported = append(unsupported, "max_item_size")
+	}
+	if config.MaxGetMultiConcurrency > 0 {
+		unsupported = append(unsupported, "max_get_multi_concurrency")
+	}
+	if config.MaxGetMultiBatchSize > 0 {
+		unsupported = append(unsupported, "max_get_multi_batch_size")
+	}
+	if config.MaxSetMultiBatchSize > 0 {
+		unsupported = append(unsupported, "max_set_multi_batch_size")
+	}
+	if tls := config.TLSConfig; tls.CAFile != "" || tls.CertFile != "" || tls.KeyFile != "" || tls.ServerName != "" {
+		unsupported = append(unsupported, "tls_config")
+	}
+	if len(unsupported) > 0 {
+		level.Warn(logger).Log("msg", "ignoring redis options not yet supported by the redis client of the response cache", "options", strings.Join(unsupported, ","))
+	}
+}
+
 // Config holds the query frontend configs.
 type Config struct {
 	QueryRangeConfig
+	InstantQueryConfig
 	LabelsConfig
 
 	CortexHandlerConfig    *transport.HandlerConfig
@@ -150,6 +273,18 @@ type Config struct {
 	CacheCompression       string
 	RequestLoggingDecision string
 	DownstreamURL          string
+
+	// DownstreamConcurrency is the maximum number of requests sent downstream at a time. The requests are queued
+	// per tenant if it is greater than 0.
+	DownstreamConcurrency   int
+	MaxOutstandingPerTenant int
+
+	// SlowQueryLogFile is the file the slow queries are written to, instead of the log.
+	SlowQueryLogFile string
+
+	// DownsamplingResolutions are the downsampling resolutions of the blocks in milliseconds, from the finest to
+	// the coarsest. Requests of max source resolutions selecting the same blocks share cache entries.
+	DownsamplingResolutions []int64
 }
 
 // QueryRangeConfig holds the config for query range tripperware.
@@ -163,8 +298,28 @@ type QueryRangeConfig struct {
 
 	AlignRangeWithStep     bool
 	SplitQueriesByInterval time.Duration
+	VerticalShards         int
 	MaxRetries             int
 	Limits                 *cortexvalidation.Limits
+
+	// RetryBudgetRatio is the ratio of retries allowed per request, retries are not limited if it is 0.
+	RetryBudgetRatio float64
+	RetryBudgetBurst int
+}
+
+// InstantQueryConfig holds the config for instant query tripperware.
+type InstantQueryConfig struct {
+	// PartialResponseStrategy is the default strategy used
+	// when parsing thanos query request.
+	PartialResponseStrategy bool
+
+	ResultsCacheConfig *queryrange.ResultsCacheConfig
+	CachePathOrContent extflag.PathOrContent
+	// AlignTimeStep is the step the evaluation time of the queries is aligned down to, if not 0.
+	AlignTimeStep time.Duration
+
+	MaxRetries int
+	Limits     *cortexvalidation.Limits
 }
 
 // LabelsConfig holds the config for labels tripperware.
@@ -194,6 +349,19 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.QueryRangeConfig.RetryBudgetRatio < 0 {
+		return errors.New("retry budget ratio cannot be negative")
+	}
+	if cfg.QueryRangeConfig.RetryBudgetRatio > 0 && cfg.QueryRangeConfig.RetryBudgetBurst < 1 {
+		return errors.New("retry budget burst should be greater than 0 when the retry budget is enabled")
+	}
+
+	if cfg.InstantQueryConfig.ResultsCacheConfig != nil {
+		if err := cfg.InstantQueryConfig.ResultsCacheConfig.Validate(); err != nil {
+			return errors.Wrap(err, "invalid ResultsCache config for query_instant tripperware")
+		}
+	}
+
 	if cfg.LabelsConfig.ResultsCacheConfig != nil {
 		if cfg.LabelsConfig.SplitQueriesByInterval <= 0 {
 			return errors.New("split queries interval should be greater than 0  when caching is enabled")
@@ -207,6 +375,10 @@ func (cfg *Config) Validate() error {
 		return errors.New("labels.default-time-range cannot be set to 0")
 	}
 
+	if cfg.DownstreamConcurrency > 0 && cfg.MaxOutstandingPerTenant <= 0 {
+		return errors.New("max outstanding requests per tenant should be greater than 0 when queueing is enabled")
+	}
+
 	if len(cfg.DownstreamURL) == 0 {
 		return errors.New("downstream URL should be configured")
 	}
@@ -0,0 +1,127 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"testing"
+	"time"
+
+	cortexcache "github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestNewCacheConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   string
+		expected *cortexcache.Config
+		err      bool
+	}{
+		{
+			name: "in-memory",
+			config: `type: IN-MEMORY
+config:
+  max_size: 1GB
+  validity: 1h`,
+			expected: &cortexcache.Config{
+				EnableFifoCache: true,
+				Fifocache:       cortexcache.FifoCacheConfig{MaxSizeBytes: "1GB", Validity: time.Hour},
+			},
+		},
+		{
+			name: "unbounded in-memory",
+			config: `type: IN-MEMORY
+config:
+  validity: 1h`,
+			expected: &cortexcache.Config{
+				EnableFifoCache: true,
+				Fifocache:       cortexcache.FifoCacheConfig{MaxSizeBytes: defaultInMemoryMaxSize, Validity: time.Hour},
+			},
+		},
+		{
+			name: "redis with defaults",
+			config: `type: REDIS
+config:
+  addresses: [redis-1:6379, redis-2:6379]
+  cluster_mode: true
+  password: secret`,
+			expected: &cortexcache.Config{
+				Redis: cortexcache.RedisConfig{
+					Endpoint:    "redis-1:6379,redis-2:6379",
+					Timeout:     3 * time.Second,
+					Expiration:  24 * time.Hour,
+					PoolSize:    100,
+					Password:    flagext.Secret{Value: "secret"},
+					IdleTimeout: 5 * time.Minute,
+				},
+				Background: cortexcache.BackgroundConfig{WriteBackBuffer: 10000, WriteBackGoroutines: 10},
+			},
+		},
+		{
+			name: "redis with multiple addresses without cluster mode",
+			config: `type: REDIS
+config:
+  addresses: [redis-1:6379, redis-2:6379]`,
+			err: true,
+		},
+		{
+			name: "redis",
+			config: `type: REDIS
+config:
+  addresses: [redis:6379]
+  master_name: master
+  db: 1
+  read_timeout: 1s
+  write_timeout: 2s
+  tls_enabled: true
+  tls_config:
+    insecure_skip_verify: true
+  max_async_concurrency: 5
+  expiration: 1h`,
+			expected: &cortexcache.Config{
+				Redis: cortexcache.RedisConfig{
+					Endpoint:           "redis:6379",
+					MasterName:         "master",
+					Timeout:            2 * time.Second,
+					Expiration:         time.Hour,
+					DB:                 1,
+					PoolSize:           100,
+					EnableTLS:          true,
+					InsecureSkipVerify: true,
+					IdleTimeout:        5 * time.Minute,
+				},
+				Background: cortexcache.BackgroundConfig{WriteBackBuffer: 10000, WriteBackGoroutines: 5},
+			},
+		},
+		{
+			name: "redis without addresses",
+			config: `type: REDIS
+config:
+  expiration: 1h`,
+			err: true,
+		},
+		{
+			name: "redis sentinel in cluster mode",
+			config: `type: REDIS
+config:
+  addresses: [redis:26379]
+  master_name: master
+  cluster_mode: true`,
+			err: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := NewCacheConfig(log.NewNopLogger(), []byte(tc.config))
+			if tc.err {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, config)
+		})
+	}
+}
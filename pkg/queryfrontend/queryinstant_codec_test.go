@@ -0,0 +1,201 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/weaveworks/common/httpgrpc"
+
+	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQueryInstantCodec_DecodeRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		url             string
+		partialResponse bool
+		expectedError   error
+		expectedRequest *ThanosQueryInstantRequest
+	}{
+		{
+			name:          "cannot parse time",
+			url:           "/api/v1/query?time=foo",
+			expectedError: httpgrpc.Errorf(http.StatusBadRequest, `cannot parse "foo" to a valid timestamp`),
+		},
+		{
+			name:          "cannot parse dedup",
+			url:           "/api/v1/query?time=123&dedup=bar",
+			expectedError: httpgrpc.Errorf(http.StatusBadRequest, "cannot parse parameter dedup"),
+		},
+		{
+			name:          "cannot parse downsampling resolution",
+			url:           "/api/v1/query?time=123&max_source_resolution=bar",
+			expectedError: httpgrpc.Errorf(http.StatusBadRequest, "cannot parse parameter max_source_resolution"),
+		},
+		{
+			name: "auto downsampling enabled",
+			url:  "/api/v1/query?time=123&query=up&max_source_resolution=auto",
+			expectedRequest: &ThanosQueryInstantRequest{
+				Path:             "/api/v1/query",
+				Time:             123000,
+				Query:            "up",
+				AutoDownsampling: true,
+				Dedup:            true,
+				StoreMatchers:    [][]*labels.Matcher{},
+			},
+		},
+		{
+			name:            "partial_response default to true",
+			url:             "/api/v1/query?time=123&query=up&max_source_resolution=5m",
+			partialResponse: true,
+			expectedRequest: &ThanosQueryInstantRequest{
+				Path:                "/api/v1/query",
+				Time:                123000,
+				Query:               "up",
+				MaxSourceResolution: 300000,
+				Dedup:               true,
+				PartialResponse:     true,
+				StoreMatchers:       [][]*labels.Matcher{},
+			},
+		},
+		{
+			name: "replicaLabels and storeMatchers",
+			url:  `/api/v1/query?time=123&query=up&replicaLabels[]=foo&storeMatch[]={cluster="test"}`,
+			expectedRequest: &ThanosQueryInstantRequest{
+				Path:          "/api/v1/query",
+				Time:          123000,
+				Query:         "up",
+				Dedup:         true,
+				ReplicaLabels: []string{"foo"},
+				StoreMatchers: [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "cluster", "test")}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			testutil.Ok(t, err)
+
+			codec := NewThanosQueryInstantCodec(tc.partialResponse)
+			req, err := codec.DecodeRequest(context.Background(), r)
+			if tc.expectedError != nil {
+				testutil.Equals(t, err, tc.expectedError)
+			} else {
+				testutil.Ok(t, err)
+				testutil.Equals(t, req, tc.expectedRequest)
+			}
+		})
+	}
+}
+
+func TestQueryInstantCodec_EncodeRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		expectedError error
+		checkFunc     func(r *http.Request) bool
+		req           queryrange.Request
+	}{
+		{
+			name:          "thanos query range request, invalid format",
+			req:           &ThanosQueryRangeRequest{},
+			expectedError: httpgrpc.Errorf(http.StatusBadRequest, "invalid request format"),
+		},
+		{
+			name: "normal thanos request",
+			req: &ThanosQueryInstantRequest{
+				Time:  123000,
+				Query: "up",
+				Dedup: true,
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("time") == "123" &&
+					r.FormValue("query") == "up" &&
+					r.FormValue(queryv1.DedupParam) == "true" &&
+					r.FormValue(queryv1.MaxSourceResolutionParam) == ""
+			},
+		},
+		{
+			name: "auto downsampling",
+			req: &ThanosQueryInstantRequest{
+				Time:             123000,
+				AutoDownsampling: true,
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue(queryv1.MaxSourceResolutionParam) == "auto"
+			},
+		},
+		{
+			name: "downsampling resolution",
+			req: &ThanosQueryInstantRequest{
+				Time:                123000,
+				MaxSourceResolution: 300000,
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue(queryv1.MaxSourceResolutionParam) == "300"
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			codec := NewThanosQueryInstantCodec(false)
+			r, err := codec.EncodeRequest(context.TODO(), tc.req)
+			if tc.expectedError != nil {
+				testutil.Equals(t, err, tc.expectedError)
+			} else {
+				testutil.Ok(t, err)
+				testutil.Equals(t, true, tc.checkFunc(r))
+			}
+		})
+	}
+}
+
+func TestQueryInstantCodec_DecodeResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		body             string
+		expectedResponse *ThanosQueryInstantResponse
+	}{
+		{
+			name: "vector",
+			body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"up"},"value":[123,"1"]}]}}`,
+			expectedResponse: &ThanosQueryInstantResponse{
+				Status: "success",
+				Data:   QueryData{ResultType: "vector", Result: []byte(`[{"metric":{"__name__":"up"},"value":[123,"1"]}]`)},
+			},
+		},
+		{
+			name: "scalar with warnings",
+			body: `{"status":"success","data":{"resultType":"scalar","result":[123,"1"]},"warnings":["partial response"]}`,
+			expectedResponse: &ThanosQueryInstantResponse{
+				Status:   "success",
+				Data:     QueryData{ResultType: "scalar", Result: []byte(`[123,"1"]`)},
+				Warnings: []string{"partial response"},
+				// Responses with warnings are not cached.
+				Headers: []*ResponseHeader{{Name: cacheControlHeader, Values: []string{noStoreValue}}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Default partial response value doesn't matter when decoding responses.
+			codec := NewThanosQueryInstantCodec(false)
+			res := &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(tc.body))}
+			r, err := codec.DecodeResponse(context.TODO(), res, &ThanosQueryInstantRequest{})
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expectedResponse, r)
+
+			// The result is sent back as it was received.
+			httpRes, err := codec.EncodeResponse(context.TODO(), r)
+			testutil.Ok(t, err)
+			b, err := ioutil.ReadAll(httpRes.Body)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.body, string(b))
+		})
+	}
+}
@@ -156,6 +156,17 @@ func (c queryRangeCodec) EncodeRequest(ctx context.Context, r queryrange.Request
 		params[queryv1.StoreMatcherParam] = matchersToStringSlice(thanosReq.StoreMatchers)
 	}
 
+	if s := thanosReq.ShardInfo; s != nil {
+		grouping := "without"
+		if s.By {
+			grouping = "by"
+		}
+		params[queryv1.ShardIndexParam] = []string{strconv.Itoa(s.ShardIndex)}
+		params[queryv1.TotalShardsParam] = []string{strconv.Itoa(s.TotalShards)}
+		params[queryv1.ShardGroupingParam] = []string{grouping}
+		params[queryv1.ShardLabelsParam] = s.Labels
+	}
+
 	req, err := http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
 	if err != nil {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
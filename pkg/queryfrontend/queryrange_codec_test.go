@@ -7,6 +7,7 @@ package queryfrontend
 import (
 	"context"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
@@ -15,6 +16,7 @@ import (
 
 	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -268,6 +270,24 @@ func TestQueryRangeCodec_EncodeRequest(t *testing.T) {
 					r.FormValue(queryv1.MaxSourceResolutionParam) == "3600"
 			},
 		},
+		{
+			name: "Shard set",
+			req: &ThanosQueryRangeRequest{
+				Start:     123000,
+				End:       456000,
+				Step:      1000,
+				ShardInfo: query.NewShardInfo(1, 3, true, []string{"job", "env"}),
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					r.FormValue(queryv1.ShardIndexParam) == "1" &&
+					r.FormValue(queryv1.TotalShardsParam) == "3" &&
+					r.FormValue(queryv1.ShardGroupingParam) == "by" &&
+					strings.Join(r.Form[queryv1.ShardLabelsParam], ",") == "env,job"
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			// Default partial response value doesn't matter when encoding requests.
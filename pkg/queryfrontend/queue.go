@@ -0,0 +1,170 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/scheduler/queue"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// QueueRoundTripper is a http.RoundTripper which queues the requests per tenant before sending them downstream.
+// A fixed number of workers send the queued requests, picking the tenants in turn, so that the requests of a tenant
+// cannot starve the requests of the other tenants.
+type QueueRoundTripper struct {
+	next    http.RoundTripper
+	queue   *queue.RequestQueue
+	workers int
+	logger  log.Logger
+
+	// Metrics.
+	queueLength       *prometheus.GaugeVec
+	queueDuration     prometheus.Histogram
+	discardedRequests *prometheus.CounterVec
+}
+
+type queuedRequest struct {
+	req        *http.Request
+	enqueuedAt time.Time
+	response   chan queuedResponse
+}
+
+type queuedResponse struct {
+	res *http.Response
+	err error
+}
+
+// NewQueueRoundTripper returns a QueueRoundTripper queueing at most maxOutstandingPerTenant requests per tenant and
+// sending at most workers requests downstream at a time. Run has to be called for the requests to be sent.
+func NewQueueRoundTripper(next http.RoundTripper, maxOutstandingPerTenant, workers int, logger log.Logger, reg prometheus.Registerer) *QueueRoundTripper {
+	queueLength := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "thanos_query_frontend_queue_length",
+		Help: "Number of queued requests per tenant.",
+	}, []string{"tenant"})
+	return &QueueRoundTripper{
+		next:        next,
+		queue:       queue.NewRequestQueue(maxOutstandingPerTenant, queueLength),
+		workers:     workers,
+		logger:      logger,
+		queueLength: queueLength,
+		queueDuration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "thanos_query_frontend_queue_duration_seconds",
+			Help:    "Time spent by the requests in the queue.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		discardedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_query_frontend_discarded_requests_total",
+			Help: "Total number of requests discarded because the queue of their tenant was full.",
+		}, []string{"tenant"}),
+	}
+}
+
+// RoundTrip queues the request in the queue of its tenant and waits for its response.
+func (q *QueueRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	tenant, err := user.ExtractOrgID(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	qr := &queuedRequest{
+		req:        r,
+		enqueuedAt: time.Now(),
+		// Buffered, so that the workers do not block on the requests whose callers stopped waiting.
+		response: make(chan queuedResponse, 1),
+	}
+	if err := q.queue.EnqueueRequest(tenant, qr, 0, nil); err != nil {
+		if err == queue.ErrTooManyRequests {
+			q.discardedRequests.WithLabelValues(tenant).Inc()
+			return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "too many outstanding requests for tenant %s", tenant)
+		}
+		return nil, errors.Wrap(err, "enqueue request")
+	}
+
+	select {
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	case resp := <-qr.response:
+		return resp.res, resp.err
+	}
+}
+
+// Run starts the workers sending the queued requests downstream. It blocks until the context is canceled and all
+// the requests queued before are sent.
+func (q *QueueRoundTripper) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			q.runWorker(id)
+		}(fmt.Sprintf("worker-%d", i))
+	}
+
+	<-ctx.Done()
+	// Stop waits for the queued requests to be dispatched, then stops the workers.
+	q.queue.Stop()
+	wg.Wait()
+	return nil
+}
+
+func (q *QueueRoundTripper) runWorker(id string) {
+	q.queue.RegisterQuerierConnection(id)
+	defer q.queue.UnregisterQuerierConnection(id)
+
+	last := queue.FirstUser()
+	for {
+		// The queue is stopped by Run, so the requests queued before are dispatched.
+		req, idx, err := q.queue.GetNextRequestForQuerier(context.Background(), last, id)
+		if err != nil {
+			if err != queue.ErrStopped {
+				level.Error(q.logger).Log("msg", "get next queued request", "err", err)
+			}
+			return
+		}
+		last = idx
+
+		qr := req.(*queuedRequest)
+		q.queueDuration.Observe(time.Since(qr.enqueuedAt).Seconds())
+
+		// Pick the next request of the same tenant if the caller of this one stopped waiting.
+		if err := qr.req.Context().Err(); err != nil {
+			qr.response <- queuedResponse{err: err}
+			last = last.ReuseLastUser()
+			continue
+		}
+		qr.response <- q.send(qr.req)
+	}
+}
+
+// send sends the request downstream and reads the whole response body, so that the workers bound the number of
+// requests in flight until they are completed.
+func (q *QueueRoundTripper) send(r *http.Request) queuedResponse {
+	res, err := q.next.RoundTrip(r)
+	if err != nil {
+		return queuedResponse{err: err}
+	}
+	defer runutil.CloseWithLogOnErr(q.logger, res.Body, "downstream response body")
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return queuedResponse{err: errors.Wrap(err, "read response body")}
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return queuedResponse{res: res}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQueueRoundTripper(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		mtx     sync.Mutex
+		served  []string
+		started = make(chan struct{})
+		unblock = make(chan struct{})
+	)
+	next := queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		tenant, err := user.ExtractOrgID(r.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		mtx.Lock()
+		served = append(served, tenant+r.URL.Path)
+		first := len(served) == 1
+		mtx.Unlock()
+
+		// Block the only worker on the first request, until the other requests are queued.
+		if first {
+			close(started)
+			<-unblock
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(tenant))}, nil
+	})
+
+	q := NewQueueRoundTripper(next, 2, 1, log.NewNopLogger(), prometheus.NewRegistry())
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- q.Run(runCtx) }()
+
+	roundTrip := func(tenant, path string) error {
+		r, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return err
+		}
+		res, err := q.RoundTrip(r.WithContext(user.InjectOrgID(ctx, tenant)))
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		if string(b) != tenant {
+			return errors.Errorf("unexpected response %q for tenant %s", string(b), tenant)
+		}
+		return nil
+	}
+	waitQueueLength := func(tenant string, expected float64) {
+		testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+			if l := promtestutil.ToFloat64(q.queueLength.WithLabelValues(tenant)); l != expected {
+				return errors.Errorf("queue length of tenant %s is %v, expected %v", tenant, l, expected)
+			}
+			return nil
+		}))
+	}
+
+	errs := make(chan error, 4)
+	go func() { errs <- roundTrip("a", "/0") }()
+	<-started
+
+	go func() { errs <- roundTrip("a", "/1") }()
+	waitQueueLength("a", 1)
+	go func() { errs <- roundTrip("a", "/2") }()
+	waitQueueLength("a", 2)
+
+	// The queue of tenant a is full.
+	testutil.Equals(t, httpgrpc.Errorf(http.StatusTooManyRequests, "too many outstanding requests for tenant a"), roundTrip("a", "/3"))
+
+	go func() { errs <- roundTrip("b", "/0") }()
+	waitQueueLength("b", 1)
+
+	close(unblock)
+	for i := 0; i < 4; i++ {
+		testutil.Ok(t, <-errs)
+	}
+
+	// The request of tenant b is served before the requests of tenant a queued before it.
+	mtx.Lock()
+	testutil.Equals(t, []string{"a/0", "b/0", "a/1", "a/2"}, served)
+	mtx.Unlock()
+
+	stop()
+	testutil.Ok(t, <-done)
+}
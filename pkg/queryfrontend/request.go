@@ -11,6 +11,8 @@ import (
 	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/timestamp"
+
+	"github.com/thanos-io/thanos/pkg/query"
 )
 
 // TODO(yeya24): add partial result when needed.
@@ -33,6 +35,8 @@ type ThanosQueryRangeRequest struct {
 	ReplicaLabels       []string
 	StoreMatchers       [][]*labels.Matcher
 	CachingOptions      queryrange.CachingOptions
+	// ShardInfo is the shard of the series the request is restricted to, if any.
+	ShardInfo *query.ShardInfo
 }
 
 // GetStart returns the start timestamp of the request in milliseconds.
@@ -80,6 +84,9 @@ func (r *ThanosQueryRangeRequest) LogToSpan(sp opentracing.Span) {
 		otlog.Bool("auto-downsampling", r.AutoDownsampling),
 		otlog.Int64("max_source_resolution (ms)", r.MaxSourceResolution),
 	}
+	if r.ShardInfo != nil {
+		fields = append(fields, otlog.Int("shard_index", r.ShardInfo.ShardIndex), otlog.Int("shard_count", r.ShardInfo.TotalShards))
+	}
 
 	sp.LogFields(fields...)
 }
@@ -98,6 +105,82 @@ func (r *ThanosQueryRangeRequest) ProtoMessage() {}
 
 func (r *ThanosQueryRangeRequest) GetStoreMatchers() [][]*labels.Matcher { return r.StoreMatchers }
 
+type ThanosQueryInstantRequest struct {
+	Path                string
+	Time                int64
+	Timeout             time.Duration
+	Query               string
+	Dedup               bool
+	PartialResponse     bool
+	AutoDownsampling    bool
+	MaxSourceResolution int64
+	ReplicaLabels       []string
+	StoreMatchers       [][]*labels.Matcher
+	CachingOptions      queryrange.CachingOptions
+}
+
+// GetStart returns the evaluation timestamp of the request in milliseconds.
+func (r *ThanosQueryInstantRequest) GetStart() int64 { return r.Time }
+
+// GetEnd returns the evaluation timestamp of the request in milliseconds.
+func (r *ThanosQueryInstantRequest) GetEnd() int64 { return r.Time }
+
+// GetStep returns the step of the request in milliseconds. Returns 1 is a trick to avoid panic in
+// https://github.com/cortexproject/cortex/blob/master/pkg/querier/queryrange/results_cache.go#L447.
+func (r *ThanosQueryInstantRequest) GetStep() int64 { return 1 }
+
+// GetQuery returns the query of the request.
+func (r *ThanosQueryInstantRequest) GetQuery() string { return r.Query }
+
+func (r *ThanosQueryInstantRequest) GetCachingOptions() queryrange.CachingOptions {
+	return r.CachingOptions
+}
+
+// WithStartEnd clone the current request with a different evaluation timestamp. Only the start timestamp is used,
+// as instant queries are evaluated at a single timestamp.
+func (r *ThanosQueryInstantRequest) WithStartEnd(start int64, _ int64) queryrange.Request {
+	q := *r
+	q.Time = start
+	return &q
+}
+
+// WithQuery clone the current request with a different query.
+func (r *ThanosQueryInstantRequest) WithQuery(query string) queryrange.Request {
+	q := *r
+	q.Query = query
+	return &q
+}
+
+// LogToSpan writes information about this request to an OpenTracing span.
+func (r *ThanosQueryInstantRequest) LogToSpan(sp opentracing.Span) {
+	fields := []otlog.Field{
+		otlog.String("query", r.GetQuery()),
+		otlog.String("time", timestamp.Time(r.GetStart()).String()),
+		otlog.Bool("dedup", r.Dedup),
+		otlog.Bool("partial_response", r.PartialResponse),
+		otlog.Object("replicaLabels", r.ReplicaLabels),
+		otlog.Object("storeMatchers", r.StoreMatchers),
+		otlog.Bool("auto-downsampling", r.AutoDownsampling),
+		otlog.Int64("max_source_resolution (ms)", r.MaxSourceResolution),
+	}
+
+	sp.LogFields(fields...)
+}
+
+// Reset implements proto.Message interface required by queryrange.Request,
+// which is not used in thanos.
+func (r *ThanosQueryInstantRequest) Reset() {}
+
+// String implements proto.Message interface required by queryrange.Request,
+// which is not used in thanos.
+func (r *ThanosQueryInstantRequest) String() string { return "" }
+
+// ProtoMessage implements proto.Message interface required by queryrange.Request,
+// which is not used in thanos.
+func (r *ThanosQueryInstantRequest) ProtoMessage() {}
+
+func (r *ThanosQueryInstantRequest) GetStoreMatchers() [][]*labels.Matcher { return r.StoreMatchers }
+
 type ThanosLabelsRequest struct {
 	Start           int64
 	End             int64
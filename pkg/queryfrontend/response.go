@@ -4,6 +4,7 @@
 package queryfrontend
 
 import (
+	"encoding/json"
 	"unsafe"
 
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
@@ -25,6 +26,8 @@ func (ThanosResponseExtractor) ResponseWithoutHeaders(resp queryrange.Response)
 		return &ThanosLabelsResponse{Status: queryrange.StatusSuccess, Data: tr.Data}
 	case *ThanosSeriesResponse:
 		return &ThanosSeriesResponse{Status: queryrange.StatusSuccess, Data: tr.Data}
+	case *ThanosQueryInstantResponse:
+		return &ThanosQueryInstantResponse{Status: queryrange.StatusSuccess, Data: tr.Data, Warnings: tr.Warnings}
 	}
 	return resp
 }
@@ -44,3 +47,34 @@ func (m *ThanosLabelsResponse) GetHeaders() []*queryrange.PrometheusResponseHead
 func (m *ThanosSeriesResponse) GetHeaders() []*queryrange.PrometheusResponseHeader {
 	return headersToQueryRangeHeaders(m.Headers)
 }
+
+// GetHeaders returns the HTTP headers in the response.
+func (m *ThanosQueryInstantResponse) GetHeaders() []*queryrange.PrometheusResponseHeader {
+	return headersToQueryRangeHeaders(m.Headers)
+}
+
+// MarshalJSON encodes the result of an instant query as it was received from the querier.
+func (m QueryData) MarshalJSON() ([]byte, error) {
+	result := json.RawMessage(m.Result)
+	if len(result) == 0 {
+		result = json.RawMessage("[]")
+	}
+	return json.Marshal(struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}{ResultType: m.ResultType, Result: result})
+}
+
+// UnmarshalJSON keeps the result of an instant query in its JSON encoding, so that it is cached without being decoded.
+func (m *QueryData) UnmarshalJSON(b []byte) error {
+	var data struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	m.ResultType = data.ResultType
+	m.Result = data.Result
+	return nil
+}
@@ -145,39 +145,130 @@ func (m *ResponseHeader) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_ResponseHeader proto.InternalMessageInfo
 
+type ThanosQueryInstantResponse struct {
+	Status    string            `protobuf:"bytes,1,opt,name=Status,proto3" json:"status"`
+	Data      QueryData         `protobuf:"bytes,2,opt,name=Data,proto3" json:"data,omitempty"`
+	ErrorType string            `protobuf:"bytes,3,opt,name=ErrorType,proto3" json:"errorType,omitempty"`
+	Error     string            `protobuf:"bytes,4,opt,name=Error,proto3" json:"error,omitempty"`
+	Warnings  []string          `protobuf:"bytes,5,rep,name=Warnings,proto3" json:"warnings,omitempty"`
+	Headers   []*ResponseHeader `protobuf:"bytes,6,rep,name=Headers,proto3" json:"-"`
+}
+
+func (m *ThanosQueryInstantResponse) Reset()         { *m = ThanosQueryInstantResponse{} }
+func (m *ThanosQueryInstantResponse) String() string { return proto.CompactTextString(m) }
+func (*ThanosQueryInstantResponse) ProtoMessage()    {}
+func (*ThanosQueryInstantResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b882fa7024d92f38, []int{3}
+}
+func (m *ThanosQueryInstantResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ThanosQueryInstantResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ThanosQueryInstantResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ThanosQueryInstantResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ThanosQueryInstantResponse.Merge(m, src)
+}
+func (m *ThanosQueryInstantResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *ThanosQueryInstantResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ThanosQueryInstantResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ThanosQueryInstantResponse proto.InternalMessageInfo
+
+// QueryData is the data of an instant query response. The result is kept in its JSON encoding, as it is only
+// cached and returned as is.
+type QueryData struct {
+	ResultType string `protobuf:"bytes,1,opt,name=ResultType,proto3" json:"resultType"`
+	Result     []byte `protobuf:"bytes,2,opt,name=Result,proto3" json:"result"`
+}
+
+func (m *QueryData) Reset()         { *m = QueryData{} }
+func (m *QueryData) String() string { return proto.CompactTextString(m) }
+func (*QueryData) ProtoMessage()    {}
+func (*QueryData) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b882fa7024d92f38, []int{4}
+}
+func (m *QueryData) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *QueryData) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_QueryData.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *QueryData) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryData.Merge(m, src)
+}
+func (m *QueryData) XXX_Size() int {
+	return m.Size()
+}
+func (m *QueryData) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryData.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryData proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterType((*ThanosLabelsResponse)(nil), "queryfrontend.ThanosLabelsResponse")
 	proto.RegisterType((*ThanosSeriesResponse)(nil), "queryfrontend.ThanosSeriesResponse")
 	proto.RegisterType((*ResponseHeader)(nil), "queryfrontend.ResponseHeader")
+	proto.RegisterType((*ThanosQueryInstantResponse)(nil), "queryfrontend.ThanosQueryInstantResponse")
+	proto.RegisterType((*QueryData)(nil), "queryfrontend.QueryData")
 }
 
 func init() { proto.RegisterFile("queryfrontend/response.proto", fileDescriptor_b882fa7024d92f38) }
 
 var fileDescriptor_b882fa7024d92f38 = []byte{
-	// 367 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x92, 0x41, 0x4f, 0xea, 0x40,
-	0x14, 0x85, 0x5b, 0x28, 0x7d, 0x8f, 0xe1, 0x3d, 0x8d, 0x03, 0x89, 0x85, 0x40, 0x4b, 0x58, 0x61,
-	0xa2, 0x6d, 0x02, 0x71, 0xeb, 0xa2, 0xd1, 0xc4, 0x18, 0xe3, 0xa2, 0x10, 0x17, 0xee, 0x86, 0x70,
-	0x45, 0x12, 0xe8, 0xd4, 0x99, 0x61, 0xd1, 0x7f, 0xa1, 0xff, 0x8a, 0x25, 0x4b, 0x57, 0x8d, 0xc2,
-	0xae, 0x3f, 0xc1, 0x95, 0x61, 0x3a, 0x8d, 0xb0, 0x74, 0xe9, 0x6e, 0xe6, 0x9c, 0xef, 0xde, 0xe4,
-	0x9c, 0x5c, 0xd4, 0x7c, 0x5e, 0x00, 0x8b, 0x1f, 0x19, 0x0d, 0x05, 0x84, 0x63, 0x8f, 0x01, 0x8f,
-	0x68, 0xc8, 0xc1, 0x8d, 0x18, 0x15, 0x14, 0xff, 0xdf, 0x73, 0x1b, 0xb5, 0x09, 0x9d, 0x50, 0xe9,
-	0x78, 0xdb, 0x57, 0x06, 0x35, 0xea, 0x5c, 0x50, 0x06, 0xde, 0x8c, 0x8c, 0x60, 0x16, 0x8d, 0x3c,
-	0x11, 0x47, 0xc0, 0x33, 0xab, 0xf3, 0xa9, 0xa3, 0xda, 0xf0, 0x89, 0x84, 0x94, 0xdf, 0x6e, 0x5d,
-	0x1e, 0xa8, 0xf5, 0xb8, 0x83, 0xcc, 0x81, 0x20, 0x62, 0xc1, 0x2d, 0xbd, 0xad, 0x77, 0xcb, 0x3e,
-	0x4a, 0x13, 0xc7, 0xe4, 0x52, 0x09, 0x94, 0x83, 0x9b, 0xc8, 0xb8, 0x24, 0x82, 0x58, 0x85, 0x76,
-	0xb1, 0x5b, 0xf6, 0xff, 0xa6, 0x89, 0x63, 0x8c, 0x89, 0x20, 0x81, 0x54, 0xf1, 0x39, 0x2a, 0x5f,
-	0x31, 0x46, 0xd9, 0x30, 0x8e, 0xc0, 0x2a, 0xca, 0x25, 0xc7, 0x69, 0xe2, 0x54, 0x21, 0x17, 0x4f,
-	0xe9, 0x7c, 0x2a, 0x60, 0x1e, 0x89, 0x38, 0xf8, 0x26, 0xf1, 0x09, 0x2a, 0xc9, 0x8f, 0x65, 0xc8,
-	0x91, 0x6a, 0x9a, 0x38, 0x87, 0x72, 0x64, 0x07, 0xcf, 0x08, 0x7c, 0x81, 0xfe, 0x5c, 0x03, 0x19,
-	0x03, 0xe3, 0x56, 0xa9, 0x5d, 0xec, 0x56, 0x7a, 0x2d, 0x77, 0xaf, 0x0e, 0x37, 0x4f, 0x93, 0x51,
-	0x7e, 0x29, 0x4d, 0x1c, 0xfd, 0x2c, 0xc8, 0x87, 0x3a, 0xaf, 0x85, 0x3c, 0xfc, 0x00, 0xd8, 0x14,
-	0x7e, 0x16, 0xbe, 0xbf, 0x13, 0xbe, 0xd2, 0x3b, 0x72, 0x85, 0x5c, 0xe4, 0x3e, 0xc8, 0x1e, 0x07,
-	0x20, 0xfc, 0x7f, 0xcb, 0xc4, 0xd1, 0x7e, 0x5d, 0x27, 0x37, 0xe8, 0x60, 0x9f, 0xc0, 0x75, 0x64,
-	0xdc, 0x91, 0x39, 0xa8, 0x2a, 0x14, 0x2f, 0x25, 0xdc, 0x42, 0xe6, 0x3d, 0x99, 0x2d, 0x80, 0xab,
-	0x13, 0x50, 0xa6, 0x12, 0xfd, 0xe6, 0xf2, 0xc3, 0xd6, 0x96, 0x6b, 0x5b, 0x5f, 0xad, 0x6d, 0xfd,
-	0x7d, 0x6d, 0xeb, 0x2f, 0x1b, 0x5b, 0x5b, 0x6d, 0x6c, 0xed, 0x6d, 0x63, 0x6b, 0x23, 0x53, 0x5e,
-	0x60, 0xff, 0x2b, 0x00, 0x00, 0xff, 0xff, 0x6d, 0x4c, 0xcd, 0xdf, 0xe1, 0x02, 0x00, 0x00,
+	// 477 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x94, 0x4f, 0x8b, 0xd3, 0x40,
+	0x18, 0xc6, 0x93, 0xfe, 0x89, 0x9b, 0xb7, 0x6b, 0xc5, 0xd9, 0x65, 0xcd, 0x96, 0x6e, 0x52, 0x7a,
+	0xaa, 0xa0, 0x29, 0x74, 0xf1, 0xea, 0x21, 0xac, 0xa0, 0x22, 0x82, 0xe9, 0xa2, 0xe0, 0x45, 0xa6,
+	0xf4, 0xb5, 0x16, 0xda, 0x4c, 0x9c, 0x99, 0x22, 0xfd, 0x16, 0xfa, 0xad, 0x7a, 0xdc, 0xa3, 0x07,
+	0x09, 0xda, 0xde, 0xf2, 0x11, 0x3c, 0x49, 0x66, 0xa6, 0x35, 0xf5, 0x56, 0x0f, 0x82, 0xb7, 0xcc,
+	0xf3, 0x3c, 0xef, 0x4b, 0x9e, 0xdf, 0x84, 0x40, 0xfb, 0xe3, 0x02, 0xf9, 0xf2, 0x3d, 0x67, 0x89,
+	0xc4, 0x64, 0xdc, 0xe7, 0x28, 0x52, 0x96, 0x08, 0x0c, 0x53, 0xce, 0x24, 0x23, 0xb7, 0xf7, 0xdc,
+	0xd6, 0xe9, 0x84, 0x4d, 0x98, 0x72, 0xfa, 0xc5, 0x93, 0x0e, 0xb5, 0xce, 0x85, 0x64, 0x1c, 0xfb,
+	0x33, 0x3a, 0xc2, 0x59, 0x3a, 0xea, 0xcb, 0x65, 0x8a, 0x42, 0x5b, 0xdd, 0x9f, 0x36, 0x9c, 0x5e,
+	0x7f, 0xa0, 0x09, 0x13, 0x2f, 0x0a, 0x57, 0xc4, 0x66, 0x3d, 0xe9, 0x82, 0x33, 0x94, 0x54, 0x2e,
+	0x84, 0x67, 0x77, 0xec, 0x9e, 0x1b, 0x41, 0x9e, 0x05, 0x8e, 0x50, 0x4a, 0x6c, 0x1c, 0xd2, 0x86,
+	0xda, 0x15, 0x95, 0xd4, 0xab, 0x74, 0xaa, 0x3d, 0x37, 0x3a, 0xca, 0xb3, 0xa0, 0x36, 0xa6, 0x92,
+	0xc6, 0x4a, 0x25, 0x8f, 0xc0, 0x7d, 0xc2, 0x39, 0xe3, 0xd7, 0xcb, 0x14, 0xbd, 0xaa, 0x5a, 0x72,
+	0x2f, 0xcf, 0x82, 0x13, 0xdc, 0x8a, 0x0f, 0xd8, 0x7c, 0x2a, 0x71, 0x9e, 0xca, 0x65, 0xfc, 0x3b,
+	0x49, 0xee, 0x43, 0x5d, 0x1d, 0xbc, 0x9a, 0x1a, 0x39, 0xc9, 0xb3, 0xe0, 0x8e, 0x1a, 0x29, 0xc5,
+	0x75, 0x82, 0x3c, 0x86, 0x5b, 0x4f, 0x91, 0x8e, 0x91, 0x0b, 0xaf, 0xde, 0xa9, 0xf6, 0x1a, 0x83,
+	0x8b, 0x70, 0x0f, 0x47, 0xb8, 0x6d, 0xa3, 0x53, 0x51, 0x3d, 0xcf, 0x02, 0xfb, 0x61, 0xbc, 0x1d,
+	0xea, 0x7e, 0xa9, 0x6c, 0xcb, 0x0f, 0x91, 0x4f, 0xf1, 0xb0, 0xf2, 0x97, 0xa5, 0xf2, 0x8d, 0xc1,
+	0xdd, 0x50, 0xaa, 0x45, 0xe1, 0x5b, 0xc5, 0x71, 0x88, 0x32, 0x3a, 0x5e, 0x65, 0x81, 0xf5, 0xdf,
+	0x31, 0x79, 0x0e, 0xcd, 0xfd, 0x04, 0x39, 0x87, 0xda, 0x4b, 0x3a, 0x47, 0x83, 0xc2, 0xe4, 0x95,
+	0x44, 0x2e, 0xc0, 0x79, 0x4d, 0x67, 0x0b, 0x14, 0xe6, 0x13, 0x30, 0xa6, 0x11, 0xbb, 0xdf, 0x2a,
+	0xd0, 0xd2, 0x7c, 0x5f, 0x15, 0xaf, 0xf0, 0x2c, 0x11, 0x92, 0x26, 0xf2, 0x20, 0xca, 0x57, 0x3b,
+	0xca, 0x76, 0xaf, 0x31, 0xf0, 0xfe, 0xe8, 0xa2, 0xd6, 0x16, 0x7e, 0x74, 0x66, 0x60, 0x37, 0x0b,
+	0xd8, 0x25, 0x2a, 0xff, 0x0a, 0xfb, 0x00, 0x8e, 0xde, 0x50, 0x9e, 0x4c, 0x93, 0x89, 0xe6, 0xee,
+	0x46, 0x67, 0x79, 0x16, 0x90, 0x4f, 0x46, 0x2b, 0x0d, 0xec, 0x72, 0xe5, 0xab, 0x72, 0xfe, 0xe6,
+	0xaa, 0xde, 0x81, 0xbb, 0x03, 0x40, 0x42, 0x80, 0x18, 0xc5, 0x62, 0x26, 0x55, 0x47, 0x0d, 0xb4,
+	0x99, 0x67, 0x01, 0xf0, 0x9d, 0x1a, 0x97, 0x12, 0x05, 0x7c, 0x7d, 0x52, 0x68, 0x8f, 0x35, 0x7c,
+	0x9d, 0x8d, 0x8d, 0x13, 0xb5, 0x57, 0x3f, 0x7c, 0x6b, 0xb5, 0xf6, 0xed, 0x9b, 0xb5, 0x6f, 0x7f,
+	0x5f, 0xfb, 0xf6, 0xe7, 0x8d, 0x6f, 0xdd, 0x6c, 0x7c, 0xeb, 0xeb, 0xc6, 0xb7, 0x46, 0x8e, 0xfa,
+	0x83, 0x5c, 0xfe, 0x1a, 0x00, 0xa1, 0x29, 0x9e, 0x22, 0xa1, 0x04, 0x00, 0x00,
 }
 
 func (m *ThanosLabelsResponse) Marshal() (dAtA []byte, err error) {
@@ -358,6 +449,120 @@ func (m *ResponseHeader) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *ThanosQueryInstantResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ThanosQueryInstantResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ThanosQueryInstantResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Headers) > 0 {
+		for iNdEx := len(m.Headers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Headers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintResponse(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if len(m.Warnings) > 0 {
+		for iNdEx := len(m.Warnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Warnings[iNdEx])
+			copy(dAtA[i:], m.Warnings[iNdEx])
+			i = encodeVarintResponse(dAtA, i, uint64(len(m.Warnings[iNdEx])))
+			i--
+			dAtA[i] = 0x2a
+		}
+	}
+	if len(m.Error) > 0 {
+		i -= len(m.Error)
+		copy(dAtA[i:], m.Error)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.Error)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.ErrorType) > 0 {
+		i -= len(m.ErrorType)
+		copy(dAtA[i:], m.ErrorType)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.ErrorType)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	{
+		size, err := m.Data.MarshalToSizedBuffer(dAtA[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarintResponse(dAtA, i, uint64(size))
+	}
+	i--
+	dAtA[i] = 0x12
+	if len(m.Status) > 0 {
+		i -= len(m.Status)
+		copy(dAtA[i:], m.Status)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.Status)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *QueryData) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *QueryData) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *QueryData) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Result) > 0 {
+		i -= len(m.Result)
+		copy(dAtA[i:], m.Result)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.Result)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.ResultType) > 0 {
+		i -= len(m.ResultType)
+		copy(dAtA[i:], m.ResultType)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.ResultType)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintResponse(dAtA []byte, offset int, v uint64) int {
 	offset -= sovResponse(v)
 	base := offset
@@ -454,6 +659,58 @@ func (m *ResponseHeader) Size() (n int) {
 	return n
 }
 
+func (m *ThanosQueryInstantResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Status)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	l = m.Data.Size()
+	n += 1 + l + sovResponse(uint64(l))
+	l = len(m.ErrorType)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	l = len(m.Error)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			l = len(s)
+			n += 1 + l + sovResponse(uint64(l))
+		}
+	}
+	if len(m.Headers) > 0 {
+		for _, e := range m.Headers {
+			l = e.Size()
+			n += 1 + l + sovResponse(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *QueryData) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.ResultType)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	l = len(m.Result)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	return n
+}
+
 func sovResponse(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
 }
@@ -1009,6 +1266,373 @@ func (m *ResponseHeader) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *ThanosQueryInstantResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowResponse
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ThanosQueryInstantResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ThanosQueryInstantResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Status", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Status = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.Data.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ErrorType", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ErrorType = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Error", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Error = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Headers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Headers = append(m.Headers, &ResponseHeader{})
+			if err := m.Headers[len(m.Headers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipResponse(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *QueryData) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowResponse
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: QueryData: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: QueryData: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResultType", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ResultType = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Result", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Result = append(m.Result[:0], dAtA[iNdEx:postIndex]...)
+			if m.Result == nil {
+				m.Result = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipResponse(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipResponse(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
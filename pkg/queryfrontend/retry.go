@@ -0,0 +1,162 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+)
+
+// retryBackoff is the backoff between the tries of a request, giving the downstream queriers some time to recover,
+// e.g. to be restarted.
+var retryBackoff = util.BackoffConfig{MinBackoff: 50 * time.Millisecond, MaxBackoff: time.Second}
+
+// RetryMiddleware creates a new Middleware that tries the requests failing with a 5xx or non HTTP error up to
+// maxTries times, with a backoff between the tries. All the requests passing through query frontend are reads,
+// so trying them again has no side effect. The retries are limited by the given budget, if not nil.
+func RetryMiddleware(logger log.Logger, maxTries int, budget *RetryBudget, registerer prometheus.Registerer) queryrange.Middleware {
+	retriesCount := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: "thanos",
+		Name:      "frontend_retries_total",
+		Help:      "Total number of retried requests sent to the downstream queriers",
+	})
+	// Kept from the retry middleware of Cortex, so that the existing dashboards and alerts still work.
+	retries := promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+		Namespace: "cortex",
+		Name:      "query_frontend_retries",
+		Help:      "Number of times a request is retried.",
+		Buckets:   []float64{0, 1, 2, 3, 4, 5},
+	})
+	budgetExhaustedCount := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Namespace: "thanos",
+		Name:      "frontend_retry_budget_exhausted_total",
+		Help:      "Total number of failed requests not retried because the retry budget was exhausted",
+	})
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return retry{
+			next:                 next,
+			logger:               logger,
+			maxTries:             maxTries,
+			budget:               budget,
+			retriesCount:         retriesCount,
+			retries:              retries,
+			budgetExhaustedCount: budgetExhaustedCount,
+		}
+	})
+}
+
+type retry struct {
+	next     queryrange.Handler
+	logger   log.Logger
+	maxTries int
+	budget   *RetryBudget
+
+	// Metrics.
+	retriesCount         prometheus.Counter
+	retries              prometheus.Histogram
+	budgetExhaustedCount prometheus.Counter
+}
+
+func (r retry) Do(ctx context.Context, req queryrange.Request) (queryrange.Response, error) {
+	r.budget.deposit()
+
+	var (
+		backoff = util.NewBackoff(ctx, retryBackoff)
+		lastErr error
+		retries int
+	)
+	defer func() { r.retries.Observe(float64(retries)) }()
+
+	for tries := 0; tries < r.maxTries; tries++ {
+		if tries > 0 {
+			if !r.budget.withdraw() {
+				r.budgetExhaustedCount.Inc()
+				return nil, lastErr
+			}
+			backoff.Wait()
+			r.retriesCount.Inc()
+			retries++
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		resp, err := r.next.Do(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		if !retryable(err) {
+			return nil, err
+		}
+		lastErr = err
+		level.Error(util.WithContext(ctx, r.logger)).Log("msg", "error processing request", "try", tries, "err", err)
+	}
+	return nil, lastErr
+}
+
+// retryable returns true if the request failed with a 5xx or non HTTP error, which was not caused by the
+// cancellation of the request.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	httpResp, ok := httpgrpc.HTTPResponseFromError(err)
+	return !ok || httpResp.Code/100 == 5
+}
+
+// RetryBudget limits the retries to a ratio of the requests, so that the retries do not overload the downstream
+// queriers when most requests fail. Every request adds ratio to the budget and every retry takes one from it. Up
+// to burst retries can be accumulated, so that short streaks of failures, e.g. of the parts of a query split by
+// time, are all retried.
+// A nil RetryBudget does not limit the retries.
+type RetryBudget struct {
+	mtx    sync.Mutex
+	ratio  float64
+	burst  float64
+	tokens float64
+}
+
+// NewRetryBudget returns a RetryBudget allowing ratio retries per request, and up to burst retries at once.
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	return &RetryBudget{
+		ratio:  ratio,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+b.ratio)
+}
+
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
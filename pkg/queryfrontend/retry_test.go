@@ -0,0 +1,110 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRetryMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		err      error
+		budget   *RetryBudget
+		requests int
+
+		expectedTries           int
+		expectedRetries         float64
+		expectedBudgetExhausted float64
+	}{
+		{
+			name:            "5xx error, retried",
+			err:             httpgrpc.Errorf(http.StatusServiceUnavailable, "querier restarting"),
+			requests:        1,
+			expectedTries:   3,
+			expectedRetries: 2,
+		},
+		{
+			name:            "non HTTP error, retried",
+			err:             errors.New("connection refused"),
+			requests:        1,
+			expectedTries:   3,
+			expectedRetries: 2,
+		},
+		{
+			name:          "4xx error, not retried",
+			err:           httpgrpc.Errorf(http.StatusBadRequest, "parse error"),
+			requests:      1,
+			expectedTries: 1,
+		},
+		{
+			name:          "canceled request, not retried",
+			err:           errors.Wrap(context.Canceled, "downstream"),
+			requests:      1,
+			expectedTries: 1,
+		},
+		{
+			name:     "budget exhausted",
+			err:      httpgrpc.Errorf(http.StatusInternalServerError, "querier down"),
+			budget:   NewRetryBudget(0.5, 2),
+			requests: 3,
+			// The first request is retried twice with the burst, the second one is not retried and the third one is
+			// retried once with the deposits of the last two requests.
+			expectedTries:           6,
+			expectedRetries:         3,
+			expectedBudgetExhausted: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tries := 0
+			next := queryrange.HandlerFunc(func(_ context.Context, _ queryrange.Request) (queryrange.Response, error) {
+				tries++
+				return nil, tc.err
+			})
+
+			m := RetryMiddleware(log.NewNopLogger(), 3, tc.budget, prometheus.NewRegistry())
+			h := m.Wrap(next).(retry)
+			for i := 0; i < tc.requests; i++ {
+				_, err := h.Do(context.Background(), &ThanosQueryRangeRequest{})
+				testutil.Equals(t, tc.err, err)
+			}
+			testutil.Equals(t, tc.expectedTries, tries)
+			testutil.Equals(t, tc.expectedRetries, promtestutil.ToFloat64(h.retriesCount))
+			testutil.Equals(t, tc.expectedBudgetExhausted, promtestutil.ToFloat64(h.budgetExhaustedCount))
+
+			var retries dto.Metric
+			testutil.Ok(t, h.retries.Write(&retries))
+			testutil.Equals(t, uint64(tc.requests), retries.GetHistogram().GetSampleCount())
+			testutil.Equals(t, tc.expectedRetries, retries.GetHistogram().GetSampleSum())
+		})
+	}
+
+	t.Run("success after retry", func(t *testing.T) {
+		tries := 0
+		next := queryrange.HandlerFunc(func(_ context.Context, _ queryrange.Request) (queryrange.Response, error) {
+			tries++
+			if tries == 1 {
+				return nil, httpgrpc.Errorf(http.StatusBadGateway, "querier restarting")
+			}
+			return &queryrange.PrometheusResponse{Status: queryrange.StatusSuccess}, nil
+		})
+
+		res, err := RetryMiddleware(log.NewNopLogger(), 3, nil, nil).Wrap(next).Do(context.Background(), &ThanosQueryRangeRequest{})
+		testutil.Ok(t, err)
+		testutil.Equals(t, &queryrange.PrometheusResponse{Status: queryrange.StatusSuccess}, res)
+		testutil.Equals(t, 2, tries)
+	})
+}
@@ -4,6 +4,7 @@
 package queryfrontend
 
 import (
+	"context"
 	"net/http"
 	"regexp"
 	"strings"
@@ -30,8 +31,8 @@ const (
 // NewTripperware returns a Tripperware which sends requests to different sub tripperwares based on the query type.
 func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger) (queryrange.Tripperware, error) {
 	var (
-		queryRangeLimits, labelsLimits queryrange.Limits
-		err                            error
+		queryRangeLimits, instantQueryLimits, labelsLimits queryrange.Limits
+		err                                                error
 	)
 	if config.QueryRangeConfig.Limits != nil {
 		queryRangeLimits, err = validation.NewOverrides(*config.QueryRangeConfig.Limits, nil)
@@ -40,6 +41,13 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 		}
 	}
 
+	if config.InstantQueryConfig.Limits != nil {
+		instantQueryLimits, err = validation.NewOverrides(*config.InstantQueryConfig.Limits, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "initialize instant query limits")
+		}
+	}
+
 	if config.LabelsConfig.Limits != nil {
 		labelsLimits, err = validation.NewOverrides(*config.LabelsConfig.Limits, nil)
 		if err != nil {
@@ -48,14 +56,21 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 	}
 
 	queryRangeCodec := NewThanosQueryRangeCodec(config.QueryRangeConfig.PartialResponseStrategy)
+	instantQueryCodec := NewThanosQueryInstantCodec(config.InstantQueryConfig.PartialResponseStrategy)
 	labelsCodec := NewThanosLabelsCodec(config.LabelsConfig.PartialResponseStrategy, config.DefaultTimeRange)
 
-	queryRangeTripperware, err := newQueryRangeTripperware(config.QueryRangeConfig, queryRangeLimits, queryRangeCodec,
+	queryRangeTripperware, err := newQueryRangeTripperware(config.QueryRangeConfig, queryRangeLimits, queryRangeCodec, config.DownsamplingResolutions,
 		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "query_range"}, reg), logger)
 	if err != nil {
 		return nil, err
 	}
 
+	instantQueryTripperware, err := newInstantQueryTripperware(config.InstantQueryConfig, instantQueryLimits, instantQueryCodec, config.DownsamplingResolutions,
+		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "query_instant"}, reg), logger)
+	if err != nil {
+		return nil, err
+	}
+
 	labelsTripperware, err := newLabelsTripperware(config.LabelsConfig, labelsLimits, labelsCodec,
 		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "labels"}, reg), logger)
 	if err != nil {
@@ -63,21 +78,23 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 	}
 
 	return func(next http.RoundTripper) http.RoundTripper {
-		return newRoundTripper(next, queryRangeTripperware(next), labelsTripperware(next), reg)
+		next = downstreamStatsRoundTripper{next: next}
+		return newRoundTripper(next, queryRangeTripperware(next), instantQueryTripperware(next), labelsTripperware(next), reg)
 	}, nil
 }
 
 type roundTripper struct {
-	next, queryRange, labels http.RoundTripper
+	next, queryRange, queryInstant, labels http.RoundTripper
 
 	queriesCount *prometheus.CounterVec
 }
 
-func newRoundTripper(next, queryRange, metadata http.RoundTripper, reg prometheus.Registerer) roundTripper {
+func newRoundTripper(next, queryRange, queryInstant, metadata http.RoundTripper, reg prometheus.Registerer) roundTripper {
 	r := roundTripper{
-		next:       next,
-		queryRange: queryRange,
-		labels:     metadata,
+		next:         next,
+		queryRange:   queryRange,
+		queryInstant: queryInstant,
+		labels:       metadata,
 		queriesCount: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "thanos_query_frontend_queries_total",
 			Help: "Total queries passing through query frontend",
@@ -96,6 +113,7 @@ func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	switch op := getOperation(req); op {
 	case instantQueryOp:
 		r.queriesCount.WithLabelValues(instantQueryOp).Inc()
+		return r.queryInstant.RoundTrip(req)
 	case rangeQueryOp:
 		r.queriesCount.WithLabelValues(rangeQueryOp).Inc()
 		return r.queryRange.RoundTrip(req)
@@ -131,11 +149,12 @@ func getOperation(r *http.Request) string {
 }
 
 // newQueryRangeTripperware returns a Tripperware for range queries configured with middlewares of
-// limit, step align, split by interval, cache requests and retry.
+// limit, step align, split by interval, cache requests, vertical sharding and retry.
 func newQueryRangeTripperware(
 	config QueryRangeConfig,
 	limits queryrange.Limits,
 	codec *queryRangeCodec,
+	resolutions []int64,
 	reg prometheus.Registerer,
 	logger log.Logger,
 ) (queryrange.Tripperware, error) {
@@ -167,7 +186,7 @@ func newQueryRangeTripperware(
 		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
 			logger,
 			*config.ResultsCacheConfig,
-			newThanosCacheKeyGenerator(config.SplitQueriesByInterval),
+			newThanosCacheKeyGenerator(config.SplitQueriesByInterval, resolutions),
 			limits,
 			codec,
 			queryrange.PrometheusResponseExtractor{},
@@ -186,14 +205,30 @@ func newQueryRangeTripperware(
 		)
 	}
 
+	// The sharded queries are cached as a whole.
+	if config.VerticalShards > 1 {
+		queryRangeMiddleware = append(
+			queryRangeMiddleware,
+			queryrange.InstrumentMiddleware("shard_query", m),
+			ShardQueryMiddleware(config.VerticalShards, limits, codec, reg),
+		)
+	}
+
 	if config.MaxRetries > 0 {
+		var budget *RetryBudget
+		if config.RetryBudgetRatio > 0 {
+			budget = NewRetryBudget(config.RetryBudgetRatio, config.RetryBudgetBurst)
+		}
 		queryRangeMiddleware = append(
 			queryRangeMiddleware,
 			queryrange.InstrumentMiddleware("retry", m),
-			queryrange.NewRetryMiddleware(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg)),
+			RetryMiddleware(logger, config.MaxRetries, budget, reg),
 		)
 	}
 
+	// Count the series of each downstream response, retries included.
+	queryRangeMiddleware = append(queryRangeMiddleware, QueryStatsMiddleware())
+
 	return func(next http.RoundTripper) http.RoundTripper {
 		rt := queryrange.NewRoundTripper(next, codec, queryRangeMiddleware...)
 		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
@@ -230,7 +265,7 @@ func newLabelsTripperware(
 		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
 			logger,
 			*config.ResultsCacheConfig,
-			newThanosCacheKeyGenerator(config.SplitQueriesByInterval),
+			newThanosCacheKeyGenerator(config.SplitQueriesByInterval, nil),
 			limits,
 			codec,
 			ThanosResponseExtractor{},
@@ -253,9 +288,12 @@ func newLabelsTripperware(
 		labelsMiddleware = append(
 			labelsMiddleware,
 			queryrange.InstrumentMiddleware("retry", m),
-			queryrange.NewRetryMiddleware(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg)),
+			RetryMiddleware(logger, config.MaxRetries, nil, reg),
 		)
 	}
+	// Count the series of each downstream response, retries included.
+	labelsMiddleware = append(labelsMiddleware, QueryStatsMiddleware())
+
 	return func(next http.RoundTripper) http.RoundTripper {
 		rt := queryrange.NewRoundTripper(next, codec, labelsMiddleware...)
 		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
@@ -264,6 +302,79 @@ func newLabelsTripperware(
 	}, nil
 }
 
+// newInstantQueryTripperware returns a Tripperware for instant queries configured with middlewares of
+// cache requests and retry. Instant queries are evaluated at a single timestamp, so they are not split.
+func newInstantQueryTripperware(
+	config InstantQueryConfig,
+	limits queryrange.Limits,
+	codec *queryInstantCodec,
+	resolutions []int64,
+	reg prometheus.Registerer,
+	logger log.Logger,
+) (queryrange.Tripperware, error) {
+	instantQueryMiddleware := []queryrange.Middleware{}
+	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
+
+	if config.AlignTimeStep > 0 {
+		instantQueryMiddleware = append(
+			instantQueryMiddleware,
+			queryrange.InstrumentMiddleware("time_align", m),
+			timeAlignMiddleware(config.AlignTimeStep),
+		)
+	}
+
+	if config.ResultsCacheConfig != nil {
+		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
+			logger,
+			*config.ResultsCacheConfig,
+			newThanosCacheKeyGenerator(0, resolutions),
+			limits,
+			codec,
+			ThanosResponseExtractor{},
+			nil,
+			shouldCache,
+			reg,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "create results cache middleware")
+		}
+
+		instantQueryMiddleware = append(
+			instantQueryMiddleware,
+			queryrange.InstrumentMiddleware("results_cache", m),
+			queryCacheMiddleware,
+		)
+	}
+
+	if config.MaxRetries > 0 {
+		instantQueryMiddleware = append(
+			instantQueryMiddleware,
+			queryrange.InstrumentMiddleware("retry", m),
+			RetryMiddleware(logger, config.MaxRetries, nil, reg),
+		)
+	}
+	// Count the series of each downstream response, retries included.
+	instantQueryMiddleware = append(instantQueryMiddleware, QueryStatsMiddleware())
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		rt := queryrange.NewRoundTripper(next, codec, instantQueryMiddleware...)
+		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return rt.RoundTrip(r)
+		})
+	}, nil
+}
+
+// timeAlignMiddleware aligns the evaluation time of the instant queries down to a multiple of the step, so that the
+// queries received within a step have the same cache key.
+func timeAlignMiddleware(step time.Duration) queryrange.Middleware {
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return queryrange.HandlerFunc(func(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+			t := r.GetStart()
+			return next.Do(ctx, r.WithStartEnd(t-t%step.Milliseconds(), 0))
+		})
+	})
+}
+
 // Don't go to response cache if StoreMatchers are set.
 func shouldCache(r queryrange.Request) bool {
 	if thanosReq, ok := r.(ThanosRequest); ok {
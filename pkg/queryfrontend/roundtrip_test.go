@@ -6,6 +6,7 @@ package queryfrontend
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -83,8 +84,10 @@ func TestRoundTripRetryMiddleware(t *testing.T) {
 		End:      2 * hour,
 		Matchers: [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "foo", "bar")}},
 	}
+	testQueryInstantRequest := &ThanosQueryInstantRequest{Path: "/api/v1/query", Time: 2 * hour, Query: "up"}
 
 	queryRangeCodec := NewThanosQueryRangeCodec(true)
+	queryInstantCodec := NewThanosQueryInstantCodec(true)
 	labelsCodec := NewThanosLabelsCodec(true, 2*time.Hour)
 
 	for _, tc := range []struct {
@@ -97,16 +100,11 @@ func TestRoundTripRetryMiddleware(t *testing.T) {
 		expected    int
 	}{
 		{
-			name:       "not query range, retry won't be triggered 1.",
-			maxRetries: 100,
-			req: &ThanosQueryRangeRequest{
-				Path:  "/api/v1/query",
-				Start: 0,
-				End:   2 * hour,
-				Step:  10 * seconds,
-			},
-			codec:       queryRangeCodec,
-			handlerFunc: promqlResults,
+			name:        "no failure, retry won't be triggered",
+			maxRetries:  100,
+			req:         testQueryInstantRequest,
+			codec:       queryInstantCodec,
+			handlerFunc: queryInstantResults,
 			expected:    1,
 		},
 		{
@@ -190,6 +188,24 @@ func TestRoundTripRetryMiddleware(t *testing.T) {
 			handlerFunc: seriesResults,
 			expected:    3,
 		},
+		{
+			name:        "instant query requests: no retry, get counter value 1",
+			maxRetries:  0,
+			req:         testQueryInstantRequest,
+			codec:       queryInstantCodec,
+			handlerFunc: queryInstantResults,
+			fail:        true,
+			expected:    1,
+		},
+		{
+			name:        "instant query requests: retry set to 3",
+			maxRetries:  3,
+			fail:        true,
+			req:         testQueryInstantRequest,
+			codec:       queryInstantCodec,
+			handlerFunc: queryInstantResults,
+			expected:    3,
+		},
 	} {
 
 		t.Run(tc.name, func(t *testing.T) {
@@ -200,6 +216,10 @@ func TestRoundTripRetryMiddleware(t *testing.T) {
 						Limits:                 defaultLimits,
 						SplitQueriesByInterval: day,
 					},
+					InstantQueryConfig: InstantQueryConfig{
+						MaxRetries: tc.maxRetries,
+						Limits:     defaultLimits,
+					},
 					LabelsConfig: LabelsConfig{
 						MaxRetries:             tc.maxRetries,
 						Limits:                 defaultLimits,
@@ -683,6 +703,111 @@ func TestRoundTripSeriesCacheMiddleware(t *testing.T) {
 	}
 }
 
+// TestRoundTripQueryInstantCacheMiddleware tests the cache middleware for instant queries.
+func TestRoundTripQueryInstantCacheMiddleware(t *testing.T) {
+	testRequest := &ThanosQueryInstantRequest{
+		Path:  "/api/v1/query",
+		Time:  2 * hour,
+		Query: "up",
+		Dedup: true,
+	}
+
+	// Same query params as testRequest, but evaluated at a different time.
+	testRequestOtherTime := &ThanosQueryInstantRequest{
+		Path:  "/api/v1/query",
+		Time:  3 * hour,
+		Query: "up",
+		Dedup: true,
+	}
+
+	// Same query params as testRequest, but evaluated at a time aligned to the one of testRequest.
+	testRequestAlignedTime := &ThanosQueryInstantRequest{
+		Path:  "/api/v1/query",
+		Time:  2*hour + 600*seconds,
+		Query: "up",
+		Dedup: true,
+	}
+
+	// Query returning warnings.
+	testRequestWithWarnings := &ThanosQueryInstantRequest{
+		Path:  "/api/v1/query",
+		Time:  2 * hour,
+		Query: "partial",
+		Dedup: true,
+	}
+
+	// Same query params as testRequest, but with storeMatchers
+	testRequestWithStoreMatchers := &ThanosQueryInstantRequest{
+		Path:          "/api/v1/query",
+		Time:          2 * hour,
+		Query:         "up",
+		Dedup:         true,
+		StoreMatchers: [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "foo", "bar")}},
+	}
+
+	cacheConf := &queryrange.ResultsCacheConfig{
+		CacheConfig: cortexcache.Config{
+			EnableFifoCache: true,
+			Fifocache: cortexcache.FifoCacheConfig{
+				MaxSizeBytes: "1MiB",
+				MaxSizeItems: 1000,
+				Validity:     time.Hour,
+			},
+		},
+	}
+
+	tpw, err := NewTripperware(
+		Config{
+			InstantQueryConfig: InstantQueryConfig{
+				Limits:             defaultLimits,
+				ResultsCacheConfig: cacheConf,
+				AlignTimeStep:      time.Hour,
+			},
+		}, nil, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := queryInstantResults(false)
+	rt.setHandler(handler)
+
+	for _, tc := range []struct {
+		name     string
+		req      queryrange.Request
+		expected int
+	}{
+		{name: "first request", req: testRequest, expected: 1},
+		{name: "same request as the first one, directly use cache", req: testRequest, expected: 1},
+		{name: "same query at a different time, not use cache", req: testRequestOtherTime, expected: 2},
+		{name: "same query at an aligned time, directly use cache", req: testRequestAlignedTime, expected: 2},
+		{name: "storeMatchers requests won't go to cache", req: testRequestWithStoreMatchers, expected: 3},
+		{name: "first request with warnings", req: testRequestWithWarnings, expected: 4},
+		{name: "responses with warnings are not cached", req: testRequestWithWarnings, expected: 5},
+	} {
+
+		t.Run(tc.name, func(t *testing.T) {
+
+			ctx := user.InjectOrgID(context.Background(), "1")
+			httpReq, err := NewThanosQueryInstantCodec(true).EncodeRequest(ctx, tc.req)
+			testutil.Ok(t, err)
+
+			resp, err := tpw(rt).RoundTrip(httpReq)
+			testutil.Ok(t, err)
+
+			b, err := ioutil.ReadAll(resp.Body)
+			testutil.Ok(t, err)
+			if tc.req != testRequestWithWarnings {
+				testutil.Equals(t, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"up"},"value":[7200,"1"]}]}}`, string(b))
+			}
+
+			testutil.Equals(t, tc.expected, *res)
+		})
+
+	}
+}
+
 // promqlResults is a mock handler used to test split and cache middleware.
 // Modified from Loki https://github.com/grafana/loki/blob/master/pkg/querier/queryrange/roundtrip_test.go#L547.
 func promqlResults(fail bool) (*int, http.Handler) {
@@ -766,3 +891,29 @@ func seriesResults(fail bool) (*int, http.Handler) {
 		count++
 	})
 }
+
+// queryInstantResults is a mock handler used to test cache middleware for instant queries.
+func queryInstantResults(fail bool) (*int, http.Handler) {
+	count := 0
+	var lock sync.Mutex
+	q := `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"up"},"value":[7200,"1"]}]}}`
+	partial := `{"status":"success","data":{"resultType":"vector","result":[]},"warnings":["store down"]}`
+
+	return &count, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		// Set fail in the response code to test retry.
+		if fail {
+			w.WriteHeader(500)
+		}
+		body := q
+		if r.FormValue("query") == "partial" {
+			body = partial
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			panic(err)
+		}
+		count++
+	})
+}
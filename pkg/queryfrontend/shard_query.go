@@ -0,0 +1,185 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/query"
+)
+
+// ShardQueryMiddleware creates a new Middleware that shards the range queries aggregating their series into the given
+// number of shards, by the hash of the labels the series are grouped by. The shards are evaluated in parallel by the
+// downstream queriers, each on its own subset of the series, and their results are merged.
+func ShardQueryMiddleware(totalShards int, limits queryrange.Limits, merger queryrange.Merger, registerer prometheus.Registerer) queryrange.Middleware {
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return shardQuery{
+			next:        next,
+			limits:      limits,
+			merger:      merger,
+			totalShards: totalShards,
+			shardedCounter: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+				Namespace: "thanos",
+				Name:      "frontend_sharded_queries_total",
+				Help:      "Total number of underlying query requests after the vertical sharding is applied",
+			}),
+		}
+	})
+}
+
+type shardQuery struct {
+	next        queryrange.Handler
+	limits      queryrange.Limits
+	merger      queryrange.Merger
+	totalShards int
+
+	// Metrics.
+	shardedCounter prometheus.Counter
+}
+
+func (s shardQuery) Do(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+	tr, ok := r.(*ThanosQueryRangeRequest)
+	if !ok || tr.ShardInfo != nil {
+		return s.next.Do(ctx, r)
+	}
+	by, lbls, ok := analyzeQuery(tr.Query)
+	if !ok {
+		return s.next.Do(ctx, r)
+	}
+
+	reqs := make([]queryrange.Request, 0, s.totalShards)
+	for i := 0; i < s.totalShards; i++ {
+		q := *tr
+		q.ShardInfo = query.NewShardInfo(i, s.totalShards, by, lbls)
+		reqs = append(reqs, &q)
+	}
+	s.shardedCounter.Add(float64(len(reqs)))
+	if stats := queryStatsFromContext(ctx); stats != nil {
+		atomic.StoreInt64(&stats.shards, int64(s.totalShards))
+	}
+
+	reqResps, err := queryrange.DoRequests(ctx, s.next, reqs, s.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	resps := make([]queryrange.Response, 0, len(reqResps))
+	for _, reqResp := range reqResps {
+		resps = append(resps, reqResp.Response)
+	}
+
+	response, err := s.merger.MergeResponse(resps...)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// errNotShardable stops the inspection of a query which cannot be sharded.
+var errNotShardable = errors.New("query not shardable")
+
+// analyzeQuery returns the labels the series of the query can be sharded by, so that the series aggregated or matched
+// together by the query are all in the same shard. The series are sharded by the hash of the returned labels if by
+// is true, or by the hash of all their labels but the returned ones otherwise. It returns false if the query does
+// not aggregate its series, or if it cannot be sharded.
+func analyzeQuery(q string) (by bool, lbls []string, ok bool) {
+	expr, err := parser.ParseExpr(q)
+	if err != nil {
+		return false, nil, false
+	}
+
+	var (
+		// byLabels is the intersection of the by groupings and the on matchings, nil if there are none.
+		byLabels map[string]struct{}
+		// withoutLabels is the union of the without groupings and the ignoring matchings. The metric name is always
+		// excluded, as it is dropped by most functions.
+		withoutLabels = map[string]struct{}{labels.MetricName: {}}
+		aggregations  int
+	)
+	intersect := func(ls []string) {
+		set := make(map[string]struct{}, len(ls))
+		for _, l := range ls {
+			if _, ok := byLabels[l]; ok || byLabels == nil {
+				set[l] = struct{}{}
+			}
+		}
+		byLabels = set
+	}
+	union := func(ls ...string) {
+		for _, l := range ls {
+			withoutLabels[l] = struct{}{}
+		}
+	}
+
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.AggregateExpr:
+			// count_values adds a label the series cannot be sharded by.
+			if n.Op == parser.COUNT_VALUES {
+				err = errNotShardable
+				return err
+			}
+			aggregations++
+			if n.Without {
+				union(n.Grouping...)
+			} else {
+				intersect(n.Grouping)
+			}
+		case *parser.Call:
+			switch n.Func.Name {
+			case "absent", "absent_over_time", "label_join", "label_replace", "scalar", "vector":
+				// These functions return series based on all the series of their argument, or change their labels.
+				err = errNotShardable
+				return err
+			case "histogram_quantile":
+				// The buckets of a histogram must be in the same shard.
+				union(labels.BucketLabel)
+			}
+		case *parser.BinaryExpr:
+			// The matching is only set between two instant vectors.
+			if n.VectorMatching == nil {
+				return nil
+			}
+			if n.VectorMatching.On {
+				intersect(n.VectorMatching.MatchingLabels)
+			} else {
+				union(n.VectorMatching.MatchingLabels...)
+			}
+		}
+		return nil
+	})
+	if err != nil || aggregations == 0 {
+		return false, nil, false
+	}
+
+	if byLabels == nil {
+		for l := range withoutLabels {
+			lbls = append(lbls, l)
+		}
+		sort.Strings(lbls)
+		return false, lbls, true
+	}
+
+	// Sharding by the by labels which are not excluded by a without grouping keeps the series of both groupings in
+	// the same shard.
+	for l := range byLabels {
+		if _, ok := withoutLabels[l]; !ok {
+			lbls = append(lbls, l)
+		}
+	}
+	if len(lbls) == 0 {
+		return false, nil, false
+	}
+	sort.Strings(lbls)
+	return true, lbls, true
+}
@@ -0,0 +1,134 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	cortexvalidation "github.com/cortexproject/cortex/pkg/util/validation"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/user"
+
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestAnalyzeQuery(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+
+		notShardable bool
+		by           bool
+		labels       []string
+	}{
+		{query: `up`, notShardable: true},
+		{query: `rate(http_requests_total[5m])`, notShardable: true},
+		{query: `sum(up)`, notShardable: true},
+		{query: `sum by (job) (up)`, by: true, labels: []string{"job"}},
+		{query: `sum without (instance) (rate(http_requests_total[5m]))`, labels: []string{"__name__", "instance"}},
+		{query: `sum by (job, __name__) (up)`, by: true, labels: []string{"job"}},
+		{query: `sum by (__name__) (up)`, notShardable: true},
+		{query: `max by (job) (sum by (job, instance) (up))`, by: true, labels: []string{"job"}},
+		{query: `max by (job) (sum by (instance) (up))`, notShardable: true},
+		{query: `sum without (pod) (sum without (instance) (up))`, labels: []string{"__name__", "instance", "pod"}},
+		{query: `sum by (job, instance) (sum without (instance) (up))`, by: true, labels: []string{"job"}},
+		{query: `topk(5, sum by (job) (up))`, notShardable: true},
+		{query: `topk by (job) (5, up)`, by: true, labels: []string{"job"}},
+		{query: `sum by (job) (up) / on (job) group_left sum by (job, instance) (up)`, by: true, labels: []string{"job"}},
+		{query: `sum by (job) (up) / on (instance) sum by (job, instance) (up)`, notShardable: true},
+		{query: `sum by (job, instance) (up) / ignoring (instance) group_left sum by (job) (up)`, by: true, labels: []string{"job"}},
+		{query: `sum without (instance) (up) / ignoring (pod) up`, labels: []string{"__name__", "instance", "pod"}},
+		{query: `sum by (job) (up) > 0`, by: true, labels: []string{"job"}},
+		{query: `sum by (job) (up) and on () up`, notShardable: true},
+		{query: `histogram_quantile(0.9, sum by (job, le) (rate(http_request_duration_seconds_bucket[5m])))`, by: true, labels: []string{"job"}},
+		{query: `histogram_quantile(0.9, sum without (instance) (rate(http_request_duration_seconds_bucket[5m])))`, labels: []string{"__name__", "instance", "le"}},
+		{query: `sum by (job) (label_replace(up, "job", "$1", "instance", "(.*)"))`, notShardable: true},
+		{query: `sum by (job) (up) * scalar(sum(up))`, notShardable: true},
+		{query: `sum by (job) (up) or vector(0)`, notShardable: true},
+		{query: `count_values by (job) ("value", up)`, notShardable: true},
+		{query: `max_over_time(sum by (job) (up)[1h:5m])`, by: true, labels: []string{"job"}},
+		{query: `sum by (job`, notShardable: true},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			by, lbls, ok := analyzeQuery(tc.query)
+			testutil.Equals(t, !tc.notShardable, ok)
+			testutil.Equals(t, tc.by, by)
+			testutil.Equals(t, tc.labels, lbls)
+		})
+	}
+}
+
+func TestShardQueryMiddleware(t *testing.T) {
+	limits, err := cortexvalidation.NewOverrides(*defaultLimits, nil)
+	testutil.Ok(t, err)
+	ctx := user.InjectOrgID(context.Background(), "1")
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{name: "sharded query", query: `sum by (job) (up)`, expected: 3},
+		{name: "not shardable query", query: `sum(up)`, expected: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mtx    sync.Mutex
+				shards []*query.ShardInfo
+			)
+			next := queryrange.HandlerFunc(func(_ context.Context, r queryrange.Request) (queryrange.Response, error) {
+				s := r.(*ThanosQueryRangeRequest).ShardInfo
+
+				mtx.Lock()
+				defer mtx.Unlock()
+				shards = append(shards, s)
+
+				job := "all"
+				if s != nil {
+					job = strconv.Itoa(s.ShardIndex)
+				}
+				return &queryrange.PrometheusResponse{
+					Status: queryrange.StatusSuccess,
+					Data: queryrange.PrometheusData{
+						ResultType: "matrix",
+						Result: []queryrange.SampleStream{{
+							Labels:  []client.LabelAdapter{{Name: "job", Value: job}},
+							Samples: []client.Sample{{Value: 1, TimestampMs: 0}},
+						}},
+					},
+				}, nil
+			})
+
+			h := ShardQueryMiddleware(3, limits, NewThanosQueryRangeCodec(true), prometheus.NewRegistry()).Wrap(next)
+			res, err := h.Do(ctx, &ThanosQueryRangeRequest{
+				Path:  "/api/v1/query_range",
+				Start: 0,
+				End:   2 * hour,
+				Step:  10 * seconds,
+				Query: tc.query,
+			})
+			testutil.Ok(t, err)
+
+			testutil.Equals(t, tc.expected, len(shards))
+			testutil.Equals(t, tc.expected, len(res.(*queryrange.PrometheusResponse).Data.Result))
+			if tc.expected == 1 {
+				testutil.Assert(t, shards[0] == nil, "query should not be sharded")
+				return
+			}
+			indexes := map[int]struct{}{}
+			for _, s := range shards {
+				testutil.Equals(t, 3, s.TotalShards)
+				testutil.Equals(t, true, s.By)
+				testutil.Equals(t, []string{"job"}, s.Labels)
+				indexes[s.ShardIndex] = struct{}{}
+			}
+			testutil.Equals(t, 3, len(indexes))
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/weaveworks/common/user"
+)
+
+// queryStats are the statistics of a request passing through the query frontend, as reported by the slow query log.
+type queryStats struct {
+	// splits is the number of subqueries the request is split into by interval.
+	splits int64
+	// shards is the number of vertical shards each subquery is split into.
+	shards             int64
+	downstreamRequests int64
+	// seriesFetched and bytesFetched are the series and bytes of the responses of the downstream queriers.
+	seriesFetched int64
+	bytesFetched  int64
+}
+
+type queryStatsKey struct{}
+
+func withQueryStats(ctx context.Context, s *queryStats) context.Context {
+	return context.WithValue(ctx, queryStatsKey{}, s)
+}
+
+func queryStatsFromContext(ctx context.Context) *queryStats {
+	s, _ := ctx.Value(queryStatsKey{}).(*queryStats)
+	return s
+}
+
+// NewSlowQueryLogHandler returns a http.Handler logging the requests served by next in longer than threshold as
+// structured records, along with their source and the work they caused downstream. All the requests are logged if
+// threshold is lower than 0.
+func NewSlowQueryLogHandler(next http.Handler, threshold time.Duration, logger log.Logger) http.Handler {
+	return &slowQueryLogHandler{next: next, threshold: threshold, logger: logger}
+}
+
+type slowQueryLogHandler struct {
+	next      http.Handler
+	threshold time.Duration
+	logger    log.Logger
+}
+
+func (h *slowQueryLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The form is parsed once, for next and the log, as parsing it again is a no-op. The consumed body of POST forms
+	// is restored for the requests proxied downstream as is.
+	if err := r.ParseForm(); err != nil {
+		level.Warn(h.logger).Log("msg", "unable to parse form of query", "path", r.URL.Path, "err", err)
+	} else if isPostForm(r) {
+		body := r.PostForm.Encode()
+		r.Body = ioutil.NopCloser(strings.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+
+	stats := &queryStats{}
+	rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	h.next.ServeHTTP(rw, r.WithContext(withQueryStats(r.Context(), stats)))
+	took := time.Since(start)
+
+	if h.threshold >= 0 && took <= h.threshold {
+		return
+	}
+	h.log(r, rw, took, stats)
+}
+
+// isPostForm returns true if the body of the request is a form, read by ParseForm.
+func isPostForm(r *http.Request) bool {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		return false
+	}
+	ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && ct == "application/x-www-form-urlencoded"
+}
+
+func (h *slowQueryLogHandler) log(r *http.Request, rw *responseRecorder, took time.Duration, stats *queryStats) {
+	tenant, _ := user.ExtractOrgID(r.Context())
+	q := r.Form.Get("query")
+	if q == "" {
+		q = strings.Join(r.Form["match[]"], ",")
+	}
+	keyvals := []interface{}{
+		"msg", "slow query",
+		"tenant", tenant,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"query", q,
+		"fingerprint", queryFingerprint(q),
+	}
+	for _, p := range []string{"start", "end", "step", "time"} {
+		if v := r.Form.Get(p); v != "" {
+			keyvals = append(keyvals, p, v)
+		}
+	}
+	keyvals = append(keyvals,
+		"duration_seconds", took.Seconds(),
+		"status", rw.status,
+		"response_bytes", rw.bytes,
+		"remote_addr", remoteHost(r),
+		"user_agent", r.UserAgent(),
+	)
+	// The X-Forwarded-For header is set by proxies, but also by any client, so it is logged along with the address
+	// of the connection.
+	for _, hdr := range []struct{ header, key string }{
+		{"X-Forwarded-For", "forwarded_for"},
+		// Grafana identifies the dashboard and panel sending the query in these headers.
+		{"Referer", "referer"},
+		{"X-Dashboard-Uid", "dashboard_uid"},
+		{"X-Panel-Id", "panel_id"},
+	} {
+		if v := r.Header.Get(hdr.header); v != "" {
+			keyvals = append(keyvals, hdr.key, v)
+		}
+	}
+	keyvals = append(keyvals,
+		"splits", atomic.LoadInt64(&stats.splits),
+		"shards", atomic.LoadInt64(&stats.shards),
+		"downstream_requests", atomic.LoadInt64(&stats.downstreamRequests),
+		"series_fetched", atomic.LoadInt64(&stats.seriesFetched),
+		"bytes_fetched", atomic.LoadInt64(&stats.bytesFetched),
+	)
+	level.Info(h.logger).Log(keyvals...)
+}
+
+// remoteHost returns the host of the address of the client, or the proxy, sending the request.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// queryFingerprint returns the fingerprint of the given query. The queries differing only by their formatting and the
+// values of their label matchers, e.g. the queries of a dashboard panel for different values of its variables, have
+// the same fingerprint.
+func queryFingerprint(q string) string {
+	if expr, err := parser.ParseExpr(q); err == nil {
+		parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			if vs, ok := node.(*parser.VectorSelector); ok {
+				for i, m := range vs.LabelMatchers {
+					if m.Name == labels.MetricName {
+						continue
+					}
+					vs.LabelMatchers[i] = &labels.Matcher{Type: m.Type, Name: m.Name, Value: "?"}
+				}
+			}
+			return nil
+		})
+		q = expr.String()
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(q))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// responseRecorder records the status and size of the response written by a http.Handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, so that the responses streamed by the handler are still flushed.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// downstreamStatsRoundTripper counts the requests sent to the downstream queriers and the bytes of their responses
+// into the statistics of the request, if gathered.
+type downstreamStatsRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt downstreamStatsRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := rt.next.RoundTrip(r)
+	stats := queryStatsFromContext(r.Context())
+	if stats == nil {
+		return res, err
+	}
+	atomic.AddInt64(&stats.downstreamRequests, 1)
+	if err == nil {
+		res.Body = &countingReadCloser{ReadCloser: res.Body, n: &stats.bytesFetched}
+	}
+	return res, err
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// QueryStatsMiddleware creates a new Middleware that counts the series of the responses of the downstream queriers
+// into the statistics of the request, if gathered. It is expected to be the last middleware.
+func QueryStatsMiddleware() queryrange.Middleware {
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return queryrange.HandlerFunc(func(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+			res, err := next.Do(ctx, r)
+			if stats := queryStatsFromContext(ctx); stats != nil && err == nil {
+				atomic.AddInt64(&stats.seriesFetched, int64(responseSeries(res)))
+			}
+			return res, err
+		})
+	})
+}
+
+// responseSeries returns the number of series of the given response.
+func responseSeries(res queryrange.Response) int {
+	switch r := res.(type) {
+	case *queryrange.PrometheusResponse:
+		return len(r.Data.Result)
+	case *ThanosSeriesResponse:
+		return len(r.Data)
+	case *ThanosQueryInstantResponse:
+		if r.Data.ResultType != "vector" && r.Data.ResultType != "matrix" {
+			return 0
+		}
+		var series []json.RawMessage
+		if err := json.Unmarshal(r.Data.Result, &series); err != nil {
+			return 0
+		}
+		return len(series)
+	}
+	return 0
+}
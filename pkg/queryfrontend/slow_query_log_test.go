@@ -0,0 +1,150 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/frontend/transport"
+	"github.com/go-kit/kit/log"
+	"github.com/weaveworks/common/user"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQueryFingerprint(t *testing.T) {
+	fp := queryFingerprint(`sum by (job) (rate(http_requests_total{job="api", code=~"5.."}[5m]))`)
+	for _, q := range []string{
+		`sum by (job) (rate(http_requests_total{job="web", code=~"4.."}[5m]))`,
+		`sum  by(job)(rate(http_requests_total{job="api",code=~"5.."}[5m]))`,
+	} {
+		testutil.Equals(t, fp, queryFingerprint(q))
+	}
+	for _, q := range []string{
+		`sum by (job) (rate(http_requests_total{job="api", code=~"5.."}[1h]))`,
+		`sum by (job) (rate(http_requests_total{job="api"}[5m]))`,
+		`sum by (job) (rate(other_total{job="api", code=~"5.."}[5m]))`,
+	} {
+		testutil.Assert(t, fp != queryFingerprint(q), "query %s should have another fingerprint", q)
+	}
+	// Unparsable queries are fingerprinted as is.
+	testutil.Equals(t, queryFingerprint(`sum(`), queryFingerprint(`sum(`))
+	testutil.Assert(t, queryFingerprint(`sum(`) != queryFingerprint(`sum (`), "unparsable queries should not be normalized")
+}
+
+func TestSlowQueryLogHandler(t *testing.T) {
+	tpw, err := NewTripperware(
+		Config{
+			LabelsConfig: LabelsConfig{
+				Limits:                 defaultLimits,
+				SplitQueriesByInterval: time.Hour,
+			},
+		}, nil, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	var requests int
+	rt.setHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/api/v1/query_exemplars" {
+			// The requests not handled by the tripperware are proxied with their body.
+			testutil.Ok(t, r.ParseForm())
+			testutil.Equals(t, "up", r.PostForm.Get("query"))
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":[{"__name__":"up","job":"api"}]}`))
+	}))
+
+	var buf bytes.Buffer
+	newHandler := func(threshold time.Duration) http.Handler {
+		return NewSlowQueryLogHandler(
+			transport.NewHandler(transport.HandlerConfig{MaxBodySize: 1 << 20}, tpw(rt), log.NewNopLogger()),
+			threshold,
+			log.NewJSONLogger(&buf),
+		)
+	}
+	newRequest := func() *http.Request {
+		form := url.Values{"match[]": {`up{job="api"}`, `down`}, "start": {"0"}, "end": {"7200"}}
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/series", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("User-Agent", "Grafana/7.3.0")
+		r.Header.Set("X-Dashboard-Uid", "abc")
+		r.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+		return r.WithContext(user.InjectOrgID(context.Background(), "team-a"))
+	}
+
+	// Fast requests are not logged.
+	w := httptest.NewRecorder()
+	newHandler(time.Hour).ServeHTTP(w, newRequest())
+	testutil.Equals(t, http.StatusOK, w.Code)
+	testutil.Equals(t, 2, requests)
+	testutil.Equals(t, 0, buf.Len())
+
+	w = httptest.NewRecorder()
+	newHandler(-1).ServeHTTP(w, newRequest())
+	testutil.Equals(t, http.StatusOK, w.Code)
+
+	var record map[string]interface{}
+	testutil.Ok(t, json.Unmarshal(buf.Bytes(), &record))
+	testutil.Assert(t, record["duration_seconds"].(float64) > 0, "duration should be logged")
+	testutil.Assert(t, record["bytes_fetched"].(float64) > 0, "bytes fetched should be logged")
+	testutil.Equals(t, float64(w.Body.Len()), record["response_bytes"])
+	for _, k := range []string{"duration_seconds", "bytes_fetched", "response_bytes"} {
+		delete(record, k)
+	}
+	testutil.Equals(t, map[string]interface{}{
+		"level":               "info",
+		"msg":                 "slow query",
+		"tenant":              "team-a",
+		"method":              http.MethodPost,
+		"path":                "/api/v1/series",
+		"query":               `up{job="api"},down`,
+		"fingerprint":         queryFingerprint(`up{job="api"},down`),
+		"start":               "0",
+		"end":                 "7200",
+		"status":              float64(http.StatusOK),
+		"remote_addr":         "192.0.2.1",
+		"forwarded_for":       "10.0.0.1, 10.0.0.2",
+		"user_agent":          "Grafana/7.3.0",
+		"dashboard_uid":       "abc",
+		"splits":              float64(2),
+		"shards":              float64(0),
+		"downstream_requests": float64(2),
+		"series_fetched":      float64(2),
+	}, record)
+
+	buf.Reset()
+	form := url.Values{"query": {"up"}}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/query_exemplars", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	newHandler(-1).ServeHTTP(w, r)
+	testutil.Equals(t, http.StatusOK, w.Code)
+	testutil.Equals(t, 5, requests)
+	testutil.Ok(t, json.Unmarshal(buf.Bytes(), &record))
+	testutil.Equals(t, "up", record["query"])
+}
+
+func TestSlowQueryLogHandler_Flush(t *testing.T) {
+	h := NewSlowQueryLogHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		f, ok := w.(http.Flusher)
+		testutil.Assert(t, ok, "response writer should be a http.Flusher")
+		_, _ = w.Write([]byte("partial"))
+		f.Flush()
+	}), -1, log.NewNopLogger())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil))
+	testutil.Assert(t, w.Flushed, "response should be flushed")
+}
@@ -8,6 +8,7 @@ package queryfrontend
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
@@ -47,6 +48,9 @@ func (s splitByInterval) Do(ctx context.Context, r queryrange.Request) (queryran
 	// to line up the boundaries with step.
 	reqs := splitQuery(r, s.interval(r))
 	s.splitByCounter.Add(float64(len(reqs)))
+	if stats := queryStatsFromContext(ctx); stats != nil {
+		atomic.AddInt64(&stats.splits, int64(len(reqs)))
+	}
 
 	reqResps, err := queryrange.DoRequests(ctx, s.next, reqs, s.limits)
 	if err != nil {
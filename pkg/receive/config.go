@@ -26,14 +26,17 @@ var (
 	errParseConfigurationFile = errors.New("configuration file is not parsable")
 	// An errEmptyConfigurationFile is returned by the ConfigWatcher when attempting to load an empty configuration file.
 	errEmptyConfigurationFile = errors.New("configuration file is empty")
+	// An errInvalidConfigurationFile is returned by the ConfigWatcher when the parsed configuration is not valid.
+	errInvalidConfigurationFile = errors.New("configuration file is not valid")
 )
 
 // HashringConfig represents the configuration for a hashring
 // a receive node knows about.
 type HashringConfig struct {
-	Hashring  string   `json:"hashring,omitempty"`
-	Tenants   []string `json:"tenants,omitempty"`
-	Endpoints []string `json:"endpoints"`
+	Hashring  string            `json:"hashring,omitempty"`
+	Tenants   []string          `json:"tenants,omitempty"`
+	Endpoints []string          `json:"endpoints"`
+	Algorithm HashringAlgorithm `json:"algorithm,omitempty"`
 }
 
 // ConfigWatcher is able to watch a file containing a hashring configuration
@@ -197,6 +200,14 @@ func (cw *ConfigWatcher) loadConfig() ([]HashringConfig, float64, error) {
 		return nil, 0, errors.Wrapf(errEmptyConfigurationFile, "failed to load configuration file, path: %s", cw.path)
 	}
 
+	for _, c := range config {
+		switch c.Algorithm {
+		case "", AlgorithmHashmod, AlgorithmKetama:
+		default:
+			return nil, 0, errors.Wrapf(errInvalidConfigurationFile, "unknown algorithm %q of hashring %q", c.Algorithm, c.Hashring)
+		}
+	}
+
 	return config, hashAsMetricValue(cfgContent), nil
 }
 
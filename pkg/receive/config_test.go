@@ -44,6 +44,16 @@ func TestValidateConfig(t *testing.T) {
 			},
 			err: nil, // means it's valid.
 		},
+		{
+			name: "unknown algorithm",
+			cfg: []HashringConfig{
+				{
+					Endpoints: []string{"node1"},
+					Algorithm: "unknown",
+				},
+			},
+			err: errInvalidConfigurationFile,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			content, err := json.Marshal(tc.cfg)
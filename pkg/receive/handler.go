@@ -7,10 +7,12 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
 	stdlog "log"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -35,7 +37,9 @@ import (
 	"github.com/thanos-io/thanos/pkg/errutil"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/server/http/auth"
 	"github.com/thanos-io/thanos/pkg/server/http/middleware"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
 	"github.com/thanos-io/thanos/pkg/tracing"
@@ -53,6 +57,9 @@ const (
 	// Labels for metrics.
 	labelSuccess = "success"
 	labelError   = "error"
+
+	// asyncReplicationAttempts is the number of attempts to write a replica in the background.
+	asyncReplicationAttempts = 5
 )
 
 var (
@@ -74,10 +81,27 @@ type Options struct {
 	ReplicaHeader     string
 	Endpoint          string
 	ReplicationFactor uint64
-	Tracer            opentracing.Tracer
-	TLSConfig         *tls.Config
-	DialOpts          []grpc.DialOption
-	ForwardTimeout    time.Duration
+	// ReplicationQuorum is the number of replicas that have to be written for a write request to succeed.
+	// It defaults to a majority of the replication factor.
+	ReplicationQuorum uint64
+	// AsyncReplication makes write requests succeed as soon as their local replica, or their first one, is written,
+	// the other replicas being written in the background and retried on failure.
+	AsyncReplication bool
+	// AsyncReplicationMaxPending is the maximum number of replicas written in the background, 0 for no limit. Once
+	// reached, the replicas are written before the write requests succeed.
+	AsyncReplicationMaxPending int
+	// ForwardConcurrency is the maximum number of concurrent requests forwarded to the other receivers, 0 for no limit.
+	ForwardConcurrency int
+	Tracer             opentracing.Tracer
+	TLSConfig          *tls.Config
+	DialOpts           []grpc.DialOption
+	ForwardTimeout     time.Duration
+	// SplitTenantLabelName is the name of the label of the series holding their tenant, if any. The label takes
+	// precedence over the tenant header, and is removed from the series.
+	SplitTenantLabelName string
+	Limiter              *Limiter
+	// Auth authenticates and authorizes the write requests, if not nil.
+	Auth *auth.Middleware
 }
 
 // Handler serves a Prometheus remote write receiving HTTP endpoint.
@@ -94,9 +118,21 @@ type Handler struct {
 	expBackoff backoff.Backoff
 	peerStates map[string]*retryState
 
-	forwardRequests   *prometheus.CounterVec
-	replications      *prometheus.CounterVec
-	replicationFactor prometheus.Gauge
+	// forwardGate limits the number of concurrent forward requests, if not nil.
+	forwardGate chan struct{}
+	// asyncGate limits the number of replicas written in the background, if not nil.
+	asyncGate chan struct{}
+	// asyncCtx is canceled by Close to stop the writes in the background, and asyncWG waits for them.
+	asyncCtx    context.Context
+	asyncCancel context.CancelFunc
+	asyncWG     sync.WaitGroup
+
+	forwardRequests          *prometheus.CounterVec
+	replications             *prometheus.CounterVec
+	asyncReplications        *prometheus.CounterVec
+	asyncReplicationsPending prometheus.Gauge
+	replicationFactor        prometheus.Gauge
+	replicationQuorum        prometheus.Gauge
 }
 
 func NewHandler(logger log.Logger, o *Options) *Handler {
@@ -128,24 +164,52 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 				Help: "The number of replication operations done by the receiver. The success of replication is fulfilled when a quorum is met.",
 			}, []string{"result"},
 		),
+		asyncReplications: promauto.With(o.Registry).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_async_replications_total",
+				Help: "The number of replicas written in the background with --receive.replication-async, by result after all the attempts.",
+			}, []string{"result"},
+		),
+		asyncReplicationsPending: promauto.With(o.Registry).NewGauge(
+			prometheus.GaugeOpts{
+				Name: "thanos_receive_async_replications_pending",
+				Help: "The number of replicas being written in the background with --receive.replication-async.",
+			},
+		),
 		replicationFactor: promauto.With(o.Registry).NewGauge(
 			prometheus.GaugeOpts{
 				Name: "thanos_receive_replication_factor",
 				Help: "The number of times to replicate incoming write requests.",
 			},
 		),
+		replicationQuorum: promauto.With(o.Registry).NewGauge(
+			prometheus.GaugeOpts{
+				Name: "thanos_receive_replication_quorum",
+				Help: "The number of replicas of incoming write requests that have to be written for them to succeed.",
+			},
+		),
+	}
+	if o.ForwardConcurrency > 0 {
+		h.forwardGate = make(chan struct{}, o.ForwardConcurrency)
+	}
+	if o.AsyncReplicationMaxPending > 0 {
+		h.asyncGate = make(chan struct{}, o.AsyncReplicationMaxPending)
 	}
+	h.asyncCtx, h.asyncCancel = context.WithCancel(context.Background())
 
 	h.forwardRequests.WithLabelValues(labelSuccess)
 	h.forwardRequests.WithLabelValues(labelError)
 	h.replications.WithLabelValues(labelSuccess)
 	h.replications.WithLabelValues(labelError)
+	h.asyncReplications.WithLabelValues(labelSuccess)
+	h.asyncReplications.WithLabelValues(labelError)
 
 	if o.ReplicationFactor > 1 {
 		h.replicationFactor.Set(float64(o.ReplicationFactor))
 	} else {
 		h.replicationFactor.Set(1)
 	}
+	h.replicationQuorum.Set(float64(h.writeQuorum()))
 
 	ins := extpromhttp.NewNopInstrumentationMiddleware()
 	if o.Registry != nil {
@@ -203,11 +267,13 @@ func (h *Handler) testReady(f http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// Close stops the Handler.
+// Close stops the Handler, and the writes of replicas in the background.
 func (h *Handler) Close() {
 	if h.listener != nil {
 		runutil.CloseWithLogOnErr(h.logger, h.listener, "receive HTTP listener")
 	}
+	h.asyncCancel()
+	h.asyncWG.Wait()
 }
 
 // Run serves the HTTP endpoints.
@@ -227,8 +293,13 @@ func (h *Handler) Run() error {
 
 	errlog := stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0)
 
+	var handler http.Handler = h.router
+	if h.options.Auth != nil {
+		handler = h.options.Auth.Handler(handler)
+	}
+
 	httpSrv := &http.Server{
-		Handler:   h.router,
+		Handler:   handler,
 		ErrorLog:  errlog,
 		TLSConfig: h.options.TLSConfig,
 	}
@@ -273,6 +344,9 @@ func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenant string,
 		if countCause(err, isConflict) > 0 {
 			return conflictErr
 		}
+		if countCause(err, isHeadSeriesLimited) > 0 {
+			return errHeadSeriesLimited
+		}
 		return err
 	}
 	return nil
@@ -282,11 +356,26 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	span, ctx := tracing.StartSpan(r.Context(), "receive_http")
 	defer span.Finish()
 
-	compressed, err := ioutil.ReadAll(r.Body)
+	tenant := r.Header.Get(h.options.TenantHeader)
+	if len(tenant) == 0 {
+		tenant = h.options.DefaultTenantID
+	}
+
+	body := io.Reader(r.Body)
+	maxBodyBytes := h.options.Limiter.MaxRequestBodyBytes(tenant)
+	if maxBodyBytes > 0 {
+		body = io.LimitReader(body, maxBodyBytes+1)
+	}
+	compressed, err := ioutil.ReadAll(body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if maxBodyBytes > 0 && int64(len(compressed)) > maxBodyBytes {
+		h.options.Limiter.RejectBody(tenant)
+		http.Error(w, errors.Wrapf(errBodyLimited, "limit %d bytes", maxBodyBytes).Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 
 	reqBuf, err := snappy.Decode(nil, compressed)
 	if err != nil {
@@ -310,27 +399,101 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	tenant := r.Header.Get(h.options.TenantHeader)
-	if len(tenant) == 0 {
-		tenant = h.options.DefaultTenantID
+	wreqs := map[string]*prompb.WriteRequest{tenant: &wreq}
+	if h.options.SplitTenantLabelName != "" {
+		wreqs = splitTenants(h.options.SplitTenantLabelName, tenant, &wreq)
+	}
+	tenants := make([]string, 0, len(wreqs))
+	for t := range wreqs {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+
+	// The requests of all the tenants are written even if some fail, the error of the first failing one is returned.
+	var (
+		code     int
+		firstErr error
+	)
+	for _, t := range tenants {
+		if c, err := h.receiveTenant(ctx, rep, t, wreqs[t]); err != nil && firstErr == nil {
+			code, firstErr = c, err
+		}
+	}
+	if firstErr != nil {
+		http.Error(w, firstErr.Error(), code)
+	}
+}
+
+// receiveTenant writes the given write request of the given tenant. If it fails, it returns the HTTP status code
+// of the error.
+func (h *Handler) receiveTenant(ctx context.Context, rep uint64, tenant string, wreq *prompb.WriteRequest) (int, error) {
+	// Only the requests of the clients are limited, not the ones already replicated by other receivers.
+	var limitErr error
+	if rep == 0 {
+		limitErr = h.options.Limiter.Limit(tenant, wreq, time.Now())
+		switch errors.Cause(limitErr) {
+		case errRateLimited:
+			return http.StatusTooManyRequests, limitErr
+		case errBurstExceeded:
+			return http.StatusRequestEntityTooLarge, limitErr
+		}
 	}
 
-	err = h.handleRequest(ctx, rep, tenant, &wreq)
+	var err error
+	if len(wreq.Timeseries) > 0 {
+		err = h.handleRequest(ctx, rep, tenant, wreq)
+	}
 	switch err {
 	case nil:
-		return
+		// The series within the limits are written, report the ones which are not.
+		switch errors.Cause(limitErr) {
+		case nil:
+			return 0, nil
+		case errSeriesLimited:
+			return http.StatusTooManyRequests, limitErr
+		default:
+			return http.StatusBadRequest, limitErr
+		}
 	case errNotReady:
-		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return http.StatusServiceUnavailable, err
 	case errUnavailable:
-		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return http.StatusServiceUnavailable, err
 	case conflictErr:
-		http.Error(w, err.Error(), http.StatusConflict)
+		return http.StatusConflict, err
+	case errHeadSeriesLimited:
+		return http.StatusTooManyRequests, err
 	case errBadReplica:
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		return http.StatusBadRequest, err
 	default:
-		level.Error(h.logger).Log("err", err, "msg", "internal server error")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		level.Error(h.logger).Log("err", err, "msg", "internal server error", "tenant", tenant)
+		return http.StatusInternalServerError, err
+	}
+}
+
+// splitTenants splits the series of the given write request by the tenant in the value of their given label, which
+// is removed from them. The series without the label belong to the given default tenant.
+func splitTenants(labelName, defaultTenant string, wreq *prompb.WriteRequest) map[string]*prompb.WriteRequest {
+	wreqs := map[string]*prompb.WriteRequest{}
+	for _, ts := range wreq.Timeseries {
+		tenant := defaultTenant
+		for i, l := range ts.Labels {
+			if l.Name != labelName {
+				continue
+			}
+			if l.Value != "" {
+				tenant = l.Value
+			}
+			lbls := make([]labelpb.ZLabel, 0, len(ts.Labels)-1)
+			lbls = append(lbls, ts.Labels[:i]...)
+			ts.Labels = append(lbls, ts.Labels[i+1:]...)
+			break
+		}
+		if _, ok := wreqs[tenant]; !ok {
+			wreqs[tenant] = &prompb.WriteRequest{}
+		}
+		wreqs[tenant].Timeseries = append(wreqs[tenant].Timeseries, ts)
 	}
+	return wreqs
 }
 
 // forward accepts a write request, batches its time series by
@@ -383,6 +546,12 @@ func (h *Handler) forward(ctx context.Context, tenant string, r replica, wreq *p
 
 // writeQuorum returns minimum number of replicas that has to confirm write success before claiming replication success.
 func (h *Handler) writeQuorum() int {
+	if h.options.AsyncReplication {
+		return 1
+	}
+	if h.options.ReplicationQuorum > 0 {
+		return int(h.options.ReplicationQuorum)
+	}
 	return int((h.options.ReplicationFactor / 2) + 1)
 }
 
@@ -456,6 +625,8 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 					if errs, ok := err.(errutil.MultiError); ok {
 						if countCause(errs, isConflict) > 0 {
 							err = errors.Wrap(conflictErr, errs.Error())
+						} else if countCause(errs, isHeadSeriesLimited) > 0 {
+							err = errors.Wrap(errHeadSeriesLimited, errs.Error())
 						} else if countCause(errs, isNotReady) > 0 {
 							err = errNotReady
 						} else {
@@ -505,6 +676,17 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 			}
 			h.mtx.RUnlock()
 
+			if h.forwardGate != nil {
+				select {
+				case h.forwardGate <- struct{}{}:
+					defer func() { <-h.forwardGate }()
+				case <-fctx.Done():
+					err = fctx.Err()
+					ec <- errors.Wrapf(err, "waiting to forward request to endpoint %v", endpoint)
+					return
+				}
+			}
+
 			// Create a span to track the request made to another receive node.
 			tracing.DoInSpan(fctx, "receive_forward", func(ctx context.Context) {
 				// Actually make the request against the endpoint we determined should handle these time series.
@@ -590,7 +772,6 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 func (h *Handler) replicate(ctx context.Context, tenant string, wreq *prompb.WriteRequest) error {
 	wreqs := make(map[string]*prompb.WriteRequest)
 	replicas := make(map[string]replica)
-	var i uint64
 
 	// It is possible that hashring is ready in testReady() but unready now,
 	// so need to lock here.
@@ -600,27 +781,64 @@ func (h *Handler) replicate(ctx context.Context, tenant string, wreq *prompb.Wri
 		return errors.New("hashring is not ready")
 	}
 
-	for i = 0; i < h.options.ReplicationFactor; i++ {
-		endpoint, err := h.hashring.GetN(tenant, &wreq.Timeseries[0], i)
-		if err != nil {
-			h.mtx.RUnlock()
-			return err
-		}
+	endpoints, err := h.hashring.GetReplicas(tenant, &wreq.Timeseries[0], h.options.ReplicationFactor)
+	h.mtx.RUnlock()
+	if err != nil {
+		return err
+	}
+	for i, endpoint := range endpoints {
 		wreqs[endpoint] = wreq
-		replicas[endpoint] = replica{i, true}
+		replicas[endpoint] = replica{uint64(i), true}
 	}
-	h.mtx.RUnlock()
 
 	quorum := h.writeQuorum()
+	if h.options.AsyncReplication {
+		// The local replica, or the first one, is written first. Once it is written, the other replicas are written
+		// in the background. Otherwise, the request succeeds once any other replica is written.
+		first := endpoints[0]
+		for _, endpoint := range endpoints {
+			if endpoint == h.options.Endpoint {
+				first = endpoint
+			}
+		}
+		err := h.fanoutForward(ctx, tenant, map[string]replica{first: replicas[first]}, map[string]*prompb.WriteRequest{first: wreq}, 1)
+		delete(wreqs, first)
+		delete(replicas, first)
+		if err == nil {
+			for endpoint := range wreqs {
+				if !h.acquireAsync() {
+					// Too many replicas are written in the background, this one is written before the request succeeds.
+					continue
+				}
+				h.asyncWG.Add(1)
+				go h.replicateInBackground(tenant, endpoint, replicas[endpoint], wreq)
+				delete(wreqs, endpoint)
+				delete(replicas, endpoint)
+			}
+			if len(wreqs) == 0 {
+				return nil
+			}
+			quorum = len(wreqs)
+		} else {
+			level.Debug(h.logger).Log("msg", "writing first replica failed, waiting for the other ones", "tenant", tenant, "endpoint", first, "err", err)
+		}
+	}
+
+	// The quorum cannot be reached anymore once this number of replicas failed.
+	failures := len(wreqs) - quorum + 1
 	// fanoutForward only returns an error if successThreshold (quorum) is not reached.
+	// Once it is reached, the remaining replicas are still written in the background.
 	if err := h.fanoutForward(ctx, tenant, replicas, wreqs, quorum); err != nil {
-		if countCause(err, isNotReady) >= quorum {
+		if countCause(err, isNotReady) >= failures {
 			return errors.Wrap(errNotReady, "replicate: quorum not reached")
 		}
-		if countCause(err, isConflict) >= quorum {
+		if countCause(err, isConflict) >= failures {
 			return errors.Wrap(conflictErr, "replicate: quorum not reached")
 		}
-		if countCause(err, isUnavailable) >= quorum {
+		if countCause(err, isHeadSeriesLimited) >= failures {
+			return errors.Wrap(errHeadSeriesLimited, "replicate: quorum not reached")
+		}
+		if countCause(err, isUnavailable) >= failures {
 			return errors.Wrap(errUnavailable, "replicate: quorum not reached")
 		}
 		return errors.Wrap(err, "unexpected error, before quorum is reached")
@@ -629,6 +847,57 @@ func (h *Handler) replicate(ctx context.Context, tenant string, wreq *prompb.Wri
 	return nil
 }
 
+// acquireAsync returns true if one more replica can be written in the background.
+func (h *Handler) acquireAsync() bool {
+	if h.asyncGate == nil {
+		return true
+	}
+	select {
+	case h.asyncGate <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// replicateInBackground writes the given replica of a write request in the background, with up to
+// asyncReplicationAttempts attempts. Conflicting samples, e.g. out of order ones, are not retried.
+func (h *Handler) replicateInBackground(tenant, endpoint string, r replica, wreq *prompb.WriteRequest) {
+	h.asyncReplicationsPending.Inc()
+	defer func() {
+		h.asyncReplicationsPending.Dec()
+		if h.asyncGate != nil {
+			<-h.asyncGate
+		}
+		h.asyncWG.Done()
+	}()
+
+	b := backoff.Backoff{
+		Factor: 2,
+		Min:    100 * time.Millisecond,
+		Max:    30 * time.Second,
+		Jitter: true,
+	}
+	for attempt := 1; ; attempt++ {
+		err := h.fanoutForward(h.asyncCtx, tenant, map[string]replica{endpoint: r}, map[string]*prompb.WriteRequest{endpoint: wreq}, 1)
+		if err == nil {
+			h.asyncReplications.WithLabelValues(labelSuccess).Inc()
+			return
+		}
+		if attempt >= asyncReplicationAttempts || countCause(err, isConflict) > 0 {
+			h.asyncReplications.WithLabelValues(labelError).Inc()
+			level.Warn(h.logger).Log("msg", "writing replica in the background failed", "tenant", tenant, "endpoint", endpoint, "attempts", attempt, "err", err)
+			return
+		}
+		select {
+		case <-time.After(b.Duration()):
+		case <-h.asyncCtx.Done():
+			h.asyncReplications.WithLabelValues(labelError).Inc()
+			return
+		}
+	}
+}
+
 // RemoteWrite implements the gRPC remote write handler for storepb.WriteableStore.
 func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*storepb.WriteResponse, error) {
 	span, ctx := tracing.StartSpan(ctx, "receive_grpc")
@@ -644,6 +913,8 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 		return nil, status.Error(codes.Unavailable, err.Error())
 	case conflictErr:
 		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case errHeadSeriesLimited:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
 	case errBadReplica:
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	default:
@@ -19,14 +19,17 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
 	"github.com/pkg/errors"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage"
 	"google.golang.org/grpc"
 
 	"github.com/thanos-io/thanos/pkg/errutil"
+	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
 func TestCountCause(t *testing.T) {
@@ -167,7 +170,7 @@ func newHandlerHashring(appendables []*fakeAppendable, replicationFactor uint64)
 			ReplicaHeader:     DefaultReplicaHeader,
 			ReplicationFactor: replicationFactor,
 			ForwardTimeout:    5 * time.Second,
-			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(appendables[i])),
+			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(appendables[i]), nil, nil),
 		})
 		handlers = append(handlers, h)
 		h.peers = peers
@@ -922,3 +925,164 @@ type fakeRemoteWriteGRPCServer struct {
 func (f *fakeRemoteWriteGRPCServer) RemoteWrite(ctx context.Context, in *storepb.WriteRequest, opts ...grpc.CallOption) (*storepb.WriteResponse, error) {
 	return f.h.RemoteWrite(ctx, in)
 }
+
+func TestReceiveReplicationQuorum(t *testing.T) {
+	commitErrFn := func() error { return errors.New("failed to commit") }
+	wreq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+			},
+		},
+	}
+	for _, tc := range []struct {
+		name   string
+		quorum uint64
+		async  bool
+		status int
+	}{
+		{name: "majority", status: http.StatusInternalServerError},
+		{name: "quorum 1", quorum: 1, status: http.StatusOK},
+		{name: "quorum 3", quorum: 3, status: http.StatusInternalServerError},
+		{name: "async", async: true, status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handlers, _ := newHandlerHashring([]*fakeAppendable{
+				{appender: newFakeAppender(nil, nil, nil, nil)},
+				{appender: newFakeAppender(nil, nil, commitErrFn, nil)},
+				{appender: newFakeAppender(nil, nil, commitErrFn, nil)},
+			}, 3)
+			for _, h := range handlers {
+				h.options.ReplicationQuorum = tc.quorum
+				h.options.AsyncReplication = tc.async
+				defer h.Close()
+			}
+			for i, h := range handlers {
+				rec, err := makeRequest(h, "test", wreq)
+				if err != nil {
+					t.Fatalf("handler %d: unexpectedly failed making HTTP request: %v", i, err)
+				}
+				if rec.Code != tc.status {
+					t.Errorf("handler %d: got unexpected HTTP status code: expected %d, got %d; body: %s", i, tc.status, rec.Code, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestReceiveAsyncReplication(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		commits int
+	)
+	// The remote replicas fail to be written once.
+	commitErrFn := func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		commits++
+		if commits <= 2 {
+			return errors.New("failed to commit")
+		}
+		return nil
+	}
+	handlers, _ := newHandlerHashring([]*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, commitErrFn, nil)},
+		{appender: newFakeAppender(nil, nil, commitErrFn, nil)},
+	}, 3)
+	for _, h := range handlers {
+		h.options.AsyncReplication = true
+		defer h.Close()
+	}
+	h := handlers[0]
+
+	rec, err := makeRequest(h, "test", &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+			},
+		},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+
+	// The remote replicas are retried in the background.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(100*time.Millisecond, ctx.Done(), func() error {
+		if v := promtestutil.ToFloat64(h.asyncReplications.WithLabelValues(labelSuccess)); v != 2 {
+			return errors.Errorf("%v replicas written in the background", v)
+		}
+		if v := promtestutil.ToFloat64(h.asyncReplicationsPending); v != 0 {
+			return errors.Errorf("%v replicas pending", v)
+		}
+		return nil
+	}))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(h.asyncReplications.WithLabelValues(labelError)))
+}
+
+func TestSplitTenants(t *testing.T) {
+	wreq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{Labels: []labelpb.ZLabel{{Name: "a", Value: "1"}, {Name: "tenant", Value: "foo"}, {Name: "z", Value: "1"}}},
+			{Labels: []labelpb.ZLabel{{Name: "a", Value: "2"}}},
+			{Labels: []labelpb.ZLabel{{Name: "a", Value: "3"}, {Name: "tenant", Value: ""}}},
+			{Labels: []labelpb.ZLabel{{Name: "tenant", Value: "foo"}}},
+		},
+	}
+	wreqs := splitTenants("tenant", "default", wreq)
+
+	expected := map[string]*prompb.WriteRequest{
+		"foo": {
+			Timeseries: []prompb.TimeSeries{
+				{Labels: []labelpb.ZLabel{{Name: "a", Value: "1"}, {Name: "z", Value: "1"}}},
+				{Labels: []labelpb.ZLabel{}},
+			},
+		},
+		"default": {
+			Timeseries: []prompb.TimeSeries{
+				{Labels: []labelpb.ZLabel{{Name: "a", Value: "2"}}},
+				{Labels: []labelpb.ZLabel{{Name: "a", Value: "3"}}},
+			},
+		},
+	}
+	if len(wreqs) != len(expected) {
+		t.Fatalf("expected %d tenants, got %d", len(expected), len(wreqs))
+	}
+	for tenant, e := range expected {
+		if wreqs[tenant].String() != e.String() {
+			t.Errorf("tenant %s: expected %s, got %s", tenant, e.String(), wreqs[tenant].String())
+		}
+	}
+	// The labels of the original request are not modified.
+	if len(wreq.Timeseries[0].Labels) != 3 {
+		t.Errorf("labels of the original request modified: %v", wreq.Timeseries[0].Labels)
+	}
+}
+
+func TestReceiveSplitTenants(t *testing.T) {
+	appendable := &fakeAppendable{appender: newFakeAppender(nil, nil, nil, nil)}
+	handlers, _ := newHandlerHashring([]*fakeAppendable{appendable}, 1)
+	h := handlers[0]
+	h.options.SplitTenantLabelName = "tenant"
+
+	rec, err := makeRequest(h, "", &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: "foo", Value: "bar"}, {Name: "tenant", Value: "a"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpectedly failed making HTTP request: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got unexpected HTTP status code: expected %d, got %d; body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if n := len(appendable.appender.(*fakeAppender).Get(labels.FromStrings("foo", "bar"))); n != 1 {
+		t.Errorf("expected 1 sample of the series without the tenant label, got %d", n)
+	}
+}
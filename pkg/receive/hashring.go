@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/cespare/xxhash"
@@ -16,6 +17,22 @@ import (
 
 const sep = '\xff'
 
+// HashringAlgorithm is the algorithm used to distribute the time series of a hashring across its nodes.
+type HashringAlgorithm string
+
+const (
+	// AlgorithmHashmod assigns a time series to the node at the index of its hash modulo the number of nodes.
+	// Changing the number of nodes of the hashring reassigns almost all the time series.
+	AlgorithmHashmod HashringAlgorithm = "hashmod"
+	// AlgorithmKetama assigns a time series to the node owning the section of a consistent hash ring its hash falls
+	// in. Adding or removing a node only reassigns the time series of about one node.
+	AlgorithmKetama HashringAlgorithm = "ketama"
+
+	// sectionsPerNode is the number of sections of the ring owned by each node of a ketama hashring. The more
+	// sections, the more even the distribution of the time series across the nodes.
+	sectionsPerNode = 1000
+)
+
 // insufficientNodesError is returned when a hashring does not
 // have enough nodes to satisfy a request for a node.
 type insufficientNodesError struct {
@@ -36,6 +53,9 @@ type Hashring interface {
 	Get(tenant string, timeSeries *prompb.TimeSeries) (string, error)
 	// GetN returns the nth node that should handle the given tenant and time series.
 	GetN(tenant string, timeSeries *prompb.TimeSeries, n uint64) (string, error)
+	// GetReplicas returns the first n nodes that should handle the given tenant and time series, in order. It is
+	// equivalent to calling GetN from 0 to n-1, in a single pass.
+	GetReplicas(tenant string, timeSeries *prompb.TimeSeries, n uint64) ([]string, error)
 }
 
 // hash returns a hash for the given tenant and time series.
@@ -71,6 +91,14 @@ func (s SingleNodeHashring) GetN(_ string, _ *prompb.TimeSeries, n uint64) (stri
 	return string(s), nil
 }
 
+// GetReplicas implements the Hashring interface.
+func (s SingleNodeHashring) GetReplicas(_ string, _ *prompb.TimeSeries, n uint64) ([]string, error) {
+	if n > 1 {
+		return nil, &insufficientNodesError{have: 1, want: n}
+	}
+	return []string{string(s)}[:n], nil
+}
+
 // simpleHashring represents a group of nodes handling write requests.
 type simpleHashring []string
 
@@ -87,6 +115,94 @@ func (s simpleHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 	return s[(hash(tenant, ts)+n)%uint64(len(s))], nil
 }
 
+// GetReplicas returns the first n targets to handle the given tenant and time series.
+func (s simpleHashring) GetReplicas(tenant string, ts *prompb.TimeSeries, n uint64) ([]string, error) {
+	if n > uint64(len(s)) {
+		return nil, &insufficientNodesError{have: uint64(len(s)), want: n}
+	}
+	v := hash(tenant, ts)
+	res := make([]string, 0, n)
+	for i := uint64(0); i < n; i++ {
+		res = append(res, s[(v+i)%uint64(len(s))])
+	}
+	return res, nil
+}
+
+// section is the part of a ketama hashring ending at the given hash, owned by the node at the given index.
+type section struct {
+	hash     uint64
+	endpoint uint64
+}
+
+// ketamaHashring represents a group of nodes handling write requests, distributed with consistent hashing.
+// Every node owns sectionsPerNode sections of the ring, placed by hashing the node address and the section number,
+// and a time series is handled by the node owning the section its hash falls in.
+type ketamaHashring struct {
+	endpoints []string
+	sections  []section
+}
+
+func newKetamaHashring(endpoints []string) *ketamaHashring {
+	h := &ketamaHashring{
+		endpoints: endpoints,
+		sections:  make([]section, 0, len(endpoints)*sectionsPerNode),
+	}
+	for i, endpoint := range endpoints {
+		b := make([]byte, 0, len(endpoint)+1+20)
+		for j := 0; j < sectionsPerNode; j++ {
+			b = append(b[:0], endpoint...)
+			b = append(b, sep)
+			b = strconv.AppendInt(b, int64(j), 10)
+			h.sections = append(h.sections, section{hash: xxhash.Sum64(b), endpoint: uint64(i)})
+		}
+	}
+	sort.Slice(h.sections, func(i, j int) bool {
+		if h.sections[i].hash == h.sections[j].hash {
+			// Order colliding sections by address, so that the ring does not depend on the order of the endpoints.
+			return h.endpoints[h.sections[i].endpoint] < h.endpoints[h.sections[j].endpoint]
+		}
+		return h.sections[i].hash < h.sections[j].hash
+	})
+	return h
+}
+
+// Get returns a target to handle the given tenant and time series.
+func (k *ketamaHashring) Get(tenant string, ts *prompb.TimeSeries) (string, error) {
+	return k.GetN(tenant, ts, 0)
+}
+
+// GetN returns the nth target to handle the given tenant and time series. The targets are the distinct nodes owning
+// the sections following the hash of the time series on the ring.
+func (k *ketamaHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (string, error) {
+	res, err := k.GetReplicas(tenant, ts, n+1)
+	if err != nil {
+		return "", err
+	}
+	return res[n], nil
+}
+
+// GetReplicas returns the first n targets to handle the given tenant and time series, walking the ring once.
+func (k *ketamaHashring) GetReplicas(tenant string, ts *prompb.TimeSeries, n uint64) ([]string, error) {
+	if n > uint64(len(k.endpoints)) {
+		return nil, &insufficientNodesError{have: uint64(len(k.endpoints)), want: n}
+	}
+
+	v := hash(tenant, ts)
+	i := sort.Search(len(k.sections), func(i int) bool { return k.sections[i].hash >= v })
+
+	res := make([]string, 0, n)
+	seen := make(map[uint64]struct{}, n)
+	for uint64(len(res)) < n {
+		s := k.sections[i%len(k.sections)]
+		if _, ok := seen[s.endpoint]; !ok {
+			seen[s.endpoint] = struct{}{}
+			res = append(res, k.endpoints[s.endpoint])
+		}
+		i++
+	}
+	return res, nil
+}
+
 // multiHashring represents a set of hashrings.
 // Which hashring to use for a tenant is determined
 // by the tenants field of the hashring configuration.
@@ -108,11 +224,29 @@ func (m *multiHashring) Get(tenant string, ts *prompb.TimeSeries) (string, error
 
 // GetN returns the nth target to handle the given tenant and time series.
 func (m *multiHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (string, error) {
+	h, err := m.hashring(tenant)
+	if err != nil {
+		return "", err
+	}
+	return h.GetN(tenant, ts, n)
+}
+
+// GetReplicas returns the first n targets to handle the given tenant and time series.
+func (m *multiHashring) GetReplicas(tenant string, ts *prompb.TimeSeries, n uint64) ([]string, error) {
+	h, err := m.hashring(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return h.GetReplicas(tenant, ts, n)
+}
+
+// hashring returns the hashring handling the given tenant.
+func (m *multiHashring) hashring(tenant string) (Hashring, error) {
 	m.mu.RLock()
 	h, ok := m.cache[tenant]
 	m.mu.RUnlock()
 	if ok {
-		return h.GetN(tenant, ts, n)
+		return h, nil
 	}
 	var found bool
 	// If the tenant is not in the cache, then we need to check
@@ -129,10 +263,10 @@ func (m *multiHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 			m.mu.Lock()
 			m.cache[tenant] = m.hashrings[i]
 			m.mu.Unlock()
-			return m.hashrings[i].GetN(tenant, ts, n)
+			return m.hashrings[i], nil
 		}
 	}
-	return "", errors.New("no matching hashring to handle tenant")
+	return nil, errors.New("no matching hashring to handle tenant")
 }
 
 // newMultiHashring creates a multi-tenant hashring for a given slice of
@@ -145,7 +279,12 @@ func newMultiHashring(cfg []HashringConfig) Hashring {
 	}
 
 	for _, h := range cfg {
-		m.hashrings = append(m.hashrings, simpleHashring(h.Endpoints))
+		switch h.Algorithm {
+		case AlgorithmKetama:
+			m.hashrings = append(m.hashrings, newKetamaHashring(h.Endpoints))
+		default:
+			m.hashrings = append(m.hashrings, simpleHashring(h.Endpoints))
+		}
 		var t map[string]struct{}
 		if len(h.Tenants) != 0 {
 			t = make(map[string]struct{})
@@ -4,10 +4,12 @@
 package receive
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
 func TestHash(t *testing.T) {
@@ -136,6 +138,20 @@ func TestHashringGet(t *testing.T) {
 			},
 			tenant: "tenant1",
 		},
+		{
+			name: "many nodes ketama",
+			cfg: []HashringConfig{
+				{
+					Endpoints: []string{"node1", "node2", "node3"},
+					Algorithm: AlgorithmKetama,
+				},
+			},
+			nodes: map[string]struct{}{
+				"node1": {},
+				"node2": {},
+				"node3": {},
+			},
+		},
 		{
 			name: "many nodes default",
 			cfg: []HashringConfig{
@@ -171,3 +187,58 @@ func TestHashringGet(t *testing.T) {
 		}
 	}
 }
+
+func TestKetamaHashringGetN(t *testing.T) {
+	h := newKetamaHashring([]string{"node1", "node2", "node3"})
+	reversed := newKetamaHashring([]string{"node3", "node2", "node1"})
+
+	for i := 0; i < 100; i++ {
+		ts := &prompb.TimeSeries{Labels: []labelpb.ZLabel{{Name: "series", Value: fmt.Sprint(i)}}}
+
+		replicas, err := h.GetReplicas("tenant", ts, 3)
+		testutil.Ok(t, err)
+
+		seen := map[string]struct{}{}
+		for n := uint64(0); n < 3; n++ {
+			node, err := h.GetN("tenant", ts, n)
+			testutil.Ok(t, err)
+			testutil.Equals(t, node, replicas[n])
+			seen[node] = struct{}{}
+
+			// The ring does not depend on the order of the endpoints.
+			other, err := reversed.GetN("tenant", ts, n)
+			testutil.Ok(t, err)
+			testutil.Equals(t, node, other)
+		}
+		testutil.Equals(t, 3, len(seen))
+
+		_, err = h.GetN("tenant", ts, 3)
+		testutil.NotOk(t, err)
+		_, err = h.GetReplicas("tenant", ts, 4)
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestKetamaHashringResharding(t *testing.T) {
+	const series = 10000
+
+	before := newKetamaHashring([]string{"node1", "node2", "node3", "node4"})
+	after := newKetamaHashring([]string{"node1", "node2", "node3", "node4", "node5"})
+
+	moved := 0
+	for i := 0; i < series; i++ {
+		ts := &prompb.TimeSeries{Labels: []labelpb.ZLabel{{Name: "series", Value: fmt.Sprint(i)}}}
+
+		b, err := before.Get("tenant", ts)
+		testutil.Ok(t, err)
+		a, err := after.Get("tenant", ts)
+		testutil.Ok(t, err)
+		if a != b {
+			// Time series only move to the new node.
+			testutil.Equals(t, "node5", a)
+			moved++
+		}
+	}
+	// About a fifth of the time series move to the new node, instead of almost all of them with hashmod.
+	testutil.Assert(t, moved > series/10 && moved < series*3/10, "unexpected number of moved series %d", moved)
+}
@@ -0,0 +1,311 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	reasonBodySize = "body_size"
+	reasonLabels   = "labels"
+	reasonRate     = "rate"
+	reasonSeries   = "series"
+)
+
+var (
+	errBodyLimited   = errors.New("request body exceeds the limit")
+	errLabelsLimited = errors.New("series labels exceed the limits")
+	errRateLimited   = errors.New("samples rate exceeds the limit")
+	errBurstExceeded = errors.New("request samples exceed the burst")
+	errSeriesLimited = errors.New("active series exceed the limit")
+)
+
+// Limits are the limits enforced on the write requests of a tenant. Zero values mean no limit.
+type Limits struct {
+	// MaxSeries is the maximum number of active series, i.e. series which received samples in the last 10 minutes.
+	MaxSeries int `yaml:"max_series"`
+	// SamplesPerSecond is the maximum rate of samples.
+	SamplesPerSecond float64 `yaml:"samples_per_second"`
+	// SamplesBurst is the maximum number of samples above the rate in a short time. It defaults to SamplesPerSecond.
+	SamplesBurst int `yaml:"samples_burst"`
+	// MaxRequestBodyBytes is the maximum size of the compressed body of a request.
+	MaxRequestBodyBytes int64 `yaml:"max_request_body_bytes"`
+	// MaxLabelsPerSeries is the maximum number of labels of a series.
+	MaxLabelsPerSeries int `yaml:"max_labels_per_series"`
+	// MaxLabelNameLength is the maximum length of a label name.
+	MaxLabelNameLength int `yaml:"max_label_name_length"`
+	// MaxLabelValueLength is the maximum length of a label value.
+	MaxLabelValueLength int `yaml:"max_label_value_length"`
+}
+
+// limitsOverride is the limits of a tenant in the limits configuration, overriding the default ones if set.
+type limitsOverride struct {
+	MaxSeries           *int     `yaml:"max_series"`
+	SamplesPerSecond    *float64 `yaml:"samples_per_second"`
+	SamplesBurst        *int     `yaml:"samples_burst"`
+	MaxRequestBodyBytes *int64   `yaml:"max_request_body_bytes"`
+	MaxLabelsPerSeries  *int     `yaml:"max_labels_per_series"`
+	MaxLabelNameLength  *int     `yaml:"max_label_name_length"`
+	MaxLabelValueLength *int     `yaml:"max_label_value_length"`
+}
+
+type limitsConfig struct {
+	Default Limits                    `yaml:"default"`
+	Tenants map[string]limitsOverride `yaml:"tenants"`
+}
+
+// Limiter enforces the limits of the write requests of each tenant. A nil Limiter is valid and enforces no limits.
+type Limiter struct {
+	defaults  Limits
+	overrides map[string]Limits
+
+	mtx     sync.Mutex
+	tenants map[string]*tenantLimiter
+	// lastEviction is the last time the idle tenants were evicted from tenants.
+	lastEviction time.Time
+
+	limitedRequests *prometheus.CounterVec
+	limitedSamples  *prometheus.CounterVec
+	activeSeries    *prometheus.GaugeVec
+}
+
+// tenantLimiter is the state of the limits of a tenant.
+type tenantLimiter struct {
+	limits Limits
+	rate   *rate.Limiter
+	series *seriesTracker
+	// lastSeen is the time of the last request of the tenant.
+	lastSeen time.Time
+}
+
+// idleTimeout returns the time after which the state of the tenant without requests is back to its initial state:
+// its series are not active anymore and its rate limit burst is refilled. It can then be evicted.
+func (t *tenantLimiter) idleTimeout() time.Duration {
+	d := activeSeriesWindow
+	if t.rate != nil {
+		if refill := time.Duration(float64(t.rate.Burst()) / float64(t.rate.Limit()) * float64(time.Second)); refill > d {
+			d = refill
+		}
+	}
+	return d
+}
+
+// NewLimiter creates a Limiter from the YAML limits configuration. It returns nil if the configuration is empty.
+func NewLimiter(reg prometheus.Registerer, content []byte) (*Limiter, error) {
+	if len(content) == 0 {
+		return nil, nil
+	}
+	var conf limitsConfig
+	if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+		return nil, errors.Wrap(err, "parsing limits configuration")
+	}
+	if err := validateLimits(conf.Default); err != nil {
+		return nil, errors.Wrap(err, "default limits")
+	}
+
+	l := &Limiter{
+		defaults:  conf.Default,
+		overrides: map[string]Limits{},
+		tenants:   map[string]*tenantLimiter{},
+		limitedRequests: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_limited_requests_total",
+				Help: "The number of write requests exceeding the limits of their tenant.",
+			}, []string{"tenant", "reason"},
+		),
+		limitedSamples: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_limited_samples_total",
+				Help: "The number of samples rejected because of the limits of their tenant.",
+			}, []string{"tenant", "reason"},
+		),
+		activeSeries: promauto.With(reg).NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "thanos_receive_limits_active_series",
+				Help: "The number of active series of the tenants limiting them.",
+			}, []string{"tenant"},
+		),
+	}
+	for tenant, o := range conf.Tenants {
+		limits := conf.Default
+		if o.MaxSeries != nil {
+			limits.MaxSeries = *o.MaxSeries
+		}
+		if o.SamplesPerSecond != nil {
+			limits.SamplesPerSecond = *o.SamplesPerSecond
+		}
+		if o.SamplesBurst != nil {
+			limits.SamplesBurst = *o.SamplesBurst
+		}
+		if o.MaxRequestBodyBytes != nil {
+			limits.MaxRequestBodyBytes = *o.MaxRequestBodyBytes
+		}
+		if o.MaxLabelsPerSeries != nil {
+			limits.MaxLabelsPerSeries = *o.MaxLabelsPerSeries
+		}
+		if o.MaxLabelNameLength != nil {
+			limits.MaxLabelNameLength = *o.MaxLabelNameLength
+		}
+		if o.MaxLabelValueLength != nil {
+			limits.MaxLabelValueLength = *o.MaxLabelValueLength
+		}
+		if err := validateLimits(limits); err != nil {
+			return nil, errors.Wrapf(err, "limits of tenant %s", tenant)
+		}
+		l.overrides[tenant] = limits
+	}
+	return l, nil
+}
+
+func validateLimits(l Limits) error {
+	if l.MaxSeries < 0 || l.SamplesPerSecond < 0 || l.SamplesBurst < 0 || l.MaxRequestBodyBytes < 0 ||
+		l.MaxLabelsPerSeries < 0 || l.MaxLabelNameLength < 0 || l.MaxLabelValueLength < 0 {
+		return errors.New("negative limit")
+	}
+	return nil
+}
+
+// limits returns the limits of the given tenant.
+func (l *Limiter) limits(tenant string) Limits {
+	if limits, ok := l.overrides[tenant]; ok {
+		return limits
+	}
+	return l.defaults
+}
+
+// tenant returns the state of the limits of the given tenant, receiving a request at the given time. The state of
+// the tenants idle for longer than their idle timeout is evicted, at most every activeSeriesWindow.
+func (l *Limiter) tenant(tenant string, now time.Time) *tenantLimiter {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if now.Sub(l.lastEviction) >= activeSeriesWindow {
+		for name, t := range l.tenants {
+			if now.Sub(t.lastSeen) > t.idleTimeout() {
+				delete(l.tenants, name)
+				l.activeSeries.DeleteLabelValues(name)
+			}
+		}
+		l.lastEviction = now
+	}
+
+	if t, ok := l.tenants[tenant]; ok {
+		t.lastSeen = now
+		return t
+	}
+	limits := l.limits(tenant)
+	t := &tenantLimiter{limits: limits, series: newSeriesTracker(), lastSeen: now}
+	if limits.SamplesPerSecond > 0 {
+		burst := limits.SamplesBurst
+		if burst == 0 {
+			burst = int(limits.SamplesPerSecond)
+		}
+		t.rate = rate.NewLimiter(rate.Limit(limits.SamplesPerSecond), burst)
+	}
+	l.tenants[tenant] = t
+	return t
+}
+
+// MaxRequestBodyBytes returns the maximum size of the compressed body of the requests of the given tenant, or 0 if
+// it is not limited.
+func (l *Limiter) MaxRequestBodyBytes(tenant string) int64 {
+	if l == nil {
+		return 0
+	}
+	return l.limits(tenant).MaxRequestBodyBytes
+}
+
+// RejectBody records the rejection of a request of the given tenant with a too large body.
+func (l *Limiter) RejectBody(tenant string) {
+	if l == nil {
+		return
+	}
+	l.limitedRequests.WithLabelValues(tenant, reasonBodySize).Inc()
+}
+
+// Limit enforces the limits of the given tenant on the given write request at the given time. The series exceeding
+// the label limits and the new series exceeding the active series limit are removed from the request, and the cause
+// of the error returned is errLabelsLimited or errSeriesLimited: the rest of the request can still be written.
+// If the samples exceed the rate limit, the cause of the error returned is errRateLimited and the whole request must
+// be rejected, and retried later. If the request has more samples than the rate limit burst, it can never be accepted:
+// the cause of the error returned is errBurstExceeded.
+func (l *Limiter) Limit(tenant string, wreq *prompb.WriteRequest, now time.Time) error {
+	if l == nil {
+		return nil
+	}
+	t := l.tenant(tenant, now)
+
+	var labelsErr error
+	if t.limits.MaxLabelsPerSeries > 0 || t.limits.MaxLabelNameLength > 0 || t.limits.MaxLabelValueLength > 0 {
+		kept := wreq.Timeseries[:0]
+		for _, ts := range wreq.Timeseries {
+			if err := t.validateLabels(ts); err != nil {
+				l.limitedSamples.WithLabelValues(tenant, reasonLabels).Add(float64(len(ts.Samples)))
+				if labelsErr == nil {
+					labelsErr = err
+				}
+				continue
+			}
+			kept = append(kept, ts)
+		}
+		wreq.Timeseries = kept
+		if labelsErr != nil {
+			l.limitedRequests.WithLabelValues(tenant, reasonLabels).Inc()
+		}
+	}
+
+	if t.rate != nil {
+		var samples int
+		for _, ts := range wreq.Timeseries {
+			samples += len(ts.Samples)
+		}
+		if samples > t.rate.Burst() {
+			l.limitedRequests.WithLabelValues(tenant, reasonRate).Inc()
+			l.limitedSamples.WithLabelValues(tenant, reasonRate).Add(float64(samples))
+			return errors.Wrapf(errBurstExceeded, "%d samples with a burst of %d, split the request", samples, t.rate.Burst())
+		}
+		if !t.rate.AllowN(now, samples) {
+			l.limitedRequests.WithLabelValues(tenant, reasonRate).Inc()
+			l.limitedSamples.WithLabelValues(tenant, reasonRate).Add(float64(samples))
+			return errors.Wrapf(errRateLimited, "%d samples at %v per second with a burst of %d", samples, t.limits.SamplesPerSecond, t.rate.Burst())
+		}
+	}
+
+	if t.limits.MaxSeries > 0 {
+		kept, active, dropped, samples := t.series.track(tenant, wreq.Timeseries, now, t.limits.MaxSeries)
+		wreq.Timeseries = kept
+		l.activeSeries.WithLabelValues(tenant).Set(float64(active))
+		if dropped > 0 {
+			l.limitedRequests.WithLabelValues(tenant, reasonSeries).Inc()
+			l.limitedSamples.WithLabelValues(tenant, reasonSeries).Add(float64(samples))
+			return errors.Wrapf(errSeriesLimited, "%d new series rejected, limit %d", dropped, t.limits.MaxSeries)
+		}
+	}
+	return labelsErr
+}
+
+func (t *tenantLimiter) validateLabels(ts prompb.TimeSeries) error {
+	if t.limits.MaxLabelsPerSeries > 0 && len(ts.Labels) > t.limits.MaxLabelsPerSeries {
+		return errors.Wrapf(errLabelsLimited, "series with %d labels, limit %d", len(ts.Labels), t.limits.MaxLabelsPerSeries)
+	}
+	for _, l := range ts.Labels {
+		if t.limits.MaxLabelNameLength > 0 && len(l.Name) > t.limits.MaxLabelNameLength {
+			return errors.Wrapf(errLabelsLimited, "label name %q longer than %d", l.Name, t.limits.MaxLabelNameLength)
+		}
+		if t.limits.MaxLabelValueLength > 0 && len(l.Value) > t.limits.MaxLabelValueLength {
+			return errors.Wrapf(errLabelsLimited, "value of label %q longer than %d", l.Name, t.limits.MaxLabelValueLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func seriesRequest(from, to int, labels ...labelpb.ZLabel) *prompb.WriteRequest {
+	wreq := &prompb.WriteRequest{}
+	for i := from; i < to; i++ {
+		wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+			Labels:  append([]labelpb.ZLabel{{Name: "series", Value: fmt.Sprint(i)}}, labels...),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		})
+	}
+	return wreq
+}
+
+func TestNewLimiter(t *testing.T) {
+	l, err := NewLimiter(nil, nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, l == nil, "expected no limiter without configuration")
+	testutil.Equals(t, int64(0), l.MaxRequestBodyBytes("tenant"))
+	testutil.Ok(t, l.Limit("tenant", seriesRequest(0, 10), time.Now()))
+
+	_, err = NewLimiter(nil, []byte(`
+default:
+  max_series: -1
+`))
+	testutil.NotOk(t, err)
+	_, err = NewLimiter(nil, []byte(`
+tenants:
+  tenant:
+    unknown: 1
+`))
+	testutil.NotOk(t, err)
+
+	l, err = NewLimiter(nil, []byte(`
+default:
+  max_series: 10
+  max_request_body_bytes: 1024
+tenants:
+  tenant-a:
+    max_request_body_bytes: 0
+  tenant-b:
+    max_series: 20
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, Limits{MaxSeries: 10, MaxRequestBodyBytes: 1024}, l.limits("default"))
+	testutil.Equals(t, Limits{MaxSeries: 10}, l.limits("tenant-a"))
+	testutil.Equals(t, Limits{MaxSeries: 20, MaxRequestBodyBytes: 1024}, l.limits("tenant-b"))
+}
+
+func TestLimiterLimit(t *testing.T) {
+	l, err := NewLimiter(nil, []byte(`
+tenants:
+  labels:
+    max_labels_per_series: 2
+    max_label_name_length: 6
+    max_label_value_length: 3
+  rate:
+    samples_per_second: 1
+    samples_burst: 10
+  series:
+    max_series: 10
+`))
+	testutil.Ok(t, err)
+	now := time.Now()
+
+	t.Run("labels", func(t *testing.T) {
+		wreq := seriesRequest(0, 2)
+		testutil.Ok(t, l.Limit("labels", wreq, now))
+		testutil.Equals(t, 2, len(wreq.Timeseries))
+
+		for _, lbls := range [][]labelpb.ZLabel{
+			{{Name: "a", Value: "b"}, {Name: "c", Value: "d"}},
+			{{Name: "longest", Value: "b"}},
+			{{Name: "a", Value: "long"}},
+		} {
+			wreq = seriesRequest(0, 2)
+			wreq.Timeseries[1].Labels = append(wreq.Timeseries[1].Labels, lbls...)
+			testutil.Equals(t, errLabelsLimited, errors.Cause(l.Limit("labels", wreq, now)))
+			testutil.Equals(t, seriesRequest(0, 1), wreq)
+		}
+		testutil.Equals(t, 3, int(promtestutil.ToFloat64(l.limitedSamples.WithLabelValues("labels", reasonLabels))))
+	})
+	t.Run("rate", func(t *testing.T) {
+		testutil.Ok(t, l.Limit("rate", seriesRequest(0, 10), now))
+		testutil.Equals(t, errRateLimited, errors.Cause(l.Limit("rate", seriesRequest(0, 1), now)))
+		testutil.Ok(t, l.Limit("rate", seriesRequest(0, 1), now.Add(time.Second)))
+		testutil.Equals(t, 1, int(promtestutil.ToFloat64(l.limitedRequests.WithLabelValues("rate", reasonRate))))
+
+		// A request larger than the burst can never be accepted.
+		testutil.Equals(t, errBurstExceeded, errors.Cause(l.Limit("rate", seriesRequest(0, 11), now.Add(time.Hour))))
+		testutil.Ok(t, l.Limit("rate", seriesRequest(0, 10), now.Add(time.Hour)))
+	})
+	t.Run("series", func(t *testing.T) {
+		testutil.Ok(t, l.Limit("series", seriesRequest(0, 8), now))
+
+		// The new series above the limit are removed, the active ones are kept.
+		wreq := seriesRequest(5, 15)
+		testutil.Equals(t, errSeriesLimited, errors.Cause(l.Limit("series", wreq, now)))
+		testutil.Equals(t, seriesRequest(5, 10), wreq)
+		testutil.Equals(t, 10, int(promtestutil.ToFloat64(l.activeSeries.WithLabelValues("series"))))
+		testutil.Equals(t, 5, int(promtestutil.ToFloat64(l.limitedSamples.WithLabelValues("series", reasonSeries))))
+
+		// The series are not active anymore without samples.
+		later := now.Add(activeSeriesWindow + time.Second)
+		testutil.Ok(t, l.Limit("series", seriesRequest(10, 20), later))
+		testutil.Equals(t, 10, int(promtestutil.ToFloat64(l.activeSeries.WithLabelValues("series"))))
+	})
+	t.Run("idle tenants", func(t *testing.T) {
+		later := now.Add(2 * time.Hour)
+		testutil.Ok(t, l.Limit("idle", seriesRequest(0, 1), later))
+		_, ok := l.tenants["series"]
+		testutil.Assert(t, !ok, "idle tenant not evicted")
+		_, ok = l.tenants["idle"]
+		testutil.Assert(t, ok, "active tenant evicted")
+	})
+	t.Run("no limits", func(t *testing.T) {
+		wreq := seriesRequest(0, 100, labelpb.ZLabel{Name: "very_long_label_name", Value: "very_long_label_value"})
+		testutil.Ok(t, l.Limit("other", wreq, now))
+		testutil.Equals(t, 100, len(wreq.Timeseries))
+	})
+}
+
+func TestReceiveLimits(t *testing.T) {
+	appendable := &fakeAppendable{appender: newFakeAppender(nil, nil, nil, nil)}
+	handlers, _ := newHandlerHashring([]*fakeAppendable{appendable}, 1)
+	h := handlers[0]
+
+	var err error
+	h.options.Limiter, err = NewLimiter(nil, []byte(`
+tenants:
+  body:
+    max_request_body_bytes: 10
+  rate:
+    samples_per_second: 1
+    samples_burst: 2
+  burst:
+    samples_per_second: 1
+  series:
+    max_series: 1
+`))
+	testutil.Ok(t, err)
+
+	for _, tc := range []struct {
+		tenant   string
+		requests int
+		status   int
+	}{
+		{tenant: "other", requests: 1, status: http.StatusOK},
+		{tenant: "body", requests: 1, status: http.StatusRequestEntityTooLarge},
+		{tenant: "rate", requests: 2, status: http.StatusTooManyRequests},
+		{tenant: "burst", requests: 1, status: http.StatusRequestEntityTooLarge},
+		{tenant: "series", requests: 1, status: http.StatusTooManyRequests},
+	} {
+		t.Run(tc.tenant, func(t *testing.T) {
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tc.requests; i++ {
+				var err error
+				rec, err = makeRequest(h, tc.tenant, seriesRequest(0, 2))
+				testutil.Ok(t, err)
+			}
+			testutil.Equals(t, tc.status, rec.Code)
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -18,8 +19,11 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/fileutil"
+	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/errutil"
@@ -34,6 +38,7 @@ type MultiTSDB struct {
 	logger          log.Logger
 	reg             prometheus.Registerer
 	tsdbOpts        *tsdb.Options
+	tenantTSDBOpts  *TenantTSDBOptions
 	tenantLabelName string
 	labels          labels.Labels
 	bucket          objstore.Bucket
@@ -41,6 +46,8 @@ type MultiTSDB struct {
 	mtx                   *sync.RWMutex
 	tenants               map[string]*tenant
 	allowOutOfOrderUpload bool
+	uploadOpts            block.UploadOptions
+	annotations           map[string]string
 }
 
 func NewMultiTSDB(
@@ -48,10 +55,13 @@ func NewMultiTSDB(
 	l log.Logger,
 	reg prometheus.Registerer,
 	tsdbOpts *tsdb.Options,
+	tenantTSDBOpts *TenantTSDBOptions,
 	labels labels.Labels,
 	tenantLabelName string,
 	bucket objstore.Bucket,
 	allowOutOfOrderUpload bool,
+	uploadOpts block.UploadOptions,
+	annotations map[string]string,
 ) *MultiTSDB {
 	if l == nil {
 		l = log.NewNopLogger()
@@ -62,12 +72,15 @@ func NewMultiTSDB(
 		logger:                log.With(l, "component", "multi-tsdb"),
 		reg:                   reg,
 		tsdbOpts:              tsdbOpts,
+		tenantTSDBOpts:        tenantTSDBOpts,
 		mtx:                   &sync.RWMutex{},
 		tenants:               map[string]*tenant{},
 		labels:                labels,
 		tenantLabelName:       tenantLabelName,
 		bucket:                bucket,
 		allowOutOfOrderUpload: allowOutOfOrderUpload,
+		uploadOpts:            uploadOpts,
+		annotations:           annotations,
 	}
 }
 
@@ -214,6 +227,68 @@ func (t *MultiTSDB) Sync(ctx context.Context) error {
 	return merr.Err()
 }
 
+// Prune flushes, uploads, closes and removes the TSDBs of the tenants which received no writes for idleTimeout, so
+// tenants which stopped sending data do not keep their TSDB open forever. The TSDB of a pruned tenant is re-created on
+// its next write.
+// NOTE: Prune must not be invoked concurrently with Sync, as they both upload the blocks of the tenants.
+func (t *MultiTSDB) Prune(ctx context.Context, idleTimeout time.Duration) error {
+	if t.bucket == nil {
+		return errors.New("bucket is not specified, Prune should not be invoked")
+	}
+
+	idle := map[string]*tenant{}
+	t.mtx.RLock()
+	for id, tenant := range t.tenants {
+		if tenant.readyStorage().Get() != nil && time.Since(tenant.readyStorage().LastAppend()) > idleTimeout {
+			idle[id] = tenant
+		}
+	}
+	t.mtx.RUnlock()
+
+	merr := errutil.MultiError{}
+	for id, tenant := range idle {
+		if err := t.pruneTenant(ctx, log.With(t.logger, "tenant", id), id, tenant); err != nil {
+			merr.Add(errors.Wrapf(err, "prune tenant %s", id))
+		}
+	}
+	return merr.Err()
+}
+
+func (t *MultiTSDB) pruneTenant(ctx context.Context, logger log.Logger, tenantID string, tenant *tenant) error {
+	db := tenant.readyStorage().Get()
+	lastAppend := tenant.readyStorage().LastAppend()
+	level.Info(logger).Log("msg", "pruning idle TSDB", "lastAppend", lastAppend)
+
+	head := db.Head()
+	if head.MinTime() <= head.MaxTime() {
+		if err := db.CompactHead(tsdb.NewRangeHead(head, head.MinTime(), head.MaxTime())); err != nil {
+			return errors.Wrap(err, "flush head")
+		}
+	}
+	if _, err := tenant.shipper().Sync(ctx); err != nil {
+		return errors.Wrap(err, "upload blocks")
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	// Writes received while flushing and uploading are not uploaded yet, so the tenant is pruned on a later attempt.
+	if !tenant.readyStorage().unsetIfIdle(lastAppend) {
+		level.Info(logger).Log("msg", "TSDB received writes while being pruned, keeping it")
+		return nil
+	}
+	tenant.set(nil, nil, nil)
+	delete(t.tenants, tenantID)
+	if err := db.Close(); err != nil {
+		return errors.Wrap(err, "close TSDB")
+	}
+	if err := os.RemoveAll(t.defaultTenantDataDir(tenantID)); err != nil {
+		return errors.Wrap(err, "remove TSDB")
+	}
+	level.Info(logger).Log("msg", "pruned idle TSDB")
+	return nil
+}
+
 func (t *MultiTSDB) RemoveLockFilesIfAny() error {
 	fis, err := ioutil.ReadDir(t.dataDir)
 	if err != nil {
@@ -254,17 +329,38 @@ func (t *MultiTSDB) TSDBStores() map[string]storepb.StoreServer {
 	return res
 }
 
+// TenantsStoredBytes returns the size on disk of the TSDB of each tenant, including its WAL.
+func (t *MultiTSDB) TenantsStoredBytes() (map[string]int64, error) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	res := make(map[string]int64, len(t.tenants))
+	for id := range t.tenants {
+		size, err := fileutil.DirSize(t.defaultTenantDataDir(id))
+		if err != nil {
+			return nil, errors.Wrapf(err, "size of TSDB of tenant %s", id)
+		}
+		res[id] = size
+	}
+	return res, nil
+}
+
 func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant) error {
-	reg := prometheus.WrapRegistererWith(prometheus.Labels{"tenant": tenantID}, t.reg)
+	// The metrics of pruned tenants are registered again once their TSDB is re-created.
+	reg := &UnRegisterer{Registerer: prometheus.WrapRegistererWith(prometheus.Labels{"tenant": tenantID}, t.reg)}
 	lbls := append(t.labels, labels.Label{Name: t.tenantLabelName, Value: tenantID})
 	dataDir := t.defaultTenantDataDir(tenantID)
 
-	level.Info(logger).Log("msg", "opening TSDB")
 	opts := *t.tsdbOpts
+	if o := t.tenantTSDBOpts.ForTenant(tenantID); o != nil {
+		opts = *o
+	}
+	level.Info(logger).Log("msg", "opening TSDB", "retention", time.Duration(opts.RetentionDuration)*time.Millisecond,
+		"block_duration", time.Duration(opts.MaxBlockDuration)*time.Millisecond, "wal_compression", opts.WALCompression)
 	s, err := tsdb.Open(
 		dataDir,
 		logger,
-		&UnRegisterer{Registerer: reg},
+		reg,
 		&opts,
 	)
 	if err != nil {
@@ -275,6 +371,10 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 	}
 	var ship *shipper.Shipper
 	if t.bucket != nil {
+		annotations := map[string]string{metadata.TenantAnnotation: tenantID}
+		for k, v := range t.annotations {
+			annotations[k] = v
+		}
 		ship = shipper.New(
 			logger,
 			reg,
@@ -282,8 +382,10 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 			t.bucket,
 			func() labels.Labels { return lbls },
 			metadata.ReceiveSource,
+			annotations,
 			false,
 			t.allowOutOfOrderUpload,
+			t.uploadOpts,
 		)
 	}
 	tenant.set(store.NewTSDBStore(logger, reg, s, component.Receive, lbls), s, ship)
@@ -347,14 +449,41 @@ var ErrNotReady = errors.New("TSDB not ready")
 type ReadyStorage struct {
 	mtx sync.RWMutex
 	a   *adapter
+
+	lastAppend atomic.Int64
+	// appenders is the number of appenders not committed or rolled back yet.
+	appenders atomic.Int64
 }
 
-// Set the storage.
+// Set the storage. Setting nil storage makes it not ready again.
 func (s *ReadyStorage) Set(db *tsdb.DB) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
+	if db == nil {
+		s.a = nil
+		return
+	}
 	s.a = &adapter{db: db}
+	s.lastAppend.Store(time.Now().UnixNano())
+}
+
+// unsetIfIdle makes the storage not ready again, unless it has appenders in flight or was appended to since the given
+// time of its last append. It returns true if the storage was unset.
+func (s *ReadyStorage) unsetIfIdle(lastAppend time.Time) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.appenders.Load() > 0 || !s.LastAppend().Equal(lastAppend) {
+		return false
+	}
+	s.a = nil
+	return true
+}
+
+// LastAppend returns the time of the last append to the storage, or the time it was set if none.
+func (s *ReadyStorage) LastAppend() time.Time {
+	return time.Unix(0, s.lastAppend.Load())
 }
 
 // Get the storage.
@@ -385,12 +514,47 @@ func (s *ReadyStorage) Querier(ctx context.Context, mint, maxt int64) (storage.Q
 	return nil, ErrNotReady
 }
 
-// Appender implements the Storage interface.
+// Appender implements the Storage interface. The storage is not unset by unsetIfIdle until the appender is committed
+// or rolled back.
 func (s *ReadyStorage) Appender(ctx context.Context) (storage.Appender, error) {
-	if x := s.get(); x != nil {
-		return x.Appender(ctx)
+	// The lock is held until the appender is counted, so that the storage can't be unset in between.
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.a == nil {
+		return nil, ErrNotReady
 	}
-	return nil, ErrNotReady
+	s.lastAppend.Store(time.Now().UnixNano())
+	app, err := s.a.Appender(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.appenders.Inc()
+	return &readyAppender{Appender: app, s: s}, nil
+}
+
+// readyAppender is an appender of a ReadyStorage, counted until it is committed or rolled back.
+type readyAppender struct {
+	storage.Appender
+	s    *ReadyStorage
+	once sync.Once
+}
+
+func (a *readyAppender) Commit() error {
+	defer a.done()
+	return a.Appender.Commit()
+}
+
+func (a *readyAppender) Rollback() error {
+	defer a.done()
+	return a.Appender.Rollback()
+}
+
+func (a *readyAppender) done() {
+	a.once.Do(func() {
+		a.s.lastAppend.Store(time.Now().UnixNano())
+		a.s.appenders.Dec()
+	})
 }
 
 // Close implements the Storage interface.
@@ -7,6 +7,7 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +19,9 @@ import (
 	"github.com/prometheus/prometheus/tsdb"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -38,10 +42,13 @@ func TestMultiTSDB(t *testing.T) {
 				RetentionDuration: int64(6 * time.Hour / time.Millisecond),
 				NoLockfile:        true,
 			},
+			nil,
 			labels.FromStrings("replica", "01"),
 			"tenant_id",
 			nil,
 			false,
+			block.UploadOptions{},
+			nil,
 		)
 		defer func() { testutil.Ok(t, m.Close()) }()
 
@@ -105,10 +112,13 @@ func TestMultiTSDB(t *testing.T) {
 				RetentionDuration: int64(6 * time.Hour / time.Millisecond),
 				NoLockfile:        true,
 			},
+			nil,
 			labels.FromStrings("replica", "01"),
 			"tenant_id",
 			nil,
 			false,
+			block.UploadOptions{},
+			nil,
 		)
 		defer func() { testutil.Ok(t, m.Close()) }()
 
@@ -139,6 +149,87 @@ func TestMultiTSDB(t *testing.T) {
 	})
 }
 
+func TestMultiTSDB_Prune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.NewInMemBucket()
+	m := NewMultiTSDB(
+		dir, log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+			MinBlockDuration:  int64(2 * time.Hour / time.Millisecond),
+			MaxBlockDuration:  int64(2 * time.Hour / time.Millisecond),
+			RetentionDuration: int64(6 * time.Hour / time.Millisecond),
+			NoLockfile:        true,
+		},
+		nil,
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		bkt,
+		false,
+		block.UploadOptions{},
+		nil,
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	appendSample := func(tenantID string, ts int64) {
+		app, err := m.TenantAppendable(tenantID)
+		testutil.Ok(t, err)
+
+		var a storage.Appender
+		testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+			a, err = app.Appender(context.Background())
+			return err
+		}))
+		_, err = a.Add(labels.FromStrings("a", "1"), ts, 1)
+		testutil.Ok(t, err)
+		testutil.Ok(t, a.Commit())
+	}
+	appendSample("foo", 1)
+	appendSample("bar", 1)
+
+	// Tenants written to recently are kept.
+	testutil.Ok(t, m.Prune(ctx, time.Hour))
+	testutil.Equals(t, 2, len(m.TSDBStores()))
+	testutil.Equals(t, 0, len(bkt.Objects()))
+
+	time.Sleep(10 * time.Millisecond)
+	appendSample("bar", 2)
+	testutil.Ok(t, m.Prune(ctx, 5*time.Millisecond))
+	testutil.Equals(t, 1, len(m.TSDBStores()))
+	_, ok := m.TSDBStores()["bar"]
+	testutil.Assert(t, ok, "tenant bar written to recently should be kept")
+
+	_, err = os.Stat(m.defaultTenantDataDir("foo"))
+	testutil.Assert(t, os.IsNotExist(err), "data dir of the pruned tenant should be removed, got %v", err)
+	var metas int
+	for name := range bkt.Objects() {
+		if strings.HasSuffix(name, "/"+metadata.MetaFilename) {
+			metas++
+		}
+	}
+	testutil.Equals(t, 1, metas)
+
+	// Tenants with appenders in flight are kept, even if idle.
+	app, err := m.TenantAppendable("bar")
+	testutil.Ok(t, err)
+	a, err := app.Appender(context.Background())
+	testutil.Ok(t, err)
+	time.Sleep(10 * time.Millisecond)
+	testutil.Ok(t, m.Prune(ctx, 5*time.Millisecond))
+	testutil.Equals(t, 1, len(m.TSDBStores()))
+	_, err = a.Add(labels.FromStrings("a", "1"), 4, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, a.Commit())
+
+	// The TSDB of a pruned tenant is created again on its next write.
+	appendSample("foo", 3)
+	testutil.Equals(t, 2, len(m.TSDBStores()))
+}
+
 var (
 	expectedFooResp = []storepb.Series{
 		{
@@ -0,0 +1,197 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+const (
+	// activeSeriesWindow is the time after which a series not receiving samples is not active anymore.
+	activeSeriesWindow = 10 * time.Minute
+	// activeSeriesPruneInterval is the interval at which the series which are not active anymore are forgotten.
+	activeSeriesPruneInterval = time.Minute
+)
+
+// errHeadSeriesLimited is returned when new series are not written to the TSDB of their tenant because it has
+// too many active series.
+var errHeadSeriesLimited = errors.New("active series of the TSDB exceed the limit")
+
+// seriesTracker tracks the active series of a tenant, i.e. the series which received samples in the last
+// activeSeriesWindow.
+type seriesTracker struct {
+	mtx        sync.Mutex
+	series     map[uint64]time.Time
+	lastPruned time.Time
+}
+
+func newSeriesTracker() *seriesTracker {
+	return &seriesTracker{series: map[uint64]time.Time{}}
+}
+
+// track marks the given series of the given tenant as active at the given time. If limit is not 0, the new series
+// are not marked once there are limit active series: the series which are marked are returned in a new slice,
+// along with the number of active series and the number of series and samples not marked.
+func (s *seriesTracker) track(tenant string, series []prompb.TimeSeries, now time.Time, limit int) (kept []prompb.TimeSeries, active, dropped, samples int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.prune(now)
+
+	kept = make([]prompb.TimeSeries, 0, len(series))
+	for i := range series {
+		h := hash(tenant, &series[i])
+		if _, ok := s.series[h]; !ok && limit > 0 && len(s.series) >= limit {
+			dropped++
+			samples += len(series[i].Samples)
+			continue
+		}
+		s.series[h] = now
+		kept = append(kept, series[i])
+	}
+	return kept, len(s.series), dropped, samples
+}
+
+// active returns the number of active series at the given time.
+func (s *seriesTracker) active(now time.Time) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.prune(now)
+	return len(s.series)
+}
+
+func (s *seriesTracker) prune(now time.Time) {
+	if now.Sub(s.lastPruned) < activeSeriesPruneInterval {
+		return
+	}
+	for h, lastSeen := range s.series {
+		if now.Sub(lastSeen) > activeSeriesWindow {
+			delete(s.series, h)
+		}
+	}
+	s.lastPruned = now
+}
+
+// TenantActiveSeries is the number of active series of the TSDB of a tenant.
+type TenantActiveSeries struct {
+	Tenant       string `json:"tenant"`
+	ActiveSeries int    `json:"activeSeries"`
+	// Limit is the maximum number of active series of the TSDB, 0 if it is not limited.
+	Limit int `json:"limit"`
+}
+
+// ActiveSeries tracks the active series written to the TSDB of each tenant, i.e. the series which received samples
+// in the last 10 minutes, and limits them. A nil ActiveSeries is valid and tracks nothing.
+type ActiveSeries struct {
+	limit int
+
+	mtx     sync.Mutex
+	tenants map[string]*seriesTracker
+
+	activeSeriesDesc *prometheus.Desc
+	limitedSamples   *prometheus.CounterVec
+}
+
+// NewActiveSeries creates an ActiveSeries rejecting the new series of a tenant once its TSDB has limit active
+// series. It returns nil if limit is 0, as tracking the series has a cost.
+func NewActiveSeries(reg prometheus.Registerer, limit int) *ActiveSeries {
+	if limit == 0 {
+		return nil
+	}
+	a := &ActiveSeries{
+		limit:   limit,
+		tenants: map[string]*seriesTracker{},
+		activeSeriesDesc: prometheus.NewDesc(
+			"thanos_receive_head_active_series",
+			"The number of series of the TSDB of the tenant which received samples in the last 10 minutes.",
+			[]string{"tenant"}, nil,
+		),
+		limitedSamples: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_head_series_limited_samples_total",
+				Help: "The number of samples of new series not written to the TSDB of their tenant because it has too many active series.",
+			}, []string{"tenant"},
+		),
+	}
+	if reg != nil {
+		reg.MustRegister(a)
+	}
+	return a
+}
+
+// Track marks the series of the given write request of the given tenant as active, and returns the series to write.
+// If the TSDB of the tenant has too many active series, its new series are not returned and the cause of the error
+// returned is errHeadSeriesLimited.
+func (a *ActiveSeries) Track(tenant string, wreq *prompb.WriteRequest, now time.Time) ([]prompb.TimeSeries, error) {
+	if a == nil {
+		return wreq.Timeseries, nil
+	}
+
+	a.mtx.Lock()
+	t, ok := a.tenants[tenant]
+	if !ok {
+		t = newSeriesTracker()
+		a.tenants[tenant] = t
+	}
+	a.mtx.Unlock()
+
+	kept, _, dropped, samples := t.track(tenant, wreq.Timeseries, now, a.limit)
+	if dropped > 0 {
+		a.limitedSamples.WithLabelValues(tenant).Add(float64(samples))
+		return kept, errors.Wrapf(errHeadSeriesLimited, "%d new series not written, limit %d", dropped, a.limit)
+	}
+	return kept, nil
+}
+
+// Tenants returns the active series of the TSDB of each tenant at the given time, sorted by tenant.
+func (a *ActiveSeries) Tenants(now time.Time) []TenantActiveSeries {
+	if a == nil {
+		return nil
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	res := make([]TenantActiveSeries, 0, len(a.tenants))
+	for tenant, t := range a.tenants {
+		res = append(res, TenantActiveSeries{Tenant: tenant, ActiveSeries: t.active(now), Limit: a.limit})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Tenant < res[j].Tenant })
+	return res
+}
+
+// Describe implements prometheus.Collector.
+func (a *ActiveSeries) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.activeSeriesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (a *ActiveSeries) Collect(ch chan<- prometheus.Metric) {
+	for _, t := range a.Tenants(time.Now()) {
+		ch <- prometheus.MustNewConstMetric(a.activeSeriesDesc, prometheus.GaugeValue, float64(t.ActiveSeries), t.Tenant)
+	}
+}
+
+// isHeadSeriesLimited returns whether or not the given error represents new series rejected by the TSDB of their
+// tenant, by this receiver or by the gRPC remote write handler of another one. Other resource exhausted gRPC errors,
+// e.g. too large messages, do not.
+func isHeadSeriesLimited(err error) bool {
+	if err == errHeadSeriesLimited {
+		return true
+	}
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.ResourceExhausted && strings.Contains(st.Message(), errHeadSeriesLimited.Error())
+}
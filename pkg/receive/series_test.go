@@ -0,0 +1,93 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestActiveSeries(t *testing.T) {
+	var nilSeries *ActiveSeries
+	kept, err := nilSeries.Track("tenant", seriesRequest(0, 10), time.Now())
+	testutil.Ok(t, err)
+	testutil.Equals(t, seriesRequest(0, 10).Timeseries, kept)
+	testutil.Equals(t, 0, len(nilSeries.Tenants(time.Now())))
+
+	a := NewActiveSeries(nil, 10)
+	now := time.Now()
+
+	kept, err = a.Track("tenant-b", seriesRequest(0, 8), now)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 8, len(kept))
+	kept, err = a.Track("tenant-a", seriesRequest(0, 2), now)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(kept))
+
+	// The new series above the limit are not written, the active ones are, and the request is left untouched.
+	wreq := seriesRequest(5, 15)
+	kept, err = a.Track("tenant-b", wreq, now)
+	testutil.Equals(t, errHeadSeriesLimited, errors.Cause(err))
+	testutil.Equals(t, seriesRequest(5, 10).Timeseries, kept)
+	testutil.Equals(t, seriesRequest(5, 15), wreq)
+	testutil.Equals(t, 5, int(promtestutil.ToFloat64(a.limitedSamples.WithLabelValues("tenant-b"))))
+
+	testutil.Equals(t, []TenantActiveSeries{
+		{Tenant: "tenant-a", ActiveSeries: 2, Limit: 10},
+		{Tenant: "tenant-b", ActiveSeries: 10, Limit: 10},
+	}, a.Tenants(now))
+
+	// The series are not active anymore without samples.
+	later := now.Add(activeSeriesWindow + time.Second)
+	kept, err = a.Track("tenant-b", seriesRequest(10, 20), later)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 10, len(kept))
+	testutil.Equals(t, []TenantActiveSeries{
+		{Tenant: "tenant-a", ActiveSeries: 0, Limit: 10},
+		{Tenant: "tenant-b", ActiveSeries: 10, Limit: 10},
+	}, a.Tenants(later))
+
+	// Without limit, the series are not tracked.
+	testutil.Assert(t, NewActiveSeries(nil, 0) == nil, "expected no tracking without limit")
+}
+
+func TestIsHeadSeriesLimited(t *testing.T) {
+	testutil.Assert(t, isHeadSeriesLimited(errHeadSeriesLimited), "expected local error to match")
+	testutil.Assert(t, isHeadSeriesLimited(status.Error(codes.ResourceExhausted, errors.Wrap(errHeadSeriesLimited, "1 new series not written").Error())), "expected remote error to match")
+	testutil.Assert(t, !isHeadSeriesLimited(status.Error(codes.ResourceExhausted, "grpc: received message larger than max")), "expected other resource exhausted error not to match")
+	testutil.Assert(t, !isHeadSeriesLimited(errors.New("other")), "expected other error not to match")
+}
+
+func TestReceiveHeadSeriesLimit(t *testing.T) {
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil, nil)},
+	}
+	handlers, _ := newHandlerHashring(appendables, 3)
+	for _, h := range handlers {
+		h.writer.activeSeries = NewActiveSeries(nil, 1)
+	}
+
+	rec, err := makeRequest(handlers[0], "tenant", seriesRequest(0, 1))
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+
+	// The active series are still written.
+	rec, err = makeRequest(handlers[0], "tenant", seriesRequest(0, 1))
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+
+	rec, err = makeRequest(handlers[0], "tenant", seriesRequest(1, 2))
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusTooManyRequests, rec.Code)
+}
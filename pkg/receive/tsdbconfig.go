@@ -0,0 +1,88 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/tsdb"
+	"gopkg.in/yaml.v2"
+)
+
+// tenantTSDBConfig is an entry of the tenant TSDB configuration, overriding the default TSDB options of the
+// tenants matching one of its regular expressions if set.
+type tenantTSDBConfig struct {
+	Tenants        []string        `yaml:"tenants"`
+	Retention      *model.Duration `yaml:"retention"`
+	BlockDuration  *model.Duration `yaml:"block_duration"`
+	WALCompression *bool           `yaml:"wal_compression"`
+}
+
+type tenantTSDBOptions struct {
+	matchers []*regexp.Regexp
+	opts     tsdb.Options
+}
+
+// TenantTSDBOptions are the TSDB options of each tenant. A nil TenantTSDBOptions is valid and gives no overrides.
+type TenantTSDBOptions struct {
+	overrides []tenantTSDBOptions
+}
+
+// NewTenantTSDBOptions creates TenantTSDBOptions from the default TSDB options and the YAML tenant TSDB
+// configuration overriding them for the tenants matching its entries, if any.
+func NewTenantTSDBOptions(defaults *tsdb.Options, content []byte) (*TenantTSDBOptions, error) {
+	var conf []tenantTSDBConfig
+	if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+		return nil, errors.Wrap(err, "parsing tenant TSDB configuration")
+	}
+
+	o := &TenantTSDBOptions{}
+	for i, c := range conf {
+		if len(c.Tenants) == 0 {
+			return nil, errors.Errorf("entry %d matches no tenant", i)
+		}
+		to := tenantTSDBOptions{opts: *defaults}
+		for _, t := range c.Tenants {
+			re, err := regexp.Compile("^(?:" + t + ")$")
+			if err != nil {
+				return nil, errors.Wrapf(err, "entry %d: parsing tenant matcher %q", i, t)
+			}
+			to.matchers = append(to.matchers, re)
+		}
+		if c.Retention != nil {
+			to.opts.RetentionDuration = int64(time.Duration(*c.Retention) / time.Millisecond)
+		}
+		if c.BlockDuration != nil {
+			if *c.BlockDuration <= 0 {
+				return nil, errors.Errorf("entry %d: block duration must be positive", i)
+			}
+			to.opts.MinBlockDuration = int64(time.Duration(*c.BlockDuration) / time.Millisecond)
+			to.opts.MaxBlockDuration = to.opts.MinBlockDuration
+		}
+		if c.WALCompression != nil {
+			to.opts.WALCompression = *c.WALCompression
+		}
+		o.overrides = append(o.overrides, to)
+	}
+	return o, nil
+}
+
+// ForTenant returns the TSDB options of the first entry matching the given tenant, or nil if none matches.
+func (o *TenantTSDBOptions) ForTenant(tenant string) *tsdb.Options {
+	if o == nil {
+		return nil
+	}
+	for _, to := range o.overrides {
+		for _, m := range to.matchers {
+			if m.MatchString(tenant) {
+				opts := to.opts
+				return &opts
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestTenantTSDBOptions(t *testing.T) {
+	defaults := &tsdb.Options{
+		MinBlockDuration:  int64(2 * time.Hour / time.Millisecond),
+		MaxBlockDuration:  int64(2 * time.Hour / time.Millisecond),
+		RetentionDuration: int64(6 * time.Hour / time.Millisecond),
+		WALCompression:    true,
+	}
+
+	o, err := NewTenantTSDBOptions(defaults, nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, o.ForTenant("tenant") == nil, "expected no overrides")
+
+	var nilOpts *TenantTSDBOptions
+	testutil.Assert(t, nilOpts.ForTenant("tenant") == nil, "expected no overrides")
+
+	for _, c := range []string{
+		`- retention: 1h`,
+		`- tenants: ["("]`,
+		`- {tenants: [a], block_duration: 0s}`,
+		`- {tenants: [a], unknown: 1}`,
+	} {
+		_, err := NewTenantTSDBOptions(defaults, []byte(c))
+		testutil.NotOk(t, err, c)
+	}
+
+	o, err = NewTenantTSDBOptions(defaults, []byte(`
+- tenants: [short-.*, other]
+  retention: 2h
+- tenants: [short-lived, long]
+  retention: 48h
+  block_duration: 1h
+  wal_compression: false
+`))
+	testutil.Ok(t, err)
+
+	testutil.Assert(t, o.ForTenant("tenant") == nil, "expected no overrides")
+	// Regular expressions are anchored.
+	testutil.Assert(t, o.ForTenant("not-short-lived") == nil, "expected no overrides")
+
+	// The first matching entry wins.
+	for _, tenant := range []string{"short-lived", "other"} {
+		expected := *defaults
+		expected.RetentionDuration = int64(2 * time.Hour / time.Millisecond)
+		testutil.Equals(t, &expected, o.ForTenant(tenant))
+	}
+	testutil.Equals(t, &tsdb.Options{
+		MinBlockDuration:  int64(time.Hour / time.Millisecond),
+		MaxBlockDuration:  int64(time.Hour / time.Millisecond),
+		RetentionDuration: int64(48 * time.Hour / time.Millisecond),
+	}, o.ForTenant("long"))
+}
@@ -6,6 +6,7 @@ package receive
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -14,6 +15,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 
+	"github.com/thanos-io/thanos/pkg/accounting"
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
 )
@@ -28,14 +30,21 @@ type TenantStorage interface {
 }
 
 type Writer struct {
-	logger    log.Logger
-	multiTSDB TenantStorage
+	logger       log.Logger
+	multiTSDB    TenantStorage
+	activeSeries *ActiveSeries
+	accountant   *accounting.Accountant
 }
 
-func NewWriter(logger log.Logger, multiTSDB TenantStorage) *Writer {
+// NewWriter creates a Writer of the write requests into the TSDBs of their tenants. If activeSeries is not nil,
+// it tracks the series written, and limits the new ones. If accountant is not nil, it accounts the samples written
+// to their tenant.
+func NewWriter(logger log.Logger, multiTSDB TenantStorage, activeSeries *ActiveSeries, accountant *accounting.Accountant) *Writer {
 	return &Writer{
-		logger:    logger,
-		multiTSDB: multiTSDB,
+		logger:       logger,
+		multiTSDB:    multiTSDB,
+		activeSeries: activeSeries,
+		accountant:   accountant,
 	}
 }
 
@@ -44,6 +53,7 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		numOutOfOrder  = 0
 		numDuplicates  = 0
 		numOutOfBounds = 0
+		numAppended    = 0
 	)
 
 	s, err := r.multiTSDB.TenantAppendable(tenantID)
@@ -60,7 +70,12 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 	}
 
 	var errs errutil.MultiError
-	for _, t := range wreq.Timeseries {
+	series, err := r.activeSeries.Track(tenantID, wreq, time.Now())
+	if err != nil {
+		level.Debug(r.logger).Log("msg", "Active series limit reached", "tenant", tenantID, "err", err)
+		errs.Add(err)
+	}
+	for _, t := range series {
 		lset := make(labels.Labels, len(t.Labels))
 		for j := range t.Labels {
 			lset[j] = labels.Label{
@@ -74,6 +89,7 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 			_, err = app.Add(lset, s.Timestamp, s.Value)
 			switch err {
 			case nil:
+				numAppended++
 				continue
 			case storage.ErrOutOfOrderSample:
 				numOutOfOrder++
@@ -103,6 +119,8 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 
 	if err := app.Commit(); err != nil {
 		errs.Add(errors.Wrap(err, "commit samples"))
+	} else if r.accountant != nil {
+		r.accountant.AddIngestedSamples(tenantID, numAppended)
 	}
 
 	return errs.Err()
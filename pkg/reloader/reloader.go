@@ -9,6 +9,8 @@
 // 	* Watch on changes against certain file e.g (`cfgFile`).
 // 	* Optionally, specify different different output file for watched `cfgFile` (`cfgOutputFile`).
 // 	This will also try decompress the `cfgFile` if needed and substitute ALL the envvars using Kubernetes substitution format: (`$(var)`)
+// 	* Watch on changes against more config files, each with its own optional output file (`CfgFiles`).
+// 	Their output can also be rendered as Go templates, using the `env` function to get environment variables.
 // 	* Watch on changes against certain directories (`watchedDirs`).
 //
 // Once any of those two changes, Prometheus on given `reloadURL` will be notified, causing Prometheus to reload configuration and rules.
@@ -68,6 +70,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -85,8 +88,7 @@ import (
 type Reloader struct {
 	logger        log.Logger
 	reloadURL     *url.URL
-	cfgFile       string
-	cfgOutputFile string
+	cfgFiles      []CfgFile
 	watchInterval time.Duration
 	retryInterval time.Duration
 	watchedDirs   []string
@@ -112,6 +114,9 @@ type Options struct {
 	// will be substituted and the output written into the given path. Prometheus should then use
 	// cfgOutputFile as its config file path.
 	CfgOutputFile string
+	// CfgFiles are more config files to watch, in addition to CfgFile. They are all applied at once, triggering
+	// a single reload.
+	CfgFiles []CfgFile
 	// WatchedDirs is a collection of paths for the reloader to watch over.
 	WatchedDirs []string
 	// DelayInterval controls how long the reloader will wait without receiving
@@ -124,6 +129,21 @@ type Options struct {
 	RetryInterval time.Duration
 }
 
+// CfgFile is a config file watched by the reloader.
+type CfgFile struct {
+	// Path is a path to the config file to watch.
+	Path string
+	// OutputPath is a path for the output config file.
+	// If OutputPath is not empty the config file will be decompressed if needed, environment variables
+	// will be substituted, the result rendered as a Go template if Template is true, and the output
+	// written into the given path.
+	OutputPath string
+	// Template enables rendering the config file as a Go template, after substituting environment variables.
+	// The template can use the `env` function to get the value of an environment variable.
+	// It has no effect if OutputPath is empty.
+	Template bool
+}
+
 var firstGzipBytes = []byte{0x1f, 0x8b, 0x08}
 
 // New creates a new reloader that watches the given config file and directories
@@ -132,11 +152,16 @@ func New(logger log.Logger, reg prometheus.Registerer, o *Options) *Reloader {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
+	var cfgFiles []CfgFile
+	if o.CfgFile != "" {
+		cfgFiles = append(cfgFiles, CfgFile{Path: o.CfgFile, OutputPath: o.CfgOutputFile})
+	}
+	cfgFiles = append(cfgFiles, o.CfgFiles...)
+
 	r := &Reloader{
 		logger:        logger,
 		reloadURL:     o.ReloadURL,
-		cfgFile:       o.CfgFile,
-		cfgOutputFile: o.CfgOutputFile,
+		cfgFiles:      cfgFiles,
 		watcher:       newWatcher(logger, reg, o.DelayInterval),
 		watchedDirs:   o.WatchedDirs,
 		watchInterval: o.WatchInterval,
@@ -170,16 +195,16 @@ func New(logger log.Logger, reg prometheus.Registerer, o *Options) *Reloader {
 	return r
 }
 
-// Watch detects any change made to the watched config file and directories. It
+// Watch detects any change made to the watched config files and directories. It
 // returns when the context is canceled.
 // Whenever a filesystem change is detected or the watch interval has elapsed,
-// the reloader expands the config file (if cfgOutputFile is specified) and
-// triggers a reload if the configuration file or files in the watched
+// the reloader expands the config files (if their OutputPath is specified) and
+// triggers a reload if the configuration files or files in the watched
 // directories have changed.
 // Because some edge cases might be missing, the reloader also relies on the
 // watch interval.
 func (r *Reloader) Watch(ctx context.Context) error {
-	if r.cfgFile == "" && len(r.watchedDirs) == 0 {
+	if len(r.cfgFiles) == 0 && len(r.watchedDirs) == 0 {
 		level.Info(r.logger).Log("msg", "nothing to be watched")
 		<-ctx.Done()
 		return nil
@@ -187,9 +212,11 @@ func (r *Reloader) Watch(ctx context.Context) error {
 
 	defer runutil.CloseWithLogOnErr(r.logger, r.watcher, "config watcher close")
 
-	if r.cfgFile != "" {
-		if err := r.watcher.addFile(r.cfgFile); err != nil {
-			return errors.Wrapf(err, "add config file %s to watcher", r.cfgFile)
+	if len(r.cfgFiles) > 0 {
+		for _, f := range r.cfgFiles {
+			if err := r.watcher.addFile(f.Path); err != nil {
+				return errors.Wrapf(err, "add config file %s to watcher", f.Path)
+			}
 		}
 
 		if err := r.apply(ctx); err != nil {
@@ -213,8 +240,8 @@ func (r *Reloader) Watch(ctx context.Context) error {
 
 	level.Info(r.logger).Log(
 		"msg", "started watching config file and directories for changes",
-		"cfg", r.cfgFile,
-		"out", r.cfgOutputFile,
+		"cfg", r.cfgPaths(),
+		"out", r.cfgOutputPaths(),
 		"dirs", strings.Join(r.watchedDirs, ","))
 
 	applyCtx, applyCancel := context.WithTimeout(ctx, r.watchInterval)
@@ -242,56 +269,27 @@ func (r *Reloader) Watch(ctx context.Context) error {
 	}
 }
 
-// apply triggers Prometheus reload if rules or config changed. If cfgOutputFile is set, we also
-// expand env vars into config file before reloading.
+// apply triggers Prometheus reload if rules or config changed. If the OutputPath of a config file is set,
+// we also expand env vars into the config file before reloading.
 // Reload is retried in retryInterval until watchInterval.
 func (r *Reloader) apply(ctx context.Context) error {
 	var (
 		cfgHash         []byte
 		watchedDirsHash []byte
 	)
-	if r.cfgFile != "" {
+	if len(r.cfgFiles) > 0 {
 		h := sha256.New()
-		if err := hashFile(h, r.cfgFile); err != nil {
-			return errors.Wrap(err, "hash file")
-		}
-		cfgHash = h.Sum(nil)
-		if r.cfgOutputFile != "" {
-			b, err := ioutil.ReadFile(r.cfgFile)
-			if err != nil {
-				return errors.Wrap(err, "read file")
+		for _, f := range r.cfgFiles {
+			if err := hashFile(h, f.Path); err != nil {
+				return errors.Wrap(err, "hash file")
 			}
-
-			// Detect and extract gzipped file.
-			if bytes.Equal(b[0:3], firstGzipBytes) {
-				zr, err := gzip.NewReader(bytes.NewReader(b))
-				if err != nil {
-					return errors.Wrap(err, "create gzip reader")
-				}
-				defer runutil.CloseWithLogOnErr(r.logger, zr, "gzip reader close")
-
-				b, err = ioutil.ReadAll(zr)
-				if err != nil {
-					return errors.Wrap(err, "read compressed config file")
+			if f.OutputPath != "" {
+				if err := r.applyCfgFile(f); err != nil {
+					return errors.Wrapf(err, "apply config file %s", f.Path)
 				}
 			}
-
-			b, err = expandEnv(b)
-			if err != nil {
-				return errors.Wrap(err, "expand environment variables")
-			}
-
-			tmpFile := r.cfgOutputFile + ".tmp"
-			defer func() {
-				_ = os.Remove(tmpFile)
-			}()
-			if err := ioutil.WriteFile(tmpFile, b, 0666); err != nil {
-				return errors.Wrap(err, "write file")
-			}
-			if err := os.Rename(tmpFile, r.cfgOutputFile); err != nil {
-				return errors.Wrap(err, "rename file")
-			}
 		}
+		cfgHash = h.Sum(nil)
 	}
 
 	h := sha256.New()
@@ -346,8 +344,8 @@ func (r *Reloader) apply(ctx context.Context) error {
 		r.lastWatchedDirsHash = watchedDirsHash
 		level.Info(r.logger).Log(
 			"msg", "Reload triggered",
-			"cfg_in", r.cfgFile,
-			"cfg_out", r.cfgOutputFile,
+			"cfg_in", r.cfgPaths(),
+			"cfg_out", r.cfgOutputPaths(),
 			"watched_dirs", strings.Join(r.watchedDirs, ", "))
 		return nil
 	}); err != nil {
@@ -357,6 +355,70 @@ func (r *Reloader) apply(ctx context.Context) error {
 	return nil
 }
 
+// applyCfgFile writes the output config file of the given config file.
+func (r *Reloader) applyCfgFile(f CfgFile) error {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return errors.Wrap(err, "read file")
+	}
+
+	// Detect and extract gzipped file.
+	if bytes.HasPrefix(b, firstGzipBytes) {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return errors.Wrap(err, "create gzip reader")
+		}
+		defer runutil.CloseWithLogOnErr(r.logger, zr, "gzip reader close")
+
+		b, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return errors.Wrap(err, "read compressed config file")
+		}
+	}
+
+	b, err = expandEnv(b)
+	if err != nil {
+		return errors.Wrap(err, "expand environment variables")
+	}
+
+	if f.Template {
+		b, err = renderTemplate(f.Path, b)
+		if err != nil {
+			return errors.Wrap(err, "render template")
+		}
+	}
+
+	tmpFile := f.OutputPath + ".tmp"
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+	if err := ioutil.WriteFile(tmpFile, b, 0666); err != nil {
+		return errors.Wrap(err, "write file")
+	}
+	if err := os.Rename(tmpFile, f.OutputPath); err != nil {
+		return errors.Wrap(err, "rename file")
+	}
+	return nil
+}
+
+func (r *Reloader) cfgPaths() string {
+	paths := make([]string, 0, len(r.cfgFiles))
+	for _, f := range r.cfgFiles {
+		paths = append(paths, f.Path)
+	}
+	return strings.Join(paths, ", ")
+}
+
+func (r *Reloader) cfgOutputPaths() string {
+	paths := make([]string, 0, len(r.cfgFiles))
+	for _, f := range r.cfgFiles {
+		if f.OutputPath != "" {
+			paths = append(paths, f.OutputPath)
+		}
+	}
+	return strings.Join(paths, ", ")
+}
+
 func hashFile(h hash.Hash, fn string) error {
 	f, err := os.Open(fn)
 	if err != nil {
@@ -425,6 +487,29 @@ func expandEnv(b []byte) (r []byte, err error) {
 	return r, err
 }
 
+// renderTemplate renders the given content of the given file as a Go template. Referenced environment variables
+// must be set.
+func renderTemplate(name string, b []byte) ([]byte, error) {
+	t, err := template.New(filepath.Base(name)).Option("missingkey=error").Funcs(template.FuncMap{
+		"env": func(n string) (string, error) {
+			v, ok := os.LookupEnv(n)
+			if !ok {
+				return "", errors.Errorf("found reference to unset environment variable %q", n)
+			}
+			return v, nil
+		},
+	}).Parse(string(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse template")
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nil); err != nil {
+		return nil, errors.Wrap(err, "execute template")
+	}
+	return buf.Bytes(), nil
+}
+
 type watcher struct {
 	notify chan struct{}
 
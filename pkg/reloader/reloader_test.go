@@ -20,9 +20,11 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
 	"go.uber.org/atomic"
 	"go.uber.org/goleak"
 
+	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -476,3 +478,102 @@ func TestReloaderDirectoriesApplyBasedOnWatchInterval(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, 2, reloads.Load().(int))
 }
+
+func TestReloader_MultipleConfigsApply(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "localhost:0")
+	testutil.Ok(t, err)
+
+	reloads := atomic.NewInt32(0)
+	srv := &http.Server{}
+	srv.Handler = http.HandlerFunc(func(resp http.ResponseWriter, r *http.Request) {
+		reloads.Inc()
+		resp.WriteHeader(http.StatusOK)
+	})
+	go func() { _ = srv.Serve(l) }()
+	defer func() { testutil.Ok(t, srv.Close()) }()
+
+	reloadURL, err := url.Parse(fmt.Sprintf("http://%s", l.Addr().String()))
+	testutil.Ok(t, err)
+
+	dir, err := ioutil.TempDir("", "reloader-cfgs-test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	var (
+		input     = filepath.Join(dir, "cfg.yaml")
+		output    = filepath.Join(dir, "cfg.out.yaml")
+		tmplInput = filepath.Join(dir, "scrape.yaml.tmpl")
+		tmplOuput = filepath.Join(dir, "scrape.yaml")
+		raw       = filepath.Join(dir, "raw.yaml")
+	)
+	testutil.Ok(t, os.Setenv("TEST_RELOADER_THANOS_ENV", "2"))
+	defer func() { testutil.Ok(t, os.Unsetenv("TEST_RELOADER_THANOS_ENV")) }()
+
+	testutil.Ok(t, ioutil.WriteFile(input, []byte("a: $(TEST_RELOADER_THANOS_ENV)\n"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(tmplInput, []byte("b: {{ env \"TEST_RELOADER_THANOS_UNSET_ENV\" }}\n"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(raw, []byte("c: {{ 1 }}\n"), os.ModePerm))
+
+	reloader := New(nil, nil, &Options{
+		ReloadURL: reloadURL,
+		CfgFiles: []CfgFile{
+			{Path: input, OutputPath: output},
+			{Path: tmplInput, OutputPath: tmplOuput, Template: true},
+			{Path: raw},
+		},
+		WatchInterval: 9999 * time.Hour, // Disable interval to test watch logic only.
+		RetryInterval: 100 * time.Millisecond,
+		DelayInterval: 100 * time.Millisecond,
+	})
+
+	// Fail with an unset environment variable in the template.
+	err = reloader.Watch(ctx)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "render template"), err.Error())
+
+	testutil.Ok(t, ioutil.WriteFile(tmplInput, []byte(`b: $(TEST_RELOADER_THANOS_ENV)
+b_env: {{ env "TEST_RELOADER_THANOS_ENV" }}
+`), os.ModePerm))
+
+	rctx, cancel2 := context.WithCancel(ctx)
+	g := sync.WaitGroup{}
+	g.Add(1)
+	go func() {
+		defer g.Done()
+		testutil.Ok(t, reloader.Watch(rctx))
+	}()
+
+	waitReloads := func(exp int32) {
+		testutil.Ok(t, runutil.Retry(100*time.Millisecond, ctx.Done(), func() error {
+			if got := reloads.Load(); got != exp {
+				return errors.Errorf("expected %d reloads, got %d", exp, got)
+			}
+			return nil
+		}))
+	}
+
+	// Initial apply.
+	waitReloads(1)
+	b, err := ioutil.ReadFile(output)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "a: 2\n", string(b))
+	b, err = ioutil.ReadFile(tmplOuput)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "b: 2\nb_env: 2\n", string(b))
+
+	// Changes of several files trigger a single reload.
+	testutil.Ok(t, ioutil.WriteFile(input, []byte("a: changed\n"), os.ModePerm))
+	testutil.Ok(t, ioutil.WriteFile(raw, []byte("c: changed\n"), os.ModePerm))
+	waitReloads(2)
+	b, err = ioutil.ReadFile(output)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "a: changed\n", string(b))
+
+	time.Sleep(500 * time.Millisecond)
+	testutil.Equals(t, int32(2), reloads.Load())
+
+	cancel2()
+	g.Wait()
+}
@@ -6,8 +6,8 @@ package replicate
 import (
 	"context"
 	"math/rand"
+	"regexp"
 	"strconv"
-	"strings"
 	"time"
 
 	thanosmodel "github.com/thanos-io/thanos/pkg/model"
@@ -39,35 +39,45 @@ const (
 	labelError   = "error"
 )
 
-// ParseFlagMatchers parse flag into matchers.
+var flagMatcherRe = regexp.MustCompile(`^([^=!~]*)(=~|!~|!=|=)(.*)$`)
+
+// ParseFlagMatchers parse flag into matchers. The flags are in the key="value" format, with one of the
+// =, !=, =~ and !~ operators.
 func ParseFlagMatchers(s []string) ([]*labels.Matcher, error) {
 	matchers := make([]*labels.Matcher, 0, len(s))
 
 	for _, l := range s {
-		parts := strings.SplitN(l, "=", 2)
-		if len(parts) != 2 {
+		parts := flagMatcherRe.FindStringSubmatch(l)
+		if parts == nil {
 			return nil, errors.Errorf("unrecognized label %q", l)
 		}
 
-		labelName := parts[0]
+		labelName := parts[1]
 		if !model.LabelName.IsValid(model.LabelName(labelName)) {
 			return nil, errors.Errorf("unsupported format for label %s", l)
 		}
 
-		labelValue, err := strconv.Unquote(parts[1])
+		labelValue, err := strconv.Unquote(parts[3])
 		if err != nil {
 			return nil, errors.Wrap(err, "unquote label value")
 		}
-		newEqualMatcher, err := labels.NewMatcher(labels.MatchEqual, labelName, labelValue)
+		newMatcher, err := labels.NewMatcher(matchTypes[parts[2]], labelName, labelValue)
 		if err != nil {
-			return nil, errors.Wrap(err, "new equal matcher")
+			return nil, errors.Wrap(err, "new matcher")
 		}
-		matchers = append(matchers, newEqualMatcher)
+		matchers = append(matchers, newMatcher)
 	}
 
 	return matchers, nil
 }
 
+var matchTypes = map[string]labels.MatchType{
+	"=":  labels.MatchEqual,
+	"!=": labels.MatchNotEqual,
+	"=~": labels.MatchRegexp,
+	"!~": labels.MatchNotRegexp,
+}
+
 // RunReplicate replicate data based on config.
 func RunReplicate(
 	g *run.Group,
@@ -82,6 +92,7 @@ func RunReplicate(
 	fromObjStoreConfig *extflag.PathOrContent,
 	toObjStoreConfig *extflag.PathOrContent,
 	singleRun bool,
+	interval time.Duration,
 	minTime, maxTime *thanosmodel.TimeOrDurationValue,
 ) error {
 	logger = log.With(logger, "component", "replicate")
@@ -164,6 +175,11 @@ func RunReplicate(
 	replicationRunDuration.WithLabelValues(labelSuccess)
 	replicationRunDuration.WithLabelValues(labelError)
 
+	lastSuccessfulRun := promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_replicate_last_successful_run_timestamp_seconds",
+		Help: "Timestamp of the last successful replication run.",
+	})
+
 	fetcher, err := thanosblock.NewMetaFetcher(
 		logger,
 		32,
@@ -213,7 +229,7 @@ func RunReplicate(
 			return replicateFn()
 		}
 
-		return runutil.Repeat(time.Minute, ctx.Done(), func() error {
+		return runutil.Repeat(interval, ctx.Done(), func() error {
 			start := time.Now()
 			if err := replicateFn(); err != nil {
 				level.Error(logger).Log("msg", "running replication failed", "err", err)
@@ -225,6 +241,7 @@ func RunReplicate(
 			}
 			replicationRunCounter.WithLabelValues(labelSuccess).Inc()
 			replicationRunDuration.WithLabelValues(labelSuccess).Observe(time.Since(start).Seconds())
+			lastSuccessfulRun.SetToCurrentTime()
 			level.Info(logger).Log("msg", "ran replication successfully")
 
 			return nil
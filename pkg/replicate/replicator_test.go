@@ -0,0 +1,34 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package replicate
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseFlagMatchers(t *testing.T) {
+	matchers, err := ParseFlagMatchers([]string{
+		`cluster="eu-1"`,
+		`env!="dev"`,
+		`replica=~"a|b"`,
+		`tenant!~"test-.*"`,
+		`query="a=~b"`,
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, "cluster", "eu-1"),
+		labels.MustNewMatcher(labels.MatchNotEqual, "env", "dev"),
+		labels.MustNewMatcher(labels.MatchRegexp, "replica", "a|b"),
+		labels.MustNewMatcher(labels.MatchNotRegexp, "tenant", "test-.*"),
+		labels.MustNewMatcher(labels.MatchEqual, "query", "a=~b"),
+	}, matchers)
+
+	for _, s := range []string{`cluster`, `clu-ster="eu-1"`, `cluster=eu-1`, `cluster=~"("`} {
+		_, err := ParseFlagMatchers([]string{s})
+		testutil.NotOk(t, err, s)
+	}
+}
@@ -120,6 +120,8 @@ type replicationMetrics struct {
 	blocksAlreadyReplicated prometheus.Counter
 	blocksReplicated        prometheus.Counter
 	objectsReplicated       prometheus.Counter
+	bytesReplicated         prometheus.Counter
+	blocksPending           prometheus.Gauge
 }
 
 func newReplicationMetrics(reg prometheus.Registerer) *replicationMetrics {
@@ -136,6 +138,14 @@ func newReplicationMetrics(reg prometheus.Registerer) *replicationMetrics {
 			Name: "thanos_replicate_objects_replicated_total",
 			Help: "Total number of objects replicated.",
 		}),
+		bytesReplicated: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_replicate_bytes_replicated_total",
+			Help: "Total number of bytes of the objects replicated.",
+		}),
+		blocksPending: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_replicate_blocks_pending",
+			Help: "Number of blocks selected by the current or last replication run which are not ensured to be replicated yet.",
+		}),
 	}
 	return m
 }
@@ -189,10 +199,12 @@ func (rs *replicationScheme) execute(ctx context.Context) error {
 		return availableBlocks[i].BlockMeta.MinTime < availableBlocks[j].BlockMeta.MinTime
 	})
 
+	rs.metrics.blocksPending.Set(float64(len(availableBlocks)))
 	for _, b := range availableBlocks {
 		if err := rs.ensureBlockIsReplicated(ctx, b.BlockMeta.ULID); err != nil {
 			return errors.Wrapf(err, "ensure block %v is replicated", b.BlockMeta.ULID.String())
 		}
+		rs.metrics.blocksPending.Dec()
 	}
 
 	return nil
@@ -299,12 +311,31 @@ func (rs *replicationScheme) ensureObjectReplicated(ctx context.Context, objectN
 
 	defer r.Close()
 
-	if err = rs.toBkt.Upload(ctx, objectName, r); err != nil {
+	cr := &countingReader{Reader: r}
+	if err = rs.toBkt.Upload(ctx, objectName, cr); err != nil {
 		return errors.Wrapf(err, "upload %v to target bucket", objectName)
 	}
 
-	level.Info(rs.logger).Log("msg", "object replicated", "object", objectName)
+	level.Info(rs.logger).Log("msg", "object replicated", "object", objectName, "bytes", cr.n)
 	rs.metrics.objectsReplicated.Inc()
+	rs.metrics.bytesReplicated.Add(float64(cr.n))
 
 	return nil
 }
+
+// countingReader counts the bytes read from the underlying reader, keeping its size known to the bucket uploading it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// ObjectSize implements objstore.ObjectSizer.
+func (r *countingReader) ObjectSize() (int64, error) {
+	return objstore.TryToGetSize(r.Reader)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/oklog/ulid"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/block"
@@ -323,3 +324,36 @@ func TestReplicationSchemeAll(t *testing.T) {
 		c.assert(ctx, t, originBucket, targetBucket)
 	}
 }
+
+func TestReplicationSchemeMetrics(t *testing.T) {
+	ctx := context.Background()
+	originBucket := objstore.NewInMemBucket()
+	targetBucket := objstore.NewInMemBucket()
+	logger := testLogger(t.Name())
+
+	for i := int64(0); i < 2; i++ {
+		ulid := testULID(i)
+		b, err := json.Marshal(testMeta(ulid))
+		testutil.Ok(t, err)
+		testutil.Ok(t, originBucket.Upload(ctx, path.Join(ulid.String(), "meta.json"), bytes.NewReader(b)))
+		testutil.Ok(t, originBucket.Upload(ctx, path.Join(ulid.String(), "chunks", "000001"), bytes.NewReader([]byte("chunks"))))
+		testutil.Ok(t, originBucket.Upload(ctx, path.Join(ulid.String(), "index"), bytes.NewReader([]byte("index"))))
+	}
+
+	filter := NewBlockFilter(logger, labels.Selector{}, []compact.ResolutionLevel{compact.ResolutionLevelRaw}, []int{1}).Filter
+	fetcher, err := block.NewMetaFetcher(logger, 32, objstore.WithNoopInstr(originBucket), "", nil, nil, nil)
+	testutil.Ok(t, err)
+	metrics := newReplicationMetrics(nil)
+	r := newReplicationScheme(logger, metrics, filter, fetcher, objstore.WithNoopInstr(originBucket), targetBucket, nil)
+
+	testutil.Ok(t, r.execute(ctx))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(metrics.blocksReplicated))
+	testutil.Equals(t, 4.0, promtest.ToFloat64(metrics.objectsReplicated))
+	testutil.Equals(t, 22.0, promtest.ToFloat64(metrics.bytesReplicated))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(metrics.blocksPending))
+
+	// Already replicated blocks are not replicated again.
+	testutil.Ok(t, r.execute(ctx))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(metrics.blocksAlreadyReplicated))
+	testutil.Equals(t, 22.0, promtest.ToFloat64(metrics.bytesReplicated))
+}
@@ -18,8 +18,10 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/rules"
 	"gopkg.in/yaml.v3"
 
@@ -114,6 +116,9 @@ type Manager struct {
 	workDir string
 	mgrs    map[storepb.PartialResponseStrategy]*rules.Manager
 	extLset labels.Labels
+	// queryOffset is the default query offset of the rule groups.
+	queryOffset time.Duration
+	sharder     *Sharder
 
 	mtx       sync.RWMutex
 	ruleFiles map[string]string
@@ -121,6 +126,8 @@ type Manager struct {
 
 // NewManager creates new Manager.
 // QueryFunc from baseOpts will be rewritten.
+// The queryOffset is used for the rule groups that do not define their own query_offset.
+// If sharder is not nil, only the rule groups it assigns to this replica are evaluated.
 func NewManager(
 	ctx context.Context,
 	reg prometheus.Registerer,
@@ -128,12 +135,16 @@ func NewManager(
 	baseOpts rules.ManagerOptions,
 	queryFuncCreator func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc,
 	extLset labels.Labels,
+	queryOffset time.Duration,
+	sharder *Sharder,
 ) *Manager {
 	m := &Manager{
-		workDir:   filepath.Join(dataDir, tmpRuleDir),
-		mgrs:      make(map[storepb.PartialResponseStrategy]*rules.Manager),
-		extLset:   extLset,
-		ruleFiles: make(map[string]string),
+		workDir:     filepath.Join(dataDir, tmpRuleDir),
+		mgrs:        make(map[storepb.PartialResponseStrategy]*rules.Manager),
+		extLset:     extLset,
+		queryOffset: queryOffset,
+		sharder:     sharder,
+		ruleFiles:   make(map[string]string),
 	}
 	for _, strategy := range storepb.PartialResponseStrategy_value {
 		s := storepb.PartialResponseStrategy(strategy)
@@ -199,6 +210,7 @@ func (m *Manager) Active() []*rulespb.AlertInstance {
 
 type configRuleAdapter struct {
 	PartialResponseStrategy *storepb.PartialResponseStrategy
+	QueryOffset             *model.Duration
 
 	group           rulefmt.RuleGroup
 	nativeRuleGroup map[string]interface{}
@@ -206,8 +218,9 @@ type configRuleAdapter struct {
 
 func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	rs := struct {
-		RuleGroup rulefmt.RuleGroup `yaml:",inline"`
-		Strategy  string            `yaml:"partial_response_strategy"`
+		RuleGroup   rulefmt.RuleGroup `yaml:",inline"`
+		Strategy    string            `yaml:"partial_response_strategy"`
+		QueryOffset *model.Duration   `yaml:"query_offset"`
 	}{}
 
 	if err := unmarshal(&rs); err != nil {
@@ -219,6 +232,7 @@ func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) err
 	if err := g.PartialResponseStrategy.UnmarshalJSON([]byte("\"" + rs.Strategy + "\"")); err != nil {
 		return err
 	}
+	g.QueryOffset = rs.QueryOffset
 	g.group = rs.RuleGroup
 
 	var native map[string]interface{}
@@ -226,6 +240,7 @@ func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) err
 		return errors.Wrap(err, "failed to unmarshal rulefmt.configRuleAdapter")
 	}
 	delete(native, "partial_response_strategy")
+	delete(native, "query_offset")
 
 	g.nativeRuleGroup = native
 	return nil
@@ -239,6 +254,38 @@ func (g configRuleAdapter) MarshalYAML() (interface{}, error) {
 	}, nil
 }
 
+// offsetQueries adds the given offset to all the selectors of the expressions of the rules, so that they are evaluated
+// against the samples written offset before the evaluation time, like with the PromQL offset modifier.
+func (g configRuleAdapter) offsetQueries(offset time.Duration) error {
+	if offset == 0 {
+		return nil
+	}
+	rs, _ := g.nativeRuleGroup["rules"].([]interface{})
+	for _, r := range rs {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		q, ok := rule["expr"].(string)
+		if !ok {
+			continue
+		}
+		expr, err := parser.ParseExpr(q)
+		if err != nil {
+			return errors.Wrapf(err, "parse expression %q", q)
+		}
+		parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			// The selectors of the matrix selectors and subqueries are visited too.
+			if vs, ok := node.(*parser.VectorSelector); ok {
+				vs.Offset += offset
+			}
+			return nil
+		})
+		rule["expr"] = expr.String()
+	}
+	return nil
+}
+
 // TODO(bwplotka): Replace this with upstream implementation after https://github.com/prometheus/prometheus/issues/7128 is fixed.
 func (g configRuleAdapter) validate() (errs []error) {
 	set := map[string]struct{}{}
@@ -344,6 +391,17 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 		// which is not supported, to be able to reuse rules.Manager. The problem is that it uses yaml.UnmarshalStrict.
 		groupsByStrategy := map[storepb.PartialResponseStrategy][]configRuleAdapter{}
 		for _, rg := range rg.Groups {
+			if !m.sharder.Owns(rg.group.Name) {
+				continue
+			}
+			queryOffset := m.queryOffset
+			if rg.QueryOffset != nil {
+				queryOffset = time.Duration(*rg.QueryOffset)
+			}
+			if err := rg.offsetQueries(queryOffset); err != nil {
+				errs.Add(errors.Wrapf(err, "%s: group %s", fn, rg.group.Name))
+				continue
+			}
 			groupsByStrategy[*rg.PartialResponseStrategy] = append(groupsByStrategy[*rg.PartialResponseStrategy], rg)
 		}
 		for s, rg := range groupsByStrategy {
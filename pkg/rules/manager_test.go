@@ -86,6 +86,8 @@ groups:
 			}
 		},
 		labels.FromStrings("replica", "1"),
+		0,
+		nil,
 	)
 	testutil.Ok(t, thanosRuleMgr.Update(1*time.Second, []string{filepath.Join(dir, "rule.yaml")}))
 
@@ -179,6 +181,8 @@ groups:
 			}
 		},
 		labels.FromStrings("replica", "1"),
+		0,
+		nil,
 	)
 	err = thanosRuleMgr.Update(10*time.Second, []string{
 		filepath.Join(dir, "no_strategy.yaml"),
@@ -325,6 +329,8 @@ func TestManager_Rules(t *testing.T) {
 			}
 		},
 		labels.FromStrings("replica", "test1"),
+		0,
+		nil,
 	)
 	testutil.Ok(t, thanosRuleMgr.Update(60*time.Second, []string{
 		filepath.Join(curr, "../../examples/alerts/alerts.yaml"),
@@ -366,6 +372,8 @@ groups:
 			}
 		},
 		nil,
+		0,
+		nil,
 	)
 
 	// We need to run the underlying rule managers to update them more than
@@ -385,3 +393,69 @@ groups:
 	testutil.Ok(t, err)
 	testutil.Equals(t, 0, len(thanosRuleMgr.RuleGroups()))
 }
+
+func TestManagerUpdateWithQueryOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_rule_query_offset")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(`
+groups:
+- name: "default"
+  rules:
+  - record: "some"
+    expr: "sum(up offset 30s)"
+- name: "group"
+  query_offset: 5m
+  partial_response_strategy: "warn"
+  rules:
+  - record: "some"
+    expr: "rate(some_metric[5m]) / max_over_time(rate(other_metric[1m])[1h:5m])"
+  - alert: "some"
+    expr: "up == 0"
+- name: "none"
+  query_offset: 0s
+  rules:
+  - record: "some"
+    expr: "sum(up)"
+`), os.ModePerm))
+
+	thanosRuleMgr := NewManager(
+		context.Background(),
+		nil,
+		dir,
+		rules.ManagerOptions{
+			Logger:    log.NewLogfmtLogger(os.Stderr),
+			Queryable: nopQueryable{},
+		},
+		func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc {
+			return func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+				return nil, nil
+			}
+		},
+		nil,
+		time.Minute,
+		nil,
+	)
+	thanosRuleMgr.Run()
+	defer thanosRuleMgr.Stop()
+
+	testutil.Ok(t, thanosRuleMgr.Update(1*time.Second, []string{filepath.Join(dir, "rules.yaml")}))
+
+	queries := map[string][]string{}
+	for _, g := range thanosRuleMgr.RuleGroups() {
+		for _, r := range g.Rules() {
+			switch rule := r.(type) {
+			case *rules.AlertingRule:
+				queries[g.Name()] = append(queries[g.Name()], rule.Query().String())
+			case *rules.RecordingRule:
+				queries[g.Name()] = append(queries[g.Name()], rule.Query().String())
+			}
+		}
+	}
+	testutil.Equals(t, map[string][]string{
+		"default": {"sum(up offset 1m30s)"},
+		"group":   {"rate(some_metric[5m] offset 5m) / max_over_time(rate(other_metric[1m] offset 5m)[1h:5m])", "up offset 5m == 0"},
+		"none":    {"sum(up)"},
+	}, queries)
+}
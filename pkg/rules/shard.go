@@ -0,0 +1,186 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	grpc_health "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const sep = '\xff'
+
+var errShardPeersNotDiscovered = errors.New("rule shard peers not discovered yet")
+
+// PeerHealthChecker checks whether the ruler replica with the given address is healthy.
+type PeerHealthChecker func(ctx context.Context, addr string) error
+
+// NewGRPCPeerHealthChecker returns a PeerHealthChecker calling the gRPC health service of the ruler replicas, with the
+// given timeout and dial options.
+func NewGRPCPeerHealthChecker(timeout time.Duration, dialOpts ...grpc.DialOption) PeerHealthChecker {
+	return func(ctx context.Context, addr string) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		conn, err := grpc.DialContext(ctx, addr, dialOpts...)
+		if err != nil {
+			return errors.Wrapf(err, "dial %s", addr)
+		}
+		defer func() { _ = conn.Close() }()
+
+		resp, err := grpc_health.NewHealthClient(conn).Check(ctx, &grpc_health.HealthCheckRequest{})
+		if err != nil {
+			return errors.Wrapf(err, "health check %s", addr)
+		}
+		if resp.Status != grpc_health.HealthCheckResponse_SERVING {
+			return errors.Errorf("%s is %s", addr, resp.Status)
+		}
+		return nil
+	}
+}
+
+// Sharder assigns the rule groups to the ruler replicas sharing them, so that every group is evaluated by a single
+// replica. The groups are assigned with rendezvous hashing: each group goes to the peer with the highest hash of the
+// group name and the peer, so when a peer appears or disappears, only the groups assigned to it move.
+// The Sharder fails closed: until the peers are discovered, or while this replica is not among them, no group is
+// assigned to this replica.
+// A nil Sharder assigns all the groups to this replica.
+type Sharder struct {
+	logger log.Logger
+	self   string
+	check  PeerHealthChecker
+
+	mtx   sync.RWMutex
+	peers []string
+	// err is the reason why no group is assigned to this replica, if not nil.
+	err error
+}
+
+// NewSharder returns a Sharder for the replica with the given address. The peers failing the given health check, if
+// not nil, are dropped.
+func NewSharder(logger log.Logger, self string, check PeerHealthChecker) *Sharder {
+	return &Sharder{logger: logger, self: self, check: check, err: errShardPeersNotDiscovered}
+}
+
+// SetPeers sets the discovered addresses of the replicas sharing the rule groups, which have to include this replica.
+// The other peers are health checked concurrently, and the unhealthy ones are dropped. It returns true if the groups
+// assigned to this replica changed, in which case the rule groups have to be reloaded to be rebalanced, and an error
+// if this replica is not among the peers, in which case no group is assigned to it.
+func (s *Sharder) SetPeers(ctx context.Context, addrs []string) (bool, error) {
+	var (
+		others []string
+		found  bool
+		seen   = map[string]struct{}{}
+	)
+	for _, addr := range addrs {
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		seen[addr] = struct{}{}
+		if addr == s.self {
+			found = true
+			continue
+		}
+		others = append(others, addr)
+	}
+	if !found {
+		err := errors.Errorf("this replica %s is not among the discovered rule shard peers %s, check --rule.shard.self", s.self, strings.Join(addrs, ","))
+		return s.set(nil, err), err
+	}
+
+	peers := []string{s.self}
+	if s.check == nil {
+		peers = append(peers, others...)
+	} else {
+		var (
+			wg  sync.WaitGroup
+			mtx sync.Mutex
+		)
+		for _, addr := range others {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+
+				if err := s.check(ctx, addr); err != nil {
+					level.Warn(s.logger).Log("msg", "dropping unhealthy rule shard peer", "peer", addr, "err", err)
+					return
+				}
+				mtx.Lock()
+				peers = append(peers, addr)
+				mtx.Unlock()
+			}(addr)
+		}
+		wg.Wait()
+	}
+	sort.Strings(peers)
+	return s.set(peers, nil), nil
+}
+
+func (s *Sharder) set(peers []string, err error) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	changed := (s.err == nil) != (err == nil) || !equalStrings(s.peers, peers)
+	s.peers, s.err = peers, err
+	return changed
+}
+
+// Peers returns the sorted addresses of the healthy replicas sharing the rule groups, including this one, or nil if
+// no group is assigned to this replica.
+func (s *Sharder) Peers() []string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.peers
+}
+
+// Owns returns true if the rule group with the given name is assigned to this replica. The groups are assigned by
+// their name only, so that the paths of the rule files may differ between the replicas.
+func (s *Sharder) Owns(group string) bool {
+	if s == nil {
+		return true
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.err != nil {
+		return false
+	}
+
+	var (
+		owner string
+		max   uint64
+	)
+	for _, p := range s.peers {
+		b := make([]byte, 0, len(group)+len(p)+1)
+		b = append(b, group...)
+		b = append(b, sep)
+		b = append(b, p...)
+		if h := xxhash.Sum64(b); owner == "" || h > max {
+			owner, max = p, h
+		}
+	}
+	return owner == s.self
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
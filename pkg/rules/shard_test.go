@@ -0,0 +1,97 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestSharder(t *testing.T) {
+	peers := []string{"ruler-0:10902", "ruler-1:10902", "ruler-2:10902"}
+
+	owners := func(sharders []*Sharder) map[string]string {
+		res := map[string]string{}
+		for i := 0; i < 100; i++ {
+			group := fmt.Sprintf("group-%d", i)
+			for _, s := range sharders {
+				if !s.Owns(group) {
+					continue
+				}
+				_, ok := res[group]
+				testutil.Assert(t, !ok, "group %s assigned to more than one peer", group)
+				res[group] = s.self
+			}
+			testutil.Assert(t, res[group] != "", "group %s not assigned to any peer", group)
+		}
+		return res
+	}
+
+	ctx := context.Background()
+	var sharders []*Sharder
+	for _, p := range peers {
+		s := NewSharder(log.NewNopLogger(), p, nil)
+		testutil.Equals(t, false, s.Owns("group-0"))
+		testutil.Equals(t, true, ok(t)(s.SetPeers(ctx, peers)))
+		testutil.Equals(t, false, ok(t)(s.SetPeers(ctx, []string{peers[2], peers[1], peers[0], peers[0]})))
+		testutil.Equals(t, peers, s.Peers())
+		sharders = append(sharders, s)
+	}
+	before := owners(sharders)
+
+	perPeer := map[string]int{}
+	for _, p := range before {
+		perPeer[p]++
+	}
+	testutil.Equals(t, len(peers), len(perPeer))
+
+	// When a peer disappears, only its groups are moved to the other peers.
+	for _, s := range sharders[:2] {
+		testutil.Equals(t, true, ok(t)(s.SetPeers(ctx, peers[:2])))
+	}
+	after := owners(sharders[:2])
+	for group, p := range before {
+		if p != peers[2] {
+			testutil.Equals(t, p, after[group])
+		}
+	}
+
+	// Unhealthy peers are dropped.
+	check := func(_ context.Context, addr string) error {
+		if addr == peers[2] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	s := NewSharder(log.NewNopLogger(), peers[0], check)
+	testutil.Equals(t, true, ok(t)(s.SetPeers(ctx, peers)))
+	testutil.Equals(t, peers[:2], s.Peers())
+	for group, p := range after {
+		testutil.Equals(t, p == peers[0], s.Owns(group))
+	}
+
+	// A replica not among the discovered peers evaluates no group.
+	changed, err := s.SetPeers(ctx, peers[1:])
+	testutil.NotOk(t, err)
+	testutil.Equals(t, true, changed)
+	for group := range after {
+		testutil.Equals(t, false, s.Owns(group))
+	}
+
+	// A nil sharder evaluates all the groups.
+	testutil.Equals(t, true, (*Sharder)(nil).Owns("group-0"))
+}
+
+func ok(t *testing.T) func(bool, error) bool {
+	return func(changed bool, err error) bool {
+		testutil.Ok(t, err)
+		return changed
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const ruleFileExt = ".yaml"
+
+var (
+	// ErrNotFound is returned when the requested rule group or namespace does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is returned when a rule group, namespace or tenant given to the Storage is invalid.
+	ErrInvalid = errors.New("invalid")
+
+	validName = regexp.MustCompile(`^[a-zA-Z0-9_\-][a-zA-Z0-9_\-.]*$`)
+)
+
+// Storage stores the rule groups of the tenants in a bucket. The groups of a namespace of a tenant are stored in
+// the rule file <prefix>/<tenant>/<namespace>.yaml, in the same format as the local rule files.
+// Sync downloads the rule files into a local directory, for them to be loaded by the Manager.
+type Storage struct {
+	logger log.Logger
+	bkt    objstore.Bucket
+	prefix string
+	dir    string
+
+	// Serializes the updates of the rule files, which are read, modified and uploaded back.
+	mtx sync.Mutex
+}
+
+// NewStorage returns a Storage storing the rule files under the given prefix of the bucket, and syncing them into
+// the given directory.
+func NewStorage(logger log.Logger, bkt objstore.Bucket, prefix, dir string) *Storage {
+	return &Storage{
+		logger: logger,
+		bkt:    bkt,
+		prefix: strings.Trim(prefix, objstore.DirDelim),
+		dir:    dir,
+	}
+}
+
+// Sync replaces the content of the local directory with the rule files in the bucket and returns their local paths.
+// The paths of the rule files do not change across syncs, so that the state of their groups is kept. If the rule
+// files cannot be downloaded, the ones of the last successful sync are returned along with the error.
+func (s *Storage) Sync(ctx context.Context) ([]string, error) {
+	err := s.download(ctx)
+
+	files, gerr := filepath.Glob(filepath.Join(s.dir, "*", "*"+ruleFileExt))
+	if gerr != nil {
+		return nil, errors.Wrap(gerr, "list rule files")
+	}
+	return files, err
+}
+
+func (s *Storage) download(ctx context.Context) error {
+	tmpDir := s.dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return errors.Wrapf(err, "remove %s", tmpDir)
+	}
+	if err := objstore.DownloadDir(ctx, s.logger, s.bkt, s.prefix, tmpDir); err != nil {
+		return errors.Wrap(err, "download rule files")
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		return errors.Wrapf(err, "remove %s", s.dir)
+	}
+	if err := os.Rename(tmpDir, s.dir); err != nil {
+		return errors.Wrapf(err, "rename %s to %s", tmpDir, s.dir)
+	}
+	return nil
+}
+
+// Namespaces returns the sorted namespaces of the given tenant.
+func (s *Storage) Namespaces(ctx context.Context, tenant string) ([]string, error) {
+	if !validName.MatchString(tenant) {
+		return nil, errors.Wrapf(ErrInvalid, "name %q", tenant)
+	}
+	var namespaces []string
+	if err := s.bkt.Iter(ctx, path.Join(s.prefix, tenant), func(name string) error {
+		if strings.HasSuffix(name, ruleFileExt) {
+			namespaces = append(namespaces, strings.TrimSuffix(path.Base(name), ruleFileExt))
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "list rule files of tenant %s", tenant)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// Namespace returns the rule groups of the given namespace of the given tenant.
+func (s *Storage) Namespace(ctx context.Context, tenant, namespace string) ([]map[string]interface{}, error) {
+	name, err := s.file(tenant, namespace)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, ErrNotFound
+	}
+	return groups, nil
+}
+
+// Group returns the given rule group of the given namespace of the given tenant.
+func (s *Storage) Group(ctx context.Context, tenant, namespace, group string) (map[string]interface{}, error) {
+	groups, err := s.Namespace(ctx, tenant, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g["name"] == group {
+			return g, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SetGroup creates the rule group given in YAML in the given namespace of the given tenant, or replaces the group
+// with the same name.
+func (s *Storage) SetGroup(ctx context.Context, tenant, namespace string, groupYAML []byte) error {
+	var group map[string]interface{}
+	if err := yaml.Unmarshal(groupYAML, &group); err != nil {
+		return errors.Wrapf(ErrInvalid, "parse rule group: %v", err)
+	}
+	name, ok := group["name"].(string)
+	if !ok || name == "" {
+		return errors.Wrap(ErrInvalid, "rule group has no name")
+	}
+
+	return s.update(ctx, tenant, namespace, func(groups []map[string]interface{}) ([]map[string]interface{}, error) {
+		for i, g := range groups {
+			if g["name"] == name {
+				groups[i] = group
+				return groups, nil
+			}
+		}
+		return append(groups, group), nil
+	})
+}
+
+// DeleteGroup deletes the given rule group of the given namespace of the given tenant.
+func (s *Storage) DeleteGroup(ctx context.Context, tenant, namespace, group string) error {
+	return s.update(ctx, tenant, namespace, func(groups []map[string]interface{}) ([]map[string]interface{}, error) {
+		for i, g := range groups {
+			if g["name"] == group {
+				return append(groups[:i], groups[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// DeleteNamespace deletes all the rule groups of the given namespace of the given tenant.
+func (s *Storage) DeleteNamespace(ctx context.Context, tenant, namespace string) error {
+	return s.update(ctx, tenant, namespace, func(groups []map[string]interface{}) ([]map[string]interface{}, error) {
+		if len(groups) == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, nil
+	})
+}
+
+// update replaces the rule groups of the given namespace of the given tenant with the result of f. The rule file is
+// deleted if no group is left, and is not uploaded if the groups are not valid.
+func (s *Storage) update(ctx context.Context, tenant, namespace string, f func([]map[string]interface{}) ([]map[string]interface{}, error)) error {
+	name, err := s.file(tenant, namespace)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	groups, err := s.read(ctx, name)
+	if err != nil {
+		return err
+	}
+	groups, err = f(groups)
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		if err := s.bkt.Delete(ctx, name); err != nil && !s.bkt.IsObjNotFoundErr(err) {
+			return errors.Wrapf(err, "delete rule file %s", name)
+		}
+		return nil
+	}
+
+	b, err := yaml.Marshal(struct {
+		Groups []map[string]interface{} `yaml:"groups"`
+	}{Groups: groups})
+	if err != nil {
+		return errors.Wrap(err, "marshal rule groups")
+	}
+	if _, errs := ValidateAndCount(bytes.NewReader(b)); errs.Err() != nil {
+		return errors.Wrapf(ErrInvalid, "validate rule groups: %v", errs.Err())
+	}
+	if err := s.bkt.Upload(ctx, name, bytes.NewReader(b)); err != nil {
+		return errors.Wrapf(err, "upload rule file %s", name)
+	}
+	return nil
+}
+
+// read returns the rule groups of the given rule file, or no group if it does not exist.
+func (s *Storage) read(ctx context.Context, name string) ([]map[string]interface{}, error) {
+	rc, err := s.bkt.Get(ctx, name)
+	if err != nil {
+		if s.bkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get rule file %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(s.logger, rc, "rule file reader")
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read rule file %s", name)
+	}
+	var rf struct {
+		Groups []map[string]interface{} `yaml:"groups"`
+	}
+	if err := yaml.Unmarshal(b, &rf); err != nil {
+		return nil, errors.Wrapf(err, "parse rule file %s", name)
+	}
+	return rf.Groups, nil
+}
+
+// file returns the name of the rule file of the given namespace of the given tenant in the bucket.
+func (s *Storage) file(tenant, namespace string) (string, error) {
+	for _, n := range []string{tenant, namespace} {
+		if !validName.MatchString(n) {
+			return "", errors.Wrapf(ErrInvalid, "name %q", n)
+		}
+	}
+	return path.Join(s.prefix, tenant, namespace+ruleFileExt), nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_rule_storage")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	s := NewStorage(log.NewNopLogger(), bkt, "rules/", filepath.Join(dir, "rule-storage"))
+
+	files, err := s.Sync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(files))
+
+	testutil.Ok(t, s.SetGroup(ctx, "tenant-a", "ns", []byte(`
+name: group-1
+partial_response_strategy: warn
+rules:
+- alert: some
+  expr: up == 0
+`)))
+	testutil.Ok(t, s.SetGroup(ctx, "tenant-a", "ns", []byte(`
+name: group-2
+rules:
+- record: some
+  expr: sum(up)
+`)))
+	testutil.Ok(t, s.SetGroup(ctx, "tenant-b", "other", []byte(`
+name: group-1
+rules:
+- record: some
+  expr: sum(up)
+`)))
+
+	// Replace a group.
+	testutil.Ok(t, s.SetGroup(ctx, "tenant-a", "ns", []byte(`
+name: group-2
+rules:
+- record: other
+  expr: sum(up)
+`)))
+	g, err := s.Group(ctx, "tenant-a", "ns", "group-2")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "other", g["rules"].([]interface{})[0].(map[string]interface{})["record"])
+
+	groups, err := s.Namespace(ctx, "tenant-a", "ns")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(groups))
+	testutil.Equals(t, "warn", groups[0]["partial_response_strategy"])
+
+	namespaces, err := s.Namespaces(ctx, "tenant-a")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"ns"}, namespaces)
+
+	files, err = s.Sync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{
+		filepath.Join(dir, "rule-storage", "tenant-a", "ns.yaml"),
+		filepath.Join(dir, "rule-storage", "tenant-b", "other.yaml"),
+	}, files)
+	b, err := ioutil.ReadFile(files[0])
+	testutil.Ok(t, err)
+	n, errs := ValidateAndCount(bytes.NewReader(b))
+	testutil.Ok(t, errs.Err())
+	testutil.Equals(t, 2, n)
+
+	// Invalid groups and names are rejected.
+	testutil.Equals(t, ErrInvalid, errors.Cause(s.SetGroup(ctx, "tenant-a", "ns", []byte(`
+name: group-3
+rules:
+- record: some
+  expr: sum(up
+`))))
+	testutil.Equals(t, ErrInvalid, errors.Cause(s.SetGroup(ctx, "tenant-a", "ns", []byte(`rules: []`))))
+	testutil.Equals(t, ErrInvalid, errors.Cause(s.SetGroup(ctx, "..", "ns", []byte(`name: group-3`))))
+	testutil.Equals(t, ErrInvalid, errors.Cause(s.SetGroup(ctx, "tenant-a", "../ns", []byte(`name: group-3`))))
+
+	// Delete groups and namespaces.
+	testutil.Equals(t, ErrNotFound, errors.Cause(s.DeleteGroup(ctx, "tenant-a", "ns", "group-3")))
+	testutil.Ok(t, s.DeleteGroup(ctx, "tenant-a", "ns", "group-1"))
+	testutil.Ok(t, s.DeleteGroup(ctx, "tenant-a", "ns", "group-2"))
+	_, err = s.Namespace(ctx, "tenant-a", "ns")
+	testutil.Equals(t, ErrNotFound, errors.Cause(err))
+	testutil.Ok(t, s.DeleteNamespace(ctx, "tenant-b", "other"))
+	testutil.Equals(t, ErrNotFound, errors.Cause(s.DeleteNamespace(ctx, "tenant-b", "other")))
+
+	files, err = s.Sync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(files))
+}
@@ -0,0 +1,289 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package auth authenticates and authorizes the requests to HTTP servers, with basic authentication, static bearer
+// tokens or OpenID Connect ID tokens.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// The authentication methods of the identities.
+const (
+	MethodBasic  = "basic"
+	MethodBearer = "bearer"
+	MethodOIDC   = "oidc"
+)
+
+// Config is the configuration of the authentication and authorization of the requests.
+type Config struct {
+	// BasicAuthUsers are the bcrypt hashes of the passwords of the users allowed to authenticate with basic
+	// authentication, by user name.
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+	// BearerTokens are the static tokens allowed to authenticate with the Authorization Bearer header.
+	BearerTokens []BearerToken `yaml:"bearer_tokens"`
+	// OIDC enables the authentication with the ID tokens of an OpenID Connect provider in the Authorization Bearer
+	// header.
+	OIDC *OIDCConfig `yaml:"oidc"`
+	// Authorization are the rules of the paths the identities are allowed to request. All the authenticated
+	// requests are allowed if empty.
+	Authorization []AuthorizationRule `yaml:"authorization"`
+}
+
+// BearerToken is a static bearer token.
+type BearerToken struct {
+	// Subject is the name of the identity authenticated with the token.
+	Subject string `yaml:"subject"`
+	// Token is the token. Takes precedence over TokenFile.
+	Token string `yaml:"token"`
+	// TokenFile is the path of the file holding the token.
+	TokenFile string `yaml:"token_file"`
+}
+
+// AuthorizationRule allows the given subjects to request the paths with the given prefixes.
+type AuthorizationRule struct {
+	// Subjects are the names of the identities, or their OpenID Connect groups. '*' matches all the identities.
+	Subjects []string `yaml:"subjects"`
+	// PathPrefixes are the prefixes of the allowed paths. All the paths are allowed if empty.
+	PathPrefixes []string `yaml:"path_prefixes"`
+}
+
+// Parse parses and validates the YAML configuration of the authentication.
+func Parse(b []byte) (Config, error) {
+	var cfg Config
+	if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+		return Config{}, errors.Wrap(err, "parsing YAML content")
+	}
+	if len(cfg.BasicAuthUsers) == 0 && len(cfg.BearerTokens) == 0 && cfg.OIDC == nil {
+		return Config{}, errors.New("no authentication method configured")
+	}
+	for user, hash := range cfg.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return Config{}, errors.Wrapf(err, "invalid bcrypt hash of the password of user %s", user)
+		}
+	}
+	for i, t := range cfg.BearerTokens {
+		if t.Subject == "" {
+			return Config{}, errors.Errorf("no subject for bearer token %d", i)
+		}
+		if t.Token == "" && t.TokenFile == "" {
+			return Config{}, errors.Errorf("no token nor token file for bearer token of %s", t.Subject)
+		}
+	}
+	if cfg.OIDC != nil {
+		if cfg.OIDC.IssuerURL == "" || cfg.OIDC.ClientID == "" {
+			return Config{}, errors.New("both the issuer URL and the client ID must be set for OIDC")
+		}
+	}
+	for i, r := range cfg.Authorization {
+		if len(r.Subjects) == 0 {
+			return Config{}, errors.Errorf("no subjects for authorization rule %d", i)
+		}
+	}
+	return cfg, nil
+}
+
+// Identity is an authenticated identity.
+type Identity struct {
+	// Name is the user name of basic authentication, the subject of static bearer tokens, or the configured claim of
+	// OpenID Connect ID tokens.
+	Name string
+	// Groups are the OpenID Connect groups of the identity, if any.
+	Groups []string
+	// Method is the method the identity is authenticated with.
+	Method string
+}
+
+type ctxKey int
+
+const identityKey = ctxKey(0)
+
+// IdentityFromContext returns the identity of the authenticated request of the context.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey).(Identity)
+	return id, ok
+}
+
+// Authorizer authorizes the authenticated requests.
+type Authorizer interface {
+	// Authorize returns an error if the identity is not allowed to send the request.
+	Authorize(r *http.Request, id Identity) error
+}
+
+// AuthorizerFunc is a function implementing Authorizer.
+type AuthorizerFunc func(r *http.Request, id Identity) error
+
+// Authorize implements Authorizer.
+func (f AuthorizerFunc) Authorize(r *http.Request, id Identity) error {
+	return f(r, id)
+}
+
+// NewRulesAuthorizer returns an Authorizer allowing the requests matching any of the given rules, or all the requests
+// if there are none.
+func NewRulesAuthorizer(rules []AuthorizationRule) Authorizer {
+	return AuthorizerFunc(func(r *http.Request, id Identity) error {
+		if len(rules) == 0 {
+			return nil
+		}
+		for _, rule := range rules {
+			if rule.matchesSubject(id) && rule.matchesPath(r.URL.Path) {
+				return nil
+			}
+		}
+		return errors.Errorf("%s is not allowed to request %s", id.Name, r.URL.Path)
+	})
+}
+
+func (r AuthorizationRule) matchesSubject(id Identity) bool {
+	for _, s := range r.Subjects {
+		if s == "*" || s == id.Name {
+			return true
+		}
+		for _, g := range id.Groups {
+			if s == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r AuthorizationRule) matchesPath(path string) bool {
+	if len(r.PathPrefixes) == 0 {
+		return true
+	}
+	for _, p := range r.PathPrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware authenticates the requests, then authorizes them.
+type Middleware struct {
+	logger     log.Logger
+	basic      map[string][]byte
+	bearer     map[string]string
+	oidc       *oidcVerifier
+	authorizer Authorizer
+
+	requests *prometheus.CounterVec
+}
+
+// NewMiddleware returns a new Middleware for the given configuration. The requests are authorized by the rules of
+// the configuration, unless another authorizer is given.
+func NewMiddleware(logger log.Logger, reg prometheus.Registerer, cfg Config, authorizer Authorizer) (*Middleware, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if authorizer == nil {
+		authorizer = NewRulesAuthorizer(cfg.Authorization)
+	}
+
+	m := &Middleware{
+		logger:     logger,
+		basic:      make(map[string][]byte, len(cfg.BasicAuthUsers)),
+		bearer:     make(map[string]string, len(cfg.BearerTokens)),
+		authorizer: authorizer,
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_http_auth_requests_total",
+			Help: "Total number of HTTP requests checked for authentication and authorization, by result.",
+		}, []string{"result"}),
+	}
+	for user, hash := range cfg.BasicAuthUsers {
+		m.basic[user] = []byte(hash)
+	}
+	for _, t := range cfg.BearerTokens {
+		token := t.Token
+		if token == "" {
+			b, err := ioutil.ReadFile(t.TokenFile)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read bearer token file of %s", t.Subject)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		m.bearer[token] = t.Subject
+	}
+	if cfg.OIDC != nil {
+		m.oidc = newOIDCVerifier(*cfg.OIDC)
+	}
+
+	for _, result := range []string{"allowed", "unauthenticated", "denied"} {
+		m.requests.WithLabelValues(result)
+	}
+	return m, nil
+}
+
+// Authenticate returns the identity of the request, or an error if it is not authenticated.
+func (m *Middleware) Authenticate(r *http.Request) (Identity, error) {
+	if user, password, ok := r.BasicAuth(); ok {
+		hash, ok := m.basic[user]
+		if !ok {
+			return Identity{}, errors.Errorf("unknown user %s", user)
+		}
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			return Identity{}, errors.Errorf("invalid password of user %s", user)
+		}
+		return Identity{Name: user, Method: MethodBasic}, nil
+	}
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return Identity{}, errors.New("no credentials")
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	for t, subject := range m.bearer {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return Identity{Name: subject, Method: MethodBearer}, nil
+		}
+	}
+	if m.oidc == nil {
+		return Identity{}, errors.New("unknown bearer token")
+	}
+	id, err := m.oidc.verify(r.Context(), token)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "verify ID token")
+	}
+	return id, nil
+}
+
+// Handler returns a handler serving the authenticated and authorized requests with the given handler. The identity
+// of the requests is added to their context.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := m.Authenticate(r)
+		if err != nil {
+			m.requests.WithLabelValues("unauthenticated").Inc()
+			level.Debug(m.logger).Log("msg", "unauthenticated request", "path", r.URL.Path, "err", err)
+			if len(m.basic) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="thanos"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if err := m.authorizer.Authorize(r, id); err != nil {
+			m.requests.WithLabelValues("denied").Inc()
+			level.Debug(m.logger).Log("msg", "unauthorized request", "path", r.URL.Path, "err", err)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		m.requests.WithLabelValues("allowed").Inc()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+	})
+}
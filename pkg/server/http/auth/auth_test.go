@@ -0,0 +1,377 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParse(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	testutil.Ok(t, err)
+
+	cfg, err := Parse([]byte(fmt.Sprintf(`
+basic_auth_users:
+  alice: %s
+bearer_tokens:
+  - subject: ci
+    token: token
+authorization:
+  - subjects: [ci]
+    path_prefixes: [/api/v1/query]
+`, hash)))
+	testutil.Ok(t, err)
+	testutil.Equals(t, Config{
+		BasicAuthUsers: map[string]string{"alice": string(hash)},
+		BearerTokens:   []BearerToken{{Subject: "ci", Token: "token"}},
+		Authorization:  []AuthorizationRule{{Subjects: []string{"ci"}, PathPrefixes: []string{"/api/v1/query"}}},
+	}, cfg)
+
+	for _, tcase := range []string{
+		``,
+		`basic_auth_users: {alice: secret}`,
+		`bearer_tokens: [{token: token}]`,
+		`bearer_tokens: [{subject: ci}]`,
+		`oidc: {issuer_url: https://example.org}`,
+		`bearer_tokens: [{subject: ci, token: token}]
+authorization: [{path_prefixes: [/]}]`,
+		`unknown: true`,
+	} {
+		_, err := Parse([]byte(tcase))
+		testutil.NotOk(t, err, tcase)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	testutil.Ok(t, err)
+
+	m, err := NewMiddleware(log.NewNopLogger(), nil, Config{
+		BasicAuthUsers: map[string]string{"alice": string(hash)},
+		BearerTokens:   []BearerToken{{Subject: "ci", Token: "token"}},
+		Authorization: []AuthorizationRule{
+			{Subjects: []string{"alice"}},
+			{Subjects: []string{"ci"}, PathPrefixes: []string{"/api/v1/query"}},
+		},
+	}, nil)
+	testutil.Ok(t, err)
+
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFromContext(r.Context())
+		testutil.Assert(t, ok, "identity should be in the context")
+		_, _ = w.Write([]byte(id.Method + ":" + id.Name))
+	}))
+
+	for _, tcase := range []struct {
+		name           string
+		path           string
+		setAuth        func(r *http.Request)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "no credentials",
+			path:           "/api/v1/query",
+			setAuth:        func(r *http.Request) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "basic auth",
+			path:           "/api/v1/rules",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("alice", "secret") },
+			expectedStatus: http.StatusOK,
+			expectedBody:   "basic:alice",
+		},
+		{
+			name:           "basic auth with invalid password",
+			path:           "/api/v1/rules",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("alice", "invalid") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "basic auth with unknown user",
+			path:           "/api/v1/rules",
+			setAuth:        func(r *http.Request) { r.SetBasicAuth("bob", "secret") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bearer token",
+			path:           "/api/v1/query_range",
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expectedStatus: http.StatusOK,
+			expectedBody:   "bearer:ci",
+		},
+		{
+			name:           "unknown bearer token",
+			path:           "/api/v1/query",
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer invalid") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bearer token of subject not allowed to request path",
+			path:           "/api/v1/rules",
+			setAuth:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expectedStatus: http.StatusForbidden,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tcase.path, nil)
+			tcase.setAuth(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			testutil.Equals(t, tcase.expectedStatus, rec.Code)
+			if tcase.expectedStatus == http.StatusOK {
+				testutil.Equals(t, tcase.expectedBody, rec.Body.String())
+			}
+			if tcase.expectedStatus == http.StatusUnauthorized {
+				testutil.Equals(t, `Basic realm="thanos"`, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestMiddleware_Authorizer(t *testing.T) {
+	m, err := NewMiddleware(log.NewNopLogger(), nil, Config{
+		BearerTokens: []BearerToken{{Subject: "ci", Token: "token"}},
+	}, AuthorizerFunc(func(r *http.Request, id Identity) error {
+		if r.Method != http.MethodGet {
+			return fmt.Errorf("%s is read-only", id.Name)
+		}
+		return nil
+	}))
+	testutil.Ok(t, err)
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for method, status := range map[string]int{http.MethodGet: http.StatusOK, http.MethodPost: http.StatusForbidden} {
+		req := httptest.NewRequest(method, "/api/v1/query", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		testutil.Equals(t, status, rec.Code, method)
+	}
+}
+
+func TestMiddleware_OIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	testutil.Ok(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	testutil.Ok(t, err)
+
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			testutil.Ok(t, json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"}))
+		case "/keys":
+			// Keys of unsupported types or curves are ignored.
+			testutil.Ok(t, json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+				{"kty": "OKP", "kid": "key-ed25519", "use": "sig", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+				{"kty": "EC", "kid": "key-p192", "use": "sig", "crv": "P-192", "x": "AQ", "y": "AQ"},
+				{
+					"kty": "RSA",
+					"kid": "key-1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				},
+			}}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	issuer = srv.URL
+
+	m, err := NewMiddleware(log.NewNopLogger(), nil, Config{
+		OIDC: &OIDCConfig{IssuerURL: issuer, ClientID: "thanos", UsernameClaim: "email", GroupsClaim: "groups"},
+		Authorization: []AuthorizationRule{
+			{Subjects: []string{"admins"}},
+		},
+	}, nil)
+	testutil.Ok(t, err)
+
+	sign := func(k *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(k)
+		testutil.Ok(t, err)
+		return s
+	}
+	claims := func(modify func(c jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":    issuer,
+			"aud":    []string{"other", "thanos"},
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"sub":    "1234",
+			"email":  "alice@example.org",
+			"groups": []string{"users", "admins"},
+		}
+		modify(c)
+		return c
+	}
+
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := IdentityFromContext(r.Context())
+		_, _ = w.Write([]byte(id.Method + ":" + id.Name))
+	}))
+	for _, tcase := range []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{
+			name:           "valid token",
+			token:          sign(key, "key-1", claims(func(jwt.MapClaims) {})),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "single audience",
+			token:          sign(key, "key-1", claims(func(c jwt.MapClaims) { c["aud"] = "thanos" })),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "other audience",
+			token:          sign(key, "key-1", claims(func(c jwt.MapClaims) { c["aud"] = "other" })),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "other issuer",
+			token:          sign(key, "key-1", claims(func(c jwt.MapClaims) { c["iss"] = "https://example.org" })),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired",
+			token:          sign(key, "key-1", claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no expiration time",
+			token:          sign(key, "key-1", claims(func(c jwt.MapClaims) { delete(c, "exp") })),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "signed with unknown key",
+			token:          sign(otherKey, "key-2", claims(func(jwt.MapClaims) {})),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "signed with other key",
+			token:          sign(otherKey, "key-1", claims(func(jwt.MapClaims) {})),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "not in allowed group",
+			token:          sign(key, "key-1", claims(func(c jwt.MapClaims) { c["groups"] = []string{"users"} })),
+			expectedStatus: http.StatusForbidden,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			req.Header.Set("Authorization", "Bearer "+tcase.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			testutil.Equals(t, tcase.expectedStatus, rec.Code)
+			if tcase.expectedStatus == http.StatusOK {
+				testutil.Equals(t, "oidc:alice@example.org", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestOIDCVerifier_ConcurrentKeysRefresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	testutil.Ok(t, err)
+
+	var (
+		issuer  string
+		fetches int32
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			testutil.Ok(t, json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"}))
+		case "/keys":
+			atomic.AddInt32(&fetches, 1)
+			// Slow enough for all the tokens to wait for the keys.
+			time.Sleep(100 * time.Millisecond)
+			testutil.Ok(t, json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	issuer = srv.URL
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": issuer,
+		"aud": "thanos",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"sub": "alice",
+	})
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	testutil.Ok(t, err)
+
+	v := newOIDCVerifier(OIDCConfig{IssuerURL: issuer, ClientID: "thanos"})
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 10)
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.verify(context.Background(), signed)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		testutil.Ok(t, err)
+	}
+	testutil.Equals(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// Waiting for the keys stops with the context of the token.
+	v = newOIDCVerifier(OIDCConfig{IssuerURL: issuer, ClientID: "thanos"})
+	go func() { _, _ = v.verify(context.Background(), signed) }()
+	for {
+		v.mtx.Lock()
+		refreshing := v.refreshing != nil
+		v.mtx.Unlock()
+		if refreshing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = v.verify(ctx, signed)
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,279 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// minKeysRefreshInterval is the minimum interval between two fetches of the keys of the provider, so that tokens
+// signed with unknown keys can not be used to flood it.
+const minKeysRefreshInterval = time.Minute
+
+// errUnsupportedKey is the error of the keys of the provider which can not be used to verify tokens, e.g. of other
+// types or curves.
+var errUnsupportedKey = errors.New("unsupported key")
+
+// OIDCConfig is the configuration of the authentication with the ID tokens of an OpenID Connect provider.
+type OIDCConfig struct {
+	// IssuerURL is the URL of the provider, which must be the issuer of the tokens. Its configuration is discovered
+	// from the /.well-known/openid-configuration path of the URL.
+	IssuerURL string `yaml:"issuer_url"`
+	// ClientID is the ID of the client the tokens must be issued for, in their audience.
+	ClientID string `yaml:"client_id"`
+	// UsernameClaim is the claim of the tokens used as the name of the identities. Defaults to sub.
+	UsernameClaim string `yaml:"username_claim"`
+	// GroupsClaim is the claim of the tokens holding the groups of the identities, if any.
+	GroupsClaim string `yaml:"groups_claim"`
+}
+
+// oidcVerifier verifies the signature and the claims of ID tokens, with the keys of the provider. The keys are
+// fetched on the first token, and refetched when a token is signed with an unknown key, e.g. after their rotation.
+type oidcVerifier struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mtx         sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+	// refreshing is closed once the keys being fetched, if any, are refreshed.
+	refreshing chan struct{}
+}
+
+func newOIDCVerifier(cfg OIDCConfig) *oidcVerifier {
+	cfg.IssuerURL = strings.TrimSuffix(cfg.IssuerURL, "/")
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "sub"
+	}
+	return &oidcVerifier{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (v *oidcVerifier) verify(ctx context.Context, token string) (Identity, error) {
+	parser := &jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}}
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	}); err != nil {
+		return Identity{}, err
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return Identity{}, errors.New("token without expiration time")
+	}
+	if !claims.VerifyIssuer(v.cfg.IssuerURL, true) {
+		return Identity{}, errors.Errorf("token not issued by %s", v.cfg.IssuerURL)
+	}
+	if !hasAudience(claims["aud"], v.cfg.ClientID) {
+		return Identity{}, errors.Errorf("token not issued for client %s", v.cfg.ClientID)
+	}
+
+	name, ok := claims[v.cfg.UsernameClaim].(string)
+	if !ok || name == "" {
+		return Identity{}, errors.Errorf("no %s claim in token", v.cfg.UsernameClaim)
+	}
+	id := Identity{Name: name, Method: MethodOIDC}
+	if v.cfg.GroupsClaim != "" {
+		groups, _ := claims[v.cfg.GroupsClaim].([]interface{})
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	}
+	return id, nil
+}
+
+// hasAudience returns true if the audience claim, either a string or a list of strings, contains the client ID.
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the key of the provider with the given ID, refreshing the keys if it is unknown. The keys are fetched
+// by a single caller at a time, without holding the lock, and the other callers wait for them.
+func (v *oidcVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for {
+		v.mtx.Lock()
+		if k, ok := v.keys[kid]; ok {
+			v.mtx.Unlock()
+			return k, nil
+		}
+		if v.refreshing == nil {
+			break
+		}
+		refreshing := v.refreshing
+		v.mtx.Unlock()
+
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if time.Since(v.lastRefresh) < minKeysRefreshInterval {
+		v.mtx.Unlock()
+		return nil, errors.Errorf("unknown key %q", kid)
+	}
+	v.lastRefresh = time.Now()
+	refreshing := make(chan struct{})
+	v.refreshing = refreshing
+	v.mtx.Unlock()
+
+	// The keys are fetched for all the waiting callers, so not with the context of this one. The client has a timeout.
+	keys, err := v.fetchKeys(context.Background())
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if err == nil {
+		v.keys = keys
+	}
+	v.refreshing = nil
+	close(refreshing)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch keys of provider")
+	}
+	if k, ok := v.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, errors.Errorf("unknown key %q", kid)
+}
+
+func (v *oidcVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.get(ctx, v.cfg.IssuerURL+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, errors.Wrap(err, "discover provider configuration")
+	}
+	if discovery.Issuer != v.cfg.IssuerURL {
+		return nil, errors.Errorf("issuer %s of provider configuration does not match %s", discovery.Issuer, v.cfg.IssuerURL)
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.get(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, errors.Wrap(err, "get JSON web key set")
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if errors.Cause(err) == errUnsupportedKey {
+			// Providers can publish keys for other algorithms, unused for the tokens verified here.
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse key %q", k.Kid)
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (v *oidcVerifier) get(ctx context.Context, url string, value interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(value), "decode response of %s", url)
+}
+
+// jwk is a JSON web key, as defined in RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// The modulus and exponent of RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+	// The curve and coordinates of elliptic curve keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode modulus")
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Wrapf(errUnsupportedKey, "curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode x coordinate")
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode y coordinate")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errors.Wrapf(errUnsupportedKey, "key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -40,15 +40,23 @@ func New(logger log.Logger, reg *prometheus.Registry, comp component.Component,
 
 	mux := http.NewServeMux()
 	registerMetrics(mux, reg)
-	registerProbes(mux, prober, logger)
 	registerProfiler(mux)
 
+	handler := http.NewServeMux()
+	// The probes are never authenticated, so that they can be used by orchestrators like Kubernetes.
+	registerProbes(handler, prober, logger)
+	if options.auth != nil {
+		handler.Handle("/", options.auth.Handler(mux))
+	} else {
+		handler.Handle("/", mux)
+	}
+
 	return &Server{
 		logger: log.With(logger, "service", "http/server", "component", comp.String()),
 		comp:   comp,
 		prober: prober,
 		mux:    mux,
-		srv:    &http.Server{Addr: options.listen, Handler: mux},
+		srv:    &http.Server{Addr: options.listen, Handler: handler, TLSConfig: options.tlsConfig},
 		opts:   options,
 	}
 }
@@ -56,6 +64,10 @@ func New(logger log.Logger, reg *prometheus.Registry, comp component.Component,
 // ListenAndServe listens on the TCP network address and handles requests on incoming connections.
 func (s *Server) ListenAndServe() error {
 	level.Info(s.logger).Log("msg", "listening for requests and metrics", "address", s.opts.listen)
+	if s.opts.tlsConfig != nil {
+		// The certificates are already in the TLS config.
+		return errors.Wrap(s.srv.ListenAndServeTLS("", ""), "serve HTTPS and metrics")
+	}
 	return errors.Wrap(s.srv.ListenAndServe(), "serve HTTP and metrics")
 }
 
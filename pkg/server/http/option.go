@@ -4,12 +4,17 @@
 package http
 
 import (
+	"crypto/tls"
 	"time"
+
+	"github.com/thanos-io/thanos/pkg/server/http/auth"
 )
 
 type options struct {
 	gracePeriod time.Duration
 	listen      string
+	tlsConfig   *tls.Config
+	auth        *auth.Middleware
 }
 
 // Option overrides behavior of Server.
@@ -38,3 +43,19 @@ func WithListen(s string) Option {
 		o.listen = s
 	})
 }
+
+// WithTLSConfig sets TLS configuration for HTTP server.
+// Server serves HTTPS if the configuration is not nil.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return optionFunc(func(o *options) {
+		o.tlsConfig = cfg
+	})
+}
+
+// WithAuth sets the authentication and authorization of the requests to the HTTP server.
+// All the endpoints but the probes require authentication if the middleware is not nil.
+func WithAuth(m *auth.Middleware) Option {
+	return optionFunc(func(o *options) {
+		o.auth = m
+	})
+}
@@ -8,12 +8,14 @@ package shipper
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -36,6 +38,7 @@ type metrics struct {
 	uploads           prometheus.Counter
 	uploadFailures    prometheus.Counter
 	uploadedCompacted prometheus.Gauge
+	pendingCompacted  prometheus.Gauge
 }
 
 func newMetrics(reg prometheus.Registerer, uploadCompacted bool) *metrics {
@@ -61,10 +64,16 @@ func newMetrics(reg prometheus.Registerer, uploadCompacted bool) *metrics {
 		Name: "thanos_shipper_upload_compacted_done",
 		Help: "If 1 it means shipper uploaded all compacted blocks from the filesystem.",
 	}
+	pendingCompactedGaugeOpts := prometheus.GaugeOpts{
+		Name: "thanos_shipper_upload_compacted_pending_blocks",
+		Help: "Number of blocks from the filesystem the shipper has yet to check and upload in the current sync.",
+	}
 	if uploadCompacted {
 		m.uploadedCompacted = promauto.With(reg).NewGauge(uploadCompactedGaugeOpts)
+		m.pendingCompacted = promauto.With(reg).NewGauge(pendingCompactedGaugeOpts)
 	} else {
 		m.uploadedCompacted = promauto.With(nil).NewGauge(uploadCompactedGaugeOpts)
+		m.pendingCompacted = promauto.With(nil).NewGauge(pendingCompactedGaugeOpts)
 	}
 	return &m
 }
@@ -79,13 +88,18 @@ type Shipper struct {
 	labels  func() labels.Labels
 	source  metadata.SourceType
 
+	annotations map[string]string
+
 	uploadCompacted        bool
 	allowOutOfOrderUploads bool
+	uploadOpts             block.UploadOptions
 }
 
 // New creates a new shipper that detects new TSDB blocks in dir and uploads them to
-// remote if necessary. It attaches the Thanos metadata section in each meta JSON file.
-// If uploadCompacted is enabled, it also uploads compacted blocks which are already in filesystem.
+// remote if necessary. It attaches the Thanos metadata section in each meta JSON file, with the given annotations.
+// If uploadCompacted is enabled, it also uploads compacted blocks which are already in filesystem, as well as
+// blocks created externally, after checking they do not overlap with the blocks of the bucket.
+// The blocks are uploaded with the given upload options.
 func New(
 	logger log.Logger,
 	r prometheus.Registerer,
@@ -93,8 +107,10 @@ func New(
 	bucket objstore.Bucket,
 	lbls func() labels.Labels,
 	source metadata.SourceType,
+	annotations map[string]string,
 	uploadCompacted bool,
 	allowOutOfOrderUploads bool,
+	uploadOpts block.UploadOptions,
 ) *Shipper {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -110,8 +126,10 @@ func New(
 		labels:                 lbls,
 		metrics:                newMetrics(r, uploadCompacted),
 		source:                 source,
+		annotations:            annotations,
 		allowOutOfOrderUploads: allowOutOfOrderUploads,
 		uploadCompacted:        uploadCompacted,
+		uploadOpts:             uploadOpts,
 	}
 }
 
@@ -157,8 +175,9 @@ type lazyOverlapChecker struct {
 	bucket objstore.Bucket
 	labels func() labels.Labels
 
-	metas       []tsdb.BlockMeta
-	lookupMetas map[ulid.ULID]struct{}
+	metas         []tsdb.BlockMeta
+	lookupMetas   map[ulid.ULID]struct{}
+	lookupSources map[ulid.ULID]struct{}
 }
 
 func newLazyOverlapChecker(logger log.Logger, bucket objstore.Bucket, labels func() labels.Labels) *lazyOverlapChecker {
@@ -167,7 +186,8 @@ func newLazyOverlapChecker(logger log.Logger, bucket objstore.Bucket, labels fun
 		bucket: bucket,
 		labels: labels,
 
-		lookupMetas: map[ulid.ULID]struct{}{},
+		lookupMetas:   map[ulid.ULID]struct{}{},
+		lookupSources: map[ulid.ULID]struct{}{},
 	}
 }
 
@@ -187,8 +207,7 @@ func (c *lazyOverlapChecker) sync(ctx context.Context) error {
 			return nil
 		}
 
-		c.metas = append(c.metas, m.BlockMeta)
-		c.lookupMetas[m.ULID] = struct{}{}
+		c.add(m.BlockMeta)
 		return nil
 
 	}); err != nil {
@@ -199,22 +218,60 @@ func (c *lazyOverlapChecker) sync(ctx context.Context) error {
 	return nil
 }
 
-func (c *lazyOverlapChecker) IsOverlapping(ctx context.Context, newMeta tsdb.BlockMeta) error {
-	if !c.synced {
-		level.Info(c.logger).Log("msg", "gathering all existing blocks from the remote bucket for check", "id", newMeta.ULID.String())
-		if err := c.sync(ctx); err != nil {
-			return err
+// add records the given block as being in the remote bucket.
+func (c *lazyOverlapChecker) add(m tsdb.BlockMeta) {
+	c.metas = append(c.metas, m)
+	c.lookupMetas[m.ULID] = struct{}{}
+	for _, id := range m.Compaction.Sources {
+		c.lookupSources[id] = struct{}{}
+	}
+}
+
+func (c *lazyOverlapChecker) ensureSynced(ctx context.Context, newMeta tsdb.BlockMeta) error {
+	if c.synced {
+		return nil
+	}
+	level.Info(c.logger).Log("msg", "gathering all existing blocks from the remote bucket for check", "id", newMeta.ULID.String())
+	return c.sync(ctx)
+}
+
+// IsCovered returns true if all the source blocks of the given block are already in the remote bucket, either
+// as such or compacted in other blocks: the block holds no new data, e.g. it was compacted by Prometheus from
+// blocks which were already uploaded.
+func (c *lazyOverlapChecker) IsCovered(ctx context.Context, newMeta tsdb.BlockMeta) (bool, error) {
+	if err := c.ensureSynced(ctx, newMeta); err != nil {
+		return false, err
+	}
+	if len(newMeta.Compaction.Sources) == 0 {
+		return false, nil
+	}
+	for _, id := range newMeta.Compaction.Sources {
+		if _, ok := c.lookupSources[id]; ok {
+			continue
+		}
+		if _, ok := c.lookupMetas[id]; ok {
+			continue
 		}
+		return false, nil
 	}
+	return true, nil
+}
 
-	// TODO(bwplotka) so confusing! we need to sort it first. Add comment to TSDB code.
-	metas := append([]tsdb.BlockMeta{newMeta}, c.metas...)
-	sort.Slice(metas, func(i, j int) bool {
-		return metas[i].MinTime < metas[j].MinTime
-	})
-	if o := tsdb.OverlappingBlocks(metas); len(o) > 0 {
-		// TODO(bwplotka): Consider checking if overlaps relates to block in concern?
-		return errors.Errorf("shipping compacted block %s is blocked; overlap spotted: %s", newMeta.ULID, o.String())
+func (c *lazyOverlapChecker) IsOverlapping(ctx context.Context, newMeta tsdb.BlockMeta) error {
+	if err := c.ensureSynced(ctx, newMeta); err != nil {
+		return err
+	}
+
+	// Only the overlaps with the block in concern matter, the remote bucket might have overlaps of its own
+	// which the compactor takes care of.
+	var overlaps []string
+	for _, m := range c.metas {
+		if m.MinTime < newMeta.MaxTime && newMeta.MinTime < m.MaxTime {
+			overlaps = append(overlaps, fmt.Sprintf("%s [%d, %d)", m.ULID, m.MinTime, m.MaxTime))
+		}
+	}
+	if len(overlaps) > 0 {
+		return errors.Errorf("shipping block %s [%d, %d) is blocked; overlap spotted with: %s", newMeta.ULID, newMeta.MinTime, newMeta.MaxTime, strings.Join(overlaps, ", "))
 	}
 	return nil
 }
@@ -222,6 +279,11 @@ func (c *lazyOverlapChecker) IsOverlapping(ctx context.Context, newMeta tsdb.Blo
 // Sync performs a single synchronization, which ensures all non-compacted local blocks have been uploaded
 // to the object bucket once.
 //
+// If uploadCompacted is enabled, compacted local blocks are uploaded as well. As they can be compacted from
+// blocks previously uploaded, or be created externally, they are checked against the blocks in the bucket
+// first: blocks whose sources are all in the bucket already are skipped, and blocks overlapping with the
+// bucket are not uploaded.
+//
 // If uploaded.
 //
 // It is not concurrency-safe, however it is compactor-safe (running concurrently with compactor is ok).
@@ -255,6 +317,15 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 	if err != nil {
 		return 0, err
 	}
+
+	pending := 0
+	for _, m := range metas {
+		if _, uploaded := hasUploaded[m.ULID]; !uploaded && m.Stats.NumSamples > 0 {
+			pending++
+		}
+	}
+	s.metrics.pendingCompacted.Set(float64(pending))
+
 	for _, m := range metas {
 		// Do not sync a block if we already uploaded or ignored it. If it's no longer found in the bucket,
 		// it was generally removed by the compaction process.
@@ -283,15 +354,30 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 		}
 		if ok {
 			meta.Uploaded = append(meta.Uploaded, m.ULID)
+			pending--
+			s.metrics.pendingCompacted.Set(float64(pending))
 			continue
 		}
 
-		if m.Compaction.Level > 1 {
+		// Compacted blocks and blocks created externally can hold data which is in the bucket already.
+		if s.uploadCompacted {
+			covered, err := checker.IsCovered(ctx, m.BlockMeta)
+			if err != nil {
+				return 0, errors.Wrap(err, "check sources")
+			}
+			if covered {
+				level.Info(s.logger).Log("msg", "skipping block, all its sources are in the bucket already", "block", m.ULID, "level", m.Compaction.Level)
+				meta.Uploaded = append(meta.Uploaded, m.ULID)
+				pending--
+				s.metrics.pendingCompacted.Set(float64(pending))
+				continue
+			}
+
 			if err := checker.IsOverlapping(ctx, m.BlockMeta); err != nil {
 				if !s.allowOutOfOrderUploads {
-					return 0, errors.Errorf("Found overlap or error during sync, cannot upload compacted block, details: %v", err)
+					return 0, errors.Errorf("Found overlap or error during sync, cannot upload block, details: %v", err)
 				}
-				level.Error(s.logger).Log("msg", "found overlap or error during sync, cannot upload compacted block", "err", err)
+				level.Error(s.logger).Log("msg", "found overlap or error during sync, cannot upload block", "err", err)
 				uploadErrs++
 				continue
 			}
@@ -311,6 +397,14 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 		meta.Uploaded = append(meta.Uploaded, m.ULID)
 		uploaded++
 		s.metrics.uploads.Inc()
+		pending--
+		s.metrics.pendingCompacted.Set(float64(pending))
+
+		if s.uploadCompacted {
+			// Following blocks must not overlap with this one either.
+			checker.add(m.BlockMeta)
+			level.Info(s.logger).Log("msg", "uploaded block", "block", m.ULID, "level", m.Compaction.Level, "uploaded", uploaded, "pending", pending)
+		}
 	}
 	if err := WriteMetaFile(s.logger, s.dir, meta); err != nil {
 		level.Warn(s.logger).Log("msg", "updating meta file failed", "err", err)
@@ -359,11 +453,18 @@ func (s *Shipper) upload(ctx context.Context, meta *metadata.Meta) error {
 		meta.Thanos.Labels = lset.Map()
 	}
 	meta.Thanos.Source = s.source
+	// Keep the annotations of blocks created externally, unless they are overridden.
+	if len(s.annotations) > 0 && meta.Thanos.Annotations == nil {
+		meta.Thanos.Annotations = make(map[string]string, len(s.annotations))
+	}
+	for k, v := range s.annotations {
+		meta.Thanos.Annotations[k] = v
+	}
 	meta.Thanos.SegmentFiles = block.GetSegmentFiles(updir)
 	if err := meta.WriteToDir(s.logger, updir); err != nil {
 		return errors.Wrap(err, "write meta file")
 	}
-	return block.Upload(ctx, s.logger, s.bucket, updir)
+	return block.UploadWithOptions(ctx, s.logger, s.bucket, updir, s.uploadOpts)
 }
 
 // blockMetasFromOldest returns the block meta of each block found in dir
@@ -45,7 +45,7 @@ func TestShipper_SyncBlocks_e2e(t *testing.T) {
 		}()
 
 		extLset := labels.FromStrings("prometheus", "prom-1")
-		shipper := New(log.NewLogfmtLogger(os.Stderr), nil, dir, metricsBucket, func() labels.Labels { return extLset }, metadata.TestSource, false, false)
+		shipper := New(log.NewLogfmtLogger(os.Stderr), nil, dir, metricsBucket, func() labels.Labels { return extLset }, metadata.TestSource, nil, false, false, block.UploadOptions{})
 
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -129,7 +129,9 @@ func TestShipper_SyncBlocks_e2e(t *testing.T) {
 				# HELP thanos_objstore_bucket_operations_total Total number of all attempted operations against a bucket.
 				# TYPE thanos_objstore_bucket_operations_total counter
 				thanos_objstore_bucket_operations_total{bucket="test",operation="attributes"} 0
+				thanos_objstore_bucket_operations_total{bucket="test",operation="copy"} 0
 				thanos_objstore_bucket_operations_total{bucket="test",operation="delete"} 0
+				thanos_objstore_bucket_operations_total{bucket="test",operation="delete_multiple"} 0
 				thanos_objstore_bucket_operations_total{bucket="test",operation="exists"} 5
 				thanos_objstore_bucket_operations_total{bucket="test",operation="get"} 0
 				thanos_objstore_bucket_operations_total{bucket="test",operation="get_range"} 0
@@ -223,7 +225,7 @@ func TestShipper_SyncBlocksWithMigrating_e2e(t *testing.T) {
 		defer upcancel2()
 		testutil.Ok(t, p.WaitPrometheusUp(upctx2))
 
-		shipper := New(log.NewLogfmtLogger(os.Stderr), nil, dir, bkt, func() labels.Labels { return extLset }, metadata.TestSource, true, false)
+		shipper := New(log.NewLogfmtLogger(os.Stderr), nil, dir, bkt, func() labels.Labels { return extLset }, metadata.TestSource, nil, true, false, block.UploadOptions{})
 
 		// Create 10 new blocks. 9 of them (non compacted) should be actually uploaded.
 		var (
@@ -16,6 +16,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/oklog/ulid"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb"
 
@@ -32,7 +33,7 @@ func TestShipperTimestamps(t *testing.T) {
 		testutil.Ok(t, os.RemoveAll(dir))
 	}()
 
-	s := New(nil, nil, dir, nil, nil, metadata.TestSource, false, false)
+	s := New(nil, nil, dir, nil, nil, metadata.TestSource, nil, false, false, block.UploadOptions{})
 
 	// Missing thanos meta file.
 	_, _, err = s.Timestamps()
@@ -129,7 +130,7 @@ func TestIterBlockMetas(t *testing.T) {
 		},
 	}.WriteToDir(log.NewNopLogger(), path.Join(dir, id3.String())))
 
-	shipper := New(nil, nil, dir, nil, nil, metadata.TestSource, false, false)
+	shipper := New(nil, nil, dir, nil, nil, metadata.TestSource, nil, false, false, block.UploadOptions{})
 	metas, err := shipper.blockMetasFromOldest()
 	testutil.Ok(t, err)
 	testutil.Equals(t, sort.SliceIsSorted(metas, func(i, j int) bool {
@@ -164,7 +165,7 @@ func BenchmarkIterBlockMetas(b *testing.B) {
 	})
 	b.ResetTimer()
 
-	shipper := New(nil, nil, dir, nil, nil, metadata.TestSource, false, false)
+	shipper := New(nil, nil, dir, nil, nil, metadata.TestSource, nil, false, false, block.UploadOptions{})
 
 	_, err = shipper.blockMetasFromOldest()
 	testutil.Ok(b, err)
@@ -180,7 +181,8 @@ func TestShipperAddsSegmentFiles(t *testing.T) {
 	inmemory := objstore.NewInMemBucket()
 
 	lbls := []labels.Label{{Name: "test", Value: "test"}}
-	s := New(nil, nil, dir, inmemory, func() labels.Labels { return lbls }, metadata.TestSource, false, false)
+	annotations := map[string]string{metadata.ProducerAnnotation: "host-a"}
+	s := New(nil, nil, dir, inmemory, func() labels.Labels { return lbls }, metadata.TestSource, annotations, false, false, block.UploadOptions{})
 
 	id := ulid.MustNew(1, nil)
 	blockDir := path.Join(dir, id.String())
@@ -198,6 +200,9 @@ func TestShipperAddsSegmentFiles(t *testing.T) {
 				NumSamples: 1000, // Not really, but shipper needs nonzero value.
 			},
 		},
+		Thanos: metadata.Thanos{
+			Annotations: map[string]string{metadata.ProducerAnnotation: "host-b", "pipeline": "v1"},
+		},
 	}.WriteToDir(log.NewNopLogger(), path.Join(dir, id.String())))
 	testutil.Ok(t, ioutil.WriteFile(filepath.Join(blockDir, "index"), []byte("index file"), 0666))
 	segmentFile := "00001"
@@ -211,4 +216,87 @@ func TestShipperAddsSegmentFiles(t *testing.T) {
 	testutil.Ok(t, err)
 
 	testutil.Equals(t, []string{segmentFile}, meta.Thanos.SegmentFiles)
+	testutil.Equals(t, map[string]string{metadata.ProducerAnnotation: "host-a", "pipeline": "v1"}, meta.Thanos.Annotations)
+}
+
+func createTestBlock(t *testing.T, dir string, id ulid.ULID, mint, maxt int64, level int, sources ...ulid.ULID) {
+	blockDir := path.Join(dir, id.String())
+	testutil.Ok(t, os.MkdirAll(path.Join(blockDir, block.ChunksDirname), os.ModePerm))
+	testutil.Ok(t, metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    id,
+			MinTime: mint,
+			MaxTime: maxt,
+			Version: 1,
+			Stats: tsdb.BlockStats{
+				NumSamples: 1000, // Not really, but shipper needs nonzero value.
+			},
+			Compaction: tsdb.BlockMetaCompaction{
+				Level:   level,
+				Sources: sources,
+			},
+		},
+	}.WriteToDir(log.NewNopLogger(), blockDir))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(blockDir, "index"), []byte("index file"), 0666))
+}
+
+func TestShipperUploadCompacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer func() {
+		testutil.Ok(t, os.RemoveAll(dir))
+	}()
+
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	lbls := func() labels.Labels { return labels.FromStrings("prometheus", "prom-1") }
+
+	// Upload two blocks in the usual way, and replace them by their compaction, as Prometheus would.
+	a1, a2 := ulid.MustNew(1, nil), ulid.MustNew(2, nil)
+	createTestBlock(t, dir, a1, 0, 1000, 1, a1)
+	createTestBlock(t, dir, a2, 1000, 2000, 1, a2)
+	uploaded, err := New(nil, nil, dir, bkt, lbls, metadata.TestSource, nil, false, false, block.UploadOptions{}).Sync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, uploaded)
+
+	testutil.Ok(t, os.RemoveAll(path.Join(dir, a1.String())))
+	testutil.Ok(t, os.RemoveAll(path.Join(dir, a2.String())))
+	compacted := ulid.MustNew(3, nil)
+	createTestBlock(t, dir, compacted, 0, 2000, 2, a1, a2)
+
+	// A backfilled block overlapping with the bucket, and a compacted block with new data.
+	overlapping, newCompacted := ulid.MustNew(4, nil), ulid.MustNew(5, nil)
+	createTestBlock(t, dir, overlapping, 500, 1500, 1, overlapping)
+	createTestBlock(t, dir, newCompacted, 5000, 8000, 3, ulid.MustNew(6, nil), ulid.MustNew(7, nil))
+
+	s := New(nil, nil, dir, bkt, lbls, metadata.TestSource, nil, true, true, block.UploadOptions{})
+	uploaded, err = s.Sync(ctx)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 1, uploaded)
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.metrics.pendingCompacted)))
+	testutil.Equals(t, 0, int(promtestutil.ToFloat64(s.metrics.uploadedCompacted)))
+
+	for id, exp := range map[ulid.ULID]bool{compacted: false, overlapping: false, newCompacted: true} {
+		ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		testutil.Ok(t, err)
+		testutil.Assert(t, exp == ok, "unexpected existence of block %s in the bucket", id)
+	}
+	shipMeta, err := ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{compacted, newCompacted}, shipMeta.Uploaded)
+
+	// Without allowing out of order uploads, the overlap stops the sync.
+	testutil.Ok(t, os.Remove(filepath.Join(dir, MetaFilename)))
+	testutil.Ok(t, block.Delete(ctx, log.NewNopLogger(), bkt, newCompacted))
+	uploaded, err = New(nil, nil, dir, bkt, lbls, metadata.TestSource, nil, true, false, block.UploadOptions{}).Sync(ctx)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 0, uploaded)
+
+	// Once the overlapping block is removed, the migration is done.
+	testutil.Ok(t, os.RemoveAll(path.Join(dir, overlapping.String())))
+	uploaded, err = s.Sync(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, uploaded)
+	testutil.Equals(t, 0, int(promtestutil.ToFloat64(s.metrics.pendingCompacted)))
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.metrics.uploadedCompacted)))
 }
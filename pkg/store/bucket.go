@@ -26,6 +26,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	promgate "github.com/prometheus/prometheus/pkg/gate"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/prometheus/tsdb/chunks"
@@ -84,6 +85,10 @@ const (
 
 	partitionerMaxGapSize = 512 * 1024
 
+	// lazyPostingsEstimatedSeriesSize is the estimated size of a series entry in the index, used to compare the cost
+	// of fetching postings with the cost of fetching the series they could filter out.
+	lazyPostingsEstimatedSeriesSize = 64
+
 	// Labels for metrics.
 	labelEncode = "encode"
 	labelDecode = "decode"
@@ -113,8 +118,32 @@ type bucketStoreMetrics struct {
 	cachedPostingsOriginalSizeBytes      prometheus.Counter
 	cachedPostingsCompressedSizeBytes    prometheus.Counter
 
-	seriesFetchDuration   prometheus.Histogram
-	postingsFetchDuration prometheus.Histogram
+	seriesFetchDuration                prometheus.Histogram
+	postingsFetchDuration              prometheus.Histogram
+	expandedPostingsDuration           prometheus.Histogram
+	chunksFetchDuration                prometheus.Histogram
+	getRangeGateDuration               prometheus.Histogram
+	lazyExpandedPostingGroups          prometheus.Counter
+	lazyExpandedPostingsFilteredSeries prometheus.Counter
+}
+
+// registerPoolMetrics registers the metrics of the utilization of the given pool of the store.
+func registerPoolMetrics(reg prometheus.Registerer, name string, p *pool.BucketedBytesPool) {
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "thanos_bucket_store_pool_used_bytes",
+		Help:        "Number of bytes of the pool in use by the requests being served.",
+		ConstLabels: prometheus.Labels{"pool": name},
+	}, func() float64 { return float64(p.UsedBytes()) })
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "thanos_bucket_store_pool_max_bytes",
+		Help:        "Maximum number of bytes of the pool in use at a time, 0 if not limited.",
+		ConstLabels: prometheus.Labels{"pool": name},
+	}, func() float64 { return float64(p.MaxBytes()) })
+	promauto.With(reg).NewCounterFunc(prometheus.CounterOpts{
+		Name:        "thanos_bucket_store_pool_exhausted_total",
+		Help:        "Total number of requests for bytes the pool could not satisfy without exceeding its maximum size, failing their Series call.",
+		ConstLabels: prometheus.Labels{"pool": name},
+	}, func() float64 { return float64(p.Exhausted()) })
 }
 
 func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
@@ -188,7 +217,7 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 
 	m.queriesDropped = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_bucket_store_queries_dropped_total",
-		Help: "Number of queries that were dropped due to the sample limit.",
+		Help: "Number of queries that were dropped due to the sample or chunk bytes limit.",
 	})
 	m.seriesRefetches = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_bucket_store_series_refetches_total",
@@ -237,6 +266,33 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
 	})
 
+	m.expandedPostingsDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "thanos_bucket_store_expanded_postings_duration_seconds",
+		Help:    "The time it takes to fetch and intersect the postings of a block matching a request sent to a store gateway.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
+	})
+
+	m.chunksFetchDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "thanos_bucket_store_chunks_fetch_duration_seconds",
+		Help:    "The time it takes to fetch the chunks of a block from storage to respond to a request sent to a store gateway.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
+	})
+
+	m.getRangeGateDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "thanos_bucket_store_series_get_range_gate_duration_seconds",
+		Help:    "How many seconds it took for GetRange calls to wait at the per request gate limiting concurrent GetRange calls.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
+	})
+
+	m.lazyExpandedPostingGroups = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_lazy_expanded_posting_groups_total",
+		Help: "Total number of posting groups, which postings were not fetched but matched against series labels instead due to lazy expanded postings.",
+	})
+	m.lazyExpandedPostingsFilteredSeries = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_lazy_expanded_postings_filtered_series_total",
+		Help: "Total number of series fetched and filtered out by matchers of posting groups which were not fetched due to lazy expanded postings.",
+	})
+
 	return &m
 }
 
@@ -256,6 +312,8 @@ type BucketStore struct {
 	indexCache      storecache.IndexCache
 	indexReaderPool *indexheader.ReaderPool
 	chunkPool       pool.BytesPool
+	// seriesPool holds the buffers the series of the index are read into.
+	seriesPool pool.BytesPool
 
 	// Sets of blocks that have the same labels. They are indexed by a hash over their label set.
 	mtx       sync.RWMutex
@@ -272,7 +330,9 @@ type BucketStore struct {
 
 	// chunksLimiterFactory creates a new limiter used to limit the number of chunks fetched by each Series() call.
 	chunksLimiterFactory ChunksLimiterFactory
-	partitioner          partitioner
+	// bytesLimiterFactory creates a new limiter used to limit the size of chunks fetched by each Series() call.
+	bytesLimiterFactory BytesLimiterFactory
+	partitioner         partitioner
 
 	filterConfig             *FilterConfig
 	advLabelSets             []labelpb.ZLabelSet
@@ -286,6 +346,19 @@ type BucketStore struct {
 
 	// Enables hints in the Series() response.
 	enableSeriesResponseHints bool
+
+	// Enables merging of overlapping chunks of a series into chunks with a single copy of samples.
+	enableChunkDedup bool
+
+	// seriesGetRangeConcurrency limits the number of concurrent GetRange calls of a single Series() call. Unlimited if 0.
+	seriesGetRangeConcurrency int
+
+	// Skips fetching postings that are too large compared to the series they could filter out, and
+	// matches the series labels instead.
+	enableLazyExpandedPostings bool
+
+	// postingsBatchSize is the number of postings whose series are fetched together. All at once if 0.
+	postingsBatchSize int
 }
 
 // NewBucketStore creates a new bucket backed store that implements the store API against
@@ -299,7 +372,9 @@ func NewBucketStore(
 	indexCache storecache.IndexCache,
 	queryGate gate.Gate,
 	maxChunkPoolBytes uint64,
+	maxSeriesPoolBytes uint64,
 	chunksLimiterFactory ChunksLimiterFactory,
+	bytesLimiterFactory BytesLimiterFactory,
 	debugLogging bool,
 	blockSyncConcurrency int,
 	filterConfig *FilterConfig,
@@ -309,6 +384,14 @@ func NewBucketStore(
 	enableSeriesResponseHints bool, // TODO(pracucci) Thanos 0.12 and below doesn't gracefully handle new fields in SeriesResponse. Drop this flag and always enable hints once we can drop backward compatibility.
 	lazyIndexReaderEnabled bool,
 	lazyIndexReaderIdleTimeout time.Duration,
+	lazyIndexReaderMaxLoaded int,
+	lazyIndexReaderMaxLoadedBytes int64,
+	indexHeaderStateCacheEnabled bool,
+	enableChunkDedup bool,
+	seriesGetRangeConcurrency int,
+	getRangeMaxGapSize uint64,
+	enableLazyExpandedPostings bool,
+	postingsBatchSize int,
 ) (*BucketStore, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -318,6 +401,12 @@ func NewBucketStore(
 	if err != nil {
 		return nil, errors.Wrap(err, "create chunk pool")
 	}
+	seriesPool, err := pool.NewBucketedBytesPool(maxSeriesSize, 50e6, 2, maxSeriesPoolBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "create series pool")
+	}
+	registerPoolMetrics(reg, "chunk", chunkPool)
+	registerPoolMetrics(reg, "series", seriesPool)
 
 	s := &BucketStore{
 		logger:                      logger,
@@ -325,8 +414,9 @@ func NewBucketStore(
 		fetcher:                     fetcher,
 		dir:                         dir,
 		indexCache:                  indexCache,
-		indexReaderPool:             indexheader.NewReaderPool(logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, extprom.WrapRegistererWithPrefix("thanos_bucket_store_", reg)),
+		indexReaderPool:             indexheader.NewReaderPool(logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, lazyIndexReaderMaxLoaded, lazyIndexReaderMaxLoadedBytes, indexHeaderStateCacheEnabled, extprom.WrapRegistererWithPrefix("thanos_bucket_store_", reg)),
 		chunkPool:                   chunkPool,
+		seriesPool:                  seriesPool,
 		blocks:                      map[ulid.ULID]*bucketBlock{},
 		blockSets:                   map[uint64]*bucketBlockSet{},
 		debugLogging:                debugLogging,
@@ -334,11 +424,16 @@ func NewBucketStore(
 		filterConfig:                filterConfig,
 		queryGate:                   queryGate,
 		chunksLimiterFactory:        chunksLimiterFactory,
-		partitioner:                 gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
+		bytesLimiterFactory:         bytesLimiterFactory,
+		partitioner:                 gapBasedPartitioner{maxGapSize: getRangeMaxGapSize},
 		enableCompatibilityLabel:    enableCompatibilityLabel,
 		enablePostingsCompression:   enablePostingsCompression,
 		postingOffsetsInMemSampling: postingOffsetsInMemSampling,
 		enableSeriesResponseHints:   enableSeriesResponseHints,
+		enableChunkDedup:            enableChunkDedup,
+		seriesGetRangeConcurrency:   seriesGetRangeConcurrency,
+		enableLazyExpandedPostings:  enableLazyExpandedPostings,
+		postingsBatchSize:           postingsBatchSize,
 		metrics:                     newBucketStoreMetrics(reg),
 	}
 
@@ -517,9 +612,12 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		dir,
 		s.indexCache,
 		s.chunkPool,
+		s.seriesPool,
 		indexHeaderReader,
 		s.partitioner,
 		s.enablePostingsCompression,
+		s.enableLazyExpandedPostings,
+		s.postingsBatchSize,
 	)
 	if err != nil {
 		return errors.Wrap(err, "new bucket block")
@@ -599,9 +697,10 @@ func (s *BucketStore) TimeRange() (mint, maxt int64) {
 func (s *BucketStore) Info(context.Context, *storepb.InfoRequest) (*storepb.InfoResponse, error) {
 	mint, maxt := s.TimeRange()
 	res := &storepb.InfoResponse{
-		StoreType: component.Store.ToProto(),
-		MinTime:   mint,
-		MaxTime:   maxt,
+		StoreType:     component.Store.ToProto(),
+		MinTime:       mint,
+		MaxTime:       maxt,
+		LabelMatchers: true,
 	}
 
 	s.mtx.RLock()
@@ -687,7 +786,7 @@ func blockSeries(
 	req *storepb.SeriesRequest,
 	chunksLimiter ChunksLimiter,
 ) (storepb.SeriesSet, *queryStats, error) {
-	ps, err := indexr.ExpandedPostings(matchers)
+	ps, lazyMatchers, err := indexr.expandedPostings(matchers, indexr.block.enableLazyExpandedPostings)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "expanded matching posting")
 	}
@@ -696,11 +795,9 @@ func blockSeries(
 		return storepb.EmptySeriesSet(), indexr.stats, nil
 	}
 
-	// Preload all series index data.
-	// TODO(bwplotka): Consider not keeping all series in memory all the time.
-	// TODO(bwplotka): Do lazy loading in one step as `ExpandingPostings` method.
-	if err := indexr.PreloadSeries(ps); err != nil {
-		return nil, nil, errors.Wrap(err, "preload series")
+	batchSize := indexr.block.postingsBatchSize
+	if batchSize <= 0 {
+		batchSize = len(ps)
 	}
 
 	// Transform all series into the response types and mark their relevant chunks
@@ -710,12 +807,46 @@ func blockSeries(
 		lset labels.Labels
 		chks []chunks.Meta
 	)
-	for _, id := range ps {
-		if err := indexr.LoadedSeries(id, &lset, &chks, req); err != nil {
-			return nil, nil, errors.Wrap(err, "read series")
+	for len(ps) > 0 {
+		batch := ps
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
 		}
-		if len(chks) > 0 {
+		ps = ps[len(batch):]
+
+		// Preload series index data of the batch, which is released once decoded.
+		// TODO(bwplotka): Do lazy loading in one step as `ExpandingPostings` method.
+		if err := indexr.PreloadSeries(batch); err != nil {
+			return nil, nil, errors.Wrap(err, "preload series")
+		}
+		for _, id := range batch {
+			if err := indexr.LoadedSeries(id, &lset, &chks, req); err != nil {
+				return nil, nil, errors.Wrap(err, "read series")
+			}
+			if !matchesLabels(lazyMatchers, lset) {
+				indexr.block.metrics.lazyExpandedPostingsFilteredSeries.Inc()
+				continue
+			}
+			if len(chks) == 0 {
+				continue
+			}
 			s := seriesEntry{lset: make(labels.Labels, 0, len(lset)+len(extLset))}
+			for _, l := range lset {
+				// Skip if the external labels of the block overrule the series' label.
+				// NOTE(fabxc): maybe move it to a prefixed version to still ensure uniqueness of series?
+				if extLset[l.Name] != "" {
+					continue
+				}
+				s.lset = append(s.lset, l)
+			}
+			for ln, lv := range extLset {
+				s.lset = append(s.lset, labels.Label{Name: ln, Value: lv})
+			}
+			sort.Sort(s.lset)
+			if !req.ShardInfo.Matches(s.lset) {
+				continue
+			}
+
 			if !req.SkipChunks {
 				s.refs = make([]uint64, 0, len(chks))
 				s.chks = make([]storepb.AggrChunk, 0, len(chks))
@@ -736,21 +867,9 @@ func blockSeries(
 				}
 			}
 
-			for _, l := range lset {
-				// Skip if the external labels of the block overrule the series' label.
-				// NOTE(fabxc): maybe move it to a prefixed version to still ensure uniqueness of series?
-				if extLset[l.Name] != "" {
-					continue
-				}
-				s.lset = append(s.lset, l)
-			}
-			for ln, lv := range extLset {
-				s.lset = append(s.lset, labels.Label{Name: ln, Value: lv})
-			}
-			sort.Sort(s.lset)
-
 			res = append(res, s)
 		}
+		indexr.releaseLoadedSeries()
 	}
 
 	if req.SkipChunks {
@@ -778,6 +897,16 @@ func blockSeries(
 	return newBucketSeriesSet(res), indexr.stats.merge(chunkr.stats), nil
 }
 
+// matchesLabels returns true if all the matchers match the labels.
+func matchesLabels(ms []*labels.Matcher, lset labels.Labels) bool {
+	for _, m := range ms {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
 func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Aggr) error {
 	if in.Encoding() == chunkenc.EncXOR {
 		out.Raw = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: in.Bytes()}
@@ -889,9 +1018,17 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		g, gctx          = errgroup.WithContext(ctx)
 		resHints         = &hintspb.SeriesResponseHints{}
 		reqBlockMatchers []*labels.Matcher
+		enableQueryStats bool
 		chunksLimiter    = s.chunksLimiterFactory(s.metrics.queriesDropped)
+		bytesLimiter     = s.bytesLimiterFactory(s.metrics.queriesDropped)
+		getRangeGate     = gate.NewNoop()
 	)
 
+	if s.seriesGetRangeConcurrency > 0 {
+		// GetRange calls of all the blocks queried by the request share the same limit.
+		getRangeGate = gate.InstrumentGateDuration(s.metrics.getRangeGateDuration, promgate.New(s.seriesGetRangeConcurrency))
+	}
+
 	if req.Hints != nil {
 		reqHints := &hintspb.SeriesRequestHints{}
 		if err := types.UnmarshalAny(req.Hints, reqHints); err != nil {
@@ -902,6 +1039,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		if err != nil {
 			return status.Error(codes.InvalidArgument, errors.Wrap(err, "translate request hints labels matchers").Error())
 		}
+		enableQueryStats = reqHints.EnableQueryStats
 	}
 
 	s.mtx.RLock()
@@ -921,16 +1059,16 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		for _, b := range blocks {
 			b := b
 
-			if s.enableSeriesResponseHints {
+			if s.enableSeriesResponseHints || enableQueryStats {
 				// Keep track of queried blocks.
-				resHints.AddQueriedBlock(b.meta.ULID)
+				resHints.AddQueriedBlock(b.meta.ULID, b.meta.MinTime, b.meta.MaxTime, b.meta.Thanos.Downsample.Resolution)
 			}
 
 			var chunkr *bucketChunkReader
 			// We must keep the readers open until all their data has been sent.
-			indexr := b.indexReader(gctx)
+			indexr := b.indexReader(gctx, getRangeGate)
 			if !req.SkipChunks {
-				chunkr = b.chunkReader(gctx)
+				chunkr = b.chunkReader(gctx, bytesLimiter, getRangeGate)
 				defer runutil.CloseWithLogOnErr(s.logger, chunkr, "series block")
 			}
 
@@ -1021,6 +1159,13 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 			} else {
 				lset, series.Chunks = set.At()
 
+				if s.enableChunkDedup {
+					// Overlapping blocks, e.g. not vertically compacted yet, may contain the same samples.
+					if series.Chunks, err = dedupOverlappingChunks(series.Chunks); err != nil {
+						err = status.Error(codes.Unknown, errors.Wrap(err, "deduplicate chunks").Error())
+						return
+					}
+				}
 				stats.mergedChunksCount += len(series.Chunks)
 				s.metrics.chunkSizeBytes.Observe(float64(chunksSize(series.Chunks)))
 			}
@@ -1040,9 +1185,13 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		err = nil
 	})
 
-	if s.enableSeriesResponseHints {
+	if s.enableSeriesResponseHints || enableQueryStats {
 		var anyHints *types.Any
 
+		if enableQueryStats {
+			resHints.QueryStats = stats.toHints()
+		}
+
 		if anyHints, err = types.MarshalAny(resHints); err != nil {
 			err = status.Error(codes.Unknown, errors.Wrap(err, "marshal series response hints").Error())
 			return
@@ -1066,6 +1215,11 @@ func chunksSize(chks []storepb.AggrChunk) (size int) {
 
 // LabelNames implements the storepb.StoreServer interface.
 func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+	reqMatchers, err := storepb.TranslateFromPromMatchers(req.Matchers...)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	g, gctx := errgroup.WithContext(ctx)
 
 	s.mtx.RLock()
@@ -1077,14 +1231,35 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 		if !b.overlapsClosedInterval(req.Start, req.End) {
 			continue
 		}
-		indexr := b.indexReader(gctx)
+		blockMatchers, ok := b.labelMatchers(reqMatchers...)
+		if !ok {
+			continue
+		}
+		indexr := b.indexReader(gctx, gate.NewNoop())
 		g.Go(func() error {
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label names")
 
-			// Do it via index reader to have pending reader registered correctly.
-			res, err := indexr.block.indexHeaderReader.LabelNames()
-			if err != nil {
-				return errors.Wrap(err, "label names")
+			var res []string
+			if len(blockMatchers) == 0 {
+				// Do it via index reader to have pending reader registered correctly.
+				names, err := indexr.block.indexHeaderReader.LabelNames()
+				if err != nil {
+					return errors.Wrap(err, "label names")
+				}
+				res = names
+			} else {
+				// The label names are gathered from the series matching the postings of the matchers.
+				lsets, err := blockSeriesLabels(indexr, blockMatchers, req.Start, req.End)
+				if err != nil {
+					return errors.Wrap(err, "label names of matching series")
+				}
+				names := map[string]struct{}{}
+				for _, lset := range lsets {
+					for _, l := range lset {
+						names[l.Name] = struct{}{}
+					}
+				}
+				res = sortedKeys(names)
 			}
 
 			sort.Strings(res)
@@ -1109,6 +1284,11 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 
 // LabelValues implements the storepb.StoreServer interface.
 func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	reqMatchers, err := storepb.TranslateFromPromMatchers(req.Matchers...)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	g, gctx := errgroup.WithContext(ctx)
 
 	s.mtx.RLock()
@@ -1120,14 +1300,33 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 		if !b.overlapsClosedInterval(req.Start, req.End) {
 			continue
 		}
-		indexr := b.indexReader(gctx)
+		blockMatchers, ok := b.labelMatchers(reqMatchers...)
+		if !ok {
+			continue
+		}
+		indexr := b.indexReader(gctx, gate.NewNoop())
 		g.Go(func() error {
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label values")
 
-			// Do it via index reader to have pending reader registered correctly.
-			res, err := indexr.block.indexHeaderReader.LabelValues(req.Label)
-			if err != nil {
-				return errors.Wrap(err, "index header label values")
+			var res []string
+			if len(blockMatchers) == 0 {
+				// Do it via index reader to have pending reader registered correctly.
+				values, err := indexr.block.indexHeaderReader.LabelValues(req.Label)
+				if err != nil {
+					return errors.Wrap(err, "index header label values")
+				}
+				res = values
+			} else {
+				// Only the series having the label are selected.
+				lsets, err := blockSeriesLabels(indexr, append(blockMatchers, labels.MustNewMatcher(labels.MatchNotEqual, req.Label, "")), req.Start, req.End)
+				if err != nil {
+					return errors.Wrap(err, "label values of matching series")
+				}
+				values := map[string]struct{}{}
+				for _, lset := range lsets {
+					values[lset.Get(req.Label)] = struct{}{}
+				}
+				res = sortedKeys(values)
 			}
 
 			mtx.Lock()
@@ -1148,6 +1347,21 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	}, nil
 }
 
+// blockSeriesLabels returns the label sets of the series of the block matching the given matchers and having chunks
+// between mint and maxt. The external labels of the block are not added.
+func blockSeriesLabels(indexr *bucketIndexReader, matchers []*labels.Matcher, mint, maxt int64) ([]labels.Labels, error) {
+	set, _, err := blockSeries(nil, indexr, nil, matchers, &storepb.SeriesRequest{MinTime: mint, MaxTime: maxt, SkipChunks: true}, NewChunksLimiterFactory(0)(nil))
+	if err != nil {
+		return nil, err
+	}
+	var res []labels.Labels
+	for set.Next() {
+		lset, _ := set.At()
+		res = append(res, lset)
+	}
+	return res, set.Err()
+}
+
 // bucketBlockSet holds all blocks of an equal label set. It internally splits
 // them up by downsampling resolution and allows querying.
 type bucketBlockSet struct {
@@ -1157,8 +1371,8 @@ type bucketBlockSet struct {
 	blocks      [][]*bucketBlock // Ordered buckets for the existing resolutions.
 }
 
-// newBucketBlockSet initializes a new set with the known downsampling windows hard-configured.
-// The set currently does not support arbitrary ranges.
+// newBucketBlockSet initializes a new set with the standard downsampling windows. Blocks of additional
+// downsampling resolutions are supported as well, their resolution is registered once a block is added.
 func newBucketBlockSet(lset labels.Labels) *bucketBlockSet {
 	return &bucketBlockSet{
 		labels:      lset,
@@ -1174,9 +1388,16 @@ func (s *bucketBlockSet) add(b *bucketBlock) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	i := int64index(s.resolutions, b.meta.Thanos.Downsample.Resolution)
+	res := b.meta.Thanos.Downsample.Resolution
+	if res < 0 {
+		return errors.Errorf("unsupported downsampling resolution %d", res)
+	}
+	i := int64index(s.resolutions, res)
 	if i < 0 {
-		return errors.Errorf("unsupported downsampling resolution %d", b.meta.Thanos.Downsample.Resolution)
+		// Keep resolutions ordered from high to low.
+		i = sort.Search(len(s.resolutions), func(j int) bool { return s.resolutions[j] < res })
+		s.resolutions = append(s.resolutions[:i], append([]int64{res}, s.resolutions[i:]...)...)
+		s.blocks = append(s.blocks[:i], append([][]*bucketBlock{nil}, s.blocks[i:]...)...)
 	}
 	bs := append(s.blocks[i], b)
 	s.blocks[i] = bs
@@ -1283,6 +1504,23 @@ func (s *bucketBlockSet) labelMatchers(matchers ...*labels.Matcher) ([]*labels.M
 	return res, true
 }
 
+// labelMatchers returns the given matchers without the ones on the external labels of the block, or false if
+// the external labels do not match.
+func (b *bucketBlock) labelMatchers(matchers ...*labels.Matcher) ([]*labels.Matcher, bool) {
+	res := make([]*labels.Matcher, 0, len(matchers))
+	for _, m := range matchers {
+		v, ok := b.meta.Thanos.Labels[m.Name]
+		if !ok {
+			res = append(res, m)
+			continue
+		}
+		if !m.Matches(v) {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
 // bucketBlock represents a block that is located in a bucket. It holds intermediate
 // state for the block on local disk.
 type bucketBlock struct {
@@ -1293,6 +1531,7 @@ type bucketBlock struct {
 	dir        string
 	indexCache storecache.IndexCache
 	chunkPool  pool.BytesPool
+	seriesPool pool.BytesPool
 
 	indexHeaderReader indexheader.Reader
 
@@ -1302,7 +1541,9 @@ type bucketBlock struct {
 
 	partitioner partitioner
 
-	enablePostingsCompression bool
+	enablePostingsCompression  bool
+	enableLazyExpandedPostings bool
+	postingsBatchSize          int
 
 	// Block's labels used by block-level matchers to filter blocks to query. These are used to select blocks using
 	// request hints' BlockMatchers.
@@ -1318,21 +1559,27 @@ func newBucketBlock(
 	dir string,
 	indexCache storecache.IndexCache,
 	chunkPool pool.BytesPool,
+	seriesPool pool.BytesPool,
 	indexHeadReader indexheader.Reader,
 	p partitioner,
 	enablePostingsCompression bool,
+	enableLazyExpandedPostings bool,
+	postingsBatchSize int,
 ) (b *bucketBlock, err error) {
 	b = &bucketBlock{
-		logger:                    logger,
-		metrics:                   metrics,
-		bkt:                       bkt,
-		indexCache:                indexCache,
-		chunkPool:                 chunkPool,
-		dir:                       dir,
-		partitioner:               p,
-		meta:                      meta,
-		indexHeaderReader:         indexHeadReader,
-		enablePostingsCompression: enablePostingsCompression,
+		logger:                     logger,
+		metrics:                    metrics,
+		bkt:                        bkt,
+		indexCache:                 indexCache,
+		chunkPool:                  chunkPool,
+		seriesPool:                 seriesPool,
+		dir:                        dir,
+		partitioner:                p,
+		meta:                       meta,
+		indexHeaderReader:          indexHeadReader,
+		enablePostingsCompression:  enablePostingsCompression,
+		enableLazyExpandedPostings: enableLazyExpandedPostings,
+		postingsBatchSize:          postingsBatchSize,
 	}
 
 	// Translate the block's labels and inject the block ID as a label
@@ -1385,6 +1632,31 @@ func (b *bucketBlock) readIndexRange(ctx context.Context, off, length int64) ([]
 	return buf.Bytes(), nil
 }
 
+// readSeriesRange reads the range of the block's index holding series into a buffer of the series pool, which has
+// to be put back into the pool once the series are not used anymore.
+func (b *bucketBlock) readSeriesRange(ctx context.Context, off, length int64) (*[]byte, error) {
+	// The buffer capacity is increased by MinRead to avoid extra allocations due to how ReadFrom() internally works.
+	c, err := b.seriesPool.Get(int(length) + bytes.MinRead)
+	if err != nil {
+		return nil, errors.Wrap(err, "allocate series bytes")
+	}
+
+	r, err := b.bkt.GetRange(ctx, b.indexFilename(), off, length)
+	if err != nil {
+		b.seriesPool.Put(c)
+		return nil, errors.Wrap(err, "get range reader")
+	}
+	defer runutil.CloseWithLogOnErr(b.logger, r, "readSeriesRange close range reader")
+
+	buf := bytes.NewBuffer(*c)
+	if _, err := buf.ReadFrom(r); err != nil {
+		b.seriesPool.Put(c)
+		return nil, errors.Wrap(err, "read range")
+	}
+	internalBuf := buf.Bytes()
+	return &internalBuf, nil
+}
+
 func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length int64) (*[]byte, error) {
 	c, err := b.chunkPool.Get(int(length))
 	if err != nil {
@@ -1412,14 +1684,14 @@ func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length i
 	return &internalBuf, nil
 }
 
-func (b *bucketBlock) indexReader(ctx context.Context) *bucketIndexReader {
+func (b *bucketBlock) indexReader(ctx context.Context, getRangeGate gate.Gate) *bucketIndexReader {
 	b.pendingReaders.Add(1)
-	return newBucketIndexReader(ctx, b)
+	return newBucketIndexReader(ctx, b, getRangeGate)
 }
 
-func (b *bucketBlock) chunkReader(ctx context.Context) *bucketChunkReader {
+func (b *bucketBlock) chunkReader(ctx context.Context, bytesLimiter BytesLimiter, getRangeGate gate.Gate) *bucketChunkReader {
 	b.pendingReaders.Add(1)
-	return newBucketChunkReader(ctx, b)
+	return newBucketChunkReader(ctx, b, bytesLimiter, getRangeGate)
 }
 
 // matchRelabelLabels verifies whether the block matches the given matchers.
@@ -1453,11 +1725,16 @@ type bucketIndexReader struct {
 	dec   *index.Decoder
 	stats *queryStats
 
+	// getRangeGate limits the concurrent GetRange calls of the request.
+	getRangeGate gate.Gate
+
 	mtx          sync.Mutex
 	loadedSeries map[uint64][]byte
+	// seriesBytes are the buffers of the series pool holding loadedSeries.
+	seriesBytes []*[]byte
 }
 
-func newBucketIndexReader(ctx context.Context, block *bucketBlock) *bucketIndexReader {
+func newBucketIndexReader(ctx context.Context, block *bucketBlock, getRangeGate gate.Gate) *bucketIndexReader {
 	r := &bucketIndexReader{
 		ctx:   ctx,
 		block: block,
@@ -1465,11 +1742,40 @@ func newBucketIndexReader(ctx context.Context, block *bucketBlock) *bucketIndexR
 			LookupSymbol: block.indexHeaderReader.LookupSymbol,
 		},
 		stats:        &queryStats{},
+		getRangeGate: getRangeGate,
 		loadedSeries: map[uint64][]byte{},
 	}
 	return r
 }
 
+// readIndexRange reads the range of the block's index, waiting for its turn at the request's GetRange gate.
+func (r *bucketIndexReader) readIndexRange(ctx context.Context, off, length int64) ([]byte, error) {
+	if err := r.getRangeGate.Start(ctx); err != nil {
+		return nil, errors.Wrap(err, "wait for get range turn")
+	}
+	defer r.getRangeGate.Done()
+
+	return r.block.readIndexRange(ctx, off, length)
+}
+
+// readSeriesRange reads the range of the block's index holding series, waiting for its turn at the request's GetRange
+// gate. The buffer is put back into the series pool when the reader is closed.
+func (r *bucketIndexReader) readSeriesRange(ctx context.Context, off, length int64) ([]byte, error) {
+	if err := r.getRangeGate.Start(ctx); err != nil {
+		return nil, errors.Wrap(err, "wait for get range turn")
+	}
+	defer r.getRangeGate.Done()
+
+	b, err := r.block.readSeriesRange(ctx, off, length)
+	if err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	r.seriesBytes = append(r.seriesBytes, b)
+	r.mtx.Unlock()
+	return *b, nil
+}
+
 // ExpandedPostings returns postings in expanded list instead of index.Postings.
 // This is because we need to have them buffered anyway to perform efficient lookup
 // on object storage.
@@ -1480,8 +1786,20 @@ func newBucketIndexReader(ctx context.Context, block *bucketBlock) *bucketIndexR
 // chunk where the series contains the matching label-value pair for a given block of data. Postings can be fetched by
 // single label name=value.
 func (r *bucketIndexReader) ExpandedPostings(ms []*labels.Matcher) ([]uint64, error) {
+	ps, _, err := r.expandedPostings(ms, false)
+	return ps, err
+}
+
+// expandedPostings returns postings in expanded list, like ExpandedPostings. If lazy is true, postings of the posting
+// groups which are too large compared to the smallest one are not fetched. Matchers of these groups are returned
+// instead, so they can be matched against the labels of the fetched series.
+func (r *bucketIndexReader) expandedPostings(ms []*labels.Matcher, lazy bool) ([]uint64, []*labels.Matcher, error) {
+	timer := prometheus.NewTimer(r.block.metrics.expandedPostingsDuration)
+	defer timer.ObserveDuration()
+
 	var (
 		postingGroups []*postingGroup
+		lazyMatchers  []*labels.Matcher
 		allRequested  = false
 		hasAdds       = false
 		keys          []labels.Label
@@ -1492,17 +1810,33 @@ func (r *bucketIndexReader) ExpandedPostings(ms []*labels.Matcher) ([]uint64, er
 		// Each group is separate to tell later what postings are intersecting with what.
 		pg, err := toPostingGroup(r.block.indexHeaderReader.LabelValues, m)
 		if err != nil {
-			return nil, errors.Wrap(err, "toPostingGroup")
+			return nil, nil, errors.Wrap(err, "toPostingGroup")
 		}
 
 		// If this groups adds nothing, it's an empty group. We can shortcut this, since intersection with empty
 		// postings would return no postings anyway.
 		// E.g. label="non-existing-value" returns empty group.
 		if !pg.addAll && len(pg.addKeys) == 0 {
-			return nil, nil
+			return nil, nil, nil
 		}
 
+		pg.matcher = m
 		postingGroups = append(postingGroups, pg)
+	}
+
+	if len(postingGroups) == 0 {
+		return nil, nil, nil
+	}
+
+	if lazy {
+		var err error
+		if postingGroups, lazyMatchers, err = r.lazyPostingGroups(postingGroups); err != nil {
+			return nil, nil, errors.Wrap(err, "select lazy posting groups")
+		}
+		r.block.metrics.lazyExpandedPostingGroups.Add(float64(len(lazyMatchers)))
+	}
+
+	for _, pg := range postingGroups {
 		allRequested = allRequested || pg.addAll
 		hasAdds = hasAdds || len(pg.addKeys) > 0
 
@@ -1513,10 +1847,6 @@ func (r *bucketIndexReader) ExpandedPostings(ms []*labels.Matcher) ([]uint64, er
 		keys = append(keys, pg.removeKeys...)
 	}
 
-	if len(postingGroups) == 0 {
-		return nil, nil
-	}
-
 	// We only need special All postings if there are no other adds. If there are, we can skip fetching
 	// special All postings completely.
 	if allRequested && !hasAdds {
@@ -1530,7 +1860,7 @@ func (r *bucketIndexReader) ExpandedPostings(ms []*labels.Matcher) ([]uint64, er
 
 	fetchedPostings, err := r.fetchPostings(keys)
 	if err != nil {
-		return nil, errors.Wrap(err, "get postings")
+		return nil, nil, errors.Wrap(err, "get postings")
 	}
 
 	// Get "add" and "remove" postings from groups. We iterate over postingGroups and their keys
@@ -1561,14 +1891,14 @@ func (r *bucketIndexReader) ExpandedPostings(ms []*labels.Matcher) ([]uint64, er
 
 	ps, err := index.ExpandPostings(result)
 	if err != nil {
-		return nil, errors.Wrap(err, "expand")
+		return nil, nil, errors.Wrap(err, "expand")
 	}
 
 	// As of version two all series entries are 16 byte padded. All references
 	// we get have to account for that to get the correct offset.
 	version, err := r.block.indexHeaderReader.IndexVersion()
 	if err != nil {
-		return nil, errors.Wrap(err, "get index version")
+		return nil, nil, errors.Wrap(err, "get index version")
 	}
 	if version >= 2 {
 		for i, id := range ps {
@@ -1576,7 +1906,53 @@ func (r *bucketIndexReader) ExpandedPostings(ms []*labels.Matcher) ([]uint64, er
 		}
 	}
 
-	return ps, nil
+	return ps, lazyMatchers, nil
+}
+
+// lazyPostingGroups splits the posting groups into the ones which postings have to be fetched and the matchers of
+// the others. Intersecting with the postings of a group can't save more than fetching all the series matched by the
+// smallest adding group costs, so groups with postings larger than that are matched against the series labels instead.
+func (r *bucketIndexReader) lazyPostingGroups(groups []*postingGroup) ([]*postingGroup, []*labels.Matcher, error) {
+	sizes := make([]int64, len(groups))
+	minAddSize := int64(-1)
+	for i, g := range groups {
+		for _, keys := range [][]labels.Label{g.addKeys, g.removeKeys} {
+			for _, l := range keys {
+				rng, err := r.block.indexHeaderReader.PostingsOffset(l.Name, l.Value)
+				if err == indexheader.NotFoundRangeErr {
+					continue
+				}
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "index header PostingsOffset")
+				}
+				sizes[i] += rng.End - rng.Start
+			}
+		}
+		if !g.addAll && (minAddSize < 0 || sizes[i] < minAddSize) {
+			minAddSize = sizes[i]
+		}
+	}
+	// Without adding groups, all the series would have to be fetched.
+	if minAddSize < 0 {
+		return groups, nil, nil
+	}
+
+	// Each posting is a 4 bytes series reference.
+	maxSize := minAddSize / 4 * lazyPostingsEstimatedSeriesSize
+
+	var (
+		fetch        = make([]*postingGroup, 0, len(groups))
+		lazyMatchers []*labels.Matcher
+	)
+	for i, g := range groups {
+		// The smallest adding group is always fetched, as maxSize is never smaller.
+		if sizes[i] > maxSize {
+			lazyMatchers = append(lazyMatchers, g.matcher)
+			continue
+		}
+		fetch = append(fetch, g)
+	}
+	return fetch, lazyMatchers, nil
 }
 
 // postingGroup keeps posting keys for single matcher. Logical result of the group is:
@@ -1587,6 +1963,9 @@ type postingGroup struct {
 	addAll     bool
 	addKeys    []labels.Label
 	removeKeys []labels.Label
+
+	// matcher the group was created for.
+	matcher *labels.Matcher
 }
 
 func newPostingGroup(addAll bool, addKeys, removeKeys []labels.Label) *postingGroup {
@@ -1747,7 +2126,7 @@ func (r *bucketIndexReader) fetchPostings(keys []labels.Label) ([]index.Postings
 		g.Go(func() error {
 			begin := time.Now()
 
-			b, err := r.block.readIndexRange(ctx, start, length)
+			b, err := r.readIndexRange(ctx, start, length)
 			if err != nil {
 				return errors.Wrap(err, "read postings range")
 			}
@@ -1912,7 +2291,7 @@ func (r *bucketIndexReader) PreloadSeries(ids []uint64) error {
 func (r *bucketIndexReader) loadSeries(ctx context.Context, ids []uint64, refetch bool, start, end uint64) error {
 	begin := time.Now()
 
-	b, err := r.block.readIndexRange(ctx, int64(start), int64(end-start))
+	b, err := r.readSeriesRange(ctx, int64(start), int64(end-start))
 	if err != nil {
 		return errors.Wrap(err, "read series range")
 	}
@@ -1946,7 +2325,9 @@ func (r *bucketIndexReader) loadSeries(ctx context.Context, ids []uint64, refetc
 		c = c[n : n+int(l)]
 		r.mtx.Lock()
 		r.loadedSeries[id] = c
-		r.block.indexCache.StoreSeries(r.ctx, r.block.meta.ULID, id, c)
+		// The buffer is put back into the series pool once the series are decoded, while caches can keep the
+		// stored value, e.g. until it is sent asynchronously to memcached.
+		r.block.indexCache.StoreSeries(r.ctx, r.block.meta.ULID, id, append([]byte(nil), c...))
 		r.mtx.Unlock()
 	}
 	return nil
@@ -2018,9 +2399,24 @@ func (r *bucketIndexReader) LoadedSeries(ref uint64, lset *labels.Labels, chks *
 	return r.decodeSeriesWithReq(b, lset, chks, req)
 }
 
+// releaseLoadedSeries forgets the loaded series and puts the buffers holding them back into the series pool.
+// Decoded series do not reference the buffers, so it is safe once all the loaded series are decoded.
+func (r *bucketIndexReader) releaseLoadedSeries() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, b := range r.seriesBytes {
+		r.block.seriesPool.Put(b)
+	}
+	r.seriesBytes = nil
+	r.loadedSeries = map[uint64][]byte{}
+}
+
 // Close released the underlying resources of the reader.
 func (r *bucketIndexReader) Close() error {
 	r.block.pendingReaders.Done()
+
+	r.releaseLoadedSeries()
 	return nil
 }
 
@@ -2114,8 +2510,10 @@ func (r *bucketIndexReader) decodeSeriesWithReq(b []byte, lbls *labels.Labels, c
 }
 
 type bucketChunkReader struct {
-	ctx   context.Context
-	block *bucketBlock
+	ctx          context.Context
+	block        *bucketBlock
+	bytesLimiter BytesLimiter
+	getRangeGate gate.Gate
 
 	preloads [][]uint32
 
@@ -2127,13 +2525,15 @@ type bucketChunkReader struct {
 	chunkBytes []*[]byte // Byte slice to return to the chunk pool on close.
 }
 
-func newBucketChunkReader(ctx context.Context, block *bucketBlock) *bucketChunkReader {
+func newBucketChunkReader(ctx context.Context, block *bucketBlock, bytesLimiter BytesLimiter, getRangeGate gate.Gate) *bucketChunkReader {
 	return &bucketChunkReader{
-		ctx:      ctx,
-		block:    block,
-		stats:    &queryStats{},
-		preloads: make([][]uint32, len(block.chunkObjs)),
-		chunks:   map[uint64]chunkenc.Chunk{},
+		ctx:          ctx,
+		block:        block,
+		bytesLimiter: bytesLimiter,
+		getRangeGate: getRangeGate,
+		stats:        &queryStats{},
+		preloads:     make([][]uint32, len(block.chunkObjs)),
+		chunks:       map[uint64]chunkenc.Chunk{},
 	}
 }
 
@@ -2150,8 +2550,21 @@ func (r *bucketChunkReader) addPreload(id uint64) error {
 	return nil
 }
 
+// readChunkRange reads the range of the segment file, waiting for its turn at the request's GetRange gate.
+func (r *bucketChunkReader) readChunkRange(ctx context.Context, seq int, off, length int64) (*[]byte, error) {
+	if err := r.getRangeGate.Start(ctx); err != nil {
+		return nil, errors.Wrap(err, "wait for get range turn")
+	}
+	defer r.getRangeGate.Done()
+
+	return r.block.readChunkRange(ctx, seq, off, length)
+}
+
 // preload all added chunk IDs. Must be called before the first call to Chunk is made.
 func (r *bucketChunkReader) preload() error {
+	timer := prometheus.NewTimer(r.block.metrics.chunksFetchDuration)
+	defer timer.ObserveDuration()
+
 	g, ctx := errgroup.WithContext(r.ctx)
 
 	for seq, offsets := range r.preloads {
@@ -2182,7 +2595,12 @@ func (r *bucketChunkReader) preload() error {
 func (r *bucketChunkReader) loadChunks(ctx context.Context, offs []uint32, seq int, start, end uint32) error {
 	fetchBegin := time.Now()
 
-	b, err := r.block.readChunkRange(ctx, seq, int64(start), int64(end-start))
+	// Bytes are reserved before they are fetched, so a query exceeding the limit is aborted before allocating them.
+	if err := r.bytesLimiter.Reserve(uint64(end - start)); err != nil {
+		return errors.Wrap(err, "exceeded chunk bytes limit")
+	}
+
+	b, err := r.readChunkRange(ctx, seq, int64(start), int64(end-start))
 	if err != nil {
 		return errors.Wrapf(err, "read range for %d", seq)
 	}
@@ -2227,8 +2645,12 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, offs []uint32, seq i
 
 		fetchBegin = time.Now()
 
+		if err := r.bytesLimiter.Reserve(uint64(chLen)); err != nil {
+			return errors.Wrap(err, "exceeded chunk bytes limit")
+		}
+
 		// Read entire chunk into new buffer.
-		nb, err := r.block.readChunkRange(ctx, seq, int64(o), int64(chLen))
+		nb, err := r.readChunkRange(ctx, seq, int64(o), int64(chLen))
 		if err != nil {
 			return errors.Wrapf(err, "preloaded chunk too small, expecting %d, and failed to fetch full chunk", chLen)
 		}
@@ -2338,6 +2760,39 @@ type queryStats struct {
 	mergeDuration     time.Duration
 }
 
+// toHints returns the stats as series response hints.
+func (s queryStats) toHints() *hintspb.QueryStats {
+	return &hintspb.QueryStats{
+		BlocksQueried:     int64(s.blocksQueried),
+		MergedSeriesCount: int64(s.mergedSeriesCount),
+		MergedChunksCount: int64(s.mergedChunksCount),
+
+		PostingsTouched:        int64(s.postingsTouched),
+		PostingsTouchedSizeSum: int64(s.postingsTouchedSizeSum),
+		PostingsToFetch:        int64(s.postingsToFetch),
+		PostingsFetched:        int64(s.postingsFetched),
+		PostingsFetchedSizeSum: int64(s.postingsFetchedSizeSum),
+		PostingsFetchCount:     int64(s.postingsFetchCount),
+
+		SeriesTouched:        int64(s.seriesTouched),
+		SeriesTouchedSizeSum: int64(s.seriesTouchedSizeSum),
+		SeriesFetched:        int64(s.seriesFetched),
+		SeriesFetchedSizeSum: int64(s.seriesFetchedSizeSum),
+		SeriesFetchCount:     int64(s.seriesFetchCount),
+
+		ChunksTouched:        int64(s.chunksTouched),
+		ChunksTouchedSizeSum: int64(s.chunksTouchedSizeSum),
+		ChunksFetched:        int64(s.chunksFetched),
+		ChunksFetchedSizeSum: int64(s.chunksFetchedSizeSum),
+		ChunksFetchCount:     int64(s.chunksFetchCount),
+
+		DataDownloadedSizeSum: int64(s.postingsFetchedSizeSum + s.seriesFetchedSizeSum + s.chunksFetchedSizeSum),
+
+		GetAllDuration: s.getAllDuration,
+		MergeDuration:  s.mergeDuration,
+	}
+}
+
 func (s queryStats) merge(o *queryStats) *queryStats {
 	s.blocksQueried += o.blocksQueried
 
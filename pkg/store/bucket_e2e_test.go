@@ -13,11 +13,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/kit/log"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/relabel"
 	"github.com/prometheus/prometheus/pkg/timestamp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/model"
@@ -163,7 +167,9 @@ func prepareStoreWithTestBlocks(t testing.TB, dir string, bkt objstore.Bucket, m
 		s.cache,
 		nil,
 		0,
+		0,
 		NewChunksLimiterFactory(maxChunksLimit),
+		NewBytesLimiterFactory(0),
 		false,
 		20,
 		filterConf,
@@ -173,6 +179,14 @@ func prepareStoreWithTestBlocks(t testing.TB, dir string, bkt objstore.Bucket, m
 		true,
 		true,
 		time.Minute,
+		0,
+		0,
+		false,
+		false,
+		0,
+		partitionerMaxGapSize,
+		false,
+		0,
 	)
 	testutil.Ok(t, err)
 	defer func() { testutil.Ok(t, store.Close()) }()
@@ -502,6 +516,46 @@ func TestBucketStore_ManyParts_e2e(t *testing.T) {
 	})
 }
 
+func TestBucketStore_LimitedGetRangeConcurrency_e2e(t *testing.T) {
+	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dir, err := ioutil.TempDir("", "test_bucketstore_e2e")
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+		// Many parts make many concurrent GetRange calls for each block.
+		s := prepareStoreWithTestBlocks(t, dir, bkt, true, 0, emptyRelabelConfig, allowAllFilterConf)
+		s.store.seriesGetRangeConcurrency = 2
+		for _, b := range s.store.blocks {
+			b.enableLazyExpandedPostings = true
+		}
+		s.cache.SwapWith(noopCache{})
+
+		testBucketStore_e2e(t, ctx, s)
+	})
+}
+
+func TestBucketStore_PostingsBatches_e2e(t *testing.T) {
+	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dir, err := ioutil.TempDir("", "test_bucketstore_e2e")
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+		s := prepareStoreWithTestBlocks(t, dir, bkt, false, 0, emptyRelabelConfig, allowAllFilterConf)
+		for _, b := range s.store.blocks {
+			b.postingsBatchSize = 1
+		}
+		s.cache.SwapWith(noopCache{})
+
+		testBucketStore_e2e(t, ctx, s)
+	})
+}
+
 func TestBucketStore_TimePartitioning_e2e(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -609,6 +663,57 @@ func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	}
 }
 
+func TestBucketStore_Series_BytesLimiter_e2e(t *testing.T) {
+	cases := map[string]struct {
+		maxChunksBytes units.Base2Bytes
+		expectedErr    string
+	}{
+		"should succeed if the max chunk bytes limit is not exceeded": {
+			maxChunksBytes: 10 * units.MiB,
+		},
+		"should fail if the max chunk bytes limit is exceeded": {
+			maxChunksBytes: 1,
+			expectedErr:    "exceeded chunk bytes limit",
+		},
+	}
+
+	for testName, testData := range cases {
+		t.Run(testName, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			bkt := objstore.NewInMemBucket()
+
+			dir, err := ioutil.TempDir("", "test_bucket_bytes_limiter_e2e")
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+			s := prepareStoreWithTestBlocks(t, dir, bkt, false, 0, emptyRelabelConfig, allowAllFilterConf)
+			s.store.bytesLimiterFactory = NewBytesLimiterFactory(testData.maxChunksBytes)
+			testutil.Ok(t, s.store.SyncBlocks(ctx))
+
+			req := &storepb.SeriesRequest{
+				Matchers: []storepb.LabelMatcher{
+					{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+				},
+				MinTime: minTimeDuration.PrometheusTimestamp(),
+				MaxTime: maxTimeDuration.PrometheusTimestamp(),
+			}
+
+			s.cache.SwapWith(noopCache{})
+			srv := newStoreSeriesServer(ctx)
+			err = s.store.Series(req, srv)
+
+			if testData.expectedErr == "" {
+				testutil.Ok(t, err)
+			} else {
+				testutil.NotOk(t, err)
+				testutil.Assert(t, strings.Contains(err.Error(), testData.expectedErr))
+				testutil.Equals(t, codes.Aborted, status.Code(err))
+			}
+		})
+	}
+}
+
 func TestBucketStore_LabelNames_e2e(t *testing.T) {
 	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -638,6 +743,36 @@ func TestBucketStore_LabelNames_e2e(t *testing.T) {
 		})
 		testutil.Ok(t, err)
 		testutil.Equals(t, []string(nil), vals.Names)
+
+		// Only the label names of the series matching the matchers.
+		s.cache.SwapWith(noopCache{})
+		vals, err = s.store.LabelNames(ctx, &storepb.LabelNamesRequest{
+			Start:    timestamp.FromTime(minTime),
+			End:      timestamp.FromTime(maxTime),
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "c", Value: "1"}},
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a", "c"}, vals.Names)
+
+		vals, err = s.store.LabelNames(ctx, &storepb.LabelNamesRequest{
+			Start: timestamp.FromTime(minTime),
+			End:   timestamp.FromTime(maxTime),
+			Matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "ext1", Value: "value1"},
+				{Type: storepb.LabelMatcher_EQ, Name: "b", Value: "2"},
+			},
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a", "b"}, vals.Names)
+
+		// Not matching the external labels.
+		vals, err = s.store.LabelNames(ctx, &storepb.LabelNamesRequest{
+			Start:    timestamp.FromTime(minTime),
+			End:      timestamp.FromTime(maxTime),
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "ext1", Value: "value2"}},
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, len(vals.Names))
 	})
 }
 
@@ -672,5 +807,38 @@ func TestBucketStore_LabelValues_e2e(t *testing.T) {
 		})
 		testutil.Ok(t, err)
 		testutil.Equals(t, []string(nil), vals.Values)
+
+		// Only the label values of the series matching the matchers.
+		s.cache.SwapWith(noopCache{})
+		vals, err = s.store.LabelValues(ctx, &storepb.LabelValuesRequest{
+			Label: "a",
+			Start: timestamp.FromTime(minTime),
+			End:   timestamp.FromTime(maxTime),
+			Matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "ext2", Value: "value2"},
+				{Type: storepb.LabelMatcher_EQ, Name: "c", Value: "1"},
+			},
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"1", "2"}, vals.Values)
+
+		vals, err = s.store.LabelValues(ctx, &storepb.LabelValuesRequest{
+			Label:    "c",
+			Start:    timestamp.FromTime(minTime),
+			End:      timestamp.FromTime(maxTime),
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "b", Value: "1"}},
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, len(vals.Values))
+
+		// Not matching the external labels.
+		vals, err = s.store.LabelValues(ctx, &storepb.LabelValuesRequest{
+			Label:    "a",
+			Start:    timestamp.FromTime(minTime),
+			End:      timestamp.FromTime(maxTime),
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "ext1", Value: "value2"}},
+		})
+		testutil.Ok(t, err)
+		testutil.Equals(t, 0, len(vals.Values))
 	})
 }
@@ -41,6 +41,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/indexheader"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/thanos-io/thanos/pkg/pool"
@@ -207,7 +208,7 @@ func TestBucketBlock_matchLabels(t *testing.T) {
 		},
 	}
 
-	b, err := newBucketBlock(context.Background(), log.NewNopLogger(), newBucketStoreMetrics(nil), meta, bkt, path.Join(dir, blockID.String()), nil, nil, nil, nil, true)
+	b, err := newBucketBlock(context.Background(), log.NewNopLogger(), newBucketStoreMetrics(nil), meta, bkt, path.Join(dir, blockID.String()), nil, nil, nil, nil, nil, true, false, 0)
 	testutil.Ok(t, err)
 
 	cases := []struct {
@@ -424,6 +425,42 @@ func TestBucketBlockSet_remove(t *testing.T) {
 	testutil.Equals(t, input[2].id, res[1].meta.ULID)
 }
 
+func TestBucketBlockSet_additionalResolution(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	const resLevel1d = int64(24 * 60 * 60 * 1000)
+
+	set := newBucketBlockSet(labels.Labels{})
+
+	newBlock := func(id ulid.ULID, mint, maxt, resolution int64) *bucketBlock {
+		var m metadata.Meta
+		m.ULID = id
+		m.MinTime = mint
+		m.MaxTime = maxt
+		m.Thanos.Downsample.Resolution = resolution
+		return &bucketBlock{meta: &m}
+	}
+	testutil.NotOk(t, set.add(newBlock(ulid.MustNew(1, nil), 0, 100, -1)))
+
+	testutil.Ok(t, set.add(newBlock(ulid.MustNew(2, nil), 0, 100, resLevel1d)))
+	testutil.Ok(t, set.add(newBlock(ulid.MustNew(3, nil), 100, 200, downsample.ResLevel2)))
+	testutil.Ok(t, set.add(newBlock(ulid.MustNew(4, nil), 200, 300, downsample.ResLevel0)))
+	testutil.Equals(t, []int64{resLevel1d, downsample.ResLevel2, downsample.ResLevel1, downsample.ResLevel0}, set.resolutions)
+
+	var ids []ulid.ULID
+	for _, b := range set.getFor(0, 300, resLevel1d, nil) {
+		ids = append(ids, b.meta.ULID)
+	}
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(2, nil), ulid.MustNew(3, nil), ulid.MustNew(4, nil)}, ids)
+
+	// The 1d block is not returned if it is coarser than the max resolution.
+	ids = ids[:0]
+	for _, b := range set.getFor(0, 300, downsample.ResLevel2, nil) {
+		ids = append(ids, b.meta.ULID)
+	}
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(3, nil), ulid.MustNew(4, nil)}, ids)
+}
+
 func TestBucketBlockSet_labelMatchers(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -573,7 +610,9 @@ func TestBucketStore_Info(t *testing.T) {
 		noopCache{},
 		nil,
 		2e5,
+		0,
 		NewChunksLimiterFactory(0),
+		NewBytesLimiterFactory(0),
 		false,
 		20,
 		allowAllFilterConf,
@@ -583,6 +622,14 @@ func TestBucketStore_Info(t *testing.T) {
 		false,
 		false,
 		0,
+		0,
+		0,
+		false,
+		false,
+		0,
+		partitionerMaxGapSize,
+		false,
+		0,
 	)
 	testutil.Ok(t, err)
 	defer func() { testutil.Ok(t, bucketStore.Close()) }()
@@ -825,7 +872,9 @@ func testSharding(t *testing.T, reuseDisk string, bkt objstore.Bucket, all ...ul
 				noopCache{},
 				nil,
 				0,
+				0,
 				NewChunksLimiterFactory(0),
+				NewBytesLimiterFactory(0),
 				false,
 				20,
 				allowAllFilterConf,
@@ -835,6 +884,14 @@ func testSharding(t *testing.T, reuseDisk string, bkt objstore.Bucket, all ...ul
 				false,
 				false,
 				0,
+				0,
+				0,
+				false,
+				false,
+				0,
+				partitionerMaxGapSize,
+				false,
+				0,
 			)
 			testutil.Ok(t, err)
 			defer func() { testutil.Ok(t, bucketStore.Close()) }()
@@ -915,11 +972,18 @@ func expectedTouchedBlockOps(all []ulid.ULID, expected []ulid.ULID, cached []uli
 }
 
 // Regression tests against: https://github.com/thanos-io/thanos/issues/1983.
+func newSeriesPool(t testing.TB) pool.BytesPool {
+	p, err := pool.NewBucketedBytesPool(maxSeriesSize, 50e6, 2, 0)
+	testutil.Ok(t, err)
+	return p
+}
+
 func TestReadIndexCache_LoadSeries(t *testing.T) {
 	bkt := objstore.NewInMemBucket()
 
 	s := newBucketStoreMetrics(nil)
 	b := &bucketBlock{
+		seriesPool: newSeriesPool(t),
 		meta: &metadata.Meta{
 			BlockMeta: tsdb.BlockMeta{
 				ULID: ulid.MustNew(1, nil),
@@ -945,6 +1009,7 @@ func TestReadIndexCache_LoadSeries(t *testing.T) {
 	r := bucketIndexReader{
 		block:        b,
 		stats:        &queryStats{},
+		getRangeGate: gate.NewNoop(),
 		loadedSeries: map[uint64][]byte{},
 	}
 
@@ -986,6 +1051,70 @@ func TestReadIndexCache_LoadSeries(t *testing.T) {
 	testutil.NotOk(t, r.loadSeries(context.TODO(), []uint64{2, 13, 24}, false, 1, 15))
 }
 
+// retainingSeriesCache keeps the stored series as they are given, like caches storing them asynchronously.
+type retainingSeriesCache struct {
+	noopCache
+
+	mtx    sync.Mutex
+	series map[uint64][]byte
+}
+
+func (c *retainingSeriesCache) StoreSeries(_ context.Context, _ ulid.ULID, id uint64, v []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.series[id] = v
+}
+
+func TestReadIndexCache_LoadSeries_StoresCopies(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+
+	cache := &retainingSeriesCache{series: map[uint64][]byte{}}
+	b := &bucketBlock{
+		seriesPool: newSeriesPool(t),
+		meta: &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID: ulid.MustNew(1, nil),
+			},
+		},
+		bkt:        bkt,
+		logger:     log.NewNopLogger(),
+		metrics:    newBucketStoreMetrics(nil),
+		indexCache: cache,
+	}
+
+	buf := encoding.Encbuf{}
+	buf.PutByte(0)
+	buf.PutByte(0)
+	buf.PutUvarint(10)
+	buf.PutString("aaaaaaaaaa")
+	buf.PutUvarint(10)
+	buf.PutString("bbbbbbbbbb")
+	testutil.Ok(t, bkt.Upload(context.Background(), filepath.Join(b.meta.ULID.String(), block.IndexFilename), bytes.NewReader(buf.Get())))
+
+	r := bucketIndexReader{
+		block:        b,
+		stats:        &queryStats{},
+		getRangeGate: gate.NewNoop(),
+		loadedSeries: map[uint64][]byte{},
+	}
+	testutil.Ok(t, r.loadSeries(context.TODO(), []uint64{2, 13}, false, 2, 100))
+	testutil.Equals(t, 1, len(r.seriesBytes))
+
+	// Reusing the pooled buffers must not change the cached series.
+	buffers := r.seriesBytes
+	r.releaseLoadedSeries()
+	for _, b := range buffers {
+		reused := (*b)[:cap(*b)]
+		for i := range reused {
+			reused[i] = 0
+		}
+	}
+	testutil.Equals(t, map[uint64][]byte{
+		2:  []byte("aaaaaaaaaa"),
+		13: []byte("bbbbbbbbbb"),
+	}, cache.series)
+}
+
 func TestBucketIndexReader_ExpandedPostings(t *testing.T) {
 	tb := testutil.NewTB(t)
 
@@ -1005,6 +1134,90 @@ func TestBucketIndexReader_ExpandedPostings(t *testing.T) {
 	benchmarkExpandedPostings(tb, bkt, id, r, 500)
 }
 
+func TestBucketIndexReader_LazyExpandedPostings(t *testing.T) {
+	tb := testutil.NewTB(t)
+
+	tmpDir, err := ioutil.TempDir("", "test-lazy-expanded-postings")
+	testutil.Ok(tb, err)
+	defer func() { testutil.Ok(tb, os.RemoveAll(tmpDir)) }()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(tb, err)
+	defer func() { testutil.Ok(tb, bkt.Close()) }()
+
+	id := uploadTestBlock(tb, tmpDir, bkt, 500)
+
+	r, err := indexheader.NewBinaryReader(context.Background(), log.NewNopLogger(), bkt, tmpDir, id, DefaultPostingOffsetInMemorySampling)
+	testutil.Ok(tb, err)
+
+	b := &bucketBlock{
+		seriesPool:        newSeriesPool(tb),
+		logger:            log.NewNopLogger(),
+		metrics:           newBucketStoreMetrics(nil),
+		indexHeaderReader: r,
+		indexCache:        noopCache{},
+		bkt:               bkt,
+		meta:              &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id}},
+		partitioner:       gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
+	}
+
+	n1 := labels.MustNewMatcher(labels.MatchEqual, "n", "1"+storetestutil.LabelLongSuffix)
+	jFoo := labels.MustNewMatcher(labels.MatchEqual, "j", "foo")
+	iNotEmpty := labels.MustNewMatcher(labels.MatchNotEqual, "i", "")
+	iNotFoo := labels.MustNewMatcher(labels.MatchNotEqual, "i", "foo")
+
+	for _, c := range []struct {
+		name         string
+		matchers     []*labels.Matcher
+		expected     []*labels.Matcher
+		expectedLazy []*labels.Matcher
+	}{
+		{
+			name:     `n="1"`,
+			matchers: []*labels.Matcher{n1},
+			expected: []*labels.Matcher{n1},
+		},
+		{
+			name:     `n="1",j="foo"`,
+			matchers: []*labels.Matcher{n1, jFoo},
+			expected: []*labels.Matcher{n1, jFoo},
+		},
+		{
+			// Postings of all i values are much larger than the series matching n="1".
+			name:         `n="1",i!="",j="foo"`,
+			matchers:     []*labels.Matcher{n1, iNotEmpty, jFoo},
+			expected:     []*labels.Matcher{n1, jFoo},
+			expectedLazy: []*labels.Matcher{iNotEmpty},
+		},
+		{
+			// Without adding groups, postings are always fetched.
+			name:     `i!="foo"`,
+			matchers: []*labels.Matcher{iNotFoo},
+			expected: []*labels.Matcher{iNotFoo},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			indexr := newBucketIndexReader(context.Background(), b, gate.NewNoop())
+
+			exp, err := indexr.ExpandedPostings(c.expected)
+			testutil.Ok(t, err)
+
+			ps, lazyMatchers, err := indexr.expandedPostings(c.matchers, true)
+			testutil.Ok(t, err)
+			testutil.Equals(t, exp, ps)
+			testutil.Equals(t, c.expectedLazy, lazyMatchers)
+
+			// Postings of all groups are fetched if lazy expanded postings are disabled.
+			ps, lazyMatchers, err = indexr.expandedPostings(c.matchers, false)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 0, len(lazyMatchers))
+			all, err := indexr.ExpandedPostings(c.matchers)
+			testutil.Ok(t, err)
+			testutil.Equals(t, all, ps)
+		})
+	}
+}
+
 func BenchmarkBucketIndexReader_ExpandedPostings(b *testing.B) {
 	tb := testutil.NewTB(b)
 
@@ -1133,6 +1346,7 @@ func benchmarkExpandedPostings(
 	for _, c := range cases {
 		t.Run(c.name, func(t testutil.TB) {
 			b := &bucketBlock{
+				seriesPool:        newSeriesPool(t),
 				logger:            log.NewNopLogger(),
 				metrics:           newBucketStoreMetrics(nil),
 				indexHeaderReader: r,
@@ -1142,7 +1356,7 @@ func benchmarkExpandedPostings(
 				partitioner:       gapBasedPartitioner{maxGapSize: partitionerMaxGapSize},
 			}
 
-			indexr := newBucketIndexReader(context.Background(), b)
+			indexr := newBucketIndexReader(context.Background(), b, gate.NewNoop())
 
 			t.ResetTimer()
 			for i := 0; i < t.N(); i++ {
@@ -1213,8 +1427,10 @@ func benchBucketSeries(t testutil.TB, skipChunk bool, samplesPerSeries, totalSer
 	chunkPool, err = pool.NewBucketedBytesPool(maxChunkSize, 50e6, 2, 100e7)
 	testutil.Ok(t, err)
 
+	seriesPool := newSeriesPool(t)
 	if !t.IsBenchmark() {
 		chunkPool = &mockedPool{parent: chunkPool}
+		seriesPool = &mockedPool{parent: seriesPool}
 	}
 	blockDir := filepath.Join(tmpDir, "tmp")
 
@@ -1250,6 +1466,7 @@ func benchBucketSeries(t testutil.TB, skipChunk bool, samplesPerSeries, totalSer
 
 		m := newBucketStoreMetrics(nil)
 		b := &bucketBlock{
+			seriesPool:  seriesPool,
 			indexCache:  noopCache{},
 			logger:      logger,
 			metrics:     m,
@@ -1266,13 +1483,14 @@ func benchBucketSeries(t testutil.TB, skipChunk bool, samplesPerSeries, totalSer
 		bkt:             objstore.WithNoopInstr(bkt),
 		logger:          logger,
 		indexCache:      noopCache{},
-		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, nil),
+		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, 0, 0, false, nil),
 		metrics:         newBucketStoreMetrics(nil),
 		blockSets: map[uint64]*bucketBlockSet{
 			labels.Labels{{Name: "ext1", Value: "1"}}.Hash(): {blocks: [][]*bucketBlock{blocks}},
 		},
 		queryGate:            noopGate{},
 		chunksLimiterFactory: NewChunksLimiterFactory(0),
+		bytesLimiterFactory:  NewBytesLimiterFactory(0),
 	}
 
 	for _, block := range blocks {
@@ -1317,6 +1535,9 @@ func benchBucketSeries(t testutil.TB, skipChunk bool, samplesPerSeries, totalSer
 			testutil.Equals(t, 0, int(chunkPool.(*mockedPool).balance.Load()))
 			chunkPool.(*mockedPool).gets.Store(0)
 		}
+		// The series buffers are put back once the series are sent.
+		testutil.Assert(t, seriesPool.(*mockedPool).gets.Load() > 0, "series pool should be used")
+		testutil.Equals(t, 0, int(seriesPool.(*mockedPool).balance.Load()))
 
 		for _, b := range blocks {
 			// NOTE(bwplotka): It is 4 x 1.0 for 100mln samples. Kind of make sense: long series.
@@ -1422,6 +1643,7 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		testutil.Ok(t, block.Upload(context.Background(), logger, bkt, filepath.Join(blockDir, id.String())))
 
 		b1 = &bucketBlock{
+			seriesPool:  newSeriesPool(t),
 			indexCache:  indexCache,
 			logger:      logger,
 			metrics:     newBucketStoreMetrics(nil),
@@ -1461,6 +1683,7 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		testutil.Ok(t, block.Upload(context.Background(), logger, bkt, filepath.Join(blockDir, id.String())))
 
 		b2 = &bucketBlock{
+			seriesPool:  newSeriesPool(t),
 			indexCache:  indexCache,
 			logger:      logger,
 			metrics:     newBucketStoreMetrics(nil),
@@ -1478,7 +1701,7 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		bkt:             objstore.WithNoopInstr(bkt),
 		logger:          logger,
 		indexCache:      indexCache,
-		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, nil),
+		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, 0, 0, false, nil),
 		metrics:         newBucketStoreMetrics(nil),
 		blockSets: map[uint64]*bucketBlockSet{
 			labels.Labels{{Name: "ext1", Value: "1"}}.Hash(): {blocks: [][]*bucketBlock{{b1, b2}}},
@@ -1489,6 +1712,7 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		},
 		queryGate:            noopGate{},
 		chunksLimiterFactory: NewChunksLimiterFactory(0),
+		bytesLimiterFactory:  NewBytesLimiterFactory(0),
 	}
 
 	t.Run("invoke series for one block. Fill the cache on the way.", func(t *testing.T) {
@@ -1607,7 +1831,9 @@ func TestSeries_RequestAndResponseHints(t *testing.T) {
 		indexCache,
 		nil,
 		1000000,
+		0,
 		NewChunksLimiterFactory(10000/MaxSamplesPerChunk),
+		NewBytesLimiterFactory(0),
 		false,
 		10,
 		nil,
@@ -1617,12 +1843,26 @@ func TestSeries_RequestAndResponseHints(t *testing.T) {
 		true,
 		false,
 		0,
+		0,
+		0,
+		false,
+		false,
+		0,
+		partitionerMaxGapSize,
+		false,
+		0,
 	)
 	testutil.Ok(tb, err)
 	defer func() { testutil.Ok(t, store.Close()) }()
 
 	testutil.Ok(tb, store.SyncBlocks(context.Background()))
 
+	queriedBlock := func(id ulid.ULID) hintspb.Block {
+		meta, err := metadata.Read(filepath.Join(bktDir, id.String()))
+		testutil.Ok(t, err)
+		return hintspb.Block{Id: id.String(), MinTime: meta.MinTime, MaxTime: meta.MaxTime, Resolution: 0}
+	}
+
 	testCases := []*storetestutil.SeriesCase{
 		{
 			Name: "querying a range containing 1 block should return 1 block in the response hints",
@@ -1637,7 +1877,7 @@ func TestSeries_RequestAndResponseHints(t *testing.T) {
 			ExpectedHints: []hintspb.SeriesResponseHints{
 				{
 					QueriedBlocks: []hintspb.Block{
-						{Id: block1.String()},
+						queriedBlock(block1),
 					},
 				},
 			},
@@ -1654,8 +1894,8 @@ func TestSeries_RequestAndResponseHints(t *testing.T) {
 			ExpectedHints: []hintspb.SeriesResponseHints{
 				{
 					QueriedBlocks: []hintspb.Block{
-						{Id: block1.String()},
-						{Id: block2.String()},
+						queriedBlock(block1),
+						queriedBlock(block2),
 					},
 				},
 			},
@@ -1677,7 +1917,7 @@ func TestSeries_RequestAndResponseHints(t *testing.T) {
 			ExpectedHints: []hintspb.SeriesResponseHints{
 				{
 					QueriedBlocks: []hintspb.Block{
-						{Id: block1.String()},
+						queriedBlock(block1),
 					},
 				},
 			},
@@ -1685,6 +1925,28 @@ func TestSeries_RequestAndResponseHints(t *testing.T) {
 	}
 
 	storetestutil.TestServerSeries(tb, store, testCases...)
+
+	t.Run("querying with query stats enabled should return the query stats in the response hints", func(t *testing.T) {
+		srv := storetestutil.NewSeriesServer(context.Background())
+		testutil.Ok(t, store.Series(&storepb.SeriesRequest{
+			MinTime: 0,
+			MaxTime: 3,
+			Matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "foo", Value: "bar"},
+			},
+			Hints: mustMarshalAny(&hintspb.SeriesRequestHints{EnableQueryStats: true}),
+		}, srv))
+		testutil.Equals(t, 1, len(srv.HintsSet))
+
+		hints := hintspb.SeriesResponseHints{}
+		testutil.Ok(t, types.UnmarshalAny(srv.HintsSet[0], &hints))
+		testutil.Equals(t, []hintspb.Block{queriedBlock(block1), queriedBlock(block2)}, hints.QueriedBlocks)
+		testutil.Assert(t, hints.QueryStats != nil, "expected query stats")
+		testutil.Equals(t, int64(2), hints.QueryStats.BlocksQueried)
+		testutil.Equals(t, int64(len(seriesSet1)+len(seriesSet2)), hints.QueryStats.MergedSeriesCount)
+		testutil.Equals(t, hints.QueryStats.PostingsFetchedSizeSum+hints.QueryStats.SeriesFetchedSizeSum+hints.QueryStats.ChunksFetchedSizeSum, hints.QueryStats.DataDownloadedSizeSum)
+		testutil.Assert(t, hints.QueryStats.DataDownloadedSizeSum > 0, "expected data downloaded")
+	})
 }
 
 func TestSeries_ErrorUnmarshallingRequestHints(t *testing.T) {
@@ -1720,7 +1982,9 @@ func TestSeries_ErrorUnmarshallingRequestHints(t *testing.T) {
 		indexCache,
 		nil,
 		1000000,
+		0,
 		NewChunksLimiterFactory(10000/MaxSamplesPerChunk),
+		NewBytesLimiterFactory(0),
 		false,
 		10,
 		nil,
@@ -1730,6 +1994,14 @@ func TestSeries_ErrorUnmarshallingRequestHints(t *testing.T) {
 		true,
 		false,
 		0,
+		0,
+		0,
+		false,
+		false,
+		0,
+		partitionerMaxGapSize,
+		false,
+		0,
 	)
 	testutil.Ok(tb, err)
 	defer func() { testutil.Ok(t, store.Close()) }()
@@ -1814,7 +2086,9 @@ func TestSeries_BlockWithMultipleChunks(t *testing.T) {
 		indexCache,
 		nil,
 		1000000,
+		0,
 		NewChunksLimiterFactory(100000/MaxSamplesPerChunk),
+		NewBytesLimiterFactory(0),
 		false,
 		10,
 		nil,
@@ -1824,6 +2098,14 @@ func TestSeries_BlockWithMultipleChunks(t *testing.T) {
 		true,
 		false,
 		0,
+		0,
+		0,
+		false,
+		false,
+		0,
+		partitionerMaxGapSize,
+		false,
+		0,
 	)
 	testutil.Ok(tb, err)
 	testutil.Ok(tb, store.SyncBlocks(context.Background()))
@@ -1959,7 +2241,9 @@ func TestBlockWithLargeChunks(t *testing.T) {
 		indexCache,
 		nil,
 		1000000,
+		0,
 		NewChunksLimiterFactory(10000/MaxSamplesPerChunk),
+		NewBytesLimiterFactory(0),
 		false,
 		10,
 		nil,
@@ -1969,6 +2253,14 @@ func TestBlockWithLargeChunks(t *testing.T) {
 		true,
 		false,
 		0,
+		0,
+		0,
+		false,
+		false,
+		0,
+		partitionerMaxGapSize,
+		false,
+		0,
 	)
 	testutil.Ok(t, err)
 	defer func() { testutil.Ok(t, store.Close()) }()
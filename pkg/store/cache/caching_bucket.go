@@ -11,6 +11,7 @@ import (
 	"io"
 	"io/ioutil"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -490,6 +491,34 @@ func cachingKeyObjectSubrange(name string, start int64, end int64) string {
 	return fmt.Sprintf("subrange:%s:%d:%d", name, start, end)
 }
 
+// parseCachingKeyAttributes returns the object name of a key created by cachingKeyAttributes.
+func parseCachingKeyAttributes(key string) (name string, ok bool) {
+	if !strings.HasPrefix(key, "attrs:") {
+		return "", false
+	}
+	return strings.TrimPrefix(key, "attrs:"), true
+}
+
+// parseCachingKeyObjectSubrange returns the object name and subrange of a key created by cachingKeyObjectSubrange.
+func parseCachingKeyObjectSubrange(key string) (name string, start, end int64, ok bool) {
+	if !strings.HasPrefix(key, "subrange:") {
+		return "", 0, 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(key, "subrange:"), ":")
+	if len(parts) < 3 {
+		return "", 0, 0, false
+	}
+
+	var err error
+	if start, err = strconv.ParseInt(parts[len(parts)-2], 10, 64); err != nil {
+		return "", 0, 0, false
+	}
+	if end, err = strconv.ParseInt(parts[len(parts)-1], 10, 64); err != nil || end < start {
+		return "", 0, 0, false
+	}
+	return strings.Join(parts[:len(parts)-2], ":"), start, end, true
+}
+
 func cachingKeyIter(name string) string {
 	return fmt.Sprintf("iter:%s", name)
 }
@@ -4,6 +4,10 @@
 package storecache
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
 	"regexp"
 	"strings"
 	"time"
@@ -14,17 +18,23 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"gopkg.in/yaml.v2"
 
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	cache "github.com/thanos-io/thanos/pkg/cache"
 	"github.com/thanos-io/thanos/pkg/cacheutil"
 	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
 )
 
 // BucketCacheProvider is a type used to evaluate all bucket cache providers.
 type BucketCacheProvider string
 
-const MemcachedBucketCacheProvider BucketCacheProvider = "MEMCACHED" // Memcached cache-provider for caching bucket.
+const (
+	MemcachedBucketCacheProvider  BucketCacheProvider = "MEMCACHED"  // Memcached cache-provider for caching bucket.
+	RedisBucketCacheProvider      BucketCacheProvider = "REDIS"      // Redis cache-provider for caching bucket.
+	GroupcacheBucketCacheProvider BucketCacheProvider = "GROUPCACHE" // Groupcache cache-provider for caching bucket, shared by the peers.
+)
 
 // CachingWithBackendConfig is a configuration of caching bucket used by Store component.
 type CachingWithBackendConfig struct {
@@ -89,6 +99,17 @@ func NewCachingBucketFromYaml(yamlContent []byte, bucket objstore.Bucket, logger
 			return nil, errors.Wrapf(err, "failed to create memcached client")
 		}
 		c = cache.NewMemcachedCache("caching-bucket", logger, memcached, reg)
+	case string(RedisBucketCacheProvider):
+		redis, err := cacheutil.NewRedisClient(logger, "caching-bucket", backendConfig, reg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create redis client")
+		}
+		c = cache.NewRedisCache("caching-bucket", logger, redis, reg)
+	case string(GroupcacheBucketCacheProvider):
+		c, err = cache.NewGroupcache(logger, reg, backendConfig, newGroupcacheLoader(logger, bucket, config.ChunkSubrangeSize))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create groupcache")
+		}
 	default:
 		return nil, errors.Errorf("unsupported cache type: %s", config.Type)
 	}
@@ -99,11 +120,17 @@ func NewCachingBucketFromYaml(yamlContent []byte, bucket objstore.Bucket, logger
 
 	// Configure cache.
 	cfg.CacheGetRange("chunks", c, isTSDBChunkFile, config.ChunkSubrangeSize, config.ChunkObjectAttrsTTL, config.ChunkSubrangeTTL, config.MaxChunksGetRangeRequests)
-	cfg.CacheExists("meta.jsons", c, isMetaFile, config.MetafileExistsTTL, config.MetafileDoesntExistTTL)
-	cfg.CacheGet("meta.jsons", c, isMetaFile, int(config.MetafileMaxSize), config.MetafileContentTTL, config.MetafileExistsTTL, config.MetafileDoesntExistTTL)
-
-	// Cache Iter requests for root.
-	cfg.CacheIter("blocks-iter", c, isBlocksRootDir, config.BlocksIterTTL, JSONIterCodec{})
+	if strings.ToUpper(string(config.Type)) == string(GroupcacheBucketCacheProvider) {
+		// Groupcache items never expire, so only the immutable block files are cached: chunks and index,
+		// which includes postings and series fetched by the queries.
+		cfg.CacheGetRange("index", c, isTSDBIndexFile, config.ChunkSubrangeSize, config.ChunkObjectAttrsTTL, config.ChunkSubrangeTTL, config.MaxChunksGetRangeRequests)
+	} else {
+		cfg.CacheExists("meta.jsons", c, isMetaFile, config.MetafileExistsTTL, config.MetafileDoesntExistTTL)
+		cfg.CacheGet("meta.jsons", c, isMetaFile, int(config.MetafileMaxSize), config.MetafileContentTTL, config.MetafileExistsTTL, config.MetafileDoesntExistTTL)
+
+		// Cache Iter requests for root.
+		cfg.CacheIter("blocks-iter", c, isBlocksRootDir, config.BlocksIterTTL, JSONIterCodec{})
+	}
 
 	cb, err := NewCachingBucket(bucket, cfg, logger, reg)
 	if err != nil {
@@ -117,6 +144,8 @@ var chunksMatcher = regexp.MustCompile(`^.*/chunks/\d+$`)
 
 func isTSDBChunkFile(name string) bool { return chunksMatcher.MatchString(name) }
 
+func isTSDBIndexFile(name string) bool { return strings.HasSuffix(name, "/"+block.IndexFilename) }
+
 func isMetaFile(name string) bool {
 	return strings.HasSuffix(name, "/"+metadata.MetaFilename) || strings.HasSuffix(name, "/"+metadata.DeletionMarkFilename)
 }
@@ -124,3 +153,40 @@ func isMetaFile(name string) bool {
 func isBlocksRootDir(name string) bool {
 	return name == ""
 }
+
+// newGroupcacheLoader returns the loader of the items cached by the caching bucket from the bucket.
+// Keys are requested by the peers too, so only the items the caching bucket caches with groupcache are
+// loaded: attributes of chunks and index files, and their subranges aligned to the subrange size.
+func newGroupcacheLoader(logger log.Logger, bkt objstore.Bucket, subrangeSize int64) cache.GroupcacheLoader {
+	cached := func(name string) bool { return isTSDBChunkFile(name) || isTSDBIndexFile(name) }
+
+	return func(ctx context.Context, key string) ([]byte, error) {
+		if name, start, end, ok := parseCachingKeyObjectSubrange(key); ok && cached(name) {
+			if start%subrangeSize != 0 || end-start > subrangeSize {
+				return nil, errors.Errorf("subrange %d-%d of %s is not aligned to the subrange size %d", start, end, name, subrangeSize)
+			}
+			r, err := bkt.GetRange(ctx, name, start, end-start)
+			if err != nil {
+				return nil, err
+			}
+			defer runutil.CloseWithLogOnErr(logger, r, "close subrange reader")
+
+			data, err := ioutil.ReadAll(io.LimitReader(r, end-start+1))
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(data)) > end-start {
+				return nil, errors.Errorf("subrange %d-%d of %s returned more than %d bytes", start, end, name, end-start)
+			}
+			return data, nil
+		}
+		if name, ok := parseCachingKeyAttributes(key); ok && cached(name) {
+			attrs, err := bkt.Attributes(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(attrs)
+		}
+		return nil, errors.Errorf("unsupported caching key %s", key)
+	}
+}
@@ -7,6 +7,7 @@ package storecache
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 
@@ -657,3 +659,49 @@ func verifyObjectAttrs(t *testing.T, cb *CachingBucket, file string, expectedLen
 }
 
 func matchAll(string) bool { return true }
+
+func TestGroupcacheLoader(t *testing.T) {
+	ctx := context.Background()
+	inmem := objstore.NewInMemBucket()
+	data := []byte("0123456789")
+	name := "/test/chunks/000001"
+	testutil.Ok(t, inmem.Upload(ctx, name, bytes.NewReader(data)))
+
+	testutil.Ok(t, inmem.Upload(ctx, "/test/meta.json", bytes.NewReader(data)))
+
+	loader := newGroupcacheLoader(log.NewNopLogger(), inmem, 4)
+
+	b, err := loader(ctx, cachingKeyObjectSubrange(name, 4, 8))
+	testutil.Ok(t, err)
+	testutil.Equals(t, data[4:8], b)
+	b, err = loader(ctx, cachingKeyObjectSubrange(name, 8, 10))
+	testutil.Ok(t, err)
+	testutil.Equals(t, data[8:10], b)
+
+	b, err = loader(ctx, cachingKeyAttributes(name))
+	testutil.Ok(t, err)
+	var attrs objstore.ObjectAttributes
+	testutil.Ok(t, json.Unmarshal(b, &attrs))
+	testutil.Equals(t, int64(len(data)), attrs.Size)
+
+	_, err = loader(ctx, cachingKeyObjectSubrange("/test/chunks/000002", 0, 2))
+	testutil.NotOk(t, err)
+
+	// Only immutable objects are loaded, as the items never expire.
+	_, err = loader(ctx, cachingKeyExists(name))
+	testutil.NotOk(t, err)
+	_, err = loader(ctx, cachingKeyContent(name))
+	testutil.NotOk(t, err)
+	_, err = loader(ctx, "subrange:"+name+":6:2")
+	testutil.NotOk(t, err)
+
+	// Keys are requested by the peers, so only the subranges the caching bucket requests are loaded.
+	_, err = loader(ctx, cachingKeyObjectSubrange(name, 2, 6))
+	testutil.NotOk(t, err)
+	_, err = loader(ctx, cachingKeyObjectSubrange(name, 0, 8))
+	testutil.NotOk(t, err)
+	_, err = loader(ctx, cachingKeyObjectSubrange("/test/meta.json", 0, 4))
+	testutil.NotOk(t, err)
+	_, err = loader(ctx, cachingKeyAttributes("/test/meta.json"))
+	testutil.NotOk(t, err)
+}
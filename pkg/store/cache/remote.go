@@ -18,24 +18,24 @@ import (
 )
 
 const (
-	memcachedDefaultTTL = 24 * time.Hour
+	remoteDefaultTTL = 24 * time.Hour
 )
 
-// MemcachedIndexCache is a memcached-based index cache.
-type MemcachedIndexCache struct {
-	logger    log.Logger
-	memcached cacheutil.MemcachedClient
+// RemoteIndexCache is an index cache backed by a remote cache, e.g. memcached or Redis.
+type RemoteIndexCache struct {
+	logger      log.Logger
+	cacheClient cacheutil.RemoteCacheClient
 
 	// Metrics.
 	requests *prometheus.CounterVec
 	hits     *prometheus.CounterVec
 }
 
-// NewMemcachedIndexCache makes a new MemcachedIndexCache.
-func NewMemcachedIndexCache(logger log.Logger, memcached cacheutil.MemcachedClient, reg prometheus.Registerer) (*MemcachedIndexCache, error) {
-	c := &MemcachedIndexCache{
-		logger:    logger,
-		memcached: memcached,
+// NewRemoteIndexCache makes a new RemoteIndexCache.
+func NewRemoteIndexCache(logger log.Logger, cacheClient cacheutil.RemoteCacheClient, reg prometheus.Registerer) (*RemoteIndexCache, error) {
+	c := &RemoteIndexCache{
+		logger:      logger,
+		cacheClient: cacheClient,
 	}
 
 	c.requests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
@@ -52,26 +52,38 @@ func NewMemcachedIndexCache(logger log.Logger, memcached cacheutil.MemcachedClie
 	c.hits.WithLabelValues(cacheTypePostings)
 	c.hits.WithLabelValues(cacheTypeSeries)
 
-	level.Info(logger).Log("msg", "created memcached index cache")
+	level.Info(logger).Log("msg", "created remote index cache")
 
 	return c, nil
 }
 
+// MemcachedIndexCache is a memcached-based index cache.
+//
+// Deprecated: Use RemoteIndexCache instead.
+type MemcachedIndexCache = RemoteIndexCache
+
+// NewMemcachedIndexCache makes a new MemcachedIndexCache.
+//
+// Deprecated: Use NewRemoteIndexCache instead.
+func NewMemcachedIndexCache(logger log.Logger, memcached cacheutil.MemcachedClient, reg prometheus.Registerer) (*MemcachedIndexCache, error) {
+	return NewRemoteIndexCache(logger, memcached, reg)
+}
+
 // StorePostings sets the postings identified by the ulid and label to the value v.
 // The function enqueues the request and returns immediately: the entry will be
 // asynchronously stored in the cache.
-func (c *MemcachedIndexCache) StorePostings(ctx context.Context, blockID ulid.ULID, l labels.Label, v []byte) {
+func (c *RemoteIndexCache) StorePostings(ctx context.Context, blockID ulid.ULID, l labels.Label, v []byte) {
 	key := cacheKey{blockID, cacheKeyPostings(l)}.string()
 
-	if err := c.memcached.SetAsync(ctx, key, v, memcachedDefaultTTL); err != nil {
-		level.Error(c.logger).Log("msg", "failed to cache postings in memcached", "err", err)
+	if err := c.cacheClient.SetAsync(ctx, key, v, remoteDefaultTTL); err != nil {
+		level.Error(c.logger).Log("msg", "failed to cache postings in remote cache", "err", err)
 	}
 }
 
 // FetchMultiPostings fetches multiple postings - each identified by a label -
 // and returns a map containing cache hits, along with a list of missing keys.
 // In case of error, it logs and return an empty cache hits map.
-func (c *MemcachedIndexCache) FetchMultiPostings(ctx context.Context, blockID ulid.ULID, lbls []labels.Label) (hits map[labels.Label][]byte, misses []labels.Label) {
+func (c *RemoteIndexCache) FetchMultiPostings(ctx context.Context, blockID ulid.ULID, lbls []labels.Label) (hits map[labels.Label][]byte, misses []labels.Label) {
 	// Build the cache keys, while keeping a map between input label and the cache key
 	// so that we can easily reverse it back after the GetMulti().
 	keys := make([]string, 0, len(lbls))
@@ -84,9 +96,9 @@ func (c *MemcachedIndexCache) FetchMultiPostings(ctx context.Context, blockID ul
 		keysMapping[lbl] = key
 	}
 
-	// Fetch the keys from memcached in a single request.
+	// Fetch the keys from the remote cache in a single request.
 	c.requests.WithLabelValues(cacheTypePostings).Add(float64(len(keys)))
-	results := c.memcached.GetMulti(ctx, keys)
+	results := c.cacheClient.GetMulti(ctx, keys)
 	if len(results) == 0 {
 		return nil, lbls
 	}
@@ -98,11 +110,11 @@ func (c *MemcachedIndexCache) FetchMultiPostings(ctx context.Context, blockID ul
 	for _, lbl := range lbls {
 		key, ok := keysMapping[lbl]
 		if !ok {
-			level.Error(c.logger).Log("msg", "keys mapping inconsistency found in memcached index cache client", "type", "postings", "label", lbl.Name+":"+lbl.Value)
+			level.Error(c.logger).Log("msg", "keys mapping inconsistency found in remote cache index cache client", "type", "postings", "label", lbl.Name+":"+lbl.Value)
 			continue
 		}
 
-		// Check if the key has been found in memcached. If not, we add it to the list
+		// Check if the key has been found in remote cache. If not, we add it to the list
 		// of missing keys.
 		value, ok := results[key]
 		if !ok {
@@ -120,18 +132,18 @@ func (c *MemcachedIndexCache) FetchMultiPostings(ctx context.Context, blockID ul
 // StoreSeries sets the series identified by the ulid and id to the value v.
 // The function enqueues the request and returns immediately: the entry will be
 // asynchronously stored in the cache.
-func (c *MemcachedIndexCache) StoreSeries(ctx context.Context, blockID ulid.ULID, id uint64, v []byte) {
+func (c *RemoteIndexCache) StoreSeries(ctx context.Context, blockID ulid.ULID, id uint64, v []byte) {
 	key := cacheKey{blockID, cacheKeySeries(id)}.string()
 
-	if err := c.memcached.SetAsync(ctx, key, v, memcachedDefaultTTL); err != nil {
-		level.Error(c.logger).Log("msg", "failed to cache series in memcached", "err", err)
+	if err := c.cacheClient.SetAsync(ctx, key, v, remoteDefaultTTL); err != nil {
+		level.Error(c.logger).Log("msg", "failed to cache series in remote cache", "err", err)
 	}
 }
 
 // FetchMultiSeries fetches multiple series - each identified by ID - from the cache
 // and returns a map containing cache hits, along with a list of missing IDs.
 // In case of error, it logs and return an empty cache hits map.
-func (c *MemcachedIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid.ULID, ids []uint64) (hits map[uint64][]byte, misses []uint64) {
+func (c *RemoteIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid.ULID, ids []uint64) (hits map[uint64][]byte, misses []uint64) {
 	// Build the cache keys, while keeping a map between input id and the cache key
 	// so that we can easily reverse it back after the GetMulti().
 	keys := make([]string, 0, len(ids))
@@ -144,9 +156,9 @@ func (c *MemcachedIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid
 		keysMapping[id] = key
 	}
 
-	// Fetch the keys from memcached in a single request.
+	// Fetch the keys from the remote cache in a single request.
 	c.requests.WithLabelValues(cacheTypeSeries).Add(float64(len(ids)))
-	results := c.memcached.GetMulti(ctx, keys)
+	results := c.cacheClient.GetMulti(ctx, keys)
 	if len(results) == 0 {
 		return nil, ids
 	}
@@ -158,11 +170,11 @@ func (c *MemcachedIndexCache) FetchMultiSeries(ctx context.Context, blockID ulid
 	for _, id := range ids {
 		key, ok := keysMapping[id]
 		if !ok {
-			level.Error(c.logger).Log("msg", "keys mapping inconsistency found in memcached index cache client", "type", "series", "id", id)
+			level.Error(c.logger).Log("msg", "keys mapping inconsistency found in remote cache index cache client", "type", "series", "id", id)
 			continue
 		}
 
-		// Check if the key has been found in memcached. If not, we add it to the list
+		// Check if the key has been found in remote cache. If not, we add it to the list
 		// of missing keys.
 		value, ok := results[key]
 		if !ok {
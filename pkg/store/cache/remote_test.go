@@ -16,7 +16,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
-func TestMemcachedIndexCache_FetchMultiPostings(t *testing.T) {
+func TestRemoteIndexCache_FetchMultiPostings(t *testing.T) {
 	t.Parallel()
 
 	// Init some data to conveniently define test cases later one.
@@ -84,7 +84,7 @@ func TestMemcachedIndexCache_FetchMultiPostings(t *testing.T) {
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
 			memcached := newMockedMemcachedClient(testData.mockedErr)
-			c, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, nil)
+			c, err := NewRemoteIndexCache(log.NewNopLogger(), memcached, nil)
 			testutil.Ok(t, err)
 
 			// Store the postings expected before running the test.
@@ -107,7 +107,7 @@ func TestMemcachedIndexCache_FetchMultiPostings(t *testing.T) {
 	}
 }
 
-func TestMemcachedIndexCache_FetchMultiSeries(t *testing.T) {
+func TestRemoteIndexCache_FetchMultiSeries(t *testing.T) {
 	t.Parallel()
 
 	// Init some data to conveniently define test cases later one.
@@ -173,7 +173,7 @@ func TestMemcachedIndexCache_FetchMultiSeries(t *testing.T) {
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
 			memcached := newMockedMemcachedClient(testData.mockedErr)
-			c, err := NewMemcachedIndexCache(log.NewNopLogger(), memcached, nil)
+			c, err := NewRemoteIndexCache(log.NewNopLogger(), memcached, nil)
 			testutil.Ok(t, err)
 
 			// Store the series expected before running the test.
@@ -0,0 +1,123 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// chunkSample is a single sample of a raw chunk.
+type chunkSample struct {
+	t int64
+	v float64
+}
+
+// dedupOverlappingChunks merges the overlapping raw chunks of a single series, e.g. fetched from overlapping blocks
+// which were not vertically compacted yet, into chunks containing a single copy of each sample. A sample seen
+// with the same timestamp in many chunks is taken from the chunk with the lowest min time.
+// Chunks are returned sorted by min time. Non-overlapping chunks are returned untouched, while series with
+// downsampled chunks are not deduplicated at all, as their aggregates can't be merged.
+func dedupOverlappingChunks(chks []storepb.AggrChunk) ([]storepb.AggrChunk, error) {
+	if len(chks) < 2 {
+		return chks, nil
+	}
+	for _, c := range chks {
+		if c.Raw == nil || c.Raw.Type != storepb.Chunk_XOR || c.Count != nil || c.Sum != nil || c.Min != nil || c.Max != nil || c.Counter != nil {
+			return chks, nil
+		}
+	}
+
+	sort.SliceStable(chks, func(i, j int) bool {
+		return chks[i].MinTime < chks[j].MinTime
+	})
+
+	out := make([]storepb.AggrChunk, 0, len(chks))
+	for i := 0; i < len(chks); {
+		// Find all the chunks overlapping with the first one, directly or through each other.
+		j, maxt := i+1, chks[i].MaxTime
+		for ; j < len(chks) && chks[j].MinTime <= maxt; j++ {
+			if chks[j].MaxTime > maxt {
+				maxt = chks[j].MaxTime
+			}
+		}
+		if j-i == 1 {
+			out = append(out, chks[i])
+			i = j
+			continue
+		}
+
+		merged, err := mergeChunksSamples(chks[i:j])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, merged...)
+		i = j
+	}
+	return out, nil
+}
+
+// mergeChunksSamples returns the unique samples of the given chunks, re-encoded into chunks of
+// max MaxSamplesPerChunk samples.
+func mergeChunksSamples(chks []storepb.AggrChunk) ([]storepb.AggrChunk, error) {
+	var samples []chunkSample
+	for _, c := range chks {
+		chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode chunk")
+		}
+		it := chk.Iterator(nil)
+		for it.Next() {
+			t, v := it.At()
+			samples = append(samples, chunkSample{t: t, v: v})
+		}
+		if it.Err() != nil {
+			return nil, errors.Wrap(it.Err(), "iterate chunk")
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].t < samples[j].t
+	})
+
+	var (
+		out  []storepb.AggrChunk
+		chk  *chunkenc.XORChunk
+		app  chunkenc.Appender
+		mint int64
+		last = int64(-1)
+	)
+	flush := func() {
+		out = append(out, storepb.AggrChunk{
+			MinTime: mint,
+			MaxTime: last,
+			Raw:     &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()},
+		})
+	}
+	for i, s := range samples {
+		if i > 0 && s.t == last {
+			continue
+		}
+		if chk == nil || chk.NumSamples() >= MaxSamplesPerChunk {
+			if chk != nil {
+				flush()
+			}
+			chk = chunkenc.NewXORChunk()
+			var err error
+			if app, err = chk.Appender(); err != nil {
+				return nil, errors.Wrap(err, "create appender")
+			}
+			mint = s.t
+		}
+		app.Append(s.t, s.v)
+		last = s.t
+	}
+	if chk != nil {
+		flush()
+	}
+	return out, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestDedupOverlappingChunks(t *testing.T) {
+	newChunk := func(mint, maxt int64, v float64) storepb.AggrChunk {
+		chk := chunkenc.NewXORChunk()
+		app, err := chk.Appender()
+		testutil.Ok(t, err)
+		for ts := mint; ts <= maxt; ts++ {
+			app.Append(ts, v)
+		}
+		return storepb.AggrChunk{MinTime: mint, MaxTime: maxt, Raw: &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()}}
+	}
+	expand := func(chks []storepb.AggrChunk) (res []sample) {
+		for _, c := range chks {
+			chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
+			testutil.Ok(t, err)
+			samples := expandChunk(chk.Iterator(nil))
+			testutil.Assert(t, len(samples) <= MaxSamplesPerChunk, "unexpected chunk of %d samples", len(samples))
+			testutil.Equals(t, c.MinTime, samples[0].t)
+			testutil.Equals(t, c.MaxTime, samples[len(samples)-1].t)
+			res = append(res, samples...)
+		}
+		return res
+	}
+	samples := func(mint, maxt int64, v float64) (res []sample) {
+		for ts := mint; ts <= maxt; ts++ {
+			res = append(res, sample{t: ts, v: v})
+		}
+		return res
+	}
+
+	t.Run("should not change a single chunk", func(t *testing.T) {
+		chks := []storepb.AggrChunk{newChunk(0, 9, 1)}
+		res, err := dedupOverlappingChunks(chks)
+		testutil.Ok(t, err)
+		testutil.Equals(t, chks, res)
+	})
+
+	t.Run("should not change non overlapping chunks", func(t *testing.T) {
+		chks := []storepb.AggrChunk{newChunk(10, 19, 2), newChunk(0, 9, 1)}
+		res, err := dedupOverlappingChunks(chks)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []storepb.AggrChunk{newChunk(0, 9, 1), newChunk(10, 19, 2)}, res)
+	})
+
+	t.Run("should merge overlapping chunks", func(t *testing.T) {
+		chks := []storepb.AggrChunk{newChunk(0, 9, 1), newChunk(5, 14, 2), newChunk(14, 20, 3), newChunk(30, 39, 4)}
+		res, err := dedupOverlappingChunks(chks)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 2, len(res))
+		testutil.Equals(t, chks[3], res[1])
+
+		exp := append(samples(0, 9, 1), samples(10, 14, 2)...)
+		exp = append(exp, samples(15, 20, 3)...)
+		exp = append(exp, samples(30, 39, 4)...)
+		testutil.Equals(t, exp, expand(res))
+	})
+
+	t.Run("should split merged samples into many chunks", func(t *testing.T) {
+		chks := []storepb.AggrChunk{newChunk(0, 99, 1), newChunk(50, 299, 1)}
+		res, err := dedupOverlappingChunks(chks)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 3, len(res))
+		testutil.Equals(t, samples(0, 299, 1), expand(res))
+	})
+
+	t.Run("should not change downsampled chunks", func(t *testing.T) {
+		chks := []storepb.AggrChunk{newChunk(0, 9, 1), newChunk(5, 14, 2)}
+		chks[1].Count = chks[1].Raw
+		res, err := dedupOverlappingChunks(chks)
+		testutil.Ok(t, err)
+		testutil.Equals(t, chks, res)
+	})
+}
@@ -5,8 +5,11 @@ package hintspb
 
 import "github.com/oklog/ulid"
 
-func (m *SeriesResponseHints) AddQueriedBlock(id ulid.ULID) {
+func (m *SeriesResponseHints) AddQueriedBlock(id ulid.ULID, minTime, maxTime, resolution int64) {
 	m.QueriedBlocks = append(m.QueriedBlocks, Block{
-		Id: id.String(),
+		Id:         id.String(),
+		MinTime:    minTime,
+		MaxTime:    maxTime,
+		Resolution: resolution,
 	})
 }
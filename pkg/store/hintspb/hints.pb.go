@@ -5,12 +5,16 @@ package hintspb
 
 import (
 	fmt "fmt"
+
+	_ "github.com/gogo/protobuf/gogoproto"
+	proto "github.com/gogo/protobuf/proto"
+	github_com_gogo_protobuf_types "github.com/gogo/protobuf/types"
+
 	io "io"
 	math "math"
 	math_bits "math/bits"
+	time "time"
 
-	_ "github.com/gogo/protobuf/gogoproto"
-	proto "github.com/gogo/protobuf/proto"
 	storepb "github.com/thanos-io/thanos/pkg/store/storepb"
 )
 
@@ -18,6 +22,7 @@ import (
 var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
+var _ = time.Kitchen
 
 // This is a compile-time assertion to ensure that this generated file
 // is compatible with the proto package it is being compiled against.
@@ -30,6 +35,8 @@ type SeriesRequestHints struct {
 	/// labels to filter which blocks get queried. If the list is empty, no per-block filtering
 	/// is applied.
 	BlockMatchers []storepb.LabelMatcher `protobuf:"bytes,1,rep,name=block_matchers,json=blockMatchers,proto3" json:"block_matchers"`
+	/// enable_query_stats requests the statistics of the query to be returned in the response hints.
+	EnableQueryStats bool `protobuf:"varint,2,opt,name=enable_query_stats,json=enableQueryStats,proto3" json:"enable_query_stats,omitempty"`
 }
 
 func (m *SeriesRequestHints) Reset()         { *m = SeriesRequestHints{} }
@@ -68,6 +75,10 @@ var xxx_messageInfo_SeriesRequestHints proto.InternalMessageInfo
 type SeriesResponseHints struct {
 	/// queried_blocks is the list of blocks that have been queried.
 	QueriedBlocks []Block `protobuf:"bytes,1,rep,name=queried_blocks,json=queriedBlocks,proto3" json:"queried_blocks"`
+	/// query_stats are the statistics of the query, if requested.
+	QueryStats *QueryStats `protobuf:"bytes,2,opt,name=query_stats,json=queryStats,proto3" json:"query_stats,omitempty"`
+	/// stores_query_stats are the statistics of the query for each StoreAPI queried by a proxy, if requested.
+	StoresQueryStats []StoreQueryStats `protobuf:"bytes,3,rep,name=stores_query_stats,json=storesQueryStats,proto3" json:"stores_query_stats"`
 }
 
 func (m *SeriesResponseHints) Reset()         { *m = SeriesResponseHints{} }
@@ -105,6 +116,11 @@ var xxx_messageInfo_SeriesResponseHints proto.InternalMessageInfo
 
 type Block struct {
 	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	/// min_time and max_time are the time range of the block, in milliseconds, max_time being exclusive.
+	MinTime int64 `protobuf:"varint,2,opt,name=min_time,json=minTime,proto3" json:"min_time,omitempty"`
+	MaxTime int64 `protobuf:"varint,3,opt,name=max_time,json=maxTime,proto3" json:"max_time,omitempty"`
+	/// resolution is the downsampling resolution of the block, in milliseconds, 0 for raw data.
+	Resolution int64 `protobuf:"varint,4,opt,name=resolution,proto3" json:"resolution,omitempty"`
 }
 
 func (m *Block) Reset()         { *m = Block{} }
@@ -140,32 +156,181 @@ func (m *Block) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_Block proto.InternalMessageInfo
 
+/// QueryStats are the statistics of the data touched and fetched by a query.
+type QueryStats struct {
+	BlocksQueried          int64 `protobuf:"varint,1,opt,name=blocks_queried,json=blocksQueried,proto3" json:"blocks_queried,omitempty"`
+	MergedSeriesCount      int64 `protobuf:"varint,2,opt,name=merged_series_count,json=mergedSeriesCount,proto3" json:"merged_series_count,omitempty"`
+	MergedChunksCount      int64 `protobuf:"varint,3,opt,name=merged_chunks_count,json=mergedChunksCount,proto3" json:"merged_chunks_count,omitempty"`
+	PostingsTouched        int64 `protobuf:"varint,4,opt,name=postings_touched,json=postingsTouched,proto3" json:"postings_touched,omitempty"`
+	PostingsTouchedSizeSum int64 `protobuf:"varint,5,opt,name=postings_touched_size_sum,json=postingsTouchedSizeSum,proto3" json:"postings_touched_size_sum,omitempty"`
+	PostingsToFetch        int64 `protobuf:"varint,6,opt,name=postings_to_fetch,json=postingsToFetch,proto3" json:"postings_to_fetch,omitempty"`
+	PostingsFetched        int64 `protobuf:"varint,7,opt,name=postings_fetched,json=postingsFetched,proto3" json:"postings_fetched,omitempty"`
+	PostingsFetchedSizeSum int64 `protobuf:"varint,8,opt,name=postings_fetched_size_sum,json=postingsFetchedSizeSum,proto3" json:"postings_fetched_size_sum,omitempty"`
+	PostingsFetchCount     int64 `protobuf:"varint,9,opt,name=postings_fetch_count,json=postingsFetchCount,proto3" json:"postings_fetch_count,omitempty"`
+	SeriesTouched          int64 `protobuf:"varint,10,opt,name=series_touched,json=seriesTouched,proto3" json:"series_touched,omitempty"`
+	SeriesTouchedSizeSum   int64 `protobuf:"varint,11,opt,name=series_touched_size_sum,json=seriesTouchedSizeSum,proto3" json:"series_touched_size_sum,omitempty"`
+	SeriesFetched          int64 `protobuf:"varint,12,opt,name=series_fetched,json=seriesFetched,proto3" json:"series_fetched,omitempty"`
+	SeriesFetchedSizeSum   int64 `protobuf:"varint,13,opt,name=series_fetched_size_sum,json=seriesFetchedSizeSum,proto3" json:"series_fetched_size_sum,omitempty"`
+	SeriesFetchCount       int64 `protobuf:"varint,14,opt,name=series_fetch_count,json=seriesFetchCount,proto3" json:"series_fetch_count,omitempty"`
+	ChunksTouched          int64 `protobuf:"varint,15,opt,name=chunks_touched,json=chunksTouched,proto3" json:"chunks_touched,omitempty"`
+	ChunksTouchedSizeSum   int64 `protobuf:"varint,16,opt,name=chunks_touched_size_sum,json=chunksTouchedSizeSum,proto3" json:"chunks_touched_size_sum,omitempty"`
+	ChunksFetched          int64 `protobuf:"varint,17,opt,name=chunks_fetched,json=chunksFetched,proto3" json:"chunks_fetched,omitempty"`
+	ChunksFetchedSizeSum   int64 `protobuf:"varint,18,opt,name=chunks_fetched_size_sum,json=chunksFetchedSizeSum,proto3" json:"chunks_fetched_size_sum,omitempty"`
+	ChunksFetchCount       int64 `protobuf:"varint,19,opt,name=chunks_fetch_count,json=chunksFetchCount,proto3" json:"chunks_fetch_count,omitempty"`
+	/// data_downloaded_size_sum is the size of the postings, series and chunks fetched from the object storage.
+	DataDownloadedSizeSum int64         `protobuf:"varint,20,opt,name=data_downloaded_size_sum,json=dataDownloadedSizeSum,proto3" json:"data_downloaded_size_sum,omitempty"`
+	GetAllDuration        time.Duration `protobuf:"bytes,21,opt,name=get_all_duration,json=getAllDuration,proto3,stdduration" json:"get_all_duration"`
+	MergeDuration         time.Duration `protobuf:"bytes,22,opt,name=merge_duration,json=mergeDuration,proto3,stdduration" json:"merge_duration"`
+}
+
+func (m *QueryStats) Reset()         { *m = QueryStats{} }
+func (m *QueryStats) String() string { return proto.CompactTextString(m) }
+func (*QueryStats) ProtoMessage()    {}
+func (*QueryStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b82aa23c4c11e83f, []int{3}
+}
+func (m *QueryStats) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *QueryStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_QueryStats.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *QueryStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryStats.Merge(m, src)
+}
+func (m *QueryStats) XXX_Size() int {
+	return m.Size()
+}
+func (m *QueryStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryStats proto.InternalMessageInfo
+
+/// StoreQueryStats are the statistics of a query for a StoreAPI queried by a proxy.
+type StoreQueryStats struct {
+	/// store is the name of the StoreAPI.
+	Store          string `protobuf:"bytes,1,opt,name=store,proto3" json:"store,omitempty"`
+	SeriesReceived int64  `protobuf:"varint,2,opt,name=series_received,json=seriesReceived,proto3" json:"series_received,omitempty"`
+	ChunksReceived int64  `protobuf:"varint,3,opt,name=chunks_received,json=chunksReceived,proto3" json:"chunks_received,omitempty"`
+	/// duration is the wall time of the Series request to the StoreAPI.
+	Duration time.Duration `protobuf:"bytes,4,opt,name=duration,proto3,stdduration" json:"duration"`
+	/// query_stats are the statistics returned by the StoreAPI, if any.
+	QueryStats *QueryStats `protobuf:"bytes,5,opt,name=query_stats,json=queryStats,proto3" json:"query_stats,omitempty"`
+	/// queried_blocks are the blocks queried by the StoreAPI, if it returns them.
+	QueriedBlocks []Block `protobuf:"bytes,6,rep,name=queried_blocks,json=queriedBlocks,proto3" json:"queried_blocks"`
+	/// min_time and max_time are the time range of the data of the StoreAPI, as advertised in its Info.
+	MinTime int64 `protobuf:"varint,7,opt,name=min_time,json=minTime,proto3" json:"min_time,omitempty"`
+	MaxTime int64 `protobuf:"varint,8,opt,name=max_time,json=maxTime,proto3" json:"max_time,omitempty"`
+}
+
+func (m *StoreQueryStats) Reset()         { *m = StoreQueryStats{} }
+func (m *StoreQueryStats) String() string { return proto.CompactTextString(m) }
+func (*StoreQueryStats) ProtoMessage()    {}
+func (*StoreQueryStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b82aa23c4c11e83f, []int{4}
+}
+func (m *StoreQueryStats) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *StoreQueryStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_StoreQueryStats.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *StoreQueryStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StoreQueryStats.Merge(m, src)
+}
+func (m *StoreQueryStats) XXX_Size() int {
+	return m.Size()
+}
+func (m *StoreQueryStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_StoreQueryStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StoreQueryStats proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterType((*SeriesRequestHints)(nil), "hintspb.SeriesRequestHints")
 	proto.RegisterType((*SeriesResponseHints)(nil), "hintspb.SeriesResponseHints")
 	proto.RegisterType((*Block)(nil), "hintspb.Block")
+	proto.RegisterType((*QueryStats)(nil), "hintspb.QueryStats")
+	proto.RegisterType((*StoreQueryStats)(nil), "hintspb.StoreQueryStats")
 }
 
 func init() { proto.RegisterFile("store/hintspb/hints.proto", fileDescriptor_b82aa23c4c11e83f) }
 
 var fileDescriptor_b82aa23c4c11e83f = []byte{
-	// 256 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x92, 0x2c, 0x2e, 0xc9, 0x2f,
-	0x4a, 0xd5, 0xcf, 0xc8, 0xcc, 0x2b, 0x29, 0x2e, 0x48, 0x82, 0xd0, 0x7a, 0x05, 0x45, 0xf9, 0x25,
-	0xf9, 0x42, 0xec, 0x50, 0x41, 0x29, 0x91, 0xf4, 0xfc, 0xf4, 0x7c, 0xb0, 0x98, 0x3e, 0x88, 0x05,
-	0x91, 0x96, 0x82, 0xea, 0x04, 0x93, 0x05, 0x49, 0xfa, 0x25, 0x95, 0x05, 0xa9, 0x50, 0x9d, 0x4a,
-	0xe1, 0x5c, 0x42, 0xc1, 0xa9, 0x45, 0x99, 0xa9, 0xc5, 0x41, 0xa9, 0x85, 0xa5, 0xa9, 0xc5, 0x25,
-	0x1e, 0x20, 0x83, 0x84, 0x1c, 0xb9, 0xf8, 0x92, 0x72, 0xf2, 0x93, 0xb3, 0xe3, 0x73, 0x13, 0x4b,
-	0x92, 0x33, 0x52, 0x8b, 0x8a, 0x25, 0x18, 0x15, 0x98, 0x35, 0xb8, 0x8d, 0x44, 0xf4, 0x4a, 0x32,
-	0x12, 0xf3, 0xf2, 0x8b, 0xf5, 0x7c, 0x12, 0x93, 0x52, 0x73, 0x7c, 0x21, 0x92, 0x4e, 0x2c, 0x27,
-	0xee, 0xc9, 0x33, 0x04, 0xf1, 0x82, 0x75, 0x40, 0xc5, 0x8a, 0x95, 0x82, 0xb8, 0x84, 0x61, 0x06,
-	0x17, 0x17, 0xe4, 0xe7, 0x15, 0xa7, 0x42, 0x4c, 0xb6, 0xe6, 0xe2, 0x2b, 0x2c, 0x05, 0x89, 0xa7,
-	0xc4, 0x83, 0xd5, 0xc3, 0x4c, 0xe6, 0xd3, 0x83, 0x7a, 0x41, 0xcf, 0x09, 0x24, 0x0c, 0x33, 0x13,
-	0xaa, 0x16, 0x2c, 0x56, 0xac, 0x24, 0xce, 0xc5, 0x0a, 0x66, 0x09, 0xf1, 0x71, 0x31, 0x65, 0xa6,
-	0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x31, 0x65, 0xa6, 0x38, 0xa9, 0x9e, 0x78, 0x28, 0xc7,
-	0x70, 0xe2, 0x91, 0x1c, 0xe3, 0x85, 0x47, 0x72, 0x8c, 0x0f, 0x1e, 0xc9, 0x31, 0x4e, 0x78, 0x2c,
-	0xc7, 0x70, 0xe1, 0xb1, 0x1c, 0xc3, 0x8d, 0xc7, 0x72, 0x0c, 0x51, 0xb0, 0xd0, 0x49, 0x62, 0x03,
-	0xfb, 0xd9, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x89, 0x23, 0x13, 0x63, 0x4a, 0x01, 0x00, 0x00,
+	// 839 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0x4d, 0x6f, 0xdb, 0x46,
+	0x10, 0x15, 0x2d, 0x7f, 0x28, 0xe3, 0x9a, 0x96, 0xd7, 0x4a, 0x4a, 0xfb, 0xc0, 0x18, 0x06, 0x8c,
+	0xba, 0x45, 0x40, 0x15, 0x69, 0x8b, 0xa2, 0xe8, 0xa1, 0x88, 0x13, 0x04, 0x45, 0x91, 0x1c, 0x4a,
+	0xe5, 0xd4, 0x0b, 0x41, 0x89, 0x13, 0x6a, 0x11, 0x92, 0x2b, 0x73, 0x97, 0x6d, 0x92, 0x7b, 0xef,
+	0x3d, 0xf6, 0x27, 0xf9, 0xe8, 0x53, 0xd1, 0x53, 0x3f, 0x2c, 0xf4, 0x7f, 0x14, 0xdc, 0x0f, 0x72,
+	0x29, 0x21, 0x80, 0x2e, 0xb6, 0x34, 0xef, 0xbd, 0x99, 0xf7, 0x76, 0xe9, 0xa1, 0xe1, 0x84, 0x0b,
+	0x56, 0xe2, 0x78, 0x4e, 0x0b, 0xc1, 0x17, 0x53, 0xf5, 0x3b, 0x58, 0x94, 0x4c, 0x30, 0xb2, 0xa7,
+	0x8b, 0xa7, 0xa3, 0x94, 0xa5, 0x4c, 0xd6, 0xc6, 0xf5, 0x27, 0x05, 0x9f, 0x6a, 0xa5, 0xfc, 0xb9,
+	0x98, 0x8e, 0xc5, 0xbb, 0x05, 0x6a, 0xe5, 0xa9, 0x9f, 0x32, 0x96, 0x66, 0x38, 0x96, 0xdf, 0xa6,
+	0xd5, 0xeb, 0x71, 0x52, 0x95, 0xb1, 0xa0, 0xac, 0x50, 0xf8, 0xf9, 0xaf, 0x0e, 0x90, 0x09, 0x96,
+	0x14, 0x79, 0x88, 0xd7, 0x15, 0x72, 0xf1, 0x7d, 0x3d, 0x89, 0x3c, 0x01, 0x77, 0x9a, 0xb1, 0xd9,
+	0x9b, 0x28, 0x8f, 0xc5, 0x6c, 0x8e, 0x25, 0xf7, 0x9c, 0xb3, 0xfe, 0xe5, 0xfe, 0xe3, 0x51, 0x20,
+	0xe6, 0x71, 0xc1, 0x78, 0xf0, 0x22, 0x9e, 0x62, 0xf6, 0x52, 0x81, 0x57, 0xdb, 0x37, 0x7f, 0x3d,
+	0xec, 0x85, 0x07, 0x52, 0xa1, 0x6b, 0x9c, 0x3c, 0x02, 0x82, 0x45, 0x3c, 0xcd, 0x30, 0xba, 0xae,
+	0xb0, 0x7c, 0x17, 0x71, 0x11, 0x0b, 0xee, 0x6d, 0x9d, 0x39, 0x97, 0x83, 0x70, 0xa8, 0x90, 0x1f,
+	0x6b, 0x60, 0x52, 0xd7, 0xcf, 0xff, 0x70, 0xe0, 0xd8, 0xf8, 0xe0, 0x0b, 0x56, 0x70, 0x54, 0x46,
+	0xbe, 0x05, 0xb7, 0x96, 0x53, 0x4c, 0x22, 0xd9, 0xde, 0x18, 0x71, 0x03, 0x7d, 0x24, 0xc1, 0x55,
+	0x5d, 0x36, 0x16, 0x34, 0x57, 0xd6, 0x38, 0xf9, 0x12, 0xf6, 0x57, 0x67, 0xef, 0x3f, 0x3e, 0x6e,
+	0x94, 0xed, 0xf8, 0x10, 0xae, 0x9b, 0xcf, 0xe4, 0x05, 0x10, 0x79, 0x92, 0xbc, 0x63, 0xbc, 0x2f,
+	0xc7, 0x7a, 0x8d, 0x78, 0x52, 0x53, 0xda, 0x0e, 0xda, 0xc0, 0x50, 0x29, 0xad, 0x60, 0x39, 0xec,
+	0x48, 0x37, 0xc4, 0x85, 0x2d, 0x9a, 0x78, 0xce, 0x99, 0x73, 0x79, 0x2f, 0xdc, 0xa2, 0x09, 0x39,
+	0x81, 0x41, 0x4e, 0x8b, 0x48, 0xd0, 0x1c, 0xa5, 0xb3, 0x7e, 0xb8, 0x97, 0xd3, 0xe2, 0x15, 0xcd,
+	0x51, 0x42, 0xf1, 0x5b, 0x05, 0xf5, 0x35, 0x14, 0xbf, 0x95, 0x90, 0x0f, 0x50, 0x22, 0x67, 0x59,
+	0x55, 0xdf, 0xa1, 0xb7, 0x2d, 0x41, 0xab, 0x72, 0xfe, 0xdf, 0x00, 0xa0, 0x9d, 0x4e, 0x2e, 0xf4,
+	0x3d, 0xaa, 0x2c, 0x14, 0x95, 0x81, 0xbe, 0xbe, 0x2b, 0xe9, 0x93, 0x62, 0x42, 0x02, 0x38, 0xce,
+	0xb1, 0x4c, 0x31, 0x89, 0x78, 0x5d, 0xe0, 0xd1, 0x8c, 0x55, 0x85, 0xd0, 0xb6, 0x8e, 0x14, 0xa4,
+	0x6e, 0xe7, 0x69, 0x0d, 0x58, 0xfc, 0xd9, 0xbc, 0x2a, 0xde, 0x18, 0x7e, 0xdf, 0xe6, 0x3f, 0x95,
+	0x88, 0xe2, 0x7f, 0x0a, 0xc3, 0x05, 0xe3, 0x82, 0x16, 0x29, 0x8f, 0x04, 0xab, 0x66, 0x73, 0x4c,
+	0xb4, 0xf7, 0x43, 0x53, 0x7f, 0xa5, 0xca, 0xe4, 0x1b, 0x38, 0x59, 0xa5, 0x46, 0x9c, 0xbe, 0xc7,
+	0x88, 0x57, 0xb9, 0xb7, 0x23, 0x35, 0x0f, 0x56, 0x34, 0x13, 0xfa, 0x1e, 0x27, 0x55, 0x4e, 0x3e,
+	0x83, 0x23, 0x4b, 0x1a, 0xbd, 0x46, 0x31, 0x9b, 0x7b, 0xbb, 0xab, 0x63, 0x9e, 0xd7, 0xe5, 0x8e,
+	0x23, 0x49, 0xc4, 0xc4, 0xdb, 0xeb, 0x52, 0x9f, 0xa3, 0x58, 0x73, 0xa4, 0xa9, 0xad, 0xa3, 0x41,
+	0xd7, 0x91, 0xd6, 0x18, 0x47, 0x9f, 0xc3, 0xa8, 0x2b, 0xd5, 0x07, 0x75, 0x4f, 0xaa, 0x48, 0x47,
+	0xa5, 0x4e, 0xea, 0x02, 0x5c, 0x7d, 0x05, 0xe6, 0x9c, 0x40, 0x5d, 0x98, 0xaa, 0x9a, 0x53, 0xfa,
+	0x0a, 0x3e, 0xee, 0xd2, 0x5a, 0x47, 0xfb, 0x92, 0x3f, 0xea, 0xf0, 0x8d, 0x9f, 0xb6, 0xbb, 0xc9,
+	0xfc, 0x91, 0xdd, 0xdd, 0x24, 0x6e, 0xbb, 0xaf, 0xe5, 0x3d, 0xb0, 0xbb, 0xaf, 0xa4, 0x7d, 0x04,
+	0xc4, 0x96, 0xe9, 0xac, 0xae, 0x54, 0x0c, 0x2d, 0x45, 0x93, 0x54, 0x3f, 0x3c, 0x26, 0xe9, 0xa1,
+	0xf2, 0xa2, 0xaa, 0x56, 0xd2, 0x2e, 0xad, 0xf5, 0x32, 0x54, 0x5e, 0x3a, 0x7c, 0x2b, 0xa9, 0x96,
+	0x99, 0xa4, 0x47, 0x76, 0x77, 0x2b, 0x69, 0x97, 0xd6, 0x76, 0x27, 0x76, 0xf7, 0xf5, 0xa4, 0xb6,
+	0x4c, 0x27, 0x3d, 0x56, 0x49, 0x2d, 0x85, 0x4a, 0xfa, 0x35, 0x78, 0x49, 0x2c, 0xe2, 0x28, 0x61,
+	0xbf, 0x14, 0x19, 0x8b, 0x13, 0x7b, 0xca, 0x48, 0x6a, 0xee, 0xd7, 0xf8, 0xb3, 0x06, 0x36, 0x63,
+	0x5e, 0xc2, 0x30, 0x45, 0x11, 0xc5, 0x59, 0x16, 0x99, 0xb5, 0xed, 0xdd, 0x97, 0x4b, 0xec, 0x24,
+	0x50, 0x7b, 0x3d, 0x30, 0x7b, 0x3d, 0x78, 0xa6, 0x09, 0x57, 0x83, 0x7a, 0x11, 0xfd, 0xfe, 0xf7,
+	0x43, 0x27, 0x74, 0x53, 0x14, 0x4f, 0xb2, 0xcc, 0x20, 0xe4, 0x07, 0x70, 0xe5, 0x9f, 0x66, 0xdb,
+	0xec, 0xc1, 0xe6, 0xcd, 0x0e, 0xa4, 0xd4, 0x00, 0xe7, 0xcb, 0x2d, 0x38, 0x5c, 0x59, 0x81, 0x64,
+	0x04, 0x3b, 0x72, 0xfd, 0xe9, 0x25, 0xa7, 0xbe, 0x90, 0x4f, 0xe0, 0x50, 0x3f, 0x15, 0x25, 0xce,
+	0x90, 0xfe, 0x8c, 0x89, 0xde, 0x2b, 0xfa, 0x51, 0x0c, 0x75, 0xb5, 0x26, 0xea, 0x43, 0x6d, 0x88,
+	0x6a, 0xa1, 0xe8, 0x9b, 0x6c, 0x88, 0xdf, 0xc1, 0xa0, 0x49, 0xb0, 0xbd, 0x79, 0x82, 0x46, 0xb4,
+	0xfa, 0x5e, 0xd8, 0xd9, 0xec, 0xbd, 0xb0, 0xfe, 0x2a, 0xda, 0xdd, 0xfc, 0x55, 0x64, 0x6f, 0xfb,
+	0xbd, 0x0f, 0x6f, 0xfb, 0x41, 0x67, 0xdb, 0x5f, 0x5d, 0xdc, 0xfc, 0xeb, 0xf7, 0x6e, 0xee, 0x7c,
+	0xe7, 0xf6, 0xce, 0x77, 0xfe, 0xb9, 0xf3, 0x9d, 0xdf, 0x96, 0x7e, 0xef, 0x76, 0xe9, 0xf7, 0xfe,
+	0x5c, 0xfa, 0xbd, 0x9f, 0xcc, 0x7f, 0x05, 0xd3, 0x5d, 0x19, 0xfb, 0x8b, 0xff, 0x07, 0x00, 0x27,
+	0x23, 0xb0, 0x23, 0x42, 0x08, 0x00, 0x00,
 }
 
 func (m *SeriesRequestHints) Marshal() (dAtA []byte, err error) {
@@ -188,6 +353,16 @@ func (m *SeriesRequestHints) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.EnableQueryStats {
+		i--
+		if m.EnableQueryStats {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x10
+	}
 	if len(m.BlockMatchers) > 0 {
 		for iNdEx := len(m.BlockMatchers) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -225,6 +400,32 @@ func (m *SeriesResponseHints) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.StoresQueryStats) > 0 {
+		for iNdEx := len(m.StoresQueryStats) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.StoresQueryStats[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintHints(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.QueryStats != nil {
+		{
+			size, err := m.QueryStats.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintHints(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x12
+	}
 	if len(m.QueriedBlocks) > 0 {
 		for iNdEx := len(m.QueriedBlocks) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -262,6 +463,21 @@ func (m *Block) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Resolution != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.Resolution))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.MaxTime != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.MaxTime))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.MinTime != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.MinTime))
+		i--
+		dAtA[i] = 0x10
+	}
 	if len(m.Id) > 0 {
 		i -= len(m.Id)
 		copy(dAtA[i:], m.Id)
@@ -272,6 +488,243 @@ func (m *Block) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *QueryStats) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *QueryStats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *QueryStats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	n2, err2 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.MergeDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.MergeDuration):])
+	if err2 != nil {
+		return 0, err2
+	}
+	i -= n2
+	i = encodeVarintHints(dAtA, i, uint64(n2))
+	i--
+	dAtA[i] = 0x1
+	i--
+	dAtA[i] = 0xb2
+	n3, err3 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.GetAllDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.GetAllDuration):])
+	if err3 != nil {
+		return 0, err3
+	}
+	i -= n3
+	i = encodeVarintHints(dAtA, i, uint64(n3))
+	i--
+	dAtA[i] = 0x1
+	i--
+	dAtA[i] = 0xaa
+	if m.DataDownloadedSizeSum != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.DataDownloadedSizeSum))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0xa0
+	}
+	if m.ChunksFetchCount != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksFetchCount))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x98
+	}
+	if m.ChunksFetchedSizeSum != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksFetchedSizeSum))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x90
+	}
+	if m.ChunksFetched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksFetched))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x88
+	}
+	if m.ChunksTouchedSizeSum != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksTouchedSizeSum))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x80
+	}
+	if m.ChunksTouched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksTouched))
+		i--
+		dAtA[i] = 0x78
+	}
+	if m.SeriesFetchCount != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesFetchCount))
+		i--
+		dAtA[i] = 0x70
+	}
+	if m.SeriesFetchedSizeSum != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesFetchedSizeSum))
+		i--
+		dAtA[i] = 0x68
+	}
+	if m.SeriesFetched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesFetched))
+		i--
+		dAtA[i] = 0x60
+	}
+	if m.SeriesTouchedSizeSum != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesTouchedSizeSum))
+		i--
+		dAtA[i] = 0x58
+	}
+	if m.SeriesTouched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesTouched))
+		i--
+		dAtA[i] = 0x50
+	}
+	if m.PostingsFetchCount != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsFetchCount))
+		i--
+		dAtA[i] = 0x48
+	}
+	if m.PostingsFetchedSizeSum != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsFetchedSizeSum))
+		i--
+		dAtA[i] = 0x40
+	}
+	if m.PostingsFetched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsFetched))
+		i--
+		dAtA[i] = 0x38
+	}
+	if m.PostingsToFetch != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsToFetch))
+		i--
+		dAtA[i] = 0x30
+	}
+	if m.PostingsTouchedSizeSum != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsTouchedSizeSum))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.PostingsTouched != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.PostingsTouched))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.MergedChunksCount != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.MergedChunksCount))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.MergedSeriesCount != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.MergedSeriesCount))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.BlocksQueried != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.BlocksQueried))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *StoreQueryStats) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *StoreQueryStats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *StoreQueryStats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.MaxTime != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.MaxTime))
+		i--
+		dAtA[i] = 0x40
+	}
+	if m.MinTime != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.MinTime))
+		i--
+		dAtA[i] = 0x38
+	}
+	if len(m.QueriedBlocks) > 0 {
+		for iNdEx := len(m.QueriedBlocks) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.QueriedBlocks[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintHints(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if m.QueryStats != nil {
+		{
+			size, err := m.QueryStats.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintHints(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x2a
+	}
+	n5, err5 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.Duration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.Duration):])
+	if err5 != nil {
+		return 0, err5
+	}
+	i -= n5
+	i = encodeVarintHints(dAtA, i, uint64(n5))
+	i--
+	dAtA[i] = 0x22
+	if m.ChunksReceived != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.ChunksReceived))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.SeriesReceived != 0 {
+		i = encodeVarintHints(dAtA, i, uint64(m.SeriesReceived))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Store) > 0 {
+		i -= len(m.Store)
+		copy(dAtA[i:], m.Store)
+		i = encodeVarintHints(dAtA, i, uint64(len(m.Store)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintHints(dAtA []byte, offset int, v uint64) int {
 	offset -= sovHints(v)
 	base := offset
@@ -295,6 +748,9 @@ func (m *SeriesRequestHints) Size() (n int) {
 			n += 1 + l + sovHints(uint64(l))
 		}
 	}
+	if m.EnableQueryStats {
+		n += 2
+	}
 	return n
 }
 
@@ -310,6 +766,16 @@ func (m *SeriesResponseHints) Size() (n int) {
 			n += 1 + l + sovHints(uint64(l))
 		}
 	}
+	if m.QueryStats != nil {
+		l = m.QueryStats.Size()
+		n += 1 + l + sovHints(uint64(l))
+	}
+	if len(m.StoresQueryStats) > 0 {
+		for _, e := range m.StoresQueryStats {
+			l = e.Size()
+			n += 1 + l + sovHints(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -323,6 +789,125 @@ func (m *Block) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovHints(uint64(l))
 	}
+	if m.MinTime != 0 {
+		n += 1 + sovHints(uint64(m.MinTime))
+	}
+	if m.MaxTime != 0 {
+		n += 1 + sovHints(uint64(m.MaxTime))
+	}
+	if m.Resolution != 0 {
+		n += 1 + sovHints(uint64(m.Resolution))
+	}
+	return n
+}
+
+func (m *QueryStats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.BlocksQueried != 0 {
+		n += 1 + sovHints(uint64(m.BlocksQueried))
+	}
+	if m.MergedSeriesCount != 0 {
+		n += 1 + sovHints(uint64(m.MergedSeriesCount))
+	}
+	if m.MergedChunksCount != 0 {
+		n += 1 + sovHints(uint64(m.MergedChunksCount))
+	}
+	if m.PostingsTouched != 0 {
+		n += 1 + sovHints(uint64(m.PostingsTouched))
+	}
+	if m.PostingsTouchedSizeSum != 0 {
+		n += 1 + sovHints(uint64(m.PostingsTouchedSizeSum))
+	}
+	if m.PostingsToFetch != 0 {
+		n += 1 + sovHints(uint64(m.PostingsToFetch))
+	}
+	if m.PostingsFetched != 0 {
+		n += 1 + sovHints(uint64(m.PostingsFetched))
+	}
+	if m.PostingsFetchedSizeSum != 0 {
+		n += 1 + sovHints(uint64(m.PostingsFetchedSizeSum))
+	}
+	if m.PostingsFetchCount != 0 {
+		n += 1 + sovHints(uint64(m.PostingsFetchCount))
+	}
+	if m.SeriesTouched != 0 {
+		n += 1 + sovHints(uint64(m.SeriesTouched))
+	}
+	if m.SeriesTouchedSizeSum != 0 {
+		n += 1 + sovHints(uint64(m.SeriesTouchedSizeSum))
+	}
+	if m.SeriesFetched != 0 {
+		n += 1 + sovHints(uint64(m.SeriesFetched))
+	}
+	if m.SeriesFetchedSizeSum != 0 {
+		n += 1 + sovHints(uint64(m.SeriesFetchedSizeSum))
+	}
+	if m.SeriesFetchCount != 0 {
+		n += 1 + sovHints(uint64(m.SeriesFetchCount))
+	}
+	if m.ChunksTouched != 0 {
+		n += 1 + sovHints(uint64(m.ChunksTouched))
+	}
+	if m.ChunksTouchedSizeSum != 0 {
+		n += 2 + sovHints(uint64(m.ChunksTouchedSizeSum))
+	}
+	if m.ChunksFetched != 0 {
+		n += 2 + sovHints(uint64(m.ChunksFetched))
+	}
+	if m.ChunksFetchedSizeSum != 0 {
+		n += 2 + sovHints(uint64(m.ChunksFetchedSizeSum))
+	}
+	if m.ChunksFetchCount != 0 {
+		n += 2 + sovHints(uint64(m.ChunksFetchCount))
+	}
+	if m.DataDownloadedSizeSum != 0 {
+		n += 2 + sovHints(uint64(m.DataDownloadedSizeSum))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.GetAllDuration)
+	n += 2 + l + sovHints(uint64(l))
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.MergeDuration)
+	n += 2 + l + sovHints(uint64(l))
+	return n
+}
+
+func (m *StoreQueryStats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Store)
+	if l > 0 {
+		n += 1 + l + sovHints(uint64(l))
+	}
+	if m.SeriesReceived != 0 {
+		n += 1 + sovHints(uint64(m.SeriesReceived))
+	}
+	if m.ChunksReceived != 0 {
+		n += 1 + sovHints(uint64(m.ChunksReceived))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.Duration)
+	n += 1 + l + sovHints(uint64(l))
+	if m.QueryStats != nil {
+		l = m.QueryStats.Size()
+		n += 1 + l + sovHints(uint64(l))
+	}
+	if len(m.QueriedBlocks) > 0 {
+		for _, e := range m.QueriedBlocks {
+			l = e.Size()
+			n += 1 + l + sovHints(uint64(l))
+		}
+	}
+	if m.MinTime != 0 {
+		n += 1 + sovHints(uint64(m.MinTime))
+	}
+	if m.MaxTime != 0 {
+		n += 1 + sovHints(uint64(m.MaxTime))
+	}
 	return n
 }
 
@@ -395,11 +980,31 @@ func (m *SeriesRequestHints) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
-		default:
-			iNdEx = preIndex
-			skippy, err := skipHints(dAtA[iNdEx:])
-			if err != nil {
-				return err
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EnableQueryStats", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.EnableQueryStats = bool(v != 0)
+		default:
+			iNdEx = preIndex
+			skippy, err := skipHints(dAtA[iNdEx:])
+			if err != nil {
+				return err
 			}
 			if skippy < 0 {
 				return ErrInvalidLengthHints
@@ -482,6 +1087,76 @@ func (m *SeriesResponseHints) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueryStats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.QueryStats == nil {
+				m.QueryStats = &QueryStats{}
+			}
+			if err := m.QueryStats.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StoresQueryStats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.StoresQueryStats = append(m.StoresQueryStats, StoreQueryStats{})
+			if err := m.StoresQueryStats[len(m.StoresQueryStats)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipHints(dAtA[iNdEx:])
@@ -567,6 +1242,826 @@ func (m *Block) Unmarshal(dAtA []byte) error {
 			}
 			m.Id = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MinTime", wireType)
+			}
+			m.MinTime = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MinTime |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxTime", wireType)
+			}
+			m.MaxTime = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxTime |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Resolution", wireType)
+			}
+			m.Resolution = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Resolution |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipHints(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthHints
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthHints
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *QueryStats) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowHints
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: QueryStats: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: QueryStats: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlocksQueried", wireType)
+			}
+			m.BlocksQueried = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.BlocksQueried |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MergedSeriesCount", wireType)
+			}
+			m.MergedSeriesCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MergedSeriesCount |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MergedChunksCount", wireType)
+			}
+			m.MergedChunksCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MergedChunksCount |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsTouched", wireType)
+			}
+			m.PostingsTouched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsTouched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsTouchedSizeSum", wireType)
+			}
+			m.PostingsTouchedSizeSum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsTouchedSizeSum |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsToFetch", wireType)
+			}
+			m.PostingsToFetch = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsToFetch |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsFetched", wireType)
+			}
+			m.PostingsFetched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsFetched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsFetchedSizeSum", wireType)
+			}
+			m.PostingsFetchedSizeSum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsFetchedSizeSum |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PostingsFetchCount", wireType)
+			}
+			m.PostingsFetchCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PostingsFetchCount |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesTouched", wireType)
+			}
+			m.SeriesTouched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesTouched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesTouchedSizeSum", wireType)
+			}
+			m.SeriesTouchedSizeSum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesTouchedSizeSum |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 12:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesFetched", wireType)
+			}
+			m.SeriesFetched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesFetched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 13:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesFetchedSizeSum", wireType)
+			}
+			m.SeriesFetchedSizeSum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesFetchedSizeSum |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 14:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesFetchCount", wireType)
+			}
+			m.SeriesFetchCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesFetchCount |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 15:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksTouched", wireType)
+			}
+			m.ChunksTouched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksTouched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 16:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksTouchedSizeSum", wireType)
+			}
+			m.ChunksTouchedSizeSum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksTouchedSizeSum |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 17:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksFetched", wireType)
+			}
+			m.ChunksFetched = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksFetched |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 18:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksFetchedSizeSum", wireType)
+			}
+			m.ChunksFetchedSizeSum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksFetchedSizeSum |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 19:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksFetchCount", wireType)
+			}
+			m.ChunksFetchCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksFetchCount |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 20:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DataDownloadedSizeSum", wireType)
+			}
+			m.DataDownloadedSizeSum = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.DataDownloadedSizeSum |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 21:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field GetAllDuration", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.GetAllDuration, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 22:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MergeDuration", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.MergeDuration, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipHints(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthHints
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthHints
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *StoreQueryStats) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowHints
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: StoreQueryStats: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: StoreQueryStats: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Store", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Store = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesReceived", wireType)
+			}
+			m.SeriesReceived = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesReceived |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunksReceived", wireType)
+			}
+			m.ChunksReceived = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunksReceived |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Duration", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.Duration, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueryStats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.QueryStats == nil {
+				m.QueryStats = &QueryStats{}
+			}
+			if err := m.QueryStats.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueriedBlocks", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthHints
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthHints
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.QueriedBlocks = append(m.QueriedBlocks, Block{})
+			if err := m.QueriedBlocks[len(m.QueriedBlocks)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MinTime", wireType)
+			}
+			m.MinTime = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MinTime |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxTime", wireType)
+			}
+			m.MaxTime = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHints
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxTime |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipHints(dAtA[iNdEx:])
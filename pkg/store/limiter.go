@@ -6,6 +6,7 @@ package store
 import (
 	"sync"
 
+	"github.com/alecthomas/units"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/atomic"
@@ -18,10 +19,20 @@ type ChunksLimiter interface {
 	Reserve(num uint64) error
 }
 
+type BytesLimiter interface {
+	// Reserve num bytes out of the total number of bytes enforced by the limiter.
+	// Returns an error if the limit has been exceeded. This function must be
+	// goroutine safe.
+	Reserve(num uint64) error
+}
+
 // ChunksLimiterFactory is used to create a new ChunksLimiter. The factory is useful for
 // projects depending on Thanos (eg. Cortex) which have dynamic limits.
 type ChunksLimiterFactory func(failedCounter prometheus.Counter) ChunksLimiter
 
+// BytesLimiterFactory is used to create a new BytesLimiter.
+type BytesLimiterFactory func(failedCounter prometheus.Counter) BytesLimiter
+
 // Limiter is a simple mechanism for checking if something has passed a certain threshold.
 type Limiter struct {
 	limit    uint64
@@ -37,7 +48,7 @@ func NewLimiter(limit uint64, ctr prometheus.Counter) *Limiter {
 	return &Limiter{limit: limit, failedCounter: ctr}
 }
 
-// Reserve implements ChunksLimiter.
+// Reserve implements ChunksLimiter and BytesLimiter.
 func (l *Limiter) Reserve(num uint64) error {
 	if l.limit == 0 {
 		return nil
@@ -57,3 +68,10 @@ func NewChunksLimiterFactory(limit uint64) ChunksLimiterFactory {
 		return NewLimiter(limit, failedCounter)
 	}
 }
+
+// NewBytesLimiterFactory makes a new BytesLimiterFactory with a static limit.
+func NewBytesLimiterFactory(limit units.Base2Bytes) BytesLimiterFactory {
+	return func(failedCounter prometheus.Counter) BytesLimiter {
+		return NewLimiter(uint64(limit), failedCounter)
+	}
+}
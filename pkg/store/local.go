@@ -71,9 +71,10 @@ func NewLocalStoreFromJSONMmappableFile(
 			LabelSets: []labelpb.ZLabelSet{
 				{Labels: labelpb.ZLabelsFromPromLabels(extLabels)},
 			},
-			StoreType: component.ToProto(),
-			MinTime:   math.MaxInt64,
-			MaxTime:   math.MinInt64,
+			StoreType:     component.ToProto(),
+			MinTime:       math.MaxInt64,
+			MaxTime:       math.MinInt64,
+			LabelMatchers: true,
 		},
 	}
 
@@ -181,7 +182,7 @@ func (s *LocalStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				break
 			}
 		}
-		if noMatch {
+		if noMatch || !r.ShardInfo.Matches(lbls) {
 			continue
 		}
 
@@ -213,13 +214,17 @@ func (s *LocalStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	return nil
 }
 
-// LabelNames returns all known label names.
-func (s *LocalStore) LabelNames(_ context.Context, _ *storepb.LabelNamesRequest) (
+// LabelNames returns all known label names, or the ones of the series matching the given matchers.
+func (s *LocalStore) LabelNames(_ context.Context, r *storepb.LabelNamesRequest) (
 	*storepb.LabelNamesResponse, error,
 ) {
+	series, err := s.matchingSeries(r.Matchers)
+	if err != nil {
+		return nil, err
+	}
 	// TODO(bwplotka): Consider precomputing.
 	names := map[string]struct{}{}
-	for _, series := range s.series {
+	for _, series := range series {
 		for _, l := range series.Labels {
 			names[l.Name] = struct{}{}
 		}
@@ -231,12 +236,17 @@ func (s *LocalStore) LabelNames(_ context.Context, _ *storepb.LabelNamesRequest)
 	return resp, nil
 }
 
-// LabelValues returns all known label values for a given label name.
+// LabelValues returns all known label values for a given label name, or the ones of the series matching the given
+// matchers.
 func (s *LocalStore) LabelValues(_ context.Context, r *storepb.LabelValuesRequest) (
 	*storepb.LabelValuesResponse, error,
 ) {
+	series, err := s.matchingSeries(r.Matchers)
+	if err != nil {
+		return nil, err
+	}
 	vals := map[string]struct{}{}
-	for _, series := range s.series {
+	for _, series := range series {
 		lbls := labelpb.ZLabelsToPromLabels(series.Labels)
 		val := lbls.Get(r.Label)
 		if val == "" {
@@ -251,6 +261,32 @@ func (s *LocalStore) LabelValues(_ context.Context, r *storepb.LabelValuesReques
 	return resp, nil
 }
 
+// matchingSeries returns the series matching the given matchers, or all of them if there are none.
+func (s *LocalStore) matchingSeries(ms []storepb.LabelMatcher) ([]*storepb.Series, error) {
+	match, newMatchers, err := matchesExternalLabels(ms, s.extLabels)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return nil, nil
+	}
+	if len(newMatchers) == 0 {
+		return s.series, nil
+	}
+
+	matchers, err := storepb.TranslateFromPromMatchers(newMatchers...)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var res []*storepb.Series
+	for _, series := range s.series {
+		if matchesLabels(matchers, labelpb.ZLabelsToPromLabels(series.Labels)) {
+			res = append(res, series)
+		}
+	}
+	return res, nil
+}
+
 func (s *LocalStore) Close() (err error) {
 	return s.c.Close()
 }
@@ -29,7 +29,9 @@ import (
 	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/component"
@@ -50,6 +52,7 @@ type PrometheusStore struct {
 	component      component.StoreAPI
 	externalLabels func() labels.Labels
 	timestamps     func() (mint int64, maxt int64)
+	labelsStale    func() bool
 
 	remoteReadAcceptableResponses []prompb.ReadRequest_ResponseType
 
@@ -58,9 +61,14 @@ type PrometheusStore struct {
 
 const initialBufSize = 32 * 1024 // 32KB seems like a good minimum starting size for sync pool size.
 
+// ExternalLabelsStaleHeader is the gRPC header set in the Info responses of a PrometheusStore if its external labels
+// are stale, i.e. they are served from cache as they could not be refreshed from Prometheus for a while.
+const ExternalLabelsStaleHeader = "thanos-external-labels-stale"
+
 // NewPrometheusStore returns a new PrometheusStore that uses the given HTTP client
 // to talk to Prometheus.
-// It attaches the provided external labels to all results.
+// It attaches the provided external labels to all results. If labelsStale is not nil, it reports
+// whether the external labels are stale.
 func NewPrometheusStore(
 	logger log.Logger,
 	reg prometheus.Registerer,
@@ -69,6 +77,7 @@ func NewPrometheusStore(
 	component component.StoreAPI,
 	externalLabels func() labels.Labels,
 	timestamps func() (mint int64, maxt int64),
+	labelsStale func() bool,
 ) (*PrometheusStore, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -80,6 +89,7 @@ func NewPrometheusStore(
 		component:                     component,
 		externalLabels:                externalLabels,
 		timestamps:                    timestamps,
+		labelsStale:                   labelsStale,
 		remoteReadAcceptableResponses: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS, prompb.ReadRequest_SAMPLES},
 		buffers: sync.Pool{New: func() interface{} {
 			b := make([]byte, 0, initialBufSize)
@@ -99,15 +109,23 @@ func NewPrometheusStore(
 // Info returns store information about the Prometheus instance.
 // NOTE(bwplotka): MaxTime & MinTime are not accurate nor adjusted dynamically.
 // This is fine for now, but might be needed in future.
-func (p *PrometheusStore) Info(_ context.Context, _ *storepb.InfoRequest) (*storepb.InfoResponse, error) {
+// If the external labels are stale, they are still returned, marked by the ExternalLabelsStaleHeader header.
+func (p *PrometheusStore) Info(ctx context.Context, _ *storepb.InfoRequest) (*storepb.InfoResponse, error) {
 	lset := p.externalLabels()
 	mint, maxt := p.timestamps()
 
+	if p.labelsStale != nil && p.labelsStale() {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(ExternalLabelsStaleHeader, "true")); err != nil {
+			level.Debug(p.logger).Log("msg", "failed to mark stale external labels", "err", err)
+		}
+	}
+
 	res := &storepb.InfoResponse{
-		Labels:    make([]labelpb.ZLabel, 0, len(lset)),
-		StoreType: p.component.ToProto(),
-		MinTime:   mint,
-		MaxTime:   maxt,
+		Labels:        make([]labelpb.ZLabel, 0, len(lset)),
+		StoreType:     p.component.ToProto(),
+		MinTime:       mint,
+		MaxTime:       maxt,
+		LabelMatchers: true,
 	}
 	res.Labels = append(res.Labels, labelpb.ZLabelsFromPromLabels(lset)...)
 
@@ -168,6 +186,9 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_Serie
 			sort.Slice(lset, func(i, j int) bool {
 				return lset[i].Name < lset[j].Name
 			})
+			if !r.ShardInfo.Matches(labelpb.ZLabelsToPromLabels(lset)) {
+				continue
+			}
 			if err = s.Send(storepb.NewSeriesResponse(&storepb.Series{Labels: lset})); err != nil {
 				return err
 			}
@@ -207,16 +228,16 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_Serie
 	// remote read.
 	contentType := httpResp.Header.Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/x-protobuf") {
-		return p.handleSampledPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels)
+		return p.handleSampledPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels, r.ShardInfo)
 	}
 
 	if !strings.HasPrefix(contentType, "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse") {
 		return errors.Errorf("not supported remote read content type: %s", contentType)
 	}
-	return p.handleStreamedPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels)
+	return p.handleStreamedPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels, r.ShardInfo)
 }
 
-func (p *PrometheusStore) handleSampledPrometheusResponse(s storepb.Store_SeriesServer, httpResp *http.Response, querySpan opentracing.Span, externalLabels labels.Labels) error {
+func (p *PrometheusStore) handleSampledPrometheusResponse(s storepb.Store_SeriesServer, httpResp *http.Response, querySpan opentracing.Span, externalLabels labels.Labels, shard *storepb.ShardInfo) error {
 	ctx := s.Context()
 
 	level.Debug(p.logger).Log("msg", "started handling ReadRequest_SAMPLED response type.")
@@ -233,6 +254,9 @@ func (p *PrometheusStore) handleSampledPrometheusResponse(s storepb.Store_Series
 
 	for _, e := range resp.Results[0].Timeseries {
 		lset := labelpb.ExtendLabels(labelpb.ZLabelsToPromLabels(e.Labels), externalLabels)
+		if !shard.Matches(lset) {
+			continue
+		}
 		if len(e.Samples) == 0 {
 			// As found in https://github.com/thanos-io/thanos/issues/381
 			// Prometheus can give us completely empty time series. Ignore these with log until we figure out that
@@ -262,7 +286,7 @@ func (p *PrometheusStore) handleSampledPrometheusResponse(s storepb.Store_Series
 	return nil
 }
 
-func (p *PrometheusStore) handleStreamedPrometheusResponse(s storepb.Store_SeriesServer, httpResp *http.Response, querySpan opentracing.Span, externalLabels labels.Labels) error {
+func (p *PrometheusStore) handleStreamedPrometheusResponse(s storepb.Store_SeriesServer, httpResp *http.Response, querySpan opentracing.Span, externalLabels labels.Labels, shard *storepb.ShardInfo) error {
 	level.Debug(p.logger).Log("msg", "started handling ReadRequest_STREAMED_XOR_CHUNKS streamed read response.")
 
 	framesNum := 0
@@ -297,6 +321,10 @@ func (p *PrometheusStore) handleStreamedPrometheusResponse(s storepb.Store_Serie
 
 		framesNum++
 		for _, series := range res.ChunkedSeries {
+			lset := labelpb.ExtendLabels(labelpb.ZLabelsToPromLabels(series.Labels), externalLabels)
+			if !shard.Matches(lset) {
+				continue
+			}
 			thanosChks := make([]storepb.AggrChunk, len(series.Chunks))
 			for i, chk := range series.Chunks {
 				thanosChks[i] = storepb.AggrChunk{
@@ -315,9 +343,7 @@ func (p *PrometheusStore) handleStreamedPrometheusResponse(s storepb.Store_Serie
 			}
 
 			if err := s.Send(storepb.NewSeriesResponse(&storepb.Series{
-				Labels: labelpb.ZLabelsFromPromLabels(
-					labelpb.ExtendLabels(labelpb.ZLabelsToPromLabels(series.Labels), externalLabels),
-				),
+				Labels: labelpb.ZLabelsFromPromLabels(lset),
 				Chunks: thanosChks,
 			})); err != nil {
 				return err
@@ -481,28 +507,74 @@ func (p *PrometheusStore) encodeChunk(ss []prompb.Sample) (storepb.Chunk_Encodin
 	return storepb.Chunk_XOR, c.Bytes(), nil
 }
 
-// LabelNames returns all known label names.
+// LabelNames returns all known label names, or the ones of the series matching the given matchers.
 func (p *PrometheusStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
-	lbls, err := p.client.LabelNamesInGRPC(ctx, p.base, r.Start, r.End)
+	match, matchers, err := matchesExternalLabels(r.Matchers, p.externalLabels())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelNamesResponse{Names: nil}, nil
+	}
+
+	if len(matchers) == 0 {
+		lbls, err := p.client.LabelNamesInGRPC(ctx, p.base, r.Start, r.End)
+		if err != nil {
+			return nil, err
+		}
+		return &storepb.LabelNamesResponse{Names: lbls}, nil
+	}
+
+	// The series API is used, as the labels API of Prometheus does not support matchers in all versions.
+	series, err := p.client.SeriesInGRPC(ctx, p.base, matchers, r.Start, r.End)
 	if err != nil {
 		return nil, err
 	}
-	return &storepb.LabelNamesResponse{Names: lbls}, nil
+	names := map[string]struct{}{}
+	for _, s := range series {
+		for n := range s {
+			names[n] = struct{}{}
+		}
+	}
+	return &storepb.LabelNamesResponse{Names: sortedKeys(names)}, nil
 }
 
-// LabelValues returns all known label values for a given label name.
+// LabelValues returns all known label values for a given label name, or the ones of the series matching the given
+// matchers.
 func (p *PrometheusStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
 	externalLset := p.externalLabels()
 
+	match, matchers, err := matchesExternalLabels(r.Matchers, externalLset)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelValuesResponse{Values: nil}, nil
+	}
+
 	// First check for matching external label which has priority.
 	if l := externalLset.Get(r.Label); l != "" {
 		return &storepb.LabelValuesResponse{Values: []string{l}}, nil
 	}
 
-	vals, err := p.client.LabelValuesInGRPC(ctx, p.base, r.Label, r.Start, r.End)
+	if len(matchers) == 0 {
+		vals, err := p.client.LabelValuesInGRPC(ctx, p.base, r.Label, r.Start, r.End)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(vals)
+		return &storepb.LabelValuesResponse{Values: vals}, nil
+	}
+
+	series, err := p.client.SeriesInGRPC(ctx, p.base, matchers, r.Start, r.End)
 	if err != nil {
 		return nil, err
 	}
-	sort.Strings(vals)
-	return &storepb.LabelValuesResponse{Values: vals}, nil
+	values := map[string]struct{}{}
+	for _, s := range series {
+		if v := s[r.Label]; v != "" {
+			values[v] = struct{}{}
+		}
+	}
+	return &storepb.LabelValuesResponse{Values: sortedKeys(values)}, nil
 }
@@ -16,6 +16,8 @@ import (
 	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/promclient"
@@ -66,7 +68,7 @@ func testPrometheusStoreSeriesE2e(t *testing.T, prefix string) {
 	limitMinT := int64(0)
 	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar,
 		func() labels.Labels { return labels.FromStrings("region", "eu-west") },
-		func() (int64, int64) { return limitMinT, -1 }) // Maxt does not matter.
+		func() (int64, int64) { return limitMinT, -1 }, nil) // Maxt does not matter.
 	testutil.Ok(t, err)
 
 	// Query all three samples except for the first one. Since we round up queried data
@@ -201,7 +203,7 @@ func TestPrometheusStore_SeriesLabels_e2e(t *testing.T) {
 
 	promStore, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar,
 		func() labels.Labels { return labels.FromStrings("region", "eu-west") },
-		func() (int64, int64) { return math.MinInt64/1000 + 62135596801, math.MaxInt64/1000 - 62135596801 })
+		func() (int64, int64) { return math.MinInt64/1000 + 62135596801, math.MaxInt64/1000 - 62135596801 }, nil)
 	testutil.Ok(t, err)
 
 	for _, tcase := range []struct {
@@ -377,7 +379,7 @@ func TestPrometheusStore_LabelNames_e2e(t *testing.T) {
 	u, err := url.Parse(fmt.Sprintf("http://%s", p.Addr()))
 	testutil.Ok(t, err)
 
-	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar, getExternalLabels, nil)
+	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar, getExternalLabels, nil, nil)
 	testutil.Ok(t, err)
 
 	resp, err := proxy.LabelNames(ctx, &storepb.LabelNamesRequest{
@@ -396,6 +398,24 @@ func TestPrometheusStore_LabelNames_e2e(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, []string(nil), resp.Warnings)
 	testutil.Equals(t, []string{}, resp.Names)
+
+	// Only the label names of the series matching the matchers.
+	resp, err = proxy.LabelNames(ctx, &storepb.LabelNamesRequest{
+		Start:    timestamp.FromTime(minTime),
+		End:      timestamp.FromTime(maxTime),
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "b"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a"}, resp.Names)
+
+	// Not matching the external labels.
+	resp, err = proxy.LabelNames(ctx, &storepb.LabelNamesRequest{
+		Start:    timestamp.FromTime(minTime),
+		End:      timestamp.FromTime(maxTime),
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "ext_a", Value: "b"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string(nil), resp.Names)
 }
 
 func TestPrometheusStore_LabelValues_e2e(t *testing.T) {
@@ -422,7 +442,7 @@ func TestPrometheusStore_LabelValues_e2e(t *testing.T) {
 	u, err := url.Parse(fmt.Sprintf("http://%s", p.Addr()))
 	testutil.Ok(t, err)
 
-	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar, getExternalLabels, nil)
+	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar, getExternalLabels, nil, nil)
 	testutil.Ok(t, err)
 
 	resp, err := proxy.LabelValues(ctx, &storepb.LabelValuesRequest{
@@ -443,6 +463,16 @@ func TestPrometheusStore_LabelValues_e2e(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, []string(nil), resp.Warnings)
 	testutil.Equals(t, []string{}, resp.Values)
+
+	// Only the label values of the series matching the matchers.
+	resp, err = proxy.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:    "a",
+		Start:    timestamp.FromTime(minTime),
+		End:      timestamp.FromTime(maxTime),
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "a", Value: "a|b"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b"}, resp.Values)
 }
 
 // Test to check external label values retrieve.
@@ -468,7 +498,7 @@ func TestPrometheusStore_ExternalLabelValues_e2e(t *testing.T) {
 	u, err := url.Parse(fmt.Sprintf("http://%s", p.Addr()))
 	testutil.Ok(t, err)
 
-	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar, getExternalLabels, nil)
+	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar, getExternalLabels, nil, nil)
 	testutil.Ok(t, err)
 
 	resp, err := proxy.LabelValues(ctx, &storepb.LabelValuesRequest{
@@ -514,7 +544,7 @@ func TestPrometheusStore_Series_MatchExternalLabel_e2e(t *testing.T) {
 
 	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar,
 		func() labels.Labels { return labels.FromStrings("region", "eu-west") },
-		func() (int64, int64) { return 0, math.MaxInt64 })
+		func() (int64, int64) { return 0, math.MaxInt64 }, nil)
 	testutil.Ok(t, err)
 	srv := newStoreSeriesServer(ctx)
 
@@ -559,7 +589,7 @@ func TestPrometheusStore_Info(t *testing.T) {
 
 	proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), nil, component.Sidecar,
 		func() labels.Labels { return labels.FromStrings("region", "eu-west") },
-		func() (int64, int64) { return 123, 456 })
+		func() (int64, int64) { return 123, 456 }, nil)
 	testutil.Ok(t, err)
 
 	resp, err := proxy.Info(ctx, &storepb.InfoRequest{})
@@ -569,8 +599,42 @@ func TestPrometheusStore_Info(t *testing.T) {
 	testutil.Equals(t, storepb.StoreType_SIDECAR, resp.StoreType)
 	testutil.Equals(t, int64(123), resp.MinTime)
 	testutil.Equals(t, int64(456), resp.MaxTime)
+
+	// Stale external labels are still served, with a header marking them.
+	for _, stale := range []bool{false, true} {
+		proxy, err = NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), nil, component.Sidecar,
+			func() labels.Labels { return labels.FromStrings("region", "eu-west") },
+			func() (int64, int64) { return 123, 456 }, func() bool { return stale })
+		testutil.Ok(t, err)
+
+		stream := &headerServerTransportStream{}
+		resp, err = proxy.Info(grpc.NewContextWithServerTransportStream(ctx, stream), &storepb.InfoRequest{})
+		testutil.Ok(t, err)
+		testutil.Equals(t, []labelpb.ZLabel{{Name: "region", Value: "eu-west"}}, resp.Labels)
+		if stale {
+			testutil.Equals(t, []string{"true"}, stream.header.Get(ExternalLabelsStaleHeader))
+		} else {
+			testutil.Equals(t, 0, len(stream.header))
+		}
+	}
 }
 
+// headerServerTransportStream records the headers set by the gRPC handlers.
+type headerServerTransportStream struct {
+	header metadata.MD
+}
+
+func (s *headerServerTransportStream) Method() string { return "" }
+
+func (s *headerServerTransportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerServerTransportStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *headerServerTransportStream) SetTrailer(metadata.MD) error { return nil }
+
 func testSeries_SplitSamplesIntoChunksWithMaxSizeOf120(t *testing.T, appender storage.Appender, newStore func() storepb.StoreServer) {
 	baseT := timestamp.FromTime(time.Now().AddDate(0, 0, -2)) / 1000 * 1000
 
@@ -637,7 +701,7 @@ func TestPrometheusStore_Series_SplitSamplesIntoChunksWithMaxSizeOf120(t *testin
 
 		proxy, err := NewPrometheusStore(nil, nil, promclient.NewDefaultClient(), u, component.Sidecar,
 			func() labels.Labels { return labels.FromStrings("region", "eu-west") },
-			func() (int64, int64) { return 0, math.MaxInt64 })
+			func() (int64, int64) { return 0, math.MaxInt64 }, nil)
 		testutil.Ok(t, err)
 
 		// We build chunks only for SAMPLES method. Make sure we ask for SAMPLES only.
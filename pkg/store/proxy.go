@@ -14,6 +14,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/types"
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -21,6 +22,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/strutil"
@@ -36,6 +38,22 @@ type ctxKey int
 // StoreMatcherKey is the context key for the store's allow list.
 const StoreMatcherKey = ctxKey(0)
 
+// ResponseTimeoutKey is the context key for the response timeout of the stores, overriding the one of the proxy.
+const ResponseTimeoutKey = ctxKey(1)
+
+// QueriedStoreKey is the context key for a func(addr string) called with the address of each store queried.
+const QueriedStoreKey = ctxKey(2)
+
+// PartialResponseDisabledKey is the context key set to true when partial response is explicitly disabled by the request,
+// which the best-effort stores follow too.
+const PartialResponseDisabledKey = ctxKey(3)
+
+func storeQueried(ctx context.Context, st Client) {
+	if f, ok := ctx.Value(QueriedStoreKey).(func(string)); ok {
+		f(st.Addr())
+	}
+}
+
 // Client holds meta information about a store.
 type Client interface {
 	// Client to access the store.
@@ -47,11 +65,28 @@ type Client interface {
 	// Minimum and maximum time range of data in the store.
 	TimeRange() (mint int64, maxt int64)
 
+	// LabelMatchers returns true if the store restricts the label names and values to the ones of the series matching
+	// the matchers of the requests.
+	LabelMatchers() bool
+
 	String() string
 	// Addr returns address of a Client.
 	Addr() string
 }
 
+// PartialResponsePolicy is the policy of the partial responses on the failures of a store.
+type PartialResponsePolicy int
+
+const (
+	// PartialResponseDefault follows the partial response of the requests.
+	PartialResponseDefault PartialResponsePolicy = iota
+	// PartialResponseStrict fails the requests on the failures of the store, even if partial response is enabled.
+	PartialResponseStrict
+	// PartialResponseBestEffort returns partial responses on the failures of the store, even if partial response is disabled
+	// by default, unless the request explicitly disables it.
+	PartialResponseBestEffort
+)
+
 // ProxyStore implements the store API that proxies request to all given underlying stores.
 type ProxyStore struct {
 	logger         log.Logger
@@ -59,8 +94,9 @@ type ProxyStore struct {
 	component      component.StoreAPI
 	selectorLabels labels.Labels
 
-	responseTimeout time.Duration
-	metrics         *proxyStoreMetrics
+	responseTimeout       time.Duration
+	partialResponsePolicy func(Client) PartialResponsePolicy
+	metrics               *proxyStoreMetrics
 }
 
 type proxyStoreMetrics struct {
@@ -86,6 +122,7 @@ func RegisterStoreServer(storeSrv storepb.StoreServer) func(*grpc.Server) {
 
 // NewProxyStore returns a new ProxyStore that uses the given clients that implements storeAPI to fan-in all series to the client.
 // Note that there is no deduplication support. Deduplication should be done on the highest level (just before PromQL).
+// The partial response on the failures of a store follows its partialResponsePolicy, if not nil.
 func NewProxyStore(
 	logger log.Logger,
 	reg prometheus.Registerer,
@@ -93,6 +130,7 @@ func NewProxyStore(
 	component component.StoreAPI,
 	selectorLabels labels.Labels,
 	responseTimeout time.Duration,
+	partialResponsePolicy func(Client) PartialResponsePolicy,
 ) *ProxyStore {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -100,21 +138,38 @@ func NewProxyStore(
 
 	metrics := newProxyStoreMetrics(reg)
 	s := &ProxyStore{
-		logger:          logger,
-		stores:          stores,
-		component:       component,
-		selectorLabels:  selectorLabels,
-		responseTimeout: responseTimeout,
-		metrics:         metrics,
+		logger:                logger,
+		stores:                stores,
+		component:             component,
+		selectorLabels:        selectorLabels,
+		responseTimeout:       responseTimeout,
+		partialResponsePolicy: partialResponsePolicy,
+		metrics:               metrics,
 	}
 	return s
 }
 
+// partialResponse returns whether a partial response is returned on the failures of the given store.
+func (s *ProxyStore) partialResponse(ctx context.Context, st Client, partialResponseDisabled bool) bool {
+	if s.partialResponsePolicy != nil {
+		switch s.partialResponsePolicy(st) {
+		case PartialResponseStrict:
+			return false
+		case PartialResponseBestEffort:
+			disabled, _ := ctx.Value(PartialResponseDisabledKey).(bool)
+			return !disabled
+		}
+	}
+	return !partialResponseDisabled
+}
+
 // Info returns store information about the external labels this store have.
 func (s *ProxyStore) Info(_ context.Context, _ *storepb.InfoRequest) (*storepb.InfoResponse, error) {
 	res := &storepb.InfoResponse{
 		StoreType: s.component.ToProto(),
 		Labels:    labelpb.ZLabelsFromPromLabels(s.selectorLabels),
+		// The label names and values of the stores not restricting them are gathered from their series.
+		LabelMatchers: true,
 	}
 
 	minTime := int64(math.MaxInt64)
@@ -200,6 +255,27 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		return status.Error(codes.InvalidArgument, errors.New("no matchers specified (excluding external labels)").Error())
 	}
 
+	responseTimeout := s.responseTimeout
+	if ctxVal := srv.Context().Value(ResponseTimeoutKey); ctxVal != nil {
+		if value, ok := ctxVal.(time.Duration); ok {
+			responseTimeout = value
+		}
+	}
+
+	// Other request hints are specific to the stores, so they are not forwarded.
+	var storeHints *types.Any
+	reqHints := &hintspb.SeriesRequestHints{}
+	if r.Hints != nil && types.Is(r.Hints, reqHints) {
+		if err := types.UnmarshalAny(r.Hints, reqHints); err != nil {
+			return status.Error(codes.InvalidArgument, errors.Wrap(err, "unmarshal series request hints").Error())
+		}
+		if reqHints.EnableQueryStats {
+			if storeHints, err = types.MarshalAny(&hintspb.SeriesRequestHints{EnableQueryStats: true}); err != nil {
+				return status.Error(codes.Internal, errors.Wrap(err, "marshal series request hints").Error())
+			}
+		}
+	}
+
 	g, gctx := errgroup.WithContext(srv.Context())
 
 	// Allow to buffer max 10 series response.
@@ -213,6 +289,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 
 		var (
 			seriesSet      []storepb.SeriesSet
+			storesStats    []*hintspb.StoreQueryStats
 			storeDebugMsgs []string
 			r              = &storepb.SeriesRequest{
 				MinTime:                 r.MinTime,
@@ -222,6 +299,8 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				MaxResolutionWindow:     r.MaxResolutionWindow,
 				SkipChunks:              r.SkipChunks,
 				PartialResponseDisabled: r.PartialResponseDisabled,
+				Hints:                   storeHints,
+				ShardInfo:               r.ShardInfo,
 			}
 			wg = &sync.WaitGroup{}
 		)
@@ -251,6 +330,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				continue
 			}
 			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s queried", st))
+			storeQueried(srv.Context(), st)
 
 			// This is used to cancel this stream when one operations takes too long.
 			seriesCtx, closeSeries := context.WithCancel(gctx)
@@ -266,7 +346,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 					storeID = "Store Gateway"
 				}
 				err = errors.Wrapf(err, "fetch series for %s %s", storeID, st)
-				if r.PartialResponseDisabled {
+				if !s.partialResponse(gctx, st, r.PartialResponseDisabled) {
 					level.Error(s.logger).Log("err", err, "msg", "partial response disabled; aborting request")
 					return err
 				}
@@ -274,10 +354,17 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				continue
 			}
 
+			var storeStats *hintspb.StoreQueryStats
+			if reqHints.EnableQueryStats {
+				mint, maxt := st.TimeRange()
+				storeStats = &hintspb.StoreQueryStats{Store: st.String(), MinTime: mint, MaxTime: maxt}
+				storesStats = append(storesStats, storeStats)
+			}
+
 			// Schedule streamSeriesSet that translates gRPC streamed response
 			// into seriesSet (if series) or respCh if warnings.
 			seriesSet = append(seriesSet, startStreamSeriesSet(seriesCtx, s.logger, closeSeries,
-				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, s.responseTimeout, s.metrics.emptyStreamResponses))
+				wg, sc, respSender, st.String(), s.partialResponse(gctx, st, r.PartialResponseDisabled), responseTimeout, s.metrics.emptyStreamResponses, storeStats))
 		}
 
 		level.Debug(s.logger).Log("msg", strings.Join(storeDebugMsgs, ";"))
@@ -298,7 +385,24 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 			lset, chk := mergedSet.At()
 			respSender.send(storepb.NewSeriesResponse(&storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset), Chunks: chk}))
 		}
-		return mergedSet.Err()
+		if err := mergedSet.Err(); err != nil {
+			return err
+		}
+
+		if reqHints.EnableQueryStats {
+			// The stats of the stores are complete once all their streams are done.
+			wg.Wait()
+			resHints := &hintspb.SeriesResponseHints{}
+			for _, st := range storesStats {
+				resHints.StoresQueryStats = append(resHints.StoresQueryStats, *st)
+			}
+			anyHints, err := types.MarshalAny(resHints)
+			if err != nil {
+				return status.Error(codes.Unknown, errors.Wrap(err, "marshal series response hints").Error())
+			}
+			respSender.send(storepb.NewHintsSeriesResponse(anyHints))
+		}
+		return nil
 	})
 	g.Go(func() error {
 		// Go routine for gathering merged responses and sending them over to client. It stops when
@@ -342,6 +446,57 @@ type streamSeriesSet struct {
 
 	responseTimeout time.Duration
 	closeSeries     context.CancelFunc
+
+	// stats are the statistics of the stream, if enabled.
+	stats *hintspb.StoreQueryStats
+}
+
+// SeriesPlan is the fan-out of a Series request by the proxy.
+type SeriesPlan struct {
+	// Matchers are the matchers sent to the stores, without the ones of the selector labels of the proxy.
+	Matchers string      `json:"matchers"`
+	Stores   []StorePlan `json:"stores"`
+	// Reason is the reason no store is queried at all, if so.
+	Reason string `json:"reason,omitempty"`
+}
+
+// StorePlan tells whether a store is queried by a Series request.
+type StorePlan struct {
+	Store   string `json:"store"`
+	Queried bool   `json:"queried"`
+	// Reason is the reason the store is filtered out, if it is.
+	Reason string `json:"reason,omitempty"`
+}
+
+// PlanSeries returns the stores the given Series request would be sent to, without sending it.
+func (s *ProxyStore) PlanSeries(ctx context.Context, r *storepb.SeriesRequest) (*SeriesPlan, error) {
+	match, newMatchers, err := matchesExternalLabels(r.Matchers, s.selectorLabels)
+	if err != nil {
+		return nil, err
+	}
+	plan := &SeriesPlan{Matchers: storepb.MatchersToString(newMatchers...), Stores: []StorePlan{}}
+	if !match {
+		plan.Reason = "matchers do not match the selector labels of the proxy"
+		return plan, nil
+	}
+	if len(newMatchers) == 0 {
+		return nil, errors.New("no matchers specified (excluding external labels)")
+	}
+
+	var storeDebugMatcher [][]*labels.Matcher
+	if ctxVal := ctx.Value(StoreMatcherKey); ctxVal != nil {
+		if value, ok := ctxVal.([][]*labels.Matcher); ok {
+			storeDebugMatcher = value
+		}
+	}
+	for _, st := range s.stores() {
+		reason, err := storeMismatch(st, r.MinTime, r.MaxTime, storeDebugMatcher, newMatchers...)
+		if err != nil {
+			return nil, err
+		}
+		plan.Stores = append(plan.Stores, StorePlan{Store: st.String(), Queried: reason == "", Reason: reason})
+	}
+	return plan, nil
 }
 
 type recvResponse struct {
@@ -370,6 +525,7 @@ func startStreamSeriesSet(
 	partialResponse bool,
 	responseTimeout time.Duration,
 	emptyStreamResponses prometheus.Counter,
+	stats *hintspb.StoreQueryStats,
 ) *streamSeriesSet {
 	s := &streamSeriesSet{
 		ctx:             ctx,
@@ -381,6 +537,7 @@ func startStreamSeriesSet(
 		name:            name,
 		partialResponse: partialResponse,
 		responseTimeout: responseTimeout,
+		stats:           stats,
 	}
 
 	wg.Add(1)
@@ -388,6 +545,11 @@ func startStreamSeriesSet(
 		defer wg.Done()
 		defer close(s.recvCh)
 
+		if s.stats != nil {
+			begin := time.Now()
+			defer func() { s.stats.Duration = time.Since(begin) }()
+		}
+
 		numResponses := 0
 		defer func() {
 			if numResponses == 0 {
@@ -437,7 +599,27 @@ func startStreamSeriesSet(
 				s.warnCh.send(storepb.NewWarnSeriesResponse(errors.New(w)))
 			}
 
+			if h := rr.r.GetHints(); h != nil && s.stats != nil {
+				resHints := &hintspb.SeriesResponseHints{}
+				if err := types.UnmarshalAny(h, resHints); err != nil {
+					level.Warn(s.logger).Log("msg", "failed to unmarshal series response hints", "store", s.name, "err", err)
+				} else {
+					if resHints.QueryStats != nil {
+						s.stats.QueryStats = resHints.QueryStats
+					}
+					s.stats.QueriedBlocks = append(s.stats.QueriedBlocks, resHints.QueriedBlocks...)
+					// The blocks queried through another proxy, e.g. a querier, are reported by its own stores.
+					for _, st := range resHints.StoresQueryStats {
+						s.stats.QueriedBlocks = append(s.stats.QueriedBlocks, st.QueriedBlocks...)
+					}
+				}
+			}
+
 			if series := rr.r.GetSeries(); series != nil {
+				if s.stats != nil {
+					s.stats.SeriesReceived++
+					s.stats.ChunksReceived += int64(len(series.Chunks))
+				}
 				select {
 				case s.recvCh <- series:
 				case <-ctx.Done():
@@ -485,20 +667,30 @@ func (s *streamSeriesSet) Err() error {
 
 // matchStore returns true if the given store may hold data for the given label matchers.
 func storeMatches(s Client, mint, maxt int64, storeDebugMatchers [][]*labels.Matcher, matchers ...storepb.LabelMatcher) (bool, error) {
+	reason, err := storeMismatch(s, mint, maxt, storeDebugMatchers, matchers...)
+	return reason == "", err
+}
+
+// storeMismatch returns the reason the given store cannot hold data for the given label matchers, or an empty string
+// if it may hold some.
+func storeMismatch(s Client, mint, maxt int64, storeDebugMatchers [][]*labels.Matcher, matchers ...storepb.LabelMatcher) (string, error) {
 	storeMinTime, storeMaxTime := s.TimeRange()
 	if mint > storeMaxTime || maxt <= storeMinTime {
-		return false, nil
+		return "time range of the store does not overlap the time range of the request", nil
 	}
 
 	if !storeMatchDebugMetadata(s, storeDebugMatchers) {
-		return false, nil
+		return "store does not match the store matchers", nil
 	}
 
 	promMatchers, err := storepb.TranslateFromPromMatchers(matchers...)
 	if err != nil {
-		return false, err
+		return "", err
+	}
+	if !labelSetsMatch(promMatchers, s.LabelSets()...) {
+		return "label sets of the store do not match the matchers", nil
 	}
-	return labelSetsMatch(promMatchers, s.LabelSets()...), nil
+	return "", nil
 }
 
 // storeMatchDebugMetadata return true if the store's address match the storeDebugMatchers.
@@ -535,7 +727,7 @@ func labelSetsMatch(matchers []*labels.Matcher, lss ...labels.Labels) bool {
 	return false
 }
 
-// LabelNames returns all known label names.
+// LabelNames returns all known label names, or the ones of the series matching the given matchers.
 func (s *ProxyStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (
 	*storepb.LabelNamesResponse, error,
 ) {
@@ -557,24 +749,35 @@ func (s *ProxyStore) LabelNames(ctx context.Context, r *storepb.LabelNamesReques
 					storeDebugMatcher = value
 				}
 			}
-			// We can skip error, we already translated matchers once.
-			ok, _ = storeMatches(st, r.Start, r.End, storeDebugMatcher)
+			// The matchers are translated again by the stores, which return an error if they are invalid.
+			ok, _ = storeMatches(st, r.Start, r.End, storeDebugMatcher, r.Matchers...)
 		})
 		if !ok {
 			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s filtered out", st))
 			continue
 		}
 		storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s queried", st))
+		storeQueried(ctx, st)
 
 		g.Go(func() error {
-			resp, err := st.LabelNames(gctx, &storepb.LabelNamesRequest{
+			req := &storepb.LabelNamesRequest{
 				PartialResponseDisabled: r.PartialResponseDisabled,
 				Start:                   r.Start,
 				End:                     r.End,
-			})
+				Matchers:                r.Matchers,
+			}
+			var (
+				resp *storepb.LabelNamesResponse
+				err  error
+			)
+			if len(r.Matchers) > 0 && !st.LabelMatchers() {
+				resp, err = labelNamesFromSeries(gctx, st, req)
+			} else {
+				resp, err = st.LabelNames(gctx, req)
+			}
 			if err != nil {
 				err = errors.Wrapf(err, "fetch label names from store %s", st)
-				if r.PartialResponseDisabled {
+				if !s.partialResponse(gctx, st, r.PartialResponseDisabled) {
 					return err
 				}
 
@@ -604,7 +807,8 @@ func (s *ProxyStore) LabelNames(ctx context.Context, r *storepb.LabelNamesReques
 	}, nil
 }
 
-// LabelValues returns all known label values for a given label name.
+// LabelValues returns all known label values for a given label name, or the ones of the series matching the given
+// matchers.
 func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequest) (
 	*storepb.LabelValuesResponse, error,
 ) {
@@ -626,25 +830,36 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 					storeDebugMatcher = value
 				}
 			}
-			// We can skip error, we already translated matchers once.
-			ok, _ = storeMatches(st, r.Start, r.End, storeDebugMatcher)
+			// The matchers are translated again by the stores, which return an error if they are invalid.
+			ok, _ = storeMatches(st, r.Start, r.End, storeDebugMatcher, r.Matchers...)
 		})
 		if !ok {
 			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s filtered out", st))
 			continue
 		}
 		storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s queried", st))
+		storeQueried(ctx, st)
 
 		g.Go(func() error {
-			resp, err := store.LabelValues(gctx, &storepb.LabelValuesRequest{
+			req := &storepb.LabelValuesRequest{
 				Label:                   r.Label,
 				PartialResponseDisabled: r.PartialResponseDisabled,
 				Start:                   r.Start,
 				End:                     r.End,
-			})
+				Matchers:                r.Matchers,
+			}
+			var (
+				resp *storepb.LabelValuesResponse
+				err  error
+			)
+			if len(r.Matchers) > 0 && !store.LabelMatchers() {
+				resp, err = labelValuesFromSeries(gctx, store, req)
+			} else {
+				resp, err = store.LabelValues(gctx, req)
+			}
 			if err != nil {
 				err = errors.Wrapf(err, "fetch label values from store %s", store)
-				if r.PartialResponseDisabled {
+				if !s.partialResponse(gctx, store, r.PartialResponseDisabled) {
 					return err
 				}
 
@@ -673,3 +888,70 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 		Warnings: warnings,
 	}, nil
 }
+
+// labelNamesFromSeries returns the label names of the series of the store matching the matchers of the request, for
+// stores ignoring the matchers of LabelNames requests.
+func labelNamesFromSeries(ctx context.Context, st Client, r *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+	names := map[string]struct{}{}
+	warns, err := forEachSeriesLabels(ctx, st, &storepb.SeriesRequest{
+		MinTime:                 r.Start,
+		MaxTime:                 r.End,
+		Matchers:                r.Matchers,
+		PartialResponseDisabled: r.PartialResponseDisabled,
+	}, func(lset []labelpb.ZLabel) {
+		for _, l := range lset {
+			names[l.Name] = struct{}{}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &storepb.LabelNamesResponse{Names: sortedKeys(names), Warnings: warns}, nil
+}
+
+// labelValuesFromSeries returns the values of the label in the series of the store matching the matchers of the
+// request, for stores ignoring the matchers of LabelValues requests.
+func labelValuesFromSeries(ctx context.Context, st Client, r *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	values := map[string]struct{}{}
+	warns, err := forEachSeriesLabels(ctx, st, &storepb.SeriesRequest{
+		MinTime:                 r.Start,
+		MaxTime:                 r.End,
+		Matchers:                r.Matchers,
+		PartialResponseDisabled: r.PartialResponseDisabled,
+	}, func(lset []labelpb.ZLabel) {
+		for _, l := range lset {
+			if l.Name == r.Label {
+				values[l.Value] = struct{}{}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &storepb.LabelValuesResponse{Values: sortedKeys(values), Warnings: warns}, nil
+}
+
+// forEachSeriesLabels calls f with the labels of each series of the store matching the request, without their chunks.
+func forEachSeriesLabels(ctx context.Context, st Client, r *storepb.SeriesRequest, f func([]labelpb.ZLabel)) ([]string, error) {
+	r.SkipChunks = true
+	sc, err := st.Series(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	var warns []string
+	for {
+		resp, err := sc.Recv()
+		if err == io.EOF {
+			return warns, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if w := resp.GetWarning(); w != "" {
+			warns = append(warns, w)
+		}
+		if s := resp.GetSeries(); s != nil {
+			f(s.Labels)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,6 +28,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	storetestutil "github.com/thanos-io/thanos/pkg/store/storepb/testutil"
@@ -40,6 +42,8 @@ type testClient struct {
 	labelSets []labels.Labels
 	minTime   int64
 	maxTime   int64
+	// noLabelMatchers is true if the store ignores the matchers of label names and values requests.
+	noLabelMatchers bool
 }
 
 func (c testClient) LabelSets() []labels.Labels {
@@ -50,6 +54,10 @@ func (c testClient) TimeRange() (int64, int64) {
 	return c.minTime, c.maxTime
 }
 
+func (c testClient) LabelMatchers() bool {
+	return !c.noLabelMatchers
+}
+
 func (c testClient) String() string {
 	return "test"
 }
@@ -68,7 +76,7 @@ func TestProxyStore_Info(t *testing.T) {
 		nil,
 		func() []Client { return nil },
 		component.Query,
-		nil, 0*time.Second,
+		nil, 0*time.Second, nil,
 	)
 
 	resp, err := q.Info(ctx, &storepb.InfoRequest{})
@@ -477,6 +485,7 @@ func TestProxyStore_Series(t *testing.T) {
 				component.Query,
 				tc.selectorLabels,
 				0*time.Second,
+				nil,
 			)
 
 			ctx := context.Background()
@@ -1000,6 +1009,7 @@ func TestProxyStore_SeriesSlowStores(t *testing.T) {
 				component.Query,
 				tc.selectorLabels,
 				4*time.Second,
+				nil,
 			)
 
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -1049,6 +1059,7 @@ func TestProxyStore_Series_RequestParamsProxied(t *testing.T) {
 		component.Query,
 		nil,
 		0*time.Second,
+		nil,
 	)
 
 	ctx := context.Background()
@@ -1070,6 +1081,219 @@ func TestProxyStore_Series_RequestParamsProxied(t *testing.T) {
 	testutil.Assert(t, proto.Equal(req, m.LastSeriesReq), "request was not proxied properly to underlying storeAPI: %s vs %s", req, m.LastSeriesReq)
 }
 
+func TestProxyStore_Series_QueryStats(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	queriedBlocks := []hintspb.Block{
+		{Id: "01EZ4GXJ6AGPD9JYCJ0E4D5V5A", MinTime: 0, MaxTime: 100, Resolution: 0},
+		{Id: "01EZ4GXJ6AGPD9JYCJ0E4D5V5B", MinTime: 100, MaxTime: 200, Resolution: 300000},
+	}
+
+	withStats := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}}),
+			storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{0, 0}}, []sample{{1, 1}}),
+			storepb.NewHintsSeriesResponse(mustMarshalAny(&hintspb.SeriesResponseHints{
+				QueryStats:    &hintspb.QueryStats{BlocksQueried: 2, DataDownloadedSizeSum: 100},
+				QueriedBlocks: queriedBlocks,
+			})),
+		},
+	}
+	withoutStats := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "c"), []sample{{0, 0}}),
+		},
+	}
+	cls := []Client{
+		&testClient{StoreClient: withStats, minTime: 1, maxTime: 300},
+		&testClient{StoreClient: withoutStats, minTime: 1, maxTime: 300},
+	}
+	q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second, nil)
+
+	for _, enableQueryStats := range []bool{false, true} {
+		s := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+			MinTime:  1,
+			MaxTime:  300,
+			Matchers: []storepb.LabelMatcher{{Name: "a", Value: ".*", Type: storepb.LabelMatcher_RE}},
+			Hints:    mustMarshalAny(&hintspb.SeriesRequestHints{EnableQueryStats: enableQueryStats}),
+		}, s))
+		testutil.Equals(t, 3, len(s.SeriesSet))
+
+		if !enableQueryStats {
+			// Request hints are not forwarded, so the stores don't return stats.
+			testutil.Assert(t, withStats.LastSeriesReq.Hints == nil, "unexpected request hints")
+			testutil.Equals(t, 0, len(s.HintsSet))
+			continue
+		}
+
+		reqHints := &hintspb.SeriesRequestHints{}
+		testutil.Ok(t, types.UnmarshalAny(withStats.LastSeriesReq.Hints, reqHints))
+		testutil.Equals(t, &hintspb.SeriesRequestHints{EnableQueryStats: true}, reqHints)
+
+		testutil.Equals(t, 1, len(s.HintsSet))
+		resHints := &hintspb.SeriesResponseHints{}
+		testutil.Ok(t, types.UnmarshalAny(s.HintsSet[0], resHints))
+		for i := range resHints.StoresQueryStats {
+			testutil.Assert(t, resHints.StoresQueryStats[i].Duration > 0, "expected duration of store %d", i)
+			resHints.StoresQueryStats[i].Duration = 0
+		}
+		testutil.Equals(t, []hintspb.StoreQueryStats{
+			{Store: "test", MinTime: 1, MaxTime: 300, SeriesReceived: 2, ChunksReceived: 3, QueryStats: &hintspb.QueryStats{BlocksQueried: 2, DataDownloadedSizeSum: 100}, QueriedBlocks: queriedBlocks},
+			{Store: "test", MinTime: 1, MaxTime: 300, SeriesReceived: 1, ChunksReceived: 1},
+		}, resHints.StoresQueryStats)
+	}
+}
+
+func TestProxyStore_PlanSeries(t *testing.T) {
+	cls := []Client{
+		&testClient{labelSets: []labels.Labels{labels.FromStrings("ext", "1")}, minTime: 1, maxTime: 300},
+		&testClient{labelSets: []labels.Labels{labels.FromStrings("ext", "2")}, minTime: 1, maxTime: 300},
+		&testClient{labelSets: []labels.Labels{labels.FromStrings("ext", "1")}, minTime: 400, maxTime: 500},
+	}
+	q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, labels.FromStrings("region", "eu"), 0*time.Second, nil)
+
+	req := &storepb.SeriesRequest{
+		MinTime: 1,
+		MaxTime: 300,
+		Matchers: []storepb.LabelMatcher{
+			{Name: "region", Value: "eu", Type: storepb.LabelMatcher_EQ},
+			{Name: "ext", Value: "1", Type: storepb.LabelMatcher_EQ},
+		},
+	}
+	plan, err := q.PlanSeries(context.Background(), req)
+	testutil.Ok(t, err)
+	testutil.Equals(t, &SeriesPlan{Matchers: `{ext="1"}`, Stores: []StorePlan{
+		{Store: "test", Queried: true},
+		{Store: "test", Reason: "label sets of the store do not match the matchers"},
+		{Store: "test", Reason: "time range of the store does not overlap the time range of the request"},
+	}}, plan)
+
+	// The store matchers filter the stores by address.
+	ctx := context.WithValue(context.Background(), StoreMatcherKey, [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "__address__", "other")}})
+	plan, err = q.PlanSeries(ctx, req)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "store does not match the store matchers", plan.Stores[0].Reason)
+
+	req.Matchers[0].Value = "us"
+	plan, err = q.PlanSeries(context.Background(), req)
+	testutil.Ok(t, err)
+	testutil.Equals(t, &SeriesPlan{Matchers: `{}`, Stores: []StorePlan{}, Reason: "matchers do not match the selector labels of the proxy"}, plan)
+}
+
+func TestProxyStore_Series_QueriedStores(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	cls := []Client{
+		&testClient{
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}})},
+			},
+			minTime: 1,
+			maxTime: 300,
+		},
+		// Filtered out by its time range.
+		&testClient{StoreClient: &mockedStoreAPI{}, minTime: 400, maxTime: 500},
+	}
+	q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second, nil)
+
+	var queried []string
+	ctx := context.WithValue(context.Background(), QueriedStoreKey, func(addr string) { queried = append(queried, addr) })
+	s := newStoreSeriesServer(ctx)
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+	}, s))
+	testutil.Equals(t, 1, len(s.SeriesSet))
+	testutil.Equals(t, []string{"testaddr"}, queried)
+}
+
+func TestProxyStore_PartialResponsePolicy(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	healthy := &testClient{
+		StoreClient: &mockedStoreAPI{
+			RespSeries:     []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}})},
+			RespLabelNames: &storepb.LabelNamesResponse{Names: []string{"a"}},
+		},
+		minTime: 1,
+		maxTime: 300,
+	}
+	failing := &testClient{StoreClient: &mockedStoreAPI{RespError: errors.New("store down")}, minTime: 1, maxTime: 300}
+	failingStream := &testClient{
+		StoreClient: &mockedStoreAPI{
+			RespSeries:    []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{0, 0}})},
+			injectedError: errors.New("stream broken"),
+		},
+		minTime: 1,
+		maxTime: 300,
+	}
+
+	for _, tc := range []struct {
+		name                    string
+		failing                 Client
+		policy                  PartialResponsePolicy
+		partialResponseDisabled bool
+		explicit                bool
+		expectErr               bool
+	}{
+		{name: "default policy follows enabled partial response", failing: failing, policy: PartialResponseDefault},
+		{name: "default policy follows disabled partial response", failing: failing, policy: PartialResponseDefault, partialResponseDisabled: true, expectErr: true},
+		{name: "strict store fails enabled partial response", failing: failing, policy: PartialResponseStrict, expectErr: true},
+		{name: "best-effort store with disabled partial response", failing: failing, policy: PartialResponseBestEffort, partialResponseDisabled: true},
+		{name: "best-effort store with explicitly disabled partial response", failing: failing, policy: PartialResponseBestEffort, partialResponseDisabled: true, explicit: true, expectErr: true},
+		{name: "strict store failing while streaming", failing: failingStream, policy: PartialResponseStrict, expectErr: true},
+		{name: "best-effort store failing while streaming", failing: failingStream, policy: PartialResponseBestEffort, partialResponseDisabled: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cls := []Client{healthy, tc.failing}
+			q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second, func(st Client) PartialResponsePolicy {
+				if st == tc.failing {
+					return tc.policy
+				}
+				return PartialResponseStrict
+			})
+
+			ctx := context.Background()
+			if tc.explicit {
+				ctx = context.WithValue(ctx, PartialResponseDisabledKey, true)
+			}
+			s := newStoreSeriesServer(ctx)
+			err := q.Series(&storepb.SeriesRequest{
+				MinTime:                 1,
+				MaxTime:                 300,
+				Matchers:                []storepb.LabelMatcher{{Name: "a", Value: ".*", Type: storepb.LabelMatcher_RE}},
+				PartialResponseDisabled: tc.partialResponseDisabled,
+			}, s)
+			if tc.expectErr {
+				testutil.NotOk(t, err)
+
+				if tc.failing == failing {
+					_, err = q.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 1, End: 300, PartialResponseDisabled: tc.partialResponseDisabled})
+					testutil.NotOk(t, err)
+				}
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(s.Warnings))
+			testutil.Assert(t, strings.Contains(s.Warnings[0], "test"), "warning %q does not name the failed store", s.Warnings[0])
+
+			if tc.failing != failing {
+				return
+			}
+			resp, err := q.LabelNames(ctx, &storepb.LabelNamesRequest{
+				Start:                   1,
+				End:                     300,
+				PartialResponseDisabled: tc.partialResponseDisabled,
+			})
+			testutil.Ok(t, err)
+			testutil.Equals(t, []string{"a"}, resp.Names)
+			testutil.Equals(t, 1, len(resp.Warnings))
+		})
+	}
+}
+
 func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -1109,6 +1333,7 @@ func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 		component.Query,
 		labels.FromStrings("fed", "a"),
 		0*time.Second,
+		nil,
 	)
 
 	ctx := context.Background()
@@ -1155,6 +1380,7 @@ func TestProxyStore_LabelValues(t *testing.T) {
 		component.Query,
 		nil,
 		0*time.Second,
+		nil,
 	)
 
 	ctx := context.Background()
@@ -1186,6 +1412,119 @@ func TestProxyStore_LabelValues(t *testing.T) {
 	testutil.Equals(t, 1, len(resp.Warnings))
 }
 
+func TestProxyStore_LabelNamesValues_Matchers(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	m1 := &mockedStoreAPI{
+		RespLabelNames:  &storepb.LabelNamesResponse{Names: []string{"a", "b"}},
+		RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"1", "2"}},
+	}
+	m2 := &mockedStoreAPI{
+		RespLabelNames:  &storepb.LabelNamesResponse{Names: []string{"c"}},
+		RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"3"}},
+	}
+	cls := []Client{
+		&testClient{
+			StoreClient: m1,
+			labelSets:   []labels.Labels{labels.FromStrings("ext", "1")},
+			minTime:     math.MinInt64,
+			maxTime:     math.MaxInt64,
+		},
+		&testClient{
+			StoreClient: m2,
+			labelSets:   []labels.Labels{labels.FromStrings("ext", "2")},
+			minTime:     math.MinInt64,
+			maxTime:     math.MaxInt64,
+		},
+	}
+	q := NewProxyStore(nil,
+		nil,
+		func() []Client { return cls },
+		component.Query,
+		nil,
+		0*time.Second,
+		nil,
+	)
+
+	ctx := context.Background()
+	matchers := []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_EQ, Name: "ext", Value: "1"},
+		{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+	}
+
+	// The matchers are forwarded, and the stores not matching the external labels are skipped.
+	namesReq := &storepb.LabelNamesRequest{
+		PartialResponseDisabled: true,
+		Start:                   timestamp.FromTime(minTime),
+		End:                     timestamp.FromTime(maxTime),
+		Matchers:                matchers,
+	}
+	namesResp, err := q.LabelNames(ctx, namesReq)
+	testutil.Ok(t, err)
+	testutil.Assert(t, proto.Equal(namesReq, m1.LastLabelNamesReq), "request was not proxied properly to underlying storeAPI: %s vs %s", namesReq, m1.LastLabelNamesReq)
+	testutil.Assert(t, m2.LastLabelNamesReq == nil, "store not matching the external labels should not be queried")
+	testutil.Equals(t, []string{"a", "b"}, namesResp.Names)
+
+	valuesReq := &storepb.LabelValuesRequest{
+		Label:                   "a",
+		PartialResponseDisabled: true,
+		Start:                   timestamp.FromTime(minTime),
+		End:                     timestamp.FromTime(maxTime),
+		Matchers:                matchers,
+	}
+	valuesResp, err := q.LabelValues(ctx, valuesReq)
+	testutil.Ok(t, err)
+	testutil.Assert(t, proto.Equal(valuesReq, m1.LastLabelValuesReq), "request was not proxied properly to underlying storeAPI: %s vs %s", valuesReq, m1.LastLabelValuesReq)
+	testutil.Assert(t, m2.LastLabelValuesReq == nil, "store not matching the external labels should not be queried")
+	testutil.Equals(t, []string{"1", "2"}, valuesResp.Values)
+}
+
+func TestProxyStore_LabelNamesValues_NoLabelMatchers(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	// The store ignores the matchers of label requests, so its label names and values are gathered from its series.
+	m := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "1", "tenant_id", "team-a")),
+			storeSeriesResponse(t, labels.FromStrings("a", "2", "b", "1", "tenant_id", "team-a")),
+			storepb.NewWarnSeriesResponse(errors.New("warning")),
+		},
+		RespLabelNames:  &storepb.LabelNamesResponse{Names: []string{"a", "b", "c", "tenant_id"}},
+		RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"1", "2", "3"}},
+	}
+	cls := []Client{&testClient{StoreClient: m, minTime: math.MinInt64, maxTime: math.MaxInt64, noLabelMatchers: true}}
+	q := NewProxyStore(nil,
+		nil,
+		func() []Client { return cls },
+		component.Query,
+		nil,
+		0*time.Second,
+		nil,
+	)
+
+	ctx := context.Background()
+	matchers := []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "tenant_id", Value: "team-a"}}
+	namesResp, err := q.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 0, End: 10, Matchers: matchers})
+	testutil.Ok(t, err)
+	testutil.Assert(t, m.LastLabelNamesReq == nil, "label names should be gathered from the series")
+	testutil.Equals(t, &storepb.SeriesRequest{MinTime: 0, MaxTime: 10, Matchers: matchers, SkipChunks: true}, m.LastSeriesReq)
+	testutil.Equals(t, []string{"a", "b", "tenant_id"}, namesResp.Names)
+	testutil.Equals(t, []string{"warning"}, namesResp.Warnings)
+
+	valuesResp, err := q.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "a", Start: 0, End: 10, Matchers: matchers})
+	testutil.Ok(t, err)
+	testutil.Assert(t, m.LastLabelValuesReq == nil, "label values should be gathered from the series")
+	testutil.Equals(t, []string{"1", "2"}, valuesResp.Values)
+
+	// Without matchers, the label requests are forwarded.
+	namesResp, err = q.LabelNames(ctx, &storepb.LabelNamesRequest{Start: 0, End: 10})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b", "c", "tenant_id"}, namesResp.Names)
+	valuesResp, err = q.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "a", Start: 0, End: 10})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"1", "2", "3"}, valuesResp.Values)
+}
+
 func TestProxyStore_LabelNames(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -1352,6 +1691,7 @@ func TestProxyStore_LabelNames(t *testing.T) {
 				component.Query,
 				nil,
 				0*time.Second,
+				nil,
 			)
 
 			ctx := context.Background()
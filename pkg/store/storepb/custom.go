@@ -337,6 +337,44 @@ func (x *PartialResponseStrategy) MarshalJSON() ([]byte, error) {
 	return []byte(strconv.Quote(x.String())), nil
 }
 
+// AggrsFromFunc infers aggregates of the underlying data based on the wrapping
+// function of a series selection.
+func AggrsFromFunc(f string) []Aggr {
+	if f == "min" || strings.HasPrefix(f, "min_") {
+		return []Aggr{Aggr_MIN}
+	}
+	if f == "max" || strings.HasPrefix(f, "max_") {
+		return []Aggr{Aggr_MAX}
+	}
+	if f == "count" || strings.HasPrefix(f, "count_") {
+		return []Aggr{Aggr_COUNT}
+	}
+	// f == "sum" falls through here since we want the actual samples.
+	if strings.HasPrefix(f, "sum_") {
+		return []Aggr{Aggr_SUM}
+	}
+	if f == "increase" || f == "rate" || f == "irate" || f == "resets" {
+		return []Aggr{Aggr_COUNTER}
+	}
+	// In the default case, we retrieve count and sum to compute an average.
+	return []Aggr{Aggr_COUNT, Aggr_SUM}
+}
+
+// Matches returns true if the series with the given labels belongs to the shard. A nil shard matches all the series.
+func (m *ShardInfo) Matches(lset labels.Labels) bool {
+	if m == nil || m.TotalShards < 1 {
+		return true
+	}
+
+	var h uint64
+	if m.By {
+		h, _ = lset.HashForLabels(nil, m.Labels...)
+	} else {
+		h, _ = lset.HashWithoutLabels(nil, m.Labels...)
+	}
+	return h%uint64(m.TotalShards) == uint64(m.ShardIndex)
+}
+
 // TranslatePromMatchers returns proto matchers from Prometheus matchers.
 // NOTE: It allocates memory.
 func TranslatePromMatchers(ms ...*labels.Matcher) ([]LabelMatcher, error) {
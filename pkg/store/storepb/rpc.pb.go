@@ -229,6 +229,9 @@ type InfoResponse struct {
 	StoreType StoreType                                              `protobuf:"varint,4,opt,name=storeType,proto3,enum=thanos.StoreType" json:"storeType,omitempty"`
 	// label_sets is an unsorted list of `ZLabelSet`s.
 	LabelSets []labelpb.ZLabelSet `protobuf:"bytes,5,rep,name=label_sets,json=labelSets,proto3" json:"label_sets"`
+	// label_matchers is true if the store restricts the label names and values to the ones of the series matching the
+	// matchers of LabelNames and LabelValues requests. Queriers gather them from the series of the other stores.
+	LabelMatchers bool `protobuf:"varint,6,opt,name=label_matchers,json=labelMatchers,proto3" json:"label_matchers,omitempty"`
 }
 
 func (m *InfoResponse) Reset()         { *m = InfoResponse{} }
@@ -280,6 +283,9 @@ type SeriesRequest struct {
 	// The content of this field and whether it's supported depends on the
 	// implementation of a specific store.
 	Hints *types.Any `protobuf:"bytes,9,opt,name=hints,proto3" json:"hints,omitempty"`
+	// shard_info selects the shard of the series to return, if any. Store implementations only send the series
+	// belonging to the shard.
+	ShardInfo *ShardInfo `protobuf:"bytes,11,opt,name=shard_info,json=shardInfo,proto3" json:"shard_info,omitempty"`
 }
 
 func (m *SeriesRequest) Reset()         { *m = SeriesRequest{} }
@@ -315,6 +321,50 @@ func (m *SeriesRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_SeriesRequest proto.InternalMessageInfo
 
+// ShardInfo selects a shard of the series, which are assigned to the shards by the hash of their labels.
+type ShardInfo struct {
+	// shard_index is the index of the selected shard, from 0 to total_shards-1.
+	ShardIndex  int64 `protobuf:"varint,1,opt,name=shard_index,json=shardIndex,proto3" json:"shard_index,omitempty"`
+	TotalShards int64 `protobuf:"varint,2,opt,name=total_shards,json=totalShards,proto3" json:"total_shards,omitempty"`
+	// by is true if the series are hashed by the labels, and false if they are hashed by all their labels but
+	// the labels and the metric name.
+	By     bool     `protobuf:"varint,3,opt,name=by,proto3" json:"by,omitempty"`
+	Labels []string `protobuf:"bytes,4,rep,name=labels,proto3" json:"labels,omitempty"`
+}
+
+func (m *ShardInfo) Reset()         { *m = ShardInfo{} }
+func (m *ShardInfo) String() string { return proto.CompactTextString(m) }
+func (*ShardInfo) ProtoMessage()    {}
+func (*ShardInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a938d55a388af629, []int{5}
+}
+func (m *ShardInfo) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ShardInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ShardInfo.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ShardInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShardInfo.Merge(m, src)
+}
+func (m *ShardInfo) XXX_Size() int {
+	return m.Size()
+}
+func (m *ShardInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShardInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShardInfo proto.InternalMessageInfo
+
 type SeriesResponse struct {
 	// Types that are valid to be assigned to Result:
 	//	*SeriesResponse_Series
@@ -327,7 +377,7 @@ func (m *SeriesResponse) Reset()         { *m = SeriesResponse{} }
 func (m *SeriesResponse) String() string { return proto.CompactTextString(m) }
 func (*SeriesResponse) ProtoMessage()    {}
 func (*SeriesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{5}
+	return fileDescriptor_a938d55a388af629, []int{6}
 }
 func (m *SeriesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -419,13 +469,15 @@ type LabelNamesRequest struct {
 	PartialResponseStrategy PartialResponseStrategy `protobuf:"varint,2,opt,name=partial_response_strategy,json=partialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partial_response_strategy,omitempty"`
 	Start                   int64                   `protobuf:"varint,3,opt,name=start,proto3" json:"start,omitempty"`
 	End                     int64                   `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`
+	// matchers restrict the label names to the ones of the series matching all of them, if any.
+	Matchers []LabelMatcher `protobuf:"bytes,5,rep,name=matchers,proto3" json:"matchers"`
 }
 
 func (m *LabelNamesRequest) Reset()         { *m = LabelNamesRequest{} }
 func (m *LabelNamesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesRequest) ProtoMessage()    {}
 func (*LabelNamesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{6}
+	return fileDescriptor_a938d55a388af629, []int{7}
 }
 func (m *LabelNamesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -463,7 +515,7 @@ func (m *LabelNamesResponse) Reset()         { *m = LabelNamesResponse{} }
 func (m *LabelNamesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesResponse) ProtoMessage()    {}
 func (*LabelNamesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{7}
+	return fileDescriptor_a938d55a388af629, []int{8}
 }
 func (m *LabelNamesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -499,13 +551,15 @@ type LabelValuesRequest struct {
 	PartialResponseStrategy PartialResponseStrategy `protobuf:"varint,3,opt,name=partial_response_strategy,json=partialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partial_response_strategy,omitempty"`
 	Start                   int64                   `protobuf:"varint,4,opt,name=start,proto3" json:"start,omitempty"`
 	End                     int64                   `protobuf:"varint,5,opt,name=end,proto3" json:"end,omitempty"`
+	// matchers restrict the label values to the ones of the series matching all of them, if any.
+	Matchers []LabelMatcher `protobuf:"bytes,6,rep,name=matchers,proto3" json:"matchers"`
 }
 
 func (m *LabelValuesRequest) Reset()         { *m = LabelValuesRequest{} }
 func (m *LabelValuesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesRequest) ProtoMessage()    {}
 func (*LabelValuesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{8}
+	return fileDescriptor_a938d55a388af629, []int{9}
 }
 func (m *LabelValuesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -543,7 +597,7 @@ func (m *LabelValuesResponse) Reset()         { *m = LabelValuesResponse{} }
 func (m *LabelValuesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesResponse) ProtoMessage()    {}
 func (*LabelValuesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a938d55a388af629, []int{9}
+	return fileDescriptor_a938d55a388af629, []int{10}
 }
 func (m *LabelValuesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -580,6 +634,7 @@ func init() {
 	proto.RegisterType((*InfoRequest)(nil), "thanos.InfoRequest")
 	proto.RegisterType((*InfoResponse)(nil), "thanos.InfoResponse")
 	proto.RegisterType((*SeriesRequest)(nil), "thanos.SeriesRequest")
+	proto.RegisterType((*ShardInfo)(nil), "thanos.ShardInfo")
 	proto.RegisterType((*SeriesResponse)(nil), "thanos.SeriesResponse")
 	proto.RegisterType((*LabelNamesRequest)(nil), "thanos.LabelNamesRequest")
 	proto.RegisterType((*LabelNamesResponse)(nil), "thanos.LabelNamesResponse")
@@ -590,72 +645,79 @@ func init() {
 func init() { proto.RegisterFile("store/storepb/rpc.proto", fileDescriptor_a938d55a388af629) }
 
 var fileDescriptor_a938d55a388af629 = []byte{
-	// 1031 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x4b, 0x6f, 0x23, 0x45,
-	0x10, 0xf6, 0x78, 0xfc, 0x2c, 0x6f, 0xc2, 0x6c, 0xc7, 0xc9, 0x4e, 0xbc, 0x92, 0x63, 0x59, 0x42,
-	0xb2, 0xa2, 0xc5, 0x06, 0x83, 0x56, 0x02, 0xed, 0xc5, 0x4e, 0xbc, 0x24, 0x62, 0xe3, 0x40, 0x3b,
-	0xde, 0xc0, 0x22, 0x64, 0x8d, 0x9d, 0xde, 0xf1, 0x28, 0xf3, 0x62, 0xba, 0x4d, 0xe2, 0x2b, 0xdc,
-	0x11, 0xe2, 0x3f, 0x21, 0xe5, 0xb8, 0x07, 0x0e, 0x88, 0xc3, 0x0a, 0x92, 0x23, 0x7f, 0x02, 0xf5,
-	0x63, 0x1c, 0x4f, 0xc8, 0xe6, 0x12, 0x2e, 0x56, 0x57, 0x7d, 0x55, 0xd5, 0x5f, 0x7f, 0xd5, 0xd5,
-	0x1e, 0x78, 0x44, 0x59, 0x10, 0x91, 0x96, 0xf8, 0x0d, 0xc7, 0xad, 0x28, 0x9c, 0x34, 0xc3, 0x28,
-	0x60, 0x01, 0xca, 0xb1, 0xa9, 0xe5, 0x07, 0xb4, 0xb2, 0x99, 0x0c, 0x60, 0xf3, 0x90, 0x50, 0x19,
-	0x52, 0x29, 0xdb, 0x81, 0x1d, 0x88, 0x65, 0x8b, 0xaf, 0x94, 0xb7, 0x96, 0x4c, 0x08, 0xa3, 0xc0,
-	0xbb, 0x91, 0xa7, 0x4a, 0xba, 0xd6, 0x98, 0xb8, 0x37, 0x21, 0x3b, 0x08, 0x6c, 0x97, 0xb4, 0x84,
-	0x35, 0x9e, 0xbd, 0x6e, 0x59, 0xfe, 0x5c, 0x42, 0xf5, 0xf7, 0x60, 0xe5, 0x38, 0x72, 0x18, 0xc1,
-	0x84, 0x86, 0x81, 0x4f, 0x49, 0xfd, 0x27, 0x0d, 0x1e, 0x28, 0xcf, 0xf7, 0x33, 0x42, 0x19, 0xea,
-	0x00, 0x30, 0xc7, 0x23, 0x94, 0x44, 0x0e, 0xa1, 0xa6, 0x56, 0xd3, 0x1b, 0xa5, 0xf6, 0x63, 0x9e,
-	0xed, 0x11, 0x36, 0x25, 0x33, 0x3a, 0x9a, 0x04, 0xe1, 0xbc, 0x79, 0xe4, 0x78, 0x64, 0x20, 0x42,
-	0xba, 0x99, 0x8b, 0xb7, 0x5b, 0x29, 0xbc, 0x94, 0x84, 0x36, 0x20, 0xc7, 0x88, 0x6f, 0xf9, 0xcc,
-	0x4c, 0xd7, 0xb4, 0x46, 0x11, 0x2b, 0x0b, 0x99, 0x90, 0x8f, 0x48, 0xe8, 0x3a, 0x13, 0xcb, 0xd4,
-	0x6b, 0x5a, 0x43, 0xc7, 0xb1, 0x59, 0x5f, 0x81, 0xd2, 0xbe, 0xff, 0x3a, 0x50, 0x1c, 0xea, 0xbf,
-	0xa6, 0xe1, 0x81, 0xb4, 0x25, 0x4b, 0x34, 0x81, 0x9c, 0x38, 0x68, 0x4c, 0x68, 0xa5, 0x29, 0x85,
-	0x6d, 0xbe, 0xe0, 0xde, 0xee, 0x33, 0x4e, 0xe1, 0xcf, 0xb7, 0x5b, 0x9f, 0xd8, 0x0e, 0x9b, 0xce,
-	0xc6, 0xcd, 0x49, 0xe0, 0xb5, 0x64, 0xc0, 0x07, 0x4e, 0xa0, 0x56, 0xad, 0xf0, 0xd4, 0x6e, 0x25,
-	0x34, 0x6b, 0xbe, 0x12, 0xd9, 0x58, 0x95, 0x46, 0x9b, 0x50, 0xf0, 0x1c, 0x7f, 0xc4, 0x0f, 0x22,
-	0x88, 0xeb, 0x38, 0xef, 0x39, 0x3e, 0x3f, 0xa9, 0x80, 0xac, 0x73, 0x09, 0x29, 0xea, 0x9e, 0x75,
-	0x2e, 0xa0, 0x16, 0x14, 0x45, 0xd5, 0xa3, 0x79, 0x48, 0xcc, 0x4c, 0x4d, 0x6b, 0xac, 0xb6, 0x1f,
-	0xc6, 0xec, 0x06, 0x31, 0x80, 0xaf, 0x63, 0xd0, 0x53, 0x00, 0xb1, 0xe1, 0x88, 0x12, 0x46, 0xcd,
-	0xac, 0x38, 0xcf, 0x22, 0x43, 0x52, 0x1a, 0x10, 0xa6, 0x64, 0x2d, 0xba, 0xca, 0xa6, 0xf5, 0xdf,
-	0x74, 0x58, 0x91, 0x92, 0xc7, 0xad, 0x5a, 0x26, 0xac, 0xbd, 0x9b, 0x70, 0x3a, 0x49, 0xf8, 0x29,
-	0x87, 0xd8, 0x64, 0x4a, 0x22, 0x6a, 0xea, 0x62, 0xf7, 0x72, 0x42, 0xcd, 0x03, 0x09, 0x2a, 0x02,
-	0x8b, 0x58, 0xd4, 0x86, 0x75, 0x5e, 0x32, 0x22, 0x34, 0x70, 0x67, 0xcc, 0x09, 0xfc, 0xd1, 0x99,
-	0xe3, 0x9f, 0x04, 0x67, 0xe2, 0xd0, 0x3a, 0x5e, 0xf3, 0xac, 0x73, 0xbc, 0xc0, 0x8e, 0x05, 0x84,
-	0x9e, 0x00, 0x58, 0xb6, 0x1d, 0x11, 0xdb, 0x62, 0x44, 0x9e, 0x75, 0xb5, 0xfd, 0x20, 0xde, 0xad,
-	0x63, 0xdb, 0x11, 0x5e, 0xc2, 0xd1, 0x67, 0xb0, 0x19, 0x5a, 0x11, 0x73, 0x2c, 0x97, 0xef, 0x22,
-	0x3a, 0x3f, 0x3a, 0x71, 0xa8, 0x35, 0x76, 0xc9, 0x89, 0x99, 0xab, 0x69, 0x8d, 0x02, 0x7e, 0xa4,
-	0x02, 0xe2, 0x9b, 0xb1, 0xab, 0x60, 0xf4, 0xed, 0x2d, 0xb9, 0x94, 0x45, 0x16, 0x23, 0xf6, 0xdc,
-	0xcc, 0x8b, 0xb6, 0x6c, 0xc5, 0x1b, 0x7f, 0x99, 0xac, 0x31, 0x50, 0x61, 0xff, 0x29, 0x1e, 0x03,
-	0x68, 0x0b, 0x4a, 0xf4, 0xd4, 0x09, 0x47, 0x93, 0xe9, 0xcc, 0x3f, 0xa5, 0x66, 0x41, 0x50, 0x01,
-	0xee, 0xda, 0x11, 0x1e, 0xb4, 0x0d, 0xd9, 0xa9, 0xe3, 0x33, 0x6a, 0x16, 0x6b, 0x9a, 0x10, 0x54,
-	0x4e, 0x60, 0x33, 0x9e, 0xc0, 0x66, 0xc7, 0x9f, 0x63, 0x19, 0x52, 0xff, 0x59, 0x83, 0xd5, 0xb8,
-	0x8f, 0xea, 0x7a, 0x37, 0x20, 0xb7, 0x98, 0x37, 0x9e, 0xbf, 0xba, 0xb8, 0x40, 0xc2, 0xbb, 0x97,
-	0xc2, 0x0a, 0x47, 0x15, 0xc8, 0x9f, 0x59, 0x91, 0xef, 0xf8, 0xb6, 0x9c, 0xad, 0xbd, 0x14, 0x8e,
-	0x1d, 0xe8, 0x49, 0x4c, 0x42, 0x7f, 0x37, 0x89, 0xbd, 0x94, 0xa2, 0xd1, 0x2d, 0x40, 0x2e, 0x22,
-	0x74, 0xe6, 0xb2, 0xfa, 0xef, 0x1a, 0x3c, 0x14, 0x9d, 0xef, 0x5b, 0xde, 0xf5, 0xe5, 0xba, 0xb3,
-	0x19, 0xda, 0x3d, 0x9a, 0x91, 0xbe, 0x67, 0x33, 0xca, 0x90, 0xa5, 0xcc, 0x8a, 0x98, 0x1a, 0x44,
-	0x69, 0x20, 0x03, 0x74, 0xe2, 0x9f, 0xa8, 0xbb, 0xc8, 0x97, 0xf5, 0xe7, 0x80, 0x96, 0x4f, 0xa5,
-	0xa4, 0x2e, 0x43, 0xd6, 0xe7, 0x0e, 0xf1, 0x90, 0x14, 0xb1, 0x34, 0x50, 0x05, 0x0a, 0x4a, 0x45,
-	0x6a, 0xa6, 0x05, 0xb0, 0xb0, 0xeb, 0xff, 0x68, 0xaa, 0xd0, 0x4b, 0xcb, 0x9d, 0x5d, 0xeb, 0x53,
-	0x86, 0xac, 0x98, 0x4d, 0xa1, 0x45, 0x11, 0x4b, 0xe3, 0x6e, 0xd5, 0xd2, 0xf7, 0x50, 0x4d, 0xff,
-	0xbf, 0x54, 0xcb, 0xdc, 0xa2, 0x5a, 0xf6, 0x5a, 0xb5, 0x7d, 0x58, 0x4b, 0x1c, 0x56, 0xc9, 0xb6,
-	0x01, 0xb9, 0x1f, 0x84, 0x47, 0xe9, 0xa6, 0xac, 0xbb, 0x84, 0xdb, 0xfe, 0x0e, 0x8a, 0x8b, 0x07,
-	0x10, 0x95, 0x20, 0x3f, 0xec, 0x7f, 0xd1, 0x3f, 0x3c, 0xee, 0x1b, 0x29, 0x54, 0x84, 0xec, 0x57,
-	0xc3, 0x1e, 0xfe, 0xc6, 0xd0, 0x50, 0x01, 0x32, 0x78, 0xf8, 0xa2, 0x67, 0xa4, 0x79, 0xc4, 0x60,
-	0x7f, 0xb7, 0xb7, 0xd3, 0xc1, 0x86, 0xce, 0x23, 0x06, 0x47, 0x87, 0xb8, 0x67, 0x64, 0xb8, 0x1f,
-	0xf7, 0x76, 0x7a, 0xfb, 0x2f, 0x7b, 0x46, 0x96, 0xfb, 0x77, 0x7b, 0xdd, 0xe1, 0xe7, 0x46, 0x6e,
-	0xbb, 0x0b, 0x19, 0xfe, 0x82, 0xa0, 0x3c, 0xe8, 0xb8, 0x73, 0x2c, 0xab, 0xee, 0x1c, 0x0e, 0xfb,
-	0x47, 0x86, 0xc6, 0x7d, 0x83, 0xe1, 0x81, 0x91, 0xe6, 0x8b, 0x83, 0xfd, 0xbe, 0xa1, 0x8b, 0x45,
-	0xe7, 0x6b, 0x59, 0x4e, 0x44, 0xf5, 0xb0, 0x91, 0x6d, 0xff, 0x98, 0x86, 0xac, 0xe0, 0x88, 0x3e,
-	0x82, 0x0c, 0xff, 0xc7, 0x41, 0x6b, 0xb1, 0xc2, 0x4b, 0xff, 0x47, 0x95, 0x72, 0xd2, 0xa9, 0x34,
-	0xf9, 0x14, 0x72, 0x72, 0x3e, 0xd1, 0x7a, 0x72, 0x5e, 0xe3, 0xb4, 0x8d, 0x9b, 0x6e, 0x99, 0xf8,
-	0xa1, 0x86, 0x76, 0x00, 0xae, 0xef, 0x26, 0xda, 0x4c, 0xbc, 0xbf, 0xcb, 0x53, 0x58, 0xa9, 0xdc,
-	0x06, 0xa9, 0xfd, 0x9f, 0x43, 0x69, 0xa9, 0x55, 0x28, 0x19, 0x9a, 0xb8, 0xac, 0x95, 0xc7, 0xb7,
-	0x62, 0xb2, 0x4e, 0xbb, 0x0f, 0xab, 0xe2, 0x0b, 0x80, 0xdf, 0x42, 0x29, 0xc6, 0x33, 0x28, 0x61,
-	0xe2, 0x05, 0x8c, 0x08, 0x3f, 0x5a, 0x1c, 0x7f, 0xf9, 0x43, 0xa1, 0xb2, 0x7e, 0xc3, 0xab, 0x3e,
-	0x28, 0x52, 0xdd, 0xf7, 0x2f, 0xfe, 0xae, 0xa6, 0x2e, 0x2e, 0xab, 0xda, 0x9b, 0xcb, 0xaa, 0xf6,
-	0xd7, 0x65, 0x55, 0xfb, 0xe5, 0xaa, 0x9a, 0x7a, 0x73, 0x55, 0x4d, 0xfd, 0x71, 0x55, 0x4d, 0xbd,
-	0xca, 0xab, 0x6f, 0x9a, 0x71, 0x4e, 0xbc, 0x4b, 0x1f, 0xff, 0x1b, 0x00, 0x00, 0xff, 0xff, 0xd2,
-	0x17, 0x25, 0x76, 0x3d, 0x09, 0x00, 0x00,
+	// 1141 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0xdd, 0x6e, 0x1b, 0x45,
+	0x14, 0xf6, 0xee, 0xfa, 0xf7, 0x38, 0x31, 0xdb, 0xa9, 0xdb, 0x3a, 0xae, 0xe4, 0x18, 0x4b, 0x95,
+	0xac, 0xaa, 0xd8, 0xc5, 0xa0, 0x4a, 0xa0, 0xde, 0xd8, 0xa9, 0x4b, 0x02, 0x8d, 0x03, 0xe3, 0xb8,
+	0x81, 0x22, 0x64, 0xad, 0xed, 0xc9, 0x7a, 0x15, 0xef, 0x0f, 0x3b, 0x63, 0x12, 0xdf, 0xc2, 0x2d,
+	0x42, 0xbc, 0x03, 0x4f, 0xc1, 0x1b, 0xe4, 0xb2, 0x97, 0x88, 0x8b, 0x0a, 0x92, 0xe7, 0x40, 0x42,
+	0xf3, 0xb3, 0x8e, 0x37, 0xa4, 0x11, 0x28, 0xdc, 0x58, 0x73, 0xbe, 0xef, 0x9c, 0x33, 0x67, 0xbe,
+	0x39, 0x67, 0xbc, 0x70, 0x8f, 0x32, 0x3f, 0x24, 0x4d, 0xf1, 0x1b, 0x8c, 0x9a, 0x61, 0x30, 0x6e,
+	0x04, 0xa1, 0xcf, 0x7c, 0x94, 0x66, 0x53, 0xcb, 0xf3, 0x69, 0x79, 0x23, 0xee, 0xc0, 0x16, 0x01,
+	0xa1, 0xd2, 0xa5, 0x5c, 0xb4, 0x7d, 0xdb, 0x17, 0xcb, 0x26, 0x5f, 0x29, 0xb4, 0x1a, 0x0f, 0x08,
+	0x42, 0xdf, 0xbd, 0x14, 0xa7, 0x52, 0xce, 0xac, 0x11, 0x99, 0x5d, 0xa6, 0x6c, 0xdf, 0xb7, 0x67,
+	0xa4, 0x29, 0xac, 0xd1, 0xfc, 0xb0, 0x69, 0x79, 0x0b, 0x49, 0xd5, 0xde, 0x81, 0xf5, 0x83, 0xd0,
+	0x61, 0x04, 0x13, 0x1a, 0xf8, 0x1e, 0x25, 0xb5, 0x1f, 0x34, 0x58, 0x53, 0xc8, 0xb7, 0x73, 0x42,
+	0x19, 0x6a, 0x03, 0x30, 0xc7, 0x25, 0x94, 0x84, 0x0e, 0xa1, 0x25, 0xad, 0x6a, 0xd4, 0xf3, 0xad,
+	0xfb, 0x3c, 0xda, 0x25, 0x6c, 0x4a, 0xe6, 0x74, 0x38, 0xf6, 0x83, 0x45, 0x63, 0xdf, 0x71, 0x49,
+	0x5f, 0xb8, 0x74, 0x92, 0xa7, 0x6f, 0x36, 0x13, 0x78, 0x25, 0x08, 0xdd, 0x85, 0x34, 0x23, 0x9e,
+	0xe5, 0xb1, 0x92, 0x5e, 0xd5, 0xea, 0x39, 0xac, 0x2c, 0x54, 0x82, 0x4c, 0x48, 0x82, 0x99, 0x33,
+	0xb6, 0x4a, 0x46, 0x55, 0xab, 0x1b, 0x38, 0x32, 0x6b, 0xeb, 0x90, 0xdf, 0xf1, 0x0e, 0x7d, 0x55,
+	0x43, 0xed, 0x57, 0x1d, 0xd6, 0xa4, 0x2d, 0xab, 0x44, 0x63, 0x48, 0x8b, 0x83, 0x46, 0x05, 0xad,
+	0x37, 0xa4, 0xb0, 0x8d, 0x17, 0x1c, 0xed, 0x3c, 0xe5, 0x25, 0xfc, 0xfe, 0x66, 0xf3, 0x43, 0xdb,
+	0x61, 0xd3, 0xf9, 0xa8, 0x31, 0xf6, 0xdd, 0xa6, 0x74, 0x78, 0xcf, 0xf1, 0xd5, 0xaa, 0x19, 0x1c,
+	0xd9, 0xcd, 0x98, 0x66, 0x8d, 0x57, 0x22, 0x1a, 0xab, 0xd4, 0x68, 0x03, 0xb2, 0xae, 0xe3, 0x0d,
+	0xf9, 0x41, 0x44, 0xe1, 0x06, 0xce, 0xb8, 0x8e, 0xc7, 0x4f, 0x2a, 0x28, 0xeb, 0x44, 0x52, 0xaa,
+	0x74, 0xd7, 0x3a, 0x11, 0x54, 0x13, 0x72, 0x22, 0xeb, 0xfe, 0x22, 0x20, 0xa5, 0x64, 0x55, 0xab,
+	0x17, 0x5a, 0xb7, 0xa2, 0xea, 0xfa, 0x11, 0x81, 0x2f, 0x7c, 0xd0, 0x13, 0x00, 0xb1, 0xe1, 0x90,
+	0x12, 0x46, 0x4b, 0x29, 0x71, 0x9e, 0x65, 0x84, 0x2c, 0xa9, 0x4f, 0x98, 0x92, 0x35, 0x37, 0x53,
+	0x36, 0x45, 0x0f, 0xa0, 0x20, 0xe3, 0x5c, 0x8b, 0x8d, 0xa7, 0x24, 0xa4, 0xa5, 0x74, 0x55, 0xab,
+	0x67, 0xf1, 0xba, 0x40, 0x77, 0x15, 0x58, 0xfb, 0xcb, 0x80, 0x75, 0x79, 0x33, 0xd1, 0x8d, 0xae,
+	0x9e, 0x4b, 0x7b, 0xfb, 0xb9, 0xf4, 0xf8, 0xb9, 0x9e, 0x70, 0x4a, 0x6d, 0x64, 0x88, 0x22, 0x8b,
+	0x31, 0xd1, 0xd5, 0x86, 0xaa, 0xce, 0xa5, 0x2f, 0x6a, 0xc1, 0x1d, 0x9e, 0x32, 0x24, 0xd4, 0x9f,
+	0xcd, 0x99, 0xe3, 0x7b, 0xc3, 0x63, 0xc7, 0x9b, 0xf8, 0xc7, 0x42, 0x1b, 0x03, 0xdf, 0x76, 0xad,
+	0x13, 0xbc, 0xe4, 0x0e, 0x04, 0x85, 0x1e, 0x01, 0x58, 0xb6, 0x1d, 0x12, 0xdb, 0x62, 0x44, 0x4a,
+	0x52, 0x68, 0xad, 0x45, 0xbb, 0xb5, 0x6d, 0x3b, 0xc4, 0x2b, 0x3c, 0xfa, 0x18, 0x36, 0x02, 0x2b,
+	0x64, 0x8e, 0x35, 0x1b, 0x86, 0xaa, 0x41, 0x86, 0x13, 0x87, 0x5a, 0xa3, 0x19, 0x99, 0x28, 0x4d,
+	0xee, 0x29, 0x87, 0xa8, 0x81, 0x9e, 0x29, 0x1a, 0x7d, 0x7d, 0x45, 0x2c, 0x65, 0xa1, 0xc5, 0x88,
+	0xbd, 0x28, 0x65, 0xc4, 0xed, 0x6d, 0x46, 0x1b, 0x7f, 0x1e, 0xcf, 0xd1, 0x57, 0x6e, 0xff, 0x48,
+	0x1e, 0x11, 0x68, 0x13, 0xf2, 0xf4, 0xc8, 0x09, 0x86, 0xe3, 0xe9, 0xdc, 0x3b, 0xa2, 0xa5, 0xac,
+	0x28, 0x05, 0x38, 0xb4, 0x25, 0x10, 0xf4, 0x10, 0x52, 0x53, 0xc7, 0x63, 0xb4, 0x94, 0xab, 0x6a,
+	0x42, 0x50, 0x39, 0xa8, 0x8d, 0x68, 0x50, 0x1b, 0x6d, 0x6f, 0x81, 0xa5, 0x0b, 0x7a, 0x0c, 0x40,
+	0xa7, 0x56, 0x38, 0x19, 0x3a, 0xde, 0xa1, 0x5f, 0xca, 0x57, 0xb5, 0xd5, 0x36, 0xe9, 0x73, 0x46,
+	0x4c, 0x48, 0x8e, 0x46, 0xcb, 0x4f, 0x93, 0x59, 0x30, 0xf3, 0xb5, 0x63, 0xc8, 0x2d, 0x59, 0x51,
+	0x91, 0x4a, 0x32, 0x21, 0x27, 0xea, 0xf6, 0x41, 0x85, 0x4c, 0xc8, 0x09, 0x7a, 0x17, 0xd6, 0x98,
+	0xcf, 0xac, 0xd9, 0x50, 0x60, 0x54, 0x35, 0x41, 0x5e, 0x60, 0x22, 0x0d, 0x45, 0x05, 0xd0, 0x47,
+	0x0b, 0xd1, 0xf5, 0x59, 0xac, 0x8f, 0x16, 0x7c, 0xba, 0xd5, 0x2c, 0x26, 0xab, 0x06, 0x9f, 0x6e,
+	0x69, 0xd5, 0x7e, 0xd2, 0xa0, 0x10, 0x35, 0x9e, 0x1a, 0xdb, 0x3a, 0xa4, 0x97, 0xef, 0x08, 0xaf,
+	0xbf, 0xb0, 0xac, 0x5f, 0xa0, 0xdb, 0x09, 0xac, 0x78, 0x54, 0x86, 0xcc, 0xb1, 0x15, 0x7a, 0x8e,
+	0x67, 0xcb, 0x37, 0x63, 0x3b, 0x81, 0x23, 0x00, 0x3d, 0x8a, 0x54, 0x33, 0xde, 0xae, 0xda, 0x76,
+	0x42, 0xe9, 0xd6, 0xc9, 0x42, 0x3a, 0x24, 0x74, 0x3e, 0x63, 0xb5, 0x1f, 0x75, 0xb8, 0x25, 0x5a,
+	0xb5, 0x67, 0xb9, 0x17, 0xd3, 0x70, 0x6d, 0xf7, 0x68, 0x37, 0xe8, 0x1e, 0xfd, 0x86, 0xdd, 0x53,
+	0x84, 0x14, 0x65, 0x56, 0xc8, 0xd4, 0x03, 0x23, 0x0d, 0x64, 0x82, 0x41, 0xbc, 0x89, 0x1a, 0x1e,
+	0xbe, 0x8c, 0x0d, 0x66, 0xea, 0xdf, 0x0f, 0x66, 0xed, 0x39, 0xa0, 0x55, 0x35, 0xd4, 0x15, 0x15,
+	0x21, 0xe5, 0x71, 0x40, 0x3c, 0xac, 0x39, 0x2c, 0x0d, 0x54, 0x86, 0xac, 0x52, 0x9f, 0xb7, 0x04,
+	0x27, 0x96, 0x76, 0xed, 0x17, 0x5d, 0x25, 0x7a, 0x69, 0xcd, 0xe6, 0x17, 0xba, 0x16, 0x21, 0x25,
+	0x1a, 0x41, 0x68, 0x98, 0xc3, 0xd2, 0xb8, 0x5e, 0x6d, 0xfd, 0x06, 0x6a, 0x1b, 0xff, 0x97, 0xda,
+	0xc9, 0x2b, 0xd4, 0x4e, 0x5d, 0xad, 0x76, 0xfa, 0x3f, 0xa8, 0xbd, 0x03, 0xb7, 0x63, 0x22, 0x29,
+	0xb9, 0xef, 0x42, 0xfa, 0x3b, 0x81, 0x28, 0xbd, 0x95, 0x75, 0x9d, 0xe0, 0x0f, 0xbf, 0x81, 0xdc,
+	0xf2, 0x8f, 0x04, 0xe5, 0x21, 0x33, 0xe8, 0x7d, 0xd6, 0xdb, 0x3b, 0xe8, 0x99, 0x09, 0x94, 0x83,
+	0xd4, 0x17, 0x83, 0x2e, 0xfe, 0xca, 0xd4, 0x50, 0x16, 0x92, 0x78, 0xf0, 0xa2, 0x6b, 0xea, 0xdc,
+	0xa3, 0xbf, 0xf3, 0xac, 0xbb, 0xd5, 0xc6, 0xa6, 0xc1, 0x3d, 0xfa, 0xfb, 0x7b, 0xb8, 0x6b, 0x26,
+	0x39, 0x8e, 0xbb, 0x5b, 0xdd, 0x9d, 0x97, 0x5d, 0x33, 0xc5, 0xf1, 0x67, 0xdd, 0xce, 0xe0, 0x13,
+	0x33, 0xfd, 0xb0, 0x03, 0x49, 0xfe, 0xc4, 0xa2, 0x0c, 0x18, 0xb8, 0x7d, 0x20, 0xb3, 0x6e, 0xed,
+	0x0d, 0x7a, 0xfb, 0xa6, 0xc6, 0xb1, 0xfe, 0x60, 0xd7, 0xd4, 0xf9, 0x62, 0x77, 0xa7, 0x67, 0x1a,
+	0x62, 0xd1, 0xfe, 0x52, 0xa6, 0x13, 0x5e, 0x5d, 0x6c, 0xa6, 0x5a, 0xdf, 0xeb, 0x90, 0x12, 0x35,
+	0xa2, 0xf7, 0x21, 0x29, 0x5e, 0x9e, 0xdb, 0x91, 0x4a, 0x2b, 0xff, 0xeb, 0xe5, 0x62, 0x1c, 0x54,
+	0x9a, 0x7c, 0x04, 0x69, 0xf9, 0x1e, 0xa0, 0x3b, 0xf1, 0xf7, 0x21, 0x0a, 0xbb, 0x7b, 0x19, 0x96,
+	0x81, 0x8f, 0x35, 0xb4, 0x05, 0x70, 0xd1, 0xd3, 0x68, 0x23, 0x76, 0x33, 0xab, 0x53, 0x5f, 0x2e,
+	0x5f, 0x45, 0xa9, 0xfd, 0x9f, 0x43, 0x7e, 0xe5, 0xaa, 0x50, 0xdc, 0x35, 0xd6, 0xe4, 0xe5, 0xfb,
+	0x57, 0x72, 0x32, 0x4f, 0xab, 0x07, 0x05, 0xf1, 0x25, 0xc5, 0xbb, 0x57, 0x8a, 0xf1, 0x14, 0xf2,
+	0x98, 0xb8, 0x3e, 0x23, 0x02, 0x47, 0xcb, 0xe3, 0xaf, 0x7e, 0x70, 0x95, 0xef, 0x5c, 0x42, 0xd5,
+	0x87, 0x59, 0xa2, 0xf3, 0xe0, 0xf4, 0xcf, 0x4a, 0xe2, 0xf4, 0xac, 0xa2, 0xbd, 0x3e, 0xab, 0x68,
+	0x7f, 0x9c, 0x55, 0xb4, 0x9f, 0xcf, 0x2b, 0x89, 0xd7, 0xe7, 0x95, 0xc4, 0x6f, 0xe7, 0x95, 0xc4,
+	0xab, 0x8c, 0xfa, 0x36, 0x1c, 0xa5, 0xc5, 0x3b, 0xf8, 0xc1, 0xdf, 0x03, 0x00, 0x50, 0xd8, 0x6e,
+	0xec, 0x85, 0x0a, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1091,6 +1153,16 @@ func (m *InfoResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.LabelMatchers {
+		i--
+		if m.LabelMatchers {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x30
+	}
 	if len(m.LabelSets) > 0 {
 		for iNdEx := len(m.LabelSets) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1157,6 +1229,18 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.ShardInfo != nil {
+		{
+			size, err := m.ShardInfo.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x5a
+	}
 	if m.Hints != nil {
 		{
 			size, err := m.Hints.MarshalToSizedBuffer(dAtA[:i])
@@ -1195,20 +1279,20 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		dAtA[i] = 0x30
 	}
 	if len(m.Aggregates) > 0 {
-		dAtA3 := make([]byte, len(m.Aggregates)*10)
-		var j2 int
+		dAtA4 := make([]byte, len(m.Aggregates)*10)
+		var j3 int
 		for _, num := range m.Aggregates {
 			for num >= 1<<7 {
-				dAtA3[j2] = uint8(uint64(num)&0x7f | 0x80)
+				dAtA4[j3] = uint8(uint64(num)&0x7f | 0x80)
 				num >>= 7
-				j2++
+				j3++
 			}
-			dAtA3[j2] = uint8(num)
-			j2++
+			dAtA4[j3] = uint8(num)
+			j3++
 		}
-		i -= j2
-		copy(dAtA[i:], dAtA3[:j2])
-		i = encodeVarintRpc(dAtA, i, uint64(j2))
+		i -= j3
+		copy(dAtA[i:], dAtA4[:j3])
+		i = encodeVarintRpc(dAtA, i, uint64(j3))
 		i--
 		dAtA[i] = 0x2a
 	}
@@ -1244,6 +1328,58 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *ShardInfo) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ShardInfo) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ShardInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Labels) > 0 {
+		for iNdEx := len(m.Labels) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Labels[iNdEx])
+			copy(dAtA[i:], m.Labels[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.Labels[iNdEx])))
+			i--
+			dAtA[i] = 0x22
+		}
+	}
+	if m.By {
+		i--
+		if m.By {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.TotalShards != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.TotalShards))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.ShardIndex != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.ShardIndex))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *SeriesResponse) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -1352,6 +1488,20 @@ func (m *LabelNamesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Matchers) > 0 {
+		for iNdEx := len(m.Matchers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Matchers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x2a
+		}
+	}
 	if m.End != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.End))
 		i--
@@ -1441,6 +1591,20 @@ func (m *LabelValuesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Matchers) > 0 {
+		for iNdEx := len(m.Matchers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Matchers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x32
+		}
+	}
 	if m.End != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.End))
 		i--
@@ -1595,6 +1759,9 @@ func (m *InfoResponse) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.LabelMatchers {
+		n += 2
+	}
 	return n
 }
 
@@ -1639,6 +1806,34 @@ func (m *SeriesRequest) Size() (n int) {
 		l = m.Hints.Size()
 		n += 1 + l + sovRpc(uint64(l))
 	}
+	if m.ShardInfo != nil {
+		l = m.ShardInfo.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	return n
+}
+
+func (m *ShardInfo) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.ShardIndex != 0 {
+		n += 1 + sovRpc(uint64(m.ShardIndex))
+	}
+	if m.TotalShards != 0 {
+		n += 1 + sovRpc(uint64(m.TotalShards))
+	}
+	if m.By {
+		n += 2
+	}
+	if len(m.Labels) > 0 {
+		for _, s := range m.Labels {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -1706,6 +1901,12 @@ func (m *LabelNamesRequest) Size() (n int) {
 	if m.End != 0 {
 		n += 1 + sovRpc(uint64(m.End))
 	}
+	if len(m.Matchers) > 0 {
+		for _, e := range m.Matchers {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -1752,6 +1953,12 @@ func (m *LabelValuesRequest) Size() (n int) {
 	if m.End != 0 {
 		n += 1 + sovRpc(uint64(m.End))
 	}
+	if len(m.Matchers) > 0 {
+		for _, e := range m.Matchers {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -2180,6 +2387,26 @@ func (m *InfoResponse) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LabelMatchers", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.LabelMatchers = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2488,6 +2715,185 @@ func (m *SeriesRequest) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 11:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ShardInfo", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.ShardInfo == nil {
+				m.ShardInfo = &ShardInfo{}
+			}
+			if err := m.ShardInfo.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ShardInfo) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ShardInfo: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ShardInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ShardIndex", wireType)
+			}
+			m.ShardIndex = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ShardIndex |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TotalShards", wireType)
+			}
+			m.TotalShards = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.TotalShards |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field By", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.By = bool(v != 0)
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Labels = append(m.Labels, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2773,6 +3179,40 @@ func (m *LabelNamesRequest) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Matchers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Matchers = append(m.Matchers, LabelMatcher{})
+			if err := m.Matchers[len(m.Matchers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -3052,6 +3492,40 @@ func (m *LabelValuesRequest) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Matchers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Matchers = append(m.Matchers, LabelMatcher{})
+			if err := m.Matchers[len(m.Matchers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -7,6 +7,7 @@ import (
 	"context"
 	"io"
 	"math"
+	"sort"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
@@ -74,10 +75,11 @@ func (s *TSDBStore) Info(_ context.Context, _ *storepb.InfoRequest) (*storepb.In
 	}
 
 	res := &storepb.InfoResponse{
-		Labels:    labelpb.ZLabelsFromPromLabels(s.externalLabels),
-		StoreType: s.component.ToProto(),
-		MinTime:   minTime,
-		MaxTime:   math.MaxInt64,
+		Labels:        labelpb.ZLabelsFromPromLabels(s.externalLabels),
+		StoreType:     s.component.ToProto(),
+		MinTime:       minTime,
+		MaxTime:       math.MaxInt64,
+		LabelMatchers: true,
 	}
 
 	// Until we deprecate the single labels in the reply, we just duplicate
@@ -134,7 +136,11 @@ func (s *TSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSer
 	// Stream at most one series per frame; series may be split over multiple frames according to maxBytesInFrame.
 	for set.Next() {
 		series := set.At()
-		seriesLabels := storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(labelpb.ExtendLabels(series.Labels(), s.externalLabels))}
+		lset := labelpb.ExtendLabels(series.Labels(), s.externalLabels)
+		if !r.ShardInfo.Matches(lset) {
+			continue
+		}
+		seriesLabels := storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset)}
 		if r.SkipChunks {
 			if err := srv.Send(storepb.NewSeriesResponse(&seriesLabels)); err != nil {
 				return status.Error(codes.Aborted, err.Error())
@@ -198,36 +204,107 @@ func (s *TSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSer
 	return nil
 }
 
-// LabelNames returns all known label names.
+// LabelNames returns all known label names, or the ones of the series matching the given matchers.
 func (s *TSDBStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (
 	*storepb.LabelNamesResponse, error,
 ) {
+	match, matchers, err := matchesExternalLabels(r.Matchers, s.externalLabels)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelNamesResponse{Names: nil}, nil
+	}
+
 	q, err := s.db.ChunkQuerier(ctx, r.Start, r.End)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	defer runutil.CloseWithLogOnErr(s.logger, q, "close tsdb querier label names")
 
-	res, _, err := q.LabelNames()
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+	if len(matchers) == 0 {
+		res, _, err := q.LabelNames()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &storepb.LabelNamesResponse{Names: res}, nil
 	}
-	return &storepb.LabelNamesResponse{Names: res}, nil
+
+	names := map[string]struct{}{}
+	if err := forEachChunkSeries(q, r.Start, r.End, matchers, func(lset labels.Labels) {
+		for _, l := range lset {
+			names[l.Name] = struct{}{}
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return &storepb.LabelNamesResponse{Names: sortedKeys(names)}, nil
 }
 
-// LabelValues returns all known label values for a given label name.
+// LabelValues returns all known label values for a given label name, or the ones of the series matching the given
+// matchers.
 func (s *TSDBStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequest) (
 	*storepb.LabelValuesResponse, error,
 ) {
+	match, matchers, err := matchesExternalLabels(r.Matchers, s.externalLabels)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelValuesResponse{Values: nil}, nil
+	}
+
 	q, err := s.db.ChunkQuerier(ctx, r.Start, r.End)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	defer runutil.CloseWithLogOnErr(s.logger, q, "close tsdb querier label values")
 
-	res, _, err := q.LabelValues(r.Label)
+	if len(matchers) == 0 {
+		res, _, err := q.LabelValues(r.Label)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &storepb.LabelValuesResponse{Values: res}, nil
+	}
+
+	values := map[string]struct{}{}
+	if err := forEachChunkSeries(q, r.Start, r.End, matchers, func(lset labels.Labels) {
+		if v := lset.Get(r.Label); v != "" {
+			values[v] = struct{}{}
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return &storepb.LabelValuesResponse{Values: sortedKeys(values)}, nil
+}
+
+// forEachChunkSeries calls f with the labels of the series of the querier matching the given matchers. Chunks are
+// not loaded.
+func forEachChunkSeries(q storage.ChunkQuerier, mint, maxt int64, ms []storepb.LabelMatcher, f func(labels.Labels)) error {
+	matchers, err := storepb.TranslateFromPromMatchers(ms...)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	set := q.Select(false, &storage.SelectHints{Start: mint, End: maxt, Func: "series"}, matchers...)
+	for set.Next() {
+		f(set.At().Labels())
+	}
+	if err := set.Err(); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in sorted order, or nil if it is empty.
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
-	return &storepb.LabelValuesResponse{Values: res}, nil
+	sort.Strings(keys)
+	return keys
 }
@@ -186,6 +186,47 @@ func TestTSDBStore_Series(t *testing.T) {
 	}
 }
 
+func TestTSDBStore_Series_Shards(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	tsdbStore := NewTSDBStore(nil, nil, db, component.Rule, labels.FromStrings("region", "eu-west"))
+
+	appender := db.Appender(context.Background())
+	for i := 0; i < 20; i++ {
+		_, err = appender.Add(labels.FromStrings("a", fmt.Sprintf("%d", i), "job", fmt.Sprintf("%d", i%4)), 1, 1)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, appender.Commit())
+
+	const totalShards = 3
+	jobs := map[string]int64{}
+	var series int
+	for i := int64(0); i < totalShards; i++ {
+		srv := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, tsdbStore.Series(&storepb.SeriesRequest{
+			MinTime:   1,
+			MaxTime:   1,
+			Matchers:  []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "a", Value: ".+"}},
+			ShardInfo: &storepb.ShardInfo{ShardIndex: i, TotalShards: totalShards, By: true, Labels: []string{"job"}},
+		}, srv))
+
+		for _, s := range srv.SeriesSet {
+			job := s.PromLabels().Get("job")
+			if shard, ok := jobs[job]; ok {
+				testutil.Equals(t, shard, i)
+			}
+			jobs[job] = i
+		}
+		series += len(srv.SeriesSet)
+	}
+	testutil.Equals(t, 20, series)
+	testutil.Equals(t, 4, len(jobs))
+}
+
 func TestTSDBStore_LabelNames(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -390,6 +431,104 @@ func TestTSDBStore_LabelValues(t *testing.T) {
 	}
 }
 
+func TestTSDBStore_LabelNamesValues_Matchers(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender(context.Background())
+	_, err = app.Add(labels.FromStrings("__name__", "up", "job", "a"), 10, 1)
+	testutil.Ok(t, err)
+	_, err = app.Add(labels.FromStrings("__name__", "up", "job", "b", "instance", "b1"), 20, 1)
+	testutil.Ok(t, err)
+	_, err = app.Add(labels.FromStrings("__name__", "down", "job", "c", "zone", "z1"), 30, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	tsdbStore := NewTSDBStore(nil, nil, db, component.Rule, labels.FromStrings("region", "eu-west"))
+
+	for _, tc := range []struct {
+		title          string
+		matchers       []storepb.LabelMatcher
+		start, end     int64
+		expectedNames  []string
+		expectedValues []string
+	}{
+		{
+			title:          "no matchers",
+			start:          0,
+			end:            100,
+			expectedNames:  []string{"__name__", "instance", "job", "zone"},
+			expectedValues: []string{"a", "b", "c"},
+		},
+		{
+			title:          "matching series",
+			matchers:       []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+			start:          0,
+			end:            100,
+			expectedNames:  []string{"__name__", "instance", "job"},
+			expectedValues: []string{"a", "b"},
+		},
+		{
+			title:          "matching series within the time range",
+			matchers:       []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+			start:          15,
+			end:            100,
+			expectedNames:  []string{"__name__", "instance", "job"},
+			expectedValues: []string{"b"},
+		},
+		{
+			title: "matching external labels",
+			matchers: []storepb.LabelMatcher{
+				{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "eu-west"},
+				{Type: storepb.LabelMatcher_RE, Name: "job", Value: "a|c"},
+			},
+			start:          0,
+			end:            100,
+			expectedNames:  []string{"__name__", "job", "zone"},
+			expectedValues: []string{"a", "c"},
+		},
+		{
+			title:    "not matching external labels",
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "us-east"}},
+			start:    0,
+			end:      100,
+		},
+		{
+			title:    "no matching series",
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "missing"}},
+			start:    0,
+			end:      100,
+		},
+	} {
+		if ok := t.Run(tc.title, func(t *testing.T) {
+			namesResp, err := tsdbStore.LabelNames(ctx, &storepb.LabelNamesRequest{
+				Start:    tc.start,
+				End:      tc.end,
+				Matchers: tc.matchers,
+			})
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expectedNames, namesResp.Names)
+
+			valuesResp, err := tsdbStore.LabelValues(ctx, &storepb.LabelValuesRequest{
+				Label:    "job",
+				Start:    tc.start,
+				End:      tc.end,
+				Matchers: tc.matchers,
+			})
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expectedValues, valuesResp.Values)
+		}); !ok {
+			return
+		}
+	}
+}
+
 // Regression test for https://github.com/thanos-io/thanos/issues/1038.
 func TestTSDBStore_Series_SplitSamplesIntoChunksWithMaxSizeOf120(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
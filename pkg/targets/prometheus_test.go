@@ -0,0 +1,75 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package targets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPrometheus_Targets(t *testing.T) {
+	var state string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/api/v1/targets", r.URL.Path)
+		state = r.URL.Query().Get("state")
+		_, _ = w.Write([]byte(`{"status":"success","data":{
+"activeTargets":[{"discoveredLabels":{"__address__":"localhost:9090","job":"prometheus"},"labels":{"instance":"localhost:9090","job":"prometheus"},
+"scrapePool":"prometheus","scrapeUrl":"http://localhost:9090/metrics","globalUrl":"http://prometheus:9090/metrics",
+"lastError":"","lastScrape":"2020-11-02T10:00:00Z","lastScrapeDuration":0.01,"health":"up"}],
+"droppedTargets":[{"discoveredLabels":{"__address__":"localhost:9100","job":"node"}}]}}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	promTargets := NewPrometheus(u, promclient.NewDefaultClient(), func() labels.Labels {
+		return labels.FromStrings("replica", "test1")
+	})
+	client := NewGRPCClient(promTargets)
+
+	for _, tc := range []struct {
+		state         targetspb.TargetsRequest_State
+		expectedState string
+	}{
+		{state: targetspb.TargetsRequest_ANY},
+		{state: targetspb.TargetsRequest_ACTIVE, expectedState: "active"},
+		{state: targetspb.TargetsRequest_DROPPED, expectedState: "dropped"},
+	} {
+		t.Run(tc.state.String(), func(t *testing.T) {
+			targets, w, err := client.Targets(context.Background(), &targetspb.TargetsRequest{State: tc.state})
+			testutil.Ok(t, err)
+			testutil.Equals(t, 0, len(w))
+			testutil.Equals(t, tc.expectedState, state)
+
+			testutil.Equals(t, &targetspb.TargetDiscovery{
+				ActiveTargets: []*targetspb.ActiveTarget{
+					{
+						DiscoveredLabels:   zLabelSet("__address__", "localhost:9090", "job", "prometheus", "replica", "test1"),
+						Labels:             zLabelSet("instance", "localhost:9090", "job", "prometheus", "replica", "test1"),
+						ScrapePool:         "prometheus",
+						ScrapeUrl:          "http://localhost:9090/metrics",
+						GlobalUrl:          "http://prometheus:9090/metrics",
+						LastScrape:         time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC),
+						LastScrapeDuration: 0.01,
+						Health:             targetspb.TargetHealth_UP,
+					},
+				},
+				DroppedTargets: []*targetspb.DroppedTarget{
+					{DiscoveredLabels: zLabelSet("__address__", "localhost:9100", "job", "node", "replica", "test1")},
+				},
+			}, targets)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package targets
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+)
+
+var _ UnaryClient = &GRPCClient{}
+
+// UnaryClient is gRPC targetspb.Targets client which expands streaming targets API. Useful for consumers that does not
+// support streaming.
+type UnaryClient interface {
+	Targets(ctx context.Context, req *targetspb.TargetsRequest) (*targetspb.TargetDiscovery, storage.Warnings, error)
+}
+
+// GRPCClient allows to retrieve targets from local gRPC streaming server implementation.
+type GRPCClient struct {
+	proxy targetspb.TargetsServer
+
+	replicaLabels map[string]struct{}
+}
+
+func NewGRPCClient(ts targetspb.TargetsServer) *GRPCClient {
+	return NewGRPCClientWithDedup(ts, nil)
+}
+
+func NewGRPCClientWithDedup(ts targetspb.TargetsServer, replicaLabels []string) *GRPCClient {
+	c := &GRPCClient{
+		proxy:         ts,
+		replicaLabels: map[string]struct{}{},
+	}
+
+	for _, label := range replicaLabels {
+		c.replicaLabels[label] = struct{}{}
+	}
+	return c
+}
+
+func (tc *GRPCClient) Targets(ctx context.Context, req *targetspb.TargetsRequest) (*targetspb.TargetDiscovery, storage.Warnings, error) {
+	resp := &targetsServer{ctx: ctx, targets: &targetspb.TargetDiscovery{
+		ActiveTargets:  make([]*targetspb.ActiveTarget, 0),
+		DroppedTargets: make([]*targetspb.DroppedTarget, 0),
+	}}
+
+	if err := tc.proxy.Targets(req, resp); err != nil {
+		return nil, nil, errors.Wrap(err, "proxy Targets")
+	}
+
+	resp.targets.ActiveTargets = dedupActiveTargets(resp.targets.ActiveTargets, tc.replicaLabels)
+	resp.targets.DroppedTargets = dedupDroppedTargets(resp.targets.DroppedTargets, tc.replicaLabels)
+
+	return resp.targets, resp.warnings, nil
+}
+
+// dedupActiveTargets re-sorts the set so that the same target with different replica
+// labels are coming right after each other.
+func dedupActiveTargets(targets []*targetspb.ActiveTarget, replicaLabels map[string]struct{}) []*targetspb.ActiveTarget {
+	if len(targets) == 0 {
+		return targets
+	}
+
+	// Remove replica labels first, so that the same targets of different replicas compare equal.
+	for _, t := range targets {
+		t.SetDiscoveredLabels(removeReplicaLabels(t.DiscoveredLabels.PromLabels(), replicaLabels))
+		t.SetLabels(removeReplicaLabels(t.Labels.PromLabels(), replicaLabels))
+	}
+
+	// Sort targets globally, with the healthiest and most recently scraped of the same targets first.
+	sort.Slice(targets, func(i, j int) bool {
+		if d := targets[i].Compare(targets[j]); d != 0 {
+			return d < 0
+		}
+		return targets[i].CompareState(targets[j]) < 0
+	})
+
+	i := 0
+	for j := 1; j < len(targets); j++ {
+		if targets[i].Compare(targets[j]) != 0 {
+			// Effectively retain targets[j] in the resulting slice.
+			i++
+			targets[i] = targets[j]
+		}
+	}
+	return targets[:i+1]
+}
+
+func dedupDroppedTargets(targets []*targetspb.DroppedTarget, replicaLabels map[string]struct{}) []*targetspb.DroppedTarget {
+	if len(targets) == 0 {
+		return targets
+	}
+
+	for _, t := range targets {
+		t.SetDiscoveredLabels(removeReplicaLabels(t.DiscoveredLabels.PromLabels(), replicaLabels))
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Compare(targets[j]) < 0
+	})
+
+	i := 0
+	for j := 1; j < len(targets); j++ {
+		if targets[i].Compare(targets[j]) != 0 {
+			i++
+			targets[i] = targets[j]
+		}
+	}
+	return targets[:i+1]
+}
+
+func removeReplicaLabels(lbls labels.Labels, replicaLabels map[string]struct{}) labels.Labels {
+	newLabels := make(labels.Labels, 0, len(lbls))
+	for _, l := range lbls {
+		if _, ok := replicaLabels[l.Name]; !ok {
+			newLabels = append(newLabels, l)
+		}
+	}
+	return newLabels
+}
+
+type targetsServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	targetspb.Targets_TargetsServer
+	ctx context.Context
+
+	warnings []error
+	targets  *targetspb.TargetDiscovery
+}
+
+func (srv *targetsServer) Send(res *targetspb.TargetsResponse) error {
+	if res.GetWarning() != "" {
+		srv.warnings = append(srv.warnings, errors.New(res.GetWarning()))
+		return nil
+	}
+
+	if res.GetTargets() == nil {
+		return errors.New("no targets")
+	}
+
+	srv.targets.ActiveTargets = append(srv.targets.ActiveTargets, res.GetTargets().ActiveTargets...)
+	srv.targets.DroppedTargets = append(srv.targets.DroppedTargets, res.GetTargets().DroppedTargets...)
+	return nil
+}
+
+func (srv *targetsServer) Context() context.Context {
+	return srv.ctx
+}
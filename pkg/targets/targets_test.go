@@ -0,0 +1,141 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package targets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.TolerantVerifyLeakMain(m)
+}
+
+func zLabelSet(lset ...string) labelpb.ZLabelSet {
+	if len(lset) == 0 {
+		return labelpb.ZLabelSet{}
+	}
+	return labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings(lset...))}
+}
+
+func TestDedupActiveTargets(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		targets, want []*targetspb.ActiveTarget
+		replicaLabels []string
+	}{
+		{
+			name:    "nil slice",
+			targets: nil,
+			want:    nil,
+		},
+		{
+			name:    "empty target slice",
+			targets: []*targetspb.ActiveTarget{},
+			want:    []*targetspb.ActiveTarget{},
+		},
+		{
+			name: "different scrape pools",
+			targets: []*targetspb.ActiveTarget{
+				{ScrapePool: "b", Labels: zLabelSet("job", "b")},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a")},
+			},
+			want: []*targetspb.ActiveTarget{
+				{ScrapePool: "a", Labels: zLabelSet("job", "a")},
+				{ScrapePool: "b", Labels: zLabelSet("job", "b")},
+			},
+		},
+		{
+			name: "no replica labels",
+			targets: []*targetspb.ActiveTarget{
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "replica", "1")},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "replica", "2")},
+			},
+			want: []*targetspb.ActiveTarget{
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "replica", "1")},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "replica", "2")},
+			},
+		},
+		{
+			name: "replicas, the healthy one is kept",
+			targets: []*targetspb.ActiveTarget{
+				{
+					ScrapePool:       "a",
+					DiscoveredLabels: zLabelSet("__address__", "localhost:9090", "replica", "1"),
+					Labels:           zLabelSet("job", "a", "replica", "1"),
+					Health:           targetspb.TargetHealth_DOWN,
+					LastScrape:       time.Unix(2, 0),
+				},
+				{
+					ScrapePool:       "a",
+					DiscoveredLabels: zLabelSet("__address__", "localhost:9090", "replica", "2"),
+					Labels:           zLabelSet("job", "a", "replica", "2"),
+					Health:           targetspb.TargetHealth_UP,
+					LastScrape:       time.Unix(1, 0),
+				},
+			},
+			want: []*targetspb.ActiveTarget{
+				{
+					ScrapePool:       "a",
+					DiscoveredLabels: zLabelSet("__address__", "localhost:9090"),
+					Labels:           zLabelSet("job", "a"),
+					Health:           targetspb.TargetHealth_UP,
+					LastScrape:       time.Unix(1, 0),
+				},
+			},
+			replicaLabels: []string{"replica"},
+		},
+		{
+			name: "replicas, the most recently scraped one is kept",
+			targets: []*targetspb.ActiveTarget{
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "replica", "1"), Health: targetspb.TargetHealth_UP, LastScrape: time.Unix(1, 0)},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "replica", "2"), Health: targetspb.TargetHealth_UP, LastScrape: time.Unix(3, 0)},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "replica", "3"), Health: targetspb.TargetHealth_UNKNOWN, LastScrape: time.Unix(4, 0)},
+			},
+			want: []*targetspb.ActiveTarget{
+				{ScrapePool: "a", Labels: zLabelSet("job", "a"), Health: targetspb.TargetHealth_UP, LastScrape: time.Unix(3, 0)},
+			},
+			replicaLabels: []string{"replica"},
+		},
+		{
+			name: "same targets of different Prometheus",
+			targets: []*targetspb.ActiveTarget{
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "cluster", "eu", "replica", "1")},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "cluster", "us", "replica", "1")},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "cluster", "eu", "replica", "2")},
+			},
+			want: []*targetspb.ActiveTarget{
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "cluster", "eu")},
+				{ScrapePool: "a", Labels: zLabelSet("job", "a", "cluster", "us")},
+			},
+			replicaLabels: []string{"replica"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			replicaLabels := make(map[string]struct{})
+			for _, lbl := range tc.replicaLabels {
+				replicaLabels[lbl] = struct{}{}
+			}
+			testutil.Equals(t, tc.want, dedupActiveTargets(tc.targets, replicaLabels))
+		})
+	}
+}
+
+func TestDedupDroppedTargets(t *testing.T) {
+	targets := []*targetspb.DroppedTarget{
+		{DiscoveredLabels: zLabelSet("__address__", "localhost:9091", "replica", "1")},
+		{DiscoveredLabels: zLabelSet("__address__", "localhost:9090", "replica", "2")},
+		{DiscoveredLabels: zLabelSet("__address__", "localhost:9090", "replica", "1")},
+	}
+	testutil.Equals(t, []*targetspb.DroppedTarget{
+		{DiscoveredLabels: zLabelSet("__address__", "localhost:9090")},
+		{DiscoveredLabels: zLabelSet("__address__", "localhost:9091")},
+	}, dedupDroppedTargets(targets, map[string]struct{}{"replica": {}}))
+}
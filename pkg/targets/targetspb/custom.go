@@ -0,0 +1,165 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package targetspb
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+)
+
+func NewTargetsResponse(targets *TargetDiscovery) *TargetsResponse {
+	return &TargetsResponse{
+		Result: &TargetsResponse_Targets{
+			Targets: targets,
+		},
+	}
+}
+
+func NewWarningTargetsResponse(warning error) *TargetsResponse {
+	return &TargetsResponse{
+		Result: &TargetsResponse_Warning{
+			Warning: warning.Error(),
+		},
+	}
+}
+
+func (m *TargetDiscovery) MarshalJSON() ([]byte, error) {
+	// Ensure that empty slices are marshaled as '[]' and not 'null'.
+	if m.ActiveTargets == nil {
+		m.ActiveTargets = make([]*ActiveTarget, 0)
+	}
+	if m.DroppedTargets == nil {
+		m.DroppedTargets = make([]*DroppedTarget, 0)
+	}
+	type plain TargetDiscovery
+	return json.Marshal((*plain)(m))
+}
+
+func (x *TargetHealth) UnmarshalJSON(entry []byte) error {
+	fieldStr, err := strconv.Unquote(string(entry))
+	if err != nil {
+		return errors.Wrapf(err, "targetHealth: unquote %v", string(entry))
+	}
+
+	if len(fieldStr) == 0 {
+		return errors.New("empty targetHealth")
+	}
+
+	state, ok := TargetHealth_value[strings.ToUpper(fieldStr)]
+	if !ok {
+		return errors.Errorf("unknown targetHealth: %v", string(entry))
+	}
+	*x = TargetHealth(state)
+	return nil
+}
+
+func (x *TargetHealth) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strings.ToLower(x.String()))), nil
+}
+
+// Compare compares target health x and y and returns:
+//
+//   < 0 if x < y  (target health x is healthier than target health y)
+//     0 if x == y
+//   > 0 if x > y  (target health x is less healthy than target health y)
+//
+// For sorting this makes sure that healthy targets come first and targets of unknown health last.
+func (x TargetHealth) Compare(y TargetHealth) int {
+	return x.rank() - y.rank()
+}
+
+func (x TargetHealth) rank() int {
+	switch x {
+	case TargetHealth_UP:
+		return 0
+	case TargetHealth_DOWN:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (t *ActiveTarget) SetLabels(ls labels.Labels) {
+	t.Labels = zLabelSet(ls)
+}
+
+func (t *ActiveTarget) SetDiscoveredLabels(ls labels.Labels) {
+	t.DiscoveredLabels = zLabelSet(ls)
+}
+
+func (t *DroppedTarget) SetDiscoveredLabels(ls labels.Labels) {
+	t.DiscoveredLabels = zLabelSet(ls)
+}
+
+func zLabelSet(ls labels.Labels) labelpb.ZLabelSet {
+	var result labelpb.ZLabelSet
+	if len(ls) > 0 {
+		result = labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(ls)}
+	}
+	return result
+}
+
+// Compare compares active targets t1 and t2 and returns:
+//
+//   < 0 if t1 < t2  if target t1 is not equal and lexically before target t2
+//     0 if t1 == t2 if target t1 is logically equal to t2 (t1 and t2 are the "same" targets)
+//   > 0 if t1 > t2  if target t1 is not equal and lexically after target t2
+//
+// More formally, ordering and equality is determined in the following order:
+//
+// 1. target scrape pool
+// 2. target labels
+// 3. target discovered labels
+//
+// Note: this can still leave ordering undetermined for equal targets (x == y).
+// For determining ordering of equal targets, use ActiveTarget#CompareState.
+func (t1 *ActiveTarget) Compare(t2 *ActiveTarget) int {
+	if d := strings.Compare(t1.ScrapePool, t2.ScrapePool); d != 0 {
+		return d
+	}
+
+	if d := labels.Compare(t1.Labels.PromLabels(), t2.Labels.PromLabels()); d != 0 {
+		return d
+	}
+
+	return labels.Compare(t1.DiscoveredLabels.PromLabels(), t2.DiscoveredLabels.PromLabels())
+}
+
+// CompareState compares two equal active targets t1 and t2 and returns:
+//
+//   < 0 if t1 < t2  if target t1 is lexically before target t2
+//     0 if t1 == t2
+//   > 0 if t1 > t2  if target t1 is lexically after target t2
+//
+// More formally, the ordering is determined in the following order:
+//
+// 1. target health
+// 2. target last scrape (later scrape comes first)
+//
+// Note: This method assumes t1 and t2 are logically equal as per ActiveTarget#Compare.
+func (t1 *ActiveTarget) CompareState(t2 *ActiveTarget) int {
+	if d := t1.Health.Compare(t2.Health); d != 0 {
+		return d
+	}
+
+	if t1.LastScrape.Before(t2.LastScrape) {
+		return 1
+	}
+
+	if t1.LastScrape.After(t2.LastScrape) {
+		return -1
+	}
+
+	return 0
+}
+
+// Compare compares dropped targets t1 and t2 by their discovered labels.
+func (t1 *DroppedTarget) Compare(t2 *DroppedTarget) int {
+	return labels.Compare(t1.DiscoveredLabels.PromLabels(), t2.DiscoveredLabels.PromLabels())
+}
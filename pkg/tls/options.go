@@ -7,6 +7,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"io/ioutil"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -14,6 +17,8 @@ import (
 )
 
 // NewServerConfig provides new server TLS configuration.
+// The certificate and the client CA are reloaded on the next handshakes when their files are modified, so that they
+// can be rotated without restart.
 func NewServerConfig(logger log.Logger, cert, key, clientCA string) (*tls.Config, error) {
 	if key == "" && cert == "" {
 		if clientCA != "" {
@@ -34,25 +39,27 @@ func NewServerConfig(logger log.Logger, cert, key, clientCA string) (*tls.Config
 		MinVersion: tls.VersionTLS12,
 	}
 
-	tlsCert, err := tls.LoadX509KeyPair(cert, key)
+	certs, err := newReloader(logger, func() (interface{}, error) { return loadKeyPair(cert, key) }, cert, key)
 	if err != nil {
 		return nil, errors.Wrap(err, "server credentials")
 	}
-
-	tlsCfg.Certificates = []tls.Certificate{tlsCert}
+	tlsCfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return certs.get().(*tls.Certificate), nil
+	}
 
 	if clientCA != "" {
-		caPEM, err := ioutil.ReadFile(clientCA)
+		cas, err := newReloader(logger, func() (interface{}, error) { return loadCertPool(clientCA) }, clientCA)
 		if err != nil {
-			return nil, errors.Wrap(err, "reading client CA")
-		}
-
-		certPool := x509.NewCertPool()
-		if !certPool.AppendCertsFromPEM(caPEM) {
-			return nil, errors.Wrap(err, "building client CA")
+			return nil, errors.Wrap(err, "client CA")
 		}
-		tlsCfg.ClientCAs = certPool
+		tlsCfg.ClientCAs = cas.get().(*x509.CertPool)
 		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsCfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := tlsCfg.Clone()
+			cfg.ClientCAs = cas.get().(*x509.CertPool)
+			cfg.GetConfigForClient = nil
+			return cfg, nil
+		}
 
 		level.Info(logger).Log("msg", "server TLS client verification enabled")
 	}
@@ -61,47 +68,150 @@ func NewServerConfig(logger log.Logger, cert, key, clientCA string) (*tls.Config
 }
 
 // NewClientConfig provides new client TLS configuration.
+// The certificate is reloaded on the next handshakes when its files are modified.
 func NewClientConfig(logger log.Logger, cert, key, caCert, serverName string) (*tls.Config, error) {
-	var certPool *x509.CertPool
+	cfg, err := NewClientConfigFunc(logger, cert, key, caCert, serverName)
+	if err != nil {
+		return nil, err
+	}
+	return cfg(), nil
+}
+
+// NewClientConfigFunc provides a function returning new client TLS configurations with the last loaded certificate
+// and CA, which are reloaded when their files are modified. Building the configuration of each connection with it
+// allows rotating the certificate and the CA without restart.
+func NewClientConfigFunc(logger log.Logger, cert, key, caCert, serverName string) (func() *tls.Config, error) {
+	var certPool func() *x509.CertPool
 	if caCert != "" {
-		caPEM, err := ioutil.ReadFile(caCert)
+		cas, err := newReloader(logger, func() (interface{}, error) { return loadCertPool(caCert) }, caCert)
 		if err != nil {
-			return nil, errors.Wrap(err, "reading client CA")
-		}
-
-		certPool = x509.NewCertPool()
-		if !certPool.AppendCertsFromPEM(caPEM) {
-			return nil, errors.Wrap(err, "building client CA")
+			return nil, errors.Wrap(err, "client CA")
 		}
+		certPool = func() *x509.CertPool { return cas.get().(*x509.CertPool) }
 		level.Info(logger).Log("msg", "TLS client using provided certificate pool")
 	} else {
-		var err error
-		certPool, err = x509.SystemCertPool()
+		systemPool, err := x509.SystemCertPool()
 		if err != nil {
 			return nil, errors.Wrap(err, "reading system certificate pool")
 		}
+		certPool = func() *x509.CertPool { return systemPool }
 		level.Info(logger).Log("msg", "TLS client using system certificate pool")
 	}
 
-	tlsCfg := &tls.Config{
-		RootCAs: certPool,
-	}
-
-	if serverName != "" {
-		tlsCfg.ServerName = serverName
-	}
-
 	if (key != "") != (cert != "") {
 		return nil, errors.New("both client key and certificate must be provided")
 	}
 
+	var getClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
 	if cert != "" {
-		cert, err := tls.LoadX509KeyPair(cert, key)
+		certs, err := newReloader(logger, func() (interface{}, error) { return loadKeyPair(cert, key) }, cert, key)
 		if err != nil {
 			return nil, errors.Wrap(err, "client credentials")
 		}
-		tlsCfg.Certificates = []tls.Certificate{cert}
+		getClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.get().(*tls.Certificate), nil
+		}
 		level.Info(logger).Log("msg", "TLS client authentication enabled")
 	}
-	return tlsCfg, nil
+
+	return func() *tls.Config {
+		return &tls.Config{
+			RootCAs:              certPool(),
+			ServerName:           serverName,
+			GetClientCertificate: getClientCertificate,
+		}
+	}, nil
+}
+
+func loadKeyPair(cert, key string) (*tls.Certificate, error) {
+	c, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func loadCertPool(caCert string) (*x509.CertPool, error) {
+	caPEM, err := ioutil.ReadFile(caCert)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading CA")
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.Errorf("building CA from %s", caCert)
+	}
+	return certPool, nil
+}
+
+// reloader holds a value loaded from files, which is reloaded when any of the files is modified.
+type reloader struct {
+	logger log.Logger
+	files  []string
+	load   func() (interface{}, error)
+
+	mtx   sync.Mutex
+	value interface{}
+	// The modification times and sizes of the files when the value was last loaded.
+	modTimes []time.Time
+	sizes    []int64
+}
+
+func newReloader(logger log.Logger, load func() (interface{}, error), files ...string) (*reloader, error) {
+	r := &reloader{logger: logger, files: files, load: load}
+	modTimes, sizes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if r.value, err = load(); err != nil {
+		return nil, err
+	}
+	r.modTimes, r.sizes = modTimes, sizes
+	return r, nil
+}
+
+// get returns the value, reloaded first if the files were modified since it was last loaded. The last value is
+// returned if it can not be reloaded, e.g. while the files are being rotated.
+func (r *reloader) get() interface{} {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	modTimes, sizes, err := r.stat()
+	if err != nil {
+		level.Error(r.logger).Log("msg", "failed to check TLS files for changes, using the last loaded ones", "file", r.files[0], "err", err)
+		return r.value
+	}
+	modified := false
+	for i := range r.files {
+		modified = modified || !modTimes[i].Equal(r.modTimes[i]) || sizes[i] != r.sizes[i]
+	}
+	if !modified {
+		return r.value
+	}
+
+	// The files are not reloaded again until they are modified, e.g. when the rotation of a key pair is completed.
+	r.modTimes, r.sizes = modTimes, sizes
+
+	value, err := r.load()
+	if err != nil {
+		level.Error(r.logger).Log("msg", "failed to reload TLS files, using the last loaded ones", "file", r.files[0], "err", err)
+		return r.value
+	}
+	level.Info(r.logger).Log("msg", "reloaded TLS files", "file", r.files[0])
+	r.value = value
+	return r.value
+}
+
+func (r *reloader) stat() ([]time.Time, []int64, error) {
+	modTimes := make([]time.Time, 0, len(r.files))
+	sizes := make([]int64, 0, len(r.files))
+	for _, f := range r.files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		modTimes = append(modTimes, fi.ModTime())
+		sizes = append(sizes, fi.Size())
+	}
+	return modTimes, sizes, nil
 }
@@ -0,0 +1,144 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	testutil.Ok(t, err)
+	cert, err := x509.ParseCertificate(der)
+	testutil.Ok(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// keyPair returns the PEM encoded certificate and key of a server and client named localhost, signed by the CA.
+func (ca *testCA) keyPair(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	testutil.Ok(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	testutil.Ok(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func handshake(serverCfg, clientCfg *tls.Config) error {
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- tls.Server(serverConn, serverCfg).Handshake()
+		// Unblock the client if the server fails first.
+		_ = serverConn.Close()
+	}()
+	clientErr := tls.Client(clientConn, clientCfg).Handshake()
+	_ = clientConn.Close()
+	if serverErr := <-errs; serverErr != nil {
+		return serverErr
+	}
+	return clientErr
+}
+
+func TestConfig_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls-reload")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	var (
+		caFile   = filepath.Join(dir, "ca.crt")
+		certFile = filepath.Join(dir, "tls.crt")
+		keyFile  = filepath.Join(dir, "tls.key")
+		modTime  = time.Now()
+	)
+	write := func(file string, content []byte) {
+		testutil.Ok(t, ioutil.WriteFile(file, content, 0600))
+		// Make sure the modification is detected, even within the resolution of the file system times.
+		modTime = modTime.Add(time.Second)
+		testutil.Ok(t, os.Chtimes(file, modTime, modTime))
+	}
+	rotate := func(ca *testCA) {
+		cert, key := ca.keyPair(t)
+		write(caFile, ca.pem)
+		write(certFile, cert)
+		write(keyFile, key)
+	}
+
+	rotate(newTestCA(t, "ca-1"))
+
+	logger := log.NewNopLogger()
+	serverCfg, err := NewServerConfig(logger, certFile, keyFile, caFile)
+	testutil.Ok(t, err)
+	clientCfg, err := NewClientConfigFunc(logger, certFile, keyFile, caFile, "localhost")
+	testutil.Ok(t, err)
+
+	oldClientCfg := clientCfg()
+	testutil.Ok(t, handshake(serverCfg, oldClientCfg))
+
+	// The certificates and the CAs are rotated with no need to rebuild the server configuration.
+	rotate(newTestCA(t, "ca-2"))
+	testutil.Ok(t, handshake(serverCfg, clientCfg()))
+	testutil.NotOk(t, handshake(serverCfg, oldClientCfg))
+
+	// The last loaded certificates are kept while the files are invalid.
+	write(keyFile, []byte("invalid"))
+	testutil.Ok(t, handshake(serverCfg, clientCfg()))
+
+	// The client does not trust servers with certificates of another CA.
+	rotate(newTestCA(t, "ca-3"))
+	otherCfg, err := NewServerConfig(logger, certFile, keyFile, "")
+	testutil.Ok(t, err)
+	testutil.Ok(t, handshake(otherCfg, clientCfg()))
+	write(caFile, newTestCA(t, "ca-4").pem)
+	testutil.NotOk(t, handshake(otherCfg, clientCfg()))
+}
@@ -100,3 +100,28 @@ func HTTPTripperware(logger log.Logger, next http.RoundTripper) http.RoundTrippe
 		next:   next,
 	}
 }
+
+type propagationTripperware struct {
+	next http.RoundTripper
+}
+
+func (t *propagationTripperware) RoundTrip(r *http.Request) (*http.Response, error) {
+	tracer := tracerFromContext(r.Context())
+	span := opentracing.SpanFromContext(r.Context())
+	if tracer == nil || span == nil {
+		return t.next.RoundTrip(r)
+	}
+
+	// Round trippers must not modify the requests.
+	r = r.Clone(r.Context())
+	// There's nothing we can do with any errors here.
+	_ = tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+	return t.next.RoundTrip(r)
+}
+
+// HTTPPropagationTripperware returns HTTP tripper that injects the span in the request context, if any, into the wire,
+// e.g. for the requests of object storage clients. Unlike HTTPTripperware, it does not tag the span and does not
+// expect a tracer in all the request contexts.
+func HTTPPropagationTripperware(next http.RoundTripper) http.RoundTripper {
+	return &propagationTripperware{next: next}
+}
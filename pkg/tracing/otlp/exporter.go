@@ -0,0 +1,391 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/version"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/tracing/otlp/otlppb"
+)
+
+const (
+	grpcExportMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+	instrumentationLibrary = "github.com/thanos-io/thanos"
+)
+
+// exporter sends the export requests of the spans to the OTLP receiver.
+type exporter interface {
+	Export(ctx context.Context, req *otlppb.TracesData) error
+	Close() error
+}
+
+// reporter is a jaeger.Reporter encoding the finished spans, and exporting them in batches with the given exporter.
+type reporter struct {
+	logger   log.Logger
+	exporter exporter
+	timeout  time.Duration
+
+	maxBatchSize  int
+	flushInterval time.Duration
+	resource      *otlppb.Resource
+
+	queue     chan *otlppb.Span
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	exportedSpans prometheus.Counter
+	failedSpans   prometheus.Counter
+	droppedSpans  prometheus.Counter
+}
+
+func newReporter(logger log.Logger, reg prometheus.Registerer, config Config, resource map[string]string, exp exporter) *reporter {
+	r := &reporter{
+		logger:        logger,
+		exporter:      exp,
+		timeout:       config.Timeout,
+		maxBatchSize:  config.MaxBatchSize,
+		flushInterval: config.FlushInterval,
+		resource:      newResource(resource),
+		queue:         make(chan *otlppb.Span, config.MaxQueueSize),
+		done:          make(chan struct{}),
+		exportedSpans: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_tracing_otlp_exported_spans_total",
+			Help: "Total number of spans exported with OTLP.",
+		}),
+		failedSpans: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_tracing_otlp_failed_spans_total",
+			Help: "Total number of spans which failed to be exported with OTLP.",
+		}),
+		droppedSpans: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_tracing_otlp_dropped_spans_total",
+			Help: "Total number of spans dropped because the export queue was full.",
+		}),
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run()
+	}()
+	return r
+}
+
+// Report converts the span right away, so that the span does not need to be retained.
+func (r *reporter) Report(span *jaeger.Span) {
+	select {
+	case r.queue <- newSpan(span):
+	default:
+		r.droppedSpans.Inc()
+	}
+}
+
+// Close flushes the queued spans and closes the exporter.
+func (r *reporter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+		if err := r.exporter.Close(); err != nil {
+			level.Warn(r.logger).Log("msg", "failed to close OTLP exporter", "err", err)
+		}
+	})
+}
+
+func (r *reporter) run() {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*otlppb.Span, 0, r.maxBatchSize)
+	for {
+		select {
+		case span := <-r.queue:
+			if batch = append(batch, span); len(batch) >= r.maxBatchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-r.done:
+			for {
+				select {
+				case span := <-r.queue:
+					if batch = append(batch, span); len(batch) >= r.maxBatchSize {
+						batch = r.flush(batch)
+					}
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush exports the given batch of spans, and returns it emptied.
+func (r *reporter) flush(batch []*otlppb.Span) []*otlppb.Span {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	if err := r.exporter.Export(ctx, newRequest(r.resource, batch)); err != nil {
+		level.Warn(r.logger).Log("msg", "failed to export spans with OTLP", "spans", len(batch), "err", err)
+		r.failedSpans.Add(float64(len(batch)))
+	} else {
+		r.exportedSpans.Add(float64(len(batch)))
+	}
+	return batch[:0]
+}
+
+type grpcExporter struct {
+	conn    *grpc.ClientConn
+	headers metadata.MD
+}
+
+func newGRPCExporter(ctx context.Context, config Config) (*grpcExporter, error) {
+	creds := grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{}))
+	if config.Insecure {
+		creds = grpc.WithInsecure()
+	}
+	conn, err := grpc.DialContext(ctx, config.Endpoint, creds)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial %s", config.Endpoint)
+	}
+	return &grpcExporter{conn: conn, headers: metadata.New(config.Headers)}, nil
+}
+
+func (e *grpcExporter) Export(ctx context.Context, req *otlppb.TracesData) error {
+	// The ExportTraceServiceResponse message has no fields used here.
+	return e.conn.Invoke(metadata.NewOutgoingContext(ctx, e.headers), grpcExportMethod, req, &types.Empty{})
+}
+
+func (e *grpcExporter) Close() error {
+	return e.conn.Close()
+}
+
+type httpExporter struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func newHTTPExporter(config Config) (*httpExporter, error) {
+	scheme := "https"
+	if config.Insecure {
+		scheme = "http"
+	}
+	return &httpExporter{
+		client:  &http.Client{Timeout: config.Timeout},
+		url:     fmt.Sprintf("%s://%s%s", scheme, config.Endpoint, config.URLPath),
+		headers: config.Headers,
+	}, nil
+}
+
+func (e *httpExporter) Export(ctx context.Context, req *otlppb.TracesData) (err error) {
+	b, err := req.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "marshal export request")
+	}
+	r, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		r.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(r)
+	if err != nil {
+		return errors.Wrapf(err, "post %s", e.url)
+	}
+	defer runutil.ExhaustCloseWithErrCapture(&err, resp.Body, "export response body")
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("post %s: unexpected status %s", e.url, resp.Status)
+	}
+	return nil
+}
+
+func (e *httpExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// The following functions convert the spans to OTLP messages, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto.
+
+func traceIDBytes(id jaeger.TraceID) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], id.High)
+	binary.BigEndian.PutUint64(b[8:], id.Low)
+	return b
+}
+
+func spanIDBytes(id jaeger.SpanID) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func anyValue(v interface{}) *otlppb.AnyValue {
+	switch v := v.(type) {
+	case string:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_BoolValue{BoolValue: v}}
+	case int:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int8:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int16:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int32:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int64:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: v}}
+	case uint8:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint16:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint32:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_IntValue{IntValue: int64(v)}}
+	case float32:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_DoubleValue{DoubleValue: v}}
+	default:
+		// Including uint64 and uint, which may not fit in the int64 of the values.
+		return &otlppb.AnyValue{Value: &otlppb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+	}
+}
+
+func attribute(key string, value interface{}) *otlppb.KeyValue {
+	return &otlppb.KeyValue{Key: key, Value: anyValue(value)}
+}
+
+// newResource returns the resource with the given attributes, sorted by key.
+func newResource(attrs map[string]string) *otlppb.Resource {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	r := &otlppb.Resource{}
+	for _, k := range keys {
+		r.Attributes = append(r.Attributes, attribute(k, attrs[k]))
+	}
+	return r
+}
+
+// newRequest returns the export request of the given spans, all of the given resource. The TracesData message has
+// the same encoding as the ExportTraceServiceRequest message of the OTLP trace service.
+func newRequest(resource *otlppb.Resource, spans []*otlppb.Span) *otlppb.TracesData {
+	return &otlppb.TracesData{
+		ResourceSpans: []*otlppb.ResourceSpans{{
+			Resource: resource,
+			InstrumentationLibrarySpans: []*otlppb.InstrumentationLibrarySpans{{
+				InstrumentationLibrary: &otlppb.InstrumentationLibrary{Name: instrumentationLibrary, Version: version.Version},
+				Spans:                  spans,
+			}},
+		}},
+	}
+}
+
+// newSpan returns the OTLP span of the given span. The span.kind and error tags are converted to the kind and status
+// of the span, and the logs to its events.
+func newSpan(span *jaeger.Span) *otlppb.Span {
+	ctx := span.SpanContext()
+	s := &otlppb.Span{
+		TraceId:           traceIDBytes(ctx.TraceID()),
+		SpanId:            spanIDBytes(ctx.SpanID()),
+		Name:              span.OperationName(),
+		Kind:              otlppb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: uint64(span.StartTime().UnixNano()),
+		EndTimeUnixNano:   uint64(span.StartTime().Add(span.Duration()).UnixNano()),
+	}
+	if ctx.ParentID() != 0 {
+		s.ParentSpanId = spanIDBytes(ctx.ParentID())
+	}
+
+	tags := span.Tags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := tags[k]
+		switch k {
+		case string(ext.SpanKind):
+			switch fmt.Sprint(v) {
+			case string(ext.SpanKindRPCServerEnum):
+				s.Kind = otlppb.Span_SPAN_KIND_SERVER
+			case string(ext.SpanKindRPCClientEnum):
+				s.Kind = otlppb.Span_SPAN_KIND_CLIENT
+			case string(ext.SpanKindProducerEnum):
+				s.Kind = otlppb.Span_SPAN_KIND_PRODUCER
+			case string(ext.SpanKindConsumerEnum):
+				s.Kind = otlppb.Span_SPAN_KIND_CONSUMER
+			}
+			continue
+		case string(ext.Error):
+			if e, ok := v.(bool); ok {
+				if e {
+					s.Status = &otlppb.Status{Code: otlppb.Status_STATUS_CODE_ERROR}
+				}
+				continue
+			}
+		}
+		s.Attributes = append(s.Attributes, attribute(k, v))
+	}
+
+	for _, l := range span.Logs() {
+		event := &otlppb.Span_Event{TimeUnixNano: uint64(l.Timestamp.UnixNano()), Name: "log"}
+		for _, f := range l.Fields {
+			if f.Key() == "event" {
+				event.Name = fmt.Sprint(f.Value())
+				continue
+			}
+			event.Attributes = append(event.Attributes, attribute(f.Key(), f.Value()))
+		}
+		s.Events = append(s.Events, event)
+	}
+
+	for _, ref := range span.References() {
+		refCtx, ok := ref.ReferencedContext.(jaeger.SpanContext)
+		if !ok || ref.Type != opentracing.FollowsFromRef {
+			// The parent is the child of reference.
+			continue
+		}
+		s.Links = append(s.Links, &otlppb.Span_Link{TraceId: traceIDBytes(refCtx.TraceID()), SpanId: spanIDBytes(refCtx.SpanID())})
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package otlp implements a tracer exporting the spans with the OpenTelemetry protocol (OTLP), over gRPC or HTTP, to
+// any OpenTelemetry compatible backend, e.g. the OpenTelemetry Collector. The trace context is propagated with the
+// W3C Trace Context headers.
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	"github.com/uber/jaeger-client-go"
+	jaeger_prometheus "github.com/uber/jaeger-lib/metrics/prometheus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+)
+
+// Config - YAML configuration.
+type Config struct {
+	ServiceName string `yaml:"service_name"`
+	// Protocol of the export, either grpc or http.
+	Protocol string `yaml:"protocol"`
+	// Endpoint is the host:port of the OTLP receiver. Defaults to localhost:4317 for grpc and localhost:4318 for http.
+	Endpoint string `yaml:"endpoint"`
+	// URLPath is the path of the OTLP/HTTP receiver.
+	URLPath  string            `yaml:"url_path"`
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	// ResourceAttributes are added to the attributes of the resource of the spans, along with the service.name.
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	// SampleRatio is the ratio of the traces started by Thanos which are sampled. The sampling decision of the
+	// traces propagated to Thanos is always respected.
+	SampleRatio   float64       `yaml:"sample_ratio"`
+	MaxQueueSize  int           `yaml:"max_queue_size"`
+	MaxBatchSize  int           `yaml:"max_batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// DefaultConfig is the default configuration of the OTLP tracer.
+var DefaultConfig = Config{
+	ServiceName:   "thanos",
+	Protocol:      ProtocolGRPC,
+	URLPath:       "/v1/traces",
+	Timeout:       10 * time.Second,
+	SampleRatio:   1,
+	MaxQueueSize:  2048,
+	MaxBatchSize:  512,
+	FlushInterval: 5 * time.Second,
+}
+
+func parseConfig(conf []byte) (Config, error) {
+	config := DefaultConfig
+	if err := yaml.UnmarshalStrict(conf, &config); err != nil {
+		return Config{}, err
+	}
+
+	config.Protocol = strings.ToLower(config.Protocol)
+	switch config.Protocol {
+	case ProtocolGRPC:
+		if config.Endpoint == "" {
+			config.Endpoint = "localhost:4317"
+		}
+	case ProtocolHTTP:
+		if config.Endpoint == "" {
+			config.Endpoint = "localhost:4318"
+		}
+	default:
+		return Config{}, errors.Errorf("unsupported OTLP protocol %q, expected %s or %s", config.Protocol, ProtocolGRPC, ProtocolHTTP)
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return Config{}, errors.Errorf("sample ratio must be between 0 and 1, got %v", config.SampleRatio)
+	}
+	if config.MaxQueueSize <= 0 || config.MaxBatchSize <= 0 || config.FlushInterval <= 0 {
+		return Config{}, errors.New("max queue size, max batch size and flush interval must be positive")
+	}
+	return config, nil
+}
+
+// Tracer extends opentracing.Tracer.
+type Tracer struct {
+	opentracing.Tracer
+}
+
+// GetTraceIDFromSpanContext return TraceID from span.Context, as its W3C Trace Context representation.
+func (t *Tracer) GetTraceIDFromSpanContext(ctx opentracing.SpanContext) (string, bool) {
+	if c, ok := ctx.(jaeger.SpanContext); ok {
+		return fmt.Sprintf("%016x%016x", c.TraceID().High, c.TraceID().Low), true
+	}
+	return "", false
+}
+
+// NewTracer create tracer from YAML.
+func NewTracer(ctx context.Context, logger log.Logger, metrics *prometheus.Registry, conf []byte) (opentracing.Tracer, io.Closer, error) {
+	config, err := parseConfig(conf)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing OTLP tracing configuration")
+	}
+	level.Info(logger).Log("msg", "exporting traces with OTLP", "protocol", config.Protocol, "endpoint", config.Endpoint)
+
+	var exp exporter
+	switch config.Protocol {
+	case ProtocolGRPC:
+		exp, err = newGRPCExporter(ctx, config)
+	case ProtocolHTTP:
+		exp, err = newHTTPExporter(config)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create OTLP exporter")
+	}
+
+	sampler, err := jaeger.NewProbabilisticSampler(config.SampleRatio)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create sampler")
+	}
+
+	jaegerMetrics := jaeger.NewMetrics(jaeger_prometheus.New(jaeger_prometheus.WithRegisterer(metrics)), nil)
+	// The Jaeger propagators compare the lower-cased header names.
+	headers := (&jaeger.HeadersConfig{JaegerDebugHeader: strings.ToLower(tracing.ForceTracingBaggageKey)}).ApplyDefaults()
+	r := newReporter(logger, metrics, config, resourceAttributes(config), exp)
+
+	jaegerTracer, closer := jaeger.NewTracer(
+		config.ServiceName,
+		sampler,
+		r,
+		jaeger.TracerOptions.Gen128Bit(true),
+		jaeger.TracerOptions.Metrics(jaegerMetrics),
+		jaeger.TracerOptions.Logger(&jaegerLogger{logger: logger}),
+		jaeger.TracerOptions.CustomHeaderKeys(headers),
+		jaeger.TracerOptions.Injector(opentracing.HTTPHeaders, w3cPropagator{}),
+		jaeger.TracerOptions.Injector(opentracing.TextMap, w3cPropagator{}),
+		jaeger.TracerOptions.Extractor(opentracing.HTTPHeaders, w3cPropagator{fallback: jaeger.NewHTTPHeaderPropagator(headers, *jaegerMetrics)}),
+		jaeger.TracerOptions.Extractor(opentracing.TextMap, w3cPropagator{fallback: jaeger.NewTextMapPropagator(headers, *jaegerMetrics)}),
+	)
+	return &Tracer{jaegerTracer}, closer, nil
+}
+
+// resourceAttributes returns the attributes of the resource of the spans, i.e. of this process.
+func resourceAttributes(config Config) map[string]string {
+	attrs := map[string]string{
+		"service.name":    config.ServiceName,
+		"service.version": version.Version,
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attrs["host.name"] = hostname
+	}
+	for k, v := range config.ResourceAttributes {
+		attrs[k] = v
+	}
+	return attrs
+}
+
+type jaegerLogger struct {
+	logger log.Logger
+}
+
+func (l *jaegerLogger) Infof(format string, args ...interface{}) {
+	level.Info(l.logger).Log("msg", fmt.Sprintf(format, args...))
+}
+
+func (l *jaegerLogger) Error(msg string) {
+	level.Error(l.logger).Log("msg", msg)
+}
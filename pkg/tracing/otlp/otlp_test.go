@@ -0,0 +1,274 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/tracing"
+	"github.com/thanos-io/thanos/pkg/tracing/otlp/otlppb"
+)
+
+func TestMain(m *testing.M) {
+	testutil.TolerantVerifyLeakMain(m)
+}
+
+// decodeSpans returns the spans of an encoded export request, with the attributes of their resource.
+func decodeSpans(t *testing.T, req []byte) ([]*otlppb.Span, map[string]string) {
+	var data otlppb.TracesData
+	testutil.Ok(t, data.Unmarshal(req))
+	testutil.Equals(t, 1, len(data.ResourceSpans))
+
+	resource := map[string]string{}
+	for _, kv := range data.ResourceSpans[0].Resource.Attributes {
+		resource[kv.Key] = kv.Value.GetStringValue()
+	}
+	testutil.Equals(t, 1, len(data.ResourceSpans[0].InstrumentationLibrarySpans))
+	return data.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans, resource
+}
+
+func TestW3CPropagation(t *testing.T) {
+	clientTracer, clientCloser, err := NewTracer(context.Background(), log.NewNopLogger(), prometheus.NewRegistry(), []byte(`service_name: client
+protocol: http
+endpoint: 127.0.0.1:0
+`))
+	testutil.Ok(t, err)
+	defer clientCloser.Close()
+
+	// The server would not sample any trace it starts, but respects the decision of its client.
+	srvTracer, srvCloser, err := NewTracer(context.Background(), log.NewNopLogger(), prometheus.NewRegistry(), []byte(`service_name: server
+protocol: http
+endpoint: 127.0.0.1:0
+sample_ratio: 0
+`))
+	testutil.Ok(t, err)
+	defer srvCloser.Close()
+
+	clientSpan := clientTracer.StartSpan("client")
+	clientSpan.SetBaggageItem("tenant", "team a")
+	defer clientSpan.Finish()
+
+	header := http.Header{}
+	testutil.Ok(t, clientTracer.Inject(clientSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)))
+	clientCtx := clientSpan.Context().(jaeger.SpanContext)
+	testutil.Equals(t, fmt.Sprintf("00-%016x%016x-%016x-01", clientCtx.TraceID().High, clientCtx.TraceID().Low, uint64(clientCtx.SpanID())), header.Get("traceparent"))
+	testutil.Equals(t, "tenant=team%20a", header.Get("baggage"))
+
+	wireCtx, err := srvTracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	testutil.Ok(t, err)
+	srvSpan := srvTracer.StartSpan("server", ext.RPCServerOption(wireCtx))
+	defer srvSpan.Finish()
+
+	srvCtx := srvSpan.Context().(jaeger.SpanContext)
+	testutil.Equals(t, clientCtx.TraceID(), srvCtx.TraceID())
+	testutil.Equals(t, clientCtx.SpanID(), srvCtx.ParentID())
+	testutil.Assert(t, srvCtx.IsSampled(), "server span should be sampled as its parent")
+	testutil.Equals(t, "team a", srvSpan.BaggageItem("tenant"))
+
+	traceID, ok := srvTracer.(tracing.Tracer).GetTraceIDFromSpanContext(srvCtx)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, header.Get("traceparent")[3:35], traceID)
+
+	// Traces are forced with the force tracing header, even without trace context.
+	forced, err := srvTracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{tracing.ForceTracingBaggageKey: []string{"true"}}))
+	testutil.Ok(t, err)
+	forcedSpan := srvTracer.StartSpan("forced", ext.RPCServerOption(forced))
+	defer forcedSpan.Finish()
+	testutil.Assert(t, forcedSpan.Context().(jaeger.SpanContext).IsSampled(), "forced span should be sampled")
+
+	_, err = srvTracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{}))
+	testutil.Equals(t, opentracing.ErrSpanContextNotFound, err)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, flags, err := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	testutil.Ok(t, err)
+	testutil.Equals(t, jaeger.TraceID{High: 0x4bf92f3577b34da6, Low: 0xa3ce929d0e0e4736}, traceID)
+	testutil.Equals(t, jaeger.SpanID(0x00f067aa0ba902b7), spanID)
+	testutil.Equals(t, byte(1), flags)
+
+	// Future versions may have more fields.
+	_, _, _, err = parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	testutil.Ok(t, err)
+
+	for _, tcase := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+	} {
+		_, _, _, err := parseTraceparent(tcase)
+		testutil.NotOk(t, err, tcase)
+	}
+}
+
+func TestExport_HTTP(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests [][]byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/v1/traces", r.URL.Path)
+		testutil.Equals(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		testutil.Equals(t, "secret", r.Header.Get("X-Api-Key"))
+		b, err := ioutil.ReadAll(r.Body)
+		testutil.Ok(t, err)
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		requests = append(requests, b)
+	}))
+	defer srv.Close()
+
+	tracer, closer, err := NewTracer(context.Background(), log.NewNopLogger(), prometheus.NewRegistry(), []byte(fmt.Sprintf(`service_name: thanos-query
+protocol: http
+endpoint: %s
+insecure: true
+headers:
+  X-Api-Key: secret
+resource_attributes:
+  deployment.environment: test
+`, strings.TrimPrefix(srv.URL, "http://"))))
+	testutil.Ok(t, err)
+
+	parent := tracer.StartSpan("parent")
+	child := tracer.StartSpan("child", opentracing.ChildOf(parent.Context()), ext.SpanKindRPCClient)
+	child.SetTag("store", "127.0.0.1:10901")
+	ext.Error.Set(child, true)
+	child.LogKV("event", "retry", "attempt", 2)
+	child.Finish()
+	parent.Finish()
+
+	// Closing the tracer flushes the spans.
+	testutil.Ok(t, closer.Close())
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	testutil.Equals(t, 1, len(requests))
+	spans, resource := decodeSpans(t, requests[0])
+	testutil.Equals(t, "thanos-query", resource["service.name"])
+	testutil.Equals(t, "test", resource["deployment.environment"])
+	testutil.Equals(t, 2, len(spans))
+
+	childCtx := child.Context().(jaeger.SpanContext)
+	testutil.Equals(t, traceIDBytes(childCtx.TraceID()), spans[0].TraceId)
+	testutil.Equals(t, spanIDBytes(childCtx.SpanID()), spans[0].SpanId)
+	testutil.Equals(t, spanIDBytes(childCtx.ParentID()), spans[0].ParentSpanId)
+	testutil.Equals(t, "child", spans[0].Name)
+	testutil.Equals(t, otlppb.Span_SPAN_KIND_CLIENT, spans[0].Kind)
+	testutil.Equals(t, 1, len(spans[0].Attributes))
+	testutil.Equals(t, "store", spans[0].Attributes[0].Key)
+	testutil.Equals(t, "127.0.0.1:10901", spans[0].Attributes[0].Value.GetStringValue())
+	testutil.Equals(t, 1, len(spans[0].Events))
+	testutil.Equals(t, "retry", spans[0].Events[0].Name)
+	testutil.Equals(t, int64(2), spans[0].Events[0].Attributes[0].Value.GetIntValue())
+	testutil.Equals(t, otlppb.Status_STATUS_CODE_ERROR, spans[0].Status.Code)
+
+	testutil.Equals(t, "parent", spans[1].Name)
+	testutil.Equals(t, otlppb.Span_SPAN_KIND_INTERNAL, spans[1].Kind)
+	testutil.Assert(t, spans[1].EndTimeUnixNano >= spans[1].StartTimeUnixNano, "end time should not be before start time")
+	testutil.Assert(t, len(spans[1].ParentSpanId) == 0, "root span should not have a parent")
+	testutil.Assert(t, spans[1].Status == nil, "span without error should have no status")
+}
+
+// rawCodec is the codec of the test server, keeping the encoded export requests.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return errors.Errorf("unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) String() string { return "proto" }
+
+func TestExport_GRPC(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests [][]byte
+	)
+	srv := grpc.NewServer(grpc.CustomCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		testutil.Equals(t, grpcExportMethod, method)
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		testutil.Equals(t, []string{"secret"}, md.Get("x-api-key"))
+
+		var req []byte
+		testutil.Ok(t, stream.RecvMsg(&req))
+		mtx.Lock()
+		requests = append(requests, req)
+		mtx.Unlock()
+		return stream.SendMsg(&types.Empty{})
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Stop()
+
+	tracer, closer, err := NewTracer(context.Background(), log.NewNopLogger(), prometheus.NewRegistry(), []byte(fmt.Sprintf(`endpoint: %s
+insecure: true
+headers:
+  x-api-key: secret
+max_batch_size: 2
+flush_interval: 1h
+`, l.Addr().String())))
+	testutil.Ok(t, err)
+	defer closer.Close()
+
+	for i := 0; i < 2; i++ {
+		tracer.StartSpan(fmt.Sprintf("span-%d", i)).Finish()
+	}
+
+	// The full batch is exported without waiting for the flush interval.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(50*time.Millisecond, ctx.Done(), func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(requests) != 1 {
+			return errors.Errorf("expected 1 export request, got %d", len(requests))
+		}
+		return nil
+	}))
+	mtx.Lock()
+	defer mtx.Unlock()
+	spans, resource := decodeSpans(t, requests[0])
+	testutil.Equals(t, "thanos", resource["service.name"])
+	testutil.Equals(t, 2, len(spans))
+	testutil.Equals(t, "span-0", spans[0].Name)
+	testutil.Equals(t, "span-1", spans[1].Name)
+}
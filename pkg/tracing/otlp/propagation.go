@@ -0,0 +1,148 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	baggageHeader     = "baggage"
+
+	sampledFlag = 0x01
+)
+
+// w3cPropagator injects and extracts the span contexts with the W3C Trace Context traceparent header, see
+// https://www.w3.org/TR/trace-context/, and their baggage with the W3C baggage header. The span contexts without
+// traceparent header are extracted with the fallback, if any, e.g. to support the Jaeger headers and the forced
+// tracing with the tracing.ForceTracingBaggageKey header.
+type w3cPropagator struct {
+	fallback jaeger.Extractor
+}
+
+func (p w3cPropagator) Inject(ctx jaeger.SpanContext, carrier interface{}) error {
+	writer, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	var flags byte
+	if ctx.IsSampled() {
+		flags |= sampledFlag
+	}
+	writer.Set(traceparentHeader, fmt.Sprintf("00-%016x%016x-%016x-%02x", ctx.TraceID().High, ctx.TraceID().Low, uint64(ctx.SpanID()), flags))
+
+	var items []string
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if v != "" {
+			items = append(items, url.PathEscape(k)+"="+url.PathEscape(v))
+		}
+		return true
+	})
+	if len(items) > 0 {
+		writer.Set(baggageHeader, strings.Join(items, ","))
+	}
+	return nil
+}
+
+func (p w3cPropagator) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+
+	var traceparent, baggage string
+	if err := reader.ForeachKey(func(k, v string) error {
+		switch strings.ToLower(k) {
+		case traceparentHeader:
+			traceparent = v
+		case baggageHeader:
+			baggage = v
+		}
+		return nil
+	}); err != nil {
+		return jaeger.SpanContext{}, err
+	}
+
+	if traceparent == "" {
+		if p.fallback != nil {
+			return p.fallback.Extract(carrier)
+		}
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	traceID, spanID, flags, err := parseTraceparent(traceparent)
+	if err != nil {
+		return jaeger.SpanContext{}, errors.Wrapf(opentracing.ErrSpanContextCorrupted, "invalid traceparent %q: %v", traceparent, err)
+	}
+	return jaeger.NewSpanContext(traceID, spanID, 0, flags&sampledFlag != 0, parseBaggage(baggage)), nil
+}
+
+// parseTraceparent parses a traceparent header: a version, the trace and parent span IDs and the trace flags, in hex
+// and separated by dashes.
+func parseTraceparent(s string) (jaeger.TraceID, jaeger.SpanID, byte, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return jaeger.TraceID{}, 0, 0, errors.New("expected 4 fields")
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 || version[0] == 0xff {
+		return jaeger.TraceID{}, 0, 0, errors.New("invalid version")
+	}
+	// Future versions may append fields, but the version 00 has exactly 4.
+	if version[0] == 0 && len(parts) != 4 {
+		return jaeger.TraceID{}, 0, 0, errors.New("expected 4 fields")
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return jaeger.TraceID{}, 0, 0, errors.New("invalid field length")
+	}
+
+	traceID, err := jaeger.TraceIDFromString(parts[1])
+	if err != nil || !traceID.IsValid() {
+		return jaeger.TraceID{}, 0, 0, errors.New("invalid trace ID")
+	}
+	spanID, err := jaeger.SpanIDFromString(parts[2])
+	if err != nil || spanID == 0 {
+		return jaeger.TraceID{}, 0, 0, errors.New("invalid parent ID")
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return jaeger.TraceID{}, 0, 0, errors.New("invalid trace flags")
+	}
+	return traceID, spanID, flags[0], nil
+}
+
+// parseBaggage parses a baggage header: comma separated key=value items, with optional properties after semicolons,
+// which are ignored. Invalid items are ignored as well.
+func parseBaggage(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	baggage := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.SplitN(item, ";", 2)[0]
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		k, err := url.PathUnescape(strings.TrimSpace(kv[0]))
+		if err != nil || k == "" {
+			continue
+		}
+		v, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			continue
+		}
+		baggage[k] = v
+	}
+	return baggage
+}
@@ -1,9 +1,11 @@
 // Package ui Code generated by go-bindata. (@generated) DO NOT EDIT.
 // sources:
 // pkg/ui/templates/_base.html
+// pkg/ui/templates/active_queries.html
 // pkg/ui/templates/alerts.html
 // pkg/ui/templates/bucket.html
 // pkg/ui/templates/bucket_menu.html
+// pkg/ui/templates/compactions.html
 // pkg/ui/templates/graph.html
 // pkg/ui/templates/query_menu.html
 // pkg/ui/templates/rule_menu.html
@@ -176,6 +178,26 @@ func pkgUiTemplates_baseHtml() (*asset, error) {
 	return a, nil
 }
 
+var _pkgUiTemplatesActive_queriesHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x85\x93\xc1\x6e\x83\x30\x0c\x86\xef\x7b\x8a\x28\xea\x15\xd8\x76\x9c\x00\x69\x52\x77\xe8\x61\x9b\xa6\xed\x05\x02\x31\x10\x89\x26\xc5\x84\x4a\x55\xc4\xbb\x2f\x01\x52\xda\x0e\x3a\x0e\x01\xdb\x7f\xbe\x84\xdf\xb2\x31\x1c\x0a\x21\x81\xd0\x0a\x18\xa7\x7d\xff\x40\xec\x13\xef\x41\x33\x52\x69\x7d\x08\xa0\xe9\xc4\x31\xa1\x08\x05\x42\x5b\x51\x92\x2b\xa9\x41\xea\x84\x3e\x3d\xd2\x28\x7d\x30\x06\x24\xb7\xbb\xec\x87\x07\x4d\x0a\xc7\x8a\xb9\x38\x92\xbc\x66\x6d\x9b\x0c\x69\x66\x05\x18\x14\x75\x27\x38\x4d\xc7\x93\xaa\xe7\xf4\x35\xd7\xe2\x08\xe4\xab\x03\x14\xd0\xc6\x91\x4d\x0d\x35\x63\x44\x41\xa4\xd2\x24\xf4\xd7\xba\xc0\xb1\x1a\x50\x93\x61\x0d\x84\x2c\x14\x25\xa8\x6a\x98\xf2\x34\xfd\x50\xa4\x19\x79\x84\x21\x10\xec\xa4\x14\xb2\x0c\xe3\xc8\x22\x3c\x1d\xea\x16\x3c\x59\xb3\xac\x06\xcf\x1e\x83\x61\x0d\x32\x85\x1c\x10\xfc\x7d\x47\xb1\xf3\xea\x32\xc6\x39\x98\x04\xe9\x6e\x1b\x47\xf6\xf5\x27\xff\x26\xf9\x41\x09\xa9\x97\xab\xce\x83\xd3\x72\xe9\x13\x45\x29\x24\xd3\x0a\x97\xeb\x3f\x20\xd9\x1a\xf6\x5b\x33\xd4\xc0\x97\x8b\xef\x4c\xe7\x15\x60\xbb\xb6\x55\x21\xdc\xd4\x6c\x84\x57\xd1\xad\x1f\x99\xe2\xa7\x39\x36\x06\x99\x2c\x81\x6c\x1a\xf2\x92\x9c\x9b\xb9\xe2\x1c\x4f\x8d\xd9\x34\xe1\x6e\xdb\xf7\x16\xcc\x57\xca\xde\xc5\x35\x51\x9c\x2b\x0e\xa3\x74\xb0\xd4\xe9\x86\xd4\x1d\xe6\x6c\xf0\xdd\xa3\x47\x9f\xd7\x25\xad\x90\xb9\xfb\xd7\x70\x30\xbd\xef\x09\x2b\xd5\x9a\x76\xf2\x65\xef\x7c\xb1\x3b\x7c\x27\x2c\xdc\xdf\x7f\x3f\xdf\x3c\xc3\x28\x9d\xc6\xed\x1f\x5e\x3b\xf1\xc6\xde\xf5\xbd\xe5\x38\xe6\x2a\xe0\xba\x9f\x7e\xa4\x2f\xaa\x73\x3f\x6d\xe0\xc6\xe2\x3c\x42\x83\x72\x9a\x2a\x1f\xfe\x02\x45\xf9\x68\x93\x54\x04\x00\x00")
+
+func pkgUiTemplatesActive_queriesHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_pkgUiTemplatesActive_queriesHtml,
+		"pkg/ui/templates/active_queries.html",
+	)
+}
+
+func pkgUiTemplatesActive_queriesHtml() (*asset, error) {
+	bytes, err := pkgUiTemplatesActive_queriesHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "pkg/ui/templates/active_queries.html", size: 1108, mode: os.FileMode(420), modTime: time.Unix(1791975647, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _pkgUiTemplatesAlertsHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xcc\x58\x5b\x6f\xdb\x36\x14\x7e\xcf\xaf\x38\x50\xfb\xb0\x02\x93\x85\x2c\xed\xc3\x1c\xd9\x43\x50\xa0\xdb\x80\xb6\x2b\x9a\x34\xaf\x01\x25\x1e\x5b\x6c\x18\x92\x23\x29\xc7\x9e\xa6\xff\x3e\x90\x94\x7c\x51\xe5\x9b\x0a\x6c\x73\x00\x41\x22\x79\x2e\xdf\xb9\x33\x55\x45\x71\xc6\x04\x42\x54\x20\xa1\x51\x5d\x5f\x00\x00\xa4\x9c\x89\x47\xb0\x2b\x85\x93\xc8\xe2\xd2\x26\xb9\x31\x11\x68\xe4\x93\xc8\xd8\x15\x47\x53\x20\xda\x08\x0a\x8d\xb3\x49\x54\x55\xa0\x88\x2d\x3e\x69\x9c\xb1\x25\xd4\x75\x62\x2c\xb1\x2c\x77\x34\x09\xe1\xa8\xad\x19\xe5\xc6\xfc\xb2\x98\x54\x15\x64\x25\xe3\xf4\x1e\xb5\x61\x52\x40\x5d\x47\xd3\x20\xce\xe4\x9a\x29\x0b\x46\xe7\xfb\xd9\x7d\x5d\x73\xfb\xba\x8f\x59\x9a\x04\x46\xd3\x8b\xaa\x42\x41\xeb\xfa\xe2\x62\x83\x2f\x97\xc2\xa2\xb0\x6b\x88\x94\x2d\x20\xe7\xc4\x98\x89\xdf\x22\x4c\xa0\x8e\x67\xbc\x64\xb4\xd1\xca\x9f\x2a\x2e\xa7\x37\x5e\x6a\x9a\x14\x97\x5b\xeb\x8e\x9a\xd1\x49\xe4\x55\x7a\xc7\xb8\x45\x6d\xa2\x96\x5f\x66\x45\x3c\xd7\xb2\x54\xb0\x7e\x8b\xad\x9c\xcf\x39\x46\x40\x89\x25\xcd\xc7\x24\xca\x4a\x6b\xa5\x30\x5b\x02\x83\xf5\x49\x86\x7c\x8b\x99\x67\xa3\x34\x7b\x22\x7a\x05\x24\xb7\x6c\x81\x1d\x12\x4f\xc6\x84\x2a\x6d\xe3\xb5\xbc\xc0\xfc\x31\x93\xcb\x08\x04\x79\xc2\xae\x9e\x4e\x73\x26\x02\xa7\x00\x2f\x02\x52\x5a\x99\xcb\x27\xc5\xd1\xe2\x24\x92\xb3\x59\x34\x85\xdf\x9b\x33\xf0\x43\x55\xc1\xe8\xad\x2c\x85\x35\xa3\xf5\x62\x5d\xbf\xda\xd5\x3b\xf1\x8a\xff\x17\x60\x14\x0a\xca\xc4\xfc\x10\x96\x4f\xe1\xc8\x0e\x94\x76\xed\x7f\x84\x64\xc6\xf4\x11\x20\xef\xfc\x89\x1d\x1c\xcd\xd2\x69\x30\x92\x4c\x6f\x05\x72\x42\xd9\xa2\x13\xd7\x0d\x42\x53\xc8\xe7\x98\x08\x21\x5d\xfe\xf5\x44\x29\x6b\x0f\xce\xf9\x4a\x15\x2c\x97\x02\xd6\x6f\x71\x29\x3c\x54\xa4\x2e\x2b\x59\x87\x32\x84\x7d\x63\x92\xf0\x11\xed\x95\x0a\x96\x59\x97\x2b\x6e\x03\x76\xd4\xb9\xed\xac\xa4\x49\xe0\xb5\x1f\x9d\x25\x19\xc7\x4d\xde\x9a\x3b\xf7\xbd\x16\x1d\x76\xfd\x33\xce\xa4\xa6\xa8\x91\x36\x9f\xb9\xe4\x9c\x28\x83\xb4\x6b\x04\x9b\x49\xba\xda\x5d\xab\xaa\x97\x9e\xfb\xad\x25\x16\xef\xe4\x67\xf9\xfc\xd6\xf1\x87\xf1\x04\x46\x37\x3d\x1b\x4d\x41\xda\x90\x6b\x22\xe6\x08\xa3\x5f\x5d\xdd\xe8\xee\x06\xa1\xfa\xdb\x30\x0b\x1b\x14\x7c\x7d\x9e\x44\x8a\x50\x17\xd9\x63\xf8\x49\x2d\x7b\x82\x72\x23\x6c\xf4\x87\x66\x73\x26\x08\x7f\xc7\x38\xd6\x35\x4c\xdd\xda\x47\xf2\x84\x3d\x82\x83\x49\x2d\xed\x09\xf2\xa4\x4f\xa7\x35\x14\x0f\x9b\x89\xf9\xe7\x92\x63\x1f\xa2\xd6\x6c\x5b\x05\x29\x98\x6b\x6b\x61\x9f\x3e\x56\xb7\xfe\xf3\x56\x07\xff\x8c\xab\x8a\x09\x8a\x4b\xe8\x77\xc5\xc8\x2f\xd4\x75\x38\xfc\xe0\x5a\x1f\xea\x03\x66\x4a\x2d\x9d\x6e\xe2\xdd\x07\x78\x5e\xe0\x42\x4b\x11\x53\xf9\x2c\x42\x8c\x43\x9a\x4d\xd7\xb6\x4b\x93\x6c\xea\x52\x94\xa3\x80\x1d\x5c\x4e\xa8\xff\x7c\xd5\x6f\xc9\xfd\xd6\xec\x43\xfb\x40\xd1\x12\xc6\xbb\xb9\xd9\xd5\x7d\xef\x26\x34\x39\x7f\xf8\x84\x3f\xa5\x34\xb6\xc1\x45\x99\x51\x9c\xac\xc6\x19\x97\xf9\xe3\x35\xb4\xb1\xf6\xf3\xe8\x8d\x5a\x5e\xc3\x4c\x0a\x1b\x1b\xf6\x17\x8e\x2f\xaf\xdc\x77\x2e\xb9\xd4\xe3\x17\x57\x57\x57\xd7\xf0\x2c\x35\x8d\x33\x8d\xe4\x71\xec\x9f\x31\xe1\xfc\x1a\x32\x92\x3f\xba\x2e\x29\x68\xdc\x1c\x9e\xbd\x71\x7f\xd7\x10\xd2\x70\x7c\xa9\x96\x60\x24\x67\x14\x5e\xe4\x79\xde\x2e\xc7\x9a\x50\x56\x9a\xf1\x6b\xb5\xbc\x8e\x60\x9a\xe6\x92\xa2\xf3\xc0\x6f\x77\x1f\xde\xdf\x0a\xa6\x14\x5a\xf8\xb3\x44\xbd\xfa\xf2\xf9\xbd\xf3\x88\xdf\x4f\x13\xa5\xf1\x88\x41\x92\xa3\x16\xa9\x2a\x36\xeb\xfa\xf5\xb8\x09\x43\x81\x39\x5e\x6d\x0a\xb9\x40\xdd\xbc\x9b\xa7\x26\x48\x91\xe3\x13\x0a\x6b\x1e\xfc\xfa\x01\x87\xef\x8a\x5c\xc7\xcb\x89\x14\x81\xaa\x98\xbe\x77\x9d\xc3\xa4\x89\x2d\xce\xa3\xf3\x99\x75\x3e\x59\xc8\x74\xb8\x65\x22\x1f\x40\x7d\x4f\x78\x79\x06\xd9\xfe\xfc\xea\xfe\xda\x0a\x76\xae\xab\x37\xca\x9d\x28\x68\x43\x70\x24\x5b\x0f\x6a\xe9\xdb\xfd\x8f\xf0\x72\xe1\xec\xe1\x2b\x68\x70\xe3\xe8\x03\x51\x67\x68\xbd\xa3\x90\x51\x44\xac\x87\x1e\x42\xe7\x08\xfe\xd9\x0e\x3e\xd1\xb4\xaa\x82\xdc\xba\x76\xc3\x7b\x90\x5d\xd7\x51\x9a\x38\xca\x21\x60\xc2\xe8\x7e\x96\x92\x7b\x4b\xe9\x5e\x0a\x57\xd1\xb7\xa1\xed\x36\x8f\xa6\x43\xc0\xdf\xb0\xdd\x3f\x42\xf3\xa8\x6b\x70\x57\x12\x7c\x60\x82\xb2\x9c\x58\xa9\xc1\xdd\x91\xe2\x52\x29\xd4\x39\x31\xe8\x4c\xd2\x76\x98\xc6\x0a\xc3\x14\xac\xaa\xb6\x03\xda\xd1\x97\xbb\xb7\x8e\xdb\x40\x36\xf7\xc1\x29\xe7\xd1\x9f\x9e\x26\xe0\xfd\x06\x6c\x06\xa3\x9b\xcd\x3c\x36\x20\xea\x5c\xbd\xea\x34\x19\x21\xc5\x66\x44\x0b\xa5\x70\xff\x50\x7a\x9a\x8c\xc2\xf5\x24\xe7\x97\x49\xf4\x3a\x9a\xde\x6c\x4f\x90\xe7\x54\x1e\x38\xdb\x46\xff\x1e\x44\xba\x03\x71\x58\xe6\x53\x3e\x8c\x10\x0e\x97\xa4\xef\x8b\x90\x6f\xb5\xb4\x5b\x15\x28\x4d\xa8\x1d\xae\x74\xe0\xe7\x12\xa6\xad\x62\x69\x42\x07\xd4\xe3\xf6\x37\xa4\x94\xad\xf5\x48\x86\x98\x7f\x40\x81\x38\x33\xc9\x4f\x47\x74\xea\xd9\x34\xf1\x13\xcd\xb1\x81\xeb\x30\xb3\x73\x87\xe9\x3e\x7e\x55\x85\xdc\xf4\xdd\x7b\x0e\x5d\xb8\xf6\xab\xfd\x51\x86\xe6\xe1\x6e\xe6\xda\x5d\x7c\x20\xfc\x2b\x8a\x7e\xd7\xbd\xaa\x4f\xf1\x34\xe9\x5c\x43\x77\x4c\xda\x8c\xb3\x2d\xe1\x3f\x01\x00\x00\xff\xff\x78\x1e\x88\x4d\xf2\x13\x00\x00")
 
 func pkgUiTemplatesAlertsHtmlBytes() ([]byte, error) {
@@ -236,6 +258,26 @@ func pkgUiTemplatesBucket_menuHtml() (*asset, error) {
 	return a, nil
 }
 
+var _pkgUiTemplatesCompactionsHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xed\x56\x4d\x6f\xdb\x30\x0c\xbd\xf7\x57\x08\x46\x8f\x8b\x33\x6c\xb7\x21\x31\xd0\x2d\xfb\x28\xb0\x0e\x43\x3f\x2e\xbb\x0c\x8c\xc5\x24\x42\x6d\xc9\x93\xe5\x34\x81\xe1\xff\x3e\x4a\xb2\x12\x27\x73\x9a\xae\xeb\xb0\x1d\x9a\x83\x61\x8a\xe4\x23\x45\xbe\x97\xa4\xae\x39\xce\x84\x44\x16\x2d\x10\x78\xd4\x34\x27\x8c\x3e\xa3\x1c\x0d\xb0\x85\x31\xc5\x00\x7f\x54\x62\x39\x8e\x34\xce\x34\x96\x8b\x88\xa5\x4a\x1a\x94\x66\x1c\xbd\x7e\x19\x0d\x93\x93\xba\x46\xc9\x29\x8b\x5e\x02\x50\x1b\x61\xb1\x46\x5c\x2c\x59\x9a\x41\x59\x8e\xdd\x31\x50\x80\x1e\xcc\xb2\x4a\xf0\x28\x71\x95\xea\x5a\xcc\x58\x7c\xe9\xd1\x91\x9f\x99\xf8\xbc\xfc\x86\x5a\x85\x46\x3a\x00\x90\xa1\x36\xcc\x3d\x07\x42\xce\x54\xc4\xb4\xca\xb0\x3d\x8f\x92\x77\x2a\x2f\x20\x35\x42\xc9\x92\xdd\xa1\x46\x26\x95\x61\x45\x06\x52\x22\x67\x6b\x34\xf1\x68\x48\x60\xa1\x2a\x66\x25\x86\x1a\x45\xa8\x60\x70\x65\x06\x79\x65\x90\xba\xfb\xda\x66\xd6\x75\x29\x64\x8a\x3b\x3d\x36\x0d\x83\xb9\x22\xc0\x62\x03\xe7\x87\xb0\xbd\xd1\x27\xc8\x08\x26\x54\x58\xbc\x4a\xfc\x01\xfb\xa8\x55\x55\x94\xa3\x21\x9d\x78\x97\x81\x69\x86\x9b\x06\x9c\xe1\x9e\x83\xa9\xd2\x9c\xae\x11\x06\xe5\x83\xed\x92\xba\xb6\xde\x1a\x6d\x40\xe2\x2a\x8c\x86\xf4\xf6\x8b\xcb\xf7\xd0\xef\xbb\x44\x28\x95\xdc\xf5\x91\xa5\x77\xac\xfd\xf2\x53\xc5\xd7\x5b\xbb\xae\x35\xc8\x39\xb2\xd3\x05\x7b\x33\xde\x1b\xc1\x81\x76\x79\x52\xd7\xa7\x8b\xd8\xf5\xdc\x34\x54\x81\xf7\x45\xf8\x0d\x50\x9c\x87\x0c\x0b\xe8\x0f\x1f\x95\x05\xc8\x3e\xce\x70\xdb\x9c\x66\xa5\x01\x83\xdf\x85\xe4\x22\x05\xa3\x74\xe4\x3b\xf0\xd7\xb7\x2d\xd8\xf4\x64\x17\x7a\x77\x0e\x61\xdb\x1d\xef\x76\x0e\x64\xd8\xed\xf5\xf0\xc2\x92\xe0\xb2\x92\x52\xc8\x39\xeb\x70\xf5\x1f\x51\xe1\x33\x4c\x49\x02\xfd\xbe\xb7\x99\x4a\x6f\x0f\xf8\x2e\x84\x64\xd7\x22\xc7\x03\x5e\x58\xdd\xe3\xbd\x82\xbc\xc8\xf0\x00\xf0\x95\x01\x7d\x90\x9c\xef\xaf\xcf\x9e\x86\x99\xa9\x63\x66\xbb\x86\x07\x50\x33\x3d\x46\xcd\x16\x57\x42\x8e\x2f\xd8\xe9\x12\xb2\x0a\x6d\x09\x4a\xf4\x13\xa6\xcc\x2e\x1f\xa7\xc0\x29\xdc\x3d\x07\x85\x16\x39\xe8\xb5\x23\xa0\xcd\x6f\x9a\x71\x44\xaf\x0e\xa3\x69\xa2\x96\x89\x81\x44\x47\x1a\x10\xbc\x2d\xeb\x97\xd7\x34\x84\x24\x6c\xda\x54\x0f\x93\x23\x10\x33\xa5\x73\x30\x76\x6f\xa4\x8d\xbc\xb0\x28\xb4\x66\x6b\xff\x5e\x0e\xac\xee\xcf\xa1\x98\x2f\x55\xde\xb2\xe0\xa8\xda\xd3\xb8\xa5\xc4\xfd\x72\x77\x5f\xb7\x14\x4c\x14\xb1\x97\xde\xf6\xd5\x39\xf4\x5f\xf6\x95\xbc\x95\xea\x4e\xf6\x0e\xe3\x31\x0a\xdf\xa8\x3a\xfc\x54\x3c\xab\xfa\x89\xf4\xd9\x0e\xf4\x59\x9f\xff\x91\x3e\xff\x48\x21\xfe\xd2\xec\x02\xf4\x2d\xe9\x84\x7a\x63\x13\xcc\xd0\x2a\xe5\x6f\x0a\xc5\x55\x3d\x44\x69\xdb\x49\xbf\x6f\x42\xff\x7d\xc5\xbe\x8a\x1e\x4b\xe8\xdc\x11\xda\x97\xfb\xa0\x74\xb8\xf6\x03\xa8\x9d\xc7\xe7\x93\x63\xfb\xbd\x91\x62\x45\x35\xe2\x00\x7b\x64\xbf\x36\xd0\xdd\xed\x29\x96\xdb\xfe\x9d\x0e\xc1\x3f\x01\xee\xf7\x98\x7c\x49\x0c\x00\x00")
+
+func pkgUiTemplatesCompactionsHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_pkgUiTemplatesCompactionsHtml,
+		"pkg/ui/templates/compactions.html",
+	)
+}
+
+func pkgUiTemplatesCompactionsHtml() (*asset, error) {
+	bytes, err := pkgUiTemplatesCompactionsHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "pkg/ui/templates/compactions.html", size: 3145, mode: os.FileMode(420), modTime: time.Unix(1791973739, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _pkgUiTemplatesGraphHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xbc\x55\x3d\x73\xdb\x30\x0c\xdd\xf3\x2b\x58\xee\xb4\x86\xac\x96\x7b\x1d\x7a\x5d\x3b\x75\xcd\x51\x24\x1c\xc2\xa6\x48\x95\x00\x95\x28\x3a\xfd\xf7\x9e\x64\x59\x75\xd3\xa6\x75\xda\xa8\x8b\xcd\x0f\x00\xef\x01\x0f\x22\xfa\xde\xc2\x1e\x03\x08\xe9\x40\x5b\x39\x0c\x37\x42\x08\xb1\xf5\x18\x8e\x82\xbb\x06\x4a\xc9\xf0\xc8\x85\x21\x92\x22\x81\x2f\x25\x71\xe7\x81\x1c\x00\x4b\xe1\x12\xec\x4b\xd9\xf7\xa2\xd1\xec\x3e\x27\xd8\xe3\xa3\x18\x86\x82\x58\x33\x9a\xa2\x85\x60\x63\x2a\x12\x9a\x23\x39\xfd\xb0\x2c\x36\x35\x86\x8d\x21\x7a\xdf\x96\x7d\x2f\xaa\x8c\xde\x7e\x81\x44\x18\x83\x18\x06\xb9\x7b\x73\x02\x10\x83\x26\xab\x83\xaa\x62\x64\xe2\xa4\x1b\x65\x35\x03\x63\x0d\x0d\x9a\x23\xa4\xe2\xa5\x8b\x3f\x31\x3d\x51\x25\x93\xb0\x61\x41\xc9\x5c\x5f\x8b\x79\x6f\x6f\x37\xed\xed\xe6\xf0\x12\xc0\xb6\x38\xc5\xde\xbd\x05\x90\xd7\x5d\xcc\x3c\xa5\xb4\x26\xe0\x0f\x2a\xaf\x00\x54\xc7\x1a\x02\xcf\x7f\xff\x05\x44\x8d\x0d\xf1\x14\x03\xa8\x07\x64\x37\xb6\x88\x5e\x0b\xf7\x1f\x5b\x75\x05\x46\x0b\xde\xad\x1a\xbf\x46\x3d\xbe\x12\xbf\x3c\x5c\x8b\xc0\x3e\x3f\x3d\x75\xa7\xdf\x6b\xc2\xbf\x5e\xea\x4c\xac\x8d\x83\x65\xb1\x56\x22\x07\x2a\x0e\x5f\x33\xa4\x6e\x43\xe0\xc1\x30\xc6\xeb\x61\xde\x29\xf5\x97\x58\x2e\xf2\x11\x3a\xba\x02\x49\x28\xf5\x9a\xf2\x1d\xa8\xb8\x4f\xba\x71\xaf\x16\x05\x6d\x29\x27\xcf\x3b\x86\xba\xf1\x9a\x41\x5e\x3e\xf4\x8f\xca\xe9\x60\x3d\x54\x3a\x91\x5a\x2c\x7e\x0a\xf6\x16\xf3\xc1\xd0\x39\x87\xdf\xbc\xf1\x7d\x0f\xc1\x0e\xc3\xcd\xcd\xf7\x49\x69\x62\x60\x08\xbc\x0c\x4b\x8b\xed\x45\x56\xe3\xad\xc6\x00\x49\x0a\xe3\x35\x51\x29\x97\x13\xb5\xf7\x19\xed\x3c\xe2\x16\xd7\xd9\x6a\xd2\x4b\x39\x24\x8e\xa9\xbb\xb0\x99\xec\xf0\x6c\x75\xef\xbb\xc6\xa1\x89\x41\x2c\x2b\x95\x83\x71\x60\x8e\x60\xc7\x32\xe1\x33\xcf\x2a\x33\xc7\x30\x97\xea\xb4\x59\x88\x11\xe8\x64\xdc\x82\x29\x18\xd9\xc3\xf9\x58\x34\x09\x5a\x8c\x99\xc4\xc8\x0c\x81\xe4\xee\x63\xd0\x95\x87\x69\xdf\x89\xd9\x6b\x5b\x9c\x82\x5e\x24\x55\x58\x6c\xe7\xc6\xbd\x58\x5e\xa4\xfa\x52\x41\x46\x9b\xdd\x16\x43\x93\xf9\x6c\x5a\x71\x10\x15\x07\xd5\x24\xac\xf5\xc4\x71\x4a\x84\x72\x55\x23\x4b\xd1\x6a\x9f\xa1\x94\x1f\xac\x15\x9f\xc6\xea\xcb\x49\x08\x6d\xed\xdd\x24\xc6\x58\x90\xe7\x64\xce\x82\x7e\x0b\x00\x00\xff\xff\x63\x47\x06\xde\xfa\x08\x00\x00")
 
 func pkgUiTemplatesGraphHtmlBytes() ([]byte, error) {
@@ -256,7 +298,7 @@ func pkgUiTemplatesGraphHtml() (*asset, error) {
 	return a, nil
 }
 
-var _pkgUiTemplatesQuery_menuHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb4\x54\x31\x6f\xdc\x3c\x0c\xdd\xf3\x2b\x08\x05\xf8\x36\x47\xfb\xd7\xb3\x87\x2e\x6d\x96\xa2\x68\xd2\xb9\xa0\x4f\xb4\x2d\x44\x96\x04\x89\xbe\xa4\x30\xfc\xdf\x0b\xe9\xee\x8c\xb3\xef\x1c\x20\x43\x26\x81\x04\xf9\xf8\x9e\xf8\xa4\x71\x54\xd4\x68\x4b\x20\x2c\x1e\xc4\x34\xdd\x01\x00\xec\x2c\x1e\x60\x6f\x30\xc6\x32\xa5\x6b\x0c\xd0\xe8\x37\x52\x05\x3b\x0f\xc7\x44\x41\x6f\x1e\xad\x2a\x62\x7f\x4e\x28\x0c\x2f\x50\xb7\xf9\x14\x55\xc6\xc9\x58\x4a\xcf\x58\x7b\x67\x19\xb5\xa5\x50\x34\x66\xd0\xea\xa2\x2a\x57\xd6\x03\xb3\xb3\xc0\x7f\x3d\x95\xe2\x18\x88\x25\x8d\x82\x5d\xdb\x1a\x0a\x02\x14\x32\x9e\xa2\x84\x6b\x0c\xfa\x48\xe7\x34\x86\x96\xb8\x14\xf7\x16\x0f\x45\x9a\x49\x96\x05\x60\xd0\x78\x62\x4d\xaa\x14\x0d\x9a\xd4\x90\xb3\xa9\x26\x38\x73\x1c\xb3\xea\x30\x58\x93\x29\xc5\x73\x1e\x95\xb4\xea\x16\x59\x3b\xbb\x22\x9f\x05\x44\x8f\xf6\x36\xe1\x42\xef\x53\xcb\x4e\xa6\x92\x95\x6c\x79\x94\xba\xca\xe2\x0a\xa8\x0e\x68\x95\x80\x2e\x50\x53\x8a\x71\x04\x8f\xdc\xfd\x0c\xd4\xe8\x37\x98\x26\x29\xaa\xe7\x0e\xad\x8b\x3b\x89\x2b\x9c\x74\xfd\x5a\xad\x94\x2d\xa1\xcf\xd7\x07\xf3\x3d\xde\xd0\x36\x98\x55\x57\xf2\xcb\x75\x5d\xae\x35\xfa\xa2\xb6\xd0\x4c\xbd\xa8\x16\x82\x0a\xa3\xed\xcb\xa6\x98\x36\xa0\xef\x44\xf5\x2d\x1d\x49\xd0\x4e\x1a\xfd\x39\x93\x22\xbb\x40\x51\x54\x4f\xf9\xfc\xf0\x2c\x50\xc1\x79\xe5\x5e\x6f\x99\xe1\x62\x91\xc7\xe1\xf7\x62\x4d\x6b\x6e\x3f\xb9\x64\xe5\xea\x19\x1c\x82\x33\x17\x2f\x22\xdb\xb2\xc3\xe8\x9d\x1f\x7c\x29\x38\x0c\xb4\xe1\xee\xea\x89\x91\x87\xb8\x34\xe6\x1e\x03\xf1\x6c\xc5\x2b\xc3\x5c\x99\xe7\xd4\x36\x73\xed\xc9\x0e\xef\xe8\x85\x85\x79\xe7\xae\xbc\x9a\xed\x35\x24\x9a\xa2\xfa\x35\x58\xd6\x3d\xc1\x7f\xd8\xfb\x2f\xf0\x75\xd0\x46\xc1\xa3\x6d\x5c\xe8\xf3\x93\x7b\x9f\xab\x54\xfa\xb0\xb1\xb9\x8f\xf9\xe7\xbd\x55\x6e\x18\xab\x63\xf6\xf1\x7f\x29\x39\x3f\xc2\x07\xed\x24\x6b\x7f\x8a\x64\x4b\xcc\xda\xb6\x45\x64\x0c\x4c\xea\xa1\x57\x52\xc0\xf9\x8f\xfa\x53\x1b\xb4\x2f\xa2\xfa\x4e\xc6\x6f\xea\xfb\x7c\x01\x57\x2b\xb1\xf4\x7a\x83\xe5\x0f\x7a\x85\xdf\x8f\x1f\xe4\xb9\x93\x83\x59\x7f\x79\x8b\x5d\x5d\x84\x3b\x69\xf1\x50\xdd\x8d\x23\x59\x35\x4d\x77\xff\x02\x00\x00\xff\xff\x17\x81\x2e\xcf\x9e\x06\x00\x00")
+var _pkgUiTemplatesQuery_menuHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb5\x55\x4d\x8f\x9b\x30\x10\xbd\xef\xaf\xb0\xbc\x52\x6f\xac\xef\x2d\x20\xb5\x97\xed\x5e\xaa\x7e\x6c\xcf\xab\x21\x1e\xc0\x5a\x63\x5c\x33\x6c\x52\xa1\xfc\xf7\xda\x86\xa0\x84\x84\x48\xa9\xb4\xb9\x38\x33\x9a\x8f\xf7\x66\x9e\xcd\x30\x48\x2c\x95\x41\xc6\x0d\xbc\xf1\xfd\xfe\x8e\xf9\x5f\xea\xff\xb3\x8d\x86\xae\xcb\x82\xbb\x00\xc7\x4a\xb5\x43\x99\x50\x6b\xd9\xe8\x48\x70\x67\xc1\xc8\xa4\x6b\x0e\x0e\x09\xee\x95\x15\x55\x3c\x79\x1e\xeb\xc4\x5a\x52\xcd\xb5\x36\xad\x21\xf0\xcd\x5c\x52\xea\x5e\xc9\xa3\xa8\x18\x59\xf4\x44\xad\x61\xf4\xd7\x62\xc6\x47\x83\x9f\xc2\xf0\x00\xaa\x4a\xa3\xe3\x4c\x02\xc1\x64\x85\xba\x5a\x83\xed\xf0\xe0\x06\x57\x21\x65\xfc\xde\x27\x25\xa1\x27\x1a\xe2\x0c\x9c\x82\x09\x35\xca\x8c\x97\xa0\x43\x42\xf4\x86\x18\xd7\xea\xb1\xcd\x22\x43\x43\x81\x3a\xe3\xcf\xb1\x55\xe0\xaa\x2a\x20\xe5\x91\x9d\x82\x8f\x04\x3a\x5f\xfc\x32\xe0\x44\x6d\x42\x4a\x2a\x42\xc8\x82\xb6\x18\xa9\x2e\xbc\xb0\x28\x54\x38\x0f\x9c\xb3\xda\x61\x99\xf1\x61\x60\x16\xa8\xfe\xee\x0d\xb5\x63\xfb\xbd\xe0\xf9\x73\x0d\xa6\xed\x52\x01\x8b\x3a\x61\xfc\x4a\x2e\x98\x9d\x96\x3e\x8c\x8f\xcd\x73\xbc\xc0\xad\xd7\x8b\xac\xa0\x97\xf3\xb8\x18\xab\xd5\x51\x6c\xa2\x08\x1b\x4f\xfd\x98\x50\xa2\x95\x79\x5d\x25\x53\x39\xb0\x35\xcf\x1f\xc3\x11\x08\xa5\x42\xab\xf7\xe9\xd4\x51\xeb\xb0\xe3\xf9\xaf\x78\xde\xdc\x8b\x49\xd7\x5a\xd9\x6e\x2f\x89\xe1\x68\x91\x63\xf3\x7b\xbe\x84\x35\xa7\x4f\x2a\x59\xa8\x7a\x2e\xce\xbc\x36\x8f\x6e\x44\x94\x65\x0d\x9d\x6d\x6d\x6f\x33\x4e\xae\xc7\x15\x75\x7b\x5e\x40\x7d\x77\x2a\xcc\x0d\x38\xa4\x59\x8a\x67\x82\x39\x13\xcf\x94\x36\x63\x6d\xd0\xf4\x57\xf8\x4e\x9c\x97\x59\x71\x35\xeb\x6b\x08\x30\x79\xfe\xb3\x37\xa4\x1a\x64\x1f\xa0\xb1\x9f\xd8\x97\x5e\x69\xc9\x9e\x4c\xd9\xba\x26\x5e\xb9\xab\x58\xff\xa7\x2f\x6c\x48\xbd\xe1\xcb\x9f\x1e\x9d\x0a\x32\xf8\x1c\x6d\xf6\x63\xb4\xaf\x8f\x46\xf8\xd9\xac\x08\xe5\x36\xb9\x5e\x53\xce\x8a\x8e\x6b\x22\xdb\x7d\x14\x82\xe2\x9d\x7f\x50\xad\x20\x65\x27\x4b\xf8\xa7\x8f\x94\xa9\x12\x3f\x54\x47\x28\x1f\x1a\x29\x38\x3b\x3c\x89\x2f\x85\x06\x5f\x27\xff\x8a\xda\xae\xf2\x7b\x7f\x02\x67\x9b\x30\xb8\xbd\x80\xf2\x1b\x6e\xd9\xef\xa7\x1b\x71\xa6\xa2\xd7\xcb\x17\xf6\x64\x57\x47\x66\x2a\x3c\xb2\xfc\x6e\x18\xd0\x48\xff\xed\xfb\x07\x5e\x0a\x12\x8a\x0d\x07\x00\x00")
 
 func pkgUiTemplatesQuery_menuHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -271,7 +313,7 @@ func pkgUiTemplatesQuery_menuHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "pkg/ui/templates/query_menu.html", size: 1694, mode: os.FileMode(420), modTime: time.Unix(1603912614, 0)}
+	info := bindataFileInfo{name: "pkg/ui/templates/query_menu.html", size: 1805, mode: os.FileMode(420), modTime: time.Unix(1791975647, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -1809,9 +1851,11 @@ func AssetNames() []string {
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
 	"pkg/ui/templates/_base.html":                                                                    pkgUiTemplates_baseHtml,
+	"pkg/ui/templates/active_queries.html":                                                           pkgUiTemplatesActive_queriesHtml,
 	"pkg/ui/templates/alerts.html":                                                                   pkgUiTemplatesAlertsHtml,
 	"pkg/ui/templates/bucket.html":                                                                   pkgUiTemplatesBucketHtml,
 	"pkg/ui/templates/bucket_menu.html":                                                              pkgUiTemplatesBucket_menuHtml,
+	"pkg/ui/templates/compactions.html":                                                              pkgUiTemplatesCompactionsHtml,
 	"pkg/ui/templates/graph.html":                                                                    pkgUiTemplatesGraphHtml,
 	"pkg/ui/templates/query_menu.html":                                                               pkgUiTemplatesQuery_menuHtml,
 	"pkg/ui/templates/rule_menu.html":                                                                pkgUiTemplatesRule_menuHtml,
@@ -2056,16 +2100,18 @@ var _bintree = &bintree{nil, map[string]*bintree{
 				}},
 			}},
 			"templates": {nil, map[string]*bintree{
-				"_base.html":       {pkgUiTemplates_baseHtml, map[string]*bintree{}},
-				"alerts.html":      {pkgUiTemplatesAlertsHtml, map[string]*bintree{}},
-				"bucket.html":      {pkgUiTemplatesBucketHtml, map[string]*bintree{}},
-				"bucket_menu.html": {pkgUiTemplatesBucket_menuHtml, map[string]*bintree{}},
-				"graph.html":       {pkgUiTemplatesGraphHtml, map[string]*bintree{}},
-				"query_menu.html":  {pkgUiTemplatesQuery_menuHtml, map[string]*bintree{}},
-				"rule_menu.html":   {pkgUiTemplatesRule_menuHtml, map[string]*bintree{}},
-				"rules.html":       {pkgUiTemplatesRulesHtml, map[string]*bintree{}},
-				"status.html":      {pkgUiTemplatesStatusHtml, map[string]*bintree{}},
-				"stores.html":      {pkgUiTemplatesStoresHtml, map[string]*bintree{}},
+				"_base.html":          {pkgUiTemplates_baseHtml, map[string]*bintree{}},
+				"active_queries.html": {pkgUiTemplatesActive_queriesHtml, map[string]*bintree{}},
+				"alerts.html":         {pkgUiTemplatesAlertsHtml, map[string]*bintree{}},
+				"bucket.html":         {pkgUiTemplatesBucketHtml, map[string]*bintree{}},
+				"bucket_menu.html":    {pkgUiTemplatesBucket_menuHtml, map[string]*bintree{}},
+				"compactions.html":    {pkgUiTemplatesCompactionsHtml, map[string]*bintree{}},
+				"graph.html":          {pkgUiTemplatesGraphHtml, map[string]*bintree{}},
+				"query_menu.html":     {pkgUiTemplatesQuery_menuHtml, map[string]*bintree{}},
+				"rule_menu.html":      {pkgUiTemplatesRule_menuHtml, map[string]*bintree{}},
+				"rules.html":          {pkgUiTemplatesRulesHtml, map[string]*bintree{}},
+				"status.html":         {pkgUiTemplatesStatusHtml, map[string]*bintree{}},
+				"stores.html":         {pkgUiTemplatesStoresHtml, map[string]*bintree{}},
 			}},
 		}},
 	}},
@@ -0,0 +1,58 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package ui
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/route"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/component"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+)
+
+// Compactions is a web UI representing the state of the compactions of a compactor.
+type Compactions struct {
+	*BaseUI
+
+	externalPrefix, prefixHeader string
+	uiPrefix                     string
+	tracker                      *compact.StatusTracker
+}
+
+func NewCompactionsUI(logger log.Logger, externalPrefix, prefixHeader, uiPrefix string, tracker *compact.StatusTracker) *Compactions {
+	funcs := queryTmplFuncs()
+	funcs["formatUnix"] = func(timestamp int64) string {
+		return time.Unix(timestamp, 0).Format(time.RFC3339)
+	}
+	funcs["formatTime"] = func(t *time.Time) string {
+		return t.Format(time.RFC3339)
+	}
+
+	return &Compactions{
+		BaseUI:         NewBaseUI(log.With(logger, "component", "compactionsUI"), "bucket_menu.html", funcs, nil, externalPrefix, prefixHeader, component.Compact),
+		externalPrefix: externalPrefix,
+		prefixHeader:   prefixHeader,
+		uiPrefix:       uiPrefix,
+		tracker:        tracker,
+	}
+}
+
+// Register registers http routes for compactions UI.
+func (c *Compactions) Register(r *route.Router, ins extpromhttp.InstrumentationMiddleware) {
+	instrf := func(name string, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+		return ins.NewHandler(c.externalPrefix+name, http.HandlerFunc(next))
+	}
+	r.WithPrefix(c.uiPrefix).Get("/", instrf("compactions", c.root))
+	r.WithPrefix(c.uiPrefix).Get("/static/*filepath", instrf("compactions_static", c.serveStaticAsset))
+}
+
+// Handle / of compactions UI.
+func (c *Compactions) root(w http.ResponseWriter, r *http.Request) {
+	c.executeTemplate(w, "compactions.html", GetWebPrefix(c.logger, path.Join(c.externalPrefix, strings.TrimPrefix(c.uiPrefix, "/")), c.prefixHeader, r), c.tracker.Status())
+}
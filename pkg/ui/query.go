@@ -23,7 +23,9 @@ import (
 
 type Query struct {
 	*BaseUI
-	storeSet *query.StoreSet
+	storeSet      *query.StoreSet
+	activeQueries *query.ActiveQueries
+	tenancy       *query.Tenancy
 
 	externalPrefix, prefixHeader string
 
@@ -33,7 +35,7 @@ type Query struct {
 	now     func() model.Time
 }
 
-func NewQueryUI(logger log.Logger, storeSet *query.StoreSet, externalPrefix, prefixHeader string) *Query {
+func NewQueryUI(logger log.Logger, storeSet *query.StoreSet, activeQueries *query.ActiveQueries, tenancy *query.Tenancy, externalPrefix, prefixHeader string) *Query {
 	tmplVariables := map[string]string{
 		"Component": component.Query.String(),
 	}
@@ -42,6 +44,8 @@ func NewQueryUI(logger log.Logger, storeSet *query.StoreSet, externalPrefix, pre
 	return &Query{
 		BaseUI:         NewBaseUI(logger, "query_menu.html", queryTmplFuncs(), tmplVariables, externalPrefix, prefixHeader, component.Query),
 		storeSet:       storeSet,
+		activeQueries:  activeQueries,
+		tenancy:        tenancy,
 		externalPrefix: externalPrefix,
 		prefixHeader:   prefixHeader,
 		cwd:            runtimeInfo().CWD,
@@ -73,6 +77,7 @@ func (q *Query) Register(r *route.Router, ins extpromhttp.InstrumentationMiddlew
 	r.Get("/graph", instrf("graph", q.graph))
 	r.Get("/stores", instrf("stores", q.stores))
 	r.Get("/status", instrf("status", q.status))
+	r.Get("/active_queries", instrf("active_queries", q.active))
 
 	r.Get("/static/*filepath", instrf("static", q.serveStaticAsset))
 	// Make sure that "<path-prefix>/new" is redirected to "<path-prefix>/new/" and
@@ -146,3 +151,19 @@ func (q *Query) stores(w http.ResponseWriter, r *http.Request) {
 		Sources: sources,
 	})
 }
+
+func (q *Query) active(w http.ResponseWriter, r *http.Request) {
+	prefix := GetWebPrefix(q.logger, q.externalPrefix, q.prefixHeader, r)
+
+	if !q.tenancy.Enabled() {
+		q.executeTemplate(w, "active_queries.html", prefix, q.activeQueries.List())
+		return
+	}
+	// Only the queries of the tenant of the request are listed when tenancy is enforced.
+	tenant, err := q.tenancy.Tenant(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.executeTemplate(w, "active_queries.html", prefix, q.activeQueries.ListTenant(tenant))
+}
@@ -12,6 +12,7 @@ import { GraphTabContent } from './GraphTabContent';
 import DataTable from './DataTable';
 import TimeInput from './TimeInput';
 import QueryStatsView, { QueryStats } from './QueryStatsView';
+import QuerySourcesView, { SourceRange } from './QuerySourcesView';
 import { Store } from '../../thanos/pages/stores/store';
 import PathPrefixProps from '../../types/PathPrefixProps';
 import { QueryParams } from '../../types/types';
@@ -36,6 +37,8 @@ interface PanelState {
   error: string | null;
   stats: QueryStats | null;
   exprInputValue: string;
+  showSources: boolean;
+  sources: SourceRange[] | null;
 }
 
 export interface PanelOptions {
@@ -82,11 +85,14 @@ class Panel extends Component<PanelProps & PathPrefixProps, PanelState> {
       error: null,
       stats: null,
       exprInputValue: props.options.expr,
+      showSources: false,
+      sources: null,
     };
 
     this.handleChangeDeduplication = this.handleChangeDeduplication.bind(this);
     this.handleChangePartialResponse = this.handleChangePartialResponse.bind(this);
     this.handleStoreMatchChange = this.handleStoreMatchChange.bind(this);
+    this.handleChangeShowSources = this.handleChangeShowSources.bind(this);
   }
 
   componentDidUpdate({ options: prevOpts }: PanelProps) {
@@ -146,6 +152,10 @@ class Panel extends Component<PanelProps & PathPrefixProps, PanelState> {
       dedup: this.props.options.useDeduplication.toString(),
       partial_response: this.props.options.usePartialResponse.toString(),
     });
+    if (this.state.showSources) {
+      // The sources of the data are part of the query statistics.
+      params.append('stats', 'true');
+    }
 
     // Add storeMatches to query params.
     this.props.options.storeMatches?.forEach((store: Store) =>
@@ -204,6 +214,7 @@ class Panel extends Component<PanelProps & PathPrefixProps, PanelState> {
             resolution,
             resultSeries,
           },
+          sources: json.data?.stats?.store?.timeline || null,
           loading: false,
         });
         this.abortInFlightFetch = null;
@@ -273,6 +284,27 @@ class Panel extends Component<PanelProps & PathPrefixProps, PanelState> {
     this.setOptions({ storeMatches: selectedStores || [] });
   };
 
+  handleChangeShowSources = (event: React.ChangeEvent<HTMLInputElement>): void => {
+    this.setState({ showSources: event.target.checked }, this.executeQuery);
+  };
+
+  renderSources() {
+    const { showSources, loading, error, sources, lastQueryParams } = this.state;
+    if (!showSources || loading || error || !sources || !lastQueryParams) {
+      return null;
+    }
+    // Instant queries are evaluated at their end time.
+    const startTime = this.props.options.type === PanelType.Graph ? lastQueryParams.startTime : lastQueryParams.endTime;
+    return (
+      <QuerySourcesView
+        id={this.props.id}
+        startTime={startTime * 1000}
+        endTime={lastQueryParams.endTime * 1000}
+        timeline={sources}
+      />
+    );
+  }
+
   render() {
     const { pastQueries, metricNames, options, id, stores } = this.props;
     return (
@@ -313,6 +345,14 @@ class Panel extends Component<PanelProps & PathPrefixProps, PanelState> {
             >
               Use Partial Response
             </Checkbox>
+            <Checkbox
+              wrapperStyles={{ marginLeft: 20, display: 'inline-block' }}
+              id={`show-sources-checkbox-${id}`}
+              onChange={this.handleChangeShowSources}
+              defaultChecked={this.state.showSources}
+            >
+              Show Sources
+            </Checkbox>
           </Col>
         </Row>
         {stores?.length > 0 && (
@@ -355,6 +395,7 @@ class Panel extends Component<PanelProps & PathPrefixProps, PanelState> {
               </NavItem>
               {!this.state.loading && !this.state.error && this.state.stats && <QueryStatsView {...this.state.stats} />}
             </Nav>
+            {this.renderSources()}
             <TabContent activeTab={options.type}>
               <TabPane tabId="table">
                 {options.type === 'table' && (
@@ -0,0 +1,43 @@
+import * as React from 'react';
+import { shallow } from 'enzyme';
+import QuerySourcesView, { formatResolution, sourceRows } from './QuerySourcesView';
+
+describe('QuerySourcesView', () => {
+  const timeline = [
+    { minTime: 0, maxTime: 400, sources: [{ store: 'store-gateway', block: '5m', resolution: 300000 }] },
+    { minTime: 400, maxTime: 700, sources: [{ store: 'store-gateway', block: 'raw', resolution: 0 }] },
+    {
+      minTime: 700,
+      maxTime: 1000,
+      sources: [{ store: 'sidecar', resolution: 0 }, { store: 'store-gateway', block: 'raw', resolution: 0 }],
+    },
+  ];
+
+  it('formats resolutions', () => {
+    expect(formatResolution(0)).toEqual('raw');
+    expect(formatResolution(300000)).toEqual('5m');
+    expect(formatResolution(3600000)).toEqual('1h');
+  });
+
+  it('groups the timeline by source', () => {
+    expect(sourceRows(timeline)).toEqual({
+      'store-gateway 5m (5m)': [timeline[0]],
+      'store-gateway raw (raw)': [timeline[1], timeline[2]],
+      sidecar: [timeline[2]],
+    });
+  });
+
+  it('renders a bar per time range of each source', () => {
+    const view = shallow(<QuerySourcesView id="0" startTime={0} endTime={1000} timeline={timeline} />);
+    expect(view.find('.query-sources-row')).toHaveLength(3);
+    const bars = view.find('.query-sources-bar');
+    expect(bars).toHaveLength(4);
+    expect(bars.at(0).prop('style')).toEqual({ left: '0%', width: '40%' });
+    expect(bars.at(2).hasClass('overlap')).toBe(true);
+  });
+
+  it('renders a message without sources', () => {
+    const view = shallow(<QuerySourcesView id="0" startTime={0} endTime={1000} timeline={[]} />);
+    expect(view.text()).toEqual('No source contributed data to the query.');
+  });
+});
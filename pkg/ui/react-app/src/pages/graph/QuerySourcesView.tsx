@@ -0,0 +1,93 @@
+import React, { FC } from 'react';
+import { UncontrolledTooltip } from 'reactstrap';
+import './QuerySourcesView.css';
+
+export interface Source {
+  store: string;
+  block?: string;
+  resolution: number;
+}
+
+export interface SourceRange {
+  minTime: number;
+  maxTime: number;
+  sources: Source[];
+}
+
+export interface QuerySourcesProps {
+  id: string;
+  startTime: number; // Timestamp in milliseconds.
+  endTime: number; // Timestamp in milliseconds.
+  timeline: SourceRange[];
+}
+
+export const formatResolution = (resolution: number): string => {
+  if (resolution === 0) {
+    return 'raw';
+  }
+  if (resolution % 3600000 === 0) {
+    return `${resolution / 3600000}h`;
+  }
+  return `${resolution / 60000}m`;
+};
+
+export const sourceName = (source: Source): string =>
+  source.block ? `${source.store} ${source.block} (${formatResolution(source.resolution)})` : source.store;
+
+// sourceRows groups the time ranges of the timeline by source, in the order the sources first appear in it.
+export const sourceRows = (timeline: SourceRange[]): { [name: string]: SourceRange[] } => {
+  const rows: { [name: string]: SourceRange[] } = {};
+  timeline.forEach(r =>
+    r.sources.forEach(s => {
+      const name = sourceName(s);
+      rows[name] = [...(rows[name] || []), r];
+    })
+  );
+  return rows;
+};
+
+const QuerySourcesView: FC<QuerySourcesProps> = ({ id, startTime, endTime, timeline }) => {
+  if (timeline.length === 0) {
+    return <div className="query-sources">No source contributed data to the query.</div>;
+  }
+  // The selects of a query can look further back than its start, e.g. for the range vectors.
+  const from = Math.min(startTime, timeline[0].minTime);
+  const to = Math.max(endTime, timeline[timeline.length - 1].maxTime);
+  const span = Math.max(to - from, 1);
+  const position = (t: number): number => (t - from) / span;
+  const rows = sourceRows(timeline);
+
+  return (
+    <div className="query-sources">
+      {Object.keys(rows).map((name, i) => (
+        <div className="query-sources-row" key={name}>
+          <div className="query-sources-name">{name}</div>
+          <div className="query-sources-timeline">
+            {rows[name].map((r, j) => {
+              const barId = `query-sources-${id}-${i}-${j}`;
+              return (
+                <React.Fragment key={j}>
+                  <div
+                    id={barId}
+                    className={`query-sources-bar${r.sources.length > 1 ? ' overlap' : ''}`}
+                    style={{
+                      left: `${position(r.minTime) * 100}%`,
+                      width: `${Math.max(position(r.maxTime) - position(r.minTime), 0.002) * 100}%`,
+                    }}
+                  />
+                  <UncontrolledTooltip target={barId}>
+                    {new Date(r.minTime).toISOString()} - {new Date(r.maxTime).toISOString()}
+                    <br />
+                    {r.sources.map(sourceName).join(', ')}
+                  </UncontrolledTooltip>
+                </React.Fragment>
+              );
+            })}
+          </div>
+        </div>
+      ))}
+    </div>
+  );
+};
+
+export default QuerySourcesView;
@@ -3,6 +3,7 @@ import { mount } from 'enzyme';
 import moment from 'moment';
 import { BlockDetails, BlockDetailsProps } from './BlockDetails';
 import { sampleAPIResponse } from './__testdata__/testdata';
+import { downsamplingStatus } from './helpers';
 
 const sampleBlock = sampleAPIResponse.data.blocks[0];
 const formatTime = (time: number): string => {
@@ -12,6 +13,7 @@ const formatTime = (time: number): string => {
 describe('BlockDetails', () => {
   const defaultProps: BlockDetailsProps = {
     block: sampleBlock,
+    blocks: sampleAPIResponse.data.blocks,
     selectBlock: (): void => {
       // do nothing
     },
@@ -61,6 +63,27 @@ describe('BlockDetails', () => {
     expect(div.find('span').text()).toBe(sampleBlock.stats.numChunks.toString());
   });
 
+  it('renders the size of the block', () => {
+    const div = blockDetails.find({ 'data-testid': 'size' });
+    expect(div).toHaveLength(1);
+    expect(div.find('span').text()).toBe('unknown');
+  });
+
+  it('renders the downsampling status of the block', () => {
+    const div = blockDetails.find({ 'data-testid': 'downsampling' });
+    expect(div).toHaveLength(1);
+    expect(div.find('span').text()).toBe(downsamplingStatus(sampleBlock, sampleAPIResponse.data.blocks));
+  });
+
+  it('renders the mark buttons', () => {
+    const div = blockDetails.find({ 'data-testid': 'mark' });
+    expect(div).toHaveLength(1);
+    const buttons = div.find('button');
+    expect(buttons).toHaveLength(2);
+    expect(buttons.at(0).text()).toBe('Mark for deletion');
+    expect(buttons.at(1).text()).toBe('Mark no compaction');
+  });
+
   it('renders downsampling resolution of the block', () => {
     const div = blockDetails.find({ 'data-testid': 'resolution' });
     expect(div).toHaveLength(1);
@@ -95,4 +118,17 @@ describe('BlockDetails', () => {
     const labels = list.find('li');
     expect(labels).toHaveLength(Object.keys(sampleBlock.thanos.labels).length);
   });
+
+  it('renders a list of the annotations', () => {
+    expect(blockDetails.find({ 'data-testid': 'annotations' })).toHaveLength(0);
+
+    const annotations = { 'thanos.io/producer': 'prometheus-0', 'thanos.io/version': '0.17.0' };
+    const annotated = mount(
+      <BlockDetails {...defaultProps} block={{ ...sampleBlock, thanos: { ...sampleBlock.thanos, annotations } }} />
+    );
+    const div = annotated.find({ 'data-testid': 'annotations' });
+    expect(div).toHaveLength(1);
+    expect(div.find('li')).toHaveLength(2);
+    expect(div.find('li').first().text()).toBe('thanos.io/producer: prometheus-0');
+  });
 });
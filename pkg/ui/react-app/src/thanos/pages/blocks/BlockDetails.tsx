@@ -1,16 +1,46 @@
-import React, { FC } from 'react';
+import React, { FC, useEffect, useState } from 'react';
 import { Block } from './block';
 import styles from './blocks.module.css';
 import moment from 'moment';
-import { Button } from 'reactstrap';
-import { download } from './helpers';
+import { Button, Input, UncontrolledAlert } from 'reactstrap';
+import { blockSize, download, downsamplingStatus, humanizeBytes } from './helpers';
 
 export interface BlockDetailsProps {
   block: Block | undefined;
+  blocks: Block[];
+  pathPrefix?: string;
   selectBlock: React.Dispatch<React.SetStateAction<Block | undefined>>;
 }
 
-export const BlockDetails: FC<BlockDetailsProps> = ({ block, selectBlock }) => {
+export const BlockDetails: FC<BlockDetailsProps> = ({ block, blocks, pathPrefix = '', selectBlock }) => {
+  const [detail, setDetail] = useState('');
+  const [markResult, setMarkResult] = useState<{ ok: boolean; message: string }>();
+
+  useEffect(() => {
+    setDetail('');
+    setMarkResult(undefined);
+  }, [block]);
+
+  const markBlock = async (action: string): Promise<void> => {
+    if (!block) {
+      return;
+    }
+    const body = new URLSearchParams({ id: block.ulid, action, detail });
+    try {
+      const response = await fetch(`${pathPrefix}/api/v1/blocks/mark`, { method: 'POST', body });
+      if (response.ok) {
+        setMarkResult({ ok: true, message: `Block marked for ${action === 'DELETION' ? 'deletion' : 'no compaction'}.` });
+        return;
+      }
+      const json = await response.json();
+      setMarkResult({ ok: false, message: json.error });
+    } catch (error) {
+      setMarkResult({ ok: false, message: error.message });
+    }
+  };
+
+  const size = block && blockSize(block);
+
   return (
     <div className={`${styles.blockDetails} ${block && styles.open}`}>
       {block && (
@@ -43,10 +73,26 @@ export const BlockDetails: FC<BlockDetailsProps> = ({ block, selectBlock }) => {
           <div data-testid="chunks">
             <b>Chunks:</b> <span>{block.stats.numChunks}</span>
           </div>
+          <div data-testid="size">
+            <b>Size:</b> <span>{size === undefined ? 'unknown' : humanizeBytes(size)}</span>
+            {block.thanos.files && (
+              <ul>
+                {block.thanos.files.map(f => (
+                  <li key={f.rel_path}>
+                    <b>{f.rel_path}: </b>
+                    {f.size_bytes === undefined ? '-' : humanizeBytes(f.size_bytes)}
+                  </li>
+                ))}
+              </ul>
+            )}
+          </div>
           <hr />
           <div data-testid="resolution">
             <b>Resolution:</b> <span>{block.thanos.downsample.resolution}</span>
           </div>
+          <div data-testid="downsampling">
+            <b>Downsampling:</b> <span>{downsamplingStatus(block, blocks)}</span>
+          </div>
           <div data-testid="level">
             <b>Level:</b> <span>{block.compaction.level}</span>
           </div>
@@ -65,12 +111,44 @@ export const BlockDetails: FC<BlockDetailsProps> = ({ block, selectBlock }) => {
               ))}
             </ul>
           </div>
+          {block.thanos.annotations && (
+            <div data-testid="annotations">
+              <b>Annotations:</b>
+              <ul>
+                {Object.entries(block.thanos.annotations).map(([key, value]) => (
+                  <li key={key}>
+                    <b>{key}: </b>
+                    {value}
+                  </li>
+                ))}
+              </ul>
+            </div>
+          )}
           <hr />
           <div data-testid="download">
             <a href={download(block)} download="meta.json">
               <Button>Download meta.json</Button>
             </a>
           </div>
+          <hr />
+          <div data-testid="mark">
+            <Input
+              placeholder="Details of the marker"
+              value={detail}
+              onChange={(e: React.ChangeEvent<HTMLInputElement>): void => setDetail(e.target.value)}
+            />
+            <Button className="mt-2 mr-2" color="danger" onClick={(): Promise<void> => markBlock('DELETION')}>
+              Mark for deletion
+            </Button>
+            <Button className="mt-2" color="warning" onClick={(): Promise<void> => markBlock('NO_COMPACTION')}>
+              Mark no compaction
+            </Button>
+            {markResult && (
+              <UncontrolledAlert className="mt-2" color={markResult.ok ? 'success' : 'danger'}>
+                {markResult.message}
+              </UncontrolledAlert>
+            )}
+          </div>
         </>
       )}
     </div>
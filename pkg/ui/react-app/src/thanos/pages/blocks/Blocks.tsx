@@ -1,6 +1,6 @@
 import React, { FC, useMemo, useState } from 'react';
 import { RouteComponentProps } from '@reach/router';
-import { UncontrolledAlert } from 'reactstrap';
+import { Input, UncontrolledAlert } from 'reactstrap';
 import { useQueryParams, withDefault, NumberParam } from 'use-query-params';
 import { withStatusIndicator } from '../../../components/withStatusIndicator';
 import { useFetch } from '../../../hooks/useFetch';
@@ -8,7 +8,7 @@ import PathPrefixProps from '../../../types/PathPrefixProps';
 import { Block } from './block';
 import { SourceView } from './SourceView';
 import { BlockDetails } from './BlockDetails';
-import { sortBlocks } from './helpers';
+import { filterBlocks, sortBlocks } from './helpers';
 import styles from './blocks.module.css';
 import TimeRange from './TimeRange';
 
@@ -19,12 +19,13 @@ export interface BlockListProps {
   refreshedAt: string;
 }
 
-export const BlocksContent: FC<{ data: BlockListProps }> = ({ data }) => {
+export const BlocksContent: FC<{ data: BlockListProps } & PathPrefixProps> = ({ data, pathPrefix }) => {
   const [selectedBlock, selectBlock] = useState<Block>();
+  const [filter, setFilter] = useState('');
 
   const { blocks, label, err } = data;
 
-  const blockPools = useMemo(() => sortBlocks(blocks, label), [blocks, label]);
+  const blockPools = useMemo(() => sortBlocks(filterBlocks(blocks, filter), label), [blocks, filter, label]);
   const [gridMinTime, gridMaxTime] = useMemo(() => {
     if (!err && blocks.length > 0) {
       let gridMinTime = blocks[0].minTime;
@@ -61,6 +62,12 @@ export const BlocksContent: FC<{ data: BlockListProps }> = ({ data }) => {
       {blocks.length > 0 ? (
         <div className={styles.container}>
           <div className={styles.grid}>
+            <Input
+              className={styles.filter}
+              placeholder='Filter blocks by ULID or label, e.g. cluster="eu-1"'
+              value={filter}
+              onChange={(e: React.ChangeEvent<HTMLInputElement>): void => setFilter(e.target.value)}
+            />
             <div className={styles.sources}>
               {Object.keys(blockPools).map(pk => (
                 <SourceView
@@ -81,7 +88,7 @@ export const BlocksContent: FC<{ data: BlockListProps }> = ({ data }) => {
               onChange={setViewTime}
             />
           </div>
-          <BlockDetails selectBlock={selectBlock} block={selectedBlock} />
+          <BlockDetails selectBlock={selectBlock} block={selectedBlock} blocks={blocks} pathPrefix={pathPrefix} />
         </div>
       ) : (
         <UncontrolledAlert color="warning">No blocks found.</UncontrolledAlert>
@@ -106,6 +113,7 @@ export const Blocks: FC<RouteComponentProps & PathPrefixProps & BlocksProps> = (
   return (
     <BlocksWithStatusIndicator
       data={response.data}
+      pathPrefix={pathPrefix}
       error={badResponse ? new Error(responseStatus) : error}
       isLoading={isLoading}
     />
@@ -21,6 +21,8 @@ export interface Block {
     };
     labels: LabelSet;
     source: string;
+    files?: BlockFile[];
+    annotations?: LabelSet;
   };
   ulid: string;
   version: number;
@@ -33,3 +35,8 @@ export interface LabelSet {
 export interface BlocksPool {
   [key: string]: Block[];
 }
+
+export interface BlockFile {
+  rel_path: string;
+  size_bytes?: number;
+}
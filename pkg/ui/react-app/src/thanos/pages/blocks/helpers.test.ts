@@ -0,0 +1,63 @@
+import { Block } from './block';
+import { blockSize, downsamplingStatus, filterBlocks, getDownsampledBlocks, humanizeBytes } from './helpers';
+
+const hour = 60 * 60 * 1000;
+
+const newBlock = (ulid: string, resolution: number, minTime: number, maxTime: number, sources: string[]): Block => ({
+  compaction: { level: 2, sources },
+  maxTime,
+  minTime,
+  stats: { numChunks: 1, numSamples: 1, numSeries: 1 },
+  thanos: {
+    downsample: { resolution },
+    labels: { cluster: 'eu-1' },
+    source: 'compactor',
+  },
+  ulid,
+  version: 1,
+});
+
+describe('helpers', () => {
+  const raw = newBlock('01EEB0ZRSQDJW51W11V4R6YP4T', 0, 0, 48 * hour, ['a', 'b']);
+  const downsampled = newBlock('01EEB0ZRSQDJW51W11V4R6YP5M', 300000, 0, 48 * hour, ['b', 'a']);
+  const small = newBlock('01EEB0ZRSQDJW51W11V4R6YP6H', 0, 48 * hour, 50 * hour, ['c']);
+  const pending = newBlock('01EEB0ZRSQDJW51W11V4R6YP7H', 0, 50 * hour, 98 * hour, ['d']);
+  const blocks = [raw, downsampled, small, pending];
+
+  it('humanizes bytes', () => {
+    expect(humanizeBytes(512)).toBe('512 B');
+    expect(humanizeBytes(1536)).toBe('1.50 KiB');
+    expect(humanizeBytes(3 * 1024 * 1024 * 1024)).toBe('3.00 GiB');
+  });
+
+  it('computes the size of blocks', () => {
+    expect(blockSize(raw)).toBeUndefined();
+    expect(
+      blockSize({
+        ...raw,
+        thanos: { ...raw.thanos, files: [{ rel_path: 'index', size_bytes: 10 }, { rel_path: 'meta.json' }] },
+      })
+    ).toBe(10);
+  });
+
+  it('finds the downsampled blocks', () => {
+    expect(getDownsampledBlocks(raw, blocks)).toEqual([downsampled]);
+    expect(getDownsampledBlocks(small, blocks)).toEqual([]);
+  });
+
+  it('computes the downsampling status', () => {
+    expect(downsamplingStatus(raw, blocks)).toBe(`Downsampled to ${downsampled.ulid}`);
+    expect(downsamplingStatus(small, blocks)).toBe('Not downsampled yet: range too small');
+    expect(downsamplingStatus(pending, blocks)).toBe('Pending');
+    expect(downsamplingStatus(newBlock('01EEB0ZRSQDJW51W11V4R6YP8H', 3600000, 0, hour, ['e']), blocks)).toBe(
+      'Lowest resolution'
+    );
+  });
+
+  it('filters blocks', () => {
+    expect(filterBlocks(blocks, '')).toEqual(blocks);
+    expect(filterBlocks(blocks, 'YP5M')).toEqual([downsampled]);
+    expect(filterBlocks(blocks, 'cluster="eu-1"')).toEqual(blocks);
+    expect(filterBlocks(blocks, 'cluster="us')).toEqual([]);
+  });
+});
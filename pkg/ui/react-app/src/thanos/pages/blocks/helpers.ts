@@ -60,3 +60,64 @@ export const download = (blob: Block): string => {
 
   return url;
 };
+
+// Ranges of the blocks above which they are downsampled, by resolution.
+const downsampleRanges: { [resolution: number]: number } = {
+  0: 40 * 60 * 60 * 1000,
+  300000: 10 * 24 * 60 * 60 * 1000,
+};
+
+export const humanizeBytes = (bytes: number): string => {
+  const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+  let i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return `${i === 0 ? bytes : bytes.toFixed(2)} ${units[i]}`;
+};
+
+export const blockSize = (block: Block): number | undefined => {
+  if (!block.thanos.files || block.thanos.files.length === 0) {
+    return undefined;
+  }
+  return block.thanos.files.reduce((size, f) => size + (f.size_bytes || 0), 0);
+};
+
+// getDownsampledBlocks returns the blocks downsampled from the given block, which have the same sources.
+export const getDownsampledBlocks = (block: Block, blocks: Block[]): Block[] => {
+  const sources = [...block.compaction.sources].sort().join(',');
+  return blocks.filter(
+    b =>
+      b.thanos.downsample.resolution > block.thanos.downsample.resolution &&
+      stringify(b.thanos.labels) === stringify(block.thanos.labels) &&
+      [...b.compaction.sources].sort().join(',') === sources
+  );
+};
+
+export const downsamplingStatus = (block: Block, blocks: Block[]): string => {
+  const downsampled = getDownsampledBlocks(block, blocks);
+  if (downsampled.length > 0) {
+    return `Downsampled to ${downsampled.map(b => b.ulid).join(', ')}`;
+  }
+  const range = downsampleRanges[block.thanos.downsample.resolution];
+  if (range === undefined) {
+    return 'Lowest resolution';
+  }
+  if (block.maxTime - block.minTime < range) {
+    return 'Not downsampled yet: range too small';
+  }
+  return 'Pending';
+};
+
+// filterBlocks returns the blocks whose ULID or one of whose labels, formatted as name="value", contains the filter.
+export const filterBlocks = (blocks: Block[], filter: string): Block[] => {
+  if (filter === '') {
+    return blocks;
+  }
+  return blocks.filter(
+    b =>
+      b.ulid.includes(filter) ||
+      Object.entries(b.thanos.labels).some(([key, value]) => `${key}="${value}"`.includes(filter))
+  );
+};
@@ -1,7 +1,7 @@
 import React from 'react';
 import { mount } from 'enzyme';
 import { Button, Collapse, Table, Badge } from 'reactstrap';
-import StorePoolPanel, { StorePoolPanelProps, MAX_TIME } from './StorePoolPanel';
+import StorePoolPanel, { StorePoolPanelProps, MAX_TIME, formatHistory } from './StorePoolPanel';
 import StoreLabels from './StoreLabels';
 import { getColor } from '../../../pages/targets/target';
 import { formatTime, parseTime } from '../../../utils';
@@ -118,6 +118,12 @@ describe('StorePoolPanel', () => {
         }
       });
 
+      it('renders the health check history', () => {
+        const td = row.find({ 'data-testid': 'history' });
+        expect(td).toHaveLength(1);
+        expect(td.text()).toBe(formatHistory(store.history));
+      });
+
       it('renders a badge for Errors', () => {
         const td = row.find({ 'data-testid': 'lastError' });
         const badge = td.find(Badge);
@@ -129,4 +135,14 @@ describe('StorePoolPanel', () => {
       });
     });
   });
+
+  it('summarizes the health check history', () => {
+    expect(formatHistory()).toBe('');
+    expect(
+      formatHistory([
+        { time: '2020-01-01T00:00:00Z', duration: 0.5, error: 'connection refused' },
+        { time: '2020-01-01T00:00:05Z', duration: 0.0123, error: null },
+      ])
+    ).toBe('12.3ms (1/2 successful)');
+  });
 });
@@ -7,7 +7,7 @@ import { ToggleMoreLess } from '../../../components/ToggleMoreLess';
 import { useLocalStorage } from '../../../hooks/useLocalStorage';
 import { getColor } from '../../../pages/targets/target';
 import { formatRelative, formatTime, parseTime } from '../../../utils';
-import { Store } from './store';
+import { Store, StoreCheck } from './store';
 import StoreLabels from './StoreLabels';
 
 export type StorePoolPanelProps = { title: string; storePool: Store[] };
@@ -19,11 +19,22 @@ export const columns = [
   'Min Time',
   'Max Time',
   'Last Successful Health Check',
+  'Health Check History',
   'Last Message',
 ];
 
 export const MAX_TIME = 9223372036854775807;
 
+// formatHistory summarizes the health checks of a store with the duration of the last one and the number of successful ones.
+export const formatHistory = (history: StoreCheck[] = []): string => {
+  if (history.length === 0) {
+    return '';
+  }
+  const last = history[history.length - 1];
+  const ok = history.filter(check => !check.error).length;
+  return `${(last.duration * 1000).toFixed(1)}ms (${ok}/${history.length} successful)`;
+};
+
 export const StorePoolPanel: FC<StorePoolPanelProps> = ({ title, storePool }) => {
   const [{ expanded }, setOptions] = useLocalStorage(`store-pool-${title}-expanded`, { expanded: true });
 
@@ -43,15 +54,23 @@ export const StorePoolPanel: FC<StorePoolPanelProps> = ({ title, storePool }) =>
           </thead>
           <tbody>
             {storePool.map((store: Store) => {
-              const { name, minTime, maxTime, labelSets, lastCheck, lastError } = store;
+              const { name, minTime, maxTime, labelSets, lastCheck, lastError, dynamic, drained, history } = store;
               const health = lastError ? 'down' : 'up';
               const color = getColor(health);
 
               return (
                 <tr key={name}>
-                  <td data-testid="endpoint">{name}</td>
+                  <td data-testid="endpoint">
+                    {name}
+                    {dynamic ? <small className="text-muted"> (added at runtime)</small> : null}
+                  </td>
                   <td data-testid="health">
                     <Badge color={color}>{health.toUpperCase()}</Badge>
+                    {drained ? (
+                      <Badge color="warning" className="ml-1">
+                        DRAINED
+                      </Badge>
+                    ) : null}
                   </td>
                   <td data-testid="storeLabels">
                     <StoreLabels labelSets={labelSets} />
@@ -70,6 +89,7 @@ export const StorePoolPanel: FC<StorePoolPanelProps> = ({ title, storePool }) =>
                     )}{' '}
                     ago
                   </td>
+                  <td data-testid="history">{formatHistory(history)}</td>
                   <td data-testid="lastError">{lastError ? <Badge color={color}>{lastError}</Badge> : null}</td>
                 </tr>
               );
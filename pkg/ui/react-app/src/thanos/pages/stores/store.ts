@@ -1,5 +1,11 @@
 export type Labels = Record<string, string>;
 
+export interface StoreCheck {
+  time: string;
+  duration: number;
+  error: string | null;
+}
+
 export interface Store {
   name: string;
   minTime: number;
@@ -7,4 +13,7 @@ export interface Store {
   lastError: string | null;
   lastCheck: string;
   labelSets: Labels[];
+  dynamic?: boolean;
+  drained?: boolean;
+  history?: StoreCheck[];
 }
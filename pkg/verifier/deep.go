@@ -0,0 +1,314 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// DeepReport is the machine-readable report of the deep verification of the blocks of a bucket.
+type DeepReport struct {
+	// VerifiedBlocks is the number of verified blocks, including the corrupted ones.
+	VerifiedBlocks int `json:"verified_blocks"`
+	// CorruptedBlocks are the blocks for which issues were detected, sorted by ID.
+	CorruptedBlocks []BlockReport `json:"corrupted_blocks"`
+	// FailedBlocks are the blocks which could not be verified, e.g. because they could not be downloaded, sorted by ID.
+	FailedBlocks []BlockReport `json:"failed_blocks"`
+}
+
+// BlockReport is the result of the deep verification of a corrupted block, or the reason why a block could not be
+// verified.
+type BlockReport struct {
+	ID     ulid.ULID `json:"id"`
+	Errors []string  `json:"errors"`
+}
+
+// VerifyDeep downloads all matching blocks and verifies their meta.json against their files, the TOC and postings
+// of their index and the checksums of all their chunks, verifying up to concurrency blocks at the same time.
+// Issues of the blocks are reported, not returned, and so are the blocks which could not be verified: the returned
+// error means the verification itself failed, e.g. its context was canceled.
+func (m *Manager) VerifyDeep(ctx context.Context, idMatcher func(ulid.ULID) bool, concurrency int) (*DeepReport, error) {
+	if concurrency < 1 {
+		return nil, errors.Errorf("invalid concurrency %d", concurrency)
+	}
+	level.Info(m.Logger).Log("msg", "Starting deep verify task", "concurrency", concurrency)
+
+	metas, partial, err := m.Fetcher.Fetch(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch metas")
+	}
+
+	var (
+		mtx    sync.Mutex
+		report = &DeepReport{CorruptedBlocks: []BlockReport{}, FailedBlocks: []BlockReport{}}
+	)
+	addReport := func(id ulid.ULID, errs []string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		report.VerifiedBlocks++
+		if len(errs) > 0 {
+			report.CorruptedBlocks = append(report.CorruptedBlocks, BlockReport{ID: id, Errors: errs})
+		}
+	}
+	addFailure := func(id ulid.ULID, err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		report.FailedBlocks = append(report.FailedBlocks, BlockReport{ID: id, Errors: []string{err.Error()}})
+	}
+
+	for id, err := range partial {
+		if idMatcher != nil && !idMatcher(id) {
+			continue
+		}
+		// Blocks without meta.json might still be uploaded.
+		if errors.Cause(err) == block.ErrorSyncMetaNotFound {
+			continue
+		}
+		level.Warn(m.Logger).Log("msg", "detected corrupted meta.json", "id", id, "err", err)
+		addReport(id, []string{err.Error()})
+	}
+
+	var (
+		wg sync.WaitGroup
+		ch = make(chan *metadata.Meta)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for meta := range ch {
+				errs, err := verifyBlockDeep(ctx, m.Context, meta)
+				if err != nil {
+					if ctx.Err() == nil {
+						level.Warn(m.Logger).Log("msg", "failed to verify block", "id", meta.ULID, "err", err)
+						addFailure(meta.ULID, err)
+					}
+					continue
+				}
+				if len(errs) > 0 {
+					level.Warn(m.Logger).Log("msg", "detected corrupted block", "id", meta.ULID, "issues", len(errs))
+				} else {
+					level.Debug(m.Logger).Log("msg", "verified block", "id", meta.ULID)
+				}
+				addReport(meta.ULID, errs)
+			}
+		}()
+	}
+
+	for id, meta := range metas {
+		if idMatcher != nil && !idMatcher(id) {
+			continue
+		}
+		ch <- meta
+	}
+	close(ch)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "deep verify")
+	}
+
+	for _, reports := range [][]BlockReport{report.CorruptedBlocks, report.FailedBlocks} {
+		sort.Slice(reports, func(i, j int) bool {
+			return reports[i].ID.Compare(reports[j].ID) < 0
+		})
+	}
+	level.Info(m.Logger).Log("msg", "deep verify task completed", "verified", report.VerifiedBlocks, "corrupted", len(report.CorruptedBlocks), "failed", len(report.FailedBlocks))
+	return report, nil
+}
+
+// verifyBlockDeep downloads the block of the given meta and returns its issues.
+func verifyBlockDeep(ctx context.Context, vCtx Context, meta *metadata.Meta) (_ []string, err error) {
+	tmpdir, err := ioutil.TempDir("", fmt.Sprintf("deep-verify-block-%s-", meta.ULID))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpdir); err != nil {
+			level.Warn(vCtx.Logger).Log("msg", "failed to delete dir", "tmpdir", tmpdir, "err", err)
+		}
+	}()
+
+	bdir := filepath.Join(tmpdir, meta.ULID.String())
+	if err := block.Download(ctx, vCtx.Logger, vCtx.Bkt, meta.ULID, bdir); err != nil {
+		return nil, errors.Wrap(err, "download block")
+	}
+
+	var errs []string
+	for _, err := range verifyMeta(bdir, meta) {
+		errs = append(errs, errors.Wrap(err, "meta.json").Error())
+	}
+	if err := verifyIndexAndChunks(vCtx.Logger, bdir, meta); err != nil {
+		errs = append(errs, err.Error())
+	}
+	return errs, nil
+}
+
+// verifyMeta checks the consistency of the given meta of the given block directory.
+func verifyMeta(bdir string, meta *metadata.Meta) (errs []error) {
+	if id := filepath.Base(bdir); meta.ULID.String() != id {
+		errs = append(errs, errors.Errorf("ULID %s does not match block %s", meta.ULID, id))
+	}
+	if meta.MinTime >= meta.MaxTime {
+		errs = append(errs, errors.Errorf("invalid time range [%d, %d)", meta.MinTime, meta.MaxTime))
+	}
+	if meta.Compaction.Level < 1 {
+		errs = append(errs, errors.Errorf("invalid compaction level %d", meta.Compaction.Level))
+	}
+	if len(meta.Compaction.Sources) == 0 {
+		errs = append(errs, errors.New("no compaction sources"))
+	}
+
+	for _, f := range meta.Thanos.Files {
+		if f.RelPath == block.MetaFilename {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(bdir, f.RelPath))
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "file %s", f.RelPath))
+			continue
+		}
+		if f.SizeBytes > 0 && fi.Size() != f.SizeBytes {
+			errs = append(errs, errors.Errorf("file %s has size %d, expected %d", f.RelPath, fi.Size(), f.SizeBytes))
+		}
+	}
+	return errs
+}
+
+// verifyIndexAndChunks verifies the index of the given block directory, i.e. its TOC, the consistency of its postings
+// and series and its known issues, and reads all its chunks, verifying their checksums.
+func verifyIndexAndChunks(logger log.Logger, bdir string, meta *metadata.Meta) (err error) {
+	fn := filepath.Join(bdir, block.IndexFilename)
+
+	// Opening the index verifies its TOC checksum.
+	ir, err := index.NewFileReader(fn)
+	if err != nil {
+		return errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&err, ir, "index reader")
+
+	cr, err := chunks.NewDirReader(filepath.Join(bdir, block.ChunksDirname), downsample.NewPool())
+	if err != nil {
+		return errors.Wrap(err, "open chunks")
+	}
+	defer runutil.CloseWithErrCapture(&err, cr, "chunks reader")
+
+	if err := verifyPostings(ir); err != nil {
+		return errors.Wrap(err, "index postings")
+	}
+
+	p, err := ir.Postings(index.AllPostingsKey())
+	if err != nil {
+		return errors.Wrap(err, "get all postings")
+	}
+	var (
+		lset    labels.Labels
+		chks    []chunks.Meta
+		series  uint64
+		samples uint64
+		numChks uint64
+	)
+	for p.Next() {
+		series++
+		if err := ir.Series(p.At(), &lset, &chks); err != nil {
+			return errors.Wrapf(err, "read series %d", p.At())
+		}
+		for _, c := range chks {
+			numChks++
+			chk, err := cr.Chunk(c.Ref)
+			if err != nil {
+				return errors.Wrapf(err, "read chunk %d of series %s", c.Ref, lset)
+			}
+			samples += uint64(chk.NumSamples())
+		}
+	}
+	if err := p.Err(); err != nil {
+		return errors.Wrap(err, "iterate all postings")
+	}
+
+	if meta.Stats.NumSeries > 0 && meta.Stats.NumSeries != series {
+		return errors.Errorf("index has %d series, meta.json %d", series, meta.Stats.NumSeries)
+	}
+	if meta.Stats.NumChunks > 0 && meta.Stats.NumChunks != numChks {
+		return errors.Errorf("index has %d chunks, meta.json %d", numChks, meta.Stats.NumChunks)
+	}
+	if meta.Stats.NumSamples > 0 && meta.Stats.NumSamples != samples {
+		return errors.Errorf("chunks have %d samples, meta.json %d", samples, meta.Stats.NumSamples)
+	}
+
+	stats, err := block.GatherIndexHealthStats(logger, fn, meta.MinTime, meta.MaxTime)
+	if err != nil {
+		return errors.Wrap(err, "gather index issues")
+	}
+	return stats.AnyErr()
+}
+
+// verifyPostings checks that the postings of each label are sorted and reference series having the label.
+func verifyPostings(ir *index.Reader) error {
+	names, err := ir.LabelNames()
+	if err != nil {
+		return errors.Wrap(err, "label names")
+	}
+
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for _, name := range names {
+		values, err := ir.LabelValues(name)
+		if err != nil {
+			return errors.Wrapf(err, "label values of %s", name)
+		}
+		for _, value := range values {
+			p, err := ir.Postings(name, value)
+			if err != nil {
+				return errors.Wrapf(err, "postings of %s=%q", name, value)
+			}
+			var (
+				last  uint64
+				first = true
+			)
+			for p.Next() {
+				ref := p.At()
+				if !first && ref <= last {
+					return errors.Errorf("postings of %s=%q out of order: %d after %d", name, value, ref, last)
+				}
+				first, last = false, ref
+
+				if err := ir.Series(ref, &lset, &chks); err != nil {
+					return errors.Wrapf(err, "read series %d of postings %s=%q", ref, name, value)
+				}
+				if lset.Get(name) != value {
+					return errors.Errorf("series %s of postings %s=%q does not have the label", lset, name, value)
+				}
+			}
+			if err := p.Err(); err != nil {
+				return errors.Wrapf(err, "iterate postings of %s=%q", name, value)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestManager_VerifyDeep(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "verify-deep")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2", "b", "1")}
+	var ids []ulid.ULID
+	for i := 0; i < 3; i++ {
+		id, err := e2eutil.CreateBlock(ctx, dir, series, 100, int64(i*1000), int64((i+1)*1000), labels.FromStrings("cluster", "x"), 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String())))
+		ids = append(ids, id)
+	}
+
+	fetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil, nil, nil)
+	testutil.Ok(t, err)
+	m := NewManager(nil, logger, bkt, nil, fetcher, 0, Registry{})
+
+	_, err = m.VerifyDeep(ctx, nil, 0)
+	testutil.NotOk(t, err)
+
+	report, err := m.VerifyDeep(ctx, nil, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, &DeepReport{VerifiedBlocks: 3, CorruptedBlocks: []BlockReport{}, FailedBlocks: []BlockReport{}}, report)
+
+	// Corrupt the checksum of the last chunk of the first block and the meta.json of the second one.
+	chunksFile := path.Join(ids[0].String(), block.ChunksDirname, "000001")
+	rc, err := bkt.Get(ctx, chunksFile)
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	b[len(b)-1]++
+	testutil.Ok(t, bkt.Upload(ctx, chunksFile, bytes.NewReader(b)))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(ids[1].String(), block.MetaFilename), strings.NewReader("{")))
+
+	// The fetcher caches the metas.
+	fetcher, err = block.NewMetaFetcher(logger, 32, bkt, "", nil, nil, nil)
+	testutil.Ok(t, err)
+	m = NewManager(nil, logger, bkt, nil, fetcher, 0, Registry{})
+
+	report, err = m.VerifyDeep(ctx, nil, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, report.VerifiedBlocks)
+	testutil.Equals(t, 2, len(report.CorruptedBlocks))
+	reports := map[ulid.ULID]BlockReport{}
+	for _, r := range report.CorruptedBlocks {
+		reports[r.ID] = r
+	}
+	testutil.Equals(t, 1, len(reports[ids[0]].Errors))
+	testutil.Assert(t, strings.Contains(reports[ids[0]].Errors[0], "checksum mismatch"), reports[ids[0]].Errors[0])
+	testutil.Equals(t, 1, len(reports[ids[1]].Errors))
+	testutil.Assert(t, strings.Contains(reports[ids[1]].Errors[0], "meta.json corrupted"), reports[ids[1]].Errors[0])
+
+	// Only the matching blocks are verified.
+	report, err = m.VerifyDeep(ctx, func(id ulid.ULID) bool { return id == ids[2] }, 1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, &DeepReport{VerifiedBlocks: 1, CorruptedBlocks: []BlockReport{}, FailedBlocks: []BlockReport{}}, report)
+
+	// The blocks which cannot be downloaded are reported as failed, and the others are still verified.
+	m = NewManager(nil, logger, &failingGetBucket{Bucket: bkt, name: path.Join(ids[2].String(), block.IndexFilename)}, nil, fetcher, 0, Registry{})
+	report, err = m.VerifyDeep(ctx, nil, 1)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, report.VerifiedBlocks)
+	testutil.Equals(t, 2, len(report.CorruptedBlocks))
+	testutil.Equals(t, 1, len(report.FailedBlocks))
+	testutil.Equals(t, ids[2], report.FailedBlocks[0].ID)
+	testutil.Assert(t, strings.Contains(report.FailedBlocks[0].Errors[0], "download block"), report.FailedBlocks[0].Errors[0])
+
+	// A canceled verification fails.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.VerifyDeep(cctx, nil, 1)
+	testutil.NotOk(t, err)
+}
+
+// failingGetBucket fails to get the object with the given name.
+type failingGetBucket struct {
+	objstore.Bucket
+	name string
+}
+
+func (b *failingGetBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if name == b.name {
+		return nil, errors.New("get failed")
+	}
+	return b.Bucket.Get(ctx, name)
+}
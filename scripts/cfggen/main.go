@@ -17,14 +17,18 @@ import (
 	"github.com/pkg/errors"
 	"github.com/thanos-io/thanos/pkg/alert"
 	"github.com/thanos-io/thanos/pkg/cacheutil"
+	"github.com/thanos-io/thanos/pkg/discovery/kubernetes"
 	http_util "github.com/thanos-io/thanos/pkg/http"
 	"github.com/thanos-io/thanos/pkg/objstore/azure"
+	"github.com/thanos-io/thanos/pkg/objstore/b2"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/objstore/cos"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/thanos-io/thanos/pkg/objstore/gcs"
+	"github.com/thanos-io/thanos/pkg/objstore/hdfs"
 	"github.com/thanos-io/thanos/pkg/objstore/oss"
 	"github.com/thanos-io/thanos/pkg/objstore/s3"
+	"github.com/thanos-io/thanos/pkg/objstore/sftp"
 	"github.com/thanos-io/thanos/pkg/objstore/swift"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/queryfrontend"
@@ -33,6 +37,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/tracing/elasticapm"
 	"github.com/thanos-io/thanos/pkg/tracing/jaeger"
 	"github.com/thanos-io/thanos/pkg/tracing/lightstep"
+	"github.com/thanos-io/thanos/pkg/tracing/otlp"
 	"github.com/thanos-io/thanos/pkg/tracing/stackdriver"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 	yaml "gopkg.in/yaml.v2"
@@ -43,9 +48,12 @@ var (
 		client.AZURE:      azure.Config{},
 		client.GCS:        gcs.Config{},
 		client.S3:         s3.DefaultConfig,
-		client.SWIFT:      swift.SwiftConfig{},
+		client.SWIFT:      swift.DefaultConfig,
 		client.COS:        cos.Config{},
-		client.ALIYUNOSS:  oss.Config{},
+		client.ALIYUNOSS:  oss.DefaultConfig,
+		client.B2:         b2.DefaultConfig,
+		client.HDFS:       hdfs.DefaultConfig,
+		client.SFTP:       sftp.DefaultConfig,
 		client.FILESYSTEM: filesystem.Config{},
 	}
 	tracingConfigs = map[trclient.TracingProvider]interface{}{
@@ -53,15 +61,18 @@ var (
 		trclient.STACKDRIVER: stackdriver.Config{},
 		trclient.ELASTIC_APM: elasticapm.Config{},
 		trclient.LIGHTSTEP:   lightstep.Config{},
+		trclient.OTLP:        otlp.DefaultConfig,
 	}
 	indexCacheConfigs = map[storecache.IndexCacheProvider]interface{}{
 		storecache.INMEMORY:  storecache.InMemoryIndexCacheConfig{},
 		storecache.MEMCACHED: cacheutil.MemcachedClientConfig{},
+		storecache.REDIS:     cacheutil.RedisClientConfig{},
 	}
 
 	queryfrontendCacheConfigs = map[queryfrontend.ResponseCacheProvider]interface{}{
 		queryfrontend.INMEMORY:  queryfrontend.InMemoryResponseCacheConfig{},
 		queryfrontend.MEMCACHED: queryfrontend.MemcachedResponseCacheConfig{},
+		queryfrontend.REDIS:     queryfrontend.RedisResponseCacheConfig{},
 	}
 )
 
@@ -106,6 +117,7 @@ func main() {
 
 	alertmgrCfg := alert.DefaultAlertmanagerConfig()
 	alertmgrCfg.EndpointsConfig.FileSDConfigs = []http_util.FileSDConfig{{}}
+	alertmgrCfg.EndpointsConfig.KubernetesSDConfigs = []kubernetes.SDConfig{{}}
 	if err := generate(alert.AlertingConfig{Alertmanagers: []alert.AlertmanagerConfig{alertmgrCfg}}, "rule_alerting", *outputDir); err != nil {
 		level.Error(logger).Log("msg", "failed to generate", "type", "rule_alerting", "err", err)
 		os.Exit(1)
@@ -113,6 +125,7 @@ func main() {
 
 	queryCfg := query.DefaultConfig()
 	queryCfg.EndpointsConfig.FileSDConfigs = []http_util.FileSDConfig{{}}
+	queryCfg.EndpointsConfig.KubernetesSDConfigs = []kubernetes.SDConfig{{}}
 	if err := generate([]query.Config{queryCfg}, "rule_query", *outputDir); err != nil {
 		level.Error(logger).Log("msg", "failed to generate", "type", "rule_query", "err", err)
 		os.Exit(1)
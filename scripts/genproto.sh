@@ -25,7 +25,7 @@ PATH=${PATH}:/tmp/protobin
 GOGOPROTO_ROOT="$(GO111MODULE=on go list -modfile=.bingo/protoc-gen-gogofast.mod -f '{{ .Dir }}' -m github.com/gogo/protobuf)"
 GOGOPROTO_PATH="${GOGOPROTO_ROOT}:${GOGOPROTO_ROOT}/protobuf"
 
-DIRS="store/storepb/ store/storepb/prompb/ store/labelpb rules/rulespb store/hintspb queryfrontend"
+DIRS="store/storepb/ store/storepb/prompb/ store/labelpb rules/rulespb targets/targetspb metadata/metadatapb store/hintspb queryfrontend tracing/otlp/otlppb"
 echo "generating code"
 pushd "pkg"
 for dir in ${DIRS}; do
@@ -21,6 +21,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/thanos-io/thanos/pkg/alert"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/queryfrontend"
@@ -322,6 +323,21 @@ receivers:
 }
 
 func NewStoreGW(sharedDir string, name string, bucketConfig client.BucketConfig, relabelConfig ...relabel.Config) (*Service, error) {
+	return newStoreGW(sharedDir, name, bucketConfig, relabelConfig, nil)
+}
+
+// NewStoreGWWithFaults returns a store gateway injecting the given faults into the operations on its bucket.
+func NewStoreGWWithFaults(sharedDir string, name string, bucketConfig client.BucketConfig, faults objstore.FaultConfig) (*Service, error) {
+	faultsConfigBytes, err := yaml.Marshal(faults)
+	if err != nil {
+		return nil, errors.Wrapf(err, "generate store faults config file: %v", faults)
+	}
+	return newStoreGW(sharedDir, name, bucketConfig, nil, map[string]string{
+		"--debug.objstore-faults.config": string(faultsConfigBytes),
+	})
+}
+
+func newStoreGW(sharedDir string, name string, bucketConfig client.BucketConfig, relabelConfig []relabel.Config, extArgs map[string]string) (*Service, error) {
 	dir := filepath.Join(sharedDir, "data", "store", name)
 	container := filepath.Join(e2e.ContainerSharedDir, "data", "store", name)
 	if err := os.MkdirAll(dir, 0777); err != nil {
@@ -338,24 +354,29 @@ func NewStoreGW(sharedDir string, name string, bucketConfig client.BucketConfig,
 		return nil, errors.Wrapf(err, "generate store relabel file: %v", relabelConfig)
 	}
 
+	args := map[string]string{
+		"--debug.name":        fmt.Sprintf("store-gw-%v", name),
+		"--grpc-address":      ":9091",
+		"--grpc-grace-period": "0s",
+		"--http-address":      ":8080",
+		"--log.level":         logLevel,
+		"--data-dir":          container,
+		"--objstore.config":   string(bktConfigBytes),
+		// Accelerated sync time for quicker test (3m by default).
+		"--sync-block-duration":               "3s",
+		"--block-sync-concurrency":            "1",
+		"--store.grpc.series-max-concurrency": "1",
+		"--selector.relabel-config":           string(relabelConfigBytes),
+		"--consistency-delay":                 "30m",
+	}
+	for k, v := range extArgs {
+		args[k] = v
+	}
+
 	store := NewService(
 		fmt.Sprintf("store-gw-%v", name),
 		DefaultImage(),
-		e2e.NewCommand("store", e2e.BuildArgs(map[string]string{
-			"--debug.name":        fmt.Sprintf("store-gw-%v", name),
-			"--grpc-address":      ":9091",
-			"--grpc-grace-period": "0s",
-			"--http-address":      ":8080",
-			"--log.level":         logLevel,
-			"--data-dir":          container,
-			"--objstore.config":   string(bktConfigBytes),
-			// Accelerated sync time for quicker test (3m by default).
-			"--sync-block-duration":               "3s",
-			"--block-sync-concurrency":            "1",
-			"--store.grpc.series-max-concurrency": "1",
-			"--selector.relabel-config":           string(relabelConfigBytes),
-			"--consistency-delay":                 "30m",
-		})...),
+		e2e.NewCommand("store", e2e.BuildArgs(args)...),
 		e2e.NewHTTPReadinessProbe(8080, "/-/ready", 200, 200),
 		8080,
 		9091,
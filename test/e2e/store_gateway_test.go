@@ -246,3 +246,93 @@ func TestStoreGateway(t *testing.T) {
 
 	// TODO(khyati) Let's add some case for compaction-meta.json once the PR will be merged: https://github.com/thanos-io/thanos/pull/2136.
 }
+
+func TestStoreGatewayFaultyBucket(t *testing.T) {
+	t.Parallel()
+
+	s, err := e2e.NewScenario("e2e_test_store_gateway_faults")
+	testutil.Ok(t, err)
+	t.Cleanup(e2ethanos.CleanScenario(t, s))
+
+	m := e2edb.NewMinio(8080, "thanos")
+	testutil.Ok(t, s.StartAndWaitReady(m))
+
+	// The faults are overcome by the retries, so the queries are answered with all the data.
+	s1, err := e2ethanos.NewStoreGWWithFaults(s.SharedDir(), "1", client.BucketConfig{
+		Type: client.S3,
+		Config: s3.Config{
+			Bucket:    "thanos",
+			AccessKey: e2edb.MinioAccessKey,
+			SecretKey: e2edb.MinioSecretKey,
+			Endpoint:  m.NetworkHTTPEndpoint(),
+			Insecure:  true,
+		},
+		Retries: objstore.RetryConfig{
+			MaxAttempts: 20,
+			MinBackoff:  model.Duration(10 * time.Millisecond),
+			MaxBackoff:  model.Duration(100 * time.Millisecond),
+		},
+	}, objstore.FaultConfig{
+		Get: objstore.OperationFaults{
+			ErrorRate:       0.2,
+			ThrottleRate:    0.1,
+			PartialReadRate: 0.2,
+			Latency:         model.Duration(10 * time.Millisecond),
+		},
+		Iter: objstore.OperationFaults{ErrorRate: 0.2},
+	})
+	testutil.Ok(t, err)
+	testutil.Ok(t, s.StartAndWaitReady(s1))
+
+	q, err := e2ethanos.NewQuerier(s.SharedDir(), "1", []string{s1.GRPCNetworkEndpoint()}, nil, nil, "", "")
+	testutil.Ok(t, err)
+	testutil.Ok(t, s.StartAndWaitReady(q))
+
+	dir := filepath.Join(s.SharedDir(), "tmp")
+	testutil.Ok(t, os.MkdirAll(dir, os.ModePerm))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	t.Cleanup(cancel)
+
+	series := []labels.Labels{labels.FromStrings("a", "1", "b", "2")}
+	now := time.Now()
+	l := log.NewLogfmtLogger(os.Stdout)
+	bkt, err := s3.NewBucketWithConfig(l, s3.Config{
+		Bucket:    "thanos",
+		AccessKey: e2edb.MinioAccessKey,
+		SecretKey: e2edb.MinioSecretKey,
+		Endpoint:  m.HTTPEndpoint(), // We need separate client config, when connecting to minio from outside.
+		Insecure:  true,
+	}, "test-feed")
+	testutil.Ok(t, err)
+	for _, replica := range []string{"1", "2"} {
+		id, err := e2eutil.CreateBlockWithBlockDelay(ctx, dir, series, 100, timestamp.FromTime(now), timestamp.FromTime(now.Add(2*time.Hour)), 30*time.Minute, labels.FromStrings("ext1", "value1", "replica", replica), 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, objstore.UploadDir(ctx, l, bkt, path.Join(dir, id.String()), id.String()))
+	}
+
+	testutil.Ok(t, s1.WaitSumMetrics(e2e.Equals(2), "thanos_bucket_store_blocks_loaded"))
+	testutil.Ok(t, s1.WaitSumMetrics(e2e.Equals(0), "thanos_bucket_store_block_load_failures_total"))
+
+	for i := 0; i < 5; i++ {
+		queryAndAssertSeries(t, ctx, q.HTTPEndpoint(), "{a=\"1\"}",
+			promclient.QueryOptions{
+				Deduplicate: false,
+			},
+			[]model.Metric{
+				{
+					"a":       "1",
+					"b":       "2",
+					"ext1":    "value1",
+					"replica": "1",
+				},
+				{
+					"a":       "1",
+					"b":       "2",
+					"ext1":    "value1",
+					"replica": "2",
+				},
+			},
+		)
+	}
+}